@@ -84,6 +84,7 @@ for uid_index in 0 1 2; do
     -tablet-path $alias \
     -init_keyspace $keyspace \
     -init_shard $shard \
+    -init_populate_metadata \
     -target_tablet_type replica \
     -enable-rowcache \
     -rowcache-bin $memcached_path \
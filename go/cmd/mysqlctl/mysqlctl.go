@@ -17,6 +17,7 @@ import (
 	"github.com/youtube/vitess/go/vt/logutil"
 	"github.com/youtube/vitess/go/vt/mysqlctl"
 	myproto "github.com/youtube/vitess/go/vt/mysqlctl/proto"
+	"golang.org/x/net/context"
 
 	// import mysql to register mysql connection function
 	_ "github.com/youtube/vitess/go/mysql"
@@ -36,17 +37,30 @@ func initCmd(mysqld *mysqlctl.Mysqld, subFlags *flag.FlagSet, args []string) err
 	bootstrapArchive := subFlags.String("bootstrap_archive", "mysql-db-dir.tbz", "name of bootstrap archive within vitess/data/bootstrap directory")
 	subFlags.Parse(args)
 
-	if err := mysqld.Init(*waitTime, *bootstrapArchive); err != nil {
+	ctx, cancel := context.WithTimeout(context.Background(), *waitTime)
+	defer cancel()
+	if err := mysqld.Init(ctx, *bootstrapArchive); err != nil {
 		return fmt.Errorf("failed init mysql: %v", err)
 	}
 	return nil
 }
 
+func initConfigCmd(mysqld *mysqlctl.Mysqld, subFlags *flag.FlagSet, args []string) error {
+	subFlags.Parse(args)
+
+	if err := mysqld.InitConfig(); err != nil {
+		return fmt.Errorf("failed to init mysql config: %v", err)
+	}
+	return nil
+}
+
 func shutdownCmd(mysqld *mysqlctl.Mysqld, subFlags *flag.FlagSet, args []string) error {
 	waitTime := subFlags.Duration("wait_time", mysqlctl.MysqlWaitTime, "how long to wait for shutdown")
 	subFlags.Parse(args)
 
-	if err := mysqld.Shutdown(true, *waitTime); err != nil {
+	ctx, cancel := context.WithTimeout(context.Background(), *waitTime)
+	defer cancel()
+	if err := mysqld.Shutdown(ctx, true); err != nil {
 		return fmt.Errorf("failed shutdown mysql: %v", err)
 	}
 	return nil
@@ -56,7 +70,9 @@ func startCmd(mysqld *mysqlctl.Mysqld, subFlags *flag.FlagSet, args []string) er
 	waitTime := subFlags.Duration("wait_time", mysqlctl.MysqlWaitTime, "how long to wait for startup")
 	subFlags.Parse(args)
 
-	if err := mysqld.Start(*waitTime); err != nil {
+	ctx, cancel := context.WithTimeout(context.Background(), *waitTime)
+	defer cancel()
+	if err := mysqld.Start(ctx); err != nil {
 		return fmt.Errorf("failed start mysql: %v", err)
 	}
 	return nil
@@ -117,6 +133,8 @@ type command struct {
 var commands = []command{
 	command{"init", initCmd, "[-wait_time=20s] [-bootstrap_archive=mysql-db-dir.tbz]",
 		"Initalizes the directory structure and starts mysqld"},
+	command{"init_config", initConfigCmd, "",
+		"Initalizes the directory structure and creates my.cnf, without a database nor starting mysqld. Used before restoring from a backup"},
 	command{"teardown", teardownCmd, "[-force]",
 		"Shuts mysqld down, and removes the directory"},
 	command{"start", startCmd, "[-wait_time=20s]",
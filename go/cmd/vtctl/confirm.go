@@ -0,0 +1,32 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// stdinIsTerminal returns true if a user can answer the confirmations
+// of the commands: scripts that pipe into vtctl are not asked.
+func stdinIsTerminal() bool {
+	fi, err := os.Stdin.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// confirmAtTerminal is the vtctl.Confirmer of a local vtctl.
+func confirmAtTerminal(prompt, answer string) error {
+	fmt.Fprint(os.Stderr, prompt)
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("cannot read the confirmation: %v", err)
+	}
+	if strings.TrimSpace(line) != answer {
+		return fmt.Errorf("confirmation failed: typed %q instead of %q", strings.TrimSpace(line), answer)
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/vt/logutil"
+	"github.com/youtube/vitess/go/vt/vtctl/vtctlclient"
+	"golang.org/x/net/context"
+)
+
+// This file contains the -server mode of vtctl, where the commands run
+// as jobs on a vtctld, and keep running if vtctl goes away.
+
+var (
+	server      = flag.String("server", "", "if set, the vtctld to run the command on. vtctld runs it even if vtctl goes away: vtctl prints the id of its job, then follows its logs until it is done, which 'vtctl -server <vtctld> WaitForJob <job id>' can resume")
+	detach      = flag.Bool("detach", false, "with -server, only print the job id once the command is submitted, and return")
+	dialTimeout = flag.Duration("dial-timeout", 30*time.Second, "with -server, time to wait to connect to vtctld")
+)
+
+// runRemote runs a command on vtctld. WaitForJob follows a job
+// started earlier.
+func runRemote(ctx context.Context, args []string) error {
+	client, err := vtctlclient.New(*server, *dialTimeout)
+	if err != nil {
+		return fmt.Errorf("cannot dial to vtctld %v: %v", *server, err)
+	}
+	defer client.Close()
+
+	var jobID int64
+	if args[0] == "WaitForJob" {
+		if len(args) != 2 {
+			return fmt.Errorf("action WaitForJob requires <job id>")
+		}
+		if jobID, err = strconv.ParseInt(args[1], 10, 64); err != nil {
+			return fmt.Errorf("invalid job id %v: %v", args[1], err)
+		}
+	} else {
+		if jobID, err = client.SubmitVtctlCommand(ctx, args, *waitTime, *lockWaitTimeout); err != nil {
+			return fmt.Errorf("cannot submit the command to vtctld %v: %v", *server, err)
+		}
+		if *detach {
+			fmt.Printf("%v\n", jobID)
+			return nil
+		}
+		fmt.Fprintf(os.Stderr, "Running as job %v on %v, 'WaitForJob %v' follows it again if vtctl stops\n", jobID, *server, jobID)
+	}
+
+	// the error is only set once all the events are received
+	events, errFunc := client.WaitForJob(ctx, jobID)
+	for e := range events {
+		switch e.Level {
+		case logutil.LOGGER_INFO:
+			log.Info(e.String())
+		case logutil.LOGGER_WARNING:
+			log.Warning(e.String())
+		case logutil.LOGGER_ERROR:
+			log.Error(e.String())
+		case logutil.LOGGER_CONSOLE:
+			fmt.Print(e.Value)
+		}
+	}
+	if err := errFunc(); err != nil {
+		return fmt.Errorf("job %v: %v", jobID, err)
+	}
+	return nil
+}
@@ -78,6 +78,18 @@ func main() {
 		log.Warningf("cannot connect to syslog: %v", err)
 	}
 
+	if *server != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), *waitTime)
+		installSignalHandlers(cancel)
+		err := runRemote(ctx, args)
+		cancel()
+		if err != nil {
+			log.Errorf("action failed: %v %v", action, err)
+			exit.Return(255)
+		}
+		return
+	}
+
 	topoServer := topo.GetServer()
 	defer topo.CloseServers()
 
@@ -88,6 +100,9 @@ func main() {
 	for _, f := range initFuncs {
 		f()
 	}
+	if stdinIsTerminal() {
+		vtctl.RegisterConfirmer(confirmAtTerminal)
+	}
 
 	err := vtctl.RunCommand(ctx, wr, args)
 	cancel()
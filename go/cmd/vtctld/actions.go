@@ -1,12 +1,18 @@
 package main
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"flag"
+	"fmt"
 	"html/template"
 	"net/http"
 	"net/url"
 	"strings"
+	"sync"
+	"time"
 
+	log "github.com/golang/glog"
 	"github.com/youtube/vitess/go/acl"
 	"github.com/youtube/vitess/go/vt/logutil"
 	"github.com/youtube/vitess/go/vt/tabletmanager/actionnode"
@@ -17,21 +23,56 @@ import (
 )
 
 var (
-	actionTimeout = flag.Duration("action_timeout", wrangler.DefaultActionTimeout, "time to wait for an action before resorting to force")
-	lockTimeout   = flag.Duration("lock_timeout", actionnode.DefaultLockTimeout, "lock time for wrangler/topo operations")
+	actionTimeout    = flag.Duration("action_timeout", wrangler.DefaultActionTimeout, "time to wait for an action before resorting to force")
+	lockTimeout      = flag.Duration("lock_timeout", actionnode.DefaultLockTimeout, "lock time for wrangler/topo operations")
+	actionUserHeader = flag.String("action_user_header", "X-Forwarded-User", "http header with the acting user, for the action authorizer and the topo action log")
 )
 
+// confirmTokenTTL is how long a destructive action can be confirmed
+// after it was asked for.
+const confirmTokenTTL = 5 * time.Minute
+
 // ActionResult contains the result of an action. If Error, the aciton failed.
 type ActionResult struct {
 	Name       string
 	Parameters string
 	Output     string
 	Error      bool
+
+	// ConfirmToken is set if the action is destructive and did not
+	// run: asking for it again with confirm=<ConfirmToken> runs it.
+	ConfirmToken string
+
+	// status is the http status for the API.
+	status int
 }
 
 func (ar *ActionResult) error(text string) {
+	ar.fail(http.StatusInternalServerError, text)
+}
+
+func (ar *ActionResult) fail(status int, text string) {
 	ar.Error = true
 	ar.Output = text
+	ar.status = status
+}
+
+// ActionAuthorizer returns an error if user may not run action on
+// target, a keyspace, a keyspace/shard or a tablet alias. user comes
+// from the -action_user_header header of the request, and is empty if
+// the header is not set.
+type ActionAuthorizer func(user, action, target string) error
+
+var actionAuthorizer ActionAuthorizer
+
+// RegisterActionAuthorizer sets the authorizer called before each
+// action, from the init of a plugin. Without one, all actions are
+// allowed, subject to the acl role of the tablet actions.
+func RegisterActionAuthorizer(authorizer ActionAuthorizer) {
+	if actionAuthorizer != nil {
+		log.Fatalf("an ActionAuthorizer is already registered")
+	}
+	actionAuthorizer = authorizer
 }
 
 // action{Keyspace,Shard,Tablet}Method is a function that performs
@@ -44,18 +85,35 @@ type actionShardMethod func(ctx context.Context, wr *wrangler.Wrangler, keyspace
 
 type actionTabletMethod func(ctx context.Context, wr *wrangler.Wrangler, tabletAlias topo.TabletAlias, r *http.Request) (output string, err error)
 
+type actionShardRecord struct {
+	destructive bool
+	method      actionShardMethod
+}
+
 type actionTabletRecord struct {
-	role   string
-	method actionTabletMethod
+	role        string
+	destructive bool
+	method      actionTabletMethod
+}
+
+// confirmation is a destructive action waiting to be confirmed.
+type confirmation struct {
+	action string
+	target string
+	expire time.Time
 }
 
 // ActionRepository is a repository of actions that can be performed
 // on a {Keyspace,Shard,Tablet}.
 type ActionRepository struct {
 	keyspaceActions map[string]actionKeyspaceMethod
-	shardActions    map[string]actionShardMethod
+	shardActions    map[string]actionShardRecord
 	tabletActions   map[string]actionTabletRecord
 	ts              topo.Server
+
+	// mu protects confirmations, by token.
+	mu            sync.Mutex
+	confirmations map[string]confirmation
 }
 
 // NewActionRepository creates and returns a new ActionRepository,
@@ -63,9 +121,10 @@ type ActionRepository struct {
 func NewActionRepository(ts topo.Server) *ActionRepository {
 	return &ActionRepository{
 		keyspaceActions: make(map[string]actionKeyspaceMethod),
-		shardActions:    make(map[string]actionShardMethod),
+		shardActions:    make(map[string]actionShardRecord),
 		tabletActions:   make(map[string]actionTabletRecord),
 		ts:              ts,
+		confirmations:   make(map[string]confirmation),
 	}
 }
 
@@ -74,16 +133,22 @@ func (ar *ActionRepository) RegisterKeyspaceAction(name string, method actionKey
 	ar.keyspaceActions[name] = method
 }
 
-// RegisterShardAction registers a new action on a shard.
-func (ar *ActionRepository) RegisterShardAction(name string, method actionShardMethod) {
-	ar.shardActions[name] = method
+// RegisterShardAction registers a new action on a shard. A destructive
+// action only runs once confirmed.
+func (ar *ActionRepository) RegisterShardAction(name string, destructive bool, method actionShardMethod) {
+	ar.shardActions[name] = actionShardRecord{
+		destructive: destructive,
+		method:      method,
+	}
 }
 
-// RegisterTabletAction registers a new action on a tablet.
-func (ar *ActionRepository) RegisterTabletAction(name, role string, method actionTabletMethod) {
+// RegisterTabletAction registers a new action on a tablet. A destructive
+// action only runs once confirmed.
+func (ar *ActionRepository) RegisterTabletAction(name, role string, destructive bool, method actionTabletMethod) {
 	ar.tabletActions[name] = actionTabletRecord{
-		role:   role,
-		method: method,
+		role:        role,
+		destructive: destructive,
+		method:      method,
 	}
 }
 
@@ -93,20 +158,13 @@ func (ar *ActionRepository) ApplyKeyspaceAction(actionName, keyspace string, r *
 
 	action, ok := ar.keyspaceActions[actionName]
 	if !ok {
-		result.error("Unknown keyspace action")
+		result.fail(http.StatusNotFound, "Unknown keyspace action")
 		return result
 	}
 
-	// FIXME(alainjobart) copy web context info
-	ctx, cancel := context.WithTimeout(context.TODO(), *actionTimeout)
-	wr := wrangler.New(logutil.NewConsoleLogger(), ar.ts, tmclient.NewTabletManagerClient(), *lockTimeout)
-	output, err := action(ctx, wr, keyspace, r)
-	cancel()
-	if err != nil {
-		result.error(err.Error())
-		return result
-	}
-	result.Output = output
+	ar.apply(result, r, false, keyspace, "", func(ctx context.Context, wr *wrangler.Wrangler) (string, error) {
+		return action(ctx, wr, keyspace, r)
+	})
 	return result
 }
 
@@ -121,20 +179,13 @@ func (ar *ActionRepository) ApplyShardAction(actionName, keyspace, shard string,
 
 	action, ok := ar.shardActions[actionName]
 	if !ok {
-		result.error("Unknown shard action")
+		result.fail(http.StatusNotFound, "Unknown shard action")
 		return result
 	}
 
-	// FIXME(alainjobart) copy web context info
-	ctx, cancel := context.WithTimeout(context.TODO(), *actionTimeout)
-	wr := wrangler.New(logutil.NewConsoleLogger(), ar.ts, tmclient.NewTabletManagerClient(), *lockTimeout)
-	output, err := action(ctx, wr, keyspace, shard, r)
-	cancel()
-	if err != nil {
-		result.error(err.Error())
-		return result
-	}
-	result.Output = output
+	ar.apply(result, r, action.destructive, keyspace, shard, func(ctx context.Context, wr *wrangler.Wrangler) (string, error) {
+		return action.method(ctx, wr, keyspace, shard, r)
+	})
 	return result
 }
 
@@ -144,35 +195,141 @@ func (ar *ActionRepository) ApplyTabletAction(actionName string, tabletAlias top
 
 	action, ok := ar.tabletActions[actionName]
 	if !ok {
-		result.error("Unknown tablet action")
+		result.fail(http.StatusNotFound, "Unknown tablet action")
 		return result
 	}
 
 	// check the role
 	if action.role != "" {
 		if err := acl.CheckAccessHTTP(r, action.role); err != nil {
-			result.error("Access denied")
+			result.fail(http.StatusForbidden, "Access denied")
 			return result
 		}
 	}
 
-	// run the action
+	// the action is logged in the shard of the tablet, read before
+	// the action as it may delete the tablet
+	ti, err := ar.ts.GetTablet(tabletAlias)
+	if err != nil {
+		if err == topo.ErrNoNode {
+			result.fail(http.StatusNotFound, "Unknown tablet")
+		} else {
+			result.fail(http.StatusBadGateway, fmt.Sprintf("cannot read tablet: %v", err))
+		}
+		return result
+	}
+
+	ar.apply(result, r, action.destructive, ti.Keyspace, ti.Shard, func(ctx context.Context, wr *wrangler.Wrangler) (string, error) {
+		return action.method(ctx, wr, tabletAlias, r)
+	})
+	return result
+}
+
+// apply runs an action, once authorized and, if destructive,
+// confirmed, and records it in the action log of keyspace, or of
+// keyspace/shard if shard is set.
+func (ar *ActionRepository) apply(result *ActionResult, r *http.Request, destructive bool, keyspace, shard string, run func(ctx context.Context, wr *wrangler.Wrangler) (string, error)) {
+	user := r.Header.Get(*actionUserHeader)
+	if actionAuthorizer != nil {
+		if err := actionAuthorizer(user, result.Name, result.Parameters); err != nil {
+			result.fail(http.StatusForbidden, fmt.Sprintf("Access denied: %v", err))
+			return
+		}
+	}
+	if destructive && !ar.confirm(r.FormValue("confirm"), result.Name, result.Parameters) {
+		result.ConfirmToken = ar.newConfirmToken(result.Name, result.Parameters)
+		result.Output = fmt.Sprintf("%v on %v needs to be confirmed", result.Name, result.Parameters)
+		result.status = http.StatusPreconditionFailed
+		return
+	}
+
 	// FIXME(alainjobart) copy web context info
 	ctx, cancel := context.WithTimeout(context.TODO(), *actionTimeout)
 	wr := wrangler.New(logutil.NewConsoleLogger(), ar.ts, tmclient.NewTabletManagerClient(), *lockTimeout)
-	output, err := action.method(ctx, wr, tabletAlias, r)
+	job := wr.StartJob(wrangler.DefaultJobRegistry, result.Name+" "+result.Parameters)
+	output, err := run(ctx, wr)
+	job.Finish(err)
 	cancel()
+	ar.logAction(result.Name, result.Parameters, user, keyspace, shard, err)
 	if err != nil {
 		result.error(err.Error())
-		return result
+		return
 	}
 	result.Output = output
-	return result
+}
+
+// logAction records an action in the topo action log of its
+// keyspace or shard. It only logs the errors: the action already ran.
+func (ar *ActionRepository) logAction(action, target, user, keyspace, shard string, actionErr error) {
+	if keyspace == "" {
+		log.Warningf("%v on %v by '%v' has no keyspace to log the action in", action, target, user)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.TODO(), *lockTimeout)
+	defer cancel()
+	node := actionnode.VtctldAction(action, target, user)
+	if shard == "" {
+		lockPath, err := node.LockKeyspace(ctx, ar.ts, keyspace)
+		if err == nil {
+			err = node.UnlockKeyspace(ctx, ar.ts, keyspace, lockPath, actionErr)
+		}
+		if err != nil && err != actionErr {
+			log.Warningf("cannot log %v on %v in keyspace %v: %v", action, target, keyspace, err)
+		}
+		return
+	}
+	lockPath, err := node.LockShard(ctx, ar.ts, keyspace, shard)
+	if err == nil {
+		err = node.UnlockShard(ctx, ar.ts, keyspace, shard, lockPath, actionErr)
+	}
+	if err != nil && err != actionErr {
+		log.Warningf("cannot log %v on %v in shard %v/%v: %v", action, target, keyspace, shard, err)
+	}
+}
+
+// newConfirmToken returns a token that confirms action on target,
+// once, for confirmTokenTTL.
+func (ar *ActionRepository) newConfirmToken(action, target string) string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		log.Fatalf("cannot generate a confirm token: %v", err)
+	}
+	token := hex.EncodeToString(b)
+
+	ar.mu.Lock()
+	defer ar.mu.Unlock()
+	now := time.Now()
+	for t, c := range ar.confirmations {
+		if now.After(c.expire) {
+			delete(ar.confirmations, t)
+		}
+	}
+	ar.confirmations[token] = confirmation{
+		action: action,
+		target: target,
+		expire: now.Add(confirmTokenTTL),
+	}
+	return token
+}
+
+// confirm uses up token, and returns true if it confirms action on target.
+func (ar *ActionRepository) confirm(token, action, target string) bool {
+	if token == "" {
+		return false
+	}
+	ar.mu.Lock()
+	defer ar.mu.Unlock()
+	c, ok := ar.confirmations[token]
+	if !ok {
+		return false
+	}
+	delete(ar.confirmations, token)
+	return c.action == action && c.target == target && time.Now().Before(c.expire)
 }
 
 // PopulateKeyspaceActions populates result with actions that can be
 // performed on the keyspace.
-func (ar ActionRepository) PopulateKeyspaceActions(actions map[string]template.URL, keyspace string) {
+func (ar *ActionRepository) PopulateKeyspaceActions(actions map[string]template.URL, keyspace string) {
 	for name := range ar.keyspaceActions {
 		values := url.Values{}
 		values.Set("action", name)
@@ -183,7 +340,7 @@ func (ar ActionRepository) PopulateKeyspaceActions(actions map[string]template.U
 
 // PopulateShardActions populates result with actions that can be
 // performed on the shard.
-func (ar ActionRepository) PopulateShardActions(actions map[string]template.URL, keyspace, shard string) {
+func (ar *ActionRepository) PopulateShardActions(actions map[string]template.URL, keyspace, shard string) {
 	for name := range ar.shardActions {
 		values := url.Values{}
 		values.Set("action", name)
@@ -195,7 +352,7 @@ func (ar ActionRepository) PopulateShardActions(actions map[string]template.URL,
 
 // PopulateTabletActions populates result with actions that can be
 // performed on the tablet.
-func (ar ActionRepository) PopulateTabletActions(actions map[string]template.URL, tabletAlias string, r *http.Request) {
+func (ar *ActionRepository) PopulateTabletActions(actions map[string]template.URL, tabletAlias string, r *http.Request) {
 	for name, value := range ar.tabletActions {
 		// check we are authorized for the role we need
 		if value.role != "" {
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/vt/wrangler"
+	"github.com/youtube/vitess/go/vt/zktopo"
+	"golang.org/x/net/context"
+)
+
+func newActionRequest(t *testing.T, user, confirm string) *http.Request {
+	r, err := http.NewRequest("POST", "/tablet_actions?confirm="+confirm, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Header.Set("X-Forwarded-User", user)
+	return r
+}
+
+func TestActionRepository(t *testing.T) {
+	ts := zktopo.NewTestServer(t, []string{"cell1"})
+	if err := ts.CreateKeyspace("ks1", &topo.Keyspace{}); err != nil {
+		t.Fatalf("CreateKeyspace failed: %v", err)
+	}
+	if err := ts.CreateShard("ks1", "-80", &topo.Shard{Cells: []string{"cell1"}}); err != nil {
+		t.Fatalf("CreateShard failed: %v", err)
+	}
+	tabletAlias := topo.TabletAlias{Cell: "cell1", Uid: 100}
+	if err := ts.CreateTablet(&topo.Tablet{
+		Alias:    tabletAlias,
+		Keyspace: "ks1",
+		Shard:    "-80",
+		Type:     topo.TYPE_SPARE,
+	}); err != nil {
+		t.Fatalf("CreateTablet failed: %v", err)
+	}
+
+	ar := NewActionRepository(ts)
+	runs := 0
+	ar.RegisterTabletAction("Refresh", "", false,
+		func(ctx context.Context, wr *wrangler.Wrangler, tabletAlias topo.TabletAlias, r *http.Request) (string, error) {
+			runs++
+			return "refreshed", nil
+		})
+	ar.RegisterTabletAction("Wipe", "", true,
+		func(ctx context.Context, wr *wrangler.Wrangler, tabletAlias topo.TabletAlias, r *http.Request) (string, error) {
+			runs++
+			return "wiped", nil
+		})
+	ar.RegisterShardAction("Break", false,
+		func(ctx context.Context, wr *wrangler.Wrangler, keyspace, shard string, r *http.Request) (string, error) {
+			runs++
+			return "", fmt.Errorf("broken")
+		})
+
+	var authorized []string
+	actionAuthorizer = func(user, action, target string) error {
+		authorized = append(authorized, user+" "+action+" "+target)
+		if user != "user1" {
+			return fmt.Errorf("%v is not an operator", user)
+		}
+		return nil
+	}
+	defer func() { actionAuthorizer = nil }()
+
+	// the authorizer gets the user and the action
+	result := ar.ApplyTabletAction("Refresh", tabletAlias, newActionRequest(t, "user2", ""))
+	if !result.Error || result.status != http.StatusForbidden || runs != 0 {
+		t.Errorf("Refresh by user2: %#v, runs: %v", result, runs)
+	}
+	result = ar.ApplyTabletAction("Refresh", tabletAlias, newActionRequest(t, "user1", ""))
+	if result.Error || result.Output != "refreshed" || runs != 1 {
+		t.Errorf("Refresh by user1: %#v, runs: %v", result, runs)
+	}
+	if want := "user2 Refresh cell1-0000000100,user1 Refresh cell1-0000000100"; strings.Join(authorized, ",") != want {
+		t.Errorf("authorized: %v, want %v", authorized, want)
+	}
+
+	// a destructive action runs once confirmed with its token
+	result = ar.ApplyTabletAction("Wipe", tabletAlias, newActionRequest(t, "user1", ""))
+	if result.Error || result.ConfirmToken == "" || result.status != http.StatusPreconditionFailed || runs != 1 {
+		t.Fatalf("Wipe without confirm: %#v, runs: %v", result, runs)
+	}
+	token := result.ConfirmToken
+	result = ar.ApplyTabletAction("Refresh", tabletAlias, newActionRequest(t, "user1", token))
+	if result.ConfirmToken != "" || runs != 2 {
+		t.Errorf("Refresh with a token: %#v, runs: %v", result, runs)
+	}
+	result = ar.ApplyTabletAction("Wipe", topo.TabletAlias{Cell: "cell1", Uid: 100}, newActionRequest(t, "user1", "bad"))
+	if result.ConfirmToken == "" || runs != 2 {
+		t.Errorf("Wipe with a bad token: %#v, runs: %v", result, runs)
+	}
+	result = ar.ApplyTabletAction("Wipe", tabletAlias, newActionRequest(t, "user1", token))
+	if result.Error || result.ConfirmToken != "" || result.Output != "wiped" || runs != 3 {
+		t.Errorf("Wipe with its token: %#v, runs: %v", result, runs)
+	}
+	result = ar.ApplyTabletAction("Wipe", tabletAlias, newActionRequest(t, "user1", token))
+	if result.ConfirmToken == "" || runs != 3 {
+		t.Errorf("Wipe with a used token: %#v, runs: %v", result, runs)
+	}
+
+	// failures are reported
+	result = ar.ApplyShardAction("Break", "ks1", "-80", newActionRequest(t, "user1", ""))
+	if !result.Error || result.Output != "broken" || runs != 4 {
+		t.Errorf("Break: %#v, runs: %v", result, runs)
+	}
+	result = ar.ApplyTabletAction("Refresh", topo.TabletAlias{Cell: "cell1", Uid: 101}, newActionRequest(t, "user1", ""))
+	if !result.Error || result.status != http.StatusNotFound {
+		t.Errorf("Refresh on an unknown tablet: %#v", result)
+	}
+
+	// all the actions that ran are in the action log of the shard
+	zconn := ts.Server.(*zktopo.Server).GetZConn()
+	actionLogPath := "/zk/global/vt/keyspaces/ks1/shards/-80/actionlog"
+	children, _, err := zconn.Children(actionLogPath)
+	if err != nil {
+		t.Fatalf("cannot read the action log: %v", err)
+	}
+	if len(children) != 4 {
+		t.Fatalf("got %v action log entries, want 4: %v", len(children), children)
+	}
+	var logs []string
+	for _, child := range children {
+		data, _, err := zconn.Get(actionLogPath + "/" + child)
+		if err != nil {
+			t.Fatalf("cannot read action log entry %v: %v", child, err)
+		}
+		logs = append(logs, data)
+	}
+	all := strings.Join(logs, "\n")
+	for _, want := range []string{`"Action": "Wipe"`, `"Action": "Break"`, `"User": "user1"`, `"Error": "broken"`, `"Target": "ks1/-80"`} {
+		if !strings.Contains(all, want) {
+			t.Errorf("action log is missing %v: %v", want, all)
+		}
+	}
+}
@@ -0,0 +1,466 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/vt/logutil"
+	"github.com/youtube/vitess/go/vt/tabletmanager/tmclient"
+	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/vt/wrangler"
+	"golang.org/x/net/context"
+)
+
+// This file contains the REST API on the topology. GET reads it:
+// - /api/cells: the known cells.
+// - /api/keyspaces: the keyspace names.
+// - /api/keyspaces/<keyspace>: a keyspace record, with its shard names.
+// - /api/keyspaces/<keyspace>/shards/<shard>: a shard record, with its
+//   replication graph and serving graph in each of its cells.
+// - /api/tablets/<alias>: a tablet record.
+// - /api/serving_graph/<cell>: the serving graph of a cell, checked
+//   against the tablets by wrangler.GetCellServingGraph.
+// - /api/schema/<keyspace>: the schemas of the shard masters compared
+//   table by table, see wrangler.KeyspaceSchema. exclude_tables and
+//   include_views are the options of ValidateSchemaKeyspace.
+// - /api/keyspaces/<keyspace>/shards/<shard>/reparent_preflight: what a
+//   PlannedReparent to the candidate form value would do, from
+//   wrangler.PlannedReparentPreflight.
+// - /api/topology_health: the problems of the topology by severity,
+//   from wrangler.GetTopologyHealth. It is cached for
+//   -topology_health_cache_ttl, and only covers a sample of the shards
+//   if it took more than -topology_health_budget.
+// Each reply has an ETag derived from the version of the topo records
+// in it, and a request with a matching If-None-Match gets a 304.
+// A missing record is a 404, a failure to read the topology a 502.
+//
+// POST runs the vtctld actions, with their parameters as form values:
+// - /api/keyspaces/<keyspace>/actions/<action>
+// - /api/keyspaces/<keyspace>/shards/<shard>/actions/<action>
+// - /api/tablets/<alias>/actions/<action>
+// The reply is the ActionResult. A destructive action is not run
+// but gets a 412 with a ConfirmToken, to POST again as confirm.
+
+// KeyspaceRecord is the reply of /api/keyspaces/<keyspace>.
+type KeyspaceRecord struct {
+	Name     string
+	Version  int64
+	Keyspace *topo.Keyspace
+	Shards   []string
+}
+
+// ShardServingGraph is the serving graph of a shard in a cell.
+type ShardServingGraph struct {
+	SrvShard  *topo.SrvShard
+	EndPoints map[topo.TabletType]*topo.EndPoints
+}
+
+// ShardRecord is the reply of /api/keyspaces/<keyspace>/shards/<shard>.
+// Replication and Serving are by cell.
+type ShardRecord struct {
+	Keyspace    string
+	Name        string
+	Version     int64
+	Shard       *topo.Shard
+	Replication map[string]*topo.ShardReplication
+	Serving     map[string]*ShardServingGraph
+}
+
+// TabletRecord is the reply of /api/tablets/<alias>.
+type TabletRecord struct {
+	Version int64
+	Tablet  *topo.Tablet
+}
+
+// ServingGraphRecord is the reply of /api/serving_graph/<cell>.
+// TabletLastChanged is when vtctld first saw the current version of
+// each tablet record of the end points, by alias: the topology does
+// not keep modification times, so it is never earlier than the start
+// of vtctld.
+type ServingGraphRecord struct {
+	*wrangler.CellServingGraph
+	TabletLastChanged map[string]time.Time
+}
+
+// tabletVersionSeen is a version of a tablet record, and when it was
+// first seen.
+type tabletVersionSeen struct {
+	version int64
+	seen    time.Time
+}
+
+// tabletChangeTracker remembers when each tablet record last changed.
+type tabletChangeTracker struct {
+	mu       sync.Mutex
+	versions map[topo.TabletAlias]tabletVersionSeen
+}
+
+func newTabletChangeTracker() *tabletChangeTracker {
+	return &tabletChangeTracker{versions: make(map[topo.TabletAlias]tabletVersionSeen)}
+}
+
+// lastChanged returns when version of the tablet record was first seen.
+func (tct *tabletChangeTracker) lastChanged(alias topo.TabletAlias, version int64) time.Time {
+	tct.mu.Lock()
+	defer tct.mu.Unlock()
+	vs, ok := tct.versions[alias]
+	if !ok || vs.version != version {
+		vs = tabletVersionSeen{version: version, seen: time.Now()}
+		tct.versions[alias] = vs
+	}
+	return vs.seen
+}
+
+// servingGraphRecord returns the serving graph of cell, with the
+// last change time of its tablets.
+func servingGraphRecord(ctx context.Context, ts topo.Server, tracker *tabletChangeTracker, cell string) (*ServingGraphRecord, error) {
+	wr := wrangler.New(logutil.NewConsoleLogger(), ts, tmclient.NewTabletManagerClient(), *lockTimeout)
+	sg, err := wr.GetCellServingGraph(ctx, cell)
+	if err != nil {
+		return nil, err
+	}
+	record := &ServingGraphRecord{
+		CellServingGraph:  sg,
+		TabletLastChanged: make(map[string]time.Time),
+	}
+	for _, kg := range sg.Keyspaces {
+		for _, sh := range kg.Shards {
+			for _, endPoints := range sh.EndPoints {
+				for _, ep := range endPoints {
+					if ep.TabletType == "" {
+						continue
+					}
+					alias := topo.TabletAlias{Cell: cell, Uid: ep.Uid}
+					record.TabletLastChanged[alias.String()] = tracker.lastChanged(alias, ep.TabletVersion)
+				}
+			}
+		}
+	}
+	return record, nil
+}
+
+// topoAPIError replies with the status matching a topo error: 404 if
+// the record does not exist, 502 if the topology could not be read.
+func topoAPIError(w http.ResponseWriter, what string, err error) {
+	if err == topo.ErrNoNode {
+		http.Error(w, fmt.Sprintf("no such %v", what), http.StatusNotFound)
+		return
+	}
+	httpError502(w, fmt.Sprintf("cannot read %v: %%v", what), err)
+}
+
+func httpError502(w http.ResponseWriter, format string, err error) {
+	log.Errorf(format, err)
+	http.Error(w, fmt.Sprintf(format, err), http.StatusBadGateway)
+}
+
+// writeVersionedJSON writes data with an ETag made of version, the
+// version of its main topo record (0 if there is none), and a
+// checksum of the JSON, which covers the unversioned records.
+func writeVersionedJSON(w http.ResponseWriter, r *http.Request, version int64, data interface{}) {
+	result, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		httpError(w, "cannot marshal reply: %v", err)
+		return
+	}
+	etag := fmt.Sprintf("\"%v-%08x\"", version, crc32.ChecksumIEEE(result))
+	w.Header().Set("ETag", etag)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(result)
+}
+
+func handleTopoAPI(ts topo.Server, ar *ActionRepository, schemaCache *keyspaceSchemaCache) {
+	http.HandleFunc("/api/cells", func(w http.ResponseWriter, r *http.Request) {
+		if !checkGet(w, r) {
+			return
+		}
+		cells, err := ts.GetKnownCells()
+		if err != nil {
+			topoAPIError(w, "cells", err)
+			return
+		}
+		writeVersionedJSON(w, r, 0, cells)
+	})
+
+	http.HandleFunc("/api/keyspaces", func(w http.ResponseWriter, r *http.Request) {
+		if !checkGet(w, r) {
+			return
+		}
+		keyspaces, err := ts.GetKeyspaces()
+		if err != nil {
+			topoAPIError(w, "keyspaces", err)
+			return
+		}
+		writeVersionedJSON(w, r, 0, keyspaces)
+	})
+
+	http.HandleFunc("/api/keyspaces/", func(w http.ResponseWriter, r *http.Request) {
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/keyspaces/"), "/")
+		switch {
+		case len(parts) == 1 && parts[0] != "":
+			if checkGet(w, r) {
+				keyspaceRecord(w, r, ts, parts[0])
+			}
+		case len(parts) == 3 && parts[0] != "" && parts[1] == "shards" && parts[2] != "":
+			if checkGet(w, r) {
+				shardRecord(w, r, ts, parts[0], parts[2])
+			}
+		case len(parts) == 4 && parts[0] != "" && parts[1] == "shards" && parts[2] != "" && parts[3] == "reparent_preflight":
+			if checkGet(w, r) {
+				reparentPreflight(w, r, ts, parts[0], parts[2])
+			}
+		case len(parts) == 3 && parts[0] != "" && parts[1] == "actions" && parts[2] != "":
+			if checkPost(w, r) {
+				writeActionResult(w, ar.ApplyKeyspaceAction(parts[2], parts[0], r))
+			}
+		case len(parts) == 5 && parts[0] != "" && parts[1] == "shards" && parts[2] != "" && parts[3] == "actions" && parts[4] != "":
+			if checkPost(w, r) {
+				writeActionResult(w, ar.ApplyShardAction(parts[4], parts[0], parts[2], r))
+			}
+		default:
+			http.NotFound(w, r)
+		}
+	})
+
+	tracker := newTabletChangeTracker()
+	http.HandleFunc("/api/serving_graph/", func(w http.ResponseWriter, r *http.Request) {
+		if !checkGet(w, r) {
+			return
+		}
+		cell := strings.TrimPrefix(r.URL.Path, "/api/serving_graph/")
+		if cell == "" || strings.Contains(cell, "/") {
+			http.NotFound(w, r)
+			return
+		}
+		cells, err := ts.GetKnownCells()
+		if err != nil {
+			topoAPIError(w, "cells", err)
+			return
+		}
+		if !strInList(cells, cell) {
+			http.Error(w, fmt.Sprintf("no such cell %v", cell), http.StatusNotFound)
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.TODO(), *actionTimeout)
+		defer cancel()
+		record, err := servingGraphRecord(ctx, ts, tracker, cell)
+		if err != nil {
+			httpError502(w, fmt.Sprintf("cannot read the serving graph of cell %v: %%v", cell), err)
+			return
+		}
+		writeVersionedJSON(w, r, 0, record)
+	})
+
+	healthCache := newTopologyHealthCache(ts)
+	http.HandleFunc("/api/topology_health", func(w http.ResponseWriter, r *http.Request) {
+		if !checkGet(w, r) {
+			return
+		}
+		health, err := healthCache.get(context.TODO())
+		if err != nil {
+			httpError502(w, "cannot check the topology: %v", err)
+			return
+		}
+		writeVersionedJSON(w, r, 0, health)
+	})
+
+	http.HandleFunc("/api/schema/", func(w http.ResponseWriter, r *http.Request) {
+		if !checkGet(w, r) {
+			return
+		}
+		keyspace := strings.TrimPrefix(r.URL.Path, "/api/schema/")
+		if keyspace == "" || strings.Contains(keyspace, "/") {
+			http.NotFound(w, r)
+			return
+		}
+		options, err := parseSchemaOptions(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.TODO(), *actionTimeout)
+		defer cancel()
+		schema, err := schemaCache.get(ctx, keyspace, options)
+		if err != nil {
+			topoAPIError(w, "keyspace "+keyspace, err)
+			return
+		}
+		writeVersionedJSON(w, r, 0, schema)
+	})
+
+	http.HandleFunc("/api/tablets/", func(w http.ResponseWriter, r *http.Request) {
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/tablets/"), "/")
+		if len(parts) != 1 && (len(parts) != 3 || parts[1] != "actions" || parts[2] == "") {
+			http.NotFound(w, r)
+			return
+		}
+		alias, err := topo.ParseTabletAliasString(parts[0])
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid tablet alias: %v", err), http.StatusBadRequest)
+			return
+		}
+		if len(parts) == 3 {
+			if checkPost(w, r) {
+				writeActionResult(w, ar.ApplyTabletAction(parts[2], alias, r))
+			}
+			return
+		}
+		if !checkGet(w, r) {
+			return
+		}
+		ti, err := ts.GetTablet(alias)
+		if err != nil {
+			topoAPIError(w, "tablet "+alias.String(), err)
+			return
+		}
+		writeVersionedJSON(w, r, ti.Version(), &TabletRecord{Version: ti.Version(), Tablet: ti.Tablet})
+	})
+}
+
+// reparentPreflight replies with what a PlannedReparent of the shard
+// to the candidate form value would do.
+func reparentPreflight(w http.ResponseWriter, r *http.Request, ts topo.Server, keyspace, shard string) {
+	candidate, err := topo.ParseTabletAliasString(r.FormValue("candidate"))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid candidate tablet alias: %v", err), http.StatusBadRequest)
+		return
+	}
+	waitSlaveTimeout := 30 * time.Second
+	if value := r.FormValue("wait_slave_timeout"); value != "" {
+		if waitSlaveTimeout, err = time.ParseDuration(value); err != nil {
+			http.Error(w, fmt.Sprintf("invalid wait_slave_timeout: %v", err), http.StatusBadRequest)
+			return
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.TODO(), *actionTimeout)
+	defer cancel()
+	wr := wrangler.New(logutil.NewConsoleLogger(), ts, tmclient.NewTabletManagerClient(), *lockTimeout)
+	pf, err := wr.PlannedReparentPreflight(ctx, keyspace, shard, candidate, waitSlaveTimeout)
+	if err != nil {
+		topoAPIError(w, fmt.Sprintf("shard %v/%v", keyspace, shard), err)
+		return
+	}
+	writeVersionedJSON(w, r, 0, pf)
+}
+
+// writeActionResult replies with an ActionResult, and its status.
+func writeActionResult(w http.ResponseWriter, result *ActionResult) {
+	data, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		httpError(w, "cannot marshal reply: %v", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if result.status != 0 {
+		w.WriteHeader(result.status)
+	}
+	w.Write(data)
+}
+
+func keyspaceRecord(w http.ResponseWriter, r *http.Request, ts topo.Server, keyspace string) {
+	ki, err := ts.GetKeyspace(keyspace)
+	if err != nil {
+		topoAPIError(w, "keyspace "+keyspace, err)
+		return
+	}
+	shards, err := ts.GetShardNames(keyspace)
+	if err != nil {
+		topoAPIError(w, "shards of keyspace "+keyspace, err)
+		return
+	}
+	writeVersionedJSON(w, r, ki.Version(), &KeyspaceRecord{
+		Name:     keyspace,
+		Version:  ki.Version(),
+		Keyspace: ki.Keyspace,
+		Shards:   shards,
+	})
+}
+
+func shardRecord(w http.ResponseWriter, r *http.Request, ts topo.Server, keyspace, shard string) {
+	si, err := ts.GetShard(keyspace, shard)
+	if err != nil {
+		topoAPIError(w, "shard "+keyspace+"/"+shard, err)
+		return
+	}
+	record := &ShardRecord{
+		Keyspace:    keyspace,
+		Name:        shard,
+		Version:     si.Version(),
+		Shard:       si.Shard,
+		Replication: make(map[string]*topo.ShardReplication),
+		Serving:     make(map[string]*ShardServingGraph),
+	}
+	// The graphs of a cell are left out until they exist.
+	for _, cell := range si.Cells {
+		sri, err := ts.GetShardReplication(cell, keyspace, shard)
+		switch err {
+		case nil:
+			record.Replication[cell] = sri.ShardReplication
+		case topo.ErrNoNode:
+		default:
+			httpError502(w, fmt.Sprintf("cannot read the replication graph of %v/%v in %v: %%v", keyspace, shard, cell), err)
+			return
+		}
+
+		serving, err := shardServingGraph(ts, cell, keyspace, shard)
+		if err != nil {
+			httpError502(w, fmt.Sprintf("cannot read the serving graph of %v/%v in %v: %%v", keyspace, shard, cell), err)
+			return
+		}
+		if serving != nil {
+			record.Serving[cell] = serving
+		}
+	}
+	writeVersionedJSON(w, r, si.Version(), record)
+}
+
+func strInList(sl []string, s string) bool {
+	for _, x := range sl {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
+
+// shardServingGraph returns the serving graph of a shard in a cell,
+// or nil if it has none.
+func shardServingGraph(ts topo.Server, cell, keyspace, shard string) (*ShardServingGraph, error) {
+	srvShard, err := ts.GetSrvShard(cell, keyspace, shard)
+	switch err {
+	case nil:
+	case topo.ErrNoNode:
+		return nil, nil
+	default:
+		return nil, err
+	}
+	tabletTypes, err := ts.GetSrvTabletTypesPerShard(cell, keyspace, shard)
+	if err != nil && err != topo.ErrNoNode {
+		return nil, err
+	}
+	serving := &ShardServingGraph{
+		SrvShard:  srvShard,
+		EndPoints: make(map[topo.TabletType]*topo.EndPoints),
+	}
+	for _, tabletType := range tabletTypes {
+		endPoints, err := ts.GetEndPoints(cell, keyspace, shard, tabletType)
+		switch err {
+		case nil:
+			serving.EndPoints[tabletType] = endPoints
+		case topo.ErrNoNode:
+		default:
+			return nil, err
+		}
+	}
+	return serving, nil
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/vt/wrangler"
+	"github.com/youtube/vitess/go/vt/zktopo"
+	"golang.org/x/net/context"
+)
+
+// brokenTopo is a topo.Server that cannot be read.
+type brokenTopo struct {
+	topo.Server
+}
+
+func (bt brokenTopo) GetKeyspace(keyspace string) (*topo.KeyspaceInfo, error) {
+	return nil, errors.New("connection refused")
+}
+
+func TestTopoAPI(t *testing.T) {
+	ts := zktopo.NewTestServer(t, []string{"cell1", "cell2"})
+	if err := ts.CreateKeyspace("ks1", &topo.Keyspace{ShardingColumnName: "sharding_key"}); err != nil {
+		t.Fatalf("CreateKeyspace failed: %v", err)
+	}
+	if err := ts.CreateShard("ks1", "-80", &topo.Shard{Cells: []string{"cell1", "cell2"}}); err != nil {
+		t.Fatalf("CreateShard failed: %v", err)
+	}
+	tablet := &topo.Tablet{
+		Alias:    topo.TabletAlias{Cell: "cell1", Uid: 100},
+		Hostname: "host1",
+		Keyspace: "ks1",
+		Shard:    "-80",
+		Type:     topo.TYPE_REPLICA,
+	}
+	if err := ts.CreateTablet(tablet); err != nil {
+		t.Fatalf("CreateTablet failed: %v", err)
+	}
+	if err := ts.UpdateShardReplicationFields("cell1", "ks1", "-80", func(sr *topo.ShardReplication) error {
+		sr.ReplicationLinks = []topo.ReplicationLink{{TabletAlias: tablet.Alias}}
+		return nil
+	}); err != nil {
+		t.Fatalf("UpdateShardReplicationFields failed: %v", err)
+	}
+	if err := ts.UpdateEndPoints("cell1", "ks1", "-80", topo.TYPE_REPLICA, &topo.EndPoints{Entries: []topo.EndPoint{{Uid: 100, Host: "host1"}}}); err != nil {
+		t.Fatalf("UpdateEndPoints failed: %v", err)
+	}
+	if err := ts.UpdateSrvShard("cell1", "ks1", "-80", &topo.SrvShard{Name: "-80", MasterCell: "cell1"}); err != nil {
+		t.Fatalf("UpdateSrvShard failed: %v", err)
+	}
+
+	ar := NewActionRepository(ts)
+	ar.RegisterTabletAction("DropTablet", "", true,
+		func(ctx context.Context, wr *wrangler.Wrangler, tabletAlias topo.TabletAlias, r *http.Request) (string, error) {
+			return "dropped " + tabletAlias.String(), nil
+		})
+	schemaCache := newKeyspaceSchemaCache(ts)
+	handleTopoAPI(ts, ar, schemaCache)
+	server := httptest.NewServer(http.DefaultServeMux)
+	defer server.Close()
+
+	var cells []string
+	if code := getJSON(t, server.URL+"/api/cells", &cells); code != http.StatusOK || len(cells) != 2 {
+		t.Errorf("/api/cells: %v %v", code, cells)
+	}
+	var keyspaces []string
+	if code := getJSON(t, server.URL+"/api/keyspaces", &keyspaces); code != http.StatusOK || len(keyspaces) != 1 || keyspaces[0] != "ks1" {
+		t.Errorf("/api/keyspaces: %v %v", code, keyspaces)
+	}
+	var ks KeyspaceRecord
+	if code := getJSON(t, server.URL+"/api/keyspaces/ks1", &ks); code != http.StatusOK || ks.Keyspace.ShardingColumnName != "sharding_key" || len(ks.Shards) != 1 || ks.Shards[0] != "-80" {
+		t.Errorf("/api/keyspaces/ks1: %v %#v", code, ks)
+	}
+
+	var shard ShardRecord
+	if code := getJSON(t, server.URL+"/api/keyspaces/ks1/shards/-80", &shard); code != http.StatusOK {
+		t.Fatalf("/api/keyspaces/ks1/shards/-80: %v", code)
+	}
+	if sr := shard.Replication["cell1"]; sr == nil || len(sr.ReplicationLinks) != 1 || sr.ReplicationLinks[0].TabletAlias != tablet.Alias {
+		t.Errorf("replication graph in cell1: %#v", sr)
+	}
+	if _, ok := shard.Replication["cell2"]; ok {
+		t.Errorf("no replication graph expected in cell2: %#v", shard.Replication)
+	}
+	if sg := shard.Serving["cell1"]; sg == nil || sg.SrvShard.MasterCell != "cell1" || len(sg.EndPoints[topo.TYPE_REPLICA].Entries) != 1 {
+		t.Errorf("serving graph in cell1: %#v", sg)
+	}
+
+	var sg ServingGraphRecord
+	if code := getJSON(t, server.URL+"/api/serving_graph/cell1", &sg); code != http.StatusOK {
+		t.Fatalf("/api/serving_graph/cell1: %v", code)
+	}
+	if kg := sg.Keyspaces["ks1"]; kg == nil || len(kg.Shards) != 1 || len(kg.Shards[0].EndPoints[topo.TYPE_REPLICA]) != 1 || kg.Shards[0].EndPoints[topo.TYPE_REPLICA][0].TabletType != topo.TYPE_REPLICA {
+		t.Errorf("serving graph of cell1: %#v", sg.CellServingGraph)
+	}
+	if _, ok := sg.TabletLastChanged["cell1-0000000100"]; !ok {
+		t.Errorf("no last change time for cell1-0000000100: %v", sg.TabletLastChanged)
+	}
+	if code := getJSON(t, server.URL+"/api/serving_graph/cell3", nil); code != http.StatusNotFound {
+		t.Errorf("/api/serving_graph/cell3: %v, want %v", code, http.StatusNotFound)
+	}
+
+	var health struct {
+		Problems []struct {
+			Severity string
+			Message  string
+		}
+		ShardsChecked, ShardsTotal int
+	}
+	if code := getJSON(t, server.URL+"/api/topology_health", &health); code != http.StatusOK || health.ShardsChecked != 1 || health.ShardsTotal != 1 {
+		t.Fatalf("/api/topology_health: %v %#v", code, health)
+	}
+	if len(health.Problems) == 0 || health.Problems[0].Severity != "critical" || health.Problems[0].Message != "shard ks1/-80 has no master" {
+		t.Errorf("the shard without master is not the first problem: %#v", health.Problems)
+	}
+
+	// the shard has no master to read the schema from
+	var schema wrangler.KeyspaceSchema
+	if code := getJSON(t, server.URL+"/api/schema/ks1?exclude_tables=t1,t2&include_views=true", &schema); code != http.StatusOK || len(schema.Shards) != 1 || schema.Shards[0].Error != "no master in shard ks1/-80" {
+		t.Errorf("/api/schema/ks1: %v %#v", code, schema)
+	}
+	options := &schemaOptions{ExcludeTables: []string{"t1", "t2"}, IncludeViews: true}
+	s1, err1 := schemaCache.get(context.Background(), "ks1", options)
+	s2, err2 := schemaCache.get(context.Background(), "ks1", options)
+	if err1 != nil || err2 != nil || s1 != s2 {
+		t.Errorf("the comparison of unchanged schemas was not cached: %v %v", err1, err2)
+	}
+	if code := getJSON(t, server.URL+"/api/schema/ks1?include_views=maybe", nil); code != http.StatusBadRequest {
+		t.Errorf("/api/schema/ks1 with a bad include_views: %v, want %v", code, http.StatusBadRequest)
+	}
+	if code := getJSON(t, server.URL+"/api/schema/ks2", nil); code != http.StatusNotFound {
+		t.Errorf("/api/schema/ks2: %v, want %v", code, http.StatusNotFound)
+	}
+
+	var tr TabletRecord
+	if code := getJSON(t, server.URL+"/api/tablets/cell1-0000000100", &tr); code != http.StatusOK || tr.Tablet.Hostname != "host1" {
+		t.Errorf("/api/tablets/cell1-0000000100: %v %#v", code, tr)
+	}
+
+	// a matching ETag gets a 304, until the record changes
+	resp, err := http.Get(server.URL + "/api/tablets/cell1-0000000100")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	etag := resp.Header.Get("ETag")
+	getWithETag := func() int {
+		req, err := http.NewRequest("GET", server.URL+"/api/tablets/cell1-0000000100", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("If-None-Match", etag)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if code := getWithETag(); etag == "" || code != http.StatusNotModified {
+		t.Errorf("GET with ETag %v: %v, want %v", etag, code, http.StatusNotModified)
+	}
+	if err := topo.UpdateTabletFields(context.Background(), ts, tablet.Alias, func(t *topo.Tablet) error {
+		t.Hostname = "host2"
+		return nil
+	}); err != nil {
+		t.Fatalf("UpdateTabletFields failed: %v", err)
+	}
+	if code := getWithETag(); code != http.StatusOK {
+		t.Errorf("GET with ETag %v after an update: %v, want %v", etag, code, http.StatusOK)
+	}
+
+	for _, url := range []string{"/api/keyspaces/ks2", "/api/keyspaces/ks1/shards/80-", "/api/tablets/cell1-0000000101", "/api/keyspaces/ks1/other/-80"} {
+		if code := getJSON(t, server.URL+url, nil); code != http.StatusNotFound {
+			t.Errorf("%v: %v, want %v", url, code, http.StatusNotFound)
+		}
+	}
+	if code := getJSON(t, server.URL+"/api/tablets/bad", nil); code != http.StatusBadRequest {
+		t.Errorf("/api/tablets/bad: %v, want %v", code, http.StatusBadRequest)
+	}
+
+	// actions are POSTed, and the destructive ones confirmed
+	actionURL := server.URL + "/api/tablets/cell1-0000000100/actions/DropTablet"
+	if code := getJSON(t, actionURL, nil); code != http.StatusMethodNotAllowed {
+		t.Errorf("GET %v: %v, want %v", actionURL, code, http.StatusMethodNotAllowed)
+	}
+	postAction := func(url string, values url.Values) (*ActionResult, int) {
+		resp, err := http.PostForm(url, values)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		result := &ActionResult{}
+		if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+			t.Fatalf("cannot decode %v: %v", url, err)
+		}
+		return result, resp.StatusCode
+	}
+	result, code := postAction(actionURL, nil)
+	if code != http.StatusPreconditionFailed || result.ConfirmToken == "" {
+		t.Fatalf("POST %v: %v %#v", actionURL, code, result)
+	}
+	result, code = postAction(actionURL, url.Values{"confirm": {result.ConfirmToken}})
+	if code != http.StatusOK || result.Output != "dropped cell1-0000000100" {
+		t.Errorf("POST %v confirmed: %v %#v", actionURL, code, result)
+	}
+	if result, code = postAction(server.URL+"/api/keyspaces/ks1/shards/-80/actions/Unknown", nil); code != http.StatusNotFound || !result.Error {
+		t.Errorf("POST of an unknown shard action: %v %#v", code, result)
+	}
+
+	// a topo failure is a 502
+	w := httptest.NewRecorder()
+	keyspaceRecord(w, &http.Request{Header: http.Header{}}, brokenTopo{ts}, "ks1")
+	if w.Code != http.StatusBadGateway {
+		t.Errorf("keyspace with a broken topo: %v, want %v", w.Code, http.StatusBadGateway)
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/youtube/vitess/go/vt/wrangler"
+	"golang.org/x/net/context"
+)
+
+// This file contains the read-only API on the wrangler jobs run by
+// vtctld: the vtctld actions and the remote vtctl commands.
+
+var jobLogMaxWait = flag.Duration("job_log_max_wait", 30*time.Second, "longest time a /api/jobs/<id>/log request waits for new log events of a running job")
+
+// JobLog is the reply of /api/jobs/<id>/log.
+type JobLog struct {
+	Job *wrangler.JobStatus
+	*wrangler.JobEvents
+}
+
+// handleJobsAPI serves the jobs of registry:
+//   - /api/jobs lists the running and recently finished jobs.
+//   - /api/jobs/<id> returns one job.
+//   - /api/jobs/<id>/log?from=<n>&wait=<duration> returns the log
+//     events of a job from position n (0 by default). If there are none
+//     yet and the job still runs, it waits for some, for at most wait
+//     (-job_log_max_wait by default). Clients follow a job by asking
+//     again from the Next position of each reply until it is Done.
+//
+// Only GET requests are accepted, the jobs cannot be changed.
+func handleJobsAPI(registry *wrangler.JobRegistry) {
+	http.HandleFunc("/api/jobs", func(w http.ResponseWriter, r *http.Request) {
+		if !checkGet(w, r) {
+			return
+		}
+		writeJSON(w, registry.Statuses())
+	})
+	http.HandleFunc("/api/jobs/", func(w http.ResponseWriter, r *http.Request) {
+		if !checkGet(w, r) {
+			return
+		}
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/jobs/"), "/")
+		if len(parts) > 2 || (len(parts) == 2 && parts[1] != "log") {
+			http.NotFound(w, r)
+			return
+		}
+		id, err := strconv.ParseInt(parts[0], 10, 64)
+		if err != nil {
+			http.Error(w, "invalid job id", http.StatusBadRequest)
+			return
+		}
+		job := registry.Job(id)
+		if job == nil {
+			http.Error(w, fmt.Sprintf("unknown job %v", id), http.StatusNotFound)
+			return
+		}
+		if len(parts) == 1 {
+			writeJSON(w, job.Status())
+			return
+		}
+
+		from := 0
+		if value := r.FormValue("from"); value != "" {
+			if from, err = strconv.Atoi(value); err != nil || from < 0 {
+				http.Error(w, "invalid from", http.StatusBadRequest)
+				return
+			}
+		}
+		wait := *jobLogMaxWait
+		if value := r.FormValue("wait"); value != "" {
+			d, err := time.ParseDuration(value)
+			if err != nil || d < 0 {
+				http.Error(w, "invalid wait", http.StatusBadRequest)
+				return
+			}
+			if d < wait {
+				wait = d
+			}
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), wait)
+		events := job.Events(ctx, from)
+		cancel()
+		writeJSON(w, &JobLog{Job: job.Status(), JobEvents: events})
+	})
+}
+
+// checkGet replies with an error and returns false if r is not a GET.
+func checkGet(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method != "GET" {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "only GET is allowed", http.StatusMethodNotAllowed)
+		return false
+	}
+	return true
+}
+
+// checkPost replies with an error and returns false if r is not a POST.
+func checkPost(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "only POST is allowed", http.StatusMethodNotAllowed)
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, data interface{}) {
+	result, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		httpError(w, "cannot marshal reply: %v", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(result)
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/youtube/vitess/go/vt/logutil"
+	"github.com/youtube/vitess/go/vt/wrangler"
+)
+
+func getJSON(t *testing.T, url string, result interface{}) int {
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("GET %v: %v", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusOK && result != nil {
+		if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+			t.Fatalf("bad json from %v: %v", url, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func TestJobsAPI(t *testing.T) {
+	registry := wrangler.NewJobRegistry(10)
+	handleJobsAPI(registry)
+	server := httptest.NewServer(http.DefaultServeMux)
+	defer server.Close()
+
+	wr := wrangler.New(logutil.NewMemoryLogger(), nil, nil, time.Second)
+	job := wr.StartJob(registry, "ValidateKeyspace ks")
+	wr.Logger().Infof("validating")
+
+	var statuses []*wrangler.JobStatus
+	if code := getJSON(t, server.URL+"/api/jobs", &statuses); code != http.StatusOK || len(statuses) != 1 || statuses[0].Name != "ValidateKeyspace ks" || !statuses[0].Running {
+		t.Errorf("/api/jobs: %v %#v", code, statuses)
+	}
+
+	var log JobLog
+	if code := getJSON(t, server.URL+"/api/jobs/1/log", &log); code != http.StatusOK || len(log.Events) != 1 || log.Events[0].Value != "validating" || log.Next != 1 || log.Done {
+		t.Errorf("/api/jobs/1/log: %v %#v", code, log)
+	}
+
+	// a long poll returns once the job is done
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		job.Finish(nil)
+	}()
+	log = JobLog{}
+	if code := getJSON(t, server.URL+"/api/jobs/1/log?from=1", &log); code != http.StatusOK || len(log.Events) != 0 || !log.Done || log.Job.Running {
+		t.Errorf("/api/jobs/1/log?from=1: %v %#v", code, log)
+	}
+
+	for _, url := range []string{"/api/jobs/2", "/api/jobs/1/other"} {
+		if code := getJSON(t, server.URL+url, nil); code != http.StatusNotFound {
+			t.Errorf("%v: %v, want %v", url, code, http.StatusNotFound)
+		}
+	}
+	if code := getJSON(t, server.URL+"/api/jobs/x", nil); code != http.StatusBadRequest {
+		t.Errorf("/api/jobs/x: %v, want %v", code, http.StatusBadRequest)
+	}
+
+	resp, err := http.Post(server.URL+"/api/jobs", "text/plain", strings.NewReader(""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("POST /api/jobs: %v, want %v", resp.StatusCode, http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,137 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/youtube/vitess/go/vt/logutil"
+	"github.com/youtube/vitess/go/vt/tabletmanager/tmclient"
+	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/vt/wrangler"
+	"golang.org/x/net/context"
+)
+
+// This file contains the schema browser, that compares the schemas of
+// the shard masters of a keyspace. It backs /api/schema/<keyspace> and
+// the /schema/<keyspace> page.
+
+// schemaOptions are the query parameters of the schema browser. They
+// match the options of ValidateSchemaKeyspace.
+type schemaOptions struct {
+	ExcludeTables []string
+	IncludeViews  bool
+}
+
+func parseSchemaOptions(r *http.Request) (*schemaOptions, error) {
+	options := &schemaOptions{}
+	if value := r.FormValue("exclude_tables"); value != "" {
+		options.ExcludeTables = strings.Split(value, ",")
+	}
+	if value := r.FormValue("include_views"); value != "" {
+		var err error
+		if options.IncludeViews, err = strconv.ParseBool(value); err != nil {
+			return nil, fmt.Errorf("invalid include_views: %v", err)
+		}
+	}
+	return options, nil
+}
+
+// keyspaceSchemaEntry is a comparison, and the schema versions of the
+// shards it was made from.
+type keyspaceSchemaEntry struct {
+	versions string
+	schema   *wrangler.KeyspaceSchema
+}
+
+// keyspaceSchemaCache keeps the last comparison for each keyspace and
+// options. The GetSchema RPCs run for each request, as they are the
+// only way to know the versions, but the tables are only compared
+// again when the version of a shard changed.
+type keyspaceSchemaCache struct {
+	ts topo.Server
+
+	mu      sync.Mutex
+	entries map[string]*keyspaceSchemaEntry
+}
+
+func newKeyspaceSchemaCache(ts topo.Server) *keyspaceSchemaCache {
+	return &keyspaceSchemaCache{
+		ts:      ts,
+		entries: make(map[string]*keyspaceSchemaEntry),
+	}
+}
+
+func (ksc *keyspaceSchemaCache) get(ctx context.Context, keyspace string, options *schemaOptions) (*wrangler.KeyspaceSchema, error) {
+	wr := wrangler.New(logutil.NewConsoleLogger(), ksc.ts, tmclient.NewTabletManagerClient(), *lockTimeout)
+	shards, err := wr.GetKeyspaceSchemas(ctx, keyspace, options.ExcludeTables, options.IncludeViews, wrangler.DefaultSchemaFetchConcurrency)
+	if err != nil {
+		return nil, err
+	}
+
+	key := fmt.Sprintf("%v|%v|%v", keyspace, strings.Join(options.ExcludeTables, ","), options.IncludeViews)
+	versions := make([]string, len(shards))
+	for i, ss := range shards {
+		if ss.Schema != nil {
+			versions[i] = fmt.Sprintf("%v@%v=%v", ss.Shard, ss.Master, ss.Schema.Version)
+		} else {
+			versions[i] = fmt.Sprintf("%v@%v!%v", ss.Shard, ss.Master, ss.Error)
+		}
+	}
+	version := strings.Join(versions, " ")
+
+	ksc.mu.Lock()
+	defer ksc.mu.Unlock()
+	if entry, ok := ksc.entries[key]; ok && entry.versions == version {
+		return entry.schema, nil
+	}
+	schema := wrangler.NewKeyspaceSchema(keyspace, shards)
+	ksc.entries[key] = &keyspaceSchemaEntry{versions: version, schema: schema}
+	return schema, nil
+}
+
+// SchemaPage is the data of the schema.html template. Without a
+// Schema, it lists the Keyspaces.
+type SchemaPage struct {
+	Keyspaces     []string
+	Schema        *wrangler.KeyspaceSchema
+	ExcludeTables string
+	IncludeViews  bool
+	Error         string
+}
+
+func handleSchemaPage(ts topo.Server, cache *keyspaceSchemaCache) {
+	http.HandleFunc("/schema/", func(w http.ResponseWriter, r *http.Request) {
+		keyspace := strings.TrimPrefix(r.URL.Path, "/schema/")
+		page := &SchemaPage{}
+		if keyspace == "" {
+			keyspaces, err := ts.GetKeyspaces()
+			if err != nil {
+				page.Error = err.Error()
+			}
+			page.Keyspaces = keyspaces
+			templateLoader.ServeTemplate("schema.html", page, w, r)
+			return
+		}
+
+		options, err := parseSchemaOptions(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		page.ExcludeTables = strings.Join(options.ExcludeTables, ",")
+		page.IncludeViews = options.IncludeViews
+		ctx, cancel := context.WithTimeout(context.TODO(), *actionTimeout)
+		defer cancel()
+		if page.Schema, err = cache.get(ctx, keyspace, options); err != nil {
+			page.Error = err.Error()
+		}
+		templateLoader.ServeTemplate("schema.html", page, w, r)
+	})
+}
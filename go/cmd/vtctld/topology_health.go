@@ -0,0 +1,56 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"sync"
+	"time"
+
+	"github.com/youtube/vitess/go/vt/logutil"
+	"github.com/youtube/vitess/go/vt/tabletmanager/tmclient"
+	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/vt/wrangler"
+	"golang.org/x/net/context"
+)
+
+// This file contains the cache behind /api/topology_health, so a
+// dashboard or an alert polling it doesn't run the checks each time.
+
+var (
+	topologyHealthBudget      = flag.Duration("topology_health_budget", 5*time.Second, "longest time /api/topology_health checks shards for, the report only covers a sample of them past it")
+	topologyHealthCacheTTL    = flag.Duration("topology_health_cache_ttl", 10*time.Second, "how long /api/topology_health serves the same report")
+	topologyHealthConcurrency = flag.Int("topology_health_concurrency", 8, "number of shards /api/topology_health checks at a time")
+)
+
+// topologyHealthCache keeps the last report for topologyHealthCacheTTL.
+// The requests that come while it is computed wait for it.
+type topologyHealthCache struct {
+	ts topo.Server
+
+	mu       sync.Mutex
+	health   *wrangler.TopologyHealth
+	computed time.Time
+}
+
+func newTopologyHealthCache(ts topo.Server) *topologyHealthCache {
+	return &topologyHealthCache{ts: ts}
+}
+
+func (thc *topologyHealthCache) get(ctx context.Context) (*wrangler.TopologyHealth, error) {
+	thc.mu.Lock()
+	defer thc.mu.Unlock()
+	if thc.health != nil && time.Since(thc.computed) < *topologyHealthCacheTTL {
+		return thc.health, nil
+	}
+	wr := wrangler.New(logutil.NewConsoleLogger(), thc.ts, tmclient.NewTabletManagerClient(), *lockTimeout)
+	health, err := wr.GetTopologyHealth(ctx, *topologyHealthBudget, *topologyHealthConcurrency)
+	if err != nil {
+		return nil, err
+	}
+	thc.health = health
+	thc.computed = time.Now()
+	return health, nil
+}
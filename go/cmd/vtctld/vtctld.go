@@ -77,7 +77,7 @@ func main() {
 
 	actionRepo.RegisterKeyspaceAction("ValidateSchemaKeyspace",
 		func(ctx context.Context, wr *wrangler.Wrangler, keyspace string, r *http.Request) (string, error) {
-			return "", wr.ValidateSchemaKeyspace(ctx, keyspace, nil, false)
+			return "", wr.ValidateSchemaKeyspace(ctx, keyspace, nil, false, false, wrangler.DefaultSchemaFetchConcurrency)
 		})
 
 	actionRepo.RegisterKeyspaceAction("ValidateVersionKeyspace",
@@ -91,28 +91,53 @@ func main() {
 		})
 
 	// shard actions
-	actionRepo.RegisterShardAction("ValidateShard",
+	actionRepo.RegisterShardAction("ValidateShard", false,
 		func(ctx context.Context, wr *wrangler.Wrangler, keyspace, shard string, r *http.Request) (string, error) {
 			return "", wr.ValidateShard(ctx, keyspace, shard, false)
 		})
 
-	actionRepo.RegisterShardAction("ValidateSchemaShard",
+	actionRepo.RegisterShardAction("ValidateSchemaShard", false,
 		func(ctx context.Context, wr *wrangler.Wrangler, keyspace, shard string, r *http.Request) (string, error) {
-			return "", wr.ValidateSchemaShard(ctx, keyspace, shard, nil, false)
+			return "", wr.ValidateSchemaShard(ctx, keyspace, shard, nil, false, false, false, wrangler.DefaultSchemaFetchConcurrency)
 		})
 
-	actionRepo.RegisterShardAction("ValidateVersionShard",
+	actionRepo.RegisterShardAction("ValidateVersionShard", false,
 		func(ctx context.Context, wr *wrangler.Wrangler, keyspace, shard string, r *http.Request) (string, error) {
 			return "", wr.ValidateVersionShard(ctx, keyspace, shard)
 		})
 
-	actionRepo.RegisterShardAction("ValidatePermissionsShard",
+	actionRepo.RegisterShardAction("ValidatePermissionsShard", false,
 		func(ctx context.Context, wr *wrangler.Wrangler, keyspace, shard string, r *http.Request) (string, error) {
 			return "", wr.ValidatePermissionsShard(ctx, keyspace, shard)
 		})
 
+	actionRepo.RegisterShardAction("RebuildShardGraph", false,
+		func(ctx context.Context, wr *wrangler.Wrangler, keyspace, shard string, r *http.Request) (string, error) {
+			_, err := wr.RebuildShardGraph(ctx, keyspace, shard, nil)
+			return "", err
+		})
+
+	actionRepo.RegisterShardAction("PlannedReparent", true,
+		func(ctx context.Context, wr *wrangler.Wrangler, keyspace, shard string, r *http.Request) (string, error) {
+			candidate := r.FormValue("candidate")
+			if candidate == "" {
+				return "", fmt.Errorf("PlannedReparent requires a candidate tablet alias")
+			}
+			tabletAlias, err := topo.ParseTabletAliasString(candidate)
+			if err != nil {
+				return "", err
+			}
+			waitSlaveTimeout := 30 * time.Second
+			if value := r.FormValue("wait_slave_timeout"); value != "" {
+				if waitSlaveTimeout, err = time.ParseDuration(value); err != nil {
+					return "", fmt.Errorf("invalid wait_slave_timeout: %v", err)
+				}
+			}
+			return "", wr.PlannedReparentShard(ctx, keyspace, shard, tabletAlias, waitSlaveTimeout)
+		})
+
 	// tablet actions
-	actionRepo.RegisterTabletAction("Ping", "",
+	actionRepo.RegisterTabletAction("Ping", "", false,
 		func(ctx context.Context, wr *wrangler.Wrangler, tabletAlias topo.TabletAlias, r *http.Request) (string, error) {
 			ti, err := wr.TopoServer().GetTablet(tabletAlias)
 			if err != nil {
@@ -121,7 +146,30 @@ func main() {
 			return "", wr.TabletManagerClient().Ping(ctx, ti)
 		})
 
-	actionRepo.RegisterTabletAction("ScrapTablet", acl.ADMIN,
+	actionRepo.RegisterTabletAction("RefreshState", "", false,
+		func(ctx context.Context, wr *wrangler.Wrangler, tabletAlias topo.TabletAlias, r *http.Request) (string, error) {
+			ti, err := wr.TopoServer().GetTablet(tabletAlias)
+			if err != nil {
+				return "", err
+			}
+			return "", wr.TabletManagerClient().RefreshState(ctx, ti)
+		})
+
+	actionRepo.RegisterTabletAction("ReloadSchema", "", false,
+		func(ctx context.Context, wr *wrangler.Wrangler, tabletAlias topo.TabletAlias, r *http.Request) (string, error) {
+			return "", wr.ReloadSchema(ctx, tabletAlias)
+		})
+
+	actionRepo.RegisterTabletAction("ChangeType", acl.ADMIN, true,
+		func(ctx context.Context, wr *wrangler.Wrangler, tabletAlias topo.TabletAlias, r *http.Request) (string, error) {
+			newType := topo.TabletType(r.FormValue("type"))
+			if !topo.IsTypeInList(newType, topo.AllTabletTypes) {
+				return "", fmt.Errorf("invalid tablet type '%v'", newType)
+			}
+			return "", wr.ChangeType(ctx, tabletAlias, newType, false)
+		})
+
+	actionRepo.RegisterTabletAction("ScrapTablet", acl.ADMIN, true,
 		func(ctx context.Context, wr *wrangler.Wrangler, tabletAlias topo.TabletAlias, r *http.Request) (string, error) {
 			// refuse to scrap tablets that are not spare
 			ti, err := wr.TopoServer().GetTablet(tabletAlias)
@@ -134,7 +182,7 @@ func main() {
 			return "", wr.Scrap(ctx, tabletAlias, false, false)
 		})
 
-	actionRepo.RegisterTabletAction("ScrapTabletForce", acl.ADMIN,
+	actionRepo.RegisterTabletAction("ScrapTabletForce", acl.ADMIN, true,
 		func(ctx context.Context, wr *wrangler.Wrangler, tabletAlias topo.TabletAlias, r *http.Request) (string, error) {
 			// refuse to scrap tablets that are not spare
 			ti, err := wr.TopoServer().GetTablet(tabletAlias)
@@ -147,7 +195,7 @@ func main() {
 			return "", wr.Scrap(ctx, tabletAlias, true, false)
 		})
 
-	actionRepo.RegisterTabletAction("DeleteTablet", acl.ADMIN,
+	actionRepo.RegisterTabletAction("DeleteTablet", acl.ADMIN, true,
 		func(ctx context.Context, wr *wrangler.Wrangler, tabletAlias topo.TabletAlias, r *http.Request) (string, error) {
 			return "", wr.DeleteTablet(tabletAlias)
 		})
@@ -478,6 +526,17 @@ func main() {
 		}
 		w.Write(result)
 	})
+
+	// serve the topology records, and run the actions on them
+	schemaCache := newKeyspaceSchemaCache(ts)
+	handleTopoAPI(ts, actionRepo, schemaCache)
+
+	// compare the schemas of the shards of a keyspace
+	handleSchemaPage(ts, schemaCache)
+
+	// serve the jobs of the vtctld actions and remote vtctl commands
+	handleJobsAPI(wrangler.DefaultJobRegistry)
+
 	http.HandleFunc("/json/schema-manager", func(w http.ResponseWriter, r *http.Request) {
 		if err := r.ParseForm(); err != nil {
 			httpError(w, "cannot parse form: %s", err)
@@ -5,14 +5,16 @@ import (
 
 	"github.com/youtube/vitess/go/vt/health"
 	"github.com/youtube/vitess/go/vt/mysqlctl"
+	"github.com/youtube/vitess/go/vt/tabletmanager"
 )
 
 var (
-	enableReplicationLagCheck = flag.Bool("enable_replication_lag_check", false, "will register the mysql health check module that directly calls mysql")
+	enableReplicationReporter = flag.Bool("enable_replication_reporter", false, "will register the replication reporter health check module, so broken or lagging replication makes the tablet unhealthy (see also -repair_replication and -heartbeat_enable)")
+	enableReplicationLagCheck = flag.Bool("enable_replication_lag_check", false, "(DEPRECATED) use -enable_replication_reporter instead")
 )
 
 func registerHealthReporter(mysqld *mysqlctl.Mysqld) {
-	if *enableReplicationLagCheck {
-		health.DefaultAggregator.Register("replication_reporter", mysqlctl.MySQLReplicationLag(mysqld))
+	if *enableReplicationReporter || *enableReplicationLagCheck {
+		health.DefaultAggregator.Register("replication_reporter", tabletmanager.NewReplicationReporter(mysqld))
 	}
 }
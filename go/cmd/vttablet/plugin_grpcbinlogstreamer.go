@@ -0,0 +1,16 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+// Imports and register the gRPC binlog streamer
+
+import (
+	_ "github.com/youtube/vitess/go/vt/binlog/grpcbinlogstreamer"
+	"github.com/youtube/vitess/go/vt/servenv"
+)
+
+func init() {
+	servenv.RegisterGRPCFlags()
+}
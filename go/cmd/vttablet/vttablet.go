@@ -85,8 +85,9 @@ func main() {
 	}
 	dbcfgs.App.EnableRowcache = *enableRowcache
 
+	// the ACLs of -table-acl-config and -table_acl_from_topo
+	tableacl.Register("simpleacl", &simpleacl.Factory{})
 	if *tableAclConfig != "" {
-		tableacl.Register("simpleacl", &simpleacl.Factory{})
 		tableacl.Init(*tableAclConfig)
 	}
 
@@ -114,11 +115,13 @@ func main() {
 	servenv.OnTerm(func() {
 		qsc.DisallowQueries()
 		binlog.DisableUpdateStreamService()
-		agent.Stop()
 	})
 	servenv.OnClose(func() {
-		// We will still use the topo server during lameduck period
-		// to update our state, so closing it in OnClose()
+		// The tablet manager actions in flight had the lameduck
+		// period to finish, we can now stop the agent. We will
+		// still use the topo server during lameduck period to
+		// update our state, so closing it in OnClose() too.
+		agent.Stop()
 		topo.CloseServers()
 	})
 	servenv.RunDefault()
@@ -0,0 +1,180 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/youtube/vitess/go/vt/logutil"
+	"github.com/youtube/vitess/go/vt/servenv"
+	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/vt/worker"
+	"github.com/youtube/vitess/go/vt/wrangler"
+)
+
+const (
+	defaultChecksumTabletTypes = "replica,rdonly"
+	defaultChecksumChunkCount  = 10
+)
+
+const checksumHTML = `
+<!DOCTYPE html>
+<head>
+  <title>Checksum Action</title>
+</head>
+<body>
+  <h1>Checksum Action</h1>
+
+    {{if .Error}}
+      <b>Error:</b> {{.Error}}</br>
+    {{else}}
+      <p>Choose the keyspace to check.</p>
+      <ul>
+      {{range $i, $keyspace := .Keyspaces}}
+        <li><a href="/Diffs/Checksum?keyspace={{$keyspace}}">{{$keyspace}}</a></li>
+      {{end}}
+      </ul>
+    {{end}}
+</body>
+`
+
+const checksumHTML2 = `
+<!DOCTYPE html>
+<head>
+  <title>Checksum Action</title>
+</head>
+<body>
+  <p>Keyspace involved: {{.Keyspace}}</p>
+  <h1>Checksum Action</h1>
+    <form action="/Diffs/Checksum" method="post">
+      <LABEL for="tables">Tables: </LABEL>
+        <INPUT type="text" id="tables" name="tables" value=""></BR>
+      <LABEL for="tabletTypes">Tablet Types: </LABEL>
+        <INPUT type="text" id="tabletTypes" name="tabletTypes" value="{{.DefaultTabletTypes}}"></BR>
+      <LABEL for="chunkCount">Chunk Count: </LABEL>
+        <INPUT type="text" id="chunkCount" name="chunkCount" value="{{.DefaultChunkCount}}"></BR>
+      <LABEL for="minTableSizeForSplit">Minimun Table Size For Split: </LABEL>
+        <INPUT type="text" id="minTableSizeForSplit" name="minTableSizeForSplit" value="{{.DefaultMinTableSizeForSplit}}"></BR>
+      <INPUT type="hidden" name="keyspace" value="{{.Keyspace}}"/>
+      <INPUT type="submit" name="submit" value="Checksum"/>
+    </form>
+
+  <h1>Help</h1>
+    <p>The master of each shard computes the checksums of its tables, and the replicas of the tablet types compute them again when they replicate the statements. The masters need the STATEMENT binlog format.</p>
+    <p>Tables is a comma separated list of the tables to check, all of them if empty.</p>
+  </body>
+`
+
+var checksumTemplate = mustParseTemplate("checksum", checksumHTML)
+var checksumTemplate2 = mustParseTemplate("checksum2", checksumHTML2)
+
+// parseTabletTypes parses a comma separated list of tablet types.
+func parseTabletTypes(value string) []topo.TabletType {
+	var result []topo.TabletType
+	for _, tabletType := range strings.Split(value, ",") {
+		if tabletType != "" {
+			result = append(result, topo.TabletType(tabletType))
+		}
+	}
+	return result
+}
+
+func commandChecksum(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) (worker.Worker, error) {
+	tables := subFlags.String("tables", "", "comma separated list of tables to check, all of them if empty")
+	tabletTypes := subFlags.String("tablet_types", defaultChecksumTabletTypes, "comma separated list of the types of the tablets to check")
+	chunkCount := subFlags.Int("chunk_count", defaultChecksumChunkCount, "number of chunks each table is checked in, if possible")
+	minTableSizeForSplit := subFlags.Int("min_table_size_for_split", defaultMinTableSizeForSplit, "tables bigger than this size on disk in bytes will be split into chunk_count chunks if possible")
+	if err := subFlags.Parse(args); err != nil {
+		return nil, err
+	}
+	if subFlags.NArg() != 1 {
+		return nil, fmt.Errorf("command Checksum requires <keyspace>")
+	}
+
+	var tableArray []string
+	if *tables != "" {
+		tableArray = strings.Split(*tables, ",")
+	}
+	worker, err := worker.NewChecksumWorker(wr, subFlags.Arg(0), tableArray, parseTabletTypes(*tabletTypes), *chunkCount, uint64(*minTableSizeForSplit))
+	if err != nil {
+		return nil, fmt.Errorf("cannot create checksum worker: %v", err)
+	}
+	return worker, nil
+}
+
+func interactiveChecksum(wr *wrangler.Wrangler, w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		httpError(w, "cannot parse form: %s", err)
+		return
+	}
+
+	keyspace := r.FormValue("keyspace")
+	if keyspace == "" {
+		// display the list of keyspaces to choose from
+		result := make(map[string]interface{})
+		keyspaces, err := wr.TopoServer().GetKeyspaces()
+		if err != nil {
+			result["Error"] = err.Error()
+		} else {
+			result["Keyspaces"] = keyspaces
+		}
+
+		executeTemplate(w, checksumTemplate, result)
+		return
+	}
+
+	submitButtonValue := r.FormValue("submit")
+	if submitButtonValue == "" {
+		// display the input form
+		result := make(map[string]interface{})
+		result["Keyspace"] = keyspace
+		result["DefaultTabletTypes"] = defaultChecksumTabletTypes
+		result["DefaultChunkCount"] = fmt.Sprintf("%v", defaultChecksumChunkCount)
+		result["DefaultMinTableSizeForSplit"] = fmt.Sprintf("%v", defaultMinTableSizeForSplit)
+		executeTemplate(w, checksumTemplate2, result)
+		return
+	}
+
+	// Process input form.
+	tables := r.FormValue("tables")
+	var tableArray []string
+	if tables != "" {
+		tableArray = strings.Split(tables, ",")
+	}
+	chunkCount, err := strconv.ParseInt(r.FormValue("chunkCount"), 0, 64)
+	if err != nil {
+		httpError(w, "cannot parse chunkCount: %s", err)
+		return
+	}
+	minTableSizeForSplit, err := strconv.ParseInt(r.FormValue("minTableSizeForSplit"), 0, 64)
+	if err != nil {
+		httpError(w, "cannot parse minTableSizeForSplit: %s", err)
+		return
+	}
+
+	// start the checksum job
+	wrk, err := worker.NewChecksumWorker(wr, keyspace, tableArray, parseTabletTypes(r.FormValue("tabletTypes")), int(chunkCount), uint64(minTableSizeForSplit))
+	if err != nil {
+		httpError(w, "cannot create worker: %v", err)
+		return
+	}
+	if _, err := setAndStartWorker(wrk, logutil.NewConsoleLogger()); err != nil {
+		httpError(w, "cannot set worker: %s", err)
+		return
+	}
+
+	http.Redirect(w, r, servenv.StatusURLPath(), http.StatusTemporaryRedirect)
+}
+
+func init() {
+	addCommand("Diffs", command{"Checksum",
+		commandChecksum, interactiveChecksum,
+		"[--tables=''] [--tablet_types='" + defaultChecksumTabletTypes + "'] [--chunk_count=10] <keyspace>",
+		"Checks that the replicas of each shard of a keyspace have the same data as their master, and reports the chunks of tables that differ."})
+}
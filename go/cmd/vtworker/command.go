@@ -12,8 +12,10 @@ import (
 	"time"
 
 	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/vt/logutil"
 	"github.com/youtube/vitess/go/vt/worker"
 	"github.com/youtube/vitess/go/vt/wrangler"
+	"golang.org/x/net/context"
 )
 
 var (
@@ -80,7 +82,9 @@ func commandWorker(wr *wrangler.Wrangler, args []string) (worker.Worker, error)
 	for _, group := range commands {
 		for _, cmd := range group.Commands {
 			if strings.ToLower(cmd.Name) == actionLowerCase {
-				subFlags := flag.NewFlagSet(action, flag.ExitOnError)
+				// the command may come from a remote caller, who
+				// gets the parse errors back
+				subFlags := flag.NewFlagSet(action, flag.ContinueOnError)
 				subFlags.Usage = func() {
 					fmt.Fprintf(os.Stderr, "Usage: %s %s %s\n\n", os.Args[0], cmd.Name, cmd.params)
 					fmt.Fprintf(os.Stderr, "%s\n\n", cmd.Help)
@@ -99,7 +103,7 @@ func runCommand(args []string) error {
 	if err != nil {
 		return err
 	}
-	done, err := setAndStartWorker(wrk)
+	done, err := setAndStartWorker(wrk, logutil.NewConsoleLogger())
 	if err != nil {
 		return fmt.Errorf("cannot set worker: %v", err)
 	}
@@ -128,3 +132,66 @@ func runCommand(args []string) error {
 
 	return nil
 }
+
+// runCommandFromRPC runs a command for a remote caller, and waits for
+// it to be done. If the caller goes away, the command is canceled.
+// A command that succeeded is reset right away, so the caller can run
+// the next one. One that failed stays on the status page until it is
+// reset there.
+func runCommandFromRPC(ctx context.Context, args []string, logger logutil.Logger) error {
+	if len(args) == 0 {
+		return fmt.Errorf("no vtworker command was given")
+	}
+	wrk, err := commandWorker(wr, args)
+	if err != nil {
+		return err
+	}
+	done, err := setAndStartWorker(wrk, logutil.NewTeeLogger(logger, logutil.NewConsoleLogger()))
+	if err != nil {
+		return fmt.Errorf("cannot set worker: %v", err)
+	}
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		currentWorkerMutex.Lock()
+		if currentCancelFunc != nil {
+			currentCancelFunc()
+		}
+		currentWorkerMutex.Unlock()
+		<-done
+	}
+
+	currentWorkerMutex.Lock()
+	defer currentWorkerMutex.Unlock()
+	if lastRunError != nil {
+		return lastRunError
+	}
+	if currentWorker == wrk {
+		currentWorker = nil
+		currentMemoryLogger = nil
+	}
+	return nil
+}
+
+// cancelCommandFromRPC cancels the running command for a remote
+// caller, waits until it cleaned up, and returns its final status.
+func cancelCommandFromRPC(ctx context.Context) (string, error) {
+	wrk, done, err := cancelCurrentWorker()
+	if err != nil {
+		return "", err
+	}
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return "", fmt.Errorf("the worker is still stopping: %v", ctx.Err())
+	}
+
+	status := wrk.StatusAsText()
+	currentWorkerMutex.Lock()
+	defer currentWorkerMutex.Unlock()
+	if currentWorker == wrk && lastRunError != nil {
+		status += fmt.Sprintf("\nEnded with an error: %v\n", lastRunError)
+	}
+	return status, nil
+}
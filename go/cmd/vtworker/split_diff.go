@@ -12,6 +12,7 @@ import (
 	"sync"
 
 	"github.com/youtube/vitess/go/vt/concurrency"
+	"github.com/youtube/vitess/go/vt/logutil"
 	"github.com/youtube/vitess/go/vt/servenv"
 	"github.com/youtube/vitess/go/vt/topo"
 	"github.com/youtube/vitess/go/vt/worker"
@@ -59,7 +60,9 @@ var splitDiffTemplate2 = mustParseTemplate("splitDiff2", splitDiffHTML2)
 
 func commandSplitDiff(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) (worker.Worker, error) {
 	excludeTables := subFlags.String("exclude_tables", "", "comma separated list of tables to exclude")
-	subFlags.Parse(args)
+	if err := subFlags.Parse(args); err != nil {
+		return nil, err
+	}
 	if subFlags.NArg() != 1 {
 		return nil, fmt.Errorf("command SplitDiff requires <keyspace/shard>")
 	}
@@ -169,7 +172,7 @@ func interactiveSplitDiff(wr *wrangler.Wrangler, w http.ResponseWriter, r *http.
 
 	// start the diff job
 	wrk := worker.NewSplitDiffWorker(wr, *cell, keyspace, shard, excludeTableArray)
-	if _, err := setAndStartWorker(wrk); err != nil {
+	if _, err := setAndStartWorker(wrk, logutil.NewConsoleLogger()); err != nil {
 		httpError(w, "cannot set worker: %s", err)
 		return
 	}
@@ -12,6 +12,7 @@ import (
 
 	"github.com/youtube/vitess/go/acl"
 	"github.com/youtube/vitess/go/vt/servenv"
+	"github.com/youtube/vitess/go/vt/worker"
 )
 
 const workerStatusPartHTML = servenv.JQueryIncludes + `
@@ -36,6 +37,7 @@ const workerStatusHTML = `
 <title>Worker Status</title>
 </head>
 <body>
+<h1>State: {{.State}}</h1>
 {{if .Status}}
   <h2>Worker status:</h2>
   <blockquote>
@@ -48,12 +50,22 @@ const workerStatusHTML = `
   {{if .Done}}
   <p><a href="/reset">Reset Job</a></p>
   {{else}}
+    {{if .Cancelling}}
+  <p>Cancelling the job: it stops after its chunks in progress, and cleans up.</p>
+    {{else}}
   <p><a href="/cancel">Cancel Job</a></p>
+    {{end}}
   {{end}}
 {{else}}
   <p>This worker is idle.</p>
   <p><a href="/">Toplevel Menu</a></p>
 {{end}}
+<h2>Throttling of the clones:</h2>
+<form action="/throttler" method="POST">
+  <p>Maximum transactions per second per destination tablet, 0 for no limit: <input name="max_tps" value="{{.MaxTPS}}"></p>
+  <p>Maximum replication lag of the destination replicas before the writes pause, 0 to never pause: <input name="max_replication_lag" value="{{.MaxReplicationLag}}"></p>
+  <input type="submit" value="Change">
+</form>
 </body>
 </html>
 `
@@ -70,16 +82,26 @@ func initStatusHandling() {
 		wrk := currentWorker
 		logger := currentMemoryLogger
 		ctx := currentContext
+		cancelling := currentCancelling
 		err := lastRunError
 		currentWorkerMutex.Unlock()
 
 		data := make(map[string]interface{})
+		data["MaxTPS"], data["MaxReplicationLag"] = worker.ThrottlerSettings()
+		data["State"] = "idle"
 		if wrk != nil {
+			data["State"] = "running"
+			if cancelling {
+				data["State"] = "cancelling"
+				data["Cancelling"] = true
+			}
 			status := template.HTML("Current worker:<br>\n") + wrk.StatusAsHTML()
 			if ctx == nil {
 				data["Done"] = true
+				data["State"] = "done"
 				if err != nil {
-					status += template.HTML(fmt.Sprintf("<br>\nEnded with an error: %v<br>\n", err))
+					data["State"] = "error"
+					status += template.HTML(fmt.Sprintf("<br>\nEnded with an error: %v<br>\n", template.HTMLEscapeString(err.Error())))
 				}
 			}
 			data["Status"] = status
@@ -97,6 +119,9 @@ func initStatusHandling() {
 		return nil
 	})
 
+	// throttler settings handler
+	http.HandleFunc("/throttler", worker.ServeThrottlerHTTP)
+
 	// reset handler
 	http.HandleFunc("/reset", func(w http.ResponseWriter, r *http.Request) {
 		if err := acl.CheckAccessHTTP(r, acl.ADMIN); err != nil {
@@ -133,19 +158,13 @@ func initStatusHandling() {
 			return
 		}
 
-		currentWorkerMutex.Lock()
-
 		// no worker, or not running, we go to the menu
-		if currentWorker == nil || currentCancelFunc == nil {
-			currentWorkerMutex.Unlock()
+		if _, _, err := cancelCurrentWorker(); err != nil {
 			http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
 			return
 		}
 
-		// otherwise, cancel the running worker and go back to the status page
-		cancel := currentCancelFunc
-		currentWorkerMutex.Unlock()
-		cancel()
+		// otherwise, the running worker is stopping, go back to the status page
 		http.Redirect(w, r, servenv.StatusURLPath(), http.StatusTemporaryRedirect)
 
 	})
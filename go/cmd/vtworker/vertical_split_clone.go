@@ -13,6 +13,7 @@ import (
 	"sync"
 
 	"github.com/youtube/vitess/go/vt/concurrency"
+	"github.com/youtube/vitess/go/vt/logutil"
 	"github.com/youtube/vitess/go/vt/servenv"
 	"github.com/youtube/vitess/go/vt/topo"
 	"github.com/youtube/vitess/go/vt/worker"
@@ -92,7 +93,9 @@ func commandVerticalSplitClone(wr *wrangler.Wrangler, subFlags *flag.FlagSet, ar
 	destinationPackCount := subFlags.Int("destination_pack_count", defaultDestinationPackCount, "number of packets to pack in one destination insert")
 	minTableSizeForSplit := subFlags.Int("min_table_size_for_split", defaultMinTableSizeForSplit, "tables bigger than this size on disk in bytes will be split into source_reader_count chunks if possible")
 	destinationWriterCount := subFlags.Int("destination_writer_count", defaultDestinationWriterCount, "number of concurrent RPCs to execute on the destination")
-	subFlags.Parse(args)
+	if err := subFlags.Parse(args); err != nil {
+		return nil, err
+	}
 	if subFlags.NArg() != 1 {
 		return nil, fmt.Errorf("command VerticalSplitClone requires <destination keyspace/shard>")
 	}
@@ -218,7 +221,7 @@ func interactiveVerticalSplitClone(wr *wrangler.Wrangler, w http.ResponseWriter,
 	if err != nil {
 		httpError(w, "cannot create worker: %v", err)
 	}
-	if _, err := setAndStartWorker(wrk); err != nil {
+	if _, err := setAndStartWorker(wrk, logutil.NewConsoleLogger()); err != nil {
 		httpError(w, "cannot set worker: %s", err)
 		return
 	}
@@ -8,7 +8,13 @@ vtworker is the main program to run a worker job.
 It has two modes: single command or interactive.
 - in single command, it will start the job passed in from the command line,
   and exit.
-- in interactive mode, use a web browser to start an action.
+- in interactive mode, use a web browser to start an action, or run
+  'vtctl VtWorker -server <vtworker> <command>'. It runs one job at a
+  time, which the status page follows.
+
+A job can be cancelled from the status page, with 'vtctl WorkerCancel',
+or by sending SIGINT or SIGTERM to vtworker: it stops at the next chunk
+boundary, and cleans up. SIGTERM exits once it is done.
 */
 package main
 
@@ -28,12 +34,14 @@ import (
 	"github.com/youtube/vitess/go/vt/tabletmanager/tmclient"
 	"github.com/youtube/vitess/go/vt/topo"
 	"github.com/youtube/vitess/go/vt/worker"
+	"github.com/youtube/vitess/go/vt/worker/gorpcvtworkerserver"
 	"github.com/youtube/vitess/go/vt/wrangler"
 	"golang.org/x/net/context"
 )
 
 var (
-	cell = flag.String("cell", "", "cell to pick servers from")
+	cell              = flag.String("cell", "", "cell to pick servers from")
+	cancelGracePeriod = flag.Duration("cancel_grace_period", 5*time.Second, "how long a cancelled job may take to finish its chunks in progress before it is interrupted, then cleans up. On SIGTERM, vtworker exits after -onterm_timeout anyway, which should leave time for the clean up")
 )
 
 func init() {
@@ -53,33 +61,69 @@ var (
 	// - (at least) one worker already ran, none is running atm:
 	//   currentWorker is set, currentContext is nil, lastRunError
 	//   has the error returned by the worker.
+	// currentDone is closed when the current worker is done, and
+	// currentCancelling is set once it was cancelled.
 	currentWorkerMutex  sync.Mutex
 	currentWorker       worker.Worker
 	currentMemoryLogger *logutil.MemoryLogger
 	currentContext      context.Context
 	currentCancelFunc   context.CancelFunc
+	currentDone         chan struct{}
+	currentCancelling   bool
 	lastRunError        error
 )
 
-// signal handling, centralized here
+// signal handling, centralized here. SIGINT cancels the running
+// worker. SIGTERM also makes servenv exit, once the worker cleaned up.
 func installSignalHandlers() {
 	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGTERM, syscall.SIGINT)
+	signal.Notify(sigChan, syscall.SIGINT)
 	go func() {
-		<-sigChan
-		// we got a signal, notify our modules
-		currentWorkerMutex.Lock()
-		defer currentWorkerMutex.Unlock()
-		if currentCancelFunc != nil {
-			currentCancelFunc()
+		for range sigChan {
+			cancelCurrentWorker()
 		}
 	}()
+	servenv.OnTermSync(func() {
+		if _, done, err := cancelCurrentWorker(); err == nil {
+			<-done
+		}
+	})
+}
+
+// cancelCurrentWorker asks the running worker to stop at its next
+// chunk boundary, and interrupts it if it didn't after
+// -cancel_grace_period. Either way, it cleans up before it is done. It
+// returns the worker, and a channel closed once it is done.
+func cancelCurrentWorker() (worker.Worker, chan struct{}, error) {
+	currentWorkerMutex.Lock()
+	defer currentWorkerMutex.Unlock()
+	if currentWorker == nil || currentCancelFunc == nil {
+		return nil, nil, fmt.Errorf("no worker is running")
+	}
+	wrk := currentWorker
+	done := currentDone
+	if !currentCancelling {
+		log.Infof("Cancelling the worker, it will be interrupted if it doesn't stop within %v", *cancelGracePeriod)
+		currentCancelling = true
+		wrk.Cancel()
+		cancel := currentCancelFunc
+		go func() {
+			select {
+			case <-done:
+			case <-time.After(*cancelGracePeriod):
+				log.Warningf("The worker didn't stop within %v, interrupting it", *cancelGracePeriod)
+				cancel()
+			}
+		}()
+	}
+	return wrk, done, nil
 }
 
 // setAndStartWorker will set the current worker.
 // We always log to both memory logger (for display on the web) and
-// console logger (for records / display of command line worker).
-func setAndStartWorker(wrk worker.Worker) (chan struct{}, error) {
+// logger: the console logger (for records / display of command line
+// worker), teed with the stream of a remote caller.
+func setAndStartWorker(wrk worker.Worker, logger logutil.Logger) (chan struct{}, error) {
 	currentWorkerMutex.Lock()
 	defer currentWorkerMutex.Unlock()
 	if currentWorker != nil {
@@ -91,7 +135,9 @@ func setAndStartWorker(wrk worker.Worker) (chan struct{}, error) {
 	currentContext, currentCancelFunc = context.WithCancel(context.Background())
 	lastRunError = nil
 	done := make(chan struct{})
-	wr.SetLogger(logutil.NewTeeLogger(currentMemoryLogger, logutil.NewConsoleLogger()))
+	currentDone = done
+	currentCancelling = false
+	wr.SetLogger(logutil.NewTeeLogger(currentMemoryLogger, logger))
 
 	// one go function runs the worker, changes state when done
 	go func() {
@@ -104,6 +150,8 @@ func setAndStartWorker(wrk worker.Worker) (chan struct{}, error) {
 		currentContext = nil
 		currentCancelFunc = nil
 		lastRunError = err
+		// the logger of a remote caller goes away with it
+		wr.SetLogger(logutil.NewTeeLogger(currentMemoryLogger, logutil.NewConsoleLogger()))
 		currentWorkerMutex.Unlock()
 		close(done)
 	}()
@@ -128,6 +176,7 @@ func main() {
 	if len(args) == 0 {
 		// In interactive mode, initialize the web UI to choose a command.
 		initInteractiveMode()
+		gorpcvtworkerserver.StartServer(runCommandFromRPC, cancelCommandFromRPC)
 	} else {
 		// In single command mode, just run it.
 		if err := runCommand(args); err != nil {
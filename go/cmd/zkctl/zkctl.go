@@ -10,10 +10,12 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"path"
 	"strings"
 
 	log "github.com/golang/glog"
 	"github.com/youtube/vitess/go/exit"
+	"github.com/youtube/vitess/go/vt/env"
 	"github.com/youtube/vitess/go/vt/logutil"
 	"github.com/youtube/vitess/go/zk/zkctl"
 )
@@ -22,6 +24,12 @@ var usage = `
 Commands:
 
 	init | start | shutdown | teardown
+
+With -zk.cluster, the commands handle all the servers of the cluster
+definition: init and start both start the servers that are not running,
+wait for the quorums, create the root paths of the cells and write the
+-zk.client-config file. shutdown stops the servers, and teardown also
+removes their data.
 `
 
 var (
@@ -31,6 +39,9 @@ var (
 		"which server do you want to be? only needed when running multiple instance on one box, otherwise myid is implied by hostname")
 	force = flag.Bool("force", false, "force action, no prompting")
 
+	cluster      = flag.String("zk.cluster", "", "file of the cluster definition, a JSON map of the cells to their servers in the -zk.cfg format. If set, the commands handle all the servers of the cluster, and -zk.cfg is ignored")
+	clientConfig = flag.String("zk.client-config", "", "file the cluster init writes the client addresses of the cells to, for ZK_CLIENT_CONFIG (default $VTDATAROOT/zk-client-conf.json)")
+
 	stdin *bufio.Reader
 )
 
@@ -65,6 +76,14 @@ func main() {
 		exit.Return(1)
 	}
 
+	if *cluster != "" {
+		if err := runClusterAction(flag.Arg(0)); err != nil {
+			log.Errorf("failed %v: %v", flag.Arg(0), err)
+			exit.Return(1)
+		}
+		return
+	}
+
 	zkConfig := zkctl.MakeZkConfigFromString(*zkCfg, uint32(*myId))
 	zkd := zkctl.NewZkd(zkConfig)
 
@@ -88,3 +107,23 @@ func main() {
 		exit.Return(1)
 	}
 }
+
+func runClusterAction(action string) error {
+	zc, err := zkctl.ReadZkClusterFile(*cluster)
+	if err != nil {
+		return err
+	}
+	switch action {
+	case "init", "start":
+		configFile := *clientConfig
+		if configFile == "" {
+			configFile = path.Join(env.VtDataRoot(), "zk-client-conf.json")
+		}
+		return zc.Init(configFile)
+	case "shutdown":
+		return zc.Teardown(false)
+	case "teardown":
+		return zc.Teardown(true)
+	}
+	return fmt.Errorf("invalid action: %v", action)
+}
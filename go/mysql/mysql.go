@@ -50,6 +50,9 @@ const (
 	// ErrOptionPreventsStatement is C.ER_OPTION_PREVENTS_STATEMENT
 	ErrOptionPreventsStatement = C.ER_OPTION_PREVENTS_STATEMENT
 
+	// ErrMasterFatalReadingBinlog is C.ER_MASTER_FATAL_ERROR_READING_BINLOG
+	ErrMasterFatalReadingBinlog = C.ER_MASTER_FATAL_ERROR_READING_BINLOG
+
 	// ErrServerLost is C.CR_SERVER_LOST.
 	// It's hard-coded for now because it causes problems on import.
 	ErrServerLost = 2013
@@ -43,6 +43,8 @@ type ResourcePool struct {
 	// stats
 	waitCount sync2.AtomicInt64
 	waitTime  sync2.AtomicDuration
+	inUse     sync2.AtomicInt64
+	exhausted sync2.AtomicInt64
 }
 
 type resourceWrapper struct {
@@ -117,12 +119,14 @@ func (rp *ResourcePool) get(ctx context.Context, wait bool) (resource Resource,
 	case wrapper, ok = <-rp.resources:
 	default:
 		if !wait {
+			rp.exhausted.Add(1)
 			return nil, nil
 		}
 		startTime := time.Now()
 		select {
 		case wrapper, ok = <-rp.resources:
 		case <-ctx.Done():
+			rp.exhausted.Add(1)
 			return nil, ErrTimeout
 		}
 		rp.recordWait(startTime)
@@ -141,8 +145,10 @@ func (rp *ResourcePool) get(ctx context.Context, wait bool) (resource Resource,
 		wrapper.resource, err = rp.factory()
 		if err != nil {
 			rp.resources <- resourceWrapper{}
+			return nil, err
 		}
 	}
+	rp.inUse.Add(1)
 	return wrapper.resource, err
 }
 
@@ -160,6 +166,7 @@ func (rp *ResourcePool) Put(resource Resource) {
 	default:
 		panic(errors.New("attempt to Put into a full ResourcePool"))
 	}
+	rp.inUse.Add(-1)
 }
 
 // SetCapacity changes the capacity of the pool.
@@ -253,6 +260,18 @@ func (rp *ResourcePool) WaitTime() time.Duration {
 	return rp.waitTime.Get()
 }
 
+// InUse returns the number of resources that were taken with Get or
+// TryGet and not Put back yet.
+func (rp *ResourcePool) InUse() int64 {
+	return rp.inUse.Get()
+}
+
+// Exhausted returns the number of times Get timed out or TryGet
+// returned nil because all the resources were in use.
+func (rp *ResourcePool) Exhausted() int64 {
+	return rp.exhausted.Get()
+}
+
 // IdleTimeout returns the idle timeout.
 func (rp *ResourcePool) IdleTimeout() time.Duration {
 	return rp.idleTimeout.Get()
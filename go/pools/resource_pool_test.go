@@ -525,3 +525,39 @@ func TestExpired(t *testing.T) {
 		t.Errorf("got %v, want %s", err, want)
 	}
 }
+
+func TestInUseAndExhausted(t *testing.T) {
+	ctx := context.Background()
+	lastID.Set(0)
+	count.Set(0)
+	p := NewResourcePool(PoolFactory, 1, 2, time.Second)
+	defer p.Close()
+	r, err := p.Get(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r, _ := p.TryGet(); r != nil {
+		t.Errorf("TryGet on an exhausted pool: %v", r)
+	}
+	newctx, cancel := context.WithTimeout(ctx, 1*time.Millisecond)
+	if _, err := p.Get(newctx); err != ErrTimeout {
+		t.Errorf("Get on an exhausted pool: %v", err)
+	}
+	cancel()
+	if inUse, exhausted := p.InUse(), p.Exhausted(); inUse != 1 || exhausted != 2 {
+		t.Errorf("InUse, Exhausted: %d, %d, want 1, 2", inUse, exhausted)
+	}
+
+	// a failed create is not in use
+	if err := p.SetCapacity(2); err != nil {
+		t.Fatal(err)
+	}
+	p.factory = FailFactory
+	if _, err := p.Get(ctx); err == nil {
+		t.Errorf("Get with FailFactory should fail")
+	}
+	p.Put(r)
+	if inUse := p.InUse(); inUse != 0 {
+		t.Errorf("InUse: %d, want 0", inUse)
+	}
+}
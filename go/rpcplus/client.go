@@ -14,6 +14,7 @@ import (
 	"net/http"
 	"reflect"
 	"sync"
+	"time"
 
 	"github.com/youtube/vitess/go/trace"
 	"golang.org/x/net/context"
@@ -27,6 +28,18 @@ func (e ServerError) Error() string {
 	return string(e)
 }
 
+// CodedServerError is a ServerError that came with a code, because the
+// server method returned a CodedError.
+type CodedServerError struct {
+	ServerError
+	Code int64
+}
+
+// ErrorCode returns the code sent by the server.
+func (e *CodedServerError) ErrorCode() int64 {
+	return e.Code
+}
+
 // ErrShutdown holds the specific error for closing/closed connections
 var ErrShutdown = errors.New("connection is shut down")
 
@@ -39,6 +52,7 @@ type Call struct {
 	Done          chan *Call  // Strobes when call is complete (nil for streaming RPCs)
 	Stream        bool        // True for a streaming RPC call, false otherwise
 	Subseq        uint64      // The next expected subseq in the packets
+	deadline      time.Time   // The deadline sent to the server, if any
 }
 
 // Client represents an RPC Client.
@@ -92,6 +106,7 @@ func (client *Client) send(call *Call) {
 	// Encode and send the request.
 	client.request.Seq = seq
 	client.request.ServiceMethod = call.ServiceMethod
+	client.request.Timeout = callTimeout(call.deadline)
 	err := client.codec.WriteRequest(&client.request, call.Args)
 	if err != nil {
 		client.mutex.Lock()
@@ -105,6 +120,20 @@ func (client *Client) send(call *Call) {
 	}
 }
 
+// callTimeout returns the time left before the deadline of a call, 0
+// if it has none. The server computes the deadline from it with its
+// own clock, as the clocks of the client and the server may differ. A
+// deadline that has passed is still sent, for the server to give up.
+func callTimeout(deadline time.Time) time.Duration {
+	if deadline.IsZero() {
+		return 0
+	}
+	if timeout := deadline.Sub(time.Now()); timeout > 0 {
+		return timeout
+	}
+	return time.Nanosecond
+}
+
 func (client *Client) input() {
 	var err error
 	var response Response
@@ -138,7 +167,11 @@ func (client *Client) input() {
 			// any subsequent requests will get the ReadResponseBody
 			// error if there is one.
 			if !(call.Stream && response.Error == lastStreamResponseError) {
-				call.Error = ServerError(response.Error)
+				if response.ErrorCode != 0 {
+					call.Error = &CodedServerError{ServerError(response.Error), response.ErrorCode}
+				} else {
+					call.Error = ServerError(response.Error)
+				}
 			}
 			err = client.codec.ReadResponseBody(nil)
 			if err != nil {
@@ -329,6 +362,7 @@ func (client *Client) Go(ctx context.Context, serviceMethod string, args interfa
 	call.ServiceMethod = serviceMethod
 	call.Args = args
 	call.Reply = reply
+	call.deadline, _ = ctx.Deadline()
 	if done == nil {
 		done = make(chan *Call, 10) // buffered.
 	} else {
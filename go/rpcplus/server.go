@@ -50,6 +50,12 @@ The Call method waits for the remote call to complete while the Go method
 launches the call asynchronously and signals completion using the Call
 structure's Done channel. The StreamGo method is always asynchronous.
 
+A method may also take a context as its first argument. Its context has
+the deadline of the context the client passed to Call or Go, and is
+canceled when the client hangs up. The client sends the time it has
+left, so the deadline doesn't depend on the clocks of the client and
+the server being in sync.
+
 Unless an explicit codec is set up, package encoding/gob is used to
 transport the data.
 
@@ -135,6 +141,7 @@ import (
 	"reflect"
 	"strings"
 	"sync"
+	"time"
 	"unicode"
 	"unicode/utf8"
 
@@ -178,9 +185,10 @@ type service struct {
 // but documented here as an aid to debugging, such as when analyzing
 // network traffic.
 type Request struct {
-	ServiceMethod string   // format: "Service.Method"
-	Seq           uint64   // sequence number chosen by client
-	next          *Request // for free list in Server
+	ServiceMethod string        // format: "Service.Method"
+	Seq           uint64        // sequence number chosen by client
+	Timeout       time.Duration // time left before the deadline of the call, 0 if it has none.
+	next          *Request      // for free list in Server
 }
 
 // Response is a header written before every RPC return. It is used internally
@@ -190,11 +198,28 @@ type Response struct {
 	ServiceMethod string    // echoes that of the Request
 	Seq           uint64    // echoes that of the request
 	Error         string    // error, if any.
+	ErrorCode     int64     // code of the error, if it has one.
 	next          *Response // for free list in Server
 }
 
 const lastStreamResponseError = "EOS"
 
+// CodedError is an error with a code. When a method returns one, the
+// code is sent in the Response next to the message, and the client
+// returns a *CodedServerError.
+type CodedError interface {
+	error
+	ErrorCode() int64
+}
+
+// errorCode returns the code of err, or 0 if it has none.
+func errorCode(err error) int64 {
+	if ce, ok := err.(CodedError); ok {
+		return ce.ErrorCode()
+	}
+	return 0
+}
+
 // Server represents an RPC Server.
 type Server struct {
 	mu         sync.Mutex // protects the serviceMap
@@ -203,11 +228,50 @@ type Server struct {
 	freeReq    *Request
 	respLock   sync.Mutex // protects freeResp
 	freeResp   *Response
+	callsLock  sync.Mutex // protects calls
+	calls      int        // number of non streaming calls in flight
+	callsDone  *sync.Cond // signaled when calls gets to 0
 }
 
 // NewServer returns a new Server.
 func NewServer() *Server {
-	return &Server{serviceMap: make(map[string]*service)}
+	server := &Server{serviceMap: make(map[string]*service)}
+	server.callsDone = sync.NewCond(&server.callsLock)
+	return server
+}
+
+// WaitForCalls blocks until the server has no call in flight,
+// including the calls started while it waits. It is used to let the
+// calls finish when the server shuts down. The streaming calls are not
+// waited for: some, like the health streams, only end when the client
+// hangs up.
+func (server *Server) WaitForCalls() {
+	server.callsLock.Lock()
+	for server.calls > 0 {
+		server.callsDone.Wait()
+	}
+	server.callsLock.Unlock()
+}
+
+func (server *Server) startCall(mtype *methodType) {
+	if mtype.stream {
+		return
+	}
+	server.callsLock.Lock()
+	server.calls++
+	server.callsLock.Unlock()
+}
+
+func (server *Server) endCall(mtype *methodType) {
+	if mtype.stream {
+		return
+	}
+	server.callsLock.Lock()
+	server.calls--
+	if server.calls == 0 {
+		server.callsDone.Broadcast()
+	}
+	server.callsLock.Unlock()
 }
 
 // DefaultServer is the default instance of *Server.
@@ -231,9 +295,10 @@ func isExportedOrBuiltinType(t reflect.Type) bool {
 
 // Register publishes in the server the set of methods of the
 // receiver value that satisfy the following conditions:
-//	- exported method
-//	- two arguments, both pointers to exported structs
-//	- one return value, of type error
+//   - exported method
+//   - two arguments, both pointers to exported structs
+//   - one return value, of type error
+//
 // It returns an error if the receiver is not an exported type or has no
 // suitable methods.
 // The client accesses each method using a string of the form "Type.Method",
@@ -377,12 +442,13 @@ func (server *Server) register(rcvr interface{}, name string, useName bool) erro
 // contains an error when it is used.
 var invalidRequest = struct{}{}
 
-func (server *Server) sendResponse(sending *sync.Mutex, req *Request, reply interface{}, codec ServerCodec, errmsg string, last bool) (err error) {
+func (server *Server) sendResponse(sending *sync.Mutex, req *Request, reply interface{}, codec ServerCodec, errmsg string, errcode int64, last bool) (err error) {
 	resp := server.getResponse()
 	// Encode the response header
 	resp.ServiceMethod = req.ServiceMethod
 	if errmsg != "" {
 		resp.Error = errmsg
+		resp.ErrorCode = errcode
 		reply = invalidRequest
 	}
 	resp.Seq = req.Seq
@@ -404,12 +470,21 @@ func (m *methodType) NumCalls() (n uint) {
 }
 
 func (s *service) call(ctx context.Context, server *Server, sending *sync.Mutex, mtype *methodType, req *Request, argv, replyv reflect.Value, codec ServerCodec) {
+	defer server.endCall(mtype)
 	mtype.Lock()
 	mtype.numCalls++
 	mtype.Unlock()
 	function := mtype.method.Func
 	var returnValues []reflect.Value
 
+	// The method sees the deadline of the client in its context, and
+	// can stop working when the client stopped waiting.
+	if mtype.TakesContext() && req.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, req.Timeout)
+		defer cancel()
+	}
+
 	if !mtype.stream {
 
 		// Invoke the method, providing a new value for the reply.
@@ -422,10 +497,12 @@ func (s *service) call(ctx context.Context, server *Server, sending *sync.Mutex,
 		// The return value for the method is an error.
 		errInter := returnValues[0].Interface()
 		errmsg := ""
+		var errcode int64
 		if errInter != nil {
 			errmsg = errInter.(error).Error()
+			errcode = errorCode(errInter.(error))
 		}
-		server.sendResponse(sending, req, replyv.Interface(), codec, errmsg, true)
+		server.sendResponse(sending, req, replyv.Interface(), codec, errmsg, errcode, true)
 		server.freeRequest(req)
 		return
 	}
@@ -456,7 +533,7 @@ func (s *service) call(ctx context.Context, server *Server, sending *sync.Mutex,
 			}
 		}
 
-		lastError = server.sendResponse(sending, req, oneReply, codec, "", false)
+		lastError = server.sendResponse(sending, req, oneReply, codec, "", 0, false)
 		if lastError != nil {
 			return lastError
 		}
@@ -473,9 +550,11 @@ func (s *service) call(ctx context.Context, server *Server, sending *sync.Mutex,
 	}
 	errInter := returnValues[0].Interface()
 	errmsg := ""
+	var errcode int64
 	if errInter != nil {
 		// the function returned an error, we use that
 		errmsg = errInter.(error).Error()
+		errcode = errorCode(errInter.(error))
 	} else if lastError != nil {
 		// we had an error inside sendReply, we use that
 		errmsg = lastError.Error()
@@ -487,7 +566,7 @@ func (s *service) call(ctx context.Context, server *Server, sending *sync.Mutex,
 	// this is the last packet, we don't do anything with
 	// the error here (well sendStreamResponse will log it
 	// already)
-	server.sendResponse(sending, req, nil, codec, errmsg, true)
+	server.sendResponse(sending, req, nil, codec, errmsg, errcode, true)
 	server.freeRequest(req)
 }
 
@@ -544,8 +623,14 @@ func (server *Server) ServeCodec(codec ServerCodec) {
 }
 
 // ServeCodecWithContext is like ServeCodec but it makes it possible
-// to pass a connection context to the RPC methods.
+// to pass a connection context to the RPC methods. That context is
+// canceled when the client hangs up.
 func (server *Server) ServeCodecWithContext(ctx context.Context, codec ServerCodec) {
+	if ctx == nil {
+		ctx = context.TODO()
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
 	sending := new(sync.Mutex)
 	for {
 		service, mtype, req, argv, replyv, keepReading, err := server.readRequest(codec)
@@ -558,11 +643,12 @@ func (server *Server) ServeCodecWithContext(ctx context.Context, codec ServerCod
 			}
 			// send a response if we actually managed to read a header.
 			if req != nil {
-				server.sendResponse(sending, req, invalidRequest, codec, err.Error(), true)
+				server.sendResponse(sending, req, invalidRequest, codec, err.Error(), 0, true)
 				server.freeRequest(req)
 			}
 			continue
 		}
+		server.startCall(mtype)
 		go service.call(ctx, server, sending, mtype, req, argv, replyv, codec)
 	}
 	codec.Close()
@@ -592,11 +678,12 @@ func (server *Server) ServeRequestWithContext(ctx context.Context, codec ServerC
 		}
 		// send a response if we actually managed to read a header.
 		if req != nil {
-			server.sendResponse(sending, req, invalidRequest, codec, err.Error(), true)
+			server.sendResponse(sending, req, invalidRequest, codec, err.Error(), 0, true)
 			server.freeRequest(req)
 		}
 		return err
 	}
+	server.startCall(mtype)
 	service.call(ctx, server, sending, mtype, req, argv, replyv, codec)
 	return nil
 }
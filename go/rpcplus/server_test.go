@@ -62,6 +62,22 @@ func (t *Arith) Div(args Args, reply *Reply) error {
 	return nil
 }
 
+type codedError struct {
+	msg  string
+	code int64
+}
+
+func (e codedError) Error() string    { return e.msg }
+func (e codedError) ErrorCode() int64 { return e.code }
+
+func (t *Arith) Mod(args Args, reply *Reply) error {
+	if args.B == 0 {
+		return codedError{"modulo by zero", 7}
+	}
+	reply.C = args.A % args.B
+	return nil
+}
+
 func (t *Arith) String(args *Args, reply *string) error {
 	*reply = fmt.Sprintf("%d+%d=%d", args.A, args.B, args.A+args.B)
 	return nil
@@ -197,6 +213,15 @@ func testRPC(ctx context.Context, t *testing.T, addr string) {
 		t.Error("Div: expected error")
 	} else if err.Error() != "divide by zero" {
 		t.Error("Div: expected divide by zero error; got", err)
+	} else if _, ok := err.(ServerError); !ok {
+		t.Errorf("Div: expected a ServerError, got %#v", err)
+	}
+
+	// Error with a code
+	reply = new(Reply)
+	err = client.Call(ctx, "Arith.Mod", args, reply)
+	if cse, ok := err.(*CodedServerError); !ok || cse.Error() != "modulo by zero" || cse.ErrorCode() != 7 {
+		t.Errorf("Mod: expected a CodedServerError with code 7, got %#v", err)
 	}
 
 	// Bad type.
@@ -288,6 +313,7 @@ type CodecEmulator struct {
 	serviceMethod string
 	args          *Args
 	reply         *Reply
+	timeout       time.Duration
 	err           error
 }
 
@@ -311,6 +337,7 @@ func (codec *CodecEmulator) Call(ctx context.Context, serviceMethod string, args
 func (codec *CodecEmulator) ReadRequestHeader(req *Request) error {
 	req.ServiceMethod = codec.serviceMethod
 	req.Seq = 0
+	req.Timeout = codec.timeout
 	return nil
 }
 
@@ -362,6 +389,189 @@ func testServeRequest(ctx context.Context, t *testing.T, server *Server) {
 	}
 }
 
+// Waiter has a method that runs until its context is done.
+type Waiter struct {
+	started chan bool
+	done    chan error
+}
+
+func (w *Waiter) Wait(ctx context.Context, args *Args, reply *Reply) error {
+	w.started <- true
+	select {
+	case <-ctx.Done():
+		w.done <- ctx.Err()
+		return ctx.Err()
+	case <-time.After(time.Minute):
+		w.done <- nil
+		return nil
+	}
+}
+
+// WaitStream is the streaming version of Wait: it sends nothing.
+func (w *Waiter) WaitStream(ctx context.Context, args *Args, sendReply func(reply interface{}) error) error {
+	return w.Wait(ctx, args, new(Reply))
+}
+
+func startWaiterServer(t *testing.T) (*Waiter, *Server, net.Listener) {
+	waiter := &Waiter{started: make(chan bool, 1), done: make(chan error, 1)}
+	server := NewServer()
+	if err := server.Register(waiter); err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+	l, _ := listenTCP()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go server.ServeConn(conn)
+		}
+	}()
+	return waiter, server, l
+}
+
+func TestDeadline(t *testing.T) {
+	waiter, _, l := startWaiterServer(t)
+	defer l.Close()
+	client, err := Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal("dialing", err)
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	err = client.Call(ctx, "Waiter.Wait", &Args{}, new(Reply))
+	if err == nil || err.Error() != context.DeadlineExceeded.Error() {
+		t.Errorf("Wait: expected %v, got %v", context.DeadlineExceeded, err)
+	}
+	select {
+	case err := <-waiter.done:
+		if err != context.DeadlineExceeded {
+			t.Errorf("the server context ended with %v, expected %v", err, context.DeadlineExceeded)
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("the server didn't stop at the deadline")
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	waiter, server, l := startWaiterServer(t)
+	defer l.Close()
+
+	// the deadline only depends on the clock of the server
+	client := CodecEmulator{server: server, timeout: 100 * time.Millisecond}
+	start := time.Now()
+	err := client.Call(context.Background(), "Waiter.Wait", &Args{}, new(Reply))
+	if err == nil || err.Error() != context.DeadlineExceeded.Error() {
+		t.Errorf("Wait: expected %v, got %v", context.DeadlineExceeded, err)
+	}
+	if elapsed := time.Now().Sub(start); elapsed < 100*time.Millisecond || elapsed > 5*time.Second {
+		t.Errorf("Wait with a 100ms timeout took %v", elapsed)
+	}
+	<-waiter.started
+	<-waiter.done
+}
+
+func TestCallTimeout(t *testing.T) {
+	if got := callTimeout(time.Time{}); got != 0 {
+		t.Errorf("callTimeout without a deadline = %v, want 0", got)
+	}
+	if got := callTimeout(time.Now().Add(time.Minute)); got <= 59*time.Second || got > time.Minute {
+		t.Errorf("callTimeout in a minute = %v", got)
+	}
+	// a deadline that passed still ends the call on the server
+	if got := callTimeout(time.Now().Add(-time.Minute)); got <= 0 {
+		t.Errorf("callTimeout of a passed deadline = %v, want > 0", got)
+	}
+}
+
+func TestCancelOnDisconnect(t *testing.T) {
+	waiter, _, l := startWaiterServer(t)
+	defer l.Close()
+	client, err := Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal("dialing", err)
+	}
+
+	// no deadline, the call only ends when the client goes away
+	client.Go(context.Background(), "Waiter.Wait", &Args{}, new(Reply), nil)
+	<-waiter.started
+	client.Close()
+	select {
+	case err := <-waiter.done:
+		if err != context.Canceled {
+			t.Errorf("the server context ended with %v, expected %v", err, context.Canceled)
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("the server didn't stop when the client disconnected")
+	}
+}
+
+func TestWaitForCalls(t *testing.T) {
+	waiter, server, l := startWaiterServer(t)
+	defer l.Close()
+	client, err := Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal("dialing", err)
+	}
+	defer client.Close()
+
+	// without calls, it returns right away
+	server.WaitForCalls()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	client.Go(ctx, "Waiter.Wait", &Args{}, new(Reply), nil)
+	<-waiter.started
+	waited := make(chan bool)
+	go func() {
+		server.WaitForCalls()
+		close(waited)
+	}()
+	select {
+	case <-waited:
+		t.Errorf("WaitForCalls returned while a call was in flight")
+	case <-time.After(10 * time.Millisecond):
+	}
+	select {
+	case <-waited:
+	case <-time.After(5 * time.Second):
+		t.Errorf("WaitForCalls didn't return after the call")
+	}
+}
+
+func TestWaitForCallsStreaming(t *testing.T) {
+	waiter, server, l := startWaiterServer(t)
+	defer l.Close()
+	client, err := Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal("dialing", err)
+	}
+
+	// a stream that only ends when the client hangs up isn't waited for
+	client.StreamGo("Waiter.WaitStream", &Args{}, make(chan *Reply, 1))
+	<-waiter.started
+	waited := make(chan bool)
+	go func() {
+		server.WaitForCalls()
+		close(waited)
+	}()
+	select {
+	case <-waited:
+	case <-time.After(5 * time.Second):
+		t.Errorf("WaitForCalls waited for a streaming call")
+	}
+
+	client.Close()
+	select {
+	case <-waiter.done:
+	case <-time.After(5 * time.Second):
+		t.Errorf("the stream didn't end when the client hung up")
+	}
+}
+
 type ReplyNotPointer int
 type ArgNotPublic int
 type ReplyNotPublic int
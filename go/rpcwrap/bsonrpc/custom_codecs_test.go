@@ -6,6 +6,7 @@ package bsonrpc
 
 import (
 	"testing"
+	"time"
 
 	"github.com/youtube/vitess/go/bson"
 	rpc "github.com/youtube/vitess/go/rpcplus"
@@ -69,6 +70,72 @@ func TestRequestBson(t *testing.T) {
 	}
 }
 
+type reflectTimeoutRequestBson struct {
+	ServiceMethod string
+	Seq           uint64
+	Timeout       int64
+}
+
+func TestTimeoutRequestBson(t *testing.T) {
+	timeout := 1500 * time.Millisecond
+	reflected, err := bson.Marshal(&reflectTimeoutRequestBson{
+		ServiceMethod: "aa",
+		Seq:           1,
+		Timeout:       int64(timeout),
+	})
+	if err != nil {
+		t.Error(err)
+	}
+	want := string(reflected)
+
+	custom := RequestBson{
+		&rpc.Request{
+			ServiceMethod: "aa",
+			Seq:           1,
+			Timeout:       timeout,
+		},
+	}
+	encoded, err := bson.Marshal(&custom)
+	if err != nil {
+		t.Error(err)
+	}
+	got := string(encoded)
+	if want != got {
+		t.Errorf("want\n%#v, got\n%#v", want, got)
+	}
+
+	unmarshalled := RequestBson{Request: new(rpc.Request)}
+	err = bson.Unmarshal(encoded, &unmarshalled)
+	if err != nil {
+		t.Error(err)
+	}
+	if unmarshalled.Timeout != timeout {
+		t.Errorf("want %v, got %v", timeout, unmarshalled.Timeout)
+	}
+
+	// an old server ignores the timeout
+	var old reflectRequestBson
+	if err := bson.Unmarshal(encoded, &old); err != nil {
+		t.Error(err)
+	}
+	if old.ServiceMethod != "aa" || old.Seq != 1 {
+		t.Errorf("want aa 1, got %#v", old)
+	}
+
+	// and a request of an old client has none
+	reflected, err = bson.Marshal(&reflectRequestBson{ServiceMethod: "aa", Seq: 1})
+	if err != nil {
+		t.Error(err)
+	}
+	unmarshalled = RequestBson{Request: new(rpc.Request)}
+	if err := bson.Unmarshal(reflected, &unmarshalled); err != nil {
+		t.Error(err)
+	}
+	if unmarshalled.Timeout != 0 {
+		t.Errorf("want no timeout, got %v", unmarshalled.Timeout)
+	}
+}
+
 type reflectResponseBson struct {
 	ServiceMethod string
 	Seq           uint64
@@ -133,3 +200,58 @@ func TestResponseBson(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+type reflectCodedResponseBson struct {
+	ServiceMethod string
+	Seq           uint64
+	Error         string
+	ErrorCode     int64
+}
+
+func TestCodedResponseBson(t *testing.T) {
+	reflected, err := bson.Marshal(&reflectCodedResponseBson{
+		ServiceMethod: "aa",
+		Seq:           1,
+		Error:         "err",
+		ErrorCode:     3,
+	})
+	if err != nil {
+		t.Error(err)
+	}
+	want := string(reflected)
+
+	custom := ResponseBson{
+		&rpc.Response{
+			ServiceMethod: "aa",
+			Seq:           1,
+			Error:         "err",
+			ErrorCode:     3,
+		},
+	}
+	encoded, err := bson.Marshal(&custom)
+	if err != nil {
+		t.Error(err)
+	}
+	got := string(encoded)
+	if want != got {
+		t.Errorf("want\n%#v, got\n%#v", want, got)
+	}
+
+	unmarshalled := ResponseBson{Response: new(rpc.Response)}
+	err = bson.Unmarshal(encoded, &unmarshalled)
+	if err != nil {
+		t.Error(err)
+	}
+	if unmarshalled.Error != "err" || unmarshalled.ErrorCode != 3 {
+		t.Errorf("want err with code 3, got %#v", unmarshalled.Response)
+	}
+
+	// an old client only sees the message
+	var old reflectResponseBson
+	if err := bson.Unmarshal(encoded, &old); err != nil {
+		t.Error(err)
+	}
+	if old.Error != "err" {
+		t.Errorf("want err, got %#v", old)
+	}
+}
@@ -102,7 +102,7 @@ func dialHTTP(network, address, codecName string, cFactory ClientCodecFactory, a
 	}
 
 	if config != nil {
-		conn = tls.Client(conn, config)
+		conn = tls.Client(conn, clientTLSConfigFor(config, address))
 	}
 
 	_, err = io.WriteString(conn, "CONNECT "+GetRpcPath(codecName, auth)+" HTTP/1.0\n\n")
@@ -171,6 +171,9 @@ func (h *rpcHandler) ServeHTTP(c http.ResponseWriter, req *http.Request) {
 	io.WriteString(conn, "HTTP/1.0 "+connected+"\n\n")
 	codec := h.cFactory(NewBufferedConnection(conn))
 	ctx := proto.NewContext(req.RemoteAddr)
+	if username := verifiedUsername(req.TLS); username != "" {
+		proto.SetUsername(ctx, username)
+	}
 	if h.useAuth {
 		if authenticated, err := auth.Authenticate(ctx, codec); !authenticated {
 			if err != nil {
@@ -232,6 +235,9 @@ func (h *httpRPCHandler) ServeHTTP(c http.ResponseWriter, req *http.Request) {
 		ctx = h.contextCreator(req)
 	} else {
 		ctx = proto.NewContext(req.RemoteAddr)
+		if username := verifiedUsername(req.TLS); username != "" {
+			proto.SetUsername(ctx, username)
+		}
 	}
 
 	h.server.ServeRequestWithContext(
@@ -0,0 +1,118 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rpcwrap
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"sync"
+)
+
+var (
+	clientCert   = flag.String("client_cert", "", "cert file the RPC clients present to the TLS servers that require one")
+	clientKey    = flag.String("client_key", "", "key file of -client_cert")
+	clientCACert = flag.String("client_ca_cert", "", "ca cert file the RPC clients verify the TLS servers with, required to dial them")
+
+	defaultClientTLSOnce   sync.Once
+	defaultClientTLSConfig *tls.Config
+	defaultClientTLSErr    error
+)
+
+// loadCertPool reads the PEM certificates of caFile.
+func loadCertPool(caFile string) (*x509.CertPool, error) {
+	pemCerts, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read ca file %v: %v", caFile, err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pemCerts) {
+		return nil, fmt.Errorf("no certificate found in ca file %v", caFile)
+	}
+	return pool, nil
+}
+
+// ServerTLSConfig returns the TLS config of a server presenting the
+// certFile / keyFile pair. If caFile is set, the clients have to
+// present a certificate it signed, and its common name is the
+// username of their connection.
+func ServerTLSConfig(certFile, keyFile, caFile string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("cannot load the key pair %v, %v: %v", certFile, keyFile, err)
+	}
+	config := &tls.Config{Certificates: []tls.Certificate{cert}}
+	if caFile != "" {
+		if config.ClientCAs, err = loadCertPool(caFile); err != nil {
+			return nil, err
+		}
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return config, nil
+}
+
+// ClientTLSConfig returns the TLS config of a client. The server
+// certificates have to be signed by caFile and match the host dialed:
+// a client that doesn't verify the servers is refused. If certFile is
+// set, the certFile / keyFile pair is presented to the servers asking
+// for it.
+func ClientTLSConfig(certFile, keyFile, caFile string) (*tls.Config, error) {
+	if caFile == "" {
+		return nil, fmt.Errorf("a TLS client needs a ca cert to verify the servers with, set -client_ca_cert")
+	}
+	config := &tls.Config{}
+	if certFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot load the key pair %v, %v: %v", certFile, keyFile, err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	var err error
+	if config.RootCAs, err = loadCertPool(caFile); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// DefaultClientTLSConfig returns the client TLS config of the
+// -client_cert, -client_key and -client_ca_cert flags. The files are
+// only read once.
+func DefaultClientTLSConfig() (*tls.Config, error) {
+	defaultClientTLSOnce.Do(func() {
+		defaultClientTLSConfig, defaultClientTLSErr = ClientTLSConfig(*clientCert, *clientKey, *clientCACert)
+	})
+	return defaultClientTLSConfig, defaultClientTLSErr
+}
+
+// clientTLSConfigFor returns the config to dial address with. The
+// server is verified against the host of address if config doesn't
+// name one.
+func clientTLSConfigFor(config *tls.Config, address string) *tls.Config {
+	if config.InsecureSkipVerify || config.ServerName != "" {
+		return config
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		host = address
+	}
+	return &tls.Config{
+		Certificates: config.Certificates,
+		RootCAs:      config.RootCAs,
+		ServerName:   host,
+	}
+}
+
+// verifiedUsername returns the common name of the verified client
+// certificate of a connection, or "" if it has none.
+func verifiedUsername(state *tls.ConnectionState) string {
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return ""
+	}
+	return state.VerifiedChains[0][0].Subject.CommonName
+}
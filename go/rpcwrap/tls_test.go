@@ -0,0 +1,116 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rpcwrap
+
+import (
+	"crypto/tls"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/youtube/vitess/go/rpcplus"
+	"github.com/youtube/vitess/go/rpcplus/jsonrpc"
+	"github.com/youtube/vitess/go/rpcwrap/proto"
+	"github.com/youtube/vitess/go/rpcwrap/tlstest"
+	"golang.org/x/net/context"
+)
+
+type Identity int
+
+func (t *Identity) Username(ctx context.Context, args *Request, reply *string) error {
+	*reply, _ = proto.Username(ctx)
+	return nil
+}
+
+// startTLSServer serves Identity over TLS with the server cert of
+// dir. The clients need a certificate signed by caFile if it is set.
+func startTLSServer(t *testing.T, dir, caFile string) net.Listener {
+	config, err := ServerTLSConfig(tlstest.CertFile(dir, "server"), tlstest.KeyFile(dir, "server"), caFile)
+	if err != nil {
+		t.Fatalf("ServerTLSConfig failed: %v", err)
+	}
+	server := rpcplus.NewServer()
+	server.Register(new(Identity))
+	mux := http.NewServeMux()
+	ServeCustomRPC(mux, server, false, "json", jsonrpc.NewServerCodec)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Cannot listen: %v", err)
+	}
+	go http.Serve(tls.NewListener(l, config), mux)
+	return l
+}
+
+func callUsername(address string, config *tls.Config) (string, error) {
+	client, err := DialHTTP("tcp", address, "json", jsonrpc.NewClientCodec, 0, config)
+	if err != nil {
+		return "", err
+	}
+	defer client.Close()
+	var username string
+	err = client.Call(context.Background(), "Identity.Username", &Request{}, &username)
+	return username, err
+}
+
+func TestTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rpcwrap_tls_test")
+	if err != nil {
+		t.Fatalf("TempDir failed: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	tlstest.CreateCA(t, dir, "ca")
+	tlstest.CreateSignedCert(t, dir, "ca", "server", "server", "localhost")
+	tlstest.CreateSignedCert(t, dir, "ca", "client", "client1")
+	tlstest.CreateCA(t, dir, "other-ca")
+	tlstest.CreateSignedCert(t, dir, "other-ca", "other-client", "client2")
+	caFile := tlstest.CertFile(dir, "ca")
+
+	clientConfig := func(name, caFile string) *tls.Config {
+		certFile, keyFile := "", ""
+		if name != "" {
+			certFile, keyFile = tlstest.CertFile(dir, name), tlstest.KeyFile(dir, name)
+		}
+		config, err := ClientTLSConfig(certFile, keyFile, caFile)
+		if err != nil {
+			t.Fatalf("ClientTLSConfig(%v) failed: %v", name, err)
+		}
+		return config
+	}
+
+	// without client certificates, the connection has no username
+	l := startTLSServer(t, dir, "")
+	defer l.Close()
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+	if username, err := callUsername(net.JoinHostPort("localhost", port), clientConfig("", caFile)); err != nil || username != "" {
+		t.Errorf("Username without a client certificate = %q, %v, want no username", username, err)
+	}
+	// the server certificate is checked against the host dialed
+	if _, err := callUsername(l.Addr().String(), clientConfig("", caFile)); err == nil {
+		t.Errorf("the server certificate isn't valid for %v", l.Addr())
+	}
+	// and a client that doesn't verify it is refused
+	if _, err := ClientTLSConfig("", "", ""); err == nil || !strings.Contains(err.Error(), "-client_ca_cert") {
+		t.Errorf("ClientTLSConfig without a ca cert returned %v", err)
+	}
+
+	// with them, their common name is the username
+	l = startTLSServer(t, dir, caFile)
+	defer l.Close()
+	_, port, _ = net.SplitHostPort(l.Addr().String())
+	address := net.JoinHostPort("localhost", port)
+	if username, err := callUsername(address, clientConfig("client", caFile)); err != nil || username != "client1" {
+		t.Errorf("Username = %q, %v, want client1", username, err)
+	}
+	if _, err := callUsername(address, clientConfig("", caFile)); err == nil {
+		t.Errorf("a client without a certificate shouldn't be accepted")
+	}
+	if _, err := callUsername(address, clientConfig("other-client", caFile)); err == nil {
+		t.Errorf("a client with a certificate of another ca shouldn't be accepted")
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package tlstest creates the certificates of the unit tests that use
+// TLS. They are only valid for a day.
+package tlstest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"path"
+	"testing"
+	"time"
+)
+
+// CertFile is the certificate file created for name in dir.
+func CertFile(dir, name string) string {
+	return path.Join(dir, name+"-cert.pem")
+}
+
+// KeyFile is the key file created for name in dir.
+func KeyFile(dir, name string) string {
+	return path.Join(dir, name+"-key.pem")
+}
+
+// CreateCA creates a self-signed certificate authority in dir, as
+// CertFile(dir, name) and KeyFile(dir, name).
+func CreateCA(t *testing.T, dir, name string) {
+	template := certTemplate(t, name)
+	template.IsCA = true
+	template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature
+	template.BasicConstraintsValid = true
+	createCert(t, dir, name, template, nil, nil)
+}
+
+// CreateSignedCert creates a certificate signed by the ca certificate
+// authority of dir, as CertFile(dir, name) and KeyFile(dir, name). The
+// common name is the client username, and the host names or IP
+// addresses hosts are the ones of the server.
+func CreateSignedCert(t *testing.T, dir, ca, name, commonName string, hosts ...string) {
+	caPair, err := loadPair(dir, ca)
+	if err != nil {
+		t.Fatalf("cannot load the %v certificate authority: %v", ca, err)
+	}
+	template := certTemplate(t, commonName)
+	template.KeyUsage = x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment
+	template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+	createCert(t, dir, name, template, caPair.cert, caPair.key)
+}
+
+type pair struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func loadPair(dir, name string) (*pair, error) {
+	certPEM, err := ioutil.ReadFile(CertFile(dir, name))
+	if err != nil {
+		return nil, err
+	}
+	keyPEM, err := ioutil.ReadFile(KeyFile(dir, name))
+	if err != nil {
+		return nil, err
+	}
+	certBlock, _ := pem.Decode(certPEM)
+	keyBlock, _ := pem.Decode(keyPEM)
+	if certBlock == nil || keyBlock == nil {
+		return nil, fmt.Errorf("no PEM data in the files of %v", name)
+	}
+	cert, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParseECPrivateKey(keyBlock.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	return &pair{cert, key}, nil
+}
+
+func certTemplate(t *testing.T, commonName string) *x509.Certificate {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 62))
+	if err != nil {
+		t.Fatalf("cannot pick a serial number: %v", err)
+	}
+	now := time.Now()
+	return &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(24 * time.Hour),
+	}
+}
+
+// createCert signs template with parent and parentKey, or with its
+// own key if parent is nil, and saves it in dir.
+func createCert(t *testing.T, dir, name string, template, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("cannot generate the key of %v: %v", name, err)
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatalf("cannot create the certificate of %v: %v", name, err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("cannot marshal the key of %v: %v", name, err)
+	}
+	if err := ioutil.WriteFile(CertFile(dir, name), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		t.Fatalf("cannot write the certificate of %v: %v", name, err)
+	}
+	if err := ioutil.WriteFile(KeyFile(dir, name), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600); err != nil {
+		t.Fatalf("cannot write the key of %v: %v", name, err)
+	}
+}
@@ -0,0 +1,272 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package stats
+
+// This file renders the published variables in the Prometheus text
+// exposition format. The names are converted to snake_case, and the
+// keys of the maps become labels:
+// - Int, Float, Duration and their Func versions are gauges. The
+//   durations are in seconds, with a _seconds suffix.
+// - Counters and CountersFunc are counters, with their key as the
+//   "key" label. MultiCounters and MultiCountersFunc have a label per
+//   dimension.
+// - Histogram is a histogram, with its cutoffs as buckets.
+// - Timings and MultiTimings are histograms in seconds, with a
+//   _seconds suffix, and labels like the counters.
+// The other variables are not exported.
+
+import (
+	"bytes"
+	"expvar"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// PrometheusHandler returns the handler rendering all the published
+// variables in the Prometheus text format.
+func PrometheusHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		var vars []expvar.KeyValue
+		expvar.Do(func(kv expvar.KeyValue) {
+			vars = append(vars, kv)
+		})
+		writePrometheus(w, vars)
+	})
+}
+
+// PrometheusName converts a variable or label name to a Prometheus
+// one: CamelCase becomes snake_case ("QueryCacheLength" is
+// query_cache_length, "RPCCount" is rpc_count), and the characters
+// that are not allowed become '_'.
+func PrometheusName(name string) string {
+	runes := []rune(name)
+	b := bytes.NewBuffer(make([]byte, 0, len(name)+8))
+	lastUnderscore := true
+	for i, r := range runes {
+		switch {
+		case unicode.IsUpper(r):
+			// a new word starts after a lower case letter or a
+			// digit, or at the last upper case letter of an acronym
+			if !lastUnderscore && i > 0 && (unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1]) ||
+				(unicode.IsUpper(runes[i-1]) && i+1 < len(runes) && unicode.IsLower(runes[i+1]))) {
+				b.WriteByte('_')
+			}
+			b.WriteRune(unicode.ToLower(r))
+			lastUnderscore = false
+		case r < unicode.MaxASCII && (unicode.IsLower(r) || unicode.IsDigit(r)):
+			if i == 0 && unicode.IsDigit(r) {
+				b.WriteByte('_')
+			}
+			b.WriteRune(r)
+			lastUnderscore = false
+		default:
+			if !lastUnderscore {
+				b.WriteByte('_')
+				lastUnderscore = true
+			}
+		}
+	}
+	return strings.TrimRight(b.String(), "_")
+}
+
+// prometheusMetric is a variable converted to its name, type and
+// samples.
+type prometheusMetric struct {
+	name    string
+	typ     string
+	samples []string
+}
+
+// writePrometheus renders vars. They are sorted by name, and the
+// variables that end up with the name of a previous one are dropped.
+func writePrometheus(w io.Writer, vars []expvar.KeyValue) {
+	var metrics []*prometheusMetric
+	for _, kv := range vars {
+		if m := toPrometheus(kv.Key, kv.Value); m != nil {
+			metrics = append(metrics, m)
+		}
+	}
+	sort.Sort(byPrometheusName(metrics))
+	lastName := ""
+	for _, m := range metrics {
+		if m.name == "" || m.name == lastName {
+			continue
+		}
+		lastName = m.name
+		fmt.Fprintf(w, "# TYPE %v %v\n", m.name, m.typ)
+		for _, s := range m.samples {
+			fmt.Fprintln(w, s)
+		}
+	}
+}
+
+type byPrometheusName []*prometheusMetric
+
+func (m byPrometheusName) Len() int           { return len(m) }
+func (m byPrometheusName) Swap(i, j int)      { m[i], m[j] = m[j], m[i] }
+func (m byPrometheusName) Less(i, j int) bool { return m[i].name < m[j].name }
+
+func toPrometheus(name string, v expvar.Var) *prometheusMetric {
+	name = PrometheusName(name)
+	switch v := v.(type) {
+	case *Int:
+		return gauge(name, float64(v.Get()))
+	case IntFunc:
+		return gauge(name, float64(v()))
+	case *Float:
+		return gauge(name, v.Get())
+	case FloatFunc:
+		return gauge(name, v())
+	case *Duration:
+		return gauge(name+"_seconds", v.Get().Seconds())
+	case DurationFunc:
+		return gauge(name+"_seconds", v().Seconds())
+	case *Histogram:
+		m := &prometheusMetric{name: name, typ: "histogram"}
+		m.addHistogram(nil, v, 1)
+		return m
+	case *MultiTimings:
+		return timingsHistogram(name, &v.Timings, v.Labels())
+	case *Timings:
+		return timingsHistogram(name, v, nil)
+	case *Counters:
+		return counter(name, v.Counts(), nil)
+	case CountersFunc:
+		return counter(name, v(), nil)
+	case *MultiCounters:
+		return counter(name, v.Counts(), v.Labels())
+	case *MultiCountersFunc:
+		return counter(name, v.Counts(), v.Labels())
+	}
+	return nil
+}
+
+func gauge(name string, value float64) *prometheusMetric {
+	return &prometheusMetric{
+		name:    name,
+		typ:     "gauge",
+		samples: []string{name + " " + formatPrometheusValue(value)},
+	}
+}
+
+// counter returns the counter of counts. labels are the names of the
+// dimensions of the keys, nil for a single "key" label.
+func counter(name string, counts map[string]int64, labels []string) *prometheusMetric {
+	m := &prometheusMetric{name: name, typ: "counter"}
+	for _, key := range sortedKeys(counts) {
+		pairs := labelPairs(key, labels)
+		if pairs == nil {
+			continue
+		}
+		m.samples = append(m.samples, name+formatLabels(pairs)+" "+strconv.FormatInt(counts[key], 10))
+	}
+	return m
+}
+
+// timingsHistogram returns the histogram of t, in seconds.
+func timingsHistogram(name string, t *Timings, labels []string) *prometheusMetric {
+	name += "_seconds"
+	m := &prometheusMetric{name: name, typ: "histogram"}
+	histograms := t.Histograms()
+	keys := make([]string, 0, len(histograms))
+	for key := range histograms {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		pairs := labelPairs(key, labels)
+		if pairs == nil {
+			continue
+		}
+		m.addHistogram(pairs, histograms[key], 1/float64(time.Second))
+	}
+	return m
+}
+
+// addHistogram adds the samples of h, with its values multiplied by
+// scale.
+func (m *prometheusMetric) addHistogram(pairs []string, h *Histogram, scale float64) {
+	h.mu.Lock()
+	buckets := make([]int64, len(h.buckets))
+	copy(buckets, h.buckets)
+	total := h.total
+	h.mu.Unlock()
+
+	count := int64(0)
+	for i, bucket := range buckets {
+		count += bucket
+		le := "+Inf"
+		if i < len(h.cutoffs) {
+			le = formatPrometheusValue(float64(h.cutoffs[i]) * scale)
+		}
+		bucketPairs := append(append([]string(nil), pairs...), "le", le)
+		m.samples = append(m.samples, m.name+"_bucket"+formatLabels(bucketPairs)+" "+strconv.FormatInt(count, 10))
+	}
+	m.samples = append(m.samples,
+		m.name+"_sum"+formatLabels(pairs)+" "+formatPrometheusValue(float64(total)*scale),
+		m.name+"_count"+formatLabels(pairs)+" "+strconv.FormatInt(count, 10))
+}
+
+// labelPairs returns the label names and values of a key: key itself
+// for the "key" label if labels is nil, else the parts of the key
+// joined with '.'. The last label gets the rest of the key if it has
+// more parts, and nil is returned if it has less.
+func labelPairs(key string, labels []string) []string {
+	if labels == nil {
+		return []string{"key", key}
+	}
+	values := strings.SplitN(key, ".", len(labels))
+	if len(values) != len(labels) {
+		return nil
+	}
+	pairs := make([]string, 0, 2*len(labels))
+	for i, label := range labels {
+		pairs = append(pairs, PrometheusName(label), values[i])
+	}
+	return pairs
+}
+
+// formatLabels formats the name, value pairs as {name="value",...}.
+func formatLabels(pairs []string) string {
+	if len(pairs) == 0 {
+		return ""
+	}
+	b := bytes.NewBuffer(make([]byte, 0, 64))
+	b.WriteByte('{')
+	for i := 0; i < len(pairs); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(b, "%v=\"%v\"", pairs[i], escapeLabelValue(pairs[i+1]))
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabelValue(value string) string {
+	return labelValueEscaper.Replace(value)
+}
+
+func formatPrometheusValue(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+func sortedKeys(counts map[string]int64) []string {
+	keys := make([]string, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
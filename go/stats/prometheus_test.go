@@ -0,0 +1,158 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package stats
+
+import (
+	"bytes"
+	"expvar"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPrometheusName(t *testing.T) {
+	for _, c := range []struct {
+		in, want string
+	}{
+		{"Queries", "queries"},
+		{"QueryCacheLength", "query_cache_length"},
+		{"RPCCount", "rpc_count"},
+		{"TabletRPCs", "tablet_rp_cs"},
+		{"Mysql55Errors", "mysql55_errors"},
+		{"V2Api", "v2_api"},
+		{"QPSByTable", "qps_by_table"},
+		{"already_snake", "already_snake"},
+		{"with-dash.and.dots", "with_dash_and_dots"},
+		{"Trailing_", "trailing"},
+		{"_Leading", "leading"},
+		{"9Lives", "_9_lives"},
+		{"Mixed__Underscores", "mixed_underscores"},
+	} {
+		if got := PrometheusName(c.in); got != c.want {
+			t.Errorf("PrometheusName(%q) = %q, want %q", c.in, got, c.want)
+		}
+	}
+}
+
+func TestLabelPairs(t *testing.T) {
+	for _, c := range []struct {
+		key    string
+		labels []string
+		want   []string
+	}{
+		{"a", nil, []string{"key", "a"}},
+		{"a.b", nil, []string{"key", "a.b"}},
+		{"a.b", []string{"Table", "PlanType"}, []string{"table", "a", "plan_type", "b"}},
+		{"a.b.c", []string{"Table", "PlanType"}, []string{"table", "a", "plan_type", "b.c"}},
+		{"a", []string{"Table", "PlanType"}, nil},
+	} {
+		got := labelPairs(c.key, c.labels)
+		if strings.Join(got, ",") != strings.Join(c.want, ",") || (got == nil) != (c.want == nil) {
+			t.Errorf("labelPairs(%q, %v) = %v, want %v", c.key, c.labels, got, c.want)
+		}
+	}
+}
+
+func TestPrometheusOutput(t *testing.T) {
+	i := NewInt("")
+	i.Set(3)
+	c := NewCounters("")
+	c.Add("b", 2)
+	c.Add("a\"\n", 1)
+	mc := NewMultiCounters("", []string{"Table", "PlanType"})
+	mc.Add([]string{"t1", "Select"}, 4)
+	mcf := NewMultiCountersFunc("", []string{"Keyspace", "ShardName"}, func() map[string]int64 {
+		return map[string]int64{"ks.-80": 5, "bad": 6}
+	})
+	h := NewGenericHistogram("", []int64{1, 5}, []string{"1", "5", "inf"}, "Count", "Total")
+	h.Add(1)
+	h.Add(3)
+	h.Add(10)
+	tm := NewTimings("")
+	tm.Add("Exec", 500*time.Millisecond)
+	mt := NewMultiTimings("", []string{"Method", "Shard"})
+	mt.Add([]string{"Get", "0"}, 2*time.Second)
+
+	var buf bytes.Buffer
+	writePrometheus(&buf, []expvar.KeyValue{
+		{Key: "Uptime", Value: DurationFunc(func() time.Duration { return 90 * time.Second })},
+		{Key: "ConnCount", Value: i},
+		{Key: "Load", Value: FloatFunc(func() float64 { return 0.5 })},
+		{Key: "Errors", Value: c},
+		{Key: "QueryCounts", Value: mc},
+		{Key: "ShardCounts", Value: mcf},
+		{Key: "Sizes", Value: h},
+		{Key: "Queries", Value: tm},
+		{Key: "RPCTimings", Value: mt},
+		{Key: "Conn_Count", Value: IntFunc(func() int64 { return 7 })},
+		{Key: "Version", Value: NewString("")},
+	})
+	want := `# TYPE conn_count gauge
+conn_count 3
+# TYPE errors counter
+errors{key="a\"\n"} 1
+errors{key="b"} 2
+# TYPE load gauge
+load 0.5
+# TYPE queries_seconds histogram
+queries_seconds_bucket{key="Exec",le="0.0005"} 0
+queries_seconds_bucket{key="Exec",le="0.001"} 0
+queries_seconds_bucket{key="Exec",le="0.005"} 0
+queries_seconds_bucket{key="Exec",le="0.01"} 0
+queries_seconds_bucket{key="Exec",le="0.05"} 0
+queries_seconds_bucket{key="Exec",le="0.1"} 0
+queries_seconds_bucket{key="Exec",le="0.5"} 1
+queries_seconds_bucket{key="Exec",le="1"} 1
+queries_seconds_bucket{key="Exec",le="5"} 1
+queries_seconds_bucket{key="Exec",le="10"} 1
+queries_seconds_bucket{key="Exec",le="+Inf"} 1
+queries_seconds_sum{key="Exec"} 0.5
+queries_seconds_count{key="Exec"} 1
+# TYPE query_counts counter
+query_counts{table="t1",plan_type="Select"} 4
+`
+	got := buf.String()
+	if !strings.HasPrefix(got, want) {
+		t.Errorf("got:\n%v\nwant a prefix of:\n%v", got, want)
+	}
+	got = got[len(want):]
+	for _, s := range []string{
+		"# TYPE rpc_timings_seconds histogram\n",
+		"rpc_timings_seconds_bucket{method=\"Get\",shard=\"0\",le=\"1\"} 0\n",
+		"rpc_timings_seconds_bucket{method=\"Get\",shard=\"0\",le=\"5\"} 1\n",
+		"rpc_timings_seconds_count{method=\"Get\",shard=\"0\"} 1\n",
+		"# TYPE shard_counts counter\nshard_counts{keyspace=\"ks\",shard_name=\"-80\"} 5\n",
+		"# TYPE sizes histogram\n" +
+			"sizes_bucket{le=\"1\"} 1\n" +
+			"sizes_bucket{le=\"5\"} 2\n" +
+			"sizes_bucket{le=\"+Inf\"} 3\n" +
+			"sizes_sum 14\n" +
+			"sizes_count 3\n",
+		"# TYPE uptime_seconds gauge\nuptime_seconds 90\n",
+	} {
+		if !strings.Contains(got, s) {
+			t.Errorf("%q not found in:\n%v", s, got)
+		}
+	}
+	for _, s := range []string{"method=\"All\"", "bad", "version", "conn_count"} {
+		if strings.Contains(got, s) {
+			t.Errorf("%q should not be in:\n%v", s, got)
+		}
+	}
+}
+
+func TestPrometheusHandler(t *testing.T) {
+	clear()
+	NewInt("HandlerInt").Set(12)
+	w := httptest.NewRecorder()
+	PrometheusHandler().ServeHTTP(w, nil)
+	if got, want := w.Header().Get("Content-Type"), "text/plain; version=0.0.4"; got != want {
+		t.Errorf("Content-Type = %q, want %q", got, want)
+	}
+	if want := "# TYPE handler_int gauge\nhandler_int 12\n"; !strings.Contains(w.Body.String(), want) {
+		t.Errorf("%q not found in:\n%v", want, w.Body.String())
+	}
+}
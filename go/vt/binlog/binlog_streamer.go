@@ -10,10 +10,13 @@ import (
 	"io"
 
 	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/mysql"
 	mproto "github.com/youtube/vitess/go/mysql/proto"
+	"github.com/youtube/vitess/go/sqldb"
 	"github.com/youtube/vitess/go/stats"
 	"github.com/youtube/vitess/go/sync2"
 	"github.com/youtube/vitess/go/vt/binlog/proto"
+	"github.com/youtube/vitess/go/vt/key"
 	"github.com/youtube/vitess/go/vt/mysqlctl"
 	myproto "github.com/youtube/vitess/go/vt/mysqlctl/proto"
 )
@@ -69,6 +72,16 @@ type BinlogStreamer struct {
 	startPos        myproto.ReplicationPosition
 	sendTransaction sendTransactionFunc
 
+	// keyspaceIdType and shardingColumn are set for keyrange streams,
+	// to compute the keyspace id of the rows in row based replication.
+	keyspaceIdType key.KeyspaceIdType
+	shardingColumn string
+
+	// rbrTables caches the schema of the tables of the rows events.
+	// loadTable fills it, and can be replaced in tests.
+	rbrTables map[string]*rbrTable
+	loadTable func(table string) (*rbrTable, error)
+
 	conn *mysqlctl.SlaveConnection
 }
 
@@ -80,13 +93,16 @@ type BinlogStreamer struct {
 // startPos is the position to start streaming at.
 // sendTransaction is called each time a transaction is committed or rolled back.
 func NewBinlogStreamer(dbname string, mysqld *mysqlctl.Mysqld, clientCharset *mproto.Charset, startPos myproto.ReplicationPosition, sendTransaction sendTransactionFunc) *BinlogStreamer {
-	return &BinlogStreamer{
+	bls := &BinlogStreamer{
 		dbname:          dbname,
 		mysqld:          mysqld,
 		clientCharset:   clientCharset,
 		startPos:        startPos,
 		sendTransaction: sendTransaction,
+		rbrTables:       make(map[string]*rbrTable),
 	}
+	bls.loadTable = bls.loadRBRTable
+	return bls
 }
 
 // Stream starts streaming binlog events using the settings from NewBinlogStreamer().
@@ -125,6 +141,13 @@ func (bls *BinlogStreamer) Stream(ctx *sync2.ServiceContext) (err error) {
 	var events <-chan proto.BinlogEvent
 	events, err = bls.conn.StartBinlogDump(bls.startPos)
 	if err != nil {
+		if sqlErr, ok := err.(*sqldb.SqlError); ok && sqlErr.Number() == mysql.ErrMasterFatalReadingBinlog {
+			// mysqld can't find startPos in its binlogs
+			return fmt.Errorf("%v: %v", proto.ErrPositionPurged, err)
+		}
+		if _, ok := err.(*mysqlctl.UnsupportedPositionError); ok {
+			return fmt.Errorf("%v: %v", proto.ErrPositionUnsupported, err)
+		}
 		return err
 	}
 	// parseEvents will loop until the events channel is closed, the
@@ -146,6 +169,8 @@ func (bls *BinlogStreamer) parseEvents(ctx *sync2.ServiceContext, events <-chan
 	var pos = bls.startPos
 	var autocommit = true
 	var err error
+	// tableMaps are the tables of the rows events, by table id.
+	tableMaps := make(map[uint64]*proto.TableMap)
 
 	// A begin can be triggered either by a BEGIN query, or by a GTID_EVENT.
 	begin := func() {
@@ -294,6 +319,10 @@ func (bls *BinlogStreamer) parseEvents(ctx *sync2.ServiceContext, events <-chan
 					Category: proto.BL_SET,
 					Sql:      []byte(fmt.Sprintf("SET TIMESTAMP=%d", ev.Timestamp())),
 				}
+				if cat == proto.BL_DDL {
+					// The schema of the tables of the rows events may change.
+					bls.rbrTables = make(map[string]*rbrTable)
+				}
 				statement := proto.Statement{Category: cat, Sql: q.Sql}
 				// If the statement has a charset and it's different than our client's
 				// default charset, send it along with the statement.
@@ -309,6 +338,35 @@ func (bls *BinlogStreamer) parseEvents(ctx *sync2.ServiceContext, events <-chan
 					}
 				}
 			}
+		case ev.IsTableMap(): // TABLE_MAP_EVENT
+			tm, err := ev.TableMap(format)
+			if err != nil {
+				return pos, fmt.Errorf("can't parse TABLE_MAP_EVENT: %v, event data: %#v", err, ev)
+			}
+			tableMaps[ev.TableID(format)] = tm
+		case ev.IsWriteRows() || ev.IsUpdateRows() || ev.IsDeleteRows(): // *_ROWS_EVENT
+			// A rows event we can't decode stops the stream: going on
+			// would drop rows from the stream.
+			tm, ok := tableMaps[ev.TableID(format)]
+			if !ok {
+				return pos, fmt.Errorf("got a rows event for the unknown table id %v, event data: %#v", ev.TableID(format), ev)
+			}
+			if tm.Database != "" && tm.Database != bls.dbname {
+				// Skip cross-db rows.
+				continue
+			}
+			rowsStatements, err := bls.rowsStatements(ev, format, tm)
+			if err != nil {
+				return pos, fmt.Errorf("can't decode rows event: %v, event data: %#v", err, ev)
+			}
+			if len(rowsStatements) == 0 {
+				continue
+			}
+			statements = append(statements, proto.Statement{
+				Category: proto.BL_SET,
+				Sql:      []byte(fmt.Sprintf("SET TIMESTAMP=%d", ev.Timestamp())),
+			})
+			statements = append(statements, rowsStatements...)
 		}
 	}
 
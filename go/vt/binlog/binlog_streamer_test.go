@@ -31,6 +31,10 @@ func (fakeEvent) IsGTID() bool                    { return false }
 func (fakeEvent) IsRotate() bool                  { return false }
 func (fakeEvent) IsIntVar() bool                  { return false }
 func (fakeEvent) IsRand() bool                    { return false }
+func (fakeEvent) IsTableMap() bool                { return false }
+func (fakeEvent) IsWriteRows() bool               { return false }
+func (fakeEvent) IsUpdateRows() bool              { return false }
+func (fakeEvent) IsDeleteRows() bool              { return false }
 func (fakeEvent) HasGTID(proto.BinlogFormat) bool { return true }
 func (fakeEvent) Timestamp() uint32               { return 1407805592 }
 func (fakeEvent) Format() (proto.BinlogFormat, error) {
@@ -49,6 +53,13 @@ func (fakeEvent) IntVar(proto.BinlogFormat) (string, uint64, error) {
 func (fakeEvent) Rand(proto.BinlogFormat) (uint64, uint64, error) {
 	return 0, 0, errors.New("not a rand")
 }
+func (fakeEvent) TableID(proto.BinlogFormat) uint64 { return 0 }
+func (fakeEvent) TableMap(proto.BinlogFormat) (*proto.TableMap, error) {
+	return nil, errors.New("not a table map")
+}
+func (fakeEvent) Rows(proto.BinlogFormat, *proto.TableMap) (proto.Rows, error) {
+	return proto.Rows{}, errors.New("not a rows event")
+}
 func (ev fakeEvent) StripChecksum(proto.BinlogFormat) (proto.BinlogEvent, []byte, error) {
 	return ev, nil, nil
 }
@@ -8,8 +8,10 @@
 package binlogplayer
 
 import (
+	"flag"
 	"fmt"
 	"io"
+	"strconv"
 	"sync"
 	"time"
 
@@ -33,6 +35,9 @@ var (
 	BlplQuery = "Query"
 	// BlplTransaction is the key for the stats map.
 	BlplTransaction = "Transaction"
+	// BlplBatch is the key for the stats map of the destination
+	// transactions, that may each apply several source transactions.
+	BlplBatch = "Batch"
 
 	// flags for the blp_checkpoint table. The database entry is just
 	// a join(",") of these flags.
@@ -41,6 +46,11 @@ var (
 	BlpFlagDontStart = "DontStart"
 )
 
+var (
+	batchSize     = flag.Int("binlog_player_batch_size", 1, "maximum number of source transactions the binlog player applies in one transaction")
+	batchInterval = flag.Duration("binlog_player_batch_interval", 100*time.Millisecond, "longest time the binlog player waits for more source transactions to fill a batch")
+)
+
 // BinlogPlayerStats is the internal stats of a player. It is a different
 // structure that is passed in so stats can be collected over the life
 // of multiple individual players.
@@ -53,6 +63,7 @@ type BinlogPlayerStats struct {
 	lastPosition        myproto.ReplicationPosition
 	lastPositionMutex   sync.RWMutex
 	SecondsBehindMaster sync2.AtomicInt64
+	LastBatchSize       sync2.AtomicInt64
 }
 
 // SetLastPosition sets the last replication position.
@@ -83,8 +94,9 @@ type BinlogPlayer struct {
 	dbClient VtClient
 
 	// for key range base requests
-	keyspaceIdType key.KeyspaceIdType
-	keyRange       key.KeyRange
+	keyspaceIdType     key.KeyspaceIdType
+	shardingColumnName string
+	keyRange           key.KeyRange
 
 	// for table base requests
 	tables []string
@@ -95,21 +107,30 @@ type BinlogPlayer struct {
 	blplStats      *BinlogPlayerStats
 	defaultCharset mproto.Charset
 	currentCharset mproto.Charset
+
+	// batching of the source transactions
+	batchSize     int
+	batchInterval time.Duration
 }
 
 // NewBinlogPlayerKeyRange returns a new BinlogPlayer pointing at the server
 // replicating the provided keyrange, starting at the startPosition,
 // and updating _vt.blp_checkpoint with uid=startPosition.Uid.
 // If !stopPosition.IsZero(), it will stop when reaching that position.
-func NewBinlogPlayerKeyRange(dbClient VtClient, addr string, keyspaceIdType key.KeyspaceIdType, keyRange key.KeyRange, startPosition *proto.BlpPosition, stopPosition myproto.ReplicationPosition, blplStats *BinlogPlayerStats) *BinlogPlayer {
+// shardingColumnName is sent to the server for the sources in row based
+// replication.
+func NewBinlogPlayerKeyRange(dbClient VtClient, addr string, keyspaceIdType key.KeyspaceIdType, shardingColumnName string, keyRange key.KeyRange, startPosition *proto.BlpPosition, stopPosition myproto.ReplicationPosition, blplStats *BinlogPlayerStats) *BinlogPlayer {
 	return &BinlogPlayer{
-		addr:           addr,
-		dbClient:       dbClient,
-		keyspaceIdType: keyspaceIdType,
-		keyRange:       keyRange,
-		blpPos:         *startPosition,
-		stopPosition:   stopPosition,
-		blplStats:      blplStats,
+		addr:               addr,
+		dbClient:           dbClient,
+		keyspaceIdType:     keyspaceIdType,
+		shardingColumnName: shardingColumnName,
+		keyRange:           keyRange,
+		blpPos:             *startPosition,
+		stopPosition:       stopPosition,
+		blplStats:          blplStats,
+		batchSize:          *batchSize,
+		batchInterval:      *batchInterval,
 	}
 }
 
@@ -119,42 +140,44 @@ func NewBinlogPlayerKeyRange(dbClient VtClient, addr string, keyspaceIdType key.
 // If !stopPosition.IsZero(), it will stop when reaching that position.
 func NewBinlogPlayerTables(dbClient VtClient, addr string, tables []string, startPosition *proto.BlpPosition, stopPosition myproto.ReplicationPosition, blplStats *BinlogPlayerStats) *BinlogPlayer {
 	return &BinlogPlayer{
-		addr:         addr,
-		dbClient:     dbClient,
-		tables:       tables,
-		blpPos:       *startPosition,
-		stopPosition: stopPosition,
-		blplStats:    blplStats,
+		addr:          addr,
+		dbClient:      dbClient,
+		tables:        tables,
+		blpPos:        *startPosition,
+		stopPosition:  stopPosition,
+		blplStats:     blplStats,
+		batchSize:     *batchSize,
+		batchInterval: *batchInterval,
 	}
 }
 
-// writeRecoveryPosition will write the current GTID as the recovery position
-// for the next transaction.
+// writeRecoveryPosition will write the position after txs as the recovery
+// position, in the transaction of txs, and return it. The player only moves
+// to it once the transaction is committed, so its position never runs
+// ahead of the data.
 // We will also try to get the timestamp for the transaction. Two cases:
 // - we have statements, and they start with a SET TIMESTAMP that we
 //   can parse: then we update transaction_timestamp in blp_checkpoint
-//   with it, and set SecondsBehindMaster to now() - transaction_timestamp
+//   with the one of the last transaction that has it, and set
+//   SecondsBehindMaster to now() - transaction_timestamp
 // - otherwise (the statements are probably filtered out), we leave
 //   transaction_timestamp alone (keeping the old value), and we don't
 //   change SecondsBehindMaster
-func (blp *BinlogPlayer) writeRecoveryPosition(tx *proto.BinlogTransaction) error {
-	now := time.Now().Unix()
-
-	blp.blpPos.Position = myproto.AppendGTID(blp.blpPos.Position, tx.GTIDField.Value)
-	updateRecovery := UpdateBlpCheckpoint(blp.blpPos.Uid, blp.blpPos.Position, now, tx.Timestamp)
+func (blp *BinlogPlayer) writeRecoveryPosition(txs []*proto.BinlogTransaction, now int64) (myproto.ReplicationPosition, error) {
+	position := blp.blpPos.Position
+	for _, tx := range txs {
+		position = myproto.AppendGTID(position, tx.GTIDField.Value)
+	}
+	updateRecovery := UpdateBlpCheckpoint(blp.blpPos.Uid, position, now, lastTimestamp(txs))
 
 	qr, err := blp.exec(updateRecovery)
 	if err != nil {
-		return fmt.Errorf("Error %v in writing recovery info %v", err, updateRecovery)
+		return position, fmt.Errorf("Error %v in writing recovery info %v", err, updateRecovery)
 	}
 	if qr.RowsAffected != 1 {
-		return fmt.Errorf("Cannot update blp_recovery table, affected %v rows", qr.RowsAffected)
+		return position, fmt.Errorf("Cannot update blp_recovery table, affected %v rows", qr.RowsAffected)
 	}
-	blp.blplStats.SetLastPosition(blp.blpPos.Position)
-	if tx.Timestamp != 0 {
-		blp.blplStats.SecondsBehindMaster.Set(now - tx.Timestamp)
-	}
-	return nil
+	return position, nil
 }
 
 // ReadStartPosition will return the current start position and the flags for
@@ -178,17 +201,96 @@ func ReadStartPosition(dbClient VtClient, uid uint32) (*proto.BlpPosition, strin
 	}, string(qr.Rows[0][1].Raw()), nil
 }
 
+// lastTimestamp returns the timestamp of the last transaction of txs
+// that has one, or 0.
+func lastTimestamp(txs []*proto.BinlogTransaction) int64 {
+	for i := len(txs) - 1; i >= 0; i-- {
+		if txs[i].Timestamp != 0 {
+			return txs[i].Timestamp
+		}
+	}
+	return 0
+}
+
 func (blp *BinlogPlayer) processTransaction(tx *proto.BinlogTransaction) (ok bool, err error) {
+	return blp.processBatch([]*proto.BinlogTransaction{tx})
+}
+
+// processBatch applies txs, in order, in one transaction with a single
+// checkpoint update. It returns false and no error if the transaction
+// should be retried. If it fails for a batch of more than one
+// transaction, it applies them again one by one, so the error is the
+// one of the offending transaction, and the transactions before it
+// are applied.
+func (blp *BinlogPlayer) processBatch(txs []*proto.BinlogTransaction) (ok bool, err error) {
+	ok, err = blp.applyBatch(txs)
+	if err == nil || len(txs) == 1 {
+		return ok, err
+	}
+	log.Warningf("Batch of %v transactions failed, applying them one by one: %v", len(txs), err)
+	for _, tx := range txs {
+		for {
+			ok, err = blp.applyBatch([]*proto.BinlogTransaction{tx})
+			if err != nil {
+				return false, err
+			}
+			if ok {
+				break
+			}
+			log.Infof("Retrying txn")
+			time.Sleep(1 * time.Second)
+		}
+	}
+	return true, nil
+}
+
+func (blp *BinlogPlayer) applyBatch(txs []*proto.BinlogTransaction) (ok bool, err error) {
 	txnStartTime := time.Now()
 	if err = blp.dbClient.Begin(); err != nil {
 		return false, fmt.Errorf("failed query BEGIN, err: %s", err)
 	}
-	if err = blp.writeRecoveryPosition(tx); err != nil {
+	defer func() {
+		// roll back on errors, so neither the statements nor the
+		// checkpoint are half applied on this connection
+		if err != nil {
+			if rbErr := blp.dbClient.Rollback(); rbErr != nil {
+				log.Warningf("Rollback after error %v failed: %v", err, rbErr)
+			}
+		}
+	}()
+	now := time.Now().Unix()
+	position, err := blp.writeRecoveryPosition(txs, now)
+	if err != nil {
 		return false, err
 	}
+	for _, tx := range txs {
+		if ok, err = blp.execTransaction(tx); !ok || err != nil {
+			return ok, err
+		}
+	}
+	if err = blp.dbClient.Commit(); err != nil {
+		return false, fmt.Errorf("failed query COMMIT, err: %s", err)
+	}
+	blp.blpPos.Position = position
+	blp.blplStats.SetLastPosition(position)
+	if timestamp := lastTimestamp(txs); timestamp != 0 {
+		blp.blplStats.SecondsBehindMaster.Set(now - timestamp)
+	}
+	blp.blplStats.LastBatchSize.Set(int64(len(txs)))
+	blp.blplStats.Timings.Record(BlplBatch, txnStartTime)
+	perTransaction := time.Now().Sub(txnStartTime) / time.Duration(len(txs))
+	for range txs {
+		blp.blplStats.Timings.Add(BlplTransaction, perTransaction)
+	}
+	return true, nil
+}
+
+// execTransaction executes the statements of tx. It returns false and
+// no error after rolling back on a deadlock.
+func (blp *BinlogPlayer) execTransaction(tx *proto.BinlogTransaction) (ok bool, err error) {
 	for i, stmt := range tx.Statements {
 		// Make sure the statement is replayed in the proper charset.
-		if dbClient, ok := blp.dbClient.(*DBClient); ok {
+		if csClient, ok := blp.dbClient.(CharsetClient); ok {
 			var stmtCharset mproto.Charset
 			if stmt.Charset != nil {
 				stmtCharset = *stmt.Charset
@@ -203,7 +305,7 @@ func (blp *BinlogPlayer) processTransaction(tx *proto.BinlogTransaction) (ok boo
 				// proceeds, but in Vitess-land this usually means a misconfigured
 				// server or a misbehaving client, so we spam the logs with warnings.
 				log.Warningf("BinlogPlayer changing charset from %v to %v for statement %d in transaction %v", blp.currentCharset, stmtCharset, i, *tx)
-				err = dbClient.dbConn.SetCharset(stmtCharset)
+				err = csClient.SetCharset(stmtCharset)
 				if err != nil {
 					return false, fmt.Errorf("can't set charset for statement %d in transaction %v: %v", i, *tx, err)
 				}
@@ -223,10 +325,6 @@ func (blp *BinlogPlayer) processTransaction(tx *proto.BinlogTransaction) (ok boo
 		}
 		return false, err
 	}
-	if err = blp.dbClient.Commit(); err != nil {
-		return false, fmt.Errorf("failed query COMMIT, err: %s", err)
-	}
-	blp.blplStats.Timings.Record(BlplTransaction, txnStartTime)
 	return true, nil
 }
 
@@ -290,8 +388,8 @@ func (blp *BinlogPlayer) ApplyBinlogEvents(interrupted chan struct{}) error {
 	// Get the current charset of our connection, so we can ask the stream server
 	// to check that they match. The streamer will also only send per-statement
 	// charset data if that statement's charset is different from what we specify.
-	if dbClient, ok := blp.dbClient.(*DBClient); ok {
-		blp.defaultCharset, err = dbClient.dbConn.GetCharset()
+	if csClient, ok := blp.dbClient.(CharsetClient); ok {
+		blp.defaultCharset, err = csClient.GetCharset()
 		if err != nil {
 			return fmt.Errorf("can't get charset to request binlog stream: %v", err)
 		}
@@ -300,7 +398,7 @@ func (blp *BinlogPlayer) ApplyBinlogEvents(interrupted chan struct{}) error {
 		// Restore original charset when we're done.
 		defer func() {
 			log.Infof("restoring original charset %v", blp.defaultCharset)
-			if csErr := dbClient.dbConn.SetCharset(blp.defaultCharset); csErr != nil {
+			if csErr := csClient.SetCharset(blp.defaultCharset); csErr != nil {
 				log.Errorf("can't restore original charset %v: %v", blp.defaultCharset, csErr)
 			}
 		}()
@@ -317,10 +415,11 @@ func (blp *BinlogPlayer) ApplyBinlogEvents(interrupted chan struct{}) error {
 		resp = blplClient.StreamTables(req, responseChan)
 	} else {
 		req := &proto.KeyRangeRequest{
-			KeyspaceIdType: blp.keyspaceIdType,
-			KeyRange:       blp.keyRange,
-			Position:       blp.blpPos.Position,
-			Charset:        &blp.defaultCharset,
+			KeyspaceIdType:     blp.keyspaceIdType,
+			KeyRange:           blp.keyRange,
+			Position:           blp.blpPos.Position,
+			Charset:            &blp.defaultCharset,
+			ShardingColumnName: blp.shardingColumnName,
 		}
 		resp = blplClient.StreamKeyRange(req, responseChan)
 	}
@@ -332,8 +431,9 @@ processLoop:
 			if !ok {
 				break processLoop
 			}
+			batch, closed := blp.fillBatch(response, responseChan, interrupted)
 			for {
-				ok, err = blp.processTransaction(response)
+				ok, err = blp.processBatch(batch)
 				if err != nil {
 					return fmt.Errorf("Error in processing binlog event %v", err)
 				}
@@ -349,6 +449,9 @@ processLoop:
 				log.Infof("Retrying txn")
 				time.Sleep(1 * time.Second)
 			}
+			if closed {
+				break processLoop
+			}
 		case <-interrupted:
 			return nil
 		}
@@ -359,6 +462,39 @@ processLoop:
 	return io.EOF
 }
 
+// fillBatch returns a batch that starts with first, and the transactions
+// that follow it on responseChan: up to batchSize of them, received
+// within batchInterval. The batch stops at the stop position, so the
+// player doesn't apply past it. closed is true if responseChan was
+// closed while filling the batch.
+func (blp *BinlogPlayer) fillBatch(first *proto.BinlogTransaction, responseChan chan *proto.BinlogTransaction, interrupted chan struct{}) (batch []*proto.BinlogTransaction, closed bool) {
+	batch = []*proto.BinlogTransaction{first}
+	if blp.batchSize <= 1 {
+		return batch, false
+	}
+	position := myproto.AppendGTID(blp.blpPos.Position, first.GTIDField.Value)
+	timer := time.NewTimer(blp.batchInterval)
+	defer timer.Stop()
+	for len(batch) < blp.batchSize {
+		if !blp.stopPosition.IsZero() && position.AtLeast(blp.stopPosition) {
+			break
+		}
+		select {
+		case tx, ok := <-responseChan:
+			if !ok {
+				return batch, true
+			}
+			batch = append(batch, tx)
+			position = myproto.AppendGTID(position, tx.GTIDField.Value)
+		case <-timer.C:
+			return batch, false
+		case <-interrupted:
+			return batch, false
+		}
+	}
+	return batch, false
+}
+
 // CreateBlpCheckpoint returns the statements required to create
 // the _vt.blp_checkpoint table
 func CreateBlpCheckpoint() []string {
@@ -405,3 +541,41 @@ func UpdateBlpCheckpoint(uid uint32, pos myproto.ReplicationPosition, timeUpdate
 func QueryBlpCheckpoint(index uint32) string {
 	return fmt.Sprintf("SELECT pos, flags FROM _vt.blp_checkpoint WHERE source_shard_uid=%v", index)
 }
+
+// QueryBlpCheckpoints returns a statement to query all the rows of the
+// _vt.blp_checkpoint table, for ParseBlpCheckpoints.
+func QueryBlpCheckpoints() string {
+	return "SELECT source_shard_uid, pos, time_updated, transaction_timestamp, flags FROM _vt.blp_checkpoint ORDER BY source_shard_uid"
+}
+
+// ParseBlpCheckpoints returns the checkpoints of the result of
+// QueryBlpCheckpoints.
+func ParseBlpCheckpoints(qr *mproto.QueryResult) (*proto.BlpCheckpointList, error) {
+	bcl := &proto.BlpCheckpointList{}
+	for _, row := range qr.Rows {
+		if len(row) != 5 {
+			return nil, fmt.Errorf("unexpected row in blp_checkpoint: %v", row)
+		}
+		uid, err := strconv.ParseUint(row[0].String(), 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid source_shard_uid in blp_checkpoint: %v", err)
+		}
+		bc := proto.BlpCheckpoint{Uid: uint32(uid)}
+		if !row[1].IsNull() {
+			if bc.Position, err = myproto.DecodeReplicationPosition(row[1].String()); err != nil {
+				return nil, fmt.Errorf("invalid pos in blp_checkpoint for %v: %v", uid, err)
+			}
+		}
+		if bc.TimeUpdated, err = strconv.ParseInt(row[2].String(), 10, 64); err != nil {
+			return nil, fmt.Errorf("invalid time_updated in blp_checkpoint for %v: %v", uid, err)
+		}
+		if bc.TransactionTimestamp, err = strconv.ParseInt(row[3].String(), 10, 64); err != nil {
+			return nil, fmt.Errorf("invalid transaction_timestamp in blp_checkpoint for %v: %v", uid, err)
+		}
+		if !row[4].IsNull() {
+			bc.Flags = row[4].String()
+		}
+		bcl.Entries = append(bcl.Entries, bc)
+	}
+	return bcl, nil
+}
@@ -0,0 +1,94 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build mysqld
+
+// This test needs a running mysqld, e.g.:
+//   go test -tags mysqld -run Mysqld -mysqld_socket /path/to/mysql.sock
+
+package binlogplayer
+
+import (
+	"flag"
+	"testing"
+
+	_ "github.com/youtube/vitess/go/mysql"
+	mproto "github.com/youtube/vitess/go/mysql/proto"
+	"github.com/youtube/vitess/go/sqldb"
+	"github.com/youtube/vitess/go/vt/binlog/proto"
+	myproto "github.com/youtube/vitess/go/vt/mysqlctl/proto"
+)
+
+var (
+	mysqldSocket = flag.String("mysqld_socket", "", "socket of the mysqld to run the tests against")
+	mysqldUser   = flag.String("mysqld_user", "root", "user to connect to mysqld as")
+)
+
+func TestMysqldCharset(t *testing.T) {
+	if *mysqldSocket == "" {
+		t.Skip("no -mysqld_socket")
+	}
+	dbClient := NewDbClient(&sqldb.ConnParams{
+		Uname:      *mysqldUser,
+		UnixSocket: *mysqldSocket,
+	})
+	if err := dbClient.Connect(); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	defer dbClient.Close()
+	setup := append(CreateBlpCheckpoint(),
+		"DELETE FROM _vt.blp_checkpoint WHERE source_shard_uid=1",
+		PopulateBlpCheckpoint(1, myproto.ReplicationPosition{GTIDSet: myproto.MariadbGTID{Domain: 0, Server: 1, Sequence: 0}}, 0, ""),
+		"CREATE DATABASE IF NOT EXISTS vt_charset_test",
+		"DROP TABLE IF EXISTS vt_charset_test.t",
+		"CREATE TABLE vt_charset_test.t (id INT PRIMARY KEY, l VARCHAR(16) CHARACTER SET latin1, u VARCHAR(16) CHARACTER SET utf8) ENGINE=InnoDB",
+	)
+	for _, sql := range setup {
+		if _, err := dbClient.ExecuteFetch(sql, 0, false); err != nil {
+			t.Fatalf("%v failed: %v", sql, err)
+		}
+	}
+	defer dbClient.ExecuteFetch("DROP DATABASE vt_charset_test", 0, false)
+
+	startPosition, _, err := ReadStartPosition(dbClient, 1)
+	if err != nil {
+		t.Fatalf("ReadStartPosition failed: %v", err)
+	}
+	blp := NewBinlogPlayerTables(dbClient, "", []string{"t"}, startPosition, myproto.ReplicationPosition{}, NewBinlogPlayerStats())
+	utf8 := mproto.Charset{Client: 33, Conn: 33, Server: 33}
+	latin1 := mproto.Charset{Client: 8, Conn: 8, Server: 33}
+	if err := dbClient.SetCharset(utf8); err != nil {
+		t.Fatalf("SetCharset failed: %v", err)
+	}
+	blp.defaultCharset = utf8
+	blp.currentCharset = utf8
+
+	// the same text, encoded in latin1 then utf8, must end up the
+	// same in the columns of both charsets
+	tx := &proto.BinlogTransaction{
+		Statements: []proto.Statement{
+			{Category: proto.BL_DML, Charset: &latin1, Sql: []byte("INSERT INTO vt_charset_test.t VALUES (1, 'caf\xe9', 'caf\xe9')")},
+			{Category: proto.BL_DML, Sql: []byte("INSERT INTO vt_charset_test.t VALUES (2, 'caf\xc3\xa9', 'caf\xc3\xa9')")},
+		},
+		GTIDField: myproto.GTIDField{Value: myproto.MariadbGTID{Domain: 0, Server: 1, Sequence: 1}},
+	}
+	if ok, err := blp.processTransaction(tx); !ok || err != nil {
+		t.Fatalf("processTransaction = %v, %v", ok, err)
+	}
+	if blp.currentCharset != utf8 {
+		t.Errorf("charset after the transaction = %v, want %v", blp.currentCharset, utf8)
+	}
+	qr, err := dbClient.ExecuteFetch("SELECT HEX(l), HEX(u) FROM vt_charset_test.t ORDER BY id", 10, false)
+	if err != nil {
+		t.Fatalf("SELECT failed: %v", err)
+	}
+	if len(qr.Rows) != 2 {
+		t.Fatalf("got %v rows, want 2", len(qr.Rows))
+	}
+	for i, row := range qr.Rows {
+		if l, u := row[0].String(), row[1].String(); l != "636166E9" || u != "636166C3A9" {
+			t.Errorf("row %v = %v, %v, want 636166E9, 636166C3A9", i+1, l, u)
+		}
+	}
+}
@@ -5,8 +5,18 @@
 package binlogplayer
 
 import (
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"regexp"
+	"strings"
 	"testing"
+	"time"
 
+	mproto "github.com/youtube/vitess/go/mysql/proto"
+	"github.com/youtube/vitess/go/sqltypes"
+	"github.com/youtube/vitess/go/vt/binlog/proto"
 	myproto "github.com/youtube/vitess/go/vt/mysqlctl/proto"
 )
 
@@ -53,3 +63,376 @@ func TestQueryBlpCheckpoint(t *testing.T) {
 		t.Errorf("QueryBlpCheckpoint(482821) = %#v, want %#v", got, want)
 	}
 }
+
+func TestParseBlpCheckpoints(t *testing.T) {
+	qr := &mproto.QueryResult{
+		Rows: [][]sqltypes.Value{
+			{
+				sqltypes.MakeString([]byte("1")),
+				sqltypes.MakeString([]byte("MariaDB/0-1-1083")),
+				sqltypes.MakeString([]byte("481823")),
+				sqltypes.MakeString([]byte("481820")),
+				sqltypes.MakeString([]byte("")),
+			},
+			{
+				sqltypes.MakeString([]byte("2")),
+				sqltypes.NULL,
+				sqltypes.MakeString([]byte("481824")),
+				sqltypes.MakeString([]byte("0")),
+				sqltypes.MakeString([]byte("DontStart")),
+			},
+		},
+	}
+	got, err := ParseBlpCheckpoints(qr)
+	if err != nil {
+		t.Fatalf("ParseBlpCheckpoints failed: %v", err)
+	}
+	want := &proto.BlpCheckpointList{
+		Entries: []proto.BlpCheckpoint{
+			{
+				Uid:                  1,
+				Position:             myproto.ReplicationPosition{GTIDSet: myproto.MustParseGTID("MariaDB", "0-1-1083").GTIDSet()},
+				TimeUpdated:          481823,
+				TransactionTimestamp: 481820,
+			},
+			{
+				Uid:         2,
+				TimeUpdated: 481824,
+				Flags:       BlpFlagDontStart,
+			},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseBlpCheckpoints() = %#v, want %#v", got, want)
+	}
+
+	qr.Rows[0][2] = sqltypes.MakeString([]byte("yesterday"))
+	if _, err := ParseBlpCheckpoints(qr); err == nil {
+		t.Errorf("ParseBlpCheckpoints of an invalid time_updated didn't fail")
+	}
+}
+
+// checkpointVtClient is a VtClient with a blp_checkpoint row and a
+// table of applied statements, that are only changed when their
+// transaction is committed, like InnoDB would. Statements containing
+// failOn fail, to simulate a crash in the middle of a transaction.
+type checkpointVtClient struct {
+	position string
+	applied  []string
+
+	pendingPosition string
+	pending         []string
+	failOn          string
+}
+
+var checkpointPosRegexp = regexp.MustCompile(`SET pos='([^']*)'`)
+
+func (dc *checkpointVtClient) Connect() error { return nil }
+func (dc *checkpointVtClient) Close()         {}
+
+func (dc *checkpointVtClient) Begin() error {
+	dc.pendingPosition = ""
+	dc.pending = nil
+	return nil
+}
+
+func (dc *checkpointVtClient) Commit() error {
+	if dc.pendingPosition != "" {
+		dc.position = dc.pendingPosition
+	}
+	dc.applied = append(dc.applied, dc.pending...)
+	return dc.Begin()
+}
+
+func (dc *checkpointVtClient) Rollback() error {
+	return dc.Begin()
+}
+
+func (dc *checkpointVtClient) ExecuteFetch(query string, maxrows int, wantfields bool) (*mproto.QueryResult, error) {
+	switch {
+	case dc.failOn != "" && strings.Contains(query, dc.failOn):
+		return nil, errors.New("connection lost")
+	case strings.HasPrefix(query, "SELECT pos, flags FROM _vt.blp_checkpoint"):
+		return &mproto.QueryResult{
+			RowsAffected: 1,
+			Rows: [][]sqltypes.Value{
+				{sqltypes.MakeString([]byte(dc.position)), sqltypes.MakeString(nil)},
+			},
+		}, nil
+	case strings.HasPrefix(query, "UPDATE _vt.blp_checkpoint"):
+		dc.pendingPosition = checkpointPosRegexp.FindStringSubmatch(query)[1]
+		return &mproto.QueryResult{RowsAffected: 1}, nil
+	}
+	dc.pending = append(dc.pending, query)
+	return &mproto.QueryResult{RowsAffected: 1}, nil
+}
+
+func TestBinlogPlayerRecovery(t *testing.T) {
+	gtid := func(sequence uint64) myproto.GTIDField {
+		return myproto.GTIDField{Value: myproto.MariadbGTID{Domain: 0, Server: 1, Sequence: sequence}}
+	}
+	transactions := []*proto.BinlogTransaction{
+		{
+			Statements: []proto.Statement{{Category: proto.BL_DML, Sql: []byte("insert 1")}},
+			Timestamp:  1000,
+			GTIDField:  gtid(1),
+		},
+		{
+			Statements: []proto.Statement{
+				{Category: proto.BL_DML, Sql: []byte("insert 2")},
+				{Category: proto.BL_DML, Sql: []byte("insert 3")},
+			},
+			Timestamp: 1001,
+			GTIDField: gtid(2),
+		},
+		{
+			// filtered out, only the position moves
+			GTIDField: gtid(3),
+		},
+	}
+	dbClient := &checkpointVtClient{position: "MariaDB/0-1-0"}
+	start := func() *BinlogPlayer {
+		startPosition, _, err := ReadStartPosition(dbClient, 5)
+		if err != nil {
+			t.Fatalf("ReadStartPosition failed: %v", err)
+		}
+		return NewBinlogPlayerTables(dbClient, "", []string{"t"}, startPosition, myproto.ReplicationPosition{}, NewBinlogPlayerStats())
+	}
+
+	// the tablet crashes in the middle of the second transaction
+	blp := start()
+	if ok, err := blp.processTransaction(transactions[0]); !ok || err != nil {
+		t.Fatalf("processTransaction(0) = %v, %v", ok, err)
+	}
+	dbClient.failOn = "insert 3"
+	if _, err := blp.processTransaction(transactions[1]); err == nil {
+		t.Fatalf("processTransaction(1) didn't fail")
+	}
+	if dbClient.position != "MariaDB/0-1-1" || !reflect.DeepEqual(dbClient.applied, []string{"insert 1"}) {
+		t.Errorf("checkpoint or data of a failed transaction were committed: %v %v", dbClient.position, dbClient.applied)
+	}
+	if got := myproto.EncodeReplicationPosition(blp.blplStats.GetLastPosition()); got != "MariaDB/0-1-1" {
+		t.Errorf("the position of the player ran ahead of the data: %v", got)
+	}
+
+	// after the restart, the player resumes after the first one
+	dbClient.failOn = ""
+	blp = start()
+	if got := myproto.EncodeReplicationPosition(blp.blpPos.Position); got != "MariaDB/0-1-1" {
+		t.Fatalf("restarted player position = %v, want MariaDB/0-1-1", got)
+	}
+	for i, tx := range transactions[1:] {
+		if ok, err := blp.processTransaction(tx); !ok || err != nil {
+			t.Fatalf("processTransaction(%v) after restart = %v, %v", i+1, ok, err)
+		}
+	}
+	if dbClient.position != "MariaDB/0-1-3" || !reflect.DeepEqual(dbClient.applied, []string{"insert 1", "insert 2", "insert 3"}) {
+		t.Errorf("after recovery: %v %v", dbClient.position, dbClient.applied)
+	}
+	if got := blp.blplStats.SecondsBehindMaster.Get(); got == 0 {
+		t.Errorf("SecondsBehindMaster not set from the transaction timestamp")
+	}
+}
+
+func TestBinlogPlayerBatch(t *testing.T) {
+	gtid := func(sequence uint64) myproto.GTIDField {
+		return myproto.GTIDField{Value: myproto.MariadbGTID{Domain: 0, Server: 1, Sequence: sequence}}
+	}
+	var transactions []*proto.BinlogTransaction
+	for i := 1; i <= 5; i++ {
+		transactions = append(transactions, &proto.BinlogTransaction{
+			Statements: []proto.Statement{{Category: proto.BL_DML, Sql: []byte(fmt.Sprintf("insert %v", i))}},
+			Timestamp:  int64(1000 + i),
+			GTIDField:  gtid(uint64(i)),
+		})
+	}
+	dbClient := &checkpointVtClient{position: "MariaDB/0-1-0"}
+	startPosition, _, err := ReadStartPosition(dbClient, 5)
+	if err != nil {
+		t.Fatalf("ReadStartPosition failed: %v", err)
+	}
+	stopPosition, err := myproto.DecodeReplicationPosition("MariaDB/0-1-4")
+	if err != nil {
+		t.Fatalf("DecodeReplicationPosition failed: %v", err)
+	}
+	blp := NewBinlogPlayerTables(dbClient, "", []string{"t"}, startPosition, stopPosition, NewBinlogPlayerStats())
+	blp.batchSize = 3
+	blp.batchInterval = time.Hour
+
+	// the batch is cut at its size, then at the stop position
+	responseChan := make(chan *proto.BinlogTransaction, len(transactions))
+	for _, tx := range transactions[1:] {
+		responseChan <- tx
+	}
+	batch, closed := blp.fillBatch(transactions[0], responseChan, nil)
+	if len(batch) != 3 || closed {
+		t.Fatalf("fillBatch = %v transactions, closed %v, want 3, false", len(batch), closed)
+	}
+	if ok, err := blp.processBatch(batch); !ok || err != nil {
+		t.Fatalf("processBatch = %v, %v", ok, err)
+	}
+	if dbClient.position != "MariaDB/0-1-3" || !reflect.DeepEqual(dbClient.applied, []string{"insert 1", "insert 2", "insert 3"}) {
+		t.Errorf("after the first batch: %v %v", dbClient.position, dbClient.applied)
+	}
+	if got := blp.blplStats.LastBatchSize.Get(); got != 3 {
+		t.Errorf("LastBatchSize = %v, want 3", got)
+	}
+	if got := blp.blplStats.Timings.Counts()[BlplTransaction]; got != 3 {
+		t.Errorf("%v timings = %v, want 3", BlplTransaction, got)
+	}
+	first := <-responseChan
+	batch, _ = blp.fillBatch(first, responseChan, nil)
+	if len(batch) != 1 {
+		t.Errorf("fillBatch went past the stop position: %v transactions", len(batch))
+	}
+
+	// the batch is cut when the stream ends
+	blp.stopPosition = myproto.ReplicationPosition{}
+	close(responseChan)
+	batch, closed = blp.fillBatch(first, responseChan, nil)
+	if len(batch) != 2 || !closed {
+		t.Errorf("fillBatch = %v transactions, closed %v, want 2, true", len(batch), closed)
+	}
+
+	// a failed batch is applied again one by one, up to the
+	// transaction that fails
+	dbClient.failOn = "insert 5"
+	if _, err := blp.processBatch(batch); err == nil || !strings.Contains(err.Error(), "connection lost") {
+		t.Fatalf("processBatch didn't fail: %v", err)
+	}
+	if dbClient.position != "MariaDB/0-1-4" || !reflect.DeepEqual(dbClient.applied, []string{"insert 1", "insert 2", "insert 3", "insert 4"}) {
+		t.Errorf("after the failed batch: %v %v", dbClient.position, dbClient.applied)
+	}
+}
+
+// charsetVtClient is a VtClient that records the statements it runs,
+// and the changes of its session charset.
+type charsetVtClient struct {
+	checkpointVtClient
+	charset mproto.Charset
+	log     []string
+}
+
+func (dc *charsetVtClient) GetCharset() (mproto.Charset, error) {
+	return dc.charset, nil
+}
+
+func (dc *charsetVtClient) SetCharset(cs mproto.Charset) error {
+	dc.charset = cs
+	dc.log = append(dc.log, fmt.Sprintf("charset %v", cs.Client))
+	return nil
+}
+
+func (dc *charsetVtClient) ExecuteFetch(query string, maxrows int, wantfields bool) (*mproto.QueryResult, error) {
+	if strings.HasPrefix(query, "insert") {
+		dc.log = append(dc.log, query)
+	}
+	return dc.checkpointVtClient.ExecuteFetch(query, maxrows, wantfields)
+}
+
+// fakeStreamClient is a BinlogPlayerClient that streams transactions.
+type fakeStreamClient struct {
+	transactions []*proto.BinlogTransaction
+	request      *proto.TablesRequest
+}
+
+type fakeStreamResponse struct{}
+
+func (fakeStreamResponse) Error() error { return nil }
+
+func (fsc *fakeStreamClient) Dial(addr string, connTimeout time.Duration) error { return nil }
+func (fsc *fakeStreamClient) Close()                                            {}
+
+func (fsc *fakeStreamClient) ServeUpdateStream(req *proto.UpdateStreamRequest, responseChan chan *proto.StreamEvent) BinlogPlayerResponse {
+	close(responseChan)
+	return fakeStreamResponse{}
+}
+
+func (fsc *fakeStreamClient) StreamTables(req *proto.TablesRequest, responseChan chan *proto.BinlogTransaction) BinlogPlayerResponse {
+	fsc.request = req
+	go func() {
+		for _, tx := range fsc.transactions {
+			responseChan <- tx
+		}
+		close(responseChan)
+	}()
+	return fakeStreamResponse{}
+}
+
+func (fsc *fakeStreamClient) StreamKeyRange(req *proto.KeyRangeRequest, responseChan chan *proto.BinlogTransaction) BinlogPlayerResponse {
+	close(responseChan)
+	return fakeStreamResponse{}
+}
+
+var fakeStream = &fakeStreamClient{}
+
+func init() {
+	RegisterBinlogPlayerClientFactory("fake", func() BinlogPlayerClient {
+		return fakeStream
+	})
+}
+
+func TestBinlogPlayerCharset(t *testing.T) {
+	utf8 := mproto.Charset{Client: 33, Conn: 33, Server: 33}
+	latin1 := mproto.Charset{Client: 8, Conn: 8, Server: 33}
+	gtid := func(sequence uint64) myproto.GTIDField {
+		return myproto.GTIDField{Value: myproto.MariadbGTID{Domain: 0, Server: 1, Sequence: sequence}}
+	}
+	fakeStream.transactions = []*proto.BinlogTransaction{
+		{
+			// the streamer doesn't send the charset of the
+			// statements that have the one of the request
+			Statements: []proto.Statement{
+				{Category: proto.BL_DML, Sql: []byte("insert 'caf\xc3\xa9'")},
+				{Category: proto.BL_DML, Charset: &latin1, Sql: []byte("insert 'caf\xe9'")},
+				{Category: proto.BL_DML, Charset: &latin1, Sql: []byte("insert 'na\xefve'")},
+			},
+			GTIDField: gtid(1),
+		},
+		{
+			Statements: []proto.Statement{
+				{Category: proto.BL_DML, Charset: &latin1, Sql: []byte("insert 'd\xe9j\xe0'")},
+				{Category: proto.BL_DML, Sql: []byte("insert '\xe2\x82\xac'")},
+			},
+			GTIDField: gtid(2),
+		},
+	}
+	oldProtocol := *binlogPlayerProtocol
+	*binlogPlayerProtocol = "fake"
+	defer func() { *binlogPlayerProtocol = oldProtocol }()
+
+	dbClient := &charsetVtClient{
+		checkpointVtClient: checkpointVtClient{position: "MariaDB/0-1-0"},
+		charset:            utf8,
+	}
+	startPosition, _, err := ReadStartPosition(dbClient, 5)
+	if err != nil {
+		t.Fatalf("ReadStartPosition failed: %v", err)
+	}
+	blp := NewBinlogPlayerTables(dbClient, "", []string{"t"}, startPosition, myproto.ReplicationPosition{}, NewBinlogPlayerStats())
+	if err := blp.ApplyBinlogEvents(nil); err != io.EOF {
+		t.Fatalf("ApplyBinlogEvents = %v, want io.EOF", err)
+	}
+	if fakeStream.request.Charset == nil || *fakeStream.request.Charset != utf8 {
+		t.Errorf("the request doesn't have the charset of the connection: %v", fakeStream.request.Charset)
+	}
+
+	// the charset is only changed when it differs from the one of
+	// the previous statement, and restored at the end
+	want := []string{
+		"insert 'caf\xc3\xa9'",
+		"charset 8",
+		"insert 'caf\xe9'",
+		"insert 'na\xefve'",
+		"insert 'd\xe9j\xe0'",
+		"charset 33",
+		"insert '\xe2\x82\xac'",
+		"charset 33",
+	}
+	if !reflect.DeepEqual(dbClient.log, want) {
+		t.Errorf("got %q, want %q", dbClient.log, want)
+	}
+	if dbClient.position != "MariaDB/0-1-2" {
+		t.Errorf("position = %v, want MariaDB/0-1-2", dbClient.position)
+	}
+}
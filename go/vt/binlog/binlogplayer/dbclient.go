@@ -99,3 +99,18 @@ func (dc *DBClient) ExecuteFetch(query string, maxrows int, wantfields bool) (*m
 	}
 	return mqr, nil
 }
+
+// GetCharset is part of the CharsetClient interface.
+func (dc *DBClient) GetCharset() (mproto.Charset, error) {
+	return dc.dbConn.GetCharset()
+}
+
+// SetCharset is part of the CharsetClient interface.
+func (dc *DBClient) SetCharset(cs mproto.Charset) error {
+	err := dc.dbConn.SetCharset(cs)
+	if err != nil {
+		log.Errorf("SetCharset failed w/ error %v", err)
+		dc.handleError(err)
+	}
+	return err
+}
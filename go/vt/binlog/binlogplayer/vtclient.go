@@ -21,6 +21,14 @@ type VtClient interface {
 	ExecuteFetch(query string, maxrows int, wantfields bool) (qr *mproto.QueryResult, err error)
 }
 
+// CharsetClient is implemented by the VtClients that can change the
+// charset of their session. The binlog player then applies each
+// statement with the charset it had on the source.
+type CharsetClient interface {
+	GetCharset() (mproto.Charset, error)
+	SetCharset(cs mproto.Charset) error
+}
+
 // DummyVtClient is a VtClient that writes to a writer instead of executing
 // anything
 type DummyVtClient struct {
@@ -62,6 +62,7 @@ var testKeyRangeRequest = &proto.KeyRangeRequest{
 		Conn:   13,
 		Server: 14,
 	},
+	ShardingColumnName: "keyspace_id",
 }
 
 var testBinlogTransaction = &proto.BinlogTransaction{
@@ -75,6 +76,26 @@ var testBinlogTransaction = &proto.BinlogTransaction{
 			},
 			Sql: []byte("my statement"),
 		},
+		// multi-byte data must go through unchanged, whatever
+		// its charset: here latin1, then utf8
+		proto.Statement{
+			Category: proto.BL_DML,
+			Charset: &mproto.Charset{
+				Client: 8,
+				Conn:   8,
+				Server: 33,
+			},
+			Sql: []byte("insert into t values ('caf\xe9')"),
+		},
+		proto.Statement{
+			Category: proto.BL_DML,
+			Charset: &mproto.Charset{
+				Client: 33,
+				Conn:   33,
+				Server: 33,
+			},
+			Sql: []byte("insert into t values ('caf\xc3\xa9 \xe2\x82\xac')"),
+		},
 	},
 	Timestamp: 78,
 	GTIDField: myproto.GTIDField{
@@ -0,0 +1,133 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package grpcbinlogplayer contains the gRPC implementation of the
+// binlog player client, used with -binlog_player_protocol grpc.
+package grpcbinlogplayer
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+
+	"github.com/youtube/vitess/go/vt/binlog/binlogplayer"
+	"github.com/youtube/vitess/go/vt/binlog/proto"
+
+	pb "github.com/youtube/vitess/go/vt/proto/binlogdata"
+)
+
+// response is the BinlogPlayerResponse of the streams. err is set
+// before the channel of the stream is closed.
+type response struct {
+	err error
+}
+
+func (r *response) Error() error {
+	return r.err
+}
+
+// client implements a BinlogPlayerClient over gRPC
+type client struct {
+	cc     *grpc.ClientConn
+	c      pb.UpdateStreamClient
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func (client *client) Dial(addr string, connTimeout time.Duration) error {
+	var err error
+	client.cc, err = grpc.Dial(addr)
+	if err != nil {
+		return err
+	}
+	client.c = pb.NewUpdateStreamClient(client.cc)
+	client.ctx, client.cancel = context.WithCancel(context.Background())
+	return nil
+}
+
+// Close ends the streams in progress, and the connection.
+func (client *client) Close() {
+	client.cancel()
+	client.cc.Close()
+}
+
+func (client *client) ServeUpdateStream(req *proto.UpdateStreamRequest, responseChan chan *proto.StreamEvent) binlogplayer.BinlogPlayerResponse {
+	close(responseChan)
+	return &response{err: fmt.Errorf("ServeUpdateStream is not supported over gRPC, use StreamKeyRange or StreamTables")}
+}
+
+func (client *client) StreamKeyRange(req *proto.KeyRangeRequest, responseChan chan *proto.BinlogTransaction) binlogplayer.BinlogPlayerResponse {
+	query, err := proto.KeyRangeRequestToProto(req)
+	if err != nil {
+		close(responseChan)
+		return &response{err: err}
+	}
+	stream, err := client.c.StreamKeyRange(client.ctx, query)
+	if err != nil {
+		close(responseChan)
+		return &response{err: err}
+	}
+	return client.streamTransactions(func() (*pb.BinlogTransaction, error) {
+		r, err := stream.Recv()
+		if err != nil {
+			return nil, err
+		}
+		return r.BinlogTransaction, nil
+	}, responseChan)
+}
+
+func (client *client) StreamTables(req *proto.TablesRequest, responseChan chan *proto.BinlogTransaction) binlogplayer.BinlogPlayerResponse {
+	stream, err := client.c.StreamTables(client.ctx, proto.TablesRequestToProto(req))
+	if err != nil {
+		close(responseChan)
+		return &response{err: err}
+	}
+	return client.streamTransactions(func() (*pb.BinlogTransaction, error) {
+		r, err := stream.Recv()
+		if err != nil {
+			return nil, err
+		}
+		return r.BinlogTransaction, nil
+	}, responseChan)
+}
+
+// streamTransactions sends the transactions recv returns on
+// responseChan, until the stream or the client ends.
+func (client *client) streamTransactions(recv func() (*pb.BinlogTransaction, error), responseChan chan *proto.BinlogTransaction) binlogplayer.BinlogPlayerResponse {
+	response := &response{}
+	go func() {
+		defer close(responseChan)
+		for {
+			pbt, err := recv()
+			if err != nil {
+				if err != io.EOF {
+					response.err = err
+				}
+				return
+			}
+			bt, err := proto.ProtoToBinlogTransaction(pbt)
+			if err != nil {
+				response.err = err
+				return
+			}
+			select {
+			case responseChan <- bt:
+			case <-client.ctx.Done():
+				response.err = client.ctx.Err()
+				return
+			}
+		}
+	}()
+	return response
+}
+
+// Registration as a factory
+func init() {
+	binlogplayer.RegisterBinlogPlayerClientFactory("grpc", func() binlogplayer.BinlogPlayerClient {
+		return &client{}
+	})
+}
@@ -0,0 +1,39 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package grpcbinlogplayer
+
+import (
+	"net"
+	"testing"
+
+	"google.golang.org/grpc"
+
+	"github.com/youtube/vitess/go/vt/binlog/binlogplayertest"
+	"github.com/youtube/vitess/go/vt/binlog/grpcbinlogstreamer"
+
+	pb "github.com/youtube/vitess/go/vt/proto/binlogdata"
+)
+
+// the test here creates a fake server implementation, a fake client
+// implementation, and runs the test suite against the setup.
+func TestGRPCBinlogStreamer(t *testing.T) {
+	// Listen on a random port
+	listener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("Cannot listen: %v", err)
+	}
+
+	// Create a gRPC server and listen on the port
+	server := grpc.NewServer()
+	fakeUpdateStream := binlogplayertest.NewFakeBinlogStreamer(t)
+	pb.RegisterUpdateStreamServer(server, grpcbinlogstreamer.New(fakeUpdateStream))
+	go server.Serve(listener)
+
+	// Create a gRPC client to talk to the fake tablet
+	client := &client{}
+
+	// and send it to the test suite
+	binlogplayertest.Run(t, client, listener.Addr().String(), fakeUpdateStream)
+}
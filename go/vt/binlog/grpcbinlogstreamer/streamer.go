@@ -0,0 +1,64 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package grpcbinlogstreamer contains the gRPC implementation of the
+// binlog streamer, next to the gorpc one. Both share the same
+// proto.UpdateStream.
+package grpcbinlogstreamer
+
+import (
+	"github.com/youtube/vitess/go/vt/binlog"
+	"github.com/youtube/vitess/go/vt/binlog/proto"
+	"github.com/youtube/vitess/go/vt/servenv"
+
+	pb "github.com/youtube/vitess/go/vt/proto/binlogdata"
+)
+
+// UpdateStream is the gRPC UpdateStream server
+type UpdateStream struct {
+	updateStream proto.UpdateStream
+}
+
+// New returns a new gRPC server implementation stub for UpdateStream
+func New(updateStream proto.UpdateStream) *UpdateStream {
+	return &UpdateStream{updateStream}
+}
+
+// StreamKeyRange is part of the pb.UpdateStreamServer interface
+func (server *UpdateStream) StreamKeyRange(req *pb.StreamKeyRangeRequest, stream pb.UpdateStream_StreamKeyRangeServer) (err error) {
+	defer server.updateStream.HandlePanic(&err)
+	request, err := proto.ProtoToKeyRangeRequest(req)
+	if err != nil {
+		return err
+	}
+	return server.updateStream.StreamKeyRange(request, func(reply *proto.BinlogTransaction) error {
+		return stream.Send(&pb.StreamKeyRangeResponse{
+			BinlogTransaction: proto.BinlogTransactionToProto(reply),
+		})
+	})
+}
+
+// StreamTables is part of the pb.UpdateStreamServer interface
+func (server *UpdateStream) StreamTables(req *pb.StreamTablesRequest, stream pb.UpdateStream_StreamTablesServer) (err error) {
+	defer server.updateStream.HandlePanic(&err)
+	request, err := proto.ProtoToTablesRequest(req)
+	if err != nil {
+		return err
+	}
+	return server.updateStream.StreamTables(request, func(reply *proto.BinlogTransaction) error {
+		return stream.Send(&pb.StreamTablesResponse{
+			BinlogTransaction: proto.BinlogTransactionToProto(reply),
+		})
+	})
+}
+
+// registration mechanism
+
+func init() {
+	binlog.RegisterUpdateStreamServices = append(binlog.RegisterUpdateStreamServices, func(updateStream proto.UpdateStream) {
+		if servenv.GRPCCheckServiceMap("updatestream") {
+			pb.RegisterUpdateStreamServer(servenv.GRPCServer, New(updateStream))
+		}
+	})
+}
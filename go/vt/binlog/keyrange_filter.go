@@ -7,6 +7,7 @@ package binlog
 import (
 	"bytes"
 	"encoding/base64"
+	"fmt"
 	"strconv"
 
 	log "github.com/golang/glog"
@@ -16,17 +17,16 @@ import (
 
 var KEYSPACE_ID_COMMENT = []byte("/* EMD keyspace_id:")
 var SPACE = []byte(" ")
+var COMMENT_END = []byte("*/")
 
 // KeyRangeFilterFunc returns a function that calls sendReply only if statements
 // in the transaction match the specified keyrange. The resulting function can be
 // passed into the BinlogStreamer: bls.Stream(file, pos, sendTransaction) ->
 // bls.Stream(file, pos, KeyRangeFilterFunc(sendTransaction))
+//
+// A transaction with no statement in the keyrange is still sent, without
+// statements, so the client can advance its position past it.
 func KeyRangeFilterFunc(kit key.KeyspaceIdType, keyrange key.KeyRange, sendReply sendTransactionFunc) sendTransactionFunc {
-	isInteger := true
-	if kit == key.KIT_BYTES {
-		isInteger = false
-	}
-
 	return func(reply *proto.BinlogTransaction) error {
 		matched := false
 		filtered := make([]proto.Statement, 0, len(reply.Statements))
@@ -38,40 +38,19 @@ func KeyRangeFilterFunc(kit key.KeyspaceIdType, keyrange key.KeyRange, sendReply
 				log.Warningf("Not forwarding DDL: %s", string(statement.Sql))
 				continue
 			case proto.BL_DML:
-				keyspaceIndex := bytes.LastIndex(statement.Sql, KEYSPACE_ID_COMMENT)
-				if keyspaceIndex == -1 {
-					updateStreamErrors.Add("KeyRangeStream", 1)
-					log.Errorf("Error parsing keyspace id: %s", string(statement.Sql))
+				if isAllShards(statement.Sql) {
+					filtered = append(filtered, statement)
+					matched = true
 					continue
 				}
-				idstart := keyspaceIndex + len(KEYSPACE_ID_COMMENT)
-				idend := bytes.Index(statement.Sql[idstart:], SPACE)
-				if idend == -1 {
+				keyspaceId, err := parseKeyspaceIdComment(kit, statement.Sql)
+				if err != nil {
 					updateStreamErrors.Add("KeyRangeStream", 1)
-					log.Errorf("Error parsing keyspace id: %s", string(statement.Sql))
+					log.Errorf("Error parsing keyspace id: %v: %s", err, string(statement.Sql))
 					continue
 				}
-				textId := string(statement.Sql[idstart : idstart+idend])
-				if isInteger {
-					id, err := strconv.ParseUint(textId, 10, 64)
-					if err != nil {
-						updateStreamErrors.Add("KeyRangeStream", 1)
-						log.Errorf("Error parsing keyspace id: %s", string(statement.Sql))
-						continue
-					}
-					if !keyrange.Contains(key.Uint64Key(id).KeyspaceId()) {
-						continue
-					}
-				} else {
-					data, err := base64.StdEncoding.DecodeString(textId)
-					if err != nil {
-						updateStreamErrors.Add("KeyRangeStream", 1)
-						log.Errorf("Error parsing keyspace id: %s", string(statement.Sql))
-						continue
-					}
-					if !keyrange.Contains(key.KeyspaceId(data)) {
-						continue
-					}
+				if !keyrange.Contains(keyspaceId) {
+					continue
 				}
 				filtered = append(filtered, statement)
 				matched = true
@@ -89,3 +68,52 @@ func KeyRangeFilterFunc(kit key.KeyspaceIdType, keyrange key.KeyRange, sendReply
 		return sendReply(reply)
 	}
 }
+
+// isAllShards returns true if a DML has the ALL_SHARDS_COMMENT, that
+// the streamer adds to the rows of the tables without sharding column
+// in row based replication.
+func isAllShards(sql []byte) bool {
+	if streamIndex := bytes.LastIndex(sql, STREAM_COMMENT); streamIndex != -1 {
+		sql = sql[:streamIndex]
+	}
+	return bytes.Contains(sql, ALL_SHARDS_COMMENT)
+}
+
+// parseKeyspaceIdComment returns the keyspace id of the EMD comment of
+// a DML, e.g. "/* EMD keyspace_id:12 user_id:3 */". The id is a number
+// for KIT_UINT64, and base64 for KIT_BYTES. The _stream comment the
+// tablet adds after the DML is skipped, since its values could contain
+// the text of an EMD comment.
+func parseKeyspaceIdComment(kit key.KeyspaceIdType, sql []byte) (key.KeyspaceId, error) {
+	if streamIndex := bytes.LastIndex(sql, STREAM_COMMENT); streamIndex != -1 {
+		sql = sql[:streamIndex]
+	}
+	keyspaceIndex := bytes.LastIndex(sql, KEYSPACE_ID_COMMENT)
+	if keyspaceIndex == -1 {
+		return "", fmt.Errorf("no keyspace_id comment")
+	}
+	comment := sql[keyspaceIndex+len(KEYSPACE_ID_COMMENT):]
+	idend := bytes.Index(comment, COMMENT_END)
+	if idend == -1 {
+		return "", fmt.Errorf("unterminated keyspace_id comment")
+	}
+	if space := bytes.Index(comment[:idend], SPACE); space != -1 {
+		idend = space
+	}
+	textId := string(comment[:idend])
+	if textId == "" {
+		return "", fmt.Errorf("empty keyspace_id")
+	}
+	if kit == key.KIT_BYTES {
+		data, err := base64.StdEncoding.DecodeString(textId)
+		if err != nil {
+			return "", fmt.Errorf("invalid keyspace_id %q: %v", textId, err)
+		}
+		return key.KeyspaceId(data), nil
+	}
+	id, err := strconv.ParseUint(textId, 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("invalid keyspace_id %q: %v", textId, err)
+	}
+	return key.Uint64Key(id).KeyspaceId(), nil
+}
@@ -6,8 +6,11 @@ package binlog
 
 import (
 	"fmt"
+	"reflect"
+	"strings"
 	"testing"
 
+	"github.com/youtube/vitess/go/sync2"
 	"github.com/youtube/vitess/go/vt/binlog/proto"
 	"github.com/youtube/vitess/go/vt/key"
 	myproto "github.com/youtube/vitess/go/vt/mysqlctl/proto"
@@ -71,6 +74,34 @@ func TestKeyRangeFilterSkip(t *testing.T) {
 	}
 }
 
+func TestKeyRangeFilterAllShards(t *testing.T) {
+	input := proto.BinlogTransaction{
+		Statements: []proto.Statement{
+			{
+				Category: proto.BL_DML,
+				Sql:      []byte("dml1 /* EMD keyspace_id:20 */"),
+			}, {
+				Category: proto.BL_DML,
+				Sql:      []byte("dml2 /* EMD all_shards */ /* _stream vt_a (id ) (1 ); */"),
+			}, {
+				Category: proto.BL_DML,
+				Sql:      []byte("dml3 /* EMD keyspace_id:20 */ /* _stream vt_a (name ) ('/* EMD all_shards */' ); */"),
+			},
+		},
+		GTIDField: myproto.GTIDField{Value: myproto.MustParseGTID("MariaDB", "0-41983-1")},
+	}
+	var got string
+	f := KeyRangeFilterFunc(key.KIT_UINT64, testKeyRange, func(reply *proto.BinlogTransaction) error {
+		got = bltToString(reply)
+		return nil
+	})
+	f(&input)
+	want := `statement: <4, "dml2 /* EMD all_shards */ /* _stream vt_a (id ) (1 ); */"> position: "0-41983-1" `
+	if want != got {
+		t.Errorf("want %s, got %s", want, got)
+	}
+}
+
 func TestKeyRangeFilterDDL(t *testing.T) {
 	input := proto.BinlogTransaction{
 		Statements: []proto.Statement{
@@ -127,6 +158,105 @@ func TestKeyRangeFilterMalformed(t *testing.T) {
 	}
 }
 
+func TestParseKeyspaceIdComment(t *testing.T) {
+	testcases := []struct {
+		kit  key.KeyspaceIdType
+		sql  string
+		want key.KeyspaceId
+		ok   bool
+	}{
+		{key.KIT_UINT64, "dml /* EMD keyspace_id:2 */", key.Uint64Key(2).KeyspaceId(), true},
+		{key.KIT_UINT64, "dml /* EMD keyspace_id:2 user_id:5 */", key.Uint64Key(2).KeyspaceId(), true},
+		{key.KIT_UINT64, "dml /* EMD keyspace_id:2*/", key.Uint64Key(2).KeyspaceId(), true},
+		{key.KIT_UINT64, "dml /* EMD keyspace_id:2 */ /* _stream t (id ) (1 ); */", key.Uint64Key(2).KeyspaceId(), true},
+		{key.KIT_UINT64, "dml /* EMD keyspace_id:2 */ /* _stream t (msg ) ('/* EMD keyspace_id:20 */' ); */", key.Uint64Key(2).KeyspaceId(), true},
+		{key.KIT_BYTES, "dml /* EMD keyspace_id:AAE= */", key.KeyspaceId("\x00\x01"), true},
+		{key.KIT_UINT64, "dml /* _stream t (id ) (1 ); */", "", false},
+		{key.KIT_UINT64, "dml /* EMD keyspace_id:2a */", "", false},
+		{key.KIT_UINT64, "dml /* EMD keyspace_id: */", "", false},
+		{key.KIT_UINT64, "dml /* EMD keyspace_id:2", "", false},
+		{key.KIT_BYTES, "dml /* EMD keyspace_id:!! */", "", false},
+	}
+	for _, tcase := range testcases {
+		got, err := parseKeyspaceIdComment(tcase.kit, []byte(tcase.sql))
+		if (err == nil) != tcase.ok || got != tcase.want {
+			t.Errorf("parseKeyspaceIdComment(%v, %q) = (%q, %v), want %q", tcase.kit, tcase.sql, got, err, tcase.want)
+		}
+	}
+}
+
+// sequenceQueryEvent is a query event with its own GTID, so the
+// positions of the transactions can be told apart.
+type sequenceQueryEvent struct {
+	queryEvent
+	sequence uint64
+}
+
+func (ev sequenceQueryEvent) GTID(proto.BinlogFormat) (myproto.GTID, error) {
+	return myproto.MariadbGTID{Domain: 0, Server: 62344, Sequence: ev.sequence}, nil
+}
+func (ev sequenceQueryEvent) StripChecksum(proto.BinlogFormat) (proto.BinlogEvent, []byte, error) {
+	return ev, nil, nil
+}
+
+func TestKeyRangeFilterStream(t *testing.T) {
+	query := func(sequence uint64, sql string) proto.BinlogEvent {
+		return sequenceQueryEvent{
+			queryEvent: queryEvent{query: proto.Query{Database: "vt_test_keyspace", Sql: []byte(sql)}},
+			sequence:   sequence,
+		}
+	}
+	input := []proto.BinlogEvent{
+		rotateEvent{},
+		formatEvent{},
+		// a transaction with one statement in the keyrange
+		query(1, "BEGIN"),
+		query(1, "insert into t(id) values (1) /* EMD keyspace_id:1 */ /* _stream t (id ) (1 ); */"),
+		query(1, "insert into t(id) values (20) /* EMD keyspace_id:20 */ /* _stream t (id ) (20 ); */"),
+		query(1, "COMMIT"),
+		// a transaction with none
+		query(2, "BEGIN"),
+		query(2, "insert into t(id) values (21) /* EMD keyspace_id:21 */ /* _stream t (id ) (21 ); */"),
+		query(2, "COMMIT"),
+		// an autocommit statement in the keyrange
+		query(3, "update t set msg='a' where id=3 /* EMD keyspace_id:3 */ /* _stream t (id ) (3 ); */"),
+		// a rolled back transaction
+		query(4, "BEGIN"),
+		query(4, "insert into t(id) values (4) /* EMD keyspace_id:4 */ /* _stream t (id ) (4 ); */"),
+		query(4, "ROLLBACK"),
+		// a DDL
+		query(5, "alter table t add column c int"),
+	}
+
+	var got []string
+	f := KeyRangeFilterFunc(key.KIT_UINT64, testKeyRange, func(reply *proto.BinlogTransaction) error {
+		got = append(got, bltToString(reply))
+		return nil
+	})
+	bls := NewBinlogStreamer("vt_test_keyspace", nil, nil, myproto.ReplicationPosition{}, f)
+	events := make(chan proto.BinlogEvent)
+	go sendTestEvents(events, input)
+	svm := &sync2.ServiceManager{}
+	svm.Go(func(ctx *sync2.ServiceContext) error {
+		_, err := bls.parseEvents(ctx, events)
+		return err
+	})
+	if err := svm.Join(); err != ErrServerEOF {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	want := []string{
+		`statement: <6, "SET TIMESTAMP=1407805592"> statement: <4, "insert into t(id) values (1) /* EMD keyspace_id:1 */ /* _stream t (id ) (1 ); */"> statement: <6, "SET TIMESTAMP=1407805592"> position: "0-62344-1" `,
+		`position: "0-62344-2" `,
+		`statement: <6, "SET TIMESTAMP=1407805592"> statement: <4, "update t set msg='a' where id=3 /* EMD keyspace_id:3 */ /* _stream t (id ) (3 ); */"> position: "0-62344-3" `,
+		`position: "0-62344-4" `,
+		`position: "0-62344-5" `,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("filtered stream:\ngot  %v\nwant %v", strings.Join(got, "\n     "), strings.Join(want, "\n     "))
+	}
+}
+
 func bltToString(tx *proto.BinlogTransaction) string {
 	result := ""
 	for _, statement := range tx.Statements {
@@ -8,6 +8,7 @@ import (
 	"fmt"
 
 	mproto "github.com/youtube/vitess/go/mysql/proto"
+	"github.com/youtube/vitess/go/sqltypes"
 	myproto "github.com/youtube/vitess/go/vt/mysqlctl/proto"
 )
 
@@ -46,6 +47,15 @@ type BinlogEvent interface {
 	IsIntVar() bool
 	// IsRand returns true if this is a RAND_EVENT.
 	IsRand() bool
+	// IsTableMap returns true if this is a TABLE_MAP_EVENT, which
+	// describes the table of the rows events that follow it.
+	IsTableMap() bool
+	// IsWriteRows returns true if this is a WRITE_ROWS_EVENT (v1 or v2).
+	IsWriteRows() bool
+	// IsUpdateRows returns true if this is an UPDATE_ROWS_EVENT (v1 or v2).
+	IsUpdateRows() bool
+	// IsDeleteRows returns true if this is a DELETE_ROWS_EVENT (v1 or v2).
+	IsDeleteRows() bool
 	// HasGTID returns true if this event contains a GTID. That could either be
 	// because it's a GTID_EVENT (MariaDB, MySQL 5.6), or because it is some
 	// arbitrary event type that has a GTID in the header (Google MySQL).
@@ -74,6 +84,17 @@ type BinlogEvent interface {
 	// Rand returns the two seed values for a RAND_EVENT.
 	// This is only valid if IsRand() returns true.
 	Rand(BinlogFormat) (uint64, uint64, error)
+	// TableID returns the table id of a TABLE_MAP_EVENT or a rows event.
+	// It matches the rows events with the last TABLE_MAP_EVENT that had
+	// the same id.
+	TableID(BinlogFormat) uint64
+	// TableMap returns a TableMap struct representing data from a
+	// TABLE_MAP_EVENT. This is only valid if IsTableMap() returns true.
+	TableMap(BinlogFormat) (*TableMap, error)
+	// Rows returns the rows of a rows event, decoded with the column types
+	// of its table. This is only valid if IsWriteRows(), IsUpdateRows() or
+	// IsDeleteRows() returns true.
+	Rows(BinlogFormat, *TableMap) (Rows, error)
 
 	// StripChecksum returns the checksum and a modified event with the checksum
 	// stripped off, if any. If there is no checksum, it returns the same event
@@ -112,3 +133,32 @@ func (q Query) String() string {
 	return fmt.Sprintf("{Database: %q, Charset: %v, Sql: %q}",
 		q.Database, q.Charset, string(q.Sql))
 }
+
+// TableMap contains data from a TABLE_MAP_EVENT.
+type TableMap struct {
+	Database string
+	Name     string
+
+	// Types are the MySQL types of the columns, e.g. mproto.VT_LONG,
+	// and Metadata the type specific data the event has for each of
+	// them, e.g. the maximum length of a VARCHAR.
+	Types    []byte
+	Metadata []uint16
+
+	// Unsigned is not in the event: the integer columns are decoded
+	// as unsigned if it is set for them, as signed otherwise.
+	Unsigned []bool
+}
+
+// Rows contains data from a rows event.
+type Rows struct {
+	Rows []Row
+}
+
+// Row is a row of a rows event. Before is the row before the change,
+// for updates and deletes, and After the row after it, for inserts and
+// updates. They have a value per column of the table.
+type Row struct {
+	Before []sqltypes.Value
+	After  []sqltypes.Value
+}
@@ -36,3 +36,52 @@ func (bpl *BlpPositionList) FindBlpPositionById(id uint32) (*BlpPosition, error)
 	}
 	return nil, fmt.Errorf("BlpPosition for id %v not found", id)
 }
+
+// BlpCheckpoint is a row of the _vt.blp_checkpoint table of a
+// destination tablet: the position a binlog player applied up to from
+// its source shard, when it did, and the timestamp of the last
+// transaction it applied. It is updated in the same transaction as the
+// statements it applied.
+type BlpCheckpoint struct {
+	Uid                  uint32
+	Position             myproto.ReplicationPosition
+	TimeUpdated          int64
+	TransactionTimestamp int64
+	Flags                string
+}
+
+//go:generate bsongen -file $GOFILE -type BlpCheckpoint -o blp_checkpoint_bson.go
+
+// BlpCheckpointList is the content of the _vt.blp_checkpoint table,
+// sorted by Uid.
+type BlpCheckpointList struct {
+	Entries []BlpCheckpoint
+}
+
+//go:generate bsongen -file $GOFILE -type BlpCheckpointList -o blp_checkpoint_list_bson.go
+
+// BlpStatus is the status of a running binlog player of a master:
+// where it is, how far behind its source, and what went wrong last.
+// Position is the position it applied up to, as known in memory.
+type BlpStatus struct {
+	Uid                 uint32
+	Keyspace            string
+	Shard               string
+	State               string
+	Position            myproto.ReplicationPosition
+	StopPosition        myproto.ReplicationPosition
+	SecondsBehindMaster int64
+	SourceTablet        string
+	LastError           string
+}
+
+//go:generate bsongen -file $GOFILE -type BlpStatus -o blp_status_bson.go
+
+// BlpStatusList is the status of the binlog players of a master,
+// sorted by Uid. State is the state of the players as a whole.
+type BlpStatusList struct {
+	State   string
+	Entries []BlpStatus
+}
+
+//go:generate bsongen -file $GOFILE -type BlpStatusList -o blp_status_list_bson.go
@@ -0,0 +1,59 @@
+// Copyright 2012, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package proto
+
+// DO NOT EDIT.
+// FILE GENERATED BY BSONGEN.
+
+import (
+	"bytes"
+
+	"github.com/youtube/vitess/go/bson"
+	"github.com/youtube/vitess/go/bytes2"
+)
+
+// MarshalBson bson-encodes BlpCheckpoint.
+func (blpCheckpoint *BlpCheckpoint) MarshalBson(buf *bytes2.ChunkedWriter, key string) {
+	bson.EncodeOptionalPrefix(buf, bson.Object, key)
+	lenWriter := bson.NewLenWriter(buf)
+
+	bson.EncodeUint32(buf, "Uid", blpCheckpoint.Uid)
+	blpCheckpoint.Position.MarshalBson(buf, "Position")
+	bson.EncodeInt64(buf, "TimeUpdated", blpCheckpoint.TimeUpdated)
+	bson.EncodeInt64(buf, "TransactionTimestamp", blpCheckpoint.TransactionTimestamp)
+	bson.EncodeString(buf, "Flags", blpCheckpoint.Flags)
+
+	lenWriter.Close()
+}
+
+// UnmarshalBson bson-decodes into BlpCheckpoint.
+func (blpCheckpoint *BlpCheckpoint) UnmarshalBson(buf *bytes.Buffer, kind byte) {
+	switch kind {
+	case bson.EOO, bson.Object:
+		// valid
+	case bson.Null:
+		return
+	default:
+		panic(bson.NewBsonError("unexpected kind %v for BlpCheckpoint", kind))
+	}
+	bson.Next(buf, 4)
+
+	for kind := bson.NextByte(buf); kind != bson.EOO; kind = bson.NextByte(buf) {
+		switch bson.ReadCString(buf) {
+		case "Uid":
+			blpCheckpoint.Uid = bson.DecodeUint32(buf, kind)
+		case "Position":
+			blpCheckpoint.Position.UnmarshalBson(buf, kind)
+		case "TimeUpdated":
+			blpCheckpoint.TimeUpdated = bson.DecodeInt64(buf, kind)
+		case "TransactionTimestamp":
+			blpCheckpoint.TransactionTimestamp = bson.DecodeInt64(buf, kind)
+		case "Flags":
+			blpCheckpoint.Flags = bson.DecodeString(buf, kind)
+		default:
+			bson.Skip(buf, kind)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright 2012, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package proto
+
+// DO NOT EDIT.
+// FILE GENERATED BY BSONGEN.
+
+import (
+	"bytes"
+
+	"github.com/youtube/vitess/go/bson"
+	"github.com/youtube/vitess/go/bytes2"
+)
+
+// MarshalBson bson-encodes BlpStatus.
+func (blpStatus *BlpStatus) MarshalBson(buf *bytes2.ChunkedWriter, key string) {
+	bson.EncodeOptionalPrefix(buf, bson.Object, key)
+	lenWriter := bson.NewLenWriter(buf)
+
+	bson.EncodeUint32(buf, "Uid", blpStatus.Uid)
+	bson.EncodeString(buf, "Keyspace", blpStatus.Keyspace)
+	bson.EncodeString(buf, "Shard", blpStatus.Shard)
+	bson.EncodeString(buf, "State", blpStatus.State)
+	blpStatus.Position.MarshalBson(buf, "Position")
+	blpStatus.StopPosition.MarshalBson(buf, "StopPosition")
+	bson.EncodeInt64(buf, "SecondsBehindMaster", blpStatus.SecondsBehindMaster)
+	bson.EncodeString(buf, "SourceTablet", blpStatus.SourceTablet)
+	bson.EncodeString(buf, "LastError", blpStatus.LastError)
+
+	lenWriter.Close()
+}
+
+// UnmarshalBson bson-decodes into BlpStatus.
+func (blpStatus *BlpStatus) UnmarshalBson(buf *bytes.Buffer, kind byte) {
+	switch kind {
+	case bson.EOO, bson.Object:
+		// valid
+	case bson.Null:
+		return
+	default:
+		panic(bson.NewBsonError("unexpected kind %v for BlpStatus", kind))
+	}
+	bson.Next(buf, 4)
+
+	for kind := bson.NextByte(buf); kind != bson.EOO; kind = bson.NextByte(buf) {
+		switch bson.ReadCString(buf) {
+		case "Uid":
+			blpStatus.Uid = bson.DecodeUint32(buf, kind)
+		case "Keyspace":
+			blpStatus.Keyspace = bson.DecodeString(buf, kind)
+		case "Shard":
+			blpStatus.Shard = bson.DecodeString(buf, kind)
+		case "State":
+			blpStatus.State = bson.DecodeString(buf, kind)
+		case "Position":
+			blpStatus.Position.UnmarshalBson(buf, kind)
+		case "StopPosition":
+			blpStatus.StopPosition.UnmarshalBson(buf, kind)
+		case "SecondsBehindMaster":
+			blpStatus.SecondsBehindMaster = bson.DecodeInt64(buf, kind)
+		case "SourceTablet":
+			blpStatus.SourceTablet = bson.DecodeString(buf, kind)
+		case "LastError":
+			blpStatus.LastError = bson.DecodeString(buf, kind)
+		default:
+			bson.Skip(buf, kind)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright 2012, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package proto
+
+// DO NOT EDIT.
+// FILE GENERATED BY BSONGEN.
+
+import (
+	"bytes"
+
+	"github.com/youtube/vitess/go/bson"
+	"github.com/youtube/vitess/go/bytes2"
+)
+
+// MarshalBson bson-encodes BlpStatusList.
+func (blpStatusList *BlpStatusList) MarshalBson(buf *bytes2.ChunkedWriter, key string) {
+	bson.EncodeOptionalPrefix(buf, bson.Object, key)
+	lenWriter := bson.NewLenWriter(buf)
+
+	bson.EncodeString(buf, "State", blpStatusList.State)
+	// []BlpStatus
+	{
+		bson.EncodePrefix(buf, bson.Array, "Entries")
+		lenWriter := bson.NewLenWriter(buf)
+		for _i, _v1 := range blpStatusList.Entries {
+			_v1.MarshalBson(buf, bson.Itoa(_i))
+		}
+		lenWriter.Close()
+	}
+
+	lenWriter.Close()
+}
+
+// UnmarshalBson bson-decodes into BlpStatusList.
+func (blpStatusList *BlpStatusList) UnmarshalBson(buf *bytes.Buffer, kind byte) {
+	switch kind {
+	case bson.EOO, bson.Object:
+		// valid
+	case bson.Null:
+		return
+	default:
+		panic(bson.NewBsonError("unexpected kind %v for BlpStatusList", kind))
+	}
+	bson.Next(buf, 4)
+
+	for kind := bson.NextByte(buf); kind != bson.EOO; kind = bson.NextByte(buf) {
+		switch bson.ReadCString(buf) {
+		case "State":
+			blpStatusList.State = bson.DecodeString(buf, kind)
+		case "Entries":
+			// []BlpStatus
+			if kind != bson.Null {
+				if kind != bson.Array {
+					panic(bson.NewBsonError("unexpected kind %v for blpStatusList.Entries", kind))
+				}
+				bson.Next(buf, 4)
+				blpStatusList.Entries = make([]BlpStatus, 0, 8)
+				for kind := bson.NextByte(buf); kind != bson.EOO; kind = bson.NextByte(buf) {
+					bson.SkipIndex(buf)
+					var _v1 BlpStatus
+					_v1.UnmarshalBson(buf, kind)
+					blpStatusList.Entries = append(blpStatusList.Entries, _v1)
+				}
+			}
+		default:
+			bson.Skip(buf, kind)
+		}
+	}
+}
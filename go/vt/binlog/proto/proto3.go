@@ -0,0 +1,157 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package proto
+
+import (
+	"fmt"
+
+	mproto "github.com/youtube/vitess/go/mysql/proto"
+	"github.com/youtube/vitess/go/vt/key"
+	myproto "github.com/youtube/vitess/go/vt/mysqlctl/proto"
+
+	pb "github.com/youtube/vitess/go/vt/proto/binlogdata"
+)
+
+// This file contains the conversions between the types of this
+// package and the proto3 ones, used by the gRPC update stream.
+
+// CharsetToProto converts a Charset to its proto3 version.
+func CharsetToProto(c *mproto.Charset) *pb.Charset {
+	if c == nil {
+		return nil
+	}
+	return &pb.Charset{
+		Client: int32(c.Client),
+		Conn:   int32(c.Conn),
+		Server: int32(c.Server),
+	}
+}
+
+// ProtoToCharset converts a proto3 Charset.
+func ProtoToCharset(c *pb.Charset) *mproto.Charset {
+	if c == nil {
+		return nil
+	}
+	return &mproto.Charset{
+		Client: int(c.Client),
+		Conn:   int(c.Conn),
+		Server: int(c.Server),
+	}
+}
+
+// BinlogTransactionToProto converts a BinlogTransaction to its proto3
+// version.
+func BinlogTransactionToProto(bt *BinlogTransaction) *pb.BinlogTransaction {
+	result := &pb.BinlogTransaction{
+		Timestamp: bt.Timestamp,
+		Gtid:      myproto.EncodeGTID(bt.GTIDField.Value),
+	}
+	if len(bt.Statements) > 0 {
+		result.Statements = make([]*pb.BinlogTransaction_Statement, len(bt.Statements))
+		for i, s := range bt.Statements {
+			result.Statements[i] = &pb.BinlogTransaction_Statement{
+				Category: pb.BinlogTransaction_Statement_Category(s.Category),
+				Charset:  CharsetToProto(s.Charset),
+				Sql:      s.Sql,
+			}
+		}
+	}
+	return result
+}
+
+// ProtoToBinlogTransaction converts a proto3 BinlogTransaction.
+func ProtoToBinlogTransaction(bt *pb.BinlogTransaction) (*BinlogTransaction, error) {
+	gtid, err := myproto.DecodeGTID(bt.Gtid)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode the GTID of the transaction: %v", err)
+	}
+	result := &BinlogTransaction{
+		Timestamp: bt.Timestamp,
+		GTIDField: myproto.GTIDField{Value: gtid},
+	}
+	if len(bt.Statements) > 0 {
+		result.Statements = make([]Statement, len(bt.Statements))
+		for i, s := range bt.Statements {
+			result.Statements[i] = Statement{
+				Category: int(s.Category),
+				Charset:  ProtoToCharset(s.Charset),
+				Sql:      s.Sql,
+			}
+		}
+	}
+	return result, nil
+}
+
+var keyspaceIdTypes = map[key.KeyspaceIdType]pb.KeyspaceIdType{
+	key.KIT_UNSET:  pb.KeyspaceIdType_UNSET,
+	key.KIT_UINT64: pb.KeyspaceIdType_UINT64,
+	key.KIT_BYTES:  pb.KeyspaceIdType_BYTES,
+}
+
+// KeyRangeRequestToProto converts a KeyRangeRequest to its proto3
+// version.
+func KeyRangeRequestToProto(req *KeyRangeRequest) (*pb.StreamKeyRangeRequest, error) {
+	kit, ok := keyspaceIdTypes[req.KeyspaceIdType]
+	if !ok {
+		return nil, fmt.Errorf("unknown keyspace id type %v", req.KeyspaceIdType)
+	}
+	return &pb.StreamKeyRangeRequest{
+		Position:       myproto.EncodeReplicationPosition(req.Position),
+		KeyspaceIdType: kit,
+		KeyRange: &pb.KeyRange{
+			Start: []byte(req.KeyRange.Start),
+			End:   []byte(req.KeyRange.End),
+		},
+		Charset:            CharsetToProto(req.Charset),
+		ShardingColumnName: req.ShardingColumnName,
+	}, nil
+}
+
+// ProtoToKeyRangeRequest converts a proto3 StreamKeyRangeRequest.
+func ProtoToKeyRangeRequest(req *pb.StreamKeyRangeRequest) (*KeyRangeRequest, error) {
+	pos, err := myproto.DecodeReplicationPosition(req.Position)
+	if err != nil {
+		return nil, err
+	}
+	result := &KeyRangeRequest{
+		Position:           pos,
+		Charset:            ProtoToCharset(req.Charset),
+		ShardingColumnName: req.ShardingColumnName,
+	}
+	for kit, pkit := range keyspaceIdTypes {
+		if pkit == req.KeyspaceIdType {
+			result.KeyspaceIdType = kit
+		}
+	}
+	if kr := req.GetKeyRange(); kr != nil {
+		result.KeyRange = key.KeyRange{
+			Start: key.KeyspaceId(kr.Start),
+			End:   key.KeyspaceId(kr.End),
+		}
+	}
+	return result, nil
+}
+
+// TablesRequestToProto converts a TablesRequest to its proto3 version.
+func TablesRequestToProto(req *TablesRequest) *pb.StreamTablesRequest {
+	return &pb.StreamTablesRequest{
+		Position: myproto.EncodeReplicationPosition(req.Position),
+		Tables:   req.Tables,
+		Charset:  CharsetToProto(req.Charset),
+	}
+}
+
+// ProtoToTablesRequest converts a proto3 StreamTablesRequest.
+func ProtoToTablesRequest(req *pb.StreamTablesRequest) (*TablesRequest, error) {
+	pos, err := myproto.DecodeReplicationPosition(req.Position)
+	if err != nil {
+		return nil, err
+	}
+	return &TablesRequest{
+		Position: pos,
+		Tables:   req.Tables,
+		Charset:  ProtoToCharset(req.Charset),
+	}, nil
+}
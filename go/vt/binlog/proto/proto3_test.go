@@ -0,0 +1,97 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package proto
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	mproto "github.com/youtube/vitess/go/mysql/proto"
+	"github.com/youtube/vitess/go/vt/key"
+	myproto "github.com/youtube/vitess/go/vt/mysqlctl/proto"
+
+	pb "github.com/youtube/vitess/go/vt/proto/binlogdata"
+)
+
+// roundTrip marshals in and unmarshals it into out, as gRPC does.
+func roundTrip(t *testing.T, in, out proto.Message) {
+	data, err := proto.Marshal(in)
+	if err != nil {
+		t.Fatalf("proto.Marshal(%v) failed: %v", in, err)
+	}
+	if err := proto.Unmarshal(data, out); err != nil {
+		t.Fatalf("proto.Unmarshal failed: %v", err)
+	}
+}
+
+func TestBinlogTransactionProto(t *testing.T) {
+	testcases := []*BinlogTransaction{
+		{
+			Statements: []Statement{
+				{Category: BL_SET, Sql: []byte("SET TIMESTAMP=1407805592")},
+				{Category: BL_DML, Charset: &mproto.Charset{Client: 33, Conn: 33, Server: 8}, Sql: []byte("insert into t values (1) /* _stream t (id ) (1 ); */")},
+			},
+			Timestamp: 1407805592,
+			GTIDField: myproto.GTIDField{Value: myproto.MariadbGTID{Domain: 0, Server: 41983, Sequence: 1}},
+		},
+		{},
+	}
+	for _, bt := range testcases {
+		var pbt pb.BinlogTransaction
+		roundTrip(t, BinlogTransactionToProto(bt), &pbt)
+		got, err := ProtoToBinlogTransaction(&pbt)
+		if err != nil {
+			t.Fatalf("ProtoToBinlogTransaction failed: %v", err)
+		}
+		if !reflect.DeepEqual(got, bt) {
+			t.Errorf("round trip of %#v: got %#v", bt, got)
+		}
+	}
+}
+
+func TestRequestsProto(t *testing.T) {
+	pos := myproto.ReplicationPosition{GTIDSet: myproto.MariadbGTID{Domain: 1, Server: 3456, Sequence: 7890}}
+	charset := &mproto.Charset{Client: 12, Conn: 13, Server: 14}
+
+	krr := &KeyRangeRequest{
+		Position:       pos,
+		KeyspaceIdType: key.KIT_UINT64,
+		KeyRange: key.KeyRange{
+			Start: key.Uint64Key(0x7000000000000000).KeyspaceId(),
+			End:   key.Uint64Key(0x9000000000000000).KeyspaceId(),
+		},
+		Charset:            charset,
+		ShardingColumnName: "keyspace_id",
+	}
+	pkrr, err := KeyRangeRequestToProto(krr)
+	if err != nil {
+		t.Fatalf("KeyRangeRequestToProto failed: %v", err)
+	}
+	var gotpkrr pb.StreamKeyRangeRequest
+	roundTrip(t, pkrr, &gotpkrr)
+	gotkrr, err := ProtoToKeyRangeRequest(&gotpkrr)
+	if err != nil {
+		t.Fatalf("ProtoToKeyRangeRequest failed: %v", err)
+	}
+	if !reflect.DeepEqual(gotkrr, krr) {
+		t.Errorf("round trip of %#v: got %#v", krr, gotkrr)
+	}
+
+	tr := &TablesRequest{
+		Position: pos,
+		Tables:   []string{"table1", "table2"},
+		Charset:  charset,
+	}
+	var gotptr pb.StreamTablesRequest
+	roundTrip(t, TablesRequestToProto(tr), &gotptr)
+	gottr, err := ProtoToTablesRequest(&gotptr)
+	if err != nil {
+		t.Fatalf("ProtoToTablesRequest failed: %v", err)
+	}
+	if !reflect.DeepEqual(gottr, tr) {
+		t.Errorf("round trip of %#v: got %#v", tr, gottr)
+	}
+}
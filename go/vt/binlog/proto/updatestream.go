@@ -5,11 +5,38 @@
 package proto
 
 import (
+	"errors"
+	"strings"
+
 	mproto "github.com/youtube/vitess/go/mysql/proto"
 	"github.com/youtube/vitess/go/vt/key"
 	myproto "github.com/youtube/vitess/go/vt/mysqlctl/proto"
 )
 
+// ErrPositionPurged is returned by the update stream when the binlogs
+// that contain the requested position are gone, e.g. purged. The
+// client has to bootstrap again, and stream from a newer position.
+var ErrPositionPurged = errors.New("the binlogs that contain the requested position were purged")
+
+// IsPositionPurged returns true if err is, or wraps, ErrPositionPurged.
+// It works on the errors that went through an RPC, which only keep
+// their message.
+func IsPositionPurged(err error) bool {
+	return err != nil && strings.Contains(err.Error(), ErrPositionPurged.Error())
+}
+
+// ErrPositionUnsupported is returned by the update stream when the
+// requested position is not of the flavor of its mysqld, e.g. a MySQL
+// 5.6 GTID set sent to a MariaDB server, or a file position, which
+// can't be streamed from.
+var ErrPositionUnsupported = errors.New("the requested position is not supported by the flavor of the server")
+
+// IsPositionUnsupported returns true if err is, or wraps,
+// ErrPositionUnsupported, even after it went through an RPC.
+func IsPositionUnsupported(err error) bool {
+	return err != nil && strings.Contains(err.Error(), ErrPositionUnsupported.Error())
+}
+
 // UpdateStreamRequest is used to make a request for ServeUpdateStream.
 type UpdateStreamRequest struct {
 	Position myproto.ReplicationPosition
@@ -21,6 +48,11 @@ type KeyRangeRequest struct {
 	KeyspaceIdType key.KeyspaceIdType
 	KeyRange       key.KeyRange
 	Charset        *mproto.Charset
+
+	// ShardingColumnName is the sharding column of the keyspace. It
+	// is used to compute the keyspace id of the rows in row based
+	// replication, whose statements have no keyspace_id comment.
+	ShardingColumnName string
 }
 
 // TablesRequest is used to make a request for StreamTables.
@@ -0,0 +1,280 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package binlog
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"flag"
+	"fmt"
+
+	mproto "github.com/youtube/vitess/go/mysql/proto"
+	"github.com/youtube/vitess/go/sqltypes"
+	"github.com/youtube/vitess/go/vt/binlog/proto"
+	"github.com/youtube/vitess/go/vt/key"
+	"github.com/youtube/vitess/go/vt/rowrouter"
+)
+
+// This file contains the row based replication support of the
+// BinlogStreamer: the rows events are turned into the statements the
+// tablet would have written, with their _stream comment, and an EMD
+// comment with the keyspace id of the row computed from the sharding
+// column, so the filters work the same on both formats.
+
+var rbrTablesWithoutShardingColumn = flag.String("binlog_rbr_tables_without_sharding_column", rbrSkip, "what a keyrange stream does with the rows of the tables that don't have the sharding column in row based replication: skip, or replicate (to all the shards)")
+
+const (
+	rbrSkip      = "skip"
+	rbrReplicate = "replicate"
+)
+
+// ALL_SHARDS_COMMENT marks the statements that go to every keyrange.
+var ALL_SHARDS_COMMENT = []byte("/* EMD all_shards */")
+
+// rbrTable is what the streamer needs to know of a table to write the
+// statements of its rows, that the rows events don't have.
+type rbrTable struct {
+	columns  []string
+	unsigned []bool
+	// pkColumns are the indexes of the primary key columns in columns.
+	pkColumns []int
+}
+
+// loadRBRTable reads the schema of a table from mysqld.
+func (bls *BinlogStreamer) loadRBRTable(table string) (*rbrTable, error) {
+	qr, err := bls.mysqld.FetchSuperQuery(fmt.Sprintf("SELECT * FROM `%v`.`%v` WHERE 1=0", bls.dbname, table))
+	if err != nil {
+		return nil, err
+	}
+	pkNames, err := bls.mysqld.GetPrimaryKeyColumns(bls.dbname, table)
+	if err != nil {
+		return nil, err
+	}
+	rt := &rbrTable{
+		columns:  make([]string, len(qr.Fields)),
+		unsigned: make([]bool, len(qr.Fields)),
+	}
+	for i, field := range qr.Fields {
+		rt.columns[i] = field.Name
+		rt.unsigned[i] = field.Flags&mproto.VT_UNSIGNED_FLAG != 0
+	}
+	for _, name := range pkNames {
+		index := rt.columnIndex(name)
+		if index == -1 {
+			return nil, fmt.Errorf("primary key column %v is not a column of table %v", name, table)
+		}
+		rt.pkColumns = append(rt.pkColumns, index)
+	}
+	return rt, nil
+}
+
+// columnIndex returns the index of a column, or -1.
+func (rt *rbrTable) columnIndex(name string) int {
+	for i, column := range rt.columns {
+		if column == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// getRBRTable returns the cached schema of a table, and loads it if
+// needed. The cache is cleared on each DDL.
+func (bls *BinlogStreamer) getRBRTable(table string) (*rbrTable, error) {
+	if rt, ok := bls.rbrTables[table]; ok {
+		return rt, nil
+	}
+	rt, err := bls.loadTable(table)
+	if err != nil {
+		return nil, fmt.Errorf("can't load the schema of table %v: %v", table, err)
+	}
+	bls.rbrTables[table] = rt
+	return rt, nil
+}
+
+// rowsStatements returns the statements of a rows event.
+func (bls *BinlogStreamer) rowsStatements(ev proto.BinlogEvent, format proto.BinlogFormat, tm *proto.TableMap) ([]proto.Statement, error) {
+	rt, err := bls.getRBRTable(tm.Name)
+	if err != nil {
+		return nil, err
+	}
+	if len(rt.columns) != len(tm.Types) {
+		return nil, fmt.Errorf("table %v has %v columns, but its rows event has %v", tm.Name, len(rt.columns), len(tm.Types))
+	}
+	tm.Unsigned = rt.unsigned
+	rows, err := ev.Rows(format, tm)
+	if err != nil {
+		return nil, err
+	}
+
+	shardingColumn := -1
+	if bls.shardingColumn != "" {
+		shardingColumn = rt.columnIndex(bls.shardingColumn)
+		if shardingColumn == -1 && *rbrTablesWithoutShardingColumn != rbrReplicate {
+			return nil, nil
+		}
+	}
+
+	statements := make([]proto.Statement, 0, len(rows.Rows))
+	for _, row := range rows.Rows {
+		buf := bytes.NewBuffer(make([]byte, 0, 256))
+		switch {
+		case ev.IsWriteRows():
+			writeInsert(buf, tm.Name, rt, row.After)
+		case ev.IsUpdateRows():
+			writeUpdate(buf, tm.Name, rt, row.Before, row.After)
+		case ev.IsDeleteRows():
+			writeDelete(buf, tm.Name, rt, row.Before)
+		}
+
+		if bls.shardingColumn != "" {
+			if shardingColumn == -1 {
+				buf.WriteString(" ")
+				buf.Write(ALL_SHARDS_COMMENT)
+			} else {
+				if err := writeKeyspaceIdComment(buf, bls.keyspaceIdType, bls.shardingColumn, row, shardingColumn); err != nil {
+					return nil, fmt.Errorf("table %v: %v", tm.Name, err)
+				}
+			}
+		}
+		writeStreamComment(buf, tm.Name, rt, row)
+		statements = append(statements, proto.Statement{
+			Category: proto.BL_DML,
+			Sql:      buf.Bytes(),
+		})
+	}
+	return statements, nil
+}
+
+func writeInsert(buf *bytes.Buffer, table string, rt *rbrTable, values []sqltypes.Value) {
+	fmt.Fprintf(buf, "INSERT INTO `%v` (", table)
+	for i, column := range rt.columns {
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		fmt.Fprintf(buf, "`%v`", column)
+	}
+	buf.WriteString(") VALUES (")
+	for i, value := range values {
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		value.EncodeSql(buf)
+	}
+	buf.WriteString(")")
+}
+
+func writeUpdate(buf *bytes.Buffer, table string, rt *rbrTable, before, after []sqltypes.Value) {
+	fmt.Fprintf(buf, "UPDATE `%v` SET ", table)
+	for i, column := range rt.columns {
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		fmt.Fprintf(buf, "`%v` = ", column)
+		after[i].EncodeSql(buf)
+	}
+	writeWhere(buf, rt, before)
+}
+
+func writeDelete(buf *bytes.Buffer, table string, rt *rbrTable, before []sqltypes.Value) {
+	fmt.Fprintf(buf, "DELETE FROM `%v`", table)
+	writeWhere(buf, rt, before)
+}
+
+// writeWhere writes the clause that matches a row: on its primary key,
+// or on all its columns if the table has none.
+func writeWhere(buf *bytes.Buffer, rt *rbrTable, values []sqltypes.Value) {
+	buf.WriteString(" WHERE ")
+	columns := rt.pkColumns
+	if len(columns) == 0 {
+		columns = make([]int, len(rt.columns))
+		for i := range columns {
+			columns[i] = i
+		}
+	}
+	for i, column := range columns {
+		if i > 0 {
+			buf.WriteString(" AND ")
+		}
+		if values[column].IsNull() {
+			fmt.Fprintf(buf, "`%v` IS NULL", rt.columns[column])
+			continue
+		}
+		fmt.Fprintf(buf, "`%v` = ", rt.columns[column])
+		values[column].EncodeSql(buf)
+	}
+}
+
+// writeKeyspaceIdComment writes the EMD comment of a row. An update
+// can't change the keyspace id, since the row would move to another
+// shard, that doesn't have it.
+func writeKeyspaceIdComment(buf *bytes.Buffer, kit key.KeyspaceIdType, name string, row proto.Row, column int) error {
+	values := row.After
+	if values == nil {
+		values = row.Before
+	}
+	value := values[column]
+	if value.IsNull() {
+		return fmt.Errorf("sharding column %v is NULL", name)
+	}
+	if row.Before != nil && row.After != nil && !bytes.Equal(row.Before[column].Raw(), row.After[column].Raw()) {
+		return fmt.Errorf("update changes sharding column %v from %v to %v", name, row.Before[column], row.After[column])
+	}
+	kid, err := rowrouter.KeyspaceId(kit, value)
+	if err != nil {
+		return fmt.Errorf("sharding column %v: %v", name, err)
+	}
+	buf.WriteString(" ")
+	buf.Write(KEYSPACE_ID_COMMENT)
+	if kit == key.KIT_BYTES {
+		buf.WriteString(base64.StdEncoding.EncodeToString([]byte(kid)))
+	} else {
+		fmt.Fprintf(buf, "%v", binary.BigEndian.Uint64([]byte(kid)))
+	}
+	buf.WriteString(" ")
+	buf.Write(COMMENT_END)
+	return nil
+}
+
+// writeStreamComment writes the _stream comment the tablet would have
+// written, with the primary key of the row, and its new one if an
+// update changes it. The tables without primary key don't get one.
+func writeStreamComment(buf *bytes.Buffer, table string, rt *rbrTable, row proto.Row) {
+	if len(rt.pkColumns) == 0 {
+		return
+	}
+	fmt.Fprintf(buf, " /* _stream %s (", table)
+	for _, column := range rt.pkColumns {
+		buf.WriteString(rt.columns[column])
+		buf.WriteString(" ")
+	}
+	buf.WriteString(")")
+	var pkValueList [][]sqltypes.Value
+	if row.Before != nil {
+		pkValueList = append(pkValueList, row.Before)
+	}
+	if row.After != nil && (row.Before == nil || !samePK(rt, row.Before, row.After)) {
+		pkValueList = append(pkValueList, row.After)
+	}
+	for _, values := range pkValueList {
+		buf.WriteString(" (")
+		for _, column := range rt.pkColumns {
+			values[column].EncodeAscii(buf)
+			buf.WriteString(" ")
+		}
+		buf.WriteString(")")
+	}
+	buf.WriteString("; */")
+}
+
+func samePK(rt *rbrTable, before, after []sqltypes.Value) bool {
+	for _, column := range rt.pkColumns {
+		if before[column].IsNull() != after[column].IsNull() || !bytes.Equal(before[column].Raw(), after[column].Raw()) {
+			return false
+		}
+	}
+	return true
+}
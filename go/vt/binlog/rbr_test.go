@@ -0,0 +1,285 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package binlog
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/youtube/vitess/go/sqltypes"
+	"github.com/youtube/vitess/go/sync2"
+	"github.com/youtube/vitess/go/vt/binlog/proto"
+	"github.com/youtube/vitess/go/vt/key"
+	myproto "github.com/youtube/vitess/go/vt/mysqlctl/proto"
+)
+
+type tableMapEvent struct {
+	fakeEvent
+	tableID uint64
+	tm      proto.TableMap
+}
+
+func (tableMapEvent) IsTableMap() bool                     { return true }
+func (ev tableMapEvent) TableID(proto.BinlogFormat) uint64 { return ev.tableID }
+func (ev tableMapEvent) TableMap(proto.BinlogFormat) (*proto.TableMap, error) {
+	tm := ev.tm
+	return &tm, nil
+}
+func (ev tableMapEvent) StripChecksum(proto.BinlogFormat) (proto.BinlogEvent, []byte, error) {
+	return ev, nil, nil
+}
+
+type rowsEvent struct {
+	fakeEvent
+	tableID uint64
+	// kind is "write", "update" or "delete"
+	kind string
+	rows proto.Rows
+}
+
+func (ev rowsEvent) IsWriteRows() bool                 { return ev.kind == "write" }
+func (ev rowsEvent) IsUpdateRows() bool                { return ev.kind == "update" }
+func (ev rowsEvent) IsDeleteRows() bool                { return ev.kind == "delete" }
+func (ev rowsEvent) TableID(proto.BinlogFormat) uint64 { return ev.tableID }
+func (ev rowsEvent) Rows(proto.BinlogFormat, *proto.TableMap) (proto.Rows, error) {
+	return ev.rows, nil
+}
+func (ev rowsEvent) StripChecksum(proto.BinlogFormat) (proto.BinlogEvent, []byte, error) {
+	return ev, nil, nil
+}
+
+func rbrValues(values ...interface{}) []sqltypes.Value {
+	result := make([]sqltypes.Value, len(values))
+	for i, v := range values {
+		switch v := v.(type) {
+		case int:
+			result[i] = sqltypes.MakeNumeric([]byte(fmt.Sprintf("%v", v)))
+		case string:
+			result[i] = sqltypes.MakeString([]byte(v))
+		}
+	}
+	return result
+}
+
+var rbrTestTables = map[string]*rbrTable{
+	"vt_a": {
+		columns:   []string{"eid", "id", "name"},
+		unsigned:  []bool{true, false, false},
+		pkColumns: []int{0, 1},
+	},
+	"vt_nopk": {
+		columns:  []string{"name", "value"},
+		unsigned: []bool{false, false},
+	},
+}
+
+func newRBRTestStreamer(sendTransaction sendTransactionFunc) *BinlogStreamer {
+	bls := NewBinlogStreamer("vt_test_keyspace", nil, nil, myproto.ReplicationPosition{}, sendTransaction)
+	bls.loadTable = func(table string) (*rbrTable, error) {
+		if rt, ok := rbrTestTables[table]; ok {
+			return rt, nil
+		}
+		return nil, fmt.Errorf("no table %v", table)
+	}
+	return bls
+}
+
+func TestBinlogStreamerParseEventsRBR(t *testing.T) {
+	input := []proto.BinlogEvent{
+		rotateEvent{},
+		formatEvent{},
+		queryEvent{query: proto.Query{Database: "vt_test_keyspace", Sql: []byte("BEGIN")}},
+		tableMapEvent{tableID: 42, tm: proto.TableMap{Database: "vt_test_keyspace", Name: "vt_a", Types: make([]byte, 3)}},
+		rowsEvent{tableID: 42, kind: "write", rows: proto.Rows{Rows: []proto.Row{
+			{After: rbrValues(1, 2, "abc")},
+		}}},
+		rowsEvent{tableID: 42, kind: "update", rows: proto.Rows{Rows: []proto.Row{
+			{Before: rbrValues(1, 2, "abc"), After: rbrValues(1, 3, "def")},
+		}}},
+		rowsEvent{tableID: 42, kind: "delete", rows: proto.Rows{Rows: []proto.Row{
+			{Before: rbrValues(1, 3, nil)},
+		}}},
+		tableMapEvent{tableID: 43, tm: proto.TableMap{Database: "other", Name: "vt_b", Types: make([]byte, 1)}},
+		rowsEvent{tableID: 43, kind: "write", rows: proto.Rows{Rows: []proto.Row{
+			{After: rbrValues(1)},
+		}}},
+		xidEvent{},
+	}
+
+	events := make(chan proto.BinlogEvent)
+
+	want := []proto.BinlogTransaction{
+		proto.BinlogTransaction{
+			Statements: []proto.Statement{
+				proto.Statement{Category: proto.BL_SET, Sql: []byte("SET TIMESTAMP=1407805592")},
+				proto.Statement{Category: proto.BL_DML, Sql: []byte("INSERT INTO `vt_a` (`eid`, `id`, `name`) VALUES (1, 2, 'abc') /* EMD keyspace_id:1 */ /* _stream vt_a (eid id ) (1 2 ); */")},
+				proto.Statement{Category: proto.BL_SET, Sql: []byte("SET TIMESTAMP=1407805592")},
+				proto.Statement{Category: proto.BL_DML, Sql: []byte("UPDATE `vt_a` SET `eid` = 1, `id` = 3, `name` = 'def' WHERE `eid` = 1 AND `id` = 2 /* EMD keyspace_id:1 */ /* _stream vt_a (eid id ) (1 2 ) (1 3 ); */")},
+				proto.Statement{Category: proto.BL_SET, Sql: []byte("SET TIMESTAMP=1407805592")},
+				proto.Statement{Category: proto.BL_DML, Sql: []byte("DELETE FROM `vt_a` WHERE `eid` = 1 AND `id` = 3 /* EMD keyspace_id:1 */ /* _stream vt_a (eid id ) (1 3 ); */")},
+			},
+			Timestamp: 1407805592,
+			GTIDField: myproto.GTIDField{
+				Value: myproto.MariadbGTID{Domain: 0, Server: 62344, Sequence: 0x0d}},
+		},
+	}
+	var got []proto.BinlogTransaction
+	sendTransaction := func(trans *proto.BinlogTransaction) error {
+		got = append(got, *trans)
+		return nil
+	}
+	bls := newRBRTestStreamer(sendTransaction)
+	bls.keyspaceIdType = key.KIT_UINT64
+	bls.shardingColumn = "eid"
+
+	go sendTestEvents(events, input)
+	svm := &sync2.ServiceManager{}
+	svm.Go(func(ctx *sync2.ServiceContext) error {
+		_, err := bls.parseEvents(ctx, events)
+		return err
+	})
+	if err := svm.Join(); err != ErrServerEOF {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("binlogConnStreamer.parseEvents(): got %v, want %v", got, want)
+	}
+}
+
+func TestBinlogStreamerParseEventsRBRErrors(t *testing.T) {
+	vtA := tableMapEvent{tableID: 42, tm: proto.TableMap{Database: "vt_test_keyspace", Name: "vt_a", Types: make([]byte, 3)}}
+	testcases := []struct {
+		events []proto.BinlogEvent
+		want   string
+	}{
+		{
+			[]proto.BinlogEvent{
+				rowsEvent{tableID: 42, kind: "write", rows: proto.Rows{Rows: []proto.Row{{After: rbrValues(1, 2, "abc")}}}},
+			},
+			"unknown table id 42",
+		},
+		{
+			[]proto.BinlogEvent{
+				vtA,
+				rowsEvent{tableID: 42, kind: "update", rows: proto.Rows{Rows: []proto.Row{{Before: rbrValues(1, 2, "abc"), After: rbrValues(2, 2, "abc")}}}},
+			},
+			"update changes sharding column eid",
+		},
+		{
+			[]proto.BinlogEvent{
+				vtA,
+				rowsEvent{tableID: 42, kind: "write", rows: proto.Rows{Rows: []proto.Row{{After: rbrValues(nil, 2, "abc")}}}},
+			},
+			"sharding column eid is NULL",
+		},
+		{
+			[]proto.BinlogEvent{
+				tableMapEvent{tableID: 42, tm: proto.TableMap{Database: "vt_test_keyspace", Name: "vt_a", Types: make([]byte, 2)}},
+				rowsEvent{tableID: 42, kind: "write", rows: proto.Rows{Rows: []proto.Row{{After: rbrValues(1, 2)}}}},
+			},
+			"table vt_a has 3 columns, but its rows event has 2",
+		},
+		{
+			[]proto.BinlogEvent{
+				tableMapEvent{tableID: 42, tm: proto.TableMap{Database: "vt_test_keyspace", Name: "vt_unknown", Types: make([]byte, 1)}},
+				rowsEvent{tableID: 42, kind: "write", rows: proto.Rows{Rows: []proto.Row{{After: rbrValues(1)}}}},
+			},
+			"can't load the schema of table vt_unknown",
+		},
+	}
+	for _, tcase := range testcases {
+		input := append([]proto.BinlogEvent{
+			rotateEvent{},
+			formatEvent{},
+			queryEvent{query: proto.Query{Database: "vt_test_keyspace", Sql: []byte("BEGIN")}},
+		}, tcase.events...)
+		input = append(input, xidEvent{})
+		events := make(chan proto.BinlogEvent)
+		sendTransaction := func(trans *proto.BinlogTransaction) error {
+			t.Errorf("a transaction was sent for %v: %v", tcase.want, trans)
+			return nil
+		}
+		bls := newRBRTestStreamer(sendTransaction)
+		bls.keyspaceIdType = key.KIT_UINT64
+		bls.shardingColumn = "eid"
+
+		go sendTestEvents(events, input)
+		svm := &sync2.ServiceManager{}
+		svm.Go(func(ctx *sync2.ServiceContext) error {
+			_, err := bls.parseEvents(ctx, events)
+			return err
+		})
+		if err := svm.Join(); err == nil || !strings.Contains(err.Error(), tcase.want) {
+			t.Errorf("parseEvents() = %v, want error containing %q", err, tcase.want)
+		}
+		// drain the events left after the error
+		for range events {
+		}
+	}
+}
+
+func TestRowsStatements(t *testing.T) {
+	defer func(policy string) { *rbrTablesWithoutShardingColumn = policy }(*rbrTablesWithoutShardingColumn)
+
+	bls := newRBRTestStreamer(nil)
+	nopk := &proto.TableMap{Database: "vt_test_keyspace", Name: "vt_nopk", Types: make([]byte, 2)}
+	ev := rowsEvent{kind: "delete", rows: proto.Rows{Rows: []proto.Row{
+		{Before: rbrValues("n", nil)},
+	}}}
+
+	// without sharding column, it's just the statement
+	statements, err := bls.rowsStatements(ev, proto.BinlogFormat{}, nopk)
+	if err != nil {
+		t.Fatalf("rowsStatements failed: %v", err)
+	}
+	want := "DELETE FROM `vt_nopk` WHERE `name` = 'n' AND `value` IS NULL"
+	if len(statements) != 1 || string(statements[0].Sql) != want {
+		t.Errorf("rowsStatements() = %v, want %v", statements, want)
+	}
+	if !reflect.DeepEqual(nopk.Unsigned, []bool{false, false}) {
+		t.Errorf("the unsigned columns of the table map were not set: %v", nopk.Unsigned)
+	}
+
+	// the tables without the sharding column are skipped, or
+	// replicated to all shards
+	bls.keyspaceIdType = key.KIT_BYTES
+	for _, policy := range []string{rbrSkip, rbrReplicate} {
+		*rbrTablesWithoutShardingColumn = policy
+		bls.shardingColumn = "keyspace_id"
+		statements, err := bls.rowsStatements(ev, proto.BinlogFormat{}, nopk)
+		if err != nil {
+			t.Fatalf("rowsStatements failed: %v", err)
+		}
+		switch policy {
+		case rbrSkip:
+			if len(statements) != 0 {
+				t.Errorf("rowsStatements() = %v, want nothing", statements)
+			}
+		case rbrReplicate:
+			want := "DELETE FROM `vt_nopk` WHERE `name` = 'n' AND `value` IS NULL /* EMD all_shards */"
+			if len(statements) != 1 || string(statements[0].Sql) != want {
+				t.Errorf("rowsStatements() = %v, want %v", statements, want)
+			}
+		}
+	}
+
+	// the keyspace ids of KIT_BYTES are in base64
+	bls.shardingColumn = "name"
+	statements, err = bls.rowsStatements(ev, proto.BinlogFormat{}, nopk)
+	if err != nil {
+		t.Fatalf("rowsStatements failed: %v", err)
+	}
+	want = "DELETE FROM `vt_nopk` WHERE `name` = 'n' AND `value` IS NULL /* EMD keyspace_id:bg== */"
+	if len(statements) != 1 || string(statements[0].Sql) != want {
+		t.Errorf("rowsStatements() = %v, want %v", statements, want)
+	}
+	keyspaceId, err := parseKeyspaceIdComment(key.KIT_BYTES, statements[0].Sql)
+	if err != nil || keyspaceId != key.KeyspaceId("n") {
+		t.Errorf("parseKeyspaceIdComment() = %q, %v, want \"n\"", keyspaceId, err)
+	}
+}
@@ -6,6 +6,9 @@ package binlog
 
 import (
 	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
 
 	log "github.com/golang/glog"
 	"github.com/youtube/vitess/go/vt/binlog/proto"
@@ -13,10 +16,26 @@ import (
 
 var STREAM_COMMENT = []byte("/* _stream ")
 
+// The regexps that find the tables a DML writes to, when it has no
+// _stream comment, e.g. because the tablet passed it through. They
+// capture the table references, that can be a list or a join for
+// multi-table statements.
+var (
+	insertTablesRegexp = regexp.MustCompile(`(?is)^\s*(?:insert|replace)\s+(?:(?:low_priority|delayed|high_priority|ignore)\s+)*(?:into\s+)?([^\s(]+)`)
+	updateTablesRegexp = regexp.MustCompile(`(?is)^\s*update\s+(?:(?:low_priority|ignore)\s+)*(.+?)\s+set\s`)
+	deleteTablesRegexp = regexp.MustCompile(`(?is)^\s*delete\s+(?:(?:low_priority|quick|ignore)\s+)*(.*?)\bfrom\s+(.+?)(?:\s+(?:where|order\s+by|limit)\s.*)?$`)
+	usingRegexp        = regexp.MustCompile(`(?i)\susing\s`)
+	tableListRegexp    = regexp.MustCompile(`(?i),|\sjoin\s`)
+)
+
 // TablesFilterFunc returns a function that calls sendReply only if statements
 // in the transaction match the specified tables. The resulting function can be
 // passed into the BinlogStreamer: bls.Stream(file, pos, sendTransaction) ->
 // bls.Stream(file, pos, TablesFilterFunc(sendTransaction))
+//
+// A statement that writes to more than one table cannot be filtered:
+// if it writes to one of tables, the function returns an error rather
+// than replicate only part of it.
 func TablesFilterFunc(tables []string, sendReply sendTransactionFunc) sendTransactionFunc {
 	return func(reply *proto.BinlogTransaction) error {
 		matched := false
@@ -29,27 +48,29 @@ func TablesFilterFunc(tables []string, sendReply sendTransactionFunc) sendTransa
 				log.Warningf("Not forwarding DDL: %s", string(statement.Sql))
 				continue
 			case proto.BL_DML:
-				tableIndex := bytes.LastIndex(statement.Sql, STREAM_COMMENT)
-				if tableIndex == -1 {
+				dmlTables, err := parseDMLTables(statement.Sql)
+				if err != nil {
 					updateStreamErrors.Add("TablesStream", 1)
-					log.Errorf("Error parsing table name: %s", string(statement.Sql))
+					log.Errorf("Error parsing table name: %v: %s", err, string(statement.Sql))
 					continue
 				}
-				tableStart := tableIndex + len(STREAM_COMMENT)
-				tableEnd := bytes.Index(statement.Sql[tableStart:], SPACE)
-				if tableEnd == -1 {
-					updateStreamErrors.Add("TablesStream", 1)
-					log.Errorf("Error parsing table name: %s", string(statement.Sql))
-					continue
-				}
-				tableName := string(statement.Sql[tableStart : tableStart+tableEnd])
-				for _, t := range tables {
-					if t == tableName {
-						filtered = append(filtered, statement)
-						matched = true
+				included := false
+				for _, tableName := range dmlTables {
+					if strInList(tableName, tables) {
+						included = true
 						break
 					}
 				}
+				if !included {
+					continue
+				}
+				if len(dmlTables) > 1 {
+					updateStreamErrors.Add("TablesStream", 1)
+					log.Errorf("Not forwarding a statement on tables %v: %s", dmlTables, string(statement.Sql))
+					return fmt.Errorf("statement on tables %v cannot be filtered by tables, only some of them are streamed: %s", dmlTables, string(statement.Sql))
+				}
+				filtered = append(filtered, statement)
+				matched = true
 			case proto.BL_UNRECOGNIZED:
 				updateStreamErrors.Add("TablesStream", 1)
 				log.Errorf("Error parsing table name: %s", string(statement.Sql))
@@ -64,3 +85,62 @@ func TablesFilterFunc(tables []string, sendReply sendTransactionFunc) sendTransa
 		return sendReply(reply)
 	}
 }
+
+// parseDMLTables returns the tables a DML writes to. They come from
+// its _stream comment, or from the statement itself if it has none,
+// which is counted in tablesFilterFallbacks.
+func parseDMLTables(sql []byte) ([]string, error) {
+	if tableIndex := bytes.LastIndex(sql, STREAM_COMMENT); tableIndex != -1 {
+		tableStart := tableIndex + len(STREAM_COMMENT)
+		if tableEnd := bytes.Index(sql[tableStart:], SPACE); tableEnd != -1 {
+			return []string{string(sql[tableStart : tableStart+tableEnd])}, nil
+		}
+	}
+
+	tablesFilterFallbacks.Add(1)
+	var references string
+	if match := insertTablesRegexp.FindSubmatch(sql); match != nil {
+		references = string(match[1])
+	} else if match := updateTablesRegexp.FindSubmatch(sql); match != nil {
+		references = string(match[1])
+	} else if match := deleteTablesRegexp.FindSubmatch(sql); match != nil {
+		// "delete t1, t2 from ..." and "delete from t1, t2 using ..."
+		// write to the tables before from and using.
+		references = strings.TrimSpace(string(match[1]))
+		if references == "" {
+			references = usingRegexp.Split(string(match[2]), 2)[0]
+		}
+	} else {
+		return nil, fmt.Errorf("no _stream comment, and not a recognized DML")
+	}
+
+	var result []string
+	for _, reference := range tableListRegexp.Split(references, -1) {
+		reference = strings.TrimSpace(reference)
+		if reference == "" {
+			continue
+		}
+		// keep the table of "db.table alias"
+		name := strings.Fields(reference)[0]
+		if dot := strings.LastIndex(name, "."); dot != -1 {
+			name = name[dot+1:]
+		}
+		name = strings.Trim(name, "`")
+		if !strInList(name, result) {
+			result = append(result, name)
+		}
+	}
+	if len(result) == 0 {
+		return nil, fmt.Errorf("no table name found")
+	}
+	return result, nil
+}
+
+func strInList(str string, list []string) bool {
+	for _, s := range list {
+		if s == str {
+			return true
+		}
+	}
+	return false
+}
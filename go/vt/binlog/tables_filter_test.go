@@ -5,6 +5,8 @@
 package binlog
 
 import (
+	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/youtube/vitess/go/vt/binlog/proto"
@@ -116,3 +118,93 @@ func TestTablesFilterMalformed(t *testing.T) {
 		t.Errorf("want %s, got %s", want, got)
 	}
 }
+
+func TestParseDMLTables(t *testing.T) {
+	testcases := []struct {
+		sql      string
+		want     []string
+		fallback bool
+	}{
+		{"insert into t1(id) values (1) /* _stream t1 (id ) (1 ); */", []string{"t1"}, false},
+		{"insert into t1(id) values (1)", []string{"t1"}, true},
+		{"insert ignore into `db`.`t1` (id) values (1)", []string{"t1"}, true},
+		{"replace t1 values (1)", []string{"t1"}, true},
+		{"update t1 set a=1 where id=1", []string{"t1"}, true},
+		{"update low_priority t1 as a set a.b=1", []string{"t1"}, true},
+		{"update t1 join t2 on t1.id=t2.id set t1.a=t2.a", []string{"t1", "t2"}, true},
+		{"update t1, t2 set t1.a=1, t2.a=1", []string{"t1", "t2"}, true},
+		{"delete from t1 where id=1", []string{"t1"}, true},
+		{"delete from t1", []string{"t1"}, true},
+		{"delete t1, t2 from t1 join t2 on t1.id=t2.id", []string{"t1", "t2"}, true},
+		{"delete from t1, t2 using t1 join t2 join t3", []string{"t1", "t2"}, true},
+		{"dml1 /* _stream excluded1*/", nil, true},
+		{"select 1", nil, true},
+	}
+	for _, tcase := range testcases {
+		before := tablesFilterFallbacks.Get()
+		got, _ := parseDMLTables([]byte(tcase.sql))
+		if !reflect.DeepEqual(got, tcase.want) {
+			t.Errorf("parseDMLTables(%q) = %v, want %v", tcase.sql, got, tcase.want)
+		}
+		if fallback := tablesFilterFallbacks.Get() != before; fallback != tcase.fallback {
+			t.Errorf("parseDMLTables(%q) fell back to the regexps: %v, want %v", tcase.sql, fallback, tcase.fallback)
+		}
+	}
+}
+
+func TestTablesFilterFallback(t *testing.T) {
+	input := proto.BinlogTransaction{
+		Statements: []proto.Statement{
+			{
+				Category: proto.BL_SET,
+				Sql:      []byte("set1"),
+			}, {
+				Category: proto.BL_DML,
+				Sql:      []byte("update included1 set a=1 where id=1"),
+			}, {
+				Category: proto.BL_DML,
+				Sql:      []byte("delete from excluded1 where id=1"),
+			},
+		},
+	}
+	var got string
+	f := TablesFilterFunc(testTables, func(reply *proto.BinlogTransaction) error {
+		got = bltToString(reply)
+		return nil
+	})
+	if err := f(&input); err != nil {
+		t.Fatalf("TablesFilterFunc failed: %v", err)
+	}
+	want := `statement: <6, "set1"> statement: <4, "update included1 set a=1 where id=1"> position: "<nil>" `
+	if want != got {
+		t.Errorf("want %s, got %s", want, got)
+	}
+}
+
+func TestTablesFilterMultiTable(t *testing.T) {
+	sent := false
+	f := TablesFilterFunc(testTables, func(reply *proto.BinlogTransaction) error {
+		sent = true
+		return nil
+	})
+
+	// a multi-table statement on other tables is just skipped
+	if err := f(&proto.BinlogTransaction{
+		Statements: []proto.Statement{
+			{Category: proto.BL_DML, Sql: []byte("update excluded1 join excluded2 using (id) set excluded1.a=1")},
+		},
+	}); err != nil || !sent {
+		t.Errorf("multi-table statement on other tables: %v, sent %v", err, sent)
+	}
+
+	// but one that writes to one of the tables can't be half replicated
+	sent = false
+	err := f(&proto.BinlogTransaction{
+		Statements: []proto.Statement{
+			{Category: proto.BL_DML, Sql: []byte("delete included1, excluded1 from included1 join excluded1 using (id)")},
+		},
+	})
+	if err == nil || !strings.Contains(err.Error(), "cannot be filtered by tables") || sent {
+		t.Errorf("multi-table statement on an included table: %v, sent %v", err, sent)
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package updatestreamclient is the client for the applications that
+// follow the row changes of a tablet through its update stream.
+//
+// A client streams from a replication position, usually the one of
+// the last event it processed. If the tablet doesn't have the binlogs
+// of that position anymore, Stream returns proto.ErrPositionPurged,
+// and the client has to bootstrap again from a newer position, e.g.
+// the one of a backup. If the position is not of the flavor of the
+// mysqld of the tablet, e.g. after it was moved to another MySQL
+// version, Stream returns proto.ErrPositionUnsupported.
+package updatestreamclient
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/youtube/vitess/go/rpcplus"
+	"github.com/youtube/vitess/go/rpcwrap/bsonrpc"
+	"github.com/youtube/vitess/go/vt/binlog/proto"
+	myproto "github.com/youtube/vitess/go/vt/mysqlctl/proto"
+)
+
+// Client is a connection to the update stream of a tablet.
+type Client struct {
+	rpcClient *rpcplus.Client
+}
+
+// Dial connects to the update stream of the tablet at addr.
+func Dial(addr string, connTimeout time.Duration) (*Client, error) {
+	rpcClient, err := bsonrpc.DialHTTP("tcp", addr, connTimeout, nil)
+	if err != nil {
+		return nil, fmt.Errorf("cannot dial update stream %v: %v", addr, err)
+	}
+	return &Client{rpcClient: rpcClient}, nil
+}
+
+// Close closes the connection, which ends the stream in progress.
+func (client *Client) Close() {
+	client.rpcClient.Close()
+}
+
+// Stream calls sendEvent with the events of the tablet from position
+// on: one per row change with its table, primary key values and
+// category, and a POS event with the position at the end of each
+// transaction. It returns when the tablet ends the stream, or with the
+// error of sendEvent, after which the client is closed.
+//
+// It returns proto.ErrPositionPurged if the tablet can't stream from
+// position anymore, and proto.ErrPositionUnsupported if it never could.
+func (client *Client) Stream(position myproto.ReplicationPosition, sendEvent func(event *proto.StreamEvent) error) error {
+	events := make(chan *proto.StreamEvent)
+	call := client.rpcClient.StreamGo("UpdateStream.ServeUpdateStream", &proto.UpdateStreamRequest{Position: position}, events)
+	for event := range events {
+		if err := sendEvent(event); err != nil {
+			client.Close()
+			for range events {
+			}
+			return err
+		}
+	}
+	if call.Error != nil {
+		if proto.IsPositionPurged(call.Error) {
+			return proto.ErrPositionPurged
+		}
+		if proto.IsPositionUnsupported(call.Error) {
+			return proto.ErrPositionUnsupported
+		}
+		return fmt.Errorf("update stream failed: %v", call.Error)
+	}
+	return nil
+}
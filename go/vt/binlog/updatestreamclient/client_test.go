@@ -0,0 +1,132 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package updatestreamclient
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/youtube/vitess/go/rpcplus"
+	"github.com/youtube/vitess/go/rpcwrap/bsonrpc"
+	"github.com/youtube/vitess/go/vt/binlog/gorpcbinlogstreamer"
+	"github.com/youtube/vitess/go/vt/binlog/proto"
+	myproto "github.com/youtube/vitess/go/vt/mysqlctl/proto"
+)
+
+var (
+	startPosition  = myproto.ReplicationPosition{GTIDSet: myproto.MariadbGTID{Domain: 0, Server: 1, Sequence: 10}}
+	purgedPosition = myproto.ReplicationPosition{GTIDSet: myproto.MariadbGTID{Domain: 0, Server: 1, Sequence: 1}}
+
+	testEvents = []*proto.StreamEvent{
+		{
+			Category:   "DML",
+			TableName:  "vt_insert_test",
+			PKColNames: []string{"id"},
+			PKValues:   [][]interface{}{{int64(12)}},
+		},
+		{
+			Category:   "POS",
+			PKColNames: []string{},
+			PKValues:   [][]interface{}{},
+			GTIDField: myproto.GTIDField{
+				Value: myproto.MariadbGTID{Domain: 0, Server: 1, Sequence: 11},
+			},
+		},
+	}
+)
+
+// fakeUpdateStream streams testEvents from startPosition, and fails
+// like the binlog streamer from purgedPosition.
+type fakeUpdateStream struct{}
+
+func (fus *fakeUpdateStream) ServeUpdateStream(req *proto.UpdateStreamRequest, sendReply func(reply *proto.StreamEvent) error) error {
+	if req.Position.Equal(purgedPosition) {
+		return fmt.Errorf("stream error @ %v: %v: Could not find first log file name in binary log index file (errno 1236)", req.Position, proto.ErrPositionPurged)
+	}
+	if !req.Position.Equal(startPosition) {
+		return fmt.Errorf("unexpected position %v", req.Position)
+	}
+	for _, event := range testEvents {
+		if err := sendReply(event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (fus *fakeUpdateStream) StreamKeyRange(req *proto.KeyRangeRequest, sendReply func(reply *proto.BinlogTransaction) error) error {
+	return nil
+}
+
+func (fus *fakeUpdateStream) StreamTables(req *proto.TablesRequest, sendReply func(reply *proto.BinlogTransaction) error) error {
+	return nil
+}
+
+func (fus *fakeUpdateStream) HandlePanic(err *error) {
+}
+
+func startServer(t *testing.T) string {
+	listener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("Cannot listen: %v", err)
+	}
+	server := rpcplus.NewServer()
+	server.Register(gorpcbinlogstreamer.New(&fakeUpdateStream{}))
+	handler := http.NewServeMux()
+	bsonrpc.ServeCustomRPC(handler, server, false)
+	go http.Serve(listener, handler)
+	return listener.Addr().String()
+}
+
+func TestStream(t *testing.T) {
+	addr := startServer(t)
+
+	client, err := Dial(addr, 5*time.Second)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	var got []*proto.StreamEvent
+	if err := client.Stream(startPosition, func(event *proto.StreamEvent) error {
+		got = append(got, event)
+		return nil
+	}); err != nil {
+		t.Fatalf("Stream failed: %v", err)
+	}
+	if !reflect.DeepEqual(got, testEvents) {
+		for i := range got {
+			t.Logf("event %v: %#v", i, *got[i])
+		}
+		t.Errorf("Stream got unexpected events")
+	}
+
+	// the error of sendEvent ends the stream
+	errStop := errors.New("stop")
+	count := 0
+	if err := client.Stream(startPosition, func(event *proto.StreamEvent) error {
+		count++
+		return errStop
+	}); err != errStop || count != 1 {
+		t.Errorf("Stream stopped after %v events with %v, want 1 and %v", count, err, errStop)
+	}
+
+	// that closed the client
+	client, err = Dial(addr, 5*time.Second)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer client.Close()
+	err = client.Stream(purgedPosition, func(event *proto.StreamEvent) error {
+		t.Errorf("unexpected event %#v", event)
+		return nil
+	})
+	if err != proto.ErrPositionPurged {
+		t.Errorf("Stream from a purged position: got %v, want %v", err, proto.ErrPositionPurged)
+	}
+}
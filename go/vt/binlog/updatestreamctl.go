@@ -5,8 +5,10 @@
 package binlog
 
 import (
+	"flag"
 	"fmt"
 	"sync"
+	"time"
 
 	log "github.com/golang/glog"
 	"github.com/youtube/vitess/go/stats"
@@ -29,14 +31,21 @@ var usStateNames = map[int64]string{
 	DISABLED: "Disabled",
 }
 
+var enableUpdateStream = flag.Bool("enable_update_stream", true, "serve the update stream when the tablet type runs it, disable to never serve it")
+
 var (
 	streamCount          = stats.NewCounters("UpdateStreamStreamCount")
+	streamTimings        = stats.NewTimings("UpdateStreamStreams")
 	updateStreamErrors   = stats.NewCounters("UpdateStreamErrors")
 	updateStreamEvents   = stats.NewCounters("UpdateStreamEvents")
 	keyrangeStatements   = stats.NewInt("UpdateStreamKeyRangeStatements")
 	keyrangeTransactions = stats.NewInt("UpdateStreamKeyRangeTransactions")
 	tablesStatements     = stats.NewInt("UpdateStreamTablesStatements")
 	tablesTransactions   = stats.NewInt("UpdateStreamTablesTransactions")
+
+	// tablesFilterFallbacks counts the DMLs whose tables were found by
+	// parsing the statement, for lack of a _stream comment.
+	tablesFilterFallbacks = stats.NewInt("UpdateStreamTablesFilterFallbacks")
 )
 
 // UpdateStream is the real implementation of proto.UpdateStream
@@ -155,6 +164,11 @@ func (updateStream *UpdateStream) enable(dbname string, mysqld *mysqlctl.Mysqld)
 		return
 	}
 
+	if !*enableUpdateStream {
+		log.Infof("Update stream service disabled by -enable_update_stream")
+		return
+	}
+
 	if dbname == "" {
 		log.Errorf("Missing db name, cannot enable update stream service")
 		return
@@ -203,6 +217,7 @@ func (updateStream *UpdateStream) ServeUpdateStream(req *proto.UpdateStreamReque
 
 	streamCount.Add("Updates", 1)
 	defer streamCount.Add("Updates", -1)
+	defer streamTimings.Record("Updates", time.Now())
 	log.Infof("ServeUpdateStream starting @ %#v", req.Position)
 
 	evs := NewEventStreamer(updateStream.dbname, updateStream.mysqld, req.Position, func(reply *proto.StreamEvent) error {
@@ -218,7 +233,20 @@ func (updateStream *UpdateStream) ServeUpdateStream(req *proto.UpdateStreamReque
 	svm.Go(evs.Stream)
 	updateStream.streams.Add(svm)
 	defer updateStream.streams.Delete(svm)
-	return svm.Join()
+	err = svm.Join()
+	countPositionErrors(err)
+	return err
+}
+
+// countPositionErrors counts the streams that failed because of their
+// start position.
+func countPositionErrors(err error) {
+	switch {
+	case proto.IsPositionPurged(err):
+		updateStreamErrors.Add("PositionPurged", 1)
+	case proto.IsPositionUnsupported(err):
+		updateStreamErrors.Add("PositionUnsupported", 1)
+	}
 }
 
 // StreamKeyRange is part of the proto.UpdateStream interface
@@ -235,6 +263,7 @@ func (updateStream *UpdateStream) StreamKeyRange(req *proto.KeyRangeRequest, sen
 
 	streamCount.Add("KeyRange", 1)
 	defer streamCount.Add("KeyRange", -1)
+	defer streamTimings.Record("KeyRange", time.Now())
 	log.Infof("ServeUpdateStream starting @ %#v", req.Position)
 
 	// Calls cascade like this: BinlogStreamer->KeyRangeFilterFunc->func(*proto.BinlogTransaction)->sendReply
@@ -244,12 +273,16 @@ func (updateStream *UpdateStream) StreamKeyRange(req *proto.KeyRangeRequest, sen
 		return sendReply(reply)
 	})
 	bls := NewBinlogStreamer(updateStream.dbname, updateStream.mysqld, req.Charset, req.Position, f)
+	bls.keyspaceIdType = req.KeyspaceIdType
+	bls.shardingColumn = req.ShardingColumnName
 
 	svm := &sync2.ServiceManager{}
 	svm.Go(bls.Stream)
 	updateStream.streams.Add(svm)
 	defer updateStream.streams.Delete(svm)
-	return svm.Join()
+	err = svm.Join()
+	countPositionErrors(err)
+	return err
 }
 
 // StreamTables is part of the proto.UpdateStream interface
@@ -266,12 +299,13 @@ func (updateStream *UpdateStream) StreamTables(req *proto.TablesRequest, sendRep
 
 	streamCount.Add("Tables", 1)
 	defer streamCount.Add("Tables", -1)
+	defer streamTimings.Record("Tables", time.Now())
 	log.Infof("ServeUpdateStream starting @ %#v", req.Position)
 
 	// Calls cascade like this: BinlogStreamer->TablesFilterFunc->func(*proto.BinlogTransaction)->sendReply
 	f := TablesFilterFunc(req.Tables, func(reply *proto.BinlogTransaction) error {
-		keyrangeStatements.Add(int64(len(reply.Statements)))
-		keyrangeTransactions.Add(1)
+		tablesStatements.Add(int64(len(reply.Statements)))
+		tablesTransactions.Add(1)
 		return sendReply(reply)
 	})
 	bls := NewBinlogStreamer(updateStream.dbname, updateStream.mysqld, req.Charset, req.Position, f)
@@ -280,7 +314,9 @@ func (updateStream *UpdateStream) StreamTables(req *proto.TablesRequest, sendRep
 	svm.Go(bls.Stream)
 	updateStream.streams.Add(svm)
 	defer updateStream.streams.Delete(svm)
-	return svm.Join()
+	err = svm.Join()
+	countPositionErrors(err)
+	return err
 }
 
 // HandlePanic is part of the proto.UpdateStream interface
@@ -147,11 +147,12 @@ func (s *stmt) Exec(args []driver.Value) (driver.Result, error) {
 
 func (s *stmt) Query(args []driver.Value) (driver.Rows, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), s.c.Timeout)
-	defer cancel()
 	if s.c.Streaming {
+		// The stream lives until the rows are closed.
 		qrc, errFunc := s.c.vtgateConn.StreamExecute(ctx, s.query, makeBindVars(args), s.c.TabletType)
-		return vtgateconn.NewStreamingRows(qrc, errFunc), nil
+		return &streamingRows{Rows: vtgateconn.NewStreamingRows(qrc, errFunc), cancel: cancel}, nil
 	}
+	defer cancel()
 	var qr *mproto.QueryResult
 	var err error
 	if s.c.tx == nil {
@@ -165,6 +166,17 @@ func (s *stmt) Query(args []driver.Value) (driver.Rows, error) {
 	return vtgateconn.NewRows(qr), nil
 }
 
+// streamingRows cancels the context of its stream when it is closed.
+type streamingRows struct {
+	driver.Rows
+	cancel context.CancelFunc
+}
+
+func (r *streamingRows) Close() error {
+	r.cancel()
+	return r.Rows.Close()
+}
+
 func makeBindVars(args []driver.Value) map[string]interface{} {
 	if len(args) == 0 {
 		return map[string]interface{}{}
@@ -0,0 +1,52 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dbconfigs
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/youtube/vitess/go/sqldb"
+)
+
+func TestShardMysqlParams(t *testing.T) {
+	f, err := ioutil.TempFile("", "credentials")
+	if err != nil {
+		t.Fatalf("TempFile failed: %v", err)
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.WriteString(`{"vt_repl": ["pass"], "vt_repl@ks/-80": ["shardpass"]}`); err != nil {
+		t.Fatalf("WriteString failed: %v", err)
+	}
+	f.Close()
+
+	oldFile := *dbCredentialsFile
+	oldServer := AllCredentialsServers["file"]
+	defer func() {
+		*dbCredentialsFile = oldFile
+		AllCredentialsServers["file"] = oldServer
+	}()
+	*dbCredentialsFile = f.Name()
+	AllCredentialsServers["file"] = &FileCredentialsServer{}
+
+	cp := &sqldb.ConnParams{Uname: "vt_repl", Pass: "flagpass"}
+	for _, tc := range []struct {
+		keyspace, shard string
+		want            string
+	}{
+		{"ks", "-80", "shardpass"},
+		{"ks", "80-", "pass"},
+		{"", "", "pass"},
+	} {
+		got, err := ShardMysqlParams(cp, tc.keyspace, tc.shard)
+		if err != nil {
+			t.Fatalf("ShardMysqlParams(%v, %v) failed: %v", tc.keyspace, tc.shard, err)
+		}
+		if got.Uname != "vt_repl" || got.Pass != tc.want {
+			t.Errorf("ShardMysqlParams(%v, %v) = %v/%v, want vt_repl/%v", tc.keyspace, tc.shard, got.Uname, got.Pass, tc.want)
+		}
+	}
+}
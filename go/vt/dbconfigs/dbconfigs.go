@@ -122,6 +122,37 @@ func MysqlParams(cp *sqldb.ConnParams) (sqldb.ConnParams, error) {
 	return result, err
 }
 
+// ShardUser returns the name the CredentialsServer is asked for, to
+// get the credentials of user that are specific to a shard.
+func ShardUser(user, keyspace, shard string) string {
+	return fmt.Sprintf("%v@%v/%v", user, keyspace, shard)
+}
+
+// ShardMysqlParams is like MysqlParams, but it first asks the
+// CredentialsServer for ShardUser(), so each shard can use its own
+// replication credentials. A server that returns the name it was asked
+// for (like the file server) only changes the password, others can
+// also return a different user.
+func ShardMysqlParams(cp *sqldb.ConnParams, keyspace, shard string) (sqldb.ConnParams, error) {
+	if keyspace == "" || shard == "" {
+		return MysqlParams(cp)
+	}
+	shardUser := ShardUser(cp.Uname, keyspace, shard)
+	user, passwd, err := GetCredentialsServer().GetUserAndPassword(shardUser)
+	switch err {
+	case nil:
+		result := *cp
+		if user != shardUser {
+			result.Uname = user
+		}
+		result.Pass = passwd
+		return result, nil
+	case ErrUnknownUser:
+		return MysqlParams(cp)
+	}
+	return *cp, err
+}
+
 // DBConfig encapsulates a ConnParams object and adds a keyspace and a
 // shard.
 type DBConfig struct {
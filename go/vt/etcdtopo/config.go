@@ -20,6 +20,7 @@ const (
 	replicationDirPath = rootPath + "/replication"
 	servingDirPath     = rootPath + "/ns"
 	vschemaPath        = rootPath + "/vschema"
+	tableACLPath       = rootPath + "/tableacl"
 
 	// Magic file names. Directories in etcd cannot have data. Files whose names
 	// begin with '_' are hidden from directory listings.
@@ -31,6 +32,7 @@ const (
 	srvKeyspaceFilename      = dataFilename
 	srvShardFilename         = dataFilename
 	endPointsFilename        = dataFilename
+	queryRulesFilename       = "_QueryRules"
 )
 
 var (
@@ -53,6 +55,10 @@ func keyspaceFilePath(keyspace string) string {
 	return path.Join(keyspaceDirPath(keyspace), keyspaceFilename)
 }
 
+func keyspaceQueryRulesFilePath(keyspace string) string {
+	return path.Join(keyspaceDirPath(keyspace), queryRulesFilename)
+}
+
 func shardsDirPath(keyspace string) string {
 	return keyspaceDirPath(keyspace)
 }
@@ -73,6 +79,10 @@ func tabletFilePath(tablet string) string {
 	return path.Join(tabletDirPath(tablet), tabletFilename)
 }
 
+func tabletQueryRulesFilePath(tablet string) string {
+	return path.Join(tabletDirPath(tablet), queryRulesFilename)
+}
+
 func shardReplicationDirPath(keyspace, shard string) string {
 	return path.Join(replicationDirPath, keyspace, shard)
 }
@@ -0,0 +1,151 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package etcdtopo
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/coreos/go-etcd/etcd"
+	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/jscfg"
+	"github.com/youtube/vitess/go/vt/topo"
+)
+
+/*
+This file contains the query rules management code for etcdtopo.Server
+*/
+
+// SaveKeyspaceQueryRules is part of the topo.QueryRuler interface.
+func (s *Server) SaveKeyspaceQueryRules(keyspace string, qrs *topo.QueryRules) error {
+	return saveQueryRules(s.getGlobal(), keyspaceFilePath(keyspace), keyspaceQueryRulesFilePath(keyspace), qrs)
+}
+
+// GetKeyspaceQueryRules is part of the topo.QueryRuler interface.
+func (s *Server) GetKeyspaceQueryRules(keyspace string) (*topo.QueryRules, error) {
+	qrs, _, err := getQueryRules(s.getGlobal(), keyspaceQueryRulesFilePath(keyspace))
+	return qrs, err
+}
+
+// WatchKeyspaceQueryRules is part of the topo.QueryRuler interface.
+func (s *Server) WatchKeyspaceQueryRules(keyspace string) (<-chan *topo.QueryRules, chan<- struct{}, error) {
+	notifications, stopWatching := watchQueryRules(s.getGlobal(), keyspaceQueryRulesFilePath(keyspace))
+	return notifications, stopWatching, nil
+}
+
+// SaveTabletQueryRules is part of the topo.QueryRuler interface.
+func (s *Server) SaveTabletQueryRules(tabletAlias topo.TabletAlias, qrs *topo.QueryRules) error {
+	cell, err := s.getCell(tabletAlias.Cell)
+	if err != nil {
+		return err
+	}
+	return saveQueryRules(cell, tabletFilePath(tabletAlias.String()), tabletQueryRulesFilePath(tabletAlias.String()), qrs)
+}
+
+// GetTabletQueryRules is part of the topo.QueryRuler interface.
+func (s *Server) GetTabletQueryRules(tabletAlias topo.TabletAlias) (*topo.QueryRules, error) {
+	cell, err := s.getCell(tabletAlias.Cell)
+	if err != nil {
+		return nil, err
+	}
+	qrs, _, err := getQueryRules(cell, tabletQueryRulesFilePath(tabletAlias.String()))
+	return qrs, err
+}
+
+// WatchTabletQueryRules is part of the topo.QueryRuler interface.
+func (s *Server) WatchTabletQueryRules(tabletAlias topo.TabletAlias) (<-chan *topo.QueryRules, chan<- struct{}, error) {
+	cell, err := s.getCell(tabletAlias.Cell)
+	if err != nil {
+		return nil, nil, fmt.Errorf("WatchTabletQueryRules cannot get cell: %v", err)
+	}
+	notifications, stopWatching := watchQueryRules(cell, tabletQueryRulesFilePath(tabletAlias.String()))
+	return notifications, stopWatching, nil
+}
+
+// saveQueryRules saves qrs in filePath, next to the data file
+// ownerFilePath of the keyspace or tablet, which has to exist.
+func saveQueryRules(client Client, ownerFilePath, filePath string, qrs *topo.QueryRules) error {
+	if _, err := client.Get(ownerFilePath, false /* sort */, false /* recursive */); err != nil {
+		return convertError(err)
+	}
+	if _, err := client.Set(filePath, jscfg.ToJSON(qrs), 0 /* ttl */); err != nil {
+		return convertError(err)
+	}
+	return nil
+}
+
+func getQueryRules(client Client, filePath string) (*topo.QueryRules, int64, error) {
+	resp, err := client.Get(filePath, false /* sort */, false /* recursive */)
+	if err != nil {
+		return nil, -1, convertError(err)
+	}
+	if resp.Node == nil {
+		return nil, -1, ErrBadResponse
+	}
+	qrs := &topo.QueryRules{}
+	if err := json.Unmarshal([]byte(resp.Node.Value), qrs); err != nil {
+		return nil, -1, fmt.Errorf("bad query rules data (%v): %q", err, resp.Node.Value)
+	}
+	return qrs, int64(resp.Node.ModifiedIndex), nil
+}
+
+// watchQueryRules works like WatchEndPoints.
+func watchQueryRules(client Client, filePath string) (<-chan *topo.QueryRules, chan<- struct{}) {
+	notifications := make(chan *topo.QueryRules, 10)
+	stopWatching := make(chan struct{})
+
+	watch := make(chan *etcd.Response)
+	stop := make(chan bool)
+	go func() {
+		qrs, modifiedVersion, err := getQueryRules(client, filePath)
+		if err != nil {
+			// node doesn't exist
+			modifiedVersion = 0
+			qrs = nil
+		}
+
+		select {
+		case <-stop:
+			return
+		case notifications <- qrs:
+		}
+
+		for {
+			if _, err := client.Watch(filePath, uint64(modifiedVersion), false /* recursive */, watch, stop); err != nil {
+				log.Errorf("Watch on %v failed, waiting for %v to retry: %v", filePath, WatchSleepDuration, err)
+				timer := time.After(WatchSleepDuration)
+				select {
+				case <-stop:
+					return
+				case <-timer:
+				}
+			}
+		}
+	}()
+
+	go func() {
+		for {
+			select {
+			case resp := <-watch:
+				var qrs *topo.QueryRules
+				if resp.Node != nil && resp.Node.Value != "" {
+					qrs = &topo.QueryRules{}
+					if err := json.Unmarshal([]byte(resp.Node.Value), qrs); err != nil {
+						log.Errorf("failed to Unmarshal QueryRules for %v: %v", filePath, err)
+						continue
+					}
+				}
+				notifications <- qrs
+			case <-stopWatching:
+				close(stop)
+				close(notifications)
+				return
+			}
+		}
+	}()
+
+	return notifications, stopWatching
+}
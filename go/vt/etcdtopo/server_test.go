@@ -101,3 +101,23 @@ func TestVSchema(t *testing.T) {
 	defer ts.Close()
 	test.CheckVSchema(t, ts)
 }
+
+func TestTableACL(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping wait-based test in short mode.")
+	}
+
+	ts := newTestServer(t, []string{"test"})
+	defer ts.Close()
+	test.CheckTableACL(t, ts)
+}
+
+func TestQueryRules(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping wait-based test in short mode.")
+	}
+
+	ts := newTestServer(t, []string{"test"})
+	defer ts.Close()
+	test.CheckQueryRules(t, ts)
+}
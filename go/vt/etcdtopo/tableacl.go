@@ -0,0 +1,42 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package etcdtopo
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/youtube/vitess/go/jscfg"
+	"github.com/youtube/vitess/go/vt/topo"
+)
+
+/*
+This file contains the table ACL management code for etcdtopo.Server
+*/
+
+// SaveTableACL saves the global table ACL config into the topo.
+func (s *Server) SaveTableACL(tableACL *topo.TableACL) error {
+	_, err := s.getGlobal().Set(tableACLPath, jscfg.ToJSON(tableACL), 0 /* ttl */)
+	if err != nil {
+		return convertError(err)
+	}
+	return nil
+}
+
+// GetTableACL fetches the global table ACL config from the topo.
+func (s *Server) GetTableACL() (*topo.TableACL, error) {
+	resp, err := s.getGlobal().Get(tableACLPath, false /* sort */, false /* recursive */)
+	if err != nil {
+		return nil, convertError(err)
+	}
+	if resp.Node == nil {
+		return nil, ErrBadResponse
+	}
+	tableACL := &topo.TableACL{}
+	if err := json.Unmarshal([]byte(resp.Node.Value), tableACL); err != nil {
+		return nil, fmt.Errorf("bad table ACL data (%v): %q", err, resp.Node.Value)
+	}
+	return tableACL, nil
+}
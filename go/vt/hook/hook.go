@@ -6,12 +6,14 @@ package hook
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"os"
 	"os/exec"
 	"path"
 	"strings"
 	"syscall"
+	"time"
 
 	log "github.com/golang/glog"
 	"github.com/youtube/vitess/go/jscfg"
@@ -22,12 +24,27 @@ type Hook struct {
 	Name       string
 	Parameters []string
 	ExtraEnv   map[string]string
+
+	// JSONParameters is an optional JSON document written to the
+	// stdin of the hook, for hooks that need structured input.
+	JSONParameters string
+
+	// Timeout, if set, is how long the hook can run before its
+	// whole process group is killed.
+	Timeout time.Duration
 }
 
 type HookResult struct {
 	ExitStatus int // HOOK_SUCCESS if it succeeded
 	Stdout     string
 	Stderr     string
+
+	// Duration is the wall time the hook ran for.
+	Duration time.Duration
+
+	// MaxRSS is the peak resident set size of the hook process,
+	// in kilobytes, as reported by getrusage.
+	MaxRSS int64
 }
 
 // the hook will return a value between 0 and 255. 0 if it succeeds.
@@ -39,6 +56,8 @@ const (
 	HOOK_CANNOT_GET_EXIT_STATUS = -3
 	HOOK_INVALID_NAME           = -4
 	HOOK_VTROOT_ERROR           = -5
+	HOOK_INVALID_PARAMETERS     = -6
+	HOOK_TIMEOUT                = -7
 )
 
 func NewHook(name string, params []string) *Hook {
@@ -49,6 +68,17 @@ func NewSimpleHook(name string) *Hook {
 	return &Hook{Name: name}
 }
 
+// SetJSONParameters encodes v as the JSON document sent to the
+// hook on stdin.
+func (hook *Hook) SetJSONParameters(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	hook.JSONParameters = string(data)
+	return nil
+}
+
 func (hook *Hook) Execute() (result *HookResult) {
 	result = &HookResult{}
 
@@ -58,6 +88,14 @@ func (hook *Hook) Execute() (result *HookResult) {
 		result.Stderr = "Hooks cannot contains '/'\n"
 		return result
 	}
+	if hook.JSONParameters != "" {
+		var v interface{}
+		if err := json.Unmarshal([]byte(hook.JSONParameters), &v); err != nil {
+			result.ExitStatus = HOOK_INVALID_PARAMETERS
+			result.Stderr = "Invalid JSON parameters: " + err.Error() + "\n"
+			return result
+		}
+	}
 
 	// find our root
 	root, err := vtenv.VtRoot()
@@ -91,15 +129,56 @@ func (hook *Hook) Execute() (result *HookResult) {
 			cmd.Env = append(cmd.Env, key+"="+value)
 		}
 	}
+	if hook.JSONParameters != "" {
+		cmd.Stdin = strings.NewReader(hook.JSONParameters)
+	}
+	if hook.Timeout > 0 {
+		// run the hook in its own process group, so we can
+		// kill anything it started when it times out
+		cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	}
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
-	err = cmd.Run()
+	start := time.Now()
+	timedOut := false
+	err = cmd.Start()
+	if err == nil {
+		done := make(chan error, 1)
+		go func() {
+			done <- cmd.Wait()
+		}()
+		var timeout <-chan time.Time
+		if hook.Timeout > 0 {
+			timer := time.NewTimer(hook.Timeout)
+			defer timer.Stop()
+			timeout = timer.C
+		}
+		select {
+		case err = <-done:
+		case <-timeout:
+			timedOut = true
+			if kerr := syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL); kerr != nil {
+				log.Warningf("hook: cannot kill process group of %v: %v", vthook, kerr)
+			}
+			err = <-done
+		}
+	}
+	result.Duration = time.Since(start)
 	result.Stdout = stdout.String()
 	result.Stderr = stderr.String()
-	if err == nil {
+	if cmd.ProcessState != nil {
+		if rusage, ok := cmd.ProcessState.SysUsage().(*syscall.Rusage); ok {
+			result.MaxRSS = int64(rusage.Maxrss)
+		}
+	}
+	switch {
+	case timedOut:
+		result.ExitStatus = HOOK_TIMEOUT
+		result.Stderr += fmt.Sprintf("ERROR: hook timed out after %v\n", hook.Timeout)
+	case err == nil:
 		result.ExitStatus = HOOK_SUCCESS
-	} else {
+	default:
 		if cmd.ProcessState != nil && cmd.ProcessState.Sys() != nil {
 			result.ExitStatus = cmd.ProcessState.Sys().(syscall.WaitStatus).ExitStatus()
 		} else {
@@ -113,6 +192,22 @@ func (hook *Hook) Execute() (result *HookResult) {
 	return result
 }
 
+// ExecuteHooks runs the hooks in order, and returns the results of
+// the ones that were executed. It stops after the first hook that
+// fails, unless continueOnError is set. Missing hooks are skipped.
+func ExecuteHooks(hooks []*Hook, continueOnError bool) []*HookResult {
+	results := make([]*HookResult, 0, len(hooks))
+	for _, hook := range hooks {
+		hr := hook.Execute()
+		results = append(results, hr)
+		if hr.ExitStatus != HOOK_SUCCESS && hr.ExitStatus != HOOK_DOES_NOT_EXIST && !continueOnError {
+			log.Warningf("hook: %v failed(%v), not running the remaining hooks", hook.Name, hr.ExitStatus)
+			break
+		}
+	}
+	return results
+}
+
 // Execute an optional hook, returns a printable error
 func (hook *Hook) ExecuteOptional() error {
 	hr := hook.Execute()
@@ -0,0 +1,91 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hook
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+// setupHooks creates a VTROOT with the given vthook scripts, and
+// returns a function to clean it up.
+func setupHooks(t *testing.T, scripts map[string]string) func() {
+	root, err := ioutil.TempDir("", "hooktest")
+	if err != nil {
+		t.Fatalf("TempDir failed: %v", err)
+	}
+	if err := os.Mkdir(path.Join(root, "vthook"), 0755); err != nil {
+		t.Fatalf("Mkdir failed: %v", err)
+	}
+	for name, script := range scripts {
+		if err := ioutil.WriteFile(path.Join(root, "vthook", name), []byte("#!/bin/sh\n"+script+"\n"), 0755); err != nil {
+			t.Fatalf("WriteFile failed: %v", err)
+		}
+	}
+	oldRoot := os.Getenv("VTROOT")
+	os.Setenv("VTROOT", root)
+	return func() {
+		os.Setenv("VTROOT", oldRoot)
+		os.RemoveAll(root)
+	}
+}
+
+func TestJSONParameters(t *testing.T) {
+	defer setupHooks(t, map[string]string{"cat": "cat"})()
+
+	hook := NewSimpleHook("cat")
+	if err := hook.SetJSONParameters(map[string]interface{}{"volume": "vg0/data", "size": 10}); err != nil {
+		t.Fatalf("SetJSONParameters failed: %v", err)
+	}
+	hr := hook.Execute()
+	if hr.ExitStatus != HOOK_SUCCESS || hr.Stdout != `{"size":10,"volume":"vg0/data"}` {
+		t.Errorf("unexpected result: %v", hr)
+	}
+	if hr.Duration <= 0 {
+		t.Errorf("Duration was not recorded: %v", hr)
+	}
+
+	hook.JSONParameters = "{not json"
+	if hr := hook.Execute(); hr.ExitStatus != HOOK_INVALID_PARAMETERS {
+		t.Errorf("unexpected result for invalid JSON: %v", hr)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	// the hook runs a child that would keep stdout open, it has
+	// to be killed with the hook
+	defer setupHooks(t, map[string]string{"slow": "sleep 10 &\nsleep 10"})()
+
+	hook := NewSimpleHook("slow")
+	hook.Timeout = 100 * time.Millisecond
+	hr := hook.Execute()
+	if hr.ExitStatus != HOOK_TIMEOUT {
+		t.Errorf("unexpected result: %v", hr)
+	}
+	if hr.Duration > 5*time.Second {
+		t.Errorf("hook was not killed in time: %v", hr.Duration)
+	}
+}
+
+func TestExecuteHooks(t *testing.T) {
+	defer setupHooks(t, map[string]string{
+		"ok":   "echo ok",
+		"fail": "exit 3",
+	})()
+
+	hooks := []*Hook{NewSimpleHook("ok"), NewSimpleHook("missing"), NewSimpleHook("fail"), NewSimpleHook("ok")}
+	results := ExecuteHooks(hooks, false)
+	if len(results) != 3 || results[0].ExitStatus != HOOK_SUCCESS || results[1].ExitStatus != HOOK_DOES_NOT_EXIST || results[2].ExitStatus != 3 {
+		t.Errorf("unexpected results: %v", results)
+	}
+
+	results = ExecuteHooks(hooks, true)
+	if len(results) != 4 || results[3].ExitStatus != HOOK_SUCCESS || results[3].Stdout != "ok\n" {
+		t.Errorf("unexpected results with continueOnError: %v", results)
+	}
+}
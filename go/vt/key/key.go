@@ -195,6 +195,87 @@ func KeyRangesOverlap(first, second KeyRange) (KeyRange, error) {
 	return result, nil
 }
 
+// Intersect returns the KeyspaceId values that are in both ranges, and
+// false if there are none.
+func (kr KeyRange) Intersect(other KeyRange) (KeyRange, bool) {
+	if !KeyRangesIntersect(kr, other) {
+		return KeyRange{}, false
+	}
+	result, _ := KeyRangesOverlap(kr, other)
+	return result, true
+}
+
+// Union returns the range made of two adjacent ranges, in any order.
+// It's an error if they are not adjacent: if there is a gap between
+// them, or if they overlap. Note MaxKey and MinKey are both "", but the
+// end of the keyspace is not adjacent to its start.
+func (kr KeyRange) Union(other KeyRange) (KeyRange, error) {
+	switch {
+	case kr.End != MaxKey && kr.End == other.Start:
+		return KeyRange{Start: kr.Start, End: other.End}, nil
+	case other.End != MaxKey && other.End == kr.Start:
+		return KeyRange{Start: other.Start, End: kr.End}, nil
+	}
+	return KeyRange{}, fmt.Errorf("KeyRanges %v and %v are not adjacent", kr, other)
+}
+
+// CheckKeyRangesPartition returns an error unless the ranges, in any
+// order, exactly partition parent: they cover all of it, without holes
+// or overlaps, and nothing outside of it.
+func CheckKeyRangesPartition(parent KeyRange, ranges []KeyRange) error {
+	if len(ranges) == 0 {
+		return fmt.Errorf("no KeyRange to partition %v", parent)
+	}
+	sorted := make(KeyRangeArray, len(ranges))
+	copy(sorted, ranges)
+	sorted.Sort()
+	for _, kr := range sorted {
+		if kr.End != MaxKey && kr.Start >= kr.End {
+			return fmt.Errorf("KeyRange %v is empty", kr)
+		}
+	}
+	if sorted[0].Start != parent.Start {
+		return fmt.Errorf("KeyRanges don't start at the start of %v, but at %v", parent, sorted[0].Start.Hex())
+	}
+	for i := 0; i < len(sorted)-1; i++ {
+		end, next := sorted[i].End, sorted[i+1].Start
+		switch {
+		case end == MaxKey || next < end:
+			return fmt.Errorf("KeyRanges %v and %v overlap", sorted[i], sorted[i+1])
+		case next > end:
+			return fmt.Errorf("KeyRanges %v and %v leave a hole", sorted[i], sorted[i+1])
+		}
+	}
+	if last := sorted[len(sorted)-1]; last.End != parent.End {
+		return fmt.Errorf("KeyRanges don't end at the end of %v, but at %v", parent, last.End.Hex())
+	}
+	return nil
+}
+
+// ParseShardName returns the KeyRange of a shard named after it, like
+// "40-80", "-40" or "c0-" (the empty start is MinKey, the empty end is
+// MaxKey). The hex values are case insensitive.
+func ParseShardName(name string) (KeyRange, error) {
+	parts := strings.Split(strings.ToLower(name), "-")
+	if len(parts) != 2 {
+		return KeyRange{}, fmt.Errorf("malformed shard name %q: it should be <start>-<end>", name)
+	}
+	kr, err := ParseKeyRangeParts(parts[0], parts[1])
+	if err != nil {
+		return KeyRange{}, fmt.Errorf("malformed shard name %q: %v", name, err)
+	}
+	if kr.End != MaxKey && kr.Start >= kr.End {
+		return KeyRange{}, fmt.Errorf("malformed shard name %q: %v is not strictly smaller than %v", name, kr.Start.Hex(), kr.End.Hex())
+	}
+	return kr, nil
+}
+
+// ShardName returns the name of the shard of the KeyRange, the
+// reverse of ParseShardName, in lower case.
+func (kr KeyRange) ShardName() string {
+	return string(kr.Start.Hex()) + "-" + string(kr.End.Hex())
+}
+
 //
 // KeyspaceIdArray definitions
 //
@@ -239,7 +320,21 @@ func (p KeyRangeArray) Sort() { sort.Sort(p) }
 // specification. a-b-c-d will be parsed as a-b, b-c, c-d. The empty
 // string may serve both as the start and end of the keyspace: -a-b-
 // will be parsed as start-a, a-b, b-end.
+// It can also be a comma separated list of shard names, parsed by
+// ParseShardName: -a,a-b,c- will be parsed as start-a, a-b, c-end.
 func ParseShardingSpec(spec string) ([]KeyRange, error) {
+	if strings.Contains(spec, ",") {
+		names := strings.Split(spec, ",")
+		ranges := make([]KeyRange, len(names))
+		for i, name := range names {
+			kr, err := ParseShardName(strings.TrimSpace(name))
+			if err != nil {
+				return nil, fmt.Errorf("malformed spec %q: %v", spec, err)
+			}
+			ranges[i] = kr
+		}
+		return ranges, nil
+	}
 	parts := strings.Split(spec, "-")
 	if len(parts) == 1 {
 		return nil, fmt.Errorf("malformed spec: doesn't define a range: %q", spec)
@@ -6,6 +6,7 @@ package key
 
 import (
 	"encoding/json"
+	"strings"
 	"testing"
 )
 
@@ -234,3 +235,160 @@ func TestIntersectOverlap(t *testing.T) {
 		}
 	}
 }
+
+// parseTestShardName parses a shard name for the tests, "" being the
+// empty KeyRange.
+func parseTestShardName(t *testing.T, name string) KeyRange {
+	if name == "" {
+		return KeyRange{}
+	}
+	kr, err := ParseShardName(name)
+	if err != nil {
+		t.Fatalf("ParseShardName(%v) failed: %v", name, err)
+	}
+	return kr
+}
+
+func TestIntersectUnion(t *testing.T) {
+	var table = []struct {
+		left, right string
+		intersect   string
+		union       string
+	}{
+		{left: "40-80", right: "60-a0", intersect: "60-80"},
+		{left: "40-80", right: "80-c0", union: "40-c0"},
+		{left: "80-c0", right: "40-80", union: "40-c0"},
+		{left: "-40", right: "40-", union: "-"},
+		{left: "40-", right: "-40", union: "-"},
+		{left: "c0-", right: "-40"},
+		{left: "-", right: "40-80", intersect: "40-80"},
+		{left: "-80", right: "-", intersect: "-80"},
+		{left: "40-80", right: "c0-"},
+		{left: "4000-8000", right: "8000-", union: "4000-"},
+		// the keyspace id 80 is between 80 and 8000
+		{left: "4000-80", right: "8000-"},
+		{left: "40-8000", right: "80-", intersect: "80-8000"},
+	}
+	for _, el := range table {
+		left := parseTestShardName(t, el.left)
+		right := parseTestShardName(t, el.right)
+
+		intersect, ok := left.Intersect(right)
+		if ok != (el.intersect != "") {
+			t.Errorf("%v.Intersect(%v) = %v, %v", el.left, el.right, intersect, ok)
+		} else if ok && intersect.ShardName() != el.intersect {
+			t.Errorf("%v.Intersect(%v) = %v, want %v", el.left, el.right, intersect.ShardName(), el.intersect)
+		}
+
+		union, err := left.Union(right)
+		if (err == nil) != (el.union != "") {
+			t.Errorf("%v.Union(%v) = %v, %v", el.left, el.right, union, err)
+		} else if err == nil && union.ShardName() != el.union {
+			t.Errorf("%v.Union(%v) = %v, want %v", el.left, el.right, union.ShardName(), el.union)
+		}
+	}
+}
+
+func TestCheckKeyRangesPartition(t *testing.T) {
+	var table = []struct {
+		parent string
+		ranges []string
+		err    string
+	}{
+		{parent: "-", ranges: []string{"-"}},
+		{parent: "-", ranges: []string{"80-", "-40", "40-80"}},
+		{parent: "40-80", ranges: []string{"40-60", "60-80"}},
+		{parent: "80-", ranges: []string{"80-c0", "c0-"}},
+		{parent: "-", ranges: []string{"-40", "80-"}, err: "leave a hole"},
+		{parent: "-", ranges: []string{"-80", "40-"}, err: "overlap"},
+		{parent: "-", ranges: []string{"-", "40-80"}, err: "overlap"},
+		{parent: "-", ranges: []string{"-40", "40-80"}, err: "don't end at the end"},
+		{parent: "-", ranges: []string{"40-"}, err: "don't start at the start"},
+		{parent: "40-80", ranges: []string{"40-60", "60-"}, err: "don't end at the end"},
+		{parent: "40-80", ranges: []string{"-60", "60-80"}, err: "don't start at the start"},
+		{parent: "40-80", ranges: []string{}, err: "no KeyRange"},
+	}
+	for _, el := range table {
+		ranges := make([]KeyRange, len(el.ranges))
+		for i, name := range el.ranges {
+			ranges[i] = parseTestShardName(t, name)
+		}
+		err := CheckKeyRangesPartition(parseTestShardName(t, el.parent), ranges)
+		if el.err == "" {
+			if err != nil {
+				t.Errorf("CheckKeyRangesPartition(%v, %v) failed: %v", el.parent, el.ranges, err)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), el.err) {
+			t.Errorf("CheckKeyRangesPartition(%v, %v) = %v, want an error containing %q", el.parent, el.ranges, err, el.err)
+		}
+	}
+
+	// an empty range can't be part of a partition
+	if err := CheckKeyRangesPartition(KeyRange{Start: "\x40", End: "\x80"}, []KeyRange{{Start: "\x40", End: "\x40"}, {Start: "\x40", End: "\x80"}}); err == nil || !strings.Contains(err.Error(), "is empty") {
+		t.Errorf("CheckKeyRangesPartition with an empty range = %v, want an error", err)
+	}
+}
+
+func TestParseShardName(t *testing.T) {
+	var table = []struct {
+		name     string
+		keyRange KeyRange
+		err      bool
+	}{
+		{name: "-", keyRange: KeyRange{Start: MinKey, End: MaxKey}},
+		{name: "-80", keyRange: KeyRange{Start: MinKey, End: "\x80"}},
+		{name: "80-", keyRange: KeyRange{Start: "\x80", End: MaxKey}},
+		{name: "40-80", keyRange: KeyRange{Start: "\x40", End: "\x80"}},
+		{name: "C0-D0", keyRange: KeyRange{Start: "\xc0", End: "\xd0"}},
+		{name: "4000000000000000-8000000000000000", keyRange: KeyRange{Start: "\x40\x00\x00\x00\x00\x00\x00\x00", End: "\x80\x00\x00\x00\x00\x00\x00\x00"}},
+		{name: "0", err: true},
+		{name: "40-80-c0", err: true},
+		{name: "4-8", err: true},
+		{name: "80-40", err: true},
+		{name: "40-40", err: true},
+		{name: "xx-", err: true},
+	}
+	for _, el := range table {
+		kr, err := ParseShardName(el.name)
+		if el.err {
+			if err == nil {
+				t.Errorf("ParseShardName(%v) = %v, want an error", el.name, kr)
+			}
+			continue
+		}
+		if err != nil || kr != el.keyRange {
+			t.Errorf("ParseShardName(%v) = %v, %v, want %v", el.name, kr, err, el.keyRange)
+			continue
+		}
+		if got := kr.ShardName(); got != strings.ToLower(el.name) {
+			t.Errorf("%v.ShardName() = %v, want %v", kr, got, strings.ToLower(el.name))
+		}
+	}
+}
+
+func TestParseShardingSpecList(t *testing.T) {
+	ranges, err := ParseShardingSpec("40-80, 80-c0,-40")
+	if err != nil {
+		t.Fatalf("ParseShardingSpec failed: %v", err)
+	}
+	want := []KeyRange{
+		{Start: "\x40", End: "\x80"},
+		{Start: "\x80", End: "\xc0"},
+		{Start: MinKey, End: "\x40"},
+	}
+	if len(ranges) != len(want) {
+		t.Fatalf("ParseShardingSpec = %v, want %v", ranges, want)
+	}
+	for i := range want {
+		if ranges[i] != want[i] {
+			t.Errorf("ParseShardingSpec = %v, want %v", ranges, want)
+			break
+		}
+	}
+
+	for _, bad := range []string{"40-80,", "40-80,80", "40-80,c0-80"} {
+		if _, err := ParseShardingSpec(bad); err == nil {
+			t.Errorf("Didn't get expected error for %v.", bad)
+		}
+	}
+}
@@ -5,37 +5,26 @@
 package mysqlctl
 
 import (
-	"bufio"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
 	"io/ioutil"
-	"os"
-	"path"
 	"strings"
-	"sync"
 
 	log "github.com/golang/glog"
 
-	"github.com/youtube/vitess/go/cgzip"
-	"github.com/youtube/vitess/go/sync2"
-	"github.com/youtube/vitess/go/vt/concurrency"
 	"github.com/youtube/vitess/go/vt/logutil"
 	"github.com/youtube/vitess/go/vt/mysqlctl/backupstorage"
 	"github.com/youtube/vitess/go/vt/mysqlctl/proto"
+	"golang.org/x/net/context"
 )
 
-// This file handles the backup and restore related code
+// This file handles the backup and restore related code. The actual
+// work is done by the BackupEngine (see backupengine.go).
 
 const (
-	// the three bases for files to restore
-	backupInnodbDataHomeDir     = "InnoDBData"
-	backupInnodbLogGroupHomeDir = "InnoDBLog"
-	backupData                  = "Data"
-
 	// the manifest file name
-	backupManifest = "MANIFEST"
+	backupManifest = backupstorage.ManifestFileName
 )
 
 const (
@@ -48,151 +37,103 @@ var (
 	ErrNoBackup = errors.New("no available backup")
 )
 
-// FileEntry is one file to backup
-type FileEntry struct {
-	// Base is one of:
-	// - backupInnodbDataHomeDir for files that go into Mycnf.InnodbDataHomeDir
-	// - backupInnodbLogGroupHomeDir for files that go into Mycnf.InnodbLogGroupHomeDir
-	// - backupData for files that go into Mycnf.DataDir
-	Base string
-
-	// Name is the file name, relative to Base
-	Name string
-
-	// Hash is the hash of the gzip compressed data stored in the
-	// BackupStorage.
-	Hash string
+// BackupCorruptionError is returned when the checksums of some files
+// of a backup don't match its MANIFEST.
+type BackupCorruptionError struct {
+	// Files are the names of the mismatched files, sorted
+	Files []string
 }
 
-func (fe *FileEntry) open(cnf *Mycnf, readOnly bool) (*os.File, error) {
-	// find the root to use
-	var root string
-	switch fe.Base {
-	case backupInnodbDataHomeDir:
-		root = cnf.InnodbDataHomeDir
-	case backupInnodbLogGroupHomeDir:
-		root = cnf.InnodbLogGroupHomeDir
-	case backupData:
-		root = cnf.DataDir
-	default:
-		return nil, fmt.Errorf("unknown base: %v", fe.Base)
-	}
-
-	// and open the file
-	name := path.Join(root, fe.Name)
-	var fd *os.File
-	var err error
-	if readOnly {
-		fd, err = os.Open(name)
-	} else {
-		dir := path.Dir(name)
-		if err := os.MkdirAll(dir, os.ModePerm); err != nil {
-			return nil, fmt.Errorf("cannot create destination directory %v: %v", dir, err)
-		}
-		fd, err = os.Create(name)
-	}
-	if err != nil {
-		return nil, fmt.Errorf("cannot open source file %v: %v", name, err)
-	}
-	return fd, nil
+// Error is part of the error interface.
+func (e *BackupCorruptionError) Error() string {
+	return fmt.Sprintf("backup is corrupted, checksum mismatch for: %v", strings.Join(e.Files, ", "))
 }
 
-// BackupManifest represents the backup. It lists all the files, and
-// the ReplicationPosition that the backup was taken at.
+// BackupManifest is the part of the MANIFEST common to all the backup
+// engines. Each engine adds its own fields.
 type BackupManifest struct {
-	// FileEntries contains all the files in the backup
-	FileEntries []FileEntry
+	// BackupMethod is the name of the engine that took the
+	// backup. Backups taken before the engines were introduced
+	// don't have it, and are builtin backups.
+	BackupMethod string
 
 	// ReplicationPosition is the position at which the backup was taken
 	ReplicationPosition proto.ReplicationPosition
-}
-
-// isDbDir returns true if the given directory contains a DB
-func isDbDir(p string) bool {
-	// db.opt is there
-	if _, err := os.Stat(path.Join(p, "db.opt")); err == nil {
-		return true
-	}
-
-	// Look for at least one .frm file
-	fis, err := ioutil.ReadDir(p)
-	if err != nil {
-		return false
-	}
-	for _, fi := range fis {
-		if strings.HasSuffix(fi.Name(), ".frm") {
-			return true
-		}
-	}
-
-	return false
-}
 
-func addDirectory(fes []FileEntry, base string, baseDir string, subDir string) ([]FileEntry, error) {
-	p := path.Join(baseDir, subDir)
+	// CompressionEngine is the engine used to compress the backup
+	// files (see compression.go). Backups taken before the
+	// compression engines were introduced don't have it, and use
+	// gzip.
+	CompressionEngine string
 
-	fis, err := ioutil.ReadDir(p)
-	if err != nil {
-		return nil, err
-	}
-	for _, fi := range fis {
-		fes = append(fes, FileEntry{
-			Base: base,
-			Name: path.Join(subDir, fi.Name()),
-		})
-	}
-	return fes, nil
+	// DataSize is the number of bytes of data that were backed
+	// up, before compression. Backups taken before it was
+	// introduced don't have it.
+	DataSize int64
 }
 
-func findFilesTobackup(cnf *Mycnf) ([]FileEntry, error) {
-	var err error
-	var result []FileEntry
-
-	// first add inno db files
-	result, err = addDirectory(result, backupInnodbDataHomeDir, cnf.InnodbDataHomeDir, "")
-	if err != nil {
-		return nil, err
-	}
-	result, err = addDirectory(result, backupInnodbLogGroupHomeDir, cnf.InnodbLogGroupHomeDir, "")
+// writeManifest JSON-encodes the manifest of an engine, and adds it
+// to the backup.
+func writeManifest(bh backupstorage.BackupHandle, manifest interface{}) error {
+	wc, err := bh.AddFile(backupManifest)
 	if err != nil {
-		return nil, err
+		return fmt.Errorf("cannot add %v to backup: %v", backupManifest, err)
 	}
+	defer wc.Close()
 
-	// then add DB directories
-	fis, err := ioutil.ReadDir(cnf.DataDir)
+	data, err := json.MarshalIndent(manifest, "", "  ")
 	if err != nil {
-		return nil, err
+		return fmt.Errorf("cannot JSON encode %v: %v", backupManifest, err)
 	}
-
-	for _, fi := range fis {
-		p := path.Join(cnf.DataDir, fi.Name())
-		if isDbDir(p) {
-			result, err = addDirectory(result, backupData, cnf.DataDir, fi.Name())
-			if err != nil {
-				return nil, err
-			}
-		}
+	if _, err := wc.Write([]byte(data)); err != nil {
+		return fmt.Errorf("cannot write %v: %v", backupManifest, err)
 	}
-	return result, nil
+	return nil
 }
 
 // Backup is the main entry point for a backup:
 // - uses the BackupStorage service to store a new backup
-// - shuts down Mysqld during the backup
-// - remember if we were replicating, restore the exact same state
-func Backup(mysqld MysqlDaemon, logger logutil.Logger, bucket, name string, backupConcurrency int, hookExtraEnv map[string]string) error {
+// - takes it with the BackupEngine from -backup_engine_implementation
+// bandwidthLimit is the maximum total read rate of the files, in
+// bytes per second (0 for no limit).
+// The backup is refused if the BackupStorage doesn't have enough
+// space for it (see -backup_max_disk_usage), unless skipSpaceCheck
+// is set.
+func Backup(mysqld MysqlDaemon, logger logutil.Logger, bucket, name string, backupConcurrency int, bandwidthLimit int64, skipSpaceCheck bool, hookExtraEnv map[string]string) error {
+
+	// find the engine
+	be, err := GetBackupEngine()
+	if err != nil {
+		return err
+	}
 
-	// start the backup with the BackupStorage
+	// check the BackupStorage has room for the backup
 	bs, err := backupstorage.GetBackupStorage()
 	if err != nil {
 		return err
 	}
+	size, err := estimateBackupSize(mysqld.Cnf())
+	switch {
+	case err == nil:
+		logger.Infof("starting backup %v/%v with the %v engine, estimated size %v bytes", bucket, name, *BackupEngineImplementation, size)
+	case skipSpaceCheck:
+		logger.Warningf("starting backup %v/%v with the %v engine, cannot estimate its size: %v", bucket, name, *BackupEngineImplementation, err)
+	default:
+		return fmt.Errorf("cannot estimate the backup size: %v", err)
+	}
+	if skipSpaceCheck {
+		logger.Warningf("not checking the backup storage has enough space")
+	} else if err := checkBackupSpace(bs, bucket, size, *backupMaxDiskUsage); err != nil {
+		return err
+	}
+
+	// start the backup with the BackupStorage
 	bh, err := bs.StartBackup(bucket, name)
 	if err != nil {
 		return fmt.Errorf("StartBackup failed: %v", err)
 	}
 
-	if err = backup(mysqld, logger, bh, backupConcurrency, hookExtraEnv); err != nil {
+	if err = be.ExecuteBackup(mysqld, logger, bh, backupConcurrency, bandwidthLimit, hookExtraEnv); err != nil {
 		if abortErr := bh.AbortBackup(); abortErr != nil {
 			logger.Errorf("failed to abort backup: %v", abortErr)
 		}
@@ -201,194 +142,20 @@ func Backup(mysqld MysqlDaemon, logger logutil.Logger, bucket, name string, back
 	return bh.EndBackup()
 }
 
-func backup(mysqld MysqlDaemon, logger logutil.Logger, bh backupstorage.BackupHandle, backupConcurrency int, hookExtraEnv map[string]string) error {
-
-	// save initial state so we can restore
-	slaveStartRequired := false
-	sourceIsMaster := false
-	readOnly := true
-	var replicationPosition proto.ReplicationPosition
-
-	// see if we need to restart replication after backup
-	logger.Infof("getting current replication status")
-	slaveStatus, err := mysqld.SlaveStatus()
-	switch err {
-	case nil:
-		slaveStartRequired = slaveStatus.SlaveRunning()
-	case ErrNotSlave:
-		// keep going if we're the master, might be a degenerate case
-		sourceIsMaster = true
-	default:
-		return fmt.Errorf("cannot get slave status: %v", err)
-	}
-
-	// get the read-only flag
-	readOnly, err = mysqld.IsReadOnly()
-	if err != nil {
-		return fmt.Errorf("cannot get read only status: %v", err)
-	}
-
-	// get the replication position
-	if sourceIsMaster {
-		if !readOnly {
-			logger.Infof("turning master read-onyl before backup")
-			if err = mysqld.SetReadOnly(true); err != nil {
-				return fmt.Errorf("cannot get read only status: %v", err)
-			}
-		}
-		replicationPosition, err = mysqld.MasterPosition()
-		if err != nil {
-			return fmt.Errorf("cannot get master position: %v", err)
-		}
-	} else {
-		if err = StopSlave(mysqld, hookExtraEnv); err != nil {
-			return fmt.Errorf("cannot stop slave: %v", err)
-		}
-		var slaveStatus proto.ReplicationStatus
-		slaveStatus, err = mysqld.SlaveStatus()
-		if err != nil {
-			return fmt.Errorf("cannot get slave status: %v", err)
-		}
-		replicationPosition = slaveStatus.Position
-	}
-	logger.Infof("using replication position: %v", replicationPosition)
-
-	// shutdown mysqld
-	if err = mysqld.Shutdown(true, MysqlWaitTime); err != nil {
-		return fmt.Errorf("cannot shutdown mysqld: %v", err)
-	}
-
-	// get the files to backup
-	fes, err := findFilesTobackup(mysqld.Cnf())
-	if err != nil {
-		return fmt.Errorf("cannot find files to backup: %v", err)
-	}
-	logger.Infof("found %v files to backup", len(fes))
-
-	// backup everything
-	if err := backupFiles(mysqld, logger, bh, fes, replicationPosition, backupConcurrency); err != nil {
-		return fmt.Errorf("cannot backup files: %v", err)
-	}
-
-	// Try to restart mysqld
-	if err := mysqld.Start(MysqlWaitTime); err != nil {
-		return fmt.Errorf("cannot restart mysqld: %v", err)
-	}
-
-	// Restore original mysqld state that we saved above.
-	if slaveStartRequired {
-		logger.Infof("restarting mysql replication")
-		if err := StartSlave(mysqld, hookExtraEnv); err != nil {
-			return fmt.Errorf("cannot restart slave: %v", err)
-		}
-
-		// this should be quick, but we might as well just wait
-		if err := WaitForSlaveStart(mysqld, slaveStartDeadline); err != nil {
-			return fmt.Errorf("slave is not restarting: %v", err)
-		}
-	}
-
-	// And set read-only mode
-	logger.Infof("resetting mysqld read-only to %v", readOnly)
-	if err := mysqld.SetReadOnly(readOnly); err != nil {
-		return err
-	}
-
-	return nil
+// shutdownMysqld shuts mysqld down for a backup or a restore, waiting
+// at most MysqlWaitTime.
+func shutdownMysqld(mysqld MysqlDaemon) error {
+	ctx, cancel := context.WithTimeout(context.Background(), MysqlWaitTime)
+	defer cancel()
+	return mysqld.Shutdown(ctx, true)
 }
 
-func backupFiles(mysqld MysqlDaemon, logger logutil.Logger, bh backupstorage.BackupHandle, fes []FileEntry, replicationPosition proto.ReplicationPosition, backupConcurrency int) error {
-
-	sema := sync2.NewSemaphore(backupConcurrency, 0)
-	rec := concurrency.AllErrorRecorder{}
-	wg := sync.WaitGroup{}
-	for i, fe := range fes {
-		wg.Add(1)
-		go func(i int, fe FileEntry) {
-			defer wg.Done()
-
-			// wait until we are ready to go, skip if we already
-			// encountered an error
-			sema.Acquire()
-			defer sema.Release()
-			if rec.HasErrors() {
-				return
-			}
-
-			// open the source file for reading
-			source, err := fe.open(mysqld.Cnf(), true)
-			if err != nil {
-				rec.RecordError(err)
-				return
-			}
-			defer source.Close()
-
-			// open the destination file for writing, and a buffer
-			name := fmt.Sprintf("%v", i)
-			wc, err := bh.AddFile(name)
-			if err != nil {
-				rec.RecordError(fmt.Errorf("cannot add file: %v", err))
-				return
-			}
-			defer wc.Close()
-			dst := bufio.NewWriterSize(wc, 2*1024*1024)
-
-			// create the hasher and the tee on top
-			hasher := newHasher()
-			tee := io.MultiWriter(dst, hasher)
-
-			// create the gzip compression filter
-			gzip, err := cgzip.NewWriterLevel(tee, cgzip.Z_BEST_SPEED)
-			if err != nil {
-				rec.RecordError(fmt.Errorf("cannot create gziper: %v", err))
-				return
-			}
-
-			// copy from the source file to gzip to tee to output file and hasher
-			_, err = io.Copy(gzip, source)
-			if err != nil {
-				rec.RecordError(fmt.Errorf("cannot copy data: %v", err))
-				return
-			}
-
-			// close gzip to flush it, after that the hash is good
-			if err = gzip.Close(); err != nil {
-				rec.RecordError(fmt.Errorf("cannot close gzip: %v", err))
-				return
-			}
-
-			// flush the buffer to finish writing, save the hash
-			dst.Flush()
-			fes[i].Hash = hasher.HashString()
-		}(i, fe)
-	}
-
-	wg.Wait()
-	if rec.HasErrors() {
-		return rec.Error()
-	}
-
-	// open the MANIFEST
-	wc, err := bh.AddFile(backupManifest)
-	if err != nil {
-		return fmt.Errorf("cannot add %v to backup: %v", backupManifest, err)
-	}
-	defer wc.Close()
-
-	// JSON-encode and write the MANIFEST
-	bm := &BackupManifest{
-		FileEntries:         fes,
-		ReplicationPosition: replicationPosition,
-	}
-	data, err := json.MarshalIndent(bm, "", "  ")
-	if err != nil {
-		return fmt.Errorf("cannot JSON encode %v: %v", backupManifest, err)
-	}
-	if _, err := wc.Write([]byte(data)); err != nil {
-		return fmt.Errorf("cannot write %v: %v", backupManifest, err)
-	}
-
-	return nil
+// startMysqld restarts mysqld after a backup or a restore, waiting at
+// most MysqlWaitTime.
+func startMysqld(mysqld MysqlDaemon) error {
+	ctx, cancel := context.WithTimeout(context.Background(), MysqlWaitTime)
+	defer cancel()
+	return mysqld.Start(ctx)
 }
 
 // checkNoDB makes sure there is no vt_ db already there. Used by Restore,
@@ -416,139 +183,182 @@ func checkNoDB(mysqld MysqlDaemon) error {
 	return nil
 }
 
-// restoreFiles will copy all the files from the BackupStorage to the
-// right place
-func restoreFiles(cnf *Mycnf, bh backupstorage.BackupHandle, fes []FileEntry, restoreConcurrency int) error {
-	sema := sync2.NewSemaphore(restoreConcurrency, 0)
-	rec := concurrency.AllErrorRecorder{}
-	wg := sync.WaitGroup{}
-	for i, fe := range fes {
-		wg.Add(1)
-		go func(i int, fe FileEntry) {
-			defer wg.Done()
-
-			// wait until we are ready to go, skip if we already
-			// encountered an error
-			sema.Acquire()
-			defer sema.Release()
-			if rec.HasErrors() {
-				return
-			}
-
-			// open the source file for reading
-			name := fmt.Sprintf("%v", i)
-			source, err := bh.ReadFile(name)
-			if err != nil {
-				rec.RecordError(err)
-				return
-			}
-			defer source.Close()
-
-			// open the destination file for writing
-			dstFile, err := fe.open(cnf, false)
-			if err != nil {
-				rec.RecordError(err)
-				return
-			}
-			defer dstFile.Close()
-
-			// create a buffering output
-			dst := bufio.NewWriterSize(dstFile, 2*1024*1024)
-
-			// create hash to write the compressed data to
-			hasher := newHasher()
-
-			// create a Tee: we split the input into the hasher
-			// and into the gunziper
-			tee := io.TeeReader(source, hasher)
+// readManifest reads the MANIFEST of a backup. It returns the raw
+// content for the engine, and the common part.
+func readManifest(bh backupstorage.BackupHandle) ([]byte, *BackupManifest, error) {
+	rc, err := bh.ReadFile(backupManifest)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot read %v: %v", backupManifest, err)
+	}
+	defer rc.Close()
+	data, err := ioutil.ReadAll(rc)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot read %v: %v", backupManifest, err)
+	}
+	bm := &BackupManifest{}
+	if err := json.Unmarshal(data, bm); err != nil {
+		return nil, nil, fmt.Errorf("cannot JSON decode %v: %v", backupManifest, err)
+	}
+	if bm.BackupMethod == "" {
+		bm.BackupMethod = builtinBackupEngineName
+	}
+	return data, bm, nil
+}
 
-			// create the uncompresser
-			gz, err := cgzip.NewReader(tee)
-			if err != nil {
-				rec.RecordError(err)
-				return
-			}
-			defer gz.Close()
+// VerifyBackup checks the integrity of a backup, without restoring
+// it: all the files are read and decompressed, and their checksums
+// compared with the MANIFEST. If name is empty, the most recent
+// complete backup of the bucket is checked. Mismatched files are
+// returned in a *BackupCorruptionError.
+func VerifyBackup(bucket, name string, verifyConcurrency int, bandwidthLimit int64) error {
+	bs, err := backupstorage.GetBackupStorage()
+	if err != nil {
+		return err
+	}
+	bhs, err := bs.ListBackups(bucket)
+	if err != nil {
+		return fmt.Errorf("ListBackups failed: %v", err)
+	}
+	var bh backupstorage.BackupHandle
+	for i := len(bhs) - 1; i >= 0; i-- {
+		if (name == "" && !backupstorage.IsPartialBackup(bhs[i])) || bhs[i].Name() == name {
+			bh = bhs[i]
+			break
+		}
+	}
+	if bh == nil {
+		if name == "" {
+			return ErrNoBackup
+		}
+		return fmt.Errorf("no backup %v in bucket %v", name, bucket)
+	}
 
-			// copy the data. Will also write to the hasher
-			if _, err = io.Copy(dst, gz); err != nil {
-				rec.RecordError(err)
-				return
-			}
+	data, bm, err := readManifest(bh)
+	if err != nil {
+		return err
+	}
+	be, err := getBackupEngine(bm.BackupMethod)
+	if err != nil {
+		return err
+	}
+	log.Infof("VerifyBackup: checking %v backup %v %v", bm.BackupMethod, bh.Bucket(), bh.Name())
+	return be.ExecuteVerify(bh, data, verifyConcurrency, bandwidthLimit)
+}
 
-			// check the hash
-			hash := hasher.HashString()
-			if hash != fe.Hash {
-				rec.RecordError(fmt.Errorf("hash mismatch for %v, got %v expected %v", fe.Name, hash, fe.Hash))
-				return
-			}
+// BackupInfo describes a backup of a bucket. Manifest is nil if the
+// MANIFEST of the backup cannot be read, e.g. because the backup is
+// partial, and Error says why.
+type BackupInfo struct {
+	Name     string
+	Manifest *BackupManifest
+	Error    string
+}
 
-			// flush the buffer
-			dst.Flush()
-		}(i, fe)
+// ListBackups returns the backups of a bucket, oldest first, with the
+// common part of their MANIFEST.
+func ListBackups(bs backupstorage.BackupStorage, bucket string) ([]*BackupInfo, error) {
+	bhs, err := bs.ListBackups(bucket)
+	if err != nil {
+		return nil, fmt.Errorf("ListBackups failed: %v", err)
 	}
-	wg.Wait()
-	return rec.Error()
+	result := make([]*BackupInfo, len(bhs))
+	for i, bh := range bhs {
+		result[i] = &BackupInfo{Name: bh.Name()}
+		if _, bm, err := readManifest(bh); err == nil {
+			result[i].Manifest = bm
+		} else {
+			result[i].Error = err.Error()
+		}
+	}
+	return result, nil
 }
 
-// Restore is the main entry point for backup restore.  If there is no
-// appropriate backup on the BackupStorage, Restore logs an error
-// and returns ErrNoBackup. Any other error is returned.
-func Restore(mysqld MysqlDaemon, bucket string, restoreConcurrency int, hookExtraEnv map[string]string) (proto.ReplicationPosition, error) {
-	// find the right backup handle: most recent one, with a MANIFEST
-	log.Infof("Restore: looking for a suitable backup to restore")
+// findBackupToRestore returns the most recent backup of the bucket
+// with a MANIFEST, with the raw and the common MANIFEST content, and
+// the engine that took it. It returns ErrNoBackup if there is none.
+func findBackupToRestore(logger logutil.Logger, bucket string) (backupstorage.BackupHandle, []byte, *BackupManifest, BackupEngine, error) {
 	bs, err := backupstorage.GetBackupStorage()
 	if err != nil {
-		return proto.ReplicationPosition{}, err
+		return nil, nil, nil, nil, err
 	}
 	bhs, err := bs.ListBackups(bucket)
 	if err != nil {
-		return proto.ReplicationPosition{}, fmt.Errorf("ListBackups failed: %v", err)
+		return nil, nil, nil, nil, fmt.Errorf("ListBackups failed: %v", err)
 	}
 	toRestore := len(bhs) - 1
 	var bh backupstorage.BackupHandle
-	var bm BackupManifest
+	var data []byte
+	var bm *BackupManifest
 	for toRestore >= 0 {
 		bh = bhs[toRestore]
-		if rc, err := bh.ReadFile(backupManifest); err == nil {
-			dec := json.NewDecoder(rc)
-			err := dec.Decode(&bm)
-			rc.Close()
-			if err != nil {
-				log.Warningf("Possibly incomplete backup %v in bucket %v on BackupStorage (cannot JSON decode MANIFEST: %v)", bh.Name(), bucket, err)
-			} else {
-				log.Infof("Restore: found backup %v %v to restore with %v files", bh.Bucket(), bh.Name(), len(bm.FileEntries))
-				break
-			}
-		} else {
-			log.Warningf("Possibly incomplete backup %v in bucket %v on BackupStorage (cannot read MANIFEST)", bh.Name(), bucket)
+		data, bm, err = readManifest(bh)
+		if err == nil {
+			logger.Infof("Restore: found backup %v %v to restore", bh.Bucket(), bh.Name())
+			break
 		}
+		logger.Warningf("Possibly incomplete backup %v in bucket %v on BackupStorage (%v)", bh.Name(), bucket, err)
 		toRestore--
 	}
 	if toRestore < 0 {
-		log.Errorf("No backup to restore on BackupStorage for bucket %v", bucket)
-		return proto.ReplicationPosition{}, ErrNoBackup
+		logger.Errorf("No backup to restore on BackupStorage for bucket %v", bucket)
+		return nil, nil, nil, nil, ErrNoBackup
 	}
 
-	log.Infof("Restore: checking no existing data is present")
+	// find the engine that took the backup
+	be, err := getBackupEngine(bm.BackupMethod)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	return bh, data, bm, be, nil
+}
+
+// CheckRestore runs the checks Restore does before it changes
+// anything: it returns ErrNoBackup if there is no appropriate backup
+// on the BackupStorage, and an error if mysqld already has data.
+// Callers can use it to refuse a restore before they change their
+// own state for it.
+func CheckRestore(mysqld MysqlDaemon, logger logutil.Logger, bucket string) error {
+	if _, _, _, _, err := findBackupToRestore(logger, bucket); err != nil {
+		return err
+	}
+	return checkNoDB(mysqld)
+}
+
+// Restore is the main entry point for backup restore.  If there is no
+// appropriate backup on the BackupStorage, Restore logs an error
+// and returns ErrNoBackup. Any other error is returned.
+// The backup is restored by the engine that took it.
+// restoreConcurrency files are copied at the same time, using at most
+// bandwidthLimit bytes per second overall (0 for no limit).
+// The progress is logged to logger.
+func Restore(mysqld MysqlDaemon, logger logutil.Logger, bucket string, restoreConcurrency int, bandwidthLimit int64, hookExtraEnv map[string]string) (proto.ReplicationPosition, error) {
+	// find the right backup handle: most recent one, with a MANIFEST
+	logger.Infof("Restore: looking for a suitable backup to restore")
+	bh, data, bm, be, err := findBackupToRestore(logger, bucket)
+	if err != nil {
+		return proto.ReplicationPosition{}, err
+	}
+
+	logger.Infof("Restore: checking no existing data is present")
 	if err := checkNoDB(mysqld); err != nil {
 		return proto.ReplicationPosition{}, err
 	}
 
-	log.Infof("Restore: shutdown mysqld")
-	if err := mysqld.Shutdown(true, MysqlWaitTime); err != nil {
+	logger.Infof("Restore: shutdown mysqld")
+	if err := shutdownMysqld(mysqld); err != nil {
 		return proto.ReplicationPosition{}, err
 	}
 
-	log.Infof("Restore: copying all files")
-	if err := restoreFiles(mysqld.Cnf(), bh, bm.FileEntries, restoreConcurrency); err != nil {
+	logger.Infof("Restore: restoring %v backup", bm.BackupMethod)
+	pos, err := be.ExecuteRestore(mysqld, bh, data, restoreConcurrency, bandwidthLimit)
+	if err != nil {
 		return proto.ReplicationPosition{}, err
 	}
 
-	log.Infof("Restore: restart mysqld")
-	if err := mysqld.Start(MysqlWaitTime); err != nil {
+	logger.Infof("Restore: restart mysqld")
+	if err := startMysqld(mysqld); err != nil {
 		return proto.ReplicationPosition{}, err
 	}
 
-	return bm.ReplicationPosition, nil
+	return pos, nil
 }
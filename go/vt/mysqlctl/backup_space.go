@@ -0,0 +1,66 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mysqlctl
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/youtube/vitess/go/vt/mysqlctl/backupstorage"
+)
+
+// This file contains the disk space check done before a backup
+// starts, so it doesn't fail halfway when the BackupStorage fills up.
+
+var (
+	backupMaxDiskUsage = flag.Float64("backup_max_disk_usage", 0.95, "refuse to start a backup if the backup storage would be more than this fraction full once it is taken, 0 disables the check")
+)
+
+// estimateBackupSize returns the total size of the database files a
+// backup would contain. The backup storage usually needs less, as
+// the files are compressed.
+func estimateBackupSize(cnf *Mycnf) (uint64, error) {
+	fes, err := findFilesTobackup(cnf)
+	if err != nil {
+		return 0, err
+	}
+	var size uint64
+	for _, fe := range fes {
+		name, err := fe.fullPath(cnf)
+		if err != nil {
+			return 0, err
+		}
+		fi, err := os.Stat(name)
+		if err != nil {
+			return 0, err
+		}
+		size += uint64(fi.Size())
+	}
+	return size, nil
+}
+
+// checkBackupSpace returns an error if a backup of the given size
+// would leave the storage of the bucket more than maxUsage full.
+// The check is skipped if maxUsage is 0, or if the storage cannot
+// report its space.
+func checkBackupSpace(bs backupstorage.BackupStorage, bucket string, size uint64, maxUsage float64) error {
+	sc, ok := bs.(backupstorage.SpaceChecker)
+	if !ok || maxUsage <= 0 {
+		return nil
+	}
+	total, available, err := sc.Space(bucket)
+	if err != nil {
+		return fmt.Errorf("cannot get the available space of the backup storage: %v", err)
+	}
+	if total == 0 {
+		return fmt.Errorf("the backup storage reports no space")
+	}
+	usage := float64(total-available+size) / float64(total)
+	if size > available || usage > maxUsage {
+		return fmt.Errorf("not enough space in the backup storage: the backup needs up to %v bytes, %v of %v bytes are available, the storage would be %.1f%% full, over the %.1f%% of -backup_max_disk_usage", size, available, total, usage*100, maxUsage*100)
+	}
+	return nil
+}
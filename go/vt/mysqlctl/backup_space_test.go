@@ -0,0 +1,89 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mysqlctl
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/youtube/vitess/go/vt/mysqlctl/backupstorage"
+)
+
+// spaceBackupStorage is a BackupStorage that only reports its space
+type spaceBackupStorage struct {
+	backupstorage.BackupStorage
+	total, available uint64
+}
+
+func (sbs *spaceBackupStorage) Space(bucket string) (uint64, uint64, error) {
+	return sbs.total, sbs.available, nil
+}
+
+func TestCheckBackupSpace(t *testing.T) {
+	bs := &spaceBackupStorage{total: 1000, available: 400}
+	for _, tc := range []struct {
+		size     uint64
+		maxUsage float64
+		ok       bool
+	}{
+		{size: 100, maxUsage: 0.9, ok: true},
+		{size: 300, maxUsage: 0.9, ok: true},
+		{size: 350, maxUsage: 0.9, ok: false},
+		{size: 500, maxUsage: 1, ok: false},
+		{size: 500, maxUsage: 0, ok: true},
+	} {
+		err := checkBackupSpace(bs, "ks/0", tc.size, tc.maxUsage)
+		if tc.ok && err != nil {
+			t.Errorf("checkBackupSpace(%v, %v) failed: %v", tc.size, tc.maxUsage, err)
+		}
+		if !tc.ok && (err == nil || !strings.Contains(err.Error(), "not enough space")) {
+			t.Errorf("checkBackupSpace(%v, %v) returned %v", tc.size, tc.maxUsage, err)
+		}
+	}
+
+	// storages that cannot report their space are not checked
+	if err := checkBackupSpace(struct{ backupstorage.BackupStorage }{}, "ks/0", 500, 0.9); err != nil {
+		t.Errorf("checkBackupSpace without a SpaceChecker failed: %v", err)
+	}
+}
+
+func TestEstimateBackupSize(t *testing.T) {
+	root, err := ioutil.TempDir("", "backuptest")
+	if err != nil {
+		t.Fatalf("os.TempDir failed: %v", err)
+	}
+	defer os.RemoveAll(root)
+
+	cnf := &Mycnf{
+		InnodbDataHomeDir:     path.Join(root, "innodb_data"),
+		InnodbLogGroupHomeDir: path.Join(root, "innodb_log"),
+		DataDir:               path.Join(root, "data"),
+	}
+	files := map[string]string{
+		path.Join(cnf.InnodbDataHomeDir, "innodb_data_1"):    "innodb data 1 contents",
+		path.Join(cnf.InnodbLogGroupHomeDir, "innodb_log_1"): "innodb log 1 contents",
+		path.Join(cnf.DataDir, "vt_db", "db.opt"):            "db opt file",
+		path.Join(cnf.DataDir, "not_a_db", "file"):           "not backed up",
+	}
+	for name, contents := range files {
+		if err := os.MkdirAll(path.Dir(name), os.ModePerm); err != nil {
+			t.Fatalf("failed to create directory for %v: %v", name, err)
+		}
+		if err := ioutil.WriteFile(name, []byte(contents), os.ModePerm); err != nil {
+			t.Fatalf("failed to write file %v: %v", name, err)
+		}
+	}
+
+	size, err := estimateBackupSize(cnf)
+	if err != nil {
+		t.Fatalf("estimateBackupSize failed: %v", err)
+	}
+	if want := uint64(len("innodb data 1 contents") + len("innodb log 1 contents") + len("db opt file")); size != want {
+		t.Errorf("estimateBackupSize = %v, want %v", size, want)
+	}
+}
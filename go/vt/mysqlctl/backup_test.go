@@ -10,6 +10,7 @@ import (
 	"path"
 	"reflect"
 	"sort"
+	"syscall"
 	"testing"
 )
 
@@ -91,3 +92,128 @@ type forTest []FileEntry
 func (f forTest) Len() int           { return len(f) }
 func (f forTest) Swap(i, j int)      { f[i], f[j] = f[j], f[i] }
 func (f forTest) Less(i, j int) bool { return f[i].Base+f[i].Name < f[j].Base+f[j].Name }
+
+func TestMoveStagedFiles(t *testing.T) {
+	root, err := ioutil.TempDir("", "backuptest")
+	if err != nil {
+		t.Fatalf("os.TempDir failed: %v", err)
+	}
+	defer os.RemoveAll(root)
+
+	// the innodb data and log directories are the same here
+	cnf := &Mycnf{
+		InnodbDataHomeDir:     path.Join(root, "innodb"),
+		InnodbLogGroupHomeDir: path.Join(root, "innodb"),
+		DataDir:               path.Join(root, "data"),
+	}
+	staging := restoreStagingCnf(cnf)
+	files := map[string]string{
+		// existing files, some are replaced
+		path.Join(cnf.InnodbDataHomeDir, "ibdata1"):         "old ibdata1",
+		path.Join(cnf.DataDir, "auto.cnf"):                  "auto.cnf",
+		path.Join(cnf.DataDir, "vt_db", "t1.frm"):           "old t1",
+		path.Join(cnf.DataDir, "vt_db", "t2.frm"):           "old t2",
+		path.Join(cnf.DataDir, "mysql", "user.frm"):         "old mysql.user",
+		path.Join(staging.InnodbDataHomeDir, "ibdata1"):     "new ibdata1",
+		path.Join(staging.InnodbDataHomeDir, "ib_logfile0"): "new ib_logfile0",
+		path.Join(staging.DataDir, "vt_db", "t1.frm"):       "new t1",
+	}
+	for name, content := range files {
+		if err := os.MkdirAll(path.Dir(name), os.ModePerm); err != nil {
+			t.Fatalf("MkdirAll failed: %v", err)
+		}
+		if err := ioutil.WriteFile(name, []byte(content), os.ModePerm); err != nil {
+			t.Fatalf("WriteFile failed: %v", err)
+		}
+	}
+
+	// the staged files are not backed up
+	fes, err := findFilesTobackup(cnf)
+	if err != nil {
+		t.Fatalf("findFilesTobackup failed: %v", err)
+	}
+	for _, fe := range fes {
+		if path.Base(fe.Name) == restoreStagingDir {
+			t.Errorf("findFilesTobackup returned the staging directory: %v", fe)
+		}
+	}
+
+	if err := moveStagedFiles(cnf, staging); err != nil {
+		t.Fatalf("moveStagedFiles failed: %v", err)
+	}
+	for name, want := range map[string]string{
+		path.Join(cnf.InnodbDataHomeDir, "ibdata1"):     "new ibdata1",
+		path.Join(cnf.InnodbDataHomeDir, "ib_logfile0"): "new ib_logfile0",
+		path.Join(cnf.DataDir, "auto.cnf"):              "auto.cnf",
+		path.Join(cnf.DataDir, "vt_db", "t1.frm"):       "new t1",
+		path.Join(cnf.DataDir, "mysql", "user.frm"):     "old mysql.user",
+	} {
+		if data, err := ioutil.ReadFile(name); err != nil || string(data) != want {
+			t.Errorf("%v has %q %v, want %q", name, data, err, want)
+		}
+	}
+
+	// the database directories are replaced as a whole, and the
+	// staging and replaced directories are gone
+	for _, name := range []string{
+		path.Join(cnf.DataDir, "vt_db", "t2.frm"),
+		staging.InnodbDataHomeDir,
+		staging.DataDir,
+		path.Join(cnf.InnodbDataHomeDir, restoreReplacedDir),
+		path.Join(cnf.DataDir, restoreReplacedDir),
+	} {
+		if _, err := os.Stat(name); !os.IsNotExist(err) {
+			t.Errorf("%v should not exist: %v", name, err)
+		}
+	}
+}
+
+func TestMoveStagedFilesSymlinkedDataDir(t *testing.T) {
+	root, err := ioutil.TempDir("", "backuptest")
+	if err != nil {
+		t.Fatalf("os.TempDir failed: %v", err)
+	}
+	defer os.RemoveAll(root)
+	// the data directory is a symlink to another file system
+	volume, err := ioutil.TempDir("/dev/shm", "backuptest")
+	if err != nil {
+		t.Skipf("no /dev/shm: %v", err)
+	}
+	defer os.RemoveAll(volume)
+	var rootStat, volumeStat syscall.Stat_t
+	if syscall.Stat(root, &rootStat) != nil || syscall.Stat(volume, &volumeStat) != nil || rootStat.Dev == volumeStat.Dev {
+		t.Skipf("%v and %v are on the same file system", root, volume)
+	}
+
+	cnf := &Mycnf{
+		InnodbDataHomeDir:     path.Join(root, "innodb"),
+		InnodbLogGroupHomeDir: path.Join(root, "innodb"),
+		DataDir:               path.Join(root, "data"),
+	}
+	if err := os.Symlink(volume, cnf.DataDir); err != nil {
+		t.Fatalf("Symlink failed: %v", err)
+	}
+	staging := restoreStagingCnf(cnf)
+	for name, content := range map[string]string{
+		path.Join(cnf.DataDir, "vt_db", "t1.frm"):       "old t1",
+		path.Join(staging.DataDir, "vt_db", "t1.frm"):   "new t1",
+		path.Join(staging.InnodbDataHomeDir, "ibdata1"): "new ibdata1",
+	} {
+		if err := os.MkdirAll(path.Dir(name), os.ModePerm); err != nil {
+			t.Fatalf("MkdirAll failed: %v", err)
+		}
+		if err := ioutil.WriteFile(name, []byte(content), os.ModePerm); err != nil {
+			t.Fatalf("WriteFile failed: %v", err)
+		}
+	}
+
+	if err := moveStagedFiles(cnf, staging); err != nil {
+		t.Fatalf("moveStagedFiles failed: %v", err)
+	}
+	if data, err := ioutil.ReadFile(path.Join(volume, "vt_db", "t1.frm")); err != nil || string(data) != "new t1" {
+		t.Errorf("the restored file is not in the symlinked volume: %q %v", data, err)
+	}
+	if fi, err := os.Lstat(cnf.DataDir); err != nil || fi.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("the data directory should still be a symlink: %v %v", fi, err)
+	}
+}
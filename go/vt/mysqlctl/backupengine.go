@@ -0,0 +1,64 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mysqlctl
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/youtube/vitess/go/vt/logutil"
+	"github.com/youtube/vitess/go/vt/mysqlctl/backupstorage"
+	"github.com/youtube/vitess/go/vt/mysqlctl/proto"
+)
+
+// This file contains the BackupEngine interface, and the registry
+// of its implementations.
+
+var (
+	// BackupEngineImplementation is the implementation to use
+	// for new backups. Restores use the engine recorded in the
+	// backup MANIFEST. Exported for test purposes.
+	BackupEngineImplementation = flag.String("backup_engine_implementation", builtinBackupEngineName, "which implementation to use for the backup method, builtin or xtrabackup")
+)
+
+// BackupEngine is the interface to take a backup with a given engine.
+type BackupEngine interface {
+	// ExecuteBackup takes a backup of mysqld into bh, and writes
+	// the MANIFEST. It is responsible for leaving mysqld in the
+	// state it was in.
+	ExecuteBackup(mysqld MysqlDaemon, logger logutil.Logger, bh backupstorage.BackupHandle, backupConcurrency int, bandwidthLimit int64, hookExtraEnv map[string]string) error
+
+	// ExecuteRestore restores the backup in bh, described by the
+	// MANIFEST content, while mysqld is shut down. It returns the
+	// replication position of the backup. The files are checked
+	// against the MANIFEST before they replace the existing data.
+	ExecuteRestore(mysqld MysqlDaemon, bh backupstorage.BackupHandle, manifest []byte, restoreConcurrency int, bandwidthLimit int64) (proto.ReplicationPosition, error)
+
+	// ExecuteVerify reads all the files of the backup in bh, and
+	// checks them against the MANIFEST content. The mismatched
+	// files are returned in a *BackupCorruptionError.
+	ExecuteVerify(bh backupstorage.BackupHandle, manifest []byte, verifyConcurrency int, bandwidthLimit int64) error
+
+	// ShouldDrainForBackup returns true if the tablet should stop
+	// serving while the backup is taken.
+	ShouldDrainForBackup() bool
+}
+
+// BackupEngineMap contains the registered implementations for BackupEngine
+var BackupEngineMap = make(map[string]BackupEngine)
+
+// GetBackupEngine returns the BackupEngine to use for new backups.
+// Should be called after flags have been initialized.
+func GetBackupEngine() (BackupEngine, error) {
+	return getBackupEngine(*BackupEngineImplementation)
+}
+
+func getBackupEngine(name string) (BackupEngine, error) {
+	be, ok := BackupEngineMap[name]
+	if !ok {
+		return nil, fmt.Errorf("no registered implementation of BackupEngine named %v", name)
+	}
+	return be, nil
+}
@@ -0,0 +1,138 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package backupstorage
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/golang/glog"
+)
+
+// This file contains the helpers shared by all the implementations,
+// and the retention logic.
+
+const (
+	// ManifestFileName is the file a backup engine adds last to a
+	// backup. A backup without it is partial: it is still running,
+	// or it failed without being aborted.
+	ManifestFileName = "MANIFEST"
+
+	// TimeFormat is the format of the time in backup names.
+	TimeFormat = "2006-01-02.150405"
+)
+
+// BackupName returns the name of a backup taken by a tablet at the
+// provided time.
+func BackupName(tabletAlias string, startTime time.Time) string {
+	return fmt.Sprintf("%v.%v", tabletAlias, startTime.UTC().Format(TimeFormat))
+}
+
+// ParseBackupName returns the tablet alias and start time of a backup
+// from its name.
+func ParseBackupName(name string) (string, time.Time, error) {
+	i := len(name) - len(TimeFormat) - 1
+	if i < 1 || name[i] != '.' {
+		return "", time.Time{}, fmt.Errorf("invalid backup name %v: expecting <tablet alias>.<%v>", name, TimeFormat)
+	}
+	startTime, err := time.Parse(TimeFormat, name[i+1:])
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("invalid backup name %v: %v", name, err)
+	}
+	return name[:i], startTime, nil
+}
+
+// backupsByStartTime sorts backups by the start time in their names.
+// Backups with names we cannot parse come first, by name.
+type backupsByStartTime struct {
+	bhs   []BackupHandle
+	times []time.Time
+}
+
+func (b backupsByStartTime) Len() int {
+	return len(b.bhs)
+}
+
+func (b backupsByStartTime) Swap(i, j int) {
+	b.bhs[i], b.bhs[j] = b.bhs[j], b.bhs[i]
+	b.times[i], b.times[j] = b.times[j], b.times[i]
+}
+
+func (b backupsByStartTime) Less(i, j int) bool {
+	if !b.times[i].Equal(b.times[j]) {
+		return b.times[i].Before(b.times[j])
+	}
+	return b.bhs[i].Name() < b.bhs[j].Name()
+}
+
+// SortBackups sorts backups by start time, oldest first, as
+// ListBackups returns them.
+func SortBackups(bhs []BackupHandle) {
+	b := backupsByStartTime{
+		bhs:   bhs,
+		times: make([]time.Time, len(bhs)),
+	}
+	for i, bh := range bhs {
+		// unparseable names keep the zero time
+		_, b.times[i], _ = ParseBackupName(bh.Name())
+	}
+	sort.Sort(b)
+}
+
+// IsPartialBackup returns true if the backup doesn't have a MANIFEST.
+func IsPartialBackup(bh BackupHandle) bool {
+	rc, err := bh.ReadFile(ManifestFileName)
+	if err != nil {
+		return true
+	}
+	rc.Close()
+	return false
+}
+
+// RemoveOldBackups keeps the keep most recent complete backups of a
+// bucket, and removes the older ones. It also removes the partial
+// backups that started before the oldest backup it keeps: more recent
+// ones may still be running. It returns the names of the removed
+// backups.
+func RemoveOldBackups(bs BackupStorage, bucket string, keep int) ([]string, error) {
+	if keep < 1 {
+		return nil, fmt.Errorf("RemoveOldBackups needs to keep at least one backup, not %v", keep)
+	}
+	bhs, err := bs.ListBackups(bucket)
+	if err != nil {
+		return nil, fmt.Errorf("ListBackups failed: %v", err)
+	}
+
+	// bhs is oldest first, so the first complete backup we keep
+	// is the keep-th one from the end
+	complete := 0
+	oldestKept := len(bhs)
+	for i := len(bhs) - 1; i >= 0 && complete < keep; i-- {
+		if !IsPartialBackup(bhs[i]) {
+			complete++
+			oldestKept = i
+		}
+	}
+	if complete < keep {
+		return nil, nil
+	}
+
+	var removed []string
+	var errs []string
+	for _, bh := range bhs[:oldestKept] {
+		log.Infof("Removing old backup %v/%v", bucket, bh.Name())
+		if err := bs.RemoveBackup(bucket, bh.Name()); err != nil {
+			errs = append(errs, fmt.Sprintf("%v: %v", bh.Name(), err))
+			continue
+		}
+		removed = append(removed, bh.Name())
+	}
+	if len(errs) > 0 {
+		return removed, fmt.Errorf("cannot remove some backups: %v", strings.Join(errs, ", "))
+	}
+	return removed, nil
+}
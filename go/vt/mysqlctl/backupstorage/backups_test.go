@@ -0,0 +1,31 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package backupstorage
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseBackupName(t *testing.T) {
+	startTime := time.Date(2015, 6, 1, 10, 11, 12, 0, time.UTC)
+	name := BackupName("cell-0000000100", startTime)
+	if name != "cell-0000000100.2015-06-01.101112" {
+		t.Errorf("BackupName returned %v", name)
+	}
+	alias, got, err := ParseBackupName(name)
+	if err != nil {
+		t.Fatalf("ParseBackupName(%v) failed: %v", name, err)
+	}
+	if alias != "cell-0000000100" || !got.Equal(startTime) {
+		t.Errorf("ParseBackupName(%v) = %v, %v", name, alias, got)
+	}
+
+	for _, invalid := range []string{"", "2015-06-01.101112", ".2015-06-01.101112", "cell-0000000100-2015-06-01.101112", "cell-0000000100.2015-13-01.101112"} {
+		if _, _, err := ParseBackupName(invalid); err == nil {
+			t.Errorf("ParseBackupName(%v) should have failed", invalid)
+		}
+	}
+}
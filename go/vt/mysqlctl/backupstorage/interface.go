@@ -55,8 +55,9 @@ type BackupStorage interface {
 	// ListBackups returns all the backups in a bucket.  The
 	// returned backups are read-only (ReadFile can be called, but
 	// AddFile/EndBackup/AbortBackup cannot).
-	// The backups are string-sorted by Name(), ascending (ends up
-	// being the oldest backup first).
+	// The backups are sorted by the start time in their name
+	// (see SortBackups), oldest first. They include the partial
+	// backups (see IsPartialBackup).
 	ListBackups(bucket string) ([]BackupHandle, error)
 
 	// StartBackup creates a new backup with the given name.  If a
@@ -71,6 +72,16 @@ type BackupStorage interface {
 	RemoveBackup(bucket, name string) error
 }
 
+// SpaceChecker is implemented by the BackupStorage implementations
+// that can tell how much space is left for new backups. Backups are
+// refused when they would fill the storage.
+type SpaceChecker interface {
+	// Space returns the size of the storage that would hold new
+	// backups for the bucket, and how much of it is available,
+	// in bytes.
+	Space(bucket string) (total, available uint64, err error)
+}
+
 // BackupStorageMap contains the registered implementations for BackupStorage
 var BackupStorageMap = make(map[string]BackupStorage)
 
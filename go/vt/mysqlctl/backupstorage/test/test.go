@@ -0,0 +1,221 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package test contains utilities to test backupstorage.BackupStorage
+// implementations. If you are testing your implementation, you will
+// want to call CheckAll in your test method, with an empty storage.
+package test
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/youtube/vitess/go/vt/mysqlctl/backupstorage"
+)
+
+// CheckAll runs all the tests on an empty BackupStorage.
+func CheckAll(t *testing.T, bs backupstorage.BackupStorage) {
+	CheckListBackups(t, bs)
+	CheckFileContents(t, bs)
+	CheckRemoveOldBackups(t, bs)
+}
+
+// startTime returns the time of the i-th test backup.
+func startTime(i int) time.Time {
+	return time.Date(2015, 6, 1, 10, 0, 0, 0, time.UTC).Add(time.Duration(i) * time.Hour)
+}
+
+// addBackup adds a backup with only a file, and a MANIFEST if
+// complete is true.
+func addBackup(t *testing.T, bs backupstorage.BackupStorage, bucket, name string, complete bool) {
+	bh, err := bs.StartBackup(bucket, name)
+	if err != nil {
+		t.Fatalf("StartBackup(%v, %v) failed: %v", bucket, name, err)
+	}
+	files := []string{"file"}
+	if complete {
+		files = append(files, backupstorage.ManifestFileName)
+	}
+	for _, f := range files {
+		wc, err := bh.AddFile(f)
+		if err != nil {
+			t.Fatalf("AddFile(%v) failed: %v", f, err)
+		}
+		if _, err := wc.Write([]byte("contents of " + f)); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+		if err := wc.Close(); err != nil {
+			t.Fatalf("Close failed: %v", err)
+		}
+	}
+	if err := bh.EndBackup(); err != nil {
+		t.Fatalf("EndBackup failed: %v", err)
+	}
+}
+
+func listBackupNames(t *testing.T, bs backupstorage.BackupStorage, bucket string) []string {
+	bhs, err := bs.ListBackups(bucket)
+	if err != nil {
+		t.Fatalf("ListBackups(%v) failed: %v", bucket, err)
+	}
+	var names []string
+	for _, bh := range bhs {
+		if bh.Bucket() != bucket {
+			t.Errorf("backup %v is in bucket %v, not %v", bh.Name(), bh.Bucket(), bucket)
+		}
+		names = append(names, bh.Name())
+	}
+	return names
+}
+
+// CheckListBackups checks backups are listed by start time, and the
+// partial ones can be identified.
+func CheckListBackups(t *testing.T, bs backupstorage.BackupStorage) {
+	bucket := "list/0"
+	if names := listBackupNames(t, bs, bucket); len(names) != 0 {
+		t.Fatalf("ListBackups on an empty storage returned %v", names)
+	}
+
+	// the names don't sort by time as strings
+	second := backupstorage.BackupName("cell1-0000000100", startTime(1))
+	first := backupstorage.BackupName("cell2-0000000200", startTime(0))
+	addBackup(t, bs, bucket, second, true)
+	addBackup(t, bs, bucket, first, false)
+	if got, want := listBackupNames(t, bs, bucket), []string{first, second}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ListBackups returned %v, want %v", got, want)
+	}
+
+	if _, err := bs.StartBackup(bucket, second); err == nil {
+		t.Errorf("StartBackup of an existing backup should have failed")
+	}
+
+	bhs, err := bs.ListBackups(bucket)
+	if err != nil {
+		t.Fatalf("ListBackups failed: %v", err)
+	}
+	if !backupstorage.IsPartialBackup(bhs[0]) || backupstorage.IsPartialBackup(bhs[1]) {
+		t.Errorf("only %v should be partial", first)
+	}
+	if _, err := bhs[0].AddFile("test"); err == nil {
+		t.Errorf("was able to AddFile to read-only backup")
+	}
+
+	// abort and remove
+	bh, err := bs.StartBackup(bucket, "aborted")
+	if err != nil {
+		t.Fatalf("StartBackup failed: %v", err)
+	}
+	if wc, err := bh.AddFile("file"); err == nil {
+		wc.Write([]byte("some data"))
+		wc.Close()
+	}
+	if err := bh.AbortBackup(); err != nil {
+		t.Fatalf("AbortBackup failed: %v", err)
+	}
+	if err := bs.RemoveBackup(bucket, first); err != nil {
+		t.Fatalf("RemoveBackup failed: %v", err)
+	}
+	if got, want := listBackupNames(t, bs, bucket), []string{second}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ListBackups returned %v, want %v", got, want)
+	}
+}
+
+// CheckFileContents checks files of different sizes are stored
+// correctly, including files written in many calls.
+func CheckFileContents(t *testing.T, bs backupstorage.BackupStorage) {
+	bucket := "contents/0"
+	name := backupstorage.BackupName("cell-0000000100", startTime(0))
+	contents := map[string][]byte{
+		"empty": nil,
+		"small": []byte("contents of the small file"),
+		"big":   bytes.Repeat([]byte("0123456789"), 100000),
+	}
+
+	bh, err := bs.StartBackup(bucket, name)
+	if err != nil {
+		t.Fatalf("StartBackup failed: %v", err)
+	}
+	for f, data := range contents {
+		wc, err := bh.AddFile(f)
+		if err != nil {
+			t.Fatalf("AddFile(%v) failed: %v", f, err)
+		}
+		for start := 0; start < len(data); start += 3333 {
+			end := start + 3333
+			if end > len(data) {
+				end = len(data)
+			}
+			if _, err := wc.Write(data[start:end]); err != nil {
+				t.Fatalf("Write(%v) failed: %v", f, err)
+			}
+		}
+		if err := wc.Close(); err != nil {
+			t.Fatalf("Close(%v) failed: %v", f, err)
+		}
+	}
+	if _, err := bh.ReadFile("small"); err == nil {
+		t.Errorf("was able to ReadFile on read-write backup")
+	}
+	if err := bh.EndBackup(); err != nil {
+		t.Fatalf("EndBackup failed: %v", err)
+	}
+
+	bhs, err := bs.ListBackups(bucket)
+	if err != nil || len(bhs) != 1 {
+		t.Fatalf("ListBackups returned %v %v", bhs, err)
+	}
+	for f, data := range contents {
+		rc, err := bhs[0].ReadFile(f)
+		if err != nil {
+			t.Fatalf("ReadFile(%v) failed: %v", f, err)
+		}
+		got, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatalf("ReadAll(%v) failed: %v", f, err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Errorf("%v: got back %v bytes that don't match the %v original ones", f, len(got), len(data))
+		}
+	}
+}
+
+// CheckRemoveOldBackups checks the retention logic.
+func CheckRemoveOldBackups(t *testing.T, bs backupstorage.BackupStorage) {
+	bucket := "retention/0"
+	var names []string
+	for i, complete := range []bool{true, false, true, true, false} {
+		name := backupstorage.BackupName(fmt.Sprintf("cell-%010d", 100+i), startTime(i))
+		addBackup(t, bs, bucket, name, complete)
+		names = append(names, name)
+	}
+
+	if _, err := backupstorage.RemoveOldBackups(bs, bucket, 0); err == nil {
+		t.Errorf("RemoveOldBackups should refuse to remove all backups")
+	}
+
+	// not enough complete backups, nothing is removed
+	removed, err := backupstorage.RemoveOldBackups(bs, bucket, 4)
+	if err != nil || len(removed) != 0 {
+		t.Errorf("RemoveOldBackups(4) = %v, %v", removed, err)
+	}
+
+	// keeping two complete backups removes the first complete one
+	// and the partial one before the oldest kept backup, but not
+	// the last partial one that may still be running
+	removed, err = backupstorage.RemoveOldBackups(bs, bucket, 2)
+	if err != nil {
+		t.Fatalf("RemoveOldBackups(2) failed: %v", err)
+	}
+	if want := names[:2]; !reflect.DeepEqual(removed, want) {
+		t.Errorf("RemoveOldBackups(2) removed %v, want %v", removed, want)
+	}
+	if got, want := listBackupNames(t, bs, bucket), names[2:]; !reflect.DeepEqual(got, want) {
+		t.Errorf("ListBackups after RemoveOldBackups returned %v, want %v", got, want)
+	}
+}
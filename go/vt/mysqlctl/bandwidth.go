@@ -0,0 +1,101 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mysqlctl
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// This file contains the helpers to limit the bandwidth used by
+// backups and restores, and to report their progress.
+
+// bandwidthLimiter is a token bucket shared by all the files of a
+// backup or restore, so the limit applies to the total transfer rate
+// regardless of the concurrency.
+type bandwidthLimiter struct {
+	// bytesPerSecond is the refill rate, and the bucket size
+	bytesPerSecond int64
+
+	// mu protects the following fields
+	mu     sync.Mutex
+	tokens int64
+	last   time.Time
+}
+
+// newBandwidthLimiter returns a limiter for the provided rate, or nil
+// if bytesPerSecond is not positive (no limit).
+func newBandwidthLimiter(bytesPerSecond int64) *bandwidthLimiter {
+	if bytesPerSecond <= 0 {
+		return nil
+	}
+	return &bandwidthLimiter{
+		bytesPerSecond: bytesPerSecond,
+		tokens:         bytesPerSecond,
+		last:           time.Now(),
+	}
+}
+
+// take blocks until n bytes can be transferred. A nil limiter
+// doesn't block.
+func (bl *bandwidthLimiter) take(n int64) {
+	if bl == nil {
+		return
+	}
+	for n > 0 {
+		// we never take more than the bucket size at once,
+		// so large reads still make progress
+		chunk := n
+		if chunk > bl.bytesPerSecond {
+			chunk = bl.bytesPerSecond
+		}
+
+		bl.mu.Lock()
+		now := time.Now()
+		bl.tokens += int64(now.Sub(bl.last).Seconds() * float64(bl.bytesPerSecond))
+		if bl.tokens > bl.bytesPerSecond {
+			bl.tokens = bl.bytesPerSecond
+		}
+		bl.last = now
+		var wait time.Duration
+		if bl.tokens >= chunk {
+			bl.tokens -= chunk
+			n -= chunk
+		} else {
+			wait = time.Duration(float64(chunk-bl.tokens) / float64(bl.bytesPerSecond) * float64(time.Second))
+		}
+		bl.mu.Unlock()
+
+		if wait > 0 {
+			time.Sleep(wait)
+		}
+	}
+}
+
+// limitedReader is an io.Reader that waits on a bandwidthLimiter after
+// each read, and counts the bytes read.
+type limitedReader struct {
+	r       io.Reader
+	limiter *bandwidthLimiter
+	count   int64
+}
+
+// Read is part of the io.Reader interface
+func (lr *limitedReader) Read(p []byte) (int, error) {
+	n, err := lr.r.Read(p)
+	lr.count += int64(n)
+	lr.limiter.take(int64(n))
+	return n, err
+}
+
+// transferRate returns a human readable transfer rate.
+func transferRate(bytes int64, d time.Duration) string {
+	if d <= 0 {
+		return "n/a"
+	}
+	return fmt.Sprintf("%.1f MB/s", float64(bytes)/d.Seconds()/(1024*1024))
+}
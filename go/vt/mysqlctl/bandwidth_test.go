@@ -0,0 +1,44 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mysqlctl
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+func TestLimitedReader(t *testing.T) {
+	data := make([]byte, 1536*1024)
+
+	// no limit
+	startTime := time.Now()
+	lr := &limitedReader{r: bytes.NewReader(data), limiter: newBandwidthLimiter(0)}
+	if _, err := io.Copy(ioutil.Discard, lr); err != nil {
+		t.Fatalf("Copy failed: %v", err)
+	}
+	if lr.count != int64(len(data)) {
+		t.Errorf("unexpected count: %v", lr.count)
+	}
+	if d := time.Now().Sub(startTime); d > 200*time.Millisecond {
+		t.Errorf("unlimited copy took too long: %v", d)
+	}
+
+	// 1 MB/s: the first MB is free (that's the bucket), the
+	// remaining 512 KB takes half a second.
+	startTime = time.Now()
+	lr = &limitedReader{r: bytes.NewReader(data), limiter: newBandwidthLimiter(1024 * 1024)}
+	if _, err := io.Copy(ioutil.Discard, lr); err != nil {
+		t.Fatalf("Copy failed: %v", err)
+	}
+	if lr.count != int64(len(data)) {
+		t.Errorf("unexpected count: %v", lr.count)
+	}
+	if d := time.Now().Sub(startTime); d < 400*time.Millisecond || d > 2*time.Second {
+		t.Errorf("limited copy took an unexpected time: %v", d)
+	}
+}
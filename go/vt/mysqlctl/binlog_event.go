@@ -89,6 +89,13 @@ func (ev binlogEvent) Length() uint32 {
 	return binary.LittleEndian.Uint32(ev.Bytes()[9 : 9+4])
 }
 
+// nextPosition returns the next_position field from the header: the
+// offset of the next event in the binlog file, or 0 for the fake
+// events the master only sends over the stream.
+func (ev binlogEvent) nextPosition() uint32 {
+	return binary.LittleEndian.Uint32(ev.Bytes()[13 : 13+4])
+}
+
 // IsFormatDescription implements BinlogEvent.IsFormatDescription().
 func (ev binlogEvent) IsFormatDescription() bool {
 	return ev.Type() == 15
@@ -266,6 +273,21 @@ func (ev binlogEvent) Rand(f blproto.BinlogFormat) (seed1 uint64, seed2 uint64,
 	return seed1, seed2, nil
 }
 
+// rotate returns the binlog file and offset a ROTATE_EVENT goes on
+// with. The checksum, if any, must have been stripped.
+//
+// Expected format (L = total length of event data):
+//   # bytes   field
+//   8         position
+//   L-8       file name (no NULL terminator)
+func (ev binlogEvent) rotate(f blproto.BinlogFormat) (file string, pos uint32, err error) {
+	data := ev.Bytes()[f.HeaderLength:]
+	if len(data) < 8 {
+		return "", 0, fmt.Errorf("ROTATE_EVENT is too short: %v bytes", len(data))
+	}
+	return string(data[8:]), uint32(binary.LittleEndian.Uint64(data[:8])), nil
+}
+
 // IsBeginGTID implements BinlogEvent.IsBeginGTID().
 func (ev binlogEvent) IsBeginGTID(f blproto.BinlogFormat) bool {
 	return false
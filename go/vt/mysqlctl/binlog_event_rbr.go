@@ -0,0 +1,443 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mysqlctl
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strconv"
+
+	mproto "github.com/youtube/vitess/go/mysql/proto"
+	"github.com/youtube/vitess/go/sqltypes"
+	blproto "github.com/youtube/vitess/go/vt/binlog/proto"
+)
+
+// This file contains the parsing of the events of row based
+// replication: the TABLE_MAP_EVENTs, and the WRITE, UPDATE and
+// DELETE_ROWS_EVENTs that follow them.
+//
+// Only the full row images (binlog_row_image=FULL) are supported, and
+// the column types the streamer knows how to write back as SQL
+// literals. The other ones are decoding errors.
+
+// Event types of row based replication.
+const (
+	eTableMapEvent     = 19
+	eWriteRowsEventV1  = 23
+	eUpdateRowsEventV1 = 24
+	eDeleteRowsEventV1 = 25
+	eWriteRowsEventV2  = 30
+	eUpdateRowsEventV2 = 31
+	eDeleteRowsEventV2 = 32
+)
+
+// Column types of MySQL 5.6 that mproto doesn't have, as they are
+// only used in the binlogs.
+const (
+	typeTimestamp2 = 17
+	typeDatetime2  = 18
+	typeTime2      = 19
+)
+
+// IsTableMap implements BinlogEvent.IsTableMap().
+func (ev binlogEvent) IsTableMap() bool {
+	return ev.Type() == eTableMapEvent
+}
+
+// IsWriteRows implements BinlogEvent.IsWriteRows().
+func (ev binlogEvent) IsWriteRows() bool {
+	return ev.Type() == eWriteRowsEventV1 || ev.Type() == eWriteRowsEventV2
+}
+
+// IsUpdateRows implements BinlogEvent.IsUpdateRows().
+func (ev binlogEvent) IsUpdateRows() bool {
+	return ev.Type() == eUpdateRowsEventV1 || ev.Type() == eUpdateRowsEventV2
+}
+
+// IsDeleteRows implements BinlogEvent.IsDeleteRows().
+func (ev binlogEvent) IsDeleteRows() bool {
+	return ev.Type() == eDeleteRowsEventV1 || ev.Type() == eDeleteRowsEventV2
+}
+
+// TableID implements BinlogEvent.TableID().
+//
+// The table id is the first 6 bytes of the post-header of the
+// TABLE_MAP_EVENTs and rows events.
+func (ev binlogEvent) TableID(f blproto.BinlogFormat) uint64 {
+	data := ev.Bytes()[f.HeaderLength:]
+	var buf [8]byte
+	copy(buf[:], data[:6])
+	return binary.LittleEndian.Uint64(buf[:])
+}
+
+// rowsReader reads the data of a rows or TABLE_MAP_EVENT, and fails
+// instead of reading past its end.
+type rowsReader struct {
+	data []byte
+	pos  int
+}
+
+func (r *rowsReader) read(n int) ([]byte, error) {
+	if n < 0 || r.pos+n > len(r.data) {
+		return nil, fmt.Errorf("reading %v bytes at %v overflows the event data (%v bytes)", n, r.pos, len(r.data))
+	}
+	result := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return result, nil
+}
+
+// readUint reads an n bytes little endian unsigned integer.
+func (r *rowsReader) readUint(n int) (uint64, error) {
+	b, err := r.read(n)
+	if err != nil {
+		return 0, err
+	}
+	var result uint64
+	for i := n - 1; i >= 0; i-- {
+		result = result<<8 | uint64(b[i])
+	}
+	return result, nil
+}
+
+// readPackedInt reads a length encoded integer.
+func (r *rowsReader) readPackedInt() (uint64, error) {
+	b, err := r.read(1)
+	if err != nil {
+		return 0, err
+	}
+	switch b[0] {
+	case 252:
+		return r.readUint(2)
+	case 253:
+		return r.readUint(3)
+	case 254:
+		return r.readUint(8)
+	case 251, 255:
+		return 0, fmt.Errorf("invalid packed integer prefix %v", b[0])
+	}
+	return uint64(b[0]), nil
+}
+
+// readLengthString reads a 1 byte length, the string, and its NULL
+// terminator.
+func (r *rowsReader) readLengthString() (string, error) {
+	length, err := r.read(1)
+	if err != nil {
+		return "", err
+	}
+	b, err := r.read(int(length[0]) + 1)
+	if err != nil {
+		return "", err
+	}
+	return string(b[:length[0]]), nil
+}
+
+// TableMap implements BinlogEvent.TableMap().
+//
+// Expected format (L = total length of event data):
+//   # bytes   field
+//   6         table id
+//   2         flags
+//   1         length of the database name (X)
+//   X+1       database name + NULL terminator
+//   1         length of the table name (Y)
+//   Y+1       table name + NULL terminator
+//   packed    column count (N)
+//   N         column types
+//   packed    length of the metadata block (M)
+//   M         metadata of the columns
+//   (N+7)/8   bitmap of the nullable columns
+func (ev binlogEvent) TableMap(f blproto.BinlogFormat) (*blproto.TableMap, error) {
+	r := &rowsReader{data: ev.Bytes()[f.HeaderLength:], pos: 6 + 2}
+	tm := &blproto.TableMap{}
+	var err error
+	if tm.Database, err = r.readLengthString(); err != nil {
+		return nil, fmt.Errorf("can't read database name: %v", err)
+	}
+	if tm.Name, err = r.readLengthString(); err != nil {
+		return nil, fmt.Errorf("can't read table name: %v", err)
+	}
+	columnCount, err := r.readPackedInt()
+	if err != nil {
+		return nil, fmt.Errorf("can't read column count: %v", err)
+	}
+	types, err := r.read(int(columnCount))
+	if err != nil {
+		return nil, fmt.Errorf("can't read column types: %v", err)
+	}
+	tm.Types = append([]byte(nil), types...)
+	metadataLength, err := r.readPackedInt()
+	if err != nil {
+		return nil, fmt.Errorf("can't read metadata length: %v", err)
+	}
+	metadata, err := r.read(int(metadataLength))
+	if err != nil {
+		return nil, fmt.Errorf("can't read metadata: %v", err)
+	}
+	mr := &rowsReader{data: metadata}
+	tm.Metadata = make([]uint16, columnCount)
+	for i, typ := range tm.Types {
+		var b []byte
+		switch typ {
+		case mproto.VT_FLOAT, mproto.VT_DOUBLE, mproto.VT_BLOB, mproto.VT_GEOMETRY, typeTimestamp2, typeDatetime2, typeTime2:
+			if b, err = mr.read(1); err == nil {
+				tm.Metadata[i] = uint16(b[0])
+			}
+		case mproto.VT_VARCHAR, mproto.VT_VAR_STRING, mproto.VT_BIT:
+			if b, err = mr.read(2); err == nil {
+				tm.Metadata[i] = binary.LittleEndian.Uint16(b)
+			}
+		case mproto.VT_NEWDECIMAL, mproto.VT_STRING, mproto.VT_ENUM, mproto.VT_SET:
+			if b, err = mr.read(2); err == nil {
+				tm.Metadata[i] = uint16(b[0])<<8 | uint16(b[1])
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("can't read metadata of column %v: %v", i, err)
+		}
+	}
+	return tm, nil
+}
+
+// Rows implements BinlogEvent.Rows().
+//
+// Expected format (L = total length of event data):
+//   # bytes   field
+//   6         table id
+//   2         flags
+//   -- v2 only --
+//   2         length of the extra data, including these 2 bytes (X)
+//   X-2       extra data
+//   -- all --
+//   packed    column count (N)
+//   (N+7)/8   bitmap of the columns of the rows
+//   (N+7)/8   bitmap of the columns of the after images, for updates
+//   rest      rows: for each image, a bitmap of its NULL columns,
+//             then the values of the other ones
+func (ev binlogEvent) Rows(f blproto.BinlogFormat, tm *blproto.TableMap) (blproto.Rows, error) {
+	var rows blproto.Rows
+	r := &rowsReader{data: ev.Bytes()[f.HeaderLength:], pos: 6 + 2}
+	switch ev.Type() {
+	case eWriteRowsEventV2, eUpdateRowsEventV2, eDeleteRowsEventV2:
+		extraLength, err := r.readUint(2)
+		if err != nil {
+			return rows, err
+		}
+		if _, err := r.read(int(extraLength) - 2); err != nil {
+			return rows, fmt.Errorf("can't skip extra data: %v", err)
+		}
+	}
+	columnCount, err := r.readPackedInt()
+	if err != nil {
+		return rows, fmt.Errorf("can't read column count: %v", err)
+	}
+	if int(columnCount) != len(tm.Types) {
+		return rows, fmt.Errorf("rows event has %v columns, table %v.%v has %v", columnCount, tm.Database, tm.Name, len(tm.Types))
+	}
+	images := 1
+	if ev.IsUpdateRows() {
+		images = 2
+	}
+	bitmapLength := (int(columnCount) + 7) / 8
+	for i := 0; i < images; i++ {
+		bitmap, err := r.read(bitmapLength)
+		if err != nil {
+			return rows, fmt.Errorf("can't read columns bitmap: %v", err)
+		}
+		for c := 0; c < int(columnCount); c++ {
+			if bitmap[c/8]&(1<<uint(c%8)) == 0 {
+				return rows, fmt.Errorf("rows event of %v.%v doesn't have column %v, only full row images are supported", tm.Database, tm.Name, c)
+			}
+		}
+	}
+
+	for r.pos < len(r.data) {
+		image, err := readRowImage(r, tm)
+		if err != nil {
+			return rows, fmt.Errorf("can't read row %v of %v.%v: %v", len(rows.Rows), tm.Database, tm.Name, err)
+		}
+		var row blproto.Row
+		switch {
+		case ev.IsWriteRows():
+			row.After = image
+		case ev.IsDeleteRows():
+			row.Before = image
+		default:
+			row.Before = image
+			if row.After, err = readRowImage(r, tm); err != nil {
+				return rows, fmt.Errorf("can't read row %v of %v.%v: %v", len(rows.Rows), tm.Database, tm.Name, err)
+			}
+		}
+		rows.Rows = append(rows.Rows, row)
+	}
+	return rows, nil
+}
+
+// readRowImage reads the NULL bitmap and the values of a row.
+func readRowImage(r *rowsReader, tm *blproto.TableMap) ([]sqltypes.Value, error) {
+	nullBitmap, err := r.read((len(tm.Types) + 7) / 8)
+	if err != nil {
+		return nil, err
+	}
+	values := make([]sqltypes.Value, len(tm.Types))
+	for c, typ := range tm.Types {
+		if nullBitmap[c/8]&(1<<uint(c%8)) != 0 {
+			continue
+		}
+		unsigned := c < len(tm.Unsigned) && tm.Unsigned[c]
+		if values[c], err = readValue(r, typ, tm.Metadata[c], unsigned); err != nil {
+			return nil, fmt.Errorf("column %v: %v", c, err)
+		}
+	}
+	return values, nil
+}
+
+// readValue reads the value of a column of type typ.
+func readValue(r *rowsReader, typ byte, metadata uint16, unsigned bool) (sqltypes.Value, error) {
+	readInt := func(n int) (sqltypes.Value, error) {
+		v, err := r.readUint(n)
+		if err != nil {
+			return sqltypes.Value{}, err
+		}
+		if unsigned {
+			return sqltypes.MakeNumeric(strconv.AppendUint(nil, v, 10)), nil
+		}
+		// sign extend
+		shift := uint(64 - 8*n)
+		return sqltypes.MakeNumeric(strconv.AppendInt(nil, int64(v<<shift)>>shift, 10)), nil
+	}
+	readString := func(lengthBytes int) (sqltypes.Value, error) {
+		length, err := r.readUint(lengthBytes)
+		if err != nil {
+			return sqltypes.Value{}, err
+		}
+		b, err := r.read(int(length))
+		if err != nil {
+			return sqltypes.Value{}, err
+		}
+		return sqltypes.MakeString(append([]byte(nil), b...)), nil
+	}
+
+	switch typ {
+	case mproto.VT_TINY:
+		return readInt(1)
+	case mproto.VT_SHORT:
+		return readInt(2)
+	case mproto.VT_INT24:
+		return readInt(3)
+	case mproto.VT_LONG:
+		return readInt(4)
+	case mproto.VT_LONGLONG:
+		return readInt(8)
+	case mproto.VT_YEAR:
+		v, err := r.readUint(1)
+		if err != nil {
+			return sqltypes.Value{}, err
+		}
+		if v != 0 {
+			v += 1900
+		}
+		return sqltypes.MakeNumeric(strconv.AppendUint(nil, v, 10)), nil
+	case mproto.VT_FLOAT:
+		v, err := r.readUint(4)
+		if err != nil {
+			return sqltypes.Value{}, err
+		}
+		return sqltypes.MakeFractional(strconv.AppendFloat(nil, float64(math.Float32frombits(uint32(v))), 'g', -1, 32)), nil
+	case mproto.VT_DOUBLE:
+		v, err := r.readUint(8)
+		if err != nil {
+			return sqltypes.Value{}, err
+		}
+		return sqltypes.MakeFractional(strconv.AppendFloat(nil, math.Float64frombits(v), 'g', -1, 64)), nil
+	case mproto.VT_DATE:
+		v, err := r.readUint(3)
+		if err != nil {
+			return sqltypes.Value{}, err
+		}
+		return sqltypes.MakeString([]byte(fmt.Sprintf("%04d-%02d-%02d", v>>9, (v>>5)&15, v&31))), nil
+	case mproto.VT_DATETIME:
+		v, err := r.readUint(8)
+		if err != nil {
+			return sqltypes.Value{}, err
+		}
+		d, t := v/1000000, v%1000000
+		return sqltypes.MakeString([]byte(fmt.Sprintf("%04d-%02d-%02d %02d:%02d:%02d", d/10000, (d/100)%100, d%100, t/10000, (t/100)%100, t%100))), nil
+	case typeDatetime2:
+		return readDatetime2(r, int(metadata))
+	case mproto.VT_VARCHAR, mproto.VT_VAR_STRING:
+		if metadata < 256 {
+			return readString(1)
+		}
+		return readString(2)
+	case mproto.VT_BLOB, mproto.VT_GEOMETRY:
+		return readString(int(metadata))
+	case mproto.VT_STRING:
+		realType, length := byte(metadata>>8), int(metadata&0xff)
+		if realType&0x30 != 0x30 {
+			// the high bits of the length are in the type
+			length |= int((realType&0x30)^0x30) << 4
+			realType |= 0x30
+		}
+		switch realType {
+		case mproto.VT_ENUM, mproto.VT_SET:
+			// the index of the value, or the bitmap of the
+			// values of a set: MySQL takes them as numbers
+			v, err := r.readUint(length)
+			if err != nil {
+				return sqltypes.Value{}, err
+			}
+			return sqltypes.MakeNumeric(strconv.AppendUint(nil, v, 10)), nil
+		case mproto.VT_STRING:
+			if length < 256 {
+				return readString(1)
+			}
+			return readString(2)
+		}
+		return sqltypes.Value{}, fmt.Errorf("unsupported real type %v of a string column", realType)
+	}
+	return sqltypes.Value{}, fmt.Errorf("unsupported column type %v", typ)
+}
+
+// readDatetime2 reads a DATETIME of MySQL 5.6, with fsp digits of
+// fractional seconds. It is stored big endian:
+//   1 bit   sign (always 1)
+//   17 bits year*13+month
+//   5 bits  day
+//   5 bits  hour
+//   6 bits  minute
+//   6 bits  second
+//   then (fsp+1)/2 bytes of fractional seconds
+func readDatetime2(r *rowsReader, fsp int) (sqltypes.Value, error) {
+	b, err := r.read(5)
+	if err != nil {
+		return sqltypes.Value{}, err
+	}
+	var v uint64
+	for _, c := range b {
+		v = v<<8 | uint64(c)
+	}
+	v -= 0x8000000000
+	ymd, hms := v>>17, v&(1<<17-1)
+	ym := ymd >> 5
+	s := fmt.Sprintf("%04d-%02d-%02d %02d:%02d:%02d", ym/13, ym%13, ymd&31, hms>>12, (hms>>6)&63, hms&63)
+
+	if fsp > 0 {
+		fracBytes := (fsp + 1) / 2
+		b, err := r.read(fracBytes)
+		if err != nil {
+			return sqltypes.Value{}, err
+		}
+		var frac uint64
+		for _, c := range b {
+			frac = frac<<8 | uint64(c)
+		}
+		// frac has 2*fracBytes digits, keep the first fsp
+		digits := fmt.Sprintf("%0*d", 2*fracBytes, frac)
+		s += "." + digits[:fsp]
+	}
+	return sqltypes.MakeString([]byte(s)), nil
+}
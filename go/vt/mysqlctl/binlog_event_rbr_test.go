@@ -0,0 +1,193 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mysqlctl
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	mproto "github.com/youtube/vitess/go/mysql/proto"
+	"github.com/youtube/vitess/go/sqltypes"
+	blproto "github.com/youtube/vitess/go/vt/binlog/proto"
+)
+
+var rbrFormat = blproto.BinlogFormat{HeaderLength: 19}
+
+// rbrEvent returns an event of type typ with data after a 19 bytes
+// header.
+func rbrEvent(typ byte, data []byte) binlogEvent {
+	length := 19 + len(data)
+	header := []byte{0x53, 0x52, 0xe9, 0x53, typ, 0x88, 0xf3, 0x0, 0x0, byte(length), byte(length >> 8), 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0}
+	return binlogEvent(append(header, data...))
+}
+
+// The table of the events is:
+//
+//	id   BIGINT UNSIGNED
+//	name VARCHAR(64)
+//	ts   DATETIME
+//	kind ENUM('a', 'b')
+var (
+	rbrTableMapData = []byte{
+		0x42, 0x0, 0x0, 0x0, 0x0, 0x0, // table id
+		0x1, 0x0, // flags
+		16, 'v', 't', '_', 't', 'e', 's', 't', '_', 'k', 'e', 'y', 's', 'p', 'a', 'c', 'e', 0x0,
+		4, 'v', 't', '_', 'a', 0x0,
+		4, // column count
+		mproto.VT_LONGLONG, mproto.VT_VARCHAR, typeDatetime2, mproto.VT_STRING,
+		5, 64, 0x0, 0x0, mproto.VT_ENUM, 1, // metadata
+		0x0e, // nullable columns
+	}
+	rbrTs = []byte{0x99, 0x96, 0x7c, 0xc8, 0xb8} // 2015-06-30 12:34:56
+
+	rbrTableMap = &blproto.TableMap{
+		Database: "vt_test_keyspace",
+		Name:     "vt_a",
+		Types:    []byte{mproto.VT_LONGLONG, mproto.VT_VARCHAR, typeDatetime2, mproto.VT_STRING},
+		Metadata: []uint16{0, 64, 0, uint16(mproto.VT_ENUM)<<8 | 1},
+	}
+)
+
+func rbrRowsData(header []byte, images ...[]byte) []byte {
+	data := append([]byte(nil), header...)
+	for _, image := range images {
+		data = append(data, image...)
+	}
+	return data
+}
+
+var (
+	rbrRow1 = append(append([]byte{0x0, 0x1, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 3, 'a', 'b', 'c'}, rbrTs...), 2)
+	rbrRow2 = append(append([]byte{0x2, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, rbrTs...), 1)
+
+	rbrValues1 = []sqltypes.Value{
+		sqltypes.MakeNumeric([]byte("1")),
+		sqltypes.MakeString([]byte("abc")),
+		sqltypes.MakeString([]byte("2015-06-30 12:34:56")),
+		sqltypes.MakeNumeric([]byte("2")),
+	}
+	rbrValues2 = []sqltypes.Value{
+		sqltypes.MakeNumeric([]byte("18446744073709551615")),
+		sqltypes.Value{},
+		sqltypes.MakeString([]byte("2015-06-30 12:34:56")),
+		sqltypes.MakeNumeric([]byte("1")),
+	}
+)
+
+func TestBinlogEventTableMap(t *testing.T) {
+	ev := rbrEvent(eTableMapEvent, rbrTableMapData)
+	if !ev.IsValid() || !ev.IsTableMap() || ev.IsWriteRows() {
+		t.Fatalf("bad event type: %v", ev.Type())
+	}
+	if got := ev.TableID(rbrFormat); got != 0x42 {
+		t.Errorf("TableID() = %v, want 0x42", got)
+	}
+	tm, err := ev.TableMap(rbrFormat)
+	if err != nil {
+		t.Fatalf("TableMap() failed: %v", err)
+	}
+	if !reflect.DeepEqual(tm, rbrTableMap) {
+		t.Errorf("TableMap() = %#v, want %#v", tm, rbrTableMap)
+	}
+
+	ev = rbrEvent(eTableMapEvent, rbrTableMapData[:len(rbrTableMapData)-4])
+	if _, err := ev.TableMap(rbrFormat); err == nil || !strings.Contains(err.Error(), "metadata") {
+		t.Errorf("TableMap() of a truncated event: got %v", err)
+	}
+}
+
+func TestBinlogEventWriteRows(t *testing.T) {
+	header := []byte{0x42, 0x0, 0x0, 0x0, 0x0, 0x0, 0x1, 0x0, 0x2, 0x0, 4, 0x0f}
+	ev := rbrEvent(eWriteRowsEventV2, rbrRowsData(header, rbrRow1, rbrRow2))
+	if !ev.IsWriteRows() || ev.IsUpdateRows() || ev.IsDeleteRows() {
+		t.Fatalf("bad event type: %v", ev.Type())
+	}
+	tm := *rbrTableMap
+	tm.Unsigned = []bool{true, false, false, false}
+	rows, err := ev.Rows(rbrFormat, &tm)
+	if err != nil {
+		t.Fatalf("Rows() failed: %v", err)
+	}
+	want := blproto.Rows{Rows: []blproto.Row{
+		{After: rbrValues1},
+		{After: rbrValues2},
+	}}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("Rows() = %#v, want %#v", rows, want)
+	}
+
+	// signed, the id of the second row is -1
+	tm.Unsigned = nil
+	rows, err = ev.Rows(rbrFormat, &tm)
+	if err != nil {
+		t.Fatalf("Rows() failed: %v", err)
+	}
+	if got := rows.Rows[1].After[0].String(); got != "-1" {
+		t.Errorf("signed id = %v, want -1", got)
+	}
+}
+
+func TestBinlogEventUpdateRows(t *testing.T) {
+	header := []byte{0x42, 0x0, 0x0, 0x0, 0x0, 0x0, 0x1, 0x0, 4, 0x0f, 0x0f}
+	ev := rbrEvent(eUpdateRowsEventV1, rbrRowsData(header, rbrRow1, rbrRow2))
+	if !ev.IsUpdateRows() {
+		t.Fatalf("bad event type: %v", ev.Type())
+	}
+	tm := *rbrTableMap
+	tm.Unsigned = []bool{true, false, false, false}
+	rows, err := ev.Rows(rbrFormat, &tm)
+	if err != nil {
+		t.Fatalf("Rows() failed: %v", err)
+	}
+	want := blproto.Rows{Rows: []blproto.Row{
+		{Before: rbrValues1, After: rbrValues2},
+	}}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("Rows() = %#v, want %#v", rows, want)
+	}
+
+	// the after image is missing
+	ev = rbrEvent(eUpdateRowsEventV1, rbrRowsData(header, rbrRow1))
+	if _, err := ev.Rows(rbrFormat, &tm); err == nil || !strings.Contains(err.Error(), "overflows") {
+		t.Errorf("Rows() without after image: got %v", err)
+	}
+}
+
+func TestBinlogEventRowsErrors(t *testing.T) {
+	testcases := []struct {
+		ev   binlogEvent
+		tm   *blproto.TableMap
+		want string
+	}{
+		{
+			// not all the columns in the image
+			rbrEvent(eDeleteRowsEventV1, rbrRowsData([]byte{0x42, 0x0, 0x0, 0x0, 0x0, 0x0, 0x1, 0x0, 4, 0x0d}, rbrRow1)),
+			rbrTableMap,
+			"only full row images are supported",
+		},
+		{
+			rbrEvent(eDeleteRowsEventV1, rbrRowsData([]byte{0x42, 0x0, 0x0, 0x0, 0x0, 0x0, 0x1, 0x0, 3, 0x07}, rbrRow1)),
+			rbrTableMap,
+			"rows event has 3 columns",
+		},
+		{
+			rbrEvent(eDeleteRowsEventV1, rbrRowsData([]byte{0x42, 0x0, 0x0, 0x0, 0x0, 0x0, 0x1, 0x0, 1, 0x01}, []byte{0x0, 0x1, 0x2})),
+			&blproto.TableMap{Types: []byte{mproto.VT_NEWDECIMAL}, Metadata: []uint16{0x0a02}},
+			"unsupported column type",
+		},
+		{
+			rbrEvent(eDeleteRowsEventV2, []byte{0x42, 0x0, 0x0, 0x0, 0x0, 0x0, 0x1, 0x0, 0x10, 0x0}),
+			rbrTableMap,
+			"can't skip extra data",
+		},
+	}
+	for _, tcase := range testcases {
+		_, err := tcase.ev.Rows(rbrFormat, tcase.tm)
+		if err == nil || !strings.Contains(err.Error(), tcase.want) {
+			t.Errorf("Rows() = %v, want error containing %q", err, tcase.want)
+		}
+	}
+}
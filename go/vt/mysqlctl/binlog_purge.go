@@ -0,0 +1,266 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mysqlctl
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"syscall"
+	"time"
+
+	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/vt/mysqlctl/proto"
+)
+
+/*
+This file contains the binary logs management: listing them, and
+purging the old ones without breaking anything that still reads them.
+*/
+
+// BinlogFile describes one of the binary log files of the server.
+type BinlogFile struct {
+	// Name is the name of the file, as displayed by SHOW BINARY LOGS.
+	Name string
+
+	// Size is the size of the file in bytes.
+	Size int64
+
+	// ModTime is the last time the file was written to.
+	ModTime time.Time
+}
+
+// BinlogConsumer is something that reads the binary logs of the
+// server: a slave, or a binlog player of another shard.
+type BinlogConsumer struct {
+	// Name identifies the consumer in the error messages.
+	Name string
+
+	// ServerID is the server_id of the consumer if it connects as a
+	// slave, so it can be matched with the output of SHOW SLAVE
+	// HOSTS. It is 0 for the other consumers.
+	ServerID uint32
+
+	// Position is the replication position of the consumer. It
+	// still needs all the transactions after it.
+	Position proto.ReplicationPosition
+}
+
+// BinlogPurgePolicy describes which binary logs should be purged.
+// The current binary log is never purged.
+type BinlogPurgePolicy struct {
+	// MaxAge is how long binary logs are kept after they were last
+	// written to. 0 means there is no age limit.
+	MaxAge time.Duration
+
+	// MinFreeDisk is the free disk space, in bytes, to try to keep
+	// on the binary logs file system, by purging the oldest files.
+	// 0 means there is no disk space limit.
+	MinFreeDisk uint64
+}
+
+// BinaryLogs returns the binary logs of the server, oldest first.
+func (mysqld *Mysqld) BinaryLogs() ([]BinlogFile, error) {
+	qr, err := mysqld.FetchSuperQuery("SHOW BINARY LOGS")
+	if err != nil {
+		return nil, err
+	}
+	dir := path.Dir(mysqld.config.BinLogPath)
+	files := make([]BinlogFile, 0, len(qr.Rows))
+	for _, row := range qr.Rows {
+		if len(row) < 2 {
+			return nil, fmt.Errorf("unexpected row for SHOW BINARY LOGS: %v", row)
+		}
+		f := BinlogFile{Name: row[0].String()}
+		if f.Size, err = strconv.ParseInt(row[1].String(), 10, 64); err != nil {
+			return nil, fmt.Errorf("invalid size for binary log %v: %v", f.Name, err)
+		}
+		fi, err := os.Stat(path.Join(dir, f.Name))
+		if err != nil {
+			return nil, err
+		}
+		f.ModTime = fi.ModTime()
+		files = append(files, f)
+	}
+	return files, nil
+}
+
+// SlaveHosts returns the server ids of the slaves connected to the
+// server, as displayed by SHOW SLAVE HOSTS.
+func (mysqld *Mysqld) SlaveHosts() ([]uint32, error) {
+	qr, err := mysqld.FetchSuperQuery("SHOW SLAVE HOSTS")
+	if err != nil {
+		return nil, err
+	}
+	column := -1
+	for i, field := range qr.Fields {
+		if field.Name == "Server_id" {
+			column = i
+		}
+	}
+	if column == -1 {
+		return nil, fmt.Errorf("no Server_id column in SHOW SLAVE HOSTS")
+	}
+	result := make([]uint32, 0, len(qr.Rows))
+	for _, row := range qr.Rows {
+		id, err := strconv.ParseUint(row[column].String(), 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid server id in SHOW SLAVE HOSTS: %v", err)
+		}
+		result = append(result, uint32(id))
+	}
+	return result, nil
+}
+
+// binlogStartEventInfo returns the Info column of the first event
+// of the given type in a binlog file. It is used by the flavors to
+// read the event that describes the transactions of the previous
+// files, which is right after the format description event.
+func binlogStartEventInfo(mysqld *Mysqld, file, eventType string) (string, error) {
+	qr, err := mysqld.FetchSuperQuery(fmt.Sprintf("SHOW BINLOG EVENTS IN '%v' LIMIT 3", file))
+	if err != nil {
+		return "", err
+	}
+	typeColumn, infoColumn := -1, -1
+	for i, field := range qr.Fields {
+		switch field.Name {
+		case "Event_type":
+			typeColumn = i
+		case "Info":
+			infoColumn = i
+		}
+	}
+	if typeColumn == -1 || infoColumn == -1 {
+		return "", fmt.Errorf("no Event_type or Info column in SHOW BINLOG EVENTS")
+	}
+	for _, row := range qr.Rows {
+		if row[typeColumn].String() == eventType {
+			return row[infoColumn].String(), nil
+		}
+	}
+	return "", fmt.Errorf("no %v event at the beginning of binary log %v", eventType, file)
+}
+
+// binlogPurgeCount returns how many of the oldest files should be
+// purged according to the policy, with freeDisk bytes available.
+func binlogPurgeCount(files []BinlogFile, now time.Time, policy BinlogPurgePolicy, freeDisk uint64) int {
+	count := 0
+	for count < len(files)-1 {
+		f := files[count]
+		if !(policy.MaxAge > 0 && now.Sub(f.ModTime) > policy.MaxAge) && freeDisk >= policy.MinFreeDisk {
+			break
+		}
+		freeDisk += uint64(f.Size)
+		count++
+	}
+	return count
+}
+
+// neededBinlogIndex returns the index of the oldest file that
+// consumers still need. starts has the start positions of the
+// candidate files, oldest first. The result is at most
+// len(starts)-1. The connected slaves that are not consumers are
+// ignored, it's up to the caller to return all the slaves it cares
+// about, or to fail.
+func neededBinlogIndex(starts []proto.ReplicationPosition, consumers []BinlogConsumer, slaveHosts []uint32) (int, error) {
+	known := make(map[uint32]bool)
+	for _, c := range consumers {
+		if c.ServerID != 0 {
+			known[c.ServerID] = true
+		}
+	}
+	for _, id := range slaveHosts {
+		if !known[id] {
+			log.Warningf("Slave with server id %v is connected, but is not a known consumer, ignoring it", id)
+		}
+	}
+
+	needed := len(starts) - 1
+	for _, c := range consumers {
+		// the consumer needs the last file that starts before
+		// its position
+		i := needed
+		for i >= 0 && !starts[i].IsZero() && !c.Position.AtLeast(starts[i]) {
+			i--
+		}
+		if i < 0 {
+			return 0, fmt.Errorf("%v at position %v needs binary logs that were already purged", c.Name, c.Position)
+		}
+		needed = i
+	}
+	return needed, nil
+}
+
+// freeDiskSpace returns the space available to mysqld in the file
+// system of dir.
+func freeDiskSpace(dir string) (uint64, error) {
+	var fs syscall.Statfs_t
+	if err := syscall.Statfs(dir, &fs); err != nil {
+		return 0, err
+	}
+	return fs.Bavail * uint64(fs.Bsize), nil
+}
+
+// PurgeBinaryLogs purges the binary logs according to the policy,
+// but never the ones a consumer still needs. The consumers function
+// is only called if there is something to purge, and has to return
+// all of them. The connected slaves it doesn't return are not
+// protected. It returns the names
+// of the purged files.
+func (mysqld *Mysqld) PurgeBinaryLogs(policy BinlogPurgePolicy, consumers func() ([]BinlogConsumer, error)) ([]string, error) {
+	files, err := mysqld.BinaryLogs()
+	if err != nil {
+		return nil, err
+	}
+	var freeDisk uint64
+	if policy.MinFreeDisk > 0 {
+		if freeDisk, err = freeDiskSpace(path.Dir(mysqld.config.BinLogPath)); err != nil {
+			return nil, err
+		}
+	}
+	count := binlogPurgeCount(files, time.Now(), policy, freeDisk)
+	if count == 0 {
+		return nil, nil
+	}
+
+	// read the consumers after the connected slaves, so a slave
+	// that connects in between is also a consumer
+	slaveHosts, err := mysqld.SlaveHosts()
+	if err != nil {
+		return nil, err
+	}
+	cs, err := consumers()
+	if err != nil {
+		return nil, fmt.Errorf("cannot get the binary logs consumers: %v", err)
+	}
+	flavor, err := mysqld.flavor()
+	if err != nil {
+		return nil, err
+	}
+	starts := make([]proto.ReplicationPosition, count+1)
+	for i := range starts {
+		if starts[i], err = flavor.BinlogStartPosition(mysqld, files[i].Name); err != nil {
+			return nil, err
+		}
+	}
+	if count, err = neededBinlogIndex(starts, cs, slaveHosts); err != nil {
+		return nil, err
+	}
+	if count == 0 {
+		return nil, nil
+	}
+
+	// PURGE BINARY LOGS TO removes the files before the given one
+	if err := mysqld.ExecuteSuperQuery(fmt.Sprintf("PURGE BINARY LOGS TO '%v'", files[count].Name)); err != nil {
+		return nil, err
+	}
+	purged := make([]string, count)
+	for i := range purged {
+		purged[i] = files[i].Name
+	}
+	log.Infof("Purged binary logs %v", purged)
+	return purged, nil
+}
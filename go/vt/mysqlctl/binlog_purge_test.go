@@ -0,0 +1,104 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mysqlctl
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/youtube/vitess/go/vt/mysqlctl/proto"
+)
+
+func TestBinlogPurgeCount(t *testing.T) {
+	now := time.Date(2015, 6, 1, 12, 0, 0, 0, time.UTC)
+	files := []BinlogFile{
+		{Name: "bin.000001", Size: 100, ModTime: now.Add(-5 * time.Hour)},
+		{Name: "bin.000002", Size: 100, ModTime: now.Add(-4 * time.Hour)},
+		{Name: "bin.000003", Size: 100, ModTime: now.Add(-3 * time.Hour)},
+		{Name: "bin.000004", Size: 100, ModTime: now.Add(-2 * time.Hour)},
+	}
+	for _, tc := range []struct {
+		policy   BinlogPurgePolicy
+		freeDisk uint64
+		want     int
+	}{
+		{BinlogPurgePolicy{}, 0, 0},
+		{BinlogPurgePolicy{MaxAge: 10 * time.Hour}, 0, 0},
+		{BinlogPurgePolicy{MaxAge: 210 * time.Minute}, 0, 2},
+		// the current file is never purged
+		{BinlogPurgePolicy{MaxAge: time.Minute}, 0, 3},
+		{BinlogPurgePolicy{MinFreeDisk: 1000}, 1000, 0},
+		{BinlogPurgePolicy{MinFreeDisk: 1000}, 850, 2},
+		{BinlogPurgePolicy{MinFreeDisk: 1000}, 0, 3},
+		// age first, then disk space
+		{BinlogPurgePolicy{MaxAge: 270 * time.Minute, MinFreeDisk: 1000}, 850, 2},
+		{BinlogPurgePolicy{MaxAge: 150 * time.Minute, MinFreeDisk: 1000}, 850, 3},
+	} {
+		if got := binlogPurgeCount(files, now, tc.policy, tc.freeDisk); got != tc.want {
+			t.Errorf("binlogPurgeCount(%+v, %v) = %v, want %v", tc.policy, tc.freeDisk, got, tc.want)
+		}
+	}
+}
+
+func TestNeededBinlogIndex(t *testing.T) {
+	pos := func(s string) proto.ReplicationPosition {
+		return proto.MustParseReplicationPosition(mariadbFlavorID, s)
+	}
+	starts := []proto.ReplicationPosition{
+		proto.ReplicationPosition{},
+		pos("0-1-100"),
+		pos("0-1-200"),
+		pos("0-1-300"),
+	}
+
+	for _, tc := range []struct {
+		consumers  []BinlogConsumer
+		slaveHosts []uint32
+		want       int
+		err        string
+	}{
+		{nil, nil, 3, ""},
+		{[]BinlogConsumer{{"slave", 101, pos("0-1-250")}}, []uint32{101}, 2, ""},
+		{[]BinlogConsumer{{"slave", 101, pos("0-1-300")}, {"player", 0, pos("0-1-150")}}, []uint32{101}, 1, ""},
+		// a consumer past the last candidate file only needs that one
+		{[]BinlogConsumer{{"slave", 101, pos("0-1-450")}}, nil, 3, ""},
+		// a consumer that needs the first file, which has no start position
+		{[]BinlogConsumer{{"player", 0, pos("0-1-50")}}, nil, 0, ""},
+		// the slaves that are not consumers don't block the purge
+		{[]BinlogConsumer{{"slave", 101, pos("0-1-250")}}, []uint32{101, 102}, 2, ""},
+	} {
+		got, err := neededBinlogIndex(starts, tc.consumers, tc.slaveHosts)
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("neededBinlogIndex(%v, %v) returned %v, expected error with %v", tc.consumers, tc.slaveHosts, err, tc.err)
+			}
+			continue
+		}
+		if err != nil || got != tc.want {
+			t.Errorf("neededBinlogIndex(%v, %v) = %v, %v, want %v", tc.consumers, tc.slaveHosts, got, err, tc.want)
+		}
+	}
+
+	// a consumer before the position of the oldest file can't be
+	// served any more
+	_, err := neededBinlogIndex(starts[1:], []BinlogConsumer{{"lagging", 0, pos("0-1-50")}}, nil)
+	if err == nil || !strings.Contains(err.Error(), "already purged") {
+		t.Errorf("neededBinlogIndex with a lagging consumer returned %v", err)
+	}
+}
+
+func TestFilePosBinlogStartPosition(t *testing.T) {
+	start, err := (&filePos{}).BinlogStartPosition(nil, "bin.000002")
+	if err != nil {
+		t.Fatalf("BinlogStartPosition failed: %v", err)
+	}
+	fp := func(s string) proto.ReplicationPosition {
+		return proto.MustParseReplicationPosition(filePosFlavorID, s)
+	}
+	if !fp("bin.000002:4").AtLeast(start) || !fp("bin.000003:4").AtLeast(start) || fp("bin.000001:1000").AtLeast(start) {
+		t.Errorf("wrong ordering with start position %v", start)
+	}
+}
@@ -0,0 +1,662 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mysqlctl
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/golang/glog"
+
+	"github.com/youtube/vitess/go/sync2"
+	"github.com/youtube/vitess/go/vt/concurrency"
+	"github.com/youtube/vitess/go/vt/logutil"
+	"github.com/youtube/vitess/go/vt/mysqlctl/backupstorage"
+	"github.com/youtube/vitess/go/vt/mysqlctl/proto"
+)
+
+// This file contains the builtin backup engine: it shuts down mysqld
+// and copies the InnoDB and database files, compressed, one storage
+// file per database file.
+
+const (
+	// builtinBackupEngineName is the name of this engine
+	builtinBackupEngineName = "builtin"
+
+	// the three bases for files to restore
+	backupInnodbDataHomeDir     = "InnoDBData"
+	backupInnodbLogGroupHomeDir = "InnoDBLog"
+	backupData                  = "Data"
+)
+
+// builtinBackupEngine is the BackupEngine that copies the files.
+type builtinBackupEngine struct{}
+
+// builtinBackupManifest is the MANIFEST of a builtin backup.
+type builtinBackupManifest struct {
+	// BackupManifest is the common part of the manifest
+	BackupManifest
+
+	// FileEntries contains all the files in the backup
+	FileEntries []FileEntry
+}
+
+// FileEntry is one file to backup
+type FileEntry struct {
+	// Base is one of:
+	// - backupInnodbDataHomeDir for files that go into Mycnf.InnodbDataHomeDir
+	// - backupInnodbLogGroupHomeDir for files that go into Mycnf.InnodbLogGroupHomeDir
+	// - backupData for files that go into Mycnf.DataDir
+	Base string
+
+	// Name is the file name, relative to Base
+	Name string
+
+	// Hash is the hash of the compressed data stored in the
+	// BackupStorage.
+	Hash string
+
+	// SHA256 is the hex-encoded SHA256 of the file. Backups taken
+	// before it was introduced don't have it.
+	SHA256 string
+}
+
+// fullPath returns the path of the file in the directories of cnf.
+func (fe *FileEntry) fullPath(cnf *Mycnf) (string, error) {
+	// find the root to use
+	var root string
+	switch fe.Base {
+	case backupInnodbDataHomeDir:
+		root = cnf.InnodbDataHomeDir
+	case backupInnodbLogGroupHomeDir:
+		root = cnf.InnodbLogGroupHomeDir
+	case backupData:
+		root = cnf.DataDir
+	default:
+		return "", fmt.Errorf("unknown base: %v", fe.Base)
+	}
+	return path.Join(root, fe.Name), nil
+}
+
+func (fe *FileEntry) open(cnf *Mycnf, readOnly bool) (*os.File, error) {
+	name, err := fe.fullPath(cnf)
+	if err != nil {
+		return nil, err
+	}
+
+	// and open the file
+	var fd *os.File
+	if readOnly {
+		fd, err = os.Open(name)
+	} else {
+		dir := path.Dir(name)
+		if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+			return nil, fmt.Errorf("cannot create destination directory %v: %v", dir, err)
+		}
+		fd, err = os.Create(name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot open source file %v: %v", name, err)
+	}
+	return fd, nil
+}
+
+// isDbDir returns true if the given directory contains a DB
+func isDbDir(p string) bool {
+	// db.opt is there
+	if _, err := os.Stat(path.Join(p, "db.opt")); err == nil {
+		return true
+	}
+
+	// Look for at least one .frm file
+	fis, err := ioutil.ReadDir(p)
+	if err != nil {
+		return false
+	}
+	for _, fi := range fis {
+		if strings.HasSuffix(fi.Name(), ".frm") {
+			return true
+		}
+	}
+
+	return false
+}
+
+func addDirectory(fes []FileEntry, base string, baseDir string, subDir string) ([]FileEntry, error) {
+	p := path.Join(baseDir, subDir)
+
+	fis, err := ioutil.ReadDir(p)
+	if err != nil {
+		return nil, err
+	}
+	for _, fi := range fis {
+		// what a failed restore may have left
+		if subDir == "" && (fi.Name() == restoreStagingDir || fi.Name() == restoreReplacedDir) {
+			continue
+		}
+		fes = append(fes, FileEntry{
+			Base: base,
+			Name: path.Join(subDir, fi.Name()),
+		})
+	}
+	return fes, nil
+}
+
+func findFilesTobackup(cnf *Mycnf) ([]FileEntry, error) {
+	var err error
+	var result []FileEntry
+
+	// first add inno db files
+	result, err = addDirectory(result, backupInnodbDataHomeDir, cnf.InnodbDataHomeDir, "")
+	if err != nil {
+		return nil, err
+	}
+	result, err = addDirectory(result, backupInnodbLogGroupHomeDir, cnf.InnodbLogGroupHomeDir, "")
+	if err != nil {
+		return nil, err
+	}
+
+	// then add DB directories
+	fis, err := ioutil.ReadDir(cnf.DataDir)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, fi := range fis {
+		p := path.Join(cnf.DataDir, fi.Name())
+		if isDbDir(p) {
+			result, err = addDirectory(result, backupData, cnf.DataDir, fi.Name())
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return result, nil
+}
+
+// ExecuteBackup is part of the BackupEngine interface. It stops
+// replication (or turns a master read-only), shuts down mysqld, copies
+// the files, and restores the original state.
+func (be *builtinBackupEngine) ExecuteBackup(mysqld MysqlDaemon, logger logutil.Logger, bh backupstorage.BackupHandle, backupConcurrency int, bandwidthLimit int64, hookExtraEnv map[string]string) error {
+
+	// save initial state so we can restore
+	slaveStartRequired := false
+	sourceIsMaster := false
+	readOnly := true
+	var replicationPosition proto.ReplicationPosition
+
+	// see if we need to restart replication after backup
+	logger.Infof("getting current replication status")
+	slaveStatus, err := mysqld.SlaveStatus()
+	switch err {
+	case nil:
+		slaveStartRequired = slaveStatus.SlaveRunning()
+	case ErrNotSlave:
+		// keep going if we're the master, might be a degenerate case
+		sourceIsMaster = true
+	default:
+		return fmt.Errorf("cannot get slave status: %v", err)
+	}
+
+	// get the read-only flag
+	readOnly, err = mysqld.IsReadOnly()
+	if err != nil {
+		return fmt.Errorf("cannot get read only status: %v", err)
+	}
+
+	// get the replication position
+	if sourceIsMaster {
+		if !readOnly {
+			logger.Infof("turning master read-onyl before backup")
+			if err = mysqld.SetReadOnly(true); err != nil {
+				return fmt.Errorf("cannot get read only status: %v", err)
+			}
+		}
+		replicationPosition, err = mysqld.MasterPosition()
+		if err != nil {
+			return fmt.Errorf("cannot get master position: %v", err)
+		}
+	} else {
+		if err = StopSlave(mysqld, hookExtraEnv); err != nil {
+			return fmt.Errorf("cannot stop slave: %v", err)
+		}
+		var slaveStatus proto.ReplicationStatus
+		slaveStatus, err = mysqld.SlaveStatus()
+		if err != nil {
+			return fmt.Errorf("cannot get slave status: %v", err)
+		}
+		replicationPosition = slaveStatus.Position
+	}
+	logger.Infof("using replication position: %v", replicationPosition)
+
+	// shutdown mysqld
+	if err = shutdownMysqld(mysqld); err != nil {
+		return fmt.Errorf("cannot shutdown mysqld: %v", err)
+	}
+
+	// get the files to backup
+	fes, err := findFilesTobackup(mysqld.Cnf())
+	if err != nil {
+		return fmt.Errorf("cannot find files to backup: %v", err)
+	}
+	logger.Infof("found %v files to backup", len(fes))
+
+	// backup everything
+	if err := be.backupFiles(mysqld, logger, bh, fes, replicationPosition, backupConcurrency, bandwidthLimit); err != nil {
+		return fmt.Errorf("cannot backup files: %v", err)
+	}
+
+	// Try to restart mysqld
+	if err := startMysqld(mysqld); err != nil {
+		return fmt.Errorf("cannot restart mysqld: %v", err)
+	}
+
+	// Restore original mysqld state that we saved above.
+	if slaveStartRequired {
+		logger.Infof("restarting mysql replication")
+		if err := StartSlave(mysqld, hookExtraEnv); err != nil {
+			return fmt.Errorf("cannot restart slave: %v", err)
+		}
+
+		// this should be quick, but we might as well just wait
+		if err := WaitForSlaveStart(mysqld, slaveStartDeadline); err != nil {
+			return fmt.Errorf("slave is not restarting: %v", err)
+		}
+	}
+
+	// And set read-only mode
+	logger.Infof("resetting mysqld read-only to %v", readOnly)
+	if err := mysqld.SetReadOnly(readOnly); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (be *builtinBackupEngine) backupFiles(mysqld MysqlDaemon, logger logutil.Logger, bh backupstorage.BackupHandle, fes []FileEntry, replicationPosition proto.ReplicationPosition, backupConcurrency int, bandwidthLimit int64) error {
+	compressionEngine, err := backupCompressionEngine()
+	if err != nil {
+		return err
+	}
+	logger.Infof("compressing files with %v", compressionEngine)
+
+	sema := sync2.NewSemaphore(backupConcurrency, 0)
+	limiter := newBandwidthLimiter(bandwidthLimit)
+	var dataSize sync2.AtomicInt64
+	rec := concurrency.AllErrorRecorder{}
+	wg := sync.WaitGroup{}
+	for i, fe := range fes {
+		wg.Add(1)
+		go func(i int, fe FileEntry) {
+			defer wg.Done()
+
+			// wait until we are ready to go, skip if we already
+			// encountered an error
+			sema.Acquire()
+			defer sema.Release()
+			if rec.HasErrors() {
+				return
+			}
+
+			// open the source file for reading
+			source, err := fe.open(mysqld.Cnf(), true)
+			if err != nil {
+				rec.RecordError(err)
+				return
+			}
+			defer source.Close()
+
+			// open the destination file for writing, and a buffer
+			name := fmt.Sprintf("%v", i)
+			wc, err := bh.AddFile(name)
+			if err != nil {
+				rec.RecordError(fmt.Errorf("cannot add file: %v", err))
+				return
+			}
+			defer wc.Close()
+			dst := bufio.NewWriterSize(wc, 2*1024*1024)
+
+			// create the hasher and the tee on top
+			hasher := newHasher()
+			tee := io.MultiWriter(dst, hasher)
+
+			// create the compression filter
+			compressor, err := newCompressor(compressionEngine, tee)
+			if err != nil {
+				rec.RecordError(fmt.Errorf("cannot create compressor: %v", err))
+				return
+			}
+
+			// copy from the source file to the compressor to tee to output file and hasher,
+			// and hash the source file on the way
+			startTime := time.Now()
+			lr := &limitedReader{r: source, limiter: limiter}
+			sha := sha256.New()
+			_, err = io.Copy(compressor, io.TeeReader(lr, sha))
+			if err != nil {
+				compressor.Close()
+				rec.RecordError(fmt.Errorf("cannot copy data: %v", err))
+				return
+			}
+
+			// close the compressor to flush it, after that the hash is good
+			if err = compressor.Close(); err != nil {
+				rec.RecordError(fmt.Errorf("cannot close compressor: %v", err))
+				return
+			}
+
+			// flush the buffer to finish writing, save the hash
+			dst.Flush()
+			fes[i].Hash = hasher.HashString()
+			fes[i].SHA256 = hex.EncodeToString(sha.Sum(nil))
+			dataSize.Add(lr.count)
+			duration := time.Now().Sub(startTime)
+			logger.Infof("backed up %v/%v (%v bytes) in %v (%v)", fe.Base, fe.Name, lr.count, duration, transferRate(lr.count, duration))
+		}(i, fe)
+	}
+
+	wg.Wait()
+	if rec.HasErrors() {
+		return rec.Error()
+	}
+
+	// and write the MANIFEST
+	bm := &builtinBackupManifest{
+		BackupManifest: BackupManifest{
+			BackupMethod:        builtinBackupEngineName,
+			ReplicationPosition: replicationPosition,
+			CompressionEngine:   compressionEngine,
+			DataSize:            dataSize.Get(),
+		},
+		FileEntries: fes,
+	}
+	return writeManifest(bh, bm)
+}
+
+// The files of a restore are restored into a staging directory inside
+// each data directory, before they are checked and moved into place,
+// and the files they replace are moved to another directory inside
+// it. The data directories are often symlinks or mount points of
+// other volumes, this keeps all the moves on the same file system, so
+// they are renames.
+const (
+	restoreStagingDir  = ".restore"
+	restoreReplacedDir = ".restore.old"
+)
+
+// restoreStagingCnf returns a copy of cnf with the staging
+// directories of a restore.
+func restoreStagingCnf(cnf *Mycnf) *Mycnf {
+	staging := *cnf
+	staging.InnodbDataHomeDir = path.Join(cnf.InnodbDataHomeDir, restoreStagingDir)
+	staging.InnodbLogGroupHomeDir = path.Join(cnf.InnodbLogGroupHomeDir, restoreStagingDir)
+	staging.DataDir = path.Join(cnf.DataDir, restoreStagingDir)
+	return &staging
+}
+
+// stagingDirs returns the pairs of staging and destination
+// directories of a restore. A directory can be used for several
+// bases, it is only returned once.
+func stagingDirs(cnf, staging *Mycnf) [][2]string {
+	var result [][2]string
+	seen := make(map[string]bool)
+	for _, dirs := range [][2]string{
+		{staging.InnodbDataHomeDir, cnf.InnodbDataHomeDir},
+		{staging.InnodbLogGroupHomeDir, cnf.InnodbLogGroupHomeDir},
+		{staging.DataDir, cnf.DataDir},
+	} {
+		if !seen[dirs[0]] {
+			seen[dirs[0]] = true
+			result = append(result, dirs)
+		}
+	}
+	return result
+}
+
+// moveStagedFiles moves the files and directories of the staging
+// directories into place, replacing the existing ones. The replaced
+// ones are only removed once everything has been moved.
+func moveStagedFiles(cnf, staging *Mycnf) error {
+	var replacedDirs []string
+	for _, dirs := range stagingDirs(cnf, staging) {
+		fis, err := ioutil.ReadDir(dirs[0])
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return err
+		}
+		if err := os.MkdirAll(dirs[1], os.ModePerm); err != nil {
+			return err
+		}
+		replaced := path.Join(dirs[1], restoreReplacedDir)
+		if err := os.RemoveAll(replaced); err != nil {
+			return err
+		}
+		if err := os.MkdirAll(replaced, os.ModePerm); err != nil {
+			return err
+		}
+		replacedDirs = append(replacedDirs, replaced)
+		for _, fi := range fis {
+			dst := path.Join(dirs[1], fi.Name())
+			if _, err := os.Lstat(dst); err == nil {
+				if err := os.Rename(dst, path.Join(replaced, fi.Name())); err != nil {
+					return err
+				}
+			}
+			if err := os.Rename(path.Join(dirs[0], fi.Name()), dst); err != nil {
+				return err
+			}
+		}
+	}
+	for _, dir := range replacedDirs {
+		if err := os.RemoveAll(dir); err != nil {
+			log.Warningf("Restore: cannot remove replaced files in %v: %v", dir, err)
+		}
+	}
+	return removeStagingDirs(cnf, staging)
+}
+
+// removeStagingDirs removes the staging directories of a restore.
+func removeStagingDirs(cnf, staging *Mycnf) error {
+	for _, dirs := range stagingDirs(cnf, staging) {
+		if err := os.RemoveAll(dirs[0]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sourceReader remembers the error of its reader, so it can be told
+// from the errors writing the data.
+type sourceReader struct {
+	r   io.Reader
+	err error
+}
+
+// Read is part of the io.Reader interface
+func (sr *sourceReader) Read(p []byte) (int, error) {
+	n, err := sr.r.Read(p)
+	if err != nil && err != io.EOF {
+		sr.err = err
+	}
+	return n, err
+}
+
+// readFiles reads all the files from the BackupStorage, decompresses
+// them, and checks them against their hashes, reading at most
+// bandwidthLimit bytes per second from it overall (0 for no
+// limit). If cnf is not nil, the files are written into its
+// directories. The files that don't match are returned in a
+// *BackupCorruptionError, once all the files have been read.
+func (be *builtinBackupEngine) readFiles(cnf *Mycnf, bh backupstorage.BackupHandle, fes []FileEntry, compressionEngine string, readConcurrency int, bandwidthLimit int64) error {
+	sema := sync2.NewSemaphore(readConcurrency, 0)
+	limiter := newBandwidthLimiter(bandwidthLimit)
+	rec := concurrency.AllErrorRecorder{}
+	wg := sync.WaitGroup{}
+	mu := sync.Mutex{}
+	var mismatched []string
+	for i, fe := range fes {
+		wg.Add(1)
+		go func(i int, fe FileEntry) {
+			defer wg.Done()
+
+			// wait until we are ready to go, skip if we already
+			// encountered an error
+			sema.Acquire()
+			defer sema.Release()
+			if rec.HasErrors() {
+				return
+			}
+
+			// open the source file for reading
+			name := fmt.Sprintf("%v", i)
+			source, err := bh.ReadFile(name)
+			if err != nil {
+				rec.RecordError(err)
+				return
+			}
+			defer source.Close()
+
+			// open the destination file for writing, with a
+			// buffer, or discard the data if we only check it
+			var dst io.Writer = ioutil.Discard
+			var buffer *bufio.Writer
+			if cnf != nil {
+				dstFile, err := fe.open(cnf, false)
+				if err != nil {
+					rec.RecordError(err)
+					return
+				}
+				defer dstFile.Close()
+				buffer = bufio.NewWriterSize(dstFile, 2*1024*1024)
+				dst = buffer
+			}
+
+			// create hash to write the compressed data to
+			hasher := newHasher()
+
+			// create a Tee: we split the input into the hasher
+			// and into the decompressor
+			startTime := time.Now()
+			lr := &limitedReader{r: source, limiter: limiter}
+			tee := io.TeeReader(lr, hasher)
+
+			// create the decompressor, and copy the data. Will
+			// also write to the hasher, and to the hasher of the
+			// uncompressed data. A file that cannot be read back,
+			// usually because it doesn't decompress, is corrupted
+			// too.
+			sha := sha256.New()
+			decompressor, err := newDecompressor(compressionEngine, tee)
+			if err == nil {
+				defer decompressor.Close()
+				sr := &sourceReader{r: decompressor}
+				_, err = io.Copy(io.MultiWriter(dst, sha), sr)
+				if err != nil && sr.err == nil {
+					rec.RecordError(fmt.Errorf("cannot write %v/%v: %v", fe.Base, fe.Name, err))
+					return
+				}
+			}
+
+			// check the hashes. Backups taken before the SHA256
+			// was introduced don't have it.
+			hash := hasher.HashString()
+			sum := hex.EncodeToString(sha.Sum(nil))
+			if err != nil || hash != fe.Hash || (fe.SHA256 != "" && sum != fe.SHA256) {
+				if err != nil {
+					log.Errorf("cannot read %v/%v: %v", fe.Base, fe.Name, err)
+				} else {
+					log.Errorf("hash mismatch for %v/%v, got %v and SHA256 %v, expected %v and SHA256 %v", fe.Base, fe.Name, hash, sum, fe.Hash, fe.SHA256)
+				}
+				mu.Lock()
+				mismatched = append(mismatched, path.Join(fe.Base, fe.Name))
+				mu.Unlock()
+				return
+			}
+
+			// flush the buffer
+			if buffer != nil {
+				if err := buffer.Flush(); err != nil {
+					rec.RecordError(err)
+					return
+				}
+			}
+			duration := time.Now().Sub(startTime)
+			log.Infof("read %v/%v (%v bytes) in %v (%v)", fe.Base, fe.Name, lr.count, duration, transferRate(lr.count, duration))
+		}(i, fe)
+	}
+	wg.Wait()
+	if rec.HasErrors() {
+		return rec.Error()
+	}
+	if len(mismatched) > 0 {
+		sort.Strings(mismatched)
+		return &BackupCorruptionError{Files: mismatched}
+	}
+	return nil
+}
+
+// ExecuteRestore is part of the BackupEngine interface. The files are
+// restored into staging directories inside the data directories, and
+// only moved into place once they all match the MANIFEST, so a
+// corrupted backup leaves the existing data alone.
+func (be *builtinBackupEngine) ExecuteRestore(mysqld MysqlDaemon, bh backupstorage.BackupHandle, manifest []byte, restoreConcurrency int, bandwidthLimit int64) (proto.ReplicationPosition, error) {
+	var bm builtinBackupManifest
+	if err := json.Unmarshal(manifest, &bm); err != nil {
+		return proto.ReplicationPosition{}, fmt.Errorf("cannot JSON decode %v: %v", backupManifest, err)
+	}
+
+	// remove what a previous failed restore may have left
+	cnf := mysqld.Cnf()
+	staging := restoreStagingCnf(cnf)
+	if err := removeStagingDirs(cnf, staging); err != nil {
+		return proto.ReplicationPosition{}, err
+	}
+
+	log.Infof("Restore: copying %v files", len(bm.FileEntries))
+	if err := be.readFiles(staging, bh, bm.FileEntries, restoreCompressionEngine(bm.CompressionEngine), restoreConcurrency, bandwidthLimit); err != nil {
+		if removeErr := removeStagingDirs(cnf, staging); removeErr != nil {
+			log.Warningf("Restore: cannot remove the staging directories: %v", removeErr)
+		}
+		return proto.ReplicationPosition{}, err
+	}
+
+	log.Infof("Restore: all files match the %v, moving them into place", backupManifest)
+	if err := moveStagedFiles(cnf, staging); err != nil {
+		return proto.ReplicationPosition{}, fmt.Errorf("cannot move the restored files into place: %v", err)
+	}
+	return bm.ReplicationPosition, nil
+}
+
+// ExecuteVerify is part of the BackupEngine interface.
+func (be *builtinBackupEngine) ExecuteVerify(bh backupstorage.BackupHandle, manifest []byte, verifyConcurrency int, bandwidthLimit int64) error {
+	var bm builtinBackupManifest
+	if err := json.Unmarshal(manifest, &bm); err != nil {
+		return fmt.Errorf("cannot JSON decode %v: %v", backupManifest, err)
+	}
+	return be.readFiles(nil, bh, bm.FileEntries, restoreCompressionEngine(bm.CompressionEngine), verifyConcurrency, bandwidthLimit)
+}
+
+// ShouldDrainForBackup is part of the BackupEngine interface. mysqld
+// is shut down during the backup, so the tablet cannot serve.
+func (be *builtinBackupEngine) ShouldDrainForBackup() bool {
+	return true
+}
+
+func init() {
+	BackupEngineMap[builtinBackupEngineName] = &builtinBackupEngine{}
+}
@@ -0,0 +1,350 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mysqlctl
+
+import (
+	"bytes"
+	"compress/gzip"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"github.com/youtube/vitess/go/cgzip"
+)
+
+// This file contains the compression engines used for the backup
+// files. The engine that compressed a backup is recorded in its
+// MANIFEST, so it can always be restored, even if the default
+// changes.
+
+const (
+	// noCompressionEngine stores the files as is.
+	noCompressionEngine = "none"
+
+	// gzipCompressionEngine is a single gzip stream. It is what
+	// backups taken before the compression engines were
+	// introduced use.
+	gzipCompressionEngine = "gzip"
+
+	// pgzipCompressionEngine compresses blocks of
+	// -backup_storage_block_size bytes in parallel, each as its own
+	// gzip member. The result is a valid multi-member gzip file.
+	pgzipCompressionEngine = "pgzip"
+
+	// lz4CompressionEngine and zstdCompressionEngine use the
+	// external binaries of the same name.
+	lz4CompressionEngine  = "lz4"
+	zstdCompressionEngine = "zstd"
+)
+
+var (
+	backupStorageCompress     = flag.Bool("backup_storage_compress", true, "if set, the backup files are compressed with -compression_engine_name")
+	compressionEngineName     = flag.String("compression_engine_name", pgzipCompressionEngine, "compression engine for the backup files: gzip, pgzip, lz4 or zstd (lz4 and zstd run the external binaries)")
+	compressionLevel          = flag.Int("compression_level", 1, "compression level for the backup files, the valid range depends on the engine")
+	externalDecompressorCmd   = flag.String("external_decompressor", "", "if set, command to run to decompress the backup files instead of the decompressor of their engine. It reads from stdin and writes to stdout")
+	backupStorageBlockSize    = flag.Int("backup_storage_block_size", 250000, "size in bytes of the blocks the pgzip engine compresses")
+	backupStorageNumberBlocks = flag.Int("backup_storage_number_blocks", 2, "number of blocks the pgzip engine compresses at the same time")
+)
+
+// backupCompressionEngine returns the engine to use for a new backup.
+func backupCompressionEngine() (string, error) {
+	if !*backupStorageCompress {
+		return noCompressionEngine, nil
+	}
+	switch *compressionEngineName {
+	case gzipCompressionEngine, pgzipCompressionEngine, lz4CompressionEngine, zstdCompressionEngine:
+		return *compressionEngineName, nil
+	}
+	return "", fmt.Errorf("unknown compression engine %v", *compressionEngineName)
+}
+
+// restoreCompressionEngine returns the engine that compressed a
+// backup, given the value in its MANIFEST.
+func restoreCompressionEngine(engine string) string {
+	if engine == "" {
+		return gzipCompressionEngine
+	}
+	return engine
+}
+
+// newCompressor returns a writer that compresses into w with the
+// provided engine. Closing it flushes the data, but doesn't close w.
+func newCompressor(engine string, w io.Writer) (io.WriteCloser, error) {
+	switch engine {
+	case noCompressionEngine:
+		return nopWriteCloser{w}, nil
+	case gzipCompressionEngine:
+		return cgzip.NewWriterLevel(w, *compressionLevel)
+	case pgzipCompressionEngine:
+		if *backupStorageBlockSize < 1 || *backupStorageNumberBlocks < 1 {
+			return nil, fmt.Errorf("invalid -backup_storage_block_size %v or -backup_storage_number_blocks %v", *backupStorageBlockSize, *backupStorageNumberBlocks)
+		}
+		return newParallelGzipWriter(w, *compressionLevel, *backupStorageBlockSize, *backupStorageNumberBlocks), nil
+	case lz4CompressionEngine:
+		return newExternalCompressor(fmt.Sprintf("lz4 -z -c -%v", *compressionLevel), w)
+	case zstdCompressionEngine:
+		return newExternalCompressor(fmt.Sprintf("zstd -c -%v", *compressionLevel), w)
+	}
+	return nil, fmt.Errorf("unknown compression engine %v", engine)
+}
+
+// newDecompressor returns a reader that decompresses r, compressed with
+// the provided engine. Closing it doesn't close r.
+func newDecompressor(engine string, r io.Reader) (io.ReadCloser, error) {
+	if engine == noCompressionEngine {
+		return ioutil.NopCloser(r), nil
+	}
+	if *externalDecompressorCmd != "" {
+		return newExternalDecompressor(*externalDecompressorCmd, r)
+	}
+	switch engine {
+	case gzipCompressionEngine:
+		return cgzip.NewReader(r)
+	case pgzipCompressionEngine:
+		// the Go gzip reader reads all the members
+		return gzip.NewReader(r)
+	case lz4CompressionEngine:
+		return newExternalDecompressor("lz4 -d -c", r)
+	case zstdCompressionEngine:
+		return newExternalDecompressor("zstd -d -c", r)
+	}
+	return nil, fmt.Errorf("unknown compression engine %v", engine)
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+// Close is part of the io.Closer interface
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+// parallelGzipWriter is the pgzip compressor. Blocks are compressed in
+// their own go routine with the Go gzip package, and written in order
+// by another one.
+type parallelGzipWriter struct {
+	w         io.Writer
+	level     int
+	blockSize int
+
+	buf     []byte
+	written bool
+
+	// pending has the results of the blocks being compressed, in
+	// order. Its capacity limits how many blocks are compressed
+	// at the same time.
+	pending chan chan compressedBlock
+	done    chan struct{}
+
+	// mu protects err
+	mu  sync.Mutex
+	err error
+}
+
+type compressedBlock struct {
+	data []byte
+	err  error
+}
+
+func newParallelGzipWriter(w io.Writer, level, blockSize, numBlocks int) *parallelGzipWriter {
+	pgw := &parallelGzipWriter{
+		w:         w,
+		level:     level,
+		blockSize: blockSize,
+		buf:       make([]byte, 0, blockSize),
+		pending:   make(chan chan compressedBlock, numBlocks),
+		done:      make(chan struct{}),
+	}
+	go pgw.writeBlocks()
+	return pgw
+}
+
+// writeBlocks writes the compressed blocks in order.
+func (pgw *parallelGzipWriter) writeBlocks() {
+	defer close(pgw.done)
+	for result := range pgw.pending {
+		block := <-result
+		if pgw.getError() != nil {
+			continue
+		}
+		if block.err == nil {
+			_, block.err = pgw.w.Write(block.data)
+		}
+		if block.err != nil {
+			pgw.setError(block.err)
+		}
+	}
+}
+
+func (pgw *parallelGzipWriter) getError() error {
+	pgw.mu.Lock()
+	defer pgw.mu.Unlock()
+	return pgw.err
+}
+
+func (pgw *parallelGzipWriter) setError(err error) {
+	pgw.mu.Lock()
+	defer pgw.mu.Unlock()
+	if pgw.err == nil {
+		pgw.err = err
+	}
+}
+
+// compressBlock starts compressing the current buffer.
+func (pgw *parallelGzipWriter) compressBlock() {
+	data := pgw.buf
+	pgw.buf = make([]byte, 0, pgw.blockSize)
+	pgw.written = true
+	result := make(chan compressedBlock, 1)
+	pgw.pending <- result
+	go func() {
+		var b bytes.Buffer
+		gz, err := gzip.NewWriterLevel(&b, pgw.level)
+		if err == nil {
+			if _, err = gz.Write(data); err == nil {
+				err = gz.Close()
+			}
+		}
+		result <- compressedBlock{data: b.Bytes(), err: err}
+	}()
+}
+
+// Write is part of the io.Writer interface
+func (pgw *parallelGzipWriter) Write(p []byte) (int, error) {
+	if err := pgw.getError(); err != nil {
+		return 0, err
+	}
+	written := 0
+	for len(p) > 0 {
+		n := pgw.blockSize - len(pgw.buf)
+		if n > len(p) {
+			n = len(p)
+		}
+		pgw.buf = append(pgw.buf, p[:n]...)
+		written += n
+		p = p[n:]
+		if len(pgw.buf) == pgw.blockSize {
+			pgw.compressBlock()
+		}
+	}
+	return written, nil
+}
+
+// Close is part of the io.Closer interface. It compresses the last
+// block, and waits for everything to be written.
+func (pgw *parallelGzipWriter) Close() error {
+	// an empty stream still needs one gzip member to be valid
+	if len(pgw.buf) > 0 || !pgw.written {
+		pgw.compressBlock()
+	}
+	close(pgw.pending)
+	<-pgw.done
+	return pgw.getError()
+}
+
+// externalCompressor pipes the data through an external command.
+type externalCompressor struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stderr bytes.Buffer
+}
+
+func newExternalCompressor(command string, w io.Writer) (io.WriteCloser, error) {
+	args := strings.Fields(command)
+	ec := &externalCompressor{
+		cmd: exec.Command(args[0], args[1:]...),
+	}
+	ec.cmd.Stdout = w
+	ec.cmd.Stderr = &ec.stderr
+	var err error
+	if ec.stdin, err = ec.cmd.StdinPipe(); err != nil {
+		return nil, err
+	}
+	if err := ec.cmd.Start(); err != nil {
+		return nil, fmt.Errorf("cannot start %v: %v", command, err)
+	}
+	return ec, nil
+}
+
+// Write is part of the io.Writer interface
+func (ec *externalCompressor) Write(p []byte) (int, error) {
+	return ec.stdin.Write(p)
+}
+
+// Close is part of the io.Closer interface
+func (ec *externalCompressor) Close() error {
+	ec.stdin.Close()
+	if err := ec.cmd.Wait(); err != nil {
+		return fmt.Errorf("%v failed: %v: %v", strings.Join(ec.cmd.Args, " "), err, ec.stderr.String())
+	}
+	return nil
+}
+
+// externalDecompressor reads the output of an external command.
+type externalDecompressor struct {
+	cmd    *exec.Cmd
+	stdout io.ReadCloser
+	stderr bytes.Buffer
+	waited bool
+}
+
+func newExternalDecompressor(command string, r io.Reader) (io.ReadCloser, error) {
+	args := strings.Fields(command)
+	if len(args) == 0 {
+		return nil, fmt.Errorf("empty decompressor command")
+	}
+	ed := &externalDecompressor{
+		cmd: exec.Command(args[0], args[1:]...),
+	}
+	ed.cmd.Stdin = r
+	ed.cmd.Stderr = &ed.stderr
+	var err error
+	if ed.stdout, err = ed.cmd.StdoutPipe(); err != nil {
+		return nil, err
+	}
+	if err := ed.cmd.Start(); err != nil {
+		return nil, fmt.Errorf("cannot start %v: %v", command, err)
+	}
+	return ed, nil
+}
+
+func (ed *externalDecompressor) wait() error {
+	ed.waited = true
+	if err := ed.cmd.Wait(); err != nil {
+		return fmt.Errorf("%v failed: %v: %v", strings.Join(ed.cmd.Args, " "), err, ed.stderr.String())
+	}
+	return nil
+}
+
+// Read is part of the io.Reader interface. At the end of the data, it
+// returns the command error, if any.
+func (ed *externalDecompressor) Read(p []byte) (int, error) {
+	if ed.waited {
+		return 0, io.EOF
+	}
+	n, err := ed.stdout.Read(p)
+	if err == io.EOF {
+		if waitErr := ed.wait(); waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
+}
+
+// Close is part of the io.Closer interface
+func (ed *externalDecompressor) Close() error {
+	if ed.waited {
+		return nil
+	}
+	// we stopped reading early
+	ed.cmd.Process.Kill()
+	ed.wait()
+	return nil
+}
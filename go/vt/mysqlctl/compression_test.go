@@ -0,0 +1,239 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mysqlctl
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os/exec"
+	"testing"
+)
+
+// compressibleData returns size bytes of data that compresses
+// about as well as database files.
+func compressibleData(size int) []byte {
+	words := []string{"vitess", "tablet", "keyspace", "shard", "replica", "0123456789"}
+	r := rand.New(rand.NewSource(1))
+	var b bytes.Buffer
+	for b.Len() < size {
+		b.WriteString(words[r.Intn(len(words))])
+		b.WriteByte(byte(r.Intn(256)))
+	}
+	return b.Bytes()[:size]
+}
+
+func compressDecompress(t *testing.T, engine string, data []byte) []byte {
+	var compressed bytes.Buffer
+	compressor, err := newCompressor(engine, &compressed)
+	if err != nil {
+		t.Fatalf("newCompressor(%v) failed: %v", engine, err)
+	}
+	// write in odd sized chunks, so writes cross blocks
+	for start := 0; start < len(data); start += 333 {
+		end := start + 333
+		if end > len(data) {
+			end = len(data)
+		}
+		if _, err := compressor.Write(data[start:end]); err != nil {
+			t.Fatalf("%v: Write failed: %v", engine, err)
+		}
+	}
+	if err := compressor.Close(); err != nil {
+		t.Fatalf("%v: Close failed: %v", engine, err)
+	}
+
+	decompressor, err := newDecompressor(engine, &compressed)
+	if err != nil {
+		t.Fatalf("newDecompressor(%v) failed: %v", engine, err)
+	}
+	defer decompressor.Close()
+	got, err := ioutil.ReadAll(decompressor)
+	if err != nil {
+		t.Fatalf("%v: ReadAll failed: %v", engine, err)
+	}
+	return got
+}
+
+func skipIfMissing(t testing.TB, binary string) {
+	if _, err := exec.LookPath(binary); err != nil {
+		t.Skipf("%v is not installed", binary)
+	}
+}
+
+func TestCompressionEngines(t *testing.T) {
+	oldBlockSize := *backupStorageBlockSize
+	defer func() { *backupStorageBlockSize = oldBlockSize }()
+	*backupStorageBlockSize = 1000
+
+	data := compressibleData(100000)
+	for _, engine := range []string{noCompressionEngine, gzipCompressionEngine, pgzipCompressionEngine} {
+		for _, size := range []int{0, 10, 1000, 100000} {
+			if got := compressDecompress(t, engine, data[:size]); !bytes.Equal(got, data[:size]) {
+				t.Errorf("%v: got back %v bytes that don't match the %v original ones", engine, len(got), size)
+			}
+		}
+	}
+}
+
+func TestExternalCompressionEngines(t *testing.T) {
+	data := compressibleData(100000)
+	for _, engine := range []string{lz4CompressionEngine, zstdCompressionEngine} {
+		if _, err := exec.LookPath(engine); err != nil {
+			t.Logf("%v is not installed, skipping it", engine)
+			continue
+		}
+		if got := compressDecompress(t, engine, data); !bytes.Equal(got, data) {
+			t.Errorf("%v: got back %v bytes that don't match the original ones", engine, len(got))
+		}
+	}
+}
+
+func TestExternalDecompressor(t *testing.T) {
+	skipIfMissing(t, "gzip")
+	oldBlockSize := *backupStorageBlockSize
+	oldDecompressor := *externalDecompressorCmd
+	defer func() {
+		*backupStorageBlockSize = oldBlockSize
+		*externalDecompressorCmd = oldDecompressor
+	}()
+	*backupStorageBlockSize = 1000
+	*externalDecompressorCmd = "gzip -d -c"
+
+	// gzip reads both single and multi members files
+	data := compressibleData(100000)
+	for _, engine := range []string{gzipCompressionEngine, pgzipCompressionEngine} {
+		if got := compressDecompress(t, engine, data); !bytes.Equal(got, data) {
+			t.Errorf("%v: got back %v bytes that don't match the original ones", engine, len(got))
+		}
+	}
+
+	// a failing decompressor returns an error
+	decompressor, err := newDecompressor(gzipCompressionEngine, bytes.NewBufferString("not compressed"))
+	if err != nil {
+		t.Fatalf("newDecompressor failed: %v", err)
+	}
+	if _, err := ioutil.ReadAll(decompressor); err == nil {
+		t.Errorf("decompressing garbage should have failed")
+	}
+	decompressor.Close()
+}
+
+func TestBackupCompressionEngine(t *testing.T) {
+	oldCompress := *backupStorageCompress
+	oldName := *compressionEngineName
+	defer func() {
+		*backupStorageCompress = oldCompress
+		*compressionEngineName = oldName
+	}()
+
+	*backupStorageCompress = false
+	if got, err := backupCompressionEngine(); err != nil || got != noCompressionEngine {
+		t.Errorf("backupCompressionEngine() = (%v, %v), want (%v, nil)", got, err, noCompressionEngine)
+	}
+	*backupStorageCompress = true
+	*compressionEngineName = "bzip2"
+	if _, err := backupCompressionEngine(); err == nil {
+		t.Errorf("backupCompressionEngine() should have failed with an unknown engine")
+	}
+	if got := restoreCompressionEngine(""); got != gzipCompressionEngine {
+		t.Errorf("old backups should restore with %v, got %v", gzipCompressionEngine, got)
+	}
+}
+
+// benchmarkCompress compresses a synthetic 1GB data set. The same
+// 8MB are written over and over, so generating the data doesn't
+// count in the results.
+func benchmarkCompress(b *testing.B, engine string) {
+	const total = 1024 * 1024 * 1024
+	data := compressibleData(8 * 1024 * 1024)
+	b.SetBytes(total)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		compressor, err := newCompressor(engine, ioutil.Discard)
+		if err != nil {
+			b.Fatalf("newCompressor(%v) failed: %v", engine, err)
+		}
+		for written := 0; written < total; written += len(data) {
+			if _, err := compressor.Write(data); err != nil {
+				b.Fatalf("Write failed: %v", err)
+			}
+		}
+		if err := compressor.Close(); err != nil {
+			b.Fatalf("Close failed: %v", err)
+		}
+	}
+}
+
+func BenchmarkCompressGzip(b *testing.B) {
+	benchmarkCompress(b, gzipCompressionEngine)
+}
+
+func BenchmarkCompressPgzip(b *testing.B) {
+	benchmarkCompress(b, pgzipCompressionEngine)
+}
+
+func BenchmarkCompressPgzipLargeBlocks(b *testing.B) {
+	oldBlockSize := *backupStorageBlockSize
+	oldNumberBlocks := *backupStorageNumberBlocks
+	defer func() {
+		*backupStorageBlockSize = oldBlockSize
+		*backupStorageNumberBlocks = oldNumberBlocks
+	}()
+	*backupStorageBlockSize = 1024 * 1024
+	*backupStorageNumberBlocks = 8
+	benchmarkCompress(b, pgzipCompressionEngine)
+}
+
+func BenchmarkCompressLz4(b *testing.B) {
+	skipIfMissing(b, "lz4")
+	benchmarkCompress(b, lz4CompressionEngine)
+}
+
+func BenchmarkCompressZstd(b *testing.B) {
+	skipIfMissing(b, "zstd")
+	benchmarkCompress(b, zstdCompressionEngine)
+}
+
+// benchmarkDecompress decompresses the synthetic 1GB data set,
+// compressed once before the timer starts.
+func benchmarkDecompress(b *testing.B, engine string) {
+	const total = 1024 * 1024 * 1024
+	data := compressibleData(8 * 1024 * 1024)
+	var compressed bytes.Buffer
+	compressor, err := newCompressor(engine, &compressed)
+	if err != nil {
+		b.Fatalf("newCompressor(%v) failed: %v", engine, err)
+	}
+	for written := 0; written < total; written += len(data) {
+		if _, err := compressor.Write(data); err != nil {
+			b.Fatalf("Write failed: %v", err)
+		}
+	}
+	if err := compressor.Close(); err != nil {
+		b.Fatalf("Close failed: %v", err)
+	}
+	b.SetBytes(total)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		decompressor, err := newDecompressor(engine, bytes.NewReader(compressed.Bytes()))
+		if err != nil {
+			b.Fatalf("newDecompressor(%v) failed: %v", engine, err)
+		}
+		n, err := io.Copy(ioutil.Discard, decompressor)
+		if err != nil {
+			b.Fatalf("Copy failed: %v", err)
+		}
+		if n != total {
+			b.Fatalf("got %v bytes, want %v", n, total)
+		}
+		decompressor.Close()
+	}
+}
+
+func BenchmarkDecompressPgzip(b *testing.B) {
+	benchmarkDecompress(b, pgzipCompressionEngine)
+}
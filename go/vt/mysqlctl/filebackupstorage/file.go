@@ -13,6 +13,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path"
+	"syscall"
 
 	"github.com/youtube/vitess/go/vt/mysqlctl/backupstorage"
 )
@@ -80,7 +81,6 @@ type FileBackupStorage struct{}
 
 // ListBackups is part of the BackupStorage interface
 func (fbs *FileBackupStorage) ListBackups(bucket string) ([]backupstorage.BackupHandle, error) {
-	// ReadDir already sorts the results
 	p := path.Join(*FileBackupStorageRoot, bucket)
 	fi, err := ioutil.ReadDir(p)
 	if err != nil {
@@ -105,6 +105,7 @@ func (fbs *FileBackupStorage) ListBackups(bucket string) ([]backupstorage.Backup
 			readOnly: true,
 		})
 	}
+	backupstorage.SortBackups(result)
 	return result, nil
 }
 
@@ -136,6 +137,27 @@ func (fbs *FileBackupStorage) RemoveBackup(bucket, name string) error {
 	return os.RemoveAll(p)
 }
 
+// Space is part of the backupstorage.SpaceChecker interface. It
+// reports the space of the file system holding the bucket, or its
+// closest existing parent directory. The blocks reserved for root
+// are not counted.
+func (fbs *FileBackupStorage) Space(bucket string) (total, available uint64, err error) {
+	p := path.Join(*FileBackupStorageRoot, bucket)
+	for {
+		if _, err := os.Stat(p); err == nil || !os.IsNotExist(err) || p == "/" || p == "." {
+			break
+		}
+		p = path.Dir(p)
+	}
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(p, &st); err != nil {
+		return 0, 0, fmt.Errorf("cannot statfs %v: %v", p, err)
+	}
+	used := (st.Blocks - st.Bfree) * uint64(st.Bsize)
+	available = st.Bavail * uint64(st.Bsize)
+	return used + available, available, nil
+}
+
 func init() {
 	backupstorage.BackupStorageMap["file"] = &FileBackupStorage{}
 }
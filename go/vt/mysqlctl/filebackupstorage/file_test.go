@@ -9,14 +9,14 @@ import (
 	"io/ioutil"
 	"os"
 	"testing"
+
+	"github.com/youtube/vitess/go/vt/mysqlctl/backupstorage/test"
 )
 
 // This file tests the file BackupStorage engine.
 
-// Note this is a very generic test for BackupStorage implementations,
-// we test the interface only. But making it a generic test library is
-// more cumbersome, we'll do that when we have an actual need for
-// another BackupStorage implementation.
+// The tests shared by all the BackupStorage implementations are in
+// the backupstorage/test package.
 
 // setupFileBackupStorage creates a temporary directory, and
 // returns a FileBackupStorage based on it
@@ -188,3 +188,23 @@ func TestFileContents(t *testing.T) {
 		t.Fatalf("rc.Close failed: %v", err)
 	}
 }
+
+func TestAll(t *testing.T) {
+	fbs := setupFileBackupStorage(t)
+	defer cleanupFileBackupStorage(fbs)
+	test.CheckAll(t, fbs)
+}
+
+func TestSpace(t *testing.T) {
+	fbs := setupFileBackupStorage(t)
+	defer cleanupFileBackupStorage(fbs)
+
+	// the bucket doesn't exist yet, the root is used
+	total, available, err := fbs.Space("keyspace/shard")
+	if err != nil {
+		t.Fatalf("Space failed: %v", err)
+	}
+	if total == 0 || available > total {
+		t.Errorf("Space returned total %v and available %v", total, available)
+	}
+}
@@ -0,0 +1,53 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package gcsbackupstorage implements the BackupStorage interface for
+// Google Cloud Storage. It uses the XML API of GCS, which is
+// compatible with S3, with HMAC keys for the authentication. See
+// https://cloud.google.com/storage/docs/interoperability
+package gcsbackupstorage
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/youtube/vitess/go/vt/mysqlctl/backupstorage"
+	"github.com/youtube/vitess/go/vt/mysqlctl/s3backupstorage"
+)
+
+// gcsEndpoint is the endpoint of the XML API.
+const gcsEndpoint = "https://storage.googleapis.com"
+
+var (
+	gcsBucket   = flag.String("gcs_backup_storage_bucket", "", "Google Cloud Storage bucket of the gcs backup storage")
+	gcsRoot     = flag.String("gcs_backup_storage_root", "", "prefix of the objects of the gcs backup storage in the bucket")
+	gcsPartSize = flag.Int("gcs_backup_part_size", 16*1024*1024, "size in bytes of the parts the files of the gcs backup storage are uploaded in (5MB minimum)")
+)
+
+// flagsConfig returns the configuration from the flags. The HMAC key
+// is read from the GCS_ACCESS_KEY_ID and GCS_SECRET_ACCESS_KEY
+// environment variables.
+func flagsConfig() (*s3backupstorage.Config, error) {
+	if *gcsBucket == "" {
+		return nil, fmt.Errorf("-gcs_backup_storage_bucket is required by the gcs backup storage")
+	}
+	if *gcsPartSize < 5*1024*1024 {
+		return nil, fmt.Errorf("-gcs_backup_part_size cannot be less than 5MB")
+	}
+	return &s3backupstorage.Config{
+		Endpoint: gcsEndpoint,
+		// GCS ignores the region, but it is part of the signature
+		Region:    "auto",
+		Bucket:    *gcsBucket,
+		Root:      *gcsRoot,
+		AccessKey: os.Getenv("GCS_ACCESS_KEY_ID"),
+		SecretKey: os.Getenv("GCS_SECRET_ACCESS_KEY"),
+		PartSize:  *gcsPartSize,
+	}, nil
+}
+
+func init() {
+	backupstorage.BackupStorageMap["gcs"] = s3backupstorage.NewBackupStorage(flagsConfig)
+}
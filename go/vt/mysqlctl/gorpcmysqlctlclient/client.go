@@ -31,17 +31,34 @@ func goRpcMysqlctlClientFactory(network, addr string, dialTimeout time.Duration)
 	return &goRpcMysqlctlClient{rpcClient}, nil
 }
 
-// Start is part of the MysqlctlClient interface.
-func (c *goRpcMysqlctlClient) Start(mysqlWaitTime time.Duration) error {
-	return c.rpcClient.Call(context.TODO(), "MysqlctlServer.Start", &mysqlWaitTime, nil)
+// Start is part of the MysqlctlClient interface. It sends how long
+// the server can wait, 0 meaning no deadline.
+func (c *goRpcMysqlctlClient) Start(ctx context.Context) error {
+	var mysqlWaitTime time.Duration
+	if deadline, ok := ctx.Deadline(); ok {
+		mysqlWaitTime = deadline.Sub(time.Now())
+		if mysqlWaitTime <= 0 {
+			return ctx.Err()
+		}
+	}
+	return c.rpcClient.Call(ctx, "MysqlctlServer.Start", &mysqlWaitTime, nil)
 }
 
-// Shutdown is part of the MysqlctlClient interface.
-func (c *goRpcMysqlctlClient) Shutdown(waitForMysqld bool, mysqlWaitTime time.Duration) error {
-	if !waitForMysqld {
-		mysqlWaitTime = 0
+// Shutdown is part of the MysqlctlClient interface. It sends how long
+// the server can wait, 0 meaning not to wait, and a negative value to
+// wait without a deadline.
+func (c *goRpcMysqlctlClient) Shutdown(ctx context.Context, waitForMysqld bool) error {
+	var mysqlWaitTime time.Duration
+	if waitForMysqld {
+		mysqlWaitTime = -1
+		if deadline, ok := ctx.Deadline(); ok {
+			mysqlWaitTime = deadline.Sub(time.Now())
+			if mysqlWaitTime <= 0 {
+				return ctx.Err()
+			}
+		}
 	}
-	return c.rpcClient.Call(context.TODO(), "MysqlctlServer.Shutdown", &mysqlWaitTime, nil)
+	return c.rpcClient.Call(ctx, "MysqlctlServer.Shutdown", &mysqlWaitTime, nil)
 }
 
 // Close is part of the MysqlctlClient interface.
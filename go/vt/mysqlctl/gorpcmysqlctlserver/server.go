@@ -22,13 +22,26 @@ type MysqlctlServer struct {
 }
 
 // Start implements the server side of the MysqlctlClient interface.
+// args is how long to wait, 0 meaning no deadline.
 func (s *MysqlctlServer) Start(ctx context.Context, args *time.Duration, reply *int) error {
-	return s.mysqld.Start(*args)
+	if *args > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *args)
+		defer cancel()
+	}
+	return s.mysqld.Start(ctx)
 }
 
 // Shutdown implements the server side of the MysqlctlClient interface.
+// args is how long to wait, 0 meaning not to wait, and a negative
+// value to wait without a deadline.
 func (s *MysqlctlServer) Shutdown(ctx context.Context, args *time.Duration, reply *int) error {
-	return s.mysqld.Shutdown(*args > 0, *args)
+	if *args > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *args)
+		defer cancel()
+	}
+	return s.mysqld.Shutdown(ctx, *args != 0)
 }
 
 // StartServer registers the Server for RPCs.
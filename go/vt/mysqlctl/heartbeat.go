@@ -0,0 +1,53 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mysqlctl
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// CreateHeartbeatTable returns the commands to execute to create the
+// _vt.heartbeat table. It is safe to run these commands even if the
+// table already exists.
+func CreateHeartbeatTable() []string {
+	return []string{
+		"CREATE DATABASE IF NOT EXISTS _vt",
+		`CREATE TABLE IF NOT EXISTS _vt.heartbeat (
+  id INT UNSIGNED NOT NULL,
+  time_created_ns BIGINT UNSIGNED NOT NULL,
+  PRIMARY KEY (id)) ENGINE=InnoDB`}
+}
+
+// UpdateHeartbeat returns the SQL command the master runs to update
+// the _vt.heartbeat table. The row replicates to the slaves, that can
+// then compute their lag with ReadHeartbeat.
+func UpdateHeartbeat(now time.Time) string {
+	return fmt.Sprintf("INSERT INTO _vt.heartbeat (id, time_created_ns) VALUES (1, %v) "+
+		"ON DUPLICATE KEY UPDATE time_created_ns=VALUES(time_created_ns)", now.UnixNano())
+}
+
+// ReadHeartbeat returns how long ago the last heartbeat that made it
+// to this server was written by the master.
+func ReadHeartbeat(mysqld MysqlDaemon, now time.Time) (time.Duration, error) {
+	qr, err := mysqld.FetchSuperQuery("SELECT time_created_ns FROM _vt.heartbeat WHERE id=1")
+	if err != nil {
+		return 0, err
+	}
+	if len(qr.Rows) != 1 || len(qr.Rows[0]) != 1 {
+		return 0, fmt.Errorf("no heartbeat row found")
+	}
+	timeCreatedNS, err := strconv.ParseInt(qr.Rows[0][0].String(), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid heartbeat value %v: %v", qr.Rows[0][0], err)
+	}
+	lag := now.Sub(time.Unix(0, timeCreatedNS))
+	if lag < 0 {
+		// clocks are not perfectly in sync
+		lag = 0
+	}
+	return lag, nil
+}
@@ -0,0 +1,88 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mysqlctl
+
+import (
+	"sync"
+
+	"github.com/youtube/vitess/go/sqldb"
+	"github.com/youtube/vitess/go/vt/concurrency"
+	"golang.org/x/net/context"
+)
+
+// Instances is a set of mysqld instances running on the same machine,
+// for instance for a test that needs several tablets in one process.
+// Its methods act on all the instances concurrently.
+type Instances []*Mysqld
+
+// NewInstances creates an instance for each uid. The first one uses
+// overrides.MysqlPort, the next ones the following ports.
+func NewInstances(uids []uint32, overrides MycnfOverrides, dba, app, repl sqldb.ConnParams) Instances {
+	instances := make(Instances, len(uids))
+	for i, uid := range uids {
+		o := overrides
+		o.MysqlPort += i
+		instances[i] = NewMysqldForInstance(uid, o, dba, app, repl)
+	}
+	return instances
+}
+
+// forEach runs f on all instances concurrently, and returns all the
+// errors.
+func (instances Instances) forEach(f func(mysqld *Mysqld) error) error {
+	wg := sync.WaitGroup{}
+	rec := concurrency.AllErrorRecorder{}
+	for _, mysqld := range instances {
+		wg.Add(1)
+		go func(mysqld *Mysqld) {
+			defer wg.Done()
+			rec.RecordError(f(mysqld))
+		}(mysqld)
+	}
+	wg.Wait()
+	return rec.Error()
+}
+
+// InitConfig creates the directories and my.cnf of all instances.
+func (instances Instances) InitConfig() error {
+	return instances.forEach(func(mysqld *Mysqld) error {
+		return mysqld.InitConfig()
+	})
+}
+
+// Init initializes and starts all instances.
+func (instances Instances) Init(ctx context.Context, bootstrapArchive string) error {
+	return instances.forEach(func(mysqld *Mysqld) error {
+		return mysqld.Init(ctx, bootstrapArchive)
+	})
+}
+
+// Start starts all instances.
+func (instances Instances) Start(ctx context.Context) error {
+	return instances.forEach(func(mysqld *Mysqld) error {
+		return mysqld.Start(ctx)
+	})
+}
+
+// Shutdown stops all instances.
+func (instances Instances) Shutdown(ctx context.Context, waitForMysqld bool) error {
+	return instances.forEach(func(mysqld *Mysqld) error {
+		return mysqld.Shutdown(ctx, waitForMysqld)
+	})
+}
+
+// Teardown stops all instances and deletes their data.
+func (instances Instances) Teardown(force bool) error {
+	return instances.forEach(func(mysqld *Mysqld) error {
+		return mysqld.Teardown(force)
+	})
+}
+
+// Close closes the connection pools of all instances.
+func (instances Instances) Close() {
+	for _, mysqld := range instances {
+		mysqld.Close()
+	}
+}
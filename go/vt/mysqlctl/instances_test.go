@@ -0,0 +1,137 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mysqlctl
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/youtube/vitess/go/vt/dbconfigs"
+	"golang.org/x/net/context"
+)
+
+// fakeVtRoot sets up a VTROOT with my.cnf templates, and the provided
+// hooks, and returns the directory to use as the data root.
+func fakeVtRoot(t *testing.T, hooks map[string]string) (string, func()) {
+	dir, err := ioutil.TempDir("", "instances_test")
+	if err != nil {
+		t.Fatalf("TempDir failed: %v", err)
+	}
+	for _, d := range []string{"config/mycnf", "vthook", "data"} {
+		if err := os.MkdirAll(path.Join(dir, d), 0755); err != nil {
+			t.Fatalf("MkdirAll failed: %v", err)
+		}
+	}
+	for _, name := range []string{"default.cnf", "master.cnf", "replica.cnf"} {
+		if err := ioutil.WriteFile(path.Join(dir, "config/mycnf", name), []byte("port = {{.MysqlPort}}\n"), 0644); err != nil {
+			t.Fatalf("WriteFile failed: %v", err)
+		}
+	}
+	for name, script := range hooks {
+		if err := ioutil.WriteFile(path.Join(dir, "vthook", name), []byte("#!/bin/sh\n"+script+"\n"), 0755); err != nil {
+			t.Fatalf("WriteFile failed: %v", err)
+		}
+	}
+	oldVtRoot := os.Getenv("VTROOT")
+	os.Setenv("VTROOT", dir)
+	return path.Join(dir, "data"), func() {
+		os.Setenv("VTROOT", oldVtRoot)
+		os.RemoveAll(dir)
+	}
+}
+
+func TestNewMycnfForInstance(t *testing.T) {
+	cnf := NewMycnfForInstance(12, MycnfOverrides{DataRoot: "/tmp/root", MysqlPort: 15000})
+	if cnf.MysqlPort != 15000 {
+		t.Errorf("got port %v", cnf.MysqlPort)
+	}
+	for _, p := range append(cnf.directoryList(), cnf.path, cnf.SocketFile, cnf.BinLogPath, cnf.RelayLogPath) {
+		if !strings.HasPrefix(p, "/tmp/root/vt_0000000012/") {
+			t.Errorf("%v is not under the data root", p)
+		}
+	}
+	if cnf.snapshotDir != "/tmp/root/snapshot/vt_0000000012" {
+		t.Errorf("got snapshot dir %v", cnf.snapshotDir)
+	}
+
+	mysqld := NewMysqldForInstance(12, MycnfOverrides{DataRoot: "/tmp/root"}, dbconfigs.DefaultDBConfigs.Dba, dbconfigs.DefaultDBConfigs.App.ConnParams, dbconfigs.DefaultDBConfigs.Repl)
+	defer mysqld.Close()
+	if mysqld.TabletDir != "/tmp/root/vt_0000000012" {
+		t.Errorf("got tablet dir %v", mysqld.TabletDir)
+	}
+	if mysqld.dba.UnixSocket != mysqld.config.SocketFile || mysqld.dbApp.UnixSocket != mysqld.config.SocketFile {
+		t.Errorf("the connections should use the instance socket: %v %v", mysqld.dba.UnixSocket, mysqld.dbApp.UnixSocket)
+	}
+}
+
+func TestInstancesInitConfigTeardown(t *testing.T) {
+	dataRoot, cleanup := fakeVtRoot(t, nil)
+	defer cleanup()
+
+	instances := NewInstances([]uint32{1, 2, 3}, MycnfOverrides{DataRoot: dataRoot, MysqlPort: 15000}, dbconfigs.DefaultDBConfigs.Dba, dbconfigs.DefaultDBConfigs.App.ConnParams, dbconfigs.DefaultDBConfigs.Repl)
+	defer instances.Close()
+	if err := instances.InitConfig(); err != nil {
+		t.Fatalf("InitConfig failed: %v", err)
+	}
+	for i, mysqld := range instances {
+		data, err := ioutil.ReadFile(mysqld.config.path)
+		if err != nil {
+			t.Fatalf("ReadFile failed: %v", err)
+		}
+		if want := fmt.Sprintf("port = %v", 15000+i); !strings.Contains(string(data), want) {
+			t.Errorf("my.cnf of instance %v doesn't contain %q:\n%v", i, want, string(data))
+		}
+		if _, err := os.Stat(path.Dir(mysqld.config.BinLogPath)); err != nil {
+			t.Errorf("bin log dir of instance %v wasn't created: %v", i, err)
+		}
+	}
+
+	if err := instances.Teardown(false); err != nil {
+		t.Fatalf("Teardown failed: %v", err)
+	}
+	for i, mysqld := range instances {
+		if _, err := os.Stat(mysqld.config.DataDir); !os.IsNotExist(err) {
+			t.Errorf("data dir of instance %v wasn't removed: %v", i, err)
+		}
+	}
+}
+
+func TestInstancesStartHookEnv(t *testing.T) {
+	dataRoot, cleanup := fakeVtRoot(t, map[string]string{
+		"mysqld_start": `echo "$MYSQL_PORT $MYSQL_SOCKET" > "$TABLET_DIR/hook.out"
+exit 1`,
+	})
+	defer cleanup()
+
+	instances := NewInstances([]uint32{1, 2}, MycnfOverrides{DataRoot: dataRoot, MysqlPort: 15000}, dbconfigs.DefaultDBConfigs.Dba, dbconfigs.DefaultDBConfigs.App.ConnParams, dbconfigs.DefaultDBConfigs.Repl)
+	defer instances.Close()
+	if err := instances.InitConfig(); err != nil {
+		t.Fatalf("InitConfig failed: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	err := instances.Start(ctx)
+	if err == nil {
+		t.Fatalf("Start should have failed")
+	}
+	if got := strings.Count(err.Error(), "mysqld_start hook failed"); got != 2 {
+		t.Errorf("Start should have returned the errors of both instances: %v", err)
+	}
+	for i, mysqld := range instances {
+		data, err := ioutil.ReadFile(path.Join(mysqld.TabletDir, "hook.out"))
+		if err != nil {
+			t.Fatalf("the hook of instance %v didn't run: %v", i, err)
+		}
+		if got, want := strings.TrimSpace(string(data)), fmt.Sprintf("%v %v", 15000+i, mysqld.config.SocketFile); got != want {
+			t.Errorf("hook environment of instance %v: got %q, want %q", i, got, want)
+		}
+	}
+}
@@ -90,6 +90,11 @@ type Mycnf struct {
 
 	mycnfMap map[string]string
 	path     string // the actual path that represents this mycnf
+
+	// tabletDir and snapshotDir are set when the Mycnf was generated
+	// for an instance. Otherwise, the defaults for ServerId are used.
+	tabletDir   string
+	snapshotDir string
 }
 
 func (cnf *Mycnf) lookupAndCheck(key string) string {
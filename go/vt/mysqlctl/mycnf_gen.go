@@ -21,7 +21,7 @@ import (
 //
 // The default 'vt' file structure is as follows:
 // - the root is specified by the environment variable VTDATAROOT,
-//   and defaults to /vt
+//   and defaults to /vt. NewMycnfForInstance can use another root.
 // - each tablet with uid NNNNNNNNNN is located in <root>/vt_NNNNNNNNNN
 // - in that tablet directory, there is a my.cnf file for the mysql instance,
 //   and 'data', 'innodb', 'relay-logs', 'bin-logs' directories.
@@ -45,11 +45,34 @@ const (
 // tabletservers deployed within a keyspace, lest there be collisions on disk.
 // mysqldPort needs to be unique per instance per machine.
 func NewMycnf(uid uint32, mysqlPort int) *Mycnf {
+	return NewMycnfForInstance(uid, MycnfOverrides{MysqlPort: mysqlPort})
+}
+
+// MycnfOverrides changes the values NewMycnfForInstance derives from
+// the environment, so several instances can live side by side.
+type MycnfOverrides struct {
+	// DataRoot is the parent of the tablet and snapshot
+	// directories. It defaults to VTDATAROOT.
+	DataRoot string
+
+	// MysqlPort is the port mysqld listens on.
+	MysqlPort int
+}
+
+// NewMycnfForInstance is like NewMycnf, but all the paths are under
+// overrides.DataRoot if it is set.
+func NewMycnfForInstance(uid uint32, overrides MycnfOverrides) *Mycnf {
+	dataRoot := overrides.DataRoot
+	if dataRoot == "" {
+		dataRoot = env.VtDataRoot()
+	}
+	tabletDir := tabletDirIn(dataRoot, uid)
 	cnf := new(Mycnf)
-	cnf.path = mycnfFile(uid)
-	tabletDir := TabletDir(uid)
+	cnf.path = path.Join(tabletDir, "my.cnf")
+	cnf.tabletDir = tabletDir
+	cnf.snapshotDir = snapshotDirIn(dataRoot, uid)
 	cnf.ServerId = uid
-	cnf.MysqlPort = mysqlPort
+	cnf.MysqlPort = overrides.MysqlPort
 	cnf.DataDir = path.Join(tabletDir, dataDir)
 	cnf.InnodbDataHomeDir = path.Join(tabletDir, innodbDataSubdir)
 	cnf.InnodbLogGroupHomeDir = path.Join(tabletDir, innodbLogSubdir)
@@ -71,12 +94,20 @@ func NewMycnf(uid uint32, mysqlPort int) *Mycnf {
 
 // TabletDir returns the default directory for a tablet
 func TabletDir(uid uint32) string {
-	return fmt.Sprintf("%s/vt_%010d", env.VtDataRoot(), uid)
+	return tabletDirIn(env.VtDataRoot(), uid)
+}
+
+func tabletDirIn(dataRoot string, uid uint32) string {
+	return fmt.Sprintf("%s/vt_%010d", dataRoot, uid)
 }
 
 // SnapshotDir returns the default directory for a tablet's snapshots
 func SnapshotDir(uid uint32) string {
-	return fmt.Sprintf("%s/%s/vt_%010d", env.VtDataRoot(), snapshotDir, uid)
+	return snapshotDirIn(env.VtDataRoot(), uid)
+}
+
+func snapshotDirIn(dataRoot string, uid uint32) string {
+	return fmt.Sprintf("%s/%s/vt_%010d", dataRoot, snapshotDir, uid)
 }
 
 // mycnfFile returns the default location of the my.cnf file.
@@ -98,8 +129,8 @@ func (cnf *Mycnf) directoryList() []string {
 		cnf.InnodbDataHomeDir,
 		cnf.InnodbLogGroupHomeDir,
 		cnf.TmpDir,
-		path.Join(TabletDir(cnf.ServerId), relayLogDir),
-		path.Join(TabletDir(cnf.ServerId), binLogDir),
+		path.Dir(cnf.RelayLogPath),
+		path.Dir(cnf.BinLogPath),
 	}
 }
 
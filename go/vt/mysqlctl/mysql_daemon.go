@@ -24,8 +24,8 @@ type MysqlDaemon interface {
 	Cnf() *Mycnf
 
 	// methods related to mysql running or not
-	Start(mysqlWaitTime time.Duration) error
-	Shutdown(waitForMysqld bool, mysqlWaitTime time.Duration) error
+	Start(ctx context.Context) error
+	Shutdown(ctx context.Context, waitForMysqld bool) error
 
 	// GetMysqlPort returns the current port mysql is listening on.
 	GetMysqlPort() (int, error)
@@ -38,13 +38,14 @@ type MysqlDaemon interface {
 	MasterPosition() (proto.ReplicationPosition, error)
 	IsReadOnly() (bool, error)
 	SetReadOnly(on bool) error
-	StartReplicationCommands(status *proto.ReplicationStatus) ([]string, error)
-	SetMasterCommands(masterHost string, masterPort int) ([]string, error)
+	StartReplicationCommands(keyspace, shard string, status *proto.ReplicationStatus) ([]string, error)
+	SetMasterCommands(keyspace, shard, masterHost string, masterPort int) ([]string, error)
 	WaitForReparentJournal(ctx context.Context, timeCreatedNS int64) error
 
-	// DemoteMaster waits for all current transactions to finish,
-	// and returns the current replication position. It will not
-	// change the read_only state of the server.
+	// DemoteMaster makes the server read-only (using super_read_only
+	// where supported), kills the remaining write connections, waits
+	// for all current transactions to finish, and returns the final
+	// replication position, all in one call.
 	DemoteMaster() (proto.ReplicationPosition, error)
 
 	WaitMasterPos(proto.ReplicationPosition, time.Duration) error
@@ -53,6 +54,18 @@ type MysqlDaemon interface {
 	// the read_only state of the server.
 	PromoteSlave(map[string]string) (proto.ReplicationPosition, error)
 
+	// PurgeBinaryLogs purges the binary logs according to the
+	// policy, except the ones the consumers still need.
+	PurgeBinaryLogs(policy BinlogPurgePolicy, consumers func() ([]BinlogConsumer, error)) ([]string, error)
+
+	// ApplyReplicaSafetySettings sets the crash-safe settings for
+	// a replica, and returns the ones that don't match.
+	ApplyReplicaSafetySettings(ctx context.Context) ([]ReplicaSafetyMismatch, error)
+
+	// ReloadUsers applies the users spec file, and returns the
+	// statements it ran.
+	ReloadUsers() ([]string, error)
+
 	// Schema related methods
 	GetSchema(dbName string, tables, excludeTables []string, includeViews bool) (*proto.SchemaDefinition, error)
 
@@ -106,6 +119,13 @@ type FakeMysqlDaemon struct {
 	// CurrentMasterport is returned by SlaveStatus
 	CurrentMasterPort int
 
+	// LastIOErrno and LastSQLErrno are returned by SlaveStatus
+	LastIOErrno  int
+	LastSQLErrno int
+
+	// SecondsBehindMaster is returned by SlaveStatus
+	SecondsBehindMaster uint
+
 	// ReadOnly is the current value of the flag
 	ReadOnly bool
 
@@ -134,9 +154,30 @@ type FakeMysqlDaemon struct {
 	// same it returns nil, if different it returns an error
 	WaitMasterPosition proto.ReplicationPosition
 
+	// CatchUpPositions simulates a slave catching up: while
+	// Replicating, WaitMasterPos moves CurrentMasterPosition
+	// through these positions in order, until it reaches the
+	// waited for position. If it never does, WaitMasterPos fails
+	// as if it timed out.
+	CatchUpPositions []proto.ReplicationPosition
+
 	// PromoteSlaveResult is returned by PromoteSlave
 	PromoteSlaveResult proto.ReplicationPosition
 
+	// PurgeBinaryLogsResult is returned by PurgeBinaryLogs, after
+	// it has called the consumers function
+	PurgeBinaryLogsResult []string
+
+	// ReplicaSafetyMismatches is returned by ApplyReplicaSafetySettings
+	ReplicaSafetyMismatches []ReplicaSafetyMismatch
+
+	// ApplyReplicaSafetySettingsCount is how many times
+	// ApplyReplicaSafetySettings was called
+	ApplyReplicaSafetySettingsCount int
+
+	// ReloadUsersResult is returned by ReloadUsers
+	ReloadUsersResult []string
+
 	// Schema that will be returned by GetSchema. If nil we'll
 	// return an error.
 	Schema *proto.SchemaDefinition
@@ -177,7 +218,7 @@ func (fmd *FakeMysqlDaemon) Cnf() *Mycnf {
 }
 
 // Start is part of the MysqlDaemon interface
-func (fmd *FakeMysqlDaemon) Start(mysqlWaitTime time.Duration) error {
+func (fmd *FakeMysqlDaemon) Start(ctx context.Context) error {
 	if fmd.Running {
 		return fmt.Errorf("fake mysql daemon already running")
 	}
@@ -186,7 +227,7 @@ func (fmd *FakeMysqlDaemon) Start(mysqlWaitTime time.Duration) error {
 }
 
 // Shutdown is part of the MysqlDaemon interface
-func (fmd *FakeMysqlDaemon) Shutdown(waitForMysqld bool, mysqlWaitTime time.Duration) error {
+func (fmd *FakeMysqlDaemon) Shutdown(ctx context.Context, waitForMysqld bool) error {
 	if !fmd.Running {
 		return fmt.Errorf("fake mysql daemon not running")
 	}
@@ -210,6 +251,10 @@ func (fmd *FakeMysqlDaemon) SlaveStatus() (proto.ReplicationStatus, error) {
 		SlaveSQLRunning: fmd.Replicating,
 		MasterHost:      fmd.CurrentMasterHost,
 		MasterPort:      fmd.CurrentMasterPort,
+		LastIOErrno:     fmd.LastIOErrno,
+		LastSQLErrno:    fmd.LastSQLErrno,
+
+		SecondsBehindMaster: fmd.SecondsBehindMaster,
 	}, nil
 }
 
@@ -235,7 +280,7 @@ func (fmd *FakeMysqlDaemon) SetReadOnly(on bool) error {
 }
 
 // StartReplicationCommands is part of the MysqlDaemon interface
-func (fmd *FakeMysqlDaemon) StartReplicationCommands(status *proto.ReplicationStatus) ([]string, error) {
+func (fmd *FakeMysqlDaemon) StartReplicationCommands(keyspace, shard string, status *proto.ReplicationStatus) ([]string, error) {
 	status.MasterConnectRetry = int(masterConnectRetry.Seconds())
 	if !reflect.DeepEqual(fmd.StartReplicationCommandsStatus, status) {
 		return nil, fmt.Errorf("wrong status for StartReplicationCommands: expected %v got %v", fmd.StartReplicationCommandsStatus, status)
@@ -244,7 +289,7 @@ func (fmd *FakeMysqlDaemon) StartReplicationCommands(status *proto.ReplicationSt
 }
 
 // SetMasterCommands is part of the MysqlDaemon interface
-func (fmd *FakeMysqlDaemon) SetMasterCommands(masterHost string, masterPort int) ([]string, error) {
+func (fmd *FakeMysqlDaemon) SetMasterCommands(keyspace, shard, masterHost string, masterPort int) ([]string, error) {
 	input := fmt.Sprintf("%v:%v", masterHost, masterPort)
 	if fmd.SetMasterCommandsInput != input {
 		return nil, fmt.Errorf("wrong input for SetMasterCommands: expected %v got %v", fmd.SetMasterCommandsInput, input)
@@ -257,16 +302,28 @@ func (fmd *FakeMysqlDaemon) WaitForReparentJournal(ctx context.Context, timeCrea
 	return nil
 }
 
-// DemoteMaster is part of the MysqlDaemon interface
+// DemoteMaster is part of the MysqlDaemon interface. Like the real
+// implementation, it sets ReadOnly and returns the position in one call.
 func (fmd *FakeMysqlDaemon) DemoteMaster() (proto.ReplicationPosition, error) {
+	fmd.ReadOnly = true
 	return fmd.DemoteMasterPosition, nil
 }
 
 // WaitMasterPos is part of the MysqlDaemon interface
 func (fmd *FakeMysqlDaemon) WaitMasterPos(pos proto.ReplicationPosition, waitTimeout time.Duration) error {
-	if reflect.DeepEqual(fmd.WaitMasterPosition, pos) {
+	if fmd.WaitMasterPosition.Equal(pos) {
 		return nil
 	}
+	if fmd.CatchUpPositions != nil {
+		for fmd.Replicating && !fmd.CurrentMasterPosition.AtLeast(pos) && len(fmd.CatchUpPositions) > 0 {
+			fmd.CurrentMasterPosition = fmd.CatchUpPositions[0]
+			fmd.CatchUpPositions = fmd.CatchUpPositions[1:]
+		}
+		if fmd.CurrentMasterPosition.AtLeast(pos) {
+			return nil
+		}
+		return fmt.Errorf("timed out after %v waiting for %v, position is %v", waitTimeout, pos, fmd.CurrentMasterPosition)
+	}
 	return fmt.Errorf("wrong input for WaitMasterPos: expected %v got %v", fmd.WaitMasterPosition, pos)
 }
 
@@ -275,6 +332,25 @@ func (fmd *FakeMysqlDaemon) PromoteSlave(hookExtraEnv map[string]string) (proto.
 	return fmd.PromoteSlaveResult, nil
 }
 
+// PurgeBinaryLogs is part of the MysqlDaemon interface
+func (fmd *FakeMysqlDaemon) PurgeBinaryLogs(policy BinlogPurgePolicy, consumers func() ([]BinlogConsumer, error)) ([]string, error) {
+	if _, err := consumers(); err != nil {
+		return nil, err
+	}
+	return fmd.PurgeBinaryLogsResult, nil
+}
+
+// ApplyReplicaSafetySettings is part of the MysqlDaemon interface
+func (fmd *FakeMysqlDaemon) ApplyReplicaSafetySettings(ctx context.Context) ([]ReplicaSafetyMismatch, error) {
+	fmd.ApplyReplicaSafetySettingsCount++
+	return fmd.ReplicaSafetyMismatches, nil
+}
+
+// ReloadUsers is part of the MysqlDaemon interface
+func (fmd *FakeMysqlDaemon) ReloadUsers() ([]string, error) {
+	return fmd.ReloadUsersResult, nil
+}
+
 // ExecuteSuperQueryList is part of the MysqlDaemon interface
 func (fmd *FakeMysqlDaemon) ExecuteSuperQueryList(queryList []string) error {
 	for _, query := range queryList {
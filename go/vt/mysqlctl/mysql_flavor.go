@@ -60,6 +60,11 @@ type MysqlFlavor interface {
 	// proto.ReplicationPosition struct.
 	ParseReplicationPosition(string) (proto.ReplicationPosition, error)
 
+	// BinlogStartPosition returns the replication position at the
+	// start of a binlog file of the server, that is the position
+	// that contains all the transactions of the previous files.
+	BinlogStartPosition(mysqld *Mysqld, file string) (proto.ReplicationPosition, error)
+
 	// SendBinlogDumpCommand sends the flavor-specific version of
 	// the COM_BINLOG_DUMP command to start dumping raw binlog
 	// events over a slave connection, starting at a given GTID.
@@ -85,6 +90,16 @@ type MysqlFlavor interface {
 	DisableBinlogPlayback(mysqld *Mysqld) error
 }
 
+// positionTrackingFlavor is implemented by the flavors whose binlog
+// events don't carry their position, and have to follow a stream to
+// give it to its events.
+type positionTrackingFlavor interface {
+	// binlogEventMaker returns the function that makes the
+	// events of a stream starting at startPos, in order. It is
+	// used instead of MakeBinlogEvent.
+	binlogEventMaker(startPos proto.ReplicationPosition) func(buf []byte) blproto.BinlogEvent
+}
+
 var mysqlFlavors = make(map[string]MysqlFlavor)
 
 // registerFlavorBuiltin adds a flavor to the map only if the name is unused.
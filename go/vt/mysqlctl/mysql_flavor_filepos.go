@@ -0,0 +1,280 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mysqlctl
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/sqldb"
+	blproto "github.com/youtube/vitess/go/vt/binlog/proto"
+	"github.com/youtube/vitess/go/vt/mysqlctl/proto"
+)
+
+// filePos is the implementation of MysqlFlavor for servers that don't
+// have GTIDs enabled. Positions are binlog file names and offsets.
+//
+// It is never auto-detected, as the same server versions can run with
+// GTIDs. It has to be selected with MYSQL_FLAVOR=FilePos. Since a file
+// position only makes sense on the server that wrote it, a slave can't
+// be moved to another master without being given a new position, and
+// a binlog stream can't be resumed on another server.
+type filePos struct {
+}
+
+const filePosFlavorID = "FilePos"
+
+// VersionMatch implements MysqlFlavor.VersionMatch().
+func (*filePos) VersionMatch(version string) bool {
+	return false
+}
+
+// MasterPosition implements MysqlFlavor.MasterPosition().
+func (flavor *filePos) MasterPosition(mysqld *Mysqld) (rp proto.ReplicationPosition, err error) {
+	fields, err := mysqld.fetchSuperQueryMap("SHOW MASTER STATUS")
+	if err != nil {
+		return rp, err
+	}
+	if fields["File"] == "" {
+		return rp, fmt.Errorf("SHOW MASTER STATUS returned no binlog file, is binary logging enabled?")
+	}
+	return flavor.ParseReplicationPosition(fields["File"] + ":" + fields["Position"])
+}
+
+// SlaveStatus implements MysqlFlavor.SlaveStatus().
+func (flavor *filePos) SlaveStatus(mysqld *Mysqld) (proto.ReplicationStatus, error) {
+	fields, err := mysqld.fetchSuperQueryMap("SHOW SLAVE STATUS")
+	if err != nil {
+		return proto.ReplicationStatus{}, ErrNotSlave
+	}
+	status := parseSlaveStatus(fields)
+
+	// the position is the one in the master binlogs the SQL
+	// thread has executed up to
+	value := fields["Relay_Master_Log_File"] + ":" + fields["Exec_Master_Log_Pos"]
+	status.Position, err = flavor.ParseReplicationPosition(value)
+	if err != nil {
+		return proto.ReplicationStatus{}, fmt.Errorf("SlaveStatus can't parse file position (Relay_Master_Log_File:Exec_Master_Log_Pos: %#v): %v", value, err)
+	}
+	return status, nil
+}
+
+// WaitMasterPos implements MysqlFlavor.WaitMasterPos().
+func (*filePos) WaitMasterPos(mysqld *Mysqld, targetPos proto.ReplicationPosition, waitTimeout time.Duration) error {
+	gtid, ok := targetPos.GTIDSet.(proto.FilePosGTID)
+	if !ok {
+		return fmt.Errorf("targetPos.GTIDSet is wrong type - expected FilePosGTID, got: %#v", targetPos.GTIDSet)
+	}
+
+	var query string
+	if waitTimeout == 0 {
+		// Omit the timeout to wait indefinitely.
+		query = fmt.Sprintf("SELECT MASTER_POS_WAIT('%s', %d)", gtid.File, gtid.Pos)
+	} else {
+		query = fmt.Sprintf("SELECT MASTER_POS_WAIT('%s', %d, %.6f)", gtid.File, gtid.Pos, waitTimeout.Seconds())
+	}
+
+	log.Infof("Waiting for minimum replication position with query: %v", query)
+	qr, err := mysqld.FetchSuperQuery(query)
+	if err != nil {
+		return fmt.Errorf("MASTER_POS_WAIT() failed: %v", err)
+	}
+	if len(qr.Rows) != 1 || len(qr.Rows[0]) != 1 {
+		return fmt.Errorf("unexpected result format from MASTER_POS_WAIT(): %#v", qr)
+	}
+	result := qr.Rows[0][0]
+	if result.IsNull() {
+		return fmt.Errorf("MASTER_POS_WAIT() failed: the slave SQL thread is not running")
+	}
+	if result.String() == "-1" {
+		return fmt.Errorf("timed out waiting for position %v", targetPos)
+	}
+	return nil
+}
+
+// ResetReplicationCommands implements MysqlFlavor.ResetReplicationCommands().
+func (*filePos) ResetReplicationCommands() []string {
+	return []string{
+		"STOP SLAVE",
+		"RESET SLAVE",
+		"RESET MASTER",
+	}
+}
+
+// PromoteSlaveCommands implements MysqlFlavor.PromoteSlaveCommands().
+func (*filePos) PromoteSlaveCommands() []string {
+	return []string{
+		"RESET SLAVE",
+	}
+}
+
+// StartReplicationCommands implements MysqlFlavor.StartReplicationCommands().
+func (*filePos) StartReplicationCommands(params *sqldb.ConnParams, status *proto.ReplicationStatus) ([]string, error) {
+	gtid, ok := status.Position.GTIDSet.(proto.FilePosGTID)
+	if !ok {
+		return nil, fmt.Errorf("status.Position.GTIDSet is wrong type - expected FilePosGTID, got: %#v", status.Position.GTIDSet)
+	}
+
+	// Make CHANGE MASTER TO command.
+	args := changeMasterArgs(params, status.MasterHost, status.MasterPort, status.MasterConnectRetry)
+	args = append(args, fmt.Sprintf("MASTER_LOG_FILE = '%s'", gtid.File))
+	args = append(args, fmt.Sprintf("MASTER_LOG_POS = %d", gtid.Pos))
+	changeMasterTo := "CHANGE MASTER TO\n  " + strings.Join(args, ",\n  ")
+
+	return []string{
+		changeMasterTo,
+		"START SLAVE",
+	}, nil
+}
+
+// SetMasterCommands implements MysqlFlavor.SetMasterCommands().
+func (*filePos) SetMasterCommands(params *sqldb.ConnParams, masterHost string, masterPort int, masterConnectRetry int) ([]string, error) {
+	return nil, fmt.Errorf("cannot change the master without a position in its binlogs with the %v flavor", filePosFlavorID)
+}
+
+// ParseGTID implements MysqlFlavor.ParseGTID().
+func (*filePos) ParseGTID(s string) (proto.GTID, error) {
+	return proto.ParseGTID(filePosFlavorID, s)
+}
+
+// ParseReplicationPosition implements MysqlFlavor.ParseReplicationPosition().
+func (*filePos) ParseReplicationPosition(s string) (proto.ReplicationPosition, error) {
+	return proto.ParseReplicationPosition(filePosFlavorID, s)
+}
+
+// BinlogStartPosition implements MysqlFlavor.BinlogStartPosition().
+// File positions are ordered by file name, so it is the beginning of
+// the file.
+func (*filePos) BinlogStartPosition(mysqld *Mysqld, file string) (proto.ReplicationPosition, error) {
+	return proto.ReplicationPosition{GTIDSet: proto.FilePosGTID{File: file}}, nil
+}
+
+// SendBinlogDumpCommand implements MysqlFlavor.SendBinlogDumpCommand().
+// The binlogs are dumped from the file and offset of the position.
+func (*filePos) SendBinlogDumpCommand(mysqld *Mysqld, conn *SlaveConnection, startPos proto.ReplicationPosition) error {
+	const ComBinlogDump = 0x12
+
+	gtid, ok := startPos.GTIDSet.(proto.FilePosGTID)
+	if !ok || gtid.File == "" {
+		return &UnsupportedPositionError{Flavor: filePosFlavorID, Position: startPos}
+	}
+
+	// Tell the server that we understand the format of events that will be used
+	// if binlog_checksum is enabled on the server.
+	if _, err := conn.ExecuteFetch("SET @master_binlog_checksum=@@global.binlog_checksum", 0, false); err != nil {
+		return fmt.Errorf("failed to set @master_binlog_checksum=@@global.binlog_checksum: %v", err)
+	}
+
+	buf := makeBinlogDumpCommand(filePosDumpOffset(gtid), 0, conn.slaveID, gtid.File)
+	return conn.SendCommand(ComBinlogDump, buf)
+}
+
+// filePosDumpOffset returns the offset to dump the binlog file of gtid
+// from. The events of a file start after its 4 bytes magic number, the
+// offset of BinlogStartPosition.
+func filePosDumpOffset(gtid proto.FilePosGTID) uint32 {
+	const binlogMagicLength = 4
+	if gtid.Pos < binlogMagicLength {
+		return binlogMagicLength
+	}
+	return gtid.Pos
+}
+
+// MakeBinlogEvent implements MysqlFlavor.MakeBinlogEvent(). The events
+// have the same format as the MySQL 5.6 ones, but they don't know
+// their position: the ones of a stream are made by binlogEventMaker.
+func (*filePos) MakeBinlogEvent(buf []byte) blproto.BinlogEvent {
+	return NewMysql56BinlogEvent(buf)
+}
+
+// binlogEventMaker implements positionTrackingFlavor.binlogEventMaker().
+func (*filePos) binlogEventMaker(startPos proto.ReplicationPosition) func(buf []byte) blproto.BinlogEvent {
+	gtid, _ := startPos.GTIDSet.(proto.FilePosGTID)
+	m := &filePosEventMaker{file: gtid.File}
+	return m.makeBinlogEvent
+}
+
+// filePosEventMaker follows the binlog file of a stream through its
+// ROTATE_EVENTs, to give the events their file position.
+type filePosEventMaker struct {
+	file   string
+	format blproto.BinlogFormat
+}
+
+func (m *filePosEventMaker) makeBinlogEvent(buf []byte) blproto.BinlogEvent {
+	ev := mysql56BinlogEvent{binlogEvent: binlogEvent(buf)}
+	if !ev.IsValid() {
+		return ev
+	}
+	switch {
+	case ev.IsFormatDescription():
+		if f, err := ev.Format(); err == nil {
+			m.format = f
+		}
+	case ev.IsRotate() && !m.format.IsZero():
+		// The fake ROTATE_EVENT the master sends before the
+		// FORMAT_DESCRIPTION_EVENT names the file we asked for.
+		// The other ones start the next file.
+		stripped, _, err := ev.StripChecksum(m.format)
+		if err != nil {
+			return ev
+		}
+		file, pos, err := stripped.(mysql56BinlogEvent).rotate(m.format)
+		if err != nil {
+			return ev
+		}
+		m.file = file
+		return filePosBinlogEvent{mysql56BinlogEvent: ev, gtid: proto.FilePosGTID{File: file, Pos: pos}}
+	}
+	// The fake events have no position.
+	if pos := ev.nextPosition(); pos != 0 {
+		return filePosBinlogEvent{mysql56BinlogEvent: ev, gtid: proto.FilePosGTID{File: m.file, Pos: pos}}
+	}
+	return ev
+}
+
+// filePosBinlogEvent is a binlog event of a server without GTIDs, with
+// the position in the binlogs right after it as its GTID. The
+// transactions of a stream of them are at the position of their
+// commit, which is where to resume the stream from.
+type filePosBinlogEvent struct {
+	mysql56BinlogEvent
+	gtid proto.FilePosGTID
+}
+
+// HasGTID implements BinlogEvent.HasGTID().
+func (ev filePosBinlogEvent) HasGTID(f blproto.BinlogFormat) bool {
+	return true
+}
+
+// GTID implements BinlogEvent.GTID().
+func (ev filePosBinlogEvent) GTID(f blproto.BinlogFormat) (proto.GTID, error) {
+	return ev.gtid, nil
+}
+
+// StripChecksum implements BinlogEvent.StripChecksum().
+func (ev filePosBinlogEvent) StripChecksum(f blproto.BinlogFormat) (blproto.BinlogEvent, []byte, error) {
+	stripped, checksum, err := ev.mysql56BinlogEvent.StripChecksum(f)
+	if err != nil {
+		return ev, nil, err
+	}
+	return filePosBinlogEvent{mysql56BinlogEvent: stripped.(mysql56BinlogEvent), gtid: ev.gtid}, checksum, nil
+}
+
+// EnableBinlogPlayback implements MysqlFlavor.EnableBinlogPlayback().
+func (*filePos) EnableBinlogPlayback(mysqld *Mysqld) error {
+	return nil
+}
+
+// DisableBinlogPlayback implements MysqlFlavor.DisableBinlogPlayback().
+func (*filePos) DisableBinlogPlayback(mysqld *Mysqld) error {
+	return nil
+}
+
+func init() {
+	registerFlavorBuiltin(filePosFlavorID, &filePos{})
+}
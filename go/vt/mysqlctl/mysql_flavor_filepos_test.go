@@ -0,0 +1,181 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mysqlctl
+
+import (
+	"encoding/binary"
+	"reflect"
+	"testing"
+
+	"github.com/youtube/vitess/go/sqldb"
+	"github.com/youtube/vitess/go/vt/mysqlctl/proto"
+)
+
+func TestFilePosVersionMatch(t *testing.T) {
+	// FilePos is only used when set with MYSQL_FLAVOR
+	for _, version := range []string{"5.6.24-log", "10.0.13-MariaDB-1~precise-log"} {
+		if (&filePos{}).VersionMatch(version) {
+			t.Errorf("(&filePos{}).VersionMatch(%#v) = true, want false", version)
+		}
+	}
+}
+
+func TestFilePosParseReplicationPosition(t *testing.T) {
+	input := "vt-0000062344-bin.000012:4567"
+	want := proto.ReplicationPosition{GTIDSet: proto.FilePosGTID{File: "vt-0000062344-bin.000012", Pos: 4567}}
+
+	got, err := (&filePos{}).ParseReplicationPosition(input)
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if !got.Equal(want) {
+		t.Errorf("(&filePos{}).ParseReplicationPosition(%#v) = %#v, want %#v", input, got, want)
+	}
+}
+
+func TestFilePosStartReplicationCommands(t *testing.T) {
+	params := &sqldb.ConnParams{
+		Uname: "username",
+		Pass:  "password",
+	}
+	pos, _ := (&filePos{}).ParseReplicationPosition("vt-0000062344-bin.000012:4567")
+	status := &proto.ReplicationStatus{
+		Position:           pos,
+		MasterHost:         "localhost",
+		MasterPort:         123,
+		MasterConnectRetry: 1234,
+	}
+	want := []string{
+		`CHANGE MASTER TO
+  MASTER_HOST = 'localhost',
+  MASTER_PORT = 123,
+  MASTER_USER = 'username',
+  MASTER_PASSWORD = 'password',
+  MASTER_CONNECT_RETRY = 1234,
+  MASTER_LOG_FILE = 'vt-0000062344-bin.000012',
+  MASTER_LOG_POS = 4567`,
+		"START SLAVE",
+	}
+
+	got, err := (&filePos{}).StartReplicationCommands(params, status)
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+		return
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("(&filePos{}).StartReplicationCommands(%#v, %#v) = %#v, want %#v", params, status, got, want)
+	}
+
+	// a position of another flavor is rejected
+	status.Position, _ = (&mariaDB10{}).ParseReplicationPosition("0-1-2")
+	if _, err := (&filePos{}).StartReplicationCommands(params, status); err == nil {
+		t.Errorf("StartReplicationCommands should have failed with a MariaDB position")
+	}
+}
+
+func TestFilePosSetMasterCommands(t *testing.T) {
+	params := &sqldb.ConnParams{
+		Uname: "username",
+		Pass:  "password",
+	}
+	if _, err := (&filePos{}).SetMasterCommands(params, "localhost", 123, 1234); err == nil {
+		t.Errorf("SetMasterCommands should fail without GTIDs")
+	}
+}
+
+func TestFilePosDumpOffset(t *testing.T) {
+	testcases := []struct {
+		pos  uint32
+		want uint32
+	}{
+		// the start of a file, from BinlogStartPosition
+		{0, 4},
+		{4, 4},
+		{4567, 4567},
+	}
+	for _, tc := range testcases {
+		if got := filePosDumpOffset(proto.FilePosGTID{File: "vt-bin.000001", Pos: tc.pos}); got != tc.want {
+			t.Errorf("filePosDumpOffset(%v) = %v, want %v", tc.pos, got, tc.want)
+		}
+	}
+}
+
+// makeFilePosTestEvent returns a MySQL 5.6 event with a CRC32 checksum.
+func makeFilePosTestEvent(typ byte, nextPos uint32, body []byte) []byte {
+	buf := make([]byte, 19, 19+len(body)+4)
+	buf[4] = typ
+	binary.LittleEndian.PutUint32(buf[9:], uint32(19+len(body)+4))
+	binary.LittleEndian.PutUint32(buf[13:], nextPos)
+	buf = append(buf, body...)
+	return append(buf, 0xde, 0xad, 0xbe, 0xef)
+}
+
+func makeFilePosTestRotate(nextPos uint32, file string, pos uint64) []byte {
+	body := make([]byte, 8)
+	binary.LittleEndian.PutUint64(body, pos)
+	return makeFilePosTestEvent(4, nextPos, append(body, file...))
+}
+
+func TestFilePosBinlogEventMaker(t *testing.T) {
+	startPos := proto.ReplicationPosition{GTIDSet: proto.FilePosGTID{File: "vt-bin.000001", Pos: 4}}
+	makeBinlogEvent := (&filePos{}).binlogEventMaker(startPos)
+	testcases := []struct {
+		desc string
+		buf  []byte
+		// want is nil for the events without a position
+		want proto.GTID
+	}{{
+		desc: "fake rotate",
+		buf:  makeFilePosTestRotate(0, "vt-bin.000001", 4),
+	}, {
+		desc: "format description",
+		buf:  mysql56FormatEvent.(mysql56BinlogEvent).Bytes(),
+		want: proto.FilePosGTID{File: "vt-bin.000001", Pos: 120},
+	}, {
+		desc: "begin",
+		buf:  makeFilePosTestEvent(2, 200, []byte("BEGIN")),
+		want: proto.FilePosGTID{File: "vt-bin.000001", Pos: 200},
+	}, {
+		desc: "xid",
+		buf:  makeFilePosTestEvent(16, 231, make([]byte, 8)),
+		want: proto.FilePosGTID{File: "vt-bin.000001", Pos: 231},
+	}, {
+		desc: "rotate",
+		buf:  makeFilePosTestRotate(280, "vt-bin.000002", 4),
+		want: proto.FilePosGTID{File: "vt-bin.000002", Pos: 4},
+	}, {
+		desc: "begin in the next file",
+		buf:  makeFilePosTestEvent(2, 150, []byte("BEGIN")),
+		want: proto.FilePosGTID{File: "vt-bin.000002", Pos: 150},
+	}}
+	f, err := mysql56FormatEvent.Format()
+	if err != nil {
+		t.Fatalf("Format failed: %v", err)
+	}
+	for _, tc := range testcases {
+		ev := makeBinlogEvent(tc.buf)
+		if !ev.IsValid() {
+			t.Errorf("%v: invalid event", tc.desc)
+			continue
+		}
+		if got := ev.HasGTID(f); got != (tc.want != nil) {
+			t.Errorf("%v: HasGTID() = %v, want %v", tc.desc, got, tc.want != nil)
+			continue
+		}
+		if tc.want == nil {
+			continue
+		}
+		// the position survives the checksum stripping
+		stripped, _, err := ev.StripChecksum(f)
+		if err != nil {
+			t.Errorf("%v: StripChecksum failed: %v", tc.desc, err)
+			continue
+		}
+		got, err := stripped.GTID(f)
+		if err != nil || got != tc.want {
+			t.Errorf("%v: GTID() = %v, %v, want %v", tc.desc, got, err, tc.want)
+		}
+	}
+}
@@ -137,10 +137,29 @@ func (*mariaDB10) ParseReplicationPosition(s string) (proto.ReplicationPosition,
 	return proto.ParseReplicationPosition(mariadbFlavorID, s)
 }
 
+// BinlogStartPosition implements MysqlFlavor.BinlogStartPosition().
+// It is the Gtid_list event at the beginning of the file, displayed as
+// a bracketed list, like [0-1-100].
+func (flavor *mariaDB10) BinlogStartPosition(mysqld *Mysqld, file string) (proto.ReplicationPosition, error) {
+	info, err := binlogStartEventInfo(mysqld, file, "Gtid_list")
+	if err != nil {
+		return proto.ReplicationPosition{}, err
+	}
+	info = strings.TrimSuffix(strings.TrimPrefix(info, "["), "]")
+	if info == "" {
+		return proto.ReplicationPosition{}, nil
+	}
+	return flavor.ParseReplicationPosition(info)
+}
+
 // SendBinlogDumpCommand implements MysqlFlavor.SendBinlogDumpCommand().
 func (*mariaDB10) SendBinlogDumpCommand(mysqld *Mysqld, conn *SlaveConnection, startPos proto.ReplicationPosition) error {
 	const ComBinlogDump = 0x12
 
+	if _, ok := startPos.GTIDSet.(proto.MariadbGTID); !ok {
+		return &UnsupportedPositionError{Flavor: mariadbFlavorID, Position: startPos}
+	}
+
 	// Tell the server that we understand GTIDs by setting our slave capability
 	// to MARIA_SLAVE_CAPABILITY_GTID = 4 (MariaDB >= 10.0.1).
 	if _, err := conn.ExecuteFetch("SET @mariadb_slave_capability=4", 0, false); err != nil {
@@ -133,13 +133,28 @@ func (*mysql56) ParseReplicationPosition(s string) (proto.ReplicationPosition, e
 	return proto.ParseReplicationPosition(mysql56FlavorID, s)
 }
 
+// BinlogStartPosition implements MysqlFlavor.BinlogStartPosition().
+// It is the Previous_gtids event at the beginning of the file.
+func (flavor *mysql56) BinlogStartPosition(mysqld *Mysqld, file string) (proto.ReplicationPosition, error) {
+	info, err := binlogStartEventInfo(mysqld, file, "Previous_gtids")
+	if err != nil {
+		return proto.ReplicationPosition{}, err
+	}
+	// the sets of the different servers may be on separate lines
+	info = strings.Replace(info, "\n", "", -1)
+	if info == "" {
+		return proto.ReplicationPosition{}, nil
+	}
+	return flavor.ParseReplicationPosition(info)
+}
+
 // SendBinlogDumpCommand implements MysqlFlavor.SendBinlogDumpCommand().
 func (flavor *mysql56) SendBinlogDumpCommand(mysqld *Mysqld, conn *SlaveConnection, startPos proto.ReplicationPosition) error {
 	const ComBinlogDumpGTID = 0x1E // COM_BINLOG_DUMP_GTID
 
 	gtidSet, ok := startPos.GTIDSet.(proto.Mysql56GTIDSet)
 	if !ok {
-		return fmt.Errorf("startPos.GTIDSet is wrong type - expected Mysql56GTIDSet, got: %#v", startPos.GTIDSet)
+		return &UnsupportedPositionError{Flavor: mysql56FlavorID, Position: startPos}
 	}
 
 	// Tell the server that we understand the format of events that will be used
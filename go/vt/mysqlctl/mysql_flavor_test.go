@@ -24,6 +24,9 @@ func (fakeMysqlFlavor) MakeBinlogEvent(buf []byte) blproto.BinlogEvent { return
 func (fakeMysqlFlavor) ParseReplicationPosition(string) (proto.ReplicationPosition, error) {
 	return proto.ReplicationPosition{}, nil
 }
+func (fakeMysqlFlavor) BinlogStartPosition(mysqld *Mysqld, file string) (proto.ReplicationPosition, error) {
+	return proto.ReplicationPosition{}, nil
+}
 func (fakeMysqlFlavor) SendBinlogDumpCommand(mysqld *Mysqld, conn *SlaveConnection, startPos proto.ReplicationPosition) error {
 	return nil
 }
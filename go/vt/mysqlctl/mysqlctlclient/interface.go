@@ -12,16 +12,17 @@ import (
 	"time"
 
 	log "github.com/golang/glog"
+	"golang.org/x/net/context"
 )
 
 var mysqlctlClientProtocol = flag.String("mysqlctl_client_protocol", "gorpc", "the protocol to use to talk to the mysqlctl server")
 
 // MysqlctlClient defines the interface used to send remote mysqlctl commands
 type MysqlctlClient interface {
-	// Start calls Mysqld.Start remotely.
-	Start(mysqlWaitTime time.Duration) error
-	// Shutdown calls Mysqld.Shutdown remotely.
-	Shutdown(waitForMysqld bool, mysqlWaitTime time.Duration) error
+	// Start calls Mysqld.Start remotely, with the deadline of ctx.
+	Start(ctx context.Context) error
+	// Shutdown calls Mysqld.Shutdown remotely, with the deadline of ctx.
+	Shutdown(ctx context.Context, waitForMysqld bool) error
 
 	// Close will terminate the connection. This object won't be used anymore.
 	Close()
@@ -34,11 +34,21 @@ import (
 	vtenv "github.com/youtube/vitess/go/vt/env"
 	"github.com/youtube/vitess/go/vt/hook"
 	"github.com/youtube/vitess/go/vt/mysqlctl/mysqlctlclient"
+	"golang.org/x/net/context"
 )
 
 const (
 	// MysqlWaitTime is the default number of seconds to wait for mysql
 	MysqlWaitTime = 120 * time.Second
+
+	// minSocketWaitDelay and maxSocketWaitDelay bound the delay
+	// between two checks of the socket file, which doubles each time.
+	minSocketWaitDelay = 10 * time.Millisecond
+	maxSocketWaitDelay = time.Second
+
+	// errorLogLines is how many lines of the error log the Start
+	// errors contain.
+	errorLogLines = 20
 )
 
 var (
@@ -51,6 +61,9 @@ var (
 
 	// masterConnectRetry is used in 'SET MASTER' commands
 	masterConnectRetry = flag.Duration("master_connect_retry", 10*time.Second, "how long to wait in between slave -> connection attempts. Only precise to the second.")
+
+	// masterHeartbeatPeriod is also used in 'SET MASTER' commands
+	masterHeartbeatPeriod = flag.Duration("master_heartbeat_period", 0, "if set, how often the master sends heartbeats to its slaves when idle. Only precise to the millisecond. 0 keeps the MySQL default")
 )
 
 // Mysqld is the object that represents a mysqld daemon running on this server.
@@ -65,6 +78,10 @@ type Mysqld struct {
 	TabletDir     string
 	SnapshotDir   string
 
+	// mysqlctlSocket is the mysqlctld socket to run Start and
+	// Shutdown remotely, if set.
+	mysqlctlSocket string
+
 	// mutex protects the fields below.
 	mutex         sync.Mutex
 	mysqlFlavor   MysqlFlavor
@@ -72,6 +89,63 @@ type Mysqld struct {
 	cancelWaitCmd chan struct{}
 }
 
+// StartTimeoutError is returned by Start when mysqld doesn't accept
+// connections on its socket file in time.
+type StartTimeoutError struct {
+	Name       string
+	SocketFile string
+	Err        error
+	ErrorLog   string
+}
+
+func (e *StartTimeoutError) Error() string {
+	return fmt.Sprintf("%v: %v waiting for %v, last lines of the error log:\n%v", e.Name, e.Err, e.SocketFile, e.ErrorLog)
+}
+
+// StartExitError is returned by Start when mysqld_safe exits before
+// mysqld accepts connections, usually because mysqld failed to start.
+type StartExitError struct {
+	Name     string
+	Err      error
+	ErrorLog string
+}
+
+func (e *StartExitError) Error() string {
+	return fmt.Sprintf("%v exited before mysqld was ready (%v), last lines of the error log:\n%v", e.Name, e.Err, e.ErrorLog)
+}
+
+// nextSocketWaitDelay returns the delay to use after delay.
+func nextSocketWaitDelay(delay time.Duration) time.Duration {
+	delay *= 2
+	if delay > maxSocketWaitDelay {
+		delay = maxSocketWaitDelay
+	}
+	return delay
+}
+
+// waitTime returns how long we can wait until the deadline of ctx,
+// or MysqlWaitTime if it has none.
+func waitTime(ctx context.Context) time.Duration {
+	if deadline, ok := ctx.Deadline(); ok {
+		return deadline.Sub(time.Now())
+	}
+	return MysqlWaitTime
+}
+
+// tailErrorLog returns the last errorLogLines lines of the error log,
+// or why it couldn't be read.
+func tailErrorLog(errorLogPath string) string {
+	data, err := ioutil.ReadFile(errorLogPath)
+	if err != nil {
+		return fmt.Sprintf("cannot read error log: %v", err)
+	}
+	lines := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	if len(lines) > errorLogLines {
+		lines = lines[len(lines)-errorLogLines:]
+	}
+	return strings.Join(lines, "\n")
+}
+
 // NewMysqld creates a Mysqld object based on the provided configuration
 // and connection parameters.
 // dbaName and appName are the base for stats exports, use 'Dba' and 'App', except in tests
@@ -102,19 +176,60 @@ func NewMysqld(dbaName, appName string, config *Mycnf, dba, app, repl *sqldb.Con
 	appPool := dbconnpool.NewConnectionPool(appPoolName, *appPoolSize, *appIdleTimeout)
 	appPool.Open(dbconnpool.DBConnectionCreator(app, appMysqlStats))
 
+	tabletDir := config.tabletDir
+	if tabletDir == "" {
+		tabletDir = TabletDir(config.ServerId)
+	}
+	snapshotDir := config.snapshotDir
+	if snapshotDir == "" {
+		snapshotDir = SnapshotDir(config.ServerId)
+	}
+
 	return &Mysqld{
-		config:        config,
-		dba:           dba,
-		dbApp:         app,
-		dbaPool:       dbaPool,
-		appPool:       appPool,
-		replParams:    repl,
-		dbaMysqlStats: dbaMysqlStats,
-		TabletDir:     TabletDir(config.ServerId),
-		SnapshotDir:   SnapshotDir(config.ServerId),
+		config:         config,
+		dba:            dba,
+		dbApp:          app,
+		dbaPool:        dbaPool,
+		appPool:        appPool,
+		replParams:     repl,
+		dbaMysqlStats:  dbaMysqlStats,
+		TabletDir:      tabletDir,
+		SnapshotDir:    snapshotDir,
+		mysqlctlSocket: *socketFile,
+	}
+}
+
+// NewMysqldForInstance creates a Mysqld for one of several instances
+// running in the same process. All its paths come from
+// NewMycnfForInstance, the dba and app connections use its socket,
+// and it doesn't publish any stats, nor use -mysqlctl_socket.
+func NewMysqldForInstance(uid uint32, overrides MycnfOverrides, dba, app, repl sqldb.ConnParams) *Mysqld {
+	config := NewMycnfForInstance(uid, overrides)
+	dba.UnixSocket = config.SocketFile
+	app.UnixSocket = config.SocketFile
+	mysqld := NewMysqld("", "", config, &dba, &app, &repl)
+	mysqld.mysqlctlSocket = ""
+	return mysqld
+}
+
+// hookExtraEnv returns the environment the hooks need to act on this
+// instance.
+func (mysqld *Mysqld) hookExtraEnv() map[string]string {
+	return map[string]string{
+		"TABLET_DIR":   mysqld.TabletDir,
+		"MYCNF_FILE":   mysqld.config.path,
+		"MYSQL_PORT":   fmt.Sprintf("%v", mysqld.config.MysqlPort),
+		"MYSQL_SOCKET": mysqld.config.SocketFile,
 	}
 }
 
+// newHook returns the named hook, with the environment of this instance.
+func (mysqld *Mysqld) newHook(name string) *hook.Hook {
+	h := hook.NewSimpleHook(name)
+	h.ExtraEnv = mysqld.hookExtraEnv()
+	return h
+}
+
 // Cnf returns the mysql config for the daemon
 func (mysqld *Mysqld) Cnf() *Mycnf {
 	return mysqld.config
@@ -123,23 +238,33 @@ func (mysqld *Mysqld) Cnf() *Mycnf {
 // Start will start the mysql daemon, either by running the 'mysqld_start'
 // hook, or by running mysqld_safe in the background.
 // If a mysqlctld address is provided in a flag, Start will run remotely.
-func (mysqld *Mysqld) Start(mysqlWaitTime time.Duration) error {
+//
+// It waits until mysqld accepts connections on its socket file, or ctx
+// is done. It returns a *StartTimeoutError if mysqld wasn't ready in
+// time, and a *StartExitError if mysqld_safe exited before mysqld was
+// ready.
+func (mysqld *Mysqld) Start(ctx context.Context) error {
 	// Execute as remote action on mysqlctld if requested.
-	if *socketFile != "" {
-		log.Infof("executing Mysqld.Start() remotely via mysqlctld server: %v", *socketFile)
-		client, err := mysqlctlclient.New("unix", *socketFile, mysqlWaitTime)
+	if mysqld.mysqlctlSocket != "" {
+		log.Infof("executing Mysqld.Start() remotely via mysqlctld server: %v", mysqld.mysqlctlSocket)
+		client, err := mysqlctlclient.New("unix", mysqld.mysqlctlSocket, waitTime(ctx))
 		if err != nil {
 			return fmt.Errorf("can't dial mysqlctld: %v", err)
 		}
 		defer client.Close()
-		return client.Start(mysqlWaitTime)
+		return client.Start(ctx)
 	}
 
 	var name string
 	ts := fmt.Sprintf("Mysqld.Start(%v)", time.Now().Unix())
 
+	// exited is closed if the process we start exits. It stays
+	// nil with the hook, as we don't have a process to watch.
+	var exited chan struct{}
+	var exitErr error
+
 	// try the mysqld start hook, if any
-	switch hr := hook.NewSimpleHook("mysqld_start").Execute(); hr.ExitStatus {
+	switch hr := mysqld.newHook("mysqld_start").Execute(); hr.ExitStatus {
 	case hook.HOOK_SUCCESS:
 		// hook exists and worked, we can keep going
 		name = "mysqld_start hook"
@@ -158,14 +283,14 @@ func (mysqld *Mysqld) Start(mysqlWaitTime time.Duration) error {
 		cmd := exec.Command(name, arg...)
 		cmd.Dir = dir
 		cmd.Env = env
-		log.Infof("%v mysqlWaitTime:%v %#v", ts, mysqlWaitTime, cmd)
+		log.Infof("%v %#v", ts, cmd)
 		stderr, err := cmd.StderrPipe()
 		if err != nil {
-			return nil
+			return err
 		}
 		stdout, err := cmd.StdoutPipe()
 		if err != nil {
-			return nil
+			return err
 		}
 		go func() {
 			scanner := bufio.NewScanner(stderr)
@@ -181,15 +306,17 @@ func (mysqld *Mysqld) Start(mysqlWaitTime time.Duration) error {
 		}()
 		err = cmd.Start()
 		if err != nil {
-			return nil
+			return err
 		}
 
+		exited = make(chan struct{})
 		mysqld.mutex.Lock()
 		mysqld.cancelWaitCmd = make(chan struct{})
 		go func(cancel <-chan struct{}) {
 			// Wait regardless of cancel, so we don't generate defunct processes.
-			err := cmd.Wait()
-			log.Infof("%v exit: %v", ts, err)
+			exitErr = cmd.Wait()
+			log.Infof("%v exit: %v", ts, exitErr)
+			close(exited)
 
 			// The process exited. Trigger OnTerm callbacks, unless we were cancelled.
 			select {
@@ -210,7 +337,7 @@ func (mysqld *Mysqld) Start(mysqlWaitTime time.Duration) error {
 
 	// give it some time to succeed - usually by the time the socket emerges
 	// we are in good shape
-	for i := mysqlWaitTime; i >= 0; i -= time.Second {
+	for delay := minSocketWaitDelay; ; delay = nextSocketWaitDelay(delay) {
 		_, statErr := os.Stat(mysqld.config.SocketFile)
 		if statErr == nil {
 			// Make sure the socket file isn't stale.
@@ -222,31 +349,45 @@ func (mysqld *Mysqld) Start(mysqlWaitTime time.Duration) error {
 		} else if !os.IsNotExist(statErr) {
 			return statErr
 		}
-		log.Infof("%v: sleeping for 1s waiting for socket file %v", ts, mysqld.config.SocketFile)
-		time.Sleep(time.Second)
+		log.Infof("%v: sleeping for %v waiting for socket file %v", ts, delay, mysqld.config.SocketFile)
+		select {
+		case <-time.After(delay):
+		case <-exited:
+			return &StartExitError{
+				Name:     name,
+				Err:      exitErr,
+				ErrorLog: tailErrorLog(mysqld.config.ErrorLogPath),
+			}
+		case <-ctx.Done():
+			return &StartTimeoutError{
+				Name:       name,
+				SocketFile: mysqld.config.SocketFile,
+				Err:        ctx.Err(),
+				ErrorLog:   tailErrorLog(mysqld.config.ErrorLogPath),
+			}
+		}
 	}
-	return errors.New(name + ": deadline exceeded waiting for " + mysqld.config.SocketFile)
 }
 
 // Shutdown will stop the mysqld daemon that is running in the background.
 //
 // waitForMysqld: should the function block until mysqld has stopped?
 // This can actually take a *long* time if the buffer cache needs to be fully
-// flushed - on the order of 20-30 minutes.
+// flushed - on the order of 20-30 minutes. It waits until ctx is done.
 //
 // If a mysqlctld address is provided in a flag, Shutdown will run remotely.
-func (mysqld *Mysqld) Shutdown(waitForMysqld bool, mysqlWaitTime time.Duration) error {
+func (mysqld *Mysqld) Shutdown(ctx context.Context, waitForMysqld bool) error {
 	log.Infof("Mysqld.Shutdown")
 
 	// Execute as remote action on mysqlctld if requested.
-	if *socketFile != "" {
-		log.Infof("executing Mysqld.Shutdown() remotely via mysqlctld server: %v", *socketFile)
-		client, err := mysqlctlclient.New("unix", *socketFile, mysqlWaitTime)
+	if mysqld.mysqlctlSocket != "" {
+		log.Infof("executing Mysqld.Shutdown() remotely via mysqlctld server: %v", mysqld.mysqlctlSocket)
+		client, err := mysqlctlclient.New("unix", mysqld.mysqlctlSocket, waitTime(ctx))
 		if err != nil {
 			return fmt.Errorf("can't dial mysqlctld: %v", err)
 		}
 		defer client.Close()
-		return client.Shutdown(waitForMysqld, mysqlWaitTime)
+		return client.Shutdown(ctx, waitForMysqld)
 	}
 
 	// We're shutting down on purpose. We no longer want to be notified when
@@ -267,7 +408,7 @@ func (mysqld *Mysqld) Shutdown(waitForMysqld bool, mysqlWaitTime time.Duration)
 	}
 
 	// try the mysqld shutdown hook, if any
-	h := hook.NewSimpleHook("mysqld_shutdown")
+	h := mysqld.newHook("mysqld_shutdown")
 	hr := h.Execute()
 	switch hr.ExitStatus {
 	case hook.HOOK_SUCCESS:
@@ -298,15 +439,18 @@ func (mysqld *Mysqld) Shutdown(waitForMysqld bool, mysqlWaitTime time.Duration)
 	// wait for mysqld to really stop. use the sock file as a proxy for that since
 	// we can't call wait() in a process we didn't start.
 	if waitForMysqld {
-		for i := mysqlWaitTime; i >= 0; i -= time.Second {
+		for delay := minSocketWaitDelay; ; delay = nextSocketWaitDelay(delay) {
 			_, statErr := os.Stat(mysqld.config.SocketFile)
 			if statErr != nil && os.IsNotExist(statErr) {
 				return nil
 			}
-			log.Infof("Mysqld.Shutdown: sleeping for 1s waiting for socket file %v", mysqld.config.SocketFile)
-			time.Sleep(time.Second)
+			log.Infof("Mysqld.Shutdown: sleeping for %v waiting for socket file %v", delay, mysqld.config.SocketFile)
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+				return fmt.Errorf("gave up waiting for mysqld to stop: %v", ctx.Err())
+			}
 		}
-		return errors.New("gave up waiting for mysqld to stop")
 	}
 	return nil
 }
@@ -330,11 +474,9 @@ func execCmd(name string, args, env []string, dir string) (cmd *exec.Cmd, err er
 // Init will create the default directory structure for the mysqld process,
 // generate / configure a my.cnf file, unpack a skeleton database,
 // and create some management tables.
-func (mysqld *Mysqld) Init(mysqlWaitTime time.Duration, bootstrapArchive string) error {
+func (mysqld *Mysqld) Init(ctx context.Context, bootstrapArchive string) error {
 	log.Infof("mysqlctl.Init")
-	err := mysqld.createDirs()
-	if err != nil {
-		log.Errorf("%s", err.Error())
+	if err := mysqld.InitConfig(); err != nil {
 		return err
 	}
 	root, err := vtenv.VtRoot()
@@ -343,12 +485,6 @@ func (mysqld *Mysqld) Init(mysqlWaitTime time.Duration, bootstrapArchive string)
 		return err
 	}
 
-	// Set up config files.
-	if err = mysqld.initConfig(root); err != nil {
-		log.Errorf("failed creating %v: %v", mysqld.config.path, err)
-		return err
-	}
-
 	// Unpack bootstrap DB files.
 	dbTbzPath := path.Join(root, "data/bootstrap/"+bootstrapArchive)
 	log.Infof("decompress bootstrap db %v", dbTbzPath)
@@ -359,11 +495,42 @@ func (mysqld *Mysqld) Init(mysqlWaitTime time.Duration, bootstrapArchive string)
 	}
 
 	// Start mysqld.
-	if err = mysqld.Start(mysqlWaitTime); err != nil {
+	if err = mysqld.Start(ctx); err != nil {
 		log.Errorf("failed starting, check %v", mysqld.config.ErrorLogPath)
 		return err
 	}
 
+	// Create the users and the initial objects.
+	if err = mysqld.initDatabase(); err != nil {
+		log.Errorf("failed initializing the database: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// InitConfig creates the directory structure and the my.cnf file, but
+// doesn't unpack the skeleton database nor start mysqld. It is what a
+// tablet provisioned from a backup needs, as the restore brings the
+// data files.
+func (mysqld *Mysqld) InitConfig() error {
+	log.Infof("mysqlctl.InitConfig")
+	err := mysqld.createDirs()
+	if err != nil {
+		log.Errorf("%s", err.Error())
+		return err
+	}
+	root, err := vtenv.VtRoot()
+	if err != nil {
+		log.Errorf("%s", err.Error())
+		return err
+	}
+
+	// Set up config files.
+	if err = mysqld.initConfig(root); err != nil {
+		log.Errorf("failed creating %v: %v", mysqld.config.path, err)
+		return err
+	}
 	return nil
 }
 
@@ -371,7 +538,7 @@ func (mysqld *Mysqld) initConfig(root string) error {
 	var err error
 	var configData string
 
-	switch hr := hook.NewSimpleHook("make_mycnf").Execute(); hr.ExitStatus {
+	switch hr := mysqld.newHook("make_mycnf").Execute(); hr.ExitStatus {
 	case hook.HOOK_DOES_NOT_EXIST:
 		log.Infof("make_mycnf hook doesn't exist, reading default template files")
 		cnfTemplatePaths := []string{
@@ -419,15 +586,15 @@ func (mysqld *Mysqld) createDirs() error {
 }
 
 // createTopDir creates a top level directory under TabletDir.
-// However, if a directory of the same name already exists under
-// vtenv.VtDataRoot(), it creates a directory named after the tablet
-// id under that directory, and then creates a symlink under TabletDir
-// that points to the newly created directory.  For example, if
+// However, if a directory of the same name already exists under the
+// parent of TabletDir (usually vtenv.VtDataRoot()), it creates a
+// directory named after the tablet id under that directory, and then
+// creates a symlink under TabletDir that points to the newly created directory.  For example, if
 // /vt/data is present, it will create the following structure:
 // /vt/data/vt_xxxx /vt/vt_xxxx/data -> /vt/data/vt_xxxx
 func (mysqld *Mysqld) createTopDir(dir string) error {
 	vtname := path.Base(mysqld.TabletDir)
-	target := path.Join(vtenv.VtDataRoot(), dir)
+	target := path.Join(path.Dir(mysqld.TabletDir), dir)
 	_, err := os.Lstat(target)
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -451,7 +618,9 @@ func (mysqld *Mysqld) createTopDir(dir string) error {
 // Teardown will shutdown the running daemon, and delete the root directory.
 func (mysqld *Mysqld) Teardown(force bool) error {
 	log.Infof("mysqlctl.Teardown")
-	if err := mysqld.Shutdown(true, MysqlWaitTime); err != nil {
+	ctx, cancel := context.WithTimeout(context.Background(), MysqlWaitTime)
+	defer cancel()
+	if err := mysqld.Shutdown(ctx, true); err != nil {
 		log.Warningf("failed mysqld shutdown: %v", err.Error())
 		if !force {
 			return err
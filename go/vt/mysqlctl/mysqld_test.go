@@ -0,0 +1,120 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mysqlctl
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/youtube/vitess/go/sqldb"
+	"golang.org/x/net/context"
+)
+
+func TestNextSocketWaitDelay(t *testing.T) {
+	delay := minSocketWaitDelay
+	for i := 0; i < 20; i++ {
+		next := nextSocketWaitDelay(delay)
+		if next < delay || next > maxSocketWaitDelay {
+			t.Fatalf("nextSocketWaitDelay(%v) = %v", delay, next)
+		}
+		delay = next
+	}
+	if delay != maxSocketWaitDelay {
+		t.Errorf("delay should have reached %v, got %v", maxSocketWaitDelay, delay)
+	}
+}
+
+func TestTailErrorLog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mysqld_test")
+	if err != nil {
+		t.Fatalf("TempDir failed: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	errorLog := path.Join(dir, "error.log")
+	var lines []string
+	for i := 0; i < 30; i++ {
+		lines = append(lines, fmt.Sprintf("line %v", i))
+	}
+	if err := ioutil.WriteFile(errorLog, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	if got, want := tailErrorLog(errorLog), strings.Join(lines[10:], "\n"); got != want {
+		t.Errorf("tailErrorLog() = %q, want %q", got, want)
+	}
+	if got := tailErrorLog(path.Join(dir, "missing.log")); !strings.HasPrefix(got, "cannot read error log") {
+		t.Errorf("tailErrorLog() of a missing file = %q", got)
+	}
+}
+
+// fakeMysqldSafe sets up a VT_MYSQL_ROOT with a bin/mysqld_safe
+// script, and returns a Mysqld using it.
+func fakeMysqldSafe(t *testing.T, script string) (*Mysqld, func()) {
+	dir, err := ioutil.TempDir("", "mysqld_test")
+	if err != nil {
+		t.Fatalf("TempDir failed: %v", err)
+	}
+	if err := os.Mkdir(path.Join(dir, "bin"), 0755); err != nil {
+		t.Fatalf("Mkdir failed: %v", err)
+	}
+	if err := ioutil.WriteFile(path.Join(dir, "bin", "mysqld_safe"), []byte("#!/bin/sh\n"+script+"\n"), 0755); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	oldVtRoot := os.Getenv("VTROOT")
+	oldVtMysqlRoot := os.Getenv("VT_MYSQL_ROOT")
+	os.Setenv("VTROOT", dir)
+	os.Setenv("VT_MYSQL_ROOT", dir)
+
+	cnf := &Mycnf{
+		path:         path.Join(dir, "my.cnf"),
+		SocketFile:   path.Join(dir, "mysql.sock"),
+		ErrorLogPath: path.Join(dir, "error.log"),
+	}
+	mysqld := NewMysqld("", "", cnf, &sqldb.ConnParams{}, &sqldb.ConnParams{}, &sqldb.ConnParams{})
+	return mysqld, func() {
+		mysqld.Close()
+		os.Setenv("VTROOT", oldVtRoot)
+		os.Setenv("VT_MYSQL_ROOT", oldVtMysqlRoot)
+		os.RemoveAll(dir)
+	}
+}
+
+func TestStartExitError(t *testing.T) {
+	mysqld, cleanup := fakeMysqldSafe(t, `echo "[ERROR] Can't start server: Bind on TCP/IP port" >> "$(dirname $0)/../error.log"
+exit 1`)
+	defer cleanup()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	err := mysqld.Start(ctx)
+	exitErr, ok := err.(*StartExitError)
+	if !ok {
+		t.Fatalf("Start should have returned a StartExitError, got %v", err)
+	}
+	if !strings.Contains(exitErr.ErrorLog, "Bind on TCP/IP port") {
+		t.Errorf("the error should contain the error log: %v", exitErr)
+	}
+}
+
+func TestStartTimeoutError(t *testing.T) {
+	mysqld, cleanup := fakeMysqldSafe(t, `exec sleep 2`)
+	defer cleanup()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := mysqld.Start(ctx)
+	if _, ok := err.(*StartTimeoutError); !ok {
+		t.Fatalf("Start should have returned a StartTimeoutError, got %v", err)
+	}
+	if elapsed := time.Now().Sub(start); elapsed > time.Second {
+		t.Errorf("Start should have returned at the deadline, took %v", elapsed)
+	}
+}
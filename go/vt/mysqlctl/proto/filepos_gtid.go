@@ -0,0 +1,140 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package proto
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const filePosFlavorID = "FilePos"
+
+// parseFilePosGTID is registered as a GTID parser.
+func parseFilePosGTID(s string) (GTID, error) {
+	// Split into parts.
+	parts := strings.Split(s, ":")
+	if len(parts) != 2 || parts[0] == "" {
+		return nil, fmt.Errorf("invalid FilePos GTID (%v): expecting File:Position", s)
+	}
+
+	// Parse Position.
+	Pos, err := strconv.ParseUint(parts[1], 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid FilePos GTID Position (%v): %v", parts[1], err)
+	}
+
+	return FilePosGTID{
+		File: parts[0],
+		Pos:  uint32(Pos),
+	}, nil
+}
+
+// parseFilePosGTIDSet is registered as a GTIDSet parser.
+func parseFilePosGTIDSet(s string) (GTIDSet, error) {
+	gtid, err := parseFilePosGTID(s)
+	if err != nil {
+		return nil, err
+	}
+	return gtid.(FilePosGTID), err
+}
+
+// FilePosGTID implements GTID, for servers that don't have GTIDs
+// enabled. It is a binlog file name and an offset in that file. The
+// binlog files of a server are named with an increasing sequence
+// number, so file names of the same server can be compared.
+type FilePosGTID struct {
+	// File is the name of the binlog file.
+	File string
+	// Pos is the offset in the binlog file.
+	Pos uint32
+}
+
+// String implements GTID.String().
+func (gtid FilePosGTID) String() string {
+	return fmt.Sprintf("%s:%d", gtid.File, gtid.Pos)
+}
+
+// Flavor implements GTID.Flavor().
+func (gtid FilePosGTID) Flavor() string {
+	return filePosFlavorID
+}
+
+// SequenceDomain implements GTID.SequenceDomain(). Offsets can only be
+// compared within the same file.
+func (gtid FilePosGTID) SequenceDomain() interface{} {
+	return gtid.File
+}
+
+// SourceServer implements GTID.SourceServer(). The file position
+// doesn't identify the server.
+func (gtid FilePosGTID) SourceServer() interface{} {
+	return nil
+}
+
+// SequenceNumber implements GTID.SequenceNumber().
+func (gtid FilePosGTID) SequenceNumber() interface{} {
+	return gtid.Pos
+}
+
+// GTIDSet implements GTID.GTIDSet().
+func (gtid FilePosGTID) GTIDSet() GTIDSet {
+	return gtid
+}
+
+// after returns true if gtid is at or after other.
+func (gtid FilePosGTID) after(other FilePosGTID) bool {
+	if gtid.File != other.File {
+		return gtid.File > other.File
+	}
+	return gtid.Pos >= other.Pos
+}
+
+// ContainsGTID implements GTIDSet.ContainsGTID().
+func (gtid FilePosGTID) ContainsGTID(other GTID) bool {
+	if other == nil {
+		return true
+	}
+	fpOther, ok := other.(FilePosGTID)
+	if !ok {
+		return false
+	}
+	return gtid.after(fpOther)
+}
+
+// Contains implements GTIDSet.Contains().
+func (gtid FilePosGTID) Contains(other GTIDSet) bool {
+	if other == nil {
+		return true
+	}
+	fpOther, ok := other.(FilePosGTID)
+	if !ok {
+		return false
+	}
+	return gtid.after(fpOther)
+}
+
+// Equal implements GTIDSet.Equal().
+func (gtid FilePosGTID) Equal(other GTIDSet) bool {
+	fpOther, ok := other.(FilePosGTID)
+	if !ok {
+		return false
+	}
+	return gtid == fpOther
+}
+
+// AddGTID implements GTIDSet.AddGTID().
+func (gtid FilePosGTID) AddGTID(other GTID) GTIDSet {
+	fpOther, ok := other.(FilePosGTID)
+	if !ok || gtid.after(fpOther) {
+		return gtid
+	}
+	return fpOther
+}
+
+func init() {
+	gtidParsers[filePosFlavorID] = parseFilePosGTID
+	gtidSetParsers[filePosFlavorID] = parseFilePosGTIDSet
+}
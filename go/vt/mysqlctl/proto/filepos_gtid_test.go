@@ -0,0 +1,117 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package proto
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseFilePosGTID(t *testing.T) {
+	input := "vt-0000062344-bin.000012:4567"
+	want := FilePosGTID{File: "vt-0000062344-bin.000012", Pos: 4567}
+
+	got, err := parseFilePosGTID(input)
+	if err != nil {
+		t.Errorf("%v", err)
+	}
+	if got.(FilePosGTID) != want {
+		t.Errorf("parseFilePosGTID(%v) = %v, want %v", input, got, want)
+	}
+	if got.String() != input {
+		t.Errorf("%#v.String() = %v, want %v", got, got.String(), input)
+	}
+}
+
+func TestParseInvalidFilePosGTID(t *testing.T) {
+	table := map[string]string{
+		"bin.000012":      "invalid FilePos GTID",
+		":4567":           "invalid FilePos GTID",
+		"bin.000012:45x7": "invalid FilePos GTID Position",
+	}
+	for input, want := range table {
+		_, err := parseFilePosGTID(input)
+		if err == nil {
+			t.Errorf("expected error for invalid input (%v)", input)
+			continue
+		}
+		if !strings.HasPrefix(err.Error(), want) {
+			t.Errorf("wrong error message, got '%v', want '%v'", err, want)
+		}
+	}
+}
+
+func TestParseFilePosReplicationPosition(t *testing.T) {
+	input := "bin.000012:4567"
+	want := ReplicationPosition{GTIDSet: FilePosGTID{File: "bin.000012", Pos: 4567}}
+
+	got, err := ParseReplicationPosition(filePosFlavorID, input)
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if !got.Equal(want) {
+		t.Errorf("ParseReplicationPosition(%#v) = %#v, want %#v", input, got, want)
+	}
+
+	// encoding keeps the flavor
+	decoded, err := DecodeReplicationPosition(EncodeReplicationPosition(got))
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if !decoded.Equal(want) {
+		t.Errorf("DecodeReplicationPosition() = %#v, want %#v", decoded, want)
+	}
+}
+
+func TestFilePosGTIDContains(t *testing.T) {
+	base := FilePosGTID{File: "bin.000012", Pos: 4567}
+	table := []struct {
+		other GTIDSet
+		want  bool
+	}{
+		{FilePosGTID{File: "bin.000012", Pos: 4567}, true},
+		{FilePosGTID{File: "bin.000012", Pos: 123}, true},
+		{FilePosGTID{File: "bin.000012", Pos: 9999}, false},
+		{FilePosGTID{File: "bin.000011", Pos: 9999}, true},
+		{FilePosGTID{File: "bin.000013", Pos: 4}, false},
+		{MariadbGTID{Domain: 1, Server: 2, Sequence: 3}, false},
+		{nil, true},
+	}
+	for _, tc := range table {
+		if got := base.Contains(tc.other); got != tc.want {
+			t.Errorf("%#v.Contains(%#v) = %v, want %v", base, tc.other, got, tc.want)
+		}
+		if gtid, ok := tc.other.(GTID); ok {
+			if got := base.ContainsGTID(gtid); got != tc.want {
+				t.Errorf("%#v.ContainsGTID(%#v) = %v, want %v", base, gtid, got, tc.want)
+			}
+		}
+	}
+}
+
+func TestFilePosReplicationPositionAtLeast(t *testing.T) {
+	pos := ReplicationPosition{GTIDSet: FilePosGTID{File: "bin.000012", Pos: 4567}}
+	if !pos.AtLeast(ReplicationPosition{GTIDSet: FilePosGTID{File: "bin.000011", Pos: 10000}}) {
+		t.Errorf("%v should be at least a position in a previous file", pos)
+	}
+	if pos.AtLeast(ReplicationPosition{GTIDSet: FilePosGTID{File: "bin.000012", Pos: 5000}}) {
+		t.Errorf("%v shouldn't be at least a later position in the same file", pos)
+	}
+}
+
+func TestFilePosGTIDAddGTID(t *testing.T) {
+	base := FilePosGTID{File: "bin.000012", Pos: 4567}
+	later := FilePosGTID{File: "bin.000013", Pos: 4}
+	if got := base.AddGTID(later); got != later {
+		t.Errorf("%#v.AddGTID(%#v) = %#v, want %#v", base, later, got, later)
+	}
+	earlier := FilePosGTID{File: "bin.000012", Pos: 4}
+	if got := base.AddGTID(earlier); got != base {
+		t.Errorf("%#v.AddGTID(%#v) = %#v, want %#v", base, earlier, got, base)
+	}
+	if got := base.AddGTID(MariadbGTID{Domain: 1, Server: 2, Sequence: 3}); got != base {
+		t.Errorf("AddGTID of the wrong type should be a no-op, got %#v", got)
+	}
+}
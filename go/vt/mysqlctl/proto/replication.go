@@ -205,6 +205,8 @@ type ReplicationStatus struct {
 	MasterHost          string
 	MasterPort          int
 	MasterConnectRetry  int
+	LastIOErrno         int
+	LastSQLErrno        int
 }
 
 // SlaveRunning returns true iff both the Slave IO and Slave SQL threads are
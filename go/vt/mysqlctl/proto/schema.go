@@ -30,6 +30,7 @@ type TableDefinition struct {
 	PrimaryKeyColumns []string // the columns used by the primary key, in order
 	Type              string   // TableBaseTable or TableView
 	DataLength        uint64   // how much space the data file takes.
+	IndexLength       uint64   // how much space the indexes take.
 	RowCount          uint64   // how many rows in the table (may
 	// be approximate count)
 }
@@ -56,6 +57,8 @@ type SchemaDefinition struct {
 	TableDefinitions TableDefinitions
 
 	// the md5 of the concatenation of TableDefinition.Schema
+	// (the sizes and row counts are not part of it, so the version
+	// doesn't change as data is inserted)
 	Version string
 }
 
@@ -212,7 +215,13 @@ func DiffSchema(leftName string, left *SchemaDefinition, rightName string, right
 			continue
 		}
 
-		// same name, let's see content
+		// same name, let's see content. A primary key change is
+		// reported on its own, as it changes how the data is
+		// chunked and copied.
+		if !stringListsEqual(left.TableDefinitions[leftIndex].PrimaryKeyColumns, right.TableDefinitions[rightIndex].PrimaryKeyColumns) {
+			er.RecordError(fmt.Errorf("%v and %v disagree on primary key columns for table %v:\n%v\n differs from:\n%v", leftName, rightName, left.TableDefinitions[leftIndex].Name, left.TableDefinitions[leftIndex].PrimaryKeyColumns, right.TableDefinitions[rightIndex].PrimaryKeyColumns))
+		}
+
 		if left.TableDefinitions[leftIndex].Schema != right.TableDefinitions[rightIndex].Schema {
 			er.RecordError(fmt.Errorf("%v and %v disagree on schema for table %v:\n%v\n differs from:\n%v", leftName, rightName, left.TableDefinitions[leftIndex].Name, left.TableDefinitions[leftIndex].Schema, right.TableDefinitions[rightIndex].Schema))
 		}
@@ -245,6 +254,90 @@ func DiffSchema(leftName string, left *SchemaDefinition, rightName string, right
 	}
 }
 
+// DiffSchemaSummary compares two schemas, and returns one short
+// description per differing table, like "t1 (missing table)", where
+// the reason is given from the point of view of the right side.
+// Use DiffSchema for the complete differences.
+func DiffSchemaSummary(left, right *SchemaDefinition) []string {
+	if left == nil && right == nil {
+		return nil
+	}
+	if left == nil || right == nil {
+		return []string{"schema (missing)"}
+	}
+	var result []string
+	if left.DatabaseSchema != right.DatabaseSchema {
+		result = append(result, "database (creation command differs)")
+	}
+
+	leftIndex := 0
+	rightIndex := 0
+	for leftIndex < len(left.TableDefinitions) || rightIndex < len(right.TableDefinitions) {
+		var l, r *TableDefinition
+		switch {
+		case rightIndex == len(right.TableDefinitions):
+			l = left.TableDefinitions[leftIndex]
+		case leftIndex == len(left.TableDefinitions):
+			r = right.TableDefinitions[rightIndex]
+		case left.TableDefinitions[leftIndex].Name < right.TableDefinitions[rightIndex].Name:
+			l = left.TableDefinitions[leftIndex]
+		case left.TableDefinitions[leftIndex].Name > right.TableDefinitions[rightIndex].Name:
+			r = right.TableDefinitions[rightIndex]
+		default:
+			l = left.TableDefinitions[leftIndex]
+			r = right.TableDefinitions[rightIndex]
+		}
+		if l != nil {
+			leftIndex++
+		}
+		if r != nil {
+			rightIndex++
+		}
+
+		var name, reason string
+		switch {
+		case r == nil:
+			name, reason = l.Name, "missing "+tableKind(l)
+		case l == nil:
+			name, reason = r.Name, "extra "+tableKind(r)
+		case l.Type != r.Type:
+			name, reason = l.Name, "type differs"
+		case len(l.Columns) != len(r.Columns):
+			name, reason = l.Name, "column count differs"
+		case !stringListsEqual(l.PrimaryKeyColumns, r.PrimaryKeyColumns):
+			name, reason = l.Name, "primary key differs"
+		case l.Schema != r.Schema:
+			name, reason = l.Name, "schema differs"
+		default:
+			continue
+		}
+		result = append(result, fmt.Sprintf("%v (%v)", name, reason))
+	}
+	return result
+}
+
+// tableKind returns "view" or "table" depending on the table type.
+func tableKind(td *TableDefinition) string {
+	if td.Type == TableView {
+		return "view"
+	}
+	return "table"
+}
+
+// stringListsEqual returns true if both lists have the same
+// strings in the same order.
+func stringListsEqual(left, right []string) bool {
+	if len(left) != len(right) {
+		return false
+	}
+	for i := range left {
+		if left[i] != right[i] {
+			return false
+		}
+	}
+	return true
+}
+
 // DiffSchemaToArray diffs two schemas and return the schema diffs if there is any.
 func DiffSchemaToArray(leftName string, left *SchemaDefinition, rightName string, right *SchemaDefinition) (result []string) {
 	er := concurrency.AllErrorRecorder{}
@@ -269,6 +362,12 @@ type SchemaChange struct {
 type SchemaChangeResult struct {
 	BeforeSchema *SchemaDefinition
 	AfterSchema  *SchemaDefinition
+
+	// ChangeType is the parsed type of the change, one of the
+	// sqlparser DDL actions ("create", "alter", "rename" or "drop"),
+	// or empty if it couldn't be parsed. It is only set by
+	// PreflightSchema.
+	ChangeType string
 }
 
 func (scr *SchemaChangeResult) String() string {
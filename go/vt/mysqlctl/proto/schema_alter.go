@@ -0,0 +1,552 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package proto
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/youtube/vitess/go/vt/concurrency"
+)
+
+// AlterOptions lists the changes AlterTableStatements is allowed to
+// make, on top of the ones that can't lose data.
+type AlterOptions struct {
+	// AllowNarrowing allows column type changes that may truncate
+	// or reject existing values, like a shorter varchar or a
+	// smaller integer type.
+	AllowNarrowing bool
+
+	// AllowCharsetChange allows changes of the character set or
+	// collation of columns or tables.
+	AllowCharsetChange bool
+}
+
+// AlterTableStatements returns the statements that change the table
+// from into the table to, both described by their SHOW CREATE TABLE
+// output. The columns keep their names: a renamed column is dropped
+// and added again. Changes that may lose data are refused unless
+// allowed by opts.
+func AlterTableStatements(from, to *TableDefinition, opts AlterOptions) ([]string, error) {
+	if from.Type != TableBaseTable || to.Type != TableBaseTable {
+		return nil, fmt.Errorf("cannot alter %v into %v, only base tables can be altered", from.Name, to.Name)
+	}
+	if from.Name != to.Name {
+		return nil, fmt.Errorf("cannot alter %v into %v, tables have different names", from.Name, to.Name)
+	}
+	fromTable, err := parseCreateTable(from.Schema)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse schema of %v: %v", from.Name, err)
+	}
+	toTable, err := parseCreateTable(to.Schema)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse schema of %v: %v", to.Name, err)
+	}
+
+	// foreign keys are dropped in their own statement, as MySQL
+	// can't drop and add a foreign key with the same name at once
+	var fkDrops, clauses []string
+	for _, name := range fromTable.indexNames {
+		if def, ok := toTable.indexes[name]; ok && def == fromTable.indexes[name] {
+			continue
+		}
+		switch {
+		case name == "PRIMARY":
+			clauses = append(clauses, "DROP PRIMARY KEY")
+		case strings.HasPrefix(fromTable.indexes[name], "CONSTRAINT "):
+			fkDrops = append(fkDrops, "DROP FOREIGN KEY "+quoteName(name))
+		default:
+			clauses = append(clauses, "DROP INDEX "+quoteName(name))
+		}
+	}
+
+	columnClauses, err := alterColumns(fromTable, toTable, opts)
+	if err != nil {
+		return nil, fmt.Errorf("cannot alter %v: %v", from.Name, err)
+	}
+	clauses = append(clauses, columnClauses...)
+
+	for _, name := range toTable.indexNames {
+		if def, ok := fromTable.indexes[name]; ok && def == toTable.indexes[name] {
+			continue
+		}
+		clauses = append(clauses, "ADD "+toTable.indexes[name])
+	}
+
+	optionClauses, err := alterTableOptions(fromTable.options, toTable.options, opts)
+	if err != nil {
+		return nil, fmt.Errorf("cannot alter %v: %v", from.Name, err)
+	}
+	clauses = append(clauses, optionClauses...)
+
+	var result []string
+	if len(fkDrops) > 0 {
+		result = append(result, alterTableStatement(from.Name, fkDrops))
+	}
+	if len(clauses) > 0 {
+		result = append(result, alterTableStatement(from.Name, clauses))
+	}
+	return result, nil
+}
+
+// SchemaFixes returns the statements that change the schema from into
+// the schema to: the missing tables and views are created, the extra
+// ones dropped, and the different tables altered. The tables that
+// can't be changed are recorded in er.
+func SchemaFixes(from, to *SchemaDefinition, opts AlterOptions, er concurrency.ErrorRecorder) []string {
+	var result []string
+	for _, td := range from.TableDefinitions {
+		if _, ok := to.GetTable(td.Name); !ok {
+			result = append(result, dropStatement(td))
+		}
+	}
+	for _, td := range to.TableDefinitions {
+		fromTd, ok := from.GetTable(td.Name)
+		switch {
+		case !ok:
+			result = append(result, td.Schema)
+		case fromTd.Schema == td.Schema && fromTd.Type == td.Type:
+		case fromTd.Type == TableView || td.Type == TableView:
+			result = append(result, dropStatement(fromTd), td.Schema)
+		default:
+			statements, err := AlterTableStatements(fromTd, td, opts)
+			if err != nil {
+				er.RecordError(err)
+				continue
+			}
+			result = append(result, statements...)
+		}
+	}
+	return result
+}
+
+func dropStatement(td *TableDefinition) string {
+	if td.Type == TableView {
+		return "DROP VIEW " + quoteName(td.Name)
+	}
+	return "DROP TABLE " + quoteName(td.Name)
+}
+
+func alterTableStatement(table string, clauses []string) string {
+	return "ALTER TABLE " + quoteName(table) + "\n  " + strings.Join(clauses, ",\n  ")
+}
+
+func quoteName(name string) string {
+	return "`" + name + "`"
+}
+
+// createTable is a CREATE TABLE statement, as displayed by SHOW
+// CREATE TABLE, split into its parts.
+type createTable struct {
+	// columnNames is in the table order, columns has the
+	// definitions without the names.
+	columnNames []string
+	columns     map[string]string
+
+	// indexNames is in the table order, and uses PRIMARY for the
+	// primary key. indexes has the full definitions.
+	indexNames []string
+	indexes    map[string]string
+
+	// options are the table options after the closing parenthesis.
+	options map[string]string
+}
+
+var (
+	indexRegexp      = regexp.MustCompile("^(?:UNIQUE |FULLTEXT |SPATIAL )?KEY `([^`]+)`")
+	constraintRegexp = regexp.MustCompile("^CONSTRAINT `([^`]+)`")
+)
+
+// parseCreateTable parses the output of SHOW CREATE TABLE. It relies
+// on its formatting, with one column or index per line.
+func parseCreateTable(schema string) (*createTable, error) {
+	lines := strings.Split(schema, "\n")
+	if len(lines) < 3 || !strings.HasPrefix(lines[0], "CREATE TABLE ") || !strings.HasSuffix(lines[0], " (") || !strings.HasPrefix(lines[len(lines)-1], ")") {
+		return nil, fmt.Errorf("not a SHOW CREATE TABLE output")
+	}
+	ct := &createTable{
+		columns: make(map[string]string),
+		indexes: make(map[string]string),
+	}
+	for _, line := range lines[1 : len(lines)-1] {
+		line = strings.TrimSuffix(strings.TrimSpace(line), ",")
+		var name string
+		switch {
+		case strings.HasPrefix(line, "`"):
+			end := strings.Index(line[1:], "`")
+			if end == -1 {
+				return nil, fmt.Errorf("invalid column definition: %v", line)
+			}
+			name = line[1 : end+1]
+			ct.columnNames = append(ct.columnNames, name)
+			ct.columns[name] = strings.TrimSpace(line[end+2:])
+			continue
+		case strings.HasPrefix(line, "PRIMARY KEY "):
+			name = "PRIMARY"
+		default:
+			m := indexRegexp.FindStringSubmatch(line)
+			if m == nil {
+				m = constraintRegexp.FindStringSubmatch(line)
+			}
+			if m == nil {
+				return nil, fmt.Errorf("unsupported definition: %v", line)
+			}
+			name = m[1]
+		}
+		ct.indexNames = append(ct.indexNames, name)
+		ct.indexes[name] = line
+	}
+	options, err := parseTableOptions(strings.TrimPrefix(lines[len(lines)-1], ")"))
+	if err != nil {
+		return nil, err
+	}
+	ct.options = options
+	return ct, nil
+}
+
+// parseTableOptions parses table options like
+// ENGINE=InnoDB DEFAULT CHARSET=utf8 COMMENT='a comment'.
+// The keys are the option names, without DEFAULT.
+func parseTableOptions(s string) (map[string]string, error) {
+	options := make(map[string]string)
+	s = strings.TrimSpace(s)
+	for s != "" {
+		s = strings.TrimPrefix(s, "DEFAULT ")
+		eq := strings.Index(s, "=")
+		if eq == -1 {
+			return nil, fmt.Errorf("invalid table options: %v", s)
+		}
+		name := s[:eq]
+		s = s[eq+1:]
+		end := strings.Index(s, " ")
+		if strings.HasPrefix(s, "'") {
+			// quotes are doubled in quoted values
+			end = 1
+			for {
+				q := strings.Index(s[end:], "'")
+				if q == -1 {
+					return nil, fmt.Errorf("unterminated table option %v", name)
+				}
+				end += q + 1
+				if !strings.HasPrefix(s[end:], "'") {
+					break
+				}
+				end++
+			}
+		} else if end == -1 {
+			end = len(s)
+		}
+		options[name] = s[:end]
+		s = strings.TrimSpace(s[end:])
+	}
+	return options, nil
+}
+
+// alterTableOptions returns the clauses that change the table options.
+// AUTO_INCREMENT is not part of the table definition, and is ignored.
+func alterTableOptions(from, to map[string]string, opts AlterOptions) ([]string, error) {
+	var names []string
+	for name := range from {
+		names = append(names, name)
+	}
+	for name := range to {
+		if _, ok := from[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var clauses []string
+	for _, name := range names {
+		if name == "AUTO_INCREMENT" || from[name] == to[name] {
+			continue
+		}
+		value := to[name]
+		switch name {
+		case "CHARSET", "COLLATE":
+			if !opts.AllowCharsetChange {
+				return nil, fmt.Errorf("table %v changes from %v to %v", name, from[name], to[name])
+			}
+			name = "DEFAULT " + name
+		case "COMMENT":
+			if value == "" {
+				value = "''"
+			}
+		case "ENGINE", "ROW_FORMAT", "KEY_BLOCK_SIZE":
+		default:
+			return nil, fmt.Errorf("unsupported table option %v", name)
+		}
+		if value == "" {
+			value = "DEFAULT"
+		}
+		clauses = append(clauses, name+"="+value)
+	}
+	return clauses, nil
+}
+
+// alterColumns returns the clauses that drop, add, change and
+// reorder the columns. The columns that keep their place are the
+// longest sequence of common columns that are already in order, the
+// others are moved after their predecessor in the new order.
+func alterColumns(from, to *createTable, opts AlterOptions) ([]string, error) {
+	var clauses []string
+	var kept []string
+	for _, name := range from.columnNames {
+		toDef, ok := to.columns[name]
+		if !ok {
+			clauses = append(clauses, "DROP COLUMN "+quoteName(name))
+			continue
+		}
+		// a generated column can't be converted to a stored
+		// one, or the other way around, but its values don't
+		// need to be kept
+		if isGenerated(from.columns[name]) && isGenerated(toDef) && from.columns[name] != toDef {
+			clauses = append(clauses, "DROP COLUMN "+quoteName(name))
+			continue
+		}
+		kept = append(kept, name)
+	}
+
+	inPlace := make(map[string]bool)
+	for _, name := range longestOrderedSubsequence(kept, to.columnNames) {
+		inPlace[name] = true
+	}
+
+	keptSet := make(map[string]bool)
+	for _, name := range kept {
+		keptSet[name] = true
+	}
+	for i, name := range to.columnNames {
+		position := " FIRST"
+		if i > 0 {
+			position = " AFTER " + quoteName(to.columnNames[i-1])
+		}
+		def := to.columns[name]
+		if !keptSet[name] {
+			clauses = append(clauses, "ADD COLUMN "+quoteName(name)+" "+def+position)
+			continue
+		}
+		if from.columns[name] == def && inPlace[name] {
+			continue
+		}
+		if err := checkColumnChange(name, from.columns[name], def, opts); err != nil {
+			return nil, err
+		}
+		if inPlace[name] {
+			position = ""
+		}
+		clauses = append(clauses, "MODIFY COLUMN "+quoteName(name)+" "+def+position)
+	}
+	return clauses, nil
+}
+
+// longestOrderedSubsequence returns the longest subsequence of names
+// that is in the same order in order.
+func longestOrderedSubsequence(names, order []string) []string {
+	rank := make(map[string]int)
+	for i, name := range order {
+		rank[name] = i
+	}
+	// length[i] is the length of the longest subsequence ending
+	// with names[i], and previous[i] the index before it in it
+	length := make([]int, len(names))
+	previous := make([]int, len(names))
+	best := -1
+	for i := range names {
+		length[i], previous[i] = 1, -1
+		for j := 0; j < i; j++ {
+			if rank[names[j]] < rank[names[i]] && length[j]+1 > length[i] {
+				length[i], previous[i] = length[j]+1, j
+			}
+		}
+		if best == -1 || length[i] > length[best] {
+			best = i
+		}
+	}
+	var result []string
+	for i := best; i >= 0; i = previous[i] {
+		result = append([]string{names[i]}, result...)
+	}
+	return result
+}
+
+func isGenerated(def string) bool {
+	return strings.Contains(def, " GENERATED ALWAYS AS ")
+}
+
+var (
+	columnCharsetRegexp   = regexp.MustCompile(`CHARACTER SET (\w+)`)
+	columnCollationRegexp = regexp.MustCompile(`COLLATE (\w+)`)
+)
+
+// checkColumnChange returns an error if changing the column
+// definition from into to is not allowed.
+func checkColumnChange(name, from, to string, opts AlterOptions) error {
+	if isGenerated(from) != isGenerated(to) {
+		return fmt.Errorf("column %v cannot be converted between a generated and a regular column", name)
+	}
+	if !opts.AllowCharsetChange {
+		for _, re := range []*regexp.Regexp{columnCharsetRegexp, columnCollationRegexp} {
+			if f, t := re.FindString(from), re.FindString(to); f != t {
+				return fmt.Errorf("column %v changes from %q to %q, which is a character set change", name, f, t)
+			}
+		}
+	}
+	if !opts.AllowNarrowing {
+		fromType, err := parseColumnType(from)
+		if err != nil {
+			return fmt.Errorf("column %v: %v", name, err)
+		}
+		toType, err := parseColumnType(to)
+		if err != nil {
+			return fmt.Errorf("column %v: %v", name, err)
+		}
+		if !toType.holds(fromType) {
+			return fmt.Errorf("column %v changes from %v to %v, which may not hold all the values", name, fromType, toType)
+		}
+	}
+	return nil
+}
+
+// columnType is the type part of a column definition.
+type columnType struct {
+	base     string
+	args     []string
+	unsigned bool
+}
+
+func (ct columnType) String() string {
+	s := ct.base
+	if len(ct.args) > 0 {
+		s += "(" + strings.Join(ct.args, ",") + ")"
+	}
+	if ct.unsigned {
+		s += " unsigned"
+	}
+	return s
+}
+
+// parseColumnType parses the type at the beginning of a column
+// definition, like "varchar(64) NOT NULL" or "enum('a','b')".
+func parseColumnType(def string) (columnType, error) {
+	var ct columnType
+	end := strings.IndexAny(def, " (")
+	if end == -1 {
+		end = len(def)
+	}
+	ct.base = strings.ToLower(def[:end])
+	rest := def[end:]
+	if strings.HasPrefix(rest, "(") {
+		inQuote := false
+		start, i := 1, 1
+		for ; i < len(rest) && (inQuote || rest[i] != ')'); i++ {
+			switch {
+			case rest[i] == '\'':
+				inQuote = !inQuote
+			case rest[i] == ',' && !inQuote:
+				ct.args = append(ct.args, rest[start:i])
+				start = i + 1
+			}
+		}
+		if i == len(rest) {
+			return ct, fmt.Errorf("invalid column type in %v", def)
+		}
+		ct.args = append(ct.args, rest[start:i])
+		rest = rest[i+1:]
+	}
+	ct.unsigned = strings.HasPrefix(rest, " unsigned")
+	return ct, nil
+}
+
+var (
+	integerRanks = map[string]int{"tinyint": 1, "smallint": 2, "mediumint": 3, "int": 4, "bigint": 5}
+	textRanks    = map[string]int{"tinytext": 1, "text": 2, "mediumtext": 3, "longtext": 4}
+	blobRanks    = map[string]int{"tinyblob": 1, "blob": 2, "mediumblob": 3, "longblob": 4}
+)
+
+// holds returns true if all the values of other can be stored in ct
+// without losing anything.
+func (ct columnType) holds(other columnType) bool {
+	if r, ok := integerRanks[ct.base]; ok {
+		otherR, ok := integerRanks[other.base]
+		switch {
+		case !ok:
+			return false
+		case ct.unsigned == other.unsigned:
+			return r >= otherR
+		default:
+			// unsigned values fit in a bigger signed type,
+			// negative values never fit in an unsigned one
+			return !ct.unsigned && r > otherR
+		}
+	}
+	for _, ranks := range []map[string]int{textRanks, blobRanks} {
+		if r, ok := ranks[ct.base]; ok {
+			otherR, ok := ranks[other.base]
+			return ok && r >= otherR
+		}
+	}
+
+	switch {
+	case ct.base == other.base:
+	case ct.base == "varchar" && other.base == "char", ct.base == "varbinary" && other.base == "binary":
+	case ct.base == "double" && other.base == "float":
+		return len(ct.args) == 0 && len(other.args) == 0
+	default:
+		return false
+	}
+
+	if ct.base == "enum" || ct.base == "set" {
+		// values can be added at the end
+		if len(ct.args) < len(other.args) {
+			return false
+		}
+		for i, v := range other.args {
+			if ct.args[i] != v {
+				return false
+			}
+		}
+		return true
+	}
+	if ct.unsigned != other.unsigned {
+		return false
+	}
+	if ct.base == "decimal" {
+		// decimal(precision,scale): both the integer part and
+		// the scale have to be at least as big
+		p, s := decimalArgs(ct.args)
+		otherP, otherS := decimalArgs(other.args)
+		return s >= otherS && p-s >= otherP-otherS
+	}
+	// the other types only have a length or a precision
+	return argOrZero(ct.args) >= argOrZero(other.args)
+}
+
+// decimalArgs returns the precision and scale of a decimal, with the
+// MySQL defaults.
+func decimalArgs(args []string) (int, int) {
+	p, s := 10, 0
+	if len(args) > 0 {
+		p = argOrZero(args[:1])
+	}
+	if len(args) > 1 {
+		s = argOrZero(args[1:])
+	}
+	return p, s
+}
+
+func argOrZero(args []string) int {
+	if len(args) == 0 {
+		return 0
+	}
+	n, err := strconv.Atoi(args[0])
+	if err != nil {
+		return 0
+	}
+	return n
+}
@@ -0,0 +1,343 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package proto
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/youtube/vitess/go/vt/concurrency"
+)
+
+func showCreateTable(lines ...string) *TableDefinition {
+	return &TableDefinition{
+		Name:   "t",
+		Schema: "CREATE TABLE `t` (\n  " + strings.Join(lines[:len(lines)-1], ",\n  ") + "\n" + lines[len(lines)-1],
+		Type:   TableBaseTable,
+	}
+}
+
+func TestAlterTableStatements(t *testing.T) {
+	base := showCreateTable(
+		"`id` bigint(20) NOT NULL",
+		"`name` varchar(64) DEFAULT NULL",
+		"`count` int(11) NOT NULL DEFAULT '0'",
+		"PRIMARY KEY (`id`)",
+		"KEY `name` (`name`)",
+		") ENGINE=InnoDB DEFAULT CHARSET=utf8")
+
+	for _, tc := range []struct {
+		desc string
+		to   *TableDefinition
+		opts AlterOptions
+		want []string
+	}{
+		{
+			desc: "no change",
+			to:   base,
+			want: nil,
+		},
+		{
+			desc: "add, drop and modify columns",
+			to: showCreateTable(
+				"`id` bigint(20) NOT NULL",
+				"`name` varchar(128) NOT NULL",
+				"`created` datetime DEFAULT NULL",
+				"PRIMARY KEY (`id`)",
+				"KEY `name` (`name`)",
+				") ENGINE=InnoDB DEFAULT CHARSET=utf8"),
+			want: []string{"ALTER TABLE `t`\n" +
+				"  DROP COLUMN `count`,\n" +
+				"  MODIFY COLUMN `name` varchar(128) NOT NULL,\n" +
+				"  ADD COLUMN `created` datetime DEFAULT NULL AFTER `name`"},
+		},
+		{
+			desc: "reorder columns with a single move",
+			to: showCreateTable(
+				"`name` varchar(64) DEFAULT NULL",
+				"`count` int(11) NOT NULL DEFAULT '0'",
+				"`id` bigint(20) NOT NULL",
+				"PRIMARY KEY (`id`)",
+				"KEY `name` (`name`)",
+				") ENGINE=InnoDB DEFAULT CHARSET=utf8"),
+			want: []string{"ALTER TABLE `t`\n" +
+				"  MODIFY COLUMN `id` bigint(20) NOT NULL AFTER `count`"},
+		},
+		{
+			desc: "move a column first",
+			to: showCreateTable(
+				"`count` int(11) NOT NULL DEFAULT '0'",
+				"`id` bigint(20) NOT NULL",
+				"`name` varchar(64) DEFAULT NULL",
+				"PRIMARY KEY (`id`)",
+				"KEY `name` (`name`)",
+				") ENGINE=InnoDB DEFAULT CHARSET=utf8"),
+			want: []string{"ALTER TABLE `t`\n" +
+				"  MODIFY COLUMN `count` int(11) NOT NULL DEFAULT '0' FIRST"},
+		},
+		{
+			desc: "change indexes and primary key",
+			to: showCreateTable(
+				"`id` bigint(20) NOT NULL",
+				"`name` varchar(64) DEFAULT NULL",
+				"`count` int(11) NOT NULL DEFAULT '0'",
+				"PRIMARY KEY (`id`,`name`)",
+				"UNIQUE KEY `name` (`name`)",
+				"KEY `count` (`count`)",
+				") ENGINE=InnoDB DEFAULT CHARSET=utf8"),
+			want: []string{"ALTER TABLE `t`\n" +
+				"  DROP PRIMARY KEY,\n" +
+				"  DROP INDEX `name`,\n" +
+				"  ADD PRIMARY KEY (`id`,`name`),\n" +
+				"  ADD UNIQUE KEY `name` (`name`),\n" +
+				"  ADD KEY `count` (`count`)"},
+		},
+		{
+			desc: "widen types and change the engine",
+			to: showCreateTable(
+				"`id` bigint(20) unsigned NOT NULL",
+				"`name` varchar(64) DEFAULT NULL",
+				"`count` bigint(20) NOT NULL DEFAULT '0'",
+				"PRIMARY KEY (`id`)",
+				"KEY `name` (`name`)",
+				") ENGINE=MyISAM DEFAULT CHARSET=utf8 COMMENT='it''s a table'"),
+			opts: AlterOptions{AllowNarrowing: true},
+			want: []string{"ALTER TABLE `t`\n" +
+				"  MODIFY COLUMN `id` bigint(20) unsigned NOT NULL,\n" +
+				"  MODIFY COLUMN `count` bigint(20) NOT NULL DEFAULT '0',\n" +
+				"  COMMENT='it''s a table',\n" +
+				"  ENGINE=MyISAM"},
+		},
+		{
+			desc: "allowed charset change",
+			to: showCreateTable(
+				"`id` bigint(20) NOT NULL",
+				"`name` varchar(64) CHARACTER SET latin1 DEFAULT NULL",
+				"`count` int(11) NOT NULL DEFAULT '0'",
+				"PRIMARY KEY (`id`)",
+				"KEY `name` (`name`)",
+				") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4"),
+			opts: AlterOptions{AllowCharsetChange: true},
+			want: []string{"ALTER TABLE `t`\n" +
+				"  MODIFY COLUMN `name` varchar(64) CHARACTER SET latin1 DEFAULT NULL,\n" +
+				"  DEFAULT CHARSET=utf8mb4"},
+		},
+	} {
+		got, err := AlterTableStatements(base, tc.to, tc.opts)
+		if err != nil {
+			t.Errorf("%v: AlterTableStatements failed: %v", tc.desc, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%v: AlterTableStatements returned:\n%v\nwant:\n%v", tc.desc, strings.Join(got, ";\n"), strings.Join(tc.want, ";\n"))
+		}
+	}
+}
+
+// TestAlterTableStatementsGeneratedColumns uses MySQL 5.7 generated
+// columns, that don't exist on a MySQL 5.5 schema.
+func TestAlterTableStatementsGeneratedColumns(t *testing.T) {
+	mysql55 := showCreateTable(
+		"`id` bigint(20) NOT NULL",
+		"`price` int(11) NOT NULL",
+		"PRIMARY KEY (`id`)",
+		") ENGINE=InnoDB DEFAULT CHARSET=utf8")
+	virtual := showCreateTable(
+		"`id` bigint(20) NOT NULL",
+		"`price` int(11) NOT NULL",
+		"`taxed` int(11) GENERATED ALWAYS AS ((`price` * 2)) VIRTUAL",
+		"PRIMARY KEY (`id`)",
+		"KEY `taxed` (`taxed`)",
+		") ENGINE=InnoDB DEFAULT CHARSET=utf8")
+	stored := showCreateTable(
+		"`id` bigint(20) NOT NULL",
+		"`price` int(11) NOT NULL",
+		"`taxed` int(11) GENERATED ALWAYS AS ((`price` * 2)) STORED",
+		"PRIMARY KEY (`id`)",
+		"KEY `taxed` (`taxed`)",
+		") ENGINE=InnoDB DEFAULT CHARSET=utf8")
+
+	for _, tc := range []struct {
+		desc     string
+		from, to *TableDefinition
+		want     []string
+	}{
+		{
+			desc: "add a generated column",
+			from: mysql55,
+			to:   virtual,
+			want: []string{"ALTER TABLE `t`\n" +
+				"  ADD COLUMN `taxed` int(11) GENERATED ALWAYS AS ((`price` * 2)) VIRTUAL AFTER `price`,\n" +
+				"  ADD KEY `taxed` (`taxed`)"},
+		},
+		{
+			desc: "drop a generated column",
+			from: virtual,
+			to:   mysql55,
+			want: []string{"ALTER TABLE `t`\n" +
+				"  DROP INDEX `taxed`,\n" +
+				"  DROP COLUMN `taxed`"},
+		},
+		{
+			desc: "store a generated column",
+			from: virtual,
+			to:   stored,
+			want: []string{"ALTER TABLE `t`\n" +
+				"  DROP COLUMN `taxed`,\n" +
+				"  ADD COLUMN `taxed` int(11) GENERATED ALWAYS AS ((`price` * 2)) STORED AFTER `price`"},
+		},
+	} {
+		got, err := AlterTableStatements(tc.from, tc.to, AlterOptions{})
+		if err != nil {
+			t.Errorf("%v: AlterTableStatements failed: %v", tc.desc, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%v: AlterTableStatements returned:\n%v\nwant:\n%v", tc.desc, strings.Join(got, ";\n"), strings.Join(tc.want, ";\n"))
+		}
+	}
+}
+
+func TestAlterTableStatementsForeignKeys(t *testing.T) {
+	from := showCreateTable(
+		"`id` bigint(20) NOT NULL",
+		"`parent` bigint(20) NOT NULL",
+		"PRIMARY KEY (`id`)",
+		"KEY `parent` (`parent`)",
+		"CONSTRAINT `fk_parent` FOREIGN KEY (`parent`) REFERENCES `p` (`id`)",
+		") ENGINE=InnoDB DEFAULT CHARSET=utf8")
+	to := showCreateTable(
+		"`id` bigint(20) NOT NULL",
+		"`parent` bigint(20) NOT NULL",
+		"PRIMARY KEY (`id`)",
+		"KEY `parent` (`parent`)",
+		"CONSTRAINT `fk_parent` FOREIGN KEY (`parent`) REFERENCES `p` (`id`) ON DELETE CASCADE",
+		") ENGINE=InnoDB DEFAULT CHARSET=utf8")
+	got, err := AlterTableStatements(from, to, AlterOptions{})
+	if err != nil {
+		t.Fatalf("AlterTableStatements failed: %v", err)
+	}
+	want := []string{
+		"ALTER TABLE `t`\n  DROP FOREIGN KEY `fk_parent`",
+		"ALTER TABLE `t`\n  ADD CONSTRAINT `fk_parent` FOREIGN KEY (`parent`) REFERENCES `p` (`id`) ON DELETE CASCADE",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("AlterTableStatements returned %v, want %v", got, want)
+	}
+}
+
+func TestAlterTableStatementsRefused(t *testing.T) {
+	from := showCreateTable(
+		"`id` bigint(20) unsigned NOT NULL",
+		"`name` varchar(64) DEFAULT NULL",
+		"`kind` enum('a','b') DEFAULT NULL",
+		"`price` decimal(10,2) NOT NULL",
+		"`total` int(11) NOT NULL",
+		"PRIMARY KEY (`id`)",
+		") ENGINE=InnoDB DEFAULT CHARSET=utf8")
+	for _, tc := range []struct {
+		column, def string
+		narrowing   bool
+	}{
+		{"id", "bigint(20) NOT NULL", true},
+		{"id", "int(10) unsigned NOT NULL", true},
+		{"name", "varchar(32) DEFAULT NULL", true},
+		{"name", "char(64) DEFAULT NULL", true},
+		{"name", "int(11) DEFAULT NULL", true},
+		{"name", "varchar(64) CHARACTER SET latin1 DEFAULT NULL", false},
+		{"name", "varchar(64) COLLATE utf8_bin DEFAULT NULL", false},
+		{"kind", "enum('b','a') DEFAULT NULL", true},
+		{"price", "decimal(10,3) NOT NULL", true},
+		{"total", "int(11) GENERATED ALWAYS AS (`price`) VIRTUAL", false},
+	} {
+		defs := map[string]string{
+			"id":    "bigint(20) unsigned NOT NULL",
+			"name":  "varchar(64) DEFAULT NULL",
+			"kind":  "enum('a','b') DEFAULT NULL",
+			"price": "decimal(10,2) NOT NULL",
+			"total": "int(11) NOT NULL",
+		}
+		defs[tc.column] = tc.def
+		var lines []string
+		for _, c := range []string{"id", "name", "kind", "price", "total"} {
+			lines = append(lines, "`"+c+"` "+defs[c])
+		}
+		to := showCreateTable(append(lines, "PRIMARY KEY (`id`)", ") ENGINE=InnoDB DEFAULT CHARSET=utf8")...)
+
+		if _, err := AlterTableStatements(from, to, AlterOptions{}); err == nil || !strings.Contains(err.Error(), "column "+tc.column) {
+			t.Errorf("changing %v to %v should have been refused, got %v", tc.column, tc.def, err)
+		}
+		if tc.narrowing {
+			if _, err := AlterTableStatements(from, to, AlterOptions{AllowNarrowing: true}); err != nil {
+				t.Errorf("changing %v to %v should have been allowed: %v", tc.column, tc.def, err)
+			}
+		}
+	}
+
+	// a table charset change
+	to := showCreateTable(
+		"`id` bigint(20) unsigned NOT NULL",
+		"`name` varchar(64) DEFAULT NULL",
+		"`kind` enum('a','b') DEFAULT NULL",
+		"`price` decimal(10,2) NOT NULL",
+		"`total` int(11) NOT NULL",
+		"PRIMARY KEY (`id`)",
+		") ENGINE=InnoDB DEFAULT CHARSET=latin1")
+	if _, err := AlterTableStatements(from, to, AlterOptions{}); err == nil || !strings.Contains(err.Error(), "CHARSET") {
+		t.Errorf("changing the table charset should have been refused, got %v", err)
+	}
+
+	// widening is always allowed
+	to = showCreateTable(
+		"`id` bigint(20) unsigned NOT NULL",
+		"`name` varchar(255) DEFAULT NULL",
+		"`kind` enum('a','b','c') DEFAULT NULL",
+		"`price` decimal(12,3) NOT NULL",
+		"`total` bigint(20) NOT NULL",
+		"PRIMARY KEY (`id`)",
+		") ENGINE=InnoDB DEFAULT CHARSET=utf8")
+	if _, err := AlterTableStatements(from, to, AlterOptions{}); err != nil {
+		t.Errorf("widening columns failed: %v", err)
+	}
+
+	view := &TableDefinition{Name: "t", Schema: "CREATE VIEW `t` AS SELECT 1", Type: TableView}
+	if _, err := AlterTableStatements(view, view, AlterOptions{}); err == nil {
+		t.Errorf("altering a view should fail")
+	}
+}
+
+func TestSchemaFixes(t *testing.T) {
+	table := func(name, column string) *TableDefinition {
+		return &TableDefinition{
+			Name:   name,
+			Schema: "CREATE TABLE `" + name + "` (\n  `" + column + "` int(11) NOT NULL\n) ENGINE=InnoDB DEFAULT CHARSET=utf8",
+			Type:   TableBaseTable,
+		}
+	}
+	from := &SchemaDefinition{TableDefinitions: []*TableDefinition{table("altered", "a"), table("extra", "a"), view1}}
+	to := &SchemaDefinition{TableDefinitions: []*TableDefinition{table("altered", "b"), table("missing", "a"), view1}}
+
+	er := concurrency.AllErrorRecorder{}
+	got := SchemaFixes(from, to, AlterOptions{}, &er)
+	if er.HasErrors() {
+		t.Fatalf("SchemaFixes failed: %v", er.Error())
+	}
+	want := []string{
+		"DROP TABLE `extra`",
+		"ALTER TABLE `altered`\n  DROP COLUMN `a`,\n  ADD COLUMN `b` int(11) NOT NULL FIRST",
+		table("missing", "a").Schema,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("SchemaFixes returned:\n%v\nwant:\n%v", strings.Join(got, ";\n"), strings.Join(want, ";\n"))
+	}
+
+	// the tables that can't be altered are reported
+	to.TableDefinitions[0] = &TableDefinition{Name: "altered", Schema: "not a table schema", Type: TableBaseTable}
+	er = concurrency.AllErrorRecorder{}
+	if got := SchemaFixes(from, to, AlterOptions{}, &er); len(got) != 2 || !er.HasErrors() {
+		t.Errorf("SchemaFixes with an invalid schema returned %v, %v", got, er.Error())
+	}
+}
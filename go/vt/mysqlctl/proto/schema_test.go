@@ -237,6 +237,88 @@ func TestSchemaDiff(t *testing.T) {
 
 	sd2.TableDefinitions = append(sd2.TableDefinitions, &TableDefinition{Name: "table2", Schema: "schema3", Type: TableBaseTable})
 	testDiff(t, sd1, sd2, "sd1", "sd2", []string{"sd1 and sd2 disagree on schema for table table2:\nschema2\n differs from:\nschema3"})
+
+	// primary key changes are reported on their own
+	sd1.TableDefinitions[1].PrimaryKeyColumns = []string{"id"}
+	sd2.TableDefinitions[1].PrimaryKeyColumns = []string{"id", "keyspace_id"}
+	testDiff(t, sd1, sd2, "sd1", "sd2", []string{
+		"sd1 and sd2 disagree on primary key columns for table table2:\n[id]\n differs from:\n[id keyspace_id]",
+		"sd1 and sd2 disagree on schema for table table2:\nschema2\n differs from:\nschema3",
+	})
+}
+
+func TestDiffSchemaSummary(t *testing.T) {
+	left := &SchemaDefinition{
+		DatabaseSchema: "CREATE DATABASE {{.DatabaseName}}",
+		TableDefinitions: []*TableDefinition{
+			&TableDefinition{Name: "columns", Schema: "schema", Columns: []string{"id", "msg"}, Type: TableBaseTable},
+			&TableDefinition{Name: "missing", Schema: "schema", Type: TableBaseTable},
+			&TableDefinition{Name: "pk", Schema: "schema", PrimaryKeyColumns: []string{"id"}, Type: TableBaseTable},
+			&TableDefinition{Name: "same", Schema: "schema", Type: TableBaseTable},
+			&TableDefinition{Name: "schema", Schema: "schema", Type: TableBaseTable},
+			&TableDefinition{Name: "type", Schema: "schema", Type: TableBaseTable},
+		},
+	}
+	right := &SchemaDefinition{
+		DatabaseSchema: "CREATE DATABASE {{.DatabaseName}}",
+		TableDefinitions: []*TableDefinition{
+			&TableDefinition{Name: "columns", Schema: "other schema", Columns: []string{"id"}, Type: TableBaseTable},
+			&TableDefinition{Name: "pk", Schema: "schema", PrimaryKeyColumns: []string{"id", "msg"}, Type: TableBaseTable},
+			&TableDefinition{Name: "same", Schema: "schema", Type: TableBaseTable},
+			&TableDefinition{Name: "schema", Schema: "other schema", Type: TableBaseTable},
+			&TableDefinition{Name: "type", Schema: "schema", Type: TableView},
+			&TableDefinition{Name: "view", Schema: "schema", Type: TableView},
+		},
+	}
+	want := []string{
+		"columns (column count differs)",
+		"missing (missing table)",
+		"pk (primary key differs)",
+		"schema (schema differs)",
+		"type (type differs)",
+		"view (extra view)",
+	}
+	if got := DiffSchemaSummary(left, right); !reflect.DeepEqual(got, want) {
+		t.Errorf("DiffSchemaSummary = %#v, want %#v", got, want)
+	}
+
+	if got := DiffSchemaSummary(left, left); len(got) != 0 {
+		t.Errorf("DiffSchemaSummary of the same schema = %#v", got)
+	}
+	if got := DiffSchemaSummary(left, nil); !reflect.DeepEqual(got, []string{"schema (missing)"}) {
+		t.Errorf("DiffSchemaSummary with a nil schema = %#v", got)
+	}
+}
+
+func TestGenerateSchemaVersionIgnoresSizes(t *testing.T) {
+	sd := &SchemaDefinition{
+		TableDefinitions: []*TableDefinition{
+			&TableDefinition{
+				Name:        "table1",
+				Schema:      "schema1",
+				Type:        TableBaseTable,
+				DataLength:  1024,
+				IndexLength: 512,
+				RowCount:    10,
+			},
+		},
+	}
+	sd.GenerateSchemaVersion()
+	version := sd.Version
+
+	sd.TableDefinitions[0].DataLength = 4096
+	sd.TableDefinitions[0].IndexLength = 2048
+	sd.TableDefinitions[0].RowCount = 100
+	sd.GenerateSchemaVersion()
+	if sd.Version != version {
+		t.Errorf("schema version changed with the table sizes: %v != %v", sd.Version, version)
+	}
+
+	sd.TableDefinitions[0].Schema = "schema2"
+	sd.GenerateSchemaVersion()
+	if sd.Version == version {
+		t.Errorf("schema version didn't change with the schema: %v", sd.Version)
+	}
 }
 
 func TestFilterTables(t *testing.T) {
@@ -14,10 +14,22 @@ import (
 	"fmt"
 	"time"
 
+	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/sqldb"
 	"github.com/youtube/vitess/go/vt/mysqlctl/proto"
 	"golang.org/x/net/context"
 )
 
+const (
+	// sqlSetSuperReadOnly is the statement used to make a master
+	// read-only, even for users with the SUPER privilege.
+	sqlSetSuperReadOnly = "SET GLOBAL super_read_only = ON"
+
+	// errUnknownSystemVariable is ER_UNKNOWN_SYSTEM_VARIABLE, returned
+	// by servers that don't support super_read_only.
+	errUnknownSystemVariable = 1193
+)
+
 // CreateReparentJournal returns the commands to execute to create
 // the _vt.reparent_journal table. It is safe to run these commands
 // even if the table already exists.
@@ -69,9 +81,19 @@ func (mysqld *Mysqld) WaitForReparentJournal(ctx context.Context, timeCreatedNS
 }
 
 // DemoteMaster will gracefully demote a master mysql instance to read only.
-// If the master is still alive, then we need to demote it gracefully
-// make it read-only, flush the writes and get the position
+// If the master is still alive, then we need to demote it gracefully:
+// make it super read-only (or just read-only if super_read_only is not
+// supported), kill the remaining write connections, flush the writes and
+// get the position. All of this is done in one call, so no write can
+// sneak in between the time we go read-only and the time we read the
+// position.
 func (mysqld *Mysqld) DemoteMaster() (rp proto.ReplicationPosition, err error) {
+	if err = mysqld.setSuperReadOnly(); err != nil {
+		return rp, err
+	}
+	if err = mysqld.killWriteConnections(); err != nil {
+		return rp, err
+	}
 	cmds := []string{
 		"FLUSH TABLES WITH READ LOCK",
 		"UNLOCK TABLES",
@@ -82,6 +104,46 @@ func (mysqld *Mysqld) DemoteMaster() (rp proto.ReplicationPosition, err error) {
 	return mysqld.MasterPosition()
 }
 
+// setSuperReadOnly sets super_read_only, which also blocks writes from
+// users with the SUPER privilege. If the server doesn't know about
+// super_read_only (MySQL < 5.7.8, MariaDB), it falls back to read_only.
+func (mysqld *Mysqld) setSuperReadOnly() error {
+	conn, err := mysqld.dbaPool.Get(0)
+	if err != nil {
+		return err
+	}
+	defer conn.Recycle()
+
+	log.Infof("exec %v", sqlSetSuperReadOnly)
+	_, err = conn.ExecuteFetch(sqlSetSuperReadOnly, 1, false)
+	if err == nil {
+		return nil
+	}
+	if sqlErr, ok := err.(*sqldb.SqlError); !ok || sqlErr.Number() != errUnknownSystemVariable {
+		return fmt.Errorf("ExecuteFetch(%v) failed: %v", sqlSetSuperReadOnly, err)
+	}
+	log.Infof("super_read_only is not supported, falling back to read_only")
+	return mysqld.SetReadOnly(true)
+}
+
+// killWriteConnections kills all the client connections that could still
+// be writing to the database: everything except our own dba connections,
+// the replication threads and the system threads.
+func (mysqld *Mysqld) killWriteConnections() error {
+	qr, err := mysqld.FetchSuperQuery(fmt.Sprintf("SELECT ID FROM information_schema.PROCESSLIST WHERE USER NOT IN ('system user', 'event_scheduler', '%v') AND COMMAND NOT IN ('Binlog Dump', 'Binlog Dump GTID', 'Daemon')", mysqld.dba.Uname))
+	if err != nil {
+		return err
+	}
+	for _, row := range qr.Rows {
+		id := row[0].String()
+		// The connection may already be gone, that's fine.
+		if err := mysqld.ExecuteSuperQuery("KILL " + id); err != nil {
+			log.Warningf("failed to kill connection %v: %v", id, err)
+		}
+	}
+	return nil
+}
+
 // PromoteSlave will promote a slave to be the new master.
 func (mysqld *Mysqld) PromoteSlave(hookExtraEnv map[string]string) (proto.ReplicationPosition, error) {
 	// we handle replication, just stop it
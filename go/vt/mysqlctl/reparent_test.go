@@ -0,0 +1,88 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mysqlctl
+
+import (
+	"fmt"
+	"testing"
+
+	mproto "github.com/youtube/vitess/go/mysql/proto"
+	"github.com/youtube/vitess/go/sqldb"
+	"github.com/youtube/vitess/go/sqltypes"
+	"github.com/youtube/vitess/go/vt/vttest/fakesqldb"
+)
+
+const sqlSetReadOnly = "SET GLOBAL read_only = ON"
+
+func newFakeSqlDBMysqld() (*Mysqld, *fakesqldb.DB) {
+	db := fakesqldb.Register()
+	cnf := &Mycnf{tabletDir: "/tmp/vt_test", snapshotDir: "/tmp/vt_test/snapshot"}
+	dba := &sqldb.ConnParams{Uname: "vt_dba_test"}
+	return NewMysqld("", "", cnf, dba, &sqldb.ConnParams{}, &sqldb.ConnParams{}), db
+}
+
+func TestSetSuperReadOnly(t *testing.T) {
+	mysqld, db := newFakeSqlDBMysqld()
+	defer mysqld.Close()
+	if err := mysqld.setSuperReadOnly(); err != nil {
+		t.Fatalf("setSuperReadOnly failed: %v", err)
+	}
+	if got := db.GetQueryCalledNum(sqlSetSuperReadOnly); got != 1 {
+		t.Errorf("super_read_only was set %v times, want 1", got)
+	}
+	if got := db.GetQueryCalledNum(sqlSetReadOnly); got != 0 {
+		t.Errorf("read_only was set %v times with super_read_only supported, want 0", got)
+	}
+}
+
+func TestSetSuperReadOnlyFallback(t *testing.T) {
+	mysqld, db := newFakeSqlDBMysqld()
+	defer mysqld.Close()
+	db.AddRejectedQueryError(sqlSetSuperReadOnly, sqldb.NewSqlError(errUnknownSystemVariable, "Unknown system variable 'super_read_only'"))
+	if err := mysqld.setSuperReadOnly(); err != nil {
+		t.Fatalf("setSuperReadOnly failed: %v", err)
+	}
+	if got := db.GetQueryCalledNum(sqlSetReadOnly); got != 1 {
+		t.Errorf("read_only was set %v times, want 1", got)
+	}
+}
+
+func TestSetSuperReadOnlyError(t *testing.T) {
+	mysqld, db := newFakeSqlDBMysqld()
+	defer mysqld.Close()
+	// any other error is returned, and doesn't fall back to read_only
+	db.AddRejectedQueryError(sqlSetSuperReadOnly, sqldb.NewSqlError(1227, "Access denied"))
+	if err := mysqld.setSuperReadOnly(); err == nil {
+		t.Errorf("setSuperReadOnly should have failed")
+	}
+	if got := db.GetQueryCalledNum(sqlSetReadOnly); got != 0 {
+		t.Errorf("read_only was set %v times, want 0", got)
+	}
+}
+
+func TestKillWriteConnections(t *testing.T) {
+	mysqld, db := newFakeSqlDBMysqld()
+	defer mysqld.Close()
+	db.AddQuery("SELECT ID FROM information_schema.PROCESSLIST WHERE USER NOT IN ('system user', 'event_scheduler', 'vt_dba_test') AND COMMAND NOT IN ('Binlog Dump', 'Binlog Dump GTID', 'Daemon')", &mproto.QueryResult{
+		RowsAffected: 2,
+		Rows: [][]sqltypes.Value{
+			{sqltypes.MakeString([]byte("5"))},
+			{sqltypes.MakeString([]byte("6"))},
+		},
+	})
+	// a connection that is already gone doesn't fail the kills
+	db.AddRejectedQueryError("KILL 5", sqldb.NewSqlError(1094, "Unknown thread id: 5"))
+	if err := mysqld.killWriteConnections(); err != nil {
+		t.Fatalf("killWriteConnections failed: %v", err)
+	}
+	if got := db.GetQueryCalledNum("KILL 6"); got != 1 {
+		t.Errorf("connection 6 was killed %v times, want 1", got)
+	}
+
+	db.AddRejectedQueryError("SELECT ID FROM information_schema.PROCESSLIST WHERE USER NOT IN ('system user', 'event_scheduler', 'vt_dba_test') AND COMMAND NOT IN ('Binlog Dump', 'Binlog Dump GTID', 'Daemon')", fmt.Errorf("processlist error"))
+	if err := mysqld.killWriteConnections(); err == nil {
+		t.Errorf("killWriteConnections should fail when the processlist cannot be read")
+	}
+}
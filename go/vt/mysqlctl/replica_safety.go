@@ -0,0 +1,123 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mysqlctl
+
+import (
+	"fmt"
+	"strings"
+
+	log "github.com/golang/glog"
+	"golang.org/x/net/context"
+)
+
+// replicaSafetySetting is a server variable a replica needs to survive
+// a crash without losing or corrupting data.
+type replicaSafetySetting struct {
+	name  string
+	value string
+
+	// dynamic settings are set by ApplyReplicaSafetySettings, the
+	// other ones need a restart and are only verified.
+	dynamic bool
+}
+
+// replicaSafetySettings are the recommended settings for replicas.
+// The variables a flavor doesn't have are skipped.
+var replicaSafetySettings = []replicaSafetySetting{
+	{"sync_binlog", "1", true},
+	{"innodb_flush_log_at_trx_commit", "1", true},
+	{"read_only", "ON", true},
+	{"relay_log_recovery", "ON", false},
+	{"relay_log_info_repository", "TABLE", false},
+}
+
+// ReplicaSafetyMismatch is a server variable that doesn't have its
+// recommended value after ApplyReplicaSafetySettings.
+type ReplicaSafetyMismatch struct {
+	Name     string
+	Value    string
+	Expected string
+}
+
+// String is part of the fmt.Stringer interface.
+func (rsm ReplicaSafetyMismatch) String() string {
+	return fmt.Sprintf("%v=%v (expected %v)", rsm.Name, rsm.Value, rsm.Expected)
+}
+
+// sameVariableValue compares two values of a server variable, the
+// booleans can be displayed as ON or 1.
+func sameVariableValue(a, b string) bool {
+	normalize := func(v string) string {
+		switch v = strings.ToUpper(v); v {
+		case "1":
+			return "ON"
+		case "0":
+			return "OFF"
+		}
+		return v
+	}
+	return normalize(a) == normalize(b)
+}
+
+// globalVariables returns the current values of the given global
+// variables. The unknown ones are not in the result.
+func (mysqld *Mysqld) globalVariables(names []string) (map[string]string, error) {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = "'" + name + "'"
+	}
+	qr, err := mysqld.FetchSuperQuery(fmt.Sprintf("SHOW GLOBAL VARIABLES WHERE Variable_name IN (%v)", strings.Join(quoted, ", ")))
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]string, len(qr.Rows))
+	for _, row := range qr.Rows {
+		if len(row) != 2 {
+			return nil, fmt.Errorf("unexpected row for SHOW GLOBAL VARIABLES: %v", row)
+		}
+		result[row[0].String()] = row[1].String()
+	}
+	return result, nil
+}
+
+// ApplyReplicaSafetySettings sets the recommended dynamic variables
+// for a replica, and verifies the ones that can only be set in the
+// configuration file. The variables that still don't have their
+// recommended value are returned, they are not an error.
+func (mysqld *Mysqld) ApplyReplicaSafetySettings(ctx context.Context) ([]ReplicaSafetyMismatch, error) {
+	names := make([]string, len(replicaSafetySettings))
+	for i, s := range replicaSafetySettings {
+		names[i] = s.name
+	}
+	values, err := mysqld.globalVariables(names)
+	if err != nil {
+		return nil, err
+	}
+
+	var mismatches []ReplicaSafetyMismatch
+	for _, s := range replicaSafetySettings {
+		value, ok := values[s.name]
+		if !ok || sameVariableValue(value, s.value) {
+			continue
+		}
+		if s.dynamic {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			log.Infof("Setting %v to %v for a replica, was %v", s.name, s.value, value)
+			err := mysqld.ExecuteSuperQuery(fmt.Sprintf("SET GLOBAL %v = %v", s.name, s.value))
+			if err == nil {
+				continue
+			}
+			log.Warningf("Cannot set %v: %v", s.name, err)
+		}
+		mismatches = append(mismatches, ReplicaSafetyMismatch{
+			Name:     s.name,
+			Value:    value,
+			Expected: s.value,
+		})
+	}
+	return mismatches, nil
+}
@@ -0,0 +1,27 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mysqlctl
+
+import "testing"
+
+func TestSameVariableValue(t *testing.T) {
+	for _, tc := range []struct {
+		a, b string
+		want bool
+	}{
+		{"ON", "ON", true},
+		{"1", "ON", true},
+		{"on", "1", true},
+		{"0", "OFF", true},
+		{"OFF", "ON", false},
+		{"TABLE", "table", true},
+		{"FILE", "TABLE", false},
+		{"100", "1", false},
+	} {
+		if got := sameVariableValue(tc.a, tc.b); got != tc.want {
+			t.Errorf("sameVariableValue(%v, %v) = %v, want %v", tc.a, tc.b, got, tc.want)
+		}
+	}
+}
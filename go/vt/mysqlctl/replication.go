@@ -52,8 +52,12 @@ func changeMasterArgs(params *sqldb.ConnParams, masterHost string, masterPort in
 	args = append(args, fmt.Sprintf("MASTER_USER = '%s'", params.Uname))
 	args = append(args, fmt.Sprintf("MASTER_PASSWORD = '%s'", params.Pass))
 	args = append(args, fmt.Sprintf("MASTER_CONNECT_RETRY = %d", masterConnectRetry))
+	if *masterHeartbeatPeriod > 0 {
+		args = append(args, fmt.Sprintf("MASTER_HEARTBEAT_PERIOD = %v", strconv.FormatFloat(masterHeartbeatPeriod.Seconds(), 'f', 3, 64)))
+	}
 
-	if mysql.SslEnabled(params) {
+	// setting any of the certificates is enough to use SSL
+	if mysql.SslEnabled(params) || params.SslCa != "" || params.SslCaPath != "" || params.SslCert != "" || params.SslKey != "" {
 		args = append(args, "MASTER_SSL = 1")
 	}
 	if params.SslCa != "" {
@@ -84,6 +88,10 @@ func parseSlaveStatus(fields map[string]string) proto.ReplicationStatus {
 	status.MasterConnectRetry = int(parseInt)
 	parseUint, _ := strconv.ParseUint(fields["Seconds_Behind_Master"], 10, 0)
 	status.SecondsBehindMaster = uint(parseUint)
+	parseInt, _ = strconv.ParseInt(fields["Last_IO_Errno"], 10, 0)
+	status.LastIOErrno = int(parseInt)
+	parseInt, _ = strconv.ParseInt(fields["Last_SQL_Errno"], 10, 0)
+	status.LastSQLErrno = int(parseInt)
 	return status
 }
 
@@ -217,13 +225,15 @@ func (mysqld *Mysqld) MasterPosition() (rp proto.ReplicationPosition, err error)
 // StartReplicationCommands returns the commands used to start
 // replication to the provided master using the provided starting
 // position.  The provided MasterConnectRetry will be ignored and
-// replaced by the command line parameter.
-func (mysqld *Mysqld) StartReplicationCommands(status *proto.ReplicationStatus) ([]string, error) {
+// replaced by the command line parameter. The replication credentials
+// can be specific to the keyspace and shard, see
+// dbconfigs.ShardMysqlParams.
+func (mysqld *Mysqld) StartReplicationCommands(keyspace, shard string, status *proto.ReplicationStatus) ([]string, error) {
 	flavor, err := mysqld.flavor()
 	if err != nil {
 		return nil, fmt.Errorf("StartReplicationCommands needs flavor: %v", err)
 	}
-	params, err := dbconfigs.MysqlParams(mysqld.replParams)
+	params, err := dbconfigs.ShardMysqlParams(mysqld.replParams, keyspace, shard)
 	if err != nil {
 		return nil, err
 	}
@@ -232,13 +242,13 @@ func (mysqld *Mysqld) StartReplicationCommands(status *proto.ReplicationStatus)
 }
 
 // SetMasterCommands returns the commands to run to make the provided
-// host / port the master.
-func (mysqld *Mysqld) SetMasterCommands(masterHost string, masterPort int) ([]string, error) {
+// host / port the master of the keyspace and shard.
+func (mysqld *Mysqld) SetMasterCommands(keyspace, shard, masterHost string, masterPort int) ([]string, error) {
 	flavor, err := mysqld.flavor()
 	if err != nil {
 		return nil, fmt.Errorf("SetMasterCommands needs flavor: %v", err)
 	}
-	params, err := dbconfigs.MysqlParams(mysqld.replParams)
+	params, err := dbconfigs.ShardMysqlParams(mysqld.replParams, keyspace, shard)
 	if err != nil {
 		return nil, err
 	}
@@ -298,8 +308,8 @@ func (mysqld *Mysqld) FindSlaves() ([]string, error) {
 }
 
 // WaitBlpPosition will wait for the filtered replication to reach at least
-// the provided position.
-func (mysqld *Mysqld) WaitBlpPosition(bp *blproto.BlpPosition, waitTimeout time.Duration) error {
+// the provided position, as read from the blp_checkpoint table of mysqld.
+func WaitBlpPosition(mysqld MysqlDaemon, bp *blproto.BlpPosition, waitTimeout time.Duration) error {
 	timeOut := time.Now().Add(waitTimeout)
 	for {
 		if time.Now().After(timeOut) {
@@ -332,6 +342,16 @@ func (mysqld *Mysqld) WaitBlpPosition(bp *blproto.BlpPosition, waitTimeout time.
 	return fmt.Errorf("WaitBlpPosition(%v) timed out", bp.Uid)
 }
 
+// ReadBlpCheckpoints returns the content of the blp_checkpoint table of
+// mysqld.
+func ReadBlpCheckpoints(mysqld MysqlDaemon) (*blproto.BlpCheckpointList, error) {
+	qr, err := mysqld.FetchSuperQuery(binlogplayer.QueryBlpCheckpoints())
+	if err != nil {
+		return nil, err
+	}
+	return binlogplayer.ParseBlpCheckpoints(qr)
+}
+
 // EnableBinlogPlayback prepares the server to play back events from a binlog stream.
 // Whatever it does for a given flavor, it must be idempotent.
 func (mysqld *Mysqld) EnableBinlogPlayback() error {
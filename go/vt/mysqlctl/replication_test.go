@@ -5,7 +5,12 @@
 package mysqlctl
 
 import (
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/youtube/vitess/go/mysql"
+	"github.com/youtube/vitess/go/sqldb"
 )
 
 func testRedacted(t *testing.T, source, expected string) {
@@ -44,3 +49,89 @@ func TestRedactMasterPassword(t *testing.T) {
   MASTER_PASSWORD = 'AAA`, `CHANGE MASTER TO
   MASTER_PASSWORD = 'AAA`)
 }
+
+func TestChangeMasterArgs(t *testing.T) {
+	oldHeartbeat := *masterHeartbeatPeriod
+	defer func() { *masterHeartbeatPeriod = oldHeartbeat }()
+
+	sslFlags := &sqldb.ConnParams{Uname: "vt_repl", Pass: "pass"}
+	mysql.EnableSSL(sslFlags)
+	testCases := []struct {
+		name      string
+		params    *sqldb.ConnParams
+		heartbeat time.Duration
+		want      string
+	}{
+		{
+			name:   "no ssl",
+			params: &sqldb.ConnParams{Uname: "vt_repl", Pass: "pass"},
+			want: `MASTER_HOST = 'localhost',
+MASTER_PORT = 123,
+MASTER_USER = 'vt_repl',
+MASTER_PASSWORD = 'pass',
+MASTER_CONNECT_RETRY = 10`,
+		},
+		{
+			name:      "heartbeat",
+			params:    &sqldb.ConnParams{Uname: "vt_repl", Pass: "pass"},
+			heartbeat: 1500 * time.Millisecond,
+			want: `MASTER_HOST = 'localhost',
+MASTER_PORT = 123,
+MASTER_USER = 'vt_repl',
+MASTER_PASSWORD = 'pass',
+MASTER_CONNECT_RETRY = 10,
+MASTER_HEARTBEAT_PERIOD = 1.500`,
+		},
+		{
+			name:   "ssl flag only",
+			params: sslFlags,
+			want: `MASTER_HOST = 'localhost',
+MASTER_PORT = 123,
+MASTER_USER = 'vt_repl',
+MASTER_PASSWORD = 'pass',
+MASTER_CONNECT_RETRY = 10,
+MASTER_SSL = 1`,
+		},
+		{
+			name:   "ssl ca without the ssl flag",
+			params: &sqldb.ConnParams{Uname: "vt_repl", Pass: "pass", SslCa: "ssl-ca"},
+			want: `MASTER_HOST = 'localhost',
+MASTER_PORT = 123,
+MASTER_USER = 'vt_repl',
+MASTER_PASSWORD = 'pass',
+MASTER_CONNECT_RETRY = 10,
+MASTER_SSL = 1,
+MASTER_SSL_CA = 'ssl-ca'`,
+		},
+		{
+			name: "all ssl options and heartbeat",
+			params: &sqldb.ConnParams{
+				Uname:     "vt_repl",
+				Pass:      "pass",
+				SslCa:     "ssl-ca",
+				SslCaPath: "ssl-ca-path",
+				SslCert:   "ssl-cert",
+				SslKey:    "ssl-key",
+			},
+			heartbeat: 2 * time.Second,
+			want: `MASTER_HOST = 'localhost',
+MASTER_PORT = 123,
+MASTER_USER = 'vt_repl',
+MASTER_PASSWORD = 'pass',
+MASTER_CONNECT_RETRY = 10,
+MASTER_HEARTBEAT_PERIOD = 2.000,
+MASTER_SSL = 1,
+MASTER_SSL_CA = 'ssl-ca',
+MASTER_SSL_CAPATH = 'ssl-ca-path',
+MASTER_SSL_CERT = 'ssl-cert',
+MASTER_SSL_KEY = 'ssl-key'`,
+		},
+	}
+	for _, tc := range testCases {
+		*masterHeartbeatPeriod = tc.heartbeat
+		got := strings.Join(changeMasterArgs(tc.params, "localhost", 123, 10), ",\n")
+		if got != tc.want {
+			t.Errorf("%v: got:\n%v\nwant:\n%v", tc.name, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,488 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package s3backupstorage implements the BackupStorage interface for
+// Amazon S3, and for the storages that have a compatible API.
+//
+// A backup is stored under <root>/<bucket>/<name>/ in the S3 bucket,
+// one object per file. The files are uploaded in parts, so they don't
+// need to be buffered entirely.
+package s3backupstorage
+
+import (
+	"bytes"
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/youtube/vitess/go/vt/mysqlctl/backupstorage"
+)
+
+// minPartSize is the minimum size of the parts of a multipart upload,
+// except the last one.
+const minPartSize = 5 * 1024 * 1024
+
+var (
+	s3Region   = flag.String("s3_backup_aws_region", "us-east-1", "AWS region of the S3 bucket for the s3 backup storage")
+	s3Endpoint = flag.String("s3_backup_aws_endpoint", "", "endpoint of the S3 service for the s3 backup storage, if not the AWS one of -s3_backup_aws_region")
+	s3Bucket   = flag.String("s3_backup_storage_bucket", "", "S3 bucket of the s3 backup storage")
+	s3Root     = flag.String("s3_backup_storage_root", "", "prefix of the objects of the s3 backup storage in the bucket")
+	s3PartSize = flag.Int("s3_backup_part_size", 16*1024*1024, "size in bytes of the parts the files of the s3 backup storage are uploaded in (5MB minimum)")
+)
+
+// Config describes where the backups are stored, and how to
+// authenticate.
+type Config struct {
+	// Endpoint is the URL of the service, like
+	// https://s3.amazonaws.com. Objects are addressed with paths,
+	// as <Endpoint>/<Bucket>/<key>.
+	Endpoint string
+
+	// Region is the region used to sign the requests.
+	Region string
+
+	// Bucket is the bucket of the service, not the backup bucket.
+	Bucket string
+
+	// Root is the prefix of all the objects.
+	Root string
+
+	// AccessKey, SecretKey and SessionToken are the credentials.
+	// SessionToken is only used with temporary credentials.
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+
+	// PartSize is the size of the parts files are uploaded in.
+	PartSize int
+}
+
+// flagsConfig returns the configuration from the flags, and the
+// standard AWS environment variables for the credentials.
+func flagsConfig() (*Config, error) {
+	if *s3Bucket == "" {
+		return nil, fmt.Errorf("-s3_backup_storage_bucket is required by the s3 backup storage")
+	}
+	if *s3PartSize < minPartSize {
+		return nil, fmt.Errorf("-s3_backup_part_size cannot be less than %v", minPartSize)
+	}
+	endpoint := *s3Endpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://s3.%v.amazonaws.com", *s3Region)
+		if *s3Region == "us-east-1" {
+			endpoint = "https://s3.amazonaws.com"
+		}
+	}
+	return &Config{
+		Endpoint:     endpoint,
+		Region:       *s3Region,
+		Bucket:       *s3Bucket,
+		Root:         *s3Root,
+		AccessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+		PartSize:     *s3PartSize,
+	}, nil
+}
+
+// S3BackupStorage implements BackupStorage for S3.
+type S3BackupStorage struct {
+	// getConfig is called for every operation, as the flags are
+	// parsed after the storage is registered.
+	getConfig func() (*Config, error)
+	client    *http.Client
+}
+
+// NewBackupStorage returns a BackupStorage using the configuration
+// returned by getConfig. Other storages with an S3 compatible API
+// register themselves with it.
+func NewBackupStorage(getConfig func() (*Config, error)) *S3BackupStorage {
+	return &S3BackupStorage{
+		getConfig: getConfig,
+		client:    http.DefaultClient,
+	}
+}
+
+// objectKey returns the key of an object of a backup.
+func objectKey(c *Config, parts ...string) string {
+	return path.Join(append([]string{c.Root}, parts...)...)
+}
+
+// do sends a signed request for key, and returns the response if it
+// has the expected status. The body is closed otherwise.
+func (sbs *S3BackupStorage) do(c *Config, method, key string, query url.Values, body []byte, expectedStatus int) (*http.Response, error) {
+	req, err := http.NewRequest(method, strings.TrimRight(c.Endpoint, "/"), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	// the path is sent encoded the same way it is signed
+	req.URL.Path += "/" + c.Bucket
+	if key != "" {
+		req.URL.Path += "/" + key
+	}
+	req.URL.RawPath = uriEncode(req.URL.Path, false)
+	req.URL.RawQuery = canonicalQuery(query)
+	signRequest(req, c, payloadHash(body), time.Now())
+
+	resp, err := sbs.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != expectedStatus {
+		data, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		return nil, fmt.Errorf("%v %v failed: %v: %s", method, key, resp.Status, data)
+	}
+	return resp, nil
+}
+
+// doAndDecode sends a request, and decodes the XML response into
+// result.
+func (sbs *S3BackupStorage) doAndDecode(c *Config, method, key string, query url.Values, body []byte, result interface{}) error {
+	resp, err := sbs.do(c, method, key, query, body, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := xml.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("cannot decode the response of %v %v: %v", method, key, err)
+	}
+	return nil
+}
+
+// listBucketResult is the response to a ListObjectsV2 request.
+type listBucketResult struct {
+	Contents []struct {
+		Key string
+	}
+	CommonPrefixes []struct {
+		Prefix string
+	}
+	IsTruncated           bool
+	NextContinuationToken string
+}
+
+// list returns the keys and the common prefixes under prefix.
+func (sbs *S3BackupStorage) list(c *Config, prefix, delimiter string) ([]string, []string, error) {
+	var keys, prefixes []string
+	token := ""
+	for {
+		query := url.Values{
+			"list-type": []string{"2"},
+			"prefix":    []string{prefix},
+		}
+		if delimiter != "" {
+			query.Set("delimiter", delimiter)
+		}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		var result listBucketResult
+		if err := sbs.doAndDecode(c, "GET", "", query, nil, &result); err != nil {
+			return nil, nil, err
+		}
+		for _, o := range result.Contents {
+			keys = append(keys, o.Key)
+		}
+		for _, p := range result.CommonPrefixes {
+			prefixes = append(prefixes, p.Prefix)
+		}
+		if !result.IsTruncated {
+			return keys, prefixes, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+// ListBackups is part of the BackupStorage interface
+func (sbs *S3BackupStorage) ListBackups(bucket string) ([]backupstorage.BackupHandle, error) {
+	c, err := sbs.getConfig()
+	if err != nil {
+		return nil, err
+	}
+	prefix := objectKey(c, bucket) + "/"
+	_, prefixes, err := sbs.list(c, prefix, "/")
+	if err != nil {
+		return nil, err
+	}
+	result := make([]backupstorage.BackupHandle, 0, len(prefixes))
+	for _, p := range prefixes {
+		result = append(result, &S3BackupHandle{
+			sbs:      sbs,
+			config:   c,
+			bucket:   bucket,
+			name:     strings.TrimSuffix(strings.TrimPrefix(p, prefix), "/"),
+			readOnly: true,
+		})
+	}
+	backupstorage.SortBackups(result)
+	return result, nil
+}
+
+// StartBackup is part of the BackupStorage interface
+func (sbs *S3BackupStorage) StartBackup(bucket, name string) (backupstorage.BackupHandle, error) {
+	c, err := sbs.getConfig()
+	if err != nil {
+		return nil, err
+	}
+	keys, _, err := sbs.list(c, objectKey(c, bucket, name)+"/", "")
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) > 0 {
+		return nil, fmt.Errorf("backup %v/%v already exists", bucket, name)
+	}
+	return &S3BackupHandle{
+		sbs:    sbs,
+		config: c,
+		bucket: bucket,
+		name:   name,
+	}, nil
+}
+
+// RemoveBackup is part of the BackupStorage interface
+func (sbs *S3BackupStorage) RemoveBackup(bucket, name string) error {
+	c, err := sbs.getConfig()
+	if err != nil {
+		return err
+	}
+	keys, _, err := sbs.list(c, objectKey(c, bucket, name)+"/", "")
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		resp, err := sbs.do(c, "DELETE", key, nil, nil, http.StatusNoContent)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+	}
+	return nil
+}
+
+// S3BackupHandle implements BackupHandle for S3.
+type S3BackupHandle struct {
+	sbs      *S3BackupStorage
+	config   *Config
+	bucket   string
+	name     string
+	readOnly bool
+
+	// mu protects errs, the errors of the files being uploaded
+	mu   sync.Mutex
+	errs []string
+}
+
+// Bucket is part of the BackupHandle interface
+func (bh *S3BackupHandle) Bucket() string {
+	return bh.bucket
+}
+
+// Name is part of the BackupHandle interface
+func (bh *S3BackupHandle) Name() string {
+	return bh.name
+}
+
+// AddFile is part of the BackupHandle interface
+func (bh *S3BackupHandle) AddFile(filename string) (io.WriteCloser, error) {
+	if bh.readOnly {
+		return nil, fmt.Errorf("AddFile cannot be called on read-only backup")
+	}
+	return &s3Writer{
+		bh:  bh,
+		key: objectKey(bh.config, bh.bucket, bh.name, filename),
+	}, nil
+}
+
+func (bh *S3BackupHandle) recordError(err error) {
+	bh.mu.Lock()
+	bh.errs = append(bh.errs, err.Error())
+	bh.mu.Unlock()
+}
+
+// EndBackup is part of the BackupHandle interface
+func (bh *S3BackupHandle) EndBackup() error {
+	if bh.readOnly {
+		return fmt.Errorf("EndBackup cannot be called on read-only backup")
+	}
+	bh.mu.Lock()
+	defer bh.mu.Unlock()
+	if len(bh.errs) > 0 {
+		return fmt.Errorf("some files failed to upload: %v", strings.Join(bh.errs, ", "))
+	}
+	return nil
+}
+
+// AbortBackup is part of the BackupHandle interface
+func (bh *S3BackupHandle) AbortBackup() error {
+	if bh.readOnly {
+		return fmt.Errorf("AbortBackup cannot be called on read-only backup")
+	}
+	return bh.sbs.RemoveBackup(bh.bucket, bh.name)
+}
+
+// ReadFile is part of the BackupHandle interface
+func (bh *S3BackupHandle) ReadFile(filename string) (io.ReadCloser, error) {
+	if !bh.readOnly {
+		return nil, fmt.Errorf("ReadFile cannot be called on read-write backup")
+	}
+	resp, err := bh.sbs.do(bh.config, "GET", objectKey(bh.config, bh.bucket, bh.name, filename), nil, nil, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// s3Writer uploads a file. Files smaller than a part are uploaded
+// with a single request when closed. Bigger files use a multipart
+// upload, with a part uploaded every time the buffer is full.
+type s3Writer struct {
+	bh  *S3BackupHandle
+	key string
+	buf []byte
+
+	// uploadID and etags are set once the multipart upload has
+	// started.
+	uploadID string
+	etags    []string
+
+	err error
+}
+
+type initiateMultipartUploadResult struct {
+	UploadID string `xml:"UploadId"`
+}
+
+type completeMultipartUpload struct {
+	XMLName xml.Name       `xml:"CompleteMultipartUpload"`
+	Parts   []completePart `xml:"Part"`
+}
+
+type completePart struct {
+	PartNumber int
+	ETag       string
+}
+
+// uploadPart uploads the buffer as the next part.
+func (w *s3Writer) uploadPart() error {
+	c := w.bh.config
+	if w.uploadID == "" {
+		var result initiateMultipartUploadResult
+		if err := w.bh.sbs.doAndDecode(c, "POST", w.key, url.Values{"uploads": []string{""}}, nil, &result); err != nil {
+			return err
+		}
+		w.uploadID = result.UploadID
+	}
+	query := url.Values{
+		"partNumber": []string{fmt.Sprintf("%v", len(w.etags)+1)},
+		"uploadId":   []string{w.uploadID},
+	}
+	resp, err := w.bh.sbs.do(c, "PUT", w.key, query, w.buf, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	w.etags = append(w.etags, resp.Header.Get("ETag"))
+	w.buf = w.buf[:0]
+	return nil
+}
+
+// Write is part of the io.Writer interface
+func (w *s3Writer) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	size := w.bh.config.PartSize
+	written := 0
+	for len(p) > 0 {
+		n := size - len(w.buf)
+		if n > len(p) {
+			n = len(p)
+		}
+		w.buf = append(w.buf, p[:n]...)
+		written += n
+		p = p[n:]
+		if len(w.buf) == size {
+			if w.err = w.uploadPart(); w.err != nil {
+				return written, w.err
+			}
+		}
+	}
+	return written, nil
+}
+
+// Close is part of the io.Closer interface. It finishes the upload.
+func (w *s3Writer) Close() error {
+	if w.err == nil {
+		w.err = w.finish()
+	}
+	if w.err != nil {
+		w.bh.recordError(fmt.Errorf("%v: %v", w.key, w.err))
+		w.abort()
+	}
+	return w.err
+}
+
+func (w *s3Writer) finish() error {
+	c := w.bh.config
+	if w.uploadID == "" {
+		resp, err := w.bh.sbs.do(c, "PUT", w.key, nil, w.buf, http.StatusOK)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		return nil
+	}
+	if len(w.buf) > 0 {
+		if err := w.uploadPart(); err != nil {
+			return err
+		}
+	}
+	complete := completeMultipartUpload{}
+	for i, etag := range w.etags {
+		complete.Parts = append(complete.Parts, completePart{PartNumber: i + 1, ETag: etag})
+	}
+	body, err := xml.Marshal(complete)
+	if err != nil {
+		return err
+	}
+	// the response can be an error even with a 200 status, and
+	// it is then missing the CompleteMultipartUploadResult.
+	var result struct {
+		XMLName xml.Name
+		Message string
+	}
+	if err := w.bh.sbs.doAndDecode(c, "POST", w.key, url.Values{"uploadId": []string{w.uploadID}}, body, &result); err != nil {
+		return err
+	}
+	if result.XMLName.Local != "CompleteMultipartUploadResult" {
+		return fmt.Errorf("cannot complete the upload of %v: %v %v", w.key, result.XMLName.Local, result.Message)
+	}
+	w.uploadID = ""
+	return nil
+}
+
+// abort cleans up a failed multipart upload, if any.
+func (w *s3Writer) abort() {
+	if w.uploadID == "" {
+		return
+	}
+	resp, err := w.bh.sbs.do(w.bh.config, "DELETE", w.key, url.Values{"uploadId": []string{w.uploadID}}, nil, http.StatusNoContent)
+	if err == nil {
+		resp.Body.Close()
+	}
+}
+
+func init() {
+	backupstorage.BackupStorageMap["s3"] = NewBackupStorage(flagsConfig)
+}
@@ -11,6 +11,7 @@ import (
 
 	log "github.com/golang/glog"
 	"github.com/youtube/vitess/go/vt/mysqlctl/proto"
+	"github.com/youtube/vitess/go/vt/sqlparser"
 )
 
 var autoIncr = regexp.MustCompile(" AUTO_INCREMENT=\\d+")
@@ -31,7 +32,7 @@ func (mysqld *Mysqld) GetSchema(dbName string, tables, excludeTables []string, i
 	sd.DatabaseSchema = strings.Replace(qr.Rows[0][1].String(), "`"+dbName+"`", "`{{.DatabaseName}}`", 1)
 
 	// get the list of tables we're interested in
-	sql := "SELECT table_name, table_type, data_length, table_rows FROM information_schema.tables WHERE table_schema = '" + dbName + "'"
+	sql := "SELECT table_name, table_type, data_length, index_length, table_rows FROM information_schema.tables WHERE table_schema = '" + dbName + "'"
 	if !includeViews {
 		sql += " AND table_type = '" + proto.TableBaseTable + "'"
 	}
@@ -58,10 +59,19 @@ func (mysqld *Mysqld) GetSchema(dbName string, tables, excludeTables []string, i
 			}
 		}
 
+		// compute indexLength, also NULL for views
+		var indexLength uint64
+		if !row[3].IsNull() {
+			indexLength, err = row[3].ParseUint64()
+			if err != nil {
+				return nil, err
+			}
+		}
+
 		// get row count
 		var rowCount uint64
-		if !row[3].IsNull() {
-			rowCount, err = row[3].ParseUint64()
+		if !row[4].IsNull() {
+			rowCount, err = row[4].ParseUint64()
 			if err != nil {
 				return nil, err
 			}
@@ -100,6 +110,7 @@ func (mysqld *Mysqld) GetSchema(dbName string, tables, excludeTables []string, i
 		}
 		td.Type = tableType
 		td.DataLength = dataLength
+		td.IndexLength = indexLength
 		td.RowCount = rowCount
 		sd.TableDefinitions = append(sd.TableDefinitions, td)
 	}
@@ -196,52 +207,111 @@ func (mysqld *Mysqld) GetPrimaryKeyColumns(dbName, table string) ([]string, erro
 	return columns, err
 }
 
-// PreflightSchemaChange will apply the schema change to a fake
+// preflightDbName is the scratch database used by PreflightSchemaChange.
+const preflightDbName = "_vt_preflight"
+
+// CopySchemaToDatabase creates a new database named dbName (dropping
+// it first if it exists) and replays the CREATE TABLE statements of
+// the base tables of sd in it. The statements are not replicated.
+func (mysqld *Mysqld) CopySchemaToDatabase(sd *proto.SchemaDefinition, dbName string) error {
+	sql := "SET sql_log_bin = 0;\n"
+	sql += "DROP DATABASE IF EXISTS " + dbName + ";\n"
+	sql += "CREATE DATABASE " + dbName + ";\n"
+	sql += "USE " + dbName + ";\n"
+	for _, td := range sd.TableDefinitions {
+		if td.Type == proto.TableBaseTable {
+			sql += td.Schema + ";\n"
+		}
+	}
+	return mysqld.ExecuteMysqlCommand(sql)
+}
+
+// dropDatabaseNoLog drops the database without replicating the drop.
+func (mysqld *Mysqld) dropDatabaseNoLog(dbName string) error {
+	sql := "SET sql_log_bin = 0;\n"
+	sql += "DROP DATABASE IF EXISTS " + dbName + ";\n"
+	return mysqld.ExecuteMysqlCommand(sql)
+}
+
+// schemaChangeTypePriority orders the DDL actions from the least to
+// the most destructive.
+var schemaChangeTypePriority = map[string]int{
+	sqlparser.AST_CREATE: 1,
+	sqlparser.AST_ALTER:  2,
+	sqlparser.AST_RENAME: 3,
+	sqlparser.AST_DROP:   4,
+}
+
+// ParseSchemaChangeType returns the type of a schema change, as one of
+// the sqlparser DDL actions. If the change has multiple statements,
+// the most destructive one is returned. If any statement cannot be
+// parsed as a DDL, it returns an empty string.
+func ParseSchemaChangeType(change string) string {
+	result := ""
+	for _, sql := range strings.Split(change, ";") {
+		sql = strings.TrimSpace(sql)
+		if sql == "" {
+			continue
+		}
+		stmt, err := sqlparser.Parse(sql)
+		if err != nil {
+			return ""
+		}
+		ddl, ok := stmt.(*sqlparser.DDL)
+		if !ok {
+			return ""
+		}
+		if schemaChangeTypePriority[ddl.Action] > schemaChangeTypePriority[result] {
+			result = ddl.Action
+		}
+	}
+	return result
+}
+
+// PreflightSchemaChange will apply the schema change to a scratch
 // database that has the same schema as the target database, see if it
-// works.
-func (mysqld *Mysqld) PreflightSchemaChange(dbName string, change string) (*proto.SchemaChangeResult, error) {
+// works. The scratch database is always dropped on the way out.
+func (mysqld *Mysqld) PreflightSchemaChange(dbName string, change string) (result *proto.SchemaChangeResult, err error) {
 	// gather current schema on real database
 	beforeSchema, err := mysqld.GetSchema(dbName, nil, nil, true)
 	if err != nil {
 		return nil, err
 	}
 
-	// populate temporary database with it
-	sql := "SET sql_log_bin = 0;\n"
-	sql += "DROP DATABASE IF EXISTS _vt_preflight;\n"
-	sql += "CREATE DATABASE _vt_preflight;\n"
-	sql += "USE _vt_preflight;\n"
-	for _, td := range beforeSchema.TableDefinitions {
-		if td.Type == proto.TableBaseTable {
-			sql += td.Schema + ";\n"
+	// clean up the scratch database, even if something failed
+	defer func() {
+		if dropErr := mysqld.dropDatabaseNoLog(preflightDbName); dropErr != nil {
+			log.Warningf("failed to drop preflight database %v: %v", preflightDbName, dropErr)
+			if err == nil {
+				result, err = nil, dropErr
+			}
 		}
-	}
-	if err = mysqld.ExecuteMysqlCommand(sql); err != nil {
+	}()
+
+	// populate scratch database with it
+	if err = mysqld.CopySchemaToDatabase(beforeSchema, preflightDbName); err != nil {
 		return nil, err
 	}
 
-	// apply schema change to the temporary database
-	sql = "SET sql_log_bin = 0;\n"
-	sql += "USE _vt_preflight;\n"
+	// apply schema change to the scratch database
+	sql := "SET sql_log_bin = 0;\n"
+	sql += "USE " + preflightDbName + ";\n"
 	sql += change
 	if err = mysqld.ExecuteMysqlCommand(sql); err != nil {
 		return nil, err
 	}
 
 	// get the result
-	afterSchema, err := mysqld.GetSchema("_vt_preflight", nil, nil, true)
+	afterSchema, err := mysqld.GetSchema(preflightDbName, nil, nil, true)
 	if err != nil {
 		return nil, err
 	}
 
-	// and clean up the extra database
-	sql = "SET sql_log_bin = 0;\n"
-	sql += "DROP DATABASE _vt_preflight;\n"
-	if err = mysqld.ExecuteMysqlCommand(sql); err != nil {
-		return nil, err
-	}
-
-	return &proto.SchemaChangeResult{BeforeSchema: beforeSchema, AfterSchema: afterSchema}, nil
+	return &proto.SchemaChangeResult{
+		BeforeSchema: beforeSchema,
+		AfterSchema:  afterSchema,
+		ChangeType:   ParseSchemaChangeType(change),
+	}, nil
 }
 
 // ApplySchemaChange will apply the schema change to the given database.
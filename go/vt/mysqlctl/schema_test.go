@@ -0,0 +1,32 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mysqlctl
+
+import (
+	"testing"
+
+	"github.com/youtube/vitess/go/vt/sqlparser"
+)
+
+func TestParseSchemaChangeType(t *testing.T) {
+	testcases := []struct {
+		change string
+		want   string
+	}{
+		{"create table t1 (id int)", sqlparser.AST_CREATE},
+		{"alter table t1 add column c int", sqlparser.AST_ALTER},
+		{"create table t2 (id int);\nalter table t1 add column c int;\n", sqlparser.AST_ALTER},
+		{"rename table t1 to t2", sqlparser.AST_RENAME},
+		{"alter table t1 add column c int; drop table t2", sqlparser.AST_DROP},
+		{"drop view if exists v1", sqlparser.AST_DROP},
+		{"insert into t1 values (1)", ""},
+		{"create table t1 (id int); not a statement", ""},
+	}
+	for _, tc := range testcases {
+		if got := ParseSchemaChangeType(tc.change); got != tc.want {
+			t.Errorf("ParseSchemaChangeType(%q) = %q, want %q", tc.change, got, tc.want)
+		}
+	}
+}
@@ -57,6 +57,22 @@ func NewSlaveConnection(mysqld *Mysqld) (*SlaveConnection, error) {
 	return sc, nil
 }
 
+// UnsupportedPositionError is returned by StartBinlogDump when the
+// start position can't be streamed from with the flavor of mysqld,
+// e.g. when it is of another flavor.
+type UnsupportedPositionError struct {
+	Flavor   string
+	Position proto.ReplicationPosition
+}
+
+func (e *UnsupportedPositionError) Error() string {
+	positionFlavor := "none"
+	if !e.Position.IsZero() {
+		positionFlavor = e.Position.GTIDSet.Flavor()
+	}
+	return fmt.Sprintf("cannot stream binlogs from position %v (of flavor %v) with the %v flavor", e.Position, positionFlavor, e.Flavor)
+}
+
 // slaveIDPool is the IDPool for server IDs used to connect as a slave.
 var slaveIDPool = pools.NewIDPool()
 
@@ -84,6 +100,10 @@ func (sc *SlaveConnection) StartBinlogDump(startPos proto.ReplicationPosition) (
 		return nil, err
 	}
 
+	makeBinlogEvent := flavor.MakeBinlogEvent
+	if ptf, ok := flavor.(positionTrackingFlavor); ok {
+		makeBinlogEvent = ptf.binlogEventMaker(startPos)
+	}
 	eventChan := make(chan blproto.BinlogEvent)
 
 	// Start reading events.
@@ -99,7 +119,7 @@ func (sc *SlaveConnection) StartBinlogDump(startPos proto.ReplicationPosition) (
 
 			select {
 			// Skip the first byte because it's only used for signaling EOF.
-			case eventChan <- flavor.MakeBinlogEvent(buf[1:]):
+			case eventChan <- makeBinlogEvent(buf[1:]):
 			case <-svc.ShuttingDown:
 				return nil
 			}
@@ -7,6 +7,8 @@ package mysqlctl
 import (
 	"reflect"
 	"testing"
+
+	"github.com/youtube/vitess/go/vt/mysqlctl/proto"
 )
 
 func TestMakeBinlogDumpCommand(t *testing.T) {
@@ -44,3 +46,25 @@ func TestMakeBinlogDumpCommandEmptyFilename(t *testing.T) {
 		t.Errorf("makeBinlogDumpCommand() = %#v, want %#v", got, want)
 	}
 }
+
+func TestSendBinlogDumpCommandUnsupportedPosition(t *testing.T) {
+	mariadbPos := proto.ReplicationPosition{GTIDSet: proto.MariadbGTID{Domain: 0, Server: 1, Sequence: 2}}
+	filePosition := proto.ReplicationPosition{GTIDSet: proto.FilePosGTID{File: "vt-bin.000001", Pos: 4}}
+	testcases := []struct {
+		flavor   MysqlFlavor
+		startPos proto.ReplicationPosition
+	}{
+		{&mysql56{}, mariadbPos},
+		{&mysql56{}, filePosition},
+		{&mariaDB10{}, filePosition},
+		{&mariaDB10{}, proto.ReplicationPosition{}},
+		{&filePos{}, mariadbPos},
+		{&filePos{}, proto.ReplicationPosition{}},
+	}
+	for _, tcase := range testcases {
+		err := tcase.flavor.SendBinlogDumpCommand(nil, nil, tcase.startPos)
+		if _, ok := err.(*UnsupportedPositionError); !ok {
+			t.Errorf("%T.SendBinlogDumpCommand(%v) = %v, want an UnsupportedPositionError", tcase.flavor, tcase.startPos, err)
+		}
+	}
+}
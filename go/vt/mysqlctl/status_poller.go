@@ -0,0 +1,202 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mysqlctl
+
+import (
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/golang/glog"
+	mproto "github.com/youtube/vitess/go/mysql/proto"
+	"github.com/youtube/vitess/go/stats"
+)
+
+/*
+This file contains the mysqld status poller: it periodically reads
+SHOW GLOBAL STATUS, and SHOW ENGINE INNODB STATUS for the values that
+are only there, and publishes an allowlist of the numeric variables.
+
+Variables that can't be read or parsed are just missing from the
+published values, as their availability depends on the versions and
+flavors of mysqld.
+*/
+
+// maxStatusPollerBackoff is the maximum interval between two polls,
+// when mysqld can't be reached.
+const maxStatusPollerBackoff = 5 * time.Minute
+
+// innodbStatusVariables are the variables parsed from the output of
+// SHOW ENGINE INNODB STATUS, with the regexp that finds their value.
+var innodbStatusVariables = map[string]*regexp.Regexp{
+	"Innodb_history_list_length": regexp.MustCompile(`(?m)^History list length (\d+)`),
+}
+
+// StatusPoller periodically reads the status variables of mysqld.
+type StatusPoller struct {
+	mysqld    MysqlDaemon
+	interval  time.Duration
+	variables []string
+
+	// mu protects the following fields
+	mu     sync.Mutex
+	values map[string]int64
+	done   chan struct{}
+}
+
+// NewStatusPoller returns a StatusPoller that reads the given
+// variables every interval. If name is not empty, the values are
+// published under that name.
+func NewStatusPoller(name string, mysqld MysqlDaemon, interval time.Duration, variables []string) *StatusPoller {
+	sp := &StatusPoller{
+		mysqld:    mysqld,
+		interval:  interval,
+		variables: variables,
+	}
+	if name != "" {
+		stats.Publish(name, stats.CountersFunc(sp.Values))
+	}
+	return sp
+}
+
+// Values returns a copy of the last values read.
+func (sp *StatusPoller) Values() map[string]int64 {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	result := make(map[string]int64, len(sp.values))
+	for k, v := range sp.values {
+		result[k] = v
+	}
+	return result
+}
+
+// Start starts polling in the background. It is a no-op if the
+// poller is already running.
+func (sp *StatusPoller) Start() {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	if sp.done != nil {
+		return
+	}
+	sp.done = make(chan struct{})
+	go sp.run(sp.done)
+}
+
+// Stop stops polling, and forgets the values.
+func (sp *StatusPoller) Stop() {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	if sp.done == nil {
+		return
+	}
+	close(sp.done)
+	sp.done = nil
+	sp.values = nil
+}
+
+// run polls until done is closed. When mysqld can't be reached, the
+// interval doubles up to maxStatusPollerBackoff, and the values are
+// forgotten so stale ones are not published.
+func (sp *StatusPoller) run(done chan struct{}) {
+	wait := time.Duration(0)
+	for {
+		select {
+		case <-done:
+			return
+		case <-time.After(wait):
+		}
+
+		values, err := sp.poll()
+		sp.mu.Lock()
+		if sp.done == done {
+			sp.values = values
+		}
+		sp.mu.Unlock()
+		wait = nextStatusPollerWait(wait, sp.interval, err)
+		if err != nil {
+			log.Warningf("Cannot read mysqld status, next try in %v: %v", wait, err)
+		}
+	}
+}
+
+// nextStatusPollerWait returns the wait before the next poll.
+func nextStatusPollerWait(wait, interval time.Duration, err error) time.Duration {
+	if err == nil {
+		return interval
+	}
+	wait *= 2
+	if wait > maxStatusPollerBackoff {
+		wait = maxStatusPollerBackoff
+	}
+	if wait < interval {
+		wait = interval
+	}
+	return wait
+}
+
+// poll reads the variables once. It only fails if SHOW GLOBAL STATUS
+// does. A failing SHOW ENGINE INNODB STATUS means its variables are
+// missing.
+func (sp *StatusPoller) poll() (map[string]int64, error) {
+	qr, err := sp.mysqld.FetchSuperQuery("SHOW GLOBAL STATUS")
+	if err != nil {
+		return nil, err
+	}
+	values := parseGlobalStatus(qr, sp.variables)
+
+	var innodb []string
+	for _, v := range sp.variables {
+		if _, ok := innodbStatusVariables[v]; ok {
+			innodb = append(innodb, v)
+		}
+	}
+	if len(innodb) > 0 {
+		qr, err := sp.mysqld.FetchSuperQuery("SHOW ENGINE INNODB STATUS")
+		if err != nil {
+			log.V(2).Infof("Cannot read innodb status: %v", err)
+		} else if len(qr.Rows) == 1 && len(qr.Rows[0]) == 3 {
+			parseInnodbStatus(qr.Rows[0][2].String(), innodb, values)
+		}
+	}
+	return values, nil
+}
+
+// parseGlobalStatus returns the numeric values of the variables in
+// the result of SHOW GLOBAL STATUS.
+func parseGlobalStatus(qr *mproto.QueryResult, variables []string) map[string]int64 {
+	wanted := make(map[string]bool, len(variables))
+	for _, v := range variables {
+		wanted[v] = true
+	}
+	values := make(map[string]int64)
+	for _, row := range qr.Rows {
+		if len(row) != 2 || !wanted[row[0].String()] {
+			continue
+		}
+		value, err := strconv.ParseInt(row[1].String(), 10, 64)
+		if err != nil {
+			continue
+		}
+		values[row[0].String()] = value
+	}
+	return values
+}
+
+// parseInnodbStatus adds the values of the variables found in the
+// output of SHOW ENGINE INNODB STATUS to values.
+func parseInnodbStatus(status string, variables []string, values map[string]int64) {
+	for _, v := range variables {
+		m := innodbStatusVariables[v].FindStringSubmatch(status)
+		if m == nil {
+			continue
+		}
+		value, err := strconv.ParseInt(m[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		values[v] = value
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mysqlctl
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	mproto "github.com/youtube/vitess/go/mysql/proto"
+	"github.com/youtube/vitess/go/sqltypes"
+)
+
+func statusResult(rows ...[]string) *mproto.QueryResult {
+	qr := &mproto.QueryResult{}
+	for _, row := range rows {
+		var values []sqltypes.Value
+		for _, v := range row {
+			values = append(values, sqltypes.MakeString([]byte(v)))
+		}
+		qr.Rows = append(qr.Rows, values)
+	}
+	return qr
+}
+
+func TestStatusPollerPoll(t *testing.T) {
+	fmd := NewFakeMysqlDaemon()
+	fmd.FetchSuperQueryMap = map[string]*mproto.QueryResult{
+		"SHOW GLOBAL STATUS": statusResult(
+			[]string{"Threads_running", "3"},
+			[]string{"Threads_connected", "12"},
+			[]string{"Uptime", "86400"},
+			[]string{"Slave_running", "ON"},
+			[]string{"Bytes_sent", "1000"},
+		),
+	}
+	sp := NewStatusPoller("", fmd, time.Second, []string{"Threads_running", "Threads_connected", "Uptime", "Slave_running", "Innodb_history_list_length", "Unknown_variable"})
+
+	// no innodb status: the other values are still there, and the
+	// non numeric ones are skipped
+	values, err := sp.poll()
+	if err != nil {
+		t.Fatalf("poll failed: %v", err)
+	}
+	want := map[string]int64{
+		"Threads_running":   3,
+		"Threads_connected": 12,
+		"Uptime":            86400,
+	}
+	if !reflect.DeepEqual(values, want) {
+		t.Errorf("got values %v, want %v", values, want)
+	}
+
+	fmd.FetchSuperQueryMap["SHOW ENGINE INNODB STATUS"] = statusResult([]string{"InnoDB", "", `
+------------
+TRANSACTIONS
+------------
+Trx id counter 1234567
+Purge done for trx's n:o < 1234560 undo n:o < 0 state: running but idle
+History list length 42
+LIST OF TRANSACTIONS FOR EACH SESSION:
+`})
+	values, err = sp.poll()
+	if err != nil {
+		t.Fatalf("poll failed: %v", err)
+	}
+	want["Innodb_history_list_length"] = 42
+	if !reflect.DeepEqual(values, want) {
+		t.Errorf("got values %v, want %v", values, want)
+	}
+
+	// mysqld is down
+	delete(fmd.FetchSuperQueryMap, "SHOW GLOBAL STATUS")
+	if _, err := sp.poll(); err == nil {
+		t.Errorf("poll should have failed")
+	}
+}
+
+func TestNextStatusPollerWait(t *testing.T) {
+	interval := 10 * time.Second
+	failure := fmt.Errorf("mysqld is down")
+	wait := time.Duration(0)
+	for _, want := range []time.Duration{10 * time.Second, 20 * time.Second, 40 * time.Second, 80 * time.Second, 160 * time.Second, 5 * time.Minute, 5 * time.Minute} {
+		wait = nextStatusPollerWait(wait, interval, failure)
+		if wait != want {
+			t.Errorf("got wait %v, want %v", wait, want)
+		}
+	}
+	if got := nextStatusPollerWait(wait, interval, nil); got != interval {
+		t.Errorf("got wait %v after a success, want %v", got, interval)
+	}
+}
@@ -0,0 +1,372 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mysqlctl
+
+import (
+	"bufio"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	log "github.com/golang/glog"
+	mproto "github.com/youtube/vitess/go/mysql/proto"
+	"github.com/youtube/vitess/go/sqltypes"
+	"github.com/youtube/vitess/go/vt/concurrency"
+	"github.com/youtube/vitess/go/vt/mysqlctl/proto"
+)
+
+/*
+This file contains the streaming clone: the data of the tables is read
+from a running source mysqld, and loaded into the destination mysqld
+as it arrives, without being staged on the local disk of either side.
+
+The data is transferred in the default format of LOAD DATA INFILE:
+fields are separated by tabs, rows are terminated by newlines, NULL is
+\N, and backslashes, tabs, newlines and NUL bytes are escaped with a
+backslash. The go/mysql client doesn't support LOAD DATA LOCAL INFILE,
+so the destination gives the data to mysqld through a named pipe in
+its tmp directory, with a regular LOAD DATA INFILE. mysqld needs the
+FILE privilege for that, and secure_file_priv has to allow the tmp
+directory.
+
+Both sides compute the number of rows and a CRC32 of the encoded data,
+so the destination can check it loaded exactly what the source sent.
+*/
+
+// streamingCloneBufferSize is the size of the row batches read from
+// the source mysqld.
+const streamingCloneBufferSize = 64 * 1024
+
+// TableDataStats describes the data of a table, as transferred by a
+// streaming clone.
+type TableDataStats struct {
+	// Rows is the number of rows.
+	Rows uint64
+
+	// Checksum is the CRC32 (IEEE) of the encoded rows.
+	Checksum uint32
+}
+
+// String is part of the fmt.Stringer interface.
+func (tds TableDataStats) String() string {
+	return fmt.Sprintf("%v rows, checksum %08x", tds.Rows, tds.Checksum)
+}
+
+// TableDataReader is where StreamingRestore reads the data of a
+// table from.
+type TableDataReader interface {
+	io.ReadCloser
+
+	// Stats returns the stats of the data computed by the source.
+	// It is only called after Read returned io.EOF.
+	Stats() (TableDataStats, error)
+}
+
+// tableDataWriter encodes rows in the LOAD DATA INFILE format.
+type tableDataWriter struct {
+	w     *bufio.Writer
+	crc   hash.Hash32
+	stats TableDataStats
+}
+
+func newTableDataWriter(w io.Writer) *tableDataWriter {
+	crc := crc32.NewIEEE()
+	return &tableDataWriter{
+		w:   bufio.NewWriterSize(io.MultiWriter(w, crc), streamingCloneBufferSize),
+		crc: crc,
+	}
+}
+
+// writeRow encodes one row.
+func (tdw *tableDataWriter) writeRow(row []sqltypes.Value) error {
+	for i, v := range row {
+		if i > 0 {
+			tdw.w.WriteByte('\t')
+		}
+		if v.IsNull() {
+			tdw.w.WriteString(`\N`)
+			continue
+		}
+		for _, b := range v.Raw() {
+			switch b {
+			case '\\':
+				tdw.w.WriteString(`\\`)
+			case '\t':
+				tdw.w.WriteString(`\t`)
+			case '\n':
+				tdw.w.WriteString(`\n`)
+			case 0:
+				tdw.w.WriteString(`\0`)
+			default:
+				tdw.w.WriteByte(b)
+			}
+		}
+	}
+	if err := tdw.w.WriteByte('\n'); err != nil {
+		return err
+	}
+	tdw.stats.Rows++
+	return nil
+}
+
+// close flushes the buffered data and returns the stats of what was
+// written.
+func (tdw *tableDataWriter) close() (TableDataStats, error) {
+	if err := tdw.w.Flush(); err != nil {
+		return TableDataStats{}, err
+	}
+	tdw.stats.Checksum = tdw.crc.Sum32()
+	return tdw.stats, nil
+}
+
+// tableDataCounter computes the stats of the encoded data that is
+// read through it. All the newlines in the encoded data terminate
+// rows, the ones in the values are escaped.
+type tableDataCounter struct {
+	r    io.Reader
+	crc  hash.Hash32
+	rows uint64
+}
+
+func newTableDataCounter(r io.Reader) *tableDataCounter {
+	return &tableDataCounter{
+		r:   r,
+		crc: crc32.NewIEEE(),
+	}
+}
+
+// Read is part of the io.Reader interface.
+func (tdc *tableDataCounter) Read(p []byte) (int, error) {
+	n, err := tdc.r.Read(p)
+	tdc.crc.Write(p[:n])
+	for _, b := range p[:n] {
+		if b == '\n' {
+			tdc.rows++
+		}
+	}
+	return n, err
+}
+
+func (tdc *tableDataCounter) stats() TableDataStats {
+	return TableDataStats{
+		Rows:     tdc.rows,
+		Checksum: tdc.crc.Sum32(),
+	}
+}
+
+// columnList returns the escaped columns of a table, comma separated.
+func columnList(td *proto.TableDefinition) string {
+	columns := make([]string, len(td.Columns))
+	for i, c := range td.Columns {
+		columns[i] = "`" + c + "`"
+	}
+	return strings.Join(columns, ", ")
+}
+
+// StreamTableData writes all the rows of a table to w, in the LOAD
+// DATA INFILE format, and returns the stats of what was written.
+// The caller has to make sure the table isn't modified meanwhile,
+// usually by stopping replication on a non-serving tablet.
+func StreamTableData(mysqld MysqlDaemon, w io.Writer, dbName string, td *proto.TableDefinition) (TableDataStats, error) {
+	if td.Type != proto.TableBaseTable {
+		return TableDataStats{}, fmt.Errorf("%v is not a base table", td.Name)
+	}
+	conn, err := mysqld.GetDbaConnection()
+	if err != nil {
+		return TableDataStats{}, err
+	}
+	defer conn.Close()
+
+	tdw := newTableDataWriter(w)
+	query := fmt.Sprintf("SELECT %v FROM `%v`.`%v`", columnList(td), dbName, td.Name)
+	if err := conn.ExecuteStreamFetch(query, func(qr *mproto.QueryResult) error {
+		for _, row := range qr.Rows {
+			if err := tdw.writeRow(row); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, streamingCloneBufferSize); err != nil {
+		return TableDataStats{}, fmt.Errorf("cannot stream table %v: %v", td.Name, err)
+	}
+	return tdw.close()
+}
+
+// openFifoForWriting opens the write side of a named pipe, without
+// blocking forever if no reader ever opens it: the open is retried
+// until done is closed.
+func openFifoForWriting(name string, done <-chan struct{}) (*os.File, error) {
+	for {
+		f, err := os.OpenFile(name, os.O_WRONLY|syscall.O_NONBLOCK, 0)
+		if err == nil {
+			return f, nil
+		}
+		if pe, ok := err.(*os.PathError); !ok || pe.Err != syscall.ENXIO {
+			return nil, err
+		}
+		select {
+		case <-done:
+			return nil, fmt.Errorf("the reader of %v went away", name)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+// LoadTableData loads the rows read from r, in the LOAD DATA INFILE
+// format, into a table, and returns the stats of what was read. The
+// binary logs are disabled while loading.
+func LoadTableData(mysqld MysqlDaemon, r io.Reader, dbName string, td *proto.TableDefinition) (TableDataStats, error) {
+	fifo := path.Join(mysqld.Cnf().TmpDir, fmt.Sprintf("streaming_clone.%v.%v.fifo", dbName, td.Name))
+	os.Remove(fifo)
+	// mysqld only reads files that are readable by everybody, or
+	// that belong to itself.
+	if err := syscall.Mkfifo(fifo, 0644); err != nil {
+		return TableDataStats{}, fmt.Errorf("cannot create named pipe %v: %v", fifo, err)
+	}
+	defer os.Remove(fifo)
+
+	conn, err := mysqld.GetDbaConnection()
+	if err != nil {
+		return TableDataStats{}, err
+	}
+	defer conn.Close()
+	for _, query := range []string{"SET sql_log_bin = 0", "SET foreign_key_checks = 0", "SET unique_checks = 0"} {
+		if _, err := conn.ExecuteFetch(query, 0, false); err != nil {
+			return TableDataStats{}, err
+		}
+	}
+
+	// LOAD DATA INFILE runs until it reads the end of the pipe
+	done := make(chan struct{})
+	var loaded uint64
+	var loadErr error
+	go func() {
+		defer close(done)
+		query := fmt.Sprintf("LOAD DATA INFILE '%v' INTO TABLE `%v`.`%v` CHARACTER SET binary (%v)", fifo, dbName, td.Name, columnList(td))
+		qr, err := conn.ExecuteFetch(query, 0, false)
+		if err != nil {
+			loadErr = err
+			return
+		}
+		loaded = qr.RowsAffected
+	}()
+
+	tdc := newTableDataCounter(r)
+	f, err := openFifoForWriting(fifo, done)
+	if err == nil {
+		_, err = io.Copy(f, tdc)
+		// closing the pipe ends the load
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	<-done
+	if loadErr != nil {
+		return TableDataStats{}, fmt.Errorf("cannot load table %v: %v", td.Name, loadErr)
+	}
+	if err != nil {
+		return TableDataStats{}, fmt.Errorf("cannot copy the data of table %v: %v", td.Name, err)
+	}
+	stats := tdc.stats()
+	if loaded != stats.Rows {
+		return TableDataStats{}, fmt.Errorf("loaded %v rows in table %v, but read %v", loaded, td.Name, stats.Rows)
+	}
+	return stats, nil
+}
+
+// createDatabase creates the database and its tables and views, as
+// described by the schema, without writing into the binary logs.
+func createDatabase(mysqld MysqlDaemon, sd *proto.SchemaDefinition, dbName string) error {
+	conn, err := mysqld.GetDbaConnection()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	queries := []string{"SET sql_log_bin = 0"}
+	for i, sql := range sd.ToSQLStrings() {
+		query, err := fillStringTemplate(sql, map[string]string{"DatabaseName": dbName})
+		if err != nil {
+			return err
+		}
+		queries = append(queries, query)
+		if i == 0 {
+			// the views are not qualified with the database
+			queries = append(queries, "USE `"+dbName+"`")
+		}
+	}
+	for _, query := range queries {
+		if _, err := conn.ExecuteFetch(query, 0, false); err != nil {
+			return fmt.Errorf("ExecuteFetch(%v) failed: %v", query, err)
+		}
+	}
+	return nil
+}
+
+// restoreTable loads one table from the source, and compares the
+// stats on both sides.
+func restoreTable(mysqld MysqlDaemon, dbName string, td *proto.TableDefinition, open func(table string) (TableDataReader, error)) error {
+	tdr, err := open(td.Name)
+	if err != nil {
+		return fmt.Errorf("cannot open the data of table %v: %v", td.Name, err)
+	}
+	defer tdr.Close()
+	got, err := LoadTableData(mysqld, tdr, dbName, td)
+	if err != nil {
+		return err
+	}
+	want, err := tdr.Stats()
+	if err != nil {
+		return fmt.Errorf("source failed to send table %v: %v", td.Name, err)
+	}
+	if got != want {
+		return fmt.Errorf("table %v doesn't match the source: got %v, source sent %v", td.Name, got, want)
+	}
+	log.Infof("StreamingRestore: loaded table %v: %v", td.Name, got)
+	return nil
+}
+
+// StreamingRestore creates the database as described by sd, and
+// loads the data of its tables, read from open, restoreConcurrency
+// tables at a time. There must be no existing database, like for Restore.
+func StreamingRestore(mysqld MysqlDaemon, sd *proto.SchemaDefinition, dbName string, restoreConcurrency int, open func(table string) (TableDataReader, error)) error {
+	log.Infof("StreamingRestore: checking no existing data is present")
+	if err := checkNoDB(mysqld); err != nil {
+		return err
+	}
+
+	log.Infof("StreamingRestore: creating database %v", dbName)
+	if err := createDatabase(mysqld, sd, dbName); err != nil {
+		return err
+	}
+
+	sema := make(chan struct{}, restoreConcurrency)
+	rec := concurrency.AllErrorRecorder{}
+	wg := sync.WaitGroup{}
+	for _, td := range sd.TableDefinitions {
+		if td.Type != proto.TableBaseTable {
+			continue
+		}
+		wg.Add(1)
+		go func(td *proto.TableDefinition) {
+			defer wg.Done()
+			sema <- struct{}{}
+			defer func() { <-sema }()
+			if rec.HasErrors() {
+				return
+			}
+			rec.RecordError(restoreTable(mysqld, dbName, td, open))
+		}(td)
+	}
+	wg.Wait()
+	return rec.Error()
+}
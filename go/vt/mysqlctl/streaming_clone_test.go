@@ -0,0 +1,63 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mysqlctl
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/youtube/vitess/go/sqltypes"
+)
+
+func TestTableDataWriter(t *testing.T) {
+	buf := &bytes.Buffer{}
+	tdw := newTableDataWriter(buf)
+	rows := [][]sqltypes.Value{
+		{sqltypes.MakeNumeric([]byte("1")), sqltypes.MakeString([]byte("simple"))},
+		{sqltypes.MakeNumeric([]byte("2")), sqltypes.NULL},
+		{sqltypes.MakeNumeric([]byte("3")), sqltypes.MakeString([]byte("tab\there\nnewline\\N\x00"))},
+		{sqltypes.MakeNumeric([]byte("4")), sqltypes.MakeString([]byte(""))},
+	}
+	for _, row := range rows {
+		if err := tdw.writeRow(row); err != nil {
+			t.Fatalf("writeRow failed: %v", err)
+		}
+	}
+	stats, err := tdw.close()
+	if err != nil {
+		t.Fatalf("close failed: %v", err)
+	}
+
+	want := "1\tsimple\n" +
+		"2\t\\N\n" +
+		"3\ttab\\there\\nnewline\\\\N\\0\n" +
+		"4\t\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got encoded data:\n%q\nwant:\n%q", got, want)
+	}
+	if stats.Rows != uint64(len(rows)) {
+		t.Errorf("got %v rows, want %v", stats.Rows, len(rows))
+	}
+
+	// the destination has to compute the same stats
+	tdc := newTableDataCounter(bytes.NewReader(buf.Bytes()))
+	if _, err := ioutil.ReadAll(tdc); err != nil {
+		t.Fatalf("ReadAll failed: %v", err)
+	}
+	if got := tdc.stats(); got != stats {
+		t.Errorf("got destination stats %v, want %v", got, stats)
+	}
+
+	// and different ones if the data was altered
+	altered := bytes.Replace(buf.Bytes(), []byte("simple"), []byte("simplE"), 1)
+	tdc = newTableDataCounter(bytes.NewReader(altered))
+	if _, err := ioutil.ReadAll(tdc); err != nil {
+		t.Fatalf("ReadAll failed: %v", err)
+	}
+	if got := tdc.stats(); got == stats {
+		t.Errorf("altered data has the same stats %v", got)
+	}
+}
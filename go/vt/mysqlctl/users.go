@@ -0,0 +1,489 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mysqlctl
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	log "github.com/golang/glog"
+	mproto "github.com/youtube/vitess/go/mysql/proto"
+	"github.com/youtube/vitess/go/sqltypes"
+	"github.com/youtube/vitess/go/vt/concurrency"
+)
+
+/*
+This file contains the declarative management of the mysql users. They
+are described in a JSON file, for instance:
+
+  {
+    "Users": [
+      {
+        "Name": "vt_repl",
+        "Host": "%",
+        "Password": "secret",
+        "Grants": ["REPLICATION SLAVE ON *.*"]
+      },
+      {
+        "Name": "vt_dba",
+        "Host": "localhost",
+        "AuthPlugin": "auth_socket",
+        "Grants": ["ALL ON *.* WITH GRANT OPTION"]
+      }
+    ]
+  }
+
+Applying the file creates the missing users, sets their password, and
+grants or revokes privileges so they match the file exactly. The users
+that are not in the file are left alone. Nothing is written to the
+binary logs, as each server applies the file on its own.
+*/
+
+var (
+	initDbSqlFile = flag.String("init_db_sql_file", "", "path to a SQL file to run when mysqld is initialized, after it first starts. Statements are terminated by a ';' at the end of a line")
+	usersSpecFile = flag.String("users_spec_file", "", "path to a JSON file describing the mysql users and their grants, applied when mysqld is initialized, and by the ReloadUsers tablet action")
+)
+
+// UserSpec describes one mysql user.
+type UserSpec struct {
+	Name string
+	Host string
+
+	// Password is the clear text password. PasswordHash can be
+	// used instead, with the mysql_native_password hash
+	// ('*' followed by 40 hex digits). Both are ignored if
+	// AuthPlugin is set.
+	Password     string
+	PasswordHash string
+
+	// AuthPlugin is the authentication plugin to use, for
+	// instance auth_socket.
+	AuthPlugin string
+
+	// Grants are the privileges of the user, as in a GRANT
+	// statement without the TO clause, for instance
+	// "SELECT, INSERT ON vt_keyspace.*".
+	Grants []string
+}
+
+// UsersSpec describes the mysql users managed by vitess.
+type UsersSpec struct {
+	Users []UserSpec
+}
+
+// ReadUsersSpec reads and checks a users spec file.
+func ReadUsersSpec(file string) (*UsersSpec, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	spec := &UsersSpec{}
+	if err := json.Unmarshal(data, spec); err != nil {
+		return nil, fmt.Errorf("cannot parse users spec %v: %v", file, err)
+	}
+	for _, u := range spec.Users {
+		if u.Name == "" || u.Host == "" {
+			return nil, fmt.Errorf("users spec %v has a user without Name or Host", file)
+		}
+		for _, g := range u.Grants {
+			if _, err := parseGrant(g); err != nil {
+				return nil, fmt.Errorf("users spec %v has an invalid grant for %v@%v: %v", file, u.Name, u.Host, err)
+			}
+		}
+	}
+	return spec, nil
+}
+
+// sqlString returns s as a quoted SQL string.
+func sqlString(s string) string {
+	buf := &bytes.Buffer{}
+	sqltypes.MakeString([]byte(s)).EncodeSql(buf)
+	return buf.String()
+}
+
+// account returns the 'user'@'host' form of a user.
+func (u *UserSpec) account() string {
+	return sqlString(u.Name) + "@" + sqlString(u.Host)
+}
+
+// nativePasswordHash returns the mysql_native_password hash of a
+// clear text password, as displayed in the mysql.user table.
+func nativePasswordHash(password string) string {
+	first := sha1.Sum([]byte(password))
+	second := sha1.Sum(first[:])
+	return "*" + strings.ToUpper(hex.EncodeToString(second[:]))
+}
+
+// passwordHash returns the password hash the user should have, or ""
+// if it uses an authentication plugin or no password.
+func (u *UserSpec) passwordHash() string {
+	switch {
+	case u.AuthPlugin != "":
+		return ""
+	case u.PasswordHash != "":
+		return strings.ToUpper(u.PasswordHash)
+	case u.Password != "":
+		return nativePasswordHash(u.Password)
+	}
+	return ""
+}
+
+// grant is a parsed GRANT statement: privileges on one object.
+type grant struct {
+	privileges []string
+	object     string
+}
+
+// grantOption is the privilege we use for WITH GRANT OPTION.
+const grantOption = "GRANT OPTION"
+
+// splitPrivileges splits a list of privileges on the commas that are
+// not in a column list.
+func splitPrivileges(s string) []string {
+	var result []string
+	depth := 0
+	start := 0
+	for i, c := range s {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				result = append(result, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(result, s[start:])
+}
+
+// normalizePrivilege uppercases the name of a privilege, and
+// collapses its spaces. ALL is ALL PRIVILEGES.
+func normalizePrivilege(p string) string {
+	name, columns := p, ""
+	if i := strings.Index(p, "("); i != -1 {
+		name, columns = p[:i], " "+strings.Replace(p[i:], "`", "", -1)
+	}
+	name = strings.ToUpper(strings.Join(strings.Fields(name), " "))
+	if name == "ALL" {
+		name = "ALL PRIVILEGES"
+	}
+	return name + columns
+}
+
+// parseGrant parses a grant from the users spec (privileges ON
+// object, optionally followed by WITH GRANT OPTION), or a line of
+// SHOW GRANTS.
+func parseGrant(s string) (*grant, error) {
+	s = strings.TrimSpace(s)
+	if upper := strings.ToUpper(s); strings.HasPrefix(upper, "GRANT ") && !strings.HasPrefix(upper, grantOption) {
+		s = s[len("GRANT "):]
+	}
+	upper := strings.ToUpper(s)
+	on := strings.Index(upper, " ON ")
+	if on == -1 {
+		return nil, fmt.Errorf("no ON in grant %q", s)
+	}
+	object := s[on+len(" ON "):]
+	withGrantOption := strings.HasSuffix(upper, " WITH GRANT OPTION")
+	if to := strings.Index(strings.ToUpper(object), " TO "); to != -1 {
+		object = object[:to]
+	} else if withGrantOption {
+		object = object[:len(object)-len(" WITH GRANT OPTION")]
+	}
+	object = strings.TrimSpace(strings.Replace(object, "`", "", -1))
+	if object == "" || strings.ContainsAny(object, " '") {
+		return nil, fmt.Errorf("invalid object in grant %q", s)
+	}
+
+	g := &grant{object: object}
+	for _, p := range splitPrivileges(s[:on]) {
+		p = normalizePrivilege(p)
+		switch p {
+		case "":
+			return nil, fmt.Errorf("empty privilege in grant %q", s)
+		case "USAGE":
+			continue
+		}
+		g.privileges = append(g.privileges, p)
+	}
+	if withGrantOption {
+		g.privileges = append(g.privileges, grantOption)
+	}
+	return g, nil
+}
+
+// privilegesByObject merges grants into the set of privileges of each
+// object.
+func privilegesByObject(grants []*grant) map[string]map[string]bool {
+	result := make(map[string]map[string]bool)
+	for _, g := range grants {
+		if result[g.object] == nil {
+			result[g.object] = make(map[string]bool)
+		}
+		for _, p := range g.privileges {
+			result[g.object][p] = true
+		}
+	}
+	return result
+}
+
+// quoteObject quotes the database and table of a grant object.
+func quoteObject(object string) string {
+	parts := strings.Split(object, ".")
+	for i, p := range parts {
+		if p != "*" {
+			parts[i] = "`" + p + "`"
+		}
+	}
+	return strings.Join(parts, ".")
+}
+
+// sortedKeys returns the keys of a set, sorted.
+func sortedKeys(set map[string]bool) []string {
+	result := make([]string, 0, len(set))
+	for k := range set {
+		result = append(result, k)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// grantChanges returns the GRANT and REVOKE statements that change
+// the privileges of account from current to wanted.
+func grantChanges(account string, current, wanted []*grant) []string {
+	have := privilegesByObject(current)
+	want := privilegesByObject(wanted)
+	objects := make(map[string]bool)
+	for o := range have {
+		objects[o] = true
+	}
+	for o := range want {
+		objects[o] = true
+	}
+
+	var result []string
+	for _, o := range sortedKeys(objects) {
+		var revoke, add []string
+		withGrantOption := false
+		for _, p := range sortedKeys(have[o]) {
+			if !want[o][p] {
+				revoke = append(revoke, p)
+			}
+		}
+		for _, p := range sortedKeys(want[o]) {
+			if have[o][p] {
+				continue
+			}
+			if p == grantOption {
+				withGrantOption = true
+			} else {
+				add = append(add, p)
+			}
+		}
+		if len(revoke) > 0 {
+			result = append(result, fmt.Sprintf("REVOKE %v ON %v FROM %v", strings.Join(revoke, ", "), quoteObject(o), account))
+		}
+		if len(add) > 0 || withGrantOption {
+			privileges := "USAGE"
+			if len(add) > 0 {
+				privileges = strings.Join(add, ", ")
+			}
+			query := fmt.Sprintf("GRANT %v ON %v TO %v", privileges, quoteObject(o), account)
+			if withGrantOption {
+				query += " WITH GRANT OPTION"
+			}
+			result = append(result, query)
+		}
+	}
+	return result
+}
+
+// columnValue returns the value of a column in the first row of qr,
+// and false if there is no such column.
+func columnValue(qr *mproto.QueryResult, column string) (string, bool) {
+	for i, f := range qr.Fields {
+		if strings.EqualFold(f.Name, column) {
+			return qr.Rows[0][i].String(), true
+		}
+	}
+	return "", false
+}
+
+// userChanges returns the statements that make the user match the
+// spec.
+func (mysqld *Mysqld) userChanges(u *UserSpec) ([]string, error) {
+	account := u.account()
+	hash := u.passwordHash()
+	qr, err := mysqld.FetchSuperQuery(fmt.Sprintf("SELECT * FROM mysql.user WHERE User = %v AND Host = %v", sqlString(u.Name), sqlString(u.Host)))
+	if err != nil {
+		return nil, err
+	}
+	var result []string
+	var current []*grant
+	if len(qr.Rows) == 0 {
+		switch {
+		case u.AuthPlugin != "":
+			result = append(result, fmt.Sprintf("CREATE USER %v IDENTIFIED WITH %v", account, u.AuthPlugin))
+		case hash != "":
+			result = append(result, fmt.Sprintf("CREATE USER %v IDENTIFIED BY PASSWORD %v", account, sqlString(hash)))
+		default:
+			result = append(result, fmt.Sprintf("CREATE USER %v", account))
+		}
+	} else {
+		plugin, _ := columnValue(qr, "plugin")
+		if u.AuthPlugin != "" && plugin != u.AuthPlugin {
+			return nil, fmt.Errorf("%v uses the authentication plugin %q instead of %q, it has to be changed manually", account, plugin, u.AuthPlugin)
+		}
+		if u.AuthPlugin == "" {
+			currentHash, _ := columnValue(qr, "authentication_string")
+			if currentHash == "" {
+				currentHash, _ = columnValue(qr, "Password")
+			}
+			if strings.ToUpper(currentHash) != hash {
+				result = append(result, fmt.Sprintf("GRANT USAGE ON *.* TO %v IDENTIFIED BY PASSWORD %v", account, sqlString(hash)))
+			}
+		}
+
+		qr, err := mysqld.FetchSuperQuery("SHOW GRANTS FOR " + account)
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range qr.Rows {
+			line := row[0].String()
+			if strings.HasPrefix(line, "GRANT PROXY ") {
+				continue
+			}
+			g, err := parseGrant(line)
+			if err != nil {
+				return nil, fmt.Errorf("cannot parse the grants of %v: %v", account, err)
+			}
+			current = append(current, g)
+		}
+	}
+
+	wanted := make([]*grant, len(u.Grants))
+	for i, s := range u.Grants {
+		if wanted[i], err = parseGrant(s); err != nil {
+			return nil, err
+		}
+	}
+	return append(result, grantChanges(account, current, wanted)...), nil
+}
+
+// ApplyUsersSpec makes the users of the spec match it, and returns
+// the statements it ran. The users are applied independently, the
+// errors are returned together.
+func (mysqld *Mysqld) ApplyUsersSpec(spec *UsersSpec) ([]string, error) {
+	conn, err := mysqld.GetDbaConnection()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if _, err := conn.ExecuteFetch("SET sql_log_bin = 0", 0, false); err != nil {
+		return nil, err
+	}
+
+	var applied []string
+	rec := concurrency.AllErrorRecorder{}
+	for i := range spec.Users {
+		u := &spec.Users[i]
+		queries, err := mysqld.userChanges(u)
+		if err != nil {
+			rec.RecordError(err)
+			continue
+		}
+		for _, query := range queries {
+			if _, err := conn.ExecuteFetch(query, 0, false); err != nil {
+				rec.RecordError(fmt.Errorf("%v failed: %v", redactPassword(query), err))
+				break
+			}
+			log.Infof("Applied users spec: %v", redactPassword(query))
+			applied = append(applied, redactPassword(query))
+		}
+	}
+	return applied, rec.Error()
+}
+
+// redactPassword hides the password hash of a statement.
+func redactPassword(query string) string {
+	if i := strings.Index(query, " IDENTIFIED BY PASSWORD "); i != -1 {
+		return query[:i] + " IDENTIFIED BY PASSWORD ****"
+	}
+	return query
+}
+
+// ReloadUsers applies the file of -users_spec_file.
+func (mysqld *Mysqld) ReloadUsers() ([]string, error) {
+	if *usersSpecFile == "" {
+		return nil, fmt.Errorf("no -users_spec_file to reload the users from")
+	}
+	spec, err := ReadUsersSpec(*usersSpecFile)
+	if err != nil {
+		return nil, err
+	}
+	return mysqld.ApplyUsersSpec(spec)
+}
+
+// splitSqlStatements splits the content of a SQL file into
+// statements. A statement ends with a ';' at the end of a line, and
+// the lines starting with '--' are comments.
+func splitSqlStatements(data string) []string {
+	var result []string
+	var current []string
+	for _, line := range strings.Split(data, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		if strings.HasSuffix(trimmed, ";") {
+			current = append(current, strings.TrimSuffix(trimmed, ";"))
+			result = append(result, strings.Join(current, "\n"))
+			current = nil
+			continue
+		}
+		current = append(current, trimmed)
+	}
+	if len(current) > 0 {
+		result = append(result, strings.Join(current, "\n"))
+	}
+	return result
+}
+
+// initDatabase runs -init_db_sql_file, and applies -users_spec_file,
+// after mysqld was started for the first time.
+func (mysqld *Mysqld) initDatabase() error {
+	if *initDbSqlFile != "" {
+		data, err := ioutil.ReadFile(*initDbSqlFile)
+		if err != nil {
+			return err
+		}
+		conn, err := mysqld.GetDbaConnection()
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		for _, query := range append([]string{"SET sql_log_bin = 0"}, splitSqlStatements(string(data))...) {
+			if _, err := conn.ExecuteFetch(query, 0, false); err != nil {
+				return fmt.Errorf("init_db_sql_file %v: %v failed: %v", *initDbSqlFile, query, err)
+			}
+		}
+	}
+	if *usersSpecFile != "" {
+		if _, err := mysqld.ReloadUsers(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
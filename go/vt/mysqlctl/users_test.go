@@ -0,0 +1,106 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mysqlctl
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNativePasswordHash(t *testing.T) {
+	// value of SELECT PASSWORD('password')
+	if got, want := nativePasswordHash("password"), "*2470C0C06DEE42FD1618BB99005ADCA2EC9D1E19"; got != want {
+		t.Errorf("nativePasswordHash = %v, want %v", got, want)
+	}
+}
+
+func TestParseGrant(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want *grant
+	}{
+		{"GRANT USAGE ON *.* TO 'vt_repl'@'%' IDENTIFIED BY PASSWORD '*2470C0C06DEE42FD1618BB99005ADCA2EC9D1E19'", &grant{object: "*.*"}},
+		{"GRANT ALL PRIVILEGES ON *.* TO 'vt_dba'@'localhost' WITH GRANT OPTION", &grant{privileges: []string{"ALL PRIVILEGES", grantOption}, object: "*.*"}},
+		{"GRANT SELECT, INSERT, UPDATE (`id`, `name`) ON `vt_keyspace`.`table1` TO 'vt_app'@'%'", &grant{privileges: []string{"SELECT", "INSERT", "UPDATE (id, name)"}, object: "vt_keyspace.table1"}},
+		{"all on vt_keyspace.* with grant option", &grant{privileges: []string{"ALL PRIVILEGES", grantOption}, object: "vt_keyspace.*"}},
+		{"replication  slave, replication client ON *.*", &grant{privileges: []string{"REPLICATION SLAVE", "REPLICATION CLIENT"}, object: "*.*"}},
+	} {
+		got, err := parseGrant(tc.in)
+		if err != nil || !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("parseGrant(%q) = %#v %v, want %#v", tc.in, got, err, tc.want)
+		}
+	}
+
+	for _, in := range []string{"SELECT", "SELECT ON", "SELECT, ON *.*", "SELECT ON vt keyspace.*"} {
+		if _, err := parseGrant(in); err == nil {
+			t.Errorf("parseGrant(%q) should have failed", in)
+		}
+	}
+}
+
+func TestGrantChanges(t *testing.T) {
+	parse := func(grants ...string) []*grant {
+		var result []*grant
+		for _, s := range grants {
+			g, err := parseGrant(s)
+			if err != nil {
+				t.Fatalf("parseGrant(%q) failed: %v", s, err)
+			}
+			result = append(result, g)
+		}
+		return result
+	}
+	account := "'vt_app'@'%'"
+
+	current := parse(
+		"GRANT USAGE ON *.* TO 'vt_app'@'%'",
+		"GRANT SELECT, INSERT, DELETE ON `vt_keyspace`.* TO 'vt_app'@'%'",
+		"GRANT SELECT ON `other`.* TO 'vt_app'@'%' WITH GRANT OPTION",
+	)
+	wanted := parse(
+		"SELECT, INSERT, UPDATE ON vt_keyspace.*",
+		"SELECT ON other.*",
+		"PROCESS ON *.* WITH GRANT OPTION",
+	)
+	want := []string{
+		"GRANT PROCESS ON *.* TO 'vt_app'@'%' WITH GRANT OPTION",
+		"REVOKE GRANT OPTION ON `other`.* FROM 'vt_app'@'%'",
+		"REVOKE DELETE ON `vt_keyspace`.* FROM 'vt_app'@'%'",
+		"GRANT UPDATE ON `vt_keyspace`.* TO 'vt_app'@'%'",
+	}
+	if got := grantChanges(account, current, wanted); !reflect.DeepEqual(got, want) {
+		t.Errorf("grantChanges = %#v, want %#v", got, want)
+	}
+
+	// applying the same grants is a no-op
+	if got := grantChanges(account, wanted, wanted); len(got) != 0 {
+		t.Errorf("grantChanges with the same grants = %#v", got)
+	}
+
+	// GRANT OPTION alone is granted with USAGE
+	want = []string{"GRANT USAGE ON *.* TO 'vt_app'@'%' WITH GRANT OPTION"}
+	if got := grantChanges(account, parse("PROCESS ON *.*"), parse("PROCESS ON *.* WITH GRANT OPTION")); !reflect.DeepEqual(got, want) {
+		t.Errorf("grantChanges = %#v, want %#v", got, want)
+	}
+}
+
+func TestSplitSqlStatements(t *testing.T) {
+	data := `-- the vitess database
+CREATE DATABASE IF NOT EXISTS _vt;
+CREATE TABLE IF NOT EXISTS _vt.blp_checkpoint (
+  source_shard_uid INT(10) UNSIGNED NOT NULL,
+  PRIMARY KEY (source_shard_uid)
+) ENGINE=InnoDB;
+
+FLUSH PRIVILEGES`
+	want := []string{
+		"CREATE DATABASE IF NOT EXISTS _vt",
+		"CREATE TABLE IF NOT EXISTS _vt.blp_checkpoint (\nsource_shard_uid INT(10) UNSIGNED NOT NULL,\nPRIMARY KEY (source_shard_uid)\n) ENGINE=InnoDB",
+		"FLUSH PRIVILEGES",
+	}
+	if got := splitSqlStatements(data); !reflect.DeepEqual(got, want) {
+		t.Errorf("splitSqlStatements = %#v, want %#v", got, want)
+	}
+}
@@ -0,0 +1,596 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mysqlctl
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/golang/glog"
+
+	"github.com/youtube/vitess/go/sync2"
+	"github.com/youtube/vitess/go/vt/concurrency"
+	"github.com/youtube/vitess/go/vt/logutil"
+	"github.com/youtube/vitess/go/vt/mysqlctl/backupstorage"
+	"github.com/youtube/vitess/go/vt/mysqlctl/proto"
+)
+
+// This file contains the xtrabackup backup engine. It streams a hot
+// backup from xtrabackup, so mysqld keeps running and serving, and it
+// works on masters. The stream is split in blocks written in turn to
+// each of the stripes (separate files on the BackupStorage), so they
+// can be compressed and uploaded in parallel.
+
+var (
+	xtrabackupRootPath        = flag.String("xtrabackup_root_path", "", "directory containing the xtrabackup and xbstream binaries")
+	xtrabackupUser            = flag.String("xtrabackup_user", "", "user xtrabackup uses to connect to mysqld, it needs the backup privileges")
+	xtrabackupBackupFlags     = flag.String("xtrabackup_backup_flags", "", "space separated extra flags to pass to xtrabackup when taking a backup")
+	xtrabackupStripes         = flag.Int("xtrabackup_stripes", 1, "number of files the xtrabackup stream is split into, for parallel upload and download")
+	xtrabackupStripeBlockSize = flag.Int("xtrabackup_stripe_block_size", 102400, "number of bytes of the xtrabackup stream written to a stripe before moving to the next one")
+)
+
+const (
+	// xtrabackupEngineName is the name of this engine
+	xtrabackupEngineName = "xtrabackup"
+
+	// xtrabackupFileName is the base name of the stripes
+	xtrabackupFileName = "xtrabackup"
+)
+
+// xtrabackupPositionRegexp finds the replication position in the
+// xtrabackup output. The GTID set can span multiple lines.
+var xtrabackupPositionRegexp = regexp.MustCompile(`GTID of the last change '([^']*)'`)
+
+// xtrabackupEngine is the BackupEngine that uses xtrabackup.
+type xtrabackupEngine struct{}
+
+// xtrabackupManifest is the MANIFEST of an xtrabackup backup.
+type xtrabackupManifest struct {
+	// BackupManifest is the common part of the manifest
+	BackupManifest
+
+	// FileName is the base name of the stripes: they are
+	// FileName-0, FileName-1, ...
+	FileName string
+
+	// NumStripes is the number of stripes
+	NumStripes int
+
+	// StripeBlockSize is the size of the blocks of the
+	// uncompressed stream written to each stripe in turn
+	StripeBlockSize int
+
+	// StripeHashes are the hashes of the compressed stripes
+	StripeHashes []string
+
+	// StripeSHA256s are the hex-encoded SHA256 of the compressed
+	// stripes. Backups taken before they were introduced don't
+	// have them.
+	StripeSHA256s []string
+}
+
+func xtrabackupStripeName(fileName string, i int) string {
+	return fmt.Sprintf("%v-%v", fileName, i)
+}
+
+// ExecuteBackup is part of the BackupEngine interface.
+func (be *xtrabackupEngine) ExecuteBackup(mysqld MysqlDaemon, logger logutil.Logger, bh backupstorage.BackupHandle, backupConcurrency int, bandwidthLimit int64, hookExtraEnv map[string]string) error {
+	if *xtrabackupUser == "" {
+		return fmt.Errorf("-xtrabackup_user must be set to use the xtrabackup engine")
+	}
+	if *xtrabackupStripes < 1 || *xtrabackupStripeBlockSize < 1 {
+		return fmt.Errorf("invalid -xtrabackup_stripes %v or -xtrabackup_stripe_block_size %v", *xtrabackupStripes, *xtrabackupStripeBlockSize)
+	}
+
+	// xtrabackup prints the position without its flavor, get it
+	// from the current position.
+	currentPosition, err := mysqld.MasterPosition()
+	if err != nil {
+		return fmt.Errorf("cannot get master position: %v", err)
+	}
+	if currentPosition.GTIDSet == nil {
+		return fmt.Errorf("cannot find the replication flavor, GTIDs need to be enabled")
+	}
+	flavor := currentPosition.GTIDSet.Flavor()
+
+	cnf := mysqld.Cnf()
+	flags := []string{
+		"--defaults-file=" + cnf.path,
+		"--backup",
+		"--socket=" + cnf.SocketFile,
+		"--slave-info",
+		"--user=" + *xtrabackupUser,
+		"--target-dir=" + cnf.TmpDir,
+		"--stream=xbstream",
+		fmt.Sprintf("--parallel=%v", backupConcurrency),
+	}
+	flags = append(flags, strings.Fields(*xtrabackupBackupFlags)...)
+	cmd := exec.Command(path.Join(*xtrabackupRootPath, "xtrabackup"), flags...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("cannot create stdout pipe: %v", err)
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return fmt.Errorf("cannot create stderr pipe: %v", err)
+	}
+
+	compressionEngine, err := backupCompressionEngine()
+	if err != nil {
+		return err
+	}
+
+	// open the stripes
+	stripes, err := newBackupStripes(bh, xtrabackupFileName, *xtrabackupStripes, compressionEngine)
+	if err != nil {
+		return err
+	}
+
+	logger.Infof("running %v %v", cmd.Path, strings.Join(flags, " "))
+	if err := cmd.Start(); err != nil {
+		stripes.abort(err)
+		return fmt.Errorf("cannot start xtrabackup: %v", err)
+	}
+
+	// log stderr, and keep it to find the position
+	output := &bytes.Buffer{}
+	stderrDone := make(chan struct{})
+	go func() {
+		defer close(stderrDone)
+		scanner := bufio.NewScanner(stderr)
+		for scanner.Scan() {
+			line := scanner.Text()
+			logger.Infof("xtrabackup stderr: %v", line)
+			output.WriteString(line)
+			output.WriteString("\n")
+		}
+	}()
+
+	// copy the stream to the stripes
+	startTime := time.Now()
+	lr := &limitedReader{r: stdout, limiter: newBandwidthLimiter(bandwidthLimit)}
+	_, copyErr := io.Copy(newStripedWriter(stripes.writers(), *xtrabackupStripeBlockSize), lr)
+	if copyErr != nil {
+		// stop xtrabackup, it would block writing to stdout
+		cmd.Process.Kill()
+		stripes.abort(copyErr)
+	}
+	hashes, sha256s, stripesErr := stripes.close()
+	<-stderrDone
+	waitErr := cmd.Wait()
+	switch {
+	case copyErr != nil:
+		return fmt.Errorf("cannot copy the xtrabackup output: %v", copyErr)
+	case stripesErr != nil:
+		return fmt.Errorf("cannot write the backup stripes: %v", stripesErr)
+	case waitErr != nil:
+		return fmt.Errorf("xtrabackup failed: %v", waitErr)
+	}
+	duration := time.Now().Sub(startTime)
+	logger.Infof("backed up %v bytes in %v stripes in %v (%v)", lr.count, len(hashes), duration, transferRate(lr.count, duration))
+
+	replicationPosition, err := findXtrabackupReplicationPosition(output.String(), flavor)
+	if err != nil {
+		return err
+	}
+	logger.Infof("xtrabackup replication position: %v", replicationPosition)
+
+	return writeManifest(bh, &xtrabackupManifest{
+		BackupManifest: BackupManifest{
+			BackupMethod:        xtrabackupEngineName,
+			ReplicationPosition: replicationPosition,
+			CompressionEngine:   compressionEngine,
+			DataSize:            lr.count,
+		},
+		FileName:        xtrabackupFileName,
+		NumStripes:      len(hashes),
+		StripeBlockSize: *xtrabackupStripeBlockSize,
+		StripeHashes:    hashes,
+		StripeSHA256s:   sha256s,
+	})
+}
+
+// findXtrabackupReplicationPosition parses the replication position
+// out of the xtrabackup output.
+func findXtrabackupReplicationPosition(output, flavor string) (proto.ReplicationPosition, error) {
+	match := xtrabackupPositionRegexp.FindStringSubmatch(output)
+	if match == nil {
+		return proto.ReplicationPosition{}, fmt.Errorf("cannot find the replication position in the xtrabackup output")
+	}
+	position := strings.Replace(match[1], "\n", "", -1)
+	replicationPosition, err := proto.ParseReplicationPosition(flavor, position)
+	if err != nil {
+		return proto.ReplicationPosition{}, fmt.Errorf("cannot parse the replication position %v reported by xtrabackup: %v", position, err)
+	}
+	return replicationPosition, nil
+}
+
+// ExecuteRestore is part of the BackupEngine interface. It extracts
+// the stream with xbstream in a temporary directory, checks and
+// prepares it, and only then replaces the existing data files with it,
+// with xtrabackup.
+func (be *xtrabackupEngine) ExecuteRestore(mysqld MysqlDaemon, bh backupstorage.BackupHandle, manifest []byte, restoreConcurrency int, bandwidthLimit int64) (proto.ReplicationPosition, error) {
+	var bm xtrabackupManifest
+	if err := json.Unmarshal(manifest, &bm); err != nil {
+		return proto.ReplicationPosition{}, fmt.Errorf("cannot JSON decode %v: %v", backupManifest, err)
+	}
+
+	cnf := mysqld.Cnf()
+	tempDir := path.Join(cnf.TmpDir, time.Now().UTC().Format("xtrabackup-2006-01-02.150405"))
+	if err := os.MkdirAll(tempDir, os.ModePerm); err != nil {
+		return proto.ReplicationPosition{}, fmt.Errorf("cannot create temporary directory %v: %v", tempDir, err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	log.Infof("Restore: extracting %v stripes into %v", bm.NumStripes, tempDir)
+	if err := be.extractStripes(bh, &bm, tempDir, restoreConcurrency, bandwidthLimit); err != nil {
+		return proto.ReplicationPosition{}, err
+	}
+
+	xtrabackup := path.Join(*xtrabackupRootPath, "xtrabackup")
+	log.Infof("Restore: preparing the backup")
+	if _, err := execCmd(xtrabackup, []string{"--prepare", "--target-dir=" + tempDir}, nil, ""); err != nil {
+		return proto.ReplicationPosition{}, err
+	}
+	log.Infof("Restore: removing the existing data files")
+	for _, dir := range []string{cnf.DataDir, cnf.InnodbDataHomeDir, cnf.InnodbLogGroupHomeDir} {
+		if err := removeDirectoryContents(dir); err != nil {
+			return proto.ReplicationPosition{}, err
+		}
+	}
+	log.Infof("Restore: moving the files into place")
+	if _, err := execCmd(xtrabackup, []string{"--defaults-file=" + cnf.path, "--move-back", "--target-dir=" + tempDir}, nil, ""); err != nil {
+		return proto.ReplicationPosition{}, err
+	}
+	return bm.ReplicationPosition, nil
+}
+
+// stripeHashers computes the hashes of a compressed stripe.
+type stripeHashers struct {
+	hasher *hasher
+	sha    hash.Hash
+}
+
+func newStripeHashers() *stripeHashers {
+	return &stripeHashers{
+		hasher: newHasher(),
+		sha:    sha256.New(),
+	}
+}
+
+// Write is part of the io.Writer interface
+func (sh *stripeHashers) Write(p []byte) (int, error) {
+	sh.hasher.Write(p)
+	return sh.sha.Write(p)
+}
+
+// matches returns true if the hashes match the ones of stripe i in
+// the MANIFEST. Backups taken before the SHA256 was introduced only
+// have the other hash.
+func (sh *stripeHashers) matches(bm *xtrabackupManifest, i int) bool {
+	hash := sh.hasher.HashString()
+	sum := hex.EncodeToString(sh.sha.Sum(nil))
+	expectedSum := ""
+	if len(bm.StripeSHA256s) > 0 {
+		expectedSum = bm.StripeSHA256s[i]
+	}
+	if hash == bm.StripeHashes[i] && (expectedSum == "" || sum == expectedSum) {
+		return true
+	}
+	log.Errorf("hash mismatch for stripe %v, got %v and SHA256 %v, expected %v and SHA256 %v", i, hash, sum, bm.StripeHashes[i], expectedSum)
+	return false
+}
+
+// extractStripes reads the stripes, and pipes the stream into xbstream.
+func (be *xtrabackupEngine) extractStripes(bh backupstorage.BackupHandle, bm *xtrabackupManifest, dir string, restoreConcurrency int, bandwidthLimit int64) error {
+	limiter := newBandwidthLimiter(bandwidthLimit)
+	readers := make([]io.Reader, bm.NumStripes)
+	hashers := make([]*stripeHashers, bm.NumStripes)
+	for i := 0; i < bm.NumStripes; i++ {
+		rc, err := bh.ReadFile(xtrabackupStripeName(bm.FileName, i))
+		if err != nil {
+			return err
+		}
+		defer rc.Close()
+		hashers[i] = newStripeHashers()
+		tee := io.TeeReader(&limitedReader{r: rc, limiter: limiter}, hashers[i])
+		decompressor, err := newDecompressor(restoreCompressionEngine(bm.CompressionEngine), tee)
+		if err != nil {
+			return err
+		}
+		defer decompressor.Close()
+		readers[i] = decompressor
+	}
+
+	stderr := &bytes.Buffer{}
+	cmd := exec.Command(path.Join(*xtrabackupRootPath, "xbstream"), "-x", "-C", dir, fmt.Sprintf("--parallel=%v", restoreConcurrency))
+	cmd.Stdin = newStripedReader(readers, bm.StripeBlockSize)
+	cmd.Stderr = stderr
+	runErr := cmd.Run()
+
+	// a corrupted stream can also make xbstream fail, report the
+	// mismatched stripes first
+	var mismatched []string
+	for i, h := range hashers {
+		if !h.matches(bm, i) {
+			mismatched = append(mismatched, xtrabackupStripeName(bm.FileName, i))
+		}
+	}
+	if len(mismatched) > 0 {
+		return &BackupCorruptionError{Files: mismatched}
+	}
+	if runErr != nil {
+		return fmt.Errorf("xbstream failed: %v: %v", runErr, stderr.String())
+	}
+	return nil
+}
+
+// ExecuteVerify is part of the BackupEngine interface. Each stripe is
+// read and decompressed on its own.
+func (be *xtrabackupEngine) ExecuteVerify(bh backupstorage.BackupHandle, manifest []byte, verifyConcurrency int, bandwidthLimit int64) error {
+	var bm xtrabackupManifest
+	if err := json.Unmarshal(manifest, &bm); err != nil {
+		return fmt.Errorf("cannot JSON decode %v: %v", backupManifest, err)
+	}
+
+	sema := sync2.NewSemaphore(verifyConcurrency, 0)
+	limiter := newBandwidthLimiter(bandwidthLimit)
+	rec := concurrency.AllErrorRecorder{}
+	wg := sync.WaitGroup{}
+	mismatched := make([]bool, bm.NumStripes)
+	for i := 0; i < bm.NumStripes; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			sema.Acquire()
+			defer sema.Release()
+
+			name := xtrabackupStripeName(bm.FileName, i)
+			rc, err := bh.ReadFile(name)
+			if err != nil {
+				rec.RecordError(err)
+				return
+			}
+			defer rc.Close()
+			// a corrupted stripe may not decompress
+			h := newStripeHashers()
+			decompressor, err := newDecompressor(restoreCompressionEngine(bm.CompressionEngine), io.TeeReader(&limitedReader{r: rc, limiter: limiter}, h))
+			if err == nil {
+				defer decompressor.Close()
+				_, err = io.Copy(ioutil.Discard, decompressor)
+			}
+			if err != nil {
+				log.Errorf("cannot read stripe %v: %v", name, err)
+				mismatched[i] = true
+				return
+			}
+			mismatched[i] = !h.matches(&bm, i)
+		}(i)
+	}
+	wg.Wait()
+	if rec.HasErrors() {
+		return rec.Error()
+	}
+	var files []string
+	for i, m := range mismatched {
+		if m {
+			files = append(files, xtrabackupStripeName(bm.FileName, i))
+		}
+	}
+	if len(files) > 0 {
+		return &BackupCorruptionError{Files: files}
+	}
+	return nil
+}
+
+// removeDirectoryContents removes everything in a directory, but keeps
+// the directory.
+func removeDirectoryContents(dir string) error {
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	for _, fi := range fis {
+		if err := os.RemoveAll(path.Join(dir, fi.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ShouldDrainForBackup is part of the BackupEngine interface. The
+// backup is taken while mysqld is running, so the tablet can keep
+// serving.
+func (be *xtrabackupEngine) ShouldDrainForBackup() bool {
+	return false
+}
+
+// backupStripes compresses and writes the stripes of a backup, each
+// in its own go routine.
+type backupStripes struct {
+	compressionEngine string
+	pipes             []*io.PipeWriter
+	hashes            []string
+	sha256s           []string
+	wg                sync.WaitGroup
+	rec               concurrency.AllErrorRecorder
+}
+
+func newBackupStripes(bh backupstorage.BackupHandle, fileName string, count int, compressionEngine string) (*backupStripes, error) {
+	bs := &backupStripes{
+		compressionEngine: compressionEngine,
+		pipes:             make([]*io.PipeWriter, count),
+		hashes:            make([]string, count),
+		sha256s:           make([]string, count),
+	}
+	for i := 0; i < count; i++ {
+		wc, err := bh.AddFile(xtrabackupStripeName(fileName, i))
+		if err != nil {
+			err = fmt.Errorf("cannot add file: %v", err)
+			bs.abort(err)
+			return nil, err
+		}
+		pr, pw := io.Pipe()
+		bs.pipes[i] = pw
+		bs.wg.Add(1)
+		go func(i int, wc io.WriteCloser) {
+			defer bs.wg.Done()
+			err := bs.writeStripe(i, pr, wc)
+			if err != nil {
+				bs.rec.RecordError(err)
+			}
+			// unblock the writer if we stopped early
+			pr.CloseWithError(err)
+		}(i, wc)
+	}
+	return bs, nil
+}
+
+func (bs *backupStripes) writeStripe(i int, r io.Reader, wc io.WriteCloser) error {
+	defer wc.Close()
+	dst := bufio.NewWriterSize(wc, 2*1024*1024)
+	hashers := newStripeHashers()
+	compressor, err := newCompressor(bs.compressionEngine, io.MultiWriter(dst, hashers))
+	if err != nil {
+		return fmt.Errorf("cannot create compressor: %v", err)
+	}
+	if _, err := io.Copy(compressor, r); err != nil {
+		compressor.Close()
+		return fmt.Errorf("cannot copy data to stripe %v: %v", i, err)
+	}
+	if err := compressor.Close(); err != nil {
+		return fmt.Errorf("cannot close compressor for stripe %v: %v", i, err)
+	}
+	if err := dst.Flush(); err != nil {
+		return fmt.Errorf("cannot flush stripe %v: %v", i, err)
+	}
+	bs.hashes[i] = hashers.hasher.HashString()
+	bs.sha256s[i] = hex.EncodeToString(hashers.sha.Sum(nil))
+	return nil
+}
+
+// writers returns the writers to send the stripes data to.
+func (bs *backupStripes) writers() []io.Writer {
+	result := make([]io.Writer, len(bs.pipes))
+	for i, pw := range bs.pipes {
+		result[i] = pw
+	}
+	return result
+}
+
+// abort stops writing the stripes.
+func (bs *backupStripes) abort(err error) {
+	for _, pw := range bs.pipes {
+		if pw != nil {
+			pw.CloseWithError(err)
+		}
+	}
+}
+
+// close finishes writing the stripes, and returns their hashes and
+// SHA256.
+func (bs *backupStripes) close() ([]string, []string, error) {
+	for _, pw := range bs.pipes {
+		pw.Close()
+	}
+	bs.wg.Wait()
+	if bs.rec.HasErrors() {
+		return nil, nil, bs.rec.Error()
+	}
+	return bs.hashes, bs.sha256s, nil
+}
+
+// stripedWriter writes blockSize bytes to each of its writers in turn.
+type stripedWriter struct {
+	writers   []io.Writer
+	blockSize int
+	current   int
+	offset    int
+}
+
+func newStripedWriter(writers []io.Writer, blockSize int) *stripedWriter {
+	return &stripedWriter{
+		writers:   writers,
+		blockSize: blockSize,
+	}
+}
+
+// Write is part of the io.Writer interface
+func (sw *stripedWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n := sw.blockSize - sw.offset
+		if n > len(p) {
+			n = len(p)
+		}
+		if _, err := sw.writers[sw.current].Write(p[:n]); err != nil {
+			return written, err
+		}
+		written += n
+		p = p[n:]
+		sw.offset += n
+		if sw.offset == sw.blockSize {
+			sw.offset = 0
+			sw.current = (sw.current + 1) % len(sw.writers)
+		}
+	}
+	return written, nil
+}
+
+// stripedReader reads blockSize bytes from each of its readers in
+// turn. The stream ends when the current reader ends.
+type stripedReader struct {
+	readers   []io.Reader
+	blockSize int
+	current   int
+	offset    int
+}
+
+func newStripedReader(readers []io.Reader, blockSize int) *stripedReader {
+	return &stripedReader{
+		readers:   readers,
+		blockSize: blockSize,
+	}
+}
+
+// Read is part of the io.Reader interface
+func (sr *stripedReader) Read(p []byte) (int, error) {
+	if remaining := sr.blockSize - sr.offset; len(p) > remaining {
+		p = p[:remaining]
+	}
+	n, err := sr.readers[sr.current].Read(p)
+	sr.offset += n
+	if sr.offset == sr.blockSize {
+		sr.offset = 0
+		sr.current = (sr.current + 1) % len(sr.readers)
+	}
+	if err == io.EOF && n > 0 {
+		// we'll get the EOF again on the next read
+		err = nil
+	}
+	return n, err
+}
+
+func init() {
+	BackupEngineMap[xtrabackupEngineName] = &xtrabackupEngine{}
+}
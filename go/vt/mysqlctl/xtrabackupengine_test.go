@@ -0,0 +1,90 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mysqlctl
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"testing"
+)
+
+func TestStripes(t *testing.T) {
+	data := make([]byte, 10000)
+	for i := range data {
+		data[i] = byte(rand.Intn(256))
+	}
+
+	for _, tc := range []struct{ stripes, blockSize, size int }{
+		{1, 100, 10000},
+		{3, 100, 10000},
+		{3, 100, 900},
+		{3, 100, 950},
+		{4, 7, 9999},
+		{2, 20000, 10000},
+		{3, 100, 0},
+	} {
+		buffers := make([]*bytes.Buffer, tc.stripes)
+		writers := make([]io.Writer, tc.stripes)
+		for i := range buffers {
+			buffers[i] = &bytes.Buffer{}
+			writers[i] = buffers[i]
+		}
+		// copy in odd sized chunks, so writes cross blocks
+		sw := newStripedWriter(writers, tc.blockSize)
+		for start := 0; start < tc.size; start += 333 {
+			end := start + 333
+			if end > tc.size {
+				end = tc.size
+			}
+			if _, err := sw.Write(data[start:end]); err != nil {
+				t.Fatalf("Write failed: %v", err)
+			}
+		}
+
+		readers := make([]io.Reader, tc.stripes)
+		for i, b := range buffers {
+			readers[i] = b
+		}
+		got, err := ioutil.ReadAll(newStripedReader(readers, tc.blockSize))
+		if err != nil {
+			t.Fatalf("ReadAll failed: %v", err)
+		}
+		if !bytes.Equal(got, data[:tc.size]) {
+			t.Errorf("stripes %v, block size %v, size %v: got back %v bytes that don't match", tc.stripes, tc.blockSize, tc.size, len(got))
+		}
+	}
+}
+
+func TestFindXtrabackupReplicationPosition(t *testing.T) {
+	output := `xtrabackup: Transaction log of lsn (1597586) to (1597595) was copied.
+MySQL binlog position: filename 'vt-0000062344-bin.000001', position '1234', GTID of the last change '0-41983-1'
+completed OK!
+`
+	pos, err := findXtrabackupReplicationPosition(output, mariadbFlavorID)
+	if err != nil {
+		t.Fatalf("findXtrabackupReplicationPosition failed: %v", err)
+	}
+	if got, want := pos.String(), "0-41983-1"; got != want {
+		t.Errorf("got position %v, want %v", got, want)
+	}
+
+	// MySQL 5.6 GTID sets can span multiple lines
+	output = `MySQL binlog position: filename 'mysql-bin.000003', position '154', GTID of the last change '00010203-0405-0607-0809-0a0b0c0d0e0f:1-5,
+00010203-0405-0607-0809-0a0b0c0d0e10:1-3'
+`
+	pos, err = findXtrabackupReplicationPosition(output, mysql56FlavorID)
+	if err != nil {
+		t.Fatalf("findXtrabackupReplicationPosition failed: %v", err)
+	}
+	if got, want := pos.String(), "00010203-0405-0607-0809-0a0b0c0d0e0f:1-5,00010203-0405-0607-0809-0a0b0c0d0e10:1-3"; got != want {
+		t.Errorf("got position %v, want %v", got, want)
+	}
+
+	if _, err := findXtrabackupReplicationPosition("completed OK!", mariadbFlavorID); err == nil {
+		t.Errorf("findXtrabackupReplicationPosition should have failed without a position")
+	}
+}
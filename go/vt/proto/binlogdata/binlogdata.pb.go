@@ -0,0 +1,408 @@
+// Code generated by protoc-gen-go.
+// source: binlogdata.proto
+// DO NOT EDIT!
+
+/*
+Package binlogdata is a generated protocol buffer package.
+
+It is generated from these files:
+	binlogdata.proto
+
+It has these top-level messages:
+	Charset
+	BinlogTransaction
+	KeyRange
+	StreamKeyRangeRequest
+	StreamKeyRangeResponse
+	StreamTablesRequest
+	StreamTablesResponse
+*/
+package binlogdata
+
+import proto "github.com/golang/protobuf/proto"
+
+import (
+	context "golang.org/x/net/context"
+	grpc "google.golang.org/grpc"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConn
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+
+// KeyspaceIdType describes the type of the sharding key of a keyspace.
+type KeyspaceIdType int32
+
+const (
+	KeyspaceIdType_UNSET  KeyspaceIdType = 0
+	KeyspaceIdType_UINT64 KeyspaceIdType = 1
+	KeyspaceIdType_BYTES  KeyspaceIdType = 2
+)
+
+var KeyspaceIdType_name = map[int32]string{
+	0: "UNSET",
+	1: "UINT64",
+	2: "BYTES",
+}
+var KeyspaceIdType_value = map[string]int32{
+	"UNSET":  0,
+	"UINT64": 1,
+	"BYTES":  2,
+}
+
+func (x KeyspaceIdType) String() string {
+	return proto.EnumName(KeyspaceIdType_name, int32(x))
+}
+
+type BinlogTransaction_Statement_Category int32
+
+const (
+	BinlogTransaction_Statement_BL_UNRECOGNIZED BinlogTransaction_Statement_Category = 0
+	BinlogTransaction_Statement_BL_BEGIN        BinlogTransaction_Statement_Category = 1
+	BinlogTransaction_Statement_BL_COMMIT       BinlogTransaction_Statement_Category = 2
+	BinlogTransaction_Statement_BL_ROLLBACK     BinlogTransaction_Statement_Category = 3
+	BinlogTransaction_Statement_BL_DML          BinlogTransaction_Statement_Category = 4
+	BinlogTransaction_Statement_BL_DDL          BinlogTransaction_Statement_Category = 5
+	BinlogTransaction_Statement_BL_SET          BinlogTransaction_Statement_Category = 6
+)
+
+var BinlogTransaction_Statement_Category_name = map[int32]string{
+	0: "BL_UNRECOGNIZED",
+	1: "BL_BEGIN",
+	2: "BL_COMMIT",
+	3: "BL_ROLLBACK",
+	4: "BL_DML",
+	5: "BL_DDL",
+	6: "BL_SET",
+}
+var BinlogTransaction_Statement_Category_value = map[string]int32{
+	"BL_UNRECOGNIZED": 0,
+	"BL_BEGIN":        1,
+	"BL_COMMIT":       2,
+	"BL_ROLLBACK":     3,
+	"BL_DML":          4,
+	"BL_DDL":          5,
+	"BL_SET":          6,
+}
+
+func (x BinlogTransaction_Statement_Category) String() string {
+	return proto.EnumName(BinlogTransaction_Statement_Category_name, int32(x))
+}
+
+// Charset is the per-statement charset info from a QUERY_EVENT binlog entry.
+type Charset struct {
+	// @@session.character_set_client
+	Client int32 `protobuf:"varint,1,opt,name=client" json:"client,omitempty"`
+	// @@session.collation_connection
+	Conn int32 `protobuf:"varint,2,opt,name=conn" json:"conn,omitempty"`
+	// @@session.collation_server
+	Server int32 `protobuf:"varint,3,opt,name=server" json:"server,omitempty"`
+}
+
+func (m *Charset) Reset()         { *m = Charset{} }
+func (m *Charset) String() string { return proto.CompactTextString(m) }
+func (*Charset) ProtoMessage()    {}
+
+// BinlogTransaction describes a transaction inside the binlogs.
+type BinlogTransaction struct {
+	// the statements in this transaction
+	Statements []*BinlogTransaction_Statement `protobuf:"bytes,1,rep,name=statements" json:"statements,omitempty"`
+	// the timestamp of the statements
+	Timestamp int64 `protobuf:"varint,2,opt,name=timestamp" json:"timestamp,omitempty"`
+	// the Global Transaction ID after this statement, encoded with
+	// its flavor, e.g. "MariaDB/0-41983-1".
+	Gtid string `protobuf:"bytes,3,opt,name=gtid" json:"gtid,omitempty"`
+}
+
+func (m *BinlogTransaction) Reset()         { *m = BinlogTransaction{} }
+func (m *BinlogTransaction) String() string { return proto.CompactTextString(m) }
+func (*BinlogTransaction) ProtoMessage()    {}
+
+func (m *BinlogTransaction) GetStatements() []*BinlogTransaction_Statement {
+	if m != nil {
+		return m.Statements
+	}
+	return nil
+}
+
+type BinlogTransaction_Statement struct {
+	// what type of statement is this?
+	Category BinlogTransaction_Statement_Category `protobuf:"varint,1,opt,name=category,enum=binlogdata.BinlogTransaction_Statement_Category" json:"category,omitempty"`
+	// charset of this statement, if different from pre-negotiated default.
+	Charset *Charset `protobuf:"bytes,2,opt,name=charset" json:"charset,omitempty"`
+	// the sql
+	Sql []byte `protobuf:"bytes,3,opt,name=sql,proto3" json:"sql,omitempty"`
+}
+
+func (m *BinlogTransaction_Statement) Reset()         { *m = BinlogTransaction_Statement{} }
+func (m *BinlogTransaction_Statement) String() string { return proto.CompactTextString(m) }
+func (*BinlogTransaction_Statement) ProtoMessage()    {}
+
+func (m *BinlogTransaction_Statement) GetCharset() *Charset {
+	if m != nil {
+		return m.Charset
+	}
+	return nil
+}
+
+// KeyRange describes a range of sharding keys, [start, end).
+type KeyRange struct {
+	Start []byte `protobuf:"bytes,1,opt,name=start,proto3" json:"start,omitempty"`
+	End   []byte `protobuf:"bytes,2,opt,name=end,proto3" json:"end,omitempty"`
+}
+
+func (m *KeyRange) Reset()         { *m = KeyRange{} }
+func (m *KeyRange) String() string { return proto.CompactTextString(m) }
+func (*KeyRange) ProtoMessage()    {}
+
+// StreamKeyRangeRequest is the payload to StreamKeyRange
+type StreamKeyRangeRequest struct {
+	// where to start, encoded with its flavor
+	Position string `protobuf:"bytes,1,opt,name=position" json:"position,omitempty"`
+	// type to get keyspace ids
+	KeyspaceIdType KeyspaceIdType `protobuf:"varint,2,opt,name=keyspace_id_type,enum=binlogdata.KeyspaceIdType" json:"keyspace_id_type,omitempty"`
+	// what to get
+	KeyRange *KeyRange `protobuf:"bytes,3,opt,name=key_range" json:"key_range,omitempty"`
+	// default charset on the player side
+	Charset *Charset `protobuf:"bytes,4,opt,name=charset" json:"charset,omitempty"`
+	// sharding column of the keyspace, to get the keyspace ids of
+	// the rows in row based replication
+	ShardingColumnName string `protobuf:"bytes,5,opt,name=sharding_column_name" json:"sharding_column_name,omitempty"`
+}
+
+func (m *StreamKeyRangeRequest) Reset()         { *m = StreamKeyRangeRequest{} }
+func (m *StreamKeyRangeRequest) String() string { return proto.CompactTextString(m) }
+func (*StreamKeyRangeRequest) ProtoMessage()    {}
+
+func (m *StreamKeyRangeRequest) GetKeyRange() *KeyRange {
+	if m != nil {
+		return m.KeyRange
+	}
+	return nil
+}
+
+func (m *StreamKeyRangeRequest) GetCharset() *Charset {
+	if m != nil {
+		return m.Charset
+	}
+	return nil
+}
+
+// StreamKeyRangeResponse is the response from StreamKeyRange
+type StreamKeyRangeResponse struct {
+	BinlogTransaction *BinlogTransaction `protobuf:"bytes,1,opt,name=binlog_transaction" json:"binlog_transaction,omitempty"`
+}
+
+func (m *StreamKeyRangeResponse) Reset()         { *m = StreamKeyRangeResponse{} }
+func (m *StreamKeyRangeResponse) String() string { return proto.CompactTextString(m) }
+func (*StreamKeyRangeResponse) ProtoMessage()    {}
+
+func (m *StreamKeyRangeResponse) GetBinlogTransaction() *BinlogTransaction {
+	if m != nil {
+		return m.BinlogTransaction
+	}
+	return nil
+}
+
+// StreamTablesRequest is the payload to StreamTables
+type StreamTablesRequest struct {
+	// where to start, encoded with its flavor
+	Position string `protobuf:"bytes,1,opt,name=position" json:"position,omitempty"`
+	// what to get
+	Tables []string `protobuf:"bytes,2,rep,name=tables" json:"tables,omitempty"`
+	// default charset on the player side
+	Charset *Charset `protobuf:"bytes,3,opt,name=charset" json:"charset,omitempty"`
+}
+
+func (m *StreamTablesRequest) Reset()         { *m = StreamTablesRequest{} }
+func (m *StreamTablesRequest) String() string { return proto.CompactTextString(m) }
+func (*StreamTablesRequest) ProtoMessage()    {}
+
+func (m *StreamTablesRequest) GetCharset() *Charset {
+	if m != nil {
+		return m.Charset
+	}
+	return nil
+}
+
+// StreamTablesResponse is the response from StreamTables
+type StreamTablesResponse struct {
+	BinlogTransaction *BinlogTransaction `protobuf:"bytes,1,opt,name=binlog_transaction" json:"binlog_transaction,omitempty"`
+}
+
+func (m *StreamTablesResponse) Reset()         { *m = StreamTablesResponse{} }
+func (m *StreamTablesResponse) String() string { return proto.CompactTextString(m) }
+func (*StreamTablesResponse) ProtoMessage()    {}
+
+func (m *StreamTablesResponse) GetBinlogTransaction() *BinlogTransaction {
+	if m != nil {
+		return m.BinlogTransaction
+	}
+	return nil
+}
+
+func init() {
+	proto.RegisterEnum("binlogdata.KeyspaceIdType", KeyspaceIdType_name, KeyspaceIdType_value)
+	proto.RegisterEnum("binlogdata.BinlogTransaction_Statement_Category", BinlogTransaction_Statement_Category_name, BinlogTransaction_Statement_Category_value)
+}
+
+// Client API for UpdateStream service
+
+type UpdateStreamClient interface {
+	// StreamKeyRange returns the binlog transactions related to
+	// the specified Keyrange.
+	StreamKeyRange(ctx context.Context, in *StreamKeyRangeRequest, opts ...grpc.CallOption) (UpdateStream_StreamKeyRangeClient, error)
+	// StreamTables returns the binlog transactions related to
+	// the specified Tables.
+	StreamTables(ctx context.Context, in *StreamTablesRequest, opts ...grpc.CallOption) (UpdateStream_StreamTablesClient, error)
+}
+
+type updateStreamClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewUpdateStreamClient(cc *grpc.ClientConn) UpdateStreamClient {
+	return &updateStreamClient{cc}
+}
+
+func (c *updateStreamClient) StreamKeyRange(ctx context.Context, in *StreamKeyRangeRequest, opts ...grpc.CallOption) (UpdateStream_StreamKeyRangeClient, error) {
+	stream, err := grpc.NewClientStream(ctx, &_UpdateStream_serviceDesc.Streams[0], c.cc, "/binlogdata.UpdateStream/StreamKeyRange", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &updateStreamStreamKeyRangeClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type UpdateStream_StreamKeyRangeClient interface {
+	Recv() (*StreamKeyRangeResponse, error)
+	grpc.ClientStream
+}
+
+type updateStreamStreamKeyRangeClient struct {
+	grpc.ClientStream
+}
+
+func (x *updateStreamStreamKeyRangeClient) Recv() (*StreamKeyRangeResponse, error) {
+	m := new(StreamKeyRangeResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *updateStreamClient) StreamTables(ctx context.Context, in *StreamTablesRequest, opts ...grpc.CallOption) (UpdateStream_StreamTablesClient, error) {
+	stream, err := grpc.NewClientStream(ctx, &_UpdateStream_serviceDesc.Streams[1], c.cc, "/binlogdata.UpdateStream/StreamTables", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &updateStreamStreamTablesClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type UpdateStream_StreamTablesClient interface {
+	Recv() (*StreamTablesResponse, error)
+	grpc.ClientStream
+}
+
+type updateStreamStreamTablesClient struct {
+	grpc.ClientStream
+}
+
+func (x *updateStreamStreamTablesClient) Recv() (*StreamTablesResponse, error) {
+	m := new(StreamTablesResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Server API for UpdateStream service
+
+type UpdateStreamServer interface {
+	// StreamKeyRange returns the binlog transactions related to
+	// the specified Keyrange.
+	StreamKeyRange(*StreamKeyRangeRequest, UpdateStream_StreamKeyRangeServer) error
+	// StreamTables returns the binlog transactions related to
+	// the specified Tables.
+	StreamTables(*StreamTablesRequest, UpdateStream_StreamTablesServer) error
+}
+
+func RegisterUpdateStreamServer(s *grpc.Server, srv UpdateStreamServer) {
+	s.RegisterService(&_UpdateStream_serviceDesc, srv)
+}
+
+func _UpdateStream_StreamKeyRange_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(StreamKeyRangeRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(UpdateStreamServer).StreamKeyRange(m, &updateStreamStreamKeyRangeServer{stream})
+}
+
+type UpdateStream_StreamKeyRangeServer interface {
+	Send(*StreamKeyRangeResponse) error
+	grpc.ServerStream
+}
+
+type updateStreamStreamKeyRangeServer struct {
+	grpc.ServerStream
+}
+
+func (x *updateStreamStreamKeyRangeServer) Send(m *StreamKeyRangeResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _UpdateStream_StreamTables_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(StreamTablesRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(UpdateStreamServer).StreamTables(m, &updateStreamStreamTablesServer{stream})
+}
+
+type UpdateStream_StreamTablesServer interface {
+	Send(*StreamTablesResponse) error
+	grpc.ServerStream
+}
+
+type updateStreamStreamTablesServer struct {
+	grpc.ServerStream
+}
+
+func (x *updateStreamStreamTablesServer) Send(m *StreamTablesResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+var _UpdateStream_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "binlogdata.UpdateStream",
+	HandlerType: (*UpdateStreamServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamKeyRange",
+			Handler:       _UpdateStream_StreamKeyRange_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "StreamTables",
+			Handler:       _UpdateStream_StreamTables_Handler,
+			ServerStreams: true,
+		},
+	},
+}
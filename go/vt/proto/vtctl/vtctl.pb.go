@@ -10,6 +10,8 @@ It is generated from these files:
 
 It has these top-level messages:
 	ExecuteVtctlCommandArgs
+	SubmitVtctlCommandReply
+	WaitForJobArgs
 	Time
 	LoggerEvent
 */
@@ -41,6 +43,25 @@ func (m *ExecuteVtctlCommandArgs) Reset()         { *m = ExecuteVtctlCommandArgs
 func (m *ExecuteVtctlCommandArgs) String() string { return proto.CompactTextString(m) }
 func (*ExecuteVtctlCommandArgs) ProtoMessage()    {}
 
+// SubmitVtctlCommandReply is returned by SubmitVtctlCommand, with the
+// id of the job running the command.
+type SubmitVtctlCommandReply struct {
+	JobId int64 `protobuf:"varint,1,opt,name=job_id" json:"job_id,omitempty"`
+}
+
+func (m *SubmitVtctlCommandReply) Reset()         { *m = SubmitVtctlCommandReply{} }
+func (m *SubmitVtctlCommandReply) String() string { return proto.CompactTextString(m) }
+func (*SubmitVtctlCommandReply) ProtoMessage()    {}
+
+// WaitForJobArgs arguments to WaitForJob
+type WaitForJobArgs struct {
+	JobId int64 `protobuf:"varint,1,opt,name=job_id" json:"job_id,omitempty"`
+}
+
+func (m *WaitForJobArgs) Reset()         { *m = WaitForJobArgs{} }
+func (m *WaitForJobArgs) String() string { return proto.CompactTextString(m) }
+func (*WaitForJobArgs) ProtoMessage()    {}
+
 // Time represents a time stamp in nanoseconds. In go, use time.Unix to
 // rebuild the Time value, and t.Unix() / t.Nanosecond() to generate.
 type Time struct {
@@ -52,7 +73,7 @@ func (m *Time) Reset()         { *m = Time{} }
 func (m *Time) String() string { return proto.CompactTextString(m) }
 func (*Time) ProtoMessage()    {}
 
-// Streamed by ExecuteVtctlCommand
+// Streamed by ExecuteVtctlCommand and WaitForJob
 type LoggerEvent struct {
 	Time  *Time  `protobuf:"bytes,1,opt,name=time" json:"time,omitempty"`
 	Level int64  `protobuf:"varint,2,opt,name=level" json:"level,omitempty"`
@@ -79,6 +100,13 @@ func init() {
 
 type VtctlClient interface {
 	ExecuteVtctlCommand(ctx context.Context, in *ExecuteVtctlCommandArgs, opts ...grpc.CallOption) (Vtctl_ExecuteVtctlCommandClient, error)
+	// SubmitVtctlCommand starts a vt command in the background, and
+	// returns right away. The command keeps running if the client goes
+	// away.
+	SubmitVtctlCommand(ctx context.Context, in *ExecuteVtctlCommandArgs, opts ...grpc.CallOption) (*SubmitVtctlCommandReply, error)
+	// WaitForJob streams the logs of a command started by
+	// SubmitVtctlCommand until it is done, and fails if it failed.
+	WaitForJob(ctx context.Context, in *WaitForJobArgs, opts ...grpc.CallOption) (Vtctl_WaitForJobClient, error)
 }
 
 type vtctlClient struct {
@@ -121,10 +149,58 @@ func (x *vtctlExecuteVtctlCommandClient) Recv() (*LoggerEvent, error) {
 	return m, nil
 }
 
+func (c *vtctlClient) SubmitVtctlCommand(ctx context.Context, in *ExecuteVtctlCommandArgs, opts ...grpc.CallOption) (*SubmitVtctlCommandReply, error) {
+	out := new(SubmitVtctlCommandReply)
+	err := grpc.Invoke(ctx, "/vtctl.Vtctl/SubmitVtctlCommand", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *vtctlClient) WaitForJob(ctx context.Context, in *WaitForJobArgs, opts ...grpc.CallOption) (Vtctl_WaitForJobClient, error) {
+	stream, err := grpc.NewClientStream(ctx, &_Vtctl_serviceDesc.Streams[1], c.cc, "/vtctl.Vtctl/WaitForJob", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &vtctlWaitForJobClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Vtctl_WaitForJobClient interface {
+	Recv() (*LoggerEvent, error)
+	grpc.ClientStream
+}
+
+type vtctlWaitForJobClient struct {
+	grpc.ClientStream
+}
+
+func (x *vtctlWaitForJobClient) Recv() (*LoggerEvent, error) {
+	m := new(LoggerEvent)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 // Server API for Vtctl service
 
 type VtctlServer interface {
 	ExecuteVtctlCommand(*ExecuteVtctlCommandArgs, Vtctl_ExecuteVtctlCommandServer) error
+	// SubmitVtctlCommand starts a vt command in the background, and
+	// returns right away. The command keeps running if the client goes
+	// away.
+	SubmitVtctlCommand(context.Context, *ExecuteVtctlCommandArgs) (*SubmitVtctlCommandReply, error)
+	// WaitForJob streams the logs of a command started by
+	// SubmitVtctlCommand until it is done, and fails if it failed.
+	WaitForJob(*WaitForJobArgs, Vtctl_WaitForJobServer) error
 }
 
 func RegisterVtctlServer(s *grpc.Server, srv VtctlServer) {
@@ -152,15 +228,58 @@ func (x *vtctlExecuteVtctlCommandServer) Send(m *LoggerEvent) error {
 	return x.ServerStream.SendMsg(m)
 }
 
+func _Vtctl_SubmitVtctlCommand_Handler(srv interface{}, ctx context.Context, codec grpc.Codec, buf []byte) (interface{}, error) {
+	in := new(ExecuteVtctlCommandArgs)
+	if err := codec.Unmarshal(buf, in); err != nil {
+		return nil, err
+	}
+	out, err := srv.(VtctlServer).SubmitVtctlCommand(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func _Vtctl_WaitForJob_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WaitForJobArgs)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(VtctlServer).WaitForJob(m, &vtctlWaitForJobServer{stream})
+}
+
+type Vtctl_WaitForJobServer interface {
+	Send(*LoggerEvent) error
+	grpc.ServerStream
+}
+
+type vtctlWaitForJobServer struct {
+	grpc.ServerStream
+}
+
+func (x *vtctlWaitForJobServer) Send(m *LoggerEvent) error {
+	return x.ServerStream.SendMsg(m)
+}
+
 var _Vtctl_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "vtctl.Vtctl",
 	HandlerType: (*VtctlServer)(nil),
-	Methods:     []grpc.MethodDesc{},
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "SubmitVtctlCommand",
+			Handler:    _Vtctl_SubmitVtctlCommand_Handler,
+		},
+	},
 	Streams: []grpc.StreamDesc{
 		{
 			StreamName:    "ExecuteVtctlCommand",
 			Handler:       _Vtctl_ExecuteVtctlCommand_Handler,
 			ServerStreams: true,
 		},
+		{
+			StreamName:    "WaitForJob",
+			Handler:       _Vtctl_WaitForJob_Handler,
+			ServerStreams: true,
+		},
 	},
 }
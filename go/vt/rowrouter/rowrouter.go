@@ -0,0 +1,172 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package rowrouter computes the keyspace id of the rows of a sharded
+// keyspace from their sharding column, and the shard they belong to.
+// vtworker uses it to split the rows it copies between the destination
+// shards, and the binlog streamer to tag the rows of row based
+// replication with their keyspace id.
+package rowrouter
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/youtube/vitess/go/sqltypes"
+	"github.com/youtube/vitess/go/vt/key"
+	"github.com/youtube/vitess/go/vt/topo"
+)
+
+// KeyspaceId returns the keyspace id of a value of the sharding column:
+// the big endian bytes of the unsigned number for key.KIT_UINT64, and
+// the value itself for key.KIT_BYTES.
+func KeyspaceId(kit key.KeyspaceIdType, value sqltypes.Value) (key.KeyspaceId, error) {
+	if value.IsNull() {
+		return "", fmt.Errorf("value is NULL")
+	}
+	switch kit {
+	case key.KIT_UINT64:
+		i, err := strconv.ParseUint(string(value.Raw()), 10, 64)
+		if err != nil {
+			return "", fmt.Errorf("non numerical value: %v", err)
+		}
+		return key.Uint64Key(i).KeyspaceId(), nil
+	case key.KIT_BYTES:
+		return key.KeyspaceId(value.Raw()), nil
+	}
+	return "", fmt.Errorf("unsupported keyspace id type %q", kit)
+}
+
+// Router routes the rows of the tables of a keyspace to its shards.
+// It is safe for concurrent use.
+type Router struct {
+	kit            key.KeyspaceIdType
+	shardingColumn string
+	shards         []*topo.ShardInfo
+
+	// mu protects tables
+	mu sync.Mutex
+	// tables caches the routing of each table
+	tables map[string]*Table
+}
+
+// NewRouter returns a Router for the rows of a keyspace, using its
+// sharding column, to the given shards. The key ranges of the shards
+// can't overlap, but they don't have to cover all the keyspace ids.
+func NewRouter(ki *topo.KeyspaceInfo, shards []*topo.ShardInfo) (*Router, error) {
+	if ki.ShardingColumnName == "" {
+		return nil, fmt.Errorf("keyspace %v has no sharding column", ki.KeyspaceName())
+	}
+	if ki.ShardingColumnType != key.KIT_UINT64 && ki.ShardingColumnType != key.KIT_BYTES {
+		return nil, fmt.Errorf("keyspace %v has an unsupported sharding column type %q", ki.KeyspaceName(), ki.ShardingColumnType)
+	}
+	for i, si := range shards {
+		for _, other := range shards[:i] {
+			if key.KeyRangesIntersect(si.KeyRange, other.KeyRange) {
+				return nil, fmt.Errorf("shards %v and %v overlap", other.ShardName(), si.ShardName())
+			}
+		}
+	}
+	return &Router{
+		kit:            ki.ShardingColumnType,
+		shardingColumn: ki.ShardingColumnName,
+		shards:         shards,
+		tables:         make(map[string]*Table),
+	}, nil
+}
+
+// Shards returns the shards the rows are routed to, in the order of the
+// indexes the Router returns.
+func (r *Router) Shards() []*topo.ShardInfo {
+	return r.shards
+}
+
+// ShardIndex returns the index of the shard a keyspace id belongs to.
+// The start of a key range is included in it, its end is not.
+func (r *Router) ShardIndex(kid key.KeyspaceId) (int, error) {
+	for i, si := range r.shards {
+		if si.KeyRange.Contains(kid) {
+			return i, nil
+		}
+	}
+	return -1, fmt.Errorf("keyspace id %v is in none of the shards", kid.Hex())
+}
+
+// Table returns the routing of the rows of a table, whose columns are
+// in the given order. It is computed once per table, and again if its
+// columns change.
+func (r *Router) Table(name string, columns []string) (*Table, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if t, ok := r.tables[name]; ok && sameColumns(t.columns, columns) {
+		return t, nil
+	}
+	for i, column := range columns {
+		if column == r.shardingColumn {
+			t := &Table{
+				Name:           name,
+				ShardingColumn: i,
+				router:         r,
+				columns:        append([]string(nil), columns...),
+			}
+			r.tables[name] = t
+			return t, nil
+		}
+	}
+	return nil, fmt.Errorf("table %v doesn't have a column named '%v'", name, r.shardingColumn)
+}
+
+func sameColumns(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Table routes the rows of one table.
+type Table struct {
+	// Name is the name of the table.
+	Name string
+	// ShardingColumn is the index of the sharding column in the rows.
+	ShardingColumn int
+
+	router  *Router
+	columns []string
+}
+
+// Router returns the Router of the table.
+func (t *Table) Router() *Router {
+	return t.router
+}
+
+// KeyspaceId returns the keyspace id of a row.
+func (t *Table) KeyspaceId(row []sqltypes.Value) (key.KeyspaceId, error) {
+	if t.ShardingColumn >= len(row) {
+		return "", fmt.Errorf("row of table %v has %v columns, the sharding column is column %v", t.Name, len(row), t.ShardingColumn)
+	}
+	kid, err := KeyspaceId(t.router.kit, row[t.ShardingColumn])
+	if err != nil {
+		return "", fmt.Errorf("table %v, sharding column %v: %v", t.Name, t.router.shardingColumn, err)
+	}
+	return kid, nil
+}
+
+// ShardIndex returns the index of the shard a row belongs to.
+func (t *Table) ShardIndex(row []sqltypes.Value) (int, error) {
+	kid, err := t.KeyspaceId(row)
+	if err != nil {
+		return -1, err
+	}
+	i, err := t.router.ShardIndex(kid)
+	if err != nil {
+		return -1, fmt.Errorf("table %v: %v", t.Name, err)
+	}
+	return i, nil
+}
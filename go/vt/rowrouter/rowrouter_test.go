@@ -0,0 +1,238 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rowrouter
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/youtube/vitess/go/sqltypes"
+	"github.com/youtube/vitess/go/vt/key"
+	"github.com/youtube/vitess/go/vt/topo"
+)
+
+func keyspaceInfo(kit key.KeyspaceIdType) *topo.KeyspaceInfo {
+	return topo.NewKeyspaceInfo("ks", &topo.Keyspace{
+		ShardingColumnName: "keyspace_id",
+		ShardingColumnType: kit,
+	}, 0)
+}
+
+// shards returns the shards of the given names, each a hex key range.
+func shards(t *testing.T, names ...string) []*topo.ShardInfo {
+	result := make([]*topo.ShardInfo, len(names))
+	for i, name := range names {
+		parts := strings.Split(name, "-")
+		kr, err := key.ParseKeyRangeParts(parts[0], parts[1])
+		if err != nil {
+			t.Fatalf("ParseKeyRangeParts(%v) failed: %v", name, err)
+		}
+		result[i] = topo.NewShardInfo("ks", name, &topo.Shard{KeyRange: kr}, 0)
+	}
+	return result
+}
+
+func newTable(t *testing.T, kit key.KeyspaceIdType, shardNames ...string) *Table {
+	router, err := NewRouter(keyspaceInfo(kit), shards(t, shardNames...))
+	if err != nil {
+		t.Fatalf("NewRouter failed: %v", err)
+	}
+	table, err := router.Table("table1", []string{"id", "keyspace_id"})
+	if err != nil {
+		t.Fatalf("Table failed: %v", err)
+	}
+	return table
+}
+
+func row(value sqltypes.Value) []sqltypes.Value {
+	return []sqltypes.Value{sqltypes.MakeNumeric([]byte("1")), value}
+}
+
+func uint64Row(i uint64) []sqltypes.Value {
+	return row(sqltypes.MakeNumeric([]byte(fmt.Sprintf("%v", i))))
+}
+
+func TestShardIndexUint64(t *testing.T) {
+	table := newTable(t, key.KIT_UINT64, "-40", "40-c0", "c0-")
+	testcases := []struct {
+		value uint64
+		want  int
+	}{
+		{0, 0},
+		{1, 0},
+		{0x3fffffffffffffff, 0},
+		// the start of a key range is in it
+		{0x4000000000000000, 1},
+		{0x4000000000000001, 1},
+		{0xbfffffffffffffff, 1},
+		// and its end is not
+		{0xc000000000000000, 2},
+		{0xffffffffffffffff, 2},
+	}
+	for _, tcase := range testcases {
+		got, err := table.ShardIndex(uint64Row(tcase.value))
+		if err != nil || got != tcase.want {
+			t.Errorf("ShardIndex(%x) = %v, %v, want %v", tcase.value, got, err, tcase.want)
+		}
+	}
+}
+
+func TestShardIndexBytes(t *testing.T) {
+	table := newTable(t, key.KIT_BYTES, "-40", "40-c0", "c0-")
+	testcases := []struct {
+		value string
+		want  int
+	}{
+		{"", 0},
+		{"\x00", 0},
+		{"\x3f", 0},
+		{"\x3f\xff\xff\xff\xff\xff\xff\xff\xff", 0},
+		// the start of a key range is in it, whatever the length
+		{"\x40", 1},
+		{"\x40\x00", 1},
+		{"\x40\x00\x00\x00\x00\x00\x00\x00\x00", 1},
+		{"\xbf\xff\xff\xff\xff\xff\xff\xff\xff", 1},
+		// and its end is not
+		{"\xc0", 2},
+		{"\xc0\x00", 2},
+		{"\xff\xff\xff\xff\xff\xff\xff\xff\xff", 2},
+	}
+	for _, tcase := range testcases {
+		got, err := table.ShardIndex(row(sqltypes.MakeString([]byte(tcase.value))))
+		if err != nil || got != tcase.want {
+			t.Errorf("ShardIndex(%x) = %v, %v, want %v", tcase.value, got, err, tcase.want)
+		}
+	}
+}
+
+func TestShardIndexMultiByteKeyRanges(t *testing.T) {
+	table := newTable(t, key.KIT_UINT64, "-4000", "4000-4001", "4001-")
+	testcases := []struct {
+		value uint64
+		want  int
+	}{
+		{0x3fffffffffffffff, 0},
+		{0x4000000000000000, 1},
+		{0x40000fffffffffff, 1},
+		{0x4000ffffffffffff, 1},
+		{0x4001000000000000, 2},
+	}
+	for _, tcase := range testcases {
+		got, err := table.ShardIndex(uint64Row(tcase.value))
+		if err != nil || got != tcase.want {
+			t.Errorf("ShardIndex(%x) = %v, %v, want %v", tcase.value, got, err, tcase.want)
+		}
+	}
+}
+
+func TestShardIndexOutsideTheShards(t *testing.T) {
+	// a destination subset of the shards, e.g. the destinations of
+	// one source shard
+	table := newTable(t, key.KIT_UINT64, "40-80", "80-c0")
+	for _, value := range []uint64{0, 0x3fffffffffffffff, 0xc000000000000000, 0xffffffffffffffff} {
+		if got, err := table.ShardIndex(uint64Row(value)); err == nil || !strings.Contains(err.Error(), "is in none of the shards") {
+			t.Errorf("ShardIndex(%x) = %v, %v, want error", value, got, err)
+		}
+	}
+	for _, value := range []uint64{0x4000000000000000, 0x7fffffffffffffff, 0x8000000000000000, 0xbfffffffffffffff} {
+		if _, err := table.ShardIndex(uint64Row(value)); err != nil {
+			t.Errorf("ShardIndex(%x) failed: %v", value, err)
+		}
+	}
+}
+
+func TestKeyspaceId(t *testing.T) {
+	testcases := []struct {
+		kit   key.KeyspaceIdType
+		value sqltypes.Value
+		want  key.KeyspaceId
+		err   string
+	}{
+		{key.KIT_UINT64, sqltypes.MakeNumeric([]byte("0")), key.KeyspaceId("\x00\x00\x00\x00\x00\x00\x00\x00"), ""},
+		{key.KIT_UINT64, sqltypes.MakeNumeric([]byte("18446744073709551615")), key.KeyspaceId("\xff\xff\xff\xff\xff\xff\xff\xff"), ""},
+		// values streamed as strings are numbers too
+		{key.KIT_UINT64, sqltypes.MakeString([]byte("4611686018427387904")), key.KeyspaceId("\x40\x00\x00\x00\x00\x00\x00\x00"), ""},
+		{key.KIT_UINT64, sqltypes.MakeNumeric([]byte("18446744073709551616")), "", "non numerical value"},
+		{key.KIT_UINT64, sqltypes.MakeNumeric([]byte("-1")), "", "non numerical value"},
+		{key.KIT_UINT64, sqltypes.MakeString([]byte("abc")), "", "non numerical value"},
+		{key.KIT_UINT64, sqltypes.NULL, "", "value is NULL"},
+		{key.KIT_BYTES, sqltypes.MakeString([]byte("\x40\x01")), key.KeyspaceId("\x40\x01"), ""},
+		{key.KIT_BYTES, sqltypes.MakeString([]byte("")), key.MinKey, ""},
+		{key.KIT_BYTES, sqltypes.NULL, "", "value is NULL"},
+		{key.KIT_UNSET, sqltypes.MakeString([]byte("a")), "", "unsupported keyspace id type"},
+	}
+	for _, tcase := range testcases {
+		got, err := KeyspaceId(tcase.kit, tcase.value)
+		if tcase.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tcase.err) {
+				t.Errorf("KeyspaceId(%v, %v) = %v, %v, want error containing %q", tcase.kit, tcase.value, got, err, tcase.err)
+			}
+			continue
+		}
+		if err != nil || got != tcase.want {
+			t.Errorf("KeyspaceId(%v, %v) = %x, %v, want %x", tcase.kit, tcase.value, got, err, tcase.want)
+		}
+	}
+}
+
+func TestTableKeyspaceIdErrors(t *testing.T) {
+	table := newTable(t, key.KIT_UINT64, "-")
+	_, err := table.KeyspaceId(row(sqltypes.NULL))
+	if want := "table table1, sharding column keyspace_id: value is NULL"; err == nil || err.Error() != want {
+		t.Errorf("KeyspaceId(NULL) = %v, want %v", err, want)
+	}
+	_, err = table.KeyspaceId([]sqltypes.Value{sqltypes.MakeNumeric([]byte("1"))})
+	if want := "row of table table1 has 1 columns"; err == nil || !strings.Contains(err.Error(), want) {
+		t.Errorf("KeyspaceId(short row) = %v, want error containing %q", err, want)
+	}
+}
+
+func TestNewRouterErrors(t *testing.T) {
+	testcases := []struct {
+		ki     *topo.KeyspaceInfo
+		shards []string
+		want   string
+	}{
+		{topo.NewKeyspaceInfo("ks", &topo.Keyspace{}, 0), []string{"-"}, "keyspace ks has no sharding column"},
+		{topo.NewKeyspaceInfo("ks", &topo.Keyspace{ShardingColumnName: "keyspace_id"}, 0), []string{"-"}, "unsupported sharding column type"},
+		{keyspaceInfo(key.KIT_UINT64), []string{"-80", "40-"}, "shards -80 and 40- overlap"},
+		{keyspaceInfo(key.KIT_UINT64), []string{"-", "80-"}, "shards - and 80- overlap"},
+	}
+	for _, tcase := range testcases {
+		if _, err := NewRouter(tcase.ki, shards(t, tcase.shards...)); err == nil || !strings.Contains(err.Error(), tcase.want) {
+			t.Errorf("NewRouter(%v) = %v, want error containing %q", tcase.shards, err, tcase.want)
+		}
+	}
+
+	// adjacent shards don't overlap
+	if _, err := NewRouter(keyspaceInfo(key.KIT_UINT64), shards(t, "-80", "80-")); err != nil {
+		t.Errorf("NewRouter(-80, 80-) failed: %v", err)
+	}
+}
+
+func TestTableCache(t *testing.T) {
+	router, err := NewRouter(keyspaceInfo(key.KIT_UINT64), shards(t, "-80", "80-"))
+	if err != nil {
+		t.Fatalf("NewRouter failed: %v", err)
+	}
+	first, err := router.Table("table1", []string{"id", "keyspace_id"})
+	if err != nil || first.ShardingColumn != 1 {
+		t.Fatalf("Table() = %v, %v, want sharding column 1", first, err)
+	}
+	if second, err := router.Table("table1", []string{"id", "keyspace_id"}); err != nil || second != first {
+		t.Errorf("Table() = %v, %v, want the cached %v", second, err, first)
+	}
+
+	// the columns changed
+	changed, err := router.Table("table1", []string{"keyspace_id", "id", "msg"})
+	if err != nil || changed == first || changed.ShardingColumn != 0 {
+		t.Errorf("Table() = %v, %v, want a new table with sharding column 0", changed, err)
+	}
+
+	if _, err := router.Table("table2", []string{"id", "msg"}); err == nil || err.Error() != "table table2 doesn't have a column named 'keyspace_id'" {
+		t.Errorf("Table(table2) = %v, want error", err)
+	}
+}
@@ -23,6 +23,7 @@ type TabletExecutor struct {
 	tabletInfos []*topo.TabletInfo
 	schemaDiffs []*proto.SchemaChangeResult
 	isClosed    bool
+	allowDrop   bool
 }
 
 // NewTabletExecutor creates a new TabletExecutor instance
@@ -36,6 +37,12 @@ func NewTabletExecutor(
 	}
 }
 
+// AllowDrop makes the executor apply the changes that drop tables,
+// it refuses them by default.
+func (exec *TabletExecutor) AllowDrop() {
+	exec.allowDrop = true
+}
+
 // Open opens a connection to the master for every shard
 func (exec *TabletExecutor) Open(keyspace string) error {
 	if !exec.isClosed {
@@ -133,6 +140,9 @@ func (exec *TabletExecutor) preflightSchemaChanges(sqls []string) error {
 		if err != nil {
 			return err
 		}
+		if schemaDiff.ChangeType == sqlparser.AST_DROP && !exec.allowDrop {
+			return fmt.Errorf("Schema change: '%s' drops tables, it is refused unless drops are allowed.", sqls[i])
+		}
 		exec.schemaDiffs[i] = schemaDiff
 		diffs := proto.DiffSchemaToArray(
 			"BeforeSchema",
@@ -115,3 +115,35 @@ func TestTabletExecutorExecute(t *testing.T) {
 		t.Fatalf("execute should fail, ddl does not introduce any table schema change")
 	}
 }
+
+func TestTabletExecutorExecuteDrop(t *testing.T) {
+	fakeTmc := newFakeTabletManagerClient()
+	sql := "DROP TABLE test_table"
+	fakeTmc.AddSchemaChange(sql, &proto.SchemaChangeResult{
+		BeforeSchema: &proto.SchemaDefinition{
+			TableDefinitions: []*proto.TableDefinition{
+				&proto.TableDefinition{
+					Name:   "test_table",
+					Schema: "table schema",
+					Type:   proto.TableBaseTable,
+				},
+			},
+		},
+		AfterSchema: &proto.SchemaDefinition{},
+		ChangeType:  "drop",
+	})
+	executor := NewTabletExecutor(fakeTmc, newFakeTopo())
+	executor.Open("test_keyspace")
+	defer executor.Close()
+
+	result := executor.Execute([]string{sql})
+	if result.ExecutorErr == "" || len(result.SuccessShards) != 0 {
+		t.Fatalf("execute should refuse the drop, got %+v", result)
+	}
+
+	executor.AllowDrop()
+	result = executor.Execute([]string{sql})
+	if result.ExecutorErr != "" || len(result.FailedShards) != 0 {
+		t.Fatalf("execute should apply the drop once drops are allowed, got %+v", result)
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package servenv
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/event"
+	"github.com/youtube/vitess/go/rpcplus"
+)
+
+// Lameduck is the shutdown sequence of a server that received a
+// SIGTERM. Run first closes the listeners, so no new connection is
+// accepted. It then fires the OnTerm hooks without waiting for them,
+// and the OnTermSync hooks, waiting up to OnTermTimeout for them.
+// Last, the non streaming calls in flight on the RPC servers get what
+// remains of Period to finish. servenv.Run runs the OnClose hooks
+// after it, and the tests can run their own.
+type Lameduck struct {
+	Period        time.Duration
+	OnTermTimeout time.Duration
+
+	// OnTerm and OnTermSync may be nil.
+	OnTerm     *event.Hooks
+	OnTermSync *event.Hooks
+
+	// mu protects the fields below.
+	mu         sync.Mutex
+	listeners  []net.Listener
+	rpcServers []*rpcplus.Server
+}
+
+// AddListener adds a listener to close when Run starts.
+func (ld *Lameduck) AddListener(l net.Listener) {
+	ld.mu.Lock()
+	defer ld.mu.Unlock()
+	ld.listeners = append(ld.listeners, l)
+}
+
+// AddRPCServer adds a server whose calls in flight Run waits for.
+func (ld *Lameduck) AddRPCServer(server *rpcplus.Server) {
+	ld.mu.Lock()
+	defer ld.mu.Unlock()
+	ld.rpcServers = append(ld.rpcServers, server)
+}
+
+// Run runs the shutdown sequence. It returns true iff the OnTermSync
+// hooks and the calls in flight finished in time.
+func (ld *Lameduck) Run() bool {
+	startTime := time.Now()
+	ld.mu.Lock()
+	listeners := ld.listeners
+	rpcServers := ld.rpcServers
+	ld.mu.Unlock()
+
+	log.Infof("Entering lameduck mode for at most %v, closing %v listeners", ld.Period, len(listeners))
+	for _, l := range listeners {
+		l.Close()
+	}
+
+	finished := true
+	if ld.OnTerm != nil {
+		log.Infof("Firing asynchronous OnTerm hooks")
+		go ld.OnTerm.Fire()
+	}
+	if ld.OnTermSync != nil {
+		finished = fireHooks(ld.OnTermSync, ld.OnTermTimeout)
+	}
+
+	remain := ld.Period - time.Since(startTime)
+	log.Infof("Waiting up to %v for the RPCs in flight", remain)
+	done := make(chan struct{})
+	go func() {
+		for _, server := range rpcServers {
+			server.WaitForCalls()
+		}
+		close(done)
+	}()
+	timer := time.NewTimer(remain)
+	defer timer.Stop()
+	select {
+	case <-done:
+		log.Infof("The RPCs in flight finished")
+	case <-timer.C:
+		log.Infof("Lameduck period expired with RPCs still in flight")
+		finished = false
+	}
+	return finished
+}
+
+// fireHooks fires hooks, and returns true iff they all finish before
+// the timeout.
+func fireHooks(hooks *event.Hooks, timeout time.Duration) bool {
+	log.Infof("Firing synchronous OnTermSync hooks and waiting up to %v for them", timeout)
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	done := make(chan struct{})
+	go func() {
+		hooks.Fire()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		log.Infof("OnTermSync hooks finished")
+		return true
+	case <-timer.C:
+		log.Infof("OnTermSync hooks timed out")
+		return false
+	}
+}
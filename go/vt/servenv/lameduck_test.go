@@ -0,0 +1,89 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package servenv
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/youtube/vitess/go/event"
+	"github.com/youtube/vitess/go/rpcplus"
+	"golang.org/x/net/context"
+)
+
+type Blocker struct {
+	started chan bool
+	release chan bool
+}
+
+func (b *Blocker) Block(ctx context.Context, args *int, reply *int) error {
+	b.started <- true
+	<-b.release
+	return nil
+}
+
+func TestLameduck(t *testing.T) {
+	blocker := &Blocker{started: make(chan bool, 1), release: make(chan bool)}
+	server := rpcplus.NewServer()
+	if err := server.Register(blocker); err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Cannot listen: %v", err)
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go server.ServeConn(conn)
+		}
+	}()
+	client, err := rpcplus.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer client.Close()
+	call := client.Go(context.Background(), "Blocker.Block", new(int), new(int), nil)
+	<-blocker.started
+
+	hooks := &event.Hooks{}
+	listenerClosed := false
+	hooks.Add(func() {
+		if conn, err := net.Dial("tcp", l.Addr().String()); err == nil {
+			conn.Close()
+		} else {
+			listenerClosed = true
+		}
+	})
+	ld := &Lameduck{
+		Period:        10 * time.Millisecond,
+		OnTermTimeout: time.Second,
+		OnTermSync:    hooks,
+	}
+	ld.AddListener(l)
+	ld.AddRPCServer(server)
+
+	// the call is still in flight at the end of the period
+	if finished := ld.Run(); finished {
+		t.Errorf("Run finished with a call in flight")
+	}
+	if !listenerClosed {
+		t.Errorf("the listener was not closed when the hooks ran")
+	}
+
+	// once it is done, Run doesn't wait for the period
+	close(blocker.release)
+	if err := (<-call.Done).Error; err != nil {
+		t.Errorf("the call in flight failed: %v", err)
+	}
+	ld.Period = time.Hour
+	if finished := ld.Run(); !finished {
+		t.Errorf("Run didn't finish without calls in flight")
+	}
+}
@@ -0,0 +1,18 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package servenv
+
+import (
+	"net/http"
+
+	"github.com/youtube/vitess/go/stats"
+)
+
+func init() {
+	onInit(func() {
+		// the variables of /debug/vars, for Prometheus to scrape
+		http.Handle("/metrics", stats.PrometheusHandler())
+	})
+}
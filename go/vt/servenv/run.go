@@ -4,11 +4,12 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
-	"time"
 
 	log "github.com/golang/glog"
 	"github.com/youtube/vitess/go/event"
 	"github.com/youtube/vitess/go/proc"
+	rpc "github.com/youtube/vitess/go/rpcplus"
+	"github.com/youtube/vitess/go/rpcwrap"
 )
 
 var (
@@ -28,20 +29,18 @@ func Run(port int) {
 		log.Fatal(err)
 	}
 	go http.Serve(l, nil)
+	lameduck.AddListener(l)
 
 	proc.Wait()
-	l.Close()
-
-	startTime := time.Now()
-	log.Infof("Entering lameduck mode for at least %v", *lameduckPeriod)
-	log.Infof("Firing asynchronous OnTerm hooks")
-	go onTermHooks.Fire()
-
-	fireOnTermSyncHooks(*onTermTimeout)
-	if remain := *lameduckPeriod - time.Since(startTime); remain > 0 {
-		log.Infof("Sleeping an extra %v after OnTermSync to finish lameduck period", remain)
-		time.Sleep(remain)
-	}
+	lameduck.Period = *lameduckPeriod
+	lameduck.OnTermTimeout = *onTermTimeout
+	lameduck.AddRPCServer(rpc.DefaultServer)
+	lameduck.AddRPCServer(rpcwrap.AuthenticatedServer)
+	lameduck.AddRPCServer(secureRpcServer)
+	lameduck.AddRPCServer(authenticatedSecureRpcServer)
+	lameduck.AddRPCServer(socketFileRpcServer)
+	lameduck.AddRPCServer(authenticatedSocketFileRpcServer)
+	lameduck.Run()
 
 	log.Info("Shutting down gracefully")
 	Close()
@@ -40,7 +40,7 @@ var (
 	Port *int
 
 	// Flags to alter the behavior of the library.
-	lameduckPeriod = flag.Duration("lameduck-period", 50*time.Millisecond, "keep running at least this long after SIGTERM before stopping")
+	lameduckPeriod = flag.Duration("lameduck-period", 50*time.Millisecond, "how long the RPCs in flight have to finish after SIGTERM, before stopping")
 	onTermTimeout  = flag.Duration("onterm_timeout", 10*time.Second, "wait no more than this for OnTermSync handlers before stopping")
 	memProfileRate = flag.Int("mem-profile-rate", 512*1024, "profile every n bytes allocated")
 
@@ -53,6 +53,13 @@ var (
 	onRunHooks      event.Hooks
 	inited          bool
 
+	// lameduck is run by Run on SIGTERM. The listeners are added
+	// to it when they are created.
+	lameduck = &Lameduck{
+		OnTerm:     &onTermHooks,
+		OnTermSync: &onTermSyncHooks,
+	}
+
 	// filled in when calling Run
 	ListeningURL url.URL
 )
@@ -128,36 +135,14 @@ func OnTerm(f func()) {
 // This allows the program to change its behavior during the lameduck period.
 //
 // All hooks are run in parallel, and the process will do its best to wait
-// (up to -onterm_timeout) for all of them to finish before dying.
+// (up to -onterm_timeout) for all of them to finish before dying. They run
+// once the listeners are closed, and before waiting for the RPCs in flight.
 //
 // See also: OnTerm
 func OnTermSync(f func()) {
 	onTermSyncHooks.Add(f)
 }
 
-// fireOnTermSyncHooks returns true iff all the hooks finish before the timeout.
-func fireOnTermSyncHooks(timeout time.Duration) bool {
-	log.Infof("Firing synchronous OnTermSync hooks and waiting up to %v for them", timeout)
-
-	timer := time.NewTimer(timeout)
-	defer timer.Stop()
-
-	done := make(chan struct{})
-	go func() {
-		onTermSyncHooks.Fire()
-		close(done)
-	}()
-
-	select {
-	case <-done:
-		log.Infof("OnTermSync hooks finished")
-		return true
-	case <-timer.C:
-		log.Infof("OnTermSync hooks timed out")
-		return false
-	}
-}
-
 // OnRun registers f to be run right at the beginning of Run. All
 // hooks are run in parallel.
 func OnRun(f func()) {
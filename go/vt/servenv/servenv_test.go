@@ -23,7 +23,7 @@ func TestFireOnTermSyncHooksFinished(t *testing.T) {
 		triggered2 = true
 	})
 
-	if finished, want := fireOnTermSyncHooks(1*time.Second), true; finished != want {
+	if finished, want := fireHooks(&onTermSyncHooks, 1*time.Second), true; finished != want {
 		t.Errorf("finished = %v, want %v", finished, want)
 	}
 	if want := true; triggered1 != want {
@@ -41,7 +41,7 @@ func TestFireOnTermSyncHooksTimeout(t *testing.T) {
 		time.Sleep(1 * time.Second)
 	})
 
-	if finished, want := fireOnTermSyncHooks(1*time.Nanosecond), false; finished != want {
+	if finished, want := fireHooks(&onTermSyncHooks, 1*time.Nanosecond), false; finished != want {
 		t.Errorf("finished = %v, want %v", finished, want)
 	}
 }
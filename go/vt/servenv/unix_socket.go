@@ -65,6 +65,7 @@ func ServeSocketFile(name string) {
 		log.Fatalf("Error listening on socket file %v: %v", name, err)
 	}
 	log.Infof("Listening on socket file %v", name)
+	lameduck.AddListener(l)
 
 	// HandleHTTP registers the default GOB handler at /_goRPC_
 	// and the debug RPC service at /debug/rpc (it displays a list
@@ -0,0 +1,297 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlparser
+
+// normalizer.go contains the normalization of the queries, which
+// replaces their values with bind variables, so the queries that only
+// differ by their values share the same plan.
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/youtube/vitess/go/sqltypes"
+)
+
+// Normalize replaces the literal values of the statement with bind
+// variables. The identical values share the same bind variable. It
+// returns the canonical form of the statement, the same for all the
+// statements that only differ by their values, and the bind variables
+// to execute it with: the ones of bindVars, which is not changed, and
+// the generated ones.
+//
+// The values that change the meaning of a statement are kept: the
+// ones of the select expressions, which name the columns of the
+// result, and the ones of the GROUP BY and ORDER BY clauses, which can
+// be column positions. So are the numbers a bind variable can't
+// represent as the same literal, like the hexadecimal ones.
+func Normalize(stmt Statement, bindVars map[string]interface{}) (string, map[string]interface{}) {
+	nz := &normalizer{
+		bindVars: make(map[string]interface{}, len(bindVars)),
+		used:     make(map[string]bool),
+		names:    make(map[string]string),
+	}
+	for name, value := range bindVars {
+		nz.bindVars[name] = value
+		nz.used[name] = true
+	}
+	// the arguments of the statement missing from bindVars
+	// can't be reused either
+	buf := NewTrackedBuffer(nil)
+	stmt.Format(buf)
+	for _, loc := range buf.bindLocations {
+		nz.used[strings.TrimLeft(buf.String()[loc.offset:loc.offset+loc.length], ":")] = true
+	}
+
+	nz.statement(stmt)
+	return String(stmt), nz.bindVars
+}
+
+type normalizer struct {
+	bindVars map[string]interface{}
+	// used has the names that can't be generated
+	used map[string]bool
+	// names has the generated bind variable of each value, by the
+	// serialization of the value
+	names   map[string]string
+	counter int
+}
+
+// bindVar returns the bind variable for value, generating it if needed.
+func (nz *normalizer) bindVar(key string, value interface{}) string {
+	if name, ok := nz.names[key]; ok {
+		return name
+	}
+	var name string
+	for {
+		nz.counter++
+		name = "v" + strconv.Itoa(nz.counter)
+		if !nz.used[name] {
+			break
+		}
+	}
+	nz.names[key] = name
+	nz.bindVars[name] = value
+	return name
+}
+
+func (nz *normalizer) statement(stmt Statement) {
+	switch stmt := stmt.(type) {
+	case SelectStatement:
+		nz.selectStatement(stmt)
+	case *Insert:
+		switch rows := stmt.Rows.(type) {
+		case Values:
+			for _, row := range rows {
+				if tuple, ok := row.(ValTuple); ok {
+					nz.valTuple(tuple)
+				} else {
+					nz.valExpr(row)
+				}
+			}
+		case SelectStatement:
+			nz.selectStatement(rows)
+		}
+		nz.updateExprs(UpdateExprs(stmt.OnDup))
+	case *Update:
+		nz.updateExprs(stmt.Exprs)
+		nz.where(stmt.Where)
+		nz.limit(stmt.Limit)
+	case *Delete:
+		nz.where(stmt.Where)
+		nz.limit(stmt.Limit)
+	}
+	// SET, DDL and the other statements have no values to replace
+}
+
+func (nz *normalizer) selectStatement(stmt SelectStatement) {
+	switch stmt := stmt.(type) {
+	case *Select:
+		for _, expr := range stmt.From {
+			nz.tableExpr(expr)
+		}
+		nz.where(stmt.Where)
+		nz.where(stmt.Having)
+		nz.limit(stmt.Limit)
+	case *Union:
+		nz.selectStatement(stmt.Left)
+		nz.selectStatement(stmt.Right)
+	}
+}
+
+func (nz *normalizer) tableExpr(expr TableExpr) {
+	switch expr := expr.(type) {
+	case *AliasedTableExpr:
+		if subquery, ok := expr.Expr.(*Subquery); ok {
+			nz.selectStatement(subquery.Select)
+		}
+	case *ParenTableExpr:
+		nz.tableExpr(expr.Expr)
+	case *JoinTableExpr:
+		nz.tableExpr(expr.LeftExpr)
+		nz.tableExpr(expr.RightExpr)
+		expr.On = nz.boolExpr(expr.On)
+	}
+}
+
+func (nz *normalizer) where(where *Where) {
+	if where != nil {
+		where.Expr = nz.boolExpr(where.Expr)
+	}
+}
+
+func (nz *normalizer) limit(limit *Limit) {
+	if limit == nil {
+		return
+	}
+	// only the numbers Limits can read as int64 are replaced, with an
+	// int64 the tablet server can read too
+	if limit.Offset != nil {
+		limit.Offset = nz.limitValue(limit.Offset)
+	}
+	limit.Rowcount = nz.limitValue(limit.Rowcount)
+}
+
+func (nz *normalizer) limitValue(node ValExpr) ValExpr {
+	num, ok := node.(NumVal)
+	if !ok {
+		return node
+	}
+	value, err := strconv.ParseInt(string(num), 10, 64)
+	if err != nil {
+		return node
+	}
+	return ValArg(":" + nz.bindVar(string(num), value))
+}
+
+func (nz *normalizer) updateExprs(exprs UpdateExprs) {
+	for _, expr := range exprs {
+		expr.Expr = nz.valExpr(expr.Expr)
+	}
+}
+
+func (nz *normalizer) expr(node Expr) Expr {
+	switch node := node.(type) {
+	case BoolExpr:
+		return nz.boolExpr(node)
+	case ValExpr:
+		return nz.valExpr(node)
+	}
+	return node
+}
+
+func (nz *normalizer) boolExpr(node BoolExpr) BoolExpr {
+	switch node := node.(type) {
+	case *AndExpr:
+		node.Left = nz.boolExpr(node.Left)
+		node.Right = nz.boolExpr(node.Right)
+	case *OrExpr:
+		node.Left = nz.boolExpr(node.Left)
+		node.Right = nz.boolExpr(node.Right)
+	case *NotExpr:
+		node.Expr = nz.boolExpr(node.Expr)
+	case *ParenBoolExpr:
+		node.Expr = nz.boolExpr(node.Expr)
+	case *ComparisonExpr:
+		node.Left = nz.valExpr(node.Left)
+		if tuple, ok := node.Right.(ValTuple); ok && (node.Operator == AST_IN || node.Operator == AST_NOT_IN) {
+			node.Right = nz.inList(tuple)
+		} else {
+			node.Right = nz.valExpr(node.Right)
+		}
+	case *RangeCond:
+		node.Left = nz.valExpr(node.Left)
+		node.From = nz.valExpr(node.From)
+		node.To = nz.valExpr(node.To)
+	case *NullCheck:
+		node.Expr = nz.valExpr(node.Expr)
+	case *ExistsExpr:
+		nz.selectStatement(node.Subquery.Select)
+	}
+	// the bounds of a KEYRANGE are for vtgate, they stay as they are
+	return node
+}
+
+// inList replaces the list of an IN clause with a list bind variable
+// if all its values can be replaced, so the IN clauses of different
+// lengths share the same plan.
+func (nz *normalizer) inList(tuple ValTuple) ValExpr {
+	values := make([]interface{}, len(tuple))
+	for i, node := range tuple {
+		value, ok := literalValue(node)
+		if !ok {
+			nz.valTuple(tuple)
+			return tuple
+		}
+		values[i] = value
+	}
+	return ListArg("::" + nz.bindVar(String(tuple), values))
+}
+
+func (nz *normalizer) valTuple(tuple ValTuple) {
+	for i, node := range tuple {
+		tuple[i] = nz.valExpr(node)
+	}
+}
+
+func (nz *normalizer) valExpr(node ValExpr) ValExpr {
+	switch node := node.(type) {
+	case StrVal, NumVal:
+		if value, ok := literalValue(node); ok {
+			return ValArg(":" + nz.bindVar(String(node), value))
+		}
+	case ValTuple:
+		nz.valTuple(node)
+	case *Subquery:
+		nz.selectStatement(node.Select)
+	case *BinaryExpr:
+		node.Left = nz.expr(node.Left)
+		node.Right = nz.expr(node.Right)
+	case *UnaryExpr:
+		node.Expr = nz.expr(node.Expr)
+	case *FuncExpr:
+		for _, expr := range node.Exprs {
+			if expr, ok := expr.(*NonStarExpr); ok {
+				expr.Expr = nz.expr(expr.Expr)
+			}
+		}
+	case *CaseExpr:
+		node.Expr = nz.valExpr(node.Expr)
+		for _, when := range node.Whens {
+			when.Cond = nz.boolExpr(when.Cond)
+			when.Val = nz.valExpr(when.Val)
+		}
+		node.Else = nz.valExpr(node.Else)
+	}
+	// bind variables, column names and NULL stay as they are
+	return node
+}
+
+// literalValue returns the bind variable value that is encoded as the
+// same literal as node, or false if there is none. The integers become
+// int64 or uint64, the other numbers keep their exact representation.
+func literalValue(node ValExpr) (interface{}, bool) {
+	switch node := node.(type) {
+	case StrVal:
+		return sqltypes.MakeString([]byte(node)), true
+	case NumVal:
+		s := string(node)
+		if value, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return value, true
+		}
+		if value, err := strconv.ParseUint(s, 10, 64); err == nil {
+			return value, true
+		}
+		// hexadecimal numbers are strings in a string context, and
+		// ParseFloat reads some of them
+		if strings.ContainsAny(s, "xX") {
+			return nil, false
+		}
+		if _, err := strconv.ParseFloat(s, 64); err == nil {
+			return sqltypes.MakeFractional([]byte(node)), true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,192 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlparser
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/youtube/vitess/go/sqltypes"
+)
+
+func TestNormalize(t *testing.T) {
+	testcases := []struct {
+		in       string
+		out      string
+		bindVars map[string]interface{}
+	}{{
+		in:       "select * from a where id = 1 and name = 'x'",
+		out:      "select * from a where id = :v1 and name = :v2",
+		bindVars: map[string]interface{}{"v1": int64(1), "v2": sqltypes.MakeString([]byte("x"))},
+	}, {
+		// identical values share a bind variable
+		in:       "update a set b = 1 where id = 1 or c = -1",
+		out:      "update a set b = :v1 where id = :v1 or c = :v2",
+		bindVars: map[string]interface{}{"v1": int64(1), "v2": int64(-1)},
+	}, {
+		in:       "select * from a where id in (1, 2, 18446744073709551615) and b not in (1, 2, 18446744073709551615)",
+		out:      "select * from a where id in ::v1 and b not in ::v1",
+		bindVars: map[string]interface{}{"v1": []interface{}{int64(1), int64(2), uint64(18446744073709551615)}},
+	}, {
+		in:       "select * from a where id in (1, b)",
+		out:      "select * from a where id in (:v1, b)",
+		bindVars: map[string]interface{}{"v1": int64(1)},
+	}, {
+		// the hexadecimal numbers and the numbers that are not
+		// plain literals stay as they are
+		in:       "select * from a where b = 0x1F and c = 1.50 and d = - -1",
+		out:      "select * from a where b = 0x1F and c = :v1 and d = --1",
+		bindVars: map[string]interface{}{"v1": sqltypes.MakeFractional([]byte("1.50"))},
+	}, {
+		// so do the select expressions, the GROUP BY and ORDER BY
+		// clauses, and null
+		in:       "select 1, 'x' from a where b is null and c = null group by 1 order by 2 limit 10, 20",
+		out:      "select 1, 'x' from a where b is null and c = null group by 1 order by 2 asc limit :v1, :v2",
+		bindVars: map[string]interface{}{"v1": int64(10), "v2": int64(20)},
+	}, {
+		in:       "insert into a(id, b) values (1, 'x'), (2, 'x') on duplicate key update b = 'y'",
+		out:      "insert into a(id, b) values (:v1, :v2), (:v3, :v2) on duplicate key update b = :v4",
+		bindVars: map[string]interface{}{"v1": int64(1), "v2": sqltypes.MakeString([]byte("x")), "v3": int64(2), "v4": sqltypes.MakeString([]byte("y"))},
+	}, {
+		// the existing bind variables are kept, and not reused
+		in:       "select * from a where id = :v1 and b = :v3 and c = 1",
+		out:      "select * from a where id = :v1 and b = :v3 and c = :v2",
+		bindVars: map[string]interface{}{"v1": int64(5), "v2": int64(1)},
+	}, {
+		in:       "select * from a join b on a.id = b.id and b.c = 1 where exists (select 1 from c where d = 2) and e = case when f = 3 then 'x' else 'y' end",
+		out:      "select * from a join b on a.id = b.id and b.c = :v1 where exists (select 1 from c where d = :v2) and e = case when f = :v3 then :v4 else :v5 end",
+		bindVars: map[string]interface{}{"v1": int64(1), "v2": int64(2), "v3": int64(3), "v4": sqltypes.MakeString([]byte("x")), "v5": sqltypes.MakeString([]byte("y"))},
+	}, {
+		in:       "set a = 1",
+		out:      "set a = 1",
+		bindVars: map[string]interface{}{},
+	}}
+	for _, tcase := range testcases {
+		stmt, err := Parse(tcase.in)
+		if err != nil {
+			t.Fatalf("Parse(%v) failed: %v", tcase.in, err)
+		}
+		var bindVars map[string]interface{}
+		if strings.Contains(tcase.in, ":v1") {
+			bindVars = map[string]interface{}{"v1": int64(5)}
+		}
+		out, gotBindVars := Normalize(stmt, bindVars)
+		if out != tcase.out {
+			t.Errorf("Normalize(%v) = %v, want %v", tcase.in, out, tcase.out)
+		}
+		if !reflect.DeepEqual(gotBindVars, tcase.bindVars) {
+			t.Errorf("Normalize(%v) bind variables = %v, want %v", tcase.in, gotBindVars, tcase.bindVars)
+		}
+		if bindVars != nil && len(bindVars) != 1 {
+			t.Errorf("Normalize(%v) changed its bind variables: %v", tcase.in, bindVars)
+		}
+	}
+}
+
+// normalizerTemplates are the queries of TestNormalizeRandom, their %v
+// are replaced with random values.
+var normalizerTemplates = []string{
+	"select * from a where id = %v",
+	"select * from a where id = %v and (b = %v or c > %v) and d like %v",
+	"select a, count(*) from a where b between %v and %v group by a having count(*) > %v limit %v",
+	"select * from a where id in (%v, %v, %v) and b not in (%v)",
+	"select * from a where id = %v union select * from b where id = %v",
+	"select * from a where b = %v + %v * c and d = -%v",
+	"select * from a where b = substr(c, %v, %v) and d = case when e = %v then %v else %v end",
+	"select * from a where exists (select * from b where b.id = a.id and c = %v)",
+	"insert into a(id, b, c) values (%v, %v, %v), (%v, %v, %v) on duplicate key update b = %v",
+	"update a set b = %v, c = %v where id = %v limit %v",
+	"delete from a where id in (%v, %v) and b != %v",
+}
+
+// randomValue returns a random literal: a number, possibly negative or
+// hexadecimal, or a string with characters that have to be escaped.
+func randomValue(r *rand.Rand) string {
+	switch r.Intn(8) {
+	case 0:
+		return fmt.Sprintf("%v", r.Intn(1000))
+	case 1:
+		return fmt.Sprintf("-%v", r.Int63())
+	case 2:
+		return fmt.Sprintf("%v", uint64(r.Int63())<<1|1)
+	case 3:
+		return fmt.Sprintf("0x%X", r.Intn(1<<16))
+	case 4:
+		return fmt.Sprintf("%v.%02d", r.Intn(100), r.Intn(100))
+	case 5:
+		return fmt.Sprintf("%ve%v", r.Intn(10), r.Intn(10))
+	case 6:
+		return "null"
+	}
+	chars := []byte("ab'\"\\%_\n\t\x00")
+	b := make([]byte, r.Intn(6))
+	for i := range b {
+		b[i] = chars[r.Intn(len(chars))]
+	}
+	s := sqltypes.MakeString(b)
+	buf := NewTrackedBuffer(nil)
+	s.EncodeSql(buf)
+	return buf.String()
+}
+
+// TestNormalizeRandom checks that the normalized queries, executed with
+// their bind variables, are the original ones.
+func TestNormalizeRandom(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 2000; i++ {
+		template := normalizerTemplates[r.Intn(len(normalizerTemplates))]
+		values := make([]interface{}, strings.Count(template, "%v"))
+		for j := range values {
+			values[j] = randomValue(r)
+		}
+		sql := fmt.Sprintf(template, values...)
+		stmt, err := Parse(sql)
+		if err != nil {
+			// a random value can make the query invalid, like a
+			// negative limit
+			continue
+		}
+		want := String(stmt)
+
+		normalized, bindVars := Normalize(stmt, nil)
+		stmt, err = Parse(normalized)
+		if err != nil {
+			t.Fatalf("Parse(%v) of the normalized %v failed: %v", normalized, sql, err)
+		}
+		buf := NewTrackedBuffer(nil)
+		stmt.Format(buf)
+		got, err := buf.ParsedQuery().GenerateQuery(bindVars)
+		if err != nil {
+			t.Fatalf("GenerateQuery(%v, %v) failed: %v", normalized, bindVars, err)
+		}
+		if string(got) != want {
+			t.Errorf("the normalized %v, with %v, is %v, want %v", normalized, bindVars, string(got), want)
+		}
+	}
+}
+
+func TestNormalizeSameKey(t *testing.T) {
+	var keys []string
+	for _, sql := range []string{
+		"select * from a where id in (1, 2) and b = 'x' limit 10",
+		"select * from a where id in (3, 4, 5) and b = 'y' limit 20",
+		"select * from a where id in (-6) and b = '' limit 0",
+	} {
+		stmt, err := Parse(sql)
+		if err != nil {
+			t.Fatalf("Parse(%v) failed: %v", sql, err)
+		}
+		key, _ := Normalize(stmt, nil)
+		keys = append(keys, key)
+	}
+	for _, key := range keys[1:] {
+		if key != keys[0] {
+			t.Errorf("got different normalized queries %v and %v, want the same", keys[0], key)
+		}
+	}
+}
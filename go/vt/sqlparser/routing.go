@@ -0,0 +1,298 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlparser
+
+// routing.go contains the functions that extract from a statement what
+// is needed to route it: the tables it uses, and the values of a column
+// its rows can have. They let vtgate and the binlog streamer route
+// statements without the comments the clients append to them.
+
+import (
+	"errors"
+	"fmt"
+)
+
+// UnsupportedError is returned by the routing functions for the
+// statements they can't analyze, like the ones with a subquery in their
+// WHERE clause, or the ones that use more than one table. The caller can
+// then fall back to another way of routing them.
+type UnsupportedError string
+
+func (e UnsupportedError) Error() string {
+	return "unsupported: " + string(e)
+}
+
+// IsUnsupported returns true if err is an UnsupportedError.
+func IsUnsupported(err error) bool {
+	_, ok := err.(UnsupportedError)
+	return ok
+}
+
+// GetTableNames returns the names of the tables the statement uses, in
+// the order they appear in it. It returns nil for the statements that
+// don't use any table, like SET.
+func GetTableNames(stmt Statement) ([]string, error) {
+	var names []string
+	add := func(name string) {
+		if !StringIn(name, names...) {
+			names = append(names, name)
+		}
+	}
+	switch stmt := stmt.(type) {
+	case SelectStatement:
+		if err := addSelectTableNames(stmt, add); err != nil {
+			return nil, err
+		}
+	case *Insert:
+		if _, ok := stmt.Rows.(Values); !ok {
+			return nil, UnsupportedError("insert from a select")
+		}
+		if err := addTableName(stmt.Table, add); err != nil {
+			return nil, err
+		}
+	case *Update:
+		if err := addTableName(stmt.Table, add); err != nil {
+			return nil, err
+		}
+	case *Delete:
+		if err := addTableName(stmt.Table, add); err != nil {
+			return nil, err
+		}
+	case *DDL:
+		if stmt.Table != nil {
+			add(string(stmt.Table))
+		}
+		if stmt.NewName != nil {
+			add(string(stmt.NewName))
+		}
+	}
+	return names, nil
+}
+
+func addSelectTableNames(stmt SelectStatement, add func(string)) error {
+	switch stmt := stmt.(type) {
+	case *Select:
+		for _, expr := range stmt.From {
+			if err := addTableExprNames(expr, add); err != nil {
+				return err
+			}
+		}
+	case *Union:
+		if err := addSelectTableNames(stmt.Left, add); err != nil {
+			return err
+		}
+		return addSelectTableNames(stmt.Right, add)
+	}
+	return nil
+}
+
+func addTableExprNames(expr TableExpr, add func(string)) error {
+	switch expr := expr.(type) {
+	case *AliasedTableExpr:
+		tableName, ok := expr.Expr.(*TableName)
+		if !ok {
+			return UnsupportedError("subquery in the FROM clause")
+		}
+		return addTableName(tableName, add)
+	case *ParenTableExpr:
+		return addTableExprNames(expr.Expr, add)
+	case *JoinTableExpr:
+		if err := addTableExprNames(expr.LeftExpr, add); err != nil {
+			return err
+		}
+		return addTableExprNames(expr.RightExpr, add)
+	}
+	return fmt.Errorf("unexpected table expression %v", String(expr))
+}
+
+func addTableName(tableName *TableName, add func(string)) error {
+	if tableName.Qualifier != nil {
+		return UnsupportedError(fmt.Sprintf("qualified table name %v", String(tableName)))
+	}
+	add(string(tableName.Name))
+	return nil
+}
+
+// GetColumnValues returns the values the WHERE clause of a SELECT,
+// UPDATE or DELETE allows for a column, from the 'column = value' and
+// 'column IN (values)' conditions joined by AND at its top. A value is a
+// StrVal, a NumVal or a ValArg, or a ListArg for 'column IN ::list'.
+// It returns nil if the WHERE clause doesn't limit the values of the
+// column: the statement can affect rows with any value.
+// The statements with a subquery in their WHERE clause, and the ones
+// using more than one table, are reported with an UnsupportedError.
+func GetColumnValues(stmt Statement, column string) (ValExprs, error) {
+	var where *Where
+	switch stmt := stmt.(type) {
+	case *Select:
+		// a join is the only TableExpr that's not an AliasedTableExpr,
+		// once the parenthesis are removed
+		if len(stmt.From) != 1 || !isSimpleTableExpr(stmt.From[0]) {
+			return nil, UnsupportedError("more than one table")
+		}
+		if _, err := GetTableNames(stmt); err != nil {
+			return nil, err
+		}
+		where = stmt.Where
+	case *Update:
+		where = stmt.Where
+	case *Delete:
+		where = stmt.Where
+	case *Union:
+		return nil, UnsupportedError("union")
+	default:
+		return nil, fmt.Errorf("%v has no WHERE clause", String(stmt))
+	}
+	if where == nil {
+		return nil, nil
+	}
+	if hasSubquery(where.Expr) {
+		return nil, UnsupportedError("subquery in the WHERE clause")
+	}
+	return getColumnValues(where.Expr, column), nil
+}
+
+func isSimpleTableExpr(expr TableExpr) bool {
+	switch expr := expr.(type) {
+	case *AliasedTableExpr:
+		return true
+	case *ParenTableExpr:
+		return isSimpleTableExpr(expr.Expr)
+	}
+	return false
+}
+
+func getColumnValues(node BoolExpr, column string) ValExprs {
+	switch node := node.(type) {
+	case *AndExpr:
+		if values := getColumnValues(node.Left, column); values != nil {
+			return values
+		}
+		return getColumnValues(node.Right, column)
+	case *ParenBoolExpr:
+		return getColumnValues(node.Expr, column)
+	case *ComparisonExpr:
+		switch node.Operator {
+		case AST_EQ:
+			left, right := node.Left, node.Right
+			if !isColumn(left, column) {
+				left, right = right, left
+			}
+			if isColumn(left, column) && IsValue(right) {
+				return ValExprs{right}
+			}
+		case AST_IN:
+			if !isColumn(node.Left, column) || !IsSimpleTuple(node.Right) {
+				return nil
+			}
+			switch right := node.Right.(type) {
+			case ValTuple:
+				return ValExprs(right)
+			case ListArg:
+				return ValExprs{right}
+			}
+		}
+	}
+	return nil
+}
+
+// isColumn returns true if node is the column, with or without a
+// table qualifier.
+func isColumn(node ValExpr, column string) bool {
+	colName, ok := node.(*ColName)
+	return ok && string(colName.Name) == column
+}
+
+// hasSubquery returns true if the expression contains a subquery.
+func hasSubquery(node Expr) bool {
+	switch node := node.(type) {
+	case *AndExpr:
+		return hasSubquery(node.Left) || hasSubquery(node.Right)
+	case *OrExpr:
+		return hasSubquery(node.Left) || hasSubquery(node.Right)
+	case *NotExpr:
+		return hasSubquery(node.Expr)
+	case *ParenBoolExpr:
+		return hasSubquery(node.Expr)
+	case *ComparisonExpr:
+		return hasSubquery(node.Left) || hasSubquery(node.Right)
+	case *RangeCond:
+		return hasSubquery(node.Left) || hasSubquery(node.From) || hasSubquery(node.To)
+	case *NullCheck:
+		return hasSubquery(node.Expr)
+	case *ExistsExpr, *Subquery:
+		return true
+	case *KeyrangeExpr:
+		return hasSubquery(node.Start) || hasSubquery(node.End)
+	case ValTuple:
+		for _, val := range node {
+			if hasSubquery(val) {
+				return true
+			}
+		}
+		return false
+	case *BinaryExpr:
+		return hasSubquery(node.Left) || hasSubquery(node.Right)
+	case *UnaryExpr:
+		return hasSubquery(node.Expr)
+	case *FuncExpr:
+		for _, expr := range node.Exprs {
+			if expr, ok := expr.(*NonStarExpr); ok && hasSubquery(expr.Expr) {
+				return true
+			}
+		}
+		return false
+	case *CaseExpr:
+		if hasSubquery(node.Expr) || hasSubquery(node.Else) {
+			return true
+		}
+		for _, when := range node.Whens {
+			if hasSubquery(when.Cond) || hasSubquery(when.Val) {
+				return true
+			}
+		}
+		return false
+	}
+	// values, column names, list args and nil
+	return false
+}
+
+// GetInsertValues returns, for each row of an INSERT ... VALUES, its
+// values by column name. The inserts without a column list, and the
+// ones from a select, are reported with an UnsupportedError.
+func GetInsertValues(ins *Insert) ([]map[string]ValExpr, error) {
+	rows, ok := ins.Rows.(Values)
+	if !ok {
+		return nil, UnsupportedError("insert from a select")
+	}
+	if len(ins.Columns) == 0 {
+		return nil, UnsupportedError("insert without a column list")
+	}
+	columns := make([]string, len(ins.Columns))
+	for i, column := range ins.Columns {
+		expr, ok := column.(*NonStarExpr)
+		if !ok {
+			return nil, fmt.Errorf("unexpected column %v", String(column))
+		}
+		if columns[i] = GetColName(expr.Expr); columns[i] == "" {
+			return nil, fmt.Errorf("unexpected column %v", String(column))
+		}
+	}
+	result := make([]map[string]ValExpr, len(rows))
+	for i, row := range rows {
+		tuple, ok := row.(ValTuple)
+		if !ok {
+			return nil, UnsupportedError("row subquery")
+		}
+		if len(tuple) != len(columns) {
+			return nil, errors.New("column count doesn't match value count")
+		}
+		result[i] = make(map[string]ValExpr, len(columns))
+		for j, column := range columns {
+			result[i][column] = tuple[j]
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,157 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlparser
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGetTableNames(t *testing.T) {
+	testcases := []struct {
+		sql         string
+		names       []string
+		unsupported bool
+	}{
+		{sql: "select * from a where id = 1", names: []string{"a"}},
+		{sql: "select * from a join b on a.id = b.id, (c join a) where a.id = 1", names: []string{"a", "b", "c"}},
+		{sql: "select * from a union select * from b", names: []string{"a", "b"}},
+		{sql: "insert into a(id) values (1)", names: []string{"a"}},
+		{sql: "update a set b = 1 where id = 1", names: []string{"a"}},
+		{sql: "delete from a where id = 1", names: []string{"a"}},
+		{sql: "rename table a to b", names: []string{"a", "b"}},
+		{sql: "set a = 1"},
+		{sql: "select * from (select * from a) as t", unsupported: true},
+		{sql: "select * from d.a", unsupported: true},
+		{sql: "insert into a select * from b", unsupported: true},
+	}
+	for _, tcase := range testcases {
+		stmt, err := Parse(tcase.sql)
+		if err != nil {
+			t.Fatalf("Parse(%v) failed: %v", tcase.sql, err)
+		}
+		names, err := GetTableNames(stmt)
+		if tcase.unsupported {
+			if !IsUnsupported(err) {
+				t.Errorf("GetTableNames(%v) = %v, %v, want an UnsupportedError", tcase.sql, names, err)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(names, tcase.names) {
+			t.Errorf("GetTableNames(%v) = %v, %v, want %v", tcase.sql, names, err, tcase.names)
+		}
+	}
+}
+
+func TestGetColumnValues(t *testing.T) {
+	testcases := []struct {
+		sql         string
+		values      string
+		unsupported bool
+	}{
+		{sql: "select * from a where id = 1", values: "1"},
+		{sql: "select * from a where 'x' = a.id", values: "'x'"},
+		{sql: "select * from a where b = 2 and (c = 3 and id in (1, :b))", values: "1, :b"},
+		{sql: "update a set b = 1 where id in ::list and c = 3", values: "::list"},
+		{sql: "delete from a where b = 1 and id = :id", values: ":id"},
+		{sql: "select * from a"},
+		{sql: "select * from a where id = 1 or id = 2"},
+		{sql: "select * from a where id = b"},
+		{sql: "select * from a where id > 1"},
+		{sql: "select * from a where id in (1, b)"},
+		{sql: "select * from a where b = 1 and id in (select id from b)", unsupported: true},
+		{sql: "delete from a where exists (select * from b)", unsupported: true},
+		{sql: "select * from a join b where id = 1", unsupported: true},
+		{sql: "select * from a, b where id = 1", unsupported: true},
+		{sql: "select * from a where id = 1 union select * from b where id = 1", unsupported: true},
+	}
+	for _, tcase := range testcases {
+		stmt, err := Parse(tcase.sql)
+		if err != nil {
+			t.Fatalf("Parse(%v) failed: %v", tcase.sql, err)
+		}
+		values, err := GetColumnValues(stmt, "id")
+		if tcase.unsupported {
+			if !IsUnsupported(err) {
+				t.Errorf("GetColumnValues(%v) = %v, %v, want an UnsupportedError", tcase.sql, values, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("GetColumnValues(%v) failed: %v", tcase.sql, err)
+			continue
+		}
+		if tcase.values == "" {
+			if values != nil {
+				t.Errorf("GetColumnValues(%v) = %v, want nil", tcase.sql, String(values))
+			}
+			continue
+		}
+		if got := String(values); got != tcase.values {
+			t.Errorf("GetColumnValues(%v) = %v, want %v", tcase.sql, got, tcase.values)
+		}
+	}
+
+	stmt, err := Parse("insert into a(id) values (1)")
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if _, err := GetColumnValues(stmt, "id"); err == nil || IsUnsupported(err) {
+		t.Errorf("GetColumnValues(insert) = %v, want a plain error", err)
+	}
+}
+
+func TestGetInsertValues(t *testing.T) {
+	stmt, err := Parse("insert into a(id, name) values (1, 'x'), (:id, null)")
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	rows, err := GetInsertValues(stmt.(*Insert))
+	if err != nil {
+		t.Fatalf("GetInsertValues failed: %v", err)
+	}
+	var got []map[string]string
+	for _, row := range rows {
+		values := make(map[string]string)
+		for column, value := range row {
+			values[column] = String(value)
+		}
+		got = append(got, values)
+	}
+	want := []map[string]string{
+		{"id": "1", "name": "'x'"},
+		{"id": ":id", "name": "null"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GetInsertValues = %v, want %v", got, want)
+	}
+
+	testcases := []struct {
+		sql         string
+		err         string
+		unsupported bool
+	}{
+		{sql: "insert into a values (1, 'x')", unsupported: true},
+		{sql: "insert into a(id) select id from b", unsupported: true},
+		{sql: "insert into a(id) values (select id from b)", unsupported: true},
+		{sql: "insert into a(id, name) values (1)", err: "column count doesn't match value count"},
+	}
+	for _, tcase := range testcases {
+		stmt, err := Parse(tcase.sql)
+		if err != nil {
+			t.Fatalf("Parse(%v) failed: %v", tcase.sql, err)
+		}
+		_, err = GetInsertValues(stmt.(*Insert))
+		if tcase.unsupported {
+			if !IsUnsupported(err) {
+				t.Errorf("GetInsertValues(%v) = %v, want an UnsupportedError", tcase.sql, err)
+			}
+			continue
+		}
+		if err == nil || err.Error() != tcase.err || IsUnsupported(err) {
+			t.Errorf("GetInsertValues(%v) = %v, want %v", tcase.sql, err, tcase.err)
+		}
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"regexp"
+	"sort"
 	"strings"
 	"sync"
 
@@ -17,12 +18,46 @@ import (
 )
 
 var mu sync.Mutex
-var tableAcl map[*regexp.Regexp]map[Role]acl.ACL
 var acls = make(map[string]acl.Factory)
 
 // defaultACL tells the default ACL implementation to use.
 var defaultACL string
 
+// currentConfig is the loaded config, nil while table ACLs are
+// disabled. A reload replaces it as a whole, so a check never sees
+// a mix of two configs.
+var configMu sync.RWMutex
+var currentConfig *aclConfig
+
+// aclConfig is a loaded config.
+type aclConfig struct {
+	// groups are sorted by name. A table gets the ACLs of the
+	// first group that matches it.
+	groups []*aclGroup
+	dryRun bool
+
+	// tables caches the group of each checked table, nil if no
+	// group matches it.
+	tablesMu sync.Mutex
+	tables   map[string]*aclGroup
+}
+
+// aclGroup is an entry of the config: the tables that match a
+// pattern, and their ACLs.
+type aclGroup struct {
+	name string
+	re   *regexp.Regexp
+	acls map[Role]acl.ACL
+}
+
+// ACLResult is the ACL of a table for a role. GroupName is the
+// pattern of the config entry it comes from, or empty if no entry
+// matches the table.
+type ACLResult struct {
+	acl.ACL
+	GroupName string
+}
+
 // Init initiates table ACLs.
 func Init(configFile string) {
 	config, err := ioutil.ReadFile(configFile)
@@ -30,39 +65,74 @@ func Init(configFile string) {
 		log.Errorf("unable to read tableACL config file: %v", err)
 		panic(fmt.Errorf("unable to read tableACL config file: %v", err))
 	}
-	tableAcl, err = load(config)
-	if err != nil {
+	if err := Load(config, false); err != nil {
 		log.Errorf("tableACL initialization error: %v", err)
 		panic(fmt.Errorf("tableACL initialization error: %v", err))
 	}
 }
 
 // InitFromBytes inits table ACLs from a byte array.
-func InitFromBytes(config []byte) (err error) {
-	tableAcl, err = load(config)
-	return
+func InitFromBytes(config []byte) error {
+	return Load(config, false)
+}
+
+// Load replaces the current config with the given one, which is
+// used by all the checks that start after Load returns. If dryRun
+// is set, the callers only log the queries the config denies,
+// instead of failing them. On error, the current config is kept.
+func Load(config []byte, dryRun bool) error {
+	c, err := load(config)
+	if err != nil {
+		return err
+	}
+	c.dryRun = dryRun
+	configMu.Lock()
+	currentConfig = c
+	configMu.Unlock()
+	return nil
+}
+
+// DryRun returns true if the current config is only evaluated, not
+// enforced.
+func DryRun() bool {
+	configMu.RLock()
+	defer configMu.RUnlock()
+	return currentConfig != nil && currentConfig.dryRun
+}
+
+// ValidateConfig checks that a JSON config can be loaded, without
+// creating its ACLs: it doesn't need a registered AclFactory.
+func ValidateConfig(config []byte) error {
+	_, err := parse(config)
+	return err
+}
+
+// parsedGroup is a config entry, before its ACLs are created.
+type parsedGroup struct {
+	name          string
+	re            *regexp.Regexp
+	entriesByRole map[Role][]string
 }
 
-// load loads configurations from a JSON byte array
+// parse parses configurations from a JSON byte array
 //
 // Sample configuration
 // []byte (`{
 //	<tableRegexPattern1>: {"READER": "*", "WRITER": "<u2>,<u4>...","ADMIN": "<u5>"},
 //	<tableRegexPattern2>: {"ADMIN": "<u5>"}
 //}`)
-func load(config []byte) (map[*regexp.Regexp]map[Role]acl.ACL, error) {
+func parse(config []byte) ([]*parsedGroup, error) {
 	var contents map[string]map[string]string
 	err := json.Unmarshal(config, &contents)
 	if err != nil {
 		return nil, err
 	}
-	tableAcl := make(map[*regexp.Regexp]map[Role]acl.ACL)
+	var groups []*parsedGroup
 	for tblPattern, accessMap := range contents {
 		re, err := regexp.Compile(tblPattern)
 		if err != nil {
 			return nil, fmt.Errorf("regexp compile error %v: %v", tblPattern, err)
 		}
-		tableAcl[re] = make(map[Role]acl.ACL)
 
 		entriesByRole := make(map[Role][]string)
 		for i := READER; i < NumRoles; i++ {
@@ -78,33 +148,72 @@ func load(config []byte) (map[*regexp.Regexp]map[Role]acl.ACL, error) {
 				entriesByRole[i] = append(entriesByRole[i], strings.Split(entries, ",")...)
 			}
 		}
-		for r, entries := range entriesByRole {
+		groups = append(groups, &parsedGroup{name: tblPattern, re: re, entriesByRole: entriesByRole})
+	}
+	return groups, nil
+}
+
+// load loads configurations from a JSON byte array, see parse.
+func load(config []byte) (*aclConfig, error) {
+	parsedGroups, err := parse(config)
+	if err != nil {
+		return nil, err
+	}
+	c := &aclConfig{tables: make(map[string]*aclGroup)}
+	for _, pg := range parsedGroups {
+		group := &aclGroup{name: pg.name, re: pg.re, acls: make(map[Role]acl.ACL)}
+		for r, entries := range pg.entriesByRole {
 			a, err := newACL(entries)
 			if err != nil {
 				return nil, err
 			}
-			tableAcl[re][r] = a
+			group.acls[r] = a
 		}
+		c.groups = append(c.groups, group)
+	}
+	sort.Sort(byName(c.groups))
+	return c, nil
+}
+
+type byName []*aclGroup
 
+func (bn byName) Len() int           { return len(bn) }
+func (bn byName) Swap(i, j int)      { bn[i], bn[j] = bn[j], bn[i] }
+func (bn byName) Less(i, j int) bool { return bn[i].name < bn[j].name }
+
+// group returns the group of a table, or nil.
+func (c *aclConfig) group(table string) *aclGroup {
+	c.tablesMu.Lock()
+	defer c.tablesMu.Unlock()
+	if group, ok := c.tables[table]; ok {
+		return group
+	}
+	var match *aclGroup
+	for _, group := range c.groups {
+		if group.re.MatchString(table) {
+			match = group
+			break
+		}
 	}
-	return tableAcl, nil
+	c.tables[table] = match
+	return match
 }
 
 // Authorized returns the list of entities who have at least the
 // minimum specified Role on a tablel.
-func Authorized(table string, minRole Role) acl.ACL {
+func Authorized(table string, minRole Role) *ACLResult {
+	configMu.RLock()
+	c := currentConfig
+	configMu.RUnlock()
 	// If table ACL is disabled, return nil
-	if tableAcl == nil {
+	if c == nil {
 		return nil
 	}
-	for re, accessMap := range tableAcl {
-		if !re.MatchString(table) {
-			continue
-		}
-		return accessMap[minRole]
+	if group := c.group(table); group != nil {
+		return &ACLResult{ACL: group.acls[minRole], GroupName: group.name}
 	}
 	// No matching patterns for table, allow all access
-	return all()
+	return &ACLResult{ACL: all()}
 }
 
 // Register registers a AclFactory.
@@ -77,7 +77,7 @@ func TestInitFromBytes(t *testing.T) {
 	}
 
 	acl = Authorized("unknown_table", READER)
-	if !reflect.DeepEqual(aclFactory.All(), acl) {
+	if !reflect.DeepEqual(aclFactory.All(), acl.ACL) {
 		t.Fatalf("there is no config for unknown_table, should grand all permission")
 	}
 
@@ -87,6 +87,54 @@ func TestInitFromBytes(t *testing.T) {
 	}
 }
 
+func TestAuthorizedGroupName(t *testing.T) {
+	setUpTableACL(&simpleacl.Factory{})
+	if err := InitFromBytes([]byte(`{"test_.*":{"Reader": "vt"}, "test_table[0-9]":{"Reader": "u1"}}`)); err != nil {
+		t.Fatalf("tableacl init should succeed, but got error: %v", err)
+	}
+	// both groups match, the first one by name wins
+	result := Authorized("test_table1", READER)
+	if result.GroupName != "test_.*" || !result.IsMember("vt") {
+		t.Errorf("Authorized(test_table1) = %v, want group test_.*", result)
+	}
+	result = Authorized("unknown_table", READER)
+	if result.GroupName != "" {
+		t.Errorf("Authorized(unknown_table) group = %v, want none", result.GroupName)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	setUpTableACL(&simpleacl.Factory{})
+	if err := Load([]byte(`{"test_table":{"Reader": "vt"}}`), true); err != nil {
+		t.Fatalf("Load should succeed, but got error: %v", err)
+	}
+	if !DryRun() {
+		t.Errorf("DryRun() = false after a dry run Load")
+	}
+	if !Authorized("test_table", READER).IsMember("vt") {
+		t.Errorf("user: vt should have reader permission to table: test_table")
+	}
+
+	// a reload replaces the config, even for the tables already checked
+	if err := Load([]byte(`{"test_table":{"Reader": "u1"}}`), false); err != nil {
+		t.Fatalf("Load should succeed, but got error: %v", err)
+	}
+	if DryRun() {
+		t.Errorf("DryRun() = true after an enforced Load")
+	}
+	if Authorized("test_table", READER).IsMember("vt") {
+		t.Errorf("user: vt should not have reader permission to table: test_table after the reload")
+	}
+
+	// an invalid config keeps the current one
+	if err := Load([]byte(`{"test_table":{"InvalidRole": "vt"}}`), true); err == nil {
+		t.Fatalf("Load should fail because config has an invalid role")
+	}
+	if DryRun() || !Authorized("test_table", READER).IsMember("u1") {
+		t.Errorf("a failed Load changed the current config")
+	}
+}
+
 func TestInvalidTableRegex(t *testing.T) {
 	setUpTableACL(&simpleacl.Factory{})
 	err := InitFromBytes([]byte(`{"table(":{"Reader": "vt", "WRITER":"vt"}}`))
@@ -103,6 +151,24 @@ func TestInvalidRole(t *testing.T) {
 	}
 }
 
+func TestValidateConfig(t *testing.T) {
+	// no AclFactory is needed
+	acls = make(map[string]acl.Factory)
+	defaultACL = ""
+	if err := ValidateConfig([]byte(`{"test_table":{"Reader": "vt", "WRITER":"vt"}}`)); err != nil {
+		t.Errorf("ValidateConfig failed: %v", err)
+	}
+	for _, config := range []string{
+		`{"test_table":{"InvalidRole": "vt"}}`,
+		`{"table(":{"Reader": "vt"}}`,
+		`{"test_table":"vt"}`,
+	} {
+		if err := ValidateConfig([]byte(config)); err == nil {
+			t.Errorf("ValidateConfig(%v) should fail", config)
+		}
+	}
+}
+
 func TestFailedToCreateACL(t *testing.T) {
 	setUpTableACL(&fakeAclFactory{})
 	err := InitFromBytes([]byte(`{"test_table":{"Reader": "vt", "WRITER":"vt"}}`))
@@ -161,7 +227,7 @@ func TestGetAclFactoryWithWrongDefault(t *testing.T) {
 }
 
 func setUpTableACL(factory acl.Factory) {
-	tableAcl = nil
+	currentConfig = nil
 	name := fmt.Sprintf("tableacl-name-%d", rand.Int63())
 	Register(name, factory)
 	SetDefaultACL(name)
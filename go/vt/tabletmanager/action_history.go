@@ -0,0 +1,154 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tabletmanager
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"time"
+
+	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/acl"
+	"github.com/youtube/vitess/go/vt/tabletmanager/actionnode"
+	"golang.org/x/net/context"
+)
+
+// This file keeps track of the recent actions run by the agent, so
+// they can be returned by the GetActionHistory RPC and displayed on
+// the /debug/actions page, along with the current action queue.
+
+const (
+	// actionHistoryLength is the number of actions we keep
+	actionHistoryLength = 50
+
+	// actionArgsMaxLength is the maximum length of the args summary
+	actionArgsMaxLength = 256
+)
+
+// summarizeActionArgs returns a short human-readable version of args.
+func summarizeActionArgs(args interface{}) string {
+	if args == nil {
+		return ""
+	}
+	result := fmt.Sprintf("%+v", args)
+	if len(result) > actionArgsMaxLength {
+		result = result[:actionArgsMaxLength] + "..."
+	}
+	return result
+}
+
+// recordAction adds a finished action to the action history.
+// The history is thread-safe, and records are never modified once
+// added, so this can be called concurrently with other actions.
+func (agent *ActionAgent) recordAction(name string, args interface{}, from string, startTime time.Time, err error) {
+	record := &actionnode.ActionHistoryRecord{
+		Name:      name,
+		Args:      summarizeActionArgs(args),
+		From:      from,
+		StartTime: startTime,
+		EndTime:   time.Now(),
+	}
+	if err != nil {
+		record.Error = err.Error()
+	}
+	agent.ActionHistory.Add(record)
+}
+
+// GetActionHistory returns the recent actions, most recent first.
+// Should be called under RPCWrap.
+func (agent *ActionAgent) GetActionHistory(ctx context.Context) []*actionnode.ActionHistoryRecord {
+	records := agent.ActionHistory.Records()
+	result := make([]*actionnode.ActionHistoryRecord, len(records))
+	for i, r := range records {
+		result[i] = r.(*actionnode.ActionHistoryRecord)
+	}
+	return result
+}
+
+var actionHistoryTemplate = template.Must(template.New("actions").Parse(`
+<html>
+<head>
+<title>Tablet Manager Actions</title>
+<style>
+  table {
+    border-collapse: collapse;
+  }
+  td, th {
+    border: 1px solid #999;
+    padding: 0.5rem;
+  }
+  .failed {
+    background-color: Salmon;
+  }
+</style>
+</head>
+<body>
+<h1>Running and queued tablet manager actions</h1>
+<table>
+  <tr>
+    <th>Action</th>
+    <th>Category</th>
+    <th>State</th>
+    <th>Queued At</th>
+    <th>Started At</th>
+  </tr>
+  {{range .Queue}}
+  <tr>
+    <td>{{.Name}}</td>
+    <td>{{.Category}}</td>
+    <td>{{if .Running}}running{{else}}queued{{end}}</td>
+    <td>{{.QueueTime.Format "Jan 2, 2006 at 15:04:05.000 (MST)"}}</td>
+    <td>{{if .Running}}{{.StartTime.Format "Jan 2, 2006 at 15:04:05.000 (MST)"}}{{end}}</td>
+  </tr>
+  {{end}}
+</table>
+<h1>Recent tablet manager actions</h1>
+<table>
+  <tr>
+    <th>Start Time</th>
+    <th>Duration</th>
+    <th>Action</th>
+    <th>Args</th>
+    <th>From</th>
+    <th>Error</th>
+  </tr>
+  {{range .Records}}
+  <tr{{if .Error}} class="failed"{{end}}>
+    <td>{{.StartTime.Format "Jan 2, 2006 at 15:04:05.000 (MST)"}}</td>
+    <td>{{.EndTime.Sub .StartTime}}</td>
+    <td>{{.Name}}</td>
+    <td>{{.Args}}</td>
+    <td>{{.From}}</td>
+    <td>{{.Error}}</td>
+  </tr>
+  {{end}}
+</table>
+</body>
+</html>
+`))
+
+// serveActionHistory displays the action history.
+func (agent *ActionAgent) serveActionHistory(w http.ResponseWriter, r *http.Request) {
+	if err := acl.CheckAccessHTTP(r, acl.DEBUGGING); err != nil {
+		acl.SendError(w, err)
+		return
+	}
+	data := struct {
+		Queue   []ActionQueueEntry
+		Records []*actionnode.ActionHistoryRecord
+	}{
+		Queue:   agent.ActionQueue(),
+		Records: agent.GetActionHistory(context.Background()),
+	}
+	if err := actionHistoryTemplate.Execute(w, data); err != nil {
+		log.Errorf("actionHistoryTemplate.Execute failed: %v", err)
+	}
+}
+
+// registerActionHistoryPage registers the /debug/actions page.
+func (agent *ActionAgent) registerActionHistoryPage() {
+	http.HandleFunc("/debug/actions", agent.serveActionHistory)
+}
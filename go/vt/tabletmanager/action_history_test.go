@@ -0,0 +1,62 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tabletmanager
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/youtube/vitess/go/history"
+	"github.com/youtube/vitess/go/vt/tabletmanager/actionnode"
+	"github.com/youtube/vitess/go/vt/topo"
+	"golang.org/x/net/context"
+)
+
+func TestActionHistory(t *testing.T) {
+	agent := &ActionAgent{
+		TabletAlias:   topo.TabletAlias{Cell: "cell1", Uid: 1},
+		ActionHistory: history.New(actionHistoryLength),
+	}
+	ctx := context.Background()
+
+	// read-only actions are not recorded
+	if err := agent.RPCWrap(ctx, actionnode.TabletActionPing, "payload", nil, func() error { return nil }); err != nil {
+		t.Fatalf("RPCWrap failed: %v", err)
+	}
+	if records := agent.GetActionHistory(ctx); len(records) != 0 {
+		t.Fatalf("unexpected records for read-only action: %v", records)
+	}
+
+	// successful, failed and panicking actions are recorded
+	if err := agent.RPCWrapLock(ctx, actionnode.TabletActionSetReadOnly, true, nil, false, func() error { return nil }); err != nil {
+		t.Fatalf("RPCWrapLock failed: %v", err)
+	}
+	if err := agent.RPCWrapLock(ctx, actionnode.TabletActionStopSlave, nil, nil, false, func() error { return fmt.Errorf("stop failed") }); err == nil {
+		t.Fatalf("RPCWrapLock should have failed")
+	}
+	if err := agent.RPCWrapLock(ctx, actionnode.TabletActionStartSlave, strings.Repeat("x", 1000), nil, false, func() error { panic("oops") }); err == nil {
+		t.Fatalf("RPCWrapLock should have caught the panic")
+	}
+
+	records := agent.GetActionHistory(ctx)
+	if len(records) != 3 {
+		t.Fatalf("unexpected records: %v", records)
+	}
+	if records[0].Name != actionnode.TabletActionStartSlave || !strings.Contains(records[0].Error, "caught panic") || len(records[0].Args) != actionArgsMaxLength+3 {
+		t.Errorf("unexpected panic record: %v", records[0])
+	}
+	if records[1].Name != actionnode.TabletActionStopSlave || !strings.Contains(records[1].Error, "stop failed") {
+		t.Errorf("unexpected failed record: %v", records[1])
+	}
+	if records[2].Name != actionnode.TabletActionSetReadOnly || records[2].Error != "" || records[2].Args != "true" {
+		t.Errorf("unexpected successful record: %v", records[2])
+	}
+	for _, r := range records {
+		if r.EndTime.Before(r.StartTime) {
+			t.Errorf("invalid times in record: %v", r)
+		}
+	}
+}
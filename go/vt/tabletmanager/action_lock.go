@@ -0,0 +1,212 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tabletmanager
+
+// This file contains the action lock, that decides which locking
+// actions can run at the same time. Each action belongs to a
+// category, and only waits for the running actions of a conflicting
+// category: a long schema change doesn't hold back a reparent, but two
+// reparent steps never interleave. Waiting actions are queued until
+// the caller's context expires.
+
+import (
+	"sync"
+	"time"
+
+	"github.com/youtube/vitess/go/vt/tabletmanager/actionnode"
+	"github.com/youtube/vitess/go/vt/vterrors"
+	"golang.org/x/net/context"
+)
+
+// The action categories.
+const (
+	// actionCategoryReplication is for the actions that change the
+	// replication (reparents, filtered replication, stopping and
+	// starting replication, backups).
+	actionCategoryReplication = "replication"
+
+	// actionCategoryTypeChange is for the actions that change the
+	// tablet type or serving state.
+	actionCategoryTypeChange = "type_change"
+
+	// actionCategorySchema is for the schema changes.
+	actionCategorySchema = "schema"
+
+	// actionCategoryExclusive is for all the other actions. They
+	// conflict with everything.
+	actionCategoryExclusive = "exclusive"
+)
+
+// actionCategories maps the locking actions to their category. Actions
+// not in this map are in actionCategoryExclusive.
+var actionCategories = map[string]string{
+	actionnode.TabletActionStopSlave:                   actionCategoryReplication,
+	actionnode.TabletActionStopSlaveMinimum:            actionCategoryReplication,
+	actionnode.TabletActionStartSlave:                  actionCategoryReplication,
+	actionnode.TabletActionExternallyReparented:        actionCategoryReplication,
+	actionnode.TabletActionWaitBLPPosition:             actionCategoryReplication,
+	actionnode.TabletActionStopBLP:                     actionCategoryReplication,
+	actionnode.TabletActionStartBLP:                    actionCategoryReplication,
+	actionnode.TabletActionRunBLPUntil:                 actionCategoryReplication,
+	actionnode.TabletActionResetReplication:            actionCategoryReplication,
+	actionnode.TabletActionInitMaster:                  actionCategoryReplication,
+	actionnode.TabletActionInitSlave:                   actionCategoryReplication,
+	actionnode.TabletActionDemoteMaster:                actionCategoryReplication,
+	actionnode.TabletActionPromoteSlaveWhenCaughtUp:    actionCategoryReplication,
+	actionnode.TabletActionSlaveWasPromoted:            actionCategoryReplication,
+	actionnode.TabletActionSetMaster:                   actionCategoryReplication,
+	actionnode.TabletActionSlaveWasRestarted:           actionCategoryReplication,
+	actionnode.TabletActionStopReplicationAndGetStatus: actionCategoryReplication,
+	actionnode.TabletActionPromoteSlave:                actionCategoryReplication,
+	actionnode.TabletActionBackup:                      actionCategoryReplication,
+	actionnode.TabletActionStreamingCloneSourceStart:   actionCategoryReplication,
+	actionnode.TabletActionStreamingCloneSourceEnd:     actionCategoryReplication,
+
+	actionnode.TabletActionChangeType:         actionCategoryTypeChange,
+	actionnode.TabletActionScrap:              actionCategoryTypeChange,
+	actionnode.TabletActionSetReadOnly:        actionCategoryTypeChange,
+	actionnode.TabletActionSetReadWrite:       actionCategoryTypeChange,
+	actionnode.TabletActionRefreshState:       actionCategoryTypeChange,
+	actionnode.TabletActionSetMaintenanceMode: actionCategoryTypeChange,
+
+	actionnode.TabletActionReloadSchema:    actionCategorySchema,
+	actionnode.TabletActionPreflightSchema: actionCategorySchema,
+	actionnode.TabletActionApplySchema:     actionCategorySchema,
+	actionnode.TabletActionReloadUsers:     actionCategorySchema,
+	actionnode.TabletActionReloadTableACL:  actionCategorySchema,
+}
+
+// actionCategory returns the category of an action.
+func actionCategory(name string) string {
+	if category, ok := actionCategories[name]; ok {
+		return category
+	}
+	return actionCategoryExclusive
+}
+
+// actionCategoriesConflict returns true if actions of the two
+// categories cannot run at the same time. Reparents change the tablet
+// type, so replication and type changes conflict.
+func actionCategoriesConflict(c1, c2 string) bool {
+	if c1 == c2 || c1 == actionCategoryExclusive || c2 == actionCategoryExclusive {
+		return true
+	}
+	if c1 == actionCategorySchema || c2 == actionCategorySchema {
+		return false
+	}
+	return true
+}
+
+// ActionQueueEntry describes an action that holds or waits for the
+// action lock.
+type ActionQueueEntry struct {
+	Name     string
+	Category string
+	// Running is false while the action is queued
+	Running bool
+	// QueueTime is when the action started waiting for the lock,
+	// StartTime is when it got it.
+	QueueTime time.Time
+	StartTime time.Time
+}
+
+// actionLock serializes conflicting actions. The zero value is ready
+// to use.
+type actionLock struct {
+	// mu protects all the following fields
+	mu      sync.Mutex
+	running []*ActionQueueEntry
+	queued  []*ActionQueueEntry
+	// changed is closed and replaced every time an action
+	// releases the lock, to wake up the queued actions.
+	changed chan struct{}
+}
+
+// canRun returns true if no running action conflicts with category.
+// Should be called with mu held.
+func (al *actionLock) canRun(category string) bool {
+	for _, e := range al.running {
+		if actionCategoriesConflict(e.Category, category) {
+			return false
+		}
+	}
+	return true
+}
+
+// acquire waits until the action can run, or ctx expires. It returns
+// the function to call to release the lock.
+func (al *actionLock) acquire(ctx context.Context, name string) (func(), error) {
+	entry := &ActionQueueEntry{
+		Name:      name,
+		Category:  actionCategory(name),
+		QueueTime: time.Now(),
+	}
+
+	al.mu.Lock()
+	defer al.mu.Unlock()
+	al.queued = append(al.queued, entry)
+	for !al.canRun(entry.Category) {
+		if al.changed == nil {
+			al.changed = make(chan struct{})
+		}
+		changed := al.changed
+		al.mu.Unlock()
+		select {
+		case <-changed:
+			al.mu.Lock()
+		case <-ctx.Done():
+			al.mu.Lock()
+			al.queued = removeActionQueueEntry(al.queued, entry)
+			return nil, vterrors.Errorf(vterrors.DeadlineExceeded, "timed out after %v waiting for the %v action lock for %v", time.Now().Sub(entry.QueueTime), entry.Category, name)
+		}
+	}
+
+	al.queued = removeActionQueueEntry(al.queued, entry)
+	entry.Running = true
+	entry.StartTime = time.Now()
+	al.running = append(al.running, entry)
+	return func() { al.release(entry) }, nil
+}
+
+// release removes a running action, and wakes up the queued ones.
+func (al *actionLock) release(entry *ActionQueueEntry) {
+	al.mu.Lock()
+	defer al.mu.Unlock()
+	al.running = removeActionQueueEntry(al.running, entry)
+	if al.changed != nil {
+		close(al.changed)
+		al.changed = nil
+	}
+}
+
+// snapshot returns a copy of the running actions, followed by the
+// queued ones.
+func (al *actionLock) snapshot() []ActionQueueEntry {
+	al.mu.Lock()
+	defer al.mu.Unlock()
+	result := make([]ActionQueueEntry, 0, len(al.running)+len(al.queued))
+	for _, e := range al.running {
+		result = append(result, *e)
+	}
+	for _, e := range al.queued {
+		result = append(result, *e)
+	}
+	return result
+}
+
+func removeActionQueueEntry(list []*ActionQueueEntry, entry *ActionQueueEntry) []*ActionQueueEntry {
+	for i, e := range list {
+		if e == entry {
+			return append(list[:i], list[i+1:]...)
+		}
+	}
+	return list
+}
+
+// ActionQueue returns the actions currently running, followed by the
+// ones waiting for the action lock.
+func (agent *ActionAgent) ActionQueue() []ActionQueueEntry {
+	return agent.actionLock.snapshot()
+}
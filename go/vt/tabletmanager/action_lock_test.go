@@ -0,0 +1,106 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tabletmanager
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/youtube/vitess/go/history"
+	"github.com/youtube/vitess/go/vt/tabletmanager/actionnode"
+	"github.com/youtube/vitess/go/vt/topo"
+	"golang.org/x/net/context"
+)
+
+func TestActionLock(t *testing.T) {
+	agent := &ActionAgent{
+		TabletAlias:   topo.TabletAlias{Cell: "cell1", Uid: 1},
+		ActionHistory: history.New(actionHistoryLength),
+	}
+	ctx := context.Background()
+
+	// start a slow schema change
+	started := make(chan struct{})
+	finish := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		done <- agent.RPCWrapLock(ctx, actionnode.TabletActionApplySchema, nil, nil, false, func() error {
+			close(started)
+			<-finish
+			return nil
+		})
+	}()
+	<-started
+
+	// a Ping doesn't wait
+	if err := agent.RPCWrap(ctx, actionnode.TabletActionPing, nil, nil, func() error { return nil }); err != nil {
+		t.Fatalf("Ping failed: %v", err)
+	}
+
+	// neither does a replication action
+	if err := agent.RPCWrapLock(ctx, actionnode.TabletActionStopSlave, nil, nil, false, func() error { return nil }); err != nil {
+		t.Fatalf("StopSlave failed: %v", err)
+	}
+
+	// a second schema change is queued until its context expires
+	shortCtx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	queued := make(chan error)
+	go func() {
+		queued <- agent.RPCWrapLock(shortCtx, actionnode.TabletActionPreflightSchema, nil, nil, false, func() error { return nil })
+	}()
+	var queue []ActionQueueEntry
+	for i := 0; i < 100; i++ {
+		if queue = agent.ActionQueue(); len(queue) == 2 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if len(queue) != 2 ||
+		queue[0].Name != actionnode.TabletActionApplySchema || !queue[0].Running ||
+		queue[1].Name != actionnode.TabletActionPreflightSchema || queue[1].Running || queue[1].Category != actionCategorySchema {
+		t.Errorf("unexpected action queue: %#v", queue)
+	}
+	if err := <-queued; err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("queued PreflightSchema should have timed out: %v", err)
+	}
+
+	// once the first one is done, a new schema change can run
+	close(finish)
+	if err := <-done; err != nil {
+		t.Fatalf("ApplySchema failed: %v", err)
+	}
+	if err := agent.RPCWrapLock(ctx, actionnode.TabletActionPreflightSchema, nil, nil, false, func() error { return nil }); err != nil {
+		t.Fatalf("PreflightSchema failed: %v", err)
+	}
+	if queue := agent.ActionQueue(); len(queue) != 0 {
+		t.Errorf("action queue should be empty: %#v", queue)
+	}
+}
+
+func TestActionCategoriesConflict(t *testing.T) {
+	table := []struct {
+		c1, c2   string
+		conflict bool
+	}{
+		{actionCategorySchema, actionCategorySchema, true},
+		{actionCategorySchema, actionCategoryReplication, false},
+		{actionCategorySchema, actionCategoryTypeChange, false},
+		{actionCategorySchema, actionCategoryExclusive, true},
+		{actionCategoryReplication, actionCategoryReplication, true},
+		{actionCategoryReplication, actionCategoryTypeChange, true},
+		{actionCategoryTypeChange, actionCategoryTypeChange, true},
+		{actionCategoryExclusive, actionCategoryReplication, true},
+	}
+	for _, tc := range table {
+		if got := actionCategoriesConflict(tc.c1, tc.c2); got != tc.conflict {
+			t.Errorf("actionCategoriesConflict(%v, %v) = %v, want %v", tc.c1, tc.c2, got, tc.conflict)
+		}
+		if got := actionCategoriesConflict(tc.c2, tc.c1); got != tc.conflict {
+			t.Errorf("actionCategoriesConflict(%v, %v) = %v, want %v", tc.c2, tc.c1, got, tc.conflict)
+		}
+	}
+}
@@ -47,6 +47,10 @@ const (
 	// TabletActionScrap scraps the live running tablet
 	TabletActionScrap = "Scrap"
 
+	// TabletActionSetMaintenanceMode puts the tablet in or out of
+	// maintenance mode
+	TabletActionSetMaintenanceMode = "SetMaintenanceMode"
+
 	// TabletActionResetReplication tells the tablet it should
 	// reset its replication state
 	TabletActionResetReplication = "ResetReplication"
@@ -119,6 +123,12 @@ const (
 	// replication position in filtered replication
 	TabletActionWaitBLPPosition = "WaitBlpPosition"
 
+	// TabletActionGetBLPCheckpoints returns the blp_checkpoint table
+	TabletActionGetBLPCheckpoints = "GetBlpCheckpoints"
+
+	// TabletActionGetBLPStatus returns the status of the binlog players
+	TabletActionGetBLPStatus = "GetBlpStatus"
+
 	// TabletActionStopBLP stops filtered replication
 	TabletActionStopBLP = "StopBlp"
 
@@ -140,6 +150,10 @@ const (
 	// tablet record from the topo server.
 	TabletActionRunHealthCheck = "RunHealthCheck"
 
+	// TabletActionSetPoolSize resizes one of the connection pools
+	// of the query service.
+	TabletActionSetPoolSize = "SetPoolSize"
+
 	// TabletActionHealthStream will stream the health status
 	TabletActionHealthStream = "HealthStream"
 
@@ -158,6 +172,13 @@ const (
 	// TabletActionExecuteFetchAsApp uses the App connection to run queries.
 	TabletActionExecuteFetchAsApp = "ExecuteFetchAsApp"
 
+	// TabletActionReloadUsers applies the users spec file to mysqld.
+	TabletActionReloadUsers = "ReloadUsers"
+
+	// TabletActionReloadTableACL reloads the table ACL config from
+	// the topology.
+	TabletActionReloadTableACL = "ReloadTableACL"
+
 	// TabletActionGetPermissions returns the mysql permissions set
 	TabletActionGetPermissions = "GetPermissions"
 
@@ -168,6 +189,30 @@ const (
 	// TabletActionBackup takes a db backup and stores it into BackupStorage
 	TabletActionBackup = "Backup"
 
+	// TabletActionStreamingCloneSourceStart prepares the tablet to
+	// be the source of a streaming clone
+	TabletActionStreamingCloneSourceStart = "StreamingCloneSourceStart"
+
+	// TabletActionStreamingCloneSourceEnd puts the source of a
+	// streaming clone back in service
+	TabletActionStreamingCloneSourceEnd = "StreamingCloneSourceEnd"
+
+	// TabletActionVerifyBackup checks the integrity of a backup of
+	// the shard, without restoring it
+	TabletActionVerifyBackup = "VerifyBackup"
+
+	// TabletActionRestoreFromBackup restores the most recent backup
+	// of the shard over the data of the tablet
+	TabletActionRestoreFromBackup = "RestoreFromBackup"
+
+	// TabletActionGetActionHistory returns the recent actions run
+	// by the tablet manager and their outcome
+	TabletActionGetActionHistory = "GetActionHistory"
+
+	// TabletActionGetRuntimeStats returns a snapshot of the query
+	// service activity
+	TabletActionGetRuntimeStats = "GetRuntimeStats"
+
 	//
 	// Shard actions - involve all tablets in a shard.
 	// These are just descriptive and used for locking / logging.
@@ -221,6 +266,13 @@ const (
 	// KeyspaceActionSetServedFrom updates ServedFrom
 	KeyspaceActionSetServedFrom = "SetKeyspaceServedFrom"
 
+	// KeyspaceActionSetTableACL updates the table ACL config
+	KeyspaceActionSetTableACL = "SetKeyspaceTableACL"
+
+	// KeyspaceActionSetQueryRules updates the query rules of the
+	// keyspace or of one of its tablets
+	KeyspaceActionSetQueryRules = "SetKeyspaceQueryRules"
+
 	// KeyspaceActionCreateShard protects shard creation within the keyspace
 	KeyspaceActionCreateShard = "KeyspaceCreateShard"
 
@@ -232,6 +284,14 @@ const (
 	// SrvShardActionRebuild locks the SvrShard for rebuild
 	SrvShardActionRebuild = "RebuildSrvShard"
 
+	//
+	// vtctld actions - they lock the keyspace or shard they run on
+	// only to record themselves in its action log.
+	//
+
+	// ActionVtctld records an action run from the vtctld web UI or API
+	ActionVtctld = "VtctldAction"
+
 	// all the valid states for an action
 
 	// ActionStateQueued is for an action that is going to be executed
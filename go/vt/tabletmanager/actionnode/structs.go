@@ -7,6 +7,7 @@ package actionnode
 import (
 	"time"
 
+	myproto "github.com/youtube/vitess/go/vt/mysqlctl/proto"
 	"github.com/youtube/vitess/go/vt/topo"
 )
 
@@ -44,11 +45,55 @@ type HealthStreamReply struct {
 	// TODO(alainjobart) add some QPS reporting data here
 }
 
+// ActionHistoryRecord describes one action run by the tablet manager,
+// as kept in its action history and returned by GetActionHistory.
+type ActionHistoryRecord struct {
+	// Name is the action name, like TabletActionChangeType
+	Name string
+
+	// Args is a short summary of the action arguments
+	Args string
+
+	// From describes the caller, if known
+	From string
+
+	// StartTime and EndTime are the times the action started and
+	// finished. StartTime is taken before waiting on the action lock.
+	StartTime time.Time
+	EndTime   time.Time
+
+	// Error is the error the action returned, or empty if it succeeded
+	Error string
+}
+
 // SlaveWasRestartedArgs is the paylod for SlaveWasRestarted
 type SlaveWasRestartedArgs struct {
 	Parent topo.TabletAlias
 }
 
+// StreamingCloneSourceReply is the response for StreamingCloneSourceStart
+type StreamingCloneSourceReply struct {
+	// Position is the replication position of the data that
+	// is served, replication is stopped there.
+	Position myproto.ReplicationPosition
+
+	// DbName is the database that is served.
+	DbName string
+
+	// SchemaDefinition is the schema of the database, the data
+	// of its base tables can be streamed.
+	SchemaDefinition *myproto.SchemaDefinition
+
+	// OriginalType is the type of the tablet before it became a
+	// source, to give back to StreamingCloneSourceEnd.
+	OriginalType topo.TabletType
+}
+
+// StreamingCloneSourceEndArgs is the payload for StreamingCloneSourceEnd
+type StreamingCloneSourceEndArgs struct {
+	OriginalType topo.TabletType
+}
+
 // shard action node structures
 
 // ApplySchemaShardArgs is the payload for ApplySchemaShard
@@ -186,6 +231,20 @@ func SetKeyspaceServedFrom() *ActionNode {
 	}).SetGuid()
 }
 
+// SetKeyspaceTableACL returns an ActionNode
+func SetKeyspaceTableACL() *ActionNode {
+	return (&ActionNode{
+		Action: KeyspaceActionSetTableACL,
+	}).SetGuid()
+}
+
+// SetKeyspaceQueryRules returns an ActionNode
+func SetKeyspaceQueryRules() *ActionNode {
+	return (&ActionNode{
+		Action: KeyspaceActionSetQueryRules,
+	}).SetGuid()
+}
+
 // ApplySchemaKeyspace returns an ActionNode
 func ApplySchemaKeyspace(change string, simple bool) *ActionNode {
 	return (&ActionNode{
@@ -223,3 +282,29 @@ func RebuildSrvShard() *ActionNode {
 		Action: SrvShardActionRebuild,
 	}).SetGuid()
 }
+
+// methods to build the vtctld action nodes
+
+// VtctldActionArgs is the payload for VtctldAction
+type VtctldActionArgs struct {
+	// Action is the name of the vtctld action, like ReloadSchema
+	Action string
+
+	// Target is the keyspace, keyspace/shard or tablet alias it ran on
+	Target string
+
+	// User is the acting user, as reported to vtctld
+	User string
+}
+
+// VtctldAction returns an ActionNode
+func VtctldAction(action, target, user string) *ActionNode {
+	return (&ActionNode{
+		Action: ActionVtctld,
+		Args: &VtctldActionArgs{
+			Action: action,
+			Target: target,
+			User:   user,
+		},
+	}).SetGuid()
+}
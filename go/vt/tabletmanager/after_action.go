@@ -224,6 +224,9 @@ func (agent *ActionAgent) changeCallback(ctx context.Context, oldTablet, newTabl
 	statsKeyRangeStart.Set(string(newTablet.KeyRange.Start.Hex()))
 	statsKeyRangeEnd.Set(string(newTablet.KeyRange.End.Hex()))
 
+	// slaves get the crash-safe replication settings
+	agent.updateReplicaSafetySettings(ctx, oldTablet, newTablet)
+
 	// See if we need to start or stop any binlog player
 	if agent.BinlogPlayerMap != nil {
 		if newTablet.Type == topo.TYPE_MASTER {
@@ -13,8 +13,10 @@ topology server. Only 'ScrapTablet -force' and 'DeleteTablet'
 should be run by other processes, everything else should ask
 the tablet server to make the change.
 
-Most RPC calls lock the actionMutex, except the easy read-only ones.
-RPC calls that change the tablet record will also call updateState.
+Most RPC calls lock the actionMutex, except the easy read-only ones
+and the schema changes, that only wait for other schema changes (see
+action_lock.go). RPC calls that change the tablet record will also
+call updateState.
 
 See rpc_server.go for all cases, and which actions take the actionMutex,
 and which run changeCallback.
@@ -44,6 +46,8 @@ import (
 	"github.com/youtube/vitess/go/vt/tabletmanager/actionnode"
 	"github.com/youtube/vitess/go/vt/tabletmanager/events"
 	"github.com/youtube/vitess/go/vt/tabletserver"
+	"github.com/youtube/vitess/go/vt/tabletserver/customrule/topocustomrule"
+	tproto "github.com/youtube/vitess/go/vt/tabletserver/proto"
 	"github.com/youtube/vitess/go/vt/topo"
 )
 
@@ -72,23 +76,56 @@ type ActionAgent struct {
 	// finalizeReparentCtx represents the background finalize step of a
 	// TabletExternallyReparented call.
 	finalizeReparentCtx context.Context
+	// topoCustomRule watches the custom rules of the topology, if
+	// -topocustomrules is set.
+	topoCustomRule *topocustomrule.TopoCustomRule
 
 	// This is the History of the health checks, public so status
 	// pages can display it
 	History            *history.History
 	lastHealthMapCount *stats.Int
 
+	// ActionHistory is the History of the tablet manager actions
+	// we ran, with their outcome.
+	ActionHistory *history.History
+
+	// actionLock decides which locking RPCs can run concurrently,
+	// see action_lock.go. It is taken before actionMutex.
+	actionLock actionLock
+
 	// actionMutex is there to run only one action at a time. If
 	// both agent.actionMutex and agent.mutex needs to be taken,
 	// take actionMutex first.
 	actionMutex sync.Mutex
 
+	// _lastReplicationRepair is the last time the health check
+	// repaired replication. Protected by actionMutex.
+	_lastReplicationRepair time.Time
+
+	// unreachableSlaves are the tablets of the shard the binary logs
+	// purges couldn't reach, with the time of the first failure. Only
+	// used by the purge timer, see binlog_purge.go.
+	unreachableSlaves map[topo.TabletAlias]time.Time
+
 	// mutex protects the following fields
 	mutex            sync.Mutex
 	_tablet          *topo.TabletInfo
 	_tabletControl   *topo.TabletControl
 	_waitingForMysql bool
 
+	// _pendingSlaveWasRestarted is the last SlaveWasRestarted call
+	// waiting for the end of its coalescing window, if any.
+	_pendingSlaveWasRestarted *actionnode.SlaveWasRestartedArgs
+
+	// _streamingCloneSource is set while the tablet is the source of
+	// a streaming clone, between StreamingCloneSourceStart and
+	// StreamingCloneSourceEnd.
+	_streamingCloneSource *actionnode.StreamingCloneSourceReply
+
+	// _replicaSafetyMismatches are the replica settings that didn't
+	// match when the tablet last became a slave type, as name=value.
+	_replicaSafetyMismatches []string
+
 	// if the agent is healthy, this is nil. Otherwise it contains
 	// the reason we're not healthy.
 	_healthy error
@@ -99,6 +136,10 @@ type ActionAgent struct {
 	// replication delay the last time we got it
 	_replicationDelay time.Duration
 
+	// last sample of the query service stats, and when it was taken
+	_runtimeStats     *tproto.RuntimeStats
+	_runtimeStatsTime time.Time
+
 	// healthStreamMutex protects all the following fields
 	healthStreamMutex sync.Mutex
 	healthStreamIndex int
@@ -151,6 +192,7 @@ func NewActionAgent(
 		SchemaOverrides:     schemaOverrides,
 		LockTimeout:         lockTimeout,
 		History:             history.New(historyLength),
+		ActionHistory:       history.New(actionHistoryLength),
 		lastHealthMapCount:  stats.NewInt("LastHealthMapCount"),
 		_healthy:            fmt.Errorf("healthcheck not run yet"),
 		healthStreamMap:     make(map[int]chan<- *actionnode.HealthStreamReply),
@@ -181,12 +223,35 @@ func NewActionAgent(
 		}
 	}
 
+	// the table ACLs have to be loaded before Start enables the
+	// query service
+	if *tableACLFromTopo {
+		if err := agent.loadTableACL(batchCtx); err != nil {
+			return nil, err
+		}
+	}
+
+	// so do the custom rules of the topology, which are then
+	// watched and applied without a restart
+	agent.topoCustomRule, err = topocustomrule.ActivateTopoCustomRules(batchCtx, queryServiceControl, topoServer, tabletAlias)
+	if err != nil {
+		return nil, fmt.Errorf("cannot activate the custom rules of the topology: %v", err)
+	}
+
 	if err := agent.Start(mysqlPort, port, securePort); err != nil {
 		return nil, err
 	}
 
 	// register the RPC services from the agent
 	agent.registerQueryService()
+	agent.registerActionHistoryPage()
+	agent.registerStreamingCloneHandler()
+
+	// start the periodic binary logs purge if needed
+	agent.initBinlogPurge()
+
+	// start exporting the mysqld status if needed
+	agent.initMysqlStatusPoller()
 
 	// two cases then:
 	// - restoreFromBackup is set: we restore, then initHealthCheck, all
@@ -196,9 +261,9 @@ func NewActionAgent(
 		go func() {
 			// restoreFromBackup wil just be a regular action
 			// (same as if it was triggered remotely)
-			if err := agent.RestoreFromBackup(); err != nil {
-				println(fmt.Sprintf("RestoreFromBackup failed: %v", err))
-				log.Fatalf("RestoreFromBackup failed: %v", err)
+			if err := agent.RestoreAtStartup(); err != nil {
+				println(fmt.Sprintf("RestoreAtStartup failed: %v", err))
+				log.Fatalf("RestoreAtStartup failed: %v", err)
 			}
 
 			// after the restore is done, start health check
@@ -214,7 +279,8 @@ func NewActionAgent(
 
 // NewTestActionAgent creates an agent for test purposes. Only a
 // subset of features are supported now, but we'll add more over time.
-func NewTestActionAgent(batchCtx context.Context, ts topo.Server, tabletAlias topo.TabletAlias, port int, mysqlDaemon mysqlctl.MysqlDaemon) *ActionAgent {
+// securePort is the vts port of the tablet, 0 if it has none.
+func NewTestActionAgent(batchCtx context.Context, ts topo.Server, tabletAlias topo.TabletAlias, port, securePort int, mysqlDaemon mysqlctl.MysqlDaemon) *ActionAgent {
 	agent := &ActionAgent{
 		QueryServiceControl: tabletserver.NewTestQueryServiceControl(),
 		HealthReporter:      health.DefaultAggregator,
@@ -227,11 +293,12 @@ func NewTestActionAgent(batchCtx context.Context, ts topo.Server, tabletAlias to
 		SchemaOverrides:     nil,
 		BinlogPlayerMap:     nil,
 		History:             history.New(historyLength),
+		ActionHistory:       history.New(actionHistoryLength),
 		lastHealthMapCount:  new(stats.Int),
 		_healthy:            fmt.Errorf("healthcheck not run yet"),
 		healthStreamMap:     make(map[int]chan<- *actionnode.HealthStreamReply),
 	}
-	if err := agent.Start(0, port, 0); err != nil {
+	if err := agent.Start(0, port, securePort); err != nil {
 		panic(fmt.Errorf("agent.Start(%v) failed: %v", tabletAlias, err))
 	}
 	return agent
@@ -425,9 +492,9 @@ func (agent *ActionAgent) Start(mysqlPort, vtPort, vtsPort int) error {
 		}
 		tablet.Portmap["vt"] = vtPort
 		if vtsPort != 0 {
-			tablet.Portmap["vts"] = vtsPort
+			tablet.Portmap[topo.SecurePortName] = vtsPort
 		} else {
-			delete(tablet.Portmap, "vts")
+			delete(tablet.Portmap, topo.SecurePortName)
 		}
 		return nil
 	}
@@ -457,6 +524,9 @@ func (agent *ActionAgent) Start(mysqlPort, vtPort, vtsPort int) error {
 
 // Stop shutdowns this agent.
 func (agent *ActionAgent) Stop() {
+	if agent.topoCustomRule != nil {
+		agent.topoCustomRule.Close()
+	}
 	if agent.BinlogPlayerMap != nil {
 		agent.BinlogPlayerMap.StopAllPlayersAndReset()
 	}
@@ -8,13 +8,16 @@ import (
 	"fmt"
 	"time"
 
+	log "github.com/golang/glog"
 	"github.com/youtube/vitess/go/mysql/proto"
 	blproto "github.com/youtube/vitess/go/vt/binlog/proto"
 	"github.com/youtube/vitess/go/vt/hook"
 	"github.com/youtube/vitess/go/vt/logutil"
 	"github.com/youtube/vitess/go/vt/mysqlctl"
+	"github.com/youtube/vitess/go/vt/mysqlctl/backupstorage"
 	myproto "github.com/youtube/vitess/go/vt/mysqlctl/proto"
 	"github.com/youtube/vitess/go/vt/tabletmanager/actionnode"
+	tproto "github.com/youtube/vitess/go/vt/tabletserver/proto"
 	"github.com/youtube/vitess/go/vt/topo"
 	"github.com/youtube/vitess/go/vt/topotools"
 	"golang.org/x/net/context"
@@ -36,14 +39,20 @@ type RPCAgent interface {
 
 	GetPermissions(ctx context.Context) (*myproto.Permissions, error)
 
+	GetActionHistory(ctx context.Context) []*actionnode.ActionHistoryRecord
+
+	GetRuntimeStats(ctx context.Context) *tproto.RuntimeStats
+
 	// Various read-write methods
 
 	SetReadOnly(ctx context.Context, rdonly bool) error
 
-	ChangeType(ctx context.Context, tabletType topo.TabletType) error
+	ChangeType(ctx context.Context, tabletType topo.TabletType, force bool) error
 
 	Scrap(ctx context.Context) error
 
+	SetMaintenanceMode(ctx context.Context, on bool, reason string) error
+
 	Sleep(ctx context.Context, duration time.Duration)
 
 	ExecuteHook(ctx context.Context, hk *hook.Hook) *hook.HookResult
@@ -52,6 +61,8 @@ type RPCAgent interface {
 
 	RunHealthCheck(ctx context.Context, targetTabletType topo.TabletType)
 
+	SetPoolSize(ctx context.Context, pool string, size int) error
+
 	RegisterHealthStream(chan<- *actionnode.HealthStreamReply) (int, error)
 	UnregisterHealthStream(int) error
 
@@ -65,6 +76,10 @@ type RPCAgent interface {
 
 	ExecuteFetchAsApp(ctx context.Context, query string, maxrows int, wantFields bool) (*proto.QueryResult, error)
 
+	ReloadUsers(ctx context.Context) ([]string, error)
+
+	ReloadTableACL(ctx context.Context) error
+
 	// Replication related methods
 
 	SlaveStatus(ctx context.Context) (myproto.ReplicationStatus, error)
@@ -83,6 +98,10 @@ type RPCAgent interface {
 
 	WaitBlpPosition(ctx context.Context, blpPosition *blproto.BlpPosition, waitTime time.Duration) error
 
+	GetBlpCheckpoints(ctx context.Context) (*blproto.BlpCheckpointList, error)
+
+	GetBlpStatus(ctx context.Context) (*blproto.BlpStatusList, error)
+
 	StopBlp(ctx context.Context) (*blproto.BlpPositionList, error)
 
 	StartBlp(ctx context.Context) error
@@ -115,7 +134,15 @@ type RPCAgent interface {
 
 	// Backup / restore related methods
 
-	Backup(ctx context.Context, concurrency int, logger logutil.Logger) error
+	Backup(ctx context.Context, concurrency int, bandwidthLimit int64, skipSpaceCheck bool, logger logutil.Logger) error
+
+	StreamingCloneSourceStart(ctx context.Context) (*actionnode.StreamingCloneSourceReply, error)
+
+	StreamingCloneSourceEnd(ctx context.Context, originalType topo.TabletType) error
+
+	VerifyBackup(ctx context.Context, name string) error
+
+	RestoreFromBackup(ctx context.Context, logger logutil.Logger) error
 
 	// RPC helpers
 	RPCWrap(ctx context.Context, name string, args, reply interface{}, f func() error) error
@@ -154,9 +181,24 @@ func (agent *ActionAgent) SetReadOnly(ctx context.Context, rdonly bool) error {
 	return agent.MysqlDaemon.SetReadOnly(rdonly)
 }
 
-// ChangeType changes the tablet type
+// ChangeType changes the tablet type, if the transition is allowed
+// (see type_transitions.go). With force, illegal transitions are
+// applied anyway, and recorded in the tablet tags.
 // Should be called under RPCWrapLockAction.
-func (agent *ActionAgent) ChangeType(ctx context.Context, tabletType topo.TabletType) error {
+func (agent *ActionAgent) ChangeType(ctx context.Context, tabletType topo.TabletType, force bool) error {
+	tablet, err := agent.TopoServer.GetTablet(agent.TabletAlias)
+	if err != nil {
+		return err
+	}
+	if tablet.Type == tabletType {
+		return nil
+	}
+	if err := checkTypeTransition(tablet.Type, tabletType); err != nil {
+		if !force {
+			return err
+		}
+		return agent.forceChangeType(ctx, err, tabletType)
+	}
 	return topotools.ChangeType(ctx, agent.TopoServer, agent.TabletAlias, tabletType, nil)
 }
 
@@ -190,6 +232,12 @@ func (agent *ActionAgent) RunHealthCheck(ctx context.Context, targetTabletType t
 	agent.runHealthCheck(targetTabletType)
 }
 
+// SetPoolSize resizes one of the connection pools of the query service.
+// Should be called under RPCWrap, the pools can be resized concurrently.
+func (agent *ActionAgent) SetPoolSize(ctx context.Context, pool string, size int) error {
+	return agent.QueryServiceControl.SetPoolSize(pool, size)
+}
+
 // RegisterHealthStream adds a health stream channel to our list
 func (agent *ActionAgent) RegisterHealthStream(c chan<- *actionnode.HealthStreamReply) (int, error) {
 	agent.healthStreamMutex.Lock()
@@ -306,6 +354,13 @@ func (agent *ActionAgent) ExecuteFetchAsApp(ctx context.Context, query string, m
 	return conn.ExecuteFetch(query, maxrows, wantFields)
 }
 
+// ReloadUsers applies the users spec file, and returns the statements
+// that changed the users and their grants.
+// Should be called under RPCWrapLockAction.
+func (agent *ActionAgent) ReloadUsers(ctx context.Context) ([]string, error) {
+	return agent.MysqlDaemon.ReloadUsers()
+}
+
 // SlaveStatus returns the replication status
 // Should be called under RPCWrap.
 func (agent *ActionAgent) SlaveStatus(ctx context.Context) (myproto.ReplicationStatus, error) {
@@ -326,8 +381,9 @@ func (agent *ActionAgent) StopSlave(ctx context.Context) error {
 }
 
 // StopSlaveMinimum will stop the slave after it reaches at least the
-// provided position. Works both when Vitess manages
-// replication or not (using hook if not).
+// provided position, and returns the position it stopped at. Works
+// both when Vitess manages replication or not (using hook if not).
+// Should be called under RPCWrapLock.
 func (agent *ActionAgent) StopSlaveMinimum(ctx context.Context, position myproto.ReplicationPosition, waitTime time.Duration) (myproto.ReplicationPosition, error) {
 	if err := agent.MysqlDaemon.WaitMasterPos(position, waitTime); err != nil {
 		return myproto.ReplicationPosition{}, err
@@ -335,7 +391,14 @@ func (agent *ActionAgent) StopSlaveMinimum(ctx context.Context, position myproto
 	if err := mysqlctl.StopSlave(agent.MysqlDaemon, agent.hookExtraEnv()); err != nil {
 		return myproto.ReplicationPosition{}, err
 	}
-	return agent.MysqlDaemon.MasterPosition()
+	stopPos, err := agent.MysqlDaemon.MasterPosition()
+	if err != nil {
+		return myproto.ReplicationPosition{}, err
+	}
+	if !stopPos.AtLeast(position) {
+		return myproto.ReplicationPosition{}, fmt.Errorf("slave stopped at %v, before the requested position %v", stopPos, position)
+	}
+	return stopPos, nil
 }
 
 // StartSlave will start the replication. Works both when Vitess manages
@@ -355,7 +418,22 @@ func (agent *ActionAgent) GetSlaves(ctx context.Context) ([]string, error) {
 // reached.
 // Should be called under RPCWrapLock.
 func (agent *ActionAgent) WaitBlpPosition(ctx context.Context, blpPosition *blproto.BlpPosition, waitTime time.Duration) error {
-	return agent.Mysqld.WaitBlpPosition(blpPosition, waitTime)
+	return mysqlctl.WaitBlpPosition(agent.MysqlDaemon, blpPosition, waitTime)
+}
+
+// GetBlpCheckpoints returns the content of the blp_checkpoint table:
+// where each binlog player is, as committed with the data.
+func (agent *ActionAgent) GetBlpCheckpoints(ctx context.Context) (*blproto.BlpCheckpointList, error) {
+	return mysqlctl.ReadBlpCheckpoints(agent.MysqlDaemon)
+}
+
+// GetBlpStatus returns the status of the binlog players: where each
+// is in memory, its lag and its last error.
+func (agent *ActionAgent) GetBlpStatus(ctx context.Context) (*blproto.BlpStatusList, error) {
+	if agent.BinlogPlayerMap == nil {
+		return nil, fmt.Errorf("No BinlogPlayerMap configured")
+	}
+	return agent.BinlogPlayerMap.BlpStatusList(), nil
 }
 
 // StopBlp stops the binlog players, and return their positions.
@@ -464,7 +542,7 @@ func (agent *ActionAgent) InitSlave(ctx context.Context, parent topo.TabletAlias
 		MasterHost: ti.Hostname,
 		MasterPort: ti.Portmap["mysql"],
 	}
-	cmds, err := agent.MysqlDaemon.StartReplicationCommands(status)
+	cmds, err := agent.MysqlDaemon.StartReplicationCommands(ti.Keyspace, ti.Shard, status)
 	if err != nil {
 		return err
 	}
@@ -477,21 +555,20 @@ func (agent *ActionAgent) InitSlave(ctx context.Context, parent topo.TabletAlias
 	return agent.MysqlDaemon.WaitForReparentJournal(ctx, timeCreatedNS)
 }
 
-// DemoteMaster marks the server read-only, wait until it is done with
-// its current transactions, and returns its master position.
+// DemoteMaster stops the query service, marks the server read-only,
+// kills the remaining write connections, waits until it is done with
+// its current transactions, and returns its master position. The
+// read-only switch and the position are done in one mysqld call, so
+// the returned position is final.
 // Should be called under RPCWrapLockAction.
 func (agent *ActionAgent) DemoteMaster(ctx context.Context) (myproto.ReplicationPosition, error) {
-	// Set the server read-only. Note all active connections are not
-	// affected.
-	if err := agent.MysqlDaemon.SetReadOnly(true); err != nil {
-		return myproto.ReplicationPosition{}, err
-	}
-
-	// Now stop the query service, to make sure nobody is writing to the
-	// database. This will in effect close the connection pools to the
-	// database.
+	// Stop the query service, to make sure nobody is writing to the
+	// database through us. This will in effect close the connection
+	// pools to the database.
 	agent.disallowQueries()
 
+	// Now set the server super read-only, kill anything
+	// else that may still write, and get the final position.
 	return agent.MysqlDaemon.DemoteMaster()
 	// There is no serving graph update - the master tablet will
 	// be replaced. Even though writes may fail, reads will
@@ -569,7 +646,7 @@ func (agent *ActionAgent) SetMaster(ctx context.Context, parent topo.TabletAlias
 	if wasReplicating {
 		cmds = append(cmds, mysqlctl.SqlStopSlave)
 	}
-	smc, err := agent.MysqlDaemon.SetMasterCommands(ti.Hostname, ti.Portmap["mysql"])
+	smc, err := agent.MysqlDaemon.SetMasterCommands(ti.Keyspace, ti.Shard, ti.Hostname, ti.Portmap["mysql"])
 	if err != nil {
 		return err
 	}
@@ -603,30 +680,44 @@ func (agent *ActionAgent) SetMaster(ctx context.Context, parent topo.TabletAlias
 }
 
 // SlaveWasRestarted updates the parent record for a tablet.
+// If -slave_was_restarted_coalesce_window is set, the update is only
+// queued, and applied at the end of the window.
 // Should be called under RPCWrapLockAction.
 func (agent *ActionAgent) SlaveWasRestarted(ctx context.Context, swrd *actionnode.SlaveWasRestartedArgs) error {
-	tablet, err := agent.TopoServer.GetTablet(agent.TabletAlias)
-	if err != nil {
-		return err
+	if *slaveWasRestartedCoalesceWindow > 0 {
+		agent.queueSlaveWasRestarted(swrd)
+		return nil
 	}
+	return agent.slaveWasRestartedUpdateTopo(ctx)
+}
 
-	// Once this action completes, update authoritative tablet node first.
-	if tablet.Type == topo.TYPE_MASTER {
-		tablet.Type = topo.TYPE_SPARE
-	}
-	err = topo.UpdateTablet(ctx, agent.TopoServer, tablet)
-	if err != nil {
-		return err
-	}
+// slaveWasRestartedUpdateTopo does the topology part of SlaveWasRestarted.
+// Should be called under actionMutex.
+func (agent *ActionAgent) slaveWasRestartedUpdateTopo(ctx context.Context) error {
+	return throttleTopoWrite("SlaveWasRestarted", func() error {
+		tablet, err := agent.TopoServer.GetTablet(agent.TabletAlias)
+		if err != nil {
+			return err
+		}
 
-	// Update the new tablet location in the replication graph now that
-	// we've updated the tablet.
-	err = topo.UpdateTabletReplicationData(ctx, agent.TopoServer, tablet.Tablet)
-	if err != nil && err != topo.ErrNodeExists {
-		return err
-	}
+		// Once this action completes, update authoritative tablet node first.
+		if tablet.Type == topo.TYPE_MASTER {
+			tablet.Type = topo.TYPE_SPARE
+		}
+		err = topo.UpdateTablet(ctx, agent.TopoServer, tablet)
+		if err != nil {
+			return err
+		}
 
-	return nil
+		// Update the new tablet location in the replication graph now that
+		// we've updated the tablet.
+		err = topo.UpdateTabletReplicationData(ctx, agent.TopoServer, tablet.Tablet)
+		if err != nil && err != topo.ErrNodeExists {
+			return err
+		}
+
+		return nil
+	})
 }
 
 // StopReplicationAndGetStatus stops MySQL replication, and returns the
@@ -701,25 +792,38 @@ func (agent *ActionAgent) updateReplicationGraphForPromotedSlave(ctx context.Con
 // Backup / restore related methods
 //
 
-// Backup takes a db backup and sends it to the BackupStorage
+// Backup takes a db backup and sends it to the BackupStorage.
+// If bandwidthLimit is 0, -backup_bandwidth_limit is used.
+// If skipSpaceCheck is set, the backup is taken even if the backup
+// storage doesn't seem to have enough space for it.
+// If the backup engine needs it, the tablet goes to the backup type
+// and stops serving while the backup is taken.
 // Should be called under RPCWrapLockAction.
-func (agent *ActionAgent) Backup(ctx context.Context, concurrency int, logger logutil.Logger) error {
+func (agent *ActionAgent) Backup(ctx context.Context, concurrency int, bandwidthLimit int64, skipSpaceCheck bool, logger logutil.Logger) error {
+	engine, err := mysqlctl.GetBackupEngine()
+	if err != nil {
+		return err
+	}
+
 	// update our type to TYPE_BACKUP
 	tablet, err := agent.TopoServer.GetTablet(agent.TabletAlias)
 	if err != nil {
 		return err
 	}
-	if tablet.Type == topo.TYPE_MASTER {
+	drain := engine.ShouldDrainForBackup()
+	if drain && tablet.Type == topo.TYPE_MASTER {
 		return fmt.Errorf("type MASTER cannot take backup, if you really need to do this, restart vttablet in replica mode")
 	}
 	originalType := tablet.Type
-	if err := topotools.ChangeType(ctx, agent.TopoServer, tablet.Alias, topo.TYPE_BACKUP, make(map[string]string)); err != nil {
-		return err
-	}
+	if drain {
+		if err := topotools.ChangeType(ctx, agent.TopoServer, tablet.Alias, topo.TYPE_BACKUP, make(map[string]string)); err != nil {
+			return err
+		}
 
-	// let's update our internal state (stop query service and other things)
-	if err := agent.refreshTablet(ctx, "backup"); err != nil {
-		return fmt.Errorf("failed to update state before backup: %v", err)
+		// let's update our internal state (stop query service and other things)
+		if err := agent.refreshTablet(ctx, "backup"); err != nil {
+			return fmt.Errorf("failed to update state before backup: %v", err)
+		}
 	}
 
 	// create the loggers: tee to console and source
@@ -727,8 +831,17 @@ func (agent *ActionAgent) Backup(ctx context.Context, concurrency int, logger lo
 
 	// now we can run the backup
 	bucket := fmt.Sprintf("%v/%v", tablet.Keyspace, tablet.Shard)
-	name := fmt.Sprintf("%v.%v", tablet.Alias, time.Now().UTC().Format("2006-01-02.150405"))
-	returnErr := mysqlctl.Backup(agent.MysqlDaemon, l, bucket, name, concurrency, agent.hookExtraEnv())
+	name := backupstorage.BackupName(tablet.Alias.String(), time.Now())
+	if bandwidthLimit == 0 {
+		bandwidthLimit = *backupBandwidthLimit
+	}
+	returnErr := mysqlctl.Backup(agent.MysqlDaemon, l, bucket, name, concurrency, bandwidthLimit, skipSpaceCheck, agent.hookExtraEnv())
+	if returnErr == nil && *backupRetentionCount > 0 {
+		removeOldBackups(l, bucket, *backupRetentionCount)
+	}
+	if !drain {
+		return returnErr
+	}
 
 	// and change our type back to the appropriate value:
 	// - if healthcheck is enabled, go to spare
@@ -748,3 +861,168 @@ func (agent *ActionAgent) Backup(ctx context.Context, concurrency int, logger lo
 
 	return returnErr
 }
+
+// StreamingCloneSourceStart makes the tablet the source of a
+// streaming clone: it stops serving and replicating, and its data can
+// then be streamed by the /streamingclone/table handler, until
+// StreamingCloneSourceEnd is called.
+// Should be called under RPCWrapLockAction.
+func (agent *ActionAgent) StreamingCloneSourceStart(ctx context.Context) (*actionnode.StreamingCloneSourceReply, error) {
+	tablet, err := agent.TopoServer.GetTablet(agent.TabletAlias)
+	if err != nil {
+		return nil, err
+	}
+	if tablet.Type == topo.TYPE_MASTER {
+		return nil, fmt.Errorf("type MASTER cannot be a streaming clone source")
+	}
+	agent.mutex.Lock()
+	active := agent._streamingCloneSource != nil
+	agent.mutex.Unlock()
+	if active {
+		return nil, fmt.Errorf("tablet is already a streaming clone source")
+	}
+
+	originalType := tablet.Type
+	if err := topotools.ChangeType(ctx, agent.TopoServer, tablet.Alias, topo.TYPE_BACKUP, make(map[string]string)); err != nil {
+		return nil, err
+	}
+	reply, err := agent.startStreamingCloneSource(ctx, tablet.DbName())
+	if err != nil {
+		if endErr := agent.StreamingCloneSourceEnd(ctx, originalType); endErr != nil {
+			log.Warningf("Cannot put the tablet back in service after a failed StreamingCloneSourceStart: %v", endErr)
+		}
+		return nil, err
+	}
+	reply.OriginalType = originalType
+	return reply, nil
+}
+
+// startStreamingCloneSource does the work of
+// StreamingCloneSourceStart after the type change.
+func (agent *ActionAgent) startStreamingCloneSource(ctx context.Context, dbName string) (*actionnode.StreamingCloneSourceReply, error) {
+	// let's update our internal state (stop query service and other things)
+	if err := agent.refreshTablet(ctx, "streaming clone source"); err != nil {
+		return nil, fmt.Errorf("failed to update state before streaming clone: %v", err)
+	}
+	if err := mysqlctl.StopSlave(agent.MysqlDaemon, agent.hookExtraEnv()); err != nil {
+		return nil, fmt.Errorf("cannot stop slave: %v", err)
+	}
+	status, err := agent.MysqlDaemon.SlaveStatus()
+	if err != nil {
+		return nil, fmt.Errorf("cannot get slave status: %v", err)
+	}
+	sd, err := agent.MysqlDaemon.GetSchema(dbName, nil, nil, true)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get schema: %v", err)
+	}
+	reply := &actionnode.StreamingCloneSourceReply{
+		Position:         status.Position,
+		DbName:           dbName,
+		SchemaDefinition: sd,
+	}
+	agent.mutex.Lock()
+	agent._streamingCloneSource = reply
+	agent.mutex.Unlock()
+	return reply, nil
+}
+
+// StreamingCloneSourceEnd stops serving the data of a streaming
+// clone, restarts replication, and changes the type of the tablet
+// back to originalType, or spare if the health check is running.
+// Should be called under RPCWrapLockAction.
+func (agent *ActionAgent) StreamingCloneSourceEnd(ctx context.Context, originalType topo.TabletType) error {
+	agent.mutex.Lock()
+	agent._streamingCloneSource = nil
+	agent.mutex.Unlock()
+
+	if err := mysqlctl.StartSlave(agent.MysqlDaemon, agent.hookExtraEnv()); err != nil {
+		return fmt.Errorf("cannot restart slave: %v", err)
+	}
+	if agent.IsRunningHealthCheck() {
+		originalType = topo.TYPE_SPARE
+	}
+	return topotools.ChangeType(ctx, agent.TopoServer, agent.TabletAlias, originalType, nil)
+}
+
+// VerifyBackup checks the integrity of a backup of the shard, or of
+// its most recent one if name is empty, with the restore concurrency
+// and bandwidth limit. mysqld is not involved.
+// Should be called under RPCWrap.
+func (agent *ActionAgent) VerifyBackup(ctx context.Context, name string) error {
+	tablet := agent.Tablet()
+	bucket := fmt.Sprintf("%v/%v", tablet.Keyspace, tablet.Shard)
+	return mysqlctl.VerifyBackup(bucket, name, *restoreConcurrency, *restoreBandwidthLimit)
+}
+
+// RestoreFromBackup restores the most recent backup of the shard over
+// the data of the tablet, and points its replication at the master of
+// the shard. The tablet is in the restore type, and doesn't serve,
+// while the backup is restored. If the restore fails, it stays in the
+// restore type, as its data may be gone.
+// Should be called under RPCWrapLockAction.
+func (agent *ActionAgent) RestoreFromBackup(ctx context.Context, logger logutil.Logger) error {
+	tablet, err := agent.TopoServer.GetTablet(agent.TabletAlias)
+	if err != nil {
+		return err
+	}
+	if tablet.Type == topo.TYPE_MASTER {
+		return fmt.Errorf("type MASTER cannot restore from backup, if you really need to do this, restart vttablet in replica mode")
+	}
+
+	// refuse the restore while we are still serving, if there is
+	// nothing to restore or if we already have data
+	if err := mysqlctl.CheckRestore(agent.MysqlDaemon, logger, fmt.Sprintf("%v/%v", tablet.Keyspace, tablet.Shard)); err != nil {
+		if err == mysqlctl.ErrNoBackup {
+			err = fmt.Errorf("no backup to restore in %v/%v", tablet.Keyspace, tablet.Shard)
+		}
+		return err
+	}
+
+	// change our type to RESTORE (using UpdateTabletFields so it's
+	// always authorized), and stop serving
+	originalType := tablet.Type
+	if err := agent.TopoServer.UpdateTabletFields(tablet.Alias, func(tablet *topo.Tablet) error {
+		tablet.Type = topo.TYPE_RESTORE
+		return nil
+	}); err != nil {
+		return fmt.Errorf("cannot change type to RESTORE: %v", err)
+	}
+	if err := agent.refreshTablet(ctx, "restore from backup"); err != nil {
+		return fmt.Errorf("failed to update state before restore: %v", err)
+	}
+
+	// create the loggers: tee to console and source
+	l := logutil.NewTeeLogger(logutil.NewConsoleLogger(), logger)
+	if err := agent.restoreData(ctx, l, tablet.Tablet, false); err != nil {
+		if err == mysqlctl.ErrNoBackup {
+			err = fmt.Errorf("no backup to restore in %v/%v", tablet.Keyspace, tablet.Shard)
+		}
+		return err
+	}
+
+	// and change our type back, to spare if healthcheck is enabled
+	if agent.IsRunningHealthCheck() {
+		originalType = topo.TYPE_SPARE
+	}
+	return agent.TopoServer.UpdateTabletFields(tablet.Alias, func(tablet *topo.Tablet) error {
+		tablet.Type = originalType
+		return nil
+	})
+}
+
+// removeOldBackups applies -backup_retention_count to a bucket. The
+// backup that was just taken succeeded, so errors are only logged.
+func removeOldBackups(logger logutil.Logger, bucket string, keep int) {
+	bs, err := backupstorage.GetBackupStorage()
+	if err != nil {
+		logger.Errorf("cannot remove old backups: %v", err)
+		return
+	}
+	removed, err := backupstorage.RemoveOldBackups(bs, bucket, keep)
+	for _, name := range removed {
+		logger.Infof("removed old backup %v/%v", bucket, name)
+	}
+	if err != nil {
+		logger.Errorf("cannot remove old backups: %v", err)
+	}
+}
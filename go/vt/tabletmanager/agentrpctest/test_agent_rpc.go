@@ -20,7 +20,9 @@ import (
 	"github.com/youtube/vitess/go/vt/tabletmanager"
 	"github.com/youtube/vitess/go/vt/tabletmanager/actionnode"
 	"github.com/youtube/vitess/go/vt/tabletmanager/tmclient"
+	tproto "github.com/youtube/vitess/go/vt/tabletserver/proto"
 	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/vt/vterrors"
 	"golang.org/x/net/context"
 )
 
@@ -96,6 +98,9 @@ func expectRPCWrapPanic(t *testing.T, err error) {
 	if err == nil || !strings.Contains(err.Error(), expected) {
 		t.Fatalf("Expected a panic error with '%v' but got: %v", expected, err)
 	}
+	if code := vterrors.RecoverCode(err); code != vterrors.Internal {
+		t.Errorf("Expected a panic error with code %v but got %v", vterrors.Internal, code)
+	}
 }
 
 func expectRPCWrapLockPanic(t *testing.T, err error) {
@@ -147,6 +152,7 @@ var testGetSchemaReply = &myproto.SchemaDefinition{
 			PrimaryKeyColumns: []string{"col1"},
 			Type:              myproto.TableView,
 			DataLength:        12,
+			IndexLength:       4,
 			RowCount:          6,
 		},
 		&myproto.TableDefinition{
@@ -156,6 +162,7 @@ var testGetSchemaReply = &myproto.SchemaDefinition{
 			PrimaryKeyColumns: []string{"col1"},
 			Type:              myproto.TableBaseTable,
 			DataLength:        12,
+			IndexLength:       4,
 			RowCount:          6,
 		},
 	},
@@ -234,6 +241,67 @@ func agentRPCTestGetPermissionsPanic(ctx context.Context, t *testing.T, client t
 	expectRPCWrapPanic(t, err)
 }
 
+var testGetActionHistoryReply = []*actionnode.ActionHistoryRecord{
+	&actionnode.ActionHistoryRecord{
+		Name:      actionnode.TabletActionChangeType,
+		Args:      "replica",
+		From:      "vtctl",
+		StartTime: time.Unix(1136243045, 0).UTC(),
+		EndTime:   time.Unix(1136243046, 0).UTC(),
+	},
+	&actionnode.ActionHistoryRecord{
+		Name:      actionnode.TabletActionScrap,
+		StartTime: time.Unix(1136243040, 0).UTC(),
+		EndTime:   time.Unix(1136243041, 0).UTC(),
+		Error:     "scrap failed",
+	},
+}
+
+func (fra *fakeRPCAgent) GetActionHistory(ctx context.Context) []*actionnode.ActionHistoryRecord {
+	if fra.panics {
+		panic(fmt.Errorf("test-triggered panic"))
+	}
+	return testGetActionHistoryReply
+}
+
+func agentRPCTestGetActionHistory(ctx context.Context, t *testing.T, client tmclient.TabletManagerClient, ti *topo.TabletInfo) {
+	result, err := client.GetActionHistory(ctx, ti)
+	compareError(t, "GetActionHistory", err, result, testGetActionHistoryReply)
+}
+
+func agentRPCTestGetActionHistoryPanic(ctx context.Context, t *testing.T, client tmclient.TabletManagerClient, ti *topo.TabletInfo) {
+	_, err := client.GetActionHistory(ctx, ti)
+	expectRPCWrapPanic(t, err)
+}
+
+var testGetRuntimeStatsReply = &tproto.RuntimeStats{
+	QPS: map[string]float64{
+		"All":         12.5,
+		"PASS_SELECT": 10.0,
+	},
+	ErrorCount:          3,
+	ErrorRate:           0.5,
+	ConnectionsInUse:    4,
+	ConnectionsCapacity: 16,
+}
+
+func (fra *fakeRPCAgent) GetRuntimeStats(ctx context.Context) *tproto.RuntimeStats {
+	if fra.panics {
+		panic(fmt.Errorf("test-triggered panic"))
+	}
+	return testGetRuntimeStatsReply
+}
+
+func agentRPCTestGetRuntimeStats(ctx context.Context, t *testing.T, client tmclient.TabletManagerClient, ti *topo.TabletInfo) {
+	result, err := client.GetRuntimeStats(ctx, ti)
+	compareError(t, "GetRuntimeStats", err, result, testGetRuntimeStatsReply)
+}
+
+func agentRPCTestGetRuntimeStatsPanic(ctx context.Context, t *testing.T, client tmclient.TabletManagerClient, ti *topo.TabletInfo) {
+	_, err := client.GetRuntimeStats(ctx, ti)
+	expectRPCWrapPanic(t, err)
+}
+
 //
 // Various read-write methods
 //
@@ -269,24 +337,26 @@ func agentRPCTestSetReadOnlyPanic(ctx context.Context, t *testing.T, client tmcl
 }
 
 var testChangeTypeValue = topo.TYPE_REPLICA
+var testChangeTypeForce = true
 
-func (fra *fakeRPCAgent) ChangeType(ctx context.Context, tabletType topo.TabletType) error {
+func (fra *fakeRPCAgent) ChangeType(ctx context.Context, tabletType topo.TabletType, force bool) error {
 	if fra.panics {
 		panic(fmt.Errorf("test-triggered panic"))
 	}
 	compare(fra.t, "ChangeType tabletType", tabletType, testChangeTypeValue)
+	compare(fra.t, "ChangeType force", force, testChangeTypeForce)
 	return nil
 }
 
 func agentRPCTestChangeType(ctx context.Context, t *testing.T, client tmclient.TabletManagerClient, ti *topo.TabletInfo) {
-	err := client.ChangeType(ctx, ti, testChangeTypeValue)
+	err := client.ChangeType(ctx, ti, testChangeTypeValue, testChangeTypeForce)
 	if err != nil {
 		t.Errorf("ChangeType failed: %v", err)
 	}
 }
 
 func agentRPCTestChangeTypePanic(ctx context.Context, t *testing.T, client tmclient.TabletManagerClient, ti *topo.TabletInfo) {
-	err := client.ChangeType(ctx, ti, testChangeTypeValue)
+	err := client.ChangeType(ctx, ti, testChangeTypeValue, testChangeTypeForce)
 	expectRPCWrapLockActionPanic(t, err)
 }
 
@@ -311,6 +381,29 @@ func agentRPCTestScrapPanic(ctx context.Context, t *testing.T, client tmclient.T
 	expectRPCWrapLockActionPanic(t, err)
 }
 
+var testSetMaintenanceModeReason = "replacing disks"
+var testSetMaintenanceModeCalled = false
+
+func (fra *fakeRPCAgent) SetMaintenanceMode(ctx context.Context, on bool, reason string) error {
+	if fra.panics {
+		panic(fmt.Errorf("test-triggered panic"))
+	}
+	compare(fra.t, "SetMaintenanceMode on", on, true)
+	compare(fra.t, "SetMaintenanceMode reason", reason, testSetMaintenanceModeReason)
+	testSetMaintenanceModeCalled = true
+	return nil
+}
+
+func agentRPCTestSetMaintenanceMode(ctx context.Context, t *testing.T, client tmclient.TabletManagerClient, ti *topo.TabletInfo) {
+	err := client.SetMaintenanceMode(ctx, ti, true, testSetMaintenanceModeReason)
+	compareError(t, "SetMaintenanceMode", err, true, testSetMaintenanceModeCalled)
+}
+
+func agentRPCTestSetMaintenanceModePanic(ctx context.Context, t *testing.T, client tmclient.TabletManagerClient, ti *topo.TabletInfo) {
+	err := client.SetMaintenanceMode(ctx, ti, true, testSetMaintenanceModeReason)
+	expectRPCWrapLockActionPanic(t, err)
+}
+
 var testSleepDuration = time.Minute
 
 func (fra *fakeRPCAgent) Sleep(ctx context.Context, duration time.Duration) {
@@ -412,6 +505,30 @@ func agentRPCTestRunHealthCheckPanic(ctx context.Context, t *testing.T, client t
 	expectRPCWrapPanic(t, err)
 }
 
+var testSetPoolSizePool = "transaction"
+var testSetPoolSizeSize = 42
+var testSetPoolSizeCalled = false
+
+func (fra *fakeRPCAgent) SetPoolSize(ctx context.Context, pool string, size int) error {
+	if fra.panics {
+		panic(fmt.Errorf("test-triggered panic"))
+	}
+	compare(fra.t, "SetPoolSize pool", pool, testSetPoolSizePool)
+	compare(fra.t, "SetPoolSize size", size, testSetPoolSizeSize)
+	testSetPoolSizeCalled = true
+	return nil
+}
+
+func agentRPCTestSetPoolSize(ctx context.Context, t *testing.T, client tmclient.TabletManagerClient, ti *topo.TabletInfo) {
+	err := client.SetPoolSize(ctx, ti, testSetPoolSizePool, testSetPoolSizeSize)
+	compareError(t, "SetPoolSize", err, true, testSetPoolSizeCalled)
+}
+
+func agentRPCTestSetPoolSizePanic(ctx context.Context, t *testing.T, client tmclient.TabletManagerClient, ti *topo.TabletInfo) {
+	err := client.SetPoolSize(ctx, ti, testSetPoolSizePool, testSetPoolSizeSize)
+	expectRPCWrapPanic(t, err)
+}
+
 // this test is a bit of a hack: we write something on the channel
 // upon registration, and we also return an error, so the streaming query
 // ends right there. Otherwise we have no real way to trigger a real
@@ -628,6 +745,45 @@ func agentRPCTestExecuteFetchPanic(ctx context.Context, t *testing.T, client tmc
 	expectRPCWrapPanic(t, err)
 }
 
+var testReloadUsersResult = []string{"CREATE USER 'vt_app'@'%'", "GRANT SELECT ON *.* TO 'vt_app'@'%'"}
+
+func (fra *fakeRPCAgent) ReloadUsers(ctx context.Context) ([]string, error) {
+	if fra.panics {
+		panic(fmt.Errorf("test-triggered panic"))
+	}
+	return testReloadUsersResult, nil
+}
+
+func agentRPCTestReloadUsers(ctx context.Context, t *testing.T, client tmclient.TabletManagerClient, ti *topo.TabletInfo) {
+	changes, err := client.ReloadUsers(ctx, ti)
+	compareError(t, "ReloadUsers", err, changes, testReloadUsersResult)
+}
+
+func agentRPCTestReloadUsersPanic(ctx context.Context, t *testing.T, client tmclient.TabletManagerClient, ti *topo.TabletInfo) {
+	_, err := client.ReloadUsers(ctx, ti)
+	expectRPCWrapLockActionPanic(t, err)
+}
+
+var testReloadTableACLCalled = false
+
+func (fra *fakeRPCAgent) ReloadTableACL(ctx context.Context) error {
+	if fra.panics {
+		panic(fmt.Errorf("test-triggered panic"))
+	}
+	testReloadTableACLCalled = true
+	return nil
+}
+
+func agentRPCTestReloadTableACL(ctx context.Context, t *testing.T, client tmclient.TabletManagerClient, ti *topo.TabletInfo) {
+	err := client.ReloadTableACL(ctx, ti)
+	compareError(t, "ReloadTableACL", err, true, testReloadTableACLCalled)
+}
+
+func agentRPCTestReloadTableACLPanic(ctx context.Context, t *testing.T, client tmclient.TabletManagerClient, ti *topo.TabletInfo) {
+	err := client.ReloadTableACL(ctx, ti)
+	expectRPCWrapLockActionPanic(t, err)
+}
+
 //
 // Replication related methods
 //
@@ -823,6 +979,68 @@ var testBlpPositionList = &blproto.BlpPositionList{
 	},
 }
 
+var testBlpCheckpointList = &blproto.BlpCheckpointList{
+	Entries: []blproto.BlpCheckpoint{
+		{
+			Uid:                  testBlpPosition.Uid,
+			Position:             testBlpPosition.Position,
+			TimeUpdated:          1407805600,
+			TransactionTimestamp: 1407805592,
+			Flags:                "DontStart",
+		},
+	},
+}
+
+func (fra *fakeRPCAgent) GetBlpCheckpoints(ctx context.Context) (*blproto.BlpCheckpointList, error) {
+	if fra.panics {
+		panic(fmt.Errorf("test-triggered panic"))
+	}
+	return testBlpCheckpointList, nil
+}
+
+func agentRPCTestGetBlpCheckpoints(ctx context.Context, t *testing.T, client tmclient.TabletManagerClient, ti *topo.TabletInfo) {
+	bcl, err := client.GetBlpCheckpoints(ctx, ti)
+	compareError(t, "GetBlpCheckpoints", err, bcl, testBlpCheckpointList)
+}
+
+func agentRPCTestGetBlpCheckpointsPanic(ctx context.Context, t *testing.T, client tmclient.TabletManagerClient, ti *topo.TabletInfo) {
+	_, err := client.GetBlpCheckpoints(ctx, ti)
+	expectRPCWrapPanic(t, err)
+}
+
+var testBlpStatusList = &blproto.BlpStatusList{
+	State: "Running",
+	Entries: []blproto.BlpStatus{
+		{
+			Uid:                 testBlpPosition.Uid,
+			Keyspace:            "source_keyspace",
+			Shard:               "-80",
+			State:               "Running",
+			Position:            testBlpPosition.Position,
+			SecondsBehindMaster: 12,
+			SourceTablet:        "cell1-0000000042",
+			LastError:           "connection refused",
+		},
+	},
+}
+
+func (fra *fakeRPCAgent) GetBlpStatus(ctx context.Context) (*blproto.BlpStatusList, error) {
+	if fra.panics {
+		panic(fmt.Errorf("test-triggered panic"))
+	}
+	return testBlpStatusList, nil
+}
+
+func agentRPCTestGetBlpStatus(ctx context.Context, t *testing.T, client tmclient.TabletManagerClient, ti *topo.TabletInfo) {
+	bsl, err := client.GetBlpStatus(ctx, ti)
+	compareError(t, "GetBlpStatus", err, bsl, testBlpStatusList)
+}
+
+func agentRPCTestGetBlpStatusPanic(ctx context.Context, t *testing.T, client tmclient.TabletManagerClient, ti *topo.TabletInfo) {
+	_, err := client.GetBlpStatus(ctx, ti)
+	expectRPCWrapPanic(t, err)
+}
+
 func (fra *fakeRPCAgent) StopBlp(ctx context.Context) (*blproto.BlpPositionList, error) {
 	if fra.panics {
 		panic(fmt.Errorf("test-triggered panic"))
@@ -1128,20 +1346,24 @@ func agentRPCTestPromoteSlavePanic(ctx context.Context, t *testing.T, client tmc
 //
 
 var testBackupConcurrency = 24
+var testBackupBandwidthLimit int64 = 10 * 1024 * 1024
+var testBackupSkipSpaceCheck = true
 var testBackupCalled = false
 
-func (fra *fakeRPCAgent) Backup(ctx context.Context, concurrency int, logger logutil.Logger) error {
+func (fra *fakeRPCAgent) Backup(ctx context.Context, concurrency int, bandwidthLimit int64, skipSpaceCheck bool, logger logutil.Logger) error {
 	if fra.panics {
 		panic(fmt.Errorf("test-triggered panic"))
 	}
 	compare(fra.t, "Backup args", concurrency, testBackupConcurrency)
+	compare(fra.t, "Backup bandwidthLimit", bandwidthLimit, testBackupBandwidthLimit)
+	compareBool(fra.t, "Backup skipSpaceCheck", skipSpaceCheck)
 	logStuff(logger, 10)
 	testBackupCalled = true
 	return nil
 }
 
 func agentRPCTestBackup(ctx context.Context, t *testing.T, client tmclient.TabletManagerClient, ti *topo.TabletInfo) {
-	logChannel, errFunc, err := client.Backup(ctx, ti, testBackupConcurrency)
+	logChannel, errFunc, err := client.Backup(ctx, ti, testBackupConcurrency, testBackupBandwidthLimit, testBackupSkipSpaceCheck)
 	if err != nil {
 		t.Fatalf("Backup failed: %v", err)
 	}
@@ -1151,7 +1373,7 @@ func agentRPCTestBackup(ctx context.Context, t *testing.T, client tmclient.Table
 }
 
 func agentRPCTestBackupPanic(ctx context.Context, t *testing.T, client tmclient.TabletManagerClient, ti *topo.TabletInfo) {
-	logChannel, errFunc, err := client.Backup(ctx, ti, testBackupConcurrency)
+	logChannel, errFunc, err := client.Backup(ctx, ti, testBackupConcurrency, testBackupBandwidthLimit, testBackupSkipSpaceCheck)
 	if err != nil {
 		t.Fatalf("Backup failed: %v", err)
 	}
@@ -1162,6 +1384,106 @@ func agentRPCTestBackupPanic(ctx context.Context, t *testing.T, client tmclient.
 	expectRPCWrapLockActionPanic(t, err)
 }
 
+var testStreamingCloneSourceReply = &actionnode.StreamingCloneSourceReply{
+	Position:         testReplicationPosition,
+	DbName:           "vt_test_keyspace",
+	SchemaDefinition: testGetSchemaReply,
+	OriginalType:     topo.TYPE_RDONLY,
+}
+
+func (fra *fakeRPCAgent) StreamingCloneSourceStart(ctx context.Context) (*actionnode.StreamingCloneSourceReply, error) {
+	if fra.panics {
+		panic(fmt.Errorf("test-triggered panic"))
+	}
+	return testStreamingCloneSourceReply, nil
+}
+
+func agentRPCTestStreamingCloneSourceStart(ctx context.Context, t *testing.T, client tmclient.TabletManagerClient, ti *topo.TabletInfo) {
+	scsr, err := client.StreamingCloneSourceStart(ctx, ti)
+	compareError(t, "StreamingCloneSourceStart", err, scsr, testStreamingCloneSourceReply)
+}
+
+func agentRPCTestStreamingCloneSourceStartPanic(ctx context.Context, t *testing.T, client tmclient.TabletManagerClient, ti *topo.TabletInfo) {
+	_, err := client.StreamingCloneSourceStart(ctx, ti)
+	expectRPCWrapLockActionPanic(t, err)
+}
+
+var testStreamingCloneSourceEndCalled = false
+
+func (fra *fakeRPCAgent) StreamingCloneSourceEnd(ctx context.Context, originalType topo.TabletType) error {
+	if fra.panics {
+		panic(fmt.Errorf("test-triggered panic"))
+	}
+	compare(fra.t, "StreamingCloneSourceEnd originalType", originalType, topo.TYPE_RDONLY)
+	testStreamingCloneSourceEndCalled = true
+	return nil
+}
+
+func agentRPCTestStreamingCloneSourceEnd(ctx context.Context, t *testing.T, client tmclient.TabletManagerClient, ti *topo.TabletInfo) {
+	err := client.StreamingCloneSourceEnd(ctx, ti, topo.TYPE_RDONLY)
+	compareError(t, "StreamingCloneSourceEnd", err, true, testStreamingCloneSourceEndCalled)
+}
+
+func agentRPCTestStreamingCloneSourceEndPanic(ctx context.Context, t *testing.T, client tmclient.TabletManagerClient, ti *topo.TabletInfo) {
+	err := client.StreamingCloneSourceEnd(ctx, ti, topo.TYPE_RDONLY)
+	expectRPCWrapLockActionPanic(t, err)
+}
+
+var testVerifyBackupName = "cell1-0000000001.2015-09-01.120000"
+var testVerifyBackupCalled = false
+
+func (fra *fakeRPCAgent) VerifyBackup(ctx context.Context, name string) error {
+	if fra.panics {
+		panic(fmt.Errorf("test-triggered panic"))
+	}
+	compare(fra.t, "VerifyBackup name", name, testVerifyBackupName)
+	testVerifyBackupCalled = true
+	return nil
+}
+
+func agentRPCTestVerifyBackup(ctx context.Context, t *testing.T, client tmclient.TabletManagerClient, ti *topo.TabletInfo) {
+	err := client.VerifyBackup(ctx, ti, testVerifyBackupName)
+	compareError(t, "VerifyBackup", err, true, testVerifyBackupCalled)
+}
+
+func agentRPCTestVerifyBackupPanic(ctx context.Context, t *testing.T, client tmclient.TabletManagerClient, ti *topo.TabletInfo) {
+	err := client.VerifyBackup(ctx, ti, testVerifyBackupName)
+	expectRPCWrapPanic(t, err)
+}
+
+var testRestoreFromBackupCalled = false
+
+func (fra *fakeRPCAgent) RestoreFromBackup(ctx context.Context, logger logutil.Logger) error {
+	if fra.panics {
+		panic(fmt.Errorf("test-triggered panic"))
+	}
+	logStuff(logger, 10)
+	testRestoreFromBackupCalled = true
+	return nil
+}
+
+func agentRPCTestRestoreFromBackup(ctx context.Context, t *testing.T, client tmclient.TabletManagerClient, ti *topo.TabletInfo) {
+	logChannel, errFunc, err := client.RestoreFromBackup(ctx, ti)
+	if err != nil {
+		t.Fatalf("RestoreFromBackup failed: %v", err)
+	}
+	compareLoggedStuff(t, "RestoreFromBackup", logChannel, 10)
+	err = errFunc()
+	compareError(t, "RestoreFromBackup", err, true, testRestoreFromBackupCalled)
+}
+
+func agentRPCTestRestoreFromBackupPanic(ctx context.Context, t *testing.T, client tmclient.TabletManagerClient, ti *topo.TabletInfo) {
+	logChannel, errFunc, err := client.RestoreFromBackup(ctx, ti)
+	if err != nil {
+		t.Fatalf("RestoreFromBackup failed: %v", err)
+	}
+	if e, ok := <-logChannel; ok {
+		t.Fatalf("Unexpected RestoreFromBackup logs: %v", e)
+	}
+	err = errFunc()
+	expectRPCWrapLockActionPanic(t, err)
+}
+
 //
 // RPC helpers
 //
@@ -1170,7 +1492,7 @@ func agentRPCTestBackupPanic(ctx context.Context, t *testing.T, client tmclient.
 func (fra *fakeRPCAgent) RPCWrap(ctx context.Context, name string, args, reply interface{}, f func() error) (err error) {
 	defer func() {
 		if x := recover(); x != nil {
-			err = fmt.Errorf("RPCWrap caught panic during %v", name)
+			err = vterrors.Errorf(vterrors.Internal, "RPCWrap caught panic during %v", name)
 		}
 	}()
 	return f()
@@ -1209,20 +1531,26 @@ func Run(t *testing.T, client tmclient.TabletManagerClient, ti *topo.TabletInfo,
 	agentRPCTestPing(ctx, t, client, ti)
 	agentRPCTestGetSchema(ctx, t, client, ti)
 	agentRPCTestGetPermissions(ctx, t, client, ti)
+	agentRPCTestGetActionHistory(ctx, t, client, ti)
+	agentRPCTestGetRuntimeStats(ctx, t, client, ti)
 
 	// Various read-write methods
 	agentRPCTestSetReadOnly(ctx, t, client, ti)
 	agentRPCTestChangeType(ctx, t, client, ti)
 	agentRPCTestScrap(ctx, t, client, ti)
+	agentRPCTestSetMaintenanceMode(ctx, t, client, ti)
 	agentRPCTestSleep(ctx, t, client, ti)
 	agentRPCTestExecuteHook(ctx, t, client, ti)
 	agentRPCTestRefreshState(ctx, t, client, ti)
 	agentRPCTestRunHealthCheck(ctx, t, client, ti)
+	agentRPCTestSetPoolSize(ctx, t, client, ti)
 	agentRPCTestHealthStream(ctx, t, client, ti)
 	agentRPCTestReloadSchema(ctx, t, client, ti)
 	agentRPCTestPreflightSchema(ctx, t, client, ti)
 	agentRPCTestApplySchema(ctx, t, client, ti)
 	agentRPCTestExecuteFetch(ctx, t, client, ti)
+	agentRPCTestReloadUsers(ctx, t, client, ti)
+	agentRPCTestReloadTableACL(ctx, t, client, ti)
 
 	// Replication related methods
 	agentRPCTestSlaveStatus(ctx, t, client, ti)
@@ -1233,6 +1561,8 @@ func Run(t *testing.T, client tmclient.TabletManagerClient, ti *topo.TabletInfo,
 	agentRPCTestTabletExternallyReparented(ctx, t, client, ti)
 	agentRPCTestGetSlaves(ctx, t, client, ti)
 	agentRPCTestWaitBlpPosition(ctx, t, client, ti)
+	agentRPCTestGetBlpCheckpoints(ctx, t, client, ti)
+	agentRPCTestGetBlpStatus(ctx, t, client, ti)
 	agentRPCTestStopBlp(ctx, t, client, ti)
 	agentRPCTestStartBlp(ctx, t, client, ti)
 	agentRPCTestRunBlpUntil(ctx, t, client, ti)
@@ -1252,6 +1582,10 @@ func Run(t *testing.T, client tmclient.TabletManagerClient, ti *topo.TabletInfo,
 
 	// Backup / restore related methods
 	agentRPCTestBackup(ctx, t, client, ti)
+	agentRPCTestStreamingCloneSourceStart(ctx, t, client, ti)
+	agentRPCTestStreamingCloneSourceEnd(ctx, t, client, ti)
+	agentRPCTestVerifyBackup(ctx, t, client, ti)
+	agentRPCTestRestoreFromBackup(ctx, t, client, ti)
 
 	//
 	// Tests panic handling everywhere now
@@ -1262,20 +1596,26 @@ func Run(t *testing.T, client tmclient.TabletManagerClient, ti *topo.TabletInfo,
 	agentRPCTestPingPanic(ctx, t, client, ti)
 	agentRPCTestGetSchemaPanic(ctx, t, client, ti)
 	agentRPCTestGetPermissionsPanic(ctx, t, client, ti)
+	agentRPCTestGetActionHistoryPanic(ctx, t, client, ti)
+	agentRPCTestGetRuntimeStatsPanic(ctx, t, client, ti)
 
 	// Various read-write methods
 	agentRPCTestSetReadOnlyPanic(ctx, t, client, ti)
 	agentRPCTestChangeTypePanic(ctx, t, client, ti)
 	agentRPCTestScrapPanic(ctx, t, client, ti)
+	agentRPCTestSetMaintenanceModePanic(ctx, t, client, ti)
 	agentRPCTestSleepPanic(ctx, t, client, ti)
 	agentRPCTestExecuteHookPanic(ctx, t, client, ti)
 	agentRPCTestRefreshStatePanic(ctx, t, client, ti)
 	agentRPCTestRunHealthCheckPanic(ctx, t, client, ti)
+	agentRPCTestSetPoolSizePanic(ctx, t, client, ti)
 	agentRPCTestHealthStreamPanic(ctx, t, client, ti)
 	agentRPCTestReloadSchemaPanic(ctx, t, client, ti)
 	agentRPCTestPreflightSchemaPanic(ctx, t, client, ti)
 	agentRPCTestApplySchemaPanic(ctx, t, client, ti)
 	agentRPCTestExecuteFetchPanic(ctx, t, client, ti)
+	agentRPCTestReloadUsersPanic(ctx, t, client, ti)
+	agentRPCTestReloadTableACLPanic(ctx, t, client, ti)
 
 	// Replication related methods
 	agentRPCTestSlaveStatusPanic(ctx, t, client, ti)
@@ -1286,6 +1626,8 @@ func Run(t *testing.T, client tmclient.TabletManagerClient, ti *topo.TabletInfo,
 	agentRPCTestTabletExternallyReparentedPanic(ctx, t, client, ti)
 	agentRPCTestGetSlavesPanic(ctx, t, client, ti)
 	agentRPCTestWaitBlpPositionPanic(ctx, t, client, ti)
+	agentRPCTestGetBlpCheckpointsPanic(ctx, t, client, ti)
+	agentRPCTestGetBlpStatusPanic(ctx, t, client, ti)
 	agentRPCTestStopBlpPanic(ctx, t, client, ti)
 	agentRPCTestStartBlpPanic(ctx, t, client, ti)
 	agentRPCTestRunBlpUntilPanic(ctx, t, client, ti)
@@ -1305,4 +1647,8 @@ func Run(t *testing.T, client tmclient.TabletManagerClient, ti *topo.TabletInfo,
 
 	// Backup / restore related methods
 	agentRPCTestBackupPanic(ctx, t, client, ti)
+	agentRPCTestStreamingCloneSourceStartPanic(ctx, t, client, ti)
+	agentRPCTestStreamingCloneSourceEndPanic(ctx, t, client, ti)
+	agentRPCTestVerifyBackupPanic(ctx, t, client, ti)
+	agentRPCTestRestoreFromBackupPanic(ctx, t, client, ti)
 }
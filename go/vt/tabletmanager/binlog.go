@@ -8,14 +8,18 @@ package tabletmanager
 // replication
 
 import (
+	"encoding/json"
+	"flag"
 	"fmt"
 	"math/rand" // not crypto-safe is OK here
+	"net/http"
 	"sort"
 	"strings"
 	"sync"
 	"time"
 
 	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/acl"
 	"github.com/youtube/vitess/go/netutil"
 	"github.com/youtube/vitess/go/sqldb"
 	"github.com/youtube/vitess/go/stats"
@@ -28,6 +32,12 @@ import (
 	"github.com/youtube/vitess/go/vt/topo"
 )
 
+var (
+	binlogPlayerSourceTabletType = flag.String("binlog_player_source_tablet_type", string(topo.TYPE_RDONLY), "type of the tablets of the source shards the binlog players of a master stream from")
+	binlogPlayerRetryDelay       = flag.Duration("binlog_player_retry_delay", 5*time.Second, "how long a binlog player waits before it retries after an error, doubled after each error in a row")
+	binlogPlayerMaxRetryDelay    = flag.Duration("binlog_player_max_retry_delay", 2*time.Minute, "longest a binlog player waits before it retries after an error")
+)
+
 func init() {
 	rand.Seed(time.Now().UnixNano())
 }
@@ -40,13 +50,21 @@ type BinlogPlayerController struct {
 	mysqld   *mysqlctl.Mysqld
 
 	// Information about us (set at construction, immutable).
-	cell           string
-	keyspaceIdType key.KeyspaceIdType
-	keyRange       key.KeyRange
-	dbName         string
+	cell               string
+	keyspaceIdType     key.KeyspaceIdType
+	shardingColumnName string
+	keyRange           key.KeyRange
+	dbName             string
 
 	// Information about the source (set at construction, immutable).
-	sourceShard topo.SourceShard
+	sourceShard      topo.SourceShard
+	sourceTabletType topo.TabletType
+
+	// retryDelay is how long we wait before retrying after an
+	// error, and maxRetryDelay how long at most after several
+	// errors in a row (set at construction, immutable).
+	retryDelay    time.Duration
+	maxRetryDelay time.Duration
 
 	// BinlogPlayerStats has the stats for the players we're going to use
 	// (pointer is set at construction, immutable, values are thread-safe).
@@ -72,17 +90,21 @@ type BinlogPlayerController struct {
 	lastError error
 }
 
-func newBinlogPlayerController(ts topo.Server, dbConfig *sqldb.ConnParams, mysqld *mysqlctl.Mysqld, cell string, keyspaceIdType key.KeyspaceIdType, keyRange key.KeyRange, sourceShard topo.SourceShard, dbName string) *BinlogPlayerController {
+func newBinlogPlayerController(ts topo.Server, dbConfig *sqldb.ConnParams, mysqld *mysqlctl.Mysqld, cell string, keyspaceIdType key.KeyspaceIdType, shardingColumnName string, keyRange key.KeyRange, sourceShard topo.SourceShard, dbName string) *BinlogPlayerController {
 	blc := &BinlogPlayerController{
-		ts:                ts,
-		dbConfig:          dbConfig,
-		mysqld:            mysqld,
-		cell:              cell,
-		keyspaceIdType:    keyspaceIdType,
-		keyRange:          keyRange,
-		dbName:            dbName,
-		sourceShard:       sourceShard,
-		binlogPlayerStats: binlogplayer.NewBinlogPlayerStats(),
+		ts:                 ts,
+		dbConfig:           dbConfig,
+		mysqld:             mysqld,
+		cell:               cell,
+		keyspaceIdType:     keyspaceIdType,
+		shardingColumnName: shardingColumnName,
+		keyRange:           keyRange,
+		dbName:             dbName,
+		sourceShard:        sourceShard,
+		sourceTabletType:   topo.TabletType(*binlogPlayerSourceTabletType),
+		retryDelay:         *binlogPlayerRetryDelay,
+		maxRetryDelay:      *binlogPlayerMaxRetryDelay,
+		binlogPlayerStats:  binlogplayer.NewBinlogPlayerStats(),
 	}
 	return blc
 }
@@ -176,9 +198,14 @@ func (bpc *BinlogPlayerController) Stop() {
 }
 
 // Loop runs the main player loop: try to play, and in case of error,
-// sleep for 5 seconds and try again.
+// wait and try again. The wait doubles with each error in a row, from
+// retryDelay up to maxRetryDelay, and starts over once the player
+// made some progress.
 func (bpc *BinlogPlayerController) Loop() {
+	delay := bpc.retryDelay
+loop:
 	for {
+		lastPosition := bpc.binlogPlayerStats.GetLastPosition()
 		err := bpc.Iteration()
 		if err == nil {
 			// this happens when we get interrupted
@@ -192,14 +219,32 @@ func (bpc *BinlogPlayerController) Loop() {
 		bpc.lastError = err
 		bpc.playerMutex.Unlock()
 
-		// sleep for a bit before retrying to connect
-		time.Sleep(5 * time.Second)
+		if !bpc.binlogPlayerStats.GetLastPosition().Equal(lastPosition) {
+			delay = bpc.retryDelay
+		}
+		log.Infof("%v: retrying in %v", bpc, delay)
+		select {
+		case <-bpc.interrupted:
+			break loop
+		case <-time.After(delay):
+		}
+		delay = nextRetryDelay(delay, bpc.maxRetryDelay)
 	}
 
 	log.Infof("%v: exited main binlog player loop", bpc)
 	close(bpc.done)
 }
 
+// nextRetryDelay returns the delay to wait after the next error, for
+// a player that waited delay after the last one.
+func nextRetryDelay(delay, maxDelay time.Duration) time.Duration {
+	delay *= 2
+	if delay > maxDelay {
+		delay = maxDelay
+	}
+	return delay
+}
+
 // Iteration is a single iteration for the player: get the current status,
 // try to play, and plays until interrupted, or until an error occurs.
 func (bpc *BinlogPlayerController) Iteration() (err error) {
@@ -236,12 +281,12 @@ func (bpc *BinlogPlayerController) Iteration() (err error) {
 	}
 
 	// Find the server list for the source shard in our cell
-	addrs, err := bpc.ts.GetEndPoints(bpc.cell, bpc.sourceShard.Keyspace, bpc.sourceShard.Shard, topo.TYPE_REPLICA)
+	addrs, err := bpc.ts.GetEndPoints(bpc.cell, bpc.sourceShard.Keyspace, bpc.sourceShard.Shard, bpc.sourceTabletType)
 	if err != nil {
-		return fmt.Errorf("can't find any source tablet for %v %v %v: %v", bpc.cell, bpc.sourceShard.String(), topo.TYPE_REPLICA, err)
+		return fmt.Errorf("can't find any source tablet for %v %v %v: %v", bpc.cell, bpc.sourceShard.String(), bpc.sourceTabletType, err)
 	}
 	if len(addrs.Entries) == 0 {
-		return fmt.Errorf("empty source tablet list for %v %v %v", bpc.cell, bpc.sourceShard.String(), topo.TYPE_REPLICA)
+		return fmt.Errorf("empty source tablet list for %v %v %v", bpc.cell, bpc.sourceShard.String(), bpc.sourceTabletType)
 	}
 	newServerIndex := rand.Intn(len(addrs.Entries))
 	port, _ := addrs.Entries[newServerIndex].NamedPortMap["vt"]
@@ -275,7 +320,7 @@ func (bpc *BinlogPlayerController) Iteration() (err error) {
 		return fmt.Errorf("Source shard %v doesn't overlap destination shard %v", bpc.sourceShard.KeyRange, bpc.keyRange)
 	}
 
-	player := binlogplayer.NewBinlogPlayerKeyRange(vtClient, addr, bpc.keyspaceIdType, overlap, startPosition, bpc.stopPosition, bpc.binlogPlayerStats)
+	player := binlogplayer.NewBinlogPlayerKeyRange(vtClient, addr, bpc.keyspaceIdType, bpc.shardingColumnName, overlap, startPosition, bpc.stopPosition, bpc.binlogPlayerStats)
 	return player.ApplyBinlogEvents(bpc.interrupted)
 }
 
@@ -316,8 +361,10 @@ func NewBinlogPlayerMap(ts topo.Server, dbConfig *sqldb.ConnParams, mysqld *mysq
 	}
 }
 
-// RegisterBinlogPlayerMap registers the varz for the players.
+// RegisterBinlogPlayerMap registers the varz for the players, and the
+// /debug/binlog_player page.
 func RegisterBinlogPlayerMap(blm *BinlogPlayerMap) {
+	http.HandleFunc("/debug/binlog_player", blm.serveBlpStatus)
 	stats.Publish("BinlogPlayerMapSize", stats.IntFunc(blm.size))
 	stats.Publish("BinlogPlayerSecondsBehindMaster", stats.IntFunc(func() int64 {
 		sbm := int64(0)
@@ -341,6 +388,15 @@ func RegisterBinlogPlayerMap(blm *BinlogPlayerMap) {
 		blm.mu.Unlock()
 		return result
 	}))
+	stats.Publish("BinlogPlayerBatchSizeMap", stats.CountersFunc(func() map[string]int64 {
+		blm.mu.Lock()
+		result := make(map[string]int64, len(blm.players))
+		for i, bpc := range blm.players {
+			result[fmt.Sprintf("%v", i)] = bpc.binlogPlayerStats.LastBatchSize.Get()
+		}
+		blm.mu.Unlock()
+		return result
+	}))
 	stats.Publish("BinlogPlayerSourceShardNameMap", stats.StringMapFunc(func() map[string]string {
 		blm.mu.Lock()
 		result := make(map[string]string, len(blm.players))
@@ -372,14 +428,14 @@ func (blm *BinlogPlayerMap) size() int64 {
 }
 
 // addPlayer adds a new player to the map. It assumes we have the lock.
-func (blm *BinlogPlayerMap) addPlayer(cell string, keyspaceIdType key.KeyspaceIdType, keyRange key.KeyRange, sourceShard topo.SourceShard, dbName string) {
+func (blm *BinlogPlayerMap) addPlayer(cell string, keyspaceIdType key.KeyspaceIdType, shardingColumnName string, keyRange key.KeyRange, sourceShard topo.SourceShard, dbName string) {
 	bpc, ok := blm.players[sourceShard.Uid]
 	if ok {
 		log.Infof("Already playing logs for %v", sourceShard)
 		return
 	}
 
-	bpc = newBinlogPlayerController(blm.ts, blm.dbConfig, blm.mysqld, cell, keyspaceIdType, keyRange, sourceShard, dbName)
+	bpc = newBinlogPlayerController(blm.ts, blm.dbConfig, blm.mysqld, cell, keyspaceIdType, shardingColumnName, keyRange, sourceShard, dbName)
 	blm.players[sourceShard.Uid] = bpc
 	if blm.state == BpmStateRunning {
 		bpc.Start()
@@ -406,8 +462,14 @@ func (blm *BinlogPlayerMap) StopAllPlayersAndReset() {
 }
 
 // RefreshMap reads the right data from topo.Server and makes sure
-// we're playing the right logs.
+// we're playing the right logs. Only masters play logs, the players
+// of any other tablet are stopped.
 func (blm *BinlogPlayerMap) RefreshMap(tablet *topo.Tablet, keyspaceInfo *topo.KeyspaceInfo, shardInfo *topo.ShardInfo) {
+	if tablet.Type != topo.TYPE_MASTER {
+		log.Infof("Not a master, stopping all binlog players")
+		blm.StopAllPlayersAndReset()
+		return
+	}
 	log.Infof("Refreshing map of binlog players")
 	if shardInfo == nil {
 		log.Warningf("Could not read shardInfo, not changing anything")
@@ -434,7 +496,7 @@ func (blm *BinlogPlayerMap) RefreshMap(tablet *topo.Tablet, keyspaceInfo *topo.K
 
 	// for each source, add it if not there, and delete from toRemove
 	for _, sourceShard := range shardInfo.SourceShards {
-		blm.addPlayer(tablet.Alias.Cell, keyspaceInfo.ShardingColumnType, tablet.KeyRange, sourceShard, tablet.DbName())
+		blm.addPlayer(tablet.Alias.Cell, keyspaceInfo.ShardingColumnType, keyspaceInfo.ShardingColumnName, tablet.KeyRange, sourceShard, tablet.DbName())
 		delete(toRemove, sourceShard.Uid)
 	}
 	hasPlayers := len(shardInfo.SourceShards) > 0
@@ -640,3 +702,44 @@ func (blm *BinlogPlayerMap) Status() *BinlogPlayerMapStatus {
 
 	return result
 }
+
+// BlpStatusList returns the status of all the players, for the RPCs.
+func (blm *BinlogPlayerMap) BlpStatusList() *blproto.BlpStatusList {
+	status := blm.Status()
+	result := &blproto.BlpStatusList{
+		State:   status.State,
+		Entries: make([]blproto.BlpStatus, 0, len(status.Controllers)),
+	}
+	for _, bpcs := range status.Controllers {
+		bs := blproto.BlpStatus{
+			Uid:                 bpcs.Index,
+			Keyspace:            bpcs.SourceShard.Keyspace,
+			Shard:               bpcs.SourceShard.Shard,
+			State:               bpcs.State,
+			Position:            bpcs.LastPosition,
+			StopPosition:        bpcs.StopPosition,
+			SecondsBehindMaster: bpcs.SecondsBehindMaster,
+			LastError:           bpcs.LastError,
+		}
+		if !bpcs.SourceTablet.IsZero() {
+			bs.SourceTablet = bpcs.SourceTablet.String()
+		}
+		result.Entries = append(result.Entries, bs)
+	}
+	return result
+}
+
+// serveBlpStatus displays the status of the players as JSON.
+func (blm *BinlogPlayerMap) serveBlpStatus(w http.ResponseWriter, r *http.Request) {
+	if err := acl.CheckAccessHTTP(r, acl.DEBUGGING); err != nil {
+		acl.SendError(w, err)
+		return
+	}
+	data, err := json.MarshalIndent(blm.BlpStatusList(), "", "  ")
+	if err != nil {
+		http.Error(w, fmt.Sprintf("cannot marshal the binlog player status: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
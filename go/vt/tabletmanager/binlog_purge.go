@@ -0,0 +1,188 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tabletmanager
+
+// This file handles the periodic purge of the binary logs. It is
+// enabled by passing a binlog_purge_interval command line parameter.
+// The binary logs still needed by the slaves of the tablet, or by the
+// binlog players of the shards that use it as a source, are never
+// purged.
+
+import (
+	"flag"
+	"fmt"
+	"time"
+
+	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/timer"
+	"github.com/youtube/vitess/go/vt/binlog/binlogplayer"
+	"github.com/youtube/vitess/go/vt/mysqlctl"
+	myproto "github.com/youtube/vitess/go/vt/mysqlctl/proto"
+	"github.com/youtube/vitess/go/vt/servenv"
+	"github.com/youtube/vitess/go/vt/tabletmanager/tmclient"
+	"github.com/youtube/vitess/go/vt/topo"
+	"golang.org/x/net/context"
+)
+
+var (
+	binlogPurgeInterval = flag.Duration("binlog_purge_interval", 0, "Interval between binary logs purges, 0 to never purge them")
+	binlogMaxRetention  = flag.Duration("binlog_max_retention", 0, "How long to keep the binary logs after they were last written to, 0 for no limit")
+	binlogMinFreeDisk   = flag.Uint64("binlog_min_free_disk", 0, "Free disk space in bytes to try to keep on the binary logs file system, by purging the oldest ones")
+	binlogPurgeTimeout  = flag.Duration("binlog_purge_timeout", 30*time.Second, "Time allowed to get the positions of all the binary logs consumers")
+
+	binlogPurgeUnreachableSlaveTimeout = flag.Duration("binlog_purge_unreachable_slave_timeout", time.Hour, "How long a tablet of the shard that can't be reached blocks the binary logs purges, it is ignored after that")
+)
+
+func (agent *ActionAgent) initBinlogPurge() {
+	if *binlogPurgeInterval == 0 {
+		return
+	}
+	if *binlogMaxRetention == 0 && *binlogMinFreeDisk == 0 {
+		log.Warningf("binlog_purge_interval is set, but neither binlog_max_retention nor binlog_min_free_disk, binary logs won't be purged")
+		return
+	}
+
+	log.Infof("Starting periodic binary logs purge every %v with binlog_max_retention=%v binlog_min_free_disk=%v", *binlogPurgeInterval, *binlogMaxRetention, *binlogMinFreeDisk)
+	t := timer.NewTimer(*binlogPurgeInterval)
+	servenv.OnTermSync(func() {
+		log.Info("Stopping periodic binary logs purge timer")
+		t.Stop()
+	})
+	t.Start(agent.purgeBinaryLogs)
+}
+
+// purgeBinaryLogs runs one purge of the binary logs.
+func (agent *ActionAgent) purgeBinaryLogs() {
+	policy := mysqlctl.BinlogPurgePolicy{
+		MaxAge:      *binlogMaxRetention,
+		MinFreeDisk: *binlogMinFreeDisk,
+	}
+	consumers := func() ([]mysqlctl.BinlogConsumer, error) {
+		ctx, cancel := context.WithTimeout(agent.batchCtx, *binlogPurgeTimeout)
+		defer cancel()
+		return agent.binlogConsumers(ctx)
+	}
+	purged, err := agent.MysqlDaemon.PurgeBinaryLogs(policy, consumers)
+	if err != nil {
+		log.Warningf("Cannot purge binary logs: %v", err)
+		return
+	}
+	if len(purged) > 0 {
+		log.Infof("Purged %v binary logs, from %v to %v", len(purged), purged[0], purged[len(purged)-1])
+	}
+}
+
+// binlogConsumers returns the consumers of the binary logs of the
+// tablet: the other tablets of the shard, that may replicate from it,
+// and the binlog players of the shards that have our shard as
+// a source.
+//
+// A tablet of the shard that can't be reached is an error for
+// binlog_purge_unreachable_slave_timeout, after that it is skipped,
+// and ignored like the slaves that are not in the shard. The binlog
+// players that can't be reached are errors.
+func (agent *ActionAgent) binlogConsumers(ctx context.Context) ([]mysqlctl.BinlogConsumer, error) {
+	tablet := agent.Tablet()
+	tmc := tmclient.NewTabletManagerClient()
+
+	// with a partial map, we can't tell the missing tablets from
+	// the slaves that are not in the shard
+	tabletMap, err := topo.GetTabletMapForShard(ctx, agent.TopoServer, tablet.Keyspace, tablet.Shard)
+	if err != nil {
+		return nil, err
+	}
+	if agent.unreachableSlaves == nil {
+		agent.unreachableSlaves = make(map[topo.TabletAlias]time.Time)
+	}
+	for alias := range agent.unreachableSlaves {
+		if _, ok := tabletMap[alias]; !ok {
+			delete(agent.unreachableSlaves, alias)
+		}
+	}
+	now := time.Now()
+	var result []mysqlctl.BinlogConsumer
+	for alias, ti := range tabletMap {
+		if alias == tablet.Alias {
+			continue
+		}
+		status, err := tmc.SlaveStatus(ctx, ti)
+		if err != nil {
+			if unreachableSlaveBlocks(agent.unreachableSlaves, alias, now, *binlogPurgeUnreachableSlaveTimeout) {
+				return nil, fmt.Errorf("cannot get the replication position of %v: %v", alias, err)
+			}
+			log.Warningf("Cannot get the replication position of %v since %v, ignoring it: %v", alias, agent.unreachableSlaves[alias], err)
+			continue
+		}
+		delete(agent.unreachableSlaves, alias)
+		result = append(result, mysqlctl.BinlogConsumer{
+			Name:     "slave " + alias.String(),
+			ServerID: alias.Uid,
+			Position: status.Position,
+		})
+	}
+
+	keyspaces, err := agent.TopoServer.GetKeyspaces()
+	if err != nil {
+		return nil, err
+	}
+	for _, keyspace := range keyspaces {
+		shards, err := agent.TopoServer.GetShardNames(keyspace)
+		if err != nil {
+			return nil, err
+		}
+		for _, shard := range shards {
+			si, err := topo.GetShard(ctx, agent.TopoServer, keyspace, shard)
+			if err != nil {
+				return nil, err
+			}
+			for _, ss := range si.SourceShards {
+				if ss.Keyspace != tablet.Keyspace || ss.Shard != tablet.Shard {
+					continue
+				}
+				pos, err := agent.blpCheckpointPosition(ctx, tmc, si, ss.Uid)
+				if err != nil {
+					return nil, fmt.Errorf("cannot get the position of the binlog player %v of %v/%v: %v", ss.Uid, keyspace, shard, err)
+				}
+				result = append(result, mysqlctl.BinlogConsumer{
+					Name:     fmt.Sprintf("binlog player %v of %v/%v", ss.Uid, keyspace, shard),
+					Position: pos,
+				})
+			}
+		}
+	}
+	return result, nil
+}
+
+// unreachableSlaveBlocks records in unreachable that alias couldn't
+// be reached at now, and returns true if it's been less than timeout
+// since the first failure.
+func unreachableSlaveBlocks(unreachable map[topo.TabletAlias]time.Time, alias topo.TabletAlias, now time.Time, timeout time.Duration) bool {
+	since, ok := unreachable[alias]
+	if !ok {
+		unreachable[alias] = now
+		since = now
+	}
+	return now.Sub(since) < timeout
+}
+
+// blpCheckpointPosition returns the position of the binlog player
+// uid, as saved in the blp_checkpoint table of the master of si.
+func (agent *ActionAgent) blpCheckpointPosition(ctx context.Context, tmc tmclient.TabletManagerClient, si *topo.ShardInfo, uid uint32) (myproto.ReplicationPosition, error) {
+	if si.MasterAlias.IsZero() {
+		return myproto.ReplicationPosition{}, fmt.Errorf("shard has no master")
+	}
+	ti, err := agent.TopoServer.GetTablet(si.MasterAlias)
+	if err != nil {
+		return myproto.ReplicationPosition{}, err
+	}
+	qr, err := tmc.ExecuteFetchAsDba(ctx, ti, binlogplayer.QueryBlpCheckpoint(uid), 1, false, false, false)
+	if err != nil {
+		return myproto.ReplicationPosition{}, err
+	}
+	if len(qr.Rows) != 1 {
+		return myproto.ReplicationPosition{}, fmt.Errorf("no checkpoint for the binlog player")
+	}
+	return myproto.DecodeReplicationPosition(qr.Rows[0][0].String())
+}
@@ -0,0 +1,38 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tabletmanager
+
+import (
+	"testing"
+	"time"
+
+	"github.com/youtube/vitess/go/vt/topo"
+)
+
+func TestUnreachableSlaveBlocks(t *testing.T) {
+	unreachable := make(map[topo.TabletAlias]time.Time)
+	alias := topo.TabletAlias{Cell: "cell1", Uid: 1}
+	now := time.Unix(1000, 0)
+
+	// an unreachable slave blocks the purges for the timeout
+	if !unreachableSlaveBlocks(unreachable, alias, now, time.Hour) {
+		t.Errorf("a slave unreachable for the first time should block the purge")
+	}
+	if !unreachableSlaveBlocks(unreachable, alias, now.Add(59*time.Minute), time.Hour) {
+		t.Errorf("a slave unreachable for less than the timeout should block the purge")
+	}
+	if unreachableSlaveBlocks(unreachable, alias, now.Add(time.Hour), time.Hour) {
+		t.Errorf("a slave unreachable for the timeout should not block the purge")
+	}
+	if got := unreachable[alias]; got != now {
+		t.Errorf("the first failure should be kept, got %v", got)
+	}
+
+	// once it was reached again, it starts over
+	delete(unreachable, alias)
+	if !unreachableSlaveBlocks(unreachable, alias, now.Add(2*time.Hour), time.Hour) {
+		t.Errorf("a slave unreachable again should block the purge")
+	}
+}
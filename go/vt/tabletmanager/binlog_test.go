@@ -0,0 +1,136 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tabletmanager
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	mproto "github.com/youtube/vitess/go/mysql/proto"
+	"github.com/youtube/vitess/go/sqldb"
+	"github.com/youtube/vitess/go/sqltypes"
+	"github.com/youtube/vitess/go/vt/binlog/binlogplayer"
+	blproto "github.com/youtube/vitess/go/vt/binlog/proto"
+	"github.com/youtube/vitess/go/vt/mysqlctl"
+	myproto "github.com/youtube/vitess/go/vt/mysqlctl/proto"
+	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/vt/zktopo"
+	"golang.org/x/net/context"
+)
+
+// TestBlpCheckpoints checks the RPCs reading blp_checkpoint see what the
+// binlog player committed, e.g. after the tablet restarted in the
+// middle of a transaction it was applying.
+func TestBlpCheckpoints(t *testing.T) {
+	agent := createTestAgent(t)
+	ctx := context.Background()
+	committed := myproto.ReplicationPosition{GTIDSet: myproto.MustParseGTID("MariaDB", "0-1-10").GTIDSet()}
+	inFlight := myproto.ReplicationPosition{GTIDSet: myproto.MustParseGTID("MariaDB", "0-1-11").GTIDSet()}
+
+	encoded := []byte(myproto.EncodeReplicationPosition(committed))
+	agent.MysqlDaemon.(*mysqlctl.FakeMysqlDaemon).FetchSuperQueryMap = map[string]*mproto.QueryResult{
+		binlogplayer.QueryBlpCheckpoints(): &mproto.QueryResult{
+			Rows: [][]sqltypes.Value{
+				{
+					sqltypes.MakeString([]byte("3")),
+					sqltypes.MakeString(encoded),
+					sqltypes.MakeString([]byte("1407805600")),
+					sqltypes.MakeString([]byte("1407805592")),
+					sqltypes.MakeString(nil),
+				},
+			},
+		},
+		binlogplayer.QueryBlpCheckpoint(3): &mproto.QueryResult{
+			Rows: [][]sqltypes.Value{
+				{sqltypes.MakeString(encoded), sqltypes.MakeString(nil)},
+			},
+		},
+	}
+
+	bcl, err := agent.GetBlpCheckpoints(ctx)
+	if err != nil {
+		t.Fatalf("GetBlpCheckpoints failed: %v", err)
+	}
+	if len(bcl.Entries) != 1 || bcl.Entries[0].Uid != 3 || !bcl.Entries[0].Position.Equal(committed) || bcl.Entries[0].TransactionTimestamp != 1407805592 {
+		t.Errorf("GetBlpCheckpoints() = %#v", bcl)
+	}
+
+	if err := agent.WaitBlpPosition(ctx, &blproto.BlpPosition{Uid: 3, Position: committed}, time.Second); err != nil {
+		t.Errorf("WaitBlpPosition for the committed position failed: %v", err)
+	}
+	if err := agent.WaitBlpPosition(ctx, &blproto.BlpPosition{Uid: 3, Position: inFlight}, 0); err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("WaitBlpPosition for a position that was never committed: %v", err)
+	}
+}
+
+// TestBinlogPlayerMapRefresh checks the map follows the SourceShards of
+// the shard of a master, and has no player on other tablets.
+func TestBinlogPlayerMapRefresh(t *testing.T) {
+	// binlog playback is disabled through the flavor when the players go
+	os.Setenv("MYSQL_FLAVOR", "MariaDB")
+	ts := zktopo.NewTestServer(t, []string{cell})
+	blm := NewBinlogPlayerMap(ts, &sqldb.ConnParams{}, &mysqlctl.Mysqld{})
+	// stopped, so the players are added but don't connect
+	blm.Stop()
+
+	tablet := &topo.Tablet{
+		Alias:    tabletAlias,
+		Keyspace: "ks",
+		Shard:    "-80",
+		Type:     topo.TYPE_MASTER,
+	}
+	keyspaceInfo := topo.NewKeyspaceInfo("ks", &topo.Keyspace{}, 0)
+	shard := &topo.Shard{
+		SourceShards: []topo.SourceShard{
+			{Uid: 0, Keyspace: "source", Shard: "-40"},
+			{Uid: 1, Keyspace: "source", Shard: "40-80"},
+		},
+	}
+	checkSources := func(want ...string) {
+		bsl := blm.BlpStatusList()
+		if bsl.State != "Stopped" || len(bsl.Entries) != len(want) {
+			t.Fatalf("unexpected players: %#v", bsl)
+		}
+		for i, bs := range bsl.Entries {
+			if got := bs.Keyspace + "/" + bs.Shard; got != want[i] || bs.Uid != uint32(i) || bs.State != "Stopped" {
+				t.Errorf("player %v: got %v in state %v, want %v", i, got, bs.State, want[i])
+			}
+		}
+	}
+
+	blm.RefreshMap(tablet, keyspaceInfo, topo.NewShardInfo("ks", "-80", shard, 0))
+	checkSources("source/-40", "source/40-80")
+	if blm.dbConfig.DbName != "vt_ks" {
+		t.Errorf("players use database %v, want vt_ks", blm.dbConfig.DbName)
+	}
+
+	// a source going away stops its player
+	shard.SourceShards = shard.SourceShards[:1]
+	blm.RefreshMap(tablet, keyspaceInfo, topo.NewShardInfo("ks", "-80", shard, 0))
+	checkSources("source/-40")
+
+	// a tablet that is no master anymore has no player
+	tablet.Type = topo.TYPE_REPLICA
+	blm.RefreshMap(tablet, keyspaceInfo, topo.NewShardInfo("ks", "-80", shard, 0))
+	checkSources()
+}
+
+func TestNextRetryDelay(t *testing.T) {
+	delay := 5 * time.Second
+	var got []time.Duration
+	for i := 0; i < 6; i++ {
+		delay = nextRetryDelay(delay, time.Minute)
+		got = append(got, delay)
+	}
+	want := []time.Duration{10 * time.Second, 20 * time.Second, 40 * time.Second, time.Minute, time.Minute, time.Minute}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("retry delays: got %v, want %v", got, want)
+			break
+		}
+	}
+}
@@ -20,6 +20,7 @@ import (
 	"github.com/youtube/vitess/go/vt/tabletmanager/actionnode"
 	"github.com/youtube/vitess/go/vt/tabletmanager/gorpcproto"
 	"github.com/youtube/vitess/go/vt/tabletmanager/tmclient"
+	tproto "github.com/youtube/vitess/go/vt/tabletserver/proto"
 	"github.com/youtube/vitess/go/vt/topo"
 	"golang.org/x/net/context"
 )
@@ -82,6 +83,16 @@ func (client *FakeTabletManagerClient) GetPermissions(ctx context.Context, table
 	return &p, nil
 }
 
+// GetActionHistory is part of the tmclient.TabletManagerClient interface
+func (client *FakeTabletManagerClient) GetActionHistory(ctx context.Context, tablet *topo.TabletInfo) ([]*actionnode.ActionHistoryRecord, error) {
+	return nil, nil
+}
+
+// GetRuntimeStats is part of the tmclient.TabletManagerClient interface
+func (client *FakeTabletManagerClient) GetRuntimeStats(ctx context.Context, tablet *topo.TabletInfo) (*tproto.RuntimeStats, error) {
+	return &tproto.RuntimeStats{}, nil
+}
+
 //
 // Various read-write methods
 //
@@ -97,7 +108,7 @@ func (client *FakeTabletManagerClient) SetReadWrite(ctx context.Context, tablet
 }
 
 // ChangeType is part of the tmclient.TabletManagerClient interface
-func (client *FakeTabletManagerClient) ChangeType(ctx context.Context, tablet *topo.TabletInfo, dbType topo.TabletType) error {
+func (client *FakeTabletManagerClient) ChangeType(ctx context.Context, tablet *topo.TabletInfo, dbType topo.TabletType, force bool) error {
 	return nil
 }
 
@@ -106,6 +117,11 @@ func (client *FakeTabletManagerClient) Scrap(ctx context.Context, tablet *topo.T
 	return nil
 }
 
+// SetMaintenanceMode is part of the tmclient.TabletManagerClient interface
+func (client *FakeTabletManagerClient) SetMaintenanceMode(ctx context.Context, tablet *topo.TabletInfo, on bool, reason string) error {
+	return nil
+}
+
 // RefreshState is part of the tmclient.TabletManagerClient interface
 func (client *FakeTabletManagerClient) RefreshState(ctx context.Context, tablet *topo.TabletInfo) error {
 	return nil
@@ -116,6 +132,11 @@ func (client *FakeTabletManagerClient) RunHealthCheck(ctx context.Context, table
 	return nil
 }
 
+// SetPoolSize is part of the tmclient.TabletManagerClient interface
+func (client *FakeTabletManagerClient) SetPoolSize(ctx context.Context, tablet *topo.TabletInfo, pool string, size int) error {
+	return nil
+}
+
 // HealthStream is part of the tmclient.TabletManagerClient interface
 func (client *FakeTabletManagerClient) HealthStream(ctx context.Context, tablet *topo.TabletInfo) (<-chan *actionnode.HealthStreamReply, tmclient.ErrFunc, error) {
 	logstream := make(chan *actionnode.HealthStreamReply, 10)
@@ -153,6 +174,16 @@ func (client *FakeTabletManagerClient) ExecuteFetchAsApp(ctx context.Context, ta
 	return &qr, nil
 }
 
+// ReloadUsers is part of the tmclient.TabletManagerClient interface
+func (client *FakeTabletManagerClient) ReloadUsers(ctx context.Context, tablet *topo.TabletInfo) ([]string, error) {
+	return nil, nil
+}
+
+// ReloadTableACL is part of the tmclient.TabletManagerClient interface
+func (client *FakeTabletManagerClient) ReloadTableACL(ctx context.Context, tablet *topo.TabletInfo) error {
+	return nil
+}
+
 //
 // Replication related methods
 //
@@ -201,6 +232,16 @@ func (client *FakeTabletManagerClient) WaitBlpPosition(ctx context.Context, tabl
 	return nil
 }
 
+// GetBlpCheckpoints is part of the tmclient.TabletManagerClient interface
+func (client *FakeTabletManagerClient) GetBlpCheckpoints(ctx context.Context, tablet *topo.TabletInfo) (*blproto.BlpCheckpointList, error) {
+	return &blproto.BlpCheckpointList{}, nil
+}
+
+// GetBlpStatus is part of the tmclient.TabletManagerClient interface
+func (client *FakeTabletManagerClient) GetBlpStatus(ctx context.Context, tablet *topo.TabletInfo) (*blproto.BlpStatusList, error) {
+	return &blproto.BlpStatusList{}, nil
+}
+
 // StopBlp is part of the tmclient.TabletManagerClient interface
 func (client *FakeTabletManagerClient) StopBlp(ctx context.Context, tablet *topo.TabletInfo) (*blproto.BlpPositionList, error) {
 	// TODO(aaijazi): this works because all tests so far only need to rely on Uid 0.
@@ -295,8 +336,32 @@ func (client *FakeTabletManagerClient) PromoteSlave(ctx context.Context, tablet
 //
 
 // Backup is part of the tmclient.TabletManagerClient interface
-func (client *FakeTabletManagerClient) Backup(ctx context.Context, tablet *topo.TabletInfo, concurrency int) (<-chan *logutil.LoggerEvent, tmclient.ErrFunc, error) {
+func (client *FakeTabletManagerClient) Backup(ctx context.Context, tablet *topo.TabletInfo, concurrency int, bandwidthLimit int64, skipSpaceCheck bool) (<-chan *logutil.LoggerEvent, tmclient.ErrFunc, error) {
+	logstream := make(chan *logutil.LoggerEvent, 10)
+	return logstream, func() error {
+		return nil
+	}, nil
+}
+
+// StreamingCloneSourceStart is part of the tmclient.TabletManagerClient interface
+func (client *FakeTabletManagerClient) StreamingCloneSourceStart(ctx context.Context, tablet *topo.TabletInfo) (*actionnode.StreamingCloneSourceReply, error) {
+	return &actionnode.StreamingCloneSourceReply{}, nil
+}
+
+// StreamingCloneSourceEnd is part of the tmclient.TabletManagerClient interface
+func (client *FakeTabletManagerClient) StreamingCloneSourceEnd(ctx context.Context, tablet *topo.TabletInfo, originalType topo.TabletType) error {
+	return nil
+}
+
+// VerifyBackup is part of the tmclient.TabletManagerClient interface
+func (client *FakeTabletManagerClient) VerifyBackup(ctx context.Context, tablet *topo.TabletInfo, name string) error {
+	return nil
+}
+
+// RestoreFromBackup is part of the tmclient.TabletManagerClient interface
+func (client *FakeTabletManagerClient) RestoreFromBackup(ctx context.Context, tablet *topo.TabletInfo) (<-chan *logutil.LoggerEvent, tmclient.ErrFunc, error) {
 	logstream := make(chan *logutil.LoggerEvent, 10)
+	close(logstream)
 	return logstream, func() error {
 		return nil
 	}, nil
@@ -9,6 +9,7 @@ import (
 
 	blproto "github.com/youtube/vitess/go/vt/binlog/proto"
 	myproto "github.com/youtube/vitess/go/vt/mysqlctl/proto"
+	"github.com/youtube/vitess/go/vt/tabletmanager/actionnode"
 	"github.com/youtube/vitess/go/vt/topo"
 )
 
@@ -52,6 +53,24 @@ type SetMasterArgs struct {
 	WaitTimeout     time.Duration // pass in zero to wait indefinitely
 }
 
+// ChangeTypeArgs has arguments for ChangeType
+type ChangeTypeArgs struct {
+	TabletType topo.TabletType
+	Force      bool
+}
+
+// SetMaintenanceModeArgs has arguments for SetMaintenanceMode
+type SetMaintenanceModeArgs struct {
+	On     bool
+	Reason string
+}
+
+// SetPoolSizeArgs has arguments for SetPoolSize
+type SetPoolSizeArgs struct {
+	Pool string
+	Size int
+}
+
 // GetSchemaArgs has arguments for GetSchema
 type GetSchemaArgs struct {
 	Tables        []string
@@ -70,6 +89,16 @@ type GetSlavesReply struct {
 	Addrs []string
 }
 
+// ReloadUsersReply has the reply for ReloadUsers
+type ReloadUsersReply struct {
+	Changes []string
+}
+
+// GetActionHistoryReply has the reply for GetActionHistory
+type GetActionHistoryReply struct {
+	Records []*actionnode.ActionHistoryRecord
+}
+
 // WaitBlpPositionArgs has arguments for WaitBlpPosition
 type WaitBlpPositionArgs struct {
 	BlpPosition blproto.BlpPosition
@@ -95,6 +124,12 @@ type ExecuteFetchArgs struct {
 // BackupArgs has arguments for Backup
 type BackupArgs struct {
 	Concurrency int
+	// BandwidthLimit is in bytes per second. 0 means use the
+	// tablet's -backup_bandwidth_limit, negative means no limit.
+	BandwidthLimit int64
+	// SkipSpaceCheck starts the backup even if the backup storage
+	// doesn't seem to have enough space for it.
+	SkipSpaceCheck bool
 }
 
 // TabletExternallyReparentedArgs has arguments for TabletExternallyReparented
@@ -5,10 +5,15 @@
 package gorpctmclient
 
 import (
+	"crypto/tls"
 	"fmt"
 	"time"
 
+	log "github.com/golang/glog"
 	mproto "github.com/youtube/vitess/go/mysql/proto"
+	"github.com/youtube/vitess/go/netutil"
+	"github.com/youtube/vitess/go/rpcplus"
+	"github.com/youtube/vitess/go/rpcwrap"
 	"github.com/youtube/vitess/go/rpcwrap/bsonrpc"
 	blproto "github.com/youtube/vitess/go/vt/binlog/proto"
 	"github.com/youtube/vitess/go/vt/hook"
@@ -18,7 +23,9 @@ import (
 	"github.com/youtube/vitess/go/vt/tabletmanager/actionnode"
 	"github.com/youtube/vitess/go/vt/tabletmanager/gorpcproto"
 	"github.com/youtube/vitess/go/vt/tabletmanager/tmclient"
+	tproto "github.com/youtube/vitess/go/vt/tabletserver/proto"
 	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/vt/vterrors"
 	"golang.org/x/net/context"
 )
 
@@ -26,14 +33,49 @@ type timeoutError struct {
 	error
 }
 
+// ErrorCode returns the vterrors code of a timeout.
+func (timeoutError) ErrorCode() int64 {
+	return int64(vterrors.DeadlineExceeded)
+}
+
 func init() {
 	tmclient.RegisterTabletManagerClientFactory("bson", func() tmclient.TabletManagerClient {
 		return &GoRPCTabletManagerClient{}
 	})
+	tmclient.RegisterTabletManagerClientFactory("bsons", func() tmclient.TabletManagerClient {
+		config, err := rpcwrap.DefaultClientTLSConfig()
+		if err != nil {
+			log.Fatalf("cannot use the bsons tablet manager protocol: %v", err)
+		}
+		return NewSecureGoRPCTabletManagerClient(config)
+	})
 }
 
 // GoRPCTabletManagerClient implements tmclient.TabletManagerClient
-type GoRPCTabletManagerClient struct{}
+type GoRPCTabletManagerClient struct {
+	// tlsConfig is set to talk to the tablets over TLS.
+	tlsConfig *tls.Config
+}
+
+// NewSecureGoRPCTabletManagerClient returns a client that talks to
+// the tablets over TLS with config, on their vts port. It is
+// registered as the "bsons" protocol, with the -client_cert,
+// -client_key and -client_ca_cert config.
+func NewSecureGoRPCTabletManagerClient(config *tls.Config) *GoRPCTabletManagerClient {
+	return &GoRPCTabletManagerClient{tlsConfig: config}
+}
+
+// dial connects to the tablet manager of tablet.
+func (client *GoRPCTabletManagerClient) dial(tablet *topo.TabletInfo, connectTimeout time.Duration) (*rpcplus.Client, error) {
+	if client.tlsConfig == nil {
+		return bsonrpc.DialHTTP("tcp", tablet.Addr(), connectTimeout, nil)
+	}
+	port, ok := tablet.Portmap[topo.SecurePortName]
+	if !ok {
+		return nil, fmt.Errorf("tablet %v has no %v port", tablet.Alias, topo.SecurePortName)
+	}
+	return bsonrpc.DialHTTP("tcp", netutil.JoinHostPort(tablet.Hostname, port), connectTimeout, client.tlsConfig)
+}
 
 // rpcCallTablet wil execute the RPC on the remote server.
 func (client *GoRPCTabletManagerClient) rpcCallTablet(ctx context.Context, tablet *topo.TabletInfo, name string, args, reply interface{}) error {
@@ -46,9 +88,9 @@ func (client *GoRPCTabletManagerClient) rpcCallTablet(ctx context.Context, table
 			return timeoutError{fmt.Errorf("timeout connecting to TabletManager.%v on %v", name, tablet.Alias)}
 		}
 	}
-	rpcClient, err := bsonrpc.DialHTTP("tcp", tablet.Addr(), connectTimeout, nil)
+	rpcClient, err := client.dial(tablet, connectTimeout)
 	if err != nil {
-		return fmt.Errorf("RPC error for %v: %v", tablet.Alias, err.Error())
+		return vterrors.Errorf(vterrors.Transient, "RPC error for %v: %v", tablet.Alias, err.Error())
 	}
 	defer rpcClient.Close()
 
@@ -62,7 +104,8 @@ func (client *GoRPCTabletManagerClient) rpcCallTablet(ctx context.Context, table
 		return fmt.Errorf("interrupted waiting for TabletManager.%v to %v", name, tablet.Alias)
 	case <-call.Done:
 		if call.Error != nil {
-			return fmt.Errorf("remote error for %v: %v", tablet.Alias, call.Error.Error())
+			// keep the code the tablet sent
+			return vterrors.WithPrefix(fmt.Sprintf("remote error for %v: ", tablet.Alias), call.Error)
 		}
 		return nil
 	}
@@ -117,6 +160,24 @@ func (client *GoRPCTabletManagerClient) GetPermissions(ctx context.Context, tabl
 	return &p, nil
 }
 
+// GetActionHistory is part of the tmclient.TabletManagerClient interface
+func (client *GoRPCTabletManagerClient) GetActionHistory(ctx context.Context, tablet *topo.TabletInfo) ([]*actionnode.ActionHistoryRecord, error) {
+	var reply gorpcproto.GetActionHistoryReply
+	if err := client.rpcCallTablet(ctx, tablet, actionnode.TabletActionGetActionHistory, &rpc.Unused{}, &reply); err != nil {
+		return nil, err
+	}
+	return reply.Records, nil
+}
+
+// GetRuntimeStats is part of the tmclient.TabletManagerClient interface
+func (client *GoRPCTabletManagerClient) GetRuntimeStats(ctx context.Context, tablet *topo.TabletInfo) (*tproto.RuntimeStats, error) {
+	var rs tproto.RuntimeStats
+	if err := client.rpcCallTablet(ctx, tablet, actionnode.TabletActionGetRuntimeStats, &rpc.Unused{}, &rs); err != nil {
+		return nil, err
+	}
+	return &rs, nil
+}
+
 //
 // Various read-write methods
 //
@@ -132,8 +193,11 @@ func (client *GoRPCTabletManagerClient) SetReadWrite(ctx context.Context, tablet
 }
 
 // ChangeType is part of the tmclient.TabletManagerClient interface
-func (client *GoRPCTabletManagerClient) ChangeType(ctx context.Context, tablet *topo.TabletInfo, dbType topo.TabletType) error {
-	return client.rpcCallTablet(ctx, tablet, actionnode.TabletActionChangeType, &dbType, &rpc.Unused{})
+func (client *GoRPCTabletManagerClient) ChangeType(ctx context.Context, tablet *topo.TabletInfo, dbType topo.TabletType, force bool) error {
+	return client.rpcCallTablet(ctx, tablet, actionnode.TabletActionChangeType, &gorpcproto.ChangeTypeArgs{
+		TabletType: dbType,
+		Force:      force,
+	}, &rpc.Unused{})
 }
 
 // Scrap is part of the tmclient.TabletManagerClient interface
@@ -141,6 +205,14 @@ func (client *GoRPCTabletManagerClient) Scrap(ctx context.Context, tablet *topo.
 	return client.rpcCallTablet(ctx, tablet, actionnode.TabletActionScrap, &rpc.Unused{}, &rpc.Unused{})
 }
 
+// SetMaintenanceMode is part of the tmclient.TabletManagerClient interface
+func (client *GoRPCTabletManagerClient) SetMaintenanceMode(ctx context.Context, tablet *topo.TabletInfo, on bool, reason string) error {
+	return client.rpcCallTablet(ctx, tablet, actionnode.TabletActionSetMaintenanceMode, &gorpcproto.SetMaintenanceModeArgs{
+		On:     on,
+		Reason: reason,
+	}, &rpc.Unused{})
+}
+
 // RefreshState is part of the tmclient.TabletManagerClient interface
 func (client *GoRPCTabletManagerClient) RefreshState(ctx context.Context, tablet *topo.TabletInfo) error {
 	return client.rpcCallTablet(ctx, tablet, actionnode.TabletActionRefreshState, &rpc.Unused{}, &rpc.Unused{})
@@ -151,6 +223,14 @@ func (client *GoRPCTabletManagerClient) RunHealthCheck(ctx context.Context, tabl
 	return client.rpcCallTablet(ctx, tablet, actionnode.TabletActionRunHealthCheck, &targetTabletType, &rpc.Unused{})
 }
 
+// SetPoolSize is part of the tmclient.TabletManagerClient interface
+func (client *GoRPCTabletManagerClient) SetPoolSize(ctx context.Context, tablet *topo.TabletInfo, pool string, size int) error {
+	return client.rpcCallTablet(ctx, tablet, actionnode.TabletActionSetPoolSize, &gorpcproto.SetPoolSizeArgs{
+		Pool: pool,
+		Size: size,
+	}, &rpc.Unused{})
+}
+
 // HealthStream is part of the tmclient.TabletManagerClient interface
 func (client *GoRPCTabletManagerClient) HealthStream(ctx context.Context, tablet *topo.TabletInfo) (<-chan *actionnode.HealthStreamReply, tmclient.ErrFunc, error) {
 	var connectTimeout time.Duration
@@ -161,7 +241,7 @@ func (client *GoRPCTabletManagerClient) HealthStream(ctx context.Context, tablet
 			return nil, nil, timeoutError{fmt.Errorf("timeout connecting to TabletManager.HealthStream on %v", tablet.Alias)}
 		}
 	}
-	rpcClient, err := bsonrpc.DialHTTP("tcp", tablet.Addr(), connectTimeout, nil)
+	rpcClient, err := client.dial(tablet, connectTimeout)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -250,6 +330,20 @@ func (client *GoRPCTabletManagerClient) ExecuteFetchAsApp(ctx context.Context, t
 	return &qr, nil
 }
 
+// ReloadUsers is part of the tmclient.TabletManagerClient interface
+func (client *GoRPCTabletManagerClient) ReloadUsers(ctx context.Context, tablet *topo.TabletInfo) ([]string, error) {
+	var reply gorpcproto.ReloadUsersReply
+	if err := client.rpcCallTablet(ctx, tablet, actionnode.TabletActionReloadUsers, &rpc.Unused{}, &reply); err != nil {
+		return nil, err
+	}
+	return reply.Changes, nil
+}
+
+// ReloadTableACL is part of the tmclient.TabletManagerClient interface
+func (client *GoRPCTabletManagerClient) ReloadTableACL(ctx context.Context, tablet *topo.TabletInfo) error {
+	return client.rpcCallTablet(ctx, tablet, actionnode.TabletActionReloadTableACL, &rpc.Unused{}, &rpc.Unused{})
+}
+
 //
 // Replication related methods
 //
@@ -316,6 +410,24 @@ func (client *GoRPCTabletManagerClient) WaitBlpPosition(ctx context.Context, tab
 	}, &rpc.Unused{})
 }
 
+// GetBlpCheckpoints is part of the tmclient.TabletManagerClient interface
+func (client *GoRPCTabletManagerClient) GetBlpCheckpoints(ctx context.Context, tablet *topo.TabletInfo) (*blproto.BlpCheckpointList, error) {
+	var bcl blproto.BlpCheckpointList
+	if err := client.rpcCallTablet(ctx, tablet, actionnode.TabletActionGetBLPCheckpoints, &rpc.Unused{}, &bcl); err != nil {
+		return nil, err
+	}
+	return &bcl, nil
+}
+
+// GetBlpStatus is part of the tmclient.TabletManagerClient interface
+func (client *GoRPCTabletManagerClient) GetBlpStatus(ctx context.Context, tablet *topo.TabletInfo) (*blproto.BlpStatusList, error) {
+	var bsl blproto.BlpStatusList
+	if err := client.rpcCallTablet(ctx, tablet, actionnode.TabletActionGetBLPStatus, &rpc.Unused{}, &bsl); err != nil {
+		return nil, err
+	}
+	return &bsl, nil
+}
+
 // StopBlp is part of the tmclient.TabletManagerClient interface
 func (client *GoRPCTabletManagerClient) StopBlp(ctx context.Context, tablet *topo.TabletInfo) (*blproto.BlpPositionList, error) {
 	var bpl blproto.BlpPositionList
@@ -458,25 +570,38 @@ func (client *GoRPCTabletManagerClient) PromoteSlave(ctx context.Context, tablet
 //
 
 // Backup is part of the tmclient.TabletManagerClient interface
-func (client *GoRPCTabletManagerClient) Backup(ctx context.Context, tablet *topo.TabletInfo, concurrency int) (<-chan *logutil.LoggerEvent, tmclient.ErrFunc, error) {
+func (client *GoRPCTabletManagerClient) Backup(ctx context.Context, tablet *topo.TabletInfo, concurrency int, bandwidthLimit int64, skipSpaceCheck bool) (<-chan *logutil.LoggerEvent, tmclient.ErrFunc, error) {
+	return client.streamLogs(ctx, tablet, actionnode.TabletActionBackup, &gorpcproto.BackupArgs{
+		Concurrency:    concurrency,
+		BandwidthLimit: bandwidthLimit,
+		SkipSpaceCheck: skipSpaceCheck,
+	})
+}
+
+// RestoreFromBackup is part of the tmclient.TabletManagerClient interface
+func (client *GoRPCTabletManagerClient) RestoreFromBackup(ctx context.Context, tablet *topo.TabletInfo) (<-chan *logutil.LoggerEvent, tmclient.ErrFunc, error) {
+	return client.streamLogs(ctx, tablet, actionnode.TabletActionRestoreFromBackup, &rpc.Unused{})
+}
+
+// streamLogs calls a streaming TabletManager method that sends the
+// log events of the action it runs.
+func (client *GoRPCTabletManagerClient) streamLogs(ctx context.Context, tablet *topo.TabletInfo, name string, args interface{}) (<-chan *logutil.LoggerEvent, tmclient.ErrFunc, error) {
 	var connectTimeout time.Duration
 	deadline, ok := ctx.Deadline()
 	if ok {
 		connectTimeout = deadline.Sub(time.Now())
 		if connectTimeout < 0 {
-			return nil, nil, timeoutError{fmt.Errorf("timeout connecting to TabletManager.Backup on %v", tablet.Alias)}
+			return nil, nil, timeoutError{fmt.Errorf("timeout connecting to TabletManager.%v on %v", name, tablet.Alias)}
 		}
 	}
-	rpcClient, err := bsonrpc.DialHTTP("tcp", tablet.Addr(), connectTimeout, nil)
+	rpcClient, err := client.dial(tablet, connectTimeout)
 	if err != nil {
 		return nil, nil, err
 	}
 
 	logstream := make(chan *logutil.LoggerEvent, 10)
 	rpcstream := make(chan *logutil.LoggerEvent, 10)
-	c := rpcClient.StreamGo("TabletManager.Backup", &gorpcproto.BackupArgs{
-		Concurrency: concurrency,
-	}, rpcstream)
+	c := rpcClient.StreamGo("TabletManager."+name, args, rpcstream)
 	interrupted := false
 	go func() {
 		for {
@@ -500,12 +625,33 @@ func (client *GoRPCTabletManagerClient) Backup(ctx context.Context, tablet *topo
 	return logstream, func() error {
 		// this is only called after streaming is done
 		if interrupted {
-			return fmt.Errorf("TabletManager.Backup interrupted by context")
+			return fmt.Errorf("TabletManager.%v interrupted by context", name)
 		}
 		return c.Error
 	}, nil
 }
 
+// StreamingCloneSourceStart is part of the tmclient.TabletManagerClient interface
+func (client *GoRPCTabletManagerClient) StreamingCloneSourceStart(ctx context.Context, tablet *topo.TabletInfo) (*actionnode.StreamingCloneSourceReply, error) {
+	var scsr actionnode.StreamingCloneSourceReply
+	if err := client.rpcCallTablet(ctx, tablet, actionnode.TabletActionStreamingCloneSourceStart, &rpc.Unused{}, &scsr); err != nil {
+		return nil, err
+	}
+	return &scsr, nil
+}
+
+// StreamingCloneSourceEnd is part of the tmclient.TabletManagerClient interface
+func (client *GoRPCTabletManagerClient) StreamingCloneSourceEnd(ctx context.Context, tablet *topo.TabletInfo, originalType topo.TabletType) error {
+	return client.rpcCallTablet(ctx, tablet, actionnode.TabletActionStreamingCloneSourceEnd, &actionnode.StreamingCloneSourceEndArgs{
+		OriginalType: originalType,
+	}, &rpc.Unused{})
+}
+
+// VerifyBackup is part of the tmclient.TabletManagerClient interface
+func (client *GoRPCTabletManagerClient) VerifyBackup(ctx context.Context, tablet *topo.TabletInfo, name string) error {
+	return client.rpcCallTablet(ctx, tablet, actionnode.TabletActionVerifyBackup, &name, &rpc.Unused{})
+}
+
 //
 // RPC related methods
 //
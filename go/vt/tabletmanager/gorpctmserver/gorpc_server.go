@@ -20,6 +20,7 @@ import (
 	"github.com/youtube/vitess/go/vt/tabletmanager"
 	"github.com/youtube/vitess/go/vt/tabletmanager/actionnode"
 	"github.com/youtube/vitess/go/vt/tabletmanager/gorpcproto"
+	tproto "github.com/youtube/vitess/go/vt/tabletserver/proto"
 	"github.com/youtube/vitess/go/vt/topo"
 	"golang.org/x/net/context"
 )
@@ -43,6 +44,14 @@ func (tm *TabletManager) Ping(ctx context.Context, args, reply *string) error {
 	})
 }
 
+// SetMaintenanceMode wraps RPCAgent.SetMaintenanceMode
+func (tm *TabletManager) SetMaintenanceMode(ctx context.Context, args *gorpcproto.SetMaintenanceModeArgs, reply *rpc.Unused) error {
+	ctx = callinfo.RPCWrapCallInfo(ctx)
+	return tm.agent.RPCWrapLockAction(ctx, actionnode.TabletActionSetMaintenanceMode, args, reply, true, func() error {
+		return tm.agent.SetMaintenanceMode(ctx, args.On, args.Reason)
+	})
+}
+
 // Sleep wraps RPCAgent.Sleep
 func (tm *TabletManager) Sleep(ctx context.Context, args *time.Duration, reply *rpc.Unused) error {
 	ctx = callinfo.RPCWrapCallInfo(ctx)
@@ -85,6 +94,24 @@ func (tm *TabletManager) GetPermissions(ctx context.Context, args *rpc.Unused, r
 	})
 }
 
+// GetActionHistory wraps RPCAgent.GetActionHistory
+func (tm *TabletManager) GetActionHistory(ctx context.Context, args *rpc.Unused, reply *gorpcproto.GetActionHistoryReply) error {
+	ctx = callinfo.RPCWrapCallInfo(ctx)
+	return tm.agent.RPCWrap(ctx, actionnode.TabletActionGetActionHistory, args, reply, func() error {
+		reply.Records = tm.agent.GetActionHistory(ctx)
+		return nil
+	})
+}
+
+// GetRuntimeStats wraps RPCAgent.GetRuntimeStats
+func (tm *TabletManager) GetRuntimeStats(ctx context.Context, args *rpc.Unused, reply *tproto.RuntimeStats) error {
+	ctx = callinfo.RPCWrapCallInfo(ctx)
+	return tm.agent.RPCWrap(ctx, actionnode.TabletActionGetRuntimeStats, args, reply, func() error {
+		*reply = *tm.agent.GetRuntimeStats(ctx)
+		return nil
+	})
+}
+
 //
 // Various read-write methods
 //
@@ -106,10 +133,10 @@ func (tm *TabletManager) SetReadWrite(ctx context.Context, args *rpc.Unused, rep
 }
 
 // ChangeType wraps RPCAgent.ChangeType
-func (tm *TabletManager) ChangeType(ctx context.Context, args *topo.TabletType, reply *rpc.Unused) error {
+func (tm *TabletManager) ChangeType(ctx context.Context, args *gorpcproto.ChangeTypeArgs, reply *rpc.Unused) error {
 	ctx = callinfo.RPCWrapCallInfo(ctx)
 	return tm.agent.RPCWrapLockAction(ctx, actionnode.TabletActionChangeType, args, reply, true, func() error {
-		return tm.agent.ChangeType(ctx, *args)
+		return tm.agent.ChangeType(ctx, args.TabletType, args.Force)
 	})
 }
 
@@ -139,6 +166,14 @@ func (tm *TabletManager) RunHealthCheck(ctx context.Context, args *topo.TabletTy
 	})
 }
 
+// SetPoolSize wraps RPCAgent.SetPoolSize
+func (tm *TabletManager) SetPoolSize(ctx context.Context, args *gorpcproto.SetPoolSizeArgs, reply *rpc.Unused) error {
+	ctx = callinfo.RPCWrapCallInfo(ctx)
+	return tm.agent.RPCWrap(ctx, actionnode.TabletActionSetPoolSize, args, reply, func() error {
+		return tm.agent.SetPoolSize(ctx, args.Pool, args.Size)
+	})
+}
+
 // HealthStream registers an agent health stream
 func (tm *TabletManager) HealthStream(ctx context.Context, args *rpc.Unused, sendReply func(interface{}) error) error {
 	ctx = callinfo.RPCWrapCallInfo(ctx)
@@ -224,6 +259,24 @@ func (tm *TabletManager) ExecuteFetchAsApp(ctx context.Context, args *gorpcproto
 	})
 }
 
+// ReloadUsers wraps RPCAgent.ReloadUsers
+func (tm *TabletManager) ReloadUsers(ctx context.Context, args *rpc.Unused, reply *gorpcproto.ReloadUsersReply) error {
+	ctx = callinfo.RPCWrapCallInfo(ctx)
+	return tm.agent.RPCWrapLockAction(ctx, actionnode.TabletActionReloadUsers, args, reply, true, func() error {
+		var err error
+		reply.Changes, err = tm.agent.ReloadUsers(ctx)
+		return err
+	})
+}
+
+// ReloadTableACL wraps RPCAgent.ReloadTableACL
+func (tm *TabletManager) ReloadTableACL(ctx context.Context, args *rpc.Unused, reply *rpc.Unused) error {
+	ctx = callinfo.RPCWrapCallInfo(ctx)
+	return tm.agent.RPCWrapLockAction(ctx, actionnode.TabletActionReloadTableACL, args, reply, true, func() error {
+		return tm.agent.ReloadTableACL(ctx)
+	})
+}
+
 //
 // Replication related methods
 //
@@ -311,6 +364,30 @@ func (tm *TabletManager) WaitBlpPosition(ctx context.Context, args *gorpcproto.W
 	})
 }
 
+// GetBlpCheckpoints wraps RPCAgent.GetBlpCheckpoints
+func (tm *TabletManager) GetBlpCheckpoints(ctx context.Context, args *rpc.Unused, reply *blproto.BlpCheckpointList) error {
+	ctx = callinfo.RPCWrapCallInfo(ctx)
+	return tm.agent.RPCWrap(ctx, actionnode.TabletActionGetBLPCheckpoints, args, reply, func() error {
+		checkpoints, err := tm.agent.GetBlpCheckpoints(ctx)
+		if err == nil {
+			*reply = *checkpoints
+		}
+		return err
+	})
+}
+
+// GetBlpStatus wraps RPCAgent.GetBlpStatus
+func (tm *TabletManager) GetBlpStatus(ctx context.Context, args *rpc.Unused, reply *blproto.BlpStatusList) error {
+	ctx = callinfo.RPCWrapCallInfo(ctx)
+	return tm.agent.RPCWrap(ctx, actionnode.TabletActionGetBLPStatus, args, reply, func() error {
+		status, err := tm.agent.GetBlpStatus(ctx)
+		if err == nil {
+			*reply = *status
+		}
+		return err
+	})
+}
+
 // StopBlp wraps RPCAgent.StopBlp
 func (tm *TabletManager) StopBlp(ctx context.Context, args *rpc.Unused, reply *blproto.BlpPositionList) error {
 	ctx = callinfo.RPCWrapCallInfo(ctx)
@@ -487,7 +564,58 @@ func (tm *TabletManager) Backup(ctx context.Context, args *gorpcproto.BackupArgs
 			wg.Done()
 		}()
 
-		err := tm.agent.Backup(ctx, args.Concurrency, logger)
+		err := tm.agent.Backup(ctx, args.Concurrency, args.BandwidthLimit, args.SkipSpaceCheck, logger)
+		close(logger)
+		wg.Wait()
+		return err
+	})
+}
+
+// StreamingCloneSourceStart wraps RPCAgent.StreamingCloneSourceStart
+func (tm *TabletManager) StreamingCloneSourceStart(ctx context.Context, args *rpc.Unused, reply *actionnode.StreamingCloneSourceReply) error {
+	ctx = callinfo.RPCWrapCallInfo(ctx)
+	return tm.agent.RPCWrapLockAction(ctx, actionnode.TabletActionStreamingCloneSourceStart, args, reply, true, func() error {
+		scsr, err := tm.agent.StreamingCloneSourceStart(ctx)
+		if err == nil {
+			*reply = *scsr
+		}
+		return err
+	})
+}
+
+// StreamingCloneSourceEnd wraps RPCAgent.StreamingCloneSourceEnd
+func (tm *TabletManager) StreamingCloneSourceEnd(ctx context.Context, args *actionnode.StreamingCloneSourceEndArgs, reply *rpc.Unused) error {
+	ctx = callinfo.RPCWrapCallInfo(ctx)
+	return tm.agent.RPCWrapLockAction(ctx, actionnode.TabletActionStreamingCloneSourceEnd, args, reply, true, func() error {
+		return tm.agent.StreamingCloneSourceEnd(ctx, args.OriginalType)
+	})
+}
+
+// VerifyBackup wraps RPCAgent.VerifyBackup
+func (tm *TabletManager) VerifyBackup(ctx context.Context, args *string, reply *rpc.Unused) error {
+	ctx = callinfo.RPCWrapCallInfo(ctx)
+	return tm.agent.RPCWrap(ctx, actionnode.TabletActionVerifyBackup, args, reply, func() error {
+		return tm.agent.VerifyBackup(ctx, *args)
+	})
+}
+
+// RestoreFromBackup wraps RPCAgent.RestoreFromBackup
+func (tm *TabletManager) RestoreFromBackup(ctx context.Context, args *rpc.Unused, sendReply func(interface{}) error) error {
+	ctx = callinfo.RPCWrapCallInfo(ctx)
+	return tm.agent.RPCWrapLockAction(ctx, actionnode.TabletActionRestoreFromBackup, args, nil, true, func() error {
+		// create a logger, send the result back to the caller
+		logger := logutil.NewChannelLogger(10)
+		wg := sync.WaitGroup{}
+		wg.Add(1)
+		go func() {
+			for e := range logger {
+				// see Backup about not interrupting the loop
+				sendReply(&e)
+			}
+			wg.Done()
+		}()
+
+		err := tm.agent.RestoreFromBackup(ctx, logger)
 		close(logger)
 		wg.Wait()
 		return err
@@ -156,6 +156,14 @@ func (agent *ActionAgent) runHealthCheck(targetTabletType topo.TabletType) {
 	if tablet.Type == topo.TYPE_MASTER {
 		typeForHealthCheck = topo.TYPE_MASTER
 	}
+
+	// try to fix replication before checking it, if it's broken
+	// the health check would just make us spare otherwise.
+	// Only do that if we're in the target type or spare, so we
+	// don't restart replication a worker or a backup stopped.
+	if *repairReplication && topo.IsSlaveType(typeForHealthCheck) && (tablet.Type == targetTabletType || tablet.Type == topo.TYPE_SPARE) {
+		agent.maybeRepairReplication(tablet)
+	}
 	replicationDelay, err := agent.HealthReporter.Report(topo.IsSlaveType(typeForHealthCheck), shouldQueryServiceBeRunning)
 	health := make(map[string]string)
 	if err == nil {
@@ -163,8 +171,16 @@ func (agent *ActionAgent) runHealthCheck(targetTabletType topo.TabletType) {
 			err = fmt.Errorf("reported replication lag: %v higher than unhealthy threshold: %v", replicationDelay.Seconds(), unhealthyThreshold.Seconds())
 		} else if replicationDelay > *degradedThreshold {
 			health[topo.ReplicationLag] = topo.ReplicationLagHigh
+			health[topo.ReplicationLagSeconds] = fmt.Sprintf("%v", int64(replicationDelay.Seconds()))
 		}
 	}
+	agent.addReplicationRepairHealth(health)
+	agent.addRuntimeStatsHealth(health)
+	agent.addReplicaSafetyHealth(health)
+	maintenanceReason, inMaintenance := maintenanceModeReason(tablet.Tablet)
+	if inMaintenance {
+		health[topo.MaintenanceMode] = maintenanceReason
+	}
 
 	// Figure out if we should be running QueryService, see if we are,
 	// and reconcile.
@@ -283,6 +299,16 @@ func (agent *ActionAgent) runHealthCheck(targetTabletType topo.TabletType) {
 		agent.lastHealthMapCount.Set(int64(len(health)))
 	}
 
+	// In maintenance mode, we only update the health, the tablet
+	// stays in whatever type it was put in.
+	if inMaintenance && newTabletType != tablet.Type {
+		log.Infof("Tablet in maintenance mode (%v), not changing its type from %v to %v", maintenanceReason, tablet.Type, newTabletType)
+		newTabletType = tablet.Type
+		if tablet.IsHealthEqual(health) {
+			return
+		}
+	}
+
 	// Change the Type, update the health. Note we pass in a map
 	// that's not nil, meaning if it's empty, we will clear it.
 	if err := topotools.ChangeType(agent.batchCtx, agent.TopoServer, tablet.Alias, newTabletType, health); err != nil {
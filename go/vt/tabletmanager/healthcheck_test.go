@@ -139,7 +139,7 @@ func createTestAgent(t *testing.T) *ActionAgent {
 	}
 
 	mysqlDaemon := &mysqlctl.FakeMysqlDaemon{MysqlPort: 3306}
-	agent := NewTestActionAgent(context.Background(), ts, tabletAlias, port, mysqlDaemon)
+	agent := NewTestActionAgent(context.Background(), ts, tabletAlias, port, 0, mysqlDaemon)
 	agent.BinlogPlayerMap = NewBinlogPlayerMap(ts, nil, nil)
 	agent.HealthReporter = &fakeHealthCheck{}
 
@@ -389,3 +389,164 @@ func TestOldHealthCheck(t *testing.T) {
 		t.Errorf("Healthy returned wrong error: %v", healthy)
 	}
 }
+
+// TestReplicationRepair verifies the health check re-points replication
+// to the shard master, restarts it after benign errors, and leaves it
+// alone otherwise.
+func TestReplicationRepair(t *testing.T) {
+	agent := createTestAgent(t)
+	targetTabletType := topo.TYPE_REPLICA
+	*repairReplication = true
+	defer func() { *repairReplication = false }()
+	ctx := context.Background()
+
+	// create a shard master
+	masterAlias := topo.TabletAlias{Cell: cell, Uid: uid + 1}
+	if err := topo.CreateTablet(ctx, agent.TopoServer, &topo.Tablet{
+		Alias:    masterAlias,
+		Hostname: "master",
+		Portmap: map[string]int{
+			"mysql": 3306,
+		},
+		Keyspace: keyspace,
+		Shard:    shard,
+		Type:     topo.TYPE_MASTER,
+	}); err != nil {
+		t.Fatalf("CreateTablet failed: %v", err)
+	}
+	si, err := agent.TopoServer.GetShard(keyspace, shard)
+	if err != nil {
+		t.Fatalf("GetShard failed: %v", err)
+	}
+	si.MasterAlias = masterAlias
+	if err := topo.UpdateShard(ctx, agent.TopoServer, si); err != nil {
+		t.Fatalf("UpdateShard failed: %v", err)
+	}
+
+	// replication is stopped and points at the old master, we
+	// should re-point it
+	setMasterBefore := replicationRepairs.Counts()["SetMaster"]
+	startSlaveBefore := replicationRepairs.Counts()["StartSlave"]
+	fmd := agent.MysqlDaemon.(*mysqlctl.FakeMysqlDaemon)
+	fmd.CurrentMasterHost = "oldmaster"
+	fmd.CurrentMasterPort = 3306
+	fmd.SetMasterCommandsInput = "master:3306"
+	fmd.SetMasterCommandsResult = []string{"set master cmd"}
+	fmd.ExpectedExecuteSuperQueryList = []string{
+		"STOP SLAVE",
+		"set master cmd",
+		"START SLAVE",
+	}
+	agent.runHealthCheck(targetTabletType)
+	if err := fmd.CheckSuperQueryList(); err != nil {
+		t.Fatalf("re-pointing replication failed: %v", err)
+	}
+	if !fmd.Replicating {
+		t.Errorf("replication should be running")
+	}
+	if got := replicationRepairs.Counts()["SetMaster"] - setMasterBefore; got != 1 {
+		t.Errorf("unexpected SetMaster repairs count: %v", got)
+	}
+	ti, err := agent.TopoServer.GetTablet(tabletAlias)
+	if err != nil {
+		t.Fatalf("GetTablet failed: %v", err)
+	}
+	if ti.Health[topo.ReplicationRepaired] != topo.ReplicationRepairedRecently {
+		t.Errorf("health map should show the repair: %v", ti.Health)
+	}
+
+	// replication was stopped by a network error and a lock wait
+	// timeout, we should restart it
+	fmd.CurrentMasterHost = "master"
+	fmd.Replicating = false
+	fmd.LastIOErrno = 2013
+	fmd.LastSQLErrno = 1205
+	fmd.ExpectedExecuteSuperQueryList = []string{"START SLAVE"}
+	fmd.ExpectedExecuteSuperQueryCurrent = 0
+	agent.runHealthCheck(targetTabletType)
+	if err := fmd.CheckSuperQueryList(); err != nil {
+		t.Fatalf("restarting replication failed: %v", err)
+	}
+	if got := replicationRepairs.Counts()["StartSlave"] - startSlaveBefore; got != 1 {
+		t.Errorf("unexpected StartSlave repairs count: %v", got)
+	}
+
+	// replication was stopped by a duplicate key, we should not
+	// touch it
+	fmd.Replicating = false
+	fmd.LastSQLErrno = 1062
+	fmd.ExpectedExecuteSuperQueryList = nil
+	fmd.ExpectedExecuteSuperQueryCurrent = 0
+	if agent.maybeRepairReplication(ti) {
+		t.Errorf("replication stopped by a duplicate key should not be repaired")
+	}
+
+	// once the repair is old enough, it disappears from the health map
+	agent._lastReplicationRepair = time.Now().Add(-2 * *replicationRepairWindow)
+	fmd.LastIOErrno = 0
+	fmd.LastSQLErrno = 0
+	fmd.Replicating = true
+	agent.runHealthCheck(targetTabletType)
+	ti, err = agent.TopoServer.GetTablet(tabletAlias)
+	if err != nil {
+		t.Fatalf("GetTablet failed: %v", err)
+	}
+	if _, ok := ti.Health[topo.ReplicationRepaired]; ok {
+		t.Errorf("health map should not show an old repair: %v", ti.Health)
+	}
+}
+
+// TestReplicaSafetyDrift verifies the replica settings are applied when
+// the tablet becomes a slave type, and the mismatches are in the
+// health map.
+func TestReplicaSafetyDrift(t *testing.T) {
+	*applyReplicaSafetySettings = true
+	defer func() { *applyReplicaSafetySettings = false }()
+	agent := createTestAgent(t)
+	targetTabletType := topo.TYPE_REPLICA
+	fmd := agent.MysqlDaemon.(*mysqlctl.FakeMysqlDaemon)
+
+	// the agent started as spare
+	if fmd.ApplyReplicaSafetySettingsCount != 1 {
+		t.Errorf("ApplyReplicaSafetySettings called %v times, expected 1", fmd.ApplyReplicaSafetySettingsCount)
+	}
+
+	// coming back from idle, with some settings that can't be fixed
+	fmd.ReplicaSafetyMismatches = []mysqlctl.ReplicaSafetyMismatch{
+		{Name: "relay_log_recovery", Value: "OFF", Expected: "ON"},
+		{Name: "relay_log_info_repository", Value: "FILE", Expected: "TABLE"},
+	}
+	agent.updateReplicaSafetySettings(context.Background(), &topo.Tablet{Type: topo.TYPE_IDLE}, &topo.Tablet{Type: topo.TYPE_SPARE})
+	if fmd.ApplyReplicaSafetySettingsCount != 2 {
+		t.Errorf("ApplyReplicaSafetySettings called %v times, expected 2", fmd.ApplyReplicaSafetySettingsCount)
+	}
+
+	// the health check publishes them
+	agent.runHealthCheck(targetTabletType)
+	ti, err := agent.TopoServer.GetTablet(tabletAlias)
+	if err != nil {
+		t.Fatalf("GetTablet failed: %v", err)
+	}
+	if got, want := ti.Health[topo.ReplicaSafetyDrift], "relay_log_recovery=OFF,relay_log_info_repository=FILE"; got != want {
+		t.Errorf("unexpected replica safety drift in the health map: %v, want %v", got, want)
+	}
+
+	// and they are forgotten when the tablet is not a slave any more
+	agent.updateReplicaSafetySettings(context.Background(), &topo.Tablet{Type: topo.TYPE_REPLICA}, &topo.Tablet{Type: topo.TYPE_BACKUP})
+	health := make(map[string]string)
+	agent.addReplicaSafetyHealth(health)
+	if len(health) != 0 {
+		t.Errorf("unexpected health map for a backup tablet: %v", health)
+	}
+}
+
+// TestReplicaSafetyDisabled verifies the replica settings are left
+// alone without -apply_replica_safety_settings.
+func TestReplicaSafetyDisabled(t *testing.T) {
+	agent := createTestAgent(t)
+	fmd := agent.MysqlDaemon.(*mysqlctl.FakeMysqlDaemon)
+	agent.updateReplicaSafetySettings(context.Background(), &topo.Tablet{Type: topo.TYPE_IDLE}, &topo.Tablet{Type: topo.TYPE_SPARE})
+	if fmd.ApplyReplicaSafetySettingsCount != 0 {
+		t.Errorf("ApplyReplicaSafetySettings called %v times, expected 0", fmd.ApplyReplicaSafetySettingsCount)
+	}
+}
@@ -23,12 +23,13 @@ import (
 )
 
 var (
-	initDbNameOverride = flag.String("init_db_name_override", "", "(init parameter) override the name of the db used by vttablet")
-	initKeyspace       = flag.String("init_keyspace", "", "(init parameter) keyspace to use for this tablet")
-	initShard          = flag.String("init_shard", "", "(init parameter) shard to use for this tablet")
-	initTags           flagutil.StringMapValue
-	initTabletType     = flag.String("init_tablet_type", "", "(init parameter) the tablet type to use for this tablet. Incompatible with target_tablet_type.")
-	initTimeout        = flag.Duration("init_timeout", 1*time.Minute, "(init parameter) timeout to use for the init phase.")
+	initDbNameOverride   = flag.String("init_db_name_override", "", "(init parameter) override the name of the db used by vttablet")
+	initKeyspace         = flag.String("init_keyspace", "", "(init parameter) keyspace to use for this tablet")
+	initPopulateMetadata = flag.Bool("init_populate_metadata", false, "(init parameter) create the keyspace and shard records if they don't exist yet")
+	initShard            = flag.String("init_shard", "", "(init parameter) shard to use for this tablet")
+	initTags             flagutil.StringMapValue
+	initTabletType       = flag.String("init_tablet_type", "", "(init parameter) the tablet type to use for this tablet. Incompatible with target_tablet_type.")
+	initTimeout          = flag.Duration("init_timeout", 1*time.Minute, "(init parameter) timeout to use for the init phase.")
 )
 
 func init() {
@@ -44,7 +45,9 @@ func (agent *ActionAgent) InitTablet(port, securePort int) error {
 		return nil
 	}
 
-	// figure out our default target type
+	// Figure out our default target type. If nothing is specified,
+	// we start as a replica, unless the shard record says we're the
+	// master.
 	var tabletType topo.TabletType
 	if *initTabletType != "" {
 		if *targetTabletType != "" {
@@ -69,7 +72,9 @@ func (agent *ActionAgent) InitTablet(port, securePort int) error {
 		tabletType = topo.TYPE_SPARE
 
 	} else {
-		log.Fatalf("if init tablet is enabled, one of init_tablet_type or target_tablet_type needs to be specified")
+		// no type specified, the shard record will tell us if
+		// we're the master, otherwise we'll be a replica
+		tabletType = topo.TYPE_REPLICA
 	}
 
 	// create a context for this whole operation
@@ -89,21 +94,25 @@ func (agent *ActionAgent) InitTablet(port, securePort int) error {
 
 		log.Infof("Reading shard record %v/%v", *initKeyspace, shard)
 
-		// read the shard, create it if necessary
-		si, err := topotools.GetOrCreateShard(ctx, agent.TopoServer, *initKeyspace, shard)
-		if err != nil {
-			return fmt.Errorf("InitTablet cannot GetOrCreateShard shard: %v", err)
-		}
-		if si.MasterAlias == agent.TabletAlias {
-			// we are the current master for this shard (probably
-			// means the master tablet process was just restarted),
-			// so InitTablet as master.
-			tabletType = topo.TYPE_MASTER
+		// read the shard, create it if necessary and allowed
+		var si *topo.ShardInfo
+		if *initPopulateMetadata {
+			si, err = topotools.GetOrCreateShard(ctx, agent.TopoServer, *initKeyspace, shard)
+			if err != nil {
+				return fmt.Errorf("InitTablet cannot GetOrCreateShard shard: %v", err)
+			}
+		} else {
+			si, err = agent.TopoServer.GetShard(*initKeyspace, shard)
+			if err != nil {
+				return fmt.Errorf("InitTablet cannot read shard %v/%v (use -init_populate_metadata to create it): %v", *initKeyspace, shard, err)
+			}
 		}
 
-		// See if we need to add the tablet's cell to the shard's cell
-		// list.  If we do, it has to be under the shard lock.
-		if !si.HasCell(agent.TabletAlias.Cell) {
+		// If the shard record says we are the master, or if we
+		// need to add the tablet's cell to the shard's cell list,
+		// we have to re-check under the shard lock. That way two
+		// tablets cannot both decide they are the master.
+		if si.MasterAlias == agent.TabletAlias || !si.HasCell(agent.TabletAlias.Cell) {
 			actionNode := actionnode.UpdateShard()
 			lockPath, err := actionNode.LockShard(ctx, agent.TopoServer, *initKeyspace, shard)
 			if err != nil {
@@ -116,6 +125,13 @@ func (agent *ActionAgent) InitTablet(port, securePort int) error {
 				return actionNode.UnlockShard(ctx, agent.TopoServer, *initKeyspace, shard, lockPath, err)
 			}
 
+			if si.MasterAlias == agent.TabletAlias {
+				// we are the current master for this shard (probably
+				// means the master tablet process was just restarted),
+				// so InitTablet as master.
+				tabletType = topo.TYPE_MASTER
+			}
+
 			// see if we really need to update it now
 			if !si.HasCell(agent.TabletAlias.Cell) {
 				si.Cells = append(si.Cells, agent.TabletAlias.Cell)
@@ -159,7 +175,7 @@ func (agent *ActionAgent) InitTablet(port, securePort int) error {
 		tablet.Portmap["vt"] = port
 	}
 	if securePort != 0 {
-		tablet.Portmap["vts"] = securePort
+		tablet.Portmap[topo.SecurePortName] = securePort
 	}
 	if err := tablet.Complete(); err != nil {
 		return fmt.Errorf("InitTablet tablet.Complete failed: %v", err)
@@ -86,10 +86,18 @@ func TestInitTablet(t *testing.T) {
 	}
 
 	// try with a keyspace and shard on the previously idle tablet,
-	// should fail
+	// should fail as the shard doesn't exist
 	*initTabletType = "replica"
 	*initKeyspace = "test_keyspace"
 	*initShard = "-80"
+	if err := agent.InitTablet(port, securePort); err == nil || !strings.Contains(err.Error(), "InitTablet cannot read shard test_keyspace/-80") {
+		t.Fatalf("InitTablet(no shard) didn't fail correctly: %v", err)
+	}
+
+	// with init_populate_metadata, it will create the keyspace and
+	// shard, but then fail on the tablet record
+	*initPopulateMetadata = true
+	defer func() { *initPopulateMetadata = false }()
 	if err := agent.InitTablet(port, securePort); err == nil || !strings.Contains(err.Error(), "InitTablet failed because existing tablet keyspace and shard / differ from the provided ones test_keyspace/-80") {
 		t.Fatalf("InitTablet(type over idle) didn't fail correctly: %v", err)
 	}
@@ -133,7 +141,21 @@ func TestInitTablet(t *testing.T) {
 		t.Errorf("wrong tablet type: %v", ti.Type)
 	}
 
+	// no type at all, should default to replica
+	*targetTabletType = ""
+	if err := agent.InitTablet(port, securePort); err != nil {
+		t.Fatalf("InitTablet(no type) failed: %v", err)
+	}
+	ti, err = ts.GetTablet(tabletAlias)
+	if err != nil {
+		t.Fatalf("GetTablet failed: %v", err)
+	}
+	if ti.Type != topo.TYPE_REPLICA {
+		t.Errorf("wrong tablet type: %v", ti.Type)
+	}
+
 	// update shard's master to our alias, then try to init again
+	*targetTabletType = "replica"
 	si, err = ts.GetShard("test_keyspace", "-80")
 	if err != nil {
 		t.Fatalf("GetShard failed: %v", err)
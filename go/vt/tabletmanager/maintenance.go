@@ -0,0 +1,83 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tabletmanager
+
+// This file handles the maintenance mode. A tablet in maintenance
+// mode keeps replicating, but refuses the actions that would change
+// its type or its place in the replication graph, so automation
+// doesn't put it back into service while it's being worked on. The
+// mode is stored in the tablet record Tags, so it survives restarts.
+
+import (
+	"fmt"
+
+	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/vt/tabletmanager/actionnode"
+	"github.com/youtube/vitess/go/vt/topo"
+	"golang.org/x/net/context"
+)
+
+// maintenanceModeBlockedActions are the actions we refuse to run
+// while in maintenance mode.
+var maintenanceModeBlockedActions = map[string]bool{
+	actionnode.TabletActionChangeType:                  true,
+	actionnode.TabletActionScrap:                       true,
+	actionnode.TabletActionResetReplication:            true,
+	actionnode.TabletActionInitMaster:                  true,
+	actionnode.TabletActionInitSlave:                   true,
+	actionnode.TabletActionDemoteMaster:                true,
+	actionnode.TabletActionPromoteSlaveWhenCaughtUp:    true,
+	actionnode.TabletActionSlaveWasPromoted:            true,
+	actionnode.TabletActionSetMaster:                   true,
+	actionnode.TabletActionSlaveWasRestarted:           true,
+	actionnode.TabletActionStopReplicationAndGetStatus: true,
+	actionnode.TabletActionPromoteSlave:                true,
+	actionnode.TabletActionExternallyReparented:        true,
+	actionnode.TabletActionStreamingCloneSourceStart:   true,
+}
+
+// maintenanceModeReason returns the reason the tablet is in
+// maintenance mode, and false if it isn't.
+func maintenanceModeReason(tablet *topo.Tablet) (string, bool) {
+	reason, ok := tablet.Tags[topo.MaintenanceMode]
+	return reason, ok
+}
+
+// checkMaintenanceMode returns an error if the action should not run
+// because the tablet is in maintenance mode.
+func (agent *ActionAgent) checkMaintenanceMode(name string) error {
+	if !maintenanceModeBlockedActions[name] {
+		return nil
+	}
+	tablet := agent.Tablet()
+	if tablet == nil {
+		return nil
+	}
+	if reason, ok := maintenanceModeReason(tablet.Tablet); ok {
+		return fmt.Errorf("tablet %v is in maintenance mode (%v), refusing to run %v", agent.TabletAlias, reason, name)
+	}
+	return nil
+}
+
+// SetMaintenanceMode puts the tablet in or out of maintenance mode.
+// A reason is required to enter maintenance mode.
+// Should be called under RPCWrapLockAction.
+func (agent *ActionAgent) SetMaintenanceMode(ctx context.Context, on bool, reason string) error {
+	if on && reason == "" {
+		return fmt.Errorf("a reason is required to enter maintenance mode")
+	}
+	log.Infof("Setting maintenance mode to %v (reason: %v)", on, reason)
+	return agent.TopoServer.UpdateTabletFields(agent.TabletAlias, func(tablet *topo.Tablet) error {
+		if on {
+			if tablet.Tags == nil {
+				tablet.Tags = make(map[string]string)
+			}
+			tablet.Tags[topo.MaintenanceMode] = reason
+		} else {
+			delete(tablet.Tags, topo.MaintenanceMode)
+		}
+		return nil
+	})
+}
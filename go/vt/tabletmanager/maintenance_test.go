@@ -0,0 +1,72 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tabletmanager
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/youtube/vitess/go/vt/tabletmanager/actionnode"
+	"github.com/youtube/vitess/go/vt/topo"
+	"golang.org/x/net/context"
+)
+
+func TestMaintenanceMode(t *testing.T) {
+	agent := createTestAgent(t)
+	ctx := context.Background()
+	setMaintenanceMode := func(on bool, reason string) error {
+		return agent.RPCWrapLockAction(ctx, actionnode.TabletActionSetMaintenanceMode, reason, nil, false, func() error {
+			return agent.SetMaintenanceMode(ctx, on, reason)
+		})
+	}
+	changeType := func() error {
+		return agent.RPCWrapLockAction(ctx, actionnode.TabletActionChangeType, topo.TYPE_RDONLY, nil, false, func() error {
+			return agent.ChangeType(ctx, topo.TYPE_RDONLY, false)
+		})
+	}
+
+	// a reason is required
+	if err := setMaintenanceMode(true, ""); err == nil || !strings.Contains(err.Error(), "a reason is required") {
+		t.Fatalf("SetMaintenanceMode without a reason didn't fail correctly: %v", err)
+	}
+
+	// enter maintenance mode, it's saved in the tags
+	if err := setMaintenanceMode(true, "replacing disks"); err != nil {
+		t.Fatalf("SetMaintenanceMode failed: %v", err)
+	}
+	ti, err := agent.TopoServer.GetTablet(tabletAlias)
+	if err != nil {
+		t.Fatalf("GetTablet failed: %v", err)
+	}
+	if ti.Tags[topo.MaintenanceMode] != "replacing disks" {
+		t.Errorf("maintenance mode not saved in tags: %v", ti.Tags)
+	}
+
+	// type changes are refused
+	if err := changeType(); err == nil || !strings.Contains(err.Error(), "is in maintenance mode (replacing disks), refusing to run ChangeType") {
+		t.Errorf("ChangeType in maintenance mode didn't fail correctly: %v", err)
+	}
+
+	// the health check doesn't change the type, but reports it
+	agent.runHealthCheck(topo.TYPE_REPLICA)
+	ti, err = agent.TopoServer.GetTablet(tabletAlias)
+	if err != nil {
+		t.Fatalf("GetTablet failed: %v", err)
+	}
+	if ti.Type != topo.TYPE_SPARE {
+		t.Errorf("health check changed the type in maintenance mode: %v", ti.Type)
+	}
+	if ti.Health[topo.MaintenanceMode] != "replacing disks" {
+		t.Errorf("health map doesn't report maintenance mode: %v", ti.Health)
+	}
+
+	// leave maintenance mode, type changes work again
+	if err := setMaintenanceMode(false, ""); err != nil {
+		t.Fatalf("SetMaintenanceMode(false) failed: %v", err)
+	}
+	if err := changeType(); err != nil {
+		t.Errorf("ChangeType after maintenance mode failed: %v", err)
+	}
+}
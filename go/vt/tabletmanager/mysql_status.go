@@ -0,0 +1,41 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tabletmanager
+
+// This file handles the export of the mysqld status variables in
+// /debug/vars, as MysqlStatus. It is enabled by passing a
+// mysql_status_interval command line parameter.
+
+import (
+	"flag"
+	"strings"
+
+	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/vt/mysqlctl"
+	"github.com/youtube/vitess/go/vt/servenv"
+)
+
+var (
+	mysqlStatusInterval  = flag.Duration("mysql_status_interval", 0, "Interval between reads of the mysqld status variables exported as MysqlStatus, 0 to not export them")
+	mysqlStatusVariables = flag.String("mysql_status_variables", "Threads_running,Threads_connected,Uptime,Innodb_history_list_length", "Comma separated list of the mysqld status variables exported as MysqlStatus, from SHOW GLOBAL STATUS or SHOW ENGINE INNODB STATUS")
+)
+
+func (agent *ActionAgent) initMysqlStatusPoller() {
+	if *mysqlStatusInterval == 0 {
+		return
+	}
+
+	variables := strings.Split(*mysqlStatusVariables, ",")
+	for i, v := range variables {
+		variables[i] = strings.TrimSpace(v)
+	}
+	log.Infof("Starting mysqld status export every %v for %v", *mysqlStatusInterval, variables)
+	sp := mysqlctl.NewStatusPoller("MysqlStatus", agent.MysqlDaemon, *mysqlStatusInterval, variables)
+	servenv.OnTermSync(func() {
+		log.Info("Stopping mysqld status export")
+		sp.Stop()
+	})
+	sp.Start()
+}
@@ -0,0 +1,65 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tabletmanager
+
+// This file handles the crash-safe replication settings. With
+// -apply_replica_safety_settings, when the tablet becomes a slave
+// type, the recommended settings are applied to mysqld, and the ones
+// that can't be applied are advertised in the health map, so
+// misconfigured replicas can be found. They change the durability and
+// the read_only state of mysqld, so they are off by default.
+
+import (
+	"flag"
+	"strings"
+
+	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/vt/topo"
+	"golang.org/x/net/context"
+)
+
+var (
+	applyReplicaSafetySettings = flag.Bool("apply_replica_safety_settings", false, "if set, the crash-safe replication settings are applied to mysqld when the tablet becomes a slave type, and the ones that don't match are advertised in the health map")
+)
+
+// updateReplicaSafetySettings applies the replica settings if the
+// tablet just became a slave type, and forgets the mismatches if it
+// isn't one any more.
+func (agent *ActionAgent) updateReplicaSafetySettings(ctx context.Context, oldTablet, newTablet *topo.Tablet) {
+	if !*applyReplicaSafetySettings || newTablet.Type == oldTablet.Type {
+		return
+	}
+	if !topo.IsSlaveType(newTablet.Type) {
+		agent.mutex.Lock()
+		agent._replicaSafetyMismatches = nil
+		agent.mutex.Unlock()
+		return
+	}
+
+	mismatches, err := agent.MysqlDaemon.ApplyReplicaSafetySettings(ctx)
+	if err != nil {
+		log.Warningf("Cannot apply the replica safety settings: %v", err)
+		return
+	}
+	summary := make([]string, len(mismatches))
+	for i, m := range mismatches {
+		log.Warningf("Replica safety setting mismatch: %v", m)
+		summary[i] = m.Name + "=" + m.Value
+	}
+	agent.mutex.Lock()
+	agent._replicaSafetyMismatches = summary
+	agent.mutex.Unlock()
+}
+
+// addReplicaSafetyHealth adds the replica settings that don't match
+// to the health map.
+func (agent *ActionAgent) addReplicaSafetyHealth(health map[string]string) {
+	agent.mutex.Lock()
+	mismatches := agent._replicaSafetyMismatches
+	agent.mutex.Unlock()
+	if len(mismatches) > 0 {
+		health[topo.ReplicaSafetyDrift] = strings.Join(mismatches, ",")
+	}
+}
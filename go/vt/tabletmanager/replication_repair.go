@@ -0,0 +1,141 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tabletmanager
+
+// This file handles the replication repair loop. It is enabled by
+// passing -repair_replication (usually along with
+// -enable_replication_reporter so broken replication makes the tablet
+// unhealthy). Each health check of a slave tablet will then look at
+// the replication status, and try to fix it if it's in a known state.
+
+import (
+	"flag"
+	"time"
+
+	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/stats"
+	"github.com/youtube/vitess/go/vt/mysqlctl"
+	myproto "github.com/youtube/vitess/go/vt/mysqlctl/proto"
+	"github.com/youtube/vitess/go/vt/topo"
+)
+
+var (
+	repairReplication       = flag.Bool("repair_replication", false, "if set, the health check will try to restart replication stopped by a benign error, or re-point it to the current shard master")
+	replicationRepairWindow = flag.Duration("replication_repair_window", 15*time.Minute, "how long after a replication repair the tablet advertises it in its health map")
+
+	replicationRepairs      = stats.NewCounters("ReplicationRepairs")
+	replicationRepairErrors = stats.NewCounters("ReplicationRepairErrors")
+)
+
+// benignReplicationErrors are the Last_IO_Errno / Last_SQL_Errno values
+// for which just restarting replication is safe. They are all
+// transient: network issues between master and slave, or lock
+// contention on the slave.
+var benignReplicationErrors = map[int]bool{
+	1040: true, // ER_CON_COUNT_ERROR (too many connections on master)
+	1158: true, // ER_NET_READ_ERROR
+	1159: true, // ER_NET_READ_INTERRUPTED
+	1160: true, // ER_NET_ERROR_ON_WRITE
+	1161: true, // ER_NET_WRITE_INTERRUPTED
+	1205: true, // ER_LOCK_WAIT_TIMEOUT
+	1213: true, // ER_LOCK_DEADLOCK
+	2003: true, // CR_CONN_HOST_ERROR
+	2013: true, // CR_SERVER_LOST
+}
+
+// isBenignReplicationError returns true if the slave threads that are
+// stopped were all stopped by a benign error.
+func isBenignReplicationError(status *myproto.ReplicationStatus) bool {
+	if !status.SlaveIORunning && !benignReplicationErrors[status.LastIOErrno] {
+		return false
+	}
+	if !status.SlaveSQLRunning && !benignReplicationErrors[status.LastSQLErrno] {
+		return false
+	}
+	return true
+}
+
+// maybeRepairReplication looks at the replication state of a slave
+// tablet, and tries to repair it if it is broken in a way we know how
+// to fix. It returns true if a repair was attempted.
+// Should be called under actionMutex.
+func (agent *ActionAgent) maybeRepairReplication(tablet *topo.TabletInfo) bool {
+	status, err := agent.MysqlDaemon.SlaveStatus()
+	if err != nil {
+		// not a slave, or mysqld is down, nothing we can do
+		return false
+	}
+	if status.SlaveRunning() {
+		return false
+	}
+
+	// If the shard master is not the one we replicate from, the
+	// master was changed without us (we were down during a
+	// reparent for instance), re-point replication.
+	si, err := agent.TopoServer.GetShard(tablet.Keyspace, tablet.Shard)
+	if err != nil {
+		log.Warningf("replication repair cannot read shard %v/%v: %v", tablet.Keyspace, tablet.Shard, err)
+		return false
+	}
+	if si.MasterAlias.IsZero() || si.MasterAlias == tablet.Alias {
+		return false
+	}
+	master, err := agent.TopoServer.GetTablet(si.MasterAlias)
+	if err != nil {
+		log.Warningf("replication repair cannot read shard master %v: %v", si.MasterAlias, err)
+		return false
+	}
+	masterPort, ok := master.Portmap["mysql"]
+	if !ok {
+		return false
+	}
+	if status.MasterHost != master.Hostname || status.MasterPort != masterPort {
+		log.Infof("Replication points to %v instead of shard master %v (%v:%v), re-pointing it", status.MasterAddr(), si.MasterAlias, master.Hostname, masterPort)
+		cmds := []string{mysqlctl.SqlStopSlave}
+		smc, err := agent.MysqlDaemon.SetMasterCommands(master.Keyspace, master.Shard, master.Hostname, masterPort)
+		if err == nil {
+			cmds = append(cmds, smc...)
+			cmds = append(cmds, mysqlctl.SqlStartSlave)
+			err = agent.MysqlDaemon.ExecuteSuperQueryList(cmds)
+		}
+		agent.recordReplicationRepair("SetMaster", err)
+		return true
+	}
+
+	// Same master, restart replication if it was stopped by an
+	// error we know is safe to ignore.
+	if !isBenignReplicationError(&status) {
+		return false
+	}
+	log.Infof("Replication stopped with benign errors (IO: %v, SQL: %v), restarting it", status.LastIOErrno, status.LastSQLErrno)
+	err = agent.MysqlDaemon.ExecuteSuperQueryList([]string{mysqlctl.SqlStartSlave})
+	agent.recordReplicationRepair("StartSlave", err)
+	return true
+}
+
+// recordReplicationRepair counts a repair attempt and remembers when
+// it happened.
+// Should be called under actionMutex.
+func (agent *ActionAgent) recordReplicationRepair(kind string, err error) {
+	replicationRepairs.Add(kind, 1)
+	if err != nil {
+		replicationRepairErrors.Add(kind, 1)
+		log.Warningf("replication repair %v failed: %v", kind, err)
+	}
+	agent._lastReplicationRepair = time.Now()
+}
+
+// addReplicationRepairHealth sets the replication repaired key in the
+// health map if we repaired replication recently, so reparents can
+// avoid this tablet.
+// Should be called under actionMutex.
+func (agent *ActionAgent) addReplicationRepairHealth(health map[string]string) {
+	if agent._lastReplicationRepair.IsZero() {
+		return
+	}
+	if time.Now().Sub(agent._lastReplicationRepair) < *replicationRepairWindow {
+		health[topo.ReplicationRepaired] = topo.ReplicationRepairedRecently
+	}
+}
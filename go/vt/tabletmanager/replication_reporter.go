@@ -0,0 +1,140 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tabletmanager
+
+// This file contains the replication reporter, a health.Reporter that
+// polls the replication lag in the background, so the health check
+// always has a recent value without waiting on mysqld. With
+// -heartbeat_enable, the lag is computed from a heartbeat table the
+// master updates, instead of Seconds_Behind_Master.
+
+import (
+	"flag"
+	"fmt"
+	"html/template"
+	"sync"
+	"time"
+
+	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/stats"
+	"github.com/youtube/vitess/go/timer"
+	"github.com/youtube/vitess/go/vt/health"
+	"github.com/youtube/vitess/go/vt/mysqlctl"
+	"github.com/youtube/vitess/go/vt/servenv"
+)
+
+var (
+	replicationReporterInterval = flag.Duration("replication_reporter_interval", 5*time.Second, "how often the replication reporter polls the replication lag (and writes the heartbeat on masters)")
+	heartbeatEnable             = flag.Bool("heartbeat_enable", false, "if set, masters write to the _vt.heartbeat table, and slaves compute their replication lag from it")
+
+	replicationLagSeconds = stats.NewInt("ReplicationLagSeconds")
+)
+
+// replicationReporter implements health.Reporter
+type replicationReporter struct {
+	mysqld mysqlctl.MysqlDaemon
+
+	// mu protects all the following fields
+	mu sync.Mutex
+	// isMaster is set from the last Report call, and decides if
+	// we write or read the heartbeat
+	isMaster bool
+	// heartbeatTableCreated is set once we created the heartbeat table
+	heartbeatTableCreated bool
+	// lastPoll is the last time we got the lag
+	lastPoll time.Time
+	lag      time.Duration
+	err      error
+}
+
+// NewReplicationReporter returns a health.Reporter that reports the
+// replication lag of mysqld, polled every -replication_reporter_interval.
+func NewReplicationReporter(mysqld mysqlctl.MysqlDaemon) health.Reporter {
+	rr := &replicationReporter{mysqld: mysqld}
+	t := timer.NewTimer(*replicationReporterInterval)
+	servenv.OnTerm(t.Stop)
+	t.Start(rr.poll)
+	return rr
+}
+
+// poll updates the lag, or writes the heartbeat if we're a master.
+func (rr *replicationReporter) poll() {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+
+	if rr.isMaster {
+		if *heartbeatEnable {
+			rr.writeHeartbeat()
+		}
+		return
+	}
+
+	rr.lastPoll = time.Now()
+	if *heartbeatEnable {
+		rr.lag, rr.err = mysqlctl.ReadHeartbeat(rr.mysqld, rr.lastPoll)
+	} else {
+		rr.lag, rr.err = rr.slaveStatusLag()
+	}
+	if rr.err == nil {
+		replicationLagSeconds.Set(int64(rr.lag.Seconds()))
+	}
+}
+
+// slaveStatusLag returns the lag reported by SHOW SLAVE STATUS.
+// Should be called with mu held.
+func (rr *replicationReporter) slaveStatusLag() (time.Duration, error) {
+	status, err := rr.mysqld.SlaveStatus()
+	if err != nil {
+		return 0, err
+	}
+	if !status.SlaveRunning() {
+		return 0, fmt.Errorf("Replication is not running")
+	}
+	return time.Duration(status.SecondsBehindMaster) * time.Second, nil
+}
+
+// writeHeartbeat updates the heartbeat row on the master.
+// Should be called with mu held.
+func (rr *replicationReporter) writeHeartbeat() {
+	var cmds []string
+	if !rr.heartbeatTableCreated {
+		cmds = mysqlctl.CreateHeartbeatTable()
+	}
+	cmds = append(cmds, mysqlctl.UpdateHeartbeat(time.Now()))
+	if err := rr.mysqld.ExecuteSuperQueryList(cmds); err != nil {
+		log.Warningf("cannot write heartbeat: %v", err)
+		return
+	}
+	rr.heartbeatTableCreated = true
+}
+
+// Report is part of the health.Reporter interface
+func (rr *replicationReporter) Report(isSlaveType, shouldQueryServiceBeRunning bool) (time.Duration, error) {
+	rr.mu.Lock()
+	rr.isMaster = !isSlaveType
+	stale := time.Now().Sub(rr.lastPoll) > 3**replicationReporterInterval
+	rr.mu.Unlock()
+	if !isSlaveType {
+		return 0, nil
+	}
+
+	// if we just became a slave, or the poller is stuck, get a
+	// fresh value right now
+	if stale {
+		rr.poll()
+	}
+
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	return rr.lag, rr.err
+}
+
+// HTMLName is part of the health.Reporter interface
+func (rr *replicationReporter) HTMLName() template.HTML {
+	if *heartbeatEnable {
+		return template.HTML("ReplicationReporter(heartbeat)")
+	}
+	return template.HTML("ReplicationReporter")
+}
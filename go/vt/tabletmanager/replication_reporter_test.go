@@ -0,0 +1,78 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tabletmanager
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	mproto "github.com/youtube/vitess/go/mysql/proto"
+	"github.com/youtube/vitess/go/sqltypes"
+	"github.com/youtube/vitess/go/vt/mysqlctl"
+)
+
+func TestReplicationReporterSlaveStatus(t *testing.T) {
+	mysqld := mysqlctl.NewFakeMysqlDaemon()
+	rr := &replicationReporter{mysqld: mysqld}
+
+	// replication not running
+	if _, err := rr.Report(true, true); err == nil {
+		t.Errorf("Report should have failed with replication stopped")
+	}
+
+	// replication running, we poll again as soon as the value is stale
+	mysqld.Replicating = true
+	mysqld.SecondsBehindMaster = 12
+	rr.lastPoll = time.Time{}
+	lag, err := rr.Report(true, true)
+	if err != nil || lag != 12*time.Second {
+		t.Errorf("unexpected Report result: %v %v", lag, err)
+	}
+	if got := replicationLagSeconds.Get(); got != 12 {
+		t.Errorf("unexpected ReplicationLagSeconds: %v", got)
+	}
+
+	// a fresh value is returned from the cache
+	mysqld.SecondsBehindMaster = 20
+	if lag, err := rr.Report(true, true); err != nil || lag != 12*time.Second {
+		t.Errorf("unexpected cached Report result: %v %v", lag, err)
+	}
+
+	// masters don't report any lag
+	if lag, err := rr.Report(false, true); err != nil || lag != 0 {
+		t.Errorf("unexpected master Report result: %v %v", lag, err)
+	}
+}
+
+func TestReplicationReporterHeartbeat(t *testing.T) {
+	*heartbeatEnable = true
+	defer func() { *heartbeatEnable = false }()
+	mysqld := mysqlctl.NewFakeMysqlDaemon()
+	rr := &replicationReporter{mysqld: mysqld}
+
+	// the master creates the table once, then only updates it
+	rr.Report(false, true)
+	mysqld.ExpectedExecuteSuperQueryList = append(mysqlctl.CreateHeartbeatTable(), "SUBINSERT INTO _vt.heartbeat", "SUBINSERT INTO _vt.heartbeat")
+	rr.poll()
+	rr.poll()
+	if err := mysqld.CheckSuperQueryList(); err != nil {
+		t.Errorf("unexpected heartbeat queries: %v", err)
+	}
+
+	// slaves read it
+	heartbeat := time.Now().Add(-30 * time.Second).UnixNano()
+	mysqld.FetchSuperQueryMap = map[string]*mproto.QueryResult{
+		"SELECT time_created_ns FROM _vt.heartbeat WHERE id=1": &mproto.QueryResult{
+			Rows: [][]sqltypes.Value{
+				[]sqltypes.Value{sqltypes.MakeString([]byte(fmt.Sprintf("%v", heartbeat)))},
+			},
+		},
+	}
+	lag, err := rr.Report(true, true)
+	if err != nil || lag < 30*time.Second || lag > 40*time.Second {
+		t.Errorf("unexpected heartbeat Report result: %v %v", lag, err)
+	}
+}
@@ -8,24 +8,37 @@ import (
 	"flag"
 	"fmt"
 
+	"github.com/youtube/vitess/go/vt/logutil"
 	"github.com/youtube/vitess/go/vt/mysqlctl"
 	myproto "github.com/youtube/vitess/go/vt/mysqlctl/proto"
 	"github.com/youtube/vitess/go/vt/topo"
+	"golang.org/x/net/context"
 )
 
 // This file handles the initial backup restore upon startup.
-// It is only enabled if restore_from_backup is set.
+// It is only enabled if restore_from_backup is set, and uses a
+// streaming clone if restore_streaming_clone is also set.
+// The RestoreFromBackup RPC uses the same code.
 
 var (
-	restoreFromBackup  = flag.Bool("restore_from_backup", false, "(init restore parameter) will check BackupStorage for a recent backup at startup and start there")
-	restoreConcurrency = flag.Int("restore_concurrency", 4, "(init restore parameter) how many concurrent files to restore at once")
+	restoreFromBackup     = flag.Bool("restore_from_backup", false, "(init restore parameter) will check BackupStorage for a recent backup at startup and start there")
+	restoreConcurrency    = flag.Int("restore_concurrency", 4, "(init restore parameter) how many concurrent files to restore at once")
+	restoreBandwidthLimit = flag.Int64("restore_bandwidth_limit", 0, "(init restore parameter) maximum bytes per second read from BackupStorage, for all files (0 means no limit)")
+
+	// backupBandwidthLimit is used by the Backup RPC when the
+	// caller doesn't provide a limit.
+	backupBandwidthLimit = flag.Int64("backup_bandwidth_limit", 0, "default maximum bytes per second read by a backup, for all files (0 means no limit)")
+
+	// backupRetentionCount is how many complete backups of the
+	// shard are kept after a successful backup.
+	backupRetentionCount = flag.Int("backup_retention_count", 0, "if set, the older backups of the shard are removed after a successful backup, so only that many complete backups are kept")
 )
 
-// RestoreFromBackup is the main entry point for backup restore.
-// It will either work, fail gracefully, or return
+// RestoreAtStartup is the main entry point for backup restore at
+// startup. It will either work, fail gracefully, or return
 // an error in case of a non-recoverable error.
 // It takes the action lock so no RPC interferes.
-func (agent *ActionAgent) RestoreFromBackup() error {
+func (agent *ActionAgent) RestoreAtStartup() error {
 	agent.actionMutex.Lock()
 	defer agent.actionMutex.Unlock()
 
@@ -42,36 +55,8 @@ func (agent *ActionAgent) RestoreFromBackup() error {
 
 	// do the optional restore, if that fails we are in a bad state,
 	// just log.Fatalf out.
-	bucket := fmt.Sprintf("%v/%v", tablet.Keyspace, tablet.Shard)
-	pos, err := mysqlctl.Restore(agent.MysqlDaemon, bucket, *restoreConcurrency, agent.hookExtraEnv())
-	if err != nil && err != mysqlctl.ErrNoBackup {
-		return fmt.Errorf("Cannot restore original backup: %v", err)
-	}
-
-	if err == nil {
-		// now read the shard to find the current master, and its location
-		si, err := agent.TopoServer.GetShard(tablet.Keyspace, tablet.Shard)
-		if err != nil {
-			return fmt.Errorf("Cannot read shard: %v", err)
-		}
-		ti, err := agent.TopoServer.GetTablet(si.MasterAlias)
-		if err != nil {
-			return fmt.Errorf("Cannot read master tablet %v: %v", si.MasterAlias, err)
-		}
-
-		// set replication straight
-		status := &myproto.ReplicationStatus{
-			Position:   pos,
-			MasterHost: ti.Hostname,
-			MasterPort: ti.Portmap["mysql"],
-		}
-		cmds, err := agent.MysqlDaemon.StartReplicationCommands(status)
-		if err != nil {
-			return fmt.Errorf("MysqlDaemon.StartReplicationCommands failed: %v", err)
-		}
-		if err := agent.MysqlDaemon.ExecuteSuperQueryList(cmds); err != nil {
-			return fmt.Errorf("MysqlDaemon.ExecuteSuperQueryList failed: %v", err)
-		}
+	if err := agent.restoreData(agent.batchCtx, logutil.NewConsoleLogger(), tablet.Tablet, *restoreStreamingClone); err != nil && err != mysqlctl.ErrNoBackup {
+		return err
 	}
 
 	// change type back to original type
@@ -83,3 +68,57 @@ func (agent *ActionAgent) RestoreFromBackup() error {
 	}
 	return nil
 }
+
+// restoreData restores the data of the tablet, from a streaming clone
+// if streamingClone is set, and from BackupStorage otherwise, and
+// points its replication at the master of the shard. The streaming
+// clone falls back to BackupStorage if there is no tablet to clone.
+// It returns mysqlctl.ErrNoBackup, without changing anything, if
+// there is no backup to restore.
+func (agent *ActionAgent) restoreData(ctx context.Context, logger logutil.Logger, tablet *topo.Tablet, streamingClone bool) error {
+	var pos myproto.ReplicationPosition
+	err := errNoStreamingCloneSource
+	if streamingClone {
+		pos, err = agent.restoreFromStreamingClone(ctx, tablet)
+		if err == errNoStreamingCloneSource {
+			logger.Warningf("No tablet to clone in %v/%v, restoring from BackupStorage", tablet.Keyspace, tablet.Shard)
+		} else if err != nil {
+			return fmt.Errorf("Cannot restore with a streaming clone: %v", err)
+		}
+	}
+	if err == errNoStreamingCloneSource {
+		bucket := fmt.Sprintf("%v/%v", tablet.Keyspace, tablet.Shard)
+		pos, err = mysqlctl.Restore(agent.MysqlDaemon, logger, bucket, *restoreConcurrency, *restoreBandwidthLimit, agent.hookExtraEnv())
+		if err == mysqlctl.ErrNoBackup {
+			return err
+		}
+		if err != nil {
+			return fmt.Errorf("Cannot restore original backup: %v", err)
+		}
+	}
+
+	// now read the shard to find the current master, and its location
+	si, err := agent.TopoServer.GetShard(tablet.Keyspace, tablet.Shard)
+	if err != nil {
+		return fmt.Errorf("Cannot read shard: %v", err)
+	}
+	ti, err := agent.TopoServer.GetTablet(si.MasterAlias)
+	if err != nil {
+		return fmt.Errorf("Cannot read master tablet %v: %v", si.MasterAlias, err)
+	}
+
+	// set replication straight
+	status := &myproto.ReplicationStatus{
+		Position:   pos,
+		MasterHost: ti.Hostname,
+		MasterPort: ti.Portmap["mysql"],
+	}
+	cmds, err := agent.MysqlDaemon.StartReplicationCommands(ti.Keyspace, ti.Shard, status)
+	if err != nil {
+		return fmt.Errorf("MysqlDaemon.StartReplicationCommands failed: %v", err)
+	}
+	if err := agent.MysqlDaemon.ExecuteSuperQueryList(cmds); err != nil {
+		return fmt.Errorf("MysqlDaemon.ExecuteSuperQueryList failed: %v", err)
+	}
+	return nil
+}
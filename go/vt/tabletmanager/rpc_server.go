@@ -6,11 +6,15 @@ package tabletmanager
 
 import (
 	"fmt"
+	"regexp"
+	"strconv"
 	"time"
 
 	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/mysql"
 	"github.com/youtube/vitess/go/tb"
 	"github.com/youtube/vitess/go/vt/callinfo"
+	"github.com/youtube/vitess/go/vt/vterrors"
 	"golang.org/x/net/context"
 )
 
@@ -18,10 +22,12 @@ import (
 
 // rpcTimeout is used for timing out the queries on the server in a
 // reasonable amount of time. In the RPC case, if the
-// client goes away (while waiting on the action mutex), the server
+// client goes away (while waiting on the action lock), the server
 // won't know, and may still execute the RPC call at a later time.
-// To prevent that, if it takes more than rpcTimeout to take the action mutex,
-// we return an error to the caller.
+// To prevent that, we wait for the action lock until the caller's
+// context expires, or for at most rpcTimeout if it has no deadline.
+// If it takes more than rpcTimeout to take the action mutex,
+// we also return an error to the caller.
 const rpcTimeout = time.Second * 30
 
 //
@@ -30,41 +36,104 @@ const rpcTimeout = time.Second * 30
 
 // rpcWrapper handles all the logic for rpc calls.
 func (agent *ActionAgent) rpcWrapper(ctx context.Context, name string, args, reply interface{}, verbose bool, f func() error, lock, runAfterAction bool) (err error) {
-	defer func() {
-		if x := recover(); x != nil {
-			log.Errorf("TabletManager.%v(%v) on %v panic: %v\n%s", name, args, agent.TabletAlias, x, tb.Stack(4))
-			err = fmt.Errorf("caught panic during %v: %v", name, x)
-		}
-	}()
-
 	from := ""
 	ci, ok := callinfo.FromContext(ctx)
 	if ok {
 		from = ci.Text()
 	}
 
+	startTime := time.Now()
+	defer func() {
+		if x := recover(); x != nil {
+			log.Errorf("TabletManager.%v(%v) on %v panic: %v\n%s", name, args, agent.TabletAlias, x, tb.Stack(4))
+			err = vterrors.Errorf(vterrors.Internal, "caught panic during %v: %v", name, x)
+		}
+		if lock {
+			// actions that take the lock are kept in the action history
+			agent.recordAction(name, args, from, startTime, err)
+		}
+	}()
+
+	// Schema changes only wait for other schema changes, the other
+	// locking actions also take the action mutex, so they don't run
+	// during a health check.
+	takeActionMutex := lock && actionCategory(name) != actionCategorySchema
 	if lock {
-		beforeLock := time.Now()
+		lockCtx := ctx
+		if _, ok := ctx.Deadline(); !ok {
+			var cancel context.CancelFunc
+			lockCtx, cancel = context.WithTimeout(ctx, rpcTimeout)
+			defer cancel()
+		}
+		release, err := agent.actionLock.acquire(lockCtx, name)
+		if err != nil {
+			return err
+		}
+		defer release()
+	}
+	if takeActionMutex {
 		agent.actionMutex.Lock()
 		defer agent.actionMutex.Unlock()
-		if time.Now().Sub(beforeLock) > rpcTimeout {
-			return fmt.Errorf("server timeout for " + name)
+		if time.Now().Sub(startTime) > rpcTimeout {
+			return vterrors.Errorf(vterrors.DeadlineExceeded, "server timeout for %v", name)
 		}
 	}
+	if err = agent.checkMaintenanceMode(name); err != nil {
+		return err
+	}
 
 	if err = f(); err != nil {
 		log.Warningf("TabletManager.%v(%v)(on %v from %v) error: %v", name, args, agent.TabletAlias, from, err.Error())
-		return fmt.Errorf("TabletManager.%v on %v error: %v", name, agent.TabletAlias, err)
+		return vterrors.FromError(rpcErrorCode(ctx, err), fmt.Errorf("TabletManager.%v on %v error: %v", name, agent.TabletAlias, err))
 	}
 	if verbose {
 		log.Infof("TabletManager.%v(%v)(on %v from %v): %#v", name, args, agent.TabletAlias, from, reply)
 	}
 	if runAfterAction {
+		if !takeActionMutex {
+			agent.actionMutex.Lock()
+			defer agent.actionMutex.Unlock()
+		}
 		err = agent.refreshTablet(ctx, "RPC("+name+")")
 	}
 	return
 }
 
+var errnoExtract = regexp.MustCompile(`\(errno ([0-9]+)\)`)
+
+// rpcErrorCode returns the code of the error of an action: its own if
+// it has one, or the code of its MySQL error. The MySQL errors that
+// went through a string only have their number in the message.
+func rpcErrorCode(ctx context.Context, err error) vterrors.ErrorCode {
+	if code := vterrors.RecoverCode(err); code != vterrors.Unknown {
+		return code
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		return vterrors.DeadlineExceeded
+	}
+	var errno int
+	if sqlErr, ok := err.(interface {
+		Number() int
+	}); ok {
+		errno = sqlErr.Number()
+	} else if match := errnoExtract.FindStringSubmatch(err.Error()); match != nil {
+		errno, _ = strconv.Atoi(match[1])
+	}
+	switch {
+	case errno == 0:
+		return vterrors.Unknown
+	case errno == mysql.ErrDupEntry:
+		return vterrors.IntegrityError
+	case errno == mysql.ErrOptionPreventsStatement, errno == mysql.ErrLockWaitTimeout, errno == mysql.ErrLockDeadlock:
+		// read-only: the tablet is not a master anymore
+		return vterrors.Transient
+	case errno >= 2000 && errno <= 2018:
+		// the connection to MySQL is gone
+		return vterrors.Transient
+	}
+	return vterrors.BadInput
+}
+
 // RPCWrap is for read-only actions that can be executed concurrently.
 // verbose is forced to false.
 func (agent *ActionAgent) RPCWrap(ctx context.Context, name string, args, reply interface{}, f func() error) error {
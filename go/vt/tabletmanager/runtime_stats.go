@@ -0,0 +1,91 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tabletmanager
+
+// This file samples the query service activity (QPS, errors and
+// connections in use). The samples are returned by the GetRuntimeStats
+// RPC, so the wrangler and vtworker can see how loaded a tablet is.
+// With -health_publish_query_stats, each health check also publishes a
+// coarse version in the health map: the values are rounded down to a
+// power of ten, so the tablet record (and the serving graph) are only
+// updated when the load changes significantly.
+
+import (
+	"flag"
+	"fmt"
+	"time"
+
+	tproto "github.com/youtube/vitess/go/vt/tabletserver/proto"
+	"github.com/youtube/vitess/go/vt/topo"
+	"golang.org/x/net/context"
+)
+
+var (
+	healthPublishQueryStats = flag.Bool("health_publish_query_stats", false, "if set, the health check publishes a coarse summary of the query service QPS, error rate and connections in use in the tablet health map")
+)
+
+// sampleRuntimeStats takes a new sample of the query service stats,
+// computes the error rate since the previous sample, and remembers it.
+func (agent *ActionAgent) sampleRuntimeStats() *tproto.RuntimeStats {
+	rs := agent.QueryServiceControl.RuntimeStats()
+	now := time.Now()
+
+	agent.mutex.Lock()
+	defer agent.mutex.Unlock()
+	if previous := agent._runtimeStats; previous != nil && rs.ErrorCount >= previous.ErrorCount {
+		if elapsed := now.Sub(agent._runtimeStatsTime).Seconds(); elapsed > 0 {
+			rs.ErrorRate = float64(rs.ErrorCount-previous.ErrorCount) / elapsed
+		}
+	}
+	agent._runtimeStats = &rs
+	agent._runtimeStatsTime = now
+	return &rs
+}
+
+// GetRuntimeStats returns the most recent sample of the query service
+// stats. The health check takes a sample at every run, so we only
+// take a new one if the last one is older than the health check
+// interval (or the health check is not running). This way the error
+// rate is never computed over a very short window.
+// Should be called under RPCWrap.
+func (agent *ActionAgent) GetRuntimeStats(ctx context.Context) *tproto.RuntimeStats {
+	agent.mutex.Lock()
+	rs := agent._runtimeStats
+	age := time.Now().Sub(agent._runtimeStatsTime)
+	agent.mutex.Unlock()
+
+	if rs == nil || age > *healthCheckInterval {
+		rs = agent.sampleRuntimeStats()
+	}
+	return rs
+}
+
+// addRuntimeStatsHealth samples the query service stats, and publishes
+// their summary in the health map if enabled.
+func (agent *ActionAgent) addRuntimeStatsHealth(health map[string]string) {
+	rs := agent.sampleRuntimeStats()
+	if *healthPublishQueryStats {
+		health[topo.QueryServiceStats] = runtimeStatsSummary(rs)
+	}
+}
+
+// runtimeStatsSummary returns the coarse version of the stats
+// published in the health map.
+func runtimeStatsSummary(rs *tproto.RuntimeStats) string {
+	return fmt.Sprintf("qps=%v,errors_per_second=%v,connections=%v", magnitude(rs.QPS["All"]), magnitude(rs.ErrorRate), magnitude(float64(rs.ConnectionsInUse)))
+}
+
+// magnitude rounds a value down to a power of ten: "0" for less than
+// one, then "1+", "10+", "100+", ...
+func magnitude(value float64) string {
+	if value < 1 {
+		return "0"
+	}
+	power := int64(1)
+	for float64(power*10) <= value {
+		power *= 10
+	}
+	return fmt.Sprintf("%v+", power)
+}
@@ -0,0 +1,95 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tabletmanager
+
+import (
+	"testing"
+	"time"
+
+	"github.com/youtube/vitess/go/vt/tabletserver"
+	tproto "github.com/youtube/vitess/go/vt/tabletserver/proto"
+	"github.com/youtube/vitess/go/vt/topo"
+	"golang.org/x/net/context"
+)
+
+func TestMagnitude(t *testing.T) {
+	table := map[float64]string{
+		0:       "0",
+		0.5:     "0",
+		1:       "1+",
+		9.9:     "1+",
+		10:      "10+",
+		999:     "100+",
+		1000:    "1000+",
+		2500000: "1000000+",
+	}
+	for value, expected := range table {
+		if got := magnitude(value); got != expected {
+			t.Errorf("magnitude(%v) = %v, want %v", value, got, expected)
+		}
+	}
+}
+
+func TestGetRuntimeStats(t *testing.T) {
+	agent := createTestAgent(t)
+	ctx := context.Background()
+	qsc := agent.QueryServiceControl.(*tabletserver.TestQueryServiceControl)
+	qsc.RuntimeStatsResult = tproto.RuntimeStats{
+		QPS:        map[string]float64{"All": 150},
+		ErrorCount: 10,
+	}
+
+	// the first sample has no error rate
+	rs := agent.GetRuntimeStats(ctx)
+	if rs.QPS["All"] != 150 || rs.ErrorCount != 10 || rs.ErrorRate != 0 {
+		t.Errorf("unexpected first sample: %#v", rs)
+	}
+
+	// a recent sample is returned as is
+	qsc.RuntimeStatsResult.ErrorCount = 20
+	if rs := agent.GetRuntimeStats(ctx); rs.ErrorCount != 10 {
+		t.Errorf("recent sample should have been reused: %#v", rs)
+	}
+
+	// a new sample computes the error rate since the previous one
+	agent.mutex.Lock()
+	agent._runtimeStatsTime = agent._runtimeStatsTime.Add(-*healthCheckInterval - 10*time.Second)
+	agent.mutex.Unlock()
+	rs = agent.GetRuntimeStats(ctx)
+	if rs.ErrorCount != 20 || rs.ErrorRate <= 0 || rs.ErrorRate > 10.0/(healthCheckInterval.Seconds()+10) {
+		t.Errorf("unexpected new sample: %#v", rs)
+	}
+}
+
+func TestHealthCheckPublishesQueryStats(t *testing.T) {
+	agent := createTestAgent(t)
+	agent.QueryServiceControl.(*tabletserver.TestQueryServiceControl).RuntimeStatsResult = tproto.RuntimeStats{
+		QPS:              map[string]float64{"All": 150},
+		ConnectionsInUse: 3,
+	}
+	oldPublish := *healthPublishQueryStats
+	defer func() { *healthPublishQueryStats = oldPublish }()
+
+	// not published by default
+	*healthPublishQueryStats = false
+	agent.runHealthCheck(topo.TYPE_REPLICA)
+	ti, err := agent.TopoServer.GetTablet(tabletAlias)
+	if err != nil {
+		t.Fatalf("GetTablet failed: %v", err)
+	}
+	if _, ok := ti.Health[topo.QueryServiceStats]; ok {
+		t.Errorf("query stats shouldn't be in the health map: %v", ti.Health)
+	}
+
+	*healthPublishQueryStats = true
+	agent.runHealthCheck(topo.TYPE_REPLICA)
+	ti, err = agent.TopoServer.GetTablet(tabletAlias)
+	if err != nil {
+		t.Fatalf("GetTablet failed: %v", err)
+	}
+	if got, want := ti.Health[topo.QueryServiceStats], "qps=100+,errors_per_second=0,connections=1+"; got != want {
+		t.Errorf("unexpected query stats in the health map: got %v want %v", got, want)
+	}
+}
@@ -0,0 +1,179 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tabletmanager
+
+// This file handles both sides of the streaming clone. The source
+// tablet is prepared by StreamingCloneSourceStart, and serves the data
+// of its tables on /streamingclone/table, with chunked encoding. The
+// stats of the data are sent in the trailers, once all the rows are.
+// The destination uses it at startup instead of BackupStorage, if
+// restore_streaming_clone is set.
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/acl"
+	"github.com/youtube/vitess/go/vt/mysqlctl"
+	myproto "github.com/youtube/vitess/go/vt/mysqlctl/proto"
+	"github.com/youtube/vitess/go/vt/tabletmanager/tmclient"
+	"github.com/youtube/vitess/go/vt/topo"
+	"golang.org/x/net/context"
+)
+
+var (
+	restoreStreamingClone = flag.Bool("restore_streaming_clone", false, "(init restore parameter) with restore_from_backup, copy the data from a running rdonly or replica tablet of the shard instead of BackupStorage, which is only used if there is no such tablet")
+)
+
+const (
+	streamingCloneRowsTrailer     = "X-Vt-Rows"
+	streamingCloneChecksumTrailer = "X-Vt-Checksum"
+	streamingCloneErrorTrailer    = "X-Vt-Error"
+)
+
+// errNoStreamingCloneSource is returned by restoreFromStreamingClone
+// when there is no tablet to clone in the shard.
+var errNoStreamingCloneSource = errors.New("no tablet to clone from")
+
+// serveStreamingCloneTable streams the data of one table, while the
+// tablet is a streaming clone source.
+func (agent *ActionAgent) serveStreamingCloneTable(w http.ResponseWriter, r *http.Request) {
+	if err := acl.CheckAccessHTTP(r, acl.ADMIN); err != nil {
+		acl.SendError(w, err)
+		return
+	}
+	agent.mutex.Lock()
+	source := agent._streamingCloneSource
+	agent.mutex.Unlock()
+	if source == nil {
+		http.Error(w, "not a streaming clone source", http.StatusServiceUnavailable)
+		return
+	}
+	table := r.FormValue("table")
+	td, ok := source.SchemaDefinition.GetTable(table)
+	if !ok || td.Type != myproto.TableBaseTable {
+		http.Error(w, fmt.Sprintf("unknown table %v", table), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Trailer", strings.Join([]string{streamingCloneRowsTrailer, streamingCloneChecksumTrailer, streamingCloneErrorTrailer}, ", "))
+	stats, err := mysqlctl.StreamTableData(agent.MysqlDaemon, w, source.DbName, td)
+	if err != nil {
+		log.Warningf("Streaming clone of table %v failed: %v", table, err)
+		w.Header().Set(streamingCloneErrorTrailer, strings.Replace(err.Error(), "\n", " ", -1))
+		return
+	}
+	w.Header().Set(streamingCloneRowsTrailer, strconv.FormatUint(stats.Rows, 10))
+	w.Header().Set(streamingCloneChecksumTrailer, strconv.FormatUint(uint64(stats.Checksum), 10))
+}
+
+// registerStreamingCloneHandler registers the /streamingclone/table
+// handler.
+func (agent *ActionAgent) registerStreamingCloneHandler() {
+	http.HandleFunc("/streamingclone/table", agent.serveStreamingCloneTable)
+}
+
+// httpTableDataReader reads the data of a table served by
+// serveStreamingCloneTable.
+type httpTableDataReader struct {
+	resp *http.Response
+}
+
+// Read is part of the mysqlctl.TableDataReader interface.
+func (r *httpTableDataReader) Read(p []byte) (int, error) {
+	return r.resp.Body.Read(p)
+}
+
+// Close is part of the mysqlctl.TableDataReader interface.
+func (r *httpTableDataReader) Close() error {
+	return r.resp.Body.Close()
+}
+
+// Stats is part of the mysqlctl.TableDataReader interface.
+func (r *httpTableDataReader) Stats() (mysqlctl.TableDataStats, error) {
+	if e := r.resp.Trailer.Get(streamingCloneErrorTrailer); e != "" {
+		return mysqlctl.TableDataStats{}, errors.New(e)
+	}
+	rows, err := strconv.ParseUint(r.resp.Trailer.Get(streamingCloneRowsTrailer), 10, 64)
+	if err != nil {
+		return mysqlctl.TableDataStats{}, fmt.Errorf("invalid %v trailer: %v", streamingCloneRowsTrailer, err)
+	}
+	checksum, err := strconv.ParseUint(r.resp.Trailer.Get(streamingCloneChecksumTrailer), 10, 32)
+	if err != nil {
+		return mysqlctl.TableDataStats{}, fmt.Errorf("invalid %v trailer: %v", streamingCloneChecksumTrailer, err)
+	}
+	return mysqlctl.TableDataStats{
+		Rows:     rows,
+		Checksum: uint32(checksum),
+	}, nil
+}
+
+// openStreamingCloneTable requests the data of a table from the
+// streaming clone source at addr.
+func openStreamingCloneTable(addr, table string) (mysqlctl.TableDataReader, error) {
+	resp, err := http.Get(fmt.Sprintf("http://%v/streamingclone/table?table=%v", addr, url.QueryEscape(table)))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		return nil, fmt.Errorf("%v: %v", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return &httpTableDataReader{resp}, nil
+}
+
+// findStreamingCloneSource returns a tablet of the shard to clone
+// from: a rdonly one if possible, a replica otherwise.
+func (agent *ActionAgent) findStreamingCloneSource(ctx context.Context, tablet *topo.Tablet) (*topo.TabletInfo, error) {
+	tabletMap, err := topo.GetTabletMapForShard(ctx, agent.TopoServer, tablet.Keyspace, tablet.Shard)
+	if err != nil && err != topo.ErrPartialResult {
+		return nil, err
+	}
+	for _, tabletType := range []topo.TabletType{topo.TYPE_RDONLY, topo.TYPE_REPLICA} {
+		for alias, ti := range tabletMap {
+			if alias != tablet.Alias && ti.Type == tabletType {
+				return ti, nil
+			}
+		}
+	}
+	return nil, errNoStreamingCloneSource
+}
+
+// restoreFromStreamingClone copies the data of another tablet of the
+// shard, and returns its replication position.
+func (agent *ActionAgent) restoreFromStreamingClone(ctx context.Context, tablet *topo.Tablet) (myproto.ReplicationPosition, error) {
+	ti, err := agent.findStreamingCloneSource(ctx, tablet)
+	if err != nil {
+		return myproto.ReplicationPosition{}, err
+	}
+	log.Infof("Restore: streaming clone from %v", ti.Alias)
+
+	tmc := tmclient.NewTabletManagerClient()
+	source, err := tmc.StreamingCloneSourceStart(ctx, ti)
+	if err != nil {
+		return myproto.ReplicationPosition{}, fmt.Errorf("StreamingCloneSourceStart on %v failed: %v", ti.Alias, err)
+	}
+	restoreErr := mysqlctl.StreamingRestore(agent.MysqlDaemon, source.SchemaDefinition, tablet.DbName(), *restoreConcurrency, func(table string) (mysqlctl.TableDataReader, error) {
+		return openStreamingCloneTable(ti.Addr(), table)
+	})
+	if err := tmc.StreamingCloneSourceEnd(ctx, ti, source.OriginalType); err != nil {
+		// the clone itself may be fine, the source will need
+		// to be fixed manually
+		log.Errorf("StreamingCloneSourceEnd on %v failed: %v", ti.Alias, err)
+	}
+	if restoreErr != nil {
+		return myproto.ReplicationPosition{}, restoreErr
+	}
+	return source.Position, nil
+}
@@ -0,0 +1,81 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tabletmanager
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	myproto "github.com/youtube/vitess/go/vt/mysqlctl/proto"
+	"github.com/youtube/vitess/go/vt/tabletmanager/actionnode"
+)
+
+func TestServeStreamingCloneTable(t *testing.T) {
+	agent := &ActionAgent{}
+	server := httptest.NewServer(http.HandlerFunc(agent.serveStreamingCloneTable))
+	defer server.Close()
+	addr := strings.TrimPrefix(server.URL, "http://")
+
+	// not a source yet
+	if _, err := openStreamingCloneTable(addr, "table1"); err == nil || !strings.Contains(err.Error(), "not a streaming clone source") {
+		t.Errorf("openStreamingCloneTable on a non-source returned %v", err)
+	}
+
+	agent._streamingCloneSource = &actionnode.StreamingCloneSourceReply{
+		DbName: "vt_test_keyspace",
+		SchemaDefinition: &myproto.SchemaDefinition{
+			TableDefinitions: []*myproto.TableDefinition{
+				{Name: "table1", Type: myproto.TableBaseTable},
+				{Name: "view1", Type: myproto.TableView},
+			},
+		},
+	}
+	for _, table := range []string{"table2", "view1"} {
+		if _, err := openStreamingCloneTable(addr, table); err == nil || !strings.Contains(err.Error(), "unknown table "+table) {
+			t.Errorf("openStreamingCloneTable(%v) returned %v", table, err)
+		}
+	}
+}
+
+func TestHTTPTableDataReaderStats(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Trailer", "X-Vt-Rows, X-Vt-Checksum, X-Vt-Error")
+		w.Write([]byte("1\tone\n2\ttwo\n"))
+		if r.FormValue("table") == "broken" {
+			w.Header().Set(streamingCloneErrorTrailer, "connection lost")
+			return
+		}
+		w.Header().Set(streamingCloneRowsTrailer, "2")
+		w.Header().Set(streamingCloneChecksumTrailer, "1234")
+	}))
+	defer server.Close()
+	addr := strings.TrimPrefix(server.URL, "http://")
+
+	tdr, err := openStreamingCloneTable(addr, "table1")
+	if err != nil {
+		t.Fatalf("openStreamingCloneTable failed: %v", err)
+	}
+	if data, err := ioutil.ReadAll(tdr); err != nil || string(data) != "1\tone\n2\ttwo\n" {
+		t.Errorf("unexpected data: %q %v", data, err)
+	}
+	stats, err := tdr.Stats()
+	if err != nil || stats.Rows != 2 || stats.Checksum != 1234 {
+		t.Errorf("unexpected stats: %v %v", stats, err)
+	}
+	tdr.Close()
+
+	tdr, err = openStreamingCloneTable(addr, "broken")
+	if err != nil {
+		t.Fatalf("openStreamingCloneTable failed: %v", err)
+	}
+	ioutil.ReadAll(tdr)
+	if _, err := tdr.Stats(); err == nil || err.Error() != "connection lost" {
+		t.Errorf("Stats of a failed stream returned %v", err)
+	}
+	tdr.Close()
+}
@@ -0,0 +1,56 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tabletmanager
+
+// This file loads the table ACL config from the topology, instead of
+// the -table-acl-config file of vttablet. The config of the keyspace
+// of the tablet is used if it has one, else the global one. It is
+// loaded before the query service starts, and again by the
+// ReloadTableACL action, which replaces it for the next queries.
+
+import (
+	"flag"
+	"fmt"
+
+	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/vt/tableacl"
+	"github.com/youtube/vitess/go/vt/topo"
+	"golang.org/x/net/context"
+)
+
+var tableACLFromTopo = flag.Bool("table_acl_from_topo", false, "if set, the table ACL config is loaded from the topology (the one of the tablet keyspace, or the global one), and reloaded by the ReloadTableACL action")
+
+// loadTableACL loads the table ACL config of the tablet from the
+// topology. With no config, all the tables are allowed.
+func (agent *ActionAgent) loadTableACL(ctx context.Context) error {
+	tablet, err := topo.GetTablet(ctx, agent.TopoServer, agent.TabletAlias)
+	if err != nil {
+		return err
+	}
+	tableACL, err := topo.GetKeyspaceTableACL(agent.TopoServer, tablet.Keyspace)
+	switch err {
+	case nil:
+	case topo.ErrNoNode:
+		log.Warningf("no table ACL config in the topology for keyspace %v, allowing all the tables", tablet.Keyspace)
+		tableACL = &topo.TableACL{Config: "{}"}
+	default:
+		return fmt.Errorf("cannot read the table ACL config of keyspace %v: %v", tablet.Keyspace, err)
+	}
+	if err := tableacl.Load([]byte(tableACL.Config), tableACL.DryRun); err != nil {
+		return fmt.Errorf("invalid table ACL config for keyspace %v: %v", tablet.Keyspace, err)
+	}
+	log.Infof("loaded the table ACL config for keyspace %v (dry run: %v)", tablet.Keyspace, tableACL.DryRun)
+	return nil
+}
+
+// ReloadTableACL reloads the table ACL config from the topology. The
+// queries that are running keep the config they started with.
+// Should be called under RPCWrapLockAction.
+func (agent *ActionAgent) ReloadTableACL(ctx context.Context) error {
+	if !*tableACLFromTopo {
+		return fmt.Errorf("this tablet doesn't load its table ACL config from the topology, see -table_acl_from_topo")
+	}
+	return agent.loadTableACL(ctx)
+}
@@ -0,0 +1,80 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tabletmanager
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/youtube/vitess/go/vt/tableacl"
+	"github.com/youtube/vitess/go/vt/tableacl/simpleacl"
+	"github.com/youtube/vitess/go/vt/topo"
+	"golang.org/x/net/context"
+)
+
+func TestReloadTableACL(t *testing.T) {
+	aclName := fmt.Sprintf("simpleacl-test-%d", rand.Int63())
+	tableacl.Register(aclName, &simpleacl.Factory{})
+	tableacl.SetDefaultACL(aclName)
+
+	agent := createTestAgent(t)
+	ctx := context.Background()
+
+	// the tablet has to be configured to use the topology
+	if err := agent.ReloadTableACL(ctx); err == nil {
+		t.Errorf("ReloadTableACL without -table_acl_from_topo should fail")
+	}
+	*tableACLFromTopo = true
+	defer func() { *tableACLFromTopo = false }()
+
+	// with no config, everything is allowed
+	if err := agent.ReloadTableACL(ctx); err != nil {
+		t.Fatalf("ReloadTableACL failed: %v", err)
+	}
+	if !tableacl.Authorized("test_table", tableacl.READER).IsMember("u1") {
+		t.Errorf("u1 should be allowed without a config")
+	}
+
+	// the global config
+	tableACLer := agent.TopoServer.(topo.TableACLer)
+	if err := tableACLer.SaveTableACL(&topo.TableACL{Config: `{"test_table": {"READER": "u1"}}`}); err != nil {
+		t.Fatalf("SaveTableACL failed: %v", err)
+	}
+	if err := agent.ReloadTableACL(ctx); err != nil {
+		t.Fatalf("ReloadTableACL failed: %v", err)
+	}
+	if !tableacl.Authorized("test_table", tableacl.READER).IsMember("u1") || tableacl.DryRun() {
+		t.Errorf("the global config wasn't loaded")
+	}
+
+	// the keyspace config overrides it
+	ki, err := agent.TopoServer.GetKeyspace(keyspace)
+	if err != nil {
+		t.Fatalf("GetKeyspace failed: %v", err)
+	}
+	ki.TableACL = &topo.TableACL{Config: `{"test_table": {"READER": "u2"}}`, DryRun: true}
+	if err := topo.UpdateKeyspace(agent.TopoServer, ki); err != nil {
+		t.Fatalf("UpdateKeyspace failed: %v", err)
+	}
+	if err := agent.ReloadTableACL(ctx); err != nil {
+		t.Fatalf("ReloadTableACL failed: %v", err)
+	}
+	if tableacl.Authorized("test_table", tableacl.READER).IsMember("u1") || !tableacl.DryRun() {
+		t.Errorf("the keyspace config wasn't loaded")
+	}
+
+	// an invalid config keeps the current one
+	ki.TableACL = &topo.TableACL{Config: `{"test_table": {"BADROLE": "u1"}}`}
+	if err := topo.UpdateKeyspace(agent.TopoServer, ki); err != nil {
+		t.Fatalf("UpdateKeyspace failed: %v", err)
+	}
+	if err := agent.ReloadTableACL(ctx); err == nil {
+		t.Errorf("ReloadTableACL of an invalid config should fail")
+	}
+	if !tableacl.Authorized("test_table", tableacl.READER).IsMember("u2") || !tableacl.DryRun() {
+		t.Errorf("the failed reload changed the config")
+	}
+}
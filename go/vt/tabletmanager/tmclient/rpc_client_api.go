@@ -15,6 +15,7 @@ import (
 	"github.com/youtube/vitess/go/vt/logutil"
 	myproto "github.com/youtube/vitess/go/vt/mysqlctl/proto"
 	"github.com/youtube/vitess/go/vt/tabletmanager/actionnode"
+	tproto "github.com/youtube/vitess/go/vt/tabletserver/proto"
 	"github.com/youtube/vitess/go/vt/topo"
 	"golang.org/x/net/context"
 )
@@ -39,6 +40,14 @@ type TabletManagerClient interface {
 	// GetPermissions asks the remote tablet for its permissions list
 	GetPermissions(ctx context.Context, tablet *topo.TabletInfo) (*myproto.Permissions, error)
 
+	// GetActionHistory asks the remote tablet for the recent actions
+	// it ran, most recent first
+	GetActionHistory(ctx context.Context, tablet *topo.TabletInfo) ([]*actionnode.ActionHistoryRecord, error)
+
+	// GetRuntimeStats asks the remote tablet for a snapshot of its
+	// query service activity
+	GetRuntimeStats(ctx context.Context, tablet *topo.TabletInfo) (*tproto.RuntimeStats, error)
+
 	//
 	// Various read-write methods
 	//
@@ -49,12 +58,19 @@ type TabletManagerClient interface {
 	// SetReadWrite makes the mysql instance read-write
 	SetReadWrite(ctx context.Context, tablet *topo.TabletInfo) error
 
-	// ChangeType asks the remote tablet to change its type
-	ChangeType(ctx context.Context, tablet *topo.TabletInfo, dbType topo.TabletType) error
+	// ChangeType asks the remote tablet to change its type. The
+	// tablet refuses the transitions that need a reparent or other
+	// shard-level action, unless force is set.
+	ChangeType(ctx context.Context, tablet *topo.TabletInfo, dbType topo.TabletType, force bool) error
 
 	// Scrap scraps the live running tablet
 	Scrap(ctx context.Context, tablet *topo.TabletInfo) error
 
+	// SetMaintenanceMode puts the tablet in or out of maintenance
+	// mode. While in maintenance mode, the tablet refuses type
+	// changes and reparent related actions.
+	SetMaintenanceMode(ctx context.Context, tablet *topo.TabletInfo, on bool, reason string) error
+
 	// Sleep will sleep for a duration (used for tests)
 	Sleep(ctx context.Context, tablet *topo.TabletInfo, duration time.Duration) error
 
@@ -67,6 +83,11 @@ type TabletManagerClient interface {
 	// RunHealthCheck asks the remote tablet to run a health check cycle
 	RunHealthCheck(ctx context.Context, tablet *topo.TabletInfo, targetTabletType topo.TabletType) error
 
+	// SetPoolSize resizes one of the connection pools of the query
+	// service of the remote tablet, see tabletserver.AppPool and the
+	// other pool names.
+	SetPoolSize(ctx context.Context, tablet *topo.TabletInfo, pool string, size int) error
+
 	// HealthStream asks the tablet to stream its health status on
 	// a regular basis
 	HealthStream(ctx context.Context, tablet *topo.TabletInfo) (<-chan *actionnode.HealthStreamReply, ErrFunc, error)
@@ -86,6 +107,14 @@ type TabletManagerClient interface {
 	// ExecuteFetchAsApp executes a query remotely using the App pool
 	ExecuteFetchAsApp(ctx context.Context, tablet *topo.TabletInfo, query string, maxRows int, wantFields bool) (*mproto.QueryResult, error)
 
+	// ReloadUsers asks the remote tablet to apply its users spec
+	// file, and returns the statements it ran
+	ReloadUsers(ctx context.Context, tablet *topo.TabletInfo) ([]string, error)
+
+	// ReloadTableACL asks the remote tablet to reload its table
+	// ACL config from the topology
+	ReloadTableACL(ctx context.Context, tablet *topo.TabletInfo) error
+
 	//
 	// Replication related methods
 	//
@@ -121,6 +150,14 @@ type TabletManagerClient interface {
 	// position in replication
 	WaitBlpPosition(ctx context.Context, tablet *topo.TabletInfo, blpPosition blproto.BlpPosition, waitTime time.Duration) error
 
+	// GetBlpCheckpoints returns the blp_checkpoint table of the
+	// tablet: the positions its binlog players committed
+	GetBlpCheckpoints(ctx context.Context, tablet *topo.TabletInfo) (*blproto.BlpCheckpointList, error)
+
+	// GetBlpStatus returns the status of the binlog players of
+	// the tablet, as they run
+	GetBlpStatus(ctx context.Context, tablet *topo.TabletInfo) (*blproto.BlpStatusList, error)
+
 	// StopBlp asks the tablet to stop all its binlog players,
 	// and returns the current position for all of them
 	StopBlp(ctx context.Context, tablet *topo.TabletInfo) (*blproto.BlpPositionList, error)
@@ -155,8 +192,9 @@ type TabletManagerClient interface {
 	// reparent_journal table.
 	InitSlave(ctx context.Context, tablet *topo.TabletInfo, parent topo.TabletAlias, replicationPosition myproto.ReplicationPosition, timeCreatedNS int64) error
 
-	// DemoteMaster tells the soon-to-be-former master it's gonna change,
-	// and it should go read-only and return its current position.
+	// DemoteMaster tells the soon-to-be-former master it's gonna change.
+	// It should go read-only, kill the remaining write connections and
+	// return its final position, all in the same call.
 	DemoteMaster(ctx context.Context, tablet *topo.TabletInfo) (myproto.ReplicationPosition, error)
 
 	// PromoteSlaveWhenCaughtUp transforms the tablet from a slave to a master.
@@ -184,8 +222,28 @@ type TabletManagerClient interface {
 	// Backup / restore related methods
 	//
 
-	// Backup creates a database backup
-	Backup(ctx context.Context, tablet *topo.TabletInfo, concurrency int) (<-chan *logutil.LoggerEvent, ErrFunc, error)
+	// Backup creates a database backup. bandwidthLimit is in bytes
+	// per second, 0 means use the tablet default, negative means
+	// no limit. If skipSpaceCheck is set, the backup is taken even
+	// if the backup storage doesn't seem to have enough space.
+	Backup(ctx context.Context, tablet *topo.TabletInfo, concurrency int, bandwidthLimit int64, skipSpaceCheck bool) (<-chan *logutil.LoggerEvent, ErrFunc, error)
+
+	// StreamingCloneSourceStart makes the tablet the source of a
+	// streaming clone, and returns what it will serve.
+	StreamingCloneSourceStart(ctx context.Context, tablet *topo.TabletInfo) (*actionnode.StreamingCloneSourceReply, error)
+
+	// StreamingCloneSourceEnd puts the source of a streaming clone
+	// back in service, with the given type.
+	StreamingCloneSourceEnd(ctx context.Context, tablet *topo.TabletInfo, originalType topo.TabletType) error
+
+	// VerifyBackup asks the tablet to check the integrity of a
+	// backup of its shard, or of the most recent one if name is
+	// empty
+	VerifyBackup(ctx context.Context, tablet *topo.TabletInfo, name string) error
+
+	// RestoreFromBackup asks the tablet to restore the most recent
+	// backup of its shard over its data, and streams the progress
+	RestoreFromBackup(ctx context.Context, tablet *topo.TabletInfo) (<-chan *logutil.LoggerEvent, ErrFunc, error)
 
 	//
 	// RPC related methods
@@ -0,0 +1,94 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tabletmanager
+
+// This file contains the throttling of the topology writes done by
+// SlaveWasRestarted. When a maintenance restarts replication on a lot
+// of tablets at once, each call would otherwise write the tablet
+// record and trigger serving graph rebuilds right away.
+
+import (
+	"flag"
+	"sync"
+	"time"
+
+	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/stats"
+	"github.com/youtube/vitess/go/sync2"
+	"github.com/youtube/vitess/go/vt/tabletmanager/actionnode"
+)
+
+var (
+	topoWriteConcurrency            = flag.Int("topo_write_concurrency", 0, "maximum number of concurrent SlaveWasRestarted topology writes in this process (0 means no limit)")
+	slaveWasRestartedCoalesceWindow = flag.Duration("slave_was_restarted_coalesce_window", 0, "if set, SlaveWasRestarted topology updates are delayed by this duration, and all the calls received meanwhile are applied as a single update")
+
+	// topoWriteSemaphore is shared by all the agents in the process,
+	// and created on first use, once the flags are parsed.
+	topoWriteSemaphore     *sync2.Semaphore
+	topoWriteSemaphoreOnce sync.Once
+
+	topoWriteWaitTimings       = stats.NewTimings("TopoWriteThrottleWait")
+	slaveWasRestartedCoalesced = stats.NewInt("SlaveWasRestartedCoalesced")
+)
+
+// throttleTopoWrite runs f with the process-wide topology write
+// semaphore held, and records how long we waited for it.
+func throttleTopoWrite(name string, f func() error) error {
+	topoWriteSemaphoreOnce.Do(func() {
+		if *topoWriteConcurrency > 0 {
+			topoWriteSemaphore = sync2.NewSemaphore(*topoWriteConcurrency, 0)
+		}
+	})
+	if topoWriteSemaphore == nil {
+		return f()
+	}
+
+	startTime := time.Now()
+	topoWriteSemaphore.Acquire()
+	topoWriteWaitTimings.Record(name, startTime)
+	defer topoWriteSemaphore.Release()
+	return f()
+}
+
+// queueSlaveWasRestarted remembers a SlaveWasRestarted call, and
+// schedules the topology update at the end of the coalescing window
+// if it's not scheduled yet. Later calls replace earlier ones, so the
+// last state always wins.
+func (agent *ActionAgent) queueSlaveWasRestarted(swrd *actionnode.SlaveWasRestartedArgs) {
+	agent.mutex.Lock()
+	defer agent.mutex.Unlock()
+	if agent._pendingSlaveWasRestarted != nil {
+		slaveWasRestartedCoalesced.Add(1)
+		agent._pendingSlaveWasRestarted = swrd
+		return
+	}
+	agent._pendingSlaveWasRestarted = swrd
+	time.AfterFunc(*slaveWasRestartedCoalesceWindow, agent.flushSlaveWasRestarted)
+}
+
+// flushSlaveWasRestarted applies the pending SlaveWasRestarted update,
+// and refreshes the tablet state like the RPC would have.
+func (agent *ActionAgent) flushSlaveWasRestarted() {
+	agent.actionMutex.Lock()
+	defer agent.actionMutex.Unlock()
+
+	agent.mutex.Lock()
+	swrd := agent._pendingSlaveWasRestarted
+	agent._pendingSlaveWasRestarted = nil
+	agent.mutex.Unlock()
+	if swrd == nil {
+		return
+	}
+
+	startTime := time.Now()
+	err := agent.slaveWasRestartedUpdateTopo(agent.batchCtx)
+	if err == nil {
+		err = agent.refreshTablet(agent.batchCtx, "SlaveWasRestarted(coalesced)")
+	}
+	if err != nil {
+		log.Warningf("coalesced SlaveWasRestarted(%v) failed: %v", swrd, err)
+	}
+	agent.recordAction(actionnode.TabletActionSlaveWasRestarted, swrd, "coalesced", startTime, err)
+}
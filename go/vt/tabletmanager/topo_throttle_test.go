@@ -0,0 +1,136 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tabletmanager
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/youtube/vitess/go/sqldb"
+	"github.com/youtube/vitess/go/sync2"
+	"github.com/youtube/vitess/go/vt/tabletmanager/actionnode"
+	"github.com/youtube/vitess/go/vt/topo"
+	"golang.org/x/net/context"
+)
+
+func TestSlaveWasRestartedCoalescing(t *testing.T) {
+	agent := createTestAgent(t)
+	agent.BinlogPlayerMap = NewBinlogPlayerMap(agent.TopoServer, &sqldb.ConnParams{}, nil)
+	ctx := context.Background()
+	*slaveWasRestartedCoalesceWindow = 100 * time.Millisecond
+	defer func() { *slaveWasRestartedCoalesceWindow = 0 }()
+
+	// make the tablet a master, so SlaveWasRestarted changes it
+	if err := agent.TopoServer.UpdateTabletFields(tabletAlias, func(tablet *topo.Tablet) error {
+		tablet.Type = topo.TYPE_MASTER
+		return nil
+	}); err != nil {
+		t.Fatalf("UpdateTabletFields failed: %v", err)
+	}
+
+	// a few calls in a row are coalesced, and don't change the
+	// topology right away
+	coalescedBefore := slaveWasRestartedCoalesced.Get()
+	for i := 0; i < 3; i++ {
+		swrd := &actionnode.SlaveWasRestartedArgs{Parent: topo.TabletAlias{Cell: cell, Uid: uint32(100 + i)}}
+		if err := agent.RPCWrapLockAction(ctx, actionnode.TabletActionSlaveWasRestarted, swrd, nil, false, func() error {
+			return agent.SlaveWasRestarted(ctx, swrd)
+		}); err != nil {
+			t.Fatalf("SlaveWasRestarted failed: %v", err)
+		}
+	}
+	if got := slaveWasRestartedCoalesced.Get() - coalescedBefore; got != 2 {
+		t.Errorf("unexpected coalesced count: %v", got)
+	}
+	ti, err := agent.TopoServer.GetTablet(tabletAlias)
+	if err != nil {
+		t.Fatalf("GetTablet failed: %v", err)
+	}
+	if ti.Type != topo.TYPE_MASTER {
+		t.Errorf("tablet type changed before the end of the window: %v", ti.Type)
+	}
+
+	// at the end of the window, the last call is applied once
+	timeout := time.Now().Add(5 * time.Second)
+	for {
+		ti, err = agent.TopoServer.GetTablet(tabletAlias)
+		if err != nil {
+			t.Fatalf("GetTablet failed: %v", err)
+		}
+		if ti.Type == topo.TYPE_SPARE {
+			break
+		}
+		if time.Now().After(timeout) {
+			t.Fatalf("coalesced SlaveWasRestarted was never applied")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	records := agent.GetActionHistory(ctx)
+	if len(records) == 0 || records[0].From != "coalesced" || records[0].Error != "" || records[0].Args != "&{Parent:cell1-0000000102}" {
+		t.Errorf("unexpected action history: %v", records)
+	}
+}
+
+func TestThrottleTopoWrite(t *testing.T) {
+	called := false
+	if err := throttleTopoWrite("Test", func() error {
+		called = true
+		return nil
+	}); err != nil || !called {
+		t.Errorf("throttleTopoWrite didn't run the function: %v %v", called, err)
+	}
+}
+
+func TestThrottleTopoWriteConcurrency(t *testing.T) {
+	// the semaphore is created on first use, start over with a limit
+	*topoWriteConcurrency = 2
+	topoWriteSemaphore = nil
+	topoWriteSemaphoreOnce = sync.Once{}
+	defer func() {
+		*topoWriteConcurrency = 0
+		topoWriteSemaphore = nil
+		topoWriteSemaphoreOnce = sync.Once{}
+	}()
+	countBefore, timeBefore := int64(0), int64(0)
+	if h, ok := topoWriteWaitTimings.Histograms()["TestConcurrency"]; ok {
+		countBefore, timeBefore = h.Count(), h.Total()
+	}
+
+	var running, maxRunning sync2.AtomicInt64
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			throttleTopoWrite("TestConcurrency", func() error {
+				n := running.Add(1)
+				for {
+					m := maxRunning.Get()
+					if n <= m || maxRunning.CompareAndSwap(m, n) {
+						break
+					}
+				}
+				time.Sleep(20 * time.Millisecond)
+				running.Add(-1)
+				return nil
+			})
+		}()
+	}
+	wg.Wait()
+
+	if got := maxRunning.Get(); got != 2 {
+		t.Errorf("the writes ran %v at a time, want 2", got)
+	}
+	h := topoWriteWaitTimings.Histograms()["TestConcurrency"]
+	if got := h.Count() - countBefore; got != 6 {
+		t.Errorf("recorded %v waits, want 6", got)
+	}
+	// 6 writes of 20ms, 2 at a time: the last two waited 40ms each,
+	// the two before them 20ms each
+	if got := time.Duration(h.Total() - timeBefore); got < 120*time.Millisecond {
+		t.Errorf("the writes waited %v in total, want at least 120ms", got)
+	}
+}
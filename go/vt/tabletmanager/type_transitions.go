@@ -0,0 +1,77 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tabletmanager
+
+// This file contains the tablet type transitions the ChangeType RPC
+// accepts. The other transitions change the replication graph or the
+// shard record, and have to go through the wrangler actions that take
+// the shard lock and fix up the shard record.
+
+import (
+	"fmt"
+	"time"
+
+	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/vt/key"
+	"github.com/youtube/vitess/go/vt/topo"
+	"golang.org/x/net/context"
+)
+
+// IllegalTypeTransitionError is returned by ChangeType when the
+// transition is not allowed.
+type IllegalTypeTransitionError struct {
+	From   topo.TabletType
+	To     topo.TabletType
+	Reason string
+}
+
+// Error is part of the error interface
+func (e *IllegalTypeTransitionError) Error() string {
+	return fmt.Sprintf("illegal tablet type transition %v -> %v: %v", e.From, e.To, e.Reason)
+}
+
+// checkTypeTransition returns an IllegalTypeTransitionError if the
+// ChangeType RPC cannot change a tablet from one type to the other.
+func checkTypeTransition(from, to topo.TabletType) error {
+	if from == to || topo.IsTrivialTypeChange(from, to) {
+		return nil
+	}
+
+	var reason string
+	switch {
+	case from == topo.TYPE_MASTER:
+		reason = "the master can only be demoted by a reparent (PlannedReparentShard or EmergencyReparentShard)"
+	case to == topo.TYPE_MASTER:
+		reason = "a tablet can only become master by a reparent (PlannedReparentShard, EmergencyReparentShard or TabletExternallyReparented)"
+	case to == topo.TYPE_SCRAP:
+		reason = "use ScrapTablet to scrap a tablet"
+	case from == topo.TYPE_SCRAP || from == topo.TYPE_IDLE:
+		reason = "the tablet is not in the replication graph, use InitTablet or a reparent to add it back"
+	default:
+		reason = "the transition changes the replication graph"
+	}
+	return &IllegalTypeTransitionError{From: from, To: to, Reason: reason}
+}
+
+// forceChangeType changes the tablet type without any validation, and
+// tags the tablet record with the override so it can be audited.
+func (agent *ActionAgent) forceChangeType(ctx context.Context, transitionErr error, tabletType topo.TabletType) error {
+	log.Errorf("FORCING tablet type change on %v, the shard record may have to be fixed manually: %v", agent.TabletAlias, transitionErr)
+	return agent.TopoServer.UpdateTabletFields(agent.TabletAlias, func(tablet *topo.Tablet) error {
+		if tablet.Tags == nil {
+			tablet.Tags = make(map[string]string)
+		}
+		tablet.Tags[topo.TypeChangeOverride] = fmt.Sprintf("%v -> %v at %v", tablet.Type, tabletType, time.Now().Format(time.RFC3339))
+		tablet.Type = tabletType
+		// an idle tablet is not part of any shard, see topotools.ChangeType
+		if tabletType == topo.TYPE_IDLE {
+			tablet.Keyspace = ""
+			tablet.Shard = ""
+			tablet.KeyRange = key.KeyRange{}
+			tablet.Health = nil
+		}
+		return nil
+	})
+}
@@ -0,0 +1,95 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tabletmanager
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/youtube/vitess/go/vt/topo"
+	"golang.org/x/net/context"
+)
+
+func TestCheckTypeTransition(t *testing.T) {
+	table := []struct {
+		from, to topo.TabletType
+		legal    bool
+	}{
+		{topo.TYPE_SPARE, topo.TYPE_REPLICA, true},
+		{topo.TYPE_REPLICA, topo.TYPE_RDONLY, true},
+		{topo.TYPE_RDONLY, topo.TYPE_WORKER, true},
+		{topo.TYPE_RESTORE, topo.TYPE_SPARE, true},
+		{topo.TYPE_SCRAP, topo.TYPE_IDLE, true},
+		{topo.TYPE_MASTER, topo.TYPE_RDONLY, false},
+		{topo.TYPE_REPLICA, topo.TYPE_MASTER, false},
+		{topo.TYPE_REPLICA, topo.TYPE_SCRAP, false},
+		{topo.TYPE_IDLE, topo.TYPE_REPLICA, false},
+		{topo.TYPE_REPLICA, topo.TYPE_IDLE, false},
+	}
+	for _, tc := range table {
+		err := checkTypeTransition(tc.from, tc.to)
+		if tc.legal && err != nil {
+			t.Errorf("checkTypeTransition(%v, %v) failed: %v", tc.from, tc.to, err)
+		}
+		if !tc.legal {
+			if _, ok := err.(*IllegalTypeTransitionError); !ok {
+				t.Errorf("checkTypeTransition(%v, %v) should have returned an IllegalTypeTransitionError, got: %v", tc.from, tc.to, err)
+			}
+		}
+	}
+}
+
+func TestChangeTypeTransitions(t *testing.T) {
+	agent := createTestAgent(t)
+	ctx := context.Background()
+	if err := agent.TopoServer.UpdateTabletFields(tabletAlias, func(tablet *topo.Tablet) error {
+		tablet.Type = topo.TYPE_MASTER
+		return nil
+	}); err != nil {
+		t.Fatalf("UpdateTabletFields failed: %v", err)
+	}
+
+	// going from master to rdonly is refused
+	err := agent.ChangeType(ctx, topo.TYPE_RDONLY, false)
+	if err == nil || !strings.Contains(err.Error(), "illegal tablet type transition master -> rdonly") {
+		t.Fatalf("ChangeType should have refused the transition: %v", err)
+	}
+	ti, err := agent.TopoServer.GetTablet(tabletAlias)
+	if err != nil {
+		t.Fatalf("GetTablet failed: %v", err)
+	}
+	if ti.Type != topo.TYPE_MASTER {
+		t.Errorf("tablet type changed to %v", ti.Type)
+	}
+
+	// unless it's forced, and then it's tagged
+	if err := agent.ChangeType(ctx, topo.TYPE_RDONLY, true); err != nil {
+		t.Fatalf("forced ChangeType failed: %v", err)
+	}
+	ti, err = agent.TopoServer.GetTablet(tabletAlias)
+	if err != nil {
+		t.Fatalf("GetTablet failed: %v", err)
+	}
+	if ti.Type != topo.TYPE_RDONLY || !strings.HasPrefix(ti.Tags[topo.TypeChangeOverride], "master -> rdonly at ") {
+		t.Errorf("unexpected tablet after forced ChangeType: %v %v", ti.Type, ti.Tags)
+	}
+
+	// legal transitions still work
+	if err := agent.ChangeType(ctx, topo.TYPE_REPLICA, false); err != nil {
+		t.Fatalf("ChangeType failed: %v", err)
+	}
+
+	// a forced idle tablet leaves its shard, like a regular idle one
+	if err := agent.ChangeType(ctx, topo.TYPE_IDLE, true); err != nil {
+		t.Fatalf("forced ChangeType to idle failed: %v", err)
+	}
+	ti, err = agent.TopoServer.GetTablet(tabletAlias)
+	if err != nil {
+		t.Fatalf("GetTablet failed: %v", err)
+	}
+	if ti.Type != topo.TYPE_IDLE || ti.Keyspace != "" || ti.Shard != "" || ti.KeyRange.IsPartial() {
+		t.Errorf("unexpected tablet after forced ChangeType to idle: %v %v/%v %v", ti.Type, ti.Keyspace, ti.Shard, ti.KeyRange)
+	}
+}
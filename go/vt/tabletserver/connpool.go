@@ -5,12 +5,14 @@
 package tabletserver
 
 import (
+	"fmt"
 	"sync"
 	"time"
 
 	"github.com/youtube/vitess/go/pools"
 	"github.com/youtube/vitess/go/sqldb"
 	"github.com/youtube/vitess/go/stats"
+	"github.com/youtube/vitess/go/sync2"
 	"github.com/youtube/vitess/go/vt/dbconnpool"
 	"golang.org/x/net/context"
 )
@@ -25,21 +27,32 @@ type ConnPool struct {
 	mu                sync.Mutex
 	connections       *pools.ResourcePool
 	capacity          int
+	maxCap            int
 	idleTimeout       time.Duration
 	dbaPool           *dbconnpool.ConnectionPool
+	dbaParams         *sqldb.ConnParams
 	queryServiceStats *QueryServiceStats
+	// rejected counts the callers turned away without asking
+	// the pool, see TxPool.Begin.
+	rejected sync2.AtomicInt64
 }
 
 // NewConnPool creates a new ConnPool. The name is used
-// to publish stats only.
+// to publish stats only. The pool can be resized up to maxCap
+// with SetCapacity.
 func NewConnPool(
 	name string,
 	capacity int,
+	maxCap int,
 	idleTimeout time.Duration,
 	enablePublishStats bool,
 	queryServiceStats *QueryServiceStats) *ConnPool {
+	if maxCap < capacity {
+		maxCap = capacity
+	}
 	cp := &ConnPool{
 		capacity:          capacity,
+		maxCap:            maxCap,
 		idleTimeout:       idleTimeout,
 		dbaPool:           dbconnpool.NewConnectionPool("", 1, idleTimeout),
 		queryServiceStats: queryServiceStats,
@@ -53,6 +66,8 @@ func NewConnPool(
 		stats.Publish(name+"MaxCap", stats.IntFunc(cp.MaxCap))
 		stats.Publish(name+"WaitCount", stats.IntFunc(cp.WaitCount))
 		stats.Publish(name+"WaitTime", stats.DurationFunc(cp.WaitTime))
+		stats.Publish(name+"InUse", stats.IntFunc(cp.InUse))
+		stats.Publish(name+"Exhausted", stats.IntFunc(cp.Exhausted))
 		stats.Publish(name+"IdleTimeout", stats.DurationFunc(cp.IdleTimeout))
 	}
 	return cp
@@ -73,7 +88,8 @@ func (cp *ConnPool) Open(appParams, dbaParams *sqldb.ConnParams) {
 	f := func() (pools.Resource, error) {
 		return NewDBConn(cp, appParams, dbaParams, cp.queryServiceStats)
 	}
-	cp.connections = pools.NewResourcePool(f, cp.capacity, cp.capacity, cp.idleTimeout)
+	cp.connections = pools.NewResourcePool(f, cp.capacity, cp.maxCap, cp.idleTimeout)
+	cp.dbaParams = dbaParams
 	cp.dbaPool.Open(dbconnpool.DBConnectionCreator(dbaParams, cp.queryServiceStats.MySQLStats))
 }
 
@@ -121,6 +137,13 @@ func (cp *ConnPool) TryGet() (*DBConn, error) {
 	return r.(*DBConn), nil
 }
 
+// dbaConnParams returns the params of the dba connections.
+func (cp *ConnPool) dbaConnParams() *sqldb.ConnParams {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	return cp.dbaParams
+}
+
 // Put puts a connection into the pool.
 func (cp *ConnPool) Put(conn *DBConn) {
 	p := cp.pool()
@@ -134,17 +157,24 @@ func (cp *ConnPool) Put(conn *DBConn) {
 	}
 }
 
-// SetCapacity alters the size of the pool at runtime.
-func (cp *ConnPool) SetCapacity(capacity int) (err error) {
-	cp.mu.Lock()
-	defer cp.mu.Unlock()
-	if cp.connections != nil {
-		err = cp.connections.SetCapacity(capacity)
-		if err != nil {
+// SetCapacity alters the size of the pool at runtime, up to the max
+// capacity. The new connections are created when they are needed.
+// When shrinking, the idle connections are closed, and SetCapacity
+// waits for enough of the connections in use to be returned.
+func (cp *ConnPool) SetCapacity(capacity int) error {
+	if capacity <= 0 || capacity > cp.maxCap {
+		return fmt.Errorf("capacity %d is out of range [1, %d]", capacity, cp.maxCap)
+	}
+	// We should not hold the lock while shrinking the pool,
+	// because Put needs it to return the connections.
+	if p := cp.pool(); p != nil {
+		if err := p.SetCapacity(capacity); err != nil {
 			return err
 		}
 	}
+	cp.mu.Lock()
 	cp.capacity = capacity
+	cp.mu.Unlock()
 	return nil
 }
 
@@ -213,6 +243,25 @@ func (cp *ConnPool) WaitTime() time.Duration {
 	return p.WaitTime()
 }
 
+// InUse returns the number of connections in use.
+func (cp *ConnPool) InUse() int64 {
+	p := cp.pool()
+	if p == nil {
+		return 0
+	}
+	return p.InUse()
+}
+
+// Exhausted returns how many times no connection could be obtained
+// because they were all in use.
+func (cp *ConnPool) Exhausted() int64 {
+	p := cp.pool()
+	if p == nil {
+		return cp.rejected.Get()
+	}
+	return cp.rejected.Get() + p.Exhausted()
+}
+
 // IdleTimeout returns the idle timeout for the pool.
 func (cp *ConnPool) IdleTimeout() time.Duration {
 	p := cp.pool()
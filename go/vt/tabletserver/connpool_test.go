@@ -5,9 +5,11 @@
 package tabletserver
 
 import (
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/youtube/vitess/go/pools"
 	"github.com/youtube/vitess/go/sqldb"
 	"github.com/youtube/vitess/go/vt/vttest/fakesqldb"
 	"golang.org/x/net/context"
@@ -107,6 +109,114 @@ func TestConnPoolSetCapacity(t *testing.T) {
 	}
 }
 
+func TestConnPoolSetCapacityOverMaxCap(t *testing.T) {
+	fakesqldb.Register()
+	connPool := NewConnPool("", 5, 20, 10*time.Second, false, NewQueryServiceStats("", false))
+	if err := connPool.SetCapacity(21); err == nil {
+		t.Fatalf("set capacity over the max capacity should fail")
+	}
+	// the capacity of a closed pool is used when it opens
+	if err := connPool.SetCapacity(20); err != nil {
+		t.Fatalf("set capacity failed: %v", err)
+	}
+	connPool.Open(&sqldb.ConnParams{}, &sqldb.ConnParams{})
+	defer connPool.Close()
+	if connPool.Capacity() != 20 || connPool.MaxCap() != 20 {
+		t.Fatalf("capacity and max capacity should be 20, got %d and %d", connPool.Capacity(), connPool.MaxCap())
+	}
+}
+
+func TestConnPoolInUseAndExhausted(t *testing.T) {
+	fakesqldb.Register()
+	connPool := NewConnPool("", 1, 1, 10*time.Second, false, NewQueryServiceStats("", false))
+	connPool.Open(&sqldb.ConnParams{}, &sqldb.ConnParams{})
+	defer connPool.Close()
+	dbConn, err := connPool.Get(context.Background())
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if dbConn, _ := connPool.TryGet(); dbConn != nil {
+		t.Fatalf("TryGet should return nil when all the connections are in use")
+	}
+	if connPool.InUse() != 1 || connPool.Exhausted() != 1 {
+		t.Fatalf("in use and exhausted should be 1, got %d and %d", connPool.InUse(), connPool.Exhausted())
+	}
+	dbConn.Recycle()
+	if connPool.InUse() != 0 {
+		t.Fatalf("in use should be 0, got %d", connPool.InUse())
+	}
+}
+
+func TestConnPoolResizeWhileInUse(t *testing.T) {
+	fakesqldb.Register()
+	connPool := NewConnPool("", 5, 20, 10*time.Second, false, NewQueryServiceStats("", false))
+	connPool.Open(&sqldb.ConnParams{}, &sqldb.ConnParams{})
+
+	var mu sync.Mutex
+	dbConns := make(map[*DBConn]bool)
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+				dbConn, err := connPool.Get(ctx)
+				cancel()
+				if err == pools.ErrTimeout {
+					continue
+				}
+				if err != nil {
+					t.Errorf("Get failed: %v", err)
+					return
+				}
+				mu.Lock()
+				dbConns[dbConn] = true
+				mu.Unlock()
+				time.Sleep(time.Millisecond)
+				dbConn.Recycle()
+			}
+		}()
+	}
+
+	resized := make(chan struct{})
+	go func() {
+		defer close(resized)
+		for _, capacity := range []int{20, 1, 15, 3, 20, 5} {
+			if err := connPool.SetCapacity(capacity); err != nil {
+				t.Errorf("SetCapacity(%d) failed: %v", capacity, err)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}()
+	select {
+	case <-resized:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("resizing the pool while it is in use timed out")
+	}
+	close(done)
+	wg.Wait()
+
+	if connPool.InUse() != 0 {
+		t.Errorf("all the connections were recycled, in use: %d", connPool.InUse())
+	}
+	if connPool.Capacity() != 5 || connPool.Available() != 5 {
+		t.Errorf("capacity and available should be 5, got %d and %d", connPool.Capacity(), connPool.Available())
+	}
+	connPool.Close()
+	for dbConn := range dbConns {
+		if !dbConn.IsClosed() {
+			t.Errorf("connection %d was not closed", dbConn.ID())
+		}
+	}
+}
+
 func TestConnPoolStatJSON(t *testing.T) {
 	fakesqldb.Register()
 	testUtils := newTestUtils()
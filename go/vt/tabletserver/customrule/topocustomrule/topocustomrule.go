@@ -0,0 +1,249 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package topocustomrule implements the custom rules stored in the
+// topology, for the keyspace of a tablet and for the tablet itself.
+// They are watched, and applied to the running query service when
+// they change, without a restart. The rules of vtctl SetQueryRule
+// expire after their TTL.
+package topocustomrule
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/vt/tabletserver"
+	"github.com/youtube/vitess/go/vt/topo"
+	"golang.org/x/net/context"
+)
+
+var topoRules = flag.Bool("topocustomrules", false, "if set, the custom rules of the tablet keyspace and of the tablet are watched in the topology, see vtctl SetQueryRule")
+
+// TopoCustomRuleSource is the name of the topo based custom rule source
+const TopoCustomRuleSource string = "TOPO_CUSTOM_RULE"
+
+// TopoCustomRule watches the rules of a keyspace and of a tablet. The
+// two sets are merged by rule name: a tablet rule replaces the keyspace
+// rule with the same name, so a tablet can be given an exception. The
+// expired rules are dropped, and the others are evaluated in the order
+// of their names. This source is registered after the other ones, see
+// tabletserver.QueryRuleInfo for how the sources are combined.
+type TopoCustomRule struct {
+	ts          topo.QueryRuler
+	keyspace    string
+	tabletAlias topo.TabletAlias
+
+	// mu protects the fields below
+	mu             sync.Mutex
+	keyspaceRules  *topo.QueryRules
+	tabletRules    *topo.QueryRules
+	currentRuleSet *tabletserver.QueryRules
+
+	done     chan struct{}
+	finished chan struct{}
+}
+
+// NewTopoCustomRule returns the rule source of keyspace and tabletAlias.
+func NewTopoCustomRule(ts topo.QueryRuler, keyspace string, tabletAlias topo.TabletAlias) *TopoCustomRule {
+	return &TopoCustomRule{
+		ts:             ts,
+		keyspace:       keyspace,
+		tabletAlias:    tabletAlias,
+		currentRuleSet: tabletserver.NewQueryRules(),
+	}
+}
+
+// Open applies the current rules, and starts watching them.
+func (tcr *TopoCustomRule) Open(qsc tabletserver.QueryServiceControl) error {
+	keyspaceNotifications, stopKeyspace, err := tcr.ts.WatchKeyspaceQueryRules(tcr.keyspace)
+	if err != nil {
+		return fmt.Errorf("cannot watch the query rules of keyspace %v: %v", tcr.keyspace, err)
+	}
+	tabletNotifications, stopTablet, err := tcr.ts.WatchTabletQueryRules(tcr.tabletAlias)
+	if err != nil {
+		close(stopKeyspace)
+		return fmt.Errorf("cannot watch the query rules of tablet %v: %v", tcr.tabletAlias, err)
+	}
+
+	// the watches start with the current values
+	tcr.mu.Lock()
+	tcr.keyspaceRules = <-keyspaceNotifications
+	tcr.tabletRules = <-tabletNotifications
+	tcr.mu.Unlock()
+	nextExpiration := tcr.apply(qsc)
+
+	tcr.done = make(chan struct{})
+	tcr.finished = make(chan struct{})
+	go func() {
+		defer close(tcr.finished)
+		defer close(stopKeyspace)
+		defer close(stopTablet)
+		var timer *time.Timer
+		defer func() {
+			if timer != nil {
+				timer.Stop()
+			}
+		}()
+		for {
+			// the rules are applied again when the next one expires
+			var expired <-chan time.Time
+			if timer != nil {
+				timer.Stop()
+				timer = nil
+			}
+			if !nextExpiration.IsZero() {
+				timer = time.NewTimer(nextExpiration.Sub(time.Now()))
+				expired = timer.C
+			}
+			select {
+			case qrs, ok := <-keyspaceNotifications:
+				if !ok {
+					return
+				}
+				tcr.mu.Lock()
+				tcr.keyspaceRules = qrs
+				tcr.mu.Unlock()
+			case qrs, ok := <-tabletNotifications:
+				if !ok {
+					return
+				}
+				tcr.mu.Lock()
+				tcr.tabletRules = qrs
+				tcr.mu.Unlock()
+			case <-expired:
+			case <-tcr.done:
+				return
+			}
+			nextExpiration = tcr.apply(qsc)
+		}
+	}()
+	return nil
+}
+
+// apply merges the rules and sets them if they changed. If a rule is
+// invalid, the previous rules stay. It returns the time at which the
+// next rule expires, the zero time if none does.
+func (tcr *TopoCustomRule) apply(qsc tabletserver.QueryServiceControl) time.Time {
+	tcr.mu.Lock()
+	defer tcr.mu.Unlock()
+	qrs, nextExpiration, err := BuildQueryRules(time.Now(), tcr.keyspaceRules, tcr.tabletRules)
+	if err != nil {
+		log.Warningf("Invalid query rules for keyspace %v and tablet %v, keeping the previous ones: %v", tcr.keyspace, tcr.tabletAlias, err)
+		return nextExpiration
+	}
+	if !reflect.DeepEqual(tcr.currentRuleSet, qrs) {
+		tcr.currentRuleSet = qrs.Copy()
+		qsc.SetQueryRules(TopoCustomRuleSource, qrs.Copy())
+		log.Infof("Custom rules of keyspace %v and tablet %v fetched from the topology and applied to vttablet", tcr.keyspace, tcr.tabletAlias)
+	}
+	return nextExpiration
+}
+
+// Close stops watching the rules. The rules stay applied.
+func (tcr *TopoCustomRule) Close() {
+	if tcr.done == nil {
+		return
+	}
+	close(tcr.done)
+	<-tcr.finished
+	tcr.done = nil
+}
+
+// GetRules returns the rules that are applied.
+func (tcr *TopoCustomRule) GetRules() *tabletserver.QueryRules {
+	tcr.mu.Lock()
+	defer tcr.mu.Unlock()
+	return tcr.currentRuleSet.Copy()
+}
+
+// BuildQueryRules merges the sets of rules at now: the expired rules
+// are dropped, and the rules of a set replace the ones with the same
+// name of the previous sets. nil sets are skipped. The rules are
+// returned in the order of their names, with the time at which the
+// next one expires, the zero time if none does.
+func BuildQueryRules(now time.Time, sets ...*topo.QueryRules) (*tabletserver.QueryRules, time.Time, error) {
+	merged := make(map[string]*topo.QueryRule)
+	for _, set := range sets {
+		if set == nil {
+			continue
+		}
+		for name, qr := range set.Rules {
+			// an expired rule doesn't hide the previous ones
+			if !qr.Expired(now) {
+				merged[name] = qr
+			}
+		}
+	}
+	names := make([]string, 0, len(merged))
+	for name := range merged {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	qrs := tabletserver.NewQueryRules()
+	var nextExpiration time.Time
+	for _, name := range names {
+		qr := merged[name]
+		if qr.Expiration != 0 {
+			if expiration := time.Unix(qr.Expiration, 0); nextExpiration.IsZero() || expiration.Before(nextExpiration) {
+				nextExpiration = expiration
+			}
+		}
+		rule, err := ParseQueryRule(qr.Rule)
+		if err != nil {
+			return nil, nextExpiration, fmt.Errorf("rule %v: %v", name, err)
+		}
+		if rule.Name != name {
+			return nil, nextExpiration, fmt.Errorf("rule %v is named %v", name, rule.Name)
+		}
+		qrs.Add(rule)
+	}
+	return qrs, nextExpiration, nil
+}
+
+// ParseQueryRule parses a rule in the JSON format of the custom rules.
+// The rule needs a name.
+func ParseQueryRule(data string) (*tabletserver.QueryRule, error) {
+	var ruleInfo map[string]interface{}
+	if err := json.Unmarshal([]byte(data), &ruleInfo); err != nil {
+		return nil, err
+	}
+	qr, err := tabletserver.BuildQueryRule(ruleInfo)
+	if err != nil {
+		return nil, err
+	}
+	if qr.Name == "" {
+		return nil, fmt.Errorf("the rule has no name")
+	}
+	return qr, nil
+}
+
+// ActivateTopoCustomRules registers the rule source and opens it for the
+// tablet, if -topocustomrules is set. It returns nil otherwise.
+func ActivateTopoCustomRules(ctx context.Context, qsc tabletserver.QueryServiceControl, ts topo.Server, tabletAlias topo.TabletAlias) (*TopoCustomRule, error) {
+	if !*topoRules {
+		return nil, nil
+	}
+	queryRuler, ok := ts.(topo.QueryRuler)
+	if !ok {
+		return nil, fmt.Errorf("%T doesn't support the query rules, see -topocustomrules", ts)
+	}
+	tablet, err := topo.GetTablet(ctx, ts, tabletAlias)
+	if err != nil {
+		return nil, err
+	}
+	tabletserver.QueryRuleSources.RegisterQueryRuleSource(TopoCustomRuleSource)
+	tcr := NewTopoCustomRule(queryRuler, tablet.Keyspace, tabletAlias)
+	if err := tcr.Open(qsc); err != nil {
+		tabletserver.QueryRuleSources.UnRegisterQueryRuleSource(TopoCustomRuleSource)
+		return nil, err
+	}
+	return tcr, nil
+}
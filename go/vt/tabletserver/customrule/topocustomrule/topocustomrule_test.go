@@ -0,0 +1,154 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package topocustomrule
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/youtube/vitess/go/vt/tabletserver"
+	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/vt/zktopo"
+)
+
+func ruleNames(qrs *tabletserver.QueryRules) string {
+	var names []string
+	for _, name := range []string{"r1", "r2", "r3"} {
+		if qr := qrs.Find(name); qr != nil {
+			names = append(names, name+":"+qr.Description)
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+func TestBuildQueryRules(t *testing.T) {
+	now := time.Unix(1000, 0)
+	keyspaceRules := &topo.QueryRules{Rules: map[string]*topo.QueryRule{
+		"r2": {Rule: `{"Name": "r2", "Description": "keyspace"}`},
+		"r1": {Rule: `{"Name": "r1", "Description": "keyspace"}`, Expiration: 1200},
+		"r3": {Rule: `{"Name": "r3", "Description": "expired"}`, Expiration: 1000},
+	}}
+	tabletRules := &topo.QueryRules{Rules: map[string]*topo.QueryRule{
+		"r2": {Rule: `{"Name": "r2", "Description": "tablet", "Action": "FAIL_RETRY"}`, Expiration: 1100},
+	}}
+
+	qrs, nextExpiration, err := BuildQueryRules(now, keyspaceRules, nil, tabletRules)
+	if err != nil {
+		t.Fatalf("BuildQueryRules: %v", err)
+	}
+	if got, want := ruleNames(qrs), "r1:keyspace,r2:tablet"; got != want {
+		t.Errorf("BuildQueryRules: %v, want %v", got, want)
+	}
+	if want := time.Unix(1100, 0); nextExpiration != want {
+		t.Errorf("nextExpiration: %v, want %v", nextExpiration, want)
+	}
+
+	// the rules are in the order of their names
+	qrs, _, _ = BuildQueryRules(now, keyspaceRules)
+	want := tabletserver.NewQueryRules()
+	want.Add(tabletserver.NewQueryRule("keyspace", "r1", tabletserver.QR_FAIL))
+	want.Add(tabletserver.NewQueryRule("keyspace", "r2", tabletserver.QR_FAIL))
+	if !reflect.DeepEqual(qrs, want) {
+		t.Errorf("BuildQueryRules: %v, want %v", qrs, want)
+	}
+
+	// after the tablet rule expires, the keyspace one applies again
+	qrs, nextExpiration, _ = BuildQueryRules(time.Unix(1100, 0), keyspaceRules, tabletRules)
+	if got, want := ruleNames(qrs), "r1:keyspace,r2:keyspace"; got != want {
+		t.Errorf("BuildQueryRules: %v, want %v", got, want)
+	}
+	if want := time.Unix(1200, 0); nextExpiration != want {
+		t.Errorf("nextExpiration: %v, want %v", nextExpiration, want)
+	}
+
+	for _, c := range []struct {
+		rule, err string
+	}{
+		{`{"Name": "r1", "Action": "UNKNOWN"}`, "invalid Action UNKNOWN"},
+		{`{"Description": "no name"}`, "rule r1: the rule has no name"},
+		{`{"Name": "r2"}`, "rule r1 is named r2"},
+		{`not json`, "invalid character"},
+	} {
+		_, _, err := BuildQueryRules(now, &topo.QueryRules{Rules: map[string]*topo.QueryRule{"r1": {Rule: c.rule}}})
+		if err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Errorf("BuildQueryRules(%v): %v, want %v", c.rule, err, c.err)
+		}
+	}
+}
+
+// waitForRules waits until the rules of tcr are want.
+func waitForRules(t *testing.T, tcr *TopoCustomRule, want string) {
+	timeout := time.After(5 * time.Second)
+	for {
+		got := ruleNames(tcr.GetRules())
+		if got == want {
+			return
+		}
+		select {
+		case <-timeout:
+			t.Fatalf("timed out waiting for the rules %v, got %v", want, got)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+func TestTopoCustomRule(t *testing.T) {
+	ts := zktopo.NewTestServer(t, []string{"test"})
+	defer ts.Close()
+	tabletAlias := topo.TabletAlias{Cell: "test", Uid: 1}
+	if err := ts.CreateKeyspace("test_keyspace", &topo.Keyspace{}); err != nil {
+		t.Fatalf("CreateKeyspace: %v", err)
+	}
+	if err := ts.CreateTablet(&topo.Tablet{Alias: tabletAlias, Keyspace: "test_keyspace", Shard: "0", Type: topo.TYPE_REPLICA}); err != nil {
+		t.Fatalf("CreateTablet: %v", err)
+	}
+	if err := ts.SaveKeyspaceQueryRules("test_keyspace", &topo.QueryRules{Rules: map[string]*topo.QueryRule{
+		"r1": {Rule: `{"Name": "r1", "Description": "keyspace"}`},
+	}}); err != nil {
+		t.Fatalf("SaveKeyspaceQueryRules: %v", err)
+	}
+
+	tcr := NewTopoCustomRule(ts, "test_keyspace", tabletAlias)
+	if err := tcr.Open(tabletserver.NewTestQueryServiceControl()); err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer tcr.Close()
+	// Open applies the current rules before returning
+	if got, want := ruleNames(tcr.GetRules()), "r1:keyspace"; got != want {
+		t.Errorf("GetRules after Open: %v, want %v", got, want)
+	}
+
+	// a tablet rule overrides the keyspace one until it expires
+	if err := ts.SaveTabletQueryRules(tabletAlias, &topo.QueryRules{Rules: map[string]*topo.QueryRule{
+		"r1": {Rule: `{"Name": "r1", "Description": "tablet"}`, Expiration: time.Now().Unix() + 1},
+		"r2": {Rule: `{"Name": "r2", "Description": "tablet"}`},
+	}}); err != nil {
+		t.Fatalf("SaveTabletQueryRules: %v", err)
+	}
+	waitForRules(t, tcr, "r1:tablet,r2:tablet")
+	waitForRules(t, tcr, "r1:keyspace,r2:tablet")
+
+	// an invalid rule keeps the previous rules
+	if err := ts.SaveKeyspaceQueryRules("test_keyspace", &topo.QueryRules{Rules: map[string]*topo.QueryRule{
+		"r3": {Rule: `{"Name": "r3", "Action": "UNKNOWN"}`},
+	}}); err != nil {
+		t.Fatalf("SaveKeyspaceQueryRules: %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if got, want := ruleNames(tcr.GetRules()), "r1:keyspace,r2:tablet"; got != want {
+		t.Errorf("GetRules after an invalid rule: %v, want %v", got, want)
+	}
+
+	// clearing the rules
+	if err := ts.SaveKeyspaceQueryRules("test_keyspace", &topo.QueryRules{}); err != nil {
+		t.Fatalf("SaveKeyspaceQueryRules: %v", err)
+	}
+	if err := ts.SaveTabletQueryRules(tabletAlias, &topo.QueryRules{}); err != nil {
+		t.Fatalf("SaveTabletQueryRules: %v", err)
+	}
+	waitForRules(t, tcr, "")
+}
@@ -127,15 +127,32 @@ func (dbc *DBConn) Recycle() {
 // Kill kills the currently executing query both on MySQL side
 // and on the connection side. If no query is executing, it's a no-op.
 // Kill will also not kill a query more than once.
+// Kill uses a dba connection, so it works when the app connections are
+// all used. If the pooled dba connection is busy with another kill, it
+// opens its own one instead of waiting for it.
 func (dbc *DBConn) Kill() error {
 	dbc.queryServiceStats.KillStats.Add("Queries", 1)
 	log.Infof("killing query %s", dbc.Current())
-	killConn, err := dbc.pool.dbaPool.Get(0)
+	var killConn interface {
+		ExecuteFetch(query string, maxrows int, wantfields bool) (*mproto.QueryResult, error)
+	}
+	pooledConn, err := dbc.pool.dbaPool.TryGet()
 	if err != nil {
 		log.Warningf("Failed to get conn from dba pool: %v", err)
 		return NewTabletError(ErrFail, "Failed to get conn from dba pool: %v", err)
 	}
-	defer killConn.Recycle()
+	if pooledConn != nil {
+		defer pooledConn.Recycle()
+		killConn = pooledConn
+	} else {
+		conn, err := dbconnpool.NewDBConnection(dbc.pool.dbaConnParams(), dbc.queryServiceStats.MySQLStats)
+		if err != nil {
+			log.Warningf("Failed to open a dba conn: %v", err)
+			return NewTabletError(ErrFail, "Failed to open a dba conn: %v", err)
+		}
+		defer conn.Close()
+		killConn = conn
+	}
 	sql := fmt.Sprintf("kill %d", dbc.conn.ID())
 	_, err = killConn.ExecuteFetch(sql, 10000, false)
 	if err != nil {
@@ -90,6 +90,33 @@ func TestDBConnKill(t *testing.T) {
 
 }
 
+func TestDBConnKillWithBusyDbaPool(t *testing.T) {
+	db := fakesqldb.Register()
+	testUtils := newTestUtils()
+	connPool := testUtils.newConnPool()
+	appParams := &sqldb.ConnParams{}
+	dbaParams := &sqldb.ConnParams{}
+	connPool.Open(appParams, dbaParams)
+	defer connPool.Close()
+	queryServiceStats := NewQueryServiceStats("", false)
+	dbConn, err := NewDBConn(connPool, appParams, dbaParams, queryServiceStats)
+	if err != nil {
+		t.Fatalf("NewDBConn failed: %v", err)
+	}
+	defer dbConn.Close()
+	db.AddQuery(fmt.Sprintf("kill %d", dbConn.ID()), &mproto.QueryResult{})
+
+	// another kill holds the pooled dba connection
+	busyConn, err := connPool.dbaPool.Get(0)
+	if err != nil {
+		t.Fatalf("dbaPool.Get failed: %v", err)
+	}
+	defer busyConn.Recycle()
+	if err := dbConn.Kill(); err != nil {
+		t.Fatalf("kill should succeed with its own dba conn, but got error: %v", err)
+	}
+}
+
 func TestDBConnStream(t *testing.T) {
 	db := fakesqldb.Register()
 	testUtils := newTestUtils()
@@ -46,12 +46,22 @@ func (sq *SqlQuery) Rollback(ctx context.Context, session *proto.Session, noOutp
 // Execute is exposing tabletserver.SqlQuery.Execute
 func (sq *SqlQuery) Execute(ctx context.Context, query *proto.Query, reply *mproto.QueryResult) (err error) {
 	defer sq.server.HandlePanic(&err)
+	if query.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, query.Timeout)
+		defer cancel()
+	}
 	return sq.server.Execute(callinfo.RPCWrapCallInfo(ctx), query, reply)
 }
 
 // StreamExecute is exposing tabletserver.SqlQuery.StreamExecute
 func (sq *SqlQuery) StreamExecute(ctx context.Context, query *proto.Query, sendReply func(reply interface{}) error) (err error) {
 	defer sq.server.HandlePanic(&err)
+	if query.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, query.Timeout)
+		defer cancel()
+	}
 	return sq.server.StreamExecute(callinfo.RPCWrapCallInfo(ctx), query, func(reply *mproto.QueryResult) error {
 		return sendReply(reply)
 	})
@@ -60,6 +70,11 @@ func (sq *SqlQuery) StreamExecute(ctx context.Context, query *proto.Query, sendR
 // ExecuteBatch is exposing tabletserver.SqlQuery.ExecuteBatch
 func (sq *SqlQuery) ExecuteBatch(ctx context.Context, queryList *proto.QueryList, reply *proto.QueryResultList) (err error) {
 	defer sq.server.HandlePanic(&err)
+	if queryList.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, queryList.Timeout)
+		defer cancel()
+	}
 	return sq.server.ExecuteBatch(callinfo.RPCWrapCallInfo(ctx), queryList, reply)
 }
 
@@ -15,11 +15,13 @@ import (
 	mproto "github.com/youtube/vitess/go/mysql/proto"
 	"github.com/youtube/vitess/go/netutil"
 	"github.com/youtube/vitess/go/rpcplus"
+	"github.com/youtube/vitess/go/rpcwrap"
 	"github.com/youtube/vitess/go/rpcwrap/bsonrpc"
 	"github.com/youtube/vitess/go/vt/rpc"
 	tproto "github.com/youtube/vitess/go/vt/tabletserver/proto"
 	"github.com/youtube/vitess/go/vt/tabletserver/tabletconn"
 	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/vt/vterrors"
 	"golang.org/x/net/context"
 )
 
@@ -31,6 +33,7 @@ var (
 
 func init() {
 	tabletconn.RegisterDialer("gorpc", DialTablet)
+	tabletconn.RegisterDialer("gorpcs", DialTabletSecure)
 }
 
 // TabletBson implements a bson rpcplus implementation for TabletConn
@@ -41,16 +44,35 @@ type TabletBson struct {
 	sessionID int64
 }
 
-// DialTablet creates and initializes TabletBson.
+// DialTablet creates and initializes TabletBson. It uses the vts
+// port over TLS if -tablet-bson-encrypted is set, the vt port otherwise.
 func DialTablet(ctx context.Context, endPoint topo.EndPoint, keyspace, shard string, timeout time.Duration) (tabletconn.TabletConn, error) {
+	return dialTablet(ctx, endPoint, keyspace, shard, timeout, *tabletBsonEncrypted)
+}
+
+// DialTabletSecure creates and initializes TabletBson, always using
+// the vts port over TLS. It is registered as the "gorpcs" tablet
+// protocol, so vtgate can be pointed at the TLS endpoints with
+// -tablet_protocol=gorpcs.
+func DialTabletSecure(ctx context.Context, endPoint topo.EndPoint, keyspace, shard string, timeout time.Duration) (tabletconn.TabletConn, error) {
+	return dialTablet(ctx, endPoint, keyspace, shard, timeout, true)
+}
+
+func dialTablet(ctx context.Context, endPoint topo.EndPoint, keyspace, shard string, timeout time.Duration, encrypted bool) (tabletconn.TabletConn, error) {
 	var addr string
 	var config *tls.Config
-	if *tabletBsonEncrypted {
-		addr = netutil.JoinHostPort(endPoint.Host, endPoint.NamedPortMap["vts"])
-		config = &tls.Config{}
-		config.InsecureSkipVerify = true
+	if encrypted {
+		port, ok := endPoint.NamedPortMap[topo.SecurePortName]
+		if !ok {
+			return nil, tabletconn.OperationalError(fmt.Sprintf("vttablet: endpoint %v (uid %v) has no %v port", endPoint.Host, endPoint.Uid, topo.SecurePortName))
+		}
+		addr = netutil.JoinHostPort(endPoint.Host, port)
+		var err error
+		if config, err = rpcwrap.DefaultClientTLSConfig(); err != nil {
+			return nil, tabletconn.OperationalError(fmt.Sprintf("vttablet: cannot set up TLS for endpoint %v (uid %v): %v", endPoint.Host, endPoint.Uid, err))
+		}
 	} else {
-		addr = netutil.JoinHostPort(endPoint.Host, endPoint.NamedPortMap["vt"])
+		addr = netutil.JoinHostPort(endPoint.Host, endPoint.NamedPortMap[topo.DefaultPortName])
 	}
 
 	conn := &TabletBson{endPoint: endPoint}
@@ -90,6 +112,21 @@ func (conn *TabletBson) withTimeout(ctx context.Context, action func() error) er
 	return err
 }
 
+// ctxTimeout returns the time left before the deadline of ctx, so
+// vttablet kills the query when the caller gives up on it. It returns
+// 0 if ctx has no deadline.
+func ctxTimeout(ctx context.Context) time.Duration {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return 0
+	}
+	if timeout := deadline.Sub(time.Now()); timeout > 0 {
+		return timeout
+	}
+	// already expired: ask for the shortest possible timeout
+	return 1
+}
+
 // Execute sends the query to VTTablet.
 func (conn *TabletBson) Execute(ctx context.Context, query string, bindVars map[string]interface{}, transactionID int64) (*mproto.QueryResult, error) {
 	conn.mu.RLock()
@@ -103,6 +140,7 @@ func (conn *TabletBson) Execute(ctx context.Context, query string, bindVars map[
 		BindVariables: bindVars,
 		TransactionId: transactionID,
 		SessionId:     conn.sessionID,
+		Timeout:       ctxTimeout(ctx),
 	}
 	qr := new(mproto.QueryResult)
 	action := func() error {
@@ -126,6 +164,7 @@ func (conn *TabletBson) ExecuteBatch(ctx context.Context, queries []tproto.Bound
 		Queries:       queries,
 		TransactionId: transactionID,
 		SessionId:     conn.sessionID,
+		Timeout:       ctxTimeout(ctx),
 	}
 	qrs := new(tproto.QueryResultList)
 	action := func() error {
@@ -150,6 +189,7 @@ func (conn *TabletBson) StreamExecute(ctx context.Context, query string, bindVar
 		BindVariables: bindVars,
 		TransactionId: transactionID,
 		SessionId:     conn.sessionID,
+		Timeout:       ctxTimeout(ctx),
 	}
 	sr := make(chan *mproto.QueryResult, 10)
 	c := conn.rpcClient.StreamGo("SqlQuery.StreamExecute", req, sr)
@@ -158,14 +198,36 @@ func (conn *TabletBson) StreamExecute(ctx context.Context, query string, bindVar
 		return nil, nil, tabletError(c.Error)
 	}
 	srout := make(chan *mproto.QueryResult, 1)
+	var cancelErr error
 	go func() {
 		defer close(srout)
-		srout <- firstResult
-		for r := range sr {
-			srout <- r
+		r, ok := firstResult, true
+		for ok {
+			select {
+			case srout <- r:
+				select {
+				case r, ok = <-sr:
+					continue
+				case <-ctx.Done():
+				}
+			case <-ctx.Done():
+			}
+			// The caller is gone: stop forwarding, and drain the
+			// rest of the stream so the rpc client is not blocked.
+			cancelErr = ctx.Err()
+			go func() {
+				for range sr {
+				}
+			}()
+			return
 		}
 	}()
-	return srout, func() error { return tabletError(c.Error) }, nil
+	return srout, func() error {
+		if cancelErr != nil {
+			return tabletError(cancelErr)
+		}
+		return tabletError(c.Error)
+	}, nil
 }
 
 // Begin starts a transaction.
@@ -226,7 +288,7 @@ func (conn *TabletBson) Rollback(ctx context.Context, transactionID int64) error
 }
 
 // SplitQuery is the stub for SqlQuery.SplitQuery RPC
-func (conn *TabletBson) SplitQuery(ctx context.Context, query tproto.BoundQuery, splitCount int) (queries []tproto.QuerySplit, err error) {
+func (conn *TabletBson) SplitQuery(ctx context.Context, query tproto.BoundQuery, splitColumn string, splitCount int) (queries []tproto.QuerySplit, err error) {
 	conn.mu.RLock()
 	defer conn.mu.RUnlock()
 	if conn.rpcClient == nil {
@@ -234,9 +296,10 @@ func (conn *TabletBson) SplitQuery(ctx context.Context, query tproto.BoundQuery,
 		return
 	}
 	req := &tproto.SplitQueryRequest{
-		Query:      query,
-		SplitCount: splitCount,
-		SessionID:  conn.sessionID,
+		Query:       query,
+		SplitColumn: splitColumn,
+		SplitCount:  splitCount,
+		SessionID:   conn.sessionID,
 	}
 	reply := new(tproto.SplitQueryResult)
 	action := func() error {
@@ -271,25 +334,44 @@ func tabletError(err error) error {
 	if err == nil {
 		return nil
 	}
-	if _, ok := err.(rpcplus.ServerError); ok {
-		var code int
-		errStr := err.Error()
-		switch {
-		case strings.Contains(errStr, "fatal: "):
-			code = tabletconn.ERR_FATAL
-		case strings.Contains(errStr, "retry: "):
-			code = tabletconn.ERR_RETRY
-		case strings.Contains(errStr, "tx_pool_full: "):
-			code = tabletconn.ERR_TX_POOL_FULL
-		case strings.Contains(errStr, "not_in_tx: "):
-			code = tabletconn.ERR_NOT_IN_TX
-		default:
-			code = tabletconn.ERR_NORMAL
+	var code int
+	var serverCode vterrors.ErrorCode
+	switch err := err.(type) {
+	case *rpcplus.CodedServerError:
+		serverCode = vterrors.ErrorCode(err.Code)
+		code = tabletconn.CodeFromServerCode(serverCode)
+	case rpcplus.ServerError:
+		code, serverCode = legacyCodes(string(err))
+	default:
+		if err == context.Canceled {
+			return tabletconn.Cancelled
 		}
-		return &tabletconn.ServerError{Code: code, Err: fmt.Sprintf("vttablet: %v", err)}
+		return tabletconn.OperationalError(fmt.Sprintf("vttablet: %v", err))
 	}
-	if err == context.Canceled {
-		return tabletconn.Cancelled
-	}
-	return tabletconn.OperationalError(fmt.Sprintf("vttablet: %v", err))
+	return &tabletconn.ServerError{Code: code, ServerCode: serverCode, Err: fmt.Sprintf("vttablet: %v", err)}
+}
+
+// legacyCodes guesses the codes of the error of a vttablet that
+// doesn't send vterrors codes, from the prefix of its message. The
+// vterrors code is only set where the tablet would not send the one
+// of the Code, see tabletconn.ServerError.
+func legacyCodes(errStr string) (int, vterrors.ErrorCode) {
+	code := tabletconn.ERR_NORMAL
+	switch {
+	case strings.HasPrefix(errStr, "fatal: "):
+		code = tabletconn.ERR_FATAL
+	case strings.HasPrefix(errStr, "retry: "):
+		code = tabletconn.ERR_RETRY
+	case strings.HasPrefix(errStr, "tx_pool_full: "):
+		code = tabletconn.ERR_TX_POOL_FULL
+	case strings.HasPrefix(errStr, "not_in_tx: "):
+		code = tabletconn.ERR_NOT_IN_TX
+	}
+	switch {
+	case strings.Contains(errStr, "(errno 2013)"):
+		return code, vterrors.DeadlineExceeded
+	case code == tabletconn.ERR_NORMAL && strings.Contains(errStr, "(errno 1062)"):
+		return code, vterrors.IntegrityError
+	}
+	return code, vterrors.Unknown
 }
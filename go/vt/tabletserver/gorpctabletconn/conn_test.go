@@ -10,11 +10,15 @@ import (
 	"testing"
 	"time"
 
+	mproto "github.com/youtube/vitess/go/mysql/proto"
 	"github.com/youtube/vitess/go/rpcplus"
 	"github.com/youtube/vitess/go/rpcwrap/bsonrpc"
 	"github.com/youtube/vitess/go/vt/tabletserver/gorpcqueryservice"
+	"github.com/youtube/vitess/go/vt/tabletserver/proto"
+	"github.com/youtube/vitess/go/vt/tabletserver/tabletconn"
 	"github.com/youtube/vitess/go/vt/tabletserver/tabletconntest"
 	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/vt/vterrors"
 	"golang.org/x/net/context"
 )
 
@@ -60,3 +64,122 @@ func TestGoRPCTabletConn(t *testing.T) {
 	// and clean up
 	client.Close()
 }
+
+// This test makes sure the secure dialer refuses endpoints without a
+// vts port, instead of dialing port 0
+func TestGoRPCTabletConnSecureNoPort(t *testing.T) {
+	ctx := context.Background()
+	_, err := DialTabletSecure(ctx, topo.EndPoint{
+		Host: "localhost",
+		NamedPortMap: map[string]int{
+			"vt": 1234,
+		},
+	}, tabletconntest.TestKeyspace, tabletconntest.TestShard, 30*time.Second)
+	if _, ok := err.(tabletconn.OperationalError); !ok {
+		t.Fatalf("DialTabletSecure should have failed with an OperationalError, got: %v", err)
+	}
+}
+
+// deadlineQueryService records the deadline vttablet sees for a
+// StreamExecute.
+type deadlineQueryService struct {
+	*tabletconntest.FakeQueryService
+	deadline chan time.Time
+}
+
+func (d *deadlineQueryService) StreamExecute(ctx context.Context, query *proto.Query, sendReply func(*mproto.QueryResult) error) error {
+	deadline, _ := ctx.Deadline()
+	d.deadline <- deadline
+	return sendReply(&mproto.QueryResult{})
+}
+
+// This test makes sure the deadline of the caller is sent to vttablet,
+// so it can kill the query when the caller gives up
+func TestGoRPCTabletConnDeadline(t *testing.T) {
+	service := &deadlineQueryService{
+		FakeQueryService: tabletconntest.CreateFakeServer(t),
+		deadline:         make(chan time.Time, 1),
+	}
+	listener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("Cannot listen: %v", err)
+	}
+	defer listener.Close()
+	server := rpcplus.NewServer()
+	server.Register(gorpcqueryservice.New(service))
+	handler := http.NewServeMux()
+	bsonrpc.ServeCustomRPC(handler, server, false)
+	go http.Serve(listener, handler)
+
+	client, err := DialTablet(context.Background(), topo.EndPoint{
+		Host: "localhost",
+		NamedPortMap: map[string]int{
+			"vt": listener.Addr().(*net.TCPAddr).Port,
+		},
+	}, tabletconntest.TestKeyspace, tabletconntest.TestShard, 30*time.Second)
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	want, _ := ctx.Deadline()
+	stream, errFunc, err := client.StreamExecute(ctx, "query", nil, 0)
+	if err != nil {
+		t.Fatalf("StreamExecute failed: %v", err)
+	}
+	for range stream {
+	}
+	if err := errFunc(); err != nil {
+		t.Fatalf("StreamExecute failed: %v", err)
+	}
+	// the timeout is sent, and vttablet starts it when it gets it
+	got := <-service.deadline
+	if got.IsZero() || got.After(want.Add(10*time.Second)) || got.Before(want.Add(-10*time.Second)) {
+		t.Errorf("vttablet deadline = %v, want about %v", got, want)
+	}
+}
+
+func TestTabletError(t *testing.T) {
+	testcases := []struct {
+		err  error
+		code int
+	}{{
+		err:  &rpcplus.CodedServerError{ServerError: "cannot serve the query", Code: int64(vterrors.QueryNotServed)},
+		code: tabletconn.ERR_RETRY,
+	}, {
+		err:  &rpcplus.CodedServerError{ServerError: "pool closed", Code: int64(vterrors.Unavailable)},
+		code: tabletconn.ERR_FATAL,
+	}, {
+		err:  &rpcplus.CodedServerError{ServerError: "too many transactions", Code: int64(vterrors.ResourceExhausted)},
+		code: tabletconn.ERR_TX_POOL_FULL,
+	}, {
+		err:  &rpcplus.CodedServerError{ServerError: "transaction 12: not found", Code: int64(vterrors.NotInTx)},
+		code: tabletconn.ERR_NOT_IN_TX,
+	}, {
+		// the code wins over the message
+		err:  &rpcplus.CodedServerError{ServerError: "error: value 'retry: fatal: ' is invalid", Code: int64(vterrors.BadInput)},
+		code: tabletconn.ERR_NORMAL,
+	}, {
+		err:  &rpcplus.CodedServerError{ServerError: "error: retry: later", Code: int64(vterrors.Unknown)},
+		code: tabletconn.ERR_NORMAL,
+	}, {
+		// tablets that don't send codes
+		err:  rpcplus.ServerError("fatal: pool closed"),
+		code: tabletconn.ERR_FATAL,
+	}, {
+		err:  rpcplus.ServerError("error: value 'fatal: ' is invalid"),
+		code: tabletconn.ERR_NORMAL,
+	}}
+	for _, tc := range testcases {
+		se, ok := tabletError(tc.err).(*tabletconn.ServerError)
+		if !ok {
+			t.Errorf("tabletError(%v) is not a *tabletconn.ServerError", tc.err)
+			continue
+		}
+		if se.Code != tc.code {
+			t.Errorf("tabletError(%v).Code = %v, want %v", tc.err, se.Code, tc.code)
+		}
+	}
+}
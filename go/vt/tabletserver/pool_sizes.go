@@ -0,0 +1,111 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tabletserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/youtube/vitess/go/acl"
+)
+
+// The names of the pools that can be resized at runtime.
+const (
+	// AppPool is the pool of the queries outside of transactions.
+	AppPool = "app"
+	// StreamPool is the pool of the streaming queries.
+	StreamPool = "stream"
+	// TransactionPool is the pool of the transactions.
+	TransactionPool = "transaction"
+)
+
+// PoolStats is a snapshot of a connection pool.
+type PoolStats struct {
+	Capacity  int64
+	MaxCap    int64
+	InUse     int64
+	Available int64
+	WaitCount int64
+	WaitTime  time.Duration
+	Exhausted int64
+}
+
+func (qe *QueryEngine) poolByName(name string) (*ConnPool, error) {
+	switch name {
+	case AppPool:
+		return qe.connPool, nil
+	case StreamPool:
+		return qe.streamConnPool, nil
+	case TransactionPool:
+		return qe.txPool.pool, nil
+	}
+	return nil, fmt.Errorf("unknown pool %v, valid pools: %v, %v, %v", name, AppPool, StreamPool, TransactionPool)
+}
+
+// SetPoolSize resizes one of the pools, see ConnPool.SetCapacity.
+// While the query service is not serving, the size is kept for the
+// next time it is.
+func (qe *QueryEngine) SetPoolSize(name string, size int) error {
+	pool, err := qe.poolByName(name)
+	if err != nil {
+		return err
+	}
+	return pool.SetCapacity(size)
+}
+
+// PoolStats returns the stats of the pools that can be resized.
+func (qe *QueryEngine) PoolStats() map[string]PoolStats {
+	result := make(map[string]PoolStats)
+	for _, name := range []string{AppPool, StreamPool, TransactionPool} {
+		pool, _ := qe.poolByName(name)
+		result[name] = PoolStats{
+			Capacity:  pool.Capacity(),
+			MaxCap:    pool.MaxCap(),
+			InUse:     pool.InUse(),
+			Available: pool.Available(),
+			WaitCount: pool.WaitCount(),
+			WaitTime:  pool.WaitTime(),
+			Exhausted: pool.Exhausted(),
+		}
+	}
+	return result
+}
+
+// handleHTTPPools shows the stats of the pools as JSON. With the pool
+// and size parameters, it resizes the pool first.
+func (qe *QueryEngine) handleHTTPPools(response http.ResponseWriter, request *http.Request) {
+	if err := request.ParseForm(); err != nil {
+		http.Error(response, fmt.Sprintf("cannot parse form: %s", err), http.StatusInternalServerError)
+		return
+	}
+	if size := request.FormValue("size"); size != "" {
+		if err := acl.CheckAccessHTTP(request, acl.ADMIN); err != nil {
+			acl.SendError(response, err)
+			return
+		}
+		s, err := strconv.Atoi(size)
+		if err != nil {
+			http.Error(response, "invalid size", http.StatusInternalServerError)
+			return
+		}
+		if err := qe.SetPoolSize(request.FormValue("pool"), s); err != nil {
+			http.Error(response, fmt.Sprintf("error: %v", err), http.StatusInternalServerError)
+			return
+		}
+	} else if err := acl.CheckAccessHTTP(request, acl.MONITORING); err != nil {
+		acl.SendError(response, err)
+		return
+	}
+	b, err := json.MarshalIndent(qe.PoolStats(), "", "  ")
+	if err != nil {
+		http.Error(response, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	response.Header().Set("Content-Type", "application/json; charset=utf-8")
+	response.Write(b)
+}
@@ -0,0 +1,64 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tabletserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestQueryEngineSetPoolSize(t *testing.T) {
+	setUpSqlQueryTest()
+	testUtils := newTestUtils()
+	config := testUtils.newQueryServiceConfig()
+	sqlQuery := NewSqlQuery(config)
+	dbconfigs := testUtils.newDBConfigs()
+	if err := sqlQuery.allowQueries(&dbconfigs, []SchemaOverride{}, testUtils.newMysqld(&dbconfigs)); err != nil {
+		t.Fatalf("allowQueries failed: %v", err)
+	}
+	defer sqlQuery.disallowQueries()
+	qe := sqlQuery.qe
+
+	for pool, size := range map[string]int{AppPool: 3, StreamPool: 5, TransactionPool: 7} {
+		if err := qe.SetPoolSize(pool, size); err != nil {
+			t.Fatalf("SetPoolSize(%v, %d) failed: %v", pool, size, err)
+		}
+		if got := qe.PoolStats()[pool].Capacity; got != int64(size) {
+			t.Errorf("capacity of %v: %d, want %d", pool, got, size)
+		}
+	}
+	if err := qe.SetPoolSize("unknown", 1); err == nil || !strings.HasPrefix(err.Error(), "unknown pool unknown") {
+		t.Errorf("SetPoolSize on an unknown pool: %v", err)
+	}
+	maxCap := config.TransactionCap * config.PoolMaxCapFactor
+	if err := qe.SetPoolSize(TransactionPool, maxCap+1); err == nil {
+		t.Errorf("SetPoolSize over the max capacity %d should fail", maxCap)
+	}
+
+	// the handler resizes and shows the stats
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/debug/pools?pool=app&size=9", nil)
+	qe.handleHTTPPools(resp, req)
+	var poolStats map[string]PoolStats
+	if err := json.Unmarshal(resp.Body.Bytes(), &poolStats); err != nil {
+		t.Fatalf("cannot parse %s: %v", resp.Body.String(), err)
+	}
+	if got := poolStats[AppPool].Capacity; got != 9 {
+		t.Errorf("capacity of app after the handler: %d, want 9", got)
+	}
+	if got, want := poolStats[TransactionPool].MaxCap, int64(maxCap); got != want {
+		t.Errorf("max capacity of transaction: %d, want %d", got, want)
+	}
+
+	resp = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/debug/pools?pool=app&size=invalid", nil)
+	qe.handleHTTPPools(resp, req)
+	if resp.Code != http.StatusInternalServerError {
+		t.Errorf("an invalid size should fail, got code %d", resp.Code)
+	}
+}
@@ -6,6 +6,7 @@ package proto
 
 import (
 	"testing"
+	"time"
 
 	"github.com/youtube/vitess/go/bson"
 )
@@ -15,6 +16,7 @@ type reflectQuery struct {
 	BindVariables map[string]interface{}
 	SessionId     int64
 	TransactionId int64
+	Timeout       time.Duration
 }
 
 type extraQuery struct {
@@ -31,6 +33,7 @@ func TestQuery(t *testing.T) {
 		BindVariables: map[string]interface{}{"val": int64(1)},
 		SessionId:     2,
 		TransactionId: 1,
+		Timeout:       5 * time.Second,
 	})
 	if err != nil {
 		t.Error(err)
@@ -42,6 +45,7 @@ func TestQuery(t *testing.T) {
 		BindVariables: map[string]interface{}{"val": int64(1)},
 		SessionId:     2,
 		TransactionId: 1,
+		Timeout:       5 * time.Second,
 	}
 	encoded, err := bson.Marshal(&custom)
 	if err != nil {
@@ -69,6 +73,9 @@ func TestQuery(t *testing.T) {
 	if custom.BindVariables["val"].(int64) != unmarshalled.BindVariables["val"].(int64) {
 		t.Errorf("want %v, got %v", custom.BindVariables["val"], unmarshalled.BindVariables["val"])
 	}
+	if custom.Timeout != unmarshalled.Timeout {
+		t.Errorf("want %v, got %v", custom.Timeout, unmarshalled.Timeout)
+	}
 
 	extra, err := bson.Marshal(&extraQuery{})
 	if err != nil {
@@ -193,6 +200,7 @@ type reflectQueryList struct {
 	Queries       []BoundQuery
 	SessionId     int64
 	TransactionId int64
+	Timeout       time.Duration
 }
 
 type extraQueryList struct {
@@ -210,6 +218,7 @@ func TestQueryList(t *testing.T) {
 		}},
 		SessionId:     2,
 		TransactionId: 1,
+		Timeout:       5 * time.Second,
 	})
 	if err != nil {
 		t.Error(err)
@@ -223,6 +232,7 @@ func TestQueryList(t *testing.T) {
 		}},
 		SessionId:     2,
 		TransactionId: 1,
+		Timeout:       5 * time.Second,
 	}
 	encoded, err := bson.Marshal(&custom)
 	if err != nil {
@@ -250,6 +260,9 @@ func TestQueryList(t *testing.T) {
 	if custom.Queries[0].BindVariables["val"].(int64) != unmarshalled.Queries[0].BindVariables["val"].(int64) {
 		t.Errorf("want %v, got %v", custom.Queries[0].BindVariables["val"], unmarshalled.Queries[0].BindVariables["val"])
 	}
+	if custom.Timeout != unmarshalled.Timeout {
+		t.Errorf("want %v, got %v", custom.Timeout, unmarshalled.Timeout)
+	}
 
 	extra, err := bson.Marshal(&extraQueryList{})
 	if err != nil {
@@ -9,6 +9,7 @@ package proto
 
 import (
 	"bytes"
+	"time"
 
 	"github.com/youtube/vitess/go/bson"
 	"github.com/youtube/vitess/go/bytes2"
@@ -31,6 +32,7 @@ func (query *Query) MarshalBson(buf *bytes2.ChunkedWriter, key string) {
 	}
 	bson.EncodeInt64(buf, "SessionId", query.SessionId)
 	bson.EncodeInt64(buf, "TransactionId", query.TransactionId)
+	bson.EncodeInt64(buf, "Timeout", int64(query.Timeout))
 
 	lenWriter.Close()
 }
@@ -70,6 +72,8 @@ func (query *Query) UnmarshalBson(buf *bytes.Buffer, kind byte) {
 			query.SessionId = bson.DecodeInt64(buf, kind)
 		case "TransactionId":
 			query.TransactionId = bson.DecodeInt64(buf, kind)
+		case "Timeout":
+			query.Timeout = time.Duration(bson.DecodeInt64(buf, kind))
 		default:
 			bson.Skip(buf, kind)
 		}
@@ -9,6 +9,7 @@ package proto
 
 import (
 	"bytes"
+	"time"
 
 	"github.com/youtube/vitess/go/bson"
 	"github.com/youtube/vitess/go/bytes2"
@@ -30,6 +31,7 @@ func (queryList *QueryList) MarshalBson(buf *bytes2.ChunkedWriter, key string) {
 	}
 	bson.EncodeInt64(buf, "SessionId", queryList.SessionId)
 	bson.EncodeInt64(buf, "TransactionId", queryList.TransactionId)
+	bson.EncodeInt64(buf, "Timeout", int64(queryList.Timeout))
 
 	lenWriter.Close()
 }
@@ -67,6 +69,8 @@ func (queryList *QueryList) UnmarshalBson(buf *bytes.Buffer, kind byte) {
 			queryList.SessionId = bson.DecodeInt64(buf, kind)
 		case "TransactionId":
 			queryList.TransactionId = bson.DecodeInt64(buf, kind)
+		case "Timeout":
+			queryList.Timeout = time.Duration(bson.DecodeInt64(buf, kind))
 		default:
 			bson.Skip(buf, kind)
 		}
@@ -6,6 +6,7 @@ package proto
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/youtube/vitess/go/bytes2"
 	mproto "github.com/youtube/vitess/go/mysql/proto"
@@ -30,6 +31,9 @@ type Query struct {
 	BindVariables map[string]interface{}
 	SessionId     int64
 	TransactionId int64
+	// Timeout, if set, is how long vttablet works on the query
+	// before killing it.
+	Timeout time.Duration
 }
 
 //go:generate bsongen -file $GOFILE -type Query -o query_bson.go
@@ -74,6 +78,9 @@ type QueryList struct {
 	Queries       []BoundQuery
 	SessionId     int64
 	TransactionId int64
+	// Timeout, if set, is how long vttablet works on the queries
+	// before killing them.
+	Timeout time.Duration
 }
 
 //go:generate bsongen -file $GOFILE -type QueryList -o query_list_bson.go
@@ -123,3 +130,22 @@ type QuerySplit struct {
 type SplitQueryResult struct {
 	Queries []QuerySplit
 }
+
+// RuntimeStats is a snapshot of the query service activity.
+type RuntimeStats struct {
+	// QPS is the most recent queries per second, by plan type.
+	// "All" is the total.
+	QPS map[string]float64
+
+	// ErrorCount is the number of errors since the process started.
+	ErrorCount int64
+
+	// ErrorRate is the number of errors per second between the
+	// last two samples. It is computed by the tablet manager.
+	ErrorRate float64
+
+	// ConnectionsInUse and ConnectionsCapacity are for the regular
+	// and streaming connection pools combined.
+	ConnectionsInUse    int64
+	ConnectionsCapacity int64
+}
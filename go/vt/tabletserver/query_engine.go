@@ -130,6 +130,7 @@ func NewQueryEngine(config Config) *QueryEngine {
 	qe.connPool = NewConnPool(
 		config.PoolNamePrefix+"ConnPool",
 		config.PoolSize,
+		config.PoolSize*config.PoolMaxCapFactor,
 		time.Duration(config.IdleTimeout*1e9),
 		config.EnablePublishStats,
 		qe.queryServiceStats,
@@ -137,6 +138,7 @@ func NewQueryEngine(config Config) *QueryEngine {
 	qe.streamConnPool = NewConnPool(
 		config.PoolNamePrefix+"StreamConnPool",
 		config.StreamPoolSize,
+		config.StreamPoolSize*config.PoolMaxCapFactor,
 		time.Duration(config.IdleTimeout*1e9),
 		config.EnablePublishStats,
 		qe.queryServiceStats,
@@ -147,6 +149,7 @@ func NewQueryEngine(config Config) *QueryEngine {
 		config.PoolNamePrefix+"TransactionPool",
 		config.StatsPrefix,
 		config.TransactionCap,
+		config.TransactionCap*config.PoolMaxCapFactor,
 		time.Duration(config.TransactionTimeout*1e9),
 		time.Duration(config.TxPoolTimeout*1e9),
 		time.Duration(config.IdleTimeout*1e9),
@@ -155,7 +158,8 @@ func NewQueryEngine(config Config) *QueryEngine {
 	)
 	qe.consolidator = sync2.NewConsolidator()
 	http.Handle(config.DebugURLPrefix+"/consolidations", qe.consolidator)
-	qe.invalidator = NewRowcacheInvalidator(config.StatsPrefix, qe, config.EnablePublishStats)
+	http.HandleFunc(config.DebugURLPrefix+"/pools", qe.handleHTTPPools)
+	qe.invalidator = NewRowcacheInvalidator(config.StatsPrefix, qe, time.Duration(config.RowcacheInvalidatorMaxLag*1e9), config.EnablePublishStats)
 	qe.streamQList = NewQueryList()
 
 	// Vars
@@ -205,6 +209,11 @@ func (qe *QueryEngine) Open(dbconfigs *dbconfigs.DBConfigs, schemaOverrides []Sc
 		panic(NewTabletError(ErrFatal, "Rowcache cannot be enabled when queryserver-config-strict-mode is false"))
 	}
 	if dbconfigs.App.EnableRowcache {
+		if dbconfigs.App.EnableInvalidator {
+			// The invalidator starts from the position of mysqld
+			// before the rowcache is filled.
+			qe.invalidator.Checkpoint(mysqld)
+		}
 		qe.cachePool.Open()
 		log.Infof("rowcache is enabled")
 	} else {
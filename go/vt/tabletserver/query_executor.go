@@ -15,7 +15,9 @@ import (
 	"github.com/youtube/vitess/go/vt/callinfo"
 	"github.com/youtube/vitess/go/vt/schema"
 	"github.com/youtube/vitess/go/vt/sqlparser"
+	"github.com/youtube/vitess/go/vt/tableacl"
 	"github.com/youtube/vitess/go/vt/tabletserver/planbuilder"
+	"github.com/youtube/vitess/go/vt/vterrors"
 	"golang.org/x/net/context"
 )
 
@@ -28,6 +30,9 @@ type QueryExecutor struct {
 	ctx           context.Context
 	logStats      *SQLQueryStats
 	qe            *QueryEngine
+	// truncate is set by the QR_TRUNCATE rules, to truncate the
+	// results over the max result size instead of failing them.
+	truncate bool
 }
 
 // poolConn is the interface implemented by users of this specialized pool.
@@ -113,6 +118,9 @@ func (qre *QueryExecutor) Execute() (reply *mproto.QueryResult) {
 			reply = qre.execDmlAutoCommit()
 		}
 	}
+	if qre.plan.PlanId.IsSelect() {
+		reply = qre.limitResult(reply)
+	}
 	return reply
 }
 
@@ -194,17 +202,37 @@ func (qre *QueryExecutor) checkPermissions() {
 		panic(NewTabletError(ErrFail, "Query disallowed due to rule: %s", desc))
 	case QR_FAIL_RETRY:
 		panic(NewTabletError(ErrRetry, "Query disallowed due to rule: %s", desc))
+	case QR_TRUNCATE:
+		qre.truncate = true
 	}
 
-	// Perform table ACL check if it is enabled
-	if qre.plan.Authorized != nil && !qre.plan.Authorized.IsMember(username) {
-		errStr := fmt.Sprintf("table acl error: %q cannot run %v on table %q", username, qre.plan.PlanId, qre.plan.TableName)
-		// Raise error if in strictTableAcl mode, else just log an error
-		if qre.qe.strictTableAcl {
-			panic(NewTabletError(ErrFail, "%s", errStr))
-		}
-		qre.qe.accessCheckerLogger.Errorf("%s", errStr)
+	// Perform table ACL check if it is enabled. The ACL is looked up
+	// for each query, not cached in the plan, so the reloads of the
+	// config apply to the cached plans too.
+	authorized := tableacl.Authorized(qre.plan.TableName, qre.plan.PlanId.MinRole())
+	if authorized == nil {
+		return
+	}
+	statsKey := []string{qre.plan.TableName, authorized.GroupName, qre.plan.PlanId.String(), username}
+	if authorized.IsMember(username) {
+		qre.qe.queryServiceStats.TableACLAllowed.Add(statsKey, 1)
+		return
+	}
+	errStr := fmt.Sprintf("table acl error: %q cannot run %v on table %q", username, qre.plan.PlanId, qre.plan.TableName)
+	if tableacl.DryRun() {
+		// the config is being rolled out, it's not enforced yet
+		qre.qe.queryServiceStats.TableACLPseudoDenied.Add(statsKey, 1)
+		qre.qe.accessCheckerLogger.Errorf("dry run %s", errStr)
+		return
 	}
+	qre.qe.queryServiceStats.TableACLDenied.Add(statsKey, 1)
+	// Raise error if in strictTableAcl mode, else just log an error
+	if qre.qe.strictTableAcl {
+		te := NewTabletError(ErrFail, "%s", errStr)
+		te.Code = vterrors.Unauthenticated
+		panic(te)
+	}
+	qre.qe.accessCheckerLogger.Errorf("%s", errStr)
 }
 
 func (qre *QueryExecutor) execDDL() *mproto.QueryResult {
@@ -258,7 +286,13 @@ func (qre *QueryExecutor) fetchMulti(pkRows [][]sqltypes.Value, limit int64) (re
 	for i, pk := range pkRows {
 		keys[i] = buildKey(pk)
 	}
-	rcresults := tableInfo.Cache.Get(qre.ctx, keys)
+	// If the invalidator is too far behind, the rowcache can be stale:
+	// all the rows come from MySQL, and they aren't cached.
+	failOpen := qre.qe.invalidator.FailOpen()
+	var rcresults map[string]RCResult
+	if !failOpen {
+		rcresults = tableInfo.Cache.Get(qre.ctx, keys)
+	}
 	rows := make([][]sqltypes.Value, 0, len(pkRows))
 	missingRows := make([][]sqltypes.Value, 0, len(pkRows))
 	var hits, absent, misses int64
@@ -286,20 +320,25 @@ func (qre *QueryExecutor) fetchMulti(pkRows [][]sqltypes.Value, limit int64) (re
 		absent = int64(len(pkRows)) - hits - misses
 		for _, row := range resultFromdb.Rows {
 			rows = append(rows, applyFilter(qre.plan.ColumnNumbers, row))
+			if failOpen {
+				continue
+			}
 			key := buildKey(applyFilter(qre.plan.TableInfo.PKColumns, row))
 			tableInfo.Cache.Set(qre.ctx, key, row, rcresults[key].Cas)
 		}
 	}
 
-	qre.logStats.CacheHits = hits
-	qre.logStats.CacheAbsent = absent
-	qre.logStats.CacheMisses = misses
+	if !failOpen {
+		qre.logStats.CacheHits = hits
+		qre.logStats.CacheAbsent = absent
+		qre.logStats.CacheMisses = misses
 
-	qre.logStats.QuerySources |= QuerySourceRowcache
+		qre.logStats.QuerySources |= QuerySourceRowcache
 
-	tableInfo.hits.Add(hits)
-	tableInfo.absent.Add(absent)
-	tableInfo.misses.Add(misses)
+		tableInfo.hits.Add(hits)
+		tableInfo.absent.Add(absent)
+		tableInfo.misses.Add(misses)
+	}
 	result.RowsAffected = uint64(len(rows))
 	result.Rows = rows
 	// limit == 0 is already addressed upfront.
@@ -463,14 +502,20 @@ func (qre *QueryExecutor) execDMLPKRows(conn poolConn, pkRows [][]sqltypes.Value
 	return result
 }
 
+func (qre *QueryExecutor) setPoolSize(pool string) {
+	if err := qre.qe.SetPoolSize(pool, int(getInt64(qre.plan.SetValue))); err != nil {
+		panic(NewTabletError(ErrFail, "%v", err))
+	}
+}
+
 func (qre *QueryExecutor) execSet() (result *mproto.QueryResult) {
 	switch qre.plan.SetKey {
 	case "vt_pool_size":
-		qre.qe.connPool.SetCapacity(int(getInt64(qre.plan.SetValue)))
+		qre.setPoolSize(AppPool)
 	case "vt_stream_pool_size":
-		qre.qe.streamConnPool.SetCapacity(int(getInt64(qre.plan.SetValue)))
+		qre.setPoolSize(StreamPool)
 	case "vt_transaction_cap":
-		qre.qe.txPool.pool.SetCapacity(int(getInt64(qre.plan.SetValue)))
+		qre.setPoolSize(TransactionPool)
 	case "vt_transaction_timeout":
 		qre.qe.txPool.SetTimeout(getDuration(qre.plan.SetValue))
 	case "vt_schema_reload_time":
@@ -632,7 +677,18 @@ func (qre *QueryExecutor) execSQL(conn poolConn, sql string, wantfields bool) *m
 
 func (qre *QueryExecutor) execSQLNoPanic(conn poolConn, sql string, wantfields bool) (*mproto.QueryResult, error) {
 	defer qre.logStats.AddRewrittenSql(sql, time.Now())
-	return conn.Exec(qre.ctx, sql, int(qre.qe.maxResultSize.Get()), wantfields)
+	maxrows := int(qre.qe.maxResultSize.Get())
+	if qre.plan != nil && qre.plan.PlanId.IsSelect() {
+		// The selects can return one more row, for limitResult
+		// to fail or truncate their result. The other queries
+		// fail in mysql.
+		maxrows++
+	}
+	result, err := conn.Exec(qre.ctx, sql, maxrows, wantfields)
+	if err != nil {
+		qre.recordKill()
+	}
+	return result, err
 }
 
 func (qre *QueryExecutor) execStreamSQL(conn *DBConn, sql string, callback func(*mproto.QueryResult) error) {
@@ -640,6 +696,40 @@ func (qre *QueryExecutor) execStreamSQL(conn *DBConn, sql string, callback func(
 	err := conn.Stream(qre.ctx, sql, callback, int(qre.qe.streamBufferSize.Get()))
 	qre.logStats.AddRewrittenSql(sql, start)
 	if err != nil {
+		qre.recordKill()
 		panic(NewTabletErrorSql(ErrFail, err))
 	}
 }
+
+// recordKill counts the failed query as killed if its context is
+// done, as the connection kills it then.
+func (qre *QueryExecutor) recordKill() {
+	if qre.ctx.Err() == nil {
+		return
+	}
+	tableName := ""
+	if qre.plan != nil {
+		tableName = qre.plan.TableName
+	}
+	qre.qe.queryServiceStats.TableLimits.Add([]string{tableName, "Killed"}, 1)
+}
+
+// limitResult enforces the max result size on the result of a select.
+// A result over it fails the query, or is truncated if a QR_TRUNCATE
+// rule matched the query.
+func (qre *QueryExecutor) limitResult(result *mproto.QueryResult) *mproto.QueryResult {
+	maxResultSize := int(qre.qe.maxResultSize.Get())
+	if result == nil || len(result.Rows) <= maxResultSize {
+		return result
+	}
+	if !qre.truncate {
+		qre.qe.queryServiceStats.TableLimits.Add([]string{qre.plan.TableName, "RowCountExceeded"}, 1)
+		panic(NewTabletError(ErrFail, "Row count exceeded %d", maxResultSize))
+	}
+	qre.qe.queryServiceStats.TableLimits.Add([]string{qre.plan.TableName, "Truncated"}, 1)
+	// the result can be shared with consolidated queries
+	truncated := *result
+	truncated.Rows = result.Rows[:maxResultSize]
+	truncated.RowsAffected = uint64(maxResultSize)
+	return &truncated
+}
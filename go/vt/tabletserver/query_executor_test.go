@@ -381,6 +381,46 @@ func TestQueryExecutorPlanPKIn(t *testing.T) {
 	testUtils.checkEqual(t, expected, qre.Execute())
 }
 
+func TestQueryExecutorPlanPKInFailOpen(t *testing.T) {
+	db := setUpQueryExecutorTest()
+	testUtils := &testUtils{}
+	query := "select * from test_table where pk in (1, 2, 3) limit 1000"
+	expandedQuery := "select pk, name, addr from test_table where pk in (1, 2, 3)"
+
+	expected := &mproto.QueryResult{
+		Fields:       getTestTableFields(),
+		RowsAffected: 1,
+		Rows: [][]sqltypes.Value{
+			[]sqltypes.Value{
+				sqltypes.MakeNumeric([]byte("1")),
+				sqltypes.MakeNumeric([]byte("20")),
+				sqltypes.MakeNumeric([]byte("30")),
+			},
+		},
+	}
+	db.AddQuery(query, expected)
+	db.AddQuery(expandedQuery, expected)
+
+	db.AddQuery("select * from test_table where 1 != 1", &mproto.QueryResult{
+		Fields: getTestTableFields(),
+	})
+
+	qre, sqlQuery := newTestQueryExecutor(
+		query, context.Background(), enableRowCache|enableStrict|enableSchemaOverrides)
+	defer sqlQuery.disallowQueries()
+	checkPlanID(t, planbuilder.PLAN_PK_IN, qre.plan.PlanId)
+	// caches pk=1
+	testUtils.checkEqual(t, expected, qre.Execute())
+
+	// pk=1 is read from MySQL again while the invalidator is behind
+	qre.qe.invalidator.failOpen.Set(1)
+	qre.logStats = newSqlQueryStats("TestQueryExecutor", context.Background())
+	testUtils.checkEqual(t, expected, qre.Execute())
+	if qre.logStats.CacheHits != 0 || qre.logStats.QuerySources&QuerySourceRowcache != 0 {
+		t.Fatalf("the rowcache should not be used, got %d hits, sources: %s", qre.logStats.CacheHits, qre.logStats.FmtQuerySources())
+	}
+}
+
 func TestQueryExecutorPlanSelectSubQuery(t *testing.T) {
 	db := setUpQueryExecutorTest()
 	testUtils := &testUtils{}
@@ -704,6 +744,58 @@ func TestQueryExecutorTableAcl(t *testing.T) {
 	qre.Execute()
 }
 
+func TestQueryExecutorTableAclDryRun(t *testing.T) {
+	aclName := fmt.Sprintf("simpleacl-test-%d", rand.Int63())
+	tableacl.Register(aclName, &simpleacl.Factory{})
+	tableacl.SetDefaultACL(aclName)
+
+	db := setUpQueryExecutorTest()
+	query := "select * from test_table limit 1000"
+	expected := &mproto.QueryResult{
+		Fields:       getTestTableFields(),
+		RowsAffected: 0,
+		Rows:         [][]sqltypes.Value{},
+	}
+	db.AddQuery(query, expected)
+	db.AddQuery("select * from test_table where 1 != 1", &mproto.QueryResult{
+		Fields: getTestTableFields(),
+	})
+
+	username := "u2"
+	callInfo := &fakeCallInfo{
+		remoteAddr: "1.2.3.4",
+		username:   username,
+	}
+	ctx := callinfo.NewContext(context.Background(), callInfo)
+	if err := tableacl.Load([]byte(`{"test_table":{"READER":"superuser"}}`), true); err != nil {
+		t.Fatalf("unable to load tableacl config, error: %v", err)
+	}
+	defer tableacl.Load([]byte(`{}`), false)
+
+	// the dry run config is not enforced, even in strict mode
+	qre, sqlQuery := newTestQueryExecutor(
+		query, ctx, enableRowCache|enableSchemaOverrides|enableStrict|enableStrictTableAcl)
+	defer sqlQuery.disallowQueries()
+	checkPlanID(t, planbuilder.PLAN_PASS_SELECT, qre.plan.PlanId)
+	qre.Execute()
+	statsKey := "test_table.test_table.PASS_SELECT." + username
+	if got := qre.qe.queryServiceStats.TableACLPseudoDenied.Counts()[statsKey]; got != 1 {
+		t.Errorf("TableACLPseudoDenied[%v] = %v, want 1", statsKey, got)
+	}
+
+	// once it is reloaded as enforced, the same plan is denied
+	if err := tableacl.Load([]byte(`{"test_table":{"READER":"superuser"}}`), false); err != nil {
+		t.Fatalf("unable to load tableacl config, error: %v", err)
+	}
+	func() {
+		defer handleAndVerifyTabletError(t, "query should fail because current user do not have read permissions", ErrFail)
+		qre.Execute()
+	}()
+	if got := qre.qe.queryServiceStats.TableACLDenied.Counts()[statsKey]; got != 1 {
+		t.Errorf("TableACLDenied[%v] = %v, want 1", statsKey, got)
+	}
+}
+
 func TestQueryExecutorBlacklistQRFail(t *testing.T) {
 	db := setUpQueryExecutorTest()
 	query := "select * from test_table where name = 1 limit 1000"
@@ -800,6 +892,81 @@ func TestQueryExecutorBlacklistQRRetry(t *testing.T) {
 	qre.Execute()
 }
 
+func TestQueryExecutorMaxResultSize(t *testing.T) {
+	db := setUpQueryExecutorTest()
+	testUtils := &testUtils{}
+	query := "select * from test_table limit 1000"
+	row := []sqltypes.Value{
+		sqltypes.MakeNumeric([]byte("1")),
+		sqltypes.MakeNumeric([]byte("20")),
+		sqltypes.MakeNumeric([]byte("30")),
+	}
+	db.AddQuery(query, &mproto.QueryResult{
+		Fields:       getTestTableFields(),
+		RowsAffected: 3,
+		Rows:         [][]sqltypes.Value{row, row, row},
+	})
+	db.AddQuery("select * from test_table where 1 != 1", &mproto.QueryResult{
+		Fields: getTestTableFields(),
+	})
+
+	truncateRule := NewQueryRule("truncate for u3", "truncate", QR_TRUNCATE)
+	truncateRule.SetUserCond("u3")
+	truncateRule.AddTableCond("test_table")
+
+	rulesName := "truncateRules"
+	rules := NewQueryRules()
+	rules.Add(truncateRule)
+
+	QueryRuleSources.UnRegisterQueryRuleSource(rulesName)
+	QueryRuleSources.RegisterQueryRuleSource(rulesName)
+	defer QueryRuleSources.UnRegisterQueryRuleSource(rulesName)
+
+	if err := QueryRuleSources.SetRules(rulesName, rules); err != nil {
+		t.Fatalf("failed to set rule, error: %v", err)
+	}
+
+	// the rule truncates the result of u3
+	ctx := callinfo.NewContext(context.Background(), &fakeCallInfo{
+		remoteAddr: "1.2.3.4",
+		username:   "u3",
+	})
+	qre, sqlQuery := newTestQueryExecutor(query, ctx, enableRowCache|enableStrict)
+	defer sqlQuery.disallowQueries()
+	checkPlanID(t, planbuilder.PLAN_PASS_SELECT, qre.plan.PlanId)
+	qre.qe.maxResultSize.Set(2)
+	testUtils.checkEqual(t, &mproto.QueryResult{
+		Fields:       getTestTableFields(),
+		RowsAffected: 2,
+		Rows:         [][]sqltypes.Value{row, row},
+	}, qre.Execute())
+	tableLimits := qre.qe.queryServiceStats.TableLimits
+	if got := tableLimits.Counts()["test_table.Truncated"]; got != 1 {
+		t.Errorf("truncated results: %v, want 1", got)
+	}
+
+	// and fails it for the others
+	ctx = callinfo.NewContext(context.Background(), &fakeCallInfo{
+		remoteAddr: "1.2.3.4",
+		username:   "u4",
+	})
+	qre = &QueryExecutor{
+		query:    query,
+		bindVars: make(map[string]interface{}),
+		plan:     qre.plan,
+		ctx:      ctx,
+		logStats: newSqlQueryStats("TestQueryExecutor", ctx),
+		qe:       qre.qe,
+	}
+	defer func() {
+		verifyTabletError(t, recover(), ErrFail)
+		if got := tableLimits.Counts()["test_table.RowCountExceeded"]; got != 1 {
+			t.Errorf("failed results: %v, want 1", got)
+		}
+	}()
+	qre.Execute()
+}
+
 type executorFlags int64
 
 const (
@@ -15,12 +15,23 @@ import (
 // Global variable to keep track of every registered query rule source
 var QueryRuleSources = NewQueryRuleInfo()
 
-// QueryRuleInfo is the maintainer of QueryRules from multiple sources
+// QueryRuleInfo is the maintainer of QueryRules from multiple sources.
+//
+// A query is checked against the rules of all the sources, in the
+// order the sources were registered, and in the order of the rules
+// within each source. The first rule that fails the query decides:
+// its action (FAIL or FAIL_RETRY) and description are returned, and
+// the rules after it are not evaluated. If no rule fails the query, it
+// is truncated if any rule asked for it. So a FAIL rule of any source
+// wins over a TRUNCATE rule, and between two failing rules the earlier
+// source wins.
 type QueryRuleInfo struct {
-	// mutex to protect following queryRulesMap
+	// mutex to protect following queryRulesMap and sources
 	mu sync.Mutex
 	// queryRulesMap maps the names of different query rule sources to the actual QueryRules structure
 	queryRulesMap map[string]*QueryRules
+	// sources are the names of the sources in registration order
+	sources []string
 }
 
 // NewQueryRuleInfo returns an empty QueryRuleInfo object for use
@@ -40,6 +51,7 @@ func (qri *QueryRuleInfo) RegisterQueryRuleSource(ruleSource string) {
 		panic("Query rule source " + ruleSource + " has been registered")
 	}
 	qri.queryRulesMap[ruleSource] = NewQueryRules()
+	qri.sources = append(qri.sources, ruleSource)
 }
 
 // UnRegisterQueryRuleSource removes a registered query rule source name
@@ -47,6 +59,12 @@ func (qri *QueryRuleInfo) UnRegisterQueryRuleSource(ruleSource string) {
 	qri.mu.Lock()
 	defer qri.mu.Unlock()
 	delete(qri.queryRulesMap, ruleSource)
+	for i, source := range qri.sources {
+		if source == ruleSource {
+			qri.sources = append(qri.sources[:i], qri.sources[i+1:]...)
+			break
+		}
+	}
 }
 
 // SetRules takes an external QueryRules structure and overwrite one of the
@@ -75,13 +93,14 @@ func (qri *QueryRuleInfo) GetRules(ruleSource string) (*QueryRules, error) {
 }
 
 // filterByPlan creates a new QueryRules by prefiltering on all query rules that are contained in internal
-// QueryRules structures, in other words, query rules from all predefined sources will be applied
+// QueryRules structures, in other words, query rules from all predefined sources will be applied.
+// The rules are kept in the evaluation order documented on QueryRuleInfo.
 func (qri *QueryRuleInfo) filterByPlan(query string, planid planbuilder.PlanType, tableName string) (newqrs *QueryRules) {
 	qri.mu.Lock()
 	defer qri.mu.Unlock()
 	newqrs = NewQueryRules()
-	for _, rules := range qri.queryRulesMap {
-		newqrs.Append(rules.filterByPlan(query, planid, tableName))
+	for _, source := range qri.sources {
+		newqrs.Append(qri.queryRulesMap[source].filterByPlan(query, planid, tableName))
 	}
 	return newqrs
 }
@@ -240,3 +240,45 @@ func TestQueryRuleInfoFilterByPlan(t *testing.T) {
 	t.Errorf("Insert into t_test matches rule[0] '%s' and rule[1] '%s', but we expect rule[0] with prefix '%s' and rule[1] with prefix '%s'",
 		qrs.rules[0].Name, qrs.rules[1].Name, "keyspace_id_not_in_range", "customrule_ban_bindvar")
 }
+
+func TestQueryRuleInfoEvaluationOrder(t *testing.T) {
+	qri := NewQueryRuleInfo()
+	qri.RegisterQueryRuleSource("first")
+	qri.RegisterQueryRuleSource("second")
+	setRule := func(source, name string, action Action) {
+		qrs := NewQueryRules()
+		qrs.Add(NewQueryRule(name, name, action))
+		if err := qri.SetRules(source, qrs); err != nil {
+			t.Fatalf("SetRules(%v): %v", source, err)
+		}
+	}
+	check := func(wantAction Action, wantDesc string) {
+		qrs := qri.filterByPlan("select * from t", planbuilder.PLAN_PASS_SELECT, "t")
+		action, desc := qrs.getAction("", "", nil)
+		if action != wantAction || desc != wantDesc {
+			t.Errorf("getAction: %v %q, want %v %q", action, desc, wantAction, wantDesc)
+		}
+	}
+
+	// between two failing rules, the first registered source wins
+	setRule("first", "retry", QR_FAIL_RETRY)
+	setRule("second", "fail", QR_FAIL)
+	for i := 0; i < 10; i++ {
+		check(QR_FAIL_RETRY, "retry")
+	}
+
+	// a failing rule wins over an earlier truncating one
+	setRule("first", "truncate", QR_TRUNCATE)
+	check(QR_FAIL, "fail")
+	setRule("second", "continue", QR_CONTINUE)
+	check(QR_TRUNCATE, "truncate")
+
+	// a source registered again goes last
+	setRule("second", "fail", QR_FAIL)
+	setRule("first", "retry", QR_FAIL_RETRY)
+	qri.UnRegisterQueryRuleSource("first")
+	check(QR_FAIL, "fail")
+	qri.RegisterQueryRuleSource("first")
+	setRule("first", "retry", QR_FAIL_RETRY)
+	check(QR_FAIL, "fail")
+}
@@ -107,13 +107,22 @@ func (qrs *QueryRules) filterByPlan(query string, planid planbuilder.PlanType, t
 	return &QueryRules{newrules}
 }
 
+// getAction returns the action of the first rule that fails the query.
+// If no rule does, it returns QR_TRUNCATE if a rule asked for it.
 func (qrs *QueryRules) getAction(ip, user string, bindVars map[string]interface{}) (action Action, desc string) {
+	action = QR_CONTINUE
 	for _, qr := range qrs.rules {
-		if act := qr.getAction(ip, user, bindVars); act != QR_CONTINUE {
+		switch act := qr.getAction(ip, user, bindVars); act {
+		case QR_CONTINUE:
+		case QR_TRUNCATE:
+			if action == QR_CONTINUE {
+				action, desc = act, qr.Description
+			}
+		default:
 			return act, qr.Description
 		}
 	}
-	return QR_CONTINUE, ""
+	return action, desc
 }
 
 //-----------------------------------------------
@@ -361,13 +370,16 @@ func bvMatch(bvcond BindVarCond, bindVars map[string]interface{}) bool {
 // Support types for QueryRule
 
 // Action speficies the list of actions to perform
-// when a QueryRule is triggered.
+// when a QueryRule is triggered. QR_TRUNCATE lets the
+// query run, but truncates its result to the max result
+// size instead of failing it.
 type Action int
 
 const (
 	QR_CONTINUE = Action(iota)
 	QR_FAIL
 	QR_FAIL_RETRY
+	QR_TRUNCATE
 )
 
 // BindVarCond represents a bind var condition.
@@ -774,6 +786,8 @@ func BuildQueryRule(ruleInfo map[string]interface{}) (qr *QueryRule, err error)
 				qr.act = QR_FAIL
 			case "FAIL_RETRY":
 				qr.act = QR_FAIL_RETRY
+			case "TRUNCATE":
+				qr.act = QR_TRUNCATE
 			default:
 				return nil, NewTabletError(ErrFail, "invalid Action %s", sv)
 			}
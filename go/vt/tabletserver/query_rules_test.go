@@ -535,6 +535,34 @@ func TestAction(t *testing.T) {
 	}
 }
 
+func TestActionTruncate(t *testing.T) {
+	qrs := NewQueryRules()
+
+	qr1 := NewQueryRule("rule 1", "r1", QR_TRUNCATE)
+	qr1.SetUserCond("user.*")
+
+	qr2 := NewQueryRule("rule 2", "r2", QR_FAIL)
+	qr2.SetIPCond("123")
+
+	qrs.Add(qr1)
+	qrs.Add(qr2)
+
+	bv := make(map[string]interface{})
+	// a truncate rule does not hide the rules that fail the query
+	action, desc := qrs.getAction("123", "user1", bv)
+	if action != QR_FAIL || desc != "rule 2" {
+		t.Errorf("want fail by rule 2, got %v by %q", action, desc)
+	}
+	action, desc = qrs.getAction("1234", "user1", bv)
+	if action != QR_TRUNCATE || desc != "rule 1" {
+		t.Errorf("want truncate by rule 1, got %v by %q", action, desc)
+	}
+	action, desc = qrs.getAction("1234", "other", bv)
+	if action != QR_CONTINUE {
+		t.Errorf("want continue, got %v by %q", action, desc)
+	}
+}
+
 var jsondata = `[{
 	"Description": "desc1",
 	"Name": "name1",
@@ -831,6 +859,21 @@ func TestBuildQueryRuleActionFail(t *testing.T) {
 	}
 }
 
+func TestBuildQueryRuleActionTruncate(t *testing.T) {
+	var ruleInfo map[string]interface{}
+	err := json.Unmarshal([]byte(`{"Action": "TRUNCATE" }`), &ruleInfo)
+	if err != nil {
+		t.Fatalf("failed to unmarshal json, got error: %v", err)
+	}
+	qr, err := BuildQueryRule(ruleInfo)
+	if err != nil {
+		t.Fatalf("build query rule should succeed")
+	}
+	if qr.act != QR_TRUNCATE {
+		t.Fatalf("action should truncate")
+	}
+}
+
 func TestBuildQueryRuleFailureModes(t *testing.T) {
 	var err error
 	var errStr string
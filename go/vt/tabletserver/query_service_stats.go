@@ -32,6 +32,16 @@ type QueryServiceStats struct {
 	ResultStats *stats.Histogram
 	// SpotCheckCount shows the number of spot check events happened.
 	SpotCheckCount *stats.Int
+	// TableACLAllowed, TableACLDenied and TableACLPseudoDenied count
+	// the table ACL checks that passed, that failed, and that failed
+	// for a dry run config, by table, config group, plan and user.
+	TableACLAllowed      *stats.MultiCounters
+	TableACLDenied       *stats.MultiCounters
+	TableACLPseudoDenied *stats.MultiCounters
+	// TableLimits counts the queries killed after they timed out or
+	// were canceled, and the results over the max result size that
+	// were truncated or failed, by table and limit.
+	TableLimits *stats.MultiCounters
 }
 
 // NewQueryServiceStats returns a new QueryServiceStats instance.
@@ -46,6 +56,10 @@ func NewQueryServiceStats(statsPrefix string, enablePublishStats bool) *QuerySer
 	internalErrorsName := ""
 	resultStatsName := ""
 	spotCheckCountName := ""
+	tableACLAllowedName := ""
+	tableACLDeniedName := ""
+	tableACLPseudoDeniedName := ""
+	tableLimitsName := ""
 	if enablePublishStats {
 		mysqlStatsName = statsPrefix + "Mysql"
 		queryStatsName = statsPrefix + "Queries"
@@ -57,19 +71,28 @@ func NewQueryServiceStats(statsPrefix string, enablePublishStats bool) *QuerySer
 		internalErrorsName = statsPrefix + "InternalErrors"
 		resultStatsName = statsPrefix + "Results"
 		spotCheckCountName = statsPrefix + "RowcacheSpotCheckCount"
+		tableACLAllowedName = statsPrefix + "TableACLAllowed"
+		tableACLDeniedName = statsPrefix + "TableACLDenied"
+		tableACLPseudoDeniedName = statsPrefix + "TableACLPseudoDenied"
+		tableLimitsName = statsPrefix + "TableLimits"
 	}
 	resultBuckets := []int64{0, 1, 5, 10, 50, 100, 500, 1000, 5000, 10000}
+	tableACLLabels := []string{"TableName", "TableGroup", "PlanID", "Username"}
 	queryStats := stats.NewTimings(queryStatsName)
 	return &QueryServiceStats{
-		MySQLStats:     stats.NewTimings(mysqlStatsName),
-		QueryStats:     queryStats,
-		WaitStats:      stats.NewTimings(waitStatsName),
-		KillStats:      stats.NewCounters(killStatsName),
-		InfoErrors:     stats.NewCounters(infoErrorsName),
-		ErrorStats:     stats.NewCounters(errorStatsName),
-		InternalErrors: stats.NewCounters(internalErrorsName),
-		QPSRates:       stats.NewRates(qpsRateName, queryStats, 15, 60*time.Second),
-		ResultStats:    stats.NewHistogram(resultStatsName, resultBuckets),
-		SpotCheckCount: stats.NewInt(spotCheckCountName),
+		MySQLStats:           stats.NewTimings(mysqlStatsName),
+		QueryStats:           queryStats,
+		WaitStats:            stats.NewTimings(waitStatsName),
+		KillStats:            stats.NewCounters(killStatsName),
+		InfoErrors:           stats.NewCounters(infoErrorsName),
+		ErrorStats:           stats.NewCounters(errorStatsName),
+		InternalErrors:       stats.NewCounters(internalErrorsName),
+		QPSRates:             stats.NewRates(qpsRateName, queryStats, 15, 60*time.Second),
+		ResultStats:          stats.NewHistogram(resultStatsName, resultBuckets),
+		SpotCheckCount:       stats.NewInt(spotCheckCountName),
+		TableACLAllowed:      stats.NewMultiCounters(tableACLAllowedName, tableACLLabels),
+		TableACLDenied:       stats.NewMultiCounters(tableACLDeniedName, tableACLLabels),
+		TableACLPseudoDenied: stats.NewMultiCounters(tableACLPseudoDeniedName, tableACLLabels),
+		TableLimits:          stats.NewMultiCounters(tableLimitsName, []string{"TableName", "Limit"}),
 	}
 }
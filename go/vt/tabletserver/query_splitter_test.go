@@ -314,3 +314,87 @@ func TestSplitQuery(t *testing.T) {
 		t.Errorf("wrong splits, got: %v, want: %v", got, want)
 	}
 }
+
+// splitBounds returns the bounds on column of the where clause of a
+// split: column >= lower and column < upper. A nil bound means
+// there is no bound.
+func splitBounds(t *testing.T, sql, column string) (lower, upper *int64) {
+	statement, err := sqlparser.Parse(sql)
+	if err != nil {
+		t.Fatalf("cannot parse split %v: %v", sql, err)
+	}
+	sel := statement.(*sqlparser.Select)
+	if sel.Where == nil {
+		return nil, nil
+	}
+	var walk func(expr sqlparser.BoolExpr)
+	walk = func(expr sqlparser.BoolExpr) {
+		switch expr := expr.(type) {
+		case *sqlparser.AndExpr:
+			walk(expr.Left)
+			walk(expr.Right)
+		case *sqlparser.ComparisonExpr:
+			col, ok := expr.Left.(*sqlparser.ColName)
+			if !ok || string(col.Name) != column {
+				return
+			}
+			v, err := sqltypes.MakeNumeric(expr.Right.(sqlparser.NumVal)).ParseInt64()
+			if err != nil {
+				t.Fatalf("bad bound in split %v: %v", sql, err)
+			}
+			switch expr.Operator {
+			case sqlparser.AST_GE:
+				lower = &v
+			case sqlparser.AST_LT:
+				upper = &v
+			default:
+				t.Fatalf("unexpected operator in split %v: %v", sql, expr.Operator)
+			}
+		}
+	}
+	walk(sel.Where.Expr)
+	return lower, upper
+}
+
+// TestSplitQueryCoverage checks the splits of a table with a known
+// distribution of values return every row exactly once.
+func TestSplitQueryCoverage(t *testing.T) {
+	schemaInfo := getSchemaInfo()
+	values := []int64{-1000, -999, -10, 0, 1, 2, 3, 500, 501, 999, 1000}
+	for _, splitColumn := range []string{"", "id2"} {
+		query := &proto.BoundQuery{
+			Sql: "select * from test_table where count > :count",
+		}
+		splitter := NewQuerySplitter(query, splitColumn, 7, schemaInfo)
+		if err := splitter.validateQuery(); err != nil {
+			t.Fatalf("validateQuery failed: %v", err)
+		}
+		pkMinMax := &mproto.QueryResult{
+			Fields: []mproto.Field{{Name: "min", Type: mproto.VT_LONGLONG}, {Name: "max", Type: mproto.VT_LONGLONG}},
+			Rows:   [][]sqltypes.Value{{buildVal(values[0]), buildVal(values[len(values)-1])}},
+		}
+		splits, err := splitter.split(pkMinMax)
+		if err != nil {
+			t.Fatalf("split failed: %v", err)
+		}
+		if len(splits) != 7 {
+			t.Errorf("got %v splits, want 7", len(splits))
+		}
+		column := splitColumn
+		if column == "" {
+			column = "id"
+		}
+		for _, value := range values {
+			matches := 0
+			for _, split := range splits {
+				lower, upper := splitBounds(t, split.Query.Sql, column)
+				if (lower == nil || value >= *lower) && (upper == nil || value < *upper) {
+					matches++
+				}
+			}
+			if matches != 1 {
+				t.Errorf("split column %v: value %v is in %v splits, want 1: %v", column, value, matches, splits)
+			}
+		}
+	}
+}
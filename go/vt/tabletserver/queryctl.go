@@ -36,8 +36,9 @@ func init() {
 	flag.IntVar(&qsConfig.StreamPoolSize, "queryserver-config-stream-pool-size", DefaultQsConfig.StreamPoolSize, "query server stream pool size, stream pool is used by stream queries: queries that return results to client in a streaming fashion")
 	flag.IntVar(&qsConfig.TransactionCap, "queryserver-config-transaction-cap", DefaultQsConfig.TransactionCap, "query server transaction cap is the maximum number of transactions allowed to happen at any given point of a time for a single vttablet. E.g. by setting transaction cap to 100, there are at most 100 transactions will be processed by a vttablet and the 101th transaction will be blocked (and fail if it cannot get connection within specified timeout)")
 	flag.Float64Var(&qsConfig.TransactionTimeout, "queryserver-config-transaction-timeout", DefaultQsConfig.TransactionTimeout, "query server transaction timeout (in seconds), a transaction will be killed if it takes longer than this value")
-	flag.IntVar(&qsConfig.MaxResultSize, "queryserver-config-max-result-size", DefaultQsConfig.MaxResultSize, "query server max result size, maximum number of rows allowed to return from vttablet for non-streaming queries.")
+	flag.IntVar(&qsConfig.MaxResultSize, "queryserver-config-max-result-size", DefaultQsConfig.MaxResultSize, "query server max result size, maximum number of rows allowed to return from vttablet for non-streaming queries. A select over it fails, or has its result truncated if a query rule with the TRUNCATE action matches it.")
 	flag.IntVar(&qsConfig.MaxDMLRows, "queryserver-config-max-dml-rows", DefaultQsConfig.MaxDMLRows, "query server max dml rows per statement, maximum number of rows allowed to return at a time for an upadte or delete with either 1) an equality where clauses on primary keys, or 2) a subselect statement. For update and delete statements in above two categories, vttablet will split the original query into multiple small queries based on this configuration value. ")
+	flag.IntVar(&qsConfig.PoolMaxCapFactor, "queryserver-config-pool-max-cap-factor", DefaultQsConfig.PoolMaxCapFactor, "query server pool max capacity factor, the connection pools and the transaction pool can be resized at runtime up to this many times their initial size.")
 	flag.IntVar(&qsConfig.StreamBufferSize, "queryserver-config-stream-buffer-size", DefaultQsConfig.StreamBufferSize, "query server stream buffer size, the maximum number of bytes sent from vttablet for each stream call.")
 	flag.IntVar(&qsConfig.QueryCacheSize, "queryserver-config-query-cache-size", DefaultQsConfig.QueryCacheSize, "query server query cache size, maximum number of queries to be cached. vttablet analyzes every incoming query and generate a query plan, these plans are being cached in a lru cache. This config controls the capacity of the lru cache.")
 	flag.Float64Var(&qsConfig.SchemaReloadTime, "queryserver-config-schema-reload-time", DefaultQsConfig.SchemaReloadTime, "query server schema reload time, how often vttablet reloads schemas from underlying MySQL instance in seconds. vttablet keeps table schemas in its own memory and periodically refreshes it from MySQL. This config controls the reload time.")
@@ -45,6 +46,7 @@ func init() {
 	flag.Float64Var(&qsConfig.TxPoolTimeout, "queryserver-config-txpool-timeout", DefaultQsConfig.TxPoolTimeout, "query server transaction pool timeout, it is how long vttablet waits if tx pool is full")
 	flag.Float64Var(&qsConfig.IdleTimeout, "queryserver-config-idle-timeout", DefaultQsConfig.IdleTimeout, "query server idle timeout (in seconds), vttablet manages various mysql connection pools. This config means if a connection has not been used in given idle timeout, this connection will be removed from pool. This effectively manages number of connection objects and optimize the pool performance.")
 	flag.Float64Var(&qsConfig.SpotCheckRatio, "queryserver-config-spot-check-ratio", DefaultQsConfig.SpotCheckRatio, "query server rowcache spot check frequency (in [0, 1]), if rowcache is enabled, this value determines how often a row retrieved from the rowcache is spot-checked against MySQL.")
+	flag.Float64Var(&qsConfig.RowcacheInvalidatorMaxLag, "queryserver-config-rowcache-invalidator-max-lag", DefaultQsConfig.RowcacheInvalidatorMaxLag, "query server rowcache invalidator max lag (in seconds), if the rowcache invalidator is further behind the binlog of MySQL, the rowcache is bypassed until it catches up. 0 never bypasses it.")
 	flag.BoolVar(&qsConfig.StrictMode, "queryserver-config-strict-mode", DefaultQsConfig.StrictMode, "allow only predictable DMLs and enforces MySQL's STRICT_TRANS_TABLES")
 	flag.BoolVar(&qsConfig.StrictTableAcl, "queryserver-config-strict-table-acl", DefaultQsConfig.StrictTableAcl, "only allow queries that pass table acl checks")
 	flag.BoolVar(&qsConfig.TerseErrors, "queryserver-config-terse-errors", DefaultQsConfig.TerseErrors, "prevent bind vars from escaping in returned errors")
@@ -99,28 +101,30 @@ func (c *RowCacheConfig) GetSubprocessFlags(socket string) []string {
 
 // Config contains all the configuration for query service
 type Config struct {
-	PoolSize           int
-	StreamPoolSize     int
-	TransactionCap     int
-	TransactionTimeout float64
-	MaxResultSize      int
-	MaxDMLRows         int
-	StreamBufferSize   int
-	QueryCacheSize     int
-	SchemaReloadTime   float64
-	QueryTimeout       float64
-	TxPoolTimeout      float64
-	IdleTimeout        float64
-	RowCache           RowCacheConfig
-	SpotCheckRatio     float64
-	StrictMode         bool
-	StrictTableAcl     bool
-	TerseErrors        bool
-	EnablePublishStats bool
-	EnableAutoCommit   bool
-	StatsPrefix        string
-	DebugURLPrefix     string
-	PoolNamePrefix     string
+	PoolSize                  int
+	StreamPoolSize            int
+	TransactionCap            int
+	TransactionTimeout        float64
+	PoolMaxCapFactor          int
+	MaxResultSize             int
+	MaxDMLRows                int
+	StreamBufferSize          int
+	QueryCacheSize            int
+	SchemaReloadTime          float64
+	QueryTimeout              float64
+	TxPoolTimeout             float64
+	IdleTimeout               float64
+	RowCache                  RowCacheConfig
+	SpotCheckRatio            float64
+	RowcacheInvalidatorMaxLag float64
+	StrictMode                bool
+	StrictTableAcl            bool
+	TerseErrors               bool
+	EnablePublishStats        bool
+	EnableAutoCommit          bool
+	StatsPrefix               string
+	DebugURLPrefix            string
+	PoolNamePrefix            string
 }
 
 // DefaultQSConfig is the default value for the query service config.
@@ -132,28 +136,30 @@ type Config struct {
 // great (the overhead makes the final packets on the wire about twice
 // bigger than this).
 var DefaultQsConfig = Config{
-	PoolSize:           16,
-	StreamPoolSize:     750,
-	TransactionCap:     20,
-	TransactionTimeout: 30,
-	MaxResultSize:      10000,
-	MaxDMLRows:         500,
-	QueryCacheSize:     5000,
-	SchemaReloadTime:   30 * 60,
-	QueryTimeout:       0,
-	TxPoolTimeout:      1,
-	IdleTimeout:        30 * 60,
-	StreamBufferSize:   32 * 1024,
-	RowCache:           RowCacheConfig{Memory: -1, Connections: -1, Threads: -1},
-	SpotCheckRatio:     0,
-	StrictMode:         true,
-	StrictTableAcl:     false,
-	TerseErrors:        false,
-	EnablePublishStats: true,
-	EnableAutoCommit:   false,
-	StatsPrefix:        "",
-	DebugURLPrefix:     "/debug",
-	PoolNamePrefix:     "",
+	PoolSize:                  16,
+	StreamPoolSize:            750,
+	TransactionCap:            20,
+	TransactionTimeout:        30,
+	PoolMaxCapFactor:          4,
+	MaxResultSize:             10000,
+	MaxDMLRows:                500,
+	QueryCacheSize:            5000,
+	SchemaReloadTime:          30 * 60,
+	QueryTimeout:              0,
+	TxPoolTimeout:             1,
+	IdleTimeout:               30 * 60,
+	StreamBufferSize:          32 * 1024,
+	RowCache:                  RowCacheConfig{Memory: -1, Connections: -1, Threads: -1},
+	SpotCheckRatio:            0,
+	RowcacheInvalidatorMaxLag: 30,
+	StrictMode:                true,
+	StrictTableAcl:            false,
+	TerseErrors:               false,
+	EnablePublishStats:        true,
+	EnableAutoCommit:          false,
+	StatsPrefix:               "",
+	DebugURLPrefix:            "/debug",
+	PoolNamePrefix:            "",
 }
 
 var qsConfig Config
@@ -188,6 +194,13 @@ type QueryServiceControl interface {
 	// QueryService returns the QueryService object used by this
 	// QueryServiceControl
 	QueryService() queryservice.QueryService
+
+	// RuntimeStats returns a snapshot of the query service activity
+	RuntimeStats() proto.RuntimeStats
+
+	// SetPoolSize resizes one of the connection pools (AppPool,
+	// StreamPool or TransactionPool)
+	SetPoolSize(pool string, size int) error
 }
 
 // TestQueryServiceControl is a fake version of QueryServiceControl
@@ -203,6 +216,15 @@ type TestQueryServiceControl struct {
 
 	// ReloadSchemaCount counts how many times ReloadSchema was called
 	ReloadSchemaCount int
+
+	// RuntimeStatsResult is the return value for RuntimeStats
+	RuntimeStatsResult proto.RuntimeStats
+
+	// PoolSizes has the sizes set by SetPoolSize
+	PoolSizes map[string]int
+
+	// SetPoolSizeError is the return value for SetPoolSize
+	SetPoolSizeError error
 }
 
 // NewTestQueryServiceControl returns an implementation of QueryServiceControl
@@ -260,6 +282,23 @@ func (tqsc *TestQueryServiceControl) QueryService() queryservice.QueryService {
 	return nil
 }
 
+// RuntimeStats is part of the QueryServiceControl interface
+func (tqsc *TestQueryServiceControl) RuntimeStats() proto.RuntimeStats {
+	return tqsc.RuntimeStatsResult
+}
+
+// SetPoolSize is part of the QueryServiceControl interface
+func (tqsc *TestQueryServiceControl) SetPoolSize(pool string, size int) error {
+	if tqsc.SetPoolSizeError != nil {
+		return tqsc.SetPoolSizeError
+	}
+	if tqsc.PoolSizes == nil {
+		tqsc.PoolSizes = make(map[string]int)
+	}
+	tqsc.PoolSizes[pool] = size
+	return nil
+}
+
 // realQueryServiceControl implements QueryServiceControl for real
 type realQueryServiceControl struct {
 	sqlQueryRPCService *SqlQuery
@@ -359,6 +398,32 @@ func (rqsc *realQueryServiceControl) QueryService() queryservice.QueryService {
 	return rqsc.sqlQueryRPCService
 }
 
+// RuntimeStats is part of the QueryServiceControl interface
+func (rqsc *realQueryServiceControl) RuntimeStats() proto.RuntimeStats {
+	qe := rqsc.sqlQueryRPCService.qe
+	rs := proto.RuntimeStats{
+		QPS: make(map[string]float64),
+	}
+	for name, rates := range qe.queryServiceStats.QPSRates.Get() {
+		if len(rates) > 0 {
+			rs.QPS[name] = rates[len(rates)-1]
+		}
+	}
+	for _, count := range qe.queryServiceStats.ErrorStats.Counts() {
+		rs.ErrorCount += count
+	}
+	for _, pool := range []*ConnPool{qe.connPool, qe.streamConnPool} {
+		rs.ConnectionsCapacity += pool.Capacity()
+		rs.ConnectionsInUse += pool.InUse()
+	}
+	return rs
+}
+
+// SetPoolSize is part of the QueryServiceControl interface
+func (rqsc *realQueryServiceControl) SetPoolSize(pool string, size int) error {
+	return rqsc.sqlQueryRPCService.qe.SetPoolSize(pool, size)
+}
+
 // IsHealthy returns nil if the query service is healthy (able to
 // connect to the database and serving traffic) or an error explaining
 // the unhealthiness otherwise.
@@ -26,16 +26,36 @@ import (
 
 // RowcacheInvalidator runs the service to invalidate
 // the rowcache based on binlog events.
+//
+// Its position is a checkpoint of the transactions it has fully
+// invalidated. It is taken from mysqld before the rowcache starts,
+// since the rowcache starts empty, and the binlog streaming restarts
+// from it after an error. Every second, the position of mysqld is
+// compared to it: if the invalidator hasn't caught up with a position
+// of mysqld for more than maxLag, the rowcache is bypassed (see
+// FailOpen) until it has.
 type RowcacheInvalidator struct {
 	qe     *QueryEngine
 	dbname string
 	mysqld *mysqlctl.Mysqld
+	maxLag time.Duration
 
 	svm sync2.ServiceManager
 
+	// posMutex protects pos and the catch up fields below
 	posMutex   sync.Mutex
 	pos        myproto.ReplicationPosition
 	lagSeconds sync2.AtomicInt64
+
+	// target is a position of mysqld the invalidator hasn't reached
+	// yet, seen at targetTime. caughtUp is the last time mysqld was
+	// at a position the invalidator has reached.
+	target     myproto.ReplicationPosition
+	targetTime time.Time
+	caughtUp   time.Time
+
+	failOpen      sync2.AtomicInt64
+	invalidations *stats.Counters
 }
 
 // AppendGTID updates the current replication position by appending a GTID to
@@ -44,6 +64,10 @@ func (rci *RowcacheInvalidator) AppendGTID(gtid myproto.GTID) {
 	rci.posMutex.Lock()
 	defer rci.posMutex.Unlock()
 	rci.pos = myproto.AppendGTID(rci.pos, gtid)
+	if !rci.targetTime.IsZero() && rci.pos.AtLeast(rci.target) {
+		rci.caughtUp = rci.targetTime
+		rci.targetTime = time.Time{}
+	}
 }
 
 // SetPosition sets the current ReplicationPosition.
@@ -53,6 +77,55 @@ func (rci *RowcacheInvalidator) SetPosition(rp myproto.ReplicationPosition) {
 	rci.pos = rp
 }
 
+// Checkpoint sets the position to the current one of mysqld. It has
+// to be called before the rowcache is opened.
+func (rci *RowcacheInvalidator) Checkpoint(mysqld *mysqlctl.Mysqld) {
+	now := time.Now()
+	rp, err := mysqld.MasterPosition()
+	if err != nil {
+		panic(NewTabletError(ErrFatal, "Rowcache invalidator aborting: cannot determine replication position: %v", err))
+	}
+	rci.posMutex.Lock()
+	defer rci.posMutex.Unlock()
+	rci.pos = rp
+	rci.targetTime = time.Time{}
+	rci.caughtUp = now
+}
+
+// updateLag records that mysqld was at position mysqldPos at now, and
+// returns how far behind the invalidator is.
+func (rci *RowcacheInvalidator) updateLag(now time.Time, mysqldPos myproto.ReplicationPosition) time.Duration {
+	rci.posMutex.Lock()
+	defer rci.posMutex.Unlock()
+	if rci.pos.AtLeast(mysqldPos) {
+		rci.caughtUp = now
+		rci.targetTime = time.Time{}
+	} else if rci.targetTime.IsZero() {
+		rci.target = mysqldPos
+		rci.targetTime = now
+	}
+	return now.Sub(rci.caughtUp)
+}
+
+// Behind returns how long ago mysqld was last at a position the
+// invalidator has reached, 0 if it is not running.
+func (rci *RowcacheInvalidator) Behind() time.Duration {
+	if rci.svm.State() != sync2.SERVICE_RUNNING {
+		return 0
+	}
+	rci.posMutex.Lock()
+	defer rci.posMutex.Unlock()
+	return time.Since(rci.caughtUp)
+}
+
+// FailOpen returns true if the invalidator is more than maxLag behind.
+// The rowcache is then neither read nor filled, and the queries go to
+// MySQL. The invalidations keep being applied, so the rowcache can be
+// used again once the invalidator has caught up.
+func (rci *RowcacheInvalidator) FailOpen() bool {
+	return rci.failOpen.Get() != 0
+}
+
 // Position returns the current ReplicationPosition.
 func (rci *RowcacheInvalidator) Position() myproto.ReplicationPosition {
 	rci.posMutex.Lock()
@@ -67,45 +140,67 @@ func (rci *RowcacheInvalidator) PositionString() string {
 
 // NewRowcacheInvalidator creates a new RowcacheInvalidator.
 // Just like QueryEngine, this is a singleton class.
-// You must call this only once.
-func NewRowcacheInvalidator(statsPrefix string, qe *QueryEngine, enablePublishStats bool) *RowcacheInvalidator {
-	rci := &RowcacheInvalidator{qe: qe}
+// You must call this only once. A maxLag of 0 never bypasses the
+// rowcache.
+func NewRowcacheInvalidator(statsPrefix string, qe *QueryEngine, maxLag time.Duration, enablePublishStats bool) *RowcacheInvalidator {
+	rci := &RowcacheInvalidator{qe: qe, maxLag: maxLag}
+	// The totals by table are already in RowcacheInvalidations,
+	// so invalidations only feeds the rates.
+	invalidationRatesName := ""
+	if enablePublishStats {
+		invalidationRatesName = statsPrefix + "RowcacheInvalidationRates"
+	}
+	rci.invalidations = stats.NewCounters("")
+	stats.NewRates(invalidationRatesName, rci.invalidations, 15, 60*time.Second)
 	if enablePublishStats {
 		stats.Publish(statsPrefix+"RowcacheInvalidatorState", stats.StringFunc(rci.svm.StateName))
 		stats.Publish(statsPrefix+"RowcacheInvalidatorPosition", stats.StringFunc(rci.PositionString))
 		stats.Publish(statsPrefix+"RowcacheInvalidatorLagSeconds", stats.IntFunc(rci.lagSeconds.Get))
+		stats.Publish(statsPrefix+"RowcacheInvalidatorBehindSeconds", stats.IntFunc(func() int64 {
+			return int64(rci.Behind().Seconds())
+		}))
+		stats.Publish(statsPrefix+"RowcacheInvalidatorFailOpen", stats.IntFunc(rci.failOpen.Get))
 	}
 	return rci
 }
 
-// Open runs the invalidation loop.
+// Open runs the invalidation loop, from the position of the last
+// Checkpoint.
 func (rci *RowcacheInvalidator) Open(dbname string, mysqld *mysqlctl.Mysqld) {
-	rp, err := mysqld.MasterPosition()
-	if err != nil {
-		panic(NewTabletError(ErrFatal, "Rowcache invalidator aborting: cannot determine replication position: %v", err))
+	if rci.Position().IsZero() {
+		rci.Checkpoint(mysqld)
 	}
 	if mysqld.Cnf().BinLogPath == "" {
 		panic(NewTabletError(ErrFatal, "Rowcache invalidator aborting: binlog path not specified"))
 	}
 	rci.dbname = dbname
 	rci.mysqld = mysqld
-	rci.SetPosition(rp)
 
 	ok := rci.svm.Go(rci.run)
 	if ok {
-		log.Infof("Rowcache invalidator starting, dbname: %s, path: %s, position: %v", dbname, mysqld.Cnf().BinLogPath, rp)
+		log.Infof("Rowcache invalidator starting, dbname: %s, path: %s, position: %v", dbname, mysqld.Cnf().BinLogPath, rci.Position())
 	} else {
 		log.Infof("Rowcache invalidator already running")
 	}
 }
 
 // Close terminates the invalidation loop. It returns only of the
-// loop has terminated.
+// loop has terminated. The next Open needs a new Checkpoint.
 func (rci *RowcacheInvalidator) Close() {
 	rci.svm.Stop()
+	rci.failOpen.Set(0)
+	rci.SetPosition(myproto.ReplicationPosition{})
 }
 
 func (rci *RowcacheInvalidator) run(ctx *sync2.ServiceContext) error {
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		rci.trackLag(ctx)
+	}()
+	defer wg.Wait()
+
 	for {
 		evs := binlog.NewEventStreamer(rci.dbname, rci.mysqld, rci.Position(), rci.processEvent)
 		// We wrap this code in a func so we can catch all panics.
@@ -133,6 +228,38 @@ func (rci *RowcacheInvalidator) run(ctx *sync2.ServiceContext) error {
 	return nil
 }
 
+// trackLag compares the position of mysqld to the one of the
+// invalidator every second, and sets failOpen.
+func (rci *RowcacheInvalidator) trackLag(ctx *sync2.ServiceContext) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.ShuttingDown:
+			return
+		case <-ticker.C:
+		}
+		mysqldPos, err := rci.mysqld.MasterPosition()
+		if err != nil {
+			// the invalidator falls behind while mysqld is down
+			log.Warningf("Rowcache invalidator cannot get the position of mysqld: %v", err)
+			rci.updateFailOpen(rci.Behind())
+			continue
+		}
+		rci.updateFailOpen(rci.updateLag(time.Now(), mysqldPos))
+	}
+}
+
+func (rci *RowcacheInvalidator) updateFailOpen(behind time.Duration) {
+	failOpen := rci.maxLag > 0 && behind > rci.maxLag
+	switch {
+	case failOpen && rci.failOpen.CompareAndSwap(0, 1):
+		log.Warningf("Rowcache invalidator is %v behind mysqld, bypassing the rowcache", behind)
+	case !failOpen && rci.failOpen.CompareAndSwap(1, 0):
+		log.Infof("Rowcache invalidator caught up with mysqld, using the rowcache again")
+	}
+}
+
 func (rci *RowcacheInvalidator) handleInvalidationError(event *blproto.StreamEvent) {
 	if x := recover(); x != nil {
 		terr, ok := x.(*TabletError)
@@ -197,6 +324,7 @@ func (rci *RowcacheInvalidator) handleDMLEvent(event *blproto.StreamEvent) {
 		invalidations++
 	}
 	tableInfo.invalidations.Add(invalidations)
+	rci.invalidations.Add(event.TableName, invalidations)
 }
 
 func (rci *RowcacheInvalidator) handleDDLEvent(ddl string) {
@@ -0,0 +1,54 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tabletserver
+
+import (
+	"testing"
+	"time"
+
+	myproto "github.com/youtube/vitess/go/vt/mysqlctl/proto"
+)
+
+func TestRowcacheInvalidatorLag(t *testing.T) {
+	rci := NewRowcacheInvalidator("", nil, 10*time.Second, false)
+	start := time.Now()
+	rci.SetPosition(myproto.MustParseReplicationPosition("MariaDB", "0-1-5"))
+	rci.caughtUp = start
+
+	// mysqld is at the position of the invalidator
+	if behind := rci.updateLag(start.Add(time.Second), myproto.MustParseReplicationPosition("MariaDB", "0-1-5")); behind != 0 {
+		t.Errorf("behind: %v, want 0", behind)
+	}
+	// mysqld moves on, the invalidator is behind from the last time
+	// it was caught up
+	rci.updateLag(start.Add(2*time.Second), myproto.MustParseReplicationPosition("MariaDB", "0-1-8"))
+	if behind := rci.updateLag(start.Add(5*time.Second), myproto.MustParseReplicationPosition("MariaDB", "0-1-9")); behind != 4*time.Second {
+		t.Errorf("behind: %v, want 4s", behind)
+	}
+	rci.updateFailOpen(11 * time.Second)
+	if !rci.FailOpen() {
+		t.Errorf("FailOpen should be true over maxLag")
+	}
+	// reaching the first target catches up to the time it was seen
+	rci.AppendGTID(myproto.MustParseGTID("MariaDB", "0-1-8"))
+	if behind := rci.updateLag(start.Add(6*time.Second), myproto.MustParseReplicationPosition("MariaDB", "0-1-10")); behind != 4*time.Second {
+		t.Errorf("behind: %v, want 4s", behind)
+	}
+	rci.AppendGTID(myproto.MustParseGTID("MariaDB", "0-1-10"))
+	if behind := rci.updateLag(start.Add(7*time.Second), myproto.MustParseReplicationPosition("MariaDB", "0-1-10")); behind != 0 {
+		t.Errorf("behind: %v, want 0", behind)
+	}
+	rci.updateFailOpen(0)
+	if rci.FailOpen() {
+		t.Errorf("FailOpen should be false once caught up")
+	}
+
+	// without a max lag, the rowcache is never bypassed
+	rci.maxLag = 0
+	rci.updateFailOpen(time.Hour)
+	if rci.FailOpen() {
+		t.Errorf("FailOpen should be false without a max lag")
+	}
+}
@@ -21,8 +21,6 @@ import (
 	"github.com/youtube/vitess/go/stats"
 	"github.com/youtube/vitess/go/timer"
 	"github.com/youtube/vitess/go/vt/schema"
-	"github.com/youtube/vitess/go/vt/tableacl"
-	tacl "github.com/youtube/vitess/go/vt/tableacl/acl"
 	"github.com/youtube/vitess/go/vt/tabletserver/planbuilder"
 	"golang.org/x/net/context"
 )
@@ -42,10 +40,9 @@ const (
 // and track stats.
 type ExecPlan struct {
 	*planbuilder.ExecPlan
-	TableInfo  *TableInfo
-	Fields     []mproto.Field
-	Rules      *QueryRules
-	Authorized tacl.ACL
+	TableInfo *TableInfo
+	Fields    []mproto.Field
+	Rules     *QueryRules
 
 	mu         sync.Mutex
 	QueryCount int64
@@ -123,7 +120,7 @@ func NewSchemaInfo(
 	queryServiceStats *QueryServiceStats) *SchemaInfo {
 	si := &SchemaInfo{
 		queries:    cache.NewLRUCache(int64(queryCacheSize)),
-		connPool:   NewConnPool("", 2, idleTimeout, enablePublishStats, queryServiceStats),
+		connPool:   NewConnPool("", 2, 2, idleTimeout, enablePublishStats, queryServiceStats),
 		ticks:      timer.NewTimer(reloadTime),
 		endpoints:  endpoints,
 		reloadTime: reloadTime,
@@ -396,7 +393,6 @@ func (si *SchemaInfo) GetPlan(ctx context.Context, logStats *SQLQueryStats, sql
 	}
 	plan := &ExecPlan{ExecPlan: splan, TableInfo: tableInfo}
 	plan.Rules = QueryRuleSources.filterByPlan(sql, plan.PlanId, plan.TableName)
-	plan.Authorized = tableacl.Authorized(plan.TableName, plan.PlanId.MinRole())
 	if plan.PlanId.IsSelect() {
 		if plan.FieldQuery == nil {
 			log.Warningf("Cannot cache field info: %s", sql)
@@ -438,7 +434,6 @@ func (si *SchemaInfo) GetStreamPlan(sql string) *ExecPlan {
 	}
 	plan := &ExecPlan{ExecPlan: splan, TableInfo: tableInfo}
 	plan.Rules = QueryRuleSources.filterByPlan(sql, plan.PlanId, plan.TableName)
-	plan.Authorized = tableacl.Authorized(plan.TableName, plan.PlanId.MinRole())
 	return plan
 }
 
@@ -20,6 +20,7 @@ import (
 	"github.com/youtube/vitess/go/vt/dbconnpool"
 	"github.com/youtube/vitess/go/vt/mysqlctl"
 	"github.com/youtube/vitess/go/vt/tabletserver/proto"
+	"github.com/youtube/vitess/go/vt/vterrors"
 	"golang.org/x/net/context"
 )
 
@@ -333,12 +334,14 @@ func (sq *SqlQuery) handleExecError(query *proto.Query, err *error, logStats *SQ
 		terr, ok := x.(*TabletError)
 		if !ok {
 			log.Errorf("Uncaught panic for %v:\n%v\n%s", query, x, tb.Stack(4))
-			*err = NewTabletError(ErrFail, "%v: uncaught panic for %v", x, query)
+			terr := NewTabletError(ErrFail, "%v: uncaught panic for %v", x, query)
+			terr.Code = vterrors.Internal
+			*err = terr
 			sq.qe.queryServiceStats.InternalErrors.Add("Panic", 1)
 			return
 		}
 		if sq.config.TerseErrors && terr.SqlError != 0 {
-			*err = fmt.Errorf("%s(errno %d) during query: %s", terr.Prefix(), terr.SqlError, query.Sql)
+			*err = vterrors.FromError(vterrors.ErrorCode(terr.ErrorCode()), fmt.Errorf("%s(errno %d) during query: %s", terr.Prefix(), terr.SqlError, query.Sql))
 		} else {
 			*err = terr
 		}
@@ -535,7 +538,7 @@ func (sq *SqlQuery) SplitQuery(ctx context.Context, req *proto.SplitQueryRequest
 // HandlePanic is part of the queryservice.QueryService interface
 func (sq *SqlQuery) HandlePanic(err *error) {
 	if x := recover(); x != nil {
-		*err = fmt.Errorf("uncaught panic: %v", x)
+		*err = vterrors.Errorf(vterrors.Internal, "uncaught panic: %v", x)
 	}
 }
 
@@ -15,6 +15,7 @@ import (
 	"github.com/youtube/vitess/go/mysql"
 	"github.com/youtube/vitess/go/tb"
 	"github.com/youtube/vitess/go/vt/logutil"
+	"github.com/youtube/vitess/go/vt/vterrors"
 )
 
 const (
@@ -48,6 +49,9 @@ type TabletError struct {
 	ErrorType int
 	Message   string
 	SqlError  int
+	// Code, if set, overrides the code derived from ErrorType and
+	// SqlError.
+	Code vterrors.ErrorCode
 }
 
 // This is how go-mysql exports its error number
@@ -145,6 +149,47 @@ func (te *TabletError) Prefix() string {
 	return prefix
 }
 
+// ErrorCode returns the vterrors code of the error, that is sent to
+// the clients with it.
+func (te *TabletError) ErrorCode() int64 {
+	if te.Code != vterrors.Unknown {
+		return int64(te.Code)
+	}
+	return int64(te.vtErrorCode())
+}
+
+func (te *TabletError) vtErrorCode() vterrors.ErrorCode {
+	if te.SqlError == mysql.ErrServerLost {
+		// the query was killed, because it timed out or was canceled
+		return vterrors.DeadlineExceeded
+	}
+	// the types are about this tablet, or this transaction: the
+	// clients use their codes to know if the query was executed, and
+	// where it can be sent again
+	switch te.ErrorType {
+	case ErrRetry:
+		return vterrors.QueryNotServed
+	case ErrFatal:
+		return vterrors.Unavailable
+	case ErrTxPoolFull:
+		return vterrors.ResourceExhausted
+	case ErrNotInTx:
+		return vterrors.NotInTx
+	}
+	switch te.SqlError {
+	case 0:
+		return vterrors.BadInput
+	case mysql.ErrDupEntry:
+		return vterrors.IntegrityError
+	case mysql.ErrLockWaitTimeout, mysql.ErrLockDeadlock:
+		return vterrors.Transient
+	}
+	if te.SqlError >= 2000 && te.SqlError <= 2018 {
+		return vterrors.Transient
+	}
+	return vterrors.BadInput
+}
+
 // RecordStats will record the error in the proper stat bucket
 func (te *TabletError) RecordStats(queryServiceStats *QueryServiceStats) {
 	switch te.ErrorType {
@@ -173,7 +218,9 @@ func handleError(err *error, logStats *SQLQueryStats, queryServiceStats *QuerySe
 		terr, ok := x.(*TabletError)
 		if !ok {
 			log.Errorf("Uncaught panic:\n%v\n%s", x, tb.Stack(4))
-			*err = NewTabletError(ErrFail, "%v: uncaught panic", x)
+			terr := NewTabletError(ErrFail, "%v: uncaught panic", x)
+			terr.Code = vterrors.Internal
+			*err = terr
 			queryServiceStats.InternalErrors.Add("Panic", 1)
 			return
 		}
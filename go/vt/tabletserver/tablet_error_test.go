@@ -10,6 +10,7 @@ import (
 
 	"github.com/youtube/vitess/go/mysql"
 	"github.com/youtube/vitess/go/sqldb"
+	"github.com/youtube/vitess/go/vt/vterrors"
 	"golang.org/x/net/context"
 )
 
@@ -93,6 +94,30 @@ func TestTabletErrorPrefix(t *testing.T) {
 	}
 }
 
+func TestTabletErrorCode(t *testing.T) {
+	testcases := []struct {
+		err  *TabletError
+		want vterrors.ErrorCode
+	}{
+		{NewTabletError(ErrFail, "syntax error"), vterrors.BadInput},
+		{NewTabletErrorSql(ErrFail, sqldb.NewSqlError(mysql.ErrDupEntry, "dup")), vterrors.IntegrityError},
+		{NewTabletErrorSql(ErrFail, sqldb.NewSqlError(mysql.ErrLockDeadlock, "deadlock")), vterrors.Transient},
+		{NewTabletErrorSql(ErrFail, sqldb.NewSqlError(1054, "unknown column")), vterrors.BadInput},
+		{NewTabletErrorSql(ErrFatal, sqldb.NewSqlError(mysql.ErrServerLost, "killed")), vterrors.DeadlineExceeded},
+		{NewTabletErrorSql(ErrFatal, sqldb.NewSqlError(mysql.ErrOptionPreventsStatement, "read-only")), vterrors.QueryNotServed},
+		{NewTabletError(ErrRetry, "not serving"), vterrors.QueryNotServed},
+		{NewTabletError(ErrTxPoolFull, "pool full"), vterrors.ResourceExhausted},
+		{NewTabletError(ErrNotInTx, "not in tx"), vterrors.NotInTx},
+		{NewTabletError(ErrFatal, "pool closed"), vterrors.Unavailable},
+		{&TabletError{ErrorType: ErrFail, Message: "denied", Code: vterrors.Unauthenticated}, vterrors.Unauthenticated},
+	}
+	for _, tcase := range testcases {
+		if got := vterrors.RecoverCode(tcase.err); got != tcase.want {
+			t.Errorf("code of %v: %v, want %v", tcase.err, got, tcase.want)
+		}
+	}
+}
+
 func TestTabletErrorRecordStats(t *testing.T) {
 	tabletErr := NewTabletErrorSql(ErrRetry, sqldb.NewSqlError(2000, "test"))
 	queryServiceStats := NewQueryServiceStats("", false)
@@ -12,6 +12,7 @@ import (
 	mproto "github.com/youtube/vitess/go/mysql/proto"
 	tproto "github.com/youtube/vitess/go/vt/tabletserver/proto"
 	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/vt/vterrors"
 	"golang.org/x/net/context"
 )
 
@@ -33,14 +34,45 @@ var (
 )
 
 // ServerError represents an error that was returned from
-// a vttablet server.
+// a vttablet server. Code tells the connection what to do with the
+// tablet, ServerCode what the caller can do with the error.
 type ServerError struct {
-	Code int
-	Err  string
+	Code       int
+	ServerCode vterrors.ErrorCode
+	Err        string
 }
 
 func (e *ServerError) Error() string { return e.Err }
 
+// serverCodes are the vterrors codes vttablet sends with the errors
+// of each Code.
+var serverCodes = map[int]vterrors.ErrorCode{
+	ERR_RETRY:        vterrors.QueryNotServed,
+	ERR_FATAL:        vterrors.Unavailable,
+	ERR_TX_POOL_FULL: vterrors.ResourceExhausted,
+	ERR_NOT_IN_TX:    vterrors.NotInTx,
+}
+
+// CodeFromServerCode returns the Code of a ServerError that came with
+// the vterrors code serverCode.
+func CodeFromServerCode(serverCode vterrors.ErrorCode) int {
+	for code, c := range serverCodes {
+		if c == serverCode {
+			return code
+		}
+	}
+	return ERR_NORMAL
+}
+
+// ErrorCode returns the vterrors code of the error. Without a
+// ServerCode, it is the code vttablet sends with Code.
+func (e *ServerError) ErrorCode() int64 {
+	if e.ServerCode == vterrors.Unknown {
+		return int64(serverCodes[e.Code])
+	}
+	return int64(e.ServerCode)
+}
+
 // OperationalError represents an error due to a failure to
 // communicate with vttablet.
 type OperationalError string
@@ -83,8 +115,9 @@ type TabletConn interface {
 	EndPoint() topo.EndPoint
 
 	// SplitQuery splits a query into equally sized smaller queries by
-	// appending primary key range clauses to the original query
-	SplitQuery(context context.Context, query tproto.BoundQuery, splitCount int) ([]tproto.QuerySplit, error)
+	// appending range clauses on splitColumn to the original query.
+	// If splitColumn is empty, the first primary key column is used.
+	SplitQuery(context context.Context, query tproto.BoundQuery, splitColumn string, splitCount int) ([]tproto.QuerySplit, error)
 }
 
 type ErrFunc func() error
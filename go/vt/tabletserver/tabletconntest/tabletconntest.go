@@ -16,6 +16,7 @@ import (
 	"github.com/youtube/vitess/go/sqltypes"
 	"github.com/youtube/vitess/go/vt/tabletserver/proto"
 	"github.com/youtube/vitess/go/vt/tabletserver/tabletconn"
+	"github.com/youtube/vitess/go/vt/vterrors"
 	"golang.org/x/net/context"
 )
 
@@ -24,12 +25,15 @@ type FakeQueryService struct {
 	t                        *testing.T
 	panics                   bool
 	streamExecutePanicsEarly bool
+	// streamExecuteBlock, if set, blocks StreamExecute after
+	// the first result, until it is closed.
+	streamExecuteBlock chan struct{}
 }
 
 // HandlePanic is part of the queryservice.QueryService interface
 func (f *FakeQueryService) HandlePanic(err *error) {
 	if x := recover(); x != nil {
-		*err = fmt.Errorf("caught test panic: %v", x)
+		*err = vterrors.Errorf(vterrors.Internal, "caught test panic: %v", x)
 	}
 }
 
@@ -84,9 +88,13 @@ func testBegin(t *testing.T, conn tabletconn.TabletConn) {
 
 func testBeginPanics(t *testing.T, conn tabletconn.TabletConn) {
 	ctx := context.Background()
-	if _, err := conn.Begin(ctx); err == nil || !strings.Contains(err.Error(), "caught test panic") {
+	_, err := conn.Begin(ctx)
+	if err == nil || !strings.Contains(err.Error(), "caught test panic") {
 		t.Fatalf("unexpected panic error: %v", err)
 	}
+	if code := vterrors.RecoverCode(err); code != vterrors.Internal {
+		t.Errorf("unexpected code of the panic error: %v, want %v", code, vterrors.Internal)
+	}
 }
 
 // Commit is part of the queryservice.QueryService interface
@@ -253,6 +261,9 @@ func (f *FakeQueryService) StreamExecute(ctx context.Context, query *proto.Query
 		<-panicWait
 		panic(fmt.Errorf("test-triggered panic late"))
 	}
+	if f.streamExecuteBlock != nil {
+		<-f.streamExecuteBlock
+	}
 	if err := sendReply(&streamExecuteQueryResult2); err != nil {
 		f.t.Errorf("sendReply2 failed: %v", err)
 	}
@@ -329,6 +340,33 @@ func testStreamExecute(t *testing.T, conn tabletconn.TabletConn) {
 	}
 }
 
+func testStreamExecuteCancel(t *testing.T, conn tabletconn.TabletConn, fake *FakeQueryService) {
+	t.Log("testStreamExecuteCancel")
+	fake.streamExecuteBlock = make(chan struct{})
+	defer func() {
+		close(fake.streamExecuteBlock)
+		fake.streamExecuteBlock = nil
+	}()
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, errFunc, err := conn.StreamExecute(ctx, streamExecuteQuery, streamExecuteBindVars, streamExecuteTransactionId)
+	if err != nil {
+		t.Fatalf("StreamExecute failed: %v", err)
+	}
+	if _, ok := <-stream; !ok {
+		t.Fatalf("StreamExecute failed: cannot read result1")
+	}
+
+	// the server is blocked before sending result2, the stream
+	// has to end right after the context is cancelled
+	cancel()
+	if _, ok := <-stream; ok {
+		t.Fatalf("StreamExecute returned more results after cancel")
+	}
+	if err := errFunc(); err != tabletconn.Cancelled {
+		t.Fatalf("StreamExecute errFunc after cancel: got %v expected %v", err, tabletconn.Cancelled)
+	}
+}
+
 func testStreamExecutePanics(t *testing.T, conn tabletconn.TabletConn, fake *FakeQueryService) {
 	// early panic is before sending the Fields, that is returned
 	// by the StreamExecute call itself
@@ -464,6 +502,9 @@ func (f *FakeQueryService) SplitQuery(ctx context.Context, req *proto.SplitQuery
 	if !reflect.DeepEqual(req.Query, splitQueryBoundQuery) {
 		f.t.Errorf("invalid SplitQuery.SplitQueryRequest.Query: got %v expected %v", req.Query, splitQueryBoundQuery)
 	}
+	if req.SplitColumn != splitQuerySplitColumn {
+		f.t.Errorf("invalid SplitQuery.SplitQueryRequest.SplitColumn: got %v expected %v", req.SplitColumn, splitQuerySplitColumn)
+	}
 	if req.SplitCount != splitQuerySplitCount {
 		f.t.Errorf("invalid SplitQuery.SplitQueryRequest.SplitCount: got %v expected %v", req.SplitCount, splitQuerySplitCount)
 	}
@@ -478,6 +519,8 @@ var splitQueryBoundQuery = proto.BoundQuery{
 	},
 }
 
+const splitQuerySplitColumn = "nonPKCol"
+
 const splitQuerySplitCount = 372
 
 var splitQueryQuerySplitList = []proto.QuerySplit{
@@ -496,7 +539,7 @@ var splitQueryQuerySplitList = []proto.QuerySplit{
 func testSplitQuery(t *testing.T, conn tabletconn.TabletConn) {
 	t.Log("testSplitQuery")
 	ctx := context.Background()
-	qsl, err := conn.SplitQuery(ctx, splitQueryBoundQuery, splitQuerySplitCount)
+	qsl, err := conn.SplitQuery(ctx, splitQueryBoundQuery, splitQuerySplitColumn, splitQuerySplitCount)
 	if err != nil {
 		t.Fatalf("SplitQuery failed: %v", err)
 	}
@@ -507,7 +550,7 @@ func testSplitQuery(t *testing.T, conn tabletconn.TabletConn) {
 
 func testSplitQueryPanics(t *testing.T, conn tabletconn.TabletConn) {
 	ctx := context.Background()
-	if _, err := conn.SplitQuery(ctx, splitQueryBoundQuery, splitQuerySplitCount); err == nil || !strings.Contains(err.Error(), "caught test panic") {
+	if _, err := conn.SplitQuery(ctx, splitQueryBoundQuery, splitQuerySplitColumn, splitQuerySplitCount); err == nil || !strings.Contains(err.Error(), "caught test panic") {
 		t.Fatalf("unexpected panic error: %v", err)
 	}
 }
@@ -528,6 +571,7 @@ func TestSuite(t *testing.T, conn tabletconn.TabletConn, fake *FakeQueryService)
 	testRollback(t, conn)
 	testExecute(t, conn)
 	testStreamExecute(t, conn)
+	testStreamExecuteCancel(t, conn, fake)
 	testExecuteBatch(t, conn)
 	testSplitQuery(t, conn)
 
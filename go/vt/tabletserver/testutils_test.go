@@ -132,6 +132,7 @@ func (util *testUtils) newConnPool() *ConnPool {
 	return NewConnPool(
 		"ConnPool",
 		100,
+		100,
 		10*time.Second,
 		false,
 		NewQueryServiceStats("", false),
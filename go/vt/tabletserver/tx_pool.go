@@ -7,11 +7,13 @@ package tabletserver
 import (
 	"fmt"
 	"net/url"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/cache"
 	"github.com/youtube/vitess/go/mysql/proto"
 	"github.com/youtube/vitess/go/pools"
 	"github.com/youtube/vitess/go/sqldb"
@@ -43,6 +45,11 @@ const (
 
 const txLogInterval = time.Duration(1 * time.Minute)
 
+// killedTxCacheSize is how many ids of killed transactions are
+// remembered, to tell the clients that use them the transaction timed
+// out.
+const killedTxCacheSize = 10000
+
 // TxPool is the transaction pool for the query service.
 type TxPool struct {
 	pool              *ConnPool
@@ -53,6 +60,11 @@ type TxPool struct {
 	ticks             *timer.Timer
 	txStats           *stats.Timings
 	queryServiceStats *QueryServiceStats
+	// killedTxs has the ids of the last transactions killed
+	// for exceeding the timeout.
+	killedTxs *cache.LRUCache
+	// lastKilledQuery is the last query of the last killed transaction.
+	lastKilledQuery stats.String
 	// Tracking culprits that cause tx pool full errors.
 	logMu   sync.Mutex
 	lastLog time.Time
@@ -63,6 +75,7 @@ func NewTxPool(
 	name string,
 	txStatsPrefix string,
 	capacity int,
+	maxCap int,
 	timeout time.Duration,
 	poolTimeout time.Duration,
 	idleTimeout time.Duration,
@@ -75,7 +88,7 @@ func NewTxPool(
 	}
 
 	axp := &TxPool{
-		pool:              NewConnPool(name, capacity, idleTimeout, enablePublishStats, qStats),
+		pool:              NewConnPool(name, capacity, maxCap, idleTimeout, enablePublishStats, qStats),
 		activePool:        pools.NewNumbered(),
 		lastID:            sync2.AtomicInt64(time.Now().UnixNano()),
 		timeout:           sync2.AtomicDuration(timeout),
@@ -83,12 +96,17 @@ func NewTxPool(
 		ticks:             timer.NewTimer(timeout / 10),
 		txStats:           stats.NewTimings(txStatsName),
 		queryServiceStats: qStats,
+		killedTxs:         cache.NewLRUCache(killedTxCacheSize),
 	}
 	// Careful: pool also exports name+"xxx" vars,
-	// but we know it doesn't export Timeout.
+	// but we know it doesn't export Timeout, Active,
+	// OldestAge and LastKilledQuery.
 	if enablePublishStats {
 		stats.Publish(name+"Timeout", stats.DurationFunc(axp.timeout.Get))
 		stats.Publish(name+"PoolTimeout", stats.DurationFunc(axp.poolTimeout.Get))
+		stats.Publish(name+"Active", stats.IntFunc(axp.activePool.Size))
+		stats.Publish(name+"OldestAge", stats.DurationFunc(axp.OldestAge))
+		stats.Publish(name+"LastKilledQuery", &axp.lastKilledQuery)
 	}
 	return axp
 }
@@ -123,16 +141,34 @@ func (axp *TxPool) transactionKiller() {
 	defer logError(axp.queryServiceStats)
 	for _, v := range axp.activePool.GetOutdated(time.Duration(axp.Timeout()), "for rollback") {
 		conn := v.(*TxConnection)
-		log.Warningf("killing transaction (exceeded timeout: %v): %s", axp.Timeout(), conn.Format(nil))
+		lastQuery := conn.LastQuery()
+		log.Warningf("killing transaction (exceeded timeout: %v), last query: %q: %s", axp.Timeout(), lastQuery, conn.Format(nil))
 		axp.queryServiceStats.KillStats.Add("Transactions", 1)
+		axp.lastKilledQuery.Set(lastQuery)
+		axp.killedTxs.Set(strconv.FormatInt(conn.TransactionID, 10), killedTx{})
 		conn.Close()
 		conn.discard(TxKill)
 	}
 }
 
+// killedTx is the value of the killed transactions in killedTxs.
+type killedTx struct{}
+
+// Size is part of cache.Value.
+func (killedTx) Size() int {
+	return 1
+}
+
 // Begin begins a transaction, and returns the associated transaction id.
 // Subsequent statements can access the connection through the transaction id.
+// It fails right away with ErrTxPoolFull if all the connections are used by
+// open transactions, as none of them may end before the deadline.
 func (axp *TxPool) Begin(ctx context.Context) int64 {
+	if capacity := axp.pool.Capacity(); capacity > 0 && axp.activePool.Size() >= capacity {
+		axp.pool.rejected.Add(1)
+		axp.LogActive()
+		panic(NewTabletError(ErrTxPoolFull, "Transaction pool connection limit exceeded"))
+	}
 	poolCtx := ctx
 	if deadline, ok := ctx.Deadline(); ok {
 		var cancel func()
@@ -193,6 +229,9 @@ func (axp *TxPool) Rollback(ctx context.Context, transactionID int64) {
 func (axp *TxPool) Get(transactionID int64) (conn *TxConnection) {
 	v, err := axp.activePool.Get(transactionID, "for query")
 	if err != nil {
+		if _, ok := axp.killedTxs.Get(strconv.FormatInt(transactionID, 10)); ok {
+			panic(NewTabletError(ErrNotInTx, "Transaction %d: not found (timed out after %v)", transactionID, axp.Timeout()))
+		}
 		panic(NewTabletError(ErrNotInTx, "Transaction %d: %v", transactionID, err))
 	}
 	return v.(*TxConnection)
@@ -213,6 +252,21 @@ func (axp *TxPool) LogActive() {
 	}
 }
 
+// OldestAge returns the age of the oldest open transaction, 0 if there
+// is none.
+func (axp *TxPool) OldestAge() time.Duration {
+	var oldest time.Time
+	for _, v := range axp.activePool.GetAll() {
+		if startTime := v.(*TxConnection).StartTime; oldest.IsZero() || startTime.Before(oldest) {
+			oldest = startTime
+		}
+	}
+	if oldest.IsZero() {
+		return 0
+	}
+	return time.Now().Sub(oldest)
+}
+
 // Timeout returns the transaction timeout.
 func (axp *TxPool) Timeout() time.Duration {
 	return axp.timeout.Get()
@@ -302,6 +356,15 @@ func (txc *TxConnection) RecordQuery(query string) {
 	txc.Queries = append(txc.Queries, query)
 }
 
+// LastQuery returns the last query recorded against this transaction,
+// "" if there is none.
+func (txc *TxConnection) LastQuery() string {
+	if len(txc.Queries) == 0 {
+		return ""
+	}
+	return txc.Queries[len(txc.Queries)-1]
+}
+
 func (txc *TxConnection) discard(conclusion string) {
 	txc.Conclusion = conclusion
 	txc.EndTime = time.Now()
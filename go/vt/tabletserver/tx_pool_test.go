@@ -7,6 +7,7 @@ package tabletserver
 import (
 	"fmt"
 	"math/rand"
+	"strings"
 	"testing"
 	"time"
 
@@ -89,6 +90,46 @@ func TestTransactionKiller(t *testing.T) {
 	if killCountDiff != 1 {
 		t.Fatalf("query: %s should be killed by transaction killer", sql)
 	}
+	if got := txPool.lastKilledQuery.Get(); got != sql {
+		t.Errorf("last killed query: %q, want %q", got, sql)
+	}
+	// the transaction id is now reported as timed out
+	defer func() {
+		err, ok := recover().(*TabletError)
+		if !ok || err.ErrorType != ErrNotInTx {
+			t.Fatalf("txPool.Get should fail with ErrNotInTx, got %v", err)
+		}
+		if !strings.Contains(err.Error(), "not found (timed out") {
+			t.Errorf("txPool.Get error should say the transaction timed out, got %v", err)
+		}
+	}()
+	txPool.Get(transactionID)
+}
+
+func TestTxPoolActiveStats(t *testing.T) {
+	fakesqldb.Register()
+	txPool := newTxPool(false)
+	appParams := sqldb.ConnParams{}
+	dbaParams := sqldb.ConnParams{}
+	txPool.Open(&appParams, &dbaParams)
+	defer txPool.Close()
+	if age := txPool.OldestAge(); age != 0 {
+		t.Errorf("OldestAge without transactions: %v, want 0", age)
+	}
+	ctx := context.Background()
+	transactionID := txPool.Begin(ctx)
+	time.Sleep(10 * time.Millisecond)
+	txPool.Begin(ctx)
+	if size := txPool.activePool.Size(); size != 2 {
+		t.Errorf("active transactions: %v, want 2", size)
+	}
+	if age := txPool.OldestAge(); age < 10*time.Millisecond {
+		t.Errorf("OldestAge: %v, want at least 10ms", age)
+	}
+	txPool.Rollback(ctx, transactionID)
+	if size := txPool.activePool.Size(); size != 1 {
+		t.Errorf("active transactions: %v, want 1", size)
+	}
 }
 
 func TestBeginAfterConnPoolClosed(t *testing.T) {
@@ -131,6 +172,22 @@ func TestBeginWithPoolTimeout(t *testing.T) {
 	txPool.Begin(ctx)
 }
 
+func TestBeginWithPoolFull(t *testing.T) {
+	fakesqldb.Register()
+	txPool := newTxPool(false)
+	appParams := sqldb.ConnParams{}
+	dbaParams := sqldb.ConnParams{}
+	txPool.Open(&appParams, &dbaParams)
+	// set pool capacity to 1
+	txPool.pool.SetCapacity(1)
+	defer txPool.Close()
+	txPool.Begin(context.Background())
+	// without a deadline, the second transaction should not wait
+	// for the first one to end
+	defer handleAndVerifyTabletError(t, "expect to get an error", ErrTxPoolFull)
+	txPool.Begin(context.Background())
+}
+
 func TestBeginWithShortDeadline(t *testing.T) {
 	fakesqldb.Register()
 	txPool := newTxPool(false)
@@ -265,6 +322,7 @@ func newTxPool(enablePublishStats bool) *TxPool {
 		poolName,
 		txStatsPrefix,
 		transactionCap,
+		transactionCap,
 		transactionTimeout,
 		txPoolTimeout,
 		idleTimeout,
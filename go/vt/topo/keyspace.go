@@ -5,8 +5,12 @@
 package topo
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"strings"
 	"sync"
+	"time"
 
 	log "github.com/golang/glog"
 
@@ -50,6 +54,63 @@ type Keyspace struct {
 	// That way we can guarantee a query that is targeted to 1/N of the
 	// keyspace will land on just one shard.
 	SplitShardCount int32
+
+	// SchemaChanges is the log of the schema changes applied to
+	// the keyspace by ApplySchema, oldest first. It is bounded to
+	// MaxSchemaChanges entries.
+	SchemaChanges []*SchemaChange
+
+	// TableACL is the table ACL config of the tablets of the
+	// keyspace that load theirs from the topology. If it is
+	// nil, they use the global one.
+	TableACL *TableACL
+}
+
+// TableACL is a table ACL config stored in the topology.
+type TableACL struct {
+	// Config is the JSON config, in the format of the
+	// -table-acl-config file of vttablet.
+	Config string
+
+	// DryRun makes the tablets log and count the queries the
+	// config denies, without failing them. It is for rolling out
+	// a new config.
+	DryRun bool
+}
+
+// MaxSchemaChanges is the number of schema changes kept in the log
+// of a keyspace. Older changes are dropped.
+const MaxSchemaChanges = 100
+
+// SchemaChange is the record of one schema change statement applied
+// to a keyspace.
+type SchemaChange struct {
+	// Hash is the SchemaChangeHash of Statement.
+	Hash      string
+	Statement string
+	Time      time.Time
+
+	// ShardResults maps the shards the statement was run on to the
+	// error it returned, or to "" if it succeeded.
+	ShardResults map[string]string
+}
+
+// Succeeded returns true if the statement worked on all the shards.
+func (sc *SchemaChange) Succeeded() bool {
+	for _, err := range sc.ShardResults {
+		if err != "" {
+			return false
+		}
+	}
+	return len(sc.ShardResults) > 0
+}
+
+// SchemaChangeHash returns the hash that identifies a schema change
+// statement. Runs of whitespace are collapsed first, so a statement
+// that was only reformatted has the same hash.
+func SchemaChangeHash(statement string) string {
+	sum := sha256.Sum256([]byte(strings.Join(strings.Fields(statement), " ")))
+	return hex.EncodeToString(sum[:])
 }
 
 // KeyspaceInfo is a meta struct that contains metadata to give the
@@ -82,6 +143,26 @@ func NewKeyspaceInfo(keyspace string, value *Keyspace, version int64) *KeyspaceI
 	}
 }
 
+// AddSchemaChange appends a change to the schema change log of the
+// keyspace, dropping the oldest ones if it gets too long.
+func (ki *KeyspaceInfo) AddSchemaChange(sc *SchemaChange) {
+	ki.SchemaChanges = append(ki.SchemaChanges, sc)
+	if extra := len(ki.SchemaChanges) - MaxSchemaChanges; extra > 0 {
+		ki.SchemaChanges = append([]*SchemaChange(nil), ki.SchemaChanges[extra:]...)
+	}
+}
+
+// FindSchemaChange returns the latest change with the given hash in
+// the log that succeeded on all shards, or nil if there isn't any.
+func (ki *KeyspaceInfo) FindSchemaChange(hash string) *SchemaChange {
+	for i := len(ki.SchemaChanges) - 1; i >= 0; i-- {
+		if sc := ki.SchemaChanges[i]; sc.Hash == hash && sc.Succeeded() {
+			return sc
+		}
+	}
+	return nil
+}
+
 // CheckServedFromMigration makes sure a requested migration is safe
 func (ki *KeyspaceInfo) CheckServedFromMigration(tabletType TabletType, cells []string, keyspace string, remove bool) error {
 	// master is a special case with a few extra checks
@@ -188,6 +269,24 @@ func UpdateKeyspace(ts Server, ki *KeyspaceInfo) error {
 	return err
 }
 
+// GetKeyspaceTableACL returns the table ACL config of the tablets of a
+// keyspace: the one of the keyspace if it has one, else the global
+// one. It returns ErrNoNode if there is none.
+func GetKeyspaceTableACL(ts Server, keyspace string) (*TableACL, error) {
+	ki, err := ts.GetKeyspace(keyspace)
+	if err != nil {
+		return nil, err
+	}
+	if ki.TableACL != nil {
+		return ki.TableACL, nil
+	}
+	tableACLer, ok := ts.(TableACLer)
+	if !ok {
+		return nil, fmt.Errorf("%T doesn't store a global table ACL config", ts)
+	}
+	return tableACLer.GetTableACL()
+}
+
 // FindAllShardsInKeyspace reads and returns all the existing shards in
 // a keyspace. It doesn't take any lock.
 func FindAllShardsInKeyspace(ts Server, keyspace string) (map[string]*ShardInfo, error) {
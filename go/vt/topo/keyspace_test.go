@@ -5,6 +5,7 @@
 package topo
 
 import (
+	"fmt"
 	"reflect"
 	"testing"
 )
@@ -132,3 +133,33 @@ func TestComputeCellServedFrom(t *testing.T) {
 		t.Fatalf("c2 failed: %v", m)
 	}
 }
+
+func TestSchemaChanges(t *testing.T) {
+	if h1, h2 := SchemaChangeHash("alter table t\n  add column c int"), SchemaChangeHash(" alter  table t add\tcolumn c int "); h1 != h2 {
+		t.Errorf("reformatted statements have different hashes: %v != %v", h1, h2)
+	}
+	if h1, h2 := SchemaChangeHash("alter table t add column c int"), SchemaChangeHash("alter table t add column d int"); h1 == h2 {
+		t.Errorf("different statements have the same hash: %v", h1)
+	}
+
+	ki := NewKeyspaceInfo("ks", &Keyspace{}, 1)
+	ki.AddSchemaChange(&SchemaChange{Hash: "ok", ShardResults: map[string]string{"-80": "", "80-": ""}})
+	ki.AddSchemaChange(&SchemaChange{Hash: "partial", ShardResults: map[string]string{"-80": "", "80-": "table exists"}})
+	if sc := ki.FindSchemaChange("ok"); sc == nil || sc.Hash != "ok" {
+		t.Errorf("FindSchemaChange(ok) = %v", sc)
+	}
+	if sc := ki.FindSchemaChange("partial"); sc != nil {
+		t.Errorf("FindSchemaChange(partial) returned a change that failed on a shard: %v", sc)
+	}
+
+	// the log is bounded, and drops the oldest changes
+	for i := 0; i < MaxSchemaChanges; i++ {
+		ki.AddSchemaChange(&SchemaChange{Hash: fmt.Sprintf("h%v", i)})
+	}
+	if len(ki.SchemaChanges) != MaxSchemaChanges || ki.SchemaChanges[0].Hash != "h0" {
+		t.Errorf("AddSchemaChange kept %v changes, starting with %v", len(ki.SchemaChanges), ki.SchemaChanges[0].Hash)
+	}
+	if sc := ki.FindSchemaChange("ok"); sc != nil {
+		t.Errorf("FindSchemaChange(ok) found a dropped change: %v", sc)
+	}
+}
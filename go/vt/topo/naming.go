@@ -30,6 +30,10 @@ const (
 	// DefaultPortName is the port named used by SrvEntries
 	// if "" is given as the named port.
 	DefaultPortName = "vt"
+
+	// SecurePortName is the named port of the TLS query service
+	// endpoint, if the tablet has one.
+	SecurePortName = "vts"
 )
 
 // EndPoint describes a tablet (maybe composed of multiple processes)
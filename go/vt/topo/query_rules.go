@@ -0,0 +1,34 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package topo
+
+import (
+	"time"
+)
+
+// QueryRules are the query rules of a keyspace or of a tablet, stored
+// in the topology. The tablets started with -topocustomrules watch the
+// rules of their keyspace and their own, and apply them on top of their
+// other rules. A tablet rule replaces the keyspace rule with the same
+// name.
+type QueryRules struct {
+	// Rules maps the rule names to the rules.
+	Rules map[string]*QueryRule
+}
+
+// QueryRule is a query rule in the JSON format of the tabletserver
+// query rules.
+type QueryRule struct {
+	Rule string
+
+	// Expiration is the unix time in seconds at which the rule stops
+	// applying, 0 if it doesn't expire.
+	Expiration int64
+}
+
+// Expired returns true if the rule doesn't apply any more at now.
+func (qr *QueryRule) Expired(now time.Time) bool {
+	return qr.Expiration != 0 && now.Unix() >= qr.Expiration
+}
@@ -294,6 +294,29 @@ type Schemafier interface {
 	GetVSchema() (string, error)
 }
 
+// TableACLer is a temporary interface for supporting the global table
+// ACL config reads and writes, like Schemafier. GetTableACL returns
+// ErrNoNode if no config was saved. A keyspace can override the global
+// config with its Keyspace.TableACL.
+type TableACLer interface {
+	SaveTableACL(*TableACL) error
+	GetTableACL() (*TableACL, error)
+}
+
+// QueryRuler is a temporary interface for supporting the query rules
+// of the keyspaces and of the tablets, like Schemafier. The Get
+// methods return ErrNoNode if no rules were saved. The Watch methods
+// work like WatchEndPoints: a nil value means there are no rules.
+type QueryRuler interface {
+	SaveKeyspaceQueryRules(keyspace string, qrs *QueryRules) error
+	GetKeyspaceQueryRules(keyspace string) (*QueryRules, error)
+	WatchKeyspaceQueryRules(keyspace string) (notifications <-chan *QueryRules, stopWatching chan<- struct{}, err error)
+
+	SaveTabletQueryRules(tabletAlias TabletAlias, qrs *QueryRules) error
+	GetTabletQueryRules(tabletAlias TabletAlias) (*QueryRules, error)
+	WatchTabletQueryRules(tabletAlias TabletAlias) (notifications <-chan *QueryRules, stopWatching chan<- struct{}, err error)
+}
+
 // Registry for Server implementations.
 var serverImpls = make(map[string]Server)
 
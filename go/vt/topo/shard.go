@@ -187,20 +187,10 @@ func ValidateShardName(shard string) (string, key.KeyRange, error) {
 		return shard, key.KeyRange{}, nil
 	}
 
-	parts := strings.Split(shard, "-")
-	if len(parts) != 2 {
-		return "", key.KeyRange{}, fmt.Errorf("invalid shardId, can only contain one '-': %v", shard)
-	}
-
-	keyRange, err := key.ParseKeyRangeParts(parts[0], parts[1])
+	keyRange, err := key.ParseShardName(shard)
 	if err != nil {
 		return "", key.KeyRange{}, err
 	}
-
-	if keyRange.End != key.MaxKey && keyRange.Start >= keyRange.End {
-		return "", key.KeyRange{}, fmt.Errorf("out of order keys: %v is not strictly smaller than %v", keyRange.Start.Hex(), keyRange.End.Hex())
-	}
-
 	return strings.ToLower(shard), keyRange, nil
 }
 
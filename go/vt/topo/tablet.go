@@ -38,6 +38,41 @@ const (
 	// ReplicationLagHigh is the value in the health map to indicate high
 	// replication lag
 	ReplicationLagHigh = "high"
+
+	// ReplicationLagSeconds is the key in the health map for the
+	// replication lag in seconds. It is only set along with
+	// ReplicationLag, so healthy tablets don't update their record
+	// at every health check.
+	ReplicationLagSeconds = "replication_lag_seconds"
+
+	// ReplicationRepaired is the key in the health map to indicate
+	// the tablet recently had to repair its own replication
+	ReplicationRepaired = "replication_repaired"
+
+	// ReplicationRepairedRecently is the value in the health map to
+	// indicate a recent replication repair
+	ReplicationRepairedRecently = "recent"
+
+	// MaintenanceMode is the key in the tablet tags and the health
+	// map to indicate the tablet is in maintenance mode. The value
+	// is the reason for it.
+	MaintenanceMode = "maintenance_mode"
+
+	// QueryServiceStats is the key in the health map for the
+	// summary of the query service activity, if the tablet publishes
+	// it. It is informational, and doesn't make the tablet unhealthy.
+	QueryServiceStats = "query_service_stats"
+
+	// ReplicaSafetyDrift is the key in the health map for the
+	// crash-safe replication settings that don't have their
+	// recommended value, as a comma separated list of name=value.
+	// It is informational, and doesn't make the tablet unhealthy.
+	ReplicaSafetyDrift = "replica_safety_drift"
+
+	// TypeChangeOverride is the key in the tablet tags set when the
+	// tablet type was forced through an illegal transition. The value
+	// describes the transition.
+	TypeChangeOverride = "type_change_override"
 )
 
 // TabletAlias is the minimum required information to locate a tablet.
@@ -0,0 +1,109 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/youtube/vitess/go/vt/topo"
+)
+
+// CheckQueryRules checks the reads, writes and watches of the query
+// rules of a keyspace and of a tablet.
+func CheckQueryRules(t *testing.T, ts topo.Server) {
+	queryRuler, ok := ts.(topo.QueryRuler)
+	if !ok {
+		t.Errorf("%T is not a QueryRuler", ts)
+		return
+	}
+	cell := getLocalCell(t, ts)
+	keyspace := "test_keyspace"
+	tabletAlias := topo.TabletAlias{Cell: cell, Uid: 1}
+
+	if err := queryRuler.SaveKeyspaceQueryRules(keyspace, &topo.QueryRules{}); err != topo.ErrNoNode {
+		t.Errorf("SaveKeyspaceQueryRules with no keyspace: %v, want ErrNoNode", err)
+	}
+	if err := queryRuler.SaveTabletQueryRules(tabletAlias, &topo.QueryRules{}); err != topo.ErrNoNode {
+		t.Errorf("SaveTabletQueryRules with no tablet: %v, want ErrNoNode", err)
+	}
+	if err := ts.CreateKeyspace(keyspace, &topo.Keyspace{}); err != nil {
+		t.Fatalf("CreateKeyspace: %v", err)
+	}
+	if err := ts.CreateTablet(&topo.Tablet{
+		Alias:    tabletAlias,
+		Hostname: "localhost",
+		Keyspace: keyspace,
+		Shard:    "0",
+		Type:     topo.TYPE_REPLICA,
+	}); err != nil {
+		t.Fatalf("CreateTablet: %v", err)
+	}
+	if _, err := queryRuler.GetKeyspaceQueryRules(keyspace); err != topo.ErrNoNode {
+		t.Errorf("GetKeyspaceQueryRules with no rules: %v, want ErrNoNode", err)
+	}
+	if _, err := queryRuler.GetTabletQueryRules(tabletAlias); err != topo.ErrNoNode {
+		t.Errorf("GetTabletQueryRules with no rules: %v, want ErrNoNode", err)
+	}
+
+	keyspaceNotifications, stopKeyspace, err := queryRuler.WatchKeyspaceQueryRules(keyspace)
+	if err != nil {
+		t.Fatalf("WatchKeyspaceQueryRules: %v", err)
+	}
+	defer close(stopKeyspace)
+	tabletNotifications, stopTablet, err := queryRuler.WatchTabletQueryRules(tabletAlias)
+	if err != nil {
+		t.Fatalf("WatchTabletQueryRules: %v", err)
+	}
+	defer close(stopTablet)
+	for _, notifications := range []<-chan *topo.QueryRules{keyspaceNotifications, tabletNotifications} {
+		if qrs, ok := <-notifications; !ok || qrs != nil {
+			t.Fatalf("first value is wrong: %v %v", qrs, ok)
+		}
+	}
+
+	keyspaceRules := &topo.QueryRules{Rules: map[string]*topo.QueryRule{
+		"r1": {Rule: `{"Name": "r1", "Query": "select"}`},
+	}}
+	if err := queryRuler.SaveKeyspaceQueryRules(keyspace, keyspaceRules); err != nil {
+		t.Fatalf("SaveKeyspaceQueryRules: %v", err)
+	}
+	tabletRules := &topo.QueryRules{Rules: map[string]*topo.QueryRule{
+		"r1": {Rule: `{"Name": "r1", "Query": "insert"}`, Expiration: 1500000000},
+		"r2": {Rule: `{"Name": "r2", "Query": "delete", "Action": "FAIL_RETRY"}`},
+	}}
+	if err := queryRuler.SaveTabletQueryRules(tabletAlias, tabletRules); err != nil {
+		t.Fatalf("SaveTabletQueryRules: %v", err)
+	}
+
+	waitForQueryRules(t, keyspaceNotifications, keyspaceRules)
+	waitForQueryRules(t, tabletNotifications, tabletRules)
+	if got, err := queryRuler.GetKeyspaceQueryRules(keyspace); err != nil || !reflect.DeepEqual(got, keyspaceRules) {
+		t.Errorf("GetKeyspaceQueryRules: %v %v, want %v", got, err, keyspaceRules)
+	}
+	if got, err := queryRuler.GetTabletQueryRules(tabletAlias); err != nil || !reflect.DeepEqual(got, tabletRules) {
+		t.Errorf("GetTabletQueryRules: %v %v, want %v", got, err, tabletRules)
+	}
+
+	// clearing the rules saves an empty set
+	if err := queryRuler.SaveTabletQueryRules(tabletAlias, &topo.QueryRules{}); err != nil {
+		t.Fatalf("SaveTabletQueryRules: %v", err)
+	}
+	waitForQueryRules(t, tabletNotifications, &topo.QueryRules{})
+}
+
+// waitForQueryRules reads notifications until it gets want. The watches
+// may send duplicate notifications of the previous values.
+func waitForQueryRules(t *testing.T, notifications <-chan *topo.QueryRules, want *topo.QueryRules) {
+	for {
+		qrs, ok := <-notifications
+		if !ok {
+			t.Fatalf("watch channel is closed???")
+		}
+		if reflect.DeepEqual(qrs, want) {
+			return
+		}
+	}
+}
@@ -0,0 +1,40 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/youtube/vitess/go/vt/topo"
+)
+
+// CheckTableACL checks the global table ACL config reads and writes.
+func CheckTableACL(t *testing.T, ts topo.Server) {
+	tableACLer, ok := ts.(topo.TableACLer)
+	if !ok {
+		t.Errorf("%T is not a TableACLer", ts)
+		return
+	}
+	if _, err := tableACLer.GetTableACL(); err != topo.ErrNoNode {
+		t.Errorf("GetTableACL with no config: %v, want ErrNoNode", err)
+	}
+
+	for _, want := range []*topo.TableACL{
+		{Config: `{"table1": {"READER": "u1"}}`},
+		{Config: `{"table[0-9]+": {"READER": "u1,u2", "WRITER": "u3"}}`, DryRun: true},
+	} {
+		if err := tableACLer.SaveTableACL(want); err != nil {
+			t.Fatalf("SaveTableACL: %v", err)
+		}
+		got, err := tableACLer.GetTableACL()
+		if err != nil {
+			t.Fatalf("GetTableACL: %v", err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("GetTableACL: %v, want %v", got, want)
+		}
+	}
+}
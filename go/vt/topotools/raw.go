@@ -0,0 +1,315 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package topotools
+
+// This file contains the raw access to the topology records, for the
+// TopoCat and TopoCp commands. The records are still typed: a record is
+// only written if it unmarshals into its struct.
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"reflect"
+	"strings"
+
+	"github.com/youtube/vitess/go/jscfg"
+	"github.com/youtube/vitess/go/vt/topo"
+	"golang.org/x/net/context"
+)
+
+// RawRecord is a topology record with its path and version, as
+// printed by TopoCat and read back by TopoCp. The version of a serving
+// graph record is a checksum of its JSON, since the topology doesn't
+// version them.
+type RawRecord struct {
+	Path    string
+	Version int64
+	Record  interface{}
+}
+
+// RawPath is the parsed path of a topology record. The paths are:
+// - keyspace/<keyspace>
+// - shard/<keyspace>/<shard>
+// - tablet/<tablet alias>
+// - srv_keyspace/<cell>/<keyspace>
+// - srv_shard/<cell>/<keyspace>/<shard>
+// - end_points/<cell>/<keyspace>/<shard>/<tablet type>
+type RawPath struct {
+	Kind       string
+	Cell       string
+	Keyspace   string
+	Shard      string
+	Alias      topo.TabletAlias
+	TabletType topo.TabletType
+}
+
+var rawPathArgs = map[string]int{
+	"keyspace":     1,
+	"shard":        2,
+	"tablet":       1,
+	"srv_keyspace": 2,
+	"srv_shard":    3,
+	"end_points":   4,
+}
+
+// ParseRawPath parses the path of a topology record.
+func ParseRawPath(path string) (*RawPath, error) {
+	parts := strings.Split(path, "/")
+	n, ok := rawPathArgs[parts[0]]
+	if !ok {
+		return nil, fmt.Errorf("unknown record kind %q in path %v, must be one of keyspace, shard, tablet, srv_keyspace, srv_shard or end_points", parts[0], path)
+	}
+	args := parts[1:]
+	if len(args) != n {
+		return nil, fmt.Errorf("path %v of a %v needs %v parts after the kind", path, parts[0], n)
+	}
+	for _, arg := range args {
+		if arg == "" {
+			return nil, fmt.Errorf("path %v has an empty part", path)
+		}
+	}
+
+	rp := &RawPath{Kind: parts[0]}
+	switch rp.Kind {
+	case "keyspace":
+		rp.Keyspace = args[0]
+	case "shard":
+		rp.Keyspace, rp.Shard = args[0], args[1]
+	case "tablet":
+		alias, err := topo.ParseTabletAliasString(args[0])
+		if err != nil {
+			return nil, err
+		}
+		rp.Alias = alias
+	case "srv_keyspace":
+		rp.Cell, rp.Keyspace = args[0], args[1]
+	case "srv_shard":
+		rp.Cell, rp.Keyspace, rp.Shard = args[0], args[1], args[2]
+	case "end_points":
+		rp.Cell, rp.Keyspace, rp.Shard = args[0], args[1], args[2]
+		rp.TabletType = topo.TabletType(args[3])
+		if !topo.IsTypeInList(rp.TabletType, topo.AllTabletTypes) {
+			return nil, fmt.Errorf("unknown tablet type %v in path %v", rp.TabletType, path)
+		}
+	}
+	return rp, nil
+}
+
+// String returns the path.
+func (rp *RawPath) String() string {
+	switch rp.Kind {
+	case "keyspace":
+		return "keyspace/" + rp.Keyspace
+	case "shard":
+		return "shard/" + rp.Keyspace + "/" + rp.Shard
+	case "tablet":
+		return "tablet/" + rp.Alias.String()
+	case "srv_keyspace":
+		return "srv_keyspace/" + rp.Cell + "/" + rp.Keyspace
+	case "srv_shard":
+		return "srv_shard/" + rp.Cell + "/" + rp.Keyspace + "/" + rp.Shard
+	default:
+		return "end_points/" + rp.Cell + "/" + rp.Keyspace + "/" + rp.Shard + "/" + string(rp.TabletType)
+	}
+}
+
+// IsServingGraph returns true for the records of the serving graph,
+// that the clients read directly.
+func (rp *RawPath) IsServingGraph() bool {
+	switch rp.Kind {
+	case "srv_keyspace", "srv_shard", "end_points":
+		return true
+	}
+	return false
+}
+
+// ReadRawRecord reads the record at path, with its version.
+func ReadRawRecord(ts topo.Server, rp *RawPath) (*RawRecord, error) {
+	rr := &RawRecord{Path: rp.String()}
+	var err error
+	switch rp.Kind {
+	case "keyspace":
+		var ki *topo.KeyspaceInfo
+		if ki, err = ts.GetKeyspace(rp.Keyspace); err == nil {
+			rr.Record, rr.Version = ki.Keyspace, ki.Version()
+		}
+	case "shard":
+		var si *topo.ShardInfo
+		if si, err = ts.GetShard(rp.Keyspace, rp.Shard); err == nil {
+			rr.Record, rr.Version = si.Shard, si.Version()
+		}
+	case "tablet":
+		var ti *topo.TabletInfo
+		if ti, err = ts.GetTablet(rp.Alias); err == nil {
+			rr.Record, rr.Version = ti.Tablet, ti.Version()
+		}
+	case "srv_keyspace":
+		rr.Record, err = ts.GetSrvKeyspace(rp.Cell, rp.Keyspace)
+	case "srv_shard":
+		rr.Record, err = ts.GetSrvShard(rp.Cell, rp.Keyspace, rp.Shard)
+	case "end_points":
+		rr.Record, err = ts.GetEndPoints(rp.Cell, rp.Keyspace, rp.Shard, rp.TabletType)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read %v: %v", rr.Path, err)
+	}
+	if rp.IsServingGraph() {
+		rr.Version = rawChecksum(rr.Record)
+	}
+	return rr, nil
+}
+
+// rawChecksum is the version of an unversioned record.
+func rawChecksum(record interface{}) int64 {
+	return int64(crc32.ChecksumIEEE([]byte(jscfg.ToJSON(record))))
+}
+
+// DecodeRawRecord parses a RawRecord printed by TopoCat. The record
+// has to unmarshal into the struct of its path, without unknown
+// fields.
+func DecodeRawRecord(data []byte) (*RawPath, *RawRecord, error) {
+	var envelope struct {
+		Path    string
+		Version *int64
+		Record  json.RawMessage
+	}
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return nil, nil, fmt.Errorf("cannot parse the record file: %v", err)
+	}
+	rp, err := ParseRawPath(envelope.Path)
+	if err != nil {
+		return nil, nil, err
+	}
+	if envelope.Version == nil {
+		return nil, nil, fmt.Errorf("the record file of %v has no Version, print it with TopoCat", envelope.Path)
+	}
+	if len(envelope.Record) == 0 || string(envelope.Record) == "null" {
+		return nil, nil, fmt.Errorf("the record file of %v has no Record", envelope.Path)
+	}
+
+	var record interface{}
+	switch rp.Kind {
+	case "keyspace":
+		record = &topo.Keyspace{}
+	case "shard":
+		record = &topo.Shard{}
+	case "tablet":
+		record = &topo.Tablet{}
+	case "srv_keyspace":
+		record = &topo.SrvKeyspace{}
+	case "srv_shard":
+		record = &topo.SrvShard{}
+	case "end_points":
+		record = &topo.EndPoints{}
+	}
+	decoder := json.NewDecoder(bytes.NewReader(envelope.Record))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(record); err != nil {
+		return nil, nil, fmt.Errorf("invalid %v record: %v", rp.Kind, err)
+	}
+	if tablet, ok := record.(*topo.Tablet); ok {
+		if tablet.Alias != rp.Alias {
+			return nil, nil, fmt.Errorf("the tablet record is for %v, not %v", tablet.Alias, rp.Alias)
+		}
+		if !topo.IsTypeInList(tablet.Type, topo.AllTabletTypes) {
+			return nil, nil, fmt.Errorf("the tablet record has an unknown type %v", tablet.Type)
+		}
+	}
+	return rp, &RawRecord{Path: envelope.Path, Version: *envelope.Version, Record: record}, nil
+}
+
+// WriteRawRecord writes rr at its path, if the record there still has
+// version rr.Version: it returns topo.ErrBadVersion otherwise. The check
+// of the serving graph records is not atomic, since they have no
+// version in the topology. A change to a serving graph record that
+// does more than add to it is refused, unless force is set.
+func WriteRawRecord(ctx context.Context, ts topo.Server, rp *RawPath, rr *RawRecord, force bool) error {
+	if rp.IsServingGraph() {
+		current, err := ReadRawRecord(ts, rp)
+		if err != nil {
+			return err
+		}
+		if current.Version != rr.Version {
+			return topo.ErrBadVersion
+		}
+		if !force && !rawIsAddition(current.Record, rr.Record) {
+			return fmt.Errorf("the new %v removes or changes values of the serving graph, use -force to write it", rr.Path)
+		}
+	}
+
+	// the versioned records go straight to the Server: the
+	// topo.Update* helpers don't check version 0
+	var err error
+	switch record := rr.Record.(type) {
+	case *topo.Keyspace:
+		_, err = ts.UpdateKeyspace(topo.NewKeyspaceInfo(rp.Keyspace, record, rr.Version), rr.Version)
+		return err
+	case *topo.Shard:
+		_, err = ts.UpdateShard(topo.NewShardInfo(rp.Keyspace, rp.Shard, record, rr.Version), rr.Version)
+		return err
+	case *topo.Tablet:
+		_, err = ts.UpdateTablet(topo.NewTabletInfo(record, rr.Version), rr.Version)
+		return err
+	case *topo.SrvKeyspace:
+		return ts.UpdateSrvKeyspace(rp.Cell, rp.Keyspace, record)
+	case *topo.SrvShard:
+		return ts.UpdateSrvShard(rp.Cell, rp.Keyspace, rp.Shard, record)
+	case *topo.EndPoints:
+		return topo.UpdateEndPoints(ctx, ts, rp.Cell, rp.Keyspace, rp.Shard, rp.TabletType, record)
+	}
+	return fmt.Errorf("unknown record type %T for %v", rr.Record, rr.Path)
+}
+
+// rawIsAddition returns true if the JSON of newRecord has everything
+// the JSON of oldRecord has.
+func rawIsAddition(oldRecord, newRecord interface{}) bool {
+	var oldValue, newValue interface{}
+	if json.Unmarshal([]byte(jscfg.ToJSON(oldRecord)), &oldValue) != nil || json.Unmarshal([]byte(jscfg.ToJSON(newRecord)), &newValue) != nil {
+		return false
+	}
+	return jsonContains(newValue, oldValue)
+}
+
+// jsonContains returns true if the decoded JSON value a has all the
+// map entries and list elements of b.
+func jsonContains(a, b interface{}) bool {
+	switch bv := b.(type) {
+	case map[string]interface{}:
+		av, ok := a.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		for k, v := range bv {
+			if !jsonContains(av[k], v) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		av, ok := a.([]interface{})
+		if !ok {
+			return len(bv) == 0
+		}
+		for _, v := range bv {
+			found := false
+			for _, w := range av {
+				if reflect.DeepEqual(v, w) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return false
+			}
+		}
+		return true
+	case nil:
+		return true
+	default:
+		return reflect.DeepEqual(a, b)
+	}
+}
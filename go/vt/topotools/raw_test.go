@@ -0,0 +1,120 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package topotools_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/youtube/vitess/go/jscfg"
+	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/vt/zktopo"
+	"golang.org/x/net/context"
+
+	. "github.com/youtube/vitess/go/vt/topotools"
+)
+
+func TestParseRawPath(t *testing.T) {
+	for _, path := range []string{
+		"keyspace/ks",
+		"shard/ks/-80",
+		"tablet/cell1-0000000100",
+		"srv_keyspace/cell1/ks",
+		"srv_shard/cell1/ks/-80",
+		"end_points/cell1/ks/-80/replica",
+	} {
+		rp, err := ParseRawPath(path)
+		if err != nil || rp.String() != path {
+			t.Errorf("ParseRawPath(%v) = %v, %v", path, rp, err)
+		}
+	}
+	for _, path := range []string{"cell/cell1", "shard/ks", "shard/ks/", "end_points/cell1/ks/-80/primary"} {
+		if _, err := ParseRawPath(path); err == nil {
+			t.Errorf("ParseRawPath(%v) worked", path)
+		}
+	}
+}
+
+func TestRawRecords(t *testing.T) {
+	ctx := context.Background()
+	ts := zktopo.NewTestServer(t, []string{"cell1"})
+	if err := ts.CreateKeyspace("ks", &topo.Keyspace{ShardingColumnName: "id"}); err != nil {
+		t.Fatalf("CreateKeyspace failed: %v", err)
+	}
+	if err := ts.UpdateEndPoints("cell1", "ks", "0", topo.TYPE_REPLICA, &topo.EndPoints{Entries: []topo.EndPoint{{Uid: 1, Host: "host1"}, {Uid: 2, Host: "host2"}}}); err != nil {
+		t.Fatalf("UpdateEndPoints failed: %v", err)
+	}
+
+	// a keyspace is written with compare-and-set
+	rp, err := ParseRawPath("keyspace/ks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr, err := ReadRawRecord(ts, rp)
+	if err != nil {
+		t.Fatalf("ReadRawRecord failed: %v", err)
+	}
+	printed := jscfg.ToJSON(rr)
+	edited := strings.Replace(printed, `"ShardingColumnName": "id"`, `"ShardingColumnName": "user_id"`, 1)
+	rp, newRecord, err := DecodeRawRecord([]byte(edited))
+	if err != nil {
+		t.Fatalf("DecodeRawRecord failed: %v", err)
+	}
+	if err := WriteRawRecord(ctx, ts, rp, newRecord, false); err != nil {
+		t.Fatalf("WriteRawRecord failed: %v", err)
+	}
+	if ki, err := ts.GetKeyspace("ks"); err != nil || ki.ShardingColumnName != "user_id" {
+		t.Errorf("keyspace not written: %v %v", ki, err)
+	}
+	if err := WriteRawRecord(ctx, ts, rp, newRecord, false); err != topo.ErrBadVersion {
+		t.Errorf("second WriteRawRecord with the same version: %v, want %v", err, topo.ErrBadVersion)
+	}
+
+	// malformed records are refused
+	for _, data := range []string{
+		strings.Replace(printed, `"ShardingColumnName"`, `"ShardingColumn"`, 1),
+		strings.Replace(printed, `"ShardingColumnName": "id"`, `"ShardingColumnName": 12`, 1),
+		`{"Path": "keyspace/ks", "Record": {}}`,
+		`{"Path": "keyspace/ks", "Version": 1}`,
+	} {
+		if _, _, err := DecodeRawRecord([]byte(data)); err == nil {
+			t.Errorf("DecodeRawRecord(%v) worked", data)
+		}
+	}
+
+	// end points can be added without -force, not removed
+	rp, err = ParseRawPath("end_points/cell1/ks/0/replica")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr, err = ReadRawRecord(ts, rp)
+	if err != nil {
+		t.Fatalf("ReadRawRecord failed: %v", err)
+	}
+	endPoints := rr.Record.(*topo.EndPoints)
+	endPoints.Entries = endPoints.Entries[:1]
+	if err := WriteRawRecord(ctx, ts, rp, rr, false); err == nil || !strings.Contains(err.Error(), "use -force") {
+		t.Errorf("removing an end point without force: %v", err)
+	}
+	if err := WriteRawRecord(ctx, ts, rp, rr, true); err != nil {
+		t.Errorf("removing an end point with force failed: %v", err)
+	}
+	if err := WriteRawRecord(ctx, ts, rp, rr, true); err != topo.ErrBadVersion {
+		t.Errorf("writing the end points again with the old checksum: %v, want %v", err, topo.ErrBadVersion)
+	}
+
+	rr, err = ReadRawRecord(ts, rp)
+	if err != nil {
+		t.Fatalf("ReadRawRecord failed: %v", err)
+	}
+	endPoints = rr.Record.(*topo.EndPoints)
+	endPoints.Entries = append(endPoints.Entries, topo.EndPoint{Uid: 3, Host: "host3"})
+	if err := WriteRawRecord(ctx, ts, rp, rr, false); err != nil {
+		t.Errorf("adding an end point failed: %v", err)
+	}
+	if ep, err := ts.GetEndPoints("cell1", "ks", "0", topo.TYPE_REPLICA); err != nil || len(ep.Entries) != 2 {
+		t.Errorf("end points not written: %v %v", ep, err)
+	}
+}
@@ -8,7 +8,7 @@ import (
 	"flag"
 	"fmt"
 
-	"github.com/youtube/vitess/go/vt/mysqlctl/backupstorage"
+	myproto "github.com/youtube/vitess/go/vt/mysqlctl/proto"
 	"github.com/youtube/vitess/go/vt/topo"
 	"github.com/youtube/vitess/go/vt/wrangler"
 	"golang.org/x/net/context"
@@ -19,12 +19,22 @@ func init() {
 		"ListBackups",
 		commandListBackups,
 		"<keyspace/shard>",
-		"Lists all the backups for a shard."})
+		"Lists all the backups for a shard, oldest first, with the engine, data size and replication position from their MANIFEST. The backups are read from the BackupStorage directly."})
 	addCommand("Shards", command{
 		"RemoveBackup",
 		commandRemoveBackup,
 		"<keyspace/shard> <backup name>",
 		"Removes a backup for the BackupStorage."})
+	addCommand("Shards", command{
+		"VerifyBackup",
+		commandVerifyBackup,
+		"<tablet alias> [<backup name>]",
+		"Makes a tablet read a backup of its shard from the BackupStorage, and check the files against its MANIFEST, without restoring it. Without a backup name, the most recent backup is checked."})
+	addCommand("Tablets", command{
+		"RestoreFromBackup",
+		commandRestoreFromBackup,
+		"<tablet alias>",
+		"Stops mysqld and restores the data from the most recent backup of the shard. The tablet must not be a master, and mysqld must have no data."})
 }
 
 func commandListBackups(ctx context.Context, wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) error {
@@ -39,18 +49,20 @@ func commandListBackups(ctx context.Context, wr *wrangler.Wrangler, subFlags *fl
 	if err != nil {
 		return err
 	}
-	bucket := fmt.Sprintf("%v/%v", keyspace, shard)
-
-	bs, err := backupstorage.GetBackupStorage()
-	if err != nil {
-		return err
-	}
-	bhs, err := bs.ListBackups(bucket)
+	bis, err := wr.ListBackups(keyspace, shard)
 	if err != nil {
 		return err
 	}
-	for _, bh := range bhs {
-		wr.Logger().Printf("%v\n", bh.Name())
+	for _, bi := range bis {
+		if bi.Manifest == nil {
+			wr.Logger().Printf("%v incomplete: %v\n", bi.Name, bi.Error)
+			continue
+		}
+		size := "unknown"
+		if bi.Manifest.DataSize > 0 {
+			size = fmt.Sprintf("%v", bi.Manifest.DataSize)
+		}
+		wr.Logger().Printf("%v engine=%v size=%v position=%v\n", bi.Name, bi.Manifest.BackupMethod, size, myproto.EncodeReplicationPosition(bi.Manifest.ReplicationPosition))
 	}
 	return nil
 }
@@ -67,12 +79,35 @@ func commandRemoveBackup(ctx context.Context, wr *wrangler.Wrangler, subFlags *f
 	if err != nil {
 		return err
 	}
-	bucket := fmt.Sprintf("%v/%v", keyspace, shard)
-	name := subFlags.Arg(1)
+	return wr.RemoveBackup(keyspace, shard, subFlags.Arg(1))
+}
+
+func commandVerifyBackup(ctx context.Context, wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) error {
+	if err := subFlags.Parse(args); err != nil {
+		return err
+	}
+	if subFlags.NArg() != 1 && subFlags.NArg() != 2 {
+		return fmt.Errorf("action VerifyBackup requires <tablet alias> [<backup name>]")
+	}
+
+	tabletAlias, err := topo.ParseTabletAliasString(subFlags.Arg(0))
+	if err != nil {
+		return err
+	}
+	return wr.VerifyBackup(ctx, tabletAlias, subFlags.Arg(1))
+}
+
+func commandRestoreFromBackup(ctx context.Context, wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) error {
+	if err := subFlags.Parse(args); err != nil {
+		return err
+	}
+	if subFlags.NArg() != 1 {
+		return fmt.Errorf("action RestoreFromBackup requires <tablet alias>")
+	}
 
-	bs, err := backupstorage.GetBackupStorage()
+	tabletAlias, err := topo.ParseTabletAliasString(subFlags.Arg(0))
 	if err != nil {
 		return err
 	}
-	return bs.RemoveBackup(bucket, name)
+	return wr.RestoreFromBackup(ctx, tabletAlias)
 }
@@ -0,0 +1,135 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vtctl
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/vt/wrangler"
+	"golang.org/x/net/context"
+)
+
+// This file contains the bulk versions of the single tablet commands,
+// that run on all the tablets selected by -keyspace, -shard, -cell and
+// -tablet_type.
+
+const tabletSelectionUsage = "[-keyspace=<keyspace>] [-shard=<shard>] [-cell=<cell1>,<cell2>,...] [-tablet_type=<tablet type>] [-concurrency=8]"
+
+func init() {
+	addCommand("Tablets", command{
+		"PingTablets",
+		commandPingTablets,
+		tabletSelectionUsage,
+		"Pings all the selected tablets, and prints the result for each. Fails if any of them failed."})
+	addCommand("Tablets", command{
+		"RefreshStateTablets",
+		commandRefreshStateTablets,
+		tabletSelectionUsage,
+		"Asks all the selected tablets to reload their tablet record, and prints the result for each. Fails if any of them failed."})
+	addCommand("Schema, Version, Permissions", command{
+		"ReloadSchemaTablets",
+		commandReloadSchemaTablets,
+		tabletSelectionUsage,
+		"Asks all the selected tablets to reload their schema, and prints the result for each. Fails if any of them failed."})
+	addCommand("Schema, Version, Permissions", command{
+		"ReloadTableACLTablets",
+		commandReloadTableACLTablets,
+		tabletSelectionUsage,
+		"Asks all the selected tablets to reload their table ACL config from the topology, and prints the result for each. Fails if any of them failed."})
+}
+
+// tabletSelectionFlags are the flags of a bulk command.
+type tabletSelectionFlags struct {
+	keyspace    *string
+	shard       *string
+	cells       *string
+	tabletType  *string
+	concurrency *int
+}
+
+func addTabletSelectionFlags(subFlags *flag.FlagSet) *tabletSelectionFlags {
+	return &tabletSelectionFlags{
+		keyspace:    subFlags.String("keyspace", "", "only select the tablets of this keyspace"),
+		shard:       subFlags.String("shard", "", "only select the tablets of this shard, requires -keyspace"),
+		cells:       subFlags.String("cell", "", "only select the tablets of these comma separated cells"),
+		tabletType:  subFlags.String("tablet_type", "", "only select the tablets of this type"),
+		concurrency: subFlags.Int("concurrency", wrangler.DefaultBulkConcurrency, "how many tablets to run on at the same time"),
+	}
+}
+
+// runOnSelectedTablets runs action on the tablets selected by the
+// flags, and prints the result for each.
+func runOnSelectedTablets(ctx context.Context, wr *wrangler.Wrangler, name string, subFlags *flag.FlagSet, flags *tabletSelectionFlags, args []string, action func(ctx context.Context, ti *topo.TabletInfo) error) error {
+	if err := subFlags.Parse(args); err != nil {
+		return err
+	}
+	if subFlags.NArg() != 0 {
+		return fmt.Errorf("action %v only takes flags to select the tablets", name)
+	}
+	selection := &wrangler.TabletSelection{
+		Keyspace: *flags.keyspace,
+		Shard:    *flags.shard,
+	}
+	if *flags.cells != "" {
+		selection.Cells = strings.Split(*flags.cells, ",")
+	}
+	if *flags.tabletType != "" {
+		tabletType, err := parseTabletType(*flags.tabletType, topo.AllTabletTypes)
+		if err != nil {
+			return err
+		}
+		selection.TabletType = tabletType
+	}
+
+	tablets, err := wr.SelectTablets(ctx, selection)
+	if err != nil {
+		return err
+	}
+	if len(tablets) == 0 {
+		return fmt.Errorf("action %v: no tablet matches the selection", name)
+	}
+	results, err := wr.RunOnTablets(ctx, name, tablets, *flags.concurrency, action)
+	printResult(wr, results, func() {
+		for _, result := range results {
+			if result.Error == "" {
+				wr.Logger().Printf("%v OK\n", result.Alias)
+			} else {
+				wr.Logger().Printf("%v ERROR %v\n", result.Alias, result.Error)
+			}
+		}
+	})
+	return err
+}
+
+func commandPingTablets(ctx context.Context, wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) error {
+	flags := addTabletSelectionFlags(subFlags)
+	return runOnSelectedTablets(ctx, wr, "PingTablets", subFlags, flags, args, func(ctx context.Context, ti *topo.TabletInfo) error {
+		return wr.TabletManagerClient().Ping(ctx, ti)
+	})
+}
+
+func commandRefreshStateTablets(ctx context.Context, wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) error {
+	flags := addTabletSelectionFlags(subFlags)
+	return runOnSelectedTablets(ctx, wr, "RefreshStateTablets", subFlags, flags, args, func(ctx context.Context, ti *topo.TabletInfo) error {
+		return wr.TabletManagerClient().RefreshState(ctx, ti)
+	})
+}
+
+func commandReloadSchemaTablets(ctx context.Context, wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) error {
+	flags := addTabletSelectionFlags(subFlags)
+	return runOnSelectedTablets(ctx, wr, "ReloadSchemaTablets", subFlags, flags, args, func(ctx context.Context, ti *topo.TabletInfo) error {
+		return wr.TabletManagerClient().ReloadSchema(ctx, ti)
+	})
+}
+
+func commandReloadTableACLTablets(ctx context.Context, wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) error {
+	flags := addTabletSelectionFlags(subFlags)
+	return runOnSelectedTablets(ctx, wr, "ReloadTableACLTablets", subFlags, flags, args, func(ctx context.Context, ti *topo.TabletInfo) error {
+		return wr.TabletManagerClient().ReloadTableACL(ctx, ti)
+	})
+}
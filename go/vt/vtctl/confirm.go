@@ -0,0 +1,28 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vtctl
+
+import (
+	log "github.com/golang/glog"
+)
+
+// Confirmer asks the user running a command to type answer to go on,
+// and returns an error if they typed anything else.
+type Confirmer func(prompt, answer string) error
+
+// confirmer is nil when the commands do not run on behalf of a user
+// at a terminal, e.g. in vtctld: then there is nobody to ask, and the
+// commands go on without confirmation.
+var confirmer Confirmer
+
+// RegisterConfirmer sets the Confirmer the commands use. It should
+// only be called by binaries that run the commands for a user at a
+// terminal.
+func RegisterConfirmer(c Confirmer) {
+	if confirmer != nil {
+		log.Fatalf("RegisterConfirmer called twice")
+	}
+	confirmer = c
+}
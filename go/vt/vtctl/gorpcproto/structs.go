@@ -22,3 +22,14 @@ type ExecuteVtctlCommandArgs struct {
 	ActionTimeout time.Duration
 	LockTimeout   time.Duration
 }
+
+// SubmitVtctlCommandReply is the reply of the SubmitVtctlCommand RPC
+// call, which takes an ExecuteVtctlCommandArgs.
+type SubmitVtctlCommandReply struct {
+	JobID int64
+}
+
+// WaitForJobArgs contains the parameters for the WaitForJob RPC call.
+type WaitForJobArgs struct {
+	JobID int64
+}
@@ -45,6 +45,32 @@ func (client *goRPCVtctlClient) ExecuteVtctlCommand(ctx context.Context, args []
 	return sr, func() error { return c.Error }
 }
 
+// SubmitVtctlCommand is part of the VtctlClient interface
+func (client *goRPCVtctlClient) SubmitVtctlCommand(ctx context.Context, args []string, actionTimeout, lockTimeout time.Duration) (int64, error) {
+	req := &gorpcproto.ExecuteVtctlCommandArgs{
+		Args:          args,
+		ActionTimeout: actionTimeout,
+		LockTimeout:   lockTimeout,
+	}
+	reply := &gorpcproto.SubmitVtctlCommandReply{}
+	if err := client.rpcClient.Call(ctx, "VtctlServer.SubmitVtctlCommand", req, reply); err != nil {
+		return 0, err
+	}
+	return reply.JobID, nil
+}
+
+// WaitForJob is part of the VtctlClient interface.
+// As for ExecuteVtctlCommand, the bson rpc version doesn't honor
+// timeouts in the context.
+func (client *goRPCVtctlClient) WaitForJob(ctx context.Context, jobID int64) (<-chan *logutil.LoggerEvent, vtctlclient.ErrFunc) {
+	req := &gorpcproto.WaitForJobArgs{
+		JobID: jobID,
+	}
+	sr := make(chan *logutil.LoggerEvent, 10)
+	c := client.rpcClient.StreamGo("VtctlServer.WaitForJob", req, sr)
+	return sr, func() error { return c.Error }
+}
+
 // Close is part of the VtctlClient interface
 func (client *goRPCVtctlClient) Close() {
 	client.rpcClient.Close()
@@ -9,6 +9,7 @@ of the remote execution of vtctl commands.
 package gorpcvtctlserver
 
 import (
+	"strings"
 	"sync"
 
 	"github.com/youtube/vitess/go/vt/logutil"
@@ -51,6 +52,8 @@ func (s *VtctlServer) ExecuteVtctlCommand(ctx context.Context, query *gorpcproto
 
 	// create the wrangler
 	wr := wrangler.New(logger, s.ts, tmclient.NewTabletManagerClient(), query.LockTimeout)
+	job := wr.StartJob(wrangler.DefaultJobRegistry, strings.Join(query.Args, " "))
+	defer func() { job.Finish(err) }()
 	// FIXME(alainjobart) use a single context, copy the source info from it
 	ctx, cancel := context.WithTimeout(context.TODO(), query.ActionTimeout)
 
@@ -65,6 +68,21 @@ func (s *VtctlServer) ExecuteVtctlCommand(ctx context.Context, query *gorpcproto
 	return err
 }
 
+// SubmitVtctlCommand is the server side method that will start the
+// command as a job, and return its id.
+func (s *VtctlServer) SubmitVtctlCommand(ctx context.Context, query *gorpcproto.ExecuteVtctlCommandArgs, reply *gorpcproto.SubmitVtctlCommandReply) error {
+	reply.JobID = vtctl.SubmitCommand(s.ts, query.Args, query.ActionTimeout, query.LockTimeout)
+	return nil
+}
+
+// WaitForJob is the server side method that will stream the logs of
+// a job until it is done.
+func (s *VtctlServer) WaitForJob(ctx context.Context, query *gorpcproto.WaitForJobArgs, sendReply func(interface{}) error) error {
+	return vtctl.WaitForJob(ctx, query.JobID, func(e *logutil.LoggerEvent) error {
+		return sendReply(e)
+	})
+}
+
 // NewVtctlServer returns a new Vtctl Server for the topo server.
 func NewVtctlServer(ts topo.Server) *VtctlServer {
 	return &VtctlServer{ts}
@@ -48,7 +48,37 @@ func (client *gRPCVtctlClient) ExecuteVtctlCommand(ctx context.Context, args []s
 	if err != nil {
 		return nil, func() error { return err }
 	}
+	return streamLoggerEvents(stream)
+}
+
+// SubmitVtctlCommand is part of the VtctlClient interface
+func (client *gRPCVtctlClient) SubmitVtctlCommand(ctx context.Context, args []string, actionTimeout, lockTimeout time.Duration) (int64, error) {
+	query := &pb.ExecuteVtctlCommandArgs{
+		Args:          args,
+		ActionTimeout: int64(actionTimeout.Nanoseconds()),
+		LockTimeout:   int64(lockTimeout.Nanoseconds()),
+	}
+	reply, err := client.c.SubmitVtctlCommand(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+	return reply.JobId, nil
+}
+
+// WaitForJob is part of the VtctlClient interface
+func (client *gRPCVtctlClient) WaitForJob(ctx context.Context, jobID int64) (<-chan *logutil.LoggerEvent, vtctlclient.ErrFunc) {
+	stream, err := client.c.WaitForJob(ctx, &pb.WaitForJobArgs{JobId: jobID})
+	if err != nil {
+		return nil, func() error { return err }
+	}
+	return streamLoggerEvents(stream)
+}
 
+// streamLoggerEvents sends the events of stream on the returned
+// channel, until it ends.
+func streamLoggerEvents(stream interface {
+	Recv() (*pb.LoggerEvent, error)
+}) (<-chan *logutil.LoggerEvent, vtctlclient.ErrFunc) {
 	results := make(chan *logutil.LoggerEvent, 1)
 	var finalError error
 	go func() {
@@ -9,10 +9,12 @@ of the remote execution of vtctl commands.
 package grpcvtctlserver
 
 import (
+	"strings"
 	"sync"
 	"time"
 
 	log "github.com/golang/glog"
+	"golang.org/x/net/context"
 	"google.golang.org/grpc"
 
 	"github.com/youtube/vitess/go/vt/logutil"
@@ -52,22 +54,15 @@ func (s *VtctlServer) ExecuteVtctlCommand(args *pb.ExecuteVtctlCommandArgs, stre
 			// we still need to flush and finish the
 			// command, even if the channel to the client
 			// has been broken. We'll just keep trying.
-			stream.Send(&pb.LoggerEvent{
-				Time: &pb.Time{
-					Seconds:     e.Time.Unix(),
-					Nanoseconds: int64(e.Time.Nanosecond()),
-				},
-				Level: int64(e.Level),
-				File:  e.File,
-				Line:  int64(e.Line),
-				Value: e.Value,
-			})
+			stream.Send(loggerEventToProto(&e))
 		}
 		wg.Done()
 	}()
 
 	// create the wrangler
 	wr := wrangler.New(logger, s.ts, tmclient.NewTabletManagerClient(), time.Duration(args.LockTimeout))
+	job := wr.StartJob(wrangler.DefaultJobRegistry, strings.Join(args.Args, " "))
+	defer func() { job.Finish(err) }()
 
 	// execute the command
 	err = vtctl.RunCommand(stream.Context(), wr, args.Args)
@@ -79,6 +74,33 @@ func (s *VtctlServer) ExecuteVtctlCommand(args *pb.ExecuteVtctlCommandArgs, stre
 	return err
 }
 
+// SubmitVtctlCommand is part of the pb.VtctlServer interface
+func (s *VtctlServer) SubmitVtctlCommand(ctx context.Context, args *pb.ExecuteVtctlCommandArgs) (*pb.SubmitVtctlCommandReply, error) {
+	return &pb.SubmitVtctlCommandReply{
+		JobId: vtctl.SubmitCommand(s.ts, args.Args, time.Duration(args.ActionTimeout), time.Duration(args.LockTimeout)),
+	}, nil
+}
+
+// WaitForJob is part of the pb.VtctlServer interface
+func (s *VtctlServer) WaitForJob(args *pb.WaitForJobArgs, stream pb.Vtctl_WaitForJobServer) error {
+	return vtctl.WaitForJob(stream.Context(), args.JobId, func(e *logutil.LoggerEvent) error {
+		return stream.Send(loggerEventToProto(e))
+	})
+}
+
+func loggerEventToProto(e *logutil.LoggerEvent) *pb.LoggerEvent {
+	return &pb.LoggerEvent{
+		Time: &pb.Time{
+			Seconds:     e.Time.Unix(),
+			Nanoseconds: int64(e.Time.Nanosecond()),
+		},
+		Level: int64(e.Level),
+		File:  e.File,
+		Line:  int64(e.Line),
+		Value: e.Value,
+	}
+}
+
 // StartServer registers the VtctlServer for RPCs
 func StartServer(s *grpc.Server, ts topo.Server) {
 	if !servenv.ServiceMap["grpc-vtctl"] {
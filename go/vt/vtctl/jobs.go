@@ -0,0 +1,69 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vtctl
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/youtube/vitess/go/vt/logutil"
+	"github.com/youtube/vitess/go/vt/tabletmanager/tmclient"
+	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/vt/wrangler"
+	"golang.org/x/net/context"
+)
+
+// This file contains the server side of the asynchronous execution
+// of vtctl commands: they run as jobs of wrangler.DefaultJobRegistry,
+// that clients can follow and come back to.
+
+// SubmitCommand starts running a vtctl command in the background, and
+// returns the id of its job. The command does not depend on the
+// caller, it runs until it is done or actionTimeout expires.
+func SubmitCommand(ts topo.Server, args []string, actionTimeout, lockTimeout time.Duration) int64 {
+	wr := wrangler.New(logutil.NewConsoleLogger(), ts, tmclient.NewTabletManagerClient(), lockTimeout)
+	job := wr.StartJob(wrangler.DefaultJobRegistry, strings.Join(args, " "))
+	go func() {
+		var err error
+		defer func() { job.Finish(err) }()
+		defer HandlePanic(&err)
+
+		ctx, cancel := context.WithTimeout(context.Background(), actionTimeout)
+		defer cancel()
+		err = RunCommand(ctx, wr, args)
+	}()
+	return job.ID()
+}
+
+// WaitForJob calls send with all the log events of a job, until it
+// is done, and returns its error. It gives up when ctx is done, and
+// the job keeps running.
+func WaitForJob(ctx context.Context, jobID int64, send func(*logutil.LoggerEvent) error) error {
+	job := wrangler.DefaultJobRegistry.Job(jobID)
+	if job == nil {
+		return fmt.Errorf("unknown job %v, it is not running and did not finish recently", jobID)
+	}
+	from := 0
+	for {
+		events := job.Events(ctx, from)
+		for i := range events.Events {
+			if err := send(&events.Events[i]); err != nil {
+				return err
+			}
+		}
+		from = events.Next
+		if events.Done {
+			if status := job.Status(); status.Error != "" {
+				return errors.New(status.Error)
+			}
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+	}
+}
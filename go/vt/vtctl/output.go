@@ -0,0 +1,66 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vtctl
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/youtube/vitess/go/jscfg"
+	"github.com/youtube/vitess/go/vt/wrangler"
+)
+
+// This file contains the rendering of the results of the read
+// commands, as text or JSON.
+
+const (
+	outputText = "text"
+	outputJSON = "json"
+)
+
+var outputFormat = flag.String("output", outputText, "format of the results of the read commands (GetTablet, GetShard, GetKeyspace, GetSrvKeyspace, ListAllTablets, Validate*, and the per tablet results of the bulk commands like PingTablets): text, or json to only print the result structures as JSON")
+
+// ValidationResult is the result of a Validate command in JSON.
+type ValidationResult struct {
+	Problems []string
+}
+
+func checkOutputFormat() error {
+	switch *outputFormat {
+	case outputText, outputJSON:
+		return nil
+	}
+	return fmt.Errorf("invalid -output %q, must be %v or %v", *outputFormat, outputText, outputJSON)
+}
+
+// printResult prints the result of a read command: as JSON with
+// -output=json, and with printText otherwise.
+func printResult(wr *wrangler.Wrangler, result interface{}, printText func()) {
+	if *outputFormat == outputJSON {
+		wr.Logger().Printf("%v\n", jscfg.ToJSON(result))
+		return
+	}
+	printText()
+}
+
+// printValidation prints the problems found by a Validate command
+// with -output=json, and returns its error. Other errors than a
+// wrangler.ValidationError mean the validation could not run, so
+// nothing is printed.
+func printValidation(wr *wrangler.Wrangler, err error) error {
+	if *outputFormat != outputJSON {
+		return err
+	}
+	result := &ValidationResult{Problems: []string{}}
+	if err != nil {
+		verr, ok := err.(*wrangler.ValidationError)
+		if !ok {
+			return err
+		}
+		result.Problems = verr.Problems
+	}
+	wr.Logger().Printf("%v\n", jscfg.ToJSON(result))
+	return err
+}
@@ -7,6 +7,7 @@ package vtctl
 import (
 	"flag"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/youtube/vitess/go/vt/topo"
@@ -37,8 +38,8 @@ func init() {
 	addCommand("Shards", command{
 		"PlannedReparentShard",
 		commandPlannedReparentShard,
-		"<keyspace/shard> <tablet alias>",
-		"Reparents the shard to the new master. Both old and new master need to be up and running."})
+		"[-dry_run] [-yes] [-wait_slave_timeout=<duration>] <keyspace/shard> <tablet alias>",
+		"Reparents the shard to the new master. Both old and new master need to be up and running. A preflight report is printed first, and when run at a terminal the shard name has to be typed to go on, unless -yes is set. With -dry_run, only the report is printed."})
 	addCommand("Shards", command{
 		"EmergencyReparentShard",
 		commandEmergencyReparentShard,
@@ -65,8 +66,12 @@ func commandDemoteMaster(ctx context.Context, wr *wrangler.Wrangler, subFlags *f
 	if err != nil {
 		return err
 	}
-	_, err = wr.TabletManagerClient().DemoteMaster(ctx, tabletInfo)
-	return err
+	rp, err := wr.TabletManagerClient().DemoteMaster(ctx, tabletInfo)
+	if err != nil {
+		return err
+	}
+	wr.Logger().Printf("%v\n", rp)
+	return nil
 }
 
 func commandReparentTablet(ctx context.Context, wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) error {
@@ -117,6 +122,8 @@ func commandPlannedReparentShard(ctx context.Context, wr *wrangler.Wrangler, sub
 	}
 
 	waitSlaveTimeout := subFlags.Duration("wait_slave_timeout", 30*time.Second, "time to wait for slaves to catch up in reparenting")
+	dryRun := subFlags.Bool("dry_run", false, "only print the preflight report, do not reparent")
+	yes := subFlags.Bool("yes", false, "do not ask to type the shard name to confirm")
 	if err := subFlags.Parse(args); err != nil {
 		return err
 	}
@@ -132,9 +139,53 @@ func commandPlannedReparentShard(ctx context.Context, wr *wrangler.Wrangler, sub
 	if err != nil {
 		return err
 	}
+
+	pf, err := wr.PlannedReparentPreflight(ctx, keyspace, shard, tabletAlias, *waitSlaveTimeout)
+	if err != nil {
+		return err
+	}
+	printResult(wr, pf, func() { printReparentPreflight(wr, pf) })
+	if *dryRun {
+		return nil
+	}
+	if len(pf.Problems) > 0 {
+		return fmt.Errorf("preflight of PlannedReparentShard %v/%v failed: %v", keyspace, shard, strings.Join(pf.Problems, ", "))
+	}
+	if !*yes && confirmer != nil {
+		name := keyspace + "/" + shard
+		if err := confirmer(fmt.Sprintf("Type the shard name (%v) to reparent it to %v: ", name, tabletAlias), name); err != nil {
+			return err
+		}
+	}
 	return wr.PlannedReparentShard(ctx, keyspace, shard, tabletAlias, *waitSlaveTimeout)
 }
 
+// printReparentPreflight prints the preflight report of a reparent.
+func printReparentPreflight(wr *wrangler.Wrangler, pf *wrangler.ReparentPreflight) {
+	wr.Logger().Printf("Reparent of shard %v/%v\n", pf.Keyspace, pf.Shard)
+	wr.Logger().Printf("  current master:     %v\n", pf.OldMaster)
+	wr.Logger().Printf("  candidate:          %v (%v)\n", pf.Candidate, pf.CandidateType)
+	if len(pf.CandidateHealth) > 0 {
+		wr.Logger().Printf("  candidate health:   %v\n", pf.CandidateHealth)
+	}
+	if pf.CandidateStatus != nil {
+		wr.Logger().Printf("  candidate lag:      %vs (replicating: %v)\n", pf.CandidateStatus.SecondsBehindMaster, pf.CandidateStatus.SlaveRunning())
+	}
+	slaves := make([]string, len(pf.Slaves))
+	for i, alias := range pf.Slaves {
+		slaves[i] = alias.String()
+	}
+	wr.Logger().Printf("  reparented tablets: %v\n", strings.Join(slaves, " "))
+	wr.Logger().Printf("  cells affected:     %v\n", strings.Join(pf.Cells, " "))
+	wr.Logger().Printf("  writes refused for: at least %v\n", pf.EstimatedUnavailability)
+	for _, warning := range pf.Warnings {
+		wr.Logger().Printf("WARNING: %v\n", warning)
+	}
+	for _, problem := range pf.Problems {
+		wr.Logger().Printf("PROBLEM: %v\n", problem)
+	}
+}
+
 func commandEmergencyReparentShard(ctx context.Context, wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) error {
 	if *disableActiveReparents {
 		return fmt.Errorf("active reparent actions disable in this cluster")
@@ -0,0 +1,89 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vtctl
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/youtube/vitess/go/jscfg"
+	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/vt/topotools"
+	"github.com/youtube/vitess/go/vt/wrangler"
+	"golang.org/x/net/context"
+)
+
+// This file contains the commands to read and write the raw topology
+// records, to inspect them or patch them by hand.
+
+const topoPathHelp = "The paths are keyspace/<keyspace>, shard/<keyspace>/<shard>, tablet/<tablet alias>, srv_keyspace/<cell>/<keyspace>, srv_shard/<cell>/<keyspace>/<shard> and end_points/<cell>/<keyspace>/<shard>/<tablet type>."
+
+func init() {
+	addCommand("Generic", command{
+		"TopoCat",
+		commandTopoCat,
+		"<path>",
+		"Prints the JSON of a topology record, with its path and version, in the format TopoCp reads. " + topoPathHelp})
+	addCommand("Generic", command{
+		"TopoCp",
+		commandTopoCp,
+		"[-force] <file> <path>",
+		"Writes a record file printed by TopoCat, and then edited, back to its path. The write is refused if the record changed since TopoCat printed it, or if the file doesn't match the record type. Changes to the serving graph that remove or change values require -force. " + topoPathHelp})
+}
+
+func commandTopoCat(ctx context.Context, wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) error {
+	if err := subFlags.Parse(args); err != nil {
+		return err
+	}
+	if subFlags.NArg() != 1 {
+		return fmt.Errorf("action TopoCat requires <path>")
+	}
+	rp, err := topotools.ParseRawPath(subFlags.Arg(0))
+	if err != nil {
+		return err
+	}
+	rr, err := topotools.ReadRawRecord(wr.TopoServer(), rp)
+	if err != nil {
+		return err
+	}
+	wr.Logger().Printf("%v\n", jscfg.ToJSON(rr))
+	return nil
+}
+
+func commandTopoCp(ctx context.Context, wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) error {
+	force := subFlags.Bool("force", false, "write serving graph records even if the change removes or changes values")
+	if err := subFlags.Parse(args); err != nil {
+		return err
+	}
+	if subFlags.NArg() != 2 {
+		return fmt.Errorf("action TopoCp requires <file> <path>")
+	}
+	target, err := topotools.ParseRawPath(subFlags.Arg(1))
+	if err != nil {
+		return err
+	}
+	data, err := ioutil.ReadFile(subFlags.Arg(0))
+	if err != nil {
+		return fmt.Errorf("cannot read file %v: %v", subFlags.Arg(0), err)
+	}
+	rp, rr, err := topotools.DecodeRawRecord(data)
+	if err != nil {
+		return err
+	}
+	if rp.String() != target.String() {
+		return fmt.Errorf("file %v holds the record of %v, not %v", subFlags.Arg(0), rp, target)
+	}
+
+	switch err := topotools.WriteRawRecord(ctx, wr.TopoServer(), rp, rr, *force); err {
+	case nil:
+		wr.Logger().Infof("wrote %v", rp)
+		return nil
+	case topo.ErrBadVersion:
+		return fmt.Errorf("%v changed since version %v was printed, use TopoCat to read it again", rp, rr.Version)
+	default:
+		return err
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net"
+	"regexp"
 	"sort"
 	"strconv"
 	"strings"
@@ -19,12 +20,14 @@ import (
 	"github.com/youtube/vitess/go/flagutil"
 	"github.com/youtube/vitess/go/jscfg"
 	"github.com/youtube/vitess/go/netutil"
+	"github.com/youtube/vitess/go/stats"
 	"github.com/youtube/vitess/go/vt/client2"
 	hk "github.com/youtube/vitess/go/vt/hook"
 	"github.com/youtube/vitess/go/vt/key"
 	"github.com/youtube/vitess/go/vt/logutil"
 	myproto "github.com/youtube/vitess/go/vt/mysqlctl/proto"
 	"github.com/youtube/vitess/go/vt/tabletmanager/actionnode"
+	tproto "github.com/youtube/vitess/go/vt/tabletserver/proto"
 	"github.com/youtube/vitess/go/vt/topo"
 	"github.com/youtube/vitess/go/vt/topotools"
 	"github.com/youtube/vitess/go/vt/wrangler"
@@ -80,12 +83,21 @@ var commands = []commandGroup{
 			command{"StopSlave", commandStopSlave,
 				"[<tablet alias>]",
 				"Stops replication on the slave."},
+			command{"GetBlpCheckpoints", commandGetBlpCheckpoints,
+				"<tablet alias>",
+				"Outputs the json version of the blp_checkpoint table of a destination tablet of filtered replication: the position each binlog player committed, with the timestamp of its last transaction."},
+			command{"GetBlpStatus", commandGetBlpStatus,
+				"<tablet alias>",
+				"Outputs the json version of the status of the binlog players of a destination master of filtered replication: the position, lag, source tablet and last error of each."},
 			command{"ChangeSlaveType", commandChangeSlaveType,
-				"[-force] [-dry-run] <tablet alias> <tablet type>",
+				"[-force] [-dry-run] [-override_transition] <tablet alias> <tablet type>",
 				"Change the db type for this tablet if possible. This is mostly for arranging replicas - it will not convert a master.\n" +
 					"NOTE: This will automatically update the serving graph.\n" +
 					"Valid <tablet type>:\n" +
 					"  " + strings.Join(topo.MakeStringTypeList(topo.SlaveTabletTypes), " ")},
+			command{"SetMaintenanceMode", commandSetMaintenanceMode,
+				"[-off] [-reason <reason>] <tablet alias>",
+				"Puts a tablet in maintenance mode (or out of it with -off). In maintenance mode, the tablet refuses type changes and reparent actions. Change its type first to take it out of rotation."},
 			command{"Ping", commandPing,
 				"<tablet alias>",
 				"Check that the agent is awake and responding to RPCs. Can be blocked by other in-flight operations."},
@@ -95,6 +107,9 @@ var commands = []commandGroup{
 			command{"RunHealthCheck", commandRunHealthCheck,
 				"<tablet alias> <target tablet type>",
 				"Asks a remote tablet to run a health check with the provided target type."},
+			command{"SetPoolSize", commandSetPoolSize,
+				"<tablet alias> <app|stream|transaction> <size>",
+				"Resizes a connection pool of the query service of a tablet, up to -queryserver-config-pool-max-cap-factor times its initial size. Shrinking waits for the connections in use to be returned. The size is lost when the tablet restarts."},
 			command{"HealthStream", commandHealthStream,
 				"<tablet alias>",
 				"Streams the health status out of a tablet."},
@@ -105,14 +120,20 @@ var commands = []commandGroup{
 				"<tablet alias> <duration>",
 				"Block the action queue for the specified duration (mostly for testing)."},
 			command{"Backup", commandBackup,
-				"[-concurrency=4] <tablet alias>",
-				"Stop mysqld and copy data to BackupStorage."},
+				"[-concurrency=4] [-bandwidth_limit=<bytes per second>] [-skip_space_check] [-allow_master] <tablet alias>",
+				"Stop mysqld and copy data to BackupStorage. The backup is refused if the BackupStorage doesn't have enough space for it, unless -skip_space_check is set, and for a master, unless -allow_master is set."},
 			command{"ExecuteHook", commandExecuteHook,
-				"<tablet alias> <hook name> [<param1=value1> <param2=value2> ...]",
-				"This runs the specified hook on the given tablet."},
+				"[-json_parameters=<json document>] [-timeout=<duration>] <tablet alias> <hook name> [<param1=value1> <param2=value2> ...]",
+				"This runs the specified hook on the given tablet. The optional JSON document is sent to the hook on stdin, and the hook is killed if it runs for longer than the timeout."},
 			command{"ExecuteFetchAsDba", commandExecuteFetchAsDba,
 				"[--max_rows=10000] [--want_fields] [--disable_binlogs] <tablet alias> <sql command>",
 				"Runs the given sql command as a DBA on the remote tablet."},
+			command{"GetActionHistory", commandGetActionHistory,
+				"<tablet alias>",
+				"Displays the recent tablet manager actions run by the tablet, and their outcome."},
+			command{"GetTabletStats", commandGetTabletStats,
+				"<tablet alias>",
+				"Displays the query service activity of the tablet (QPS by plan type, errors, connections in use)."},
 		},
 	},
 	commandGroup{
@@ -135,6 +156,9 @@ var commands = []commandGroup{
 			command{"ShardReplicationPositions", commandShardReplicationPositions,
 				"<keyspace/shard>",
 				"Show slave status on all machines in the shard graph."},
+			command{"GetShardTabletStats", commandGetShardTabletStats,
+				"<keyspace/shard>",
+				"Displays the query service activity of all the tablets in the shard, and their total."},
 			command{"ListShardTablets", commandListShardTablets,
 				"<keyspace/shard>)",
 				"List all tablets in a given shard."},
@@ -206,6 +230,9 @@ var commands = []commandGroup{
 			command{"Validate", commandValidate,
 				"[-ping-tablets]",
 				"Validate all nodes reachable from global replication graph and all tablets in all discoverable cells are consistent."},
+			command{"ValidateServingGraph", commandValidateServingGraph,
+				"<cell>",
+				"Validate the serving graph of a cell matches the tablets: no end point for a scrapped or missing tablet, or of the wrong type, and one for each serving tablet."},
 			command{"RebuildReplicationGraph", commandRebuildReplicationGraph,
 				"<cell1>,<cell2>... <keyspace1>,<keyspace2>,...",
 				"HIDDEN This takes the Thor's hammer approach of recovery and should only be used in emergencies.  cell1,cell2,... are the canonical source of data for the system. This function uses that canonical data to recover the replication graph, at which point further auditing with Validate can reveal any remaining issues."},
@@ -229,15 +256,18 @@ var commands = []commandGroup{
 				"<tablet alias>",
 				"Asks a remote tablet to reload its schema."},
 			command{"ValidateSchemaShard", commandValidateSchemaShard,
-				"[-exclude_tables=''] [-include-views] <keyspace/shard>",
-				"Validate the master schema matches all the slaves."},
+				"[-exclude_tables=''] [-include-views] [-suggest_fixes] [-verbose] [-concurrency=8] <keyspace/shard>",
+				"Validate the master schema matches all the slaves. Only the differing tables are listed, unless -verbose is set."},
 			command{"ValidateSchemaKeyspace", commandValidateSchemaKeyspace,
-				"[-exclude_tables=''] [-include-views] <keyspace name>",
-				"Validate the master schema from shard 0 matches all the other tablets in the keyspace."},
+				"[-exclude_tables=''] [-include-views] [-verbose] [-concurrency=8] <keyspace name>",
+				"Validate the master schema from shard 0 matches all the other masters in the keyspace, and that the slaves match their master. Only the differing tables are listed, unless -verbose is set."},
 
 			command{"ApplySchema", commandApplySchema,
-				"[-force] {-sql=<sql> || -sql-file=<filename>} <keyspace>",
-				"Apply the schema change to the specified keyspace."},
+				"[-force] [-skip_if_applied] [-allow_drop] {-sql=<sql> || -sql-file=<filename>} <keyspace>",
+				"Apply the schema change to the specified keyspace. The statements are recorded in the schema change log of the keyspace. With -skip_if_applied, the statements the log says were applied on all shards are skipped. The changes that drop tables are refused without -allow_drop."},
+			command{"GetSchemaChanges", commandGetSchemaChanges,
+				"<keyspace>",
+				"Display the log of the schema changes applied to the keyspace by ApplySchema, oldest first."},
 			command{"CopySchemaShard", commandCopySchemaShard,
 				"[-tables=<table1>,<table2>,...] [-exclude_tables=<table1>,<table2>,...] [-include-views] <src tablet alias> <dest keyspace/shard>",
 				"Copy the schema from a source tablet to the specified shard. The schema is applied directly on the master of the destination shard, and is propogated to the replicas through binlogs."},
@@ -258,6 +288,9 @@ var commands = []commandGroup{
 			command{"ValidatePermissionsKeyspace", commandValidatePermissionsKeyspace,
 				"<keyspace name>",
 				"Validate the master permissions from shard 0 match all the other tablets in the keyspace."},
+			command{"ReloadUsers", commandReloadUsers,
+				"<tablet alias>",
+				"Apply the users spec file of a tablet to its mysqld, and display the grants that were added or revoked."},
 
 			command{"GetVSchema", commandGetVSchema,
 				"",
@@ -265,6 +298,23 @@ var commands = []commandGroup{
 			command{"ApplyVSchema", commandApplyVSchema,
 				"{-vschema=<vschema> || -vschema_file=<vschema file>}",
 				"Apply the VTGate routing schema."},
+
+			command{"GetTableACL", commandGetTableACL,
+				"[-keyspace=<keyspace>]",
+				"Display the table ACL config the tablets of a keyspace load with -table_acl_from_topo, or the global one."},
+			command{"SetTableACL", commandSetTableACL,
+				"[-keyspace=<keyspace>] [-dry_run] [-concurrency=8] <config file>",
+				"Save a table ACL config, in the -table-acl-config format, as the one of a keyspace or as the global one, and make the tablets that use it reload it. With -dry_run, the tablets log and count the queries it denies, without failing them."},
+
+			command{"GetQueryRules", commandGetQueryRules,
+				"{-keyspace=<keyspace> || -tablet=<tablet alias>}",
+				"Display the query rules of a keyspace or of a tablet, that the tablets started with -topocustomrules apply."},
+			command{"SetQueryRule", commandSetQueryRule,
+				"{-keyspace=<keyspace> || -tablet=<tablet alias>} [-ttl=<duration>] <rule>",
+				"Add a query rule, in the -filecustomrules JSON format, to a keyspace or to a tablet, replacing the rule with the same name. The tablets apply it without a restart. A tablet rule replaces the keyspace rule with the same name. With -ttl, the rule expires after it, which is meant for emergency rules."},
+			command{"ClearQueryRules", commandClearQueryRules,
+				"{-keyspace=<keyspace> || -tablet=<tablet alias>} [<rule name>...]",
+				"Remove the named query rules of a keyspace or of a tablet, or all of them."},
 		},
 	},
 	commandGroup{
@@ -297,8 +347,15 @@ func init() {
 	// would reference commandHelp that references commands
 	// (circular reference)
 	addCommand("Generic", command{"Help", commandHelp,
-		"[command name]",
-		"Prints the list of available commands, or help on a specific command."})
+		"[command or group name]",
+		"Prints the list of available commands, the commands of a group, or help on a specific command."})
+
+	// Validate acts on everything, like ValidateKeyspace acts on
+	// a keyspace and ValidateShard on a shard.
+	addCommandAlias("ValidateAll", "Validate")
+
+	// ExecuteFetch was renamed to say which user runs the query.
+	addDeprecatedCommandAlias("ExecuteFetch", "ExecuteFetchAsDba")
 }
 
 func addCommand(groupName string, c command) {
@@ -311,6 +368,119 @@ func addCommand(groupName string, c command) {
 	panic(fmt.Errorf("Trying to add to missing group %v", groupName))
 }
 
+// commandAlias is another name of a command. A deprecated alias still
+// runs the command, with a warning: it is the old name of a renamed
+// command, kept until the scripts using it are fixed.
+type commandAlias struct {
+	alias      string
+	name       string
+	deprecated bool
+}
+
+var (
+	// commandAliases are by lower case alias.
+	commandAliases = make(map[string]commandAlias)
+
+	// deprecatedCommandCounts counts the runs of the deprecated
+	// aliases by alias, to know when they can be removed.
+	deprecatedCommandCounts = stats.NewCounters("VtctlDeprecatedCommands")
+)
+
+// addCommandAlias makes alias another name of the command name.
+func addCommandAlias(alias, name string) {
+	registerCommandAlias(commandAlias{alias: alias, name: name})
+}
+
+// addDeprecatedCommandAlias keeps alias, the old name of the command
+// name, working. Running it prints a warning.
+func addDeprecatedCommandAlias(alias, name string) {
+	registerCommandAlias(commandAlias{alias: alias, name: name, deprecated: true})
+}
+
+func registerCommandAlias(ca commandAlias) {
+	key := strings.ToLower(ca.alias)
+	if _, ok := commandAliases[key]; ok {
+		panic(fmt.Errorf("alias %v is already registered", ca.alias))
+	}
+	if findCommandByName(ca.alias) != nil {
+		panic(fmt.Errorf("alias %v is the name of a command", ca.alias))
+	}
+	commandAliases[key] = ca
+}
+
+// findCommandByName returns the command with the given name, ignoring
+// case, or nil.
+func findCommandByName(name string) *command {
+	lowerCaseName := strings.ToLower(name)
+	for _, group := range commands {
+		for i, cmd := range group.commands {
+			if strings.ToLower(cmd.name) == lowerCaseName {
+				return &group.commands[i]
+			}
+		}
+	}
+	return nil
+}
+
+// findCommand returns the command with the given name or alias, and
+// the alias if it was one.
+func findCommand(name string) (*command, *commandAlias) {
+	if cmd := findCommandByName(name); cmd != nil {
+		return cmd, nil
+	}
+	ca, ok := commandAliases[strings.ToLower(name)]
+	if !ok {
+		return nil, nil
+	}
+	cmd := findCommandByName(ca.name)
+	if cmd == nil {
+		panic(fmt.Errorf("alias %v is for the unknown command %v", name, ca.name))
+	}
+	return cmd, &ca
+}
+
+// commandAliasNames returns the aliases of the command name, the
+// deprecated ones only if deprecated is set.
+func commandAliasNames(name string, deprecated bool) []string {
+	var aliases []string
+	for _, ca := range commandAliases {
+		if ca.name == name && ca.deprecated == deprecated {
+			aliases = append(aliases, ca.alias)
+		}
+	}
+	sort.Strings(aliases)
+	return aliases
+}
+
+// paramsFlagRegexp matches the flags written in the params of a
+// command, like [-force] or [--max_rows=10000], with their name.
+var paramsFlagRegexp = regexp.MustCompile(`(?:^|[\s\[|])--?([\w.\-]+)`)
+
+// flagSynopsis returns the flags of subFlags that the usage of a
+// command doesn't mention, like they are written in its params:
+// the usage of a command is generated from the flags it defines, and
+// params only has to list its arguments.
+func flagSynopsis(subFlags *flag.FlagSet, params string) string {
+	written := make(map[string]bool)
+	for _, m := range paramsFlagRegexp.FindAllStringSubmatch(params, -1) {
+		written[m[1]] = true
+	}
+	var synopsis []string
+	subFlags.VisitAll(func(f *flag.Flag) {
+		if written[f.Name] {
+			return
+		}
+		if bf, ok := f.Value.(interface {
+			IsBoolFlag() bool
+		}); ok && bf.IsBoolFlag() {
+			synopsis = append(synopsis, fmt.Sprintf("[-%v]", f.Name))
+			return
+		}
+		synopsis = append(synopsis, fmt.Sprintf("[-%v=<%v>]", f.Name, f.Name))
+	})
+	return strings.Join(synopsis, " ")
+}
+
 func fmtMapAwkable(m map[string]string) string {
 	pairs := make([]string, len(m))
 	i := 0
@@ -356,9 +526,11 @@ func dumpAllTablets(ctx context.Context, wr *wrangler.Wrangler, zkVtPath string)
 	if err != nil {
 		return err
 	}
-	for _, ti := range tablets {
-		wr.Logger().Printf("%v\n", fmtTabletAwkable(ti))
-	}
+	printResult(wr, tablets, func() {
+		for _, ti := range tablets {
+			wr.Logger().Printf("%v\n", fmtTabletAwkable(ti))
+		}
+	})
 	return nil
 }
 
@@ -739,9 +911,56 @@ func commandStopSlave(ctx context.Context, wr *wrangler.Wrangler, subFlags *flag
 	return wr.TabletManagerClient().StopSlave(ctx, ti)
 }
 
+func commandGetBlpCheckpoints(ctx context.Context, wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) error {
+	if err := subFlags.Parse(args); err != nil {
+		return err
+	}
+	if subFlags.NArg() != 1 {
+		return fmt.Errorf("action GetBlpCheckpoints requires <tablet alias>")
+	}
+
+	tabletAlias, err := topo.ParseTabletAliasString(subFlags.Arg(0))
+	if err != nil {
+		return err
+	}
+	ti, err := wr.TopoServer().GetTablet(tabletAlias)
+	if err != nil {
+		return fmt.Errorf("failed reading tablet %v: %v", tabletAlias, err)
+	}
+	bcl, err := wr.TabletManagerClient().GetBlpCheckpoints(ctx, ti)
+	if err == nil {
+		wr.Logger().Printf("%v\n", jscfg.ToJSON(bcl))
+	}
+	return err
+}
+
+func commandGetBlpStatus(ctx context.Context, wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) error {
+	if err := subFlags.Parse(args); err != nil {
+		return err
+	}
+	if subFlags.NArg() != 1 {
+		return fmt.Errorf("action GetBlpStatus requires <tablet alias>")
+	}
+
+	tabletAlias, err := topo.ParseTabletAliasString(subFlags.Arg(0))
+	if err != nil {
+		return err
+	}
+	ti, err := wr.TopoServer().GetTablet(tabletAlias)
+	if err != nil {
+		return fmt.Errorf("failed reading tablet %v: %v", tabletAlias, err)
+	}
+	bsl, err := wr.TabletManagerClient().GetBlpStatus(ctx, ti)
+	if err == nil {
+		wr.Logger().Printf("%v\n", jscfg.ToJSON(bsl))
+	}
+	return err
+}
+
 func commandChangeSlaveType(ctx context.Context, wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) error {
 	force := subFlags.Bool("force", false, "will change the type in zookeeper, and not run hooks")
 	dryRun := subFlags.Bool("dry-run", false, "just list the proposed change")
+	overrideTransition := subFlags.Bool("override_transition", false, "(emergencies only) asks the tablet to apply the change even if the type transition is illegal, the shard record is not fixed up")
 
 	if err := subFlags.Parse(args); err != nil {
 		return err
@@ -749,6 +968,9 @@ func commandChangeSlaveType(ctx context.Context, wr *wrangler.Wrangler, subFlags
 	if subFlags.NArg() != 2 {
 		return fmt.Errorf("action ChangeSlaveType requires <tablet alias> <db type>")
 	}
+	if *overrideTransition && (*force || *dryRun) {
+		return fmt.Errorf("action ChangeSlaveType: -override_transition cannot be used with -force or -dry-run")
+	}
 
 	tabletAlias, err := topo.ParseTabletAliasString(subFlags.Arg(0))
 	if err != nil {
@@ -771,9 +993,31 @@ func commandChangeSlaveType(ctx context.Context, wr *wrangler.Wrangler, subFlags
 		wr.Logger().Printf("+ %v\n", fmtTabletAwkable(ti))
 		return nil
 	}
+	if *overrideTransition {
+		return wr.ChangeTypeOverride(ctx, tabletAlias, newType)
+	}
 	return wr.ChangeType(ctx, tabletAlias, newType, *force)
 }
 
+func commandSetMaintenanceMode(ctx context.Context, wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) error {
+	off := subFlags.Bool("off", false, "takes the tablet out of maintenance mode")
+	reason := subFlags.String("reason", "", "why the tablet is in maintenance mode, required unless -off is used")
+	if err := subFlags.Parse(args); err != nil {
+		return err
+	}
+	if subFlags.NArg() != 1 {
+		return fmt.Errorf("action SetMaintenanceMode requires <tablet alias>")
+	}
+	if !*off && *reason == "" {
+		return fmt.Errorf("action SetMaintenanceMode requires -reason")
+	}
+	tabletAlias, err := topo.ParseTabletAliasString(subFlags.Arg(0))
+	if err != nil {
+		return err
+	}
+	return wr.SetMaintenanceMode(ctx, tabletAlias, !*off, *reason)
+}
+
 func commandPing(ctx context.Context, wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) error {
 	if err := subFlags.Parse(args); err != nil {
 		return err
@@ -832,6 +1076,24 @@ func commandRunHealthCheck(ctx context.Context, wr *wrangler.Wrangler, subFlags
 	return wr.TabletManagerClient().RunHealthCheck(ctx, tabletInfo, servedType)
 }
 
+func commandSetPoolSize(ctx context.Context, wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) error {
+	if err := subFlags.Parse(args); err != nil {
+		return err
+	}
+	if subFlags.NArg() != 3 {
+		return fmt.Errorf("action SetPoolSize requires <tablet alias> <pool> <size>")
+	}
+	tabletAlias, err := topo.ParseTabletAliasString(subFlags.Arg(0))
+	if err != nil {
+		return err
+	}
+	size, err := strconv.Atoi(subFlags.Arg(2))
+	if err != nil {
+		return fmt.Errorf("invalid size %v: %v", subFlags.Arg(2), err)
+	}
+	return wr.SetPoolSize(ctx, tabletAlias, subFlags.Arg(1), size)
+}
+
 func commandHealthStream(ctx context.Context, wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) error {
 	if err := subFlags.Parse(args); err != nil {
 		return err
@@ -891,6 +1153,9 @@ func commandSleep(ctx context.Context, wr *wrangler.Wrangler, subFlags *flag.Fla
 
 func commandBackup(ctx context.Context, wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) error {
 	concurrency := subFlags.Int("concurrency", 4, "how many compression/checksum jobs to run simultaneously")
+	bandwidthLimit := subFlags.Int64("bandwidth_limit", 0, "maximum bytes per second to read, for all files (0 uses the tablet's -backup_bandwidth_limit, -1 removes any limit)")
+	skipSpaceCheck := subFlags.Bool("skip_space_check", false, "take the backup even if the BackupStorage doesn't seem to have enough space for it")
+	allowMaster := subFlags.Bool("allow_master", false, "take the backup even if the tablet is a master")
 	if err := subFlags.Parse(args); err != nil {
 		return err
 	}
@@ -902,18 +1167,7 @@ func commandBackup(ctx context.Context, wr *wrangler.Wrangler, subFlags *flag.Fl
 	if err != nil {
 		return err
 	}
-	tabletInfo, err := wr.TopoServer().GetTablet(tabletAlias)
-	if err != nil {
-		return err
-	}
-	logStream, errFunc, err := wr.TabletManagerClient().Backup(ctx, tabletInfo, *concurrency)
-	if err != nil {
-		return err
-	}
-	for e := range logStream {
-		wr.Logger().Infof("%v", e)
-	}
-	return errFunc()
+	return wr.Backup(ctx, tabletAlias, *concurrency, *bandwidthLimit, *skipSpaceCheck, *allowMaster)
 }
 
 func commandExecuteFetchAsDba(ctx context.Context, wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) error {
@@ -942,6 +1196,8 @@ func commandExecuteFetchAsDba(ctx context.Context, wr *wrangler.Wrangler, subFla
 }
 
 func commandExecuteHook(ctx context.Context, wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) error {
+	jsonParameters := subFlags.String("json_parameters", "", "JSON document to send to the hook on stdin")
+	timeout := subFlags.Duration("timeout", 0, "how long the hook can run before it is killed, 0 for no limit")
 	if err := subFlags.Parse(args); err != nil {
 		return err
 	}
@@ -953,7 +1209,12 @@ func commandExecuteHook(ctx context.Context, wr *wrangler.Wrangler, subFlags *fl
 	if err != nil {
 		return err
 	}
-	hook := &hk.Hook{Name: subFlags.Arg(1), Parameters: subFlags.Args()[2:]}
+	hook := &hk.Hook{
+		Name:           subFlags.Arg(1),
+		Parameters:     subFlags.Args()[2:],
+		JSONParameters: *jsonParameters,
+		Timeout:        *timeout,
+	}
 	hr, err := wr.ExecuteHook(ctx, tabletAlias, hook)
 	if err == nil {
 		log.Infof(hr.String())
@@ -961,6 +1222,44 @@ func commandExecuteHook(ctx context.Context, wr *wrangler.Wrangler, subFlags *fl
 	return err
 }
 
+func commandGetActionHistory(ctx context.Context, wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) error {
+	if err := subFlags.Parse(args); err != nil {
+		return err
+	}
+	if subFlags.NArg() != 1 {
+		return fmt.Errorf("action GetActionHistory requires <tablet alias>")
+	}
+
+	tabletAlias, err := topo.ParseTabletAliasString(subFlags.Arg(0))
+	if err != nil {
+		return err
+	}
+	records, err := wr.GetActionHistory(ctx, tabletAlias)
+	if err == nil {
+		wr.Logger().Printf("%v\n", jscfg.ToJSON(records))
+	}
+	return err
+}
+
+func commandGetTabletStats(ctx context.Context, wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) error {
+	if err := subFlags.Parse(args); err != nil {
+		return err
+	}
+	if subFlags.NArg() != 1 {
+		return fmt.Errorf("action GetTabletStats requires <tablet alias>")
+	}
+
+	tabletAlias, err := topo.ParseTabletAliasString(subFlags.Arg(0))
+	if err != nil {
+		return err
+	}
+	rs, err := wr.GetTabletStats(ctx, tabletAlias)
+	if err == nil {
+		wr.Logger().Printf("%v\n", jscfg.ToJSON(rs))
+	}
+	return err
+}
+
 func commandCreateShard(ctx context.Context, wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) error {
 	force := subFlags.Bool("force", false, "will keep going even if the keyspace already exists")
 	parent := subFlags.Bool("parent", false, "creates the parent keyspace if it doesn't exist")
@@ -1066,7 +1365,45 @@ func commandValidateShard(ctx context.Context, wr *wrangler.Wrangler, subFlags *
 	if err != nil {
 		return err
 	}
-	return wr.ValidateShard(ctx, keyspace, shard, *pingTablets)
+	return printValidation(wr, wr.ValidateShard(ctx, keyspace, shard, *pingTablets))
+}
+
+func commandValidateServingGraph(ctx context.Context, wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) error {
+	if err := subFlags.Parse(args); err != nil {
+		return err
+	}
+	if subFlags.NArg() != 1 {
+		return fmt.Errorf("action ValidateServingGraph requires <cell>")
+	}
+	return printValidation(wr, wr.ValidateServingGraph(ctx, subFlags.Arg(0)))
+}
+
+func commandGetShardTabletStats(ctx context.Context, wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) error {
+	if err := subFlags.Parse(args); err != nil {
+		return err
+	}
+	if subFlags.NArg() != 1 {
+		return fmt.Errorf("action GetShardTabletStats requires <keyspace/shard>")
+	}
+	keyspace, shard, err := topo.ParseKeyspaceShardString(subFlags.Arg(0))
+	if err != nil {
+		return err
+	}
+	stats, total, err := wr.GetShardTabletStats(ctx, keyspace, shard)
+	if err != nil {
+		return err
+	}
+
+	// JSON maps need string keys
+	tablets := make(map[string]*tproto.RuntimeStats, len(stats))
+	for alias, rs := range stats {
+		tablets[alias.String()] = rs
+	}
+	wr.Logger().Printf("%v\n", jscfg.ToJSON(struct {
+		Tablets map[string]*tproto.RuntimeStats
+		Total   *tproto.RuntimeStats
+	}{tablets, total}))
+	return nil
 }
 
 func commandShardReplicationPositions(ctx context.Context, wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) error {
@@ -1466,7 +1803,7 @@ func commandValidateKeyspace(ctx context.Context, wr *wrangler.Wrangler, subFlag
 	}
 
 	keyspace := subFlags.Arg(0)
-	return wr.ValidateKeyspace(ctx, keyspace, *pingTablets)
+	return printValidation(wr, wr.ValidateKeyspace(ctx, keyspace, *pingTablets))
 }
 
 func commandMigrateServedTypes(ctx context.Context, wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) error {
@@ -1583,7 +1920,7 @@ func commandValidate(ctx context.Context, wr *wrangler.Wrangler, subFlags *flag.
 	if subFlags.NArg() != 0 {
 		log.Warningf("action Validate doesn't take any parameter any more")
 	}
-	return wr.Validate(ctx, *pingTablets)
+	return printValidation(wr, wr.Validate(ctx, *pingTablets))
 }
 
 func commandRebuildReplicationGraph(ctx context.Context, wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) error {
@@ -1690,6 +2027,9 @@ func commandReloadSchema(ctx context.Context, wr *wrangler.Wrangler, subFlags *f
 func commandValidateSchemaShard(ctx context.Context, wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) error {
 	excludeTables := subFlags.String("exclude_tables", "", "comma separated list of regexps for tables to exclude")
 	includeViews := subFlags.Bool("include-views", false, "include views in the validation")
+	suggestFixes := subFlags.Bool("suggest_fixes", false, "display the statements that would make the slaves schema match the master")
+	verbose := subFlags.Bool("verbose", false, "display the complete schema differences, instead of the differing table names")
+	fetchConcurrency := subFlags.Int("concurrency", wrangler.DefaultSchemaFetchConcurrency, "how many schemas to fetch at the same time")
 	if err := subFlags.Parse(args); err != nil {
 		return err
 	}
@@ -1705,12 +2045,14 @@ func commandValidateSchemaShard(ctx context.Context, wr *wrangler.Wrangler, subF
 	if *excludeTables != "" {
 		excludeTableArray = strings.Split(*excludeTables, ",")
 	}
-	return wr.ValidateSchemaShard(ctx, keyspace, shard, excludeTableArray, *includeViews)
+	return printValidation(wr, wr.ValidateSchemaShard(ctx, keyspace, shard, excludeTableArray, *includeViews, *suggestFixes, *verbose, *fetchConcurrency))
 }
 
 func commandValidateSchemaKeyspace(ctx context.Context, wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) error {
 	excludeTables := subFlags.String("exclude_tables", "", "comma separated list of regexps for tables to exclude")
 	includeViews := subFlags.Bool("include-views", false, "include views in the validation")
+	verbose := subFlags.Bool("verbose", false, "display the complete schema differences, instead of the differing table names")
+	fetchConcurrency := subFlags.Int("concurrency", wrangler.DefaultSchemaFetchConcurrency, "how many schemas to fetch at the same time")
 	if err := subFlags.Parse(args); err != nil {
 		return err
 	}
@@ -1723,7 +2065,7 @@ func commandValidateSchemaKeyspace(ctx context.Context, wr *wrangler.Wrangler, s
 	if *excludeTables != "" {
 		excludeTableArray = strings.Split(*excludeTables, ",")
 	}
-	return wr.ValidateSchemaKeyspace(ctx, keyspace, excludeTableArray, *includeViews)
+	return printValidation(wr, wr.ValidateSchemaKeyspace(ctx, keyspace, excludeTableArray, *includeViews, *verbose, *fetchConcurrency))
 }
 
 func commandApplySchema(ctx context.Context, wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) error {
@@ -1731,6 +2073,8 @@ func commandApplySchema(ctx context.Context, wr *wrangler.Wrangler, subFlags *fl
 	sql := subFlags.String("sql", "", "a list of sql commands separated by semicolon")
 	sqlFile := subFlags.String("sql-file", "", "file containing the sql commands")
 	waitSlaveTimeout := subFlags.Duration("wait_slave_timeout", 30*time.Second, "time to wait for slaves to catch up in reparenting")
+	skipIfApplied := subFlags.Bool("skip_if_applied", false, "skip the statements the schema change log of the keyspace says were already applied on all shards")
+	allowDrop := subFlags.Bool("allow_drop", false, "apply the changes that drop tables, they are refused otherwise")
 	if err := subFlags.Parse(args); err != nil {
 		return err
 	}
@@ -1743,13 +2087,47 @@ func commandApplySchema(ctx context.Context, wr *wrangler.Wrangler, subFlags *fl
 	if err != nil {
 		return err
 	}
-	scr, err := wr.ApplySchemaKeyspace(ctx, keyspace, change, true, *force, *waitSlaveTimeout)
-	if err == nil {
-		log.Infof(scr.String())
-	}
+	_, err = wr.ApplySchemaKeyspace(ctx, keyspace, change, true, *force, *skipIfApplied, *allowDrop, *waitSlaveTimeout)
 	return err
 }
 
+func commandGetSchemaChanges(ctx context.Context, wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) error {
+	if err := subFlags.Parse(args); err != nil {
+		return err
+	}
+	if subFlags.NArg() != 1 {
+		return fmt.Errorf("action GetSchemaChanges requires <keyspace>")
+	}
+
+	ki, err := wr.TopoServer().GetKeyspace(subFlags.Arg(0))
+	if err != nil {
+		return err
+	}
+	changes := ki.SchemaChanges
+	if changes == nil {
+		changes = []*topo.SchemaChange{}
+	}
+	printResult(wr, changes, func() {
+		for _, sc := range changes {
+			shards := make([]string, 0, len(sc.ShardResults))
+			for shard := range sc.ShardResults {
+				shards = append(shards, shard)
+			}
+			sort.Strings(shards)
+			results := make([]string, len(shards))
+			for i, shard := range shards {
+				if e := sc.ShardResults[shard]; e != "" {
+					results[i] = fmt.Sprintf("%v: ERROR %v", shard, e)
+				} else {
+					results[i] = fmt.Sprintf("%v: OK", shard)
+				}
+			}
+			wr.Logger().Printf("%v %v %v [%v]\n", sc.Time.Format(time.RFC3339), sc.Hash[:12], sc.Statement, strings.Join(results, ", "))
+		}
+	})
+	return nil
+}
+
 func commandCopySchemaShard(ctx context.Context, wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) error {
 	tables := subFlags.String("tables", "", "comma separated list of regexps for tables to gather schema information for")
 	excludeTables := subFlags.String("exclude_tables", "", "comma separated list of regexps for tables to exclude")
@@ -1794,7 +2172,7 @@ func commandValidateVersionShard(ctx context.Context, wr *wrangler.Wrangler, sub
 	if err != nil {
 		return err
 	}
-	return wr.ValidateVersionShard(ctx, keyspace, shard)
+	return printValidation(wr, wr.ValidateVersionShard(ctx, keyspace, shard))
 }
 
 func commandValidateVersionKeyspace(ctx context.Context, wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) error {
@@ -1806,7 +2184,7 @@ func commandValidateVersionKeyspace(ctx context.Context, wr *wrangler.Wrangler,
 	}
 
 	keyspace := subFlags.Arg(0)
-	return wr.ValidateVersionKeyspace(ctx, keyspace)
+	return printValidation(wr, wr.ValidateVersionKeyspace(ctx, keyspace))
 }
 
 func commandGetPermissions(ctx context.Context, wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) error {
@@ -1827,6 +2205,24 @@ func commandGetPermissions(ctx context.Context, wr *wrangler.Wrangler, subFlags
 	return err
 }
 
+func commandReloadUsers(ctx context.Context, wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) error {
+	if err := subFlags.Parse(args); err != nil {
+		return err
+	}
+	if subFlags.NArg() != 1 {
+		return fmt.Errorf("action ReloadUsers requires <tablet alias>")
+	}
+	tabletAlias, err := topo.ParseTabletAliasString(subFlags.Arg(0))
+	if err != nil {
+		return err
+	}
+	changes, err := wr.ReloadUsers(ctx, tabletAlias)
+	for _, change := range changes {
+		wr.Logger().Printf("%v\n", change)
+	}
+	return err
+}
+
 func commandValidatePermissionsShard(ctx context.Context, wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) error {
 	if err := subFlags.Parse(args); err != nil {
 		return err
@@ -1839,7 +2235,7 @@ func commandValidatePermissionsShard(ctx context.Context, wr *wrangler.Wrangler,
 	if err != nil {
 		return err
 	}
-	return wr.ValidatePermissionsShard(ctx, keyspace, shard)
+	return printValidation(wr, wr.ValidatePermissionsShard(ctx, keyspace, shard))
 }
 
 func commandValidatePermissionsKeyspace(ctx context.Context, wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) error {
@@ -1851,7 +2247,7 @@ func commandValidatePermissionsKeyspace(ctx context.Context, wr *wrangler.Wrangl
 	}
 
 	keyspace := subFlags.Arg(0)
-	return wr.ValidatePermissionsKeyspace(ctx, keyspace)
+	return printValidation(wr, wr.ValidatePermissionsKeyspace(ctx, keyspace))
 }
 
 func commandGetVSchema(ctx context.Context, wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) error {
@@ -1899,6 +2295,150 @@ func commandApplyVSchema(ctx context.Context, wr *wrangler.Wrangler, subFlags *f
 	return schemafier.SaveVSchema(s)
 }
 
+func commandGetTableACL(ctx context.Context, wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) error {
+	keyspace := subFlags.String("keyspace", "", "display the config of this keyspace, which may be the global one")
+	if err := subFlags.Parse(args); err != nil {
+		return err
+	}
+	if subFlags.NArg() != 0 {
+		return fmt.Errorf("action GetTableACL only takes flags")
+	}
+	tableACL, err := wr.GetTableACL(*keyspace)
+	if err != nil {
+		return err
+	}
+	printResult(wr, tableACL, func() {
+		wr.Logger().Printf("dry run: %v\n%v\n", tableACL.DryRun, tableACL.Config)
+	})
+	return nil
+}
+
+func commandSetTableACL(ctx context.Context, wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) error {
+	keyspace := subFlags.String("keyspace", "", "save the config as the one of this keyspace, instead of the global one")
+	dryRun := subFlags.Bool("dry_run", false, "only log and count the queries the config denies")
+	concurrency := subFlags.Int("concurrency", wrangler.DefaultBulkConcurrency, "how many tablets to reload the config on at the same time")
+	if err := subFlags.Parse(args); err != nil {
+		return err
+	}
+	if subFlags.NArg() != 1 {
+		return fmt.Errorf("action SetTableACL requires <config file>")
+	}
+	config, err := ioutil.ReadFile(subFlags.Arg(0))
+	if err != nil {
+		return err
+	}
+	results, err := wr.SetTableACL(ctx, *keyspace, &topo.TableACL{Config: string(config), DryRun: *dryRun}, *concurrency)
+	printResult(wr, results, func() {
+		for _, result := range results {
+			if result.Error == "" {
+				wr.Logger().Printf("%v OK\n", result.Alias)
+			} else {
+				wr.Logger().Printf("%v ERROR %v\n", result.Alias, result.Error)
+			}
+		}
+	})
+	return err
+}
+
+// queryRulesTarget parses the -keyspace and -tablet flags of the query
+// rules commands, only one of which can be set.
+func queryRulesTarget(keyspace, tablet string) (*topo.TabletAlias, error) {
+	if (keyspace == "") == (tablet == "") {
+		return nil, fmt.Errorf("one of -keyspace and -tablet is required")
+	}
+	if tablet == "" {
+		return nil, nil
+	}
+	tabletAlias, err := topo.ParseTabletAliasString(tablet)
+	if err != nil {
+		return nil, err
+	}
+	return &tabletAlias, nil
+}
+
+func commandGetQueryRules(ctx context.Context, wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) error {
+	keyspace := subFlags.String("keyspace", "", "display the rules of this keyspace")
+	tablet := subFlags.String("tablet", "", "display the rules of this tablet")
+	if err := subFlags.Parse(args); err != nil {
+		return err
+	}
+	if subFlags.NArg() != 0 {
+		return fmt.Errorf("action GetQueryRules only takes flags")
+	}
+	tabletAlias, err := queryRulesTarget(*keyspace, *tablet)
+	if err != nil {
+		return err
+	}
+	var qrs *topo.QueryRules
+	if tabletAlias != nil {
+		qrs, err = wr.GetTabletQueryRules(*tabletAlias)
+	} else {
+		qrs, err = wr.GetKeyspaceQueryRules(*keyspace)
+	}
+	if err != nil {
+		return err
+	}
+	printResult(wr, qrs, func() {
+		names := make([]string, 0, len(qrs.Rules))
+		for name := range qrs.Rules {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		now := time.Now()
+		for _, name := range names {
+			qr := qrs.Rules[name]
+			switch {
+			case qr.Expiration == 0:
+				wr.Logger().Printf("%v\n", qr.Rule)
+			case qr.Expired(now):
+				wr.Logger().Printf("%v (expired)\n", qr.Rule)
+			default:
+				wr.Logger().Printf("%v (expires at %v)\n", qr.Rule, time.Unix(qr.Expiration, 0))
+			}
+		}
+	})
+	return nil
+}
+
+func commandSetQueryRule(ctx context.Context, wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) error {
+	keyspace := subFlags.String("keyspace", "", "add the rule to this keyspace")
+	tablet := subFlags.String("tablet", "", "add the rule to this tablet")
+	ttl := subFlags.Duration("ttl", 0, "if set, the rule expires after this duration")
+	if err := subFlags.Parse(args); err != nil {
+		return err
+	}
+	if subFlags.NArg() != 1 {
+		return fmt.Errorf("action SetQueryRule requires <rule>")
+	}
+	if *ttl < 0 {
+		return fmt.Errorf("negative -ttl %v", *ttl)
+	}
+	tabletAlias, err := queryRulesTarget(*keyspace, *tablet)
+	if err != nil {
+		return err
+	}
+	if tabletAlias != nil {
+		return wr.SetTabletQueryRule(ctx, *tabletAlias, subFlags.Arg(0), *ttl)
+	}
+	return wr.SetKeyspaceQueryRule(ctx, *keyspace, subFlags.Arg(0), *ttl)
+}
+
+func commandClearQueryRules(ctx context.Context, wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) error {
+	keyspace := subFlags.String("keyspace", "", "remove the rules of this keyspace")
+	tablet := subFlags.String("tablet", "", "remove the rules of this tablet")
+	if err := subFlags.Parse(args); err != nil {
+		return err
+	}
+	tabletAlias, err := queryRulesTarget(*keyspace, *tablet)
+	if err != nil {
+		return err
+	}
+	if tabletAlias != nil {
+		return wr.ClearTabletQueryRules(ctx, *tabletAlias, subFlags.Args())
+	}
+	return wr.ClearKeyspaceQueryRules(ctx, *keyspace, subFlags.Args())
+}
+
 func commandGetSrvKeyspace(ctx context.Context, wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) error {
 	if err := subFlags.Parse(args); err != nil {
 		return err
@@ -1999,9 +2539,15 @@ func commandHelp(ctx context.Context, wr *wrangler.Wrangler, subFlags *flag.Flag
 		wr.Logger().Printf("Available commands:\n\n")
 		PrintAllCommands(wr.Logger())
 	case 1:
+		for _, group := range commands {
+			if strings.ToLower(group.name) == strings.ToLower(subFlags.Arg(0)) {
+				printCommandGroup(wr.Logger(), group)
+				return nil
+			}
+		}
 		RunCommand(ctx, wr, []string{subFlags.Arg(0), "--help"})
 	default:
-		return fmt.Errorf("action Help takes no parameter, or just the name of the command to get help on")
+		return fmt.Errorf("action Help takes no parameter, or just the name of the command or group to get help on")
 	}
 
 	return nil
@@ -2070,39 +2616,62 @@ func RunCommand(ctx context.Context, wr *wrangler.Wrangler, args []string) error
 		return fmt.Errorf("No command specified")
 	}
 
+	if err := checkOutputFormat(); err != nil {
+		return err
+	}
+
 	action := args[0]
-	actionLowerCase := strings.ToLower(action)
-	for _, group := range commands {
-		for _, cmd := range group.commands {
-			if strings.ToLower(cmd.name) == actionLowerCase {
-				subFlags := flag.NewFlagSet(action, flag.ContinueOnError)
-				subFlags.SetOutput(logutil.NewLoggerWriter(wr.Logger()))
-				subFlags.Usage = func() {
-					wr.Logger().Printf("Usage: %s %s\n\n", action, cmd.params)
-					wr.Logger().Printf("%s\n\n", cmd.help)
-					subFlags.PrintDefaults()
-				}
-				return cmd.method(ctx, wr, subFlags, args[1:])
-			}
+	cmd, alias := findCommand(action)
+	if cmd == nil {
+		wr.Logger().Printf("Unknown command: %v\n", action)
+		return ErrUnknownCommand
+	}
+	if alias != nil && alias.deprecated {
+		wr.Logger().Warningf("%v is deprecated, use %v instead", action, cmd.name)
+		deprecatedCommandCounts.Add(alias.alias, 1)
+	}
+
+	subFlags := flag.NewFlagSet(action, flag.ContinueOnError)
+	subFlags.SetOutput(logutil.NewLoggerWriter(wr.Logger()))
+	subFlags.Usage = func() {
+		params := cmd.params
+		if synopsis := flagSynopsis(subFlags, params); synopsis != "" {
+			params = strings.TrimSpace(synopsis + " " + params)
+		}
+		wr.Logger().Printf("Usage: %s %s\n\n", cmd.name, params)
+		wr.Logger().Printf("%s\n\n", cmd.help)
+		if aliases := commandAliasNames(cmd.name, false); len(aliases) > 0 {
+			wr.Logger().Printf("Aliases: %s\n\n", strings.Join(aliases, ", "))
+		}
+		if alias != nil && alias.deprecated {
+			wr.Logger().Printf("%s is deprecated, use %s instead.\n\n", action, cmd.name)
 		}
+		subFlags.PrintDefaults()
 	}
-
-	wr.Logger().Printf("Unknown command: %v\n", action)
-	return ErrUnknownCommand
+	return cmd.method(ctx, wr, subFlags, args[1:])
 }
 
 // PrintAllCommands will print the list of commands to the logger
 func PrintAllCommands(logger logutil.Logger) {
 	for _, group := range commands {
-		logger.Printf("%s:\n", group.name)
-		for _, cmd := range group.commands {
-			if strings.HasPrefix(cmd.help, "HIDDEN") {
-				continue
-			}
-			logger.Printf("  %s %s\n", cmd.name, cmd.params)
+		printCommandGroup(logger, group)
+	}
+}
+
+// printCommandGroup prints the commands of group, with their
+// aliases. The deprecated aliases are not listed.
+func printCommandGroup(logger logutil.Logger, group commandGroup) {
+	logger.Printf("%s:\n", group.name)
+	for _, cmd := range group.commands {
+		if strings.HasPrefix(cmd.help, "HIDDEN") {
+			continue
+		}
+		logger.Printf("  %s %s\n", cmd.name, cmd.params)
+		if aliases := commandAliasNames(cmd.name, false); len(aliases) > 0 {
+			logger.Printf("    (aliases: %s)\n", strings.Join(aliases, ", "))
 		}
-		logger.Printf("\n")
 	}
+	logger.Printf("\n")
 }
 
 // HandlePanic should be called using 'defer' in the RPC code that executes
@@ -0,0 +1,113 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vtctl
+
+import (
+	"flag"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/youtube/vitess/go/vt/logutil"
+	"github.com/youtube/vitess/go/vt/wrangler"
+	"golang.org/x/net/context"
+)
+
+func TestFindCommand(t *testing.T) {
+	testcases := []struct {
+		name       string
+		command    string
+		deprecated bool
+		isAlias    bool
+	}{
+		{name: "Validate", command: "Validate"},
+		{name: "validate", command: "Validate"},
+		{name: "ValidateAll", command: "Validate", isAlias: true},
+		{name: "validateall", command: "Validate", isAlias: true},
+		{name: "ExecuteFetch", command: "ExecuteFetchAsDba", isAlias: true, deprecated: true},
+	}
+	for _, tc := range testcases {
+		cmd, alias := findCommand(tc.name)
+		if cmd == nil || cmd.name != tc.command {
+			t.Errorf("findCommand(%v) = %v, want the command %v", tc.name, cmd, tc.command)
+			continue
+		}
+		if (alias != nil) != tc.isAlias {
+			t.Errorf("findCommand(%v) returned the alias %v, want an alias: %v", tc.name, alias, tc.isAlias)
+			continue
+		}
+		if alias != nil && alias.deprecated != tc.deprecated {
+			t.Errorf("findCommand(%v) deprecated = %v, want %v", tc.name, alias.deprecated, tc.deprecated)
+		}
+	}
+	if cmd, alias := findCommand("NoSuchCommand"); cmd != nil || alias != nil {
+		t.Errorf("findCommand(NoSuchCommand) = %v, %v, want nil", cmd, alias)
+	}
+
+	if got := commandAliasNames("Validate", false); len(got) != 1 || got[0] != "ValidateAll" {
+		t.Errorf("commandAliasNames(Validate) = %v", got)
+	}
+	if got := commandAliasNames("ExecuteFetchAsDba", false); len(got) != 0 {
+		t.Errorf("commandAliasNames(ExecuteFetchAsDba) lists deprecated aliases: %v", got)
+	}
+}
+
+func TestDeprecatedCommand(t *testing.T) {
+	logger := logutil.NewMemoryLogger()
+	wr := wrangler.New(logger, nil, nil, time.Second)
+	before := deprecatedCommandCounts.Counts()["ExecuteFetch"]
+
+	// the flags are parsed first, the command doesn't need a tablet
+	if err := RunCommand(context.Background(), wr, []string{"ExecuteFetch", "--help"}); err != flag.ErrHelp {
+		t.Fatalf("RunCommand(ExecuteFetch --help) returned %v", err)
+	}
+	if got := deprecatedCommandCounts.Counts()["ExecuteFetch"] - before; got != 1 {
+		t.Errorf("ExecuteFetch was counted %v times, want 1", got)
+	}
+	out := logger.String()
+	for _, want := range []string{
+		"ExecuteFetch is deprecated, use ExecuteFetchAsDba instead",
+		"Usage: ExecuteFetchAsDba ",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output doesn't contain %q: %v", want, out)
+		}
+	}
+
+	// the other names are not counted
+	before = deprecatedCommandCounts.Counts()["ValidateAll"]
+	if err := RunCommand(context.Background(), wr, []string{"ValidateAll", "--help"}); err != flag.ErrHelp {
+		t.Fatalf("RunCommand(ValidateAll --help) returned %v", err)
+	}
+	if got := deprecatedCommandCounts.Counts()["ValidateAll"] - before; got != 0 {
+		t.Errorf("ValidateAll was counted %v times, want 0", got)
+	}
+}
+
+func TestFlagSynopsis(t *testing.T) {
+	subFlags := flag.NewFlagSet("test", flag.ContinueOnError)
+	subFlags.Bool("ping", false, "")
+	subFlags.Bool("ping-tablets", false, "")
+	subFlags.Int("max_rows", 10000, "")
+	subFlags.String("max", "", "")
+	subFlags.Bool("force", false, "")
+
+	testcases := []struct {
+		params string
+		want   string
+	}{
+		{"", "[-force] [-max=<max>] [-max_rows=<max_rows>] [-ping] [-ping-tablets]"},
+		// only the flags written with their exact name are left out
+		{"[-ping-tablets] [--max_rows=10] <keyspace>", "[-force] [-max=<max>] [-ping]"},
+		{"[-force] [-max=1] [-ping] [-ping-tablets] [-max_rows=10]", ""},
+		// arguments are not flags
+		{"<keyspace/shard> <max>", "[-force] [-max=<max>] [-max_rows=<max_rows>] [-ping] [-ping-tablets]"},
+	}
+	for _, tc := range testcases {
+		if got := flagSynopsis(subFlags, tc.params); got != tc.want {
+			t.Errorf("flagSynopsis(%q) = %q, want %q", tc.params, got, tc.want)
+		}
+	}
+}
@@ -25,6 +25,15 @@ type VtctlClient interface {
 	// ExecuteVtctlCommand will execute the command remotely
 	ExecuteVtctlCommand(ctx context.Context, args []string, actionTimeout, lockTimeout time.Duration) (<-chan *logutil.LoggerEvent, ErrFunc)
 
+	// SubmitVtctlCommand will start the command remotely, and
+	// return the id of its job right away. The command keeps
+	// running when the client goes away.
+	SubmitVtctlCommand(ctx context.Context, args []string, actionTimeout, lockTimeout time.Duration) (int64, error)
+
+	// WaitForJob will stream the logs of a job, from its start,
+	// until it is done. The ErrFunc returns the error of the job.
+	WaitForJob(ctx context.Context, jobID int64) (<-chan *logutil.LoggerEvent, ErrFunc)
+
 	// Close will terminate the connection. This object won't be
 	// used after this.
 	Close()
@@ -95,4 +95,47 @@ func TestSuite(t *testing.T, ts topo.Server, client vtctlclient.VtctlClient) {
 	if err := errFunc(); err == nil || !strings.Contains(err.Error(), expected1) || !strings.Contains(err.Error(), expected2) {
 		t.Fatalf("Unexpected remote error, got: '%v' was expecting to find '%v' and '%v'", err, expected1, expected2)
 	}
+
+	// submit a command as a job, and follow it
+	jobID, err := client.SubmitVtctlCommand(ctx, []string{"ListAllTablets", "cell1"}, 30*time.Second, 10*time.Second)
+	if err != nil {
+		t.Fatalf("Cannot submit remote command: %v", err)
+	}
+	logs, errFunc = client.WaitForJob(ctx, jobID)
+	count = 0
+	for e := range logs {
+		expected := "cell1-0000000001 test_keyspace <null> master localhost:3333 localhost:3334 [tag: \"value\"]\n"
+		if e.String() != expected {
+			t.Errorf("Got unexpected log line '%v' expected '%v'", e.String(), expected)
+		}
+		count++
+	}
+	if count != 1 {
+		t.Errorf("Didn't get expected log line only, got %v lines", count)
+	}
+	if err := errFunc(); err != nil {
+		t.Fatalf("Remote job error: %v", err)
+	}
+
+	// submit a job that's gonna fail
+	jobID, err = client.SubmitVtctlCommand(ctx, []string{"ListAllTablets", "cell2"}, 30*time.Second, 10*time.Second)
+	if err != nil {
+		t.Fatalf("Cannot submit remote command: %v", err)
+	}
+	logs, errFunc = client.WaitForJob(ctx, jobID)
+	for e := range logs {
+		t.Errorf("Got unexpected line for logs: %v", e.String())
+	}
+	if err := errFunc(); err == nil || !strings.Contains(err.Error(), expected) {
+		t.Fatalf("Unexpected remote job error, got: '%v' was expecting to find '%v'", err, expected)
+	}
+
+	// wait for a job that doesn't exist
+	logs, errFunc = client.WaitForJob(ctx, jobID+1000)
+	for e := range logs {
+		t.Errorf("Got unexpected line for logs: %v", e.String())
+	}
+	if err := errFunc(); err == nil || !strings.Contains(err.Error(), "unknown job") {
+		t.Fatalf("Unexpected error for an unknown job, got: '%v'", err)
+	}
 }
@@ -0,0 +1,173 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vtctl
+
+import (
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/youtube/vitess/go/vt/logutil"
+	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/vt/worker/vtworkerclient"
+	"github.com/youtube/vitess/go/vt/wrangler"
+	"golang.org/x/net/context"
+)
+
+// This file contains the commands related to vtworker: running a
+// vtworker command on a vtworker in interactive mode, cancelling it,
+// and taking back the tablets of the vtworkers that died without
+// cleaning up.
+
+func init() {
+	addCommand("Generic", command{
+		"VtWorker",
+		commandVtWorker,
+		"-server <vtworker host:port> [-connect_timeout <duration>] <vtworker command> [<vtworker command args>]",
+		"Runs the vtworker command on the vtworker, and prints its logs until it is done. vtworker runs one command at a time, see its status page for the current one."})
+	addCommand("Generic", command{
+		"WorkerCancel",
+		commandWorkerCancel,
+		"-server <vtworker host:port> [-connect_timeout <duration>]",
+		"Cancels the command the vtworker runs: it stops at its next chunk boundary and cleans up. Prints the final status of the command once it is done."})
+	addCommand("Shards", command{
+		"ListWorkerTablets",
+		commandListWorkerTablets,
+		"<keyspace/shard>",
+		"Lists the worker tablets of the shard, with the vtworker that holds them, and whether it is alive, dead, or not set (the tablet was left by a SplitClone to resume from)."})
+	addCommand("Shards", command{
+		"ReleaseWorkerTablets",
+		commandReleaseWorkerTablets,
+		"[-include_unowned] <keyspace/shard>",
+		"Changes the worker tablets of the shard held by dead vtworkers back to rdonly, after restarting their replication. With -include_unowned, the ones left by a SplitClone to resume from are released too, and can't be resumed from anymore."})
+}
+
+func commandVtWorker(ctx context.Context, wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) error {
+	server := subFlags.String("server", "", "vtworker to run the command on")
+	connectTimeout := subFlags.Duration("connect_timeout", 30*time.Second, "time to wait to connect to vtworker")
+	if err := subFlags.Parse(args); err != nil {
+		return err
+	}
+	if *server == "" || subFlags.NArg() == 0 {
+		return fmt.Errorf("action VtWorker requires -server <vtworker host:port> <vtworker command>")
+	}
+
+	client, err := vtworkerclient.New(*server, *connectTimeout)
+	if err != nil {
+		return fmt.Errorf("cannot dial to vtworker %v: %v", *server, err)
+	}
+	defer client.Close()
+
+	logs, errFunc := client.ExecuteVtworkerCommand(ctx, subFlags.Args())
+	if err := errFunc(); err != nil {
+		return fmt.Errorf("cannot run the command on vtworker %v: %v", *server, err)
+	}
+	logger := wr.Logger()
+	for e := range logs {
+		switch e.Level {
+		case logutil.LOGGER_INFO:
+			logger.Infof("%v", e.Value)
+		case logutil.LOGGER_WARNING:
+			logger.Warningf("%v", e.Value)
+		case logutil.LOGGER_ERROR:
+			logger.Errorf("%v", e.Value)
+		case logutil.LOGGER_CONSOLE:
+			logger.Printf("%v", e.Value)
+		}
+	}
+	if err := errFunc(); err != nil {
+		return fmt.Errorf("vtworker command failed: %v", err)
+	}
+	return nil
+}
+
+func commandWorkerCancel(ctx context.Context, wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) error {
+	server := subFlags.String("server", "", "vtworker to cancel the command of")
+	connectTimeout := subFlags.Duration("connect_timeout", 30*time.Second, "time to wait to connect to vtworker")
+	if err := subFlags.Parse(args); err != nil {
+		return err
+	}
+	if *server == "" || subFlags.NArg() != 0 {
+		return fmt.Errorf("action WorkerCancel requires -server <vtworker host:port>")
+	}
+
+	client, err := vtworkerclient.New(*server, *connectTimeout)
+	if err != nil {
+		return fmt.Errorf("cannot dial to vtworker %v: %v", *server, err)
+	}
+	defer client.Close()
+
+	status, err := client.CancelVtworkerCommand(ctx)
+	if err != nil {
+		return fmt.Errorf("cannot cancel the command of vtworker %v: %v", *server, err)
+	}
+	wr.Logger().Printf("%v\n", status)
+	return nil
+}
+
+func commandListWorkerTablets(ctx context.Context, wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) error {
+	if err := subFlags.Parse(args); err != nil {
+		return err
+	}
+	if subFlags.NArg() != 1 {
+		return fmt.Errorf("action ListWorkerTablets requires <keyspace/shard>")
+	}
+	keyspace, shard, err := topo.ParseKeyspaceShardString(subFlags.Arg(0))
+	if err != nil {
+		return err
+	}
+	workerTablets, err := wr.FindWorkerTablets(ctx, keyspace, shard)
+	if err != nil {
+		return err
+	}
+	for _, wt := range workerTablets {
+		wr.Logger().Printf("%v %v %v %v\n", wt.Alias, wt.State, valueOrNull(wt.URL), valueOrNull(wt.WorkerID))
+	}
+	return nil
+}
+
+func commandReleaseWorkerTablets(ctx context.Context, wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) error {
+	includeUnowned := subFlags.Bool("include_unowned", false, "also release the tablets no vtworker holds, that a SplitClone left to resume from")
+	if err := subFlags.Parse(args); err != nil {
+		return err
+	}
+	if subFlags.NArg() != 1 {
+		return fmt.Errorf("action ReleaseWorkerTablets requires <keyspace/shard>")
+	}
+	keyspace, shard, err := topo.ParseKeyspaceShardString(subFlags.Arg(0))
+	if err != nil {
+		return err
+	}
+	workerTablets, err := wr.FindWorkerTablets(ctx, keyspace, shard)
+	if err != nil {
+		return err
+	}
+	var failed int
+	for _, wt := range workerTablets {
+		if wt.State != wrangler.WorkerTabletDead && (wt.State != wrangler.WorkerTabletUnowned || !*includeUnowned) {
+			wr.Logger().Printf("%v %v, kept\n", wt.Alias, wt.State)
+			continue
+		}
+		if err := wr.ReleaseWorkerTablet(ctx, wt.Alias); err != nil {
+			wr.Logger().Printf("%v ERROR %v\n", wt.Alias, err)
+			failed++
+			continue
+		}
+		wr.Logger().Printf("%v %v, released\n", wt.Alias, wt.State)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%v worker tablets could not be released", failed)
+	}
+	return nil
+}
+
+// valueOrNull returns <null> for an empty value, as the tablet
+// listings do.
+func valueOrNull(value string) string {
+	if value == "" {
+		return "<null>"
+	}
+	return value
+}
@@ -0,0 +1,207 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package vterrors defines the error codes that vttablet, vtgate and
+// the tablet manager send with their errors, so the callers can decide
+// what to do with an error without parsing its message.
+//
+// The codes travel with the message: in the header of the bsonrpc
+// responses, and in the ErrorCode fields of the vtgate replies. The
+// servers that predate them send no code, which reads as Unknown.
+package vterrors
+
+import (
+	"fmt"
+)
+
+// ErrorCode is the code of an error.
+type ErrorCode int64
+
+const (
+	// Unknown is the code of the errors that have none, e.g. the
+	// errors of the servers that don't send codes.
+	Unknown ErrorCode = iota
+
+	// BadInput means the request is invalid, e.g. a syntax error in
+	// a query. Sending it again will fail the same way.
+	BadInput
+
+	// DeadlineExceeded means the request did not complete before its
+	// deadline. It may or may not have been applied.
+	DeadlineExceeded
+
+	// IntegrityError means the request would break a constraint of
+	// the data, e.g. a duplicate key.
+	IntegrityError
+
+	// Transient means the request could not be served right now, e.g.
+	// because the tablet is going away or a pool is full. It can be
+	// retried, outside of a transaction.
+	Transient
+
+	// Unauthenticated means the caller is not allowed to do the
+	// request.
+	Unauthenticated
+
+	// Internal means the server failed, e.g. it panicked.
+	Internal
+
+	// ResourceExhausted means the request was rejected because a limit
+	// was reached, e.g. a rate limit of vtgate or a full transaction
+	// pool. It can be retried after a backoff, outside of a transaction.
+	ResourceExhausted
+
+	// QueryNotServed means the tablet did not execute the request,
+	// e.g. because it is not serving during a reparent. It can be sent
+	// to another tablet, outside of a transaction.
+	QueryNotServed
+
+	// Unavailable means the tablet failed the request because it is
+	// broken or going away, e.g. it lost its MySQL connection. The
+	// request may have been partly executed. It can be sent to another
+	// tablet, outside of a transaction.
+	Unavailable
+
+	// NotInTx means the transaction of the request is not open
+	// anymore, e.g. it timed out. The whole transaction has to be
+	// started again.
+	NotInTx
+)
+
+var errorCodeNames = map[ErrorCode]string{
+	Unknown:           "UNKNOWN",
+	BadInput:          "BAD_INPUT",
+	DeadlineExceeded:  "DEADLINE_EXCEEDED",
+	IntegrityError:    "INTEGRITY_ERROR",
+	Transient:         "TRANSIENT",
+	Unauthenticated:   "UNAUTHENTICATED",
+	Internal:          "INTERNAL",
+	ResourceExhausted: "RESOURCE_EXHAUSTED",
+	QueryNotServed:    "QUERY_NOT_SERVED",
+	Unavailable:       "UNAVAILABLE",
+	NotInTx:           "NOT_IN_TX",
+}
+
+func (code ErrorCode) String() string {
+	if name, ok := errorCodeNames[code]; ok {
+		return name
+	}
+	return fmt.Sprintf("ErrorCode(%d)", int64(code))
+}
+
+// codedError is implemented by the errors that have a code: the
+// VitessErrors, and the errors of the RPC clients that received one.
+// The code is an int64 so the RPC layers don't depend on this package.
+type codedError interface {
+	ErrorCode() int64
+}
+
+// VitessError is an error with a code.
+type VitessError struct {
+	Code    ErrorCode
+	Message string
+}
+
+func (e *VitessError) Error() string {
+	return e.Message
+}
+
+// ErrorCode returns the code of the error.
+func (e *VitessError) ErrorCode() int64 {
+	return int64(e.Code)
+}
+
+// Errorf returns a VitessError with code and the formatted message.
+func Errorf(code ErrorCode, format string, args ...interface{}) error {
+	return &VitessError{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// FromError returns a VitessError with code and the message of err,
+// or nil if err is nil.
+func FromError(code ErrorCode, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &VitessError{Code: code, Message: err.Error()}
+}
+
+// RecoverCode returns the code of err, or Unknown if it has none.
+func RecoverCode(err error) ErrorCode {
+	if ce, ok := err.(codedError); ok {
+		return ErrorCode(ce.ErrorCode())
+	}
+	return Unknown
+}
+
+// WithPrefix returns err with prefix before its message. It keeps the
+// code of err, so errors can be given more context on their way up.
+func WithPrefix(prefix string, err error) error {
+	if err == nil {
+		return nil
+	}
+	code := RecoverCode(err)
+	if code == Unknown {
+		return fmt.Errorf("%v%v", prefix, err)
+	}
+	return &VitessError{Code: code, Message: prefix + err.Error()}
+}
+
+// WithSuffix returns err with suffix after its message, and the code
+// of err.
+func WithSuffix(err error, suffix string) error {
+	if err == nil {
+		return nil
+	}
+	code := RecoverCode(err)
+	if code == Unknown {
+		return fmt.Errorf("%v%v", err, suffix)
+	}
+	return &VitessError{Code: code, Message: err.Error() + suffix}
+}
+
+// codePriority orders the codes for AggregateCodes: an error that
+// says the request itself is wrong wins, since retrying the request
+// would not help.
+var codePriority = []ErrorCode{
+	Unauthenticated,
+	BadInput,
+	IntegrityError,
+	Internal,
+	NotInTx,
+	DeadlineExceeded,
+	Unavailable,
+	ResourceExhausted,
+	QueryNotServed,
+	Transient,
+	Unknown,
+}
+
+// AggregateCodes returns the code of a group of errors, e.g. the
+// errors of the shards of a query: the code of highest priority among
+// them. It returns Unknown if there are no errors, or none of them has
+// a code this package knows.
+func AggregateCodes(errs []error) ErrorCode {
+	found := make(map[ErrorCode]bool)
+	for _, err := range errs {
+		if err != nil {
+			found[RecoverCode(err)] = true
+		}
+	}
+	for _, code := range codePriority {
+		if found[code] {
+			return code
+		}
+	}
+	return Unknown
+}
+
+// IsRetryable returns true if err can be retried, outside of a
+// transaction.
+func IsRetryable(err error) bool {
+	switch RecoverCode(err) {
+	case Transient, ResourceExhausted, QueryNotServed, Unavailable:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,70 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vterrors
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRecoverCode(t *testing.T) {
+	testcases := []struct {
+		err  error
+		want ErrorCode
+	}{
+		{nil, Unknown},
+		{errors.New("plain"), Unknown},
+		{Errorf(BadInput, "bad %v", "query"), BadInput},
+		{FromError(IntegrityError, errors.New("dup")), IntegrityError},
+		{WithPrefix("shard 0: ", Errorf(Transient, "retry")), Transient},
+		{WithSuffix(Errorf(DeadlineExceeded, "timeout"), ", vtgate: url"), DeadlineExceeded},
+	}
+	for _, tcase := range testcases {
+		if got := RecoverCode(tcase.err); got != tcase.want {
+			t.Errorf("RecoverCode(%v) = %v, want %v", tcase.err, got, tcase.want)
+		}
+	}
+
+	if err := FromError(Internal, nil); err != nil {
+		t.Errorf("FromError(nil) = %v, want nil", err)
+	}
+	if err := WithPrefix("shard 0: ", Errorf(Transient, "retry")); err.Error() != "shard 0: retry" {
+		t.Errorf("WithPrefix: got %q", err)
+	}
+	if err := WithSuffix(errors.New("plain"), ", vtgate: url"); err.Error() != "plain, vtgate: url" || RecoverCode(err) != Unknown {
+		t.Errorf("WithSuffix of an error without code: got %q with %v", err, RecoverCode(err))
+	}
+}
+
+func TestAggregateCodes(t *testing.T) {
+	testcases := []struct {
+		errs []error
+		want ErrorCode
+	}{
+		{nil, Unknown},
+		{[]error{nil, Errorf(Transient, "retry")}, Transient},
+		{[]error{Errorf(Transient, "retry"), Errorf(Transient, "tx_pool_full")}, Transient},
+		{[]error{Errorf(Transient, "retry"), Errorf(IntegrityError, "dup")}, IntegrityError},
+		{[]error{Errorf(IntegrityError, "dup"), Errorf(BadInput, "syntax")}, BadInput},
+		{[]error{errors.New("plain"), Errorf(Transient, "retry")}, Transient},
+		{[]error{Errorf(Transient, "retry"), Errorf(ResourceExhausted, "throttled")}, ResourceExhausted},
+		{[]error{Errorf(QueryNotServed, "retry"), Errorf(NotInTx, "not_in_tx")}, NotInTx},
+		{[]error{Errorf(QueryNotServed, "retry"), Errorf(Unavailable, "fatal")}, Unavailable},
+	}
+	for _, tcase := range testcases {
+		if got := AggregateCodes(tcase.errs); got != tcase.want {
+			t.Errorf("AggregateCodes(%v) = %v, want %v", tcase.errs, got, tcase.want)
+		}
+	}
+}
+
+func TestErrorCodeString(t *testing.T) {
+	if got := BadInput.String(); got != "BAD_INPUT" {
+		t.Errorf("BadInput.String() = %v", got)
+	}
+	if got := ErrorCode(42).String(); got != "ErrorCode(42)" {
+		t.Errorf("ErrorCode(42).String() = %v", got)
+	}
+}
@@ -0,0 +1,133 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vtgate
+
+// This is a V3 file. Do not intermix with V2.
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	mproto "github.com/youtube/vitess/go/mysql/proto"
+	"github.com/youtube/vitess/go/sqltypes"
+)
+
+// This file contains the combination of the per-shard rows of
+// multi-shard aggregate queries.
+
+// aggregateResult replaces the rows of qr, one per shard, with a
+// single row that combines them. aggregates is the aggregate function
+// of each column, as found by the planner.
+func aggregateResult(qr *mproto.QueryResult, aggregates []string) error {
+	if len(qr.Rows) == 0 {
+		return nil
+	}
+	if len(qr.Fields) != len(aggregates) {
+		return fmt.Errorf("aggregate query returned %d columns, want %d", len(qr.Fields), len(aggregates))
+	}
+	result := make([]sqltypes.Value, len(aggregates))
+	copy(result, qr.Rows[0])
+	for _, row := range qr.Rows[1:] {
+		for i, aggregate := range aggregates {
+			var err error
+			result[i], err = combineValues(aggregate, qr.Fields[i], result[i], row[i])
+			if err != nil {
+				return fmt.Errorf("cannot combine %s of column %v: %v", aggregate, qr.Fields[i].Name, err)
+			}
+		}
+	}
+	qr.Rows = [][]sqltypes.Value{result}
+	qr.RowsAffected = 1
+	return nil
+}
+
+// combineValues combines two partial results of an aggregate
+// function. NULL values are ignored, the way MySQL ignores them.
+func combineValues(aggregate string, field mproto.Field, a, b sqltypes.Value) (sqltypes.Value, error) {
+	if a.IsNull() {
+		return b, nil
+	}
+	if b.IsNull() {
+		return a, nil
+	}
+	switch aggregate {
+	case "count", "sum":
+		return addValues(field, a, b)
+	case "min", "max":
+		// the shards compared their values with the collation of
+		// the column, which vtgate only knows for binary strings
+		if err := checkComparable(field); err != nil {
+			return sqltypes.Value{}, err
+		}
+		c, err := compareValues(field, a, b)
+		if err != nil {
+			return sqltypes.Value{}, err
+		}
+		if (aggregate == "min") == (c <= 0) {
+			return a, nil
+		}
+		return b, nil
+	}
+	return sqltypes.Value{}, fmt.Errorf("unsupported aggregate %s", aggregate)
+}
+
+// addValues adds two numbers. Floating point columns are added as
+// floats. Other values are added as int64 or uint64 if they fit, and
+// as exact decimals otherwise, so a shard that returns a decimal and
+// one that returns an integer still add up.
+func addValues(field mproto.Field, a, b sqltypes.Value) (sqltypes.Value, error) {
+	as, bs := a.String(), b.String()
+	switch field.Type {
+	case mproto.VT_FLOAT, mproto.VT_DOUBLE:
+		av, err := strconv.ParseFloat(as, 64)
+		if err != nil {
+			return sqltypes.Value{}, err
+		}
+		bv, err := strconv.ParseFloat(bs, 64)
+		if err != nil {
+			return sqltypes.Value{}, err
+		}
+		return sqltypes.MakeNumeric([]byte(strconv.FormatFloat(av+bv, 'g', -1, 64))), nil
+	}
+
+	if av, err := strconv.ParseInt(as, 10, 64); err == nil {
+		if bv, err := strconv.ParseInt(bs, 10, 64); err == nil {
+			if sum := av + bv; (sum > av) == (bv > 0) {
+				return sqltypes.MakeNumeric([]byte(strconv.FormatInt(sum, 10))), nil
+			}
+		}
+	}
+	if av, err := strconv.ParseUint(as, 10, 64); err == nil {
+		if bv, err := strconv.ParseUint(bs, 10, 64); err == nil {
+			if sum := av + bv; sum >= av {
+				return sqltypes.MakeNumeric([]byte(strconv.FormatUint(sum, 10))), nil
+			}
+		}
+	}
+	av, ok := new(big.Rat).SetString(as)
+	if !ok {
+		return sqltypes.Value{}, fmt.Errorf("%v is not a number", as)
+	}
+	bv, ok := new(big.Rat).SetString(bs)
+	if !ok {
+		return sqltypes.Value{}, fmt.Errorf("%v is not a number", bs)
+	}
+	scale := decimalScale(as)
+	if s := decimalScale(bs); s > scale {
+		scale = s
+	}
+	return sqltypes.MakeNumeric([]byte(av.Add(av, bv).FloatString(scale))), nil
+}
+
+// decimalScale returns the number of digits after the decimal point.
+func decimalScale(value string) int {
+	i := strings.IndexByte(value, '.')
+	if i == -1 {
+		return 0
+	}
+	return len(value) - i - 1
+}
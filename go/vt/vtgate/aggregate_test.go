@@ -0,0 +1,94 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vtgate
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	mproto "github.com/youtube/vitess/go/mysql/proto"
+	"github.com/youtube/vitess/go/sqltypes"
+)
+
+func numeric(v string) sqltypes.Value {
+	return sqltypes.MakeNumeric([]byte(v))
+}
+
+func TestCombineValues(t *testing.T) {
+	long := mproto.Field{Name: "l", Type: mproto.VT_LONGLONG}
+	unsigned := mproto.Field{Name: "u", Type: mproto.VT_LONGLONG, Flags: mproto.VT_UNSIGNED_FLAG}
+	decimal := mproto.Field{Name: "d", Type: mproto.VT_NEWDECIMAL}
+	double := mproto.Field{Name: "f", Type: mproto.VT_DOUBLE}
+	null := sqltypes.Value{}
+	for _, tcase := range []struct {
+		aggregate string
+		field     mproto.Field
+		a, b      sqltypes.Value
+		want      sqltypes.Value
+	}{
+		{"count", long, numeric("2"), numeric("3"), numeric("5")},
+		{"sum", long, numeric("-2"), numeric("3"), numeric("1")},
+		{"sum", long, null, numeric("3"), numeric("3")},
+		{"sum", long, numeric("3"), null, numeric("3")},
+		{"sum", long, null, null, null},
+		{"sum", unsigned, numeric("9223372036854775807"), numeric("1"), numeric("9223372036854775808")},
+		{"sum", unsigned, numeric("18446744073709551615"), numeric("1"), numeric("18446744073709551616")},
+		{"sum", decimal, numeric("1.25"), numeric("2.5"), numeric("3.75")},
+		{"sum", decimal, numeric("1.25"), numeric("3"), numeric("4.25")},
+		{"sum", double, numeric("0.5"), numeric("1e3"), numeric("1000.5")},
+		{"min", long, numeric("9"), numeric("10"), numeric("9")},
+		{"min", long, null, numeric("10"), numeric("10")},
+		{"max", long, numeric("9"), numeric("10"), numeric("10")},
+		{"max", decimal, numeric("9.5"), null, numeric("9.5")},
+	} {
+		got, err := combineValues(tcase.aggregate, tcase.field, tcase.a, tcase.b)
+		if err != nil {
+			t.Errorf("combineValues(%v, %v, %v) failed: %v", tcase.aggregate, tcase.a, tcase.b, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tcase.want) {
+			t.Errorf("combineValues(%v, %v, %v) = %v, want %v", tcase.aggregate, tcase.a, tcase.b, got, tcase.want)
+		}
+	}
+	if _, err := combineValues("sum", decimal, numeric("1"), numeric("x")); err == nil {
+		t.Errorf("sum of a bad number should fail")
+	}
+	text := mproto.Field{Name: "s", Type: mproto.VT_VAR_STRING}
+	if _, err := combineValues("max", text, sqltypes.MakeString([]byte("a")), sqltypes.MakeString([]byte("B"))); err == nil || !strings.Contains(err.Error(), "is a text column") {
+		t.Errorf("max of a non binary text column: %v", err)
+	}
+}
+
+func TestAggregateResult(t *testing.T) {
+	qr := &mproto.QueryResult{
+		Fields: []mproto.Field{
+			{Name: "count(*)", Type: mproto.VT_LONGLONG},
+			{Name: "sum(a)", Type: mproto.VT_NEWDECIMAL},
+			{Name: "min(b)", Type: mproto.VT_VAR_STRING, Flags: mproto.VT_BINARY_FLAG},
+		},
+		Rows: [][]sqltypes.Value{
+			{numeric("2"), numeric("10"), sqltypes.MakeString([]byte("b"))},
+			{numeric("0"), {}, {}},
+			{numeric("1"), numeric("5"), sqltypes.MakeString([]byte("a"))},
+		},
+		RowsAffected: 3,
+	}
+	if err := aggregateResult(qr, []string{"count", "sum", "min"}); err != nil {
+		t.Fatalf("aggregateResult failed: %v", err)
+	}
+	want := [][]sqltypes.Value{{numeric("3"), numeric("15"), sqltypes.MakeString([]byte("a"))}}
+	if !reflect.DeepEqual(qr.Rows, want) {
+		t.Errorf("aggregateResult: got %v, want %v", qr.Rows, want)
+	}
+	if qr.RowsAffected != 1 {
+		t.Errorf("RowsAffected: %v, want 1", qr.RowsAffected)
+	}
+
+	err := aggregateResult(qr, []string{"count"})
+	if err == nil || !strings.Contains(err.Error(), "returned 3 columns, want 1") {
+		t.Errorf("aggregateResult with a wrong column count: %v", err)
+	}
+}
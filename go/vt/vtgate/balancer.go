@@ -16,39 +16,59 @@ import (
 	"github.com/youtube/vitess/go/vt/topo"
 )
 
-var resetDownConnDelay = flag.Duration("reset-down-conn-delay", 10*time.Minute, "delay to reset a marked down tabletconn")
+var (
+	resetDownConnDelay     = flag.Duration("reset-down-conn-delay", 10*time.Minute, "delay to reset a marked down tabletconn")
+	blacklistErrorCount    = flag.Int("endpoint-blacklist-error-count", 3, "number of consecutive errors after which an endpoint is blacklisted until a probe reaches it again (0 to never blacklist)")
+	blacklistProbeInterval = flag.Duration("endpoint-blacklist-probe-interval", 10*time.Second, "interval between two probes of the blacklisted endpoints")
+)
 
 // GetEndPointsFunc defines the callback to topo server.
 type GetEndPointsFunc func() (*topo.EndPoints, error)
 
+// ProbeFunc checks if a blacklisted endpoint is reachable again.
+type ProbeFunc func(endPoint topo.EndPoint) error
+
 // Balancer is a simple round-robin load balancer.
 // It allows you to temporarily mark down nodes that
-// are non-functional.
+// are non-functional. Nodes that keep failing are
+// blacklisted, until a background probe can reach them again.
 type Balancer struct {
-	mu                 sync.Mutex
-	addressNodes       []*addressStatus
-	index              int
-	getEndPoints       GetEndPointsFunc
-	retryDelay         time.Duration
-	resetDownConnDelay time.Duration
+	mu                  sync.Mutex
+	addressNodes        []*addressStatus
+	index               int
+	getEndPoints        GetEndPointsFunc
+	retryDelay          time.Duration
+	resetDownConnDelay  time.Duration
+	probe               ProbeFunc
+	blacklistErrorCount int
+	probeInterval       time.Duration
+	probing             bool
+	closed              bool
 }
 
 type addressStatus struct {
 	endPoint  topo.EndPoint
 	timeRetry time.Time
 	balancer  *Balancer
+	// errorCount is the number of consecutive errors.
+	errorCount  int
+	blacklisted bool
 }
 
 // NewBalancer creates a Balancer. getAddresses is the function
 // it will use to refresh the list of addresses if one of the
 // nodes has been marked down. The list of addresses is shuffled.
 // retryDelay specifies the minimum time a node will be marked down
-// before it will be cleared for a retry.
-func NewBalancer(getEndPoints GetEndPointsFunc, retryDelay time.Duration) *Balancer {
+// before it will be cleared for a retry. probe is used to check
+// the blacklisted nodes, if it is nil nodes are never blacklisted.
+func NewBalancer(getEndPoints GetEndPointsFunc, retryDelay time.Duration, probe ProbeFunc) *Balancer {
 	blc := new(Balancer)
 	blc.getEndPoints = getEndPoints
 	blc.retryDelay = retryDelay
 	blc.resetDownConnDelay = *resetDownConnDelay
+	blc.probe = probe
+	blc.blacklistErrorCount = *blacklistErrorCount
+	blc.probeInterval = *blacklistProbeInterval
 	return blc
 }
 
@@ -56,7 +76,8 @@ func NewBalancer(getEndPoints GetEndPointsFunc, retryDelay time.Duration) *Balan
 // If it finds an address that was down for longer than retryDelay,
 // it refreshes the list of addresses and returns the next available
 // node. If all addresses are marked down, it waits and retries.
-// If a refresh fails, it returns an error.
+// Blacklisted addresses are only returned if there is no other
+// address to use. If a refresh fails, it returns an error.
 func (blc *Balancer) Get() (endPoints []topo.EndPoint, err error) {
 	blc.mu.Lock()
 	defer blc.mu.Unlock()
@@ -77,25 +98,121 @@ func (blc *Balancer) Get() (endPoints []topo.EndPoint, err error) {
 	// Return all endpoints without markdown and timeRetry < now(),
 	// so endpoints just marked down (within retryDelay) are ignored.
 	validEndPoints := make([]topo.EndPoint, 0, 1)
+	var blacklistedEndPoints []topo.EndPoint
 	for _, addrNode := range blc.addressNodes {
 		if addrNode.timeRetry.IsZero() || addrNode.timeRetry.Before(time.Now()) {
+			if addrNode.blacklisted {
+				blacklistedEndPoints = append(blacklistedEndPoints, addrNode.endPoint)
+				continue
+			}
 			validEndPoints = append(validEndPoints, addrNode.endPoint)
 			continue
 		}
 		break
 	}
-
+	if len(validEndPoints) == 0 {
+		return blacklistedEndPoints, nil
+	}
 	return validEndPoints, nil
 }
 
 // MarkDown marks the specified address down. Such addresses
 // will not be used by Balancer for the duration of retryDelay.
+// After blacklistErrorCount consecutive markdowns, the address
+// is blacklisted until the probe succeeds.
 func (blc *Balancer) MarkDown(uid uint32, reason string) {
+	blc.mu.Lock()
+	defer blc.mu.Unlock()
+	index := findAddrNode(blc.addressNodes, uid)
+	if index == -1 {
+		return
+	}
+	addrNode := blc.addressNodes[index]
+	log.Infof("Marking down %v at %+v (%v)", uid, addrNode.endPoint, reason)
+	addrNode.timeRetry = time.Now().Add(blc.retryDelay)
+	addrNode.errorCount++
+	if blc.probe == nil || blc.blacklistErrorCount <= 0 || addrNode.blacklisted || addrNode.errorCount < blc.blacklistErrorCount {
+		return
+	}
+	log.Warningf("Blacklisting %v at %+v after %v consecutive errors", uid, addrNode.endPoint, addrNode.errorCount)
+	addrNode.blacklisted = true
+	if !blc.probing && !blc.closed {
+		blc.probing = true
+		go blc.probeLoop()
+	}
+}
+
+// MarkUp records a successful call to the specified address,
+// which resets its count of consecutive errors.
+func (blc *Balancer) MarkUp(uid uint32) {
+	blc.mu.Lock()
+	defer blc.mu.Unlock()
+	if index := findAddrNode(blc.addressNodes, uid); index != -1 {
+		blc.addressNodes[index].errorCount = 0
+	}
+}
+
+// BlacklistedCount returns the number of blacklisted addresses.
+func (blc *Balancer) BlacklistedCount() int {
+	blc.mu.Lock()
+	defer blc.mu.Unlock()
+	count := 0
+	for _, addrNode := range blc.addressNodes {
+		if addrNode.blacklisted {
+			count++
+		}
+	}
+	return count
+}
+
+// Close stops probing the blacklisted addresses.
+func (blc *Balancer) Close() {
+	blc.mu.Lock()
+	defer blc.mu.Unlock()
+	blc.closed = true
+}
+
+// probeLoop probes the blacklisted addresses every probeInterval,
+// and clears the ones that can be reached. It exits when no address
+// is blacklisted anymore, or when the Balancer is closed.
+func (blc *Balancer) probeLoop() {
+	for {
+		time.Sleep(blc.probeInterval)
+		blc.mu.Lock()
+		var endPoints []topo.EndPoint
+		if !blc.closed {
+			for _, addrNode := range blc.addressNodes {
+				if addrNode.blacklisted {
+					endPoints = append(endPoints, addrNode.endPoint)
+				}
+			}
+		}
+		if len(endPoints) == 0 {
+			blc.probing = false
+			blc.mu.Unlock()
+			return
+		}
+		blc.mu.Unlock()
+
+		for _, endPoint := range endPoints {
+			if err := blc.probe(endPoint); err != nil {
+				log.Infof("Probe of blacklisted %v at %+v failed: %v", endPoint.Uid, endPoint, err)
+				continue
+			}
+			blc.clearBlacklist(endPoint.Uid)
+		}
+	}
+}
+
+func (blc *Balancer) clearBlacklist(uid uint32) {
 	blc.mu.Lock()
 	defer blc.mu.Unlock()
 	if index := findAddrNode(blc.addressNodes, uid); index != -1 {
-		log.Infof("Marking down %v at %+v (%v)", uid, blc.addressNodes[index].endPoint, reason)
-		blc.addressNodes[index].timeRetry = time.Now().Add(blc.retryDelay)
+		addrNode := blc.addressNodes[index]
+		log.Infof("Removing %v at %+v from the blacklist", uid, addrNode.endPoint)
+		addrNode.blacklisted = false
+		addrNode.errorCount = 0
+		addrNode.timeRetry = time.Time{}
 	}
 }
 
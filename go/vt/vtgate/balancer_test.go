@@ -6,6 +6,7 @@ package vtgate
 
 import (
 	"fmt"
+	"sync"
 	"testing"
 	"time"
 
@@ -49,7 +50,7 @@ func endPoints3() (*topo.EndPoints, error) {
 
 func TestRandomness(t *testing.T) {
 	for i := 0; i < 100; i++ {
-		b := NewBalancer(endPoints3, RetryDelay)
+		b := NewBalancer(endPoints3, RetryDelay, nil)
 		endPoints, _ := b.Get()
 		// Ensure that you don't always get the first element at front
 		// in the balancer.
@@ -98,7 +99,7 @@ func endPointsNone() (*topo.EndPoints, error) {
 }
 
 func TestGetAddressesFail(t *testing.T) {
-	b := NewBalancer(endPointsError, RetryDelay)
+	b := NewBalancer(endPointsError, RetryDelay, nil)
 	_, err := b.Get()
 	// Ensure that end point errors are returned correctly.
 	want := "expected error"
@@ -123,7 +124,7 @@ func TestGetAddressesFail(t *testing.T) {
 }
 
 func TestGetSimple(t *testing.T) {
-	b := NewBalancer(endPoints3, RetryDelay)
+	b := NewBalancer(endPoints3, RetryDelay, nil)
 	firstEndPoints, _ := b.Get()
 	for i := 0; i < 100; i++ {
 		endPoints, _ := b.Get()
@@ -139,7 +140,7 @@ func TestGetSimple(t *testing.T) {
 func TestMarkDown(t *testing.T) {
 	start := counter
 	retryDelay := 100 * time.Millisecond
-	b := NewBalancer(endPoints3, retryDelay)
+	b := NewBalancer(endPoints3, retryDelay, nil)
 	addrs, _ := b.Get()
 	b.MarkDown(addrs[0].Uid, "")
 	addrs, _ = b.Get()
@@ -180,6 +181,83 @@ func TestMarkDown(t *testing.T) {
 	}
 }
 
+func TestBlacklist(t *testing.T) {
+	var mu sync.Mutex
+	probeErr := fmt.Errorf("still down")
+	probed := make(chan uint32, 10)
+	probe := func(endPoint topo.EndPoint) error {
+		mu.Lock()
+		defer mu.Unlock()
+		probed <- endPoint.Uid
+		return probeErr
+	}
+	b := NewBalancer(endPoints3, 0, probe)
+	b.blacklistErrorCount = 2
+	b.probeInterval = 10 * time.Millisecond
+	defer b.Close()
+
+	// A success resets the count of consecutive errors.
+	b.Get()
+	b.MarkDown(1, "")
+	b.MarkUp(1)
+	b.MarkDown(1, "")
+	if got := b.BlacklistedCount(); got != 0 {
+		t.Errorf("BlacklistedCount: got %v, want 0", got)
+	}
+	b.MarkDown(1, "")
+	if got := b.BlacklistedCount(); got != 1 {
+		t.Errorf("BlacklistedCount: got %v, want 1", got)
+	}
+	for i := 0; i < 10; i++ {
+		addrs, _ := b.Get()
+		if len(addrs) != 2 {
+			t.Fatalf("Get() returned %v, want 2 endpoints", addrs)
+		}
+		for _, addr := range addrs {
+			if addr.Uid == 1 {
+				t.Errorf("Get() returned blacklisted endpoint: %v", addrs)
+			}
+		}
+	}
+
+	// The blacklisted endpoints are used if there is nothing else.
+	for _, uid := range []uint32{0, 2} {
+		b.MarkDown(uid, "")
+		b.MarkDown(uid, "")
+	}
+	if addrs, _ := b.Get(); len(addrs) != 3 {
+		t.Errorf("Get() returned %v, want the 3 blacklisted endpoints", addrs)
+	}
+
+	// Only a successful probe clears the blacklist.
+	<-probed
+	mu.Lock()
+	probeErr = nil
+	mu.Unlock()
+	timeout := time.After(10 * time.Second)
+	for b.BlacklistedCount() != 0 {
+		select {
+		case <-probed:
+		case <-timeout:
+			t.Fatalf("blacklist was not cleared: %v endpoints left", b.BlacklistedCount())
+		}
+	}
+	if addrs, _ := b.Get(); len(addrs) != 3 {
+		t.Errorf("Get() returned %v, want 3 endpoints", addrs)
+	}
+}
+
+func TestBlacklistDisabled(t *testing.T) {
+	b := NewBalancer(endPoints3, 0, nil)
+	b.blacklistErrorCount = 1
+	b.Get()
+	b.MarkDown(1, "")
+	b.MarkDown(1, "")
+	if got := b.BlacklistedCount(); got != 0 {
+		t.Errorf("BlacklistedCount: got %v, want 0", got)
+	}
+}
+
 var addrNum uint32 = 10
 
 func endPointsMorph() (*topo.EndPoints, error) {
@@ -212,7 +290,7 @@ func endPointsMorph() (*topo.EndPoints, error) {
 }
 
 func TestRefresh(t *testing.T) {
-	b := NewBalancer(endPointsMorph, RetryDelay)
+	b := NewBalancer(endPointsMorph, RetryDelay, nil)
 	b.refresh()
 	index := findAddrNode(b.addressNodes, 11)
 	// "11" should be found in the list.
@@ -0,0 +1,153 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vtgate
+
+import (
+	"errors"
+	"flag"
+	"sync"
+	"time"
+
+	"github.com/youtube/vitess/go/stats"
+	"golang.org/x/net/context"
+)
+
+// This file contains the buffering of the master requests of a shard
+// while its master is unavailable, for instance during a reparent.
+
+var (
+	enableBuffer = flag.Bool("enable_buffer", false, "buffer the master requests of a shard while its master is unavailable, until the master end point changes. This needs a topology server that can watch the end points")
+	bufferWindow = flag.Duration("buffer_window", 10*time.Second, "how long a master request can be buffered before it fails")
+	bufferSize   = flag.Int("buffer_size", 10, "maximum number of master requests buffered per shard. The requests over it fail right away")
+
+	errBufferFull          = errors.New("master buffer is full")
+	errBufferWindowExpired = errors.New("master buffer window expired")
+	errBufferShutdown      = errors.New("vtgate is shutting down")
+
+	// buffersShutdown is closed by shutdownBuffers.
+	buffersShutdown     = make(chan struct{})
+	buffersShutdownOnce sync.Once
+
+	// bufferedRequests is the number of requests currently buffered.
+	bufferedRequests = stats.NewMultiCounters("BufferedRequests", []string{"Keyspace", "ShardName"})
+	// bufferResults counts the outcome of the buffered requests.
+	bufferResults = stats.NewMultiCounters("BufferResults", []string{"Keyspace", "ShardName", "Result"})
+)
+
+// masterBuffer holds the master requests of a shard until its end
+// points change.
+type masterBuffer struct {
+	keyspace string
+	shard    string
+	window   time.Duration
+	size     int
+
+	// mu protects the fields below. changed is closed, and
+	// replaced, every time the end points of the shard change.
+	mu       sync.Mutex
+	buffered int
+	changed  chan struct{}
+}
+
+func newMasterBuffer(keyspace, shard string) *masterBuffer {
+	return &masterBuffer{
+		keyspace: keyspace,
+		shard:    shard,
+		window:   *bufferWindow,
+		size:     *bufferSize,
+		changed:  make(chan struct{}),
+	}
+}
+
+// wait blocks until the end points of the shard change. It fails if
+// the buffer is full, or the deadline is reached or vtgate shuts down
+// first.
+func (mb *masterBuffer) wait(ctx context.Context, deadline time.Time) error {
+	select {
+	case <-buffersShutdown:
+		return errBufferShutdown
+	default:
+	}
+	mb.mu.Lock()
+	if mb.buffered >= mb.size {
+		mb.mu.Unlock()
+		return errBufferFull
+	}
+	mb.buffered++
+	changed := mb.changed
+	mb.mu.Unlock()
+	bufferedRequests.Add([]string{mb.keyspace, mb.shard}, 1)
+	defer func() {
+		mb.mu.Lock()
+		mb.buffered--
+		mb.mu.Unlock()
+		bufferedRequests.Add([]string{mb.keyspace, mb.shard}, -1)
+	}()
+
+	timer := time.NewTimer(deadline.Sub(time.Now()))
+	defer timer.Stop()
+	select {
+	case <-changed:
+		return nil
+	case <-timer.C:
+		return errBufferWindowExpired
+	case <-buffersShutdown:
+		return errBufferShutdown
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// drain wakes up all the buffered requests, so they are retried.
+func (mb *masterBuffer) drain() {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+	close(mb.changed)
+	mb.changed = make(chan struct{})
+}
+
+// shutdownBuffers is called when vtgate enters its lameduck period.
+// The buffered requests fail right away with their last error, so
+// they are done before the RPCs in flight are waited for, and no new
+// request is buffered.
+func shutdownBuffers() {
+	buffersShutdownOnce.Do(func() {
+		close(buffersShutdown)
+	})
+}
+
+// do buffers a request that failed with err because the master was
+// unavailable, and runs action again every time the end points change,
+// until the window expires. action returns true if it failed the same
+// way, so it can be buffered again. If the request cannot be buffered,
+// the last error of action is returned.
+func (mb *masterBuffer) do(ctx context.Context, err error, action func() (bool, error)) error {
+	deadline := time.Now().Add(mb.window)
+	result := "DrainSuccess"
+	for bufferable := true; bufferable; {
+		if waitErr := mb.wait(ctx, deadline); waitErr != nil {
+			result = waitResult(waitErr)
+			break
+		}
+		bufferable, err = action()
+	}
+	if result == "DrainSuccess" && err != nil {
+		result = "DrainError"
+	}
+	bufferResults.Add([]string{mb.keyspace, mb.shard, result}, 1)
+	return err
+}
+
+func waitResult(err error) string {
+	switch err {
+	case errBufferFull:
+		return "BufferFull"
+	case errBufferWindowExpired:
+		return "WindowExpired"
+	case errBufferShutdown:
+		return "Shutdown"
+	}
+	return "Cancelled"
+}
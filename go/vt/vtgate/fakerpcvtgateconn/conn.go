@@ -15,6 +15,7 @@ import (
 
 	mproto "github.com/youtube/vitess/go/mysql/proto"
 	"github.com/youtube/vitess/go/sqltypes"
+	"github.com/youtube/vitess/go/vt/key"
 	tproto "github.com/youtube/vitess/go/vt/tabletserver/proto"
 	"github.com/youtube/vitess/go/vt/topo"
 	"github.com/youtube/vitess/go/vt/vtgate/proto"
@@ -23,10 +24,13 @@ import (
 )
 
 type queryResponse struct {
-	execQuery  *proto.Query
-	shardQuery *proto.QueryShard
-	reply      *mproto.QueryResult
-	err        error
+	execQuery       *proto.Query
+	shardQuery      *proto.QueryShard
+	keyRangeQuery   *proto.KeyRangeQuery
+	keyspaceIdQuery *proto.KeyspaceIdQuery
+	entityIdsQuery  *proto.EntityIdsQuery
+	reply           *mproto.QueryResult
+	err             error
 }
 
 type splitQueryResponse struct {
@@ -39,11 +43,19 @@ type splitQueryResponse struct {
 type FakeVTGateConn struct {
 	execMap       map[string]*queryResponse
 	splitQueryMap map[string]*splitQueryResponse
+	resolverMap   map[string]*vtgateconn.KeyspaceIdResolver
+	explainMap    map[string]*proto.ExplainResult
+	srvKeyspaces  map[string]*topo.SrvKeyspace
 }
 
 // NewFakeVTGateConn creates a new FakeVTConn instance
 func NewFakeVTGateConn(ctx context.Context, address string, timeout time.Duration) *FakeVTGateConn {
-	return &FakeVTGateConn{execMap: make(map[string]*queryResponse)}
+	return &FakeVTGateConn{
+		execMap:      make(map[string]*queryResponse),
+		resolverMap:  make(map[string]*vtgateconn.KeyspaceIdResolver),
+		explainMap:   make(map[string]*proto.ExplainResult),
+		srvKeyspaces: make(map[string]*topo.SrvKeyspace),
+	}
 }
 
 // AddQuery adds a query and expected result.
@@ -64,13 +76,40 @@ func (conn *FakeVTGateConn) AddShardQuery(
 	}
 }
 
+// AddKeyRangeQuery adds a key range query and expected result.
+func (conn *FakeVTGateConn) AddKeyRangeQuery(
+	request *proto.KeyRangeQuery, expectedResult *mproto.QueryResult) {
+	conn.execMap[getKeyRangeQueryKey(request)] = &queryResponse{
+		keyRangeQuery: request,
+		reply:         expectedResult,
+	}
+}
+
+// AddKeyspaceIdsQuery adds a keyspace ids query and expected result.
+func (conn *FakeVTGateConn) AddKeyspaceIdsQuery(
+	request *proto.KeyspaceIdQuery, expectedResult *mproto.QueryResult) {
+	conn.execMap[getKeyspaceIdsQueryKey(request)] = &queryResponse{
+		keyspaceIdQuery: request,
+		reply:           expectedResult,
+	}
+}
+
+// AddEntityIdsQuery adds an entity ids query and expected result.
+func (conn *FakeVTGateConn) AddEntityIdsQuery(
+	request *proto.EntityIdsQuery, expectedResult *mproto.QueryResult) {
+	conn.execMap[getEntityIdsQueryKey(request)] = &queryResponse{
+		entityIdsQuery: request,
+		reply:          expectedResult,
+	}
+}
+
 // AddSplitQuery adds a split query and expected result.
 func (conn *FakeVTGateConn) AddSplitQuery(
 	request *proto.SplitQueryRequest, expectedResult []proto.SplitQueryPart) {
 	splits := request.SplitCount
 	reply := make([]proto.SplitQueryPart, splits, splits)
 	copy(reply, expectedResult)
-	key := getSplitQueryKey(request.Keyspace, &request.Query, request.SplitCount)
+	key := getSplitQueryKey(request.Keyspace, &request.Query, request.SplitColumn, request.SplitCount)
 	conn.splitQueryMap[key] = &splitQueryResponse{
 		splitQuery: request,
 		reply:      expectedResult,
@@ -78,6 +117,25 @@ func (conn *FakeVTGateConn) AddSplitQuery(
 	}
 }
 
+// AddKeyspaceIdResolver adds the sharding column of a keyspace.
+func (conn *FakeVTGateConn) AddKeyspaceIdResolver(keyspace, shardingColumnName string, shardingColumnType key.KeyspaceIdType) {
+	conn.resolverMap[keyspace] = &vtgateconn.KeyspaceIdResolver{
+		Keyspace:           keyspace,
+		ShardingColumnName: shardingColumnName,
+		ShardingColumnType: shardingColumnType,
+	}
+}
+
+// AddExplain adds the routing decision returned for a query.
+func (conn *FakeVTGateConn) AddExplain(query string, result *proto.ExplainResult) {
+	conn.explainMap[query] = result
+}
+
+// AddSrvKeyspace adds the SrvKeyspace returned for a keyspace in a cell.
+func (conn *FakeVTGateConn) AddSrvKeyspace(cell, keyspace string, srvKeyspace *topo.SrvKeyspace) {
+	conn.srvKeyspaces[cell+"/"+keyspace] = srvKeyspace
+}
+
 // Execute please see vtgateconn.VTGateConn.Execute
 func (conn *FakeVTGateConn) Execute(
 	ctx context.Context,
@@ -136,6 +194,136 @@ func (conn *FakeVTGateConn) executeShard(ctx context.Context, query *proto.Query
 	return &reply, nil
 }
 
+// ExecuteKeyRanges please see vtgateconn.VTGateConn.ExecuteKeyRanges
+func (conn *FakeVTGateConn) ExecuteKeyRanges(ctx context.Context, query string, keyspace string, keyRanges []key.KeyRange, bindVars map[string]interface{}, tabletType topo.TabletType) (*mproto.QueryResult, error) {
+	return conn.executeKeyRanges(
+		ctx,
+		&proto.KeyRangeQuery{
+			Sql:           query,
+			BindVariables: bindVars,
+			TabletType:    tabletType,
+			Keyspace:      keyspace,
+			KeyRanges:     keyRanges,
+			Session:       nil,
+		})
+}
+
+func (conn *FakeVTGateConn) executeKeyRanges(ctx context.Context, query *proto.KeyRangeQuery) (*mproto.QueryResult, error) {
+	response, ok := conn.execMap[getKeyRangeQueryKey(query)]
+	if !ok {
+		return nil, fmt.Errorf("no match for: %s", query.Sql)
+	}
+	if !reflect.DeepEqual(query, response.keyRangeQuery) {
+		return nil, fmt.Errorf(
+			"ExecuteKeyRanges: %+v, want %+v", query, response.keyRangeQuery)
+	}
+	var reply mproto.QueryResult
+	reply = *response.reply
+	return &reply, nil
+}
+
+// ExecuteEntityIds please see vtgateconn.VTGateConn.ExecuteEntityIds
+func (conn *FakeVTGateConn) ExecuteEntityIds(ctx context.Context, query string, keyspace string, entityColumnName string, entityKeyspaceIDs []proto.EntityId, bindVars map[string]interface{}, tabletType topo.TabletType) (*mproto.QueryResult, error) {
+	return conn.executeEntityIds(
+		ctx,
+		&proto.EntityIdsQuery{
+			Sql:               query,
+			BindVariables:     bindVars,
+			TabletType:        tabletType,
+			Keyspace:          keyspace,
+			EntityColumnName:  entityColumnName,
+			EntityKeyspaceIDs: entityKeyspaceIDs,
+			Session:           nil,
+		})
+}
+
+func (conn *FakeVTGateConn) executeEntityIds(ctx context.Context, query *proto.EntityIdsQuery) (*mproto.QueryResult, error) {
+	response, ok := conn.execMap[getEntityIdsQueryKey(query)]
+	if !ok {
+		return nil, fmt.Errorf("no match for: %s", query.Sql)
+	}
+	if !reflect.DeepEqual(query, response.entityIdsQuery) {
+		return nil, fmt.Errorf(
+			"ExecuteEntityIds: %+v, want %+v", query, response.entityIdsQuery)
+	}
+	var reply mproto.QueryResult
+	reply = *response.reply
+	return &reply, nil
+}
+
+// ExecuteBatchShard please see vtgateconn.VTGateConn.ExecuteBatchShard
+func (conn *FakeVTGateConn) ExecuteBatchShard(ctx context.Context, queries []proto.BoundShardQuery, tabletType topo.TabletType) ([]mproto.QueryResult, error) {
+	return conn.executeBatchShard(ctx, queries, tabletType, nil)
+}
+
+// executeBatchShard runs each query of the batch like executeShard.
+func (conn *FakeVTGateConn) executeBatchShard(ctx context.Context, queries []proto.BoundShardQuery, tabletType topo.TabletType, session *proto.Session) ([]mproto.QueryResult, error) {
+	return executeBatch(len(queries), func(i int) (*mproto.QueryResult, error) {
+		return conn.executeShard(ctx, &proto.QueryShard{
+			Sql:           queries[i].Sql,
+			BindVariables: queries[i].BindVariables,
+			TabletType:    tabletType,
+			Keyspace:      queries[i].Keyspace,
+			Shards:        queries[i].Shards,
+			Session:       session,
+		})
+	})
+}
+
+// ExecuteBatchKeyspaceIds please see vtgateconn.VTGateConn.ExecuteBatchKeyspaceIds
+func (conn *FakeVTGateConn) ExecuteBatchKeyspaceIds(ctx context.Context, queries []proto.BoundKeyspaceIdQuery, tabletType topo.TabletType) ([]mproto.QueryResult, error) {
+	return conn.executeBatchKeyspaceIds(ctx, queries, tabletType, nil)
+}
+
+// executeBatchKeyspaceIds runs each query of the batch against the
+// keyspace ids queries.
+func (conn *FakeVTGateConn) executeBatchKeyspaceIds(ctx context.Context, queries []proto.BoundKeyspaceIdQuery, tabletType topo.TabletType, session *proto.Session) ([]mproto.QueryResult, error) {
+	return executeBatch(len(queries), func(i int) (*mproto.QueryResult, error) {
+		request := &proto.KeyspaceIdQuery{
+			Sql:           queries[i].Sql,
+			BindVariables: queries[i].BindVariables,
+			TabletType:    tabletType,
+			Keyspace:      queries[i].Keyspace,
+			KeyspaceIds:   queries[i].KeyspaceIds,
+			Session:       session,
+		}
+		response, ok := conn.execMap[getKeyspaceIdsQueryKey(request)]
+		if !ok {
+			return nil, fmt.Errorf("no match for: %s", request.Sql)
+		}
+		if !reflect.DeepEqual(request, response.keyspaceIdQuery) {
+			return nil, fmt.Errorf("ExecuteBatchKeyspaceIds: %+v, want %+v", request, response.keyspaceIdQuery)
+		}
+		if response.err != nil {
+			return nil, response.err
+		}
+		reply := *response.reply
+		return &reply, nil
+	})
+}
+
+// executeBatch returns the results of the n queries of a batch, and
+// a *vtgateconn.BatchError if some of them failed.
+func executeBatch(n int, execute func(i int) (*mproto.QueryResult, error)) ([]mproto.QueryResult, error) {
+	qrs := make([]mproto.QueryResult, n)
+	var batchErr *vtgateconn.BatchError
+	for i := range qrs {
+		qr, err := execute(i)
+		if err != nil {
+			if batchErr == nil {
+				batchErr = &vtgateconn.BatchError{Errors: make([]error, n)}
+			}
+			batchErr.Errors[i] = err
+			continue
+		}
+		qrs[i] = *qr
+	}
+	if batchErr != nil {
+		return qrs, batchErr
+	}
+	return qrs, nil
+}
+
 // StreamExecute please see vtgateconn.VTGateConn.StreamExecute
 func (conn *FakeVTGateConn) StreamExecute(ctx context.Context, query string, bindVars map[string]interface{}, tabletType topo.TabletType) (<-chan *mproto.QueryResult, vtgateconn.ErrFunc) {
 
@@ -171,6 +359,87 @@ func (conn *FakeVTGateConn) StreamExecute(ctx context.Context, query string, bin
 	return resultChan, nil
 }
 
+// StreamExecuteShard please see vtgateconn.VTGateConn.StreamExecuteShard
+func (conn *FakeVTGateConn) StreamExecuteShard(ctx context.Context, query string, keyspace string, shards []string, bindVars map[string]interface{}, tabletType topo.TabletType, orderedMerge bool) (<-chan *mproto.QueryResult, vtgateconn.ErrFunc) {
+	request := &proto.QueryShard{
+		Sql:           query,
+		BindVariables: bindVars,
+		TabletType:    tabletType,
+		Keyspace:      keyspace,
+		Shards:        shards,
+		Session:       nil,
+		OrderedMerge:  orderedMerge,
+	}
+	response, ok := conn.execMap[getShardQueryKey(request)]
+	if !ok {
+		return streamResponse(nil, fmt.Errorf("no match for: %s", query))
+	}
+	if !reflect.DeepEqual(request, response.shardQuery) {
+		return streamResponse(nil, fmt.Errorf("StreamExecuteShard: %+v, want %+v", request, response.shardQuery))
+	}
+	return streamResponse(response.reply, response.err)
+}
+
+// StreamExecuteKeyRanges please see vtgateconn.VTGateConn.StreamExecuteKeyRanges
+func (conn *FakeVTGateConn) StreamExecuteKeyRanges(ctx context.Context, query string, keyspace string, keyRanges []key.KeyRange, bindVars map[string]interface{}, tabletType topo.TabletType, orderedMerge bool) (<-chan *mproto.QueryResult, vtgateconn.ErrFunc) {
+	request := &proto.KeyRangeQuery{
+		Sql:           query,
+		BindVariables: bindVars,
+		TabletType:    tabletType,
+		Keyspace:      keyspace,
+		KeyRanges:     keyRanges,
+		Session:       nil,
+		OrderedMerge:  orderedMerge,
+	}
+	response, ok := conn.execMap[getKeyRangeQueryKey(request)]
+	if !ok {
+		return streamResponse(nil, fmt.Errorf("no match for: %s", query))
+	}
+	if !reflect.DeepEqual(request, response.keyRangeQuery) {
+		return streamResponse(nil, fmt.Errorf("StreamExecuteKeyRanges: %+v, want %+v", request, response.keyRangeQuery))
+	}
+	return streamResponse(response.reply, response.err)
+}
+
+// StreamExecuteKeyspaceIds please see vtgateconn.VTGateConn.StreamExecuteKeyspaceIds
+func (conn *FakeVTGateConn) StreamExecuteKeyspaceIds(ctx context.Context, query string, keyspace string, keyspaceIds []key.KeyspaceId, bindVars map[string]interface{}, tabletType topo.TabletType, orderedMerge bool) (<-chan *mproto.QueryResult, vtgateconn.ErrFunc) {
+	request := &proto.KeyspaceIdQuery{
+		Sql:           query,
+		BindVariables: bindVars,
+		TabletType:    tabletType,
+		Keyspace:      keyspace,
+		KeyspaceIds:   keyspaceIds,
+		Session:       nil,
+		OrderedMerge:  orderedMerge,
+	}
+	response, ok := conn.execMap[getKeyspaceIdsQueryKey(request)]
+	if !ok {
+		return streamResponse(nil, fmt.Errorf("no match for: %s", query))
+	}
+	if !reflect.DeepEqual(request, response.keyspaceIdQuery) {
+		return streamResponse(nil, fmt.Errorf("StreamExecuteKeyspaceIds: %+v, want %+v", request, response.keyspaceIdQuery))
+	}
+	return streamResponse(response.reply, response.err)
+}
+
+// streamResponse returns reply as a stream: the fields first, then
+// one row per result.
+func streamResponse(reply *mproto.QueryResult, err error) (<-chan *mproto.QueryResult, vtgateconn.ErrFunc) {
+	var results []*mproto.QueryResult
+	if reply != nil {
+		results = append(results, &mproto.QueryResult{Fields: reply.Fields})
+		for _, row := range reply.Rows {
+			results = append(results, &mproto.QueryResult{Rows: [][]sqltypes.Value{row}})
+		}
+	}
+	resultChan := make(chan *mproto.QueryResult, len(results))
+	for _, result := range results {
+		resultChan <- result
+	}
+	close(resultChan)
+	return resultChan, func() error { return err }
+}
+
 // Begin please see vtgateconn.VTGateConn.Begin
 func (conn *FakeVTGateConn) Begin(ctx context.Context) (vtgateconn.VTGateTx, error) {
 	tx := &fakeVTGateTx{
@@ -182,18 +451,45 @@ func (conn *FakeVTGateConn) Begin(ctx context.Context) (vtgateconn.VTGateTx, err
 }
 
 // SplitQuery please see vtgateconn.VTGateConn.SplitQuery
-func (conn *FakeVTGateConn) SplitQuery(ctx context.Context, keyspace string, query tproto.BoundQuery, splitCount int) ([]proto.SplitQueryPart, error) {
-	response, ok := conn.splitQueryMap[getSplitQueryKey(keyspace, &query, splitCount)]
+func (conn *FakeVTGateConn) SplitQuery(ctx context.Context, keyspace string, query tproto.BoundQuery, splitColumn string, splitCount int) ([]proto.SplitQueryPart, error) {
+	response, ok := conn.splitQueryMap[getSplitQueryKey(keyspace, &query, splitColumn, splitCount)]
 	if !ok {
 		return nil, fmt.Errorf(
-			"no match for keyspace: %s, query: %v, split count: %d",
-			keyspace, query, splitCount)
+			"no match for keyspace: %s, query: %v, split column: %v, split count: %d",
+			keyspace, query, splitColumn, splitCount)
 	}
 	reply := make([]proto.SplitQueryPart, splitCount, splitCount)
 	copy(reply, response.reply)
 	return reply, nil
 }
 
+// GetKeyspaceIdResolver please see vtgateconn.VTGateConn.GetKeyspaceIdResolver
+func (conn *FakeVTGateConn) GetKeyspaceIdResolver(ctx context.Context, keyspace string) (*vtgateconn.KeyspaceIdResolver, error) {
+	resolver, ok := conn.resolverMap[keyspace]
+	if !ok {
+		return nil, fmt.Errorf("no match for keyspace: %s", keyspace)
+	}
+	return resolver, nil
+}
+
+// Explain please see vtgateconn.VTGateConn.Explain
+func (conn *FakeVTGateConn) Explain(ctx context.Context, query string, bindVars map[string]interface{}, tabletType topo.TabletType) (*proto.ExplainResult, error) {
+	result, ok := conn.explainMap[query]
+	if !ok {
+		return nil, fmt.Errorf("no match for: %s", query)
+	}
+	return result, nil
+}
+
+// GetSrvKeyspace please see vtgateconn.VTGateConn.GetSrvKeyspace
+func (conn *FakeVTGateConn) GetSrvKeyspace(ctx context.Context, cell, keyspace string) (*topo.SrvKeyspace, error) {
+	srvKeyspace, ok := conn.srvKeyspaces[cell+"/"+keyspace]
+	if !ok {
+		return nil, fmt.Errorf("no match for cell: %s, keyspace: %s", cell, keyspace)
+	}
+	return srvKeyspace, nil
+}
+
 // Close please see vtgateconn.VTGateConn.Close
 func (conn *FakeVTGateConn) Close() {
 }
@@ -240,6 +536,61 @@ func (tx *fakeVTGateTx) ExecuteShard(ctx context.Context, query string, keyspace
 	return r, err
 }
 
+func (tx *fakeVTGateTx) ExecuteKeyRanges(ctx context.Context, query string, keyspace string, keyRanges []key.KeyRange, bindVars map[string]interface{}, tabletType topo.TabletType) (*mproto.QueryResult, error) {
+	if tx.session == nil {
+		return nil, errors.New("executeKeyRanges: not in transaction")
+	}
+	r, err := tx.conn.executeKeyRanges(
+		ctx,
+		&proto.KeyRangeQuery{
+			Sql:           query,
+			BindVariables: bindVars,
+			TabletType:    tabletType,
+			Keyspace:      keyspace,
+			KeyRanges:     keyRanges,
+			Session:       tx.session,
+		})
+	tx.session = newSession(true, keyspace, []string{}, tabletType)
+	return r, err
+}
+
+func (tx *fakeVTGateTx) ExecuteEntityIds(ctx context.Context, query string, keyspace string, entityColumnName string, entityKeyspaceIDs []proto.EntityId, bindVars map[string]interface{}, tabletType topo.TabletType) (*mproto.QueryResult, error) {
+	if tx.session == nil {
+		return nil, errors.New("executeEntityIds: not in transaction")
+	}
+	r, err := tx.conn.executeEntityIds(
+		ctx,
+		&proto.EntityIdsQuery{
+			Sql:               query,
+			BindVariables:     bindVars,
+			TabletType:        tabletType,
+			Keyspace:          keyspace,
+			EntityColumnName:  entityColumnName,
+			EntityKeyspaceIDs: entityKeyspaceIDs,
+			Session:           tx.session,
+		})
+	tx.session = newSession(true, keyspace, []string{}, tabletType)
+	return r, err
+}
+
+func (tx *fakeVTGateTx) ExecuteBatchShard(ctx context.Context, queries []proto.BoundShardQuery, tabletType topo.TabletType) ([]mproto.QueryResult, error) {
+	if tx.session == nil {
+		return nil, errors.New("executeBatchShard: not in transaction")
+	}
+	qrs, err := tx.conn.executeBatchShard(ctx, queries, tabletType, tx.session)
+	tx.session = newSession(true, "test_keyspace", []string{}, tabletType)
+	return qrs, err
+}
+
+func (tx *fakeVTGateTx) ExecuteBatchKeyspaceIds(ctx context.Context, queries []proto.BoundKeyspaceIdQuery, tabletType topo.TabletType) ([]mproto.QueryResult, error) {
+	if tx.session == nil {
+		return nil, errors.New("executeBatchKeyspaceIds: not in transaction")
+	}
+	qrs, err := tx.conn.executeBatchKeyspaceIds(ctx, queries, tabletType, tx.session)
+	tx.session = newSession(true, "test_keyspace", []string{}, tabletType)
+	return qrs, err
+}
+
 func (tx *fakeVTGateTx) Commit(ctx context.Context) error {
 	if tx.session == nil {
 		return errors.New("commit: not in transaction")
@@ -261,8 +612,20 @@ func getShardQueryKey(request *proto.QueryShard) string {
 	return fmt.Sprintf("%s-%s", request.Sql, strings.Join(request.Shards, ":"))
 }
 
-func getSplitQueryKey(keyspace string, query *tproto.BoundQuery, splitCount int) string {
-	return fmt.Sprintf("%s:%v:%d", keyspace, query, splitCount)
+func getKeyRangeQueryKey(request *proto.KeyRangeQuery) string {
+	return fmt.Sprintf("%s-%s-%v", request.Sql, request.Keyspace, request.KeyRanges)
+}
+
+func getKeyspaceIdsQueryKey(request *proto.KeyspaceIdQuery) string {
+	return fmt.Sprintf("%s-%s-%v", request.Sql, request.Keyspace, request.KeyspaceIds)
+}
+
+func getEntityIdsQueryKey(request *proto.EntityIdsQuery) string {
+	return fmt.Sprintf("%s-%s-%s", request.Sql, request.Keyspace, request.EntityColumnName)
+}
+
+func getSplitQueryKey(keyspace string, query *tproto.BoundQuery, splitColumn string, splitCount int) string {
+	return fmt.Sprintf("%s:%v:%s:%d", keyspace, query, splitColumn, splitCount)
 }
 
 func newSession(
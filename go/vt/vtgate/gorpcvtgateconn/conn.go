@@ -6,16 +6,21 @@
 package gorpcvtgateconn
 
 import (
+	"crypto/tls"
 	"errors"
+	"fmt"
 	"strings"
 	"time"
 
 	mproto "github.com/youtube/vitess/go/mysql/proto"
 	"github.com/youtube/vitess/go/rpcplus"
+	"github.com/youtube/vitess/go/rpcwrap"
 	"github.com/youtube/vitess/go/rpcwrap/bsonrpc"
+	"github.com/youtube/vitess/go/vt/key"
 	"github.com/youtube/vitess/go/vt/rpc"
 	tproto "github.com/youtube/vitess/go/vt/tabletserver/proto"
 	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/vt/vterrors"
 	"github.com/youtube/vitess/go/vt/vtgate/proto"
 	"github.com/youtube/vitess/go/vt/vtgate/vtgateconn"
 	"golang.org/x/net/context"
@@ -23,6 +28,7 @@ import (
 
 func init() {
 	vtgateconn.RegisterDialer("gorpc", dial)
+	vtgateconn.RegisterDialer("gorpcs", dialSecure)
 }
 
 type vtgateConn struct {
@@ -35,12 +41,81 @@ func dial(ctx context.Context, address string, timeout time.Duration) (vtgatecon
 		network = "unix"
 	}
 	rpcConn, err := bsonrpc.DialHTTP(network, address, timeout, nil)
+	if err != nil {
+		return nil, vtgateError(err)
+	}
+	return &vtgateConn{rpcConn: rpcConn}, nil
+}
+
+// dialSecure connects to the secure port of vtgate, with the TLS
+// config of the -client_cert, -client_key and -client_ca_cert flags.
+// It is registered as the "gorpcs" protocol.
+func dialSecure(ctx context.Context, address string, timeout time.Duration) (vtgateconn.VTGateConn, error) {
+	config, err := rpcwrap.DefaultClientTLSConfig()
 	if err != nil {
 		return nil, err
 	}
+	return DialTLS(address, timeout, config)
+}
+
+// DialTLS connects to the secure port of vtgate with config.
+func DialTLS(address string, timeout time.Duration, config *tls.Config) (vtgateconn.VTGateConn, error) {
+	rpcConn, err := bsonrpc.DialHTTP("tcp", address, timeout, config)
+	if err != nil {
+		return nil, vtgateError(err)
+	}
 	return &vtgateConn{rpcConn: rpcConn}, nil
 }
 
+// call sends an rpc to vtgate, and returns as soon as ctx is done.
+// The returned errors are converted to the vtgateconn errors.
+func (conn *vtgateConn) call(ctx context.Context, method string, request, reply interface{}) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- conn.rpcConn.Call(ctx, method, request, reply)
+	}()
+	select {
+	case err := <-done:
+		return vtgateError(err)
+	case <-ctx.Done():
+		return vtgateError(ctx.Err())
+	}
+}
+
+// ctxTimeout returns the time left before the deadline of ctx, so
+// vtgate gives up on the call when the caller does. It returns 0 if
+// ctx has no deadline.
+func ctxTimeout(ctx context.Context) time.Duration {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return 0
+	}
+	if timeout := deadline.Sub(time.Now()); timeout > 0 {
+		return timeout
+	}
+	// already expired: ask for the shortest possible timeout
+	return 1
+}
+
+func vtgateError(err error) error {
+	if err == nil {
+		return nil
+	}
+	switch err := err.(type) {
+	case rpcplus.ServerError:
+		return vtgateconn.NewServerError(err.Error())
+	case *rpcplus.CodedServerError:
+		return vtgateconn.NewServerErrorWithCode(err.Error(), vterrors.ErrorCode(err.Code))
+	}
+	switch err {
+	case context.DeadlineExceeded:
+		return vtgateconn.ErrTimeout
+	case context.Canceled:
+		return err
+	}
+	return vtgateconn.OperationalError(fmt.Sprintf("vtgate: %v", err))
+}
+
 func (conn *vtgateConn) Execute(ctx context.Context, query string, bindVars map[string]interface{}, tabletType topo.TabletType) (*mproto.QueryResult, error) {
 	r, _, err := conn.execute(ctx, query, bindVars, tabletType, nil)
 	return r, err
@@ -52,13 +127,15 @@ func (conn *vtgateConn) execute(ctx context.Context, query string, bindVars map[
 		BindVariables: bindVars,
 		TabletType:    tabletType,
 		Session:       session,
+		Timeout:       ctxTimeout(ctx),
+		CallerID:      vtgateconn.CallerID(ctx),
 	}
 	var result proto.QueryResult
-	if err := conn.rpcConn.Call(ctx, "VTGate.Execute", request, &result); err != nil {
+	if err := conn.call(ctx, "VTGate.Execute", request, &result); err != nil {
 		return nil, session, err
 	}
 	if result.Error != "" {
-		return nil, result.Session, errors.New(result.Error)
+		return nil, result.Session, vtgateconn.NewServerErrorWithCode(result.Error, result.ErrorCode)
 	}
 	return result.Result, result.Session, nil
 }
@@ -69,64 +146,329 @@ func (conn *vtgateConn) ExecuteShard(ctx context.Context, query string, keyspace
 }
 
 func (conn *vtgateConn) executeShard(ctx context.Context, query string, keyspace string, shards []string, bindVars map[string]interface{}, tabletType topo.TabletType, session *proto.Session) (*mproto.QueryResult, *proto.Session, error) {
+	policy, allowMasterFallback := routingPolicy(ctx)
 	request := proto.QueryShard{
-		Sql:           query,
-		BindVariables: bindVars,
-		Keyspace:      keyspace,
-		Shards:        shards,
-		TabletType:    tabletType,
-		Session:       session,
+		Sql:                 query,
+		BindVariables:       bindVars,
+		Keyspace:            keyspace,
+		Shards:              shards,
+		TabletType:          tabletType,
+		Session:             session,
+		Timeout:             ctxTimeout(ctx),
+		RoutingPolicy:       policy,
+		AllowMasterFallback: allowMasterFallback,
+	}
+	var result proto.QueryResult
+	if err := conn.call(ctx, "VTGate.ExecuteShard", request, &result); err != nil {
+		return nil, session, err
+	}
+	routedTo(ctx, result.TabletType)
+	if result.Error != "" {
+		return nil, result.Session, vtgateconn.NewServerErrorWithCode(result.Error, result.ErrorCode)
+	}
+	return result.Result, result.Session, nil
+}
+
+func (conn *vtgateConn) ExecuteKeyRanges(ctx context.Context, query string, keyspace string, keyRanges []key.KeyRange, bindVars map[string]interface{}, tabletType topo.TabletType) (*mproto.QueryResult, error) {
+	r, _, err := conn.executeKeyRanges(ctx, query, keyspace, keyRanges, bindVars, tabletType, nil)
+	return r, err
+}
+
+func (conn *vtgateConn) executeKeyRanges(ctx context.Context, query string, keyspace string, keyRanges []key.KeyRange, bindVars map[string]interface{}, tabletType topo.TabletType, session *proto.Session) (*mproto.QueryResult, *proto.Session, error) {
+	policy, allowMasterFallback := routingPolicy(ctx)
+	request := proto.KeyRangeQuery{
+		Sql:                 query,
+		BindVariables:       bindVars,
+		Keyspace:            keyspace,
+		KeyRanges:           keyRanges,
+		TabletType:          tabletType,
+		Session:             session,
+		Timeout:             ctxTimeout(ctx),
+		RoutingPolicy:       policy,
+		AllowMasterFallback: allowMasterFallback,
 	}
 	var result proto.QueryResult
-	if err := conn.rpcConn.Call(ctx, "VTGate.ExecuteShard", request, &result); err != nil {
+	if err := conn.call(ctx, "VTGate.ExecuteKeyRanges", request, &result); err != nil {
 		return nil, session, err
 	}
+	routedTo(ctx, result.TabletType)
 	if result.Error != "" {
-		return nil, result.Session, errors.New(result.Error)
+		return nil, result.Session, vtgateconn.NewServerErrorWithCode(result.Error, result.ErrorCode)
 	}
 	return result.Result, result.Session, nil
 }
 
+func (conn *vtgateConn) ExecuteEntityIds(ctx context.Context, query string, keyspace string, entityColumnName string, entityKeyspaceIDs []proto.EntityId, bindVars map[string]interface{}, tabletType topo.TabletType) (*mproto.QueryResult, error) {
+	r, _, err := conn.executeEntityIds(ctx, query, keyspace, entityColumnName, entityKeyspaceIDs, bindVars, tabletType, nil)
+	return r, err
+}
+
+func (conn *vtgateConn) executeEntityIds(ctx context.Context, query string, keyspace string, entityColumnName string, entityKeyspaceIDs []proto.EntityId, bindVars map[string]interface{}, tabletType topo.TabletType, session *proto.Session) (*mproto.QueryResult, *proto.Session, error) {
+	policy, allowMasterFallback := routingPolicy(ctx)
+	request := proto.EntityIdsQuery{
+		Sql:                 query,
+		BindVariables:       bindVars,
+		Keyspace:            keyspace,
+		EntityColumnName:    entityColumnName,
+		EntityKeyspaceIDs:   entityKeyspaceIDs,
+		TabletType:          tabletType,
+		Session:             session,
+		Timeout:             ctxTimeout(ctx),
+		RoutingPolicy:       policy,
+		AllowMasterFallback: allowMasterFallback,
+	}
+	var result proto.QueryResult
+	if err := conn.call(ctx, "VTGate.ExecuteEntityIds", request, &result); err != nil {
+		return nil, session, err
+	}
+	routedTo(ctx, result.TabletType)
+	if result.Error != "" {
+		return nil, result.Session, vtgateconn.NewServerErrorWithCode(result.Error, result.ErrorCode)
+	}
+	return result.Result, result.Session, nil
+}
+
+func (conn *vtgateConn) ExecuteBatchShard(ctx context.Context, queries []proto.BoundShardQuery, tabletType topo.TabletType) ([]mproto.QueryResult, error) {
+	qrs, _, err := conn.executeBatchShard(ctx, queries, tabletType, nil)
+	return qrs, err
+}
+
+func (conn *vtgateConn) executeBatchShard(ctx context.Context, queries []proto.BoundShardQuery, tabletType topo.TabletType, session *proto.Session) ([]mproto.QueryResult, *proto.Session, error) {
+	request := proto.BatchQueryShard{
+		TabletType:   tabletType,
+		Session:      session,
+		Timeout:      ctxTimeout(ctx),
+		ShardQueries: queries,
+	}
+	var result proto.QueryResultList
+	if err := conn.call(ctx, "VTGate.ExecuteBatchShard", request, &result); err != nil {
+		return nil, session, err
+	}
+	return batchResult(&result)
+}
+
+func (conn *vtgateConn) ExecuteBatchKeyspaceIds(ctx context.Context, queries []proto.BoundKeyspaceIdQuery, tabletType topo.TabletType) ([]mproto.QueryResult, error) {
+	qrs, _, err := conn.executeBatchKeyspaceIds(ctx, queries, tabletType, nil)
+	return qrs, err
+}
+
+func (conn *vtgateConn) executeBatchKeyspaceIds(ctx context.Context, queries []proto.BoundKeyspaceIdQuery, tabletType topo.TabletType, session *proto.Session) ([]mproto.QueryResult, *proto.Session, error) {
+	request := proto.KeyspaceIdBatchQuery{
+		TabletType:        tabletType,
+		Session:           session,
+		Timeout:           ctxTimeout(ctx),
+		KeyspaceIdQueries: queries,
+	}
+	var result proto.QueryResultList
+	if err := conn.call(ctx, "VTGate.ExecuteBatchKeyspaceIds", request, &result); err != nil {
+		return nil, session, err
+	}
+	return batchResult(&result)
+}
+
+// batchResult returns the results of a batch call, and a
+// *vtgateconn.BatchError if some of its queries failed.
+func batchResult(result *proto.QueryResultList) ([]mproto.QueryResult, *proto.Session, error) {
+	if result.Error != "" {
+		return nil, result.Session, vtgateconn.NewServerErrorWithCode(result.Error, result.ErrorCode)
+	}
+	var batchErr *vtgateconn.BatchError
+	for i, qerr := range result.Errors {
+		if qerr == "" {
+			continue
+		}
+		if batchErr == nil {
+			batchErr = &vtgateconn.BatchError{Errors: make([]error, len(result.Errors))}
+		}
+		var code vterrors.ErrorCode
+		if i < len(result.ErrorCodes) {
+			code = result.ErrorCodes[i]
+		}
+		batchErr.Errors[i] = vtgateconn.NewServerErrorWithCode(qerr, code)
+	}
+	if batchErr != nil {
+		return result.List, result.Session, batchErr
+	}
+	return result.List, result.Session, nil
+}
+
+// routingPolicy returns the routing policy of ctx.
+func routingPolicy(ctx context.Context) (proto.RoutingPolicy, bool) {
+	if routing := vtgateconn.RoutingFromContext(ctx); routing != nil {
+		return routing.Policy, routing.AllowMasterFallback
+	}
+	return proto.RoutingStrict, false
+}
+
+// routedTo records the tablet type that served a read in the
+// routing of ctx.
+func routedTo(ctx context.Context, tabletType topo.TabletType) {
+	if routing := vtgateconn.RoutingFromContext(ctx); routing != nil {
+		routing.TabletType = tabletType
+	}
+}
+
 func (conn *vtgateConn) StreamExecute(ctx context.Context, query string, bindVars map[string]interface{}, tabletType topo.TabletType) (<-chan *mproto.QueryResult, vtgateconn.ErrFunc) {
 	req := &proto.Query{
 		Sql:           query,
 		BindVariables: bindVars,
 		TabletType:    tabletType,
 		Session:       nil,
+		Timeout:       ctxTimeout(ctx),
+		CallerID:      vtgateconn.CallerID(ctx),
+	}
+	return conn.streamExecute(ctx, "VTGate.StreamExecute", req)
+}
+
+func (conn *vtgateConn) StreamExecuteShard(ctx context.Context, query string, keyspace string, shards []string, bindVars map[string]interface{}, tabletType topo.TabletType, orderedMerge bool) (<-chan *mproto.QueryResult, vtgateconn.ErrFunc) {
+	req := &proto.QueryShard{
+		Sql:           query,
+		BindVariables: bindVars,
+		Keyspace:      keyspace,
+		Shards:        shards,
+		TabletType:    tabletType,
+		Session:       nil,
+		Timeout:       ctxTimeout(ctx),
+		OrderedMerge:  orderedMerge,
+	}
+	return conn.streamExecute(ctx, "VTGate.StreamExecuteShard", req)
+}
+
+func (conn *vtgateConn) StreamExecuteKeyRanges(ctx context.Context, query string, keyspace string, keyRanges []key.KeyRange, bindVars map[string]interface{}, tabletType topo.TabletType, orderedMerge bool) (<-chan *mproto.QueryResult, vtgateconn.ErrFunc) {
+	req := &proto.KeyRangeQuery{
+		Sql:           query,
+		BindVariables: bindVars,
+		Keyspace:      keyspace,
+		KeyRanges:     keyRanges,
+		TabletType:    tabletType,
+		Session:       nil,
+		Timeout:       ctxTimeout(ctx),
+		OrderedMerge:  orderedMerge,
 	}
+	return conn.streamExecute(ctx, "VTGate.StreamExecuteKeyRanges", req)
+}
+
+func (conn *vtgateConn) StreamExecuteKeyspaceIds(ctx context.Context, query string, keyspace string, keyspaceIds []key.KeyspaceId, bindVars map[string]interface{}, tabletType topo.TabletType, orderedMerge bool) (<-chan *mproto.QueryResult, vtgateconn.ErrFunc) {
+	req := &proto.KeyspaceIdQuery{
+		Sql:           query,
+		BindVariables: bindVars,
+		Keyspace:      keyspace,
+		KeyspaceIds:   keyspaceIds,
+		TabletType:    tabletType,
+		Session:       nil,
+		Timeout:       ctxTimeout(ctx),
+		OrderedMerge:  orderedMerge,
+	}
+	return conn.streamExecute(ctx, "VTGate.StreamExecuteKeyspaceIds", req)
+}
+
+// streamExecute starts a streaming call, and forwards its results
+// until it ends or ctx is done. In the latter case, the rest of the
+// stream is drained so the rpc client is not blocked.
+func (conn *vtgateConn) streamExecute(ctx context.Context, method string, req interface{}) (<-chan *mproto.QueryResult, vtgateconn.ErrFunc) {
 	sr := make(chan *proto.QueryResult, 10)
-	c := conn.rpcConn.StreamGo("VTGate.StreamExecute", req, sr)
+	c := conn.rpcConn.StreamGo(method, req, sr)
 	srout := make(chan *mproto.QueryResult, 1)
+	var cancelErr error
 	go func() {
 		defer close(srout)
-		for r := range sr {
-			srout <- r.Result
+		for {
+			select {
+			case r, ok := <-sr:
+				if !ok {
+					return
+				}
+				// the last packet may only carry the session
+				if r.Result == nil {
+					continue
+				}
+				select {
+				case srout <- r.Result:
+					continue
+				case <-ctx.Done():
+				}
+			case <-ctx.Done():
+			}
+			cancelErr = ctx.Err()
+			go func() {
+				for range sr {
+				}
+			}()
+			return
 		}
 	}()
-	return srout, func() error { return c.Error }
+	return srout, func() error {
+		if cancelErr != nil {
+			return vtgateError(cancelErr)
+		}
+		return vtgateError(c.Error)
+	}
 }
 
 func (conn *vtgateConn) Begin(ctx context.Context) (vtgateconn.VTGateTx, error) {
 	tx := &vtgateTx{conn: conn, session: &proto.Session{}}
-	if err := conn.rpcConn.Call(ctx, "VTGate.Begin", &rpc.Unused{}, tx.session); err != nil {
+	if err := conn.call(ctx, "VTGate.Begin", &rpc.Unused{}, tx.session); err != nil {
 		return nil, err
 	}
 	return tx, nil
 }
 
-func (conn *vtgateConn) SplitQuery(ctx context.Context, keyspace string, query tproto.BoundQuery, splitCount int) ([]proto.SplitQueryPart, error) {
+func (conn *vtgateConn) SplitQuery(ctx context.Context, keyspace string, query tproto.BoundQuery, splitColumn string, splitCount int) ([]proto.SplitQueryPart, error) {
 	request := &proto.SplitQueryRequest{
-		Keyspace:   keyspace,
-		Query:      query,
-		SplitCount: splitCount,
+		Keyspace:    keyspace,
+		Query:       query,
+		SplitColumn: splitColumn,
+		SplitCount:  splitCount,
 	}
 	result := &proto.SplitQueryResult{}
-	if err := conn.rpcConn.Call(ctx, "VTGate.SplitQuery", request, result); err != nil {
+	if err := conn.call(ctx, "VTGate.SplitQuery", request, result); err != nil {
 		return nil, err
 	}
 	return result.Splits, nil
 }
 
+func (conn *vtgateConn) GetKeyspaceIdResolver(ctx context.Context, keyspace string) (*vtgateconn.KeyspaceIdResolver, error) {
+	request := &proto.GetKeyspaceIdResolverRequest{
+		Keyspace: keyspace,
+	}
+	result := &proto.GetKeyspaceIdResolverResult{}
+	if err := conn.call(ctx, "VTGate.GetKeyspaceIdResolver", request, result); err != nil {
+		return nil, err
+	}
+	return &vtgateconn.KeyspaceIdResolver{
+		Keyspace:           keyspace,
+		ShardingColumnName: result.ShardingColumnName,
+		ShardingColumnType: result.ShardingColumnType,
+	}, nil
+}
+
+func (conn *vtgateConn) Explain(ctx context.Context, query string, bindVars map[string]interface{}, tabletType topo.TabletType) (*proto.ExplainResult, error) {
+	request := &proto.Query{
+		Sql:           query,
+		BindVariables: bindVars,
+		TabletType:    tabletType,
+		Timeout:       ctxTimeout(ctx),
+		CallerID:      vtgateconn.CallerID(ctx),
+	}
+	result := &proto.ExplainResult{}
+	if err := conn.call(ctx, "VTGate.Explain", request, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (conn *vtgateConn) GetSrvKeyspace(ctx context.Context, cell, keyspace string) (*topo.SrvKeyspace, error) {
+	request := &proto.GetSrvKeyspaceRequest{
+		Cell:     cell,
+		Keyspace: keyspace,
+	}
+	result := &topo.SrvKeyspace{}
+	if err := conn.call(ctx, "VTGate.GetSrvKeyspace", request, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
 func (conn *vtgateConn) Close() {
 	conn.rpcConn.Close()
 }
@@ -154,12 +496,48 @@ func (tx *vtgateTx) ExecuteShard(ctx context.Context, query string, keyspace str
 	return r, err
 }
 
+func (tx *vtgateTx) ExecuteKeyRanges(ctx context.Context, query string, keyspace string, keyRanges []key.KeyRange, bindVars map[string]interface{}, tabletType topo.TabletType) (*mproto.QueryResult, error) {
+	if tx.session == nil {
+		return nil, errors.New("executeKeyRanges: not in transaction")
+	}
+	r, session, err := tx.conn.executeKeyRanges(ctx, query, keyspace, keyRanges, bindVars, tabletType, tx.session)
+	tx.session = session
+	return r, err
+}
+
+func (tx *vtgateTx) ExecuteEntityIds(ctx context.Context, query string, keyspace string, entityColumnName string, entityKeyspaceIDs []proto.EntityId, bindVars map[string]interface{}, tabletType topo.TabletType) (*mproto.QueryResult, error) {
+	if tx.session == nil {
+		return nil, errors.New("executeEntityIds: not in transaction")
+	}
+	r, session, err := tx.conn.executeEntityIds(ctx, query, keyspace, entityColumnName, entityKeyspaceIDs, bindVars, tabletType, tx.session)
+	tx.session = session
+	return r, err
+}
+
+func (tx *vtgateTx) ExecuteBatchShard(ctx context.Context, queries []proto.BoundShardQuery, tabletType topo.TabletType) ([]mproto.QueryResult, error) {
+	if tx.session == nil {
+		return nil, errors.New("executeBatchShard: not in transaction")
+	}
+	qrs, session, err := tx.conn.executeBatchShard(ctx, queries, tabletType, tx.session)
+	tx.session = session
+	return qrs, err
+}
+
+func (tx *vtgateTx) ExecuteBatchKeyspaceIds(ctx context.Context, queries []proto.BoundKeyspaceIdQuery, tabletType topo.TabletType) ([]mproto.QueryResult, error) {
+	if tx.session == nil {
+		return nil, errors.New("executeBatchKeyspaceIds: not in transaction")
+	}
+	qrs, session, err := tx.conn.executeBatchKeyspaceIds(ctx, queries, tabletType, tx.session)
+	tx.session = session
+	return qrs, err
+}
+
 func (tx *vtgateTx) Commit(ctx context.Context) error {
 	if tx.session == nil {
 		return errors.New("commit: not in transaction")
 	}
 	defer func() { tx.session = nil }()
-	return tx.conn.rpcConn.Call(ctx, "VTGate.Commit", tx.session, &rpc.Unused{})
+	return tx.conn.call(ctx, "VTGate.Commit", tx.session, &rpc.Unused{})
 }
 
 func (tx *vtgateTx) Rollback(ctx context.Context) error {
@@ -167,5 +545,5 @@ func (tx *vtgateTx) Rollback(ctx context.Context) error {
 		return nil
 	}
 	defer func() { tx.session = nil }()
-	return tx.conn.rpcConn.Call(ctx, "VTGate.Rollback", tx.session, &rpc.Unused{})
+	return tx.conn.call(ctx, "VTGate.Rollback", tx.session, &rpc.Unused{})
 }
@@ -5,13 +5,18 @@
 package gorpcvtgateconn
 
 import (
+	"crypto/tls"
+	"io/ioutil"
 	"net"
 	"net/http"
+	"os"
 	"testing"
 	"time"
 
 	"github.com/youtube/vitess/go/rpcplus"
+	"github.com/youtube/vitess/go/rpcwrap"
 	"github.com/youtube/vitess/go/rpcwrap/bsonrpc"
+	"github.com/youtube/vitess/go/rpcwrap/tlstest"
 	"github.com/youtube/vitess/go/vt/vtgate/gorpcvtgateservice"
 	"github.com/youtube/vitess/go/vt/vtgate/vtgateconntest"
 	"golang.org/x/net/context"
@@ -53,3 +58,45 @@ func TestGoRPCVTGateConn(t *testing.T) {
 	// and clean up
 	client.Close()
 }
+
+// This test makes sure the go rpc service works over TLS
+func TestGoRPCVTGateConnTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gorpcvtgateconn_test")
+	if err != nil {
+		t.Fatalf("TempDir failed: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	tlstest.CreateCA(t, dir, "ca")
+	tlstest.CreateSignedCert(t, dir, "ca", "vtgate", "vtgate", "localhost")
+	serverConfig, err := rpcwrap.ServerTLSConfig(tlstest.CertFile(dir, "vtgate"), tlstest.KeyFile(dir, "vtgate"), "")
+	if err != nil {
+		t.Fatalf("ServerTLSConfig failed: %v", err)
+	}
+	clientConfig, err := rpcwrap.ClientTLSConfig("", "", tlstest.CertFile(dir, "ca"))
+	if err != nil {
+		t.Fatalf("ClientTLSConfig failed: %v", err)
+	}
+
+	// fake service, on a random port with TLS
+	service := vtgateconntest.CreateFakeServer(t)
+	listener, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("Cannot listen: %v", err)
+	}
+	server := rpcplus.NewServer()
+	server.Register(gorpcvtgateservice.New(service))
+	handler := http.NewServeMux()
+	bsonrpc.ServeCustomRPC(handler, server, false)
+	httpServer := http.Server{
+		Handler: handler,
+	}
+	go httpServer.Serve(tls.NewListener(listener, serverConfig))
+
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+	client, err := DialTLS(net.JoinHostPort("localhost", port), 30*time.Second, clientConfig)
+	if err != nil {
+		t.Fatalf("DialTLS failed: %v", err)
+	}
+	vtgateconntest.TestSuite(t, client, service)
+	client.Close()
+}
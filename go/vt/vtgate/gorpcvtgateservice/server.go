@@ -9,8 +9,10 @@ import (
 	"flag"
 	"time"
 
+	rpcproto "github.com/youtube/vitess/go/rpcwrap/proto"
 	"github.com/youtube/vitess/go/vt/rpc"
 	"github.com/youtube/vitess/go/vt/servenv"
+	"github.com/youtube/vitess/go/vt/topo"
 	"github.com/youtube/vitess/go/vt/vtgate"
 	"github.com/youtube/vitess/go/vt/vtgate/proto"
 	"github.com/youtube/vitess/go/vt/vtgate/vtgateservice"
@@ -18,9 +20,27 @@ import (
 )
 
 var (
-	rpcTimeout = flag.Duration("bsonrpc_timeout", 20*time.Second, "rpc timeout")
+	rpcTimeout = flag.Duration("bsonrpc_timeout", 20*time.Second, "rpc timeout, and maximum timeout a caller can ask for on a non-streaming call")
 )
 
+// withTimeout returns the context of a call. Its deadline is the
+// timeout sent by the caller, capped by -bsonrpc_timeout.
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 || timeout > *rpcTimeout {
+		timeout = *rpcTimeout
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// setCallerID makes the username of an authenticated connection, by
+// a client certificate or SASL, the CallerID of its queries: the
+// caller can't pick another one for the query rules.
+func setCallerID(ctx context.Context, query *proto.Query) {
+	if username, ok := rpcproto.Username(ctx); ok && username != "" {
+		query.CallerID = username
+	}
+}
+
 // VTGate is the public structure that is exported via BSON RPC
 type VTGate struct {
 	server vtgateservice.VTGateService
@@ -29,7 +49,8 @@ type VTGate struct {
 // Execute is the RPC version of vtgateservice.VTGateService method
 func (vtg *VTGate) Execute(ctx context.Context, query *proto.Query, reply *proto.QueryResult) (err error) {
 	defer vtg.server.HandlePanic(&err)
-	ctx, cancel := context.WithDeadline(ctx, time.Now().Add(*rpcTimeout))
+	setCallerID(ctx, query)
+	ctx, cancel := withTimeout(ctx, query.Timeout)
 	defer cancel()
 	return vtg.server.Execute(ctx, query, reply)
 }
@@ -37,7 +58,7 @@ func (vtg *VTGate) Execute(ctx context.Context, query *proto.Query, reply *proto
 // ExecuteShard is the RPC version of vtgateservice.VTGateService method
 func (vtg *VTGate) ExecuteShard(ctx context.Context, query *proto.QueryShard, reply *proto.QueryResult) (err error) {
 	defer vtg.server.HandlePanic(&err)
-	ctx, cancel := context.WithDeadline(ctx, time.Now().Add(*rpcTimeout))
+	ctx, cancel := withTimeout(ctx, query.Timeout)
 	defer cancel()
 	return vtg.server.ExecuteShard(ctx, query, reply)
 }
@@ -45,7 +66,7 @@ func (vtg *VTGate) ExecuteShard(ctx context.Context, query *proto.QueryShard, re
 // ExecuteKeyspaceIds is the RPC version of vtgateservice.VTGateService method
 func (vtg *VTGate) ExecuteKeyspaceIds(ctx context.Context, query *proto.KeyspaceIdQuery, reply *proto.QueryResult) (err error) {
 	defer vtg.server.HandlePanic(&err)
-	ctx, cancel := context.WithDeadline(ctx, time.Now().Add(*rpcTimeout))
+	ctx, cancel := withTimeout(ctx, query.Timeout)
 	defer cancel()
 	return vtg.server.ExecuteKeyspaceIds(ctx, query, reply)
 }
@@ -53,7 +74,7 @@ func (vtg *VTGate) ExecuteKeyspaceIds(ctx context.Context, query *proto.Keyspace
 // ExecuteKeyRanges is the RPC version of vtgateservice.VTGateService method
 func (vtg *VTGate) ExecuteKeyRanges(ctx context.Context, query *proto.KeyRangeQuery, reply *proto.QueryResult) (err error) {
 	defer vtg.server.HandlePanic(&err)
-	ctx, cancel := context.WithDeadline(ctx, time.Now().Add(*rpcTimeout))
+	ctx, cancel := withTimeout(ctx, query.Timeout)
 	defer cancel()
 	return vtg.server.ExecuteKeyRanges(ctx, query, reply)
 }
@@ -61,7 +82,7 @@ func (vtg *VTGate) ExecuteKeyRanges(ctx context.Context, query *proto.KeyRangeQu
 // ExecuteEntityIds is the RPC version of vtgateservice.VTGateService method
 func (vtg *VTGate) ExecuteEntityIds(ctx context.Context, query *proto.EntityIdsQuery, reply *proto.QueryResult) (err error) {
 	defer vtg.server.HandlePanic(&err)
-	ctx, cancel := context.WithDeadline(ctx, time.Now().Add(*rpcTimeout))
+	ctx, cancel := withTimeout(ctx, query.Timeout)
 	defer cancel()
 	return vtg.server.ExecuteEntityIds(ctx, query, reply)
 }
@@ -69,7 +90,7 @@ func (vtg *VTGate) ExecuteEntityIds(ctx context.Context, query *proto.EntityIdsQ
 // ExecuteBatchShard is the RPC version of vtgateservice.VTGateService method
 func (vtg *VTGate) ExecuteBatchShard(ctx context.Context, batchQuery *proto.BatchQueryShard, reply *proto.QueryResultList) (err error) {
 	defer vtg.server.HandlePanic(&err)
-	ctx, cancel := context.WithDeadline(ctx, time.Now().Add(*rpcTimeout))
+	ctx, cancel := withTimeout(ctx, batchQuery.Timeout)
 	defer cancel()
 	return vtg.server.ExecuteBatchShard(ctx, batchQuery, reply)
 }
@@ -78,7 +99,7 @@ func (vtg *VTGate) ExecuteBatchShard(ctx context.Context, batchQuery *proto.Batc
 // vtgateservice.VTGateService method
 func (vtg *VTGate) ExecuteBatchKeyspaceIds(ctx context.Context, batchQuery *proto.KeyspaceIdBatchQuery, reply *proto.QueryResultList) (err error) {
 	defer vtg.server.HandlePanic(&err)
-	ctx, cancel := context.WithDeadline(ctx, time.Now().Add(*rpcTimeout))
+	ctx, cancel := withTimeout(ctx, batchQuery.Timeout)
 	defer cancel()
 	return vtg.server.ExecuteBatchKeyspaceIds(ctx, batchQuery, reply)
 }
@@ -86,6 +107,12 @@ func (vtg *VTGate) ExecuteBatchKeyspaceIds(ctx context.Context, batchQuery *prot
 // StreamExecute is the RPC version of vtgateservice.VTGateService method
 func (vtg *VTGate) StreamExecute(ctx context.Context, query *proto.Query, sendReply func(interface{}) error) (err error) {
 	defer vtg.server.HandlePanic(&err)
+	setCallerID(ctx, query)
+	if query.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, query.Timeout)
+		defer cancel()
+	}
 	return vtg.server.StreamExecute(ctx, query, func(value *proto.QueryResult) error {
 		return sendReply(value)
 	})
@@ -94,6 +121,11 @@ func (vtg *VTGate) StreamExecute(ctx context.Context, query *proto.Query, sendRe
 // StreamExecuteShard is the RPC version of vtgateservice.VTGateService method
 func (vtg *VTGate) StreamExecuteShard(ctx context.Context, query *proto.QueryShard, sendReply func(interface{}) error) (err error) {
 	defer vtg.server.HandlePanic(&err)
+	if query.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, query.Timeout)
+		defer cancel()
+	}
 	return vtg.server.StreamExecuteShard(ctx, query, func(value *proto.QueryResult) error {
 		return sendReply(value)
 	})
@@ -103,6 +135,11 @@ func (vtg *VTGate) StreamExecuteShard(ctx context.Context, query *proto.QuerySha
 // vtgateservice.VTGateService method
 func (vtg *VTGate) StreamExecuteKeyRanges(ctx context.Context, query *proto.KeyRangeQuery, sendReply func(interface{}) error) (err error) {
 	defer vtg.server.HandlePanic(&err)
+	if query.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, query.Timeout)
+		defer cancel()
+	}
 	return vtg.server.StreamExecuteKeyRanges(ctx, query, func(value *proto.QueryResult) error {
 		return sendReply(value)
 	})
@@ -112,6 +149,11 @@ func (vtg *VTGate) StreamExecuteKeyRanges(ctx context.Context, query *proto.KeyR
 // vtgateservice.VTGateService method
 func (vtg *VTGate) StreamExecuteKeyspaceIds(ctx context.Context, query *proto.KeyspaceIdQuery, sendReply func(interface{}) error) (err error) {
 	defer vtg.server.HandlePanic(&err)
+	if query.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, query.Timeout)
+		defer cancel()
+	}
 	return vtg.server.StreamExecuteKeyspaceIds(ctx, query, func(value *proto.QueryResult) error {
 		return sendReply(value)
 	})
@@ -149,6 +191,30 @@ func (vtg *VTGate) SplitQuery(ctx context.Context, req *proto.SplitQueryRequest,
 	return vtg.server.SplitQuery(ctx, req, reply)
 }
 
+// GetKeyspaceIdResolver is the RPC version of vtgateservice.VTGateService method
+func (vtg *VTGate) GetKeyspaceIdResolver(ctx context.Context, req *proto.GetKeyspaceIdResolverRequest, reply *proto.GetKeyspaceIdResolverResult) (err error) {
+	defer vtg.server.HandlePanic(&err)
+	ctx, cancel := context.WithDeadline(ctx, time.Now().Add(*rpcTimeout))
+	defer cancel()
+	return vtg.server.GetKeyspaceIdResolver(ctx, req, reply)
+}
+
+// GetSrvKeyspace is the RPC version of vtgateservice.VTGateService method
+func (vtg *VTGate) GetSrvKeyspace(ctx context.Context, req *proto.GetSrvKeyspaceRequest, reply *topo.SrvKeyspace) (err error) {
+	defer vtg.server.HandlePanic(&err)
+	ctx, cancel := context.WithDeadline(ctx, time.Now().Add(*rpcTimeout))
+	defer cancel()
+	return vtg.server.GetSrvKeyspace(ctx, req, reply)
+}
+
+// Explain is the RPC version of vtgateservice.VTGateService method
+func (vtg *VTGate) Explain(ctx context.Context, query *proto.Query, reply *proto.ExplainResult) (err error) {
+	defer vtg.server.HandlePanic(&err)
+	ctx, cancel := withTimeout(ctx, query.Timeout)
+	defer cancel()
+	return vtg.server.Explain(ctx, query, reply)
+}
+
 // New returns a new VTGate service
 func New(vtGate vtgateservice.VTGateService) *VTGate {
 	return &VTGate{vtGate}
@@ -0,0 +1,31 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gorpcvtgateservice
+
+import (
+	"testing"
+
+	rpcproto "github.com/youtube/vitess/go/rpcwrap/proto"
+	"github.com/youtube/vitess/go/vt/vtgate/proto"
+	"golang.org/x/net/context"
+)
+
+func TestSetCallerID(t *testing.T) {
+	// the caller picks its CallerID on connections without a username
+	query := &proto.Query{CallerID: "app"}
+	setCallerID(context.Background(), query)
+	ctx := rpcproto.NewContext("127.0.0.1:1234")
+	setCallerID(ctx, query)
+	if query.CallerID != "app" {
+		t.Errorf("CallerID = %v, want app", query.CallerID)
+	}
+
+	// not on the authenticated ones
+	rpcproto.SetUsername(ctx, "client1")
+	setCallerID(ctx, query)
+	if query.CallerID != "client1" {
+		t.Errorf("CallerID = %v, want client1", query.CallerID)
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vtgate
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/youtube/vitess/go/vt/topo"
+	"golang.org/x/net/context"
+)
+
+// This file contains the /healthz readiness check of vtgate, for the
+// load balancers in front of a vtgate pool.
+
+var (
+	healthzKeyspaces = flag.String("healthz_keyspaces", "", "comma separated list of keyspaces that must be served for /healthz to report vtgate as ready: each shard of their master partition needs a master end point")
+	healthzTimeout   = flag.Duration("healthz_timeout", 5*time.Second, "timeout of the topology lookups of a /healthz check")
+)
+
+// healthStatus is the result of a readiness check. It is sent as the
+// JSON body of /healthz.
+type healthStatus struct {
+	Ready bool
+	// TopoError is set if the keyspace names cannot be read.
+	TopoError string `json:",omitempty"`
+	// MissingKeyspaces are the required keyspaces that are not in the
+	// serving graph, or whose master partition cannot be read.
+	MissingKeyspaces []string `json:",omitempty"`
+	// ShardsWithoutMaster are the keyspace/shard of the required
+	// keyspaces that have no master end point.
+	ShardsWithoutMaster []string `json:",omitempty"`
+}
+
+// healthChecker checks that vtgate can serve the required keyspaces.
+type healthChecker struct {
+	serv      SrvTopoServer
+	cell      string
+	keyspaces []string
+	timeout   time.Duration
+}
+
+func newHealthChecker(serv SrvTopoServer, cell, keyspaces string, timeout time.Duration) *healthChecker {
+	hc := &healthChecker{
+		serv:    serv,
+		cell:    cell,
+		timeout: timeout,
+	}
+	for _, keyspace := range strings.Split(keyspaces, ",") {
+		if keyspace = strings.TrimSpace(keyspace); keyspace != "" {
+			hc.keyspaces = append(hc.keyspaces, keyspace)
+		}
+	}
+	return hc
+}
+
+// check returns the readiness of vtgate. The topology has to be
+// reachable, and the required keyspaces served with a master end
+// point for each shard.
+func (hc *healthChecker) check(ctx context.Context) *healthStatus {
+	status := &healthStatus{}
+	names, err := hc.serv.GetSrvKeyspaceNames(ctx, hc.cell)
+	if err != nil {
+		status.TopoError = err.Error()
+		return status
+	}
+	served := make(map[string]bool, len(names))
+	for _, name := range names {
+		served[name] = true
+	}
+	for _, keyspace := range hc.keyspaces {
+		if !served[keyspace] {
+			status.MissingKeyspaces = append(status.MissingKeyspaces, keyspace)
+			continue
+		}
+		ks, shards, err := getKeyspaceShards(ctx, hc.serv, hc.cell, keyspace, topo.TYPE_MASTER)
+		if err != nil {
+			status.MissingKeyspaces = append(status.MissingKeyspaces, keyspace)
+			continue
+		}
+		for _, shard := range shards {
+			endPoints, err := hc.serv.GetEndPoints(ctx, hc.cell, ks, shard.Name, topo.TYPE_MASTER)
+			if err != nil || len(endPoints.Entries) == 0 {
+				status.ShardsWithoutMaster = append(status.ShardsWithoutMaster, ks+"/"+shard.Name)
+			}
+		}
+	}
+	status.Ready = len(status.MissingKeyspaces) == 0 && len(status.ShardsWithoutMaster) == 0
+	return status
+}
+
+// ServeHTTP answers 200 if vtgate is ready, and 503 otherwise. The
+// body tells what is missing. It needs no ACL, so load balancers can
+// poll it.
+func (hc *healthChecker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(context.Background(), hc.timeout)
+	defer cancel()
+	status := hc.check(ctx)
+	b, err := json.Marshal(status)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("cannot marshal health status: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if !status.Ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	w.Write(b)
+	w.Write([]byte("\n"))
+}
@@ -0,0 +1,93 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vtgate
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// failingNamesTopo is a sandboxTopo that cannot list the keyspaces.
+type failingNamesTopo struct {
+	sandboxTopo
+}
+
+func (ft *failingNamesTopo) GetSrvKeyspaceNames(ctx context.Context, cell string) ([]string, error) {
+	return nil, fmt.Errorf("topo error GetSrvKeyspaceNames")
+}
+
+func TestHealthCheck(t *testing.T) {
+	createSandbox(KsTestUnsharded).MapTestConn("0", &sandboxConn{})
+	s := createSandbox("TestHealthCheck")
+	s.MapTestConn("-20", &sandboxConn{})
+	s.MapTestConn("20-40", &sandboxConn{})
+	s.MapTestConn("40-60", &sandboxConn{})
+	s.MapTestConn("60-80", &sandboxConn{})
+	s.MapTestConn("80-a0", &sandboxConn{})
+	s.MapTestConn("a0-c0", &sandboxConn{})
+	s.MapTestConn("c0-e0", &sandboxConn{})
+
+	testCases := []struct {
+		keyspaces string
+		want      healthStatus
+	}{{
+		keyspaces: "",
+		want:      healthStatus{Ready: true},
+	}, {
+		keyspaces: KsTestUnsharded,
+		want:      healthStatus{Ready: true},
+	}, {
+		keyspaces: KsTestUnsharded + ", TestHealthCheck,unknown",
+		want: healthStatus{
+			MissingKeyspaces:    []string{"unknown"},
+			ShardsWithoutMaster: []string{"TestHealthCheck/e0-"},
+		},
+	}}
+	for _, tcase := range testCases {
+		hc := newHealthChecker(new(sandboxTopo), "aa", tcase.keyspaces, time.Second)
+		if got := hc.check(context.Background()); !reflect.DeepEqual(*got, tcase.want) {
+			t.Errorf("check(%q): %+v, want %+v", tcase.keyspaces, *got, tcase.want)
+		}
+	}
+
+	hc := newHealthChecker(&failingNamesTopo{}, "aa", KsTestUnsharded, time.Second)
+	want := healthStatus{TopoError: "topo error GetSrvKeyspaceNames"}
+	if got := hc.check(context.Background()); !reflect.DeepEqual(*got, want) {
+		t.Errorf("check with topo error: %+v, want %+v", *got, want)
+	}
+}
+
+func TestHealthCheckHTTP(t *testing.T) {
+	createSandbox(KsTestUnsharded).MapTestConn("0", &sandboxConn{})
+	createSandbox("TestHealthCheckHTTP")
+
+	hc := newHealthChecker(new(sandboxTopo), "aa", KsTestUnsharded, time.Second)
+	w := httptest.NewRecorder()
+	hc.ServeHTTP(w, &http.Request{Method: "GET", URL: &url.URL{Path: "/healthz"}})
+	if w.Code != http.StatusOK {
+		t.Errorf("ready code: %v, want %v", w.Code, http.StatusOK)
+	}
+	if got, want := w.Body.String(), "{\"Ready\":true}\n"; got != want {
+		t.Errorf("ready body: %q, want %q", got, want)
+	}
+
+	hc = newHealthChecker(new(sandboxTopo), "aa", "TestHealthCheckHTTP", time.Second)
+	w = httptest.NewRecorder()
+	hc.ServeHTTP(w, &http.Request{Method: "GET", URL: &url.URL{Path: "/healthz"}})
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("not ready code: %v, want %v", w.Code, http.StatusServiceUnavailable)
+	}
+	want := `{"Ready":false,"ShardsWithoutMaster":["TestHealthCheckHTTP/-20","TestHealthCheckHTTP/20-40","TestHealthCheckHTTP/40-60","TestHealthCheckHTTP/60-80","TestHealthCheckHTTP/80-a0","TestHealthCheckHTTP/a0-c0","TestHealthCheckHTTP/c0-e0","TestHealthCheckHTTP/e0-"]}` + "\n"
+	if got := w.Body.String(); got != want {
+		t.Errorf("not ready body: %q, want %q", got, want)
+	}
+}
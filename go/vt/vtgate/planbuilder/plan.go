@@ -66,6 +66,10 @@ type Plan struct {
 	// Values is a single or a list of values that are used
 	// for making routing decisions.
 	Values interface{}
+	// Aggregates is set for multi-shard selects that only have
+	// aggregate columns. It contains the function of each column,
+	// so the per-shard rows can be combined into one.
+	Aggregates []string
 }
 
 // Size is defined so that Plan can be given to an LRUCache.
@@ -84,25 +88,27 @@ func (pln *Plan) MarshalJSON() ([]byte, error) {
 		col = pln.ColVindex.Col
 	}
 	marshalPlan := struct {
-		ID        PlanID
-		Reason    string
-		Table     string
-		Original  string
-		Rewritten string
-		Subquery  string
-		Vindex    string
-		Col       string
-		Values    interface{}
+		ID         PlanID
+		Reason     string
+		Table      string
+		Original   string
+		Rewritten  string
+		Subquery   string
+		Vindex     string
+		Col        string
+		Values     interface{}
+		Aggregates []string `json:",omitempty"`
 	}{
-		ID:        pln.ID,
-		Reason:    pln.Reason,
-		Table:     tname,
-		Original:  pln.Original,
-		Rewritten: pln.Rewritten,
-		Subquery:  pln.Subquery,
-		Vindex:    vindexName,
-		Col:       col,
-		Values:    pln.Values,
+		ID:         pln.ID,
+		Reason:     pln.Reason,
+		Table:      tname,
+		Original:   pln.Original,
+		Rewritten:  pln.Rewritten,
+		Subquery:   pln.Subquery,
+		Vindex:     vindexName,
+		Col:        col,
+		Values:     pln.Values,
+		Aggregates: pln.Aggregates,
 	}
 	return json.Marshal(marshalPlan)
 }
@@ -4,7 +4,20 @@
 
 package planbuilder
 
-import "github.com/youtube/vitess/go/vt/sqlparser"
+import (
+	"fmt"
+
+	"github.com/youtube/vitess/go/vt/sqlparser"
+)
+
+// combinableAggregates are the aggregate functions whose per-shard
+// results vtgate can combine.
+var combinableAggregates = map[string]bool{
+	"count": true,
+	"sum":   true,
+	"min":   true,
+	"max":   true,
+}
 
 func buildSelectPlan(sel *sqlparser.Select, schema *Schema) *Plan {
 	plan := &Plan{ID: NoPlan}
@@ -21,9 +34,11 @@ func buildSelectPlan(sel *sqlparser.Select, schema *Schema) *Plan {
 	getWhereRouting(sel.Where, plan, false)
 	if plan.IsMulti() {
 		if hasPostProcessing(sel) {
-			plan.ID = NoPlan
-			plan.Reason = "multi-shard query has post-processing constructs"
-			return plan
+			plan.Aggregates, plan.Reason = getAggregates(sel)
+			if plan.Reason != "" {
+				plan.ID = NoPlan
+				return plan
+			}
 		}
 	}
 	// The where clause might have changed.
@@ -111,6 +126,35 @@ func exprHasAggregates(node sqlparser.Expr) bool {
 	}
 }
 
+// getAggregates returns the aggregate function of each column of a
+// multi-shard select, if its only post-processing is aggregates that
+// can be combined. Otherwise, it returns the reason why the query
+// cannot be sent to multiple shards.
+func getAggregates(sel *sqlparser.Select) (aggregates []string, reason string) {
+	if sel.Distinct != "" || sel.GroupBy != nil || sel.Having != nil || sel.OrderBy != nil || sel.Limit != nil {
+		return nil, "multi-shard query has post-processing constructs"
+	}
+	for _, node := range sel.SelectExprs {
+		expr, ok := node.(*sqlparser.NonStarExpr)
+		if !ok {
+			return nil, "multi-shard query mixes aggregates with other columns"
+		}
+		fn, ok := expr.Expr.(*sqlparser.FuncExpr)
+		if !ok || !fn.IsAggregate() {
+			if exprHasAggregates(expr.Expr) {
+				return nil, fmt.Sprintf("multi-shard query has an aggregate that cannot be combined: %s", sqlparser.String(expr.Expr))
+			}
+			return nil, "multi-shard query mixes aggregates with other columns"
+		}
+		name := string(fn.Name)
+		if !combinableAggregates[name] || fn.Distinct {
+			return nil, fmt.Sprintf("multi-shard query has an aggregate that cannot be combined: %s", sqlparser.String(expr.Expr))
+		}
+		aggregates = append(aggregates, name)
+	}
+	return aggregates, ""
+}
+
 func hasPostProcessing(sel *sqlparser.Select) bool {
 	return hasAggregates(sel.SelectExprs) || sel.Distinct != "" || sel.GroupBy != nil || sel.Having != nil || sel.OrderBy != nil || sel.Limit != nil
 }
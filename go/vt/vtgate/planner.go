@@ -9,19 +9,83 @@ package vtgate
 import (
 	"bytes"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/youtube/vitess/go/acl"
 	"github.com/youtube/vitess/go/cache"
+	"github.com/youtube/vitess/go/sync2"
 	"github.com/youtube/vitess/go/vt/vtgate/planbuilder"
 )
 
+var planCacheSize = flag.Int("plan_cache_size", 5000, "number of query plans cached by vtgate. The least recently used plans are evicted first")
+
 var noPlan = &planbuilder.Plan{
 	ID:     planbuilder.NoPlan,
 	Reason: "planbuiler not initialized",
 }
 
+// cachedPlan is a plan in the cache of a Planner, along with the
+// stats of its executions.
+type cachedPlan struct {
+	plan  *planbuilder.Plan
+	stats planStats
+}
+
+// Size is defined so that cachedPlan can be given to an LRUCache.
+func (cp *cachedPlan) Size() int {
+	return 1
+}
+
+// planStats are the execution stats of a plan. They are updated on
+// every query, so they only use atomic operations.
+type planStats struct {
+	queryCount   sync2.AtomicInt64
+	shardQueries sync2.AtomicInt64
+	maxShards    sync2.AtomicInt64
+	rowCount     sync2.AtomicInt64
+	errorCount   sync2.AtomicInt64
+	time         sync2.AtomicDuration
+}
+
+// add records an execution that was sent to shards shards.
+func (ps *planStats) add(shards int, duration time.Duration, rows int64, err error) {
+	ps.queryCount.Add(1)
+	ps.shardQueries.Add(int64(shards))
+	for {
+		max := ps.maxShards.Get()
+		if int64(shards) <= max || ps.maxShards.CompareAndSwap(max, int64(shards)) {
+			break
+		}
+	}
+	ps.rowCount.Add(rows)
+	if err != nil {
+		ps.errorCount.Add(1)
+	}
+	ps.time.Add(duration)
+}
+
+// MarshalJSON serializes the stats for /debug/query_plans.
+func (ps *planStats) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		QueryCount   int64
+		ShardQueries int64
+		MaxShards    int64
+		RowCount     int64
+		ErrorCount   int64
+		Time         string
+	}{
+		QueryCount:   ps.queryCount.Get(),
+		ShardQueries: ps.shardQueries.Get(),
+		MaxShards:    ps.maxShards.Get(),
+		RowCount:     ps.rowCount.Get(),
+		ErrorCount:   ps.errorCount.Get(),
+		Time:         ps.time.Get().String(),
+	})
+}
+
 type Planner struct {
 	schema *planbuilder.Schema
 	plans  *cache.LRUCache
@@ -32,22 +96,27 @@ func NewPlanner(schema *planbuilder.Schema, cacheSize int) *Planner {
 		schema: schema,
 		plans:  cache.NewLRUCache(int64(cacheSize)),
 	}
-	// TODO(sougou): Uncomment after making Planner testable.
-	//http.Handle("/debug/query_plans", plr)
-	//http.Handle("/debug/schema", plr)
 	return plr
 }
 
 func (plr *Planner) GetPlan(sql string) *planbuilder.Plan {
+	return plr.getPlan(sql).plan
+}
+
+// getPlan returns the cached plan of sql, and builds it if needed.
+func (plr *Planner) getPlan(sql string) *cachedPlan {
 	if plr.schema == nil {
-		return noPlan
+		return &cachedPlan{plan: noPlan}
+	}
+	if result, ok := plr.plans.Get(sql); ok {
+		return result.(*cachedPlan)
 	}
+	plr.plans.SetIfAbsent(sql, &cachedPlan{plan: planbuilder.BuildPlan(sql, plr.schema)})
+	// Get again, in case another query built the plan first.
 	if result, ok := plr.plans.Get(sql); ok {
-		return result.(*planbuilder.Plan)
+		return result.(*cachedPlan)
 	}
-	plan := planbuilder.BuildPlan(sql, plr.schema)
-	plr.plans.Set(sql, plan)
-	return plan
+	return &cachedPlan{plan: planbuilder.BuildPlan(sql, plr.schema)}
 }
 
 func (plr *Planner) ServeHTTP(response http.ResponseWriter, request *http.Request) {
@@ -56,19 +125,25 @@ func (plr *Planner) ServeHTTP(response http.ResponseWriter, request *http.Reques
 		return
 	}
 	if request.URL.Path == "/debug/query_plans" {
-		keys := plr.plans.Keys()
+		// Items does not change the order of the cache.
+		items := plr.plans.Items()
 		response.Header().Set("Content-Type", "text/plain")
-		response.Write([]byte(fmt.Sprintf("Length: %d\n", len(keys))))
-		for _, v := range keys {
-			response.Write([]byte(fmt.Sprintf("%#v\n", v)))
-			if plan, ok := plr.plans.Get(v); ok {
-				if b, err := json.MarshalIndent(plan, "", "  "); err != nil {
-					response.Write([]byte(err.Error()))
-				} else {
-					response.Write(b)
-				}
-				response.Write(([]byte)("\n\n"))
+		response.Write([]byte(fmt.Sprintf("Length: %d\n", len(items))))
+		for _, item := range items {
+			cp := item.Value.(*cachedPlan)
+			response.Write([]byte(fmt.Sprintf("%#v\n", item.Key)))
+			if b, err := json.MarshalIndent(cp.plan, "", "  "); err != nil {
+				response.Write([]byte(err.Error()))
+			} else {
+				response.Write(b)
+			}
+			response.Write([]byte("\n"))
+			if b, err := json.Marshal(&cp.stats); err != nil {
+				response.Write([]byte(err.Error()))
+			} else {
+				response.Write(b)
 			}
+			response.Write(([]byte)("\n\n"))
 		}
 	} else if request.URL.Path == "/debug/schema" {
 		response.Header().Set("Content-Type", "application/json; charset=utf-8")
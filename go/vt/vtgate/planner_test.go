@@ -0,0 +1,74 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vtgate
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPlanStats(t *testing.T) {
+	var ps planStats
+	ps.add(2, time.Second, 10, nil)
+	ps.add(8, time.Second, 0, errors.New("fail"))
+	ps.add(1, time.Second, 5, nil)
+	b, err := ps.MarshalJSON()
+	if err != nil {
+		t.Fatalf("MarshalJSON failed: %v", err)
+	}
+	want := `{"QueryCount":3,"ShardQueries":11,"MaxShards":8,"RowCount":15,"ErrorCount":1,"Time":"3s"}`
+	if got := string(b); got != want {
+		t.Errorf("MarshalJSON: %s, want %s", got, want)
+	}
+}
+
+func TestPlannerStats(t *testing.T) {
+	router, _, _, _ := createRouterEnv()
+
+	if _, err := routerExec(router, "select * from user where id in (1, 3)", nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := routerExec(router, "select * from user where id in (1, 3)", nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := routerExec(router, "update user set a = 2 where id = 1", nil); err != nil {
+		t.Fatal(err)
+	}
+	selectIN := router.planner.getPlan("select * from user where id in (1, 3)")
+	if got := selectIN.stats.queryCount.Get(); got != 2 {
+		t.Errorf("selectIN queryCount: %v, want 2", got)
+	}
+	if got := selectIN.stats.maxShards.Get(); got != 2 {
+		t.Errorf("selectIN maxShards: %v, want 2", got)
+	}
+	if got := selectIN.stats.shardQueries.Get(); got != 4 {
+		t.Errorf("selectIN shardQueries: %v, want 4", got)
+	}
+	update := router.planner.getPlan("update user set a = 2 where id = 1")
+	if got := update.stats.shardQueries.Get(); got != 1 {
+		t.Errorf("update shardQueries: %v, want 1", got)
+	}
+
+	w := httptest.NewRecorder()
+	router.planner.ServeHTTP(w, &http.Request{Method: "GET", URL: &url.URL{Path: "/debug/query_plans"}})
+	body := w.Body.String()
+	for _, want := range []string{
+		"Length: 2\n",
+		`"select * from user where id in (1, 3)"`,
+		`"ID": "SelectIN"`,
+		`"QueryCount":2,"ShardQueries":4,"MaxShards":2`,
+		`"update user set a = 2 where id = 1"`,
+		`"ID": "UpdateEqual"`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("/debug/query_plans: %q does not contain %q", body, want)
+		}
+	}
+}
@@ -9,6 +9,7 @@ package proto
 
 import (
 	"bytes"
+	"time"
 
 	"github.com/youtube/vitess/go/bson"
 	"github.com/youtube/vitess/go/bytes2"
@@ -47,6 +48,16 @@ func (batchQueryShard *BatchQueryShard) MarshalBson(buf *bytes2.ChunkedWriter, k
 		(*batchQueryShard.Session).MarshalBson(buf, "Session")
 	}
 	bson.EncodeBool(buf, "NotInTransaction", batchQueryShard.NotInTransaction)
+	bson.EncodeInt64(buf, "Timeout", int64(batchQueryShard.Timeout))
+	// []BoundShardQuery
+	{
+		bson.EncodePrefix(buf, bson.Array, "ShardQueries")
+		lenWriter := bson.NewLenWriter(buf)
+		for _i, _v3 := range batchQueryShard.ShardQueries {
+			_v3.MarshalBson(buf, bson.Itoa(_i))
+		}
+		lenWriter.Close()
+	}
 
 	lenWriter.Close()
 }
@@ -107,6 +118,23 @@ func (batchQueryShard *BatchQueryShard) UnmarshalBson(buf *bytes.Buffer, kind by
 			}
 		case "NotInTransaction":
 			batchQueryShard.NotInTransaction = bson.DecodeBool(buf, kind)
+		case "Timeout":
+			batchQueryShard.Timeout = time.Duration(bson.DecodeInt64(buf, kind))
+		case "ShardQueries":
+			// []BoundShardQuery
+			if kind != bson.Null {
+				if kind != bson.Array {
+					panic(bson.NewBsonError("unexpected kind %v for batchQueryShard.ShardQueries", kind))
+				}
+				bson.Next(buf, 4)
+				batchQueryShard.ShardQueries = make([]BoundShardQuery, 0, 8)
+				for kind := bson.NextByte(buf); kind != bson.EOO; kind = bson.NextByte(buf) {
+					bson.SkipIndex(buf)
+					var _v3 BoundShardQuery
+					_v3.UnmarshalBson(buf, kind)
+					batchQueryShard.ShardQueries = append(batchQueryShard.ShardQueries, _v3)
+				}
+			}
 		default:
 			bson.Skip(buf, kind)
 		}
@@ -0,0 +1,99 @@
+// Copyright 2012, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package proto
+
+// DO NOT EDIT.
+// FILE GENERATED BY BSONGEN.
+
+import (
+	"bytes"
+
+	"github.com/youtube/vitess/go/bson"
+	"github.com/youtube/vitess/go/bytes2"
+	"github.com/youtube/vitess/go/vt/key"
+)
+
+// MarshalBson bson-encodes BoundKeyspaceIdQuery.
+func (boundKeyspaceIdQuery *BoundKeyspaceIdQuery) MarshalBson(buf *bytes2.ChunkedWriter, key string) {
+	bson.EncodeOptionalPrefix(buf, bson.Object, key)
+	lenWriter := bson.NewLenWriter(buf)
+
+	bson.EncodeString(buf, "Sql", boundKeyspaceIdQuery.Sql)
+	// map[string]interface{}
+	{
+		bson.EncodePrefix(buf, bson.Object, "BindVariables")
+		lenWriter := bson.NewLenWriter(buf)
+		for _k, _v1 := range boundKeyspaceIdQuery.BindVariables {
+			bson.EncodeInterface(buf, _k, _v1)
+		}
+		lenWriter.Close()
+	}
+	bson.EncodeString(buf, "Keyspace", boundKeyspaceIdQuery.Keyspace)
+	// []key.KeyspaceId
+	{
+		bson.EncodePrefix(buf, bson.Array, "KeyspaceIds")
+		lenWriter := bson.NewLenWriter(buf)
+		for _i, _v2 := range boundKeyspaceIdQuery.KeyspaceIds {
+			_v2.MarshalBson(buf, bson.Itoa(_i))
+		}
+		lenWriter.Close()
+	}
+
+	lenWriter.Close()
+}
+
+// UnmarshalBson bson-decodes into BoundKeyspaceIdQuery.
+func (boundKeyspaceIdQuery *BoundKeyspaceIdQuery) UnmarshalBson(buf *bytes.Buffer, kind byte) {
+	switch kind {
+	case bson.EOO, bson.Object:
+		// valid
+	case bson.Null:
+		return
+	default:
+		panic(bson.NewBsonError("unexpected kind %v for BoundKeyspaceIdQuery", kind))
+	}
+	bson.Next(buf, 4)
+
+	for kind := bson.NextByte(buf); kind != bson.EOO; kind = bson.NextByte(buf) {
+		switch bson.ReadCString(buf) {
+		case "Sql":
+			boundKeyspaceIdQuery.Sql = bson.DecodeString(buf, kind)
+		case "BindVariables":
+			// map[string]interface{}
+			if kind != bson.Null {
+				if kind != bson.Object {
+					panic(bson.NewBsonError("unexpected kind %v for boundKeyspaceIdQuery.BindVariables", kind))
+				}
+				bson.Next(buf, 4)
+				boundKeyspaceIdQuery.BindVariables = make(map[string]interface{})
+				for kind := bson.NextByte(buf); kind != bson.EOO; kind = bson.NextByte(buf) {
+					_k := bson.ReadCString(buf)
+					var _v1 interface{}
+					_v1 = bson.DecodeInterface(buf, kind)
+					boundKeyspaceIdQuery.BindVariables[_k] = _v1
+				}
+			}
+		case "Keyspace":
+			boundKeyspaceIdQuery.Keyspace = bson.DecodeString(buf, kind)
+		case "KeyspaceIds":
+			// []key.KeyspaceId
+			if kind != bson.Null {
+				if kind != bson.Array {
+					panic(bson.NewBsonError("unexpected kind %v for boundKeyspaceIdQuery.KeyspaceIds", kind))
+				}
+				bson.Next(buf, 4)
+				boundKeyspaceIdQuery.KeyspaceIds = make([]key.KeyspaceId, 0, 8)
+				for kind := bson.NextByte(buf); kind != bson.EOO; kind = bson.NextByte(buf) {
+					bson.SkipIndex(buf)
+					var _v2 key.KeyspaceId
+					_v2.UnmarshalBson(buf, kind)
+					boundKeyspaceIdQuery.KeyspaceIds = append(boundKeyspaceIdQuery.KeyspaceIds, _v2)
+				}
+			}
+		default:
+			bson.Skip(buf, kind)
+		}
+	}
+}
@@ -9,6 +9,7 @@ package proto
 
 import (
 	"bytes"
+	"time"
 
 	"github.com/youtube/vitess/go/bson"
 	"github.com/youtube/vitess/go/bytes2"
@@ -48,6 +49,9 @@ func (entityIdsQuery *EntityIdsQuery) MarshalBson(buf *bytes2.ChunkedWriter, key
 		(*entityIdsQuery.Session).MarshalBson(buf, "Session")
 	}
 	bson.EncodeBool(buf, "NotInTransaction", entityIdsQuery.NotInTransaction)
+	bson.EncodeInt64(buf, "Timeout", int64(entityIdsQuery.Timeout))
+	bson.EncodeInt(buf, "RoutingPolicy", int(entityIdsQuery.RoutingPolicy))
+	bson.EncodeBool(buf, "AllowMasterFallback", entityIdsQuery.AllowMasterFallback)
 
 	lenWriter.Close()
 }
@@ -112,6 +116,12 @@ func (entityIdsQuery *EntityIdsQuery) UnmarshalBson(buf *bytes.Buffer, kind byte
 			}
 		case "NotInTransaction":
 			entityIdsQuery.NotInTransaction = bson.DecodeBool(buf, kind)
+		case "Timeout":
+			entityIdsQuery.Timeout = time.Duration(bson.DecodeInt64(buf, kind))
+		case "RoutingPolicy":
+			entityIdsQuery.RoutingPolicy = RoutingPolicy(bson.DecodeInt(buf, kind))
+		case "AllowMasterFallback":
+			entityIdsQuery.AllowMasterFallback = bson.DecodeBool(buf, kind)
 		default:
 			bson.Skip(buf, kind)
 		}
@@ -9,6 +9,7 @@ package proto
 
 import (
 	"bytes"
+	"time"
 
 	"github.com/youtube/vitess/go/bson"
 	"github.com/youtube/vitess/go/bytes2"
@@ -48,6 +49,10 @@ func (keyRangeQuery *KeyRangeQuery) MarshalBson(buf *bytes2.ChunkedWriter, key s
 		(*keyRangeQuery.Session).MarshalBson(buf, "Session")
 	}
 	bson.EncodeBool(buf, "NotInTransaction", keyRangeQuery.NotInTransaction)
+	bson.EncodeBool(buf, "OrderedMerge", keyRangeQuery.OrderedMerge)
+	bson.EncodeInt64(buf, "Timeout", int64(keyRangeQuery.Timeout))
+	bson.EncodeInt(buf, "RoutingPolicy", int(keyRangeQuery.RoutingPolicy))
+	bson.EncodeBool(buf, "AllowMasterFallback", keyRangeQuery.AllowMasterFallback)
 
 	lenWriter.Close()
 }
@@ -110,6 +115,14 @@ func (keyRangeQuery *KeyRangeQuery) UnmarshalBson(buf *bytes.Buffer, kind byte)
 			}
 		case "NotInTransaction":
 			keyRangeQuery.NotInTransaction = bson.DecodeBool(buf, kind)
+		case "OrderedMerge":
+			keyRangeQuery.OrderedMerge = bson.DecodeBool(buf, kind)
+		case "Timeout":
+			keyRangeQuery.Timeout = time.Duration(bson.DecodeInt64(buf, kind))
+		case "RoutingPolicy":
+			keyRangeQuery.RoutingPolicy = RoutingPolicy(bson.DecodeInt(buf, kind))
+		case "AllowMasterFallback":
+			keyRangeQuery.AllowMasterFallback = bson.DecodeBool(buf, kind)
 		default:
 			bson.Skip(buf, kind)
 		}
@@ -9,6 +9,7 @@ package proto
 
 import (
 	"bytes"
+	"time"
 
 	"github.com/youtube/vitess/go/bson"
 	"github.com/youtube/vitess/go/bytes2"
@@ -48,6 +49,16 @@ func (keyspaceIdBatchQuery *KeyspaceIdBatchQuery) MarshalBson(buf *bytes2.Chunke
 		(*keyspaceIdBatchQuery.Session).MarshalBson(buf, "Session")
 	}
 	bson.EncodeBool(buf, "NotInTransaction", keyspaceIdBatchQuery.NotInTransaction)
+	bson.EncodeInt64(buf, "Timeout", int64(keyspaceIdBatchQuery.Timeout))
+	// []BoundKeyspaceIdQuery
+	{
+		bson.EncodePrefix(buf, bson.Array, "KeyspaceIdQueries")
+		lenWriter := bson.NewLenWriter(buf)
+		for _i, _v3 := range keyspaceIdBatchQuery.KeyspaceIdQueries {
+			_v3.MarshalBson(buf, bson.Itoa(_i))
+		}
+		lenWriter.Close()
+	}
 
 	lenWriter.Close()
 }
@@ -108,6 +119,23 @@ func (keyspaceIdBatchQuery *KeyspaceIdBatchQuery) UnmarshalBson(buf *bytes.Buffe
 			}
 		case "NotInTransaction":
 			keyspaceIdBatchQuery.NotInTransaction = bson.DecodeBool(buf, kind)
+		case "Timeout":
+			keyspaceIdBatchQuery.Timeout = time.Duration(bson.DecodeInt64(buf, kind))
+		case "KeyspaceIdQueries":
+			// []BoundKeyspaceIdQuery
+			if kind != bson.Null {
+				if kind != bson.Array {
+					panic(bson.NewBsonError("unexpected kind %v for keyspaceIdBatchQuery.KeyspaceIdQueries", kind))
+				}
+				bson.Next(buf, 4)
+				keyspaceIdBatchQuery.KeyspaceIdQueries = make([]BoundKeyspaceIdQuery, 0, 8)
+				for kind := bson.NextByte(buf); kind != bson.EOO; kind = bson.NextByte(buf) {
+					bson.SkipIndex(buf)
+					var _v3 BoundKeyspaceIdQuery
+					_v3.UnmarshalBson(buf, kind)
+					keyspaceIdBatchQuery.KeyspaceIdQueries = append(keyspaceIdBatchQuery.KeyspaceIdQueries, _v3)
+				}
+			}
 		default:
 			bson.Skip(buf, kind)
 		}
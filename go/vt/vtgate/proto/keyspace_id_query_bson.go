@@ -9,6 +9,7 @@ package proto
 
 import (
 	"bytes"
+	"time"
 
 	"github.com/youtube/vitess/go/bson"
 	"github.com/youtube/vitess/go/bytes2"
@@ -48,6 +49,10 @@ func (keyspaceIdQuery *KeyspaceIdQuery) MarshalBson(buf *bytes2.ChunkedWriter, k
 		(*keyspaceIdQuery.Session).MarshalBson(buf, "Session")
 	}
 	bson.EncodeBool(buf, "NotInTransaction", keyspaceIdQuery.NotInTransaction)
+	bson.EncodeBool(buf, "OrderedMerge", keyspaceIdQuery.OrderedMerge)
+	bson.EncodeInt64(buf, "Timeout", int64(keyspaceIdQuery.Timeout))
+	bson.EncodeInt(buf, "RoutingPolicy", int(keyspaceIdQuery.RoutingPolicy))
+	bson.EncodeBool(buf, "AllowMasterFallback", keyspaceIdQuery.AllowMasterFallback)
 
 	lenWriter.Close()
 }
@@ -110,6 +115,14 @@ func (keyspaceIdQuery *KeyspaceIdQuery) UnmarshalBson(buf *bytes.Buffer, kind by
 			}
 		case "NotInTransaction":
 			keyspaceIdQuery.NotInTransaction = bson.DecodeBool(buf, kind)
+		case "OrderedMerge":
+			keyspaceIdQuery.OrderedMerge = bson.DecodeBool(buf, kind)
+		case "Timeout":
+			keyspaceIdQuery.Timeout = time.Duration(bson.DecodeInt64(buf, kind))
+		case "RoutingPolicy":
+			keyspaceIdQuery.RoutingPolicy = RoutingPolicy(bson.DecodeInt(buf, kind))
+		case "AllowMasterFallback":
+			keyspaceIdQuery.AllowMasterFallback = bson.DecodeBool(buf, kind)
 		default:
 			bson.Skip(buf, kind)
 		}
@@ -9,6 +9,7 @@ package proto
 
 import (
 	"bytes"
+	"time"
 
 	"github.com/youtube/vitess/go/bson"
 	"github.com/youtube/vitess/go/bytes2"
@@ -37,6 +38,8 @@ func (query *Query) MarshalBson(buf *bytes2.ChunkedWriter, key string) {
 		(*query.Session).MarshalBson(buf, "Session")
 	}
 	bson.EncodeBool(buf, "NotInTransaction", query.NotInTransaction)
+	bson.EncodeInt64(buf, "Timeout", int64(query.Timeout))
+	bson.EncodeString(buf, "CallerID", query.CallerID)
 
 	lenWriter.Close()
 }
@@ -82,6 +85,10 @@ func (query *Query) UnmarshalBson(buf *bytes.Buffer, kind byte) {
 			}
 		case "NotInTransaction":
 			query.NotInTransaction = bson.DecodeBool(buf, kind)
+		case "Timeout":
+			query.Timeout = time.Duration(bson.DecodeInt64(buf, kind))
+		case "CallerID":
+			query.CallerID = bson.DecodeString(buf, kind)
 		default:
 			bson.Skip(buf, kind)
 		}
@@ -13,6 +13,7 @@ import (
 	"github.com/youtube/vitess/go/bson"
 	"github.com/youtube/vitess/go/bytes2"
 	mproto "github.com/youtube/vitess/go/mysql/proto"
+	"github.com/youtube/vitess/go/vt/vterrors"
 )
 
 // MarshalBson bson-encodes QueryResult.
@@ -33,6 +34,8 @@ func (queryResult *QueryResult) MarshalBson(buf *bytes2.ChunkedWriter, key strin
 		(*queryResult.Session).MarshalBson(buf, "Session")
 	}
 	bson.EncodeString(buf, "Error", queryResult.Error)
+	bson.EncodeInt64(buf, "ErrorCode", int64(queryResult.ErrorCode))
+	queryResult.TabletType.MarshalBson(buf, "TabletType")
 
 	lenWriter.Close()
 }
@@ -65,6 +68,10 @@ func (queryResult *QueryResult) UnmarshalBson(buf *bytes.Buffer, kind byte) {
 			}
 		case "Error":
 			queryResult.Error = bson.DecodeString(buf, kind)
+		case "ErrorCode":
+			queryResult.ErrorCode = vterrors.ErrorCode(bson.DecodeInt64(buf, kind))
+		case "TabletType":
+			queryResult.TabletType.UnmarshalBson(buf, kind)
 		default:
 			bson.Skip(buf, kind)
 		}
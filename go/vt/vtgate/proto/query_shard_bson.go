@@ -9,6 +9,7 @@ package proto
 
 import (
 	"bytes"
+	"time"
 
 	"github.com/youtube/vitess/go/bson"
 	"github.com/youtube/vitess/go/bytes2"
@@ -47,6 +48,10 @@ func (queryShard *QueryShard) MarshalBson(buf *bytes2.ChunkedWriter, key string)
 		(*queryShard.Session).MarshalBson(buf, "Session")
 	}
 	bson.EncodeBool(buf, "NotInTransaction", queryShard.NotInTransaction)
+	bson.EncodeBool(buf, "OrderedMerge", queryShard.OrderedMerge)
+	bson.EncodeInt64(buf, "Timeout", int64(queryShard.Timeout))
+	bson.EncodeInt(buf, "RoutingPolicy", int(queryShard.RoutingPolicy))
+	bson.EncodeBool(buf, "AllowMasterFallback", queryShard.AllowMasterFallback)
 
 	lenWriter.Close()
 }
@@ -109,6 +114,14 @@ func (queryShard *QueryShard) UnmarshalBson(buf *bytes.Buffer, kind byte) {
 			}
 		case "NotInTransaction":
 			queryShard.NotInTransaction = bson.DecodeBool(buf, kind)
+		case "OrderedMerge":
+			queryShard.OrderedMerge = bson.DecodeBool(buf, kind)
+		case "Timeout":
+			queryShard.Timeout = time.Duration(bson.DecodeInt64(buf, kind))
+		case "RoutingPolicy":
+			queryShard.RoutingPolicy = RoutingPolicy(bson.DecodeInt(buf, kind))
+		case "AllowMasterFallback":
+			queryShard.AllowMasterFallback = bson.DecodeBool(buf, kind)
 		default:
 			bson.Skip(buf, kind)
 		}
@@ -6,11 +6,13 @@ package proto
 
 import (
 	"fmt"
+	"time"
 
 	mproto "github.com/youtube/vitess/go/mysql/proto"
 	"github.com/youtube/vitess/go/vt/key"
 	tproto "github.com/youtube/vitess/go/vt/tabletserver/proto"
 	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/vt/vterrors"
 )
 
 // Session represents the session state. It keeps track of
@@ -41,6 +43,40 @@ func (shardSession *ShardSession) String() string {
 	return fmt.Sprintf("Keyspace: %v, Shard: %v, TabletType: %v, TransactionId: %v", shardSession.Keyspace, shardSession.Shard, shardSession.TabletType, shardSession.TransactionId)
 }
 
+// RoutingPolicy tells vtgate how to pick the cell and tablet type
+// that serve a read. The reads of a transaction always use the
+// requested tablet type in the cell of vtgate.
+type RoutingPolicy int
+
+const (
+	// RoutingStrict reads from the requested tablet type in the cell
+	// of vtgate.
+	RoutingStrict = RoutingPolicy(iota)
+	// RoutingPreferType reads from the requested tablet type if all
+	// the shards have a serving end point of it. Otherwise it reads
+	// from the other read-only type (rdonly for replica, replica for
+	// rdonly), and then from the master if AllowMasterFallback is
+	// set.
+	RoutingPreferType
+	// RoutingNearestCell reads from the requested tablet type in the
+	// nearest cell where all the shards have a serving end point of
+	// it: the cell of vtgate, then its -routing_cells in order.
+	RoutingNearestCell
+)
+
+var routingPolicyNames = []string{
+	"STRICT",
+	"PREFER_TYPE",
+	"NEAREST_CELL",
+}
+
+func (policy RoutingPolicy) String() string {
+	if policy < 0 || int(policy) >= len(routingPolicyNames) {
+		return fmt.Sprintf("RoutingPolicy(%d)", int(policy))
+	}
+	return routingPolicyNames[policy]
+}
+
 // Query represents a keyspace agnostic query request.
 type Query struct {
 	Sql              string
@@ -48,6 +84,11 @@ type Query struct {
 	TabletType       topo.TabletType
 	Session          *Session
 	NotInTransaction bool
+	// Timeout, if set, is how long vtgate works on the call
+	// before giving up. It is capped by the server timeout.
+	Timeout time.Duration
+	// CallerID identifies the caller for the vtgate query rules.
+	CallerID string
 }
 
 //go:generate bsongen -file $GOFILE -type Query -o query_bson.go
@@ -62,6 +103,20 @@ type QueryShard struct {
 	TabletType       topo.TabletType
 	Session          *Session
 	NotInTransaction bool
+	// OrderedMerge is only used by the streaming calls. If set,
+	// the rows of the shards are merged on the ORDER BY columns
+	// of the query, instead of being sent as they arrive.
+	OrderedMerge bool
+	// Timeout, if set, is how long vtgate works on the call
+	// before giving up. It is capped by the server timeout.
+	Timeout time.Duration
+	// RoutingPolicy tells vtgate how to pick the cell and tablet
+	// type of a read outside of a transaction. The streaming calls
+	// ignore it.
+	RoutingPolicy RoutingPolicy
+	// AllowMasterFallback lets RoutingPreferType read from the
+	// master tablets.
+	AllowMasterFallback bool
 }
 
 //go:generate bsongen -file $GOFILE -type QueryShard -o query_shard_bson.go
@@ -76,6 +131,20 @@ type KeyspaceIdQuery struct {
 	TabletType       topo.TabletType
 	Session          *Session
 	NotInTransaction bool
+	// OrderedMerge is only used by the streaming calls. If set,
+	// the rows of the shards are merged on the ORDER BY columns
+	// of the query, instead of being sent as they arrive.
+	OrderedMerge bool
+	// Timeout, if set, is how long vtgate works on the call
+	// before giving up. It is capped by the server timeout.
+	Timeout time.Duration
+	// RoutingPolicy tells vtgate how to pick the cell and tablet
+	// type of a read outside of a transaction. The streaming calls
+	// ignore it.
+	RoutingPolicy RoutingPolicy
+	// AllowMasterFallback lets RoutingPreferType read from the
+	// master tablets.
+	AllowMasterFallback bool
 }
 
 //go:generate bsongen -file $GOFILE -type KeyspaceIdQuery -o keyspace_id_query_bson.go
@@ -90,6 +159,20 @@ type KeyRangeQuery struct {
 	TabletType       topo.TabletType
 	Session          *Session
 	NotInTransaction bool
+	// OrderedMerge is only used by the streaming calls. If set,
+	// the rows of the shards are merged on the ORDER BY columns
+	// of the query, instead of being sent as they arrive.
+	OrderedMerge bool
+	// Timeout, if set, is how long vtgate works on the call
+	// before giving up. It is capped by the server timeout.
+	Timeout time.Duration
+	// RoutingPolicy tells vtgate how to pick the cell and tablet
+	// type of a read outside of a transaction. The streaming calls
+	// ignore it.
+	RoutingPolicy RoutingPolicy
+	// AllowMasterFallback lets RoutingPreferType read from the
+	// master tablets.
+	AllowMasterFallback bool
 }
 
 //go:generate bsongen -file $GOFILE -type KeyRangeQuery -o key_range_query_bson.go
@@ -112,6 +195,15 @@ type EntityIdsQuery struct {
 	TabletType        topo.TabletType
 	Session           *Session
 	NotInTransaction  bool
+	// Timeout, if set, is how long vtgate works on the call
+	// before giving up. It is capped by the server timeout.
+	Timeout time.Duration
+	// RoutingPolicy tells vtgate how to pick the cell and tablet
+	// type of a read outside of a transaction.
+	RoutingPolicy RoutingPolicy
+	// AllowMasterFallback lets RoutingPreferType read from the
+	// master tablets.
+	AllowMasterFallback bool
 }
 
 //go:generate bsongen -file $GOFILE -type EntityIdsQuery -o entity_ids_query_bson.go
@@ -121,10 +213,27 @@ type QueryResult struct {
 	Result  *mproto.QueryResult
 	Session *Session
 	Error   string
+	// ErrorCode is the code of Error. The vtgates that don't send
+	// it leave it Unknown.
+	ErrorCode vterrors.ErrorCode
+	// TabletType is the tablet type that served the query, for the
+	// calls that take a RoutingPolicy.
+	TabletType topo.TabletType
 }
 
 //go:generate bsongen -file $GOFILE -type QueryResult -o query_result_bson.go
 
+// BoundShardQuery is a query of a batch, with the keyspace and
+// shards it runs on.
+type BoundShardQuery struct {
+	Sql           string
+	BindVariables map[string]interface{}
+	Keyspace      string
+	Shards        []string
+}
+
+//go:generate bsongen -file $GOFILE -type BoundShardQuery -o bound_shard_query_bson.go
+
 // BatchQueryShard represents a batch query request
 // for the specified shards.
 type BatchQueryShard struct {
@@ -134,10 +243,30 @@ type BatchQueryShard struct {
 	TabletType       topo.TabletType
 	Session          *Session
 	NotInTransaction bool
+	// Timeout, if set, is how long vtgate works on the call
+	// before giving up. It is capped by the server timeout.
+	Timeout time.Duration
+	// ShardQueries, if set, are run instead of Queries, each on
+	// its own keyspace and shards, and Keyspace and Shards are
+	// ignored. The queries of a shard are sent to it in a single
+	// ExecuteBatch call, and the reply has the error of each query
+	// in Errors.
+	ShardQueries []BoundShardQuery
 }
 
 //go:generate bsongen -file $GOFILE -type BatchQueryShard -o batch_query_shard_bson.go
 
+// BoundKeyspaceIdQuery is a query of a batch, with the keyspace ids
+// it runs on.
+type BoundKeyspaceIdQuery struct {
+	Sql           string
+	BindVariables map[string]interface{}
+	Keyspace      string
+	KeyspaceIds   []key.KeyspaceId
+}
+
+//go:generate bsongen -file $GOFILE -type BoundKeyspaceIdQuery -o bound_keyspace_id_query_bson.go
+
 // KeyspaceIdBatchQuery represents a batch query request
 // for the specified keyspace IDs.
 type KeyspaceIdBatchQuery struct {
@@ -147,22 +276,39 @@ type KeyspaceIdBatchQuery struct {
 	TabletType       topo.TabletType
 	Session          *Session
 	NotInTransaction bool
+	// Timeout, if set, is how long vtgate works on the call
+	// before giving up. It is capped by the server timeout.
+	Timeout time.Duration
+	// KeyspaceIdQueries, if set, are run instead of Queries, each
+	// on the shards of its own keyspace ids, like the ShardQueries
+	// of a BatchQueryShard.
+	KeyspaceIdQueries []BoundKeyspaceIdQuery
 }
 
 //go:generate bsongen -file $GOFILE -type KeyspaceIdBatchQuery -o keyspace_id_batch_query_bson.go
 
 // QueryResultList is mproto.QueryResultList+Session
 type QueryResultList struct {
-	List    []mproto.QueryResult
-	Session *Session
-	Error   string
+	List      []mproto.QueryResult
+	Session   *Session
+	Error     string
+	ErrorCode vterrors.ErrorCode
+	// Errors is set for a batch of ShardQueries or
+	// KeyspaceIdQueries. It has the error of each query, or "" if
+	// it succeeded. The result of a failed query is empty.
+	// ErrorCodes has the codes of Errors.
+	Errors     []string
+	ErrorCodes []vterrors.ErrorCode
 }
 
-// SplitQueryRequest is a request to split a query into multiple parts
+// SplitQueryRequest is a request to split a query into multiple parts.
+// The query is split on SplitColumn, or on the first primary key
+// column of the table if SplitColumn is empty.
 type SplitQueryRequest struct {
-	Keyspace   string
-	Query      tproto.BoundQuery
-	SplitCount int
+	Keyspace    string
+	Query       tproto.BoundQuery
+	SplitColumn string
+	SplitCount  int
 }
 
 // SplitQueryPart is a sub query of SplitQueryRequest.Query
@@ -175,3 +321,38 @@ type SplitQueryPart struct {
 type SplitQueryResult struct {
 	Splits []SplitQueryPart
 }
+
+// GetKeyspaceIdResolverRequest asks for the sharding column of a
+// keyspace.
+type GetKeyspaceIdResolverRequest struct {
+	Keyspace string
+}
+
+// GetKeyspaceIdResolverResult is the result for
+// GetKeyspaceIdResolverRequest. The keyspace ids of the keyspace are
+// built from the values of ShardingColumnName, according to
+// ShardingColumnType. Both are empty for an unsharded keyspace.
+type GetKeyspaceIdResolverResult struct {
+	ShardingColumnName string
+	ShardingColumnType key.KeyspaceIdType
+}
+
+// GetSrvKeyspaceRequest asks for the serving graph of a keyspace, as
+// seen by vtgate. If Cell is empty, the cell of vtgate is used.
+type GetSrvKeyspaceRequest struct {
+	Cell     string
+	Keyspace string
+}
+
+// ExplainResult is the routing decision of vtgate for a query. Shards
+// are the shards of Keyspace the query would be sent to, and Query
+// the query they would execute. PlanID is NoPlan if the query cannot
+// be routed, and Reason tells why.
+type ExplainResult struct {
+	PlanID   string
+	Reason   string
+	Table    string
+	Keyspace string
+	Shards   []string
+	Query    string
+}
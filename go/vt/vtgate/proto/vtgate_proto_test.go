@@ -7,6 +7,7 @@ package proto
 import (
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/youtube/vitess/go/bson"
 	mproto "github.com/youtube/vitess/go/mysql/proto"
@@ -14,6 +15,7 @@ import (
 	kproto "github.com/youtube/vitess/go/vt/key"
 	tproto "github.com/youtube/vitess/go/vt/tabletserver/proto"
 	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/vt/vterrors"
 )
 
 var commonSession = Session{
@@ -91,48 +93,113 @@ func TestSession(t *testing.T) {
 	}
 }
 
-type reflectQueryShard struct {
-	Sql              string
-	BindVariables    map[string]interface{}
-	Keyspace         string
-	Shards           []string
-	TabletType       topo.TabletType
-	Session          *Session
-	NotInTransaction bool
-}
-
-type extraQueryShard struct {
-	Extra            int
+type reflectQuery struct {
 	Sql              string
 	BindVariables    map[string]interface{}
-	Keyspace         string
-	Shards           []string
 	TabletType       topo.TabletType
 	Session          *Session
 	NotInTransaction bool
+	Timeout          time.Duration
+	CallerID         string
 }
 
-func TestQueryShard(t *testing.T) {
-	reflected, err := bson.Marshal(&reflectQueryShard{
+func TestQuery(t *testing.T) {
+	reflected, err := bson.Marshal(&reflectQuery{
 		Sql:           "query",
 		BindVariables: map[string]interface{}{"val": int64(1)},
-		Keyspace:      "keyspace",
-		Shards:        []string{"shard1", "shard2"},
 		TabletType:    topo.TabletType("replica"),
 		Session:       &commonSession,
+		Timeout:       5 * time.Second,
+		CallerID:      "caller",
 	})
 	if err != nil {
 		t.Error(err)
 	}
 	want := string(reflected)
 
-	custom := QueryShard{
+	custom := Query{
 		Sql:           "query",
 		BindVariables: map[string]interface{}{"val": int64(1)},
-		Keyspace:      "keyspace",
-		Shards:        []string{"shard1", "shard2"},
 		TabletType:    topo.TabletType("replica"),
 		Session:       &commonSession,
+		Timeout:       5 * time.Second,
+		CallerID:      "caller",
+	}
+	encoded, err := bson.Marshal(&custom)
+	if err != nil {
+		t.Error(err)
+	}
+	got := string(encoded)
+	if want != got {
+		t.Errorf("want\n%+v, got\n%+v", want, got)
+	}
+
+	var unmarshalled Query
+	err = bson.Unmarshal(encoded, &unmarshalled)
+	if err != nil {
+		t.Error(err)
+	}
+	if !reflect.DeepEqual(custom, unmarshalled) {
+		t.Errorf("want \n%+v, got \n%+v", custom, unmarshalled)
+	}
+}
+
+type reflectQueryShard struct {
+	Sql                 string
+	BindVariables       map[string]interface{}
+	Keyspace            string
+	Shards              []string
+	TabletType          topo.TabletType
+	Session             *Session
+	NotInTransaction    bool
+	OrderedMerge        bool
+	Timeout             time.Duration
+	RoutingPolicy       RoutingPolicy
+	AllowMasterFallback bool
+}
+
+type extraQueryShard struct {
+	Extra               int
+	Sql                 string
+	BindVariables       map[string]interface{}
+	Keyspace            string
+	Shards              []string
+	TabletType          topo.TabletType
+	Session             *Session
+	NotInTransaction    bool
+	OrderedMerge        bool
+	Timeout             time.Duration
+	RoutingPolicy       RoutingPolicy
+	AllowMasterFallback bool
+}
+
+func TestQueryShard(t *testing.T) {
+	reflected, err := bson.Marshal(&reflectQueryShard{
+		Sql:                 "query",
+		BindVariables:       map[string]interface{}{"val": int64(1)},
+		Keyspace:            "keyspace",
+		Shards:              []string{"shard1", "shard2"},
+		TabletType:          topo.TabletType("replica"),
+		Session:             &commonSession,
+		RoutingPolicy:       RoutingPreferType,
+		AllowMasterFallback: true,
+		Timeout:             5 * time.Second,
+	})
+	if err != nil {
+		t.Error(err)
+	}
+	want := string(reflected)
+
+	custom := QueryShard{
+		Sql:                 "query",
+		BindVariables:       map[string]interface{}{"val": int64(1)},
+		Keyspace:            "keyspace",
+		Shards:              []string{"shard1", "shard2"},
+		TabletType:          topo.TabletType("replica"),
+		Session:             &commonSession,
+		RoutingPolicy:       RoutingPreferType,
+		AllowMasterFallback: true,
+		Timeout:             5 * time.Second,
 	}
 	encoded, err := bson.Marshal(&custom)
 	if err != nil {
@@ -165,7 +232,7 @@ func TestQueryShard(t *testing.T) {
 func TestQueryResult(t *testing.T) {
 	// We can't do the reflection test because bson
 	// doesn't do it correctly for embedded fields.
-	want := "\x8b\x01\x00\x00\x03Result\x00\x94\x00\x00\x00\x04Fields\x009\x00\x00\x00\x030\x001\x00\x00\x00\x05Name\x00\x04\x00\x00\x00\x00name\x12Type\x00\x01\x00\x00\x00\x00\x00\x00\x00\x12Flags\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00?RowsAffected\x00\x02\x00\x00\x00\x00\x00\x00\x00?InsertId\x00\x03\x00\x00\x00\x00\x00\x00\x00\x04Rows\x00 \x00\x00\x00\x040\x00\x18\x00\x00\x00\x050\x00\x01\x00\x00\x00\x001\x051\x00\x02\x00\x00\x00\x00aa\x00\x00\x00\x03Session\x00\xd0\x00\x00\x00\bInTransaction\x00\x01\x04ShardSessions\x00\xac\x00\x00\x00\x030\x00Q\x00\x00\x00\x05Keyspace\x00\x01\x00\x00\x00\x00a\x05Shard\x00\x01\x00\x00\x00\x000\x05TabletType\x00\a\x00\x00\x00\x00replica\x12TransactionId\x00\x01\x00\x00\x00\x00\x00\x00\x00\x00\x031\x00P\x00\x00\x00\x05Keyspace\x00\x01\x00\x00\x00\x00b\x05Shard\x00\x01\x00\x00\x00\x001\x05TabletType\x00\x06\x00\x00\x00\x00master\x12TransactionId\x00\x02\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x05Error\x00\x05\x00\x00\x00\x00error\x00"
+	want := "\xb6\x01\x00\x00\x03Result\x00\x94\x00\x00\x00\x04Fields\x009\x00\x00\x00\x030\x001\x00\x00\x00\x05Name\x00\x04\x00\x00\x00\x00name\x12Type\x00\x01\x00\x00\x00\x00\x00\x00\x00\x12Flags\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00?RowsAffected\x00\x02\x00\x00\x00\x00\x00\x00\x00?InsertId\x00\x03\x00\x00\x00\x00\x00\x00\x00\x04Rows\x00 \x00\x00\x00\x040\x00\x18\x00\x00\x00\x050\x00\x01\x00\x00\x00\x001\x051\x00\x02\x00\x00\x00\x00aa\x00\x00\x00\x03Session\x00\xd0\x00\x00\x00\bInTransaction\x00\x01\x04ShardSessions\x00\xac\x00\x00\x00\x030\x00Q\x00\x00\x00\x05Keyspace\x00\x01\x00\x00\x00\x00a\x05Shard\x00\x01\x00\x00\x00\x000\x05TabletType\x00\a\x00\x00\x00\x00replica\x12TransactionId\x00\x01\x00\x00\x00\x00\x00\x00\x00\x00\x031\x00P\x00\x00\x00\x05Keyspace\x00\x01\x00\x00\x00\x00b\x05Shard\x00\x01\x00\x00\x00\x001\x05TabletType\x00\x06\x00\x00\x00\x00master\x12TransactionId\x00\x02\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x05Error\x00\x05\x00\x00\x00\x00error\x12ErrorCode\x00\x04\x00\x00\x00\x00\x00\x00\x00\x05TabletType\x00\a\x00\x00\x00\x00replica\x00"
 
 	custom := QueryResult{
 		Result: &mproto.QueryResult{
@@ -176,8 +243,10 @@ func TestQueryResult(t *testing.T) {
 				{{sqltypes.String("1")}, {sqltypes.String("aa")}},
 			},
 		},
-		Session: &commonSession,
-		Error:   "error",
+		Session:    &commonSession,
+		Error:      "error",
+		ErrorCode:  vterrors.Transient,
+		TabletType: topo.TabletType("replica"),
 	}
 	encoded, err := bson.Marshal(&custom)
 	if err != nil {
@@ -203,6 +272,13 @@ type reflectBoundQuery struct {
 	BindVariables map[string]interface{}
 }
 
+type reflectBoundShardQuery struct {
+	Sql           string
+	BindVariables map[string]interface{}
+	Keyspace      string
+	Shards        []string
+}
+
 type reflectBatchQueryShard struct {
 	Queries          []reflectBoundQuery
 	Keyspace         string
@@ -210,6 +286,8 @@ type reflectBatchQueryShard struct {
 	TabletType       topo.TabletType
 	Session          *Session
 	NotInTransaction bool
+	Timeout          time.Duration
+	ShardQueries     []reflectBoundShardQuery
 }
 
 type extraBatchQueryShard struct {
@@ -220,6 +298,8 @@ type extraBatchQueryShard struct {
 	TabletType       topo.TabletType
 	Session          *Session
 	NotInTransaction bool
+	Timeout          time.Duration
+	ShardQueries     []reflectBoundShardQuery
 }
 
 func TestBatchQueryShard(t *testing.T) {
@@ -243,6 +323,12 @@ func TestBatchQueryShard(t *testing.T) {
 				TransactionId: 2,
 			}},
 		},
+		ShardQueries: []reflectBoundShardQuery{{
+			Sql:           "query",
+			BindVariables: map[string]interface{}{"val": int64(1)},
+			Keyspace:      "keyspace",
+			Shards:        []string{"shard1"},
+		}},
 	})
 	if err != nil {
 		t.Error(err)
@@ -257,6 +343,12 @@ func TestBatchQueryShard(t *testing.T) {
 		Keyspace: "keyspace",
 		Shards:   []string{"shard1", "shard2"},
 		Session:  &commonSession,
+		ShardQueries: []BoundShardQuery{{
+			Sql:           "query",
+			BindVariables: map[string]interface{}{"val": int64(1)},
+			Keyspace:      "keyspace",
+			Shards:        []string{"shard1"},
+		}},
 	}
 	encoded, err := bson.Marshal(&custom)
 	if err != nil {
@@ -293,6 +385,7 @@ type badTypeBatchQueryShard struct {
 	TabletType       topo.TabletType
 	Session          *Session
 	NotInTransaction bool
+	Timeout          time.Duration
 }
 
 func TestBatchQueryShardBadType(t *testing.T) {
@@ -309,9 +402,12 @@ func TestBatchQueryShardBadType(t *testing.T) {
 }
 
 type reflectQueryResultList struct {
-	List    []mproto.QueryResult
-	Session *Session
-	Error   string
+	List       []mproto.QueryResult
+	Session    *Session
+	Error      string
+	ErrorCode  int64
+	Errors     []string
+	ErrorCodes []int64
 }
 
 type extraQueryResultList struct {
@@ -319,6 +415,7 @@ type extraQueryResultList struct {
 	List    []mproto.QueryResult
 	Session *Session
 	Error   string
+	Errors  []string
 }
 
 func TestQueryResultList(t *testing.T) {
@@ -331,8 +428,11 @@ func TestQueryResultList(t *testing.T) {
 				{{sqltypes.String("1")}, {sqltypes.String("aa")}},
 			},
 		}},
-		Session: &commonSession,
-		Error:   "error",
+		Session:    &commonSession,
+		Error:      "error",
+		ErrorCode:  1,
+		Errors:     []string{"", "error"},
+		ErrorCodes: []int64{0, 3},
 	})
 	if err != nil {
 		t.Error(err)
@@ -348,8 +448,11 @@ func TestQueryResultList(t *testing.T) {
 				{{sqltypes.String("1")}, {sqltypes.String("aa")}},
 			},
 		}},
-		Session: &commonSession,
-		Error:   "error",
+		Session:    &commonSession,
+		Error:      "error",
+		ErrorCode:  vterrors.BadInput,
+		Errors:     []string{"", "error"},
+		ErrorCodes: []vterrors.ErrorCode{vterrors.Unknown, vterrors.IntegrityError},
 	}
 	encoded, err := bson.Marshal(&custom)
 	if err != nil {
@@ -380,34 +483,44 @@ func TestQueryResultList(t *testing.T) {
 }
 
 type reflectKeyspaceIdQuery struct {
-	Sql              string
-	BindVariables    map[string]interface{}
-	Keyspace         string
-	KeyspaceIds      kproto.KeyspaceIdArray
-	TabletType       topo.TabletType
-	Session          *Session
-	NotInTransaction bool
+	Sql                 string
+	BindVariables       map[string]interface{}
+	Keyspace            string
+	KeyspaceIds         kproto.KeyspaceIdArray
+	TabletType          topo.TabletType
+	Session             *Session
+	NotInTransaction    bool
+	OrderedMerge        bool
+	Timeout             time.Duration
+	RoutingPolicy       RoutingPolicy
+	AllowMasterFallback bool
 }
 
 type extraKeyspaceIdQuery struct {
-	Extra            int
-	Sql              string
-	BindVariables    map[string]interface{}
-	Keyspace         string
-	KeyspaceIds      []kproto.KeyspaceId
-	TabletType       topo.TabletType
-	Session          *Session
-	NotInTransaction bool
+	Extra               int
+	Sql                 string
+	BindVariables       map[string]interface{}
+	Keyspace            string
+	KeyspaceIds         []kproto.KeyspaceId
+	TabletType          topo.TabletType
+	Session             *Session
+	NotInTransaction    bool
+	OrderedMerge        bool
+	Timeout             time.Duration
+	RoutingPolicy       RoutingPolicy
+	AllowMasterFallback bool
 }
 
 func TestKeyspaceIdQuery(t *testing.T) {
 	reflected, err := bson.Marshal(&reflectKeyspaceIdQuery{
-		Sql:           "query",
-		BindVariables: map[string]interface{}{"val": int64(1)},
-		Keyspace:      "keyspace",
-		KeyspaceIds:   []kproto.KeyspaceId{kproto.KeyspaceId("10"), kproto.KeyspaceId("18")},
-		TabletType:    "replica",
-		Session:       &commonSession,
+		Sql:                 "query",
+		BindVariables:       map[string]interface{}{"val": int64(1)},
+		Keyspace:            "keyspace",
+		KeyspaceIds:         []kproto.KeyspaceId{kproto.KeyspaceId("10"), kproto.KeyspaceId("18")},
+		TabletType:          "replica",
+		Session:             &commonSession,
+		RoutingPolicy:       RoutingPreferType,
+		AllowMasterFallback: true,
 	})
 
 	if err != nil {
@@ -416,12 +529,14 @@ func TestKeyspaceIdQuery(t *testing.T) {
 	want := string(reflected)
 
 	custom := KeyspaceIdQuery{
-		Sql:           "query",
-		BindVariables: map[string]interface{}{"val": int64(1)},
-		Keyspace:      "keyspace",
-		KeyspaceIds:   []kproto.KeyspaceId{kproto.KeyspaceId("10"), kproto.KeyspaceId("18")},
-		TabletType:    "replica",
-		Session:       &commonSession,
+		Sql:                 "query",
+		BindVariables:       map[string]interface{}{"val": int64(1)},
+		Keyspace:            "keyspace",
+		KeyspaceIds:         []kproto.KeyspaceId{kproto.KeyspaceId("10"), kproto.KeyspaceId("18")},
+		TabletType:          "replica",
+		Session:             &commonSession,
+		RoutingPolicy:       RoutingPreferType,
+		AllowMasterFallback: true,
 	}
 	encoded, err := bson.Marshal(&custom)
 	if err != nil {
@@ -452,34 +567,44 @@ func TestKeyspaceIdQuery(t *testing.T) {
 }
 
 type reflectKeyRangeQuery struct {
-	Sql              string
-	BindVariables    map[string]interface{}
-	Keyspace         string
-	KeyRanges        kproto.KeyRangeArray
-	TabletType       topo.TabletType
-	Session          *Session
-	NotInTransaction bool
+	Sql                 string
+	BindVariables       map[string]interface{}
+	Keyspace            string
+	KeyRanges           kproto.KeyRangeArray
+	TabletType          topo.TabletType
+	Session             *Session
+	NotInTransaction    bool
+	OrderedMerge        bool
+	Timeout             time.Duration
+	RoutingPolicy       RoutingPolicy
+	AllowMasterFallback bool
 }
 
 type extraKeyRangeQuery struct {
-	Extra            int
-	Sql              string
-	BindVariables    map[string]interface{}
-	Keyspace         string
-	KeyRanges        []kproto.KeyRange
-	TabletType       topo.TabletType
-	Session          *Session
-	NotInTransaction bool
+	Extra               int
+	Sql                 string
+	BindVariables       map[string]interface{}
+	Keyspace            string
+	KeyRanges           []kproto.KeyRange
+	TabletType          topo.TabletType
+	Session             *Session
+	NotInTransaction    bool
+	OrderedMerge        bool
+	Timeout             time.Duration
+	RoutingPolicy       RoutingPolicy
+	AllowMasterFallback bool
 }
 
 func TestKeyRangeQuery(t *testing.T) {
 	reflected, err := bson.Marshal(&reflectKeyRangeQuery{
-		Sql:           "query",
-		BindVariables: map[string]interface{}{"val": int64(1)},
-		Keyspace:      "keyspace",
-		KeyRanges:     []kproto.KeyRange{kproto.KeyRange{Start: "10", End: "18"}},
-		TabletType:    "replica",
-		Session:       &commonSession,
+		Sql:                 "query",
+		BindVariables:       map[string]interface{}{"val": int64(1)},
+		Keyspace:            "keyspace",
+		KeyRanges:           []kproto.KeyRange{kproto.KeyRange{Start: "10", End: "18"}},
+		TabletType:          "replica",
+		Session:             &commonSession,
+		RoutingPolicy:       RoutingPreferType,
+		AllowMasterFallback: true,
 	})
 
 	if err != nil {
@@ -488,12 +613,14 @@ func TestKeyRangeQuery(t *testing.T) {
 	want := string(reflected)
 
 	custom := KeyRangeQuery{
-		Sql:           "query",
-		BindVariables: map[string]interface{}{"val": int64(1)},
-		Keyspace:      "keyspace",
-		KeyRanges:     []kproto.KeyRange{kproto.KeyRange{Start: "10", End: "18"}},
-		TabletType:    "replica",
-		Session:       &commonSession,
+		Sql:                 "query",
+		BindVariables:       map[string]interface{}{"val": int64(1)},
+		Keyspace:            "keyspace",
+		KeyRanges:           []kproto.KeyRange{kproto.KeyRange{Start: "10", End: "18"}},
+		TabletType:          "replica",
+		Session:             &commonSession,
+		RoutingPolicy:       RoutingPreferType,
+		AllowMasterFallback: true,
 	}
 	encoded, err := bson.Marshal(&custom)
 	if err != nil {
@@ -523,23 +650,34 @@ func TestKeyRangeQuery(t *testing.T) {
 	}
 }
 
+type reflectBoundKeyspaceIdQuery struct {
+	Sql           string
+	BindVariables map[string]interface{}
+	Keyspace      string
+	KeyspaceIds   []kproto.KeyspaceId
+}
+
 type reflectKeyspaceIdBatchQuery struct {
-	Queries          []reflectBoundQuery
-	Keyspace         string
-	KeyspaceIds      []kproto.KeyspaceId
-	TabletType       topo.TabletType
-	Session          *Session
-	NotInTransaction bool
+	Queries           []reflectBoundQuery
+	Keyspace          string
+	KeyspaceIds       []kproto.KeyspaceId
+	TabletType        topo.TabletType
+	Session           *Session
+	NotInTransaction  bool
+	Timeout           time.Duration
+	KeyspaceIdQueries []reflectBoundKeyspaceIdQuery
 }
 
 type extraKeyspaceIdBatchQuery struct {
-	Extra            int
-	Queries          []reflectBoundQuery
-	Keyspace         string
-	KeyspaceIds      []kproto.KeyspaceId
-	TabletType       topo.TabletType
-	Session          *Session
-	NotInTransaction bool
+	Extra             int
+	Queries           []reflectBoundQuery
+	Keyspace          string
+	KeyspaceIds       []kproto.KeyspaceId
+	TabletType        topo.TabletType
+	Session           *Session
+	NotInTransaction  bool
+	Timeout           time.Duration
+	KeyspaceIdQueries []reflectBoundKeyspaceIdQuery
 }
 
 func TestKeyspaceIdBatchQuery(t *testing.T) {
@@ -563,6 +701,12 @@ func TestKeyspaceIdBatchQuery(t *testing.T) {
 				TransactionId: 2,
 			}},
 		},
+		KeyspaceIdQueries: []reflectBoundKeyspaceIdQuery{{
+			Sql:           "query",
+			BindVariables: map[string]interface{}{"val": int64(1)},
+			Keyspace:      "keyspace",
+			KeyspaceIds:   []kproto.KeyspaceId{kproto.KeyspaceId("10")},
+		}},
 	})
 	if err != nil {
 		t.Error(err)
@@ -577,6 +721,12 @@ func TestKeyspaceIdBatchQuery(t *testing.T) {
 		Keyspace:    "keyspace",
 		KeyspaceIds: []kproto.KeyspaceId{kproto.KeyspaceId("10"), kproto.KeyspaceId("20")},
 		Session:     &commonSession,
+		KeyspaceIdQueries: []BoundKeyspaceIdQuery{{
+			Sql:           "query",
+			BindVariables: map[string]interface{}{"val": int64(1)},
+			Keyspace:      "keyspace",
+			KeyspaceIds:   []kproto.KeyspaceId{kproto.KeyspaceId("10")},
+		}},
 	}
 	encoded, err := bson.Marshal(&custom)
 	if err != nil {
@@ -613,6 +763,7 @@ type badTypeKeyspaceIdsBatchQuery struct {
 	TabletType       topo.TabletType
 	Session          *Session
 	NotInTransaction bool
+	Timeout          time.Duration
 }
 
 func TestKeyspaceIdsBatchQueryBadType(t *testing.T) {
@@ -0,0 +1,257 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vtgate
+
+// This is a V3 file. Do not intermix with V2.
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"sync"
+
+	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/acl"
+	"github.com/youtube/vitess/go/stats"
+	"github.com/youtube/vitess/go/vt/vtgate/planbuilder"
+)
+
+// This file contains the rules that allow or deny V3 queries before
+// they are routed. They work like the vttablet query rules, but
+// match on the caller id of the query.
+
+var queryRulesFile = flag.String("query_rules_file", "", "JSON file of the rules that allow or deny V3 queries, by caller id, table, plan and query, before they are routed. A POST to /debug/query_rules reloads it")
+
+// ruleAction is what happens to a query that matches a rule.
+type ruleAction int
+
+const (
+	ruleAllow = ruleAction(iota)
+	ruleDeny
+	ruleDenyWithMessage
+)
+
+var ruleActionNames = map[string]ruleAction{
+	"ALLOW":             ruleAllow,
+	"DENY":              ruleDeny,
+	"DENY_WITH_MESSAGE": ruleDenyWithMessage,
+}
+
+// queryRule matches a query if all its conditions match. An empty
+// rule matches all queries.
+type queryRule struct {
+	name    string
+	action  ruleAction
+	message string
+
+	// callerID and query must fully match. nil matches anything.
+	callerID, query *regexp.Regexp
+	// Any of tableNames and any of plans must match. nil matches
+	// anything.
+	tableNames []string
+	plans      []planbuilder.PlanID
+}
+
+// queryRuleInfo is the JSON form of a queryRule.
+type queryRuleInfo struct {
+	Name        string
+	Description string
+	CallerID    string
+	Query       string
+	TableNames  []string
+	Plans       []string
+	Action      string
+	Message     string
+}
+
+// parseQueryRules parses a JSON list of rules.
+func parseQueryRules(data []byte) ([]*queryRule, error) {
+	var infos []queryRuleInfo
+	if err := json.Unmarshal(data, &infos); err != nil {
+		return nil, fmt.Errorf("cannot parse query rules: %v", err)
+	}
+	rules := make([]*queryRule, 0, len(infos))
+	names := make(map[string]bool, len(infos))
+	for _, info := range infos {
+		if info.Name == "" {
+			return nil, fmt.Errorf("query rule has no Name")
+		}
+		if names[info.Name] {
+			return nil, fmt.Errorf("duplicate query rule %v", info.Name)
+		}
+		names[info.Name] = true
+		rule := &queryRule{
+			name:       info.Name,
+			message:    info.Message,
+			tableNames: info.TableNames,
+		}
+		action, ok := ruleActionNames[info.Action]
+		if !ok {
+			return nil, fmt.Errorf("query rule %v: invalid Action %q", info.Name, info.Action)
+		}
+		if action == ruleDenyWithMessage && info.Message == "" {
+			return nil, fmt.Errorf("query rule %v: DENY_WITH_MESSAGE needs a Message", info.Name)
+		}
+		rule.action = action
+		var err error
+		if rule.callerID, err = compileExact(info.CallerID); err != nil {
+			return nil, fmt.Errorf("query rule %v: invalid CallerID: %v", info.Name, err)
+		}
+		if rule.query, err = compileExact(info.Query); err != nil {
+			return nil, fmt.Errorf("query rule %v: invalid Query: %v", info.Name, err)
+		}
+		for _, name := range info.Plans {
+			plan, ok := planbuilder.PlanByName(name)
+			if !ok {
+				return nil, fmt.Errorf("query rule %v: invalid plan name %v", info.Name, name)
+			}
+			rule.plans = append(rule.plans, plan)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// compileExact compiles a pattern that must match the whole string.
+// An empty pattern returns nil.
+func compileExact(pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return nil, nil
+	}
+	return regexp.Compile(fmt.Sprintf("^(?:%s)$", pattern))
+}
+
+func (rule *queryRule) matches(callerID, sql string, plan *planbuilder.Plan) bool {
+	if rule.callerID != nil && !rule.callerID.MatchString(callerID) {
+		return false
+	}
+	if rule.query != nil && !rule.query.MatchString(sql) {
+		return false
+	}
+	if rule.tableNames != nil {
+		if plan.Table == nil || !containsString(rule.tableNames, plan.Table.Name) {
+			return false
+		}
+	}
+	if rule.plans != nil {
+		found := false
+		for _, id := range rule.plans {
+			if id == plan.ID {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// queryRules is the list of rules of vtgate. The first rule that
+// matches a query decides if it is allowed. Queries that match no
+// rule are allowed.
+type queryRules struct {
+	path    string
+	matches *stats.Counters
+
+	// mu protects rules and data. data is the JSON the rules were
+	// parsed from.
+	mu    sync.Mutex
+	rules []*queryRule
+	data  []byte
+}
+
+func newQueryRules(path, matchesStatsName string) *queryRules {
+	return &queryRules{
+		path:    path,
+		matches: stats.NewCounters(matchesStatsName),
+	}
+}
+
+// load reads the rules from the file. The current rules are kept if
+// the file is invalid.
+func (qrs *queryRules) load() error {
+	if qrs.path == "" {
+		return nil
+	}
+	data, err := ioutil.ReadFile(qrs.path)
+	if err != nil {
+		return fmt.Errorf("cannot read query rules: %v", err)
+	}
+	rules, err := parseQueryRules(data)
+	if err != nil {
+		return err
+	}
+	qrs.mu.Lock()
+	defer qrs.mu.Unlock()
+	qrs.rules = rules
+	qrs.data = data
+	log.Infof("Loaded %v query rules from %v", len(rules), qrs.path)
+	return nil
+}
+
+// check returns an error if the first rule that matches the query
+// denies it. A nil queryRules allows all queries.
+func (qrs *queryRules) check(callerID, sql string, plan *planbuilder.Plan) error {
+	if qrs == nil {
+		return nil
+	}
+	qrs.mu.Lock()
+	rules := qrs.rules
+	qrs.mu.Unlock()
+	for _, rule := range rules {
+		if !rule.matches(callerID, sql, plan) {
+			continue
+		}
+		qrs.matches.Add(rule.name, 1)
+		switch rule.action {
+		case ruleDeny:
+			return fmt.Errorf("query denied by rule %v", rule.name)
+		case ruleDenyWithMessage:
+			return fmt.Errorf("query denied by rule %v: %v", rule.name, rule.message)
+		}
+		return nil
+	}
+	return nil
+}
+
+// ServeHTTP shows the rules, and reloads them from the file on a
+// POST.
+func (qrs *queryRules) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "POST" {
+		if err := acl.CheckAccessHTTP(r, acl.ADMIN); err != nil {
+			acl.SendError(w, err)
+			return
+		}
+		if err := qrs.load(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	} else if err := acl.CheckAccessHTTP(r, acl.DEBUGGING); err != nil {
+		acl.SendError(w, err)
+		return
+	}
+	qrs.mu.Lock()
+	data := qrs.data
+	qrs.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if data == nil {
+		data = []byte("[]\n")
+	}
+	w.Write(data)
+}
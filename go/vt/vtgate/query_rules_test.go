@@ -0,0 +1,220 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vtgate
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/vt/vtgate/proto"
+	"golang.org/x/net/context"
+)
+
+var testQueryRules = `[{
+	"Name": "no_full_delete",
+	"Description": "deletes need a where clause",
+	"Query": "(?i)delete from \\w+",
+	"Action": "DENY_WITH_MESSAGE",
+	"Message": "delete needs a where clause"
+}, {
+	"Name": "batch_user",
+	"CallerID": "batch",
+	"TableNames": ["user"],
+	"Plans": ["SelectScatter", "SelectIN"],
+	"Action": "DENY"
+}, {
+	"Name": "batch_others",
+	"CallerID": "batch",
+	"Action": "ALLOW"
+}]`
+
+func TestParseQueryRulesFail(t *testing.T) {
+	testCases := []struct {
+		data string
+		want string
+	}{{
+		data: "{",
+		want: "cannot parse query rules: unexpected end of JSON input",
+	}, {
+		data: `[{"Action": "ALLOW"}]`,
+		want: "query rule has no Name",
+	}, {
+		data: `[{"Name": "a", "Action": "ALLOW"}, {"Name": "a", "Action": "DENY"}]`,
+		want: "duplicate query rule a",
+	}, {
+		data: `[{"Name": "a", "Action": "REWRITE"}]`,
+		want: `query rule a: invalid Action "REWRITE"`,
+	}, {
+		data: `[{"Name": "a", "Action": "DENY_WITH_MESSAGE"}]`,
+		want: "query rule a: DENY_WITH_MESSAGE needs a Message",
+	}, {
+		data: `[{"Name": "a", "Action": "DENY", "CallerID": "("}]`,
+		want: "query rule a: invalid CallerID: error parsing regexp: missing closing ): `^(?:()$`",
+	}, {
+		data: `[{"Name": "a", "Action": "DENY", "Plans": ["SelectAll"]}]`,
+		want: "query rule a: invalid plan name SelectAll",
+	}}
+	for _, tcase := range testCases {
+		_, err := parseQueryRules([]byte(tcase.data))
+		if err == nil || err.Error() != tcase.want {
+			t.Errorf("parseQueryRules(%s): %v, want %v", tcase.data, err, tcase.want)
+		}
+	}
+}
+
+func TestQueryRulesCheck(t *testing.T) {
+	rules, err := parseQueryRules([]byte(testQueryRules))
+	if err != nil {
+		t.Fatalf("parseQueryRules failed: %v", err)
+	}
+	qrs := newQueryRules("", "")
+	qrs.rules = rules
+	planner := NewPlanner(routerSchema, 10)
+
+	testCases := []struct {
+		callerID string
+		sql      string
+		want     string
+	}{{
+		sql:  "delete from music_user_map",
+		want: "query denied by rule no_full_delete: delete needs a where clause",
+	}, {
+		sql: "delete from music_user_map where id = 1",
+	}, {
+		callerID: "batch",
+		sql:      "select * from user",
+		want:     "query denied by rule batch_user",
+	}, {
+		callerID: "batch",
+		sql:      "select * from user where id = 1",
+	}, {
+		callerID: "batch",
+		sql:      "select * from music",
+	}, {
+		callerID: "batch2",
+		sql:      "select * from user",
+	}}
+	for _, tcase := range testCases {
+		err := qrs.check(tcase.callerID, tcase.sql, planner.GetPlan(tcase.sql))
+		got := ""
+		if err != nil {
+			got = err.Error()
+		}
+		if got != tcase.want {
+			t.Errorf("check(%q, %q): %q, want %q", tcase.callerID, tcase.sql, got, tcase.want)
+		}
+	}
+	want := map[string]int64{
+		"no_full_delete": 1,
+		"batch_user":     1,
+		"batch_others":   2,
+	}
+	if got := qrs.matches.Counts(); !reflect.DeepEqual(got, want) {
+		t.Errorf("matches: %v, want %v", got, want)
+	}
+
+	// A nil queryRules allows everything.
+	var none *queryRules
+	if err := none.check("", "delete from music_user_map", planner.GetPlan("delete from music_user_map")); err != nil {
+		t.Errorf("nil check: %v", err)
+	}
+}
+
+func TestQueryRulesRouter(t *testing.T) {
+	router, sbc1, _, sbclookup := createRouterEnv()
+	router.rules = newQueryRules("", "")
+	rules, err := parseQueryRules([]byte(testQueryRules))
+	if err != nil {
+		t.Fatalf("parseQueryRules failed: %v", err)
+	}
+	router.rules.rules = rules
+
+	_, err = routerExec(router, "delete from music_user_map", nil)
+	want := "query denied by rule no_full_delete: delete needs a where clause"
+	if err == nil || err.Error() != want {
+		t.Errorf("routerExec: %v, want %v", err, want)
+	}
+	if sbclookup.ExecCount.Get() != 0 {
+		t.Errorf("sbclookup.ExecCount: %v, want 0", sbclookup.ExecCount.Get())
+	}
+
+	q := &proto.Query{
+		Sql:        "select * from user where id in (1, 3)",
+		TabletType: topo.TYPE_MASTER,
+		CallerID:   "batch",
+	}
+	_, err = routerStream(router, q)
+	want = "query denied by rule batch_user"
+	if err == nil || err.Error() != want {
+		t.Errorf("routerStream: %v, want %v", err, want)
+	}
+	q.CallerID = ""
+	if _, err := router.Execute(context.Background(), q); err != nil {
+		t.Errorf("Execute without caller id: %v", err)
+	}
+	if sbc1.ExecCount.Get() != 1 {
+		t.Errorf("sbc1.ExecCount: %v, want 1", sbc1.ExecCount.Get())
+	}
+}
+
+func TestQueryRulesReload(t *testing.T) {
+	f, err := ioutil.TempFile("", "query_rules")
+	if err != nil {
+		t.Fatalf("TempFile failed: %v", err)
+	}
+	defer os.Remove(f.Name())
+	f.Close()
+	if err := ioutil.WriteFile(f.Name(), []byte(testQueryRules), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	qrs := newQueryRules(f.Name(), "")
+	if err := qrs.load(); err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if len(qrs.rules) != 3 {
+		t.Errorf("rules: %v, want 3", len(qrs.rules))
+	}
+
+	w := httptest.NewRecorder()
+	qrs.ServeHTTP(w, &http.Request{Method: "GET", URL: &url.URL{Path: "/debug/query_rules"}})
+	if got := w.Body.String(); got != testQueryRules {
+		t.Errorf("GET: %q, want %q", got, testQueryRules)
+	}
+
+	// A bad file keeps the current rules.
+	if err := ioutil.WriteFile(f.Name(), []byte("["), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	w = httptest.NewRecorder()
+	r, _ := http.NewRequest("POST", "/debug/query_rules", nil)
+	qrs.ServeHTTP(w, r)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("POST with bad file: got code %v, want %v", w.Code, http.StatusBadRequest)
+	}
+	if len(qrs.rules) != 3 {
+		t.Errorf("rules after bad reload: %v, want 3", len(qrs.rules))
+	}
+
+	newRules := `[{"Name": "deny_all", "Action": "DENY"}]`
+	if err := ioutil.WriteFile(f.Name(), []byte(newRules), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	w = httptest.NewRecorder()
+	qrs.ServeHTTP(w, r)
+	if got := w.Body.String(); got != newRules {
+		t.Errorf("POST: %q, want %q", got, newRules)
+	}
+	err = qrs.check("", "select * from user", NewPlanner(routerSchema, 10).GetPlan("select * from user"))
+	if err == nil || !strings.Contains(err.Error(), "deny_all") {
+		t.Errorf("check after reload: %v, want deny_all", err)
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"fmt"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	mproto "github.com/youtube/vitess/go/mysql/proto"
@@ -39,13 +40,27 @@ var (
 // resharding happened.
 type Resolver struct {
 	scatterConn *ScatterConn
+
+	// routingCells are the other cells RoutingNearestCell can read
+	// from, nearest first. newScatterConn creates their ScatterConn.
+	routingCells   []string
+	newScatterConn func(cell string) *ScatterConn
+
+	// mu protects cellConns, the ScatterConns of the other cells.
+	mu        sync.Mutex
+	cellConns map[string]*ScatterConn
 }
 
 // NewResolver creates a new Resolver. All input parameters are passed through
 // for creating ScatterConn.
 func NewResolver(serv SrvTopoServer, statsName, cell string, retryDelay time.Duration, retryCount int, connTimeoutTotal, connTimeoutPerConn, connLife time.Duration) *Resolver {
 	return &Resolver{
-		scatterConn: NewScatterConn(serv, statsName, cell, retryDelay, retryCount, connTimeoutTotal, connTimeoutPerConn, connLife),
+		scatterConn:  NewScatterConn(serv, statsName, cell, retryDelay, retryCount, connTimeoutTotal, connTimeoutPerConn, connLife),
+		routingCells: parseRoutingCells(*routingCells),
+		newScatterConn: func(cell string) *ScatterConn {
+			return NewScatterConn(serv, "", cell, retryDelay, retryCount, connTimeoutTotal, connTimeoutPerConn, connLife)
+		},
+		cellConns: make(map[string]*ScatterConn),
 	}
 }
 
@@ -72,7 +87,8 @@ func isConnError(err error) (int, bool) {
 // ExecuteKeyspaceIds executes a non-streaming query based on KeyspaceIds.
 // It retries query if new keyspace/shards are re-resolved after a retryable error.
 // This throws an error if a dml spans multiple keyspace_ids. Resharding depends
-// on being able to uniquely route a write.
+// on being able to uniquely route a write. query.TabletType is set to the
+// tablet type picked by the routing policy of the query.
 func (res *Resolver) ExecuteKeyspaceIds(ctx context.Context, query *proto.KeyspaceIdQuery) (*mproto.QueryResult, error) {
 	if isDml(query.Sql) && len(query.KeyspaceIds) > 1 {
 		return nil, fmt.Errorf("DML should not span multiple keyspace_ids")
@@ -86,11 +102,15 @@ func (res *Resolver) ExecuteKeyspaceIds(ctx context.Context, query *proto.Keyspa
 			query.TabletType,
 			query.KeyspaceIds)
 	}
-	return res.Execute(ctx, query.Sql, query.BindVariables, query.Keyspace, query.TabletType, query.Session, mapToShards, query.NotInTransaction)
+	qr, tabletType, err := res.Execute(ctx, query.Sql, query.BindVariables, query.Keyspace, query.TabletType, query.Session, mapToShards, query.NotInTransaction, query.RoutingPolicy, query.AllowMasterFallback)
+	query.TabletType = tabletType
+	return qr, err
 }
 
 // ExecuteKeyRanges executes a non-streaming query based on KeyRanges.
 // It retries query if new keyspace/shards are re-resolved after a retryable error.
+// query.TabletType is set to the tablet type picked by the routing policy
+// of the query.
 func (res *Resolver) ExecuteKeyRanges(ctx context.Context, query *proto.KeyRangeQuery) (*mproto.QueryResult, error) {
 	mapToShards := func(keyspace string) (string, []string, error) {
 		return mapKeyRangesToShards(
@@ -101,11 +121,15 @@ func (res *Resolver) ExecuteKeyRanges(ctx context.Context, query *proto.KeyRange
 			query.TabletType,
 			query.KeyRanges)
 	}
-	return res.Execute(ctx, query.Sql, query.BindVariables, query.Keyspace, query.TabletType, query.Session, mapToShards, query.NotInTransaction)
+	qr, tabletType, err := res.Execute(ctx, query.Sql, query.BindVariables, query.Keyspace, query.TabletType, query.Session, mapToShards, query.NotInTransaction, query.RoutingPolicy, query.AllowMasterFallback)
+	query.TabletType = tabletType
+	return qr, err
 }
 
 // Execute executes a non-streaming query based on shards resolved by given func.
 // It retries query if new keyspace/shards are re-resolved after a retryable error.
+// The query is sent to the cell and tablet type picked by policy, and the
+// tablet type is returned.
 func (res *Resolver) Execute(
 	ctx context.Context,
 	sql string,
@@ -115,26 +139,30 @@ func (res *Resolver) Execute(
 	session *proto.Session,
 	mapToShards func(string) (string, []string, error),
 	notInTransaction bool,
-) (*mproto.QueryResult, error) {
+	policy proto.RoutingPolicy,
+	allowMaster bool,
+) (*mproto.QueryResult, topo.TabletType, error) {
 	keyspace, shards, err := mapToShards(keyspace)
 	if err != nil {
-		return nil, err
+		return nil, tabletType, err
 	}
+	r := res.pickRoute(ctx, keyspace, shards, res.routes(tabletType, policy, allowMaster, session))
+	stc := res.scatterConnForCell(r.cell)
 	for {
-		qr, err := res.scatterConn.Execute(
+		qr, err := stc.Execute(
 			ctx,
 			sql,
 			bindVars,
 			keyspace,
 			shards,
-			tabletType,
+			r.tabletType,
 			NewSafeSession(session),
 			notInTransaction)
 		if connErrorCode, ok := isConnError(err); ok && connErrorCode == tabletconn.ERR_RETRY {
 			resharding := false
 			newKeyspace, newShards, err := mapToShards(keyspace)
 			if err != nil {
-				return nil, err
+				return nil, r.tabletType, err
 			}
 			// check keyspace change for vertical resharding
 			if newKeyspace != keyspace {
@@ -152,14 +180,16 @@ func (res *Resolver) Execute(
 			}
 		}
 		if err != nil {
-			return nil, err
+			return nil, r.tabletType, err
 		}
-		return qr, err
+		return qr, r.tabletType, err
 	}
 }
 
 // ExecuteEntityIds executes a non-streaming query based on given KeyspaceId map.
 // It retries query if new keyspace/shards are re-resolved after a retryable error.
+// query.TabletType is set to the tablet type picked by the routing policy
+// of the query.
 func (res *Resolver) ExecuteEntityIds(
 	ctx context.Context,
 	query *proto.EntityIdsQuery,
@@ -176,8 +206,11 @@ func (res *Resolver) ExecuteEntityIds(
 	}
 	query.Keyspace = newKeyspace
 	shards, sqls, bindVars := buildEntityIds(shardIDMap, query.Sql, query.EntityColumnName, query.BindVariables)
+	r := res.pickRoute(ctx, query.Keyspace, shards, res.routes(query.TabletType, query.RoutingPolicy, query.AllowMasterFallback, query.Session))
+	query.TabletType = r.tabletType
+	stc := res.scatterConnForCell(r.cell)
 	for {
-		qr, err := res.scatterConn.ExecuteEntityIds(
+		qr, err := stc.ExecuteEntityIds(
 			ctx,
 			shards,
 			sqls,
@@ -290,12 +323,78 @@ func (res *Resolver) ExecuteBatch(
 	}
 }
 
+// ExecuteBatchShards executes a batch of queries, each on its own
+// keyspace and shards. See ScatterConn.ExecuteBatchShards.
+func (res *Resolver) ExecuteBatchShards(ctx context.Context, queries []proto.BoundShardQuery, tabletType topo.TabletType, session *proto.Session, notInTransaction bool) ([]mproto.QueryResult, []error) {
+	return res.scatterConn.ExecuteBatchShards(ctx, queries, tabletType, NewSafeSession(session), notInTransaction)
+}
+
+// ExecuteBatchKeyspaceIdQueries executes a batch of queries, each on
+// the shards of its own keyspace ids. A query whose keyspace ids
+// cannot be resolved fails on its own. The queries that get a
+// retryable error are retried if new keyspace/shards are re-resolved.
+func (res *Resolver) ExecuteBatchKeyspaceIdQueries(ctx context.Context, queries []proto.BoundKeyspaceIdQuery, tabletType topo.TabletType, session *proto.Session, notInTransaction bool) ([]mproto.QueryResult, []error) {
+	results := make([]mproto.QueryResult, len(queries))
+	errs := make([]error, len(queries))
+	shardQueries := make([]proto.BoundShardQuery, len(queries))
+	mapToShards := func(i int) error {
+		keyspace, shards, err := mapKeyspaceIdsToShards(
+			ctx,
+			res.scatterConn.toposerv,
+			res.scatterConn.cell,
+			queries[i].Keyspace,
+			tabletType,
+			queries[i].KeyspaceIds)
+		if err != nil {
+			return err
+		}
+		shardQueries[i] = proto.BoundShardQuery{
+			Sql:           queries[i].Sql,
+			BindVariables: queries[i].BindVariables,
+			Keyspace:      keyspace,
+			Shards:        shards,
+		}
+		return nil
+	}
+	var pending []int
+	for i := range queries {
+		if errs[i] = mapToShards(i); errs[i] == nil {
+			pending = append(pending, i)
+		}
+	}
+
+	safeSession := NewSafeSession(session)
+	for len(pending) > 0 {
+		batch := make([]proto.BoundShardQuery, len(pending))
+		for j, i := range pending {
+			batch[j] = shardQueries[i]
+		}
+		qrs, batchErrs := res.scatterConn.ExecuteBatchShards(ctx, batch, tabletType, safeSession, notInTransaction)
+		var retry []int
+		for j, i := range pending {
+			results[i], errs[i] = qrs[j], batchErrs[j]
+			if connErrorCode, ok := isConnError(errs[i]); !ok || connErrorCode != tabletconn.ERR_RETRY {
+				continue
+			}
+			previous := shardQueries[i]
+			if err := mapToShards(i); err != nil {
+				errs[i] = err
+				continue
+			}
+			// retry if resharding happened
+			if shardQueries[i].Keyspace != previous.Keyspace || !StrsEquals(shardQueries[i].Shards, previous.Shards) {
+				retry = append(retry, i)
+			}
+		}
+		pending = retry
+	}
+	return results, errs
+}
+
 // StreamExecuteKeyspaceIds executes a streaming query on the specified KeyspaceIds.
 // The KeyspaceIds are resolved to shards using the serving graph.
-// This function currently temporarily enforces the restriction of executing on
-// one shard since it cannot merge-sort the results to guarantee ordering of
-// response which is needed for checkpointing.
-// The api supports supplying multiple KeyspaceIds to make it future proof.
+// If query.OrderedMerge is set, the rows of the shards are merged on
+// the ORDER BY columns of the query.
 func (res *Resolver) StreamExecuteKeyspaceIds(ctx context.Context, query *proto.KeyspaceIdQuery, sendReply func(*mproto.QueryResult) error) error {
 	mapToShards := func(keyspace string) (string, []string, error) {
 		return mapKeyspaceIdsToShards(
@@ -306,15 +405,13 @@ func (res *Resolver) StreamExecuteKeyspaceIds(ctx context.Context, query *proto.
 			query.TabletType,
 			query.KeyspaceIds)
 	}
-	return res.StreamExecute(ctx, query.Sql, query.BindVariables, query.Keyspace, query.TabletType, query.Session, mapToShards, sendReply, query.NotInTransaction)
+	return res.StreamExecute(ctx, query.Sql, query.BindVariables, query.Keyspace, query.TabletType, query.Session, mapToShards, sendReply, query.NotInTransaction, query.OrderedMerge)
 }
 
 // StreamExecuteKeyRanges executes a streaming query on the specified KeyRanges.
 // The KeyRanges are resolved to shards using the serving graph.
-// This function currently temporarily enforces the restriction of executing on
-// one shard since it cannot merge-sort the results to guarantee ordering of
-// response which is needed for checkpointing.
-// The api supports supplying multiple keyranges to make it future proof.
+// If query.OrderedMerge is set, the rows of the shards are merged on
+// the ORDER BY columns of the query.
 func (res *Resolver) StreamExecuteKeyRanges(ctx context.Context, query *proto.KeyRangeQuery, sendReply func(*mproto.QueryResult) error) error {
 	mapToShards := func(keyspace string) (string, []string, error) {
 		return mapKeyRangesToShards(
@@ -325,13 +422,13 @@ func (res *Resolver) StreamExecuteKeyRanges(ctx context.Context, query *proto.Ke
 			query.TabletType,
 			query.KeyRanges)
 	}
-	return res.StreamExecute(ctx, query.Sql, query.BindVariables, query.Keyspace, query.TabletType, query.Session, mapToShards, sendReply, query.NotInTransaction)
+	return res.StreamExecute(ctx, query.Sql, query.BindVariables, query.Keyspace, query.TabletType, query.Session, mapToShards, sendReply, query.NotInTransaction, query.OrderedMerge)
 }
 
 // StreamExecute executes a streaming query on shards resolved by given func.
-// This function currently temporarily enforces the restriction of executing on
-// one shard since it cannot merge-sort the results to guarantee ordering of
-// response which is needed for checkpointing.
+// If orderedMerge is set and the query runs on more than one shard,
+// the rows of the shards are merged on the ORDER BY columns of the query,
+// otherwise they are sent as they arrive.
 func (res *Resolver) StreamExecute(
 	ctx context.Context,
 	sql string,
@@ -342,12 +439,17 @@ func (res *Resolver) StreamExecute(
 	mapToShards func(string) (string, []string, error),
 	sendReply func(*mproto.QueryResult) error,
 	notInTransaction bool,
+	orderedMerge bool,
 ) error {
 	keyspace, shards, err := mapToShards(keyspace)
 	if err != nil {
 		return err
 	}
-	err = res.scatterConn.StreamExecute(
+	streamExecute := res.scatterConn.StreamExecute
+	if orderedMerge && len(unique(shards)) > 1 {
+		streamExecute = res.scatterConn.StreamExecuteOrdered
+	}
+	err = streamExecute(
 		ctx,
 		sql,
 		bindVars,
@@ -123,6 +123,68 @@ func TestResolverExecuteBatchKeyspaceIds(t *testing.T) {
 	})
 }
 
+func TestResolverExecuteBatchKeyspaceIdQueries(t *testing.T) {
+	name := "TestResolverExecuteBatchKeyspaceIdQueries"
+	s := createSandbox(name)
+	sbc0 := &sandboxConn{}
+	s.MapTestConn("-20", sbc0)
+	sbc1 := &sandboxConn{mustFailRetry: 1}
+	s.MapTestConn("20-40", sbc1)
+	failing := createSandbox(name + "Failing")
+	failing.SrvKeyspaceMustFail = 1
+	kid10, err := key.HexKeyspaceId("10").Unhex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	kid25, err := key.HexKeyspaceId("25").Unhex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	i := 0
+	s.SrvKeyspaceCallback = func() {
+		if i == 2 {
+			s.ShardSpec = "-20-30-40-60-80-a0-c0-e0-"
+			s.MapTestConn("-20", sbc0)
+			s.MapTestConn("20-30", sbc1)
+		}
+		i++
+	}
+	queries := []proto.BoundKeyspaceIdQuery{{
+		Sql:         "query0",
+		Keyspace:    name,
+		KeyspaceIds: []key.KeyspaceId{kid10},
+	}, {
+		Sql:         "query1",
+		Keyspace:    name,
+		KeyspaceIds: []key.KeyspaceId{kid25},
+	}, {
+		Sql:         "query2",
+		Keyspace:    name + "Failing",
+		KeyspaceIds: []key.KeyspaceId{kid10},
+	}}
+	res := NewResolver(new(sandboxTopo), "", "aa", 1*time.Millisecond, 0, 2*time.Millisecond, 1*time.Millisecond, 24*time.Hour)
+	qrs, errs := res.ExecuteBatchKeyspaceIdQueries(context.Background(), queries, topo.TYPE_MASTER, nil, false)
+	for i := 0; i < 2; i++ {
+		if errs[i] != nil {
+			t.Errorf("errs[%d]: %v", i, errs[i])
+		}
+		if qrs[i].RowsAffected != 1 {
+			t.Errorf("qrs[%d]: want 1, got %v", i, qrs[i].RowsAffected)
+		}
+	}
+	want := "topo error GetSrvKeyspace"
+	if errs[2] == nil || !strings.Contains(errs[2].Error(), want) {
+		t.Errorf("errs[2]: %v, want %v", errs[2], want)
+	}
+	// Only the query that failed was sent again, after resharding.
+	if sbc0.ExecCount.Get() != 1 {
+		t.Errorf("want 1, got %v", sbc0.ExecCount.Get())
+	}
+	if sbc1.ExecCount.Get() != 2 {
+		t.Errorf("want 2, got %v", sbc1.ExecCount.Get())
+	}
+}
+
 func TestResolverStreamExecuteKeyspaceIds(t *testing.T) {
 	kid10, err := key.HexKeyspaceId("10").Unhex()
 	if err != nil {
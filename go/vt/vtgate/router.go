@@ -8,6 +8,8 @@ package vtgate
 
 import (
 	"fmt"
+	"sort"
+	"time"
 
 	mproto "github.com/youtube/vitess/go/mysql/proto"
 	"github.com/youtube/vitess/go/vt/key"
@@ -29,6 +31,8 @@ type Router struct {
 	cell        string
 	planner     *Planner
 	scatterConn *ScatterConn
+	// rules, if set, are checked before a query is routed.
+	rules *queryRules
 }
 
 type scatterParams struct {
@@ -53,7 +57,7 @@ func NewRouter(serv SrvTopoServer, cell string, schema *planbuilder.Schema, stat
 	return &Router{
 		serv:        serv,
 		cell:        cell,
-		planner:     NewPlanner(schema, 5000),
+		planner:     NewPlanner(schema, *planCacheSize),
 		scatterConn: scatterConn,
 	}
 }
@@ -64,15 +68,34 @@ func (rtr *Router) Execute(ctx context.Context, query *proto.Query) (*mproto.Que
 		query.BindVariables = make(map[string]interface{})
 	}
 	vcursor := newRequestContext(ctx, query, rtr)
-	plan := rtr.planner.GetPlan(string(query.Sql))
+	cp := rtr.planner.getPlan(string(query.Sql))
+	startTime := time.Now()
+	qr, shards, err := rtr.execute(vcursor, cp.plan)
+	var rows int64
+	if qr != nil {
+		rows = int64(qr.RowsAffected)
+	}
+	cp.stats.add(shards, time.Now().Sub(startTime), rows, err)
+	return qr, err
+}
 
+// execute executes a non-streaming query, and returns the number of
+// shards it was sent to.
+func (rtr *Router) execute(vcursor *requestContext, plan *planbuilder.Plan) (*mproto.QueryResult, int, error) {
+	query := vcursor.query
+	if err := rtr.rules.check(query.CallerID, query.Sql, plan); err != nil {
+		return nil, 0, err
+	}
 	switch plan.ID {
 	case planbuilder.UpdateEqual:
-		return rtr.execUpdateEqual(vcursor, plan)
+		qr, err := rtr.execUpdateEqual(vcursor, plan)
+		return qr, 1, err
 	case planbuilder.DeleteEqual:
-		return rtr.execDeleteEqual(vcursor, plan)
+		qr, err := rtr.execDeleteEqual(vcursor, plan)
+		return qr, 1, err
 	case planbuilder.InsertSharded:
-		return rtr.execInsertSharded(vcursor, plan)
+		qr, err := rtr.execInsertSharded(vcursor, plan)
+		return qr, 1, err
 	}
 
 	var err error
@@ -90,13 +113,13 @@ func (rtr *Router) Execute(ctx context.Context, query *proto.Query) (*mproto.Que
 	case planbuilder.SelectScatter:
 		params, err = rtr.paramsSelectScatter(vcursor, plan)
 	default:
-		return nil, fmt.Errorf("cannot route query: %s: %s", query.Sql, plan.Reason)
+		return nil, 0, fmt.Errorf("cannot route query: %s: %s", query.Sql, plan.Reason)
 	}
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
-	return rtr.scatterConn.ExecuteMulti(
-		ctx,
+	qr, err := rtr.scatterConn.ExecuteMulti(
+		vcursor.ctx,
 		params.query,
 		params.ks,
 		params.shardVars,
@@ -104,6 +127,13 @@ func (rtr *Router) Execute(ctx context.Context, query *proto.Query) (*mproto.Que
 		NewSafeSession(vcursor.query.Session),
 		query.NotInTransaction,
 	)
+	if err != nil || len(plan.Aggregates) == 0 {
+		return qr, len(params.shardVars), err
+	}
+	if err := aggregateResult(qr, plan.Aggregates); err != nil {
+		return nil, len(params.shardVars), err
+	}
+	return qr, len(params.shardVars), nil
 }
 
 // StreamExecute executes a streaming query.
@@ -112,8 +142,26 @@ func (rtr *Router) StreamExecute(ctx context.Context, query *proto.Query, sendRe
 		query.BindVariables = make(map[string]interface{})
 	}
 	vcursor := newRequestContext(ctx, query, rtr)
-	plan := rtr.planner.GetPlan(string(query.Sql))
+	cp := rtr.planner.getPlan(string(query.Sql))
+	startTime := time.Now()
+	// The replies are sent one at a time, so rows needs no locking.
+	var rows int64
+	shards, err := rtr.streamExecute(vcursor, cp.plan, func(qr *mproto.QueryResult) error {
+		rows += int64(len(qr.Rows))
+		return sendReply(qr)
+	})
+	cp.stats.add(shards, time.Now().Sub(startTime), rows, err)
+	return err
+}
 
+// streamExecute executes a streaming query, and returns the number of
+// shards it was sent to.
+func (rtr *Router) streamExecute(vcursor *requestContext, plan *planbuilder.Plan, sendReply func(*mproto.QueryResult) error) (int, error) {
+	ctx := vcursor.ctx
+	query := vcursor.query
+	if err := rtr.rules.check(query.CallerID, query.Sql, plan); err != nil {
+		return 0, err
+	}
 	var err error
 	var params *scatterParams
 	switch plan.ID {
@@ -127,22 +175,144 @@ func (rtr *Router) StreamExecute(ctx context.Context, query *proto.Query, sendRe
 		params, err = rtr.paramsSelectKeyrange(vcursor, plan)
 	case planbuilder.SelectScatter:
 		params, err = rtr.paramsSelectScatter(vcursor, plan)
+	case planbuilder.NoPlan:
+		return 0, fmt.Errorf("cannot route query: %s: %s", query.Sql, plan.Reason)
 	default:
-		return fmt.Errorf("query %q cannot be used for streaming", query.Sql)
+		return 0, fmt.Errorf("query %q cannot be used for streaming", query.Sql)
 	}
 	if err != nil {
-		return err
-	}
-	return rtr.scatterConn.StreamExecuteMulti(
+		return 0, err
+	}
+	shards := len(params.shardVars)
+	if len(plan.Aggregates) == 0 {
+		return shards, rtr.scatterConn.StreamExecuteMulti(
+			ctx,
+			params.query,
+			params.ks,
+			params.shardVars,
+			query.TabletType,
+			NewSafeSession(vcursor.query.Session),
+			sendReply,
+			query.NotInTransaction,
+		)
+	}
+	// The per-shard rows can only be combined once all the
+	// shards are done, so the result is sent in one reply.
+	qr := &mproto.QueryResult{}
+	err = rtr.scatterConn.StreamExecuteMulti(
 		ctx,
 		params.query,
 		params.ks,
 		params.shardVars,
 		query.TabletType,
 		NewSafeSession(vcursor.query.Session),
-		sendReply,
+		func(reply *mproto.QueryResult) error {
+			if qr.Fields == nil {
+				qr.Fields = reply.Fields
+			}
+			qr.Rows = append(qr.Rows, reply.Rows...)
+			return nil
+		},
 		query.NotInTransaction,
 	)
+	if err != nil {
+		return shards, err
+	}
+	if err := aggregateResult(qr, plan.Aggregates); err != nil {
+		return shards, err
+	}
+	return shards, sendReply(qr)
+}
+
+// Explain returns the routing decision for a query, without
+// executing it. Lookup vindexes are still read to find the shards.
+func (rtr *Router) Explain(ctx context.Context, query *proto.Query) (*proto.ExplainResult, error) {
+	if query.BindVariables == nil {
+		query.BindVariables = make(map[string]interface{})
+	}
+	vcursor := newRequestContext(ctx, query, rtr)
+	plan := rtr.planner.GetPlan(string(query.Sql))
+	result := &proto.ExplainResult{
+		PlanID: plan.ID.String(),
+		Reason: plan.Reason,
+	}
+	if plan.Table != nil {
+		result.Table = plan.Table.Name
+	}
+
+	var err error
+	var params *scatterParams
+	switch plan.ID {
+	case planbuilder.SelectUnsharded, planbuilder.UpdateUnsharded,
+		planbuilder.DeleteUnsharded, planbuilder.InsertUnsharded:
+		params, err = rtr.paramsUnsharded(vcursor, plan)
+	case planbuilder.SelectEqual:
+		params, err = rtr.paramsSelectEqual(vcursor, plan)
+	case planbuilder.SelectIN:
+		params, err = rtr.paramsSelectIN(vcursor, plan)
+	case planbuilder.SelectKeyrange:
+		params, err = rtr.paramsSelectKeyrange(vcursor, plan)
+	case planbuilder.SelectScatter:
+		params, err = rtr.paramsSelectScatter(vcursor, plan)
+	case planbuilder.UpdateEqual, planbuilder.DeleteEqual:
+		params, err = rtr.paramsDMLEqual(vcursor, plan)
+	case planbuilder.InsertSharded:
+		params, err = rtr.paramsInsertSharded(vcursor, plan)
+	default:
+		return result, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	result.Keyspace = params.ks
+	result.Query = params.query
+	for shard := range params.shardVars {
+		result.Shards = append(result.Shards, shard)
+	}
+	sort.Strings(result.Shards)
+	return result, nil
+}
+
+// paramsDMLEqual returns the routing of an UpdateEqual or DeleteEqual
+// plan. It has no shard if the row does not exist.
+func (rtr *Router) paramsDMLEqual(vcursor *requestContext, plan *planbuilder.Plan) (*scatterParams, error) {
+	keys, err := rtr.resolveKeys([]interface{}{plan.Values}, vcursor.query.BindVariables)
+	if err != nil {
+		return nil, fmt.Errorf("paramsDMLEqual: %v", err)
+	}
+	ks, shard, ksid, err := rtr.resolveSingleShard(vcursor, keys[0], plan)
+	if err != nil {
+		return nil, fmt.Errorf("paramsDMLEqual: %v", err)
+	}
+	if ksid == key.MinKey {
+		return newScatterParams(plan.Rewritten, plan.Table.Keyspace.Name, vcursor.query.BindVariables, nil), nil
+	}
+	return newScatterParams(plan.Rewritten+fmt.Sprintf(dmlPostfix, ksid), ks, vcursor.query.BindVariables, []string{shard}), nil
+}
+
+// paramsInsertSharded returns the routing of an InsertSharded plan.
+// Unlike execInsertSharded, it does not create the vindex entries.
+func (rtr *Router) paramsInsertSharded(vcursor *requestContext, plan *planbuilder.Plan) (*scatterParams, error) {
+	keys, err := rtr.resolveKeys(plan.Values.([]interface{}), vcursor.query.BindVariables)
+	if err != nil {
+		return nil, fmt.Errorf("paramsInsertSharded: %v", err)
+	}
+	colVindex := plan.Table.ColVindexes[0]
+	if keys[0] == nil {
+		return nil, fmt.Errorf("paramsInsertSharded: the value of column %s is only known once it is generated", colVindex.Col)
+	}
+	ksids, err := colVindex.Vindex.(planbuilder.Unique).Map(vcursor, []interface{}{keys[0]})
+	if err != nil {
+		return nil, fmt.Errorf("paramsInsertSharded: %v", err)
+	}
+	if ksids[0] == key.MinKey {
+		return nil, fmt.Errorf("paramsInsertSharded: could not map %v to a keyspace id", keys[0])
+	}
+	ks, shard, err := rtr.getRouting(vcursor.ctx, plan.Table.Keyspace.Name, vcursor.query.TabletType, ksids[0])
+	if err != nil {
+		return nil, fmt.Errorf("paramsInsertSharded: %v", err)
+	}
+	return newScatterParams(plan.Rewritten+fmt.Sprintf(dmlPostfix, ksids[0]), ks, vcursor.query.BindVariables, []string{shard}), nil
 }
 
 func (rtr *Router) paramsUnsharded(vcursor *requestContext, plan *planbuilder.Plan) (*scatterParams, error) {
@@ -0,0 +1,129 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vtgate
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/vt/vtgate/proto"
+	"golang.org/x/net/context"
+)
+
+func routerExplain(router *Router, sql string, bv map[string]interface{}) (*proto.ExplainResult, error) {
+	return router.Explain(context.Background(), &proto.Query{
+		Sql:           sql,
+		BindVariables: bv,
+		TabletType:    topo.TYPE_MASTER,
+	})
+}
+
+func TestExplain(t *testing.T) {
+	router, sbc1, sbc2, sbclookup := createRouterEnv()
+
+	testCases := []struct {
+		sql  string
+		want *proto.ExplainResult
+	}{{
+		sql: "select * from music_user_map where id = 1",
+		want: &proto.ExplainResult{
+			PlanID:   "SelectUnsharded",
+			Table:    "music_user_map",
+			Keyspace: KsTestUnsharded,
+			Shards:   []string{"0"},
+			Query:    "select * from music_user_map where id = 1",
+		},
+	}, {
+		sql: "select * from user where id = 1",
+		want: &proto.ExplainResult{
+			PlanID:   "SelectEqual",
+			Table:    "user",
+			Keyspace: "TestRouter",
+			Shards:   []string{"-20"},
+			Query:    "select * from user where id = 1",
+		},
+	}, {
+		sql: "select * from user where id in (1, 3)",
+		want: &proto.ExplainResult{
+			PlanID:   "SelectIN",
+			Table:    "user",
+			Keyspace: "TestRouter",
+			Shards:   []string{"-20", "40-60"},
+			Query:    "select * from user where id in ::_vals",
+		},
+	}, {
+		sql: "select * from user",
+		want: &proto.ExplainResult{
+			PlanID:   "SelectScatter",
+			Table:    "user",
+			Keyspace: "TestRouter",
+			Shards:   []string{"-20", "20-40", "40-60", "60-80", "80-a0", "a0-c0", "c0-e0", "e0-"},
+			Query:    "select * from user",
+		},
+	}, {
+		sql: "update user set a = 2 where id = 3",
+		want: &proto.ExplainResult{
+			PlanID:   "UpdateEqual",
+			Table:    "user",
+			Keyspace: "TestRouter",
+			Shards:   []string{"40-60"},
+			Query:    "update user set a = 2 where id = 3 /* _routing keyspace_id:4eb190c9a2fa169c */",
+		},
+	}, {
+		sql: "insert into user(id, v, name) values (1, 2, 'myname')",
+		want: &proto.ExplainResult{
+			PlanID:   "InsertSharded",
+			Table:    "user",
+			Keyspace: "TestRouter",
+			Shards:   []string{"-20"},
+			Query:    "insert into user(id, v, name) values (:_id, 2, :_name) /* _routing keyspace_id:166b40b44aba4bd6 */",
+		},
+	}, {
+		sql: "select * from user where id = (select count(*) from music)",
+		want: &proto.ExplainResult{
+			PlanID: "NoPlan",
+			Reason: "has subquery",
+			Table:  "user",
+		},
+	}}
+	for _, tcase := range testCases {
+		got, err := routerExplain(router, tcase.sql, nil)
+		if err != nil {
+			t.Errorf("routerExplain(%q): %v", tcase.sql, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tcase.want) {
+			t.Errorf("routerExplain(%q): %+v, want %+v", tcase.sql, got, tcase.want)
+		}
+	}
+	if sbc1.ExecCount.Get() != 0 || sbc2.ExecCount.Get() != 0 {
+		t.Errorf("ExecCount: %v, %v, want 0, 0", sbc1.ExecCount.Get(), sbc2.ExecCount.Get())
+	}
+	// The lookup vindexes are read, but not written.
+	for _, query := range sbclookup.Queries {
+		if query.Sql[:6] != "select" {
+			t.Errorf("sbclookup.Queries: %+v, want only selects", sbclookup.Queries)
+			break
+		}
+	}
+}
+
+func TestExplainFail(t *testing.T) {
+	router, _, _, _ := createRouterEnv()
+
+	_, err := routerExplain(router, "insert into user(v, name) values (2, 'myname')", nil)
+	want := "paramsInsertSharded: the value of column id is only known once it is generated"
+	if err == nil || err.Error() != want {
+		t.Errorf("routerExplain: %v, want %v", err, want)
+	}
+
+	getSandbox(KsTestUnsharded).SrvKeyspaceMustFail = 1
+	_, err = routerExplain(router, "select * from music_user_map where id = 1", nil)
+	want = "paramsUnsharded: keyspace TestUnsharded fetch error: topo error GetSrvKeyspace"
+	if err == nil || err.Error() != want {
+		t.Errorf("routerExplain: %v, want %v", err, want)
+	}
+}
@@ -5,6 +5,7 @@
 package vtgate
 
 import (
+	"fmt"
 	"reflect"
 	"strings"
 	"testing"
@@ -132,6 +133,16 @@ func TestStreamUnshardedFail(t *testing.T) {
 	if err == nil || err.Error() != want {
 		t.Errorf("routerExec: %v, want %v", err, want)
 	}
+
+	q = proto.Query{
+		Sql:        "select * from user where id = (select count(*) from music)",
+		TabletType: topo.TYPE_MASTER,
+	}
+	_, err = routerStream(router, &q)
+	want = "cannot route query: select * from user where id = (select count(*) from music): has subquery"
+	if err == nil || err.Error() != want {
+		t.Errorf("routerStream: %v, want %v", err, want)
+	}
 }
 
 func TestSelectEqual(t *testing.T) {
@@ -553,6 +564,62 @@ func TestSelectScatter(t *testing.T) {
 	}
 }
 
+func TestSelectScatterAggregates(t *testing.T) {
+	// Special setup: Don't use createRouterEnv.
+	s := createSandbox("TestRouter")
+	shards := []string{"-20", "20-40", "40-60", "60-80", "80-a0", "a0-c0", "c0-e0", "e0-"}
+	fields := []mproto.Field{
+		{Name: "count(*)", Type: mproto.VT_LONGLONG},
+		{Name: "max(id)", Type: mproto.VT_LONGLONG},
+	}
+	for i, shard := range shards {
+		sbc := &sandboxConn{}
+		// every shard returns its partial results twice: once for
+		// Execute, once for StreamExecute.
+		partial := &mproto.QueryResult{
+			Fields:       fields,
+			Rows:         [][]sqltypes.Value{{sqltypes.MakeNumeric([]byte("2")), sqltypes.MakeNumeric([]byte(fmt.Sprintf("%d", i)))}},
+			RowsAffected: 1,
+		}
+		sbc.setResults([]*mproto.QueryResult{partial, partial})
+		s.MapTestConn(shard, sbc)
+	}
+	serv := new(sandboxTopo)
+	scatterConn := NewScatterConn(serv, "", "aa", 1*time.Second, 10, 2*time.Millisecond, 1*time.Millisecond, 24*time.Hour)
+	router := NewRouter(serv, "aa", routerSchema, "", scatterConn)
+
+	wantResult := &mproto.QueryResult{
+		Fields:       fields,
+		Rows:         [][]sqltypes.Value{{sqltypes.MakeNumeric([]byte("16")), sqltypes.MakeNumeric([]byte("7"))}},
+		RowsAffected: 1,
+	}
+	result, err := routerExec(router, "select count(*), max(id) from user", nil)
+	if err != nil {
+		t.Error(err)
+	}
+	if !reflect.DeepEqual(result, wantResult) {
+		t.Errorf("result: %+v, want %+v", result, wantResult)
+	}
+
+	q := proto.Query{
+		Sql:        "select count(*), max(id) from user",
+		TabletType: topo.TYPE_MASTER,
+	}
+	result, err = routerStream(router, &q)
+	if err != nil {
+		t.Error(err)
+	}
+	if !reflect.DeepEqual(result, wantResult) {
+		t.Errorf("stream result: %+v, want %+v", result, wantResult)
+	}
+
+	_, err = routerExec(router, "select avg(id) from user", nil)
+	want := "cannot route query: select avg(id) from user: multi-shard query has an aggregate that cannot be combined: avg(id)"
+	if err == nil || err.Error() != want {
+		t.Errorf("routerExec: %v, want %v", err, want)
+	}
+}
+
 func TestStreamSelectScatter(t *testing.T) {
 	// Special setup: Don't use createRouterEnv.
 	s := createSandbox("TestRouter")
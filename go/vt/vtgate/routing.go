@@ -0,0 +1,125 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vtgate
+
+import (
+	"flag"
+	"strings"
+
+	"github.com/youtube/vitess/go/stats"
+	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/vt/vtgate/proto"
+	"golang.org/x/net/context"
+)
+
+// This file contains the routing policies that let a read use
+// another tablet type or cell than the requested one.
+
+var (
+	routingCells = flag.String("routing_cells", "", "comma separated list of the other cells, nearest first, that the reads with the NEAREST_CELL routing policy use when a shard has no serving end point in the cell of vtgate")
+
+	// routingFallbacks counts the reads that did not use the
+	// requested cell and tablet type.
+	routingFallbacks = stats.NewMultiCounters("VtgateRoutingFallbacks", []string{"Keyspace", "DbType", "RoutedCell", "RoutedDbType"})
+)
+
+// readFallbacks are the tablet types that RoutingPreferType reads
+// from, in order, when the requested one is not serving.
+var readFallbacks = map[topo.TabletType][]topo.TabletType{
+	topo.TYPE_REPLICA: {topo.TYPE_RDONLY},
+	topo.TYPE_RDONLY:  {topo.TYPE_REPLICA},
+}
+
+// route is a cell and tablet type that can serve a read.
+type route struct {
+	cell       string
+	tabletType topo.TabletType
+}
+
+func parseRoutingCells(value string) []string {
+	var cells []string
+	for _, cell := range strings.Split(value, ",") {
+		if cell = strings.TrimSpace(cell); cell != "" {
+			cells = append(cells, cell)
+		}
+	}
+	return cells
+}
+
+// routes returns the routes a read can use, in order of preference.
+// The first one is always the requested tablet type in the cell of
+// vtgate. A transaction only uses that one.
+func (res *Resolver) routes(tabletType topo.TabletType, policy proto.RoutingPolicy, allowMaster bool, session *proto.Session) []route {
+	local := res.scatterConn.cell
+	routes := []route{{cell: local, tabletType: tabletType}}
+	if session != nil && session.InTransaction {
+		return routes
+	}
+	switch policy {
+	case proto.RoutingPreferType:
+		if tabletType == topo.TYPE_MASTER {
+			break
+		}
+		for _, fallback := range readFallbacks[tabletType] {
+			routes = append(routes, route{cell: local, tabletType: fallback})
+		}
+		if allowMaster {
+			routes = append(routes, route{cell: local, tabletType: topo.TYPE_MASTER})
+		}
+	case proto.RoutingNearestCell:
+		for _, cell := range res.routingCells {
+			if cell != local {
+				routes = append(routes, route{cell: cell, tabletType: tabletType})
+			}
+		}
+	}
+	return routes
+}
+
+// pickRoute returns the first of routes where all the shards have a
+// serving end point. If there is none, it returns the first route,
+// so the read fails the way it would without a routing policy.
+func (res *Resolver) pickRoute(ctx context.Context, keyspace string, shards []string, routes []route) route {
+	if len(routes) == 1 {
+		return routes[0]
+	}
+	for _, r := range routes {
+		if res.serves(ctx, r, keyspace, shards) {
+			if r != routes[0] {
+				routingFallbacks.Add([]string{keyspace, string(routes[0].tabletType), r.cell, string(r.tabletType)}, 1)
+			}
+			return r
+		}
+	}
+	return routes[0]
+}
+
+// serves returns true if all the shards have a serving end point for
+// the route.
+func (res *Resolver) serves(ctx context.Context, r route, keyspace string, shards []string) bool {
+	for _, shard := range shards {
+		endPoints, err := res.scatterConn.toposerv.GetEndPoints(ctx, r.cell, keyspace, shard, r.tabletType)
+		if err != nil || len(endPoints.Entries) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// scatterConnForCell returns the ScatterConn that reads from cell.
+// The ScatterConns of the other cells are created on first use.
+func (res *Resolver) scatterConnForCell(cell string) *ScatterConn {
+	if cell == res.scatterConn.cell {
+		return res.scatterConn
+	}
+	res.mu.Lock()
+	defer res.mu.Unlock()
+	stc, ok := res.cellConns[cell]
+	if !ok {
+		stc = res.newScatterConn(cell)
+		res.cellConns[cell] = stc
+	}
+	return stc
+}
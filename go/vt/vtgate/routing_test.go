@@ -0,0 +1,169 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vtgate
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/youtube/vitess/go/vt/key"
+	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/vt/vtgate/proto"
+	"golang.org/x/net/context"
+)
+
+// This file uses the sandbox_test framework.
+
+// routingTopo is a sandboxTopo where only some cells and tablet
+// types have serving end points.
+type routingTopo struct {
+	sandboxTopo
+	// serving has the cell/tablet_type that have end points.
+	serving map[string]bool
+}
+
+func (rt *routingTopo) GetEndPoints(ctx context.Context, cell, keyspace, shard string, tabletType topo.TabletType) (*topo.EndPoints, error) {
+	if !rt.serving[cell+"/"+string(tabletType)] {
+		return &topo.EndPoints{}, nil
+	}
+	return rt.sandboxTopo.GetEndPoints(ctx, cell, keyspace, shard, tabletType)
+}
+
+func TestRoutes(t *testing.T) {
+	res := NewResolver(new(sandboxTopo), "", "aa", 1*time.Millisecond, 0, 2*time.Millisecond, 1*time.Millisecond, 24*time.Hour)
+	res.routingCells = []string{"bb", "aa", "cc"}
+	testCases := []struct {
+		tabletType  topo.TabletType
+		policy      proto.RoutingPolicy
+		allowMaster bool
+		session     *proto.Session
+		want        []route
+	}{{
+		tabletType: topo.TYPE_REPLICA,
+		policy:     proto.RoutingStrict,
+		want:       []route{{"aa", topo.TYPE_REPLICA}},
+	}, {
+		tabletType: topo.TYPE_REPLICA,
+		policy:     proto.RoutingPreferType,
+		want:       []route{{"aa", topo.TYPE_REPLICA}, {"aa", topo.TYPE_RDONLY}},
+	}, {
+		tabletType:  topo.TYPE_RDONLY,
+		policy:      proto.RoutingPreferType,
+		allowMaster: true,
+		want:        []route{{"aa", topo.TYPE_RDONLY}, {"aa", topo.TYPE_REPLICA}, {"aa", topo.TYPE_MASTER}},
+	}, {
+		tabletType:  topo.TYPE_MASTER,
+		policy:      proto.RoutingPreferType,
+		allowMaster: true,
+		want:        []route{{"aa", topo.TYPE_MASTER}},
+	}, {
+		tabletType: topo.TYPE_REPLICA,
+		policy:     proto.RoutingNearestCell,
+		want:       []route{{"aa", topo.TYPE_REPLICA}, {"bb", topo.TYPE_REPLICA}, {"cc", topo.TYPE_REPLICA}},
+	}, {
+		tabletType: topo.TYPE_REPLICA,
+		policy:     proto.RoutingPreferType,
+		session:    &proto.Session{InTransaction: true},
+		want:       []route{{"aa", topo.TYPE_REPLICA}},
+	}}
+	for _, tcase := range testCases {
+		got := res.routes(tcase.tabletType, tcase.policy, tcase.allowMaster, tcase.session)
+		if !reflect.DeepEqual(got, tcase.want) {
+			t.Errorf("routes(%v, %v, %v): %v, want %v", tcase.tabletType, tcase.policy, tcase.allowMaster, got, tcase.want)
+		}
+	}
+}
+
+func TestResolverRouting(t *testing.T) {
+	kid10, err := key.HexKeyspaceId("10").Unhex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCases := []struct {
+		name        string
+		serving     []string
+		policy      proto.RoutingPolicy
+		allowMaster bool
+		// want is the tablet type that serves the read, and "" if
+		// it fails.
+		want   topo.TabletType
+		wantBB bool
+	}{{
+		name:    "strict",
+		serving: []string{"aa/rdonly"},
+		policy:  proto.RoutingStrict,
+	}, {
+		name:    "prefer type",
+		serving: []string{"aa/replica", "aa/rdonly"},
+		policy:  proto.RoutingPreferType,
+		want:    topo.TYPE_REPLICA,
+	}, {
+		name:    "prefer type fallback",
+		serving: []string{"aa/rdonly"},
+		policy:  proto.RoutingPreferType,
+		want:    topo.TYPE_RDONLY,
+	}, {
+		name:    "no master fallback",
+		serving: []string{"aa/master"},
+		policy:  proto.RoutingPreferType,
+	}, {
+		name:        "master fallback",
+		serving:     []string{"aa/master"},
+		policy:      proto.RoutingPreferType,
+		allowMaster: true,
+		want:        topo.TYPE_MASTER,
+	}, {
+		name:    "nearest cell",
+		serving: []string{"bb/replica"},
+		policy:  proto.RoutingNearestCell,
+		want:    topo.TYPE_REPLICA,
+		wantBB:  true,
+	}}
+	for _, tcase := range testCases {
+		s := createSandbox("TestResolverRouting")
+		sbc := &sandboxConn{}
+		s.MapTestConn("-20", sbc)
+		serv := &routingTopo{serving: make(map[string]bool)}
+		for _, cellType := range tcase.serving {
+			serv.serving[cellType] = true
+		}
+		res := NewResolver(serv, "", "aa", 1*time.Millisecond, 0, 2*time.Millisecond, 1*time.Millisecond, 24*time.Hour)
+		res.routingCells = []string{"bb"}
+		query := &proto.KeyspaceIdQuery{
+			Sql:                 "query",
+			Keyspace:            "TestResolverRouting",
+			KeyspaceIds:         []key.KeyspaceId{kid10},
+			TabletType:          topo.TYPE_REPLICA,
+			RoutingPolicy:       tcase.policy,
+			AllowMasterFallback: tcase.allowMaster,
+		}
+		_, err := res.ExecuteKeyspaceIds(context.Background(), query)
+		if tcase.want == "" {
+			want := "no available addresses"
+			if err == nil || !strings.Contains(err.Error(), want) {
+				t.Errorf("%v: %v, want %v", tcase.name, err, want)
+			}
+			if query.TabletType != topo.TYPE_REPLICA {
+				t.Errorf("%v: TabletType: %v, want %v", tcase.name, query.TabletType, topo.TYPE_REPLICA)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: %v", tcase.name, err)
+			continue
+		}
+		if query.TabletType != tcase.want {
+			t.Errorf("%v: TabletType: %v, want %v", tcase.name, query.TabletType, tcase.want)
+		}
+		if sbc.ExecCount.Get() != 1 {
+			t.Errorf("%v: ExecCount: %v, want 1", tcase.name, sbc.ExecCount.Get())
+		}
+		if _, ok := res.cellConns["bb"]; ok != tcase.wantBB {
+			t.Errorf("%v: ScatterConn of cell bb: %v, want %v", tcase.name, ok, tcase.wantBB)
+		}
+	}
+}
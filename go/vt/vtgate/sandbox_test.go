@@ -179,6 +179,8 @@ func createShardedSrvKeyspace(shardSpec, servedFromKeyspace string) (*topo.SrvKe
 		shards = append(shards, shard)
 	}
 	shardedSrvKeyspace := &topo.SrvKeyspace{
+		ShardingColumnName: "user_id",
+		ShardingColumnType: key.KIT_UINT64,
 		Partitions: map[topo.TabletType]*topo.KeyspacePartition{
 			topo.TYPE_MASTER: &topo.KeyspacePartition{
 				ShardReferences: shards,
@@ -388,7 +390,11 @@ func (sbc *sandboxConn) Execute(context context.Context, query string, bindVars
 		BindVariables: bv,
 	})
 	if sbc.mustDelay != 0 {
-		time.Sleep(sbc.mustDelay)
+		select {
+		case <-time.After(sbc.mustDelay):
+		case <-context.Done():
+			return nil, tabletconn.OperationalError(fmt.Sprintf("vttablet: %v", context.Err()))
+		}
 	}
 	if err := sbc.getError(); err != nil {
 		return nil, err
@@ -467,12 +473,16 @@ var sandboxSQRowCount = int64(10)
 
 // Fake SplitQuery creates splits from the original query by appending the
 // split index as a comment to the SQL. RowCount is always sandboxSQRowCount
-func (sbc *sandboxConn) SplitQuery(context context.Context, query tproto.BoundQuery, splitCount int) ([]tproto.QuerySplit, error) {
+func (sbc *sandboxConn) SplitQuery(context context.Context, query tproto.BoundQuery, splitColumn string, splitCount int) ([]tproto.QuerySplit, error) {
 	splits := []tproto.QuerySplit{}
 	for i := 0; i < splitCount; i++ {
+		sql := fmt.Sprintf("%s /*split %v */", query.Sql, i)
+		if splitColumn != "" {
+			sql = fmt.Sprintf("%s /*split %v on %v */", query.Sql, i, splitColumn)
+		}
 		split := tproto.QuerySplit{
 			Query: tproto.BoundQuery{
-				Sql:           fmt.Sprintf("%s /*split %v */", query.Sql, i),
+				Sql:           sql,
 				BindVariables: query.BindVariables,
 			},
 			RowCount: sandboxSQRowCount,
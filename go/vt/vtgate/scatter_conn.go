@@ -6,10 +6,12 @@ package vtgate
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 
+	log "github.com/golang/glog"
 	mproto "github.com/youtube/vitess/go/mysql/proto"
 	"github.com/youtube/vitess/go/stats"
 	"github.com/youtube/vitess/go/sync2"
@@ -18,6 +20,7 @@ import (
 	tproto "github.com/youtube/vitess/go/vt/tabletserver/proto"
 	"github.com/youtube/vitess/go/vt/tabletserver/tabletconn"
 	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/vt/vterrors"
 	"github.com/youtube/vitess/go/vt/vtgate/proto"
 	"golang.org/x/net/context"
 )
@@ -37,6 +40,8 @@ type ScatterConn struct {
 	timings              *stats.MultiTimings
 	tabletCallErrorCount *stats.MultiCounters
 	tabletConnectTimings *stats.MultiTimings
+	watchInvalidations   *stats.MultiCounters
+	txJanitor            *txJanitor
 
 	mu         sync.Mutex
 	shardConns map[string]*ShardConn
@@ -54,11 +59,23 @@ type shardActionFunc func(conn *ShardConn, transactionId int64, sResults chan<-
 func NewScatterConn(serv SrvTopoServer, statsName, cell string, retryDelay time.Duration, retryCount int, connTimeoutTotal, connTimeoutPerConn, connLife time.Duration) *ScatterConn {
 	tabletCallErrorCountStatsName := ""
 	tabletConnectStatsName := ""
+	blacklistedStatsName := ""
+	watchInvalidationsStatsName := ""
+	poolCapacityStatsName := ""
+	poolInUseStatsName := ""
+	poolWaitCountStatsName := ""
+	poolWaitTimeStatsName := ""
 	if statsName != "" {
 		tabletCallErrorCountStatsName = statsName + "ErrorCount"
 		tabletConnectStatsName = statsName + "TabletConnect"
-	}
-	return &ScatterConn{
+		blacklistedStatsName = statsName + "BlacklistedEndPoints"
+		watchInvalidationsStatsName = statsName + "WatchInvalidations"
+		poolCapacityStatsName = statsName + "PoolCapacity"
+		poolInUseStatsName = statsName + "PoolInUse"
+		poolWaitCountStatsName = statsName + "PoolWaitCount"
+		poolWaitTimeStatsName = statsName + "PoolWaitTimeNs"
+	}
+	stc := &ScatterConn{
 		toposerv:             serv,
 		cell:                 cell,
 		retryDelay:           retryDelay,
@@ -69,8 +86,79 @@ func NewScatterConn(serv SrvTopoServer, statsName, cell string, retryDelay time.
 		timings:              stats.NewMultiTimings(statsName, []string{"Operation", "Keyspace", "ShardName", "DbType"}),
 		tabletCallErrorCount: stats.NewMultiCounters(tabletCallErrorCountStatsName, []string{"Operation", "Keyspace", "ShardName", "DbType"}),
 		tabletConnectTimings: stats.NewMultiTimings(tabletConnectStatsName, []string{"Keyspace", "ShardName", "DbType"}),
+		watchInvalidations:   stats.NewMultiCounters(watchInvalidationsStatsName, []string{"Keyspace", "ShardName", "DbType"}),
 		shardConns:           make(map[string]*ShardConn),
 	}
+	stc.txJanitor = newTxJanitor(*transactionTimeout, func(ctx context.Context, shardSession *proto.ShardSession) error {
+		sdc := stc.getConnection(ctx, shardSession.Keyspace, shardSession.Shard, shardSession.TabletType)
+		return sdc.Rollback(ctx, shardSession.TransactionId)
+	})
+	stats.NewMultiCountersFunc(blacklistedStatsName, []string{"Keyspace", "ShardName", "DbType"}, stc.blacklistedCounts)
+	stats.NewMultiCountersFunc(poolCapacityStatsName, []string{"Keyspace", "ShardName", "DbType"}, stc.poolCounts(func(sdc *ShardConn) int64 {
+		capacity, _ := sdc.poolCounts()
+		return int64(capacity)
+	}))
+	stats.NewMultiCountersFunc(poolInUseStatsName, []string{"Keyspace", "ShardName", "DbType"}, stc.poolCounts(func(sdc *ShardConn) int64 {
+		_, inUse := sdc.poolCounts()
+		return int64(inUse)
+	}))
+	stats.NewMultiCountersFunc(poolWaitCountStatsName, []string{"Keyspace", "ShardName", "DbType"}, stc.poolCounts(func(sdc *ShardConn) int64 {
+		return sdc.poolStats.waitCount.Get()
+	}))
+	stats.NewMultiCountersFunc(poolWaitTimeStatsName, []string{"Keyspace", "ShardName", "DbType"}, stc.poolCounts(func(sdc *ShardConn) int64 {
+		return int64(sdc.poolStats.waitTime.Get())
+	}))
+	if notifier, ok := serv.(EndPointsNotifier); ok {
+		notifier.AddEndPointsListener(stc.endPointsChanged)
+	}
+	return stc
+}
+
+// endPointsChanged is called when the EndPoints of a shard change.
+// If the ShardConn of the shard is connected to an end point that
+// is not serving any more (for instance, the old master after a
+// reparent), its connection is closed right away, and its buffered
+// master requests are retried.
+func (stc *ScatterConn) endPointsChanged(cell, keyspace, shard string, tabletType topo.TabletType, endPoints *topo.EndPoints) {
+	if cell != stc.cell {
+		return
+	}
+	stc.mu.Lock()
+	sdc, ok := stc.shardConns[fmt.Sprintf("%s.%s.%s", keyspace, shard, tabletType)]
+	stc.mu.Unlock()
+	if !ok {
+		return
+	}
+	if sdc.closeIfNotServing(endPoints) {
+		stc.watchInvalidations.Add([]string{keyspace, shard, string(tabletType)}, 1)
+	}
+	sdc.drainBuffer(endPoints)
+}
+
+// blacklistedCounts returns the number of blacklisted endpoints
+// of each ShardConn.
+func (stc *ScatterConn) blacklistedCounts() map[string]int64 {
+	stc.mu.Lock()
+	defer stc.mu.Unlock()
+	counts := make(map[string]int64, len(stc.shardConns))
+	for key, sdc := range stc.shardConns {
+		counts[key] = int64(sdc.balancer.BlacklistedCount())
+	}
+	return counts
+}
+
+// poolCounts returns a function that reports count for the
+// connection pools of each ShardConn.
+func (stc *ScatterConn) poolCounts(count func(sdc *ShardConn) int64) stats.CountersFunc {
+	return func() map[string]int64 {
+		stc.mu.Lock()
+		defer stc.mu.Unlock()
+		counts := make(map[string]int64, len(stc.shardConns))
+		for key, sdc := range stc.shardConns {
+			counts[key] = count(sdc)
+		}
+		return counts
+	}
 }
 
 // InitializeConnections pre-initializes all ShardConn which create underlying connections.
@@ -280,9 +368,98 @@ func (stc *ScatterConn) ExecuteBatch(
 	return qrs, nil
 }
 
+// batchShard is the part of a batch of BoundShardQuery that runs on
+// one shard. indexes has the position in the batch of each query.
+type batchShard struct {
+	keyspace string
+	shard    string
+	queries  []tproto.BoundQuery
+	indexes  []int
+	qrs      *tproto.QueryResultList
+	err      error
+}
+
+// ExecuteBatchShards executes a batch of queries, each on its own
+// keyspace and shards. The queries of a shard are sent to it in a
+// single ExecuteBatch call, in the order of the batch, so they share
+// its transaction. It returns the result of each query, merged over
+// its shards, and its error, which is that of the first of its
+// shards that failed. The result of a failed query is empty.
+func (stc *ScatterConn) ExecuteBatchShards(
+	ctx context.Context,
+	queries []proto.BoundShardQuery,
+	tabletType topo.TabletType,
+	session *SafeSession,
+	notInTransaction bool,
+) ([]mproto.QueryResult, []error) {
+	var batchShards []*batchShard
+	byShard := make(map[string]*batchShard)
+	for i, query := range queries {
+		for shard := range unique(query.Shards) {
+			key := query.Keyspace + "/" + shard
+			bs, ok := byShard[key]
+			if !ok {
+				bs = &batchShard{keyspace: query.Keyspace, shard: shard}
+				byShard[key] = bs
+				batchShards = append(batchShards, bs)
+			}
+			bs.queries = append(bs.queries, tproto.BoundQuery{Sql: query.Sql, BindVariables: query.BindVariables})
+			bs.indexes = append(bs.indexes, i)
+		}
+	}
+
+	var wg sync.WaitGroup
+	for _, bs := range batchShards {
+		wg.Add(1)
+		go func(bs *batchShard) {
+			defer wg.Done()
+			statsKey := []string{"ExecuteBatchShards", bs.keyspace, bs.shard, string(tabletType)}
+			defer stc.timings.Record(statsKey, time.Now())
+
+			sdc := stc.getConnection(ctx, bs.keyspace, bs.shard, tabletType)
+			transactionID, err := stc.updateSession(ctx, sdc, bs.keyspace, bs.shard, tabletType, session, notInTransaction)
+			if err == nil {
+				bs.qrs, err = sdc.ExecuteBatch(ctx, bs.queries, transactionID)
+			}
+			if err != nil {
+				bs.err = err
+				if vterrors.RecoverCode(err) != vterrors.IntegrityError {
+					stc.tabletCallErrorCount.Add(statsKey, 1)
+				}
+			}
+		}(bs)
+	}
+	wg.Wait()
+
+	results := make([]mproto.QueryResult, len(queries))
+	errs := make([]error, len(queries))
+	allErrors := new(concurrency.AllErrorRecorder)
+	for _, bs := range batchShards {
+		if bs.err != nil {
+			allErrors.RecordError(bs.err)
+		}
+		for j, i := range bs.indexes {
+			switch {
+			case errs[i] != nil:
+			case bs.err != nil:
+				errs[i] = bs.err
+				results[i] = mproto.QueryResult{}
+			default:
+				appendResult(&results[i], &bs.qrs.List[j])
+			}
+		}
+	}
+	if allErrors.HasErrors() {
+		stc.rollbackIfUnrecoverable(ctx, session, allErrors.Errors)
+	}
+	return results, errs
+}
+
 // StreamExecute executes a streaming query on vttablet. The retry rules are the same.
+// The field info is sent once, and the rows of the shards are sent as they
+// arrive. If sending to the client fails, the shard streams are cancelled.
 func (stc *ScatterConn) StreamExecute(
-	context context.Context,
+	ctx context.Context,
 	query string,
 	bindVars map[string]interface{},
 	keyspace string,
@@ -292,8 +469,10 @@ func (stc *ScatterConn) StreamExecute(
 	sendReply func(reply *mproto.QueryResult) error,
 	notInTransaction bool,
 ) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
 	results, allErrors := stc.multiGo(
-		context,
+		ctx,
 		"StreamExecute",
 		keyspace,
 		shards,
@@ -301,7 +480,42 @@ func (stc *ScatterConn) StreamExecute(
 		session,
 		notInTransaction,
 		func(sdc *ShardConn, transactionId int64, sResults chan<- interface{}) error {
-			sr, errFunc := sdc.StreamExecute(context, query, bindVars, transactionId)
+			sr, errFunc := sdc.StreamExecute(ctx, query, bindVars, transactionId)
+			if sr != nil {
+				for qr := range sr {
+					sResults <- qr
+				}
+			}
+			return errFunc()
+		})
+	return stc.sendStreamResults(results, allErrors, sendReply, cancel)
+}
+
+// StreamExecuteMulti is like StreamExecute,
+// but each shard gets its own bindVars. If len(shards) is not equal to
+// len(bindVars), the function panics.
+func (stc *ScatterConn) StreamExecuteMulti(
+	ctx context.Context,
+	query string,
+	keyspace string,
+	shardVars map[string]map[string]interface{},
+	tabletType topo.TabletType,
+	session *SafeSession,
+	sendReply func(reply *mproto.QueryResult) error,
+	notInTransaction bool,
+) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	results, allErrors := stc.multiGo(
+		ctx,
+		"StreamExecute",
+		keyspace,
+		getShards(shardVars),
+		tabletType,
+		session,
+		notInTransaction,
+		func(sdc *ShardConn, transactionId int64, sResults chan<- interface{}) error {
+			sr, errFunc := sdc.StreamExecute(ctx, query, shardVars[sdc.shard], transactionId)
 			if sr != nil {
 				for qr := range sr {
 					sResults <- qr
@@ -309,6 +523,13 @@ func (stc *ScatterConn) StreamExecute(
 			}
 			return errFunc()
 		})
+	return stc.sendStreamResults(results, allErrors, sendReply, cancel)
+}
+
+// sendStreamResults sends the results of the shard streams as they
+// arrive, with the field info only once. After a failed send, it
+// cancels the shard streams, and drains them.
+func (stc *ScatterConn) sendStreamResults(results <-chan interface{}, allErrors *concurrency.AllErrorRecorder, sendReply func(reply *mproto.QueryResult) error, cancel context.CancelFunc) error {
 	var replyErr error
 	fieldSent := false
 	for innerqr := range results {
@@ -324,7 +545,9 @@ func (stc *ScatterConn) StreamExecute(
 			}
 			fieldSent = true
 		}
-		replyErr = sendReply(mqr)
+		if replyErr = sendReply(mqr); replyErr != nil {
+			cancel()
+		}
 	}
 	if replyErr != nil {
 		allErrors.RecordError(replyErr)
@@ -332,52 +555,65 @@ func (stc *ScatterConn) StreamExecute(
 	return allErrors.AggrError(stc.aggregateErrors)
 }
 
-// StreamExecuteMulti is like StreamExecute,
-// but each shard gets its own bindVars. If len(shards) is not equal to
-// len(bindVars), the function panics.
-func (stc *ScatterConn) StreamExecuteMulti(
-	context context.Context,
+// StreamExecuteOrdered is like StreamExecute, but the rows of the
+// shards are merged on the ORDER BY columns of the query, so the
+// client receives them in order. The ORDER BY columns have to be
+// in the results.
+func (stc *ScatterConn) StreamExecuteOrdered(
+	ctx context.Context,
 	query string,
+	bindVars map[string]interface{},
 	keyspace string,
-	shardVars map[string]map[string]interface{},
+	shards []string,
 	tabletType topo.TabletType,
 	session *SafeSession,
 	sendReply func(reply *mproto.QueryResult) error,
 	notInTransaction bool,
 ) error {
+	orderBy, err := getOrderBy(query)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
 	results, allErrors := stc.multiGo(
-		context,
+		ctx,
 		"StreamExecute",
 		keyspace,
-		getShards(shardVars),
+		shards,
 		tabletType,
 		session,
 		notInTransaction,
 		func(sdc *ShardConn, transactionId int64, sResults chan<- interface{}) error {
-			sr, errFunc := sdc.StreamExecute(context, query, shardVars[sdc.shard], transactionId)
+			sr, errFunc := sdc.StreamExecute(ctx, query, bindVars, transactionId)
 			if sr != nil {
 				for qr := range sr {
-					sResults <- qr
+					sResults <- &shardPacket{shard: sdc.shard, result: qr}
 				}
 			}
+			sResults <- &shardPacket{shard: sdc.shard}
 			return errFunc()
 		})
+	uniqueShards := make([]string, 0, len(shards))
+	for shard := range unique(shards) {
+		uniqueShards = append(uniqueShards, shard)
+	}
+	sort.Strings(uniqueShards)
+	merger := newStreamMerger(uniqueShards, orderBy, sendReply)
 	var replyErr error
-	fieldSent := false
-	for innerqr := range results {
+	for packet := range results {
 		// We still need to finish pumping
 		if replyErr != nil {
 			continue
 		}
-		mqr := innerqr.(*mproto.QueryResult)
-		// only send field info once for scattered streaming
-		if len(mqr.Fields) > 0 && len(mqr.Rows) == 0 {
-			if fieldSent {
-				continue
-			}
-			fieldSent = true
+		if replyErr = merger.add(packet.(*shardPacket)); replyErr != nil {
+			cancel()
 		}
-		replyErr = sendReply(mqr)
+	}
+	if replyErr == nil {
+		// the shards that failed to start never sent their
+		// end of stream, send what the others returned.
+		replyErr = merger.flush(true)
 	}
 	if replyErr != nil {
 		allErrors.RecordError(replyErr)
@@ -386,49 +622,90 @@ func (stc *ScatterConn) StreamExecuteMulti(
 }
 
 // Commit commits the current transaction. There are no retries on this operation.
-func (stc *ScatterConn) Commit(context context.Context, session *SafeSession) (err error) {
+// The shards are committed one at a time, in the order they joined the
+// transaction. If a commit fails, the remaining shards are rolled back,
+// and a *CommitError describes the state of each shard.
+func (stc *ScatterConn) Commit(context context.Context, session *SafeSession) error {
 	if session == nil {
 		return fmt.Errorf("cannot commit: empty session")
 	}
 	if !session.InTransaction() {
 		return fmt.Errorf("cannot commit: not in transaction")
 	}
-	committing := true
-	for _, shardSession := range session.ShardSessions {
-		sdc := stc.getConnection(context, shardSession.Keyspace, shardSession.Shard, shardSession.TabletType)
-		if !committing {
-			sdc.Rollback(context, shardSession.TransactionId)
-			continue
+	defer session.Reset()
+	shardSessions, err := stc.txJanitor.forget(session.ShardSessions)
+	if err != nil {
+		if rollbackErr := stc.rollbackShards(context, shardSessions); rollbackErr != nil {
+			log.Warningf("rollback after expired transaction: %v", rollbackErr)
 		}
-		if err = sdc.Commit(context, shardSession.TransactionId); err != nil {
-			committing = false
+		return err
+	}
+	var committed []string
+	for i, shardSession := range shardSessions {
+		sdc := stc.getConnection(context, shardSession.Keyspace, shardSession.Shard, shardSession.TabletType)
+		if err := sdc.Commit(context, shardSession.TransactionId); err != nil {
+			commitErr := &CommitError{
+				Err:          err,
+				UnknownShard: shardSessionName(shardSession),
+				Committed:    committed,
+			}
+			for _, shardSession := range shardSessions[i+1:] {
+				commitErr.RolledBack = append(commitErr.RolledBack, shardSessionName(shardSession))
+			}
+			if rollbackErr := stc.rollbackShards(context, shardSessions[i+1:]); rollbackErr != nil {
+				log.Warningf("rollback after failed commit: %v", rollbackErr)
+			}
+			return commitErr
 		}
+		committed = append(committed, shardSessionName(shardSession))
 	}
-	session.Reset()
-	return err
+	return nil
 }
 
 // Rollback rolls back the current transaction. There are no retries on this operation.
-func (stc *ScatterConn) Rollback(context context.Context, session *SafeSession) (err error) {
+// All the shards are rolled back, even if some of them fail.
+func (stc *ScatterConn) Rollback(context context.Context, session *SafeSession) error {
 	if session == nil {
 		return nil
 	}
-	for _, shardSession := range session.ShardSessions {
-		sdc := stc.getConnection(context, shardSession.Keyspace, shardSession.Shard, shardSession.TabletType)
-		sdc.Rollback(context, shardSession.TransactionId)
+	defer session.Reset()
+	// The transactions rolled back by the janitor are already gone.
+	shardSessions, _ := stc.txJanitor.forget(session.ShardSessions)
+	return stc.rollbackShards(context, shardSessions)
+}
+
+// rollbackShards rolls back the transactions of the shard sessions in
+// parallel, and returns the errors for the ones that failed.
+func (stc *ScatterConn) rollbackShards(context context.Context, shardSessions []*proto.ShardSession) error {
+	var wg sync.WaitGroup
+	allErrors := new(concurrency.AllErrorRecorder)
+	for _, shardSession := range shardSessions {
+		wg.Add(1)
+		go func(shardSession *proto.ShardSession) {
+			defer wg.Done()
+			sdc := stc.getConnection(context, shardSession.Keyspace, shardSession.Shard, shardSession.TabletType)
+			if err := sdc.Rollback(context, shardSession.TransactionId); err != nil {
+				allErrors.RecordError(fmt.Errorf("rollback failed on %v: %v", shardSessionName(shardSession), err))
+			}
+		}(shardSession)
 	}
-	session.Reset()
-	return nil
+	wg.Wait()
+	return allErrors.AggrError(stc.aggregateErrors)
+}
+
+// shardSessionName returns the keyspace/shard of a shard session.
+func shardSessionName(shardSession *proto.ShardSession) string {
+	return fmt.Sprintf("%v/%v", shardSession.Keyspace, shardSession.Shard)
 }
 
 // SplitQuery scatters a SplitQuery request to all shards. For a set of
 // splits received from a shard, it construct a KeyRange queries by
 // appending that shard's keyrange to the splits. Aggregates all splits across
 // all shards in no specific order and returns.
-func (stc *ScatterConn) SplitQuery(ctx context.Context, query tproto.BoundQuery, splitCount int, keyRangeByShard map[string]kproto.KeyRange, keyspace string) ([]proto.SplitQueryPart, error) {
+func (stc *ScatterConn) SplitQuery(ctx context.Context, query tproto.BoundQuery, splitColumn string, splitCount int, keyRangeByShard map[string]kproto.KeyRange, keyspace string) ([]proto.SplitQueryPart, error) {
 	actionFunc := func(sdc *ShardConn, transactionID int64, results chan<- interface{}) error {
 		// Get all splits from this shard
-		queries, err := sdc.SplitQuery(ctx, query, splitCount)
+		queries, err := sdc.SplitQuery(ctx, query, splitColumn, splitCount)
 		if err != nil {
 			return err
 		}
@@ -472,6 +749,7 @@ func (stc *ScatterConn) SplitQuery(ctx context.Context, query tproto.BoundQuery,
 
 // Close closes the underlying ShardConn connections.
 func (stc *ScatterConn) Close() error {
+	stc.txJanitor.close()
 	stc.mu.Lock()
 	defer stc.mu.Unlock()
 	for _, v := range stc.shardConns {
@@ -481,6 +759,33 @@ func (stc *ScatterConn) Close() error {
 	return nil
 }
 
+// CommitError is returned by Commit when a transaction could not be
+// committed on all its shards. The commit state of UnknownShard is
+// unknown: its tablet may have committed before returning the error.
+type CommitError struct {
+	// Err is the error returned by the commit of UnknownShard
+	Err error
+	// UnknownShard is the keyspace/shard whose commit failed
+	UnknownShard string
+	// Committed lists the keyspace/shards committed before the failure
+	Committed []string
+	// RolledBack lists the keyspace/shards rolled back after the
+	// failure. Their transactions are not committed, even if the
+	// rollback itself failed.
+	RolledBack []string
+}
+
+func (e *CommitError) Error() string {
+	parts := []string{fmt.Sprintf("commit failed on %v, its commit state is unknown: %v", e.UnknownShard, e.Err)}
+	if len(e.Committed) > 0 {
+		parts = append(parts, fmt.Sprintf("committed on: %v", strings.Join(e.Committed, ", ")))
+	}
+	if len(e.RolledBack) > 0 {
+		parts = append(parts, fmt.Sprintf("rolled back on: %v", strings.Join(e.RolledBack, ", ")))
+	}
+	return strings.Join(parts, "; ")
+}
+
 // ScatterConnError is the ScatterConn specific error.
 type ScatterConnError struct {
 	Code int
@@ -488,6 +793,12 @@ type ScatterConnError struct {
 	Errs []error
 }
 
+// ErrorCode returns the code of the errors of the shards, see
+// vterrors.AggregateCodes.
+func (e *ScatterConnError) ErrorCode() int64 {
+	return int64(vterrors.AggregateCodes(e.Errs))
+}
+
 func (e *ScatterConnError) Error() string {
 	errStrings := make([]string, 0, len(e.Errs))
 	for _, err := range e.Errs {
@@ -562,7 +873,7 @@ func (stc *ScatterConn) multiGo(
 				allErrors.RecordError(err)
 				// Don't increment the error counter for duplicate keys, as those errors
 				// are caused by client queries and are not VTGate's fault.
-				if !strings.Contains(err.Error(), errDupKey) {
+				if vterrors.RecoverCode(err) != vterrors.IntegrityError {
 					stc.tabletCallErrorCount.Add(statsKey, 1)
 				}
 				return
@@ -574,19 +885,28 @@ func (stc *ScatterConn) multiGo(
 		// If we want to rollback, we have to do it before closing results
 		// so that the session is updated to be not InTransaction.
 		if allErrors.HasErrors() {
-			if session.InTransaction() {
-				errstr := allErrors.Error().Error()
-				// We cannot recover from these errors
-				if strings.Contains(errstr, "tx_pool_full") || strings.Contains(errstr, "not_in_tx") {
-					stc.Rollback(context, session)
-				}
-			}
+			stc.rollbackIfUnrecoverable(context, session, allErrors.Errors)
 		}
 		close(results)
 	}()
 	return results, allErrors
 }
 
+// rollbackIfUnrecoverable rolls back the transaction of session if one
+// of errs leaves it unusable: the transaction of a shard is gone, or
+// could not be started.
+func (stc *ScatterConn) rollbackIfUnrecoverable(ctx context.Context, session *SafeSession, errs []error) {
+	if !session.InTransaction() {
+		return
+	}
+	for _, err := range errs {
+		if scErr, ok := err.(*ShardConnError); ok && (scErr.Code == tabletconn.ERR_TX_POOL_FULL || scErr.Code == tabletconn.ERR_NOT_IN_TX) {
+			stc.Rollback(ctx, session)
+			return
+		}
+	}
+}
+
 func (stc *ScatterConn) getConnection(context context.Context, keyspace, shard string, tabletType topo.TabletType) *ShardConn {
 	stc.mu.Lock()
 	defer stc.mu.Unlock()
@@ -617,6 +937,14 @@ func (stc *ScatterConn) updateSession(
 	// this at the same time.
 	transactionID = session.Find(keyspace, shard, tabletType)
 	if transactionID != 0 {
+		if err := stc.txJanitor.check(&proto.ShardSession{
+			Keyspace:      keyspace,
+			TabletType:    tabletType,
+			Shard:         shard,
+			TransactionId: transactionID,
+		}); err != nil {
+			return 0, err
+		}
 		return transactionID, nil
 	}
 	// We are in a transaction at higher level,
@@ -629,12 +957,14 @@ func (stc *ScatterConn) updateSession(
 	if err != nil {
 		return 0, err
 	}
-	session.Append(&proto.ShardSession{
+	shardSession := &proto.ShardSession{
 		Keyspace:      keyspace,
 		TabletType:    tabletType,
 		Shard:         shard,
 		TransactionId: transactionID,
-	})
+	}
+	session.Append(shardSession)
+	stc.txJanitor.add(shardSession)
 	return transactionID, nil
 }
 
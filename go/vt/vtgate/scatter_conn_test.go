@@ -7,6 +7,7 @@ package vtgate
 import (
 	"fmt"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -14,6 +15,8 @@ import (
 	"github.com/youtube/vitess/go/sqltypes"
 	tproto "github.com/youtube/vitess/go/vt/tabletserver/proto"
 	"github.com/youtube/vitess/go/vt/tabletserver/tabletconn"
+	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/vt/vterrors"
 	"github.com/youtube/vitess/go/vt/vtgate/proto"
 	"golang.org/x/net/context"
 )
@@ -50,6 +53,73 @@ func TestScatterConnExecuteBatch(t *testing.T) {
 	})
 }
 
+func TestScatterConnExecuteBatchShards(t *testing.T) {
+	s := createSandbox("TestScatterConnExecuteBatchShards")
+	sbc0 := &sandboxConn{}
+	s.MapTestConn("0", sbc0)
+	sbc1 := &sandboxConn{mustFailServer: 1}
+	s.MapTestConn("1", sbc1)
+	stc := NewScatterConn(new(sandboxTopo), "", "aa", 1*time.Millisecond, 3, 2*time.Millisecond, 1*time.Millisecond, 24*time.Hour)
+
+	queries := []proto.BoundShardQuery{{
+		Sql:      "query0",
+		Keyspace: "TestScatterConnExecuteBatchShards",
+		Shards:   []string{"0"},
+	}, {
+		Sql:      "query1",
+		Keyspace: "TestScatterConnExecuteBatchShards",
+		Shards:   []string{"1"},
+	}, {
+		Sql:      "query2",
+		Keyspace: "TestScatterConnExecuteBatchShards",
+		Shards:   []string{"0", "1"},
+	}}
+	qrs, errs := stc.ExecuteBatchShards(context.Background(), queries, "", nil, false)
+	if execCount := sbc0.ExecCount.Get(); execCount != 1 {
+		t.Errorf("want 1, got %v", execCount)
+	}
+	if execCount := sbc1.ExecCount.Get(); execCount != 1 {
+		t.Errorf("want 1, got %v", execCount)
+	}
+	if errs[0] != nil {
+		t.Errorf("want nil, got %v", errs[0])
+	}
+	if !reflect.DeepEqual(qrs[0], *singleRowResult) {
+		t.Errorf("want %+v, got %+v", *singleRowResult, qrs[0])
+	}
+	want := "error: err"
+	for i := 1; i < 3; i++ {
+		if errs[i] == nil || !strings.Contains(errs[i].Error(), want) {
+			t.Errorf("errs[%d]: %v, want %v", i, errs[i], want)
+		}
+		if !reflect.DeepEqual(qrs[i], mproto.QueryResult{}) {
+			t.Errorf("qrs[%d]: %+v, want empty", i, qrs[i])
+		}
+	}
+
+	// The queries of a shard share its transaction.
+	session := NewSafeSession(&proto.Session{InTransaction: true})
+	qrs, errs = stc.ExecuteBatchShards(context.Background(), queries, "", session, false)
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("errs[%d]: %v", i, err)
+		}
+	}
+	if qrs[2].RowsAffected != 2 {
+		t.Errorf("want 2, got %v", qrs[2].RowsAffected)
+	}
+	// One Begin and one ExecuteBatch.
+	if execCount := sbc0.ExecCount.Get(); execCount != 3 {
+		t.Errorf("want 3, got %v", execCount)
+	}
+	if beginCount := sbc0.BeginCount.Get(); beginCount != 1 {
+		t.Errorf("want 1, got %v", beginCount)
+	}
+	if len(session.ShardSessions) != 2 {
+		t.Errorf("want 2, got %d", len(session.ShardSessions))
+	}
+}
+
 func TestScatterConnStreamExecute(t *testing.T) {
 	testScatterConnGeneric(t, "TestScatterConnStreamExecute", func(shards []string) (*mproto.QueryResult, error) {
 		stc := NewScatterConn(new(sandboxTopo), "", "aa", 1*time.Millisecond, 3, 2*time.Millisecond, 1*time.Millisecond, 24*time.Hour)
@@ -209,6 +279,86 @@ func TestScatterConnStreamExecuteSendError(t *testing.T) {
 	}
 }
 
+func TestScatterConnStreamExecuteOrdered(t *testing.T) {
+	s := createSandbox("TestScatterConnStreamExecuteOrdered")
+	fields := []mproto.Field{
+		{Name: "id", Type: mproto.VT_LONG, Flags: mproto.VT_ZEROVALUE_FLAG},
+		{Name: "name", Type: mproto.VT_VAR_STRING, Flags: mproto.VT_ZEROVALUE_FLAG},
+	}
+	row := func(id, name string) []sqltypes.Value {
+		return []sqltypes.Value{sqltypes.MakeNumeric([]byte(id)), sqltypes.MakeString([]byte(name))}
+	}
+	sbc0 := &sandboxConn{}
+	sbc0.setResults([]*mproto.QueryResult{{
+		Fields: fields,
+		Rows:   [][]sqltypes.Value{row("10", "c"), row("3", "a")},
+	}})
+	s.MapTestConn("0", sbc0)
+	sbc1 := &sandboxConn{}
+	sbc1.setResults([]*mproto.QueryResult{{
+		Fields: fields,
+		Rows:   [][]sqltypes.Value{row("9", "d"), row("5", "b"), row("1", "b")},
+	}})
+	s.MapTestConn("1", sbc1)
+	stc := NewScatterConn(new(sandboxTopo), "", "aa", 1*time.Millisecond, 3, 2*time.Millisecond, 1*time.Millisecond, 24*time.Hour)
+
+	var qrs []*mproto.QueryResult
+	err := stc.StreamExecuteOrdered(context.Background(), "select id, name from t order by id desc", nil, "TestScatterConnStreamExecuteOrdered", []string{"0", "1"}, "", nil, func(qr *mproto.QueryResult) error {
+		qrs = append(qrs, qr)
+		return nil
+	}, false)
+	if err != nil {
+		t.Fatalf("StreamExecuteOrdered failed: %v", err)
+	}
+	if len(qrs) == 0 || !reflect.DeepEqual(qrs[0].Fields, fields) {
+		t.Fatalf("StreamExecuteOrdered didn't send the fields first: %v", qrs)
+	}
+	var rows [][]sqltypes.Value
+	for _, r := range qrs[1:] {
+		if len(r.Fields) != 0 {
+			t.Errorf("StreamExecuteOrdered sent the fields twice: %v", qrs)
+		}
+		rows = append(rows, r.Rows...)
+	}
+	want := [][]sqltypes.Value{row("10", "c"), row("9", "d"), row("5", "b"), row("3", "a"), row("1", "b")}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("StreamExecuteOrdered rows: got %v, want %v", rows, want)
+	}
+
+	// a failed shard doesn't stop the other ones
+	s.Reset()
+	sbc0 = &sandboxConn{mustFailServer: 1}
+	sbc0.setResults([]*mproto.QueryResult{{Fields: fields}})
+	s.MapTestConn("0", sbc0)
+	sbc1 = &sandboxConn{}
+	sbc1.setResults([]*mproto.QueryResult{{
+		Fields: fields,
+		Rows:   [][]sqltypes.Value{row("1", "b"), row("2", "a")},
+	}})
+	s.MapTestConn("1", sbc1)
+	stc = NewScatterConn(new(sandboxTopo), "", "aa", 1*time.Millisecond, 3, 2*time.Millisecond, 1*time.Millisecond, 24*time.Hour)
+	rows = nil
+	err = stc.StreamExecuteOrdered(context.Background(), "select id, name from t order by id", nil, "TestScatterConnStreamExecuteOrdered", []string{"0", "1"}, "", nil, func(r *mproto.QueryResult) error {
+		rows = append(rows, r.Rows...)
+		return nil
+	}, false)
+	if err == nil || !strings.Contains(err.Error(), "error: err") {
+		t.Errorf("StreamExecuteOrdered with a failed shard: %v", err)
+	}
+	want = [][]sqltypes.Value{row("1", "b"), row("2", "a")}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("StreamExecuteOrdered rows with a failed shard: got %v, want %v", rows, want)
+	}
+
+	// the query needs an ORDER BY
+	err = stc.StreamExecuteOrdered(context.Background(), "select id, name from t", nil, "TestScatterConnStreamExecuteOrdered", []string{"0", "1"}, "", nil, func(r *mproto.QueryResult) error {
+		return nil
+	}, false)
+	if err == nil || !strings.Contains(err.Error(), "needs an ORDER BY clause") {
+		t.Errorf("StreamExecuteOrdered without ORDER BY: %v", err)
+	}
+}
+
 func TestScatterCommitRollbackIncorrectSession(t *testing.T) {
 	s := createSandbox("TestScatterCommitRollbackIncorrectSession")
 	sbc0 := &sandboxConn{}
@@ -275,8 +425,12 @@ func TestScatterConnCommitSuccess(t *testing.T) {
 	}
 	sbc0.mustFailServer = 1
 	err := stc.Commit(context.Background(), session)
-	if err == nil {
-		t.Errorf("want error, got nil")
+	commitErr, ok := err.(*CommitError)
+	if !ok {
+		t.Fatalf("want *CommitError, got %v", err)
+	}
+	if commitErr.UnknownShard != "TestScatterConnCommitSuccess/0" || len(commitErr.Committed) != 0 || !reflect.DeepEqual(commitErr.RolledBack, []string{"TestScatterConnCommitSuccess/1"}) {
+		t.Errorf("unexpected CommitError: %#v", commitErr)
 	}
 	wantSession = proto.Session{}
 	if !reflect.DeepEqual(wantSession, *session.Session) {
@@ -290,6 +444,40 @@ func TestScatterConnCommitSuccess(t *testing.T) {
 	}
 }
 
+func TestScatterConnCommitPartialFailure(t *testing.T) {
+	s := createSandbox("TestScatterConnCommitPartialFailure")
+	sbcs := []*sandboxConn{&sandboxConn{}, &sandboxConn{}, &sandboxConn{}}
+	for i, sbc := range sbcs {
+		s.MapTestConn(fmt.Sprintf("%v", i), sbc)
+	}
+	stc := NewScatterConn(new(sandboxTopo), "", "aa", 1*time.Millisecond, 3, 2*time.Millisecond, 1*time.Millisecond, 24*time.Hour)
+
+	// Sequence the executes to ensure commit order
+	session := NewSafeSession(&proto.Session{InTransaction: true})
+	for _, shard := range []string{"0", "1", "2"} {
+		stc.Execute(context.Background(), "query1", nil, "TestScatterConnCommitPartialFailure", []string{shard}, "", session, false)
+	}
+	sbcs[1].mustFailServer = 1
+	sbcs[2].mustFailServer = 1
+	err := stc.Commit(context.Background(), session)
+	for _, want := range []string{
+		"commit failed on TestScatterConnCommitPartialFailure/1, its commit state is unknown: shard, host: TestScatterConnCommitPartialFailure.1.",
+		"; committed on: TestScatterConnCommitPartialFailure/0; rolled back on: TestScatterConnCommitPartialFailure/2",
+	} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("want error containing %q, got %v", want, err)
+		}
+	}
+	if !reflect.DeepEqual(proto.Session{}, *session.Session) {
+		t.Errorf("session was not reset: %+v", *session.Session)
+	}
+	for i, counts := range [][2]int64{{1, 0}, {1, 0}, {0, 1}} {
+		if got := [2]int64{sbcs[i].CommitCount.Get(), sbcs[i].RollbackCount.Get()}; got != counts {
+			t.Errorf("shard %v: want commits and rollbacks %v, got %v", i, counts, got)
+		}
+	}
+}
+
 func TestScatterConnRollback(t *testing.T) {
 	s := createSandbox("TestScatterConnRollback")
 	sbc0 := &sandboxConn{}
@@ -316,6 +504,79 @@ func TestScatterConnRollback(t *testing.T) {
 	if sbc1.RollbackCount != 1 {
 		t.Errorf("want 1, got %d", sbc1.RollbackCount)
 	}
+
+	// all the shards are rolled back, even if one fails
+	session.Session.InTransaction = true
+	stc.Execute(context.Background(), "query1", nil, "TestScatterConnRollback", []string{"0", "1"}, "", session, false)
+	sbc0.mustFailServer = 1
+	err = stc.Rollback(context.Background(), session)
+	if err == nil || !strings.Contains(err.Error(), "rollback failed on TestScatterConnRollback/0") {
+		t.Errorf("want rollback error, got %v", err)
+	}
+	if sbc0.RollbackCount != 2 || sbc1.RollbackCount != 2 {
+		t.Errorf("want 2 rollbacks, got %d and %d", sbc0.RollbackCount, sbc1.RollbackCount)
+	}
+}
+
+func TestScatterConnUnrecoverableError(t *testing.T) {
+	s := createSandbox("TestScatterConnUnrecoverableError")
+	sbc0 := &sandboxConn{}
+	s.MapTestConn("0", sbc0)
+	sbc1 := &sandboxConn{}
+	s.MapTestConn("1", sbc1)
+	stc := NewScatterConn(new(sandboxTopo), "", "aa", 1*time.Millisecond, 3, 2*time.Millisecond, 1*time.Millisecond, 24*time.Hour)
+
+	// an error of the query leaves the transaction open
+	session := NewSafeSession(&proto.Session{InTransaction: true})
+	stc.Execute(context.Background(), "query1", nil, "TestScatterConnUnrecoverableError", []string{"0", "1"}, "", session, false)
+	sbc1.mustFailServer = 1
+	_, err := stc.Execute(context.Background(), "query1", nil, "TestScatterConnUnrecoverableError", []string{"0", "1"}, "", session, false)
+	if err == nil {
+		t.Fatalf("want error, got nil")
+	}
+	if !session.InTransaction() || sbc0.RollbackCount != 0 {
+		t.Errorf("want the transaction open, got session %+v and %d rollbacks", *session.Session, sbc0.RollbackCount)
+	}
+
+	// a full transaction pool loses the transaction, it is rolled back
+	sbc1.mustFailTxPool = 1
+	_, err = stc.Execute(context.Background(), "query1", nil, "TestScatterConnUnrecoverableError", []string{"0", "1"}, "", session, false)
+	if code := vterrors.RecoverCode(err); code != vterrors.ResourceExhausted {
+		t.Errorf("want a %v error, got %v: %v", vterrors.ResourceExhausted, code, err)
+	}
+	if !reflect.DeepEqual(proto.Session{}, *session.Session) {
+		t.Errorf("session was not reset: %+v", *session.Session)
+	}
+	if sbc0.RollbackCount != 1 {
+		t.Errorf("want 1 rollback, got %d", sbc0.RollbackCount)
+	}
+}
+
+func TestScatterConnEndPointsChanged(t *testing.T) {
+	s := createSandbox("TestScatterConnEndPointsChanged")
+	sbc := &sandboxConn{}
+	s.MapTestConn("0", sbc)
+	stc := NewScatterConn(new(sandboxTopo), "", "aa", 1*time.Millisecond, 3, 2*time.Millisecond, 1*time.Millisecond, 24*time.Hour)
+	stc.Execute(context.Background(), "query1", nil, "TestScatterConnEndPointsChanged", []string{"0"}, "", nil, false)
+
+	// unrelated changes keep the connection
+	stc.endPointsChanged("bb", "TestScatterConnEndPointsChanged", "0", "", &topo.EndPoints{})
+	stc.endPointsChanged("aa", "TestScatterConnEndPointsChanged", "0", "", &topo.EndPoints{Entries: []topo.EndPoint{sbc.EndPoint()}})
+	if got := stc.watchInvalidations.Counts()["TestScatterConnEndPointsChanged.0."]; got != 0 {
+		t.Errorf("invalidations: got %v, want 0", got)
+	}
+
+	// the end point went away, the connection is closed
+	stc.endPointsChanged("aa", "TestScatterConnEndPointsChanged", "0", "", &topo.EndPoints{Entries: []topo.EndPoint{{Uid: 10, Host: "0"}}})
+	if got := stc.watchInvalidations.Counts()["TestScatterConnEndPointsChanged.0."]; got != 1 {
+		t.Errorf("invalidations: got %v, want 1", got)
+	}
+	for i := 0; i < 100 && sbc.CloseCount.Get() == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := sbc.CloseCount.Get(); got != 1 {
+		t.Errorf("want 1 close, got %d", got)
+	}
 }
 
 func TestScatterConnClose(t *testing.T) {
@@ -502,3 +763,57 @@ func TestAppendResult(t *testing.T) {
 		t.Errorf("want 2, got %v", len(qr.Rows))
 	}
 }
+
+func TestScatterConnTransactionTimeout(t *testing.T) {
+	name := "TestScatterConnTransactionTimeout"
+	s := createSandbox(name)
+	sbc0 := &sandboxConn{}
+	s.MapTestConn("0", sbc0)
+	sbc1 := &sandboxConn{}
+	s.MapTestConn("1", sbc1)
+	defer func(timeout time.Duration) { *transactionTimeout = timeout }(*transactionTimeout)
+	// The janitor never runs by itself in this test.
+	*transactionTimeout = time.Hour
+	stc := NewScatterConn(new(sandboxTopo), "", "aa", 1*time.Millisecond, 3, 2*time.Millisecond, 1*time.Millisecond, 24*time.Hour)
+	defer stc.Close()
+	before := deadlineExceeded.Counts()["Transaction"]
+
+	session := NewSafeSession(&proto.Session{InTransaction: true})
+	for _, shard := range []string{"0", "1"} {
+		if _, err := stc.Execute(context.Background(), "query1", nil, name, []string{shard}, "", session, false); err != nil {
+			t.Fatalf("Execute failed: %v", err)
+		}
+	}
+	// Make the transaction of shard 0 old.
+	stc.txJanitor.mu.Lock()
+	stc.txJanitor.open[newTxKey(session.ShardSessions[0])] = time.Now().Add(-2 * time.Hour)
+	stc.txJanitor.mu.Unlock()
+	stc.txJanitor.expire()
+	if sbc0.RollbackCount.Get() != 1 {
+		t.Errorf("want 1, got %v", sbc0.RollbackCount.Get())
+	}
+	if sbc1.RollbackCount.Get() != 0 {
+		t.Errorf("want 0, got %v", sbc1.RollbackCount.Get())
+	}
+	if got := deadlineExceeded.Counts()["Transaction"] - before; got != 1 {
+		t.Errorf("Transaction deadlines: want 1, got %v", got)
+	}
+
+	want := "transaction 1 on TestScatterConnTransactionTimeout/0 was rolled back: it was open for longer than -transaction_timeout 1h0m0s"
+	_, err := stc.Execute(context.Background(), "query1", nil, name, []string{"0"}, "", session, false)
+	if err == nil || !strings.Contains(err.Error(), want) {
+		t.Errorf("want %v, got %v", want, err)
+	}
+	if err := stc.Commit(context.Background(), session); err == nil || err.Error() != want {
+		t.Errorf("want %v, got %v", want, err)
+	}
+	if sbc0.CommitCount.Get() != 0 || sbc1.CommitCount.Get() != 0 {
+		t.Errorf("want no commits, got %v and %v", sbc0.CommitCount.Get(), sbc1.CommitCount.Get())
+	}
+	if sbc1.RollbackCount.Get() != 1 {
+		t.Errorf("want 1, got %v", sbc1.RollbackCount.Get())
+	}
+	if session.InTransaction() {
+		t.Errorf("session is still in a transaction")
+	}
+}
@@ -5,6 +5,8 @@
 package vtgate
 
 import (
+	"errors"
+	"flag"
 	"fmt"
 	"sync"
 	"time"
@@ -18,15 +20,22 @@ import (
 	tproto "github.com/youtube/vitess/go/vt/tabletserver/proto"
 	"github.com/youtube/vitess/go/vt/tabletserver/tabletconn"
 	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/vt/vterrors"
 	"golang.org/x/net/context"
 )
 
-var danglingTabletConn = stats.NewInt("DanglingTabletConn")
+var (
+	danglingTabletConn = stats.NewInt("DanglingTabletConn")
+
+	shardAttemptTimeout = flag.Duration("shard_attempt_timeout", 0, "if set, how long a single non-streaming call to a tablet can take. A call that takes longer fails, and is not retried")
+)
 
 // ShardConn represents a load balanced connection to a group
 // of vttablets that belong to the same shard. ShardConn can
 // be concurrently used across goroutines. Such requests are
-// interleaved on the same underlying connection.
+// interleaved on the same underlying connection, or, with
+// -tablet_pool_size, spread over a pool of connections to the
+// same vttablet.
 type ShardConn struct {
 	keyspace           string
 	shard              string
@@ -40,11 +49,18 @@ type ShardConn struct {
 	consolidator       *sync2.Consolidator
 	ticker             *timer.RandTicker
 
+	// buffer is only set for master connections, with -enable_buffer.
+	buffer *masterBuffer
+
 	connectTimings *stats.MultiTimings
 
-	// conn needs a mutex because it can change during the lifetime of ShardConn.
+	poolSize        int
+	poolIdleTimeout time.Duration
+	poolStats       tabletPoolStats
+
+	// pool needs a mutex because it can change during the lifetime of ShardConn.
 	mu   sync.Mutex
-	conn tabletconn.TabletConn
+	pool *tabletConnPool
 }
 
 // NewShardConn creates a new ShardConn. It creates a Balancer using
@@ -58,7 +74,15 @@ func NewShardConn(ctx context.Context, serv SrvTopoServer, cell, keyspace, shard
 		}
 		return endpoints, nil
 	}
-	blc := NewBalancer(getAddresses, retryDelay)
+	probe := func(endPoint topo.EndPoint) error {
+		conn, err := tabletconn.GetDialer()(context.Background(), endPoint, keyspace, shard, connTimeoutPerConn)
+		if err != nil {
+			return err
+		}
+		conn.Close()
+		return nil
+	}
+	blc := NewBalancer(getAddresses, retryDelay, probe)
 	var ticker *timer.RandTicker
 	if tabletType != topo.TYPE_MASTER {
 		ticker = timer.NewRandTicker(connLife, connLife/2)
@@ -76,6 +100,11 @@ func NewShardConn(ctx context.Context, serv SrvTopoServer, cell, keyspace, shard
 		ticker:             ticker,
 		consolidator:       sync2.NewConsolidator(),
 		connectTimings:     tabletConnectTimings,
+		poolSize:           *tabletPoolSize,
+		poolIdleTimeout:    *tabletPoolIdleTimeout,
+	}
+	if tabletType == topo.TYPE_MASTER && *enableBuffer {
+		sdc.buffer = newMasterBuffer(keyspace, shard)
 	}
 	if ticker != nil {
 		go func() {
@@ -96,6 +125,25 @@ type ShardConnError struct {
 	Err error
 }
 
+// ErrorCode returns the code of the error of the tablet. The errors
+// talking to the tablet are transient.
+func (e *ShardConnError) ErrorCode() int64 {
+	if code := vterrors.RecoverCode(e.Err); code != vterrors.Unknown {
+		return int64(code)
+	}
+	switch e.Err.(type) {
+	case tabletconn.OperationalError:
+		if e.Err == tabletconn.Cancelled {
+			return int64(vterrors.Unknown)
+		}
+		return int64(vterrors.Transient)
+	}
+	if e.Err == errShardAttemptTimeout {
+		return int64(vterrors.DeadlineExceeded)
+	}
+	return int64(vterrors.Unknown)
+}
+
 func (e *ShardConnError) Error() string {
 	if e.ShardIdentifier == "" {
 		return fmt.Sprintf("%v", e.Err)
@@ -107,7 +155,7 @@ func (e *ShardConnError) Error() string {
 // It is not necessary to call this function before serving queries,
 // but it would reduce connection overhead when serving the first query.
 func (sdc *ShardConn) Dial(ctx context.Context) error {
-	return sdc.withRetry(ctx, func(conn tabletconn.TabletConn) error {
+	return sdc.withRetry(ctx, func(ctx context.Context, conn tabletconn.TabletConn) error {
 		return nil
 	}, 0, false)
 }
@@ -116,7 +164,7 @@ func (sdc *ShardConn) Dial(ctx context.Context) error {
 // it retries retryCount times before failing. It does not retry if the connection is in
 // the middle of a transaction.
 func (sdc *ShardConn) Execute(ctx context.Context, query string, bindVars map[string]interface{}, transactionID int64) (qr *mproto.QueryResult, err error) {
-	err = sdc.withRetry(ctx, func(conn tabletconn.TabletConn) error {
+	err = sdc.withRetry(ctx, func(ctx context.Context, conn tabletconn.TabletConn) error {
 		var innerErr error
 		qr, innerErr = conn.Execute(ctx, query, bindVars, transactionID)
 		return innerErr
@@ -126,7 +174,7 @@ func (sdc *ShardConn) Execute(ctx context.Context, query string, bindVars map[st
 
 // ExecuteBatch executes a group of queries. The retry rules are the same as Execute.
 func (sdc *ShardConn) ExecuteBatch(ctx context.Context, queries []tproto.BoundQuery, transactionID int64) (qrs *tproto.QueryResultList, err error) {
-	err = sdc.withRetry(ctx, func(conn tabletconn.TabletConn) error {
+	err = sdc.withRetry(ctx, func(ctx context.Context, conn tabletconn.TabletConn) error {
 		var innerErr error
 		qrs, innerErr = conn.ExecuteBatch(ctx, queries, transactionID)
 		return innerErr
@@ -136,25 +184,52 @@ func (sdc *ShardConn) ExecuteBatch(ctx context.Context, queries []tproto.BoundQu
 
 // StreamExecute executes a streaming query on vttablet. The retry rules are the same as Execute.
 func (sdc *ShardConn) StreamExecute(ctx context.Context, query string, bindVars map[string]interface{}, transactionID int64) (<-chan *mproto.QueryResult, tabletconn.ErrFunc) {
-	var usedConn tabletconn.TabletConn
+	var usedConn *pooledConn
 	var erFunc tabletconn.ErrFunc
 	var results <-chan *mproto.QueryResult
-	err := sdc.withRetry(ctx, func(conn tabletconn.TabletConn) error {
+	err := sdc.withRetry(ctx, func(ctx context.Context, conn tabletconn.TabletConn) error {
 		var err error
 		results, erFunc, err = conn.StreamExecute(ctx, query, bindVars, transactionID)
-		usedConn = conn
+		// withRetry always passes a *pooledConn.
+		usedConn = conn.(*pooledConn)
 		return err
 	}, transactionID, true)
 	if err != nil {
 		return results, func() error { return err }
 	}
 	inTransaction := (transactionID != 0)
-	return results, func() error { return sdc.WrapError(erFunc(), usedConn.EndPoint(), inTransaction) }
+	return sdc.recycleAfterStream(ctx, usedConn, results), func() error { return sdc.WrapError(erFunc(), usedConn.EndPoint(), inTransaction) }
+}
+
+// recycleAfterStream returns a channel that forwards results, and
+// gives conn back to its pool once the stream is over. A shared
+// connection needs no recycling, so results are returned as is.
+func (sdc *ShardConn) recycleAfterStream(ctx context.Context, conn *pooledConn, results <-chan *mproto.QueryResult) <-chan *mproto.QueryResult {
+	if conn.pool.shared != nil {
+		return results
+	}
+	forwarded := make(chan *mproto.QueryResult)
+	go func() {
+		defer close(forwarded)
+		defer conn.recycle()
+		for result := range results {
+			select {
+			case forwarded <- result:
+			case <-ctx.Done():
+				// Nobody reads forwarded any more: drain the stream,
+				// which ends with ctx.
+				for range results {
+				}
+				return
+			}
+		}
+	}()
+	return forwarded
 }
 
 // Begin begins a transaction. The retry rules are the same as Execute.
 func (sdc *ShardConn) Begin(ctx context.Context) (transactionID int64, err error) {
-	err = sdc.withRetry(ctx, func(conn tabletconn.TabletConn) error {
+	err = sdc.withRetry(ctx, func(ctx context.Context, conn tabletconn.TabletConn) error {
 		var innerErr error
 		transactionID, innerErr = conn.Begin(ctx)
 		return innerErr
@@ -164,23 +239,23 @@ func (sdc *ShardConn) Begin(ctx context.Context) (transactionID int64, err error
 
 // Commit commits the current transaction. The retry rules are the same as Execute.
 func (sdc *ShardConn) Commit(ctx context.Context, transactionID int64) (err error) {
-	return sdc.withRetry(ctx, func(conn tabletconn.TabletConn) error {
+	return sdc.withRetry(ctx, func(ctx context.Context, conn tabletconn.TabletConn) error {
 		return conn.Commit(ctx, transactionID)
 	}, transactionID, false)
 }
 
 // Rollback rolls back the current transaction. The retry rules are the same as Execute.
 func (sdc *ShardConn) Rollback(ctx context.Context, transactionID int64) (err error) {
-	return sdc.withRetry(ctx, func(conn tabletconn.TabletConn) error {
+	return sdc.withRetry(ctx, func(ctx context.Context, conn tabletconn.TabletConn) error {
 		return conn.Rollback(ctx, transactionID)
 	}, transactionID, false)
 }
 
 // SplitQuery splits a query into sub queries. The retry rules are the same as Execute.
-func (sdc *ShardConn) SplitQuery(ctx context.Context, query tproto.BoundQuery, splitCount int) (queries []tproto.QuerySplit, err error) {
-	err = sdc.withRetry(ctx, func(conn tabletconn.TabletConn) error {
+func (sdc *ShardConn) SplitQuery(ctx context.Context, query tproto.BoundQuery, splitColumn string, splitCount int) (queries []tproto.QuerySplit, err error) {
+	err = sdc.withRetry(ctx, func(ctx context.Context, conn tabletconn.TabletConn) error {
 		var innerErr error
-		queries, innerErr = conn.SplitQuery(ctx, query, splitCount)
+		queries, innerErr = conn.SplitQuery(ctx, query, splitColumn, splitCount)
 		return innerErr
 	}, 0, false)
 	return
@@ -191,33 +266,93 @@ func (sdc *ShardConn) Close() {
 	if sdc.ticker != nil {
 		sdc.ticker.Stop()
 	}
+	sdc.balancer.Close()
 	sdc.closeCurrent()
 }
 
 func (sdc *ShardConn) closeCurrent() {
 	sdc.mu.Lock()
 	defer sdc.mu.Unlock()
-	if sdc.conn == nil {
+	if sdc.pool == nil {
 		return
 	}
-	go func(conn tabletconn.TabletConn) {
-		danglingTabletConn.Add(1)
-		conn.Close()
-		danglingTabletConn.Add(-1)
-	}(sdc.conn)
-	sdc.conn = nil
+	sdc.pool.close()
+	sdc.pool = nil
+}
+
+// closeIfNotServing closes the current connections if their end point
+// is not in endPoints, so the next action connects to one of them.
+// It returns true if the connections were closed.
+func (sdc *ShardConn) closeIfNotServing(endPoints *topo.EndPoints) bool {
+	sdc.mu.Lock()
+	defer sdc.mu.Unlock()
+	if sdc.pool == nil {
+		return false
+	}
+	current := sdc.pool.endPoint
+	for _, endPoint := range endPoints.Entries {
+		if endPoint.Uid == current.Uid && endPoint.Host == current.Host {
+			return false
+		}
+	}
+	log.Infof("End point %+v of %v.%v.%v is not serving any more, closing its connections", current, sdc.keyspace, sdc.shard, sdc.tabletType)
+	sdc.pool.close()
+	sdc.pool = nil
+	return true
+}
+
+// poolCounts returns the capacity of the current connection pool,
+// and the number of its connections in use. Both are 0 if the
+// connection is shared.
+func (sdc *ShardConn) poolCounts() (capacity, inUse int) {
+	sdc.mu.Lock()
+	pool := sdc.pool
+	sdc.mu.Unlock()
+	if pool == nil {
+		return 0, 0
+	}
+	return pool.capacityAndInUse()
+}
+
+// drainBuffer retries the buffered requests, if the shard has
+// serving end points again.
+func (sdc *ShardConn) drainBuffer(endPoints *topo.EndPoints) {
+	if sdc.buffer == nil || len(endPoints.Entries) == 0 {
+		return
+	}
+	sdc.buffer.drain()
 }
 
 // withRetry sets up the connection and executes the action. If there are connection errors,
 // it retries retryCount times before failing. It does not retry if the connection is in
 // the middle of a transaction. While returning the error check if it maybe a result of
 // a resharding event, and set the re-resolve bit and let the upper layers
-// re-resolve and retry.
-func (sdc *ShardConn) withRetry(ctx context.Context, action func(conn tabletconn.TabletConn) error, transactionID int64, isStreaming bool) error {
-	var conn tabletconn.TabletConn
+// re-resolve and retry. If the master is unavailable and the request
+// is not part of a transaction, it is buffered until the master end
+// point changes. Only the requests that failed before they were
+// executed are buffered, and never the streaming ones.
+func (sdc *ShardConn) withRetry(ctx context.Context, action func(ctx context.Context, conn tabletconn.TabletConn) error, transactionID int64, isStreaming bool) error {
+	bufferable, err := sdc.withRetryUnbuffered(ctx, action, transactionID, isStreaming)
+	if !bufferable || sdc.buffer == nil || transactionID != 0 || isStreaming || ctx.Err() != nil {
+		return err
+	}
+	return sdc.buffer.do(ctx, err, func() (bool, error) {
+		return sdc.withRetryUnbuffered(ctx, action, transactionID, isStreaming)
+	})
+}
+
+// withRetryUnbuffered runs action with the retries of withRetry. It
+// also returns true if it failed only because the master was
+// unavailable before action was executed: it could not be reached, or
+// vttablet answered ERR_RETRY. Such a request can be buffered.
+func (sdc *ShardConn) withRetryUnbuffered(ctx context.Context, action func(ctx context.Context, conn tabletconn.TabletConn) error, transactionID int64, isStreaming bool) (bool, error) {
+	var conn *pooledConn
 	var endPoint topo.EndPoint
 	var err error
 	var isTimeout bool
+	// mayHaveExecuted is set once an attempt failed in a way that
+	// doesn't tell if action was executed.
+	mayHaveExecuted := false
 	inTransaction := (transactionID != 0)
 	// execute the action at least once even without retrying
 	for i := 0; i < sdc.retryCount+1; i++ {
@@ -229,67 +364,122 @@ func (sdc *ShardConn) withRetry(ctx context.Context, action func(conn tabletconn
 			time.Sleep(sdc.retryDelay)
 			continue
 		}
-		err = action(conn)
+		err = sdc.attempt(ctx, action, conn, isStreaming)
+		if err == nil {
+			sdc.balancer.MarkUp(endPoint.Uid)
+		} else if !isRetryError(err) {
+			mayHaveExecuted = true
+		}
+		if !isStreaming || err != nil {
+			// A successful stream keeps its connection
+			// until it is over.
+			conn.recycle()
+		}
+		if err == errShardAttemptTimeout {
+			// The tablet is slow, not down: it stays up, and the
+			// call is not retried.
+			err = tabletconn.OperationalError(fmt.Sprintf("vttablet: call exceeded -shard_attempt_timeout %v", *shardAttemptTimeout))
+			break
+		}
 		if sdc.canRetry(ctx, err, transactionID, conn, isStreaming) {
 			continue
 		}
 		break
 	}
-	return sdc.WrapError(err, endPoint, inTransaction)
+	return err != nil && !mayHaveExecuted, sdc.WrapError(err, endPoint, inTransaction)
+}
+
+// isRetryError returns true if err is an ERR_RETRY of vttablet, which
+// it only sends for the queries it did not execute.
+func isRetryError(err error) bool {
+	serverError, ok := err.(*tabletconn.ServerError)
+	return ok && serverError.Code == tabletconn.ERR_RETRY
+}
+
+var errShardAttemptTimeout = errors.New("shard attempt timeout")
+
+// attempt runs action once on conn. Non-streaming actions are bound
+// by -shard_attempt_timeout, and return errShardAttemptTimeout if it
+// expires before the deadline of ctx.
+func (sdc *ShardConn) attempt(ctx context.Context, action func(ctx context.Context, conn tabletconn.TabletConn) error, conn tabletconn.TabletConn, isStreaming bool) error {
+	if isStreaming || *shardAttemptTimeout == 0 {
+		return action(ctx, conn)
+	}
+	attemptCtx, cancel := context.WithTimeout(ctx, *shardAttemptTimeout)
+	defer cancel()
+	err := action(attemptCtx, conn)
+	if err != nil && attemptCtx.Err() == context.DeadlineExceeded && ctx.Err() == nil {
+		deadlineExceeded.Add("ShardAttempt", 1)
+		return errShardAttemptTimeout
+	}
+	return err
 }
 
 type connectResult struct {
-	Conn      tabletconn.TabletConn
 	EndPoint  topo.EndPoint
 	IsTimeout bool
 }
 
-// getConn reuses an existing connection if possible.
-// If no connection is available,
-// it creates a new connection if no connection is being created.
-// Otherwise it waits for the connection to be created.
-func (sdc *ShardConn) getConn(ctx context.Context) (conn tabletconn.TabletConn, endPoint topo.EndPoint, isTimeout bool, err error) {
-	sdc.mu.Lock()
-	if sdc.conn != nil {
-		conn = sdc.conn
-		endPoint = conn.EndPoint()
-		sdc.mu.Unlock()
-		return conn, endPoint, false, nil
-	}
+// getConn gets a connection from the current pool if possible. If
+// all its connections are in use, it waits for one until the deadline
+// of ctx. If there is no pool, it connects to an end point and creates
+// the pool if no connection is being created. Otherwise it waits for
+// the connection to be created.
+func (sdc *ShardConn) getConn(ctx context.Context) (conn *pooledConn, endPoint topo.EndPoint, isTimeout bool, err error) {
+	for {
+		sdc.mu.Lock()
+		if pool := sdc.pool; pool != nil {
+			sdc.mu.Unlock()
+			conn, err = pool.get(ctx)
+			switch {
+			case err == errPoolClosed:
+				// The end point changed in the meantime.
+				continue
+			case err != nil && ctx.Err() != nil:
+				return nil, pool.endPoint, true, err
+			case err != nil:
+				sdc.markDown(pool, err.Error())
+				return nil, pool.endPoint, false, err
+			}
+			return conn, pool.endPoint, false, nil
+		}
 
-	key := fmt.Sprintf("%s.%s.%s", sdc.keyspace, sdc.shard, sdc.tabletType)
-	q, ok := sdc.consolidator.Create(key)
-	sdc.mu.Unlock()
-	if ok {
-		defer q.Broadcast()
-		conn, endPoint, isTimeout, err := sdc.getNewConn(ctx)
-		log.Infof("Connecting to end point: %v", endPoint)
-		q.Result = &connectResult{Conn: conn, EndPoint: endPoint, IsTimeout: isTimeout}
-		q.Err = err
-	} else {
-		q.Wait()
+		key := fmt.Sprintf("%s.%s.%s", sdc.keyspace, sdc.shard, sdc.tabletType)
+		q, ok := sdc.consolidator.Create(key)
+		sdc.mu.Unlock()
+		if ok {
+			endPoint, isTimeout, err := sdc.getNewConn(ctx)
+			log.Infof("Connecting to end point: %v", endPoint)
+			q.Result = &connectResult{EndPoint: endPoint, IsTimeout: isTimeout}
+			q.Err = err
+			q.Broadcast()
+		} else {
+			q.Wait()
+		}
+		if q.Err != nil {
+			connResult := q.Result.(*connectResult)
+			return nil, connResult.EndPoint, connResult.IsTimeout, q.Err
+		}
 	}
-
-	connResult := q.Result.(*connectResult)
-	return connResult.Conn, connResult.EndPoint, connResult.IsTimeout, q.Err
 }
 
-// getNewConn creates a new tablet connection with a separate per conn timeout.
+// getNewConn creates a new tablet connection with a separate per conn timeout,
+// and the pool of connections to its end point.
 // It limits the overall timeout to connTimeoutTotal by checking elapsed time after each blocking call.
-func (sdc *ShardConn) getNewConn(ctx context.Context) (conn tabletconn.TabletConn, endPoint topo.EndPoint, isTimeout bool, err error) {
+func (sdc *ShardConn) getNewConn(ctx context.Context) (endPoint topo.EndPoint, isTimeout bool, err error) {
 	startTime := time.Now()
 
 	endPoints, err := sdc.balancer.Get()
 	if err != nil {
 		// Error when getting endpoint
-		return nil, topo.EndPoint{}, false, err
+		return topo.EndPoint{}, false, err
 	}
 	if len(endPoints) == 0 {
 		// No valid endpoint
-		return nil, topo.EndPoint{}, false, fmt.Errorf("no valid endpoint")
+		return topo.EndPoint{}, false, fmt.Errorf("no valid endpoint")
 	}
 	if time.Now().Sub(startTime) >= sdc.connTimeoutTotal {
-		return nil, topo.EndPoint{}, true, fmt.Errorf("timeout when getting endpoints")
+		return topo.EndPoint{}, true, fmt.Errorf("timeout when getting endpoints")
 	}
 
 	// Iterate through all endpoints to create a connection
@@ -297,13 +487,13 @@ func (sdc *ShardConn) getNewConn(ctx context.Context) (conn tabletconn.TabletCon
 	allErrors := new(concurrency.AllErrorRecorder)
 	for _, endPoint := range endPoints {
 		perConnStartTime := time.Now()
-		conn, err = tabletconn.GetDialer()(ctx, endPoint, sdc.keyspace, sdc.shard, perConnTimeout)
+		conn, err := tabletconn.GetDialer()(ctx, endPoint, sdc.keyspace, sdc.shard, perConnTimeout)
 		if err == nil {
 			sdc.connectTimings.Record([]string{sdc.keyspace, sdc.shard, string(sdc.tabletType)}, perConnStartTime)
 			sdc.mu.Lock()
 			defer sdc.mu.Unlock()
-			sdc.conn = conn
-			return conn, endPoint, false, nil
+			sdc.pool = newTabletConnPool(conn, sdc.dialer(endPoint), sdc.poolSize, sdc.poolIdleTimeout, &sdc.poolStats)
+			return endPoint, false, nil
 		}
 		// Markdown the endpoint if it failed to connect
 		sdc.balancer.MarkDown(endPoint.Uid, err.Error())
@@ -311,10 +501,24 @@ func (sdc *ShardConn) getNewConn(ctx context.Context) (conn tabletconn.TabletCon
 		if time.Now().Sub(startTime) >= sdc.connTimeoutTotal {
 			err = fmt.Errorf("timeout when connecting to %+v", endPoint)
 			allErrors.RecordError(err)
-			return nil, topo.EndPoint{}, true, allErrors.Error()
+			return topo.EndPoint{}, true, allErrors.Error()
 		}
 	}
-	return nil, topo.EndPoint{}, false, allErrors.Error()
+	return topo.EndPoint{}, false, allErrors.Error()
+}
+
+// dialer returns the function a pool uses to open more connections
+// to endPoint.
+func (sdc *ShardConn) dialer(endPoint topo.EndPoint) func(ctx context.Context) (tabletconn.TabletConn, error) {
+	return func(ctx context.Context) (tabletconn.TabletConn, error) {
+		startTime := time.Now()
+		conn, err := tabletconn.GetDialer()(ctx, endPoint, sdc.keyspace, sdc.shard, sdc.connTimeoutTotal)
+		if err != nil {
+			return nil, fmt.Errorf("%v %+v", err, endPoint)
+		}
+		sdc.connectTimings.Record([]string{sdc.keyspace, sdc.shard, string(sdc.tabletType)}, startTime)
+		return conn, nil
+	}
 }
 
 // getConnTimeoutPerConn determines the appropriate timeout per connection.
@@ -331,7 +535,7 @@ func (sdc *ShardConn) getConnTimeoutPerConn(endPointCount int) time.Duration {
 // canRetry determines whether a query can be retried or not.
 // OperationalErrors like retry/fatal cause a reconnect and retry if query is not in a txn.
 // TxPoolFull causes a retry and all other errors are non-retry.
-func (sdc *ShardConn) canRetry(ctx context.Context, err error, transactionID int64, conn tabletconn.TabletConn, isStreaming bool) bool {
+func (sdc *ShardConn) canRetry(ctx context.Context, err error, transactionID int64, conn *pooledConn, isStreaming bool) bool {
 	if err == nil {
 		return false
 	}
@@ -356,7 +560,7 @@ func (sdc *ShardConn) canRetry(ctx context.Context, err error, transactionID int
 		case tabletconn.ERR_RETRY:
 			// Retry on RETRY and FATAL if not in a transaction.
 			inTransaction := (transactionID != 0)
-			sdc.markDown(conn, err.Error())
+			sdc.markDown(conn.pool, err.Error())
 			return !inTransaction
 		default:
 			// Not retry for TX_POOL_FULL and normal server errors.
@@ -367,26 +571,21 @@ func (sdc *ShardConn) canRetry(ctx context.Context, err error, transactionID int
 	// TODO(liang): handle the case when VTGate is idle
 	// while vttablet is gracefully shutdown.
 	// We want to retry in that case.
-	sdc.markDown(conn, err.Error())
+	sdc.markDown(conn.pool, err.Error())
 	return false
 }
 
-// markDown closes conn and temporarily marks the associated
-// end point as unusable.
-func (sdc *ShardConn) markDown(conn tabletconn.TabletConn, reason string) {
+// markDown closes the connections of pool and temporarily marks
+// the associated end point as unusable.
+func (sdc *ShardConn) markDown(pool *tabletConnPool, reason string) {
 	sdc.mu.Lock()
 	defer sdc.mu.Unlock()
-	if conn != sdc.conn {
+	if pool != sdc.pool {
 		return
 	}
-	sdc.balancer.MarkDown(conn.EndPoint().Uid, reason)
-
-	go func(conn tabletconn.TabletConn) {
-		danglingTabletConn.Add(1)
-		conn.Close()
-		danglingTabletConn.Add(-1)
-	}(sdc.conn)
-	sdc.conn = nil
+	sdc.balancer.MarkDown(pool.endPoint.Uid, reason)
+	sdc.pool.close()
+	sdc.pool = nil
 }
 
 // WrapError returns ShardConnError which preserves the original error code if possible,
@@ -7,6 +7,7 @@ package vtgate
 import (
 	"fmt"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -789,3 +790,299 @@ func TestMasterShardConnLife(t *testing.T) {
 	}
 	sdc.Close()
 }
+
+func newTestBufferedShardConn(name string, window time.Duration, size int) *ShardConn {
+	sdc := NewShardConn(context.Background(), new(sandboxTopo), "aa", name, "0", topo.TYPE_MASTER, retryDelay, retryCount, connTimeoutTotal, connTimeoutPerConn, 24*time.Hour, connectTimings)
+	sdc.buffer = &masterBuffer{
+		keyspace: name,
+		shard:    "0",
+		window:   window,
+		size:     size,
+		changed:  make(chan struct{}),
+	}
+	return sdc
+}
+
+func waitForBuffered(t *testing.T, mb *masterBuffer, want int) {
+	for i := 0; i < 100; i++ {
+		mb.mu.Lock()
+		buffered := mb.buffered
+		mb.mu.Unlock()
+		if buffered == want {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("buffered requests never reached %v", want)
+}
+
+func TestShardConnBufferDrain(t *testing.T) {
+	name := "TestShardConnBufferDrain"
+	s := createSandbox(name)
+	sbc0 := &sandboxConn{mustFailRetry: 1000}
+	s.MapTestConn("0", sbc0)
+	sdc := newTestBufferedShardConn(name, 10*time.Second, 10)
+	defer sdc.Close()
+	results := bufferResults.Counts()
+
+	done := make(chan error)
+	go func() {
+		_, err := sdc.Execute(context.Background(), "query", nil, 0)
+		done <- err
+	}()
+	waitForBuffered(t, sdc.buffer, 1)
+	if got := bufferedRequests.Counts()[name+".0"]; got != 1 {
+		t.Errorf("BufferedRequests: %v, want 1", got)
+	}
+
+	// the new master is up
+	s.DeleteTestConn("0", sbc0)
+	sbc1 := &sandboxConn{}
+	s.MapTestConn("0", sbc1)
+	sdc.drainBuffer(&topo.EndPoints{Entries: []topo.EndPoint{sbc1.EndPoint()}})
+	if err := <-done; err != nil {
+		t.Errorf("buffered Execute failed: %v", err)
+	}
+	if got := sbc1.ExecCount.Get(); got != 1 {
+		t.Errorf("ExecCount on the new master: %v, want 1", got)
+	}
+	if got := bufferedRequests.Counts()[name+".0"]; got != 0 {
+		t.Errorf("BufferedRequests: %v, want 0", got)
+	}
+	if got := bufferResults.Counts()[name+".0.DrainSuccess"] - results[name+".0.DrainSuccess"]; got != 1 {
+		t.Errorf("BufferResults DrainSuccess: %v, want 1", got)
+	}
+}
+
+func TestShardConnBufferWindowExpired(t *testing.T) {
+	name := "TestShardConnBufferWindowExpired"
+	s := createSandbox(name)
+	s.MapTestConn("0", &sandboxConn{mustFailRetry: 1000})
+	sdc := newTestBufferedShardConn(name, 10*time.Millisecond, 10)
+	defer sdc.Close()
+	results := bufferResults.Counts()
+
+	_, err := sdc.Execute(context.Background(), "query", nil, 0)
+	if err == nil {
+		t.Errorf("Execute with an expired buffer window should fail")
+	}
+	if got := bufferResults.Counts()[name+".0.WindowExpired"] - results[name+".0.WindowExpired"]; got != 1 {
+		t.Errorf("BufferResults WindowExpired: %v, want 1", got)
+	}
+}
+
+func TestShardConnBufferFull(t *testing.T) {
+	name := "TestShardConnBufferFull"
+	s := createSandbox(name)
+	s.MapTestConn("0", &sandboxConn{mustFailRetry: 1000})
+	sdc := newTestBufferedShardConn(name, 10*time.Second, 1)
+	defer sdc.Close()
+	results := bufferResults.Counts()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		_, err := sdc.Execute(ctx, "query", nil, 0)
+		done <- err
+	}()
+	waitForBuffered(t, sdc.buffer, 1)
+
+	if _, err := sdc.Execute(context.Background(), "query", nil, 0); err == nil {
+		t.Errorf("Execute with a full buffer should fail")
+	}
+	if got := bufferResults.Counts()[name+".0.BufferFull"] - results[name+".0.BufferFull"]; got != 1 {
+		t.Errorf("BufferResults BufferFull: %v, want 1", got)
+	}
+
+	cancel()
+	if err := <-done; err == nil {
+		t.Errorf("cancelled buffered Execute should fail")
+	}
+	if got := bufferResults.Counts()[name+".0.Cancelled"] - results[name+".0.Cancelled"]; got != 1 {
+		t.Errorf("BufferResults Cancelled: %v, want 1", got)
+	}
+}
+
+func TestShardConnBufferShutdown(t *testing.T) {
+	name := "TestShardConnBufferShutdown"
+	s := createSandbox(name)
+	s.MapTestConn("0", &sandboxConn{mustFailRetry: 1000})
+	sdc := newTestBufferedShardConn(name, 10*time.Second, 10)
+	defer sdc.Close()
+	defer func() {
+		buffersShutdown = make(chan struct{})
+		buffersShutdownOnce = sync.Once{}
+	}()
+	results := bufferResults.Counts()
+
+	done := make(chan error)
+	go func() {
+		_, err := sdc.Execute(context.Background(), "query", nil, 0)
+		done <- err
+	}()
+	waitForBuffered(t, sdc.buffer, 1)
+
+	// the buffered request fails, and new ones are not buffered
+	shutdownBuffers()
+	if err := <-done; err == nil {
+		t.Errorf("buffered Execute should fail on shutdown")
+	}
+	if _, err := sdc.Execute(context.Background(), "query", nil, 0); err == nil {
+		t.Errorf("Execute after shutdown should fail")
+	}
+	if got := bufferResults.Counts()[name+".0.Shutdown"] - results[name+".0.Shutdown"]; got != 2 {
+		t.Errorf("BufferResults Shutdown: %v, want 2", got)
+	}
+}
+
+func TestShardConnBufferInTransaction(t *testing.T) {
+	name := "TestShardConnBufferInTransaction"
+	s := createSandbox(name)
+	s.MapTestConn("0", &sandboxConn{mustFailRetry: 1000})
+	sdc := newTestBufferedShardConn(name, 10*time.Second, 10)
+	defer sdc.Close()
+	results := bufferResults.Counts()
+
+	if _, err := sdc.Execute(context.Background(), "query", nil, 1); err == nil {
+		t.Errorf("Execute in a transaction should fail")
+	}
+	for key, count := range bufferResults.Counts() {
+		if strings.HasPrefix(key, name+".") && count != results[key] {
+			t.Errorf("BufferResults %v: %v, want no buffering in a transaction", key, count)
+		}
+	}
+}
+
+func TestShardConnBufferNotExecutedOnly(t *testing.T) {
+	name := "TestShardConnBufferNotExecutedOnly"
+	s := createSandbox(name)
+	sdc := newTestBufferedShardConn(name, 10*time.Second, 10)
+	defer sdc.Close()
+	results := bufferResults.Counts()
+
+	// a fatal error, or a connection lost during the query, may
+	// happen after the query was executed
+	for _, sbc := range []*sandboxConn{{mustFailFatal: 1000}, {mustFailConn: 1000}} {
+		s.MapTestConn("0", sbc)
+		if _, err := sdc.Execute(context.Background(), "query", nil, 0); err == nil {
+			t.Errorf("Execute should fail")
+		}
+		s.DeleteTestConn("0", sbc)
+	}
+	// a stream may have sent rows already
+	s.MapTestConn("0", &sandboxConn{mustFailRetry: 1000})
+	_, errFunc := sdc.StreamExecute(context.Background(), "query", nil, 0)
+	if err := errFunc(); err == nil {
+		t.Errorf("StreamExecute should fail")
+	}
+	for key, count := range bufferResults.Counts() {
+		if strings.HasPrefix(key, name+".") && count != results[key] {
+			t.Errorf("BufferResults %v: %v, want no buffering", key, count)
+		}
+	}
+}
+
+func TestShardConnAttemptTimeout(t *testing.T) {
+	name := "TestShardConnAttemptTimeout"
+	s := createSandbox(name)
+	sbc := &sandboxConn{mustDelay: time.Second}
+	s.MapTestConn("0", sbc)
+	defer func(timeout time.Duration) { *shardAttemptTimeout = timeout }(*shardAttemptTimeout)
+	*shardAttemptTimeout = 10 * time.Millisecond
+	before := deadlineExceeded.Counts()["ShardAttempt"]
+
+	sdc := NewShardConn(context.Background(), new(sandboxTopo), "aa", name, "0", "", retryDelay, retryCount, connTimeoutTotal, connTimeoutPerConn, 24*time.Hour, connectTimings)
+	_, err := sdc.Execute(context.Background(), "query", nil, 0)
+	want := "call exceeded -shard_attempt_timeout 10ms"
+	if err == nil || !strings.Contains(err.Error(), want) {
+		t.Errorf("want %v, got %v", want, err)
+	}
+	// The slow tablet is not retried.
+	if execCount := sbc.ExecCount.Get(); execCount != 1 {
+		t.Errorf("want 1, got %v", execCount)
+	}
+	if got := deadlineExceeded.Counts()["ShardAttempt"] - before; got != 1 {
+		t.Errorf("ShardAttempt deadlines: want 1, got %v", got)
+	}
+
+	// The caller deadline is not counted as a shard attempt deadline.
+	*shardAttemptTimeout = time.Second
+	sbc.mustDelay = time.Minute
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := sdc.Execute(ctx, "query", nil, 0); err == nil || !strings.Contains(err.Error(), "deadline exceeded") {
+		t.Errorf("want deadline exceeded, got %v", err)
+	}
+	if got := deadlineExceeded.Counts()["ShardAttempt"] - before; got != 1 {
+		t.Errorf("ShardAttempt deadlines: want 1, got %v", got)
+	}
+}
+
+func TestShardConnPool(t *testing.T) {
+	s := createSandbox("TestShardConnPool")
+	sbc := &sandboxConn{mustDelay: 20 * time.Millisecond}
+	s.MapTestConn("0", sbc)
+	sdc := NewShardConn(context.Background(), new(sandboxTopo), "aa", "TestShardConnPool", "0", "", retryDelay, retryCount, connTimeoutTotal, connTimeoutPerConn, 24*time.Hour, connectTimings)
+	defer sdc.Close()
+	sdc.poolSize = 2
+
+	// Three concurrent calls: two connections are opened, and the
+	// third call waits for one of them.
+	errs := make(chan error, 3)
+	for i := 0; i < 3; i++ {
+		go func() {
+			_, err := sdc.Execute(context.Background(), "query", nil, 0)
+			errs <- err
+		}()
+	}
+	for i := 0; i < 3; i++ {
+		if err := <-errs; err != nil {
+			t.Errorf("Execute: %v", err)
+		}
+	}
+	if s.DialCounter != 2 {
+		t.Errorf("DialCounter: %d, want 2", s.DialCounter)
+	}
+	if got := sdc.poolStats.waitCount.Get(); got != 1 {
+		t.Errorf("waitCount: %d, want 1", got)
+	}
+	if capacity, inUse := sdc.poolCounts(); capacity != 2 || inUse != 0 {
+		t.Errorf("poolCounts: %v, %v, want 2, 0", capacity, inUse)
+	}
+
+	// A call that cannot get a connection before its deadline fails,
+	// and is not retried.
+	for i := 0; i < 2; i++ {
+		go func() {
+			_, err := sdc.Execute(context.Background(), "query", nil, 0)
+			errs <- err
+		}()
+	}
+	time.Sleep(5 * time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	_, err := sdc.Execute(ctx, "query", nil, 0)
+	want := "no free connection to"
+	if err == nil || !strings.Contains(err.Error(), want) {
+		t.Errorf("Execute on a full pool: %v, want %v", err, want)
+	}
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err != nil {
+			t.Errorf("Execute: %v", err)
+		}
+	}
+
+	// A stream keeps its connection until it is over.
+	results, errFunc := sdc.StreamExecute(context.Background(), "query", nil, 0)
+	if _, inUse := sdc.poolCounts(); inUse != 1 {
+		t.Errorf("inUse during the stream: %v, want 1", inUse)
+	}
+	for range results {
+	}
+	if err := errFunc(); err != nil {
+		t.Errorf("StreamExecute: %v", err)
+	}
+	if _, inUse := sdc.poolCounts(); inUse != 0 {
+		t.Errorf("inUse after the stream: %v, want 0", inUse)
+	}
+}
@@ -21,7 +21,8 @@ import (
 )
 
 var (
-	srvTopoCacheTTL    = flag.Duration("srv_topo_cache_ttl", 1*time.Second, "how long to use cached entries for topology")
+	srvTopoCacheTTL    = flag.Duration("srv_topo_cache_ttl", 1*time.Second, "how long to use cached entries for topology, unless they are kept up to date by a watch")
+	srvTopoWatch       = flag.Bool("srv_topo_watch", true, "watch the serving endpoints in the topology if the topology server supports it, instead of polling them every srv_topo_cache_ttl")
 	enableRemoteMaster = flag.Bool("enable_remote_master", false, "enable remote master access")
 )
 
@@ -45,14 +46,27 @@ type SrvTopoServer interface {
 	GetEndPoints(context context.Context, cell, keyspace, shard string, tabletType topo.TabletType) (*topo.EndPoints, error)
 }
 
+// EndPointsListener is called with the new value of watched EndPoints.
+type EndPointsListener func(cell, keyspace, shard string, tabletType topo.TabletType, endPoints *topo.EndPoints)
+
+// EndPointsNotifier is implemented by the SrvTopoServer implementations
+// that watch the EndPoints they return, and can tell their clients
+// as soon as they change.
+type EndPointsNotifier interface {
+	AddEndPointsListener(listener EndPointsListener)
+}
+
 // ResilientSrvTopoServer is an implementation of SrvTopoServer based
 // on a topo.Server that uses a cache for two purposes:
 // - limit the QPS to the underlying topo.Server
 // - return the last known value of the data if there is an error
+// EndPoints are watched if the topo.Server supports it, and the
+// watched entries are used until the watch tells they changed.
 type ResilientSrvTopoServer struct {
 	topoServer         topo.Server
 	cacheTTL           time.Duration
 	enableRemoteMaster bool
+	watchEndPoints     bool
 	counts             *stats.Counters
 
 	// mutex protects the cache map itself, not the individual
@@ -65,6 +79,9 @@ type ResilientSrvTopoServer struct {
 
 	// GetEndPoints stats.
 	endPointCounters *endPointCounters
+
+	listenersMutex     sync.Mutex
+	endPointsListeners []EndPointsListener
 }
 
 type endPointCounters struct {
@@ -79,6 +96,7 @@ type endPointCounters struct {
 	remoteLookupErrors  *stats.MultiCounters
 	lookupErrors        *stats.MultiCounters
 	staleCacheFallbacks *stats.MultiCounters
+	watchUpdates        *stats.MultiCounters
 }
 
 func newEndPointCounters(counterPrefix string) *endPointCounters {
@@ -95,6 +113,7 @@ func newEndPointCounters(counterPrefix string) *endPointCounters {
 		remoteLookupErrors:  stats.NewMultiCounters(counterPrefix+"EndPointRemoteLookupErrorCount", labels),
 		lookupErrors:        stats.NewMultiCounters(counterPrefix+"EndPointLookupErrorCount", labels),
 		staleCacheFallbacks: stats.NewMultiCounters(counterPrefix+"EndPointStaleCacheFallbackCount", labels),
+		watchUpdates:        stats.NewMultiCounters(counterPrefix+"EndPointWatchUpdateCount", labels),
 	}
 }
 
@@ -151,6 +170,11 @@ type endPointsEntry struct {
 	// the mutex protects any access to this structure (read or write)
 	mutex sync.Mutex
 
+	// watchStarted is set once we tried to watch the end points,
+	// watched while the watch is running.
+	watchStarted bool
+	watched      bool
+
 	insertionTime time.Time
 
 	// value is the end points that were returned to the client.
@@ -202,6 +226,7 @@ func NewResilientSrvTopoServer(base topo.Server, counterPrefix string) *Resilien
 		topoServer:         base,
 		cacheTTL:           *srvTopoCacheTTL,
 		enableRemoteMaster: *enableRemoteMaster,
+		watchEndPoints:     *srvTopoWatch,
 		counts:             stats.NewCounters(counterPrefix + "Counts"),
 
 		srvKeyspaceNamesCache: make(map[string]*srvKeyspaceNamesEntry),
@@ -413,8 +438,14 @@ func (server *ResilientSrvTopoServer) GetEndPoints(context context.Context, cell
 		}
 	}()
 
-	// If the entry is fresh enough, return it
-	if time.Now().Sub(entry.insertionTime) < server.cacheTTL {
+	if server.watchEndPoints && !entry.watchStarted {
+		entry.watchStarted = true
+		server.startWatchingEndPoints(entry, key)
+	}
+
+	// If the entry is fresh enough, or kept up to date by the
+	// watch, return it. Remote entries are not watched.
+	if time.Now().Sub(entry.insertionTime) < server.cacheTTL || (entry.watched && !entry.remote && !entry.insertionTime.IsZero()) {
 		server.endPointCounters.cacheHits.Add(key, 1)
 		remote = entry.remote
 		return entry.value, entry.lastError
@@ -463,6 +494,63 @@ func (server *ResilientSrvTopoServer) GetEndPoints(context context.Context, cell
 	return entry.value, err
 }
 
+// AddEndPointsListener is part of the EndPointsNotifier interface.
+// The listener is called every time a watch returns new EndPoints.
+func (server *ResilientSrvTopoServer) AddEndPointsListener(listener EndPointsListener) {
+	server.listenersMutex.Lock()
+	defer server.listenersMutex.Unlock()
+	server.endPointsListeners = append(server.endPointsListeners, listener)
+}
+
+// startWatchingEndPoints starts the watch of an entry. If the
+// topo.Server cannot watch it, the entry is polled instead.
+// It has to be called with the entry mutex held.
+func (server *ResilientSrvTopoServer) startWatchingEndPoints(entry *endPointsEntry, key []string) {
+	notifications, _, err := server.topoServer.WatchEndPoints(entry.cell, entry.keyspace, entry.shard, entry.tabletType)
+	if err != nil {
+		log.Infof("WatchEndPoints(%v, %v, %v, %v) failed, polling every %v instead: %v", entry.cell, entry.keyspace, entry.shard, entry.tabletType, server.cacheTTL, err)
+		return
+	}
+	entry.watched = true
+	go server.watchEndPointsEntry(entry, key, notifications)
+}
+
+// watchEndPointsEntry updates the entry with the notifications of
+// its watch, and passes them to the listeners.
+func (server *ResilientSrvTopoServer) watchEndPointsEntry(entry *endPointsEntry, key []string, notifications <-chan *topo.EndPoints) {
+	for endPoints := range notifications {
+		server.endPointCounters.watchUpdates.Add(key, 1)
+		entry.mutex.Lock()
+		if endPoints == nil {
+			// The EndPoints don't exist, let the next
+			// GetEndPoints ask the topo.Server again.
+			entry.insertionTime = time.Time{}
+			entry.mutex.Unlock()
+			continue
+		}
+		entry.insertionTime = time.Now()
+		entry.originalValue = endPoints
+		entry.value = filterUnhealthyServers(endPoints)
+		entry.lastError = nil
+		entry.lastErrorContext = nil
+		entry.remote = false
+		value := entry.value
+		entry.mutex.Unlock()
+
+		server.listenersMutex.Lock()
+		listeners := server.endPointsListeners
+		server.listenersMutex.Unlock()
+		for _, listener := range listeners {
+			listener(entry.cell, entry.keyspace, entry.shard, entry.tabletType, value)
+		}
+	}
+
+	log.Warningf("Watch of EndPoints(%v, %v, %v, %v) stopped, polling every %v instead", entry.cell, entry.keyspace, entry.shard, entry.tabletType, server.cacheTTL)
+	entry.mutex.Lock()
+	entry.watched = false
+	entry.mutex.Unlock()
+}
+
 // The next few structures and methods are used to get a displayable
 // version of the cache in a status page
 
@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/youtube/vitess/go/vt/topo"
 	"github.com/youtube/vitess/go/vt/topo/test/faketopo"
@@ -350,3 +351,67 @@ func TestCachedErrors(t *testing.T) {
 		t.Fatalf("GetSrvKeyspace was not called again: %v times", ft.callCount)
 	}
 }
+
+// fakeTopoWatch is used to test the EndPoints watches.
+type fakeTopoWatch struct {
+	faketopo.FakeTopo
+	callCount     int
+	notifications chan *topo.EndPoints
+}
+
+func (ft *fakeTopoWatch) GetEndPoints(cell, keyspace, shard string, tabletType topo.TabletType) (*topo.EndPoints, error) {
+	ft.callCount++
+	return &topo.EndPoints{Entries: []topo.EndPoint{{Uid: 0}}}, nil
+}
+
+func (ft *fakeTopoWatch) WatchEndPoints(cell, keyspace, shard string, tabletType topo.TabletType) (<-chan *topo.EndPoints, chan<- struct{}, error) {
+	return ft.notifications, make(chan struct{}), nil
+}
+
+// TestWatchEndPoints will test the watched EndPoints are not polled.
+func TestWatchEndPoints(t *testing.T) {
+	ft := &fakeTopoWatch{notifications: make(chan *topo.EndPoints)}
+	rsts := NewResilientSrvTopoServer(ft, "TestWatchEndPoints")
+	rsts.cacheTTL = 0
+	rsts.watchEndPoints = true
+	listened := make(chan *topo.EndPoints, 1)
+	rsts.AddEndPointsListener(func(cell, keyspace, shard string, tabletType topo.TabletType, endPoints *topo.EndPoints) {
+		listened <- endPoints
+	})
+
+	for i := 0; i < 3; i++ {
+		ep, err := rsts.GetEndPoints(context.Background(), "cell1", "test_ks", "0", topo.TYPE_MASTER)
+		if err != nil || ep.Entries[0].Uid != 0 {
+			t.Fatalf("GetEndPoints got %v %v, want uid 0", ep, err)
+		}
+	}
+	if ft.callCount != 1 {
+		t.Errorf("GetEndPoints was called %v times, want 1", ft.callCount)
+	}
+
+	// a notification updates the cache and the listeners
+	ft.notifications <- &topo.EndPoints{Entries: []topo.EndPoint{{Uid: 1}}}
+	if got := <-listened; got.Entries[0].Uid != 1 {
+		t.Errorf("listener got %v, want uid 1", got)
+	}
+	ep, err := rsts.GetEndPoints(context.Background(), "cell1", "test_ks", "0", topo.TYPE_MASTER)
+	if err != nil || ep.Entries[0].Uid != 1 {
+		t.Errorf("GetEndPoints got %v %v, want uid 1", ep, err)
+	}
+	if ft.callCount != 1 {
+		t.Errorf("GetEndPoints was called %v times, want 1", ft.callCount)
+	}
+	if got := rsts.endPointCounters.watchUpdates.Counts()["cell1.test_ks.0.master"]; got != 1 {
+		t.Errorf("watch updates: got %v, want 1", got)
+	}
+
+	// once the watch stops, the entry is polled again
+	close(ft.notifications)
+	for i := 0; i < 100 && ft.callCount == 1; i++ {
+		time.Sleep(10 * time.Millisecond)
+		rsts.GetEndPoints(context.Background(), "cell1", "test_ks", "0", topo.TYPE_MASTER)
+	}
+	if ft.callCount == 1 {
+		t.Errorf("GetEndPoints was not polled after the watch stopped")
+	}
+}
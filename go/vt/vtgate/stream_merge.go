@@ -0,0 +1,285 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vtgate
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+
+	mproto "github.com/youtube/vitess/go/mysql/proto"
+	"github.com/youtube/vitess/go/sqltypes"
+	"github.com/youtube/vitess/go/vt/sqlparser"
+)
+
+// This file contains the ordered merge of the streaming results of
+// multiple shards.
+
+// orderByColumn is a column of the ORDER BY clause of a query.
+type orderByColumn struct {
+	name       string
+	descending bool
+}
+
+// getOrderBy returns the ORDER BY columns of a select query. They
+// have to be plain column names, so they can be found in the fields
+// of the results.
+func getOrderBy(sql string) ([]orderByColumn, error) {
+	statement, err := sqlparser.Parse(sql)
+	if err != nil {
+		return nil, err
+	}
+	sel, ok := statement.(*sqlparser.Select)
+	if !ok {
+		return nil, fmt.Errorf("ordered merge needs a select query: %v", sql)
+	}
+	if len(sel.OrderBy) == 0 {
+		return nil, fmt.Errorf("ordered merge needs an ORDER BY clause: %v", sql)
+	}
+	result := make([]orderByColumn, 0, len(sel.OrderBy))
+	for _, order := range sel.OrderBy {
+		col, ok := order.Expr.(*sqlparser.ColName)
+		if !ok {
+			return nil, fmt.Errorf("ordered merge only supports ORDER BY on columns, not %v", sqlparser.String(order.Expr))
+		}
+		result = append(result, orderByColumn{
+			name:       string(col.Name),
+			descending: order.Direction == sqlparser.AST_DESC,
+		})
+	}
+	return result, nil
+}
+
+// shardPacket is a streaming result of a shard. A nil result marks
+// the end of the stream of the shard.
+type shardPacket struct {
+	shard  string
+	result *mproto.QueryResult
+}
+
+// streamMerger merges the rows of the shard streams on the ORDER BY
+// columns. Each shard returns its rows in order already, so the
+// smallest buffered row can be sent as soon as every shard that is
+// still streaming has at least one row buffered.
+type streamMerger struct {
+	shards    []string
+	orderBy   []orderByColumn
+	sendReply func(*mproto.QueryResult) error
+
+	// fields are the fields of the first shard that sent them,
+	// columns the indexes of the orderBy columns in fields.
+	fields  []mproto.Field
+	columns []int
+
+	rows map[string][][]sqltypes.Value
+	done map[string]bool
+}
+
+func newStreamMerger(shards []string, orderBy []orderByColumn, sendReply func(*mproto.QueryResult) error) *streamMerger {
+	return &streamMerger{
+		shards:    shards,
+		orderBy:   orderBy,
+		sendReply: sendReply,
+		rows:      make(map[string][][]sqltypes.Value),
+		done:      make(map[string]bool),
+	}
+}
+
+// add buffers a packet of a shard, and sends the rows that can be
+// sent in order.
+func (sm *streamMerger) add(packet *shardPacket) error {
+	if packet.result == nil {
+		sm.done[packet.shard] = true
+		return sm.flush(false)
+	}
+	if len(packet.result.Fields) > 0 && sm.fields == nil {
+		if err := sm.setFields(packet.result.Fields); err != nil {
+			return err
+		}
+		if err := sm.sendReply(&mproto.QueryResult{Fields: sm.fields}); err != nil {
+			return err
+		}
+	}
+	if len(packet.result.Rows) == 0 {
+		return nil
+	}
+	sm.rows[packet.shard] = append(sm.rows[packet.shard], packet.result.Rows...)
+	return sm.flush(false)
+}
+
+func (sm *streamMerger) setFields(fields []mproto.Field) error {
+	columns := make([]int, len(sm.orderBy))
+	for i, col := range sm.orderBy {
+		columns[i] = -1
+		for j, field := range fields {
+			if field.Name == col.name {
+				columns[i] = j
+				break
+			}
+		}
+		if columns[i] == -1 {
+			return fmt.Errorf("ORDER BY column %v is not in the results", col.name)
+		}
+		if err := checkComparable(fields[columns[i]]); err != nil {
+			return fmt.Errorf("cannot merge on ORDER BY column %v: %v", col.name, err)
+		}
+	}
+	sm.fields = fields
+	sm.columns = columns
+	return nil
+}
+
+// flush sends the buffered rows that are known to be next in order.
+// If all is set, the shards are finished, and all the buffered rows
+// are sent.
+func (sm *streamMerger) flush(all bool) error {
+	var rows [][]sqltypes.Value
+	for {
+		best := ""
+		for _, shard := range sm.shards {
+			queue := sm.rows[shard]
+			if len(queue) == 0 {
+				if !all && !sm.done[shard] {
+					// this shard may still send a smaller row
+					best = ""
+					break
+				}
+				continue
+			}
+			if best == "" {
+				best = shard
+				continue
+			}
+			less, err := sm.less(queue[0], sm.rows[best][0])
+			if err != nil {
+				return err
+			}
+			if less {
+				best = shard
+			}
+		}
+		if best == "" {
+			break
+		}
+		rows = append(rows, sm.rows[best][0])
+		sm.rows[best] = sm.rows[best][1:]
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+	return sm.sendReply(&mproto.QueryResult{Rows: rows})
+}
+
+// less returns true if row a sorts strictly before row b.
+func (sm *streamMerger) less(a, b []sqltypes.Value) (bool, error) {
+	for i, col := range sm.orderBy {
+		index := sm.columns[i]
+		c, err := compareValues(sm.fields[index], a[index], b[index])
+		if err != nil {
+			return false, err
+		}
+		if c == 0 {
+			continue
+		}
+		if col.descending {
+			return c > 0, nil
+		}
+		return c < 0, nil
+	}
+	return false, nil
+}
+
+// checkComparable returns an error if compareValues can't compare the
+// values of field the way MySQL sorts them. The text columns sort with
+// their collation, which is not in the fields, so only the binary ones
+// (binary strings and _bin collations) are supported. ENUM and SET
+// columns sort by the index of their values.
+func checkComparable(field mproto.Field) error {
+	if field.Type == mproto.VT_ENUM || field.Type == mproto.VT_SET || field.Flags&(mproto.VT_ENUM_FLAG|mproto.VT_SET_FLAG) != 0 {
+		return fmt.Errorf("column %v is an ENUM or a SET", field.Name)
+	}
+	switch field.Type {
+	case mproto.VT_VARCHAR, mproto.VT_VAR_STRING, mproto.VT_STRING, mproto.VT_TINY_BLOB, mproto.VT_MEDIUM_BLOB, mproto.VT_LONG_BLOB, mproto.VT_BLOB:
+		if field.Flags&mproto.VT_BINARY_FLAG == 0 {
+			return fmt.Errorf("column %v is a text column with a collation vtgate doesn't know, only binary strings and collations are supported", field.Name)
+		}
+	}
+	return nil
+}
+
+// compareValues compares two values of a field, the way MySQL sorts
+// them: NULL first, numbers by value. Other values are compared
+// byte-wise, which matches the order of binary collations only.
+func compareValues(field mproto.Field, a, b sqltypes.Value) (int, error) {
+	switch {
+	case a.IsNull() && b.IsNull():
+		return 0, nil
+	case a.IsNull():
+		return -1, nil
+	case b.IsNull():
+		return 1, nil
+	}
+
+	switch field.Type {
+	case mproto.VT_TINY, mproto.VT_SHORT, mproto.VT_LONG, mproto.VT_LONGLONG, mproto.VT_INT24, mproto.VT_YEAR:
+		if field.Flags&mproto.VT_UNSIGNED_FLAG != 0 {
+			av, err := strconv.ParseUint(a.String(), 10, 64)
+			if err != nil {
+				return 0, err
+			}
+			bv, err := strconv.ParseUint(b.String(), 10, 64)
+			if err != nil {
+				return 0, err
+			}
+			return compareUint64(av, bv), nil
+		}
+		av, err := strconv.ParseInt(a.String(), 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		bv, err := strconv.ParseInt(b.String(), 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		return compareInt64(av, bv), nil
+	case mproto.VT_FLOAT, mproto.VT_DOUBLE, mproto.VT_DECIMAL, mproto.VT_NEWDECIMAL:
+		av, err := strconv.ParseFloat(a.String(), 64)
+		if err != nil {
+			return 0, err
+		}
+		bv, err := strconv.ParseFloat(b.String(), 64)
+		if err != nil {
+			return 0, err
+		}
+		switch {
+		case av < bv:
+			return -1, nil
+		case av > bv:
+			return 1, nil
+		}
+		return 0, nil
+	}
+	return bytes.Compare(a.Raw(), b.Raw()), nil
+}
+
+func compareInt64(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func compareUint64(a, b uint64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
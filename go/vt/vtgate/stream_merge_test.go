@@ -0,0 +1,143 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vtgate
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	mproto "github.com/youtube/vitess/go/mysql/proto"
+	"github.com/youtube/vitess/go/sqltypes"
+)
+
+func TestGetOrderBy(t *testing.T) {
+	got, err := getOrderBy("select id, name from t order by name desc, id")
+	if err != nil {
+		t.Fatalf("getOrderBy failed: %v", err)
+	}
+	want := []orderByColumn{{name: "name", descending: true}, {name: "id"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("getOrderBy: got %v, want %v", got, want)
+	}
+
+	for _, tcase := range []struct {
+		sql  string
+		want string
+	}{
+		{"select id from t", "needs an ORDER BY clause"},
+		{"update t set id = 1", "needs a select query"},
+		{"select id from t order by id + 1", "only supports ORDER BY on columns"},
+	} {
+		if _, err := getOrderBy(tcase.sql); err == nil || !strings.Contains(err.Error(), tcase.want) {
+			t.Errorf("getOrderBy(%v): %v, want %v", tcase.sql, err, tcase.want)
+		}
+	}
+}
+
+func TestCompareValues(t *testing.T) {
+	long := mproto.Field{Name: "l", Type: mproto.VT_LONGLONG}
+	unsigned := mproto.Field{Name: "u", Type: mproto.VT_LONGLONG, Flags: mproto.VT_UNSIGNED_FLAG}
+	double := mproto.Field{Name: "d", Type: mproto.VT_DOUBLE}
+	str := mproto.Field{Name: "s", Type: mproto.VT_VAR_STRING}
+	null := sqltypes.Value{}
+	for _, tcase := range []struct {
+		field mproto.Field
+		a, b  sqltypes.Value
+		want  int
+	}{
+		{long, sqltypes.MakeString([]byte("9")), sqltypes.MakeString([]byte("10")), -1},
+		{long, sqltypes.MakeString([]byte("-1")), sqltypes.MakeString([]byte("-1")), 0},
+		{unsigned, sqltypes.MakeString([]byte("18446744073709551615")), sqltypes.MakeString([]byte("1")), 1},
+		{double, sqltypes.MakeString([]byte("2.5")), sqltypes.MakeString([]byte("10.1")), -1},
+		{str, sqltypes.MakeString([]byte("b")), sqltypes.MakeString([]byte("a")), 1},
+		{str, null, sqltypes.MakeString([]byte("a")), -1},
+		{long, sqltypes.MakeString([]byte("1")), null, 1},
+		{long, null, null, 0},
+	} {
+		got, err := compareValues(tcase.field, tcase.a, tcase.b)
+		if err != nil {
+			t.Errorf("compareValues(%v, %v, %v) failed: %v", tcase.field, tcase.a, tcase.b, err)
+			continue
+		}
+		if got != tcase.want {
+			t.Errorf("compareValues(%v, %v, %v) = %v, want %v", tcase.field, tcase.a, tcase.b, got, tcase.want)
+		}
+	}
+	if _, err := compareValues(long, sqltypes.MakeString([]byte("x")), sqltypes.MakeString([]byte("1"))); err == nil {
+		t.Errorf("compareValues of a bad number should fail")
+	}
+}
+
+func TestStreamMerger(t *testing.T) {
+	fields := []mproto.Field{{Name: "id", Type: mproto.VT_LONG}}
+	row := func(id string) []sqltypes.Value {
+		return []sqltypes.Value{sqltypes.MakeNumeric([]byte(id))}
+	}
+	var sent []*mproto.QueryResult
+	sm := newStreamMerger([]string{"-80", "80-"}, []orderByColumn{{name: "id"}}, func(qr *mproto.QueryResult) error {
+		sent = append(sent, qr)
+		return nil
+	})
+	for _, packet := range []*shardPacket{
+		{"-80", &mproto.QueryResult{Fields: fields}},
+		{"-80", &mproto.QueryResult{Rows: [][]sqltypes.Value{row("1"), row("4")}}},
+		{"80-", &mproto.QueryResult{Fields: fields}},
+		{"80-", &mproto.QueryResult{Rows: [][]sqltypes.Value{row("2")}}},
+		{"80-", &mproto.QueryResult{Rows: [][]sqltypes.Value{row("3"), row("5")}}},
+		{"-80", nil},
+		{"80-", nil},
+	} {
+		if err := sm.add(packet); err != nil {
+			t.Fatalf("add(%v) failed: %v", packet, err)
+		}
+	}
+	want := []*mproto.QueryResult{
+		{Fields: fields},
+		{Rows: [][]sqltypes.Value{row("1"), row("2")}},
+		{Rows: [][]sqltypes.Value{row("3"), row("4")}},
+		{Rows: [][]sqltypes.Value{row("5")}},
+	}
+	if !reflect.DeepEqual(sent, want) {
+		t.Errorf("sent: got %v, want %v", sent, want)
+	}
+
+	sm = newStreamMerger([]string{"0"}, []orderByColumn{{name: "name"}}, func(qr *mproto.QueryResult) error {
+		return nil
+	})
+	if err := sm.add(&shardPacket{"0", &mproto.QueryResult{Fields: fields}}); err == nil || !strings.Contains(err.Error(), "ORDER BY column name is not in the results") {
+		t.Errorf("add with a missing ORDER BY column: %v", err)
+	}
+
+	// the text columns have to be binary
+	sm = newStreamMerger([]string{"0"}, []orderByColumn{{name: "name"}}, func(qr *mproto.QueryResult) error {
+		return nil
+	})
+	textFields := []mproto.Field{{Name: "name", Type: mproto.VT_VAR_STRING}}
+	if err := sm.add(&shardPacket{"0", &mproto.QueryResult{Fields: textFields}}); err == nil || !strings.Contains(err.Error(), "cannot merge on ORDER BY column name: column name is a text column") {
+		t.Errorf("add with a text ORDER BY column: %v", err)
+	}
+}
+
+func TestCheckComparable(t *testing.T) {
+	for _, tcase := range []struct {
+		field mproto.Field
+		ok    bool
+	}{
+		{mproto.Field{Name: "i", Type: mproto.VT_LONGLONG}, true},
+		{mproto.Field{Name: "d", Type: mproto.VT_DATETIME}, true},
+		{mproto.Field{Name: "b", Type: mproto.VT_VAR_STRING, Flags: mproto.VT_BINARY_FLAG}, true},
+		{mproto.Field{Name: "blob", Type: mproto.VT_BLOB, Flags: mproto.VT_BLOB_FLAG | mproto.VT_BINARY_FLAG}, true},
+		// utf8_general_ci and the like
+		{mproto.Field{Name: "s", Type: mproto.VT_VAR_STRING}, false},
+		{mproto.Field{Name: "text", Type: mproto.VT_BLOB, Flags: mproto.VT_BLOB_FLAG}, false},
+		{mproto.Field{Name: "e", Type: mproto.VT_STRING, Flags: mproto.VT_ENUM_FLAG | mproto.VT_BINARY_FLAG}, false},
+		{mproto.Field{Name: "set", Type: mproto.VT_SET}, false},
+	} {
+		if err := checkComparable(tcase.field); (err == nil) != tcase.ok {
+			t.Errorf("checkComparable(%v): %v, want ok %v", tcase.field, err, tcase.ok)
+		}
+	}
+}
@@ -0,0 +1,229 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vtgate
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/youtube/vitess/go/sync2"
+	"github.com/youtube/vitess/go/timer"
+	"github.com/youtube/vitess/go/vt/tabletserver/tabletconn"
+	"github.com/youtube/vitess/go/vt/topo"
+	"golang.org/x/net/context"
+)
+
+// This file contains the pool of connections a ShardConn has to its
+// current vttablet end point.
+
+var (
+	tabletPoolSize        = flag.Int("tablet_pool_size", 0, "if set, maximum number of connections from vtgate to each vttablet end point of a shard and tablet type. A connection serves one call at a time, and calls wait for a free connection until their deadline. If 0, all the calls share a single connection")
+	tabletPoolIdleTimeout = flag.Duration("tablet_pool_idle_timeout", time.Minute, "with -tablet_pool_size, how long a connection can stay unused before it is closed")
+
+	errPoolClosed = errors.New("tablet connection pool is closed")
+)
+
+// tabletPoolStats are the wait stats of the pools of a ShardConn.
+// They survive the pools, which are replaced when the end point
+// changes.
+type tabletPoolStats struct {
+	waitCount sync2.AtomicInt64
+	waitTime  sync2.AtomicDuration
+}
+
+// pooledConn is a connection of a tabletConnPool. recycle must be
+// called once the call that got it is done.
+type pooledConn struct {
+	tabletconn.TabletConn
+	pool *tabletConnPool
+}
+
+func (pc *pooledConn) recycle() {
+	pc.pool.put(pc)
+}
+
+type idleConn struct {
+	conn  *pooledConn
+	since time.Time
+}
+
+// tabletConnPool is a pool of connections to one end point. With a
+// capacity of 0, it has a single connection shared by all calls.
+type tabletConnPool struct {
+	endPoint    topo.EndPoint
+	dial        func(ctx context.Context) (tabletconn.TabletConn, error)
+	capacity    int
+	idleTimeout time.Duration
+	stats       *tabletPoolStats
+	timer       *timer.Timer
+	// shared is the only connection of a pool with a capacity of 0.
+	shared *pooledConn
+
+	// mu protects the fields below. idle has the unused connections,
+	// the most recently used last. released is closed, and replaced,
+	// every time a connection is put back or the pool is closed.
+	mu       sync.Mutex
+	idle     []idleConn
+	inUse    int
+	closed   bool
+	released chan struct{}
+}
+
+// newTabletConnPool creates a pool for the end point of conn, which
+// becomes its first connection. dial connects to the same end point.
+func newTabletConnPool(conn tabletconn.TabletConn, dial func(ctx context.Context) (tabletconn.TabletConn, error), capacity int, idleTimeout time.Duration, stats *tabletPoolStats) *tabletConnPool {
+	pool := &tabletConnPool{
+		endPoint:    conn.EndPoint(),
+		dial:        dial,
+		capacity:    capacity,
+		idleTimeout: idleTimeout,
+		stats:       stats,
+		released:    make(chan struct{}),
+	}
+	pc := &pooledConn{TabletConn: conn, pool: pool}
+	if capacity == 0 {
+		pool.shared = pc
+		return pool
+	}
+	pool.idle = []idleConn{{conn: pc, since: time.Now()}}
+	if idleTimeout > 0 {
+		pool.timer = timer.NewTimer(idleTimeout / 10)
+		pool.timer.Start(pool.closeIdle)
+	}
+	return pool
+}
+
+// get returns a connection of the pool. If all of them are in use,
+// it waits for one until the deadline of ctx.
+func (pool *tabletConnPool) get(ctx context.Context) (*pooledConn, error) {
+	var waitStart time.Time
+	defer func() {
+		if !waitStart.IsZero() {
+			pool.stats.waitCount.Add(1)
+			pool.stats.waitTime.Add(time.Now().Sub(waitStart))
+		}
+	}()
+	for {
+		pool.mu.Lock()
+		if pool.closed {
+			pool.mu.Unlock()
+			return nil, errPoolClosed
+		}
+		if pool.shared != nil {
+			pool.mu.Unlock()
+			return pool.shared, nil
+		}
+		if n := len(pool.idle); n > 0 {
+			pc := pool.idle[n-1].conn
+			pool.idle = pool.idle[:n-1]
+			pool.inUse++
+			pool.mu.Unlock()
+			return pc, nil
+		}
+		if pool.inUse < pool.capacity {
+			pool.inUse++
+			pool.mu.Unlock()
+			conn, err := pool.dial(ctx)
+			if err != nil {
+				pool.put(nil)
+				return nil, err
+			}
+			return &pooledConn{TabletConn: conn, pool: pool}, nil
+		}
+		released := pool.released
+		pool.mu.Unlock()
+
+		if waitStart.IsZero() {
+			waitStart = time.Now()
+		}
+		select {
+		case <-released:
+		case <-ctx.Done():
+			return nil, fmt.Errorf("no free connection to %+v in the tablet connection pool: %v", pool.endPoint, ctx.Err())
+		}
+	}
+}
+
+// put gives back a connection returned by get. A nil pc means the
+// connection could not be created. The connections of a closed pool
+// are closed.
+func (pool *tabletConnPool) put(pc *pooledConn) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	if pool.shared != nil {
+		return
+	}
+	pool.inUse--
+	if pc != nil {
+		if pool.closed {
+			closeTabletConn(pc.TabletConn)
+		} else {
+			pool.idle = append(pool.idle, idleConn{conn: pc, since: time.Now()})
+		}
+	}
+	close(pool.released)
+	pool.released = make(chan struct{})
+}
+
+// closeIdle closes the connections unused for longer than the idle
+// timeout.
+func (pool *tabletConnPool) closeIdle() {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	now := time.Now()
+	n := 0
+	for n < len(pool.idle) && now.Sub(pool.idle[n].since) >= pool.idleTimeout {
+		closeTabletConn(pool.idle[n].conn.TabletConn)
+		n++
+	}
+	pool.idle = pool.idle[n:]
+}
+
+// close closes the unused connections right away, and the others
+// when they are put back.
+func (pool *tabletConnPool) close() {
+	if pool.timer != nil {
+		pool.timer.Stop()
+	}
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	if pool.closed {
+		return
+	}
+	pool.closed = true
+	if pool.shared != nil {
+		closeTabletConn(pool.shared.TabletConn)
+	}
+	for _, ic := range pool.idle {
+		closeTabletConn(ic.conn.TabletConn)
+	}
+	pool.idle = nil
+	close(pool.released)
+	pool.released = make(chan struct{})
+}
+
+// capacityAndInUse returns the capacity of the pool, and the number
+// of its connections in use. Both are 0 for a shared connection.
+func (pool *tabletConnPool) capacityAndInUse() (int, int) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	if pool.shared != nil {
+		return 0, 0
+	}
+	return pool.capacity, pool.inUse
+}
+
+// closeTabletConn closes conn in the background, so a slow close
+// does not block the caller.
+func closeTabletConn(conn tabletconn.TabletConn) {
+	go func() {
+		danglingTabletConn.Add(1)
+		conn.Close()
+		danglingTabletConn.Add(-1)
+	}()
+}
@@ -0,0 +1,177 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vtgate
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/youtube/vitess/go/sync2"
+	"github.com/youtube/vitess/go/vt/tabletserver/tabletconn"
+	"golang.org/x/net/context"
+)
+
+// newTestTabletConnPool returns a pool of sandboxConns, and the
+// number of connections it dialed.
+func newTestTabletConnPool(capacity int, idleTimeout time.Duration) (*tabletConnPool, *sync2.AtomicInt64) {
+	dials := new(sync2.AtomicInt64)
+	dial := func(ctx context.Context) (tabletconn.TabletConn, error) {
+		dials.Add(1)
+		return &sandboxConn{}, nil
+	}
+	return newTabletConnPool(&sandboxConn{}, dial, capacity, idleTimeout, &tabletPoolStats{}), dials
+}
+
+func waitForClosed(t *testing.T, conn tabletconn.TabletConn) {
+	sbc := conn.(*sandboxConn)
+	for i := 0; i < 100; i++ {
+		if sbc.CloseCount.Get() == 1 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("CloseCount: %v, want 1", sbc.CloseCount.Get())
+}
+
+func TestTabletConnPoolShared(t *testing.T) {
+	pool, dials := newTestTabletConnPool(0, time.Minute)
+	pc1, err := pool.get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	pc2, err := pool.get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pc1 != pc2 {
+		t.Errorf("shared pool returned two connections")
+	}
+	if dials.Get() != 0 {
+		t.Errorf("dials: %v, want 0", dials.Get())
+	}
+	if capacity, inUse := pool.capacityAndInUse(); capacity != 0 || inUse != 0 {
+		t.Errorf("capacityAndInUse: %v, %v, want 0, 0", capacity, inUse)
+	}
+	pc1.recycle()
+	pc2.recycle()
+	pool.close()
+	waitForClosed(t, pc1.TabletConn)
+	if _, err := pool.get(context.Background()); err != errPoolClosed {
+		t.Errorf("get after close: %v, want %v", err, errPoolClosed)
+	}
+}
+
+func TestTabletConnPoolCapacity(t *testing.T) {
+	pool, dials := newTestTabletConnPool(2, time.Minute)
+	defer pool.close()
+	pc1, err := pool.get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	pc2, err := pool.get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pc1 == pc2 {
+		t.Errorf("pool returned the same connection twice")
+	}
+	if dials.Get() != 1 {
+		t.Errorf("dials: %v, want 1", dials.Get())
+	}
+	if capacity, inUse := pool.capacityAndInUse(); capacity != 2 || inUse != 2 {
+		t.Errorf("capacityAndInUse: %v, %v, want 2, 2", capacity, inUse)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	_, err = pool.get(ctx)
+	cancel()
+	want := "no free connection to"
+	if err == nil || !strings.Contains(err.Error(), want) {
+		t.Errorf("get on a full pool: %v, want %v", err, want)
+	}
+	if pool.stats.waitCount.Get() != 1 {
+		t.Errorf("waitCount: %v, want 1", pool.stats.waitCount.Get())
+	}
+	if pool.stats.waitTime.Get() < 10*time.Millisecond {
+		t.Errorf("waitTime: %v, want >= 10ms", pool.stats.waitTime.Get())
+	}
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		pc2.recycle()
+	}()
+	pc3, err := pool.get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pc3 != pc2 {
+		t.Errorf("pool did not return the released connection")
+	}
+	if pool.stats.waitCount.Get() != 2 {
+		t.Errorf("waitCount: %v, want 2", pool.stats.waitCount.Get())
+	}
+	pc1.recycle()
+	pc3.recycle()
+	if _, inUse := pool.capacityAndInUse(); inUse != 0 {
+		t.Errorf("inUse: %v, want 0", inUse)
+	}
+}
+
+func TestTabletConnPoolIdleTimeout(t *testing.T) {
+	pool, dials := newTestTabletConnPool(2, 20*time.Millisecond)
+	defer pool.close()
+	pc1, err := pool.get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	pc2, err := pool.get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	pc1.recycle()
+	pc2.recycle()
+	waitForClosed(t, pc1.TabletConn)
+	waitForClosed(t, pc2.TabletConn)
+
+	if _, err := pool.get(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if dials.Get() != 2 {
+		t.Errorf("dials: %v, want 2", dials.Get())
+	}
+}
+
+func TestTabletConnPoolClose(t *testing.T) {
+	pool, _ := newTestTabletConnPool(2, time.Minute)
+	pc1, err := pool.get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	pc2, err := pool.get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error)
+	go func() {
+		_, err := pool.get(context.Background())
+		done <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	pool.close()
+	if err := <-done; err != errPoolClosed {
+		t.Errorf("waiting get: %v, want %v", err, errPoolClosed)
+	}
+
+	// The connections in use are closed once they are put back.
+	if count := pc1.TabletConn.(*sandboxConn).CloseCount.Get(); count != 0 {
+		t.Errorf("CloseCount: %v, want 0", count)
+	}
+	pc1.recycle()
+	pc2.recycle()
+	waitForClosed(t, pc1.TabletConn)
+	waitForClosed(t, pc2.TabletConn)
+}
@@ -0,0 +1,141 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vtgate
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/youtube/vitess/go/acl"
+	"github.com/youtube/vitess/go/ratelimiter"
+	"github.com/youtube/vitess/go/stats"
+	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/vt/vterrors"
+	"github.com/youtube/vitess/go/vt/vtgate/proto"
+)
+
+var queryLimits = flag.String("query_limits", "", "comma separated list of keyspace:tablet_type=qps limits, e.g. user:rdonly=100. The queries over the limit fail with a 'throttled:' error. The limits can be changed at runtime on /debug/query_limits")
+
+// queryThrottler limits the rate of the queries sent to each
+// keyspace and tablet type. Statements that are part of a
+// transaction are never throttled, so open transactions can finish.
+type queryThrottler struct {
+	// mu protects limits and limiters. A limit of 0 has a nil
+	// limiter, and rejects all queries.
+	mu       sync.Mutex
+	limits   map[string]int
+	limiters map[string]*ratelimiter.RateLimiter
+
+	throttled *stats.MultiCounters
+}
+
+func newQueryThrottler(throttledStatsName string) *queryThrottler {
+	return &queryThrottler{
+		limits:    make(map[string]int),
+		limiters:  make(map[string]*ratelimiter.RateLimiter),
+		throttled: stats.NewMultiCounters(throttledStatsName, []string{"Keyspace", "DbType"}),
+	}
+}
+
+func throttlerKey(keyspace string, tabletType topo.TabletType) string {
+	return keyspace + ":" + string(tabletType)
+}
+
+// parseQueryLimits parses a list of keyspace:tablet_type=qps limits.
+func parseQueryLimits(value string) (map[string]int, error) {
+	limits := make(map[string]int)
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.Split(entry, "=")
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid query limit %q, expected keyspace:tablet_type=qps", entry)
+		}
+		keyParts := strings.Split(parts[0], ":")
+		if len(keyParts) != 2 || keyParts[0] == "" || keyParts[1] == "" {
+			return nil, fmt.Errorf("invalid query limit %q, expected keyspace:tablet_type=qps", entry)
+		}
+		qps, err := strconv.Atoi(parts[1])
+		if err != nil || qps < 0 {
+			return nil, fmt.Errorf("invalid qps in query limit %q", entry)
+		}
+		limits[throttlerKey(keyParts[0], topo.TabletType(keyParts[1]))] = qps
+	}
+	return limits, nil
+}
+
+// setLimits replaces all the limits.
+func (qt *queryThrottler) setLimits(limits map[string]int) {
+	limiters := make(map[string]*ratelimiter.RateLimiter, len(limits))
+	for key, qps := range limits {
+		if qps > 0 {
+			limiters[key] = ratelimiter.NewRateLimiter(qps, time.Second)
+		} else {
+			limiters[key] = nil
+		}
+	}
+	qt.mu.Lock()
+	defer qt.mu.Unlock()
+	qt.limits = limits
+	qt.limiters = limiters
+}
+
+// String returns the limits in the format of -query_limits.
+func (qt *queryThrottler) String() string {
+	qt.mu.Lock()
+	defer qt.mu.Unlock()
+	entries := make([]string, 0, len(qt.limits))
+	for key, qps := range qt.limits {
+		entries = append(entries, fmt.Sprintf("%v=%v", key, qps))
+	}
+	sort.Strings(entries)
+	return strings.Join(entries, ",")
+}
+
+// throttle returns an error with the ResourceExhausted code if a query
+// to keyspace and tabletType is over its limit.
+func (qt *queryThrottler) throttle(keyspace string, tabletType topo.TabletType, session *proto.Session) error {
+	if session != nil && session.InTransaction {
+		return nil
+	}
+	qt.mu.Lock()
+	limiter, ok := qt.limiters[throttlerKey(keyspace, tabletType)]
+	qt.mu.Unlock()
+	if !ok || (limiter != nil && limiter.Allow()) {
+		return nil
+	}
+	qt.throttled.Add([]string{keyspace, string(tabletType)}, 1)
+	return vterrors.Errorf(vterrors.ResourceExhausted, "throttled: too many queries for keyspace %v, tablet type %v", keyspace, tabletType)
+}
+
+// ServeHTTP shows the limits, and replaces them with the value of
+// the 'limits' parameter of a POST.
+func (qt *queryThrottler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "POST" {
+		if err := acl.CheckAccessHTTP(r, acl.ADMIN); err != nil {
+			acl.SendError(w, err)
+			return
+		}
+		limits, err := parseQueryLimits(r.FormValue("limits"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		qt.setLimits(limits)
+	} else if err := acl.CheckAccessHTTP(r, acl.DEBUGGING); err != nil {
+		acl.SendError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	fmt.Fprintf(w, "%v\n", qt)
+}
@@ -0,0 +1,94 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vtgate
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/vt/vtgate/proto"
+)
+
+func TestParseQueryLimits(t *testing.T) {
+	got, err := parseQueryLimits(" user:rdonly=100, user:replica=0,")
+	if err != nil {
+		t.Fatalf("parseQueryLimits failed: %v", err)
+	}
+	want := map[string]int{"user:rdonly": 100, "user:replica": 0}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseQueryLimits: got %v, want %v", got, want)
+	}
+
+	for _, value := range []string{"user:rdonly", "user=10", ":rdonly=10", "user:rdonly=x", "user:rdonly=-1"} {
+		if _, err := parseQueryLimits(value); err == nil {
+			t.Errorf("parseQueryLimits(%v) should have failed", value)
+		}
+	}
+}
+
+func TestQueryThrottler(t *testing.T) {
+	qt := newQueryThrottler("")
+	qt.setLimits(map[string]int{"user:rdonly": 2, "user:replica": 0})
+
+	for i := 0; i < 2; i++ {
+		if err := qt.throttle("user", topo.TYPE_RDONLY, nil); err != nil {
+			t.Errorf("query %v should not be throttled: %v", i, err)
+		}
+	}
+	if err := qt.throttle("user", topo.TYPE_RDONLY, nil); err == nil || !strings.HasPrefix(err.Error(), "throttled: ") {
+		t.Errorf("want throttled error, got %v", err)
+	}
+	if err := qt.throttle("user", topo.TYPE_RDONLY, &proto.Session{InTransaction: true}); err != nil {
+		t.Errorf("queries in a transaction should not be throttled: %v", err)
+	}
+	if err := qt.throttle("user", topo.TYPE_REPLICA, nil); err == nil {
+		t.Errorf("a limit of 0 should throttle all queries")
+	}
+	if err := qt.throttle("user", topo.TYPE_MASTER, nil); err != nil {
+		t.Errorf("queries without a limit should not be throttled: %v", err)
+	}
+	want := map[string]int64{"user.rdonly": 1, "user.replica": 1}
+	if got := qt.throttled.Counts(); !reflect.DeepEqual(got, want) {
+		t.Errorf("throttled counts: got %v, want %v", got, want)
+	}
+}
+
+func TestQueryThrottlerHTTP(t *testing.T) {
+	qt := newQueryThrottler("")
+	qt.setLimits(map[string]int{"user:rdonly": 2})
+
+	w := httptest.NewRecorder()
+	qt.ServeHTTP(w, &http.Request{Method: "GET", URL: &url.URL{Path: "/debug/query_limits"}})
+	if got, want := w.Body.String(), "user:rdonly=2\n"; got != want {
+		t.Errorf("GET: got %q, want %q", got, want)
+	}
+
+	w = httptest.NewRecorder()
+	r, err := http.NewRequest("POST", "/debug/query_limits", strings.NewReader(url.Values{"limits": {"user:rdonly=5,lookup:replica=10"}}.Encode()))
+	if err != nil {
+		t.Fatalf("NewRequest failed: %v", err)
+	}
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	qt.ServeHTTP(w, r)
+	if got, want := w.Body.String(), "lookup:replica=10,user:rdonly=5\n"; got != want {
+		t.Errorf("POST: got %q, want %q", got, want)
+	}
+
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest("POST", "/debug/query_limits", strings.NewReader("limits=bad"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	qt.ServeHTTP(w, r)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("POST with bad limits: got code %v, want %v", w.Code, http.StatusBadRequest)
+	}
+	if got, want := qt.String(), "lookup:replica=10,user:rdonly=5"; got != want {
+		t.Errorf("limits changed after a bad POST: got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,169 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vtgate
+
+import (
+	"flag"
+	"fmt"
+	"sync"
+	"time"
+
+	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/timer"
+	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/vt/vtgate/proto"
+	"golang.org/x/net/context"
+)
+
+// This file contains the rollback of the transactions that stay open
+// for too long.
+
+var transactionTimeout = flag.Duration("transaction_timeout", 0, "if set, the shard transactions open for longer are rolled back by vtgate. The next statement or commit of the transaction fails")
+
+// txKey identifies a shard transaction.
+type txKey struct {
+	keyspace      string
+	shard         string
+	tabletType    topo.TabletType
+	transactionID int64
+}
+
+func newTxKey(shardSession *proto.ShardSession) txKey {
+	return txKey{
+		keyspace:      shardSession.Keyspace,
+		shard:         shardSession.Shard,
+		tabletType:    shardSession.TabletType,
+		transactionID: shardSession.TransactionId,
+	}
+}
+
+// txJanitor rolls back the shard transactions that are open for
+// longer than timeout. The transactions it rolled back are remembered
+// for a while, so their next use gets a clear error instead of a
+// not_in_tx error from the tablet.
+type txJanitor struct {
+	timeout  time.Duration
+	rollback func(ctx context.Context, shardSession *proto.ShardSession) error
+	timer    *timer.Timer
+
+	// mu protects open and expired. open has the begin time of the
+	// shard transactions, expired the time they were rolled back.
+	mu      sync.Mutex
+	open    map[txKey]time.Time
+	expired map[txKey]time.Time
+}
+
+// newTxJanitor creates a txJanitor that uses rollback to end the
+// old transactions. It does nothing if timeout is 0.
+func newTxJanitor(timeout time.Duration, rollback func(ctx context.Context, shardSession *proto.ShardSession) error) *txJanitor {
+	tj := &txJanitor{
+		timeout:  timeout,
+		rollback: rollback,
+		open:     make(map[txKey]time.Time),
+		expired:  make(map[txKey]time.Time),
+	}
+	if timeout > 0 {
+		tj.timer = timer.NewTimer(timeout / 10)
+		tj.timer.Start(tj.expire)
+	}
+	return tj
+}
+
+// add starts tracking a shard transaction that was just begun.
+func (tj *txJanitor) add(shardSession *proto.ShardSession) {
+	if tj.timeout == 0 {
+		return
+	}
+	tj.mu.Lock()
+	defer tj.mu.Unlock()
+	tj.open[newTxKey(shardSession)] = time.Now()
+}
+
+// check returns an error if the janitor rolled back the shard
+// transaction.
+func (tj *txJanitor) check(shardSession *proto.ShardSession) error {
+	if tj.timeout == 0 {
+		return nil
+	}
+	tj.mu.Lock()
+	defer tj.mu.Unlock()
+	if _, ok := tj.expired[newTxKey(shardSession)]; ok {
+		return tj.expiredError(shardSession)
+	}
+	return nil
+}
+
+// forget stops tracking the shard transactions of a session that
+// ends. It returns the ones that are still open, and an error if
+// some of them were rolled back by the janitor.
+func (tj *txJanitor) forget(shardSessions []*proto.ShardSession) ([]*proto.ShardSession, error) {
+	if tj.timeout == 0 {
+		return shardSessions, nil
+	}
+	tj.mu.Lock()
+	defer tj.mu.Unlock()
+	var live []*proto.ShardSession
+	var err error
+	for _, shardSession := range shardSessions {
+		key := newTxKey(shardSession)
+		delete(tj.open, key)
+		if _, ok := tj.expired[key]; ok {
+			delete(tj.expired, key)
+			if err == nil {
+				err = tj.expiredError(shardSession)
+			}
+			continue
+		}
+		live = append(live, shardSession)
+	}
+	return live, err
+}
+
+func (tj *txJanitor) expiredError(shardSession *proto.ShardSession) error {
+	return fmt.Errorf("transaction %v on %v was rolled back: it was open for longer than -transaction_timeout %v", shardSession.TransactionId, shardSessionName(shardSession), tj.timeout)
+}
+
+// expire rolls back the transactions open for longer than timeout,
+// and forgets the ones it rolled back long ago.
+func (tj *txJanitor) expire() {
+	now := time.Now()
+	var old []txKey
+	tj.mu.Lock()
+	for key, begin := range tj.open {
+		if now.Sub(begin) >= tj.timeout {
+			old = append(old, key)
+			delete(tj.open, key)
+			tj.expired[key] = now
+		}
+	}
+	for key, rolledBack := range tj.expired {
+		if now.Sub(rolledBack) >= 10*tj.timeout {
+			delete(tj.expired, key)
+		}
+	}
+	tj.mu.Unlock()
+
+	for _, key := range old {
+		deadlineExceeded.Add("Transaction", 1)
+		shardSession := &proto.ShardSession{
+			Keyspace:      key.keyspace,
+			Shard:         key.shard,
+			TabletType:    key.tabletType,
+			TransactionId: key.transactionID,
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), tj.timeout)
+		if err := tj.rollback(ctx, shardSession); err != nil {
+			log.Warningf("rollback of expired transaction %v on %v failed: %v", key.transactionID, shardSessionName(shardSession), err)
+		}
+		cancel()
+	}
+}
+
+// close stops the janitor.
+func (tj *txJanitor) close() {
+	if tj.timer != nil {
+		tj.timer.Stop()
+	}
+}
@@ -7,10 +7,9 @@
 package vtgate
 
 import (
-	"errors"
 	"fmt"
 	"math"
-	"strings"
+	"net/http"
 	"time"
 
 	log "github.com/golang/glog"
@@ -23,6 +22,7 @@ import (
 	"github.com/youtube/vitess/go/vt/servenv"
 	"github.com/youtube/vitess/go/vt/tabletserver/tabletconn"
 	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/vt/vterrors"
 	"github.com/youtube/vitess/go/vt/vtgate/planbuilder"
 	"github.com/youtube/vitess/go/vt/vtgate/proto"
 	// import vindexes implementations
@@ -31,9 +31,6 @@ import (
 	"golang.org/x/net/context"
 )
 
-const errDupKey = "errno 1062"
-const errTxPoolFull = "tx_pool_full"
-
 var (
 	rpcVTGate *VTGate
 
@@ -45,12 +42,17 @@ var (
 	errorsByKeyspace  *stats.Rates
 	errorsByDbType    *stats.Rates
 
-	errTooManyInFlight = errors.New("request_backlog: too many requests in flight")
+	errTooManyInFlight = vterrors.Errorf(vterrors.ResourceExhausted, "request_backlog: too many requests in flight")
 
 	// Error counters should be global so they can be set from anywhere
 	normalErrors   *stats.MultiCounters
 	infoErrors     *stats.Counters
 	internalErrors *stats.Counters
+
+	// deadlineExceeded counts the expired deadlines by layer: Call
+	// for vtgate calls, ShardAttempt for the calls to a tablet, and
+	// Transaction for the transactions rolled back for their age.
+	deadlineExceeded = stats.NewCounters("VtgateDeadlineExceeded")
 )
 
 // VTGate is the rpc interface to vtgate. Only one instance
@@ -63,6 +65,7 @@ type VTGate struct {
 
 	maxInFlight int64
 	inFlight    sync2.AtomicInt64
+	throttler   *queryThrottler
 
 	// the throttled loggers for all errors, one per API entry
 	logExecute                  *logutil.ThrottledLogger
@@ -96,6 +99,7 @@ func Init(serv SrvTopoServer, schema *planbuilder.Schema, cell string, retryDela
 
 		maxInFlight: int64(maxInFlight),
 		inFlight:    0,
+		throttler:   newQueryThrottler("VtgateThrottledQueries"),
 
 		logExecute:                  logutil.NewThrottledLogger("Execute", 5*time.Second),
 		logExecuteShard:             logutil.NewThrottledLogger("ExecuteShard", 5*time.Second),
@@ -109,8 +113,24 @@ func Init(serv SrvTopoServer, schema *planbuilder.Schema, cell string, retryDela
 		logStreamExecuteKeyRanges:   logutil.NewThrottledLogger("StreamExecuteKeyRanges", 5*time.Second),
 		logStreamExecuteShard:       logutil.NewThrottledLogger("StreamExecuteShard", 5*time.Second),
 	}
+	limits, err := parseQueryLimits(*queryLimits)
+	if err != nil {
+		log.Fatalf("Invalid -query_limits: %v", err)
+	}
+	rpcVTGate.throttler.setLimits(limits)
+	http.Handle("/debug/query_limits", rpcVTGate.throttler)
+	http.Handle("/healthz", newHealthChecker(serv, cell, *healthzKeyspaces, *healthzTimeout))
+	servenv.OnTermSync(shutdownBuffers)
+
 	// Resuse resolver's scatterConn.
 	rpcVTGate.router = NewRouter(serv, cell, schema, "VTGateRouter", rpcVTGate.resolver.scatterConn)
+	http.Handle("/debug/query_plans", rpcVTGate.router.planner)
+	http.Handle("/debug/schema", rpcVTGate.router.planner)
+	rpcVTGate.router.rules = newQueryRules(*queryRulesFile, "VtgateQueryRuleMatches")
+	if err := rpcVTGate.router.rules.load(); err != nil {
+		log.Fatalf("Invalid -query_rules_file: %v", err)
+	}
+	http.Handle("/debug/query_rules", rpcVTGate.router.rules)
 	normalErrors = stats.NewMultiCounters("VtgateApiErrorCounts", []string{"Operation", "Keyspace", "DbType"})
 	infoErrors = stats.NewCounters("VtgateInfoErrorCounts")
 	internalErrors = stats.NewCounters("VtgateInternalErrorCounts")
@@ -161,7 +181,7 @@ func (vtg *VTGate) Execute(ctx context.Context, query *proto.Query, reply *proto
 		reply.Result = qr
 		vtg.rowsReturned.Add(statsKey, int64(len(qr.Rows)))
 	} else {
-		reply.Error = handleExecuteError(err, statsKey, query, vtg.logExecute)
+		reply.Error, reply.ErrorCode = handleExecuteError(ctx, err, statsKey, query, vtg.logExecute)
 	}
 	reply.Session = query.Session
 	return nil
@@ -178,8 +198,11 @@ func (vtg *VTGate) ExecuteShard(ctx context.Context, query *proto.QueryShard, re
 	if 0 < vtg.maxInFlight && vtg.maxInFlight < x {
 		return errTooManyInFlight
 	}
+	if err := vtg.throttler.throttle(query.Keyspace, query.TabletType, query.Session); err != nil {
+		return err
+	}
 
-	qr, err := vtg.resolver.Execute(
+	qr, tabletType, err := vtg.resolver.Execute(
 		ctx,
 		query.Sql,
 		query.BindVariables,
@@ -190,12 +213,15 @@ func (vtg *VTGate) ExecuteShard(ctx context.Context, query *proto.QueryShard, re
 			return query.Keyspace, query.Shards, nil
 		},
 		query.NotInTransaction,
+		query.RoutingPolicy,
+		query.AllowMasterFallback,
 	)
+	reply.TabletType = tabletType
 	if err == nil {
 		reply.Result = qr
 		vtg.rowsReturned.Add(statsKey, int64(len(qr.Rows)))
 	} else {
-		reply.Error = handleExecuteError(err, statsKey, query, vtg.logExecuteShard)
+		reply.Error, reply.ErrorCode = handleExecuteError(ctx, err, statsKey, query, vtg.logExecuteShard)
 	}
 	reply.Session = query.Session
 	return nil
@@ -212,13 +238,17 @@ func (vtg *VTGate) ExecuteKeyspaceIds(ctx context.Context, query *proto.Keyspace
 	if 0 < vtg.maxInFlight && vtg.maxInFlight < x {
 		return errTooManyInFlight
 	}
+	if err := vtg.throttler.throttle(query.Keyspace, query.TabletType, query.Session); err != nil {
+		return err
+	}
 
 	qr, err := vtg.resolver.ExecuteKeyspaceIds(ctx, query)
+	reply.TabletType = query.TabletType
 	if err == nil {
 		reply.Result = qr
 		vtg.rowsReturned.Add(statsKey, int64(len(qr.Rows)))
 	} else {
-		reply.Error = handleExecuteError(err, statsKey, query, vtg.logExecuteKeyspaceIds)
+		reply.Error, reply.ErrorCode = handleExecuteError(ctx, err, statsKey, query, vtg.logExecuteKeyspaceIds)
 	}
 	reply.Session = query.Session
 	return nil
@@ -235,13 +265,17 @@ func (vtg *VTGate) ExecuteKeyRanges(ctx context.Context, query *proto.KeyRangeQu
 	if 0 < vtg.maxInFlight && vtg.maxInFlight < x {
 		return errTooManyInFlight
 	}
+	if err := vtg.throttler.throttle(query.Keyspace, query.TabletType, query.Session); err != nil {
+		return err
+	}
 
 	qr, err := vtg.resolver.ExecuteKeyRanges(ctx, query)
+	reply.TabletType = query.TabletType
 	if err == nil {
 		reply.Result = qr
 		vtg.rowsReturned.Add(statsKey, int64(len(qr.Rows)))
 	} else {
-		reply.Error = handleExecuteError(err, statsKey, query, vtg.logExecuteKeyRanges)
+		reply.Error, reply.ErrorCode = handleExecuteError(ctx, err, statsKey, query, vtg.logExecuteKeyRanges)
 	}
 	reply.Session = query.Session
 	return nil
@@ -258,20 +292,36 @@ func (vtg *VTGate) ExecuteEntityIds(ctx context.Context, query *proto.EntityIdsQ
 	if 0 < vtg.maxInFlight && vtg.maxInFlight < x {
 		return errTooManyInFlight
 	}
+	if err := vtg.throttler.throttle(query.Keyspace, query.TabletType, query.Session); err != nil {
+		return err
+	}
 
 	qr, err := vtg.resolver.ExecuteEntityIds(ctx, query)
+	reply.TabletType = query.TabletType
 	if err == nil {
 		reply.Result = qr
 		vtg.rowsReturned.Add(statsKey, int64(len(qr.Rows)))
 	} else {
-		reply.Error = handleExecuteError(err, statsKey, query, vtg.logExecuteEntityIds)
+		reply.Error, reply.ErrorCode = handleExecuteError(ctx, err, statsKey, query, vtg.logExecuteEntityIds)
 	}
 	reply.Session = query.Session
 	return nil
 }
 
 // ExecuteBatchShard executes a group of queries on the specified shards.
+// If batchQuery.ShardQueries is set, each query runs on its own shards
+// instead.
 func (vtg *VTGate) ExecuteBatchShard(ctx context.Context, batchQuery *proto.BatchQueryShard, reply *proto.QueryResultList) error {
+	if len(batchQuery.ShardQueries) > 0 {
+		keyspaces := make([]string, len(batchQuery.ShardQueries))
+		for i, query := range batchQuery.ShardQueries {
+			keyspaces[i] = query.Keyspace
+		}
+		return vtg.executeBatchQueries(ctx, "ExecuteBatchShard", batchQuery, keyspaces, batchQuery.TabletType, batchQuery.Session, reply, vtg.logExecuteBatchShard, func() ([]mproto.QueryResult, []error) {
+			return vtg.resolver.ExecuteBatchShards(ctx, batchQuery.ShardQueries, batchQuery.TabletType, batchQuery.Session, batchQuery.NotInTransaction)
+		})
+	}
+
 	startTime := time.Now()
 	statsKey := []string{"ExecuteBatchShard", batchQuery.Keyspace, string(batchQuery.TabletType)}
 	defer vtg.timings.Record(statsKey, startTime)
@@ -281,6 +331,9 @@ func (vtg *VTGate) ExecuteBatchShard(ctx context.Context, batchQuery *proto.Batc
 	if 0 < vtg.maxInFlight && vtg.maxInFlight < x {
 		return errTooManyInFlight
 	}
+	if err := vtg.throttler.throttle(batchQuery.Keyspace, batchQuery.TabletType, batchQuery.Session); err != nil {
+		return err
+	}
 
 	qrs, err := vtg.resolver.ExecuteBatch(
 		ctx,
@@ -301,14 +354,26 @@ func (vtg *VTGate) ExecuteBatchShard(ctx context.Context, batchQuery *proto.Batc
 		}
 		vtg.rowsReturned.Add(statsKey, rowCount)
 	} else {
-		reply.Error = handleExecuteError(err, statsKey, batchQuery, vtg.logExecuteBatchShard)
+		reply.Error, reply.ErrorCode = handleExecuteError(ctx, err, statsKey, batchQuery, vtg.logExecuteBatchShard)
 	}
 	reply.Session = batchQuery.Session
 	return nil
 }
 
 // ExecuteBatchKeyspaceIds executes a group of queries based on the specified keyspace ids.
+// If query.KeyspaceIdQueries is set, each query runs on the shards of
+// its own keyspace ids instead.
 func (vtg *VTGate) ExecuteBatchKeyspaceIds(ctx context.Context, query *proto.KeyspaceIdBatchQuery, reply *proto.QueryResultList) error {
+	if len(query.KeyspaceIdQueries) > 0 {
+		keyspaces := make([]string, len(query.KeyspaceIdQueries))
+		for i, kq := range query.KeyspaceIdQueries {
+			keyspaces[i] = kq.Keyspace
+		}
+		return vtg.executeBatchQueries(ctx, "ExecuteBatchKeyspaceIds", query, keyspaces, query.TabletType, query.Session, reply, vtg.logExecuteBatchKeyspaceIds, func() ([]mproto.QueryResult, []error) {
+			return vtg.resolver.ExecuteBatchKeyspaceIdQueries(ctx, query.KeyspaceIdQueries, query.TabletType, query.Session, query.NotInTransaction)
+		})
+	}
+
 	startTime := time.Now()
 	statsKey := []string{"ExecuteBatchKeyspaceIds", query.Keyspace, string(query.TabletType)}
 	defer vtg.timings.Record(statsKey, startTime)
@@ -318,6 +383,9 @@ func (vtg *VTGate) ExecuteBatchKeyspaceIds(ctx context.Context, query *proto.Key
 	if 0 < vtg.maxInFlight && vtg.maxInFlight < x {
 		return errTooManyInFlight
 	}
+	if err := vtg.throttler.throttle(query.Keyspace, query.TabletType, query.Session); err != nil {
+		return err
+	}
 
 	qrs, err := vtg.resolver.ExecuteBatchKeyspaceIds(
 		ctx,
@@ -330,12 +398,53 @@ func (vtg *VTGate) ExecuteBatchKeyspaceIds(ctx context.Context, query *proto.Key
 		}
 		vtg.rowsReturned.Add(statsKey, rowCount)
 	} else {
-		reply.Error = handleExecuteError(err, statsKey, query, vtg.logExecuteBatchKeyspaceIds)
+		reply.Error, reply.ErrorCode = handleExecuteError(ctx, err, statsKey, query, vtg.logExecuteBatchKeyspaceIds)
 	}
 	reply.Session = query.Session
 	return nil
 }
 
+// executeBatchQueries runs execute, for batchQuery whose queries each
+// have their own keyspace, and fills reply with the result and the
+// error of each query. The keyspaces of the queries are throttled
+// separately.
+func (vtg *VTGate) executeBatchQueries(ctx context.Context, name string, batchQuery interface{}, keyspaces []string, tabletType topo.TabletType, session *proto.Session, reply *proto.QueryResultList, logger *logutil.ThrottledLogger, execute func() ([]mproto.QueryResult, []error)) error {
+	statsKeyspace := "Any"
+	if len(unique(keyspaces)) == 1 {
+		statsKeyspace = keyspaces[0]
+	}
+	startTime := time.Now()
+	statsKey := []string{name, statsKeyspace, string(tabletType)}
+	defer vtg.timings.Record(statsKey, startTime)
+
+	x := vtg.inFlight.Add(1)
+	defer vtg.inFlight.Add(-1)
+	if 0 < vtg.maxInFlight && vtg.maxInFlight < x {
+		return errTooManyInFlight
+	}
+	for keyspace := range unique(keyspaces) {
+		if err := vtg.throttler.throttle(keyspace, tabletType, session); err != nil {
+			return err
+		}
+	}
+
+	qrs, errs := execute()
+	reply.List = qrs
+	reply.Errors = make([]string, len(errs))
+	reply.ErrorCodes = make([]vterrors.ErrorCode, len(errs))
+	var rowCount int64
+	for i, err := range errs {
+		if err != nil {
+			reply.Errors[i], reply.ErrorCodes[i] = handleExecuteError(ctx, err, statsKey, batchQuery, logger)
+			continue
+		}
+		rowCount += int64(len(qrs[i].Rows))
+	}
+	vtg.rowsReturned.Add(statsKey, rowCount)
+	reply.Session = session
+	return nil
+}
+
 // StreamExecute executes a streaming query by routing based on the values in the query.
 func (vtg *VTGate) StreamExecute(ctx context.Context, query *proto.Query, sendReply func(*proto.QueryResult) error) error {
 	startTime := time.Now()
@@ -364,6 +473,7 @@ func (vtg *VTGate) StreamExecute(ctx context.Context, query *proto.Query, sendRe
 
 	if err != nil {
 		normalErrors.Add(statsKey, 1)
+		recordCallDeadline(ctx)
 		logError(err, query, vtg.logStreamExecute)
 	}
 	// Now we can send the final Sessoin info.
@@ -375,10 +485,8 @@ func (vtg *VTGate) StreamExecute(ctx context.Context, query *proto.Query, sendRe
 
 // StreamExecuteKeyspaceIds executes a streaming query on the specified KeyspaceIds.
 // The KeyspaceIds are resolved to shards using the serving graph.
-// This function currently temporarily enforces the restriction of executing on
-// one shard since it cannot merge-sort the results to guarantee ordering of
-// response which is needed for checkpointing.
-// The api supports supplying multiple KeyspaceIds to make it future proof.
+// If query.OrderedMerge is set, the rows of the shards are merged on
+// the ORDER BY columns of the query, so they are sent in order.
 func (vtg *VTGate) StreamExecuteKeyspaceIds(ctx context.Context, query *proto.KeyspaceIdQuery, sendReply func(*proto.QueryResult) error) error {
 	startTime := time.Now()
 	statsKey := []string{"StreamExecuteKeyspaceIds", query.Keyspace, string(query.TabletType)}
@@ -389,6 +497,9 @@ func (vtg *VTGate) StreamExecuteKeyspaceIds(ctx context.Context, query *proto.Ke
 	if 0 < vtg.maxInFlight && vtg.maxInFlight < x {
 		return errTooManyInFlight
 	}
+	if err := vtg.throttler.throttle(query.Keyspace, query.TabletType, query.Session); err != nil {
+		return err
+	}
 
 	var rowCount int64
 	err := vtg.resolver.StreamExecuteKeyspaceIds(
@@ -406,6 +517,7 @@ func (vtg *VTGate) StreamExecuteKeyspaceIds(ctx context.Context, query *proto.Ke
 
 	if err != nil {
 		normalErrors.Add(statsKey, 1)
+		recordCallDeadline(ctx)
 		logError(err, query, vtg.logStreamExecuteKeyspaceIds)
 	}
 	// Now we can send the final Sessoin info.
@@ -417,10 +529,8 @@ func (vtg *VTGate) StreamExecuteKeyspaceIds(ctx context.Context, query *proto.Ke
 
 // StreamExecuteKeyRanges executes a streaming query on the specified KeyRanges.
 // The KeyRanges are resolved to shards using the serving graph.
-// This function currently temporarily enforces the restriction of executing on
-// one shard since it cannot merge-sort the results to guarantee ordering of
-// response which is needed for checkpointing.
-// The api supports supplying multiple keyranges to make it future proof.
+// If query.OrderedMerge is set, the rows of the shards are merged on
+// the ORDER BY columns of the query, so they are sent in order.
 func (vtg *VTGate) StreamExecuteKeyRanges(ctx context.Context, query *proto.KeyRangeQuery, sendReply func(*proto.QueryResult) error) error {
 	startTime := time.Now()
 	statsKey := []string{"StreamExecuteKeyRanges", query.Keyspace, string(query.TabletType)}
@@ -431,6 +541,9 @@ func (vtg *VTGate) StreamExecuteKeyRanges(ctx context.Context, query *proto.KeyR
 	if 0 < vtg.maxInFlight && vtg.maxInFlight < x {
 		return errTooManyInFlight
 	}
+	if err := vtg.throttler.throttle(query.Keyspace, query.TabletType, query.Session); err != nil {
+		return err
+	}
 
 	var rowCount int64
 	err := vtg.resolver.StreamExecuteKeyRanges(
@@ -448,6 +561,7 @@ func (vtg *VTGate) StreamExecuteKeyRanges(ctx context.Context, query *proto.KeyR
 
 	if err != nil {
 		normalErrors.Add(statsKey, 1)
+		recordCallDeadline(ctx)
 		logError(err, query, vtg.logStreamExecuteKeyRanges)
 	}
 	// Now we can send the final Sessoin info.
@@ -458,6 +572,8 @@ func (vtg *VTGate) StreamExecuteKeyRanges(ctx context.Context, query *proto.KeyR
 }
 
 // StreamExecuteShard executes a streaming query on the specified shards.
+// If query.OrderedMerge is set, the rows of the shards are merged on
+// the ORDER BY columns of the query, so they are sent in order.
 func (vtg *VTGate) StreamExecuteShard(ctx context.Context, query *proto.QueryShard, sendReply func(*proto.QueryResult) error) error {
 	startTime := time.Now()
 	statsKey := []string{"StreamExecuteShard", query.Keyspace, string(query.TabletType)}
@@ -468,6 +584,9 @@ func (vtg *VTGate) StreamExecuteShard(ctx context.Context, query *proto.QuerySha
 	if 0 < vtg.maxInFlight && vtg.maxInFlight < x {
 		return errTooManyInFlight
 	}
+	if err := vtg.throttler.throttle(query.Keyspace, query.TabletType, query.Session); err != nil {
+		return err
+	}
 
 	var rowCount int64
 	err := vtg.resolver.StreamExecute(
@@ -488,11 +607,13 @@ func (vtg *VTGate) StreamExecuteShard(ctx context.Context, query *proto.QuerySha
 			// as it may change incrementaly as responses are sent.
 			return sendReply(reply)
 		},
-		query.NotInTransaction)
+		query.NotInTransaction,
+		query.OrderedMerge)
 	vtg.rowsReturned.Add(statsKey, rowCount)
 
 	if err != nil {
 		normalErrors.Add(statsKey, 1)
+		recordCallDeadline(ctx)
 		logError(err, query, vtg.logStreamExecuteShard)
 	}
 	// Now we can send the final Sessoin info.
@@ -535,7 +656,7 @@ func (vtg *VTGate) SplitQuery(ctx context.Context, req *proto.SplitQueryRequest,
 		keyRangeByShard[shard.Name] = shard.KeyRange
 	}
 	perShardSplitCount := int(math.Ceil(float64(req.SplitCount) / float64(len(shards))))
-	splits, err := vtg.resolver.scatterConn.SplitQuery(ctx, req.Query, perShardSplitCount, keyRangeByShard, keyspace)
+	splits, err := vtg.resolver.scatterConn.SplitQuery(ctx, req.Query, req.SplitColumn, perShardSplitCount, keyRangeByShard, keyspace)
 	if err != nil {
 		return err
 	}
@@ -543,6 +664,46 @@ func (vtg *VTGate) SplitQuery(ctx context.Context, req *proto.SplitQueryRequest,
 	return nil
 }
 
+// GetKeyspaceIdResolver returns the sharding column of a keyspace, so
+// clients can build the keyspace ids of their rows.
+func (vtg *VTGate) GetKeyspaceIdResolver(ctx context.Context, req *proto.GetKeyspaceIdResolverRequest, reply *proto.GetKeyspaceIdResolverResult) error {
+	sc := vtg.resolver.scatterConn
+	ks, err := sc.toposerv.GetSrvKeyspace(ctx, sc.cell, req.Keyspace)
+	if err != nil {
+		return fmt.Errorf("keyspace %v fetch error: %v", req.Keyspace, err)
+	}
+	reply.ShardingColumnName = ks.ShardingColumnName
+	reply.ShardingColumnType = ks.ShardingColumnType
+	return nil
+}
+
+// GetSrvKeyspace returns the SrvKeyspace of a keyspace, as cached by
+// vtgate.
+func (vtg *VTGate) GetSrvKeyspace(ctx context.Context, req *proto.GetSrvKeyspaceRequest, reply *topo.SrvKeyspace) error {
+	sc := vtg.resolver.scatterConn
+	cell := req.Cell
+	if cell == "" {
+		cell = sc.cell
+	}
+	ks, err := sc.toposerv.GetSrvKeyspace(ctx, cell, req.Keyspace)
+	if err != nil {
+		return fmt.Errorf("keyspace %v fetch error: %v", req.Keyspace, err)
+	}
+	*reply = *ks
+	return nil
+}
+
+// Explain returns the routing decision of vtgate for a V3 query,
+// without executing it.
+func (vtg *VTGate) Explain(ctx context.Context, query *proto.Query, reply *proto.ExplainResult) error {
+	result, err := vtg.router.Explain(ctx, query)
+	if err != nil {
+		return err
+	}
+	*reply = *result
+	return nil
+}
+
 // Any errors that are caused by VTGate dependencies (e.g, VtTablet) should be logged
 // as errors in those components, but logged to Info in VTGate itself.
 func logError(err error, query interface{}, logger *logutil.ThrottledLogger) {
@@ -588,31 +749,44 @@ func isErrorCausedByVTGate(err error) bool {
 	return false
 }
 
-func handleExecuteError(err error, statsKey []string, query interface{}, logger *logutil.ThrottledLogger) string {
+// handleExecuteError records err, and returns the message and code to
+// send to the client.
+func handleExecuteError(ctx context.Context, err error, statsKey []string, query interface{}, logger *logutil.ThrottledLogger) (string, vterrors.ErrorCode) {
+	recordCallDeadline(ctx)
 	errStr := err.Error() + ", vtgate: " + servenv.ListeningURL.String()
-	if strings.Contains(errStr, errDupKey) {
+	code := vterrors.RecoverCode(err)
+	if code == vterrors.Unknown && ctx.Err() == context.DeadlineExceeded {
+		code = vterrors.DeadlineExceeded
+	}
+	switch code {
+	case vterrors.IntegrityError:
 		infoErrors.Add("DupKey", 1)
-	} else if strings.Contains(errStr, errTxPoolFull) {
+	case vterrors.Transient, vterrors.ResourceExhausted, vterrors.QueryNotServed, vterrors.Unavailable, vterrors.NotInTx:
 		normalErrors.Add(statsKey, 1)
-	} else {
+	default:
 		normalErrors.Add(statsKey, 1)
 		logError(err, query, logger)
 	}
-	return errStr
+	return errStr, code
 }
 
-func formatError(err error) error {
-	if err == nil {
-		return nil
+// recordCallDeadline counts the calls that failed because their
+// deadline expired.
+func recordCallDeadline(ctx context.Context) {
+	if ctx.Err() == context.DeadlineExceeded {
+		deadlineExceeded.Add("Call", 1)
 	}
-	return fmt.Errorf("%v, vtgate: %v", err, servenv.ListeningURL.String())
+}
+
+func formatError(err error) error {
+	return vterrors.WithSuffix(err, ", vtgate: "+servenv.ListeningURL.String())
 }
 
 // HandlePanic recovers from panics, and logs / increment counters
 func (vtg *VTGate) HandlePanic(err *error) {
 	if x := recover(); x != nil {
 		log.Errorf("Uncaught panic:\n%v\n%s", x, tb.Stack(4))
-		*err = fmt.Errorf("uncaught panic: %v, vtgate: %v", x, servenv.ListeningURL.String())
+		*err = vterrors.Errorf(vterrors.Internal, "uncaught panic: %v, vtgate: %v", x, servenv.ListeningURL.String())
 		internalErrors.Add("Panic", 1)
 	}
 }
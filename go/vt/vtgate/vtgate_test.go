@@ -7,6 +7,7 @@ package vtgate
 import (
 	"fmt"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -15,6 +16,7 @@ import (
 	tproto "github.com/youtube/vitess/go/vt/tabletserver/proto"
 	"github.com/youtube/vitess/go/vt/tabletserver/tabletconn"
 	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/vt/vterrors"
 	"github.com/youtube/vitess/go/vt/vtgate/proto"
 	"golang.org/x/net/context"
 )
@@ -148,6 +150,40 @@ func TestVTGateExecuteShard(t *testing.T) {
 	*/
 }
 
+func TestVTGateThrottle(t *testing.T) {
+	sandbox := createSandbox("TestVTGateThrottle")
+	sbc := &sandboxConn{}
+	sandbox.MapTestConn("0", sbc)
+	rpcVTGate.throttler.setLimits(map[string]int{throttlerKey("TestVTGateThrottle", ""): 0})
+	defer rpcVTGate.throttler.setLimits(nil)
+
+	q := proto.QueryShard{
+		Sql:      "query",
+		Keyspace: "TestVTGateThrottle",
+		Shards:   []string{"0"},
+	}
+	qr := new(proto.QueryResult)
+	err := rpcVTGate.ExecuteShard(context.Background(), &q, qr)
+	if err == nil || !strings.HasPrefix(err.Error(), "throttled: ") {
+		t.Errorf("want throttled error, got %v", err)
+	}
+	if code := vterrors.RecoverCode(err); code != vterrors.ResourceExhausted {
+		t.Errorf("throttled error code = %v, want %v", code, vterrors.ResourceExhausted)
+	}
+	if got := sbc.ExecCount.Get(); got != 0 {
+		t.Errorf("want 0 queries, got %v", got)
+	}
+
+	// statements of a transaction go through
+	q.Session = &proto.Session{InTransaction: true}
+	if err := rpcVTGate.ExecuteShard(context.Background(), &q, qr); err != nil {
+		t.Errorf("want nil, got %v", err)
+	}
+	if sbc.ExecCount.Get() == 0 {
+		t.Errorf("the statement in a transaction was not sent")
+	}
+}
+
 func TestVTGateExecuteKeyspaceIds(t *testing.T) {
 	s := createSandbox("TestVTGateExecuteKeyspaceIds")
 	sbc1 := &sandboxConn{}
@@ -172,6 +208,7 @@ func TestVTGateExecuteKeyspaceIds(t *testing.T) {
 	}
 	wantqr := new(proto.QueryResult)
 	wantqr.Result = singleRowResult
+	wantqr.TabletType = topo.TYPE_MASTER
 	if !reflect.DeepEqual(wantqr, qr) {
 		t.Errorf("want \n%+v, got \n%+v", singleRowResult, qr)
 	}
@@ -237,6 +274,7 @@ func TestVTGateExecuteKeyRanges(t *testing.T) {
 	}
 	wantqr := new(proto.QueryResult)
 	wantqr.Result = singleRowResult
+	wantqr.TabletType = topo.TYPE_MASTER
 	if !reflect.DeepEqual(wantqr, qr) {
 		t.Errorf("want \n%+v, got \n%+v", singleRowResult, qr)
 	}
@@ -311,6 +349,7 @@ func TestVTGateExecuteEntityIds(t *testing.T) {
 	}
 	wantqr := new(proto.QueryResult)
 	wantqr.Result = singleRowResult
+	wantqr.TabletType = topo.TYPE_MASTER
 	if !reflect.DeepEqual(wantqr, qr) {
 		t.Errorf("want \n%+v, got \n%+v", singleRowResult, qr)
 	}
@@ -440,6 +479,41 @@ func TestVTGateExecuteBatchKeyspaceIds(t *testing.T) {
 	}
 }
 
+func TestVTGateExecuteBatchShardQueries(t *testing.T) {
+	s := createSandbox("TestVTGateExecuteBatchShardQueries")
+	s.MapTestConn("-20", &sandboxConn{})
+	s.MapTestConn("20-40", &sandboxConn{mustFailServer: 1})
+	q := proto.BatchQueryShard{
+		ShardQueries: []proto.BoundShardQuery{{
+			Sql:      "query",
+			Keyspace: "TestVTGateExecuteBatchShardQueries",
+			Shards:   []string{"-20"},
+		}, {
+			Sql:      "query",
+			Keyspace: "TestVTGateExecuteBatchShardQueries",
+			Shards:   []string{"20-40"},
+		}},
+	}
+	qrl := new(proto.QueryResultList)
+	err := rpcVTGate.ExecuteBatchShard(context.Background(), &q, qrl)
+	if err != nil {
+		t.Errorf("want nil, got %v", err)
+	}
+	if qrl.Error != "" {
+		t.Errorf("want empty, got %v", qrl.Error)
+	}
+	if len(qrl.List) != 2 || len(qrl.Errors) != 2 {
+		t.Fatalf("want 2 results and errors, got %+v", qrl)
+	}
+	if qrl.List[0].RowsAffected != 1 || qrl.Errors[0] != "" {
+		t.Errorf("want 1 row and no error, got %v, %v", qrl.List[0].RowsAffected, qrl.Errors[0])
+	}
+	want := "error: err"
+	if !strings.Contains(qrl.Errors[1], want) {
+		t.Errorf("want %v, got %v", want, qrl.Errors[1])
+	}
+}
+
 func TestVTGateStreamExecute(t *testing.T) {
 	sandbox := createSandbox(KsTestUnsharded)
 	sbc := &sandboxConn{}
@@ -733,6 +807,34 @@ func TestVTGateSplitQuery(t *testing.T) {
 	if !reflect.DeepEqual(actualSqlsByKeyRange, expectedSqlsByKeyRange) {
 		t.Errorf("splits contain the wrong sqls and/or keyranges, got: %v, want: %v", actualSqlsByKeyRange, expectedSqlsByKeyRange)
 	}
+
+	// the shard key ranges cover the whole keyspace, without overlap
+	var ranges kproto.KeyRangeArray
+	for kr := range actualSqlsByKeyRange {
+		ranges = append(ranges, kr)
+	}
+	ranges.Sort()
+	if ranges[0].Start != kproto.MinKey || ranges[len(ranges)-1].End != kproto.MaxKey {
+		t.Errorf("splits do not cover the whole keyspace: %v", ranges)
+	}
+	for i := 1; i < len(ranges); i++ {
+		if ranges[i-1].End != ranges[i].Start {
+			t.Errorf("splits have a gap or an overlap between %v and %v", ranges[i-1], ranges[i])
+		}
+	}
+
+	// the split column is sent to the tablets
+	req.SplitColumn = "id2"
+	req.SplitCount = 8
+	result = new(proto.SplitQueryResult)
+	if err := rpcVTGate.SplitQuery(context.Background(), &req, result); err != nil {
+		t.Fatalf("want nil, got %v", err)
+	}
+	for _, split := range result.Splits {
+		if want := "select col1, col2 from table /*split 0 on id2 */"; split.Query.Sql != want {
+			t.Errorf("wrong split sql, got %v, want %v", split.Query.Sql, want)
+		}
+	}
 }
 
 func TestIsErrorCausedByVTGate(t *testing.T) {
@@ -782,3 +884,61 @@ func TestIsErrorCausedByVTGate(t *testing.T) {
 		}
 	}
 }
+
+func TestVTGateGetSrvKeyspace(t *testing.T) {
+	createSandbox("TestVTGateGetSrvKeyspace")
+	reply := new(topo.SrvKeyspace)
+	err := rpcVTGate.GetSrvKeyspace(context.Background(), &proto.GetSrvKeyspaceRequest{Keyspace: "TestVTGateGetSrvKeyspace"}, reply)
+	if err != nil {
+		t.Fatalf("GetSrvKeyspace failed: %v", err)
+	}
+	want, err := createShardedSrvKeyspace(DefaultShardSpec, "")
+	if err != nil {
+		t.Fatalf("createShardedSrvKeyspace failed: %v", err)
+	}
+	if !reflect.DeepEqual(reply, want) {
+		t.Errorf("want %+v, got %+v", want, reply)
+	}
+
+	s := createSandbox("TestVTGateGetSrvKeyspaceFail")
+	s.SrvKeyspaceMustFail = 1
+	err = rpcVTGate.GetSrvKeyspace(context.Background(), &proto.GetSrvKeyspaceRequest{Cell: "bb", Keyspace: "TestVTGateGetSrvKeyspaceFail"}, reply)
+	wantErr := "keyspace TestVTGateGetSrvKeyspaceFail fetch error: topo error GetSrvKeyspace"
+	if err == nil || err.Error() != wantErr {
+		t.Errorf("want %v, got %v", wantErr, err)
+	}
+}
+
+func TestVTGateGetKeyspaceIdResolver(t *testing.T) {
+	createSandbox("TestVTGateGetKeyspaceIdResolver")
+	reply := new(proto.GetKeyspaceIdResolverResult)
+	err := rpcVTGate.GetKeyspaceIdResolver(context.Background(), &proto.GetKeyspaceIdResolverRequest{Keyspace: "TestVTGateGetKeyspaceIdResolver"}, reply)
+	if err != nil {
+		t.Fatalf("GetKeyspaceIdResolver failed: %v", err)
+	}
+	want := proto.GetKeyspaceIdResolverResult{
+		ShardingColumnName: "user_id",
+		ShardingColumnType: key.KIT_UINT64,
+	}
+	if *reply != want {
+		t.Errorf("want %+v, got %+v", want, *reply)
+	}
+
+	// Unsharded keyspaces have no sharding column.
+	createSandbox(KsTestUnsharded)
+	reply = new(proto.GetKeyspaceIdResolverResult)
+	if err := rpcVTGate.GetKeyspaceIdResolver(context.Background(), &proto.GetKeyspaceIdResolverRequest{Keyspace: KsTestUnsharded}, reply); err != nil {
+		t.Fatalf("GetKeyspaceIdResolver failed: %v", err)
+	}
+	if *reply != (proto.GetKeyspaceIdResolverResult{}) {
+		t.Errorf("want empty result, got %+v", *reply)
+	}
+
+	s := createSandbox("TestVTGateGetKeyspaceIdResolverFail")
+	s.SrvKeyspaceMustFail = 1
+	err = rpcVTGate.GetKeyspaceIdResolver(context.Background(), &proto.GetKeyspaceIdResolverRequest{Keyspace: "TestVTGateGetKeyspaceIdResolverFail"}, reply)
+	wantErr := "keyspace TestVTGateGetKeyspaceIdResolverFail fetch error: topo error GetSrvKeyspace"
+	if err == nil || err.Error() != wantErr {
+		t.Errorf("want %v, got %v", wantErr, err)
+	}
+}
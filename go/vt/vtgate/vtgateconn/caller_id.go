@@ -0,0 +1,21 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vtgateconn
+
+import "golang.org/x/net/context"
+
+type callerIDKey struct{}
+
+// WithCallerID returns a context that sends callerID with the V3
+// queries made with it. vtgate checks its query rules against it.
+func WithCallerID(ctx context.Context, callerID string) context.Context {
+	return context.WithValue(ctx, callerIDKey{}, callerID)
+}
+
+// CallerID returns the caller id of ctx, or "" if it has none.
+func CallerID(ctx context.Context) string {
+	callerID, _ := ctx.Value(callerIDKey{}).(string)
+	return callerID
+}
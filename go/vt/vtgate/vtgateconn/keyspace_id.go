@@ -0,0 +1,87 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vtgateconn
+
+import (
+	"fmt"
+
+	"github.com/youtube/vitess/go/vt/key"
+)
+
+// This file contains the helpers that build the keyspace id of a row
+// from its sharding key, the same way the servers do.
+
+// KeyspaceIdFromUint64 returns the keyspace id of a uint64 sharding
+// key: its 8 bytes, in big endian order.
+func KeyspaceIdFromUint64(v uint64) key.KeyspaceId {
+	return key.Uint64Key(v).KeyspaceId()
+}
+
+// KeyspaceIdFromBytes returns the keyspace id of a bytes sharding
+// key, which is the key itself.
+func KeyspaceIdFromBytes(b []byte) key.KeyspaceId {
+	return key.KeyspaceId(b)
+}
+
+// KeyspaceIdFromString returns the keyspace id of a string sharding
+// key, which is the bytes of the string.
+func KeyspaceIdFromString(s string) key.KeyspaceId {
+	return key.KeyspaceId(s)
+}
+
+// KeyspaceIdResolver builds the keyspace ids of a keyspace from the
+// values of its sharding column. It is returned by
+// VTGateConn.GetKeyspaceIdResolver, for the clients that don't know
+// the sharding scheme of their keyspaces.
+type KeyspaceIdResolver struct {
+	Keyspace           string
+	ShardingColumnName string
+	ShardingColumnType key.KeyspaceIdType
+}
+
+// KeyspaceId returns the keyspace id for a value of the sharding
+// column. uint64 keyspaces accept the integer types, and bytes
+// keyspaces accept []byte and string.
+func (r *KeyspaceIdResolver) KeyspaceId(value interface{}) (key.KeyspaceId, error) {
+	switch r.ShardingColumnType {
+	case key.KIT_UINT64:
+		var v uint64
+		switch value := value.(type) {
+		case uint64:
+			v = value
+		case uint32:
+			v = uint64(value)
+		case uint:
+			v = uint64(value)
+		case int64:
+			if value < 0 {
+				return "", fmt.Errorf("negative sharding key %v for uint64 keyspace %v", value, r.Keyspace)
+			}
+			v = uint64(value)
+		case int32:
+			if value < 0 {
+				return "", fmt.Errorf("negative sharding key %v for uint64 keyspace %v", value, r.Keyspace)
+			}
+			v = uint64(value)
+		case int:
+			if value < 0 {
+				return "", fmt.Errorf("negative sharding key %v for uint64 keyspace %v", value, r.Keyspace)
+			}
+			v = uint64(value)
+		default:
+			return "", fmt.Errorf("unexpected sharding key type %T for uint64 keyspace %v", value, r.Keyspace)
+		}
+		return KeyspaceIdFromUint64(v), nil
+	case key.KIT_BYTES:
+		switch value := value.(type) {
+		case []byte:
+			return KeyspaceIdFromBytes(value), nil
+		case string:
+			return KeyspaceIdFromString(value), nil
+		}
+		return "", fmt.Errorf("unexpected sharding key type %T for bytes keyspace %v", value, r.Keyspace)
+	}
+	return "", fmt.Errorf("keyspace %v has no sharding column", r.Keyspace)
+}
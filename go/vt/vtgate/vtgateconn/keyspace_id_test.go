@@ -0,0 +1,104 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vtgateconn
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/youtube/vitess/go/testfiles"
+	"github.com/youtube/vitess/go/vt/key"
+)
+
+// keyspaceIdVector is an entry of keyspace_id_vectors.json. The file
+// is shared with the clients in other languages, so they can check
+// they build the same keyspace ids. value is a decimal number for
+// uint64 keys, hex for bytes keys, and the string itself for string
+// keys. keyspace_id is always hex.
+type keyspaceIdVector struct {
+	Type       string `json:"type"`
+	Value      string `json:"value"`
+	KeyspaceId string `json:"keyspace_id"`
+}
+
+func TestKeyspaceIdVectors(t *testing.T) {
+	data, err := ioutil.ReadFile(testfiles.Locate("keyspace_id_vectors.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var vectors []keyspaceIdVector
+	if err := json.Unmarshal(data, &vectors); err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range vectors {
+		var got key.KeyspaceId
+		switch v.Type {
+		case "uint64":
+			u, err := strconv.ParseUint(v.Value, 10, 64)
+			if err != nil {
+				t.Fatalf("bad uint64 value %v: %v", v.Value, err)
+			}
+			got = KeyspaceIdFromUint64(u)
+		case "bytes":
+			b, err := hex.DecodeString(v.Value)
+			if err != nil {
+				t.Fatalf("bad bytes value %v: %v", v.Value, err)
+			}
+			got = KeyspaceIdFromBytes(b)
+		case "string":
+			got = KeyspaceIdFromString(v.Value)
+		default:
+			t.Fatalf("unknown type %v", v.Type)
+		}
+		if string(got.Hex()) != v.KeyspaceId {
+			t.Errorf("keyspace id of %v %q: got %v, want %v", v.Type, v.Value, got.Hex(), v.KeyspaceId)
+		}
+	}
+}
+
+func TestKeyspaceIdResolver(t *testing.T) {
+	uint64Resolver := &KeyspaceIdResolver{Keyspace: "ks", ShardingColumnName: "user_id", ShardingColumnType: key.KIT_UINT64}
+	bytesResolver := &KeyspaceIdResolver{Keyspace: "ks", ShardingColumnName: "user_key", ShardingColumnType: key.KIT_BYTES}
+	for _, tcase := range []struct {
+		resolver *KeyspaceIdResolver
+		value    interface{}
+		want     key.HexKeyspaceId
+	}{
+		{uint64Resolver, uint64(0x0102030405060708), "0102030405060708"},
+		{uint64Resolver, int64(1), "0000000000000001"},
+		{uint64Resolver, 4660, "0000000000001234"},
+		{uint64Resolver, uint32(1), "0000000000000001"},
+		{bytesResolver, []byte{0x00, 0xff}, "00ff"},
+		{bytesResolver, "abc", "616263"},
+	} {
+		got, err := tcase.resolver.KeyspaceId(tcase.value)
+		if err != nil {
+			t.Errorf("KeyspaceId(%v) failed: %v", tcase.value, err)
+			continue
+		}
+		if got.Hex() != tcase.want {
+			t.Errorf("KeyspaceId(%v): got %v, want %v", tcase.value, got.Hex(), tcase.want)
+		}
+	}
+
+	for _, tcase := range []struct {
+		resolver *KeyspaceIdResolver
+		value    interface{}
+		want     string
+	}{
+		{uint64Resolver, int64(-1), "negative sharding key -1 for uint64 keyspace ks"},
+		{uint64Resolver, "1", "unexpected sharding key type string for uint64 keyspace ks"},
+		{bytesResolver, 1, "unexpected sharding key type int for bytes keyspace ks"},
+		{&KeyspaceIdResolver{Keyspace: "unsharded"}, 1, "keyspace unsharded has no sharding column"},
+	} {
+		if _, err := tcase.resolver.KeyspaceId(tcase.value); err == nil || !strings.Contains(err.Error(), tcase.want) {
+			t.Errorf("KeyspaceId(%v): %v, want %v", tcase.value, err, tcase.want)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vtgateconn
+
+import (
+	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/vt/vtgate/proto"
+	"golang.org/x/net/context"
+)
+
+// Routing is the routing policy of the reads made with a context.
+// It is used by ExecuteShard, ExecuteKeyRanges and ExecuteEntityIds,
+// outside of a transaction.
+type Routing struct {
+	Policy              proto.RoutingPolicy
+	AllowMasterFallback bool
+
+	// TabletType is set by each call to the tablet type that
+	// served it, so it can be logged. A Routing should not be
+	// shared by concurrent calls.
+	TabletType topo.TabletType
+}
+
+type routingKey struct{}
+
+// WithRouting returns a context whose reads use routing.
+func WithRouting(ctx context.Context, routing *Routing) context.Context {
+	return context.WithValue(ctx, routingKey{}, routing)
+}
+
+// RoutingFromContext returns the Routing of ctx, or nil if it has
+// none.
+func RoutingFromContext(ctx context.Context) *Routing {
+	routing, _ := ctx.Value(routingKey{}).(*Routing)
+	return routing
+}
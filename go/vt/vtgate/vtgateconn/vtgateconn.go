@@ -5,13 +5,20 @@
 package vtgateconn
 
 import (
+	"errors"
 	"flag"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
 	"time"
 
 	log "github.com/golang/glog"
 	mproto "github.com/youtube/vitess/go/mysql/proto"
+	"github.com/youtube/vitess/go/vt/key"
 	tproto "github.com/youtube/vitess/go/vt/tabletserver/proto"
 	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/vt/vterrors"
 	"github.com/youtube/vitess/go/vt/vtgate/proto"
 	"golang.org/x/net/context"
 )
@@ -25,15 +32,85 @@ var (
 	vtgateProtocol = flag.String("vtgate_protocol", GoRPCProtocol, "how to talk to vtgate")
 )
 
+// The codes of a ServerError.
+const (
+	// ERR_NORMAL is an error of the query. Errno contains
+	// its MySQL error number, if there was one.
+	ERR_NORMAL = iota
+	// ERR_THROTTLED means the query was rejected because a limit
+	// was reached: a rate limit or the requests in flight of
+	// vtgate, or the transaction pool of vttablet. The query can be
+	// retried later.
+	ERR_THROTTLED
+)
+
+// ErrTimeout is returned when a call does not complete before the
+// deadline of its context.
+var ErrTimeout = errors.New("vtgate: deadline exceeded")
+
+var errnoExtract = regexp.MustCompile(`\(errno ([0-9]+)\)`)
+
 // ServerError represents an error that was returned from
-// a vtgate server.
+// a vtgate server. ServerCode is the vterrors code sent by vtgate, or
+// the one guessed from the message for the vtgates that don't send
+// codes.
 type ServerError struct {
-	Code int
-	Err  string
+	Code       int
+	ServerCode vterrors.ErrorCode
+	Errno      int
+	Err        string
 }
 
 func (e *ServerError) Error() string { return e.Err }
 
+// ErrorCode returns the vterrors code of the error.
+func (e *ServerError) ErrorCode() int64 { return int64(e.ServerCode) }
+
+// NewServerError returns the ServerError for an error message
+// returned by vtgate.
+func NewServerError(err string) *ServerError {
+	return NewServerErrorWithCode(err, vterrors.Unknown)
+}
+
+// NewServerErrorWithCode returns the ServerError for an error message
+// returned by vtgate with its code.
+func NewServerErrorWithCode(err string, code vterrors.ErrorCode) *ServerError {
+	se := &ServerError{Code: ERR_NORMAL, ServerCode: code, Err: err}
+	if match := errnoExtract.FindStringSubmatch(err); match != nil {
+		se.Errno, _ = strconv.Atoi(match[1])
+	}
+	if se.ServerCode == vterrors.Unknown {
+		// the servers that send no code are recognized by their messages
+		switch {
+		case strings.HasPrefix(err, "throttled: ") || strings.HasPrefix(err, "request_backlog: "):
+			se.ServerCode = vterrors.ResourceExhausted
+		case se.Errno == 1062:
+			se.ServerCode = vterrors.IntegrityError
+		}
+	}
+	if se.ServerCode == vterrors.ResourceExhausted {
+		se.Code = ERR_THROTTLED
+	}
+	return se
+}
+
+// BatchError is returned by the batch calls when some of their
+// queries failed. Errors has the error of each query of the batch,
+// or nil if it succeeded.
+type BatchError struct {
+	Errors []error
+}
+
+func (e *BatchError) Error() string {
+	var msgs []string
+	for i, err := range e.Errors {
+		if err != nil {
+			msgs = append(msgs, fmt.Sprintf("query %d: %v", i, err))
+		}
+	}
+	return strings.Join(msgs, "\n")
+}
+
 // OperationalError represents an error due to a failure to
 // communicate with vtgate.
 type OperationalError string
@@ -50,12 +127,41 @@ type VTGateConn interface {
 	Execute(ctx context.Context, query string, bindVars map[string]interface{}, tabletType topo.TabletType) (*mproto.QueryResult, error)
 	// ExecuteShard executes a non-streaming query for multiple shards on vtgate.
 	ExecuteShard(ctx context.Context, query string, keyspace string, shards []string, bindVars map[string]interface{}, tabletType topo.TabletType) (*mproto.QueryResult, error)
+	// ExecuteKeyRanges executes a non-streaming query on the shards
+	// of the keyspace covering the key ranges. If some shards fail,
+	// the error aggregates the failures of each of them.
+	ExecuteKeyRanges(ctx context.Context, query string, keyspace string, keyRanges []key.KeyRange, bindVars map[string]interface{}, tabletType topo.TabletType) (*mproto.QueryResult, error)
+	// ExecuteEntityIds executes a non-streaming query on the shards
+	// of the entity keyspace ids. The query is rewritten on each shard
+	// so it only applies to the entity ids of that shard, by adding
+	// a 'entityColumnName in (...)' condition.
+	ExecuteEntityIds(ctx context.Context, query string, keyspace string, entityColumnName string, entityKeyspaceIDs []proto.EntityId, bindVars map[string]interface{}, tabletType topo.TabletType) (*mproto.QueryResult, error)
+	// ExecuteBatchShard executes a batch of queries, each on its own
+	// keyspace and shards, in one round trip. vtgate sends the queries
+	// of a shard to it together. It returns the result of each query,
+	// in order. If some of them fail, the error is a *BatchError, and
+	// their results are empty.
+	ExecuteBatchShard(ctx context.Context, queries []proto.BoundShardQuery, tabletType topo.TabletType) ([]mproto.QueryResult, error)
+	// ExecuteBatchKeyspaceIds is like ExecuteBatchShard, with each
+	// query on the shards of its own keyspace ids.
+	ExecuteBatchKeyspaceIds(ctx context.Context, queries []proto.BoundKeyspaceIdQuery, tabletType topo.TabletType) ([]mproto.QueryResult, error)
 
 	// StreamExecute executes a streaming query on vtgate. It returns a channel, ErrFunc and error.
 	// If error is non-nil, it means that the StreamExecute failed to send the request. Otherwise,
 	// you can pull values from the channel till it's closed. Following this, you can call ErrFunc
 	// to see if the stream ended normally or due to a failure.
 	StreamExecute(ctx context.Context, query string, bindVars map[string]interface{}, tabletType topo.TabletType) (<-chan *mproto.QueryResult, ErrFunc)
+	// StreamExecuteShard executes a streaming query on vtgate, on a set of shards.
+	// The field info is returned once. If orderedMerge is set, the rows of
+	// the shards are merged on the ORDER BY columns of the query, otherwise
+	// they are returned as they arrive. Cancelling ctx ends the stream.
+	StreamExecuteShard(ctx context.Context, query string, keyspace string, shards []string, bindVars map[string]interface{}, tabletType topo.TabletType, orderedMerge bool) (<-chan *mproto.QueryResult, ErrFunc)
+	// StreamExecuteKeyRanges executes a streaming query on vtgate, on the
+	// shards covering the key ranges. It works like StreamExecuteShard.
+	StreamExecuteKeyRanges(ctx context.Context, query string, keyspace string, keyRanges []key.KeyRange, bindVars map[string]interface{}, tabletType topo.TabletType, orderedMerge bool) (<-chan *mproto.QueryResult, ErrFunc)
+	// StreamExecuteKeyspaceIds executes a streaming query on vtgate, on the
+	// shards of the keyspace ids. It works like StreamExecuteShard.
+	StreamExecuteKeyspaceIds(ctx context.Context, query string, keyspace string, keyspaceIds []key.KeyspaceId, bindVars map[string]interface{}, tabletType topo.TabletType, orderedMerge bool) (<-chan *mproto.QueryResult, ErrFunc)
 
 	// Begin starts a transaction and returns a VTGateTX.
 	Begin(ctx context.Context) (VTGateTx, error)
@@ -64,8 +170,24 @@ type VTGateConn interface {
 	Close()
 
 	// SplitQuery splits a query into equally sized smaller queries by
-	// appending primary key range clauses to the original query
-	SplitQuery(ctx context.Context, keyspace string, query tproto.BoundQuery, splitCount int) ([]proto.SplitQueryPart, error)
+	// appending range clauses on splitColumn to the original query.
+	// If splitColumn is empty, the first primary key column is used.
+	// Each split is a KeyRangeQuery for the rdonly tablets of one
+	// shard, and the splits cover the whole table without overlap.
+	SplitQuery(ctx context.Context, keyspace string, query tproto.BoundQuery, splitColumn string, splitCount int) ([]proto.SplitQueryPart, error)
+
+	// GetKeyspaceIdResolver returns the sharding column of a
+	// keyspace, which builds the keyspace ids of its rows.
+	GetKeyspaceIdResolver(ctx context.Context, keyspace string) (*KeyspaceIdResolver, error)
+
+	// Explain returns how vtgate would route a query given to
+	// Execute: the plan, the keyspace and shards, and the rewritten
+	// query. The query is not executed.
+	Explain(ctx context.Context, query string, bindVars map[string]interface{}, tabletType topo.TabletType) (*proto.ExplainResult, error)
+
+	// GetSrvKeyspace returns the serving graph of a keyspace in a
+	// cell, as seen by vtgate. An empty cell is the cell of vtgate.
+	GetSrvKeyspace(ctx context.Context, cell, keyspace string) (*topo.SrvKeyspace, error)
 }
 
 // VTGateTx defines the interface for the transaction object created by Begin.
@@ -75,10 +197,25 @@ type VTGateTx interface {
 	Execute(ctx context.Context, query string, bindVars map[string]interface{}, tabletType topo.TabletType) (*mproto.QueryResult, error)
 	// ExecuteShard executes a query for multiple shards on vtgate within the current transaction.
 	ExecuteShard(ctx context.Context, query string, keyspace string, shards []string, bindVars map[string]interface{}, tabletType topo.TabletType) (*mproto.QueryResult, error)
-
-	// Commit commits the current transaction.
+	// ExecuteKeyRanges executes a query for the key ranges on vtgate within the current transaction.
+	ExecuteKeyRanges(ctx context.Context, query string, keyspace string, keyRanges []key.KeyRange, bindVars map[string]interface{}, tabletType topo.TabletType) (*mproto.QueryResult, error)
+	// ExecuteEntityIds executes a query for the entity ids on vtgate within the current transaction.
+	ExecuteEntityIds(ctx context.Context, query string, keyspace string, entityColumnName string, entityKeyspaceIDs []proto.EntityId, bindVars map[string]interface{}, tabletType topo.TabletType) (*mproto.QueryResult, error)
+	// ExecuteBatchShard executes a batch of queries on vtgate within
+	// the current transaction. The queries of a shard share its
+	// transaction.
+	ExecuteBatchShard(ctx context.Context, queries []proto.BoundShardQuery, tabletType topo.TabletType) ([]mproto.QueryResult, error)
+	// ExecuteBatchKeyspaceIds executes a batch of queries for the
+	// keyspace ids on vtgate within the current transaction.
+	ExecuteBatchKeyspaceIds(ctx context.Context, queries []proto.BoundKeyspaceIdQuery, tabletType topo.TabletType) ([]mproto.QueryResult, error)
+
+	// Commit commits the current transaction. If it fails on one
+	// of the shards, the error lists the shards that were committed,
+	// the ones that were rolled back, and the one whose commit state
+	// is unknown.
 	Commit(ctx context.Context) error
-	// Rollback rolls back the current transaction.
+	// Rollback rolls back the current transaction on all its
+	// shards, and returns the errors of the ones that failed.
 	Rollback(ctx context.Context) error
 }
 
@@ -8,6 +8,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/youtube/vitess/go/vt/vterrors"
 	"golang.org/x/net/context"
 )
 
@@ -46,3 +47,33 @@ func TestOperationalError(t *testing.T) {
 		t.Fatal("operational error is not mepty, should not return empty error")
 	}
 }
+
+func TestNewServerError(t *testing.T) {
+	for _, tcase := range []struct {
+		err   string
+		code  int
+		errno int
+	}{
+		{"app error", ERR_NORMAL, 0},
+		{"vttablet: error: Duplicate entry '1' for key 'PRIMARY' (errno 1062) during query: insert into t values (1)", ERR_NORMAL, 1062},
+		{"throttled: too many queries for keyspace ks, tablet type rdonly", ERR_THROTTLED, 0},
+		{"request_backlog: too many requests in flight", ERR_THROTTLED, 0},
+	} {
+		got := NewServerError(tcase.err)
+		if got.Error() != tcase.err || got.Code != tcase.code || got.Errno != tcase.errno {
+			t.Errorf("NewServerError(%q) = %+v, want code %v, errno %v", tcase.err, got, tcase.code, tcase.errno)
+		}
+	}
+}
+
+func TestNewServerErrorWithCode(t *testing.T) {
+	// the code wins over the message
+	got := NewServerErrorWithCode("too many queries", vterrors.ResourceExhausted)
+	if got.Code != ERR_THROTTLED || got.ServerCode != vterrors.ResourceExhausted {
+		t.Errorf("NewServerErrorWithCode(ResourceExhausted) = %+v, want code %v", got, ERR_THROTTLED)
+	}
+	got = NewServerError("throttled: too many queries for keyspace ks, tablet type rdonly")
+	if got.ServerCode != vterrors.ResourceExhausted {
+		t.Errorf("NewServerError(throttled) server code = %v, want %v", got.ServerCode, vterrors.ResourceExhausted)
+	}
+}
@@ -77,6 +77,15 @@ func (f *fakeVTGateService) ExecuteKeyRanges(ctx context.Context, query *proto.K
 	if f.panics {
 		panic(fmt.Errorf("test forced panic"))
 	}
+	execCase, ok := execMap[query.Sql]
+	if !ok {
+		return fmt.Errorf("no match for: %s", query.Sql)
+	}
+	if !reflect.DeepEqual(query, execCase.keyRangeQuery) {
+		f.t.Errorf("ExecuteKeyRanges: %+v, want %+v", query, execCase.keyRangeQuery)
+		return nil
+	}
+	*reply = *execCase.reply
 	return nil
 }
 
@@ -85,6 +94,15 @@ func (f *fakeVTGateService) ExecuteEntityIds(ctx context.Context, query *proto.E
 	if f.panics {
 		panic(fmt.Errorf("test forced panic"))
 	}
+	execCase, ok := execMap[query.Sql]
+	if !ok {
+		return fmt.Errorf("no match for: %s", query.Sql)
+	}
+	if !reflect.DeepEqual(query, execCase.entityIdsQuery) {
+		f.t.Errorf("ExecuteEntityIds: %+v, want %+v", query, execCase.entityIdsQuery)
+		return nil
+	}
+	*reply = *execCase.reply
 	return nil
 }
 
@@ -93,6 +111,11 @@ func (f *fakeVTGateService) ExecuteBatchShard(ctx context.Context, batchQuery *p
 	if f.panics {
 		panic(fmt.Errorf("test forced panic"))
 	}
+	if !reflect.DeepEqual(batchQuery.ShardQueries, batchShardQueries) {
+		f.t.Errorf("ExecuteBatchShard: %+v, want %+v", batchQuery.ShardQueries, batchShardQueries)
+		return nil
+	}
+	*reply = *batchReply
 	return nil
 }
 
@@ -101,6 +124,11 @@ func (f *fakeVTGateService) ExecuteBatchKeyspaceIds(ctx context.Context, batchQu
 	if f.panics {
 		panic(fmt.Errorf("test forced panic"))
 	}
+	if !reflect.DeepEqual(batchQuery.KeyspaceIdQueries, batchKeyspaceIdQueries) {
+		f.t.Errorf("ExecuteBatchKeyspaceIds: %+v, want %+v", batchQuery.KeyspaceIdQueries, batchKeyspaceIdQueries)
+		return nil
+	}
+	*reply = *batchReply
 	return nil
 }
 
@@ -117,13 +145,19 @@ func (f *fakeVTGateService) StreamExecute(ctx context.Context, query *proto.Quer
 		f.t.Errorf("Execute: %+v, want %+v", query, execCase.execQuery)
 		return nil
 	}
-	if execCase.reply.Result != nil {
+	return streamReply(execCase.reply, sendReply)
+}
+
+// streamReply sends reply as a stream: the fields first, then one
+// row per result.
+func streamReply(reply *proto.QueryResult, sendReply func(*proto.QueryResult) error) error {
+	if reply.Result != nil {
 		result := proto.QueryResult{Result: &mproto.QueryResult{}}
-		result.Result.Fields = execCase.reply.Result.Fields
+		result.Result.Fields = reply.Result.Fields
 		if err := sendReply(&result); err != nil {
 			return err
 		}
-		for _, row := range execCase.reply.Result.Rows {
+		for _, row := range reply.Result.Rows {
 			result := proto.QueryResult{Result: &mproto.QueryResult{}}
 			result.Result.Rows = [][]sqltypes.Value{row}
 			if err := sendReply(&result); err != nil {
@@ -131,8 +165,8 @@ func (f *fakeVTGateService) StreamExecute(ctx context.Context, query *proto.Quer
 			}
 		}
 	}
-	if execCase.reply.Error != "" {
-		return errors.New(execCase.reply.Error)
+	if reply.Error != "" {
+		return errors.New(reply.Error)
 	}
 	return nil
 }
@@ -142,7 +176,20 @@ func (f *fakeVTGateService) StreamExecuteShard(ctx context.Context, query *proto
 	if f.panics {
 		panic(fmt.Errorf("test forced panic"))
 	}
-	return nil
+	execCase, ok := execMap[query.Sql]
+	if !ok {
+		return fmt.Errorf("no match for: %s", query.Sql)
+	}
+	// the streaming tests all ask for an ordered merge
+	if !query.OrderedMerge {
+		f.t.Errorf("StreamExecuteShard: OrderedMerge is not set")
+	}
+	query.OrderedMerge = false
+	if !reflect.DeepEqual(query, execCase.shardQuery) {
+		f.t.Errorf("StreamExecuteShard: %+v, want %+v", query, execCase.shardQuery)
+		return nil
+	}
+	return streamReply(execCase.reply, sendReply)
 }
 
 // StreamExecuteKeyRanges is part of the VTGateService interface
@@ -150,7 +197,20 @@ func (f *fakeVTGateService) StreamExecuteKeyRanges(ctx context.Context, query *p
 	if f.panics {
 		panic(fmt.Errorf("test forced panic"))
 	}
-	return nil
+	execCase, ok := execMap[query.Sql]
+	if !ok {
+		return fmt.Errorf("no match for: %s", query.Sql)
+	}
+	// the streaming tests all ask for an ordered merge
+	if !query.OrderedMerge {
+		f.t.Errorf("StreamExecuteKeyRanges: OrderedMerge is not set")
+	}
+	query.OrderedMerge = false
+	if !reflect.DeepEqual(query, execCase.keyRangeQuery) {
+		f.t.Errorf("StreamExecuteKeyRanges: %+v, want %+v", query, execCase.keyRangeQuery)
+		return nil
+	}
+	return streamReply(execCase.reply, sendReply)
 }
 
 // StreamExecuteKeyspaceIds is part of the VTGateService interface
@@ -158,7 +218,20 @@ func (f *fakeVTGateService) StreamExecuteKeyspaceIds(ctx context.Context, query
 	if f.panics {
 		panic(fmt.Errorf("test forced panic"))
 	}
-	return nil
+	execCase, ok := execMap[query.Sql]
+	if !ok {
+		return fmt.Errorf("no match for: %s", query.Sql)
+	}
+	// the streaming tests all ask for an ordered merge
+	if !query.OrderedMerge {
+		f.t.Errorf("StreamExecuteKeyspaceIds: OrderedMerge is not set")
+	}
+	query.OrderedMerge = false
+	if !reflect.DeepEqual(query, execCase.keyspaceIdQuery) {
+		f.t.Errorf("StreamExecuteKeyspaceIds: %+v, want %+v", query, execCase.keyspaceIdQuery)
+		return nil
+	}
+	return streamReply(execCase.reply, sendReply)
 }
 
 // Begin is part of the VTGateService interface
@@ -204,6 +277,42 @@ func (f *fakeVTGateService) SplitQuery(ctx context.Context, req *proto.SplitQuer
 	return nil
 }
 
+// GetKeyspaceIdResolver is part of the VTGateService interface
+func (f *fakeVTGateService) GetKeyspaceIdResolver(ctx context.Context, req *proto.GetKeyspaceIdResolverRequest, reply *proto.GetKeyspaceIdResolverResult) error {
+	if f.panics {
+		panic(fmt.Errorf("test forced panic"))
+	}
+	if req.Keyspace != "ks" {
+		return fmt.Errorf("unknown keyspace %v", req.Keyspace)
+	}
+	*reply = *keyspaceIdResolverResult
+	return nil
+}
+
+// Explain is part of the VTGateService interface
+func (f *fakeVTGateService) Explain(ctx context.Context, query *proto.Query, reply *proto.ExplainResult) error {
+	if f.panics {
+		panic(fmt.Errorf("test forced panic"))
+	}
+	if query.Sql != explainQuery {
+		return fmt.Errorf("no plan for %v", query.Sql)
+	}
+	*reply = *explainResult
+	return nil
+}
+
+// GetSrvKeyspace is part of the VTGateService interface
+func (f *fakeVTGateService) GetSrvKeyspace(ctx context.Context, req *proto.GetSrvKeyspaceRequest, reply *topo.SrvKeyspace) error {
+	if f.panics {
+		panic(fmt.Errorf("test forced panic"))
+	}
+	if req.Cell != "aa" || req.Keyspace != "ks" {
+		return fmt.Errorf("unknown keyspace %v in cell %v", req.Keyspace, req.Cell)
+	}
+	*reply = *srvKeyspace
+	return nil
+}
+
 // CreateFakeServer returns the fake server for the tests
 func CreateFakeServer(t *testing.T) vtgateservice.VTGateService {
 	return &fakeVTGateService{
@@ -223,18 +332,37 @@ func (f *fakeVTGateService) HandlePanic(err *error) {
 func TestSuite(t *testing.T, conn vtgateconn.VTGateConn, fakeServer vtgateservice.VTGateService) {
 	testExecute(t, conn)
 	testExecuteShard(t, conn)
+	testExecuteKeyRanges(t, conn)
+	testExecuteEntityIds(t, conn)
+	testExecuteRouting(t, conn)
+	testExecuteBatchShard(t, conn)
+	testExecuteBatchKeyspaceIds(t, conn)
 	testStreamExecute(t, conn)
+	testStreamExecuteShard(t, conn)
+	testStreamExecuteKeyRanges(t, conn)
+	testStreamExecuteKeyspaceIds(t, conn)
 	testTxPass(t, conn)
 	testTxFail(t, conn)
 	testSplitQuery(t, conn)
+	testGetKeyspaceIdResolver(t, conn)
+	testExplain(t, conn)
+	testGetSrvKeyspace(t, conn)
 
 	// force a panic at every call, then test that works
 	fakeServer.(*fakeVTGateService).panics = true
 	testExecutePanic(t, conn)
 	testExecuteShardPanic(t, conn)
+	testExecuteKeyRangesPanic(t, conn)
+	testExecuteEntityIdsPanic(t, conn)
+	testExecuteBatchShardPanic(t, conn)
+	testExecuteBatchKeyspaceIdsPanic(t, conn)
 	testStreamExecutePanic(t, conn)
+	testStreamExecuteShardPanic(t, conn)
 	testBeginPanic(t, conn)
 	testSplitQueryPanic(t, conn)
+	testGetKeyspaceIdResolverPanic(t, conn)
+	testExplainPanic(t, conn)
+	testGetSrvKeyspacePanic(t, conn)
 }
 
 func expectPanic(t *testing.T, err error) {
@@ -267,6 +395,9 @@ func testExecute(t *testing.T, conn vtgateconn.VTGateConn) {
 	if err == nil || err.Error() != want {
 		t.Errorf("errorRequst: %v, want %v", err, want)
 	}
+	if serverError, ok := err.(*vtgateconn.ServerError); !ok || serverError.Code != vtgateconn.ERR_NORMAL {
+		t.Errorf("errorRequst: got %#v, want a vtgateconn.ServerError with code ERR_NORMAL", err)
+	}
 }
 
 func testExecutePanic(t *testing.T, conn vtgateconn.VTGateConn) {
@@ -307,6 +438,126 @@ func testExecuteShardPanic(t *testing.T, conn vtgateconn.VTGateConn) {
 	expectPanic(t, err)
 }
 
+func testExecuteKeyRanges(t *testing.T, conn vtgateconn.VTGateConn) {
+	ctx := context.Background()
+	execCase := execMap["request1"]
+	qr, err := conn.ExecuteKeyRanges(ctx, execCase.keyRangeQuery.Sql, execCase.keyRangeQuery.Keyspace, execCase.keyRangeQuery.KeyRanges, execCase.keyRangeQuery.BindVariables, execCase.keyRangeQuery.TabletType)
+	if err != nil {
+		t.Error(err)
+	}
+	if !reflect.DeepEqual(qr, execCase.reply.Result) {
+		t.Errorf("Unexpected result from ExecuteKeyRanges: got %+v want %+v", qr, execCase.reply.Result)
+	}
+
+	_, err = conn.ExecuteKeyRanges(ctx, "none", "", []key.KeyRange{}, nil, "")
+	want := "no match for: none"
+	if err == nil || !strings.Contains(err.Error(), want) {
+		t.Errorf("none request: %v, want %v", err, want)
+	}
+
+	_, err = conn.ExecuteKeyRanges(ctx, "errorRequst", "", []key.KeyRange{}, nil, "")
+	want = "app error"
+	if err == nil || err.Error() != want {
+		t.Errorf("errorRequst: %v, want %v", err, want)
+	}
+}
+
+func testExecuteKeyRangesPanic(t *testing.T, conn vtgateconn.VTGateConn) {
+	ctx := context.Background()
+	execCase := execMap["request1"]
+	_, err := conn.ExecuteKeyRanges(ctx, execCase.keyRangeQuery.Sql, execCase.keyRangeQuery.Keyspace, execCase.keyRangeQuery.KeyRanges, execCase.keyRangeQuery.BindVariables, execCase.keyRangeQuery.TabletType)
+	expectPanic(t, err)
+}
+
+func testExecuteEntityIds(t *testing.T, conn vtgateconn.VTGateConn) {
+	ctx := context.Background()
+	execCase := execMap["request1"]
+	qr, err := conn.ExecuteEntityIds(ctx, execCase.entityIdsQuery.Sql, execCase.entityIdsQuery.Keyspace, execCase.entityIdsQuery.EntityColumnName, execCase.entityIdsQuery.EntityKeyspaceIDs, execCase.entityIdsQuery.BindVariables, execCase.entityIdsQuery.TabletType)
+	if err != nil {
+		t.Error(err)
+	}
+	if !reflect.DeepEqual(qr, execCase.reply.Result) {
+		t.Errorf("Unexpected result from ExecuteEntityIds: got %+v want %+v", qr, execCase.reply.Result)
+	}
+
+	_, err = conn.ExecuteEntityIds(ctx, "none", "", "", []proto.EntityId{}, nil, "")
+	want := "no match for: none"
+	if err == nil || !strings.Contains(err.Error(), want) {
+		t.Errorf("none request: %v, want %v", err, want)
+	}
+
+	_, err = conn.ExecuteEntityIds(ctx, "errorRequst", "", "", []proto.EntityId{}, nil, "")
+	want = "app error"
+	if err == nil || err.Error() != want {
+		t.Errorf("errorRequst: %v, want %v", err, want)
+	}
+}
+
+func testExecuteRouting(t *testing.T, conn vtgateconn.VTGateConn) {
+	execCase := execMap["routedRequest"]
+	routing := &vtgateconn.Routing{
+		Policy:              proto.RoutingPreferType,
+		AllowMasterFallback: true,
+	}
+	ctx := vtgateconn.WithRouting(context.Background(), routing)
+	qr, err := conn.ExecuteShard(ctx, execCase.shardQuery.Sql, "ks", []string{"1"}, execCase.shardQuery.BindVariables, execCase.shardQuery.TabletType)
+	if err != nil {
+		t.Error(err)
+	}
+	if !reflect.DeepEqual(qr, execCase.reply.Result) {
+		t.Errorf("Unexpected result from ExecuteShard: got %+v want %+v", qr, execCase.reply.Result)
+	}
+	if routing.TabletType != execCase.reply.TabletType {
+		t.Errorf("routed tablet type: %v, want %v", routing.TabletType, execCase.reply.TabletType)
+	}
+}
+
+func testExecuteEntityIdsPanic(t *testing.T, conn vtgateconn.VTGateConn) {
+	ctx := context.Background()
+	execCase := execMap["request1"]
+	_, err := conn.ExecuteEntityIds(ctx, execCase.entityIdsQuery.Sql, execCase.entityIdsQuery.Keyspace, execCase.entityIdsQuery.EntityColumnName, execCase.entityIdsQuery.EntityKeyspaceIDs, execCase.entityIdsQuery.BindVariables, execCase.entityIdsQuery.TabletType)
+	expectPanic(t, err)
+}
+
+func checkBatch(t *testing.T, name string, qrs []mproto.QueryResult, err error) {
+	if len(qrs) != 2 {
+		t.Fatalf("%v: got %v results, want 2", name, len(qrs))
+	}
+	if !reflect.DeepEqual(qrs[0], result1) {
+		t.Errorf("Unexpected result from %v: got %+v want %+v", name, qrs[0], result1)
+	}
+	if len(qrs[1].Rows) != 0 || qrs[1].RowsAffected != 0 {
+		t.Errorf("Unexpected result from %v for a failed query: got %+v want empty", name, qrs[1])
+	}
+	batchErr, ok := err.(*vtgateconn.BatchError)
+	if !ok {
+		t.Fatalf("%v: got %v, want a *vtgateconn.BatchError", name, err)
+	}
+	if len(batchErr.Errors) != 2 || batchErr.Errors[0] != nil || batchErr.Errors[1] == nil || batchErr.Errors[1].Error() != batchReply.Errors[1] {
+		t.Errorf("%v: got errors %v, want [<nil> %v]", name, batchErr.Errors, batchReply.Errors[1])
+	}
+}
+
+func testExecuteBatchShard(t *testing.T, conn vtgateconn.VTGateConn) {
+	qrs, err := conn.ExecuteBatchShard(context.Background(), batchShardQueries, topo.TYPE_MASTER)
+	checkBatch(t, "ExecuteBatchShard", qrs, err)
+}
+
+func testExecuteBatchShardPanic(t *testing.T, conn vtgateconn.VTGateConn) {
+	_, err := conn.ExecuteBatchShard(context.Background(), batchShardQueries, topo.TYPE_MASTER)
+	expectPanic(t, err)
+}
+
+func testExecuteBatchKeyspaceIds(t *testing.T, conn vtgateconn.VTGateConn) {
+	qrs, err := conn.ExecuteBatchKeyspaceIds(context.Background(), batchKeyspaceIdQueries, topo.TYPE_MASTER)
+	checkBatch(t, "ExecuteBatchKeyspaceIds", qrs, err)
+}
+
+func testExecuteBatchKeyspaceIdsPanic(t *testing.T, conn vtgateconn.VTGateConn) {
+	_, err := conn.ExecuteBatchKeyspaceIds(context.Background(), batchKeyspaceIdQueries, topo.TYPE_MASTER)
+	expectPanic(t, err)
+}
+
 func testStreamExecute(t *testing.T, conn vtgateconn.VTGateConn) {
 	ctx := context.Background()
 	execCase := execMap["request1"]
@@ -363,6 +614,92 @@ func testStreamExecutePanic(t *testing.T, conn vtgateconn.VTGateConn) {
 	expectPanic(t, err)
 }
 
+// readStream reads a whole stream into one result.
+func readStream(packets <-chan *mproto.QueryResult, errFunc vtgateconn.ErrFunc) (*mproto.QueryResult, error) {
+	qr := &mproto.QueryResult{}
+	for packet := range packets {
+		if len(packet.Fields) != 0 {
+			qr.Fields = packet.Fields
+		}
+		if len(packet.Rows) != 0 {
+			qr.Rows = append(qr.Rows, packet.Rows...)
+		}
+	}
+	return qr, errFunc()
+}
+
+// checkStream checks the result of a stream of the request1 case,
+// and the errors of the none and errorRequst cases.
+func checkStream(t *testing.T, name string, execute func(sql string) (<-chan *mproto.QueryResult, vtgateconn.ErrFunc)) {
+	execCase := execMap["request1"]
+	qr, err := readStream(execute(execCase.execQuery.Sql))
+	if err != nil {
+		t.Errorf("%v: %v", name, err)
+	}
+	wantResult := *execCase.reply.Result
+	wantResult.RowsAffected = 0
+	wantResult.InsertId = 0
+	if !reflect.DeepEqual(*qr, wantResult) {
+		t.Errorf("Unexpected result from %v: got %+v want %+v", name, qr, wantResult)
+	}
+
+	_, err = readStream(execute("none"))
+	want := "no match for: none"
+	if err == nil || !strings.Contains(err.Error(), want) {
+		t.Errorf("none request: %v, want %v", err, want)
+	}
+
+	_, err = readStream(execute("errorRequst"))
+	want = "app error"
+	if err == nil || !strings.Contains(err.Error(), want) {
+		t.Errorf("errorRequst: %v, want %v", err, want)
+	}
+}
+
+func testStreamExecuteShard(t *testing.T, conn vtgateconn.VTGateConn) {
+	ctx := context.Background()
+	checkStream(t, "StreamExecuteShard", func(sql string) (<-chan *mproto.QueryResult, vtgateconn.ErrFunc) {
+		q := execMap["errorRequst"].shardQuery
+		if sql == "request1" {
+			q = execMap["request1"].shardQuery
+		}
+		return conn.StreamExecuteShard(ctx, sql, q.Keyspace, q.Shards, q.BindVariables, q.TabletType, true)
+	})
+}
+
+func testStreamExecuteShardPanic(t *testing.T, conn vtgateconn.VTGateConn) {
+	ctx := context.Background()
+	q := execMap["request1"].shardQuery
+	packets, errFunc := conn.StreamExecuteShard(ctx, q.Sql, q.Keyspace, q.Shards, q.BindVariables, q.TabletType, true)
+	if _, ok := <-packets; ok {
+		t.Fatalf("Received packets instead of panic?")
+	}
+	err := errFunc()
+	expectPanic(t, err)
+}
+
+func testStreamExecuteKeyRanges(t *testing.T, conn vtgateconn.VTGateConn) {
+	ctx := context.Background()
+	checkStream(t, "StreamExecuteKeyRanges", func(sql string) (<-chan *mproto.QueryResult, vtgateconn.ErrFunc) {
+		q := execMap["errorRequst"].keyRangeQuery
+		if sql == "request1" {
+			q = execMap["request1"].keyRangeQuery
+		}
+		return conn.StreamExecuteKeyRanges(ctx, sql, q.Keyspace, q.KeyRanges, q.BindVariables, q.TabletType, true)
+	})
+}
+
+func testStreamExecuteKeyspaceIds(t *testing.T, conn vtgateconn.VTGateConn) {
+	ctx := context.Background()
+	checkStream(t, "StreamExecuteKeyspaceIds", func(sql string) (<-chan *mproto.QueryResult, vtgateconn.ErrFunc) {
+		q := execMap["errorRequst"].keyspaceIdQuery
+		if sql == "request1" {
+			q = execMap["request1"].keyspaceIdQuery
+		}
+		return conn.StreamExecuteKeyspaceIds(ctx, sql, q.Keyspace, q.KeyspaceIds, q.BindVariables, q.TabletType, true)
+	})
+}
+
 func testTxPass(t *testing.T, conn vtgateconn.VTGateConn) {
 	ctx := context.Background()
 	tx, err := conn.Begin(ctx)
@@ -392,6 +729,32 @@ func testTxPass(t *testing.T, conn vtgateconn.VTGateConn) {
 	if err != nil {
 		t.Error(err)
 	}
+
+	tx, err = conn.Begin(ctx)
+	if err != nil {
+		t.Error(err)
+	}
+	_, err = tx.ExecuteKeyRanges(ctx, execCase.keyRangeQuery.Sql, execCase.keyRangeQuery.Keyspace, execCase.keyRangeQuery.KeyRanges, execCase.keyRangeQuery.BindVariables, execCase.keyRangeQuery.TabletType)
+	if err != nil {
+		t.Error(err)
+	}
+	err = tx.Commit(ctx)
+	if err != nil {
+		t.Error(err)
+	}
+
+	tx, err = conn.Begin(ctx)
+	if err != nil {
+		t.Error(err)
+	}
+	_, err = tx.ExecuteEntityIds(ctx, execCase.entityIdsQuery.Sql, execCase.entityIdsQuery.Keyspace, execCase.entityIdsQuery.EntityColumnName, execCase.entityIdsQuery.EntityKeyspaceIDs, execCase.entityIdsQuery.BindVariables, execCase.entityIdsQuery.TabletType)
+	if err != nil {
+		t.Error(err)
+	}
+	err = tx.Rollback(ctx)
+	if err != nil {
+		t.Error(err)
+	}
 }
 
 func testBeginPanic(t *testing.T, conn vtgateconn.VTGateConn) {
@@ -424,6 +787,18 @@ func testTxFail(t *testing.T, conn vtgateconn.VTGateConn) {
 		t.Errorf("ExecuteShard: %v, want %v", err, want)
 	}
 
+	_, err = tx.ExecuteKeyRanges(ctx, "", "", nil, nil, "")
+	want = "executeKeyRanges: not in transaction"
+	if err == nil || err.Error() != want {
+		t.Errorf("ExecuteKeyRanges: %v, want %v", err, want)
+	}
+
+	_, err = tx.ExecuteEntityIds(ctx, "", "", "", nil, nil, "")
+	want = "executeEntityIds: not in transaction"
+	if err == nil || err.Error() != want {
+		t.Errorf("ExecuteEntityIds: %v, want %v", err, want)
+	}
+
 	err = tx.Commit(ctx)
 	want = "commit: not in transaction"
 	if err == nil || err.Error() != want {
@@ -448,7 +823,7 @@ func testTxFail(t *testing.T, conn vtgateconn.VTGateConn) {
 
 func testSplitQuery(t *testing.T, conn vtgateconn.VTGateConn) {
 	ctx := context.Background()
-	qsl, err := conn.SplitQuery(ctx, splitQueryRequest.Keyspace, splitQueryRequest.Query, splitQueryRequest.SplitCount)
+	qsl, err := conn.SplitQuery(ctx, splitQueryRequest.Keyspace, splitQueryRequest.Query, splitQueryRequest.SplitColumn, splitQueryRequest.SplitCount)
 	if err != nil {
 		t.Fatalf("SplitQuery failed: %v", err)
 	}
@@ -459,15 +834,86 @@ func testSplitQuery(t *testing.T, conn vtgateconn.VTGateConn) {
 
 func testSplitQueryPanic(t *testing.T, conn vtgateconn.VTGateConn) {
 	ctx := context.Background()
-	_, err := conn.SplitQuery(ctx, splitQueryRequest.Keyspace, splitQueryRequest.Query, splitQueryRequest.SplitCount)
+	_, err := conn.SplitQuery(ctx, splitQueryRequest.Keyspace, splitQueryRequest.Query, splitQueryRequest.SplitColumn, splitQueryRequest.SplitCount)
+	expectPanic(t, err)
+}
+
+func testGetKeyspaceIdResolver(t *testing.T, conn vtgateconn.VTGateConn) {
+	ctx := context.Background()
+	resolver, err := conn.GetKeyspaceIdResolver(ctx, "ks")
+	if err != nil {
+		t.Fatalf("GetKeyspaceIdResolver failed: %v", err)
+	}
+	want := &vtgateconn.KeyspaceIdResolver{
+		Keyspace:           "ks",
+		ShardingColumnName: keyspaceIdResolverResult.ShardingColumnName,
+		ShardingColumnType: keyspaceIdResolverResult.ShardingColumnType,
+	}
+	if !reflect.DeepEqual(resolver, want) {
+		t.Errorf("GetKeyspaceIdResolver returned wrong result: got %+v wanted %+v", resolver, want)
+	}
+	_, err = conn.GetKeyspaceIdResolver(ctx, "unknown")
+	if err == nil || !strings.Contains(err.Error(), "unknown keyspace unknown") {
+		t.Errorf("GetKeyspaceIdResolver(unknown): %v", err)
+	}
+}
+
+func testGetKeyspaceIdResolverPanic(t *testing.T, conn vtgateconn.VTGateConn) {
+	ctx := context.Background()
+	_, err := conn.GetKeyspaceIdResolver(ctx, "ks")
+	expectPanic(t, err)
+}
+
+func testExplain(t *testing.T, conn vtgateconn.VTGateConn) {
+	ctx := context.Background()
+	result, err := conn.Explain(ctx, explainQuery, nil, topo.TYPE_MASTER)
+	if err != nil {
+		t.Fatalf("Explain failed: %v", err)
+	}
+	if !reflect.DeepEqual(result, explainResult) {
+		t.Errorf("Explain returned wrong result: got %+v wanted %+v", result, explainResult)
+	}
+	_, err = conn.Explain(ctx, "select * from unknown", nil, topo.TYPE_MASTER)
+	if err == nil || !strings.Contains(err.Error(), "no plan for select * from unknown") {
+		t.Errorf("Explain(unknown): %v", err)
+	}
+}
+
+func testExplainPanic(t *testing.T, conn vtgateconn.VTGateConn) {
+	ctx := context.Background()
+	_, err := conn.Explain(ctx, explainQuery, nil, topo.TYPE_MASTER)
+	expectPanic(t, err)
+}
+
+func testGetSrvKeyspace(t *testing.T, conn vtgateconn.VTGateConn) {
+	ctx := context.Background()
+	ks, err := conn.GetSrvKeyspace(ctx, "aa", "ks")
+	if err != nil {
+		t.Fatalf("GetSrvKeyspace failed: %v", err)
+	}
+	if !reflect.DeepEqual(ks, srvKeyspace) {
+		t.Errorf("GetSrvKeyspace returned wrong result: got %+v wanted %+v", ks, srvKeyspace)
+	}
+	_, err = conn.GetSrvKeyspace(ctx, "aa", "unknown")
+	if err == nil || !strings.Contains(err.Error(), "unknown keyspace unknown in cell aa") {
+		t.Errorf("GetSrvKeyspace(unknown): %v", err)
+	}
+}
+
+func testGetSrvKeyspacePanic(t *testing.T, conn vtgateconn.VTGateConn) {
+	ctx := context.Background()
+	_, err := conn.GetSrvKeyspace(ctx, "aa", "ks")
 	expectPanic(t, err)
 }
 
 var execMap = map[string]struct {
-	execQuery  *proto.Query
-	shardQuery *proto.QueryShard
-	reply      *proto.QueryResult
-	err        error
+	execQuery       *proto.Query
+	shardQuery      *proto.QueryShard
+	keyRangeQuery   *proto.KeyRangeQuery
+	keyspaceIdQuery *proto.KeyspaceIdQuery
+	entityIdsQuery  *proto.EntityIdsQuery
+	reply           *proto.QueryResult
+	err             error
 }{
 	"request1": {
 		execQuery: &proto.Query{
@@ -488,6 +934,49 @@ var execMap = map[string]struct {
 			TabletType: topo.TYPE_RDONLY,
 			Session:    nil,
 		},
+		keyRangeQuery: &proto.KeyRangeQuery{
+			Sql: "request1",
+			BindVariables: map[string]interface{}{
+				"bind1": int64(0),
+			},
+			Keyspace: "ks",
+			KeyRanges: []key.KeyRange{
+				key.KeyRange{
+					Start: key.KeyspaceId("s"),
+					End:   key.KeyspaceId("e"),
+				},
+			},
+			TabletType: topo.TYPE_RDONLY,
+			Session:    nil,
+		},
+		keyspaceIdQuery: &proto.KeyspaceIdQuery{
+			Sql: "request1",
+			BindVariables: map[string]interface{}{
+				"bind1": int64(0),
+			},
+			Keyspace: "ks",
+			KeyspaceIds: []key.KeyspaceId{
+				key.KeyspaceId("a"),
+			},
+			TabletType: topo.TYPE_RDONLY,
+			Session:    nil,
+		},
+		entityIdsQuery: &proto.EntityIdsQuery{
+			Sql: "request1",
+			BindVariables: map[string]interface{}{
+				"bind1": int64(0),
+			},
+			Keyspace:         "ks",
+			EntityColumnName: "column",
+			EntityKeyspaceIDs: []proto.EntityId{
+				proto.EntityId{
+					ExternalID: []byte{105, 100, 49},
+					KeyspaceID: key.KeyspaceId("k"),
+				},
+			},
+			TabletType: topo.TYPE_RDONLY,
+			Session:    nil,
+		},
 		reply: &proto.QueryResult{
 			Result:  &result1,
 			Session: nil,
@@ -509,12 +998,54 @@ var execMap = map[string]struct {
 			Shards:        []string{},
 			Session:       nil,
 		},
+		keyRangeQuery: &proto.KeyRangeQuery{
+			Sql:           "errorRequst",
+			BindVariables: map[string]interface{}{},
+			TabletType:    "",
+			Keyspace:      "",
+			KeyRanges:     []key.KeyRange{},
+			Session:       nil,
+		},
+		keyspaceIdQuery: &proto.KeyspaceIdQuery{
+			Sql:           "errorRequst",
+			BindVariables: map[string]interface{}{},
+			TabletType:    "",
+			Keyspace:      "",
+			KeyspaceIds:   []key.KeyspaceId{},
+			Session:       nil,
+		},
+		entityIdsQuery: &proto.EntityIdsQuery{
+			Sql:               "errorRequst",
+			BindVariables:     map[string]interface{}{},
+			TabletType:        "",
+			Keyspace:          "",
+			EntityColumnName:  "",
+			EntityKeyspaceIDs: []proto.EntityId{},
+			Session:           nil,
+		},
 		reply: &proto.QueryResult{
 			Result:  nil,
 			Session: nil,
 			Error:   "app error",
 		},
 	},
+	"routedRequest": {
+		shardQuery: &proto.QueryShard{
+			Sql: "routedRequest",
+			BindVariables: map[string]interface{}{
+				"bind1": int64(0),
+			},
+			Keyspace:            "ks",
+			Shards:              []string{"1"},
+			TabletType:          topo.TYPE_REPLICA,
+			RoutingPolicy:       proto.RoutingPreferType,
+			AllowMasterFallback: true,
+		},
+		reply: &proto.QueryResult{
+			Result:     &result1,
+			TabletType: topo.TYPE_RDONLY,
+		},
+	},
 	"txRequest": {
 		execQuery: &proto.Query{
 			Sql:           "txRequest",
@@ -530,6 +1061,23 @@ var execMap = map[string]struct {
 			Shards:        []string{},
 			Session:       session1,
 		},
+		keyRangeQuery: &proto.KeyRangeQuery{
+			Sql:           "txRequest",
+			BindVariables: map[string]interface{}{},
+			TabletType:    "",
+			Keyspace:      "",
+			KeyRanges:     []key.KeyRange{},
+			Session:       session1,
+		},
+		entityIdsQuery: &proto.EntityIdsQuery{
+			Sql:               "txRequest",
+			BindVariables:     map[string]interface{}{},
+			TabletType:        "",
+			Keyspace:          "",
+			EntityColumnName:  "",
+			EntityKeyspaceIDs: []proto.EntityId{},
+			Session:           session1,
+		},
 		reply: &proto.QueryResult{
 			Result:  nil,
 			Session: session2,
@@ -563,6 +1111,36 @@ var result1 = mproto.QueryResult{
 	},
 }
 
+var batchShardQueries = []proto.BoundShardQuery{{
+	Sql:           "batch query1",
+	BindVariables: map[string]interface{}{"bind1": int64(0)},
+	Keyspace:      "ks",
+	Shards:        []string{"1"},
+}, {
+	Sql:           "batch query2",
+	BindVariables: map[string]interface{}{"bind1": int64(1)},
+	Keyspace:      "ks",
+	Shards:        []string{"1", "2"},
+}}
+
+var batchKeyspaceIdQueries = []proto.BoundKeyspaceIdQuery{{
+	Sql:           "batch query1",
+	BindVariables: map[string]interface{}{"bind1": int64(0)},
+	Keyspace:      "ks",
+	KeyspaceIds:   []key.KeyspaceId{key.KeyspaceId("a")},
+}, {
+	Sql:           "batch query2",
+	BindVariables: map[string]interface{}{"bind1": int64(1)},
+	Keyspace:      "ks",
+	KeyspaceIds:   []key.KeyspaceId{key.KeyspaceId("b")},
+}}
+
+// batchReply is the reply to the batches: the second query fails.
+var batchReply = &proto.QueryResultList{
+	List:   []mproto.QueryResult{result1, {}},
+	Errors: []string{"", "batch query2 failed"},
+}
+
 var session1 = &proto.Session{
 	InTransaction: true,
 	ShardSessions: []*proto.ShardSession{},
@@ -588,7 +1166,8 @@ var splitQueryRequest = &proto.SplitQueryRequest{
 			"bind1": int64(43),
 		},
 	},
-	SplitCount: 13,
+	SplitColumn: "split_column",
+	SplitCount:  13,
 }
 
 var splitQueryResult = &proto.SplitQueryResult{
@@ -607,3 +1186,36 @@ var splitQueryResult = &proto.SplitQueryResult{
 		},
 	},
 }
+
+var keyspaceIdResolverResult = &proto.GetKeyspaceIdResolverResult{
+	ShardingColumnName: "user_id",
+	ShardingColumnType: key.KIT_UINT64,
+}
+
+const explainQuery = "select * from user where id = 1"
+
+var explainResult = &proto.ExplainResult{
+	PlanID:   "SelectEqual",
+	Table:    "user",
+	Keyspace: "user",
+	Shards:   []string{"-20"},
+	Query:    "select * from user where id = :_id",
+}
+
+var srvKeyspace = &topo.SrvKeyspace{
+	Partitions: map[topo.TabletType]*topo.KeyspacePartition{
+		topo.TYPE_MASTER: &topo.KeyspacePartition{
+			ShardReferences: []topo.ShardReference{{
+				Name:     "-80",
+				KeyRange: key.KeyRange{End: "\x80"},
+			}, {
+				Name:     "80-",
+				KeyRange: key.KeyRange{Start: "\x80"},
+			}},
+		},
+	},
+	ShardingColumnName: "user_id",
+	ShardingColumnType: key.KIT_UINT64,
+	ServedFrom:         map[topo.TabletType]string{},
+	SplitShardCount:    2,
+}
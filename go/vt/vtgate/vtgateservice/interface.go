@@ -7,6 +7,7 @@
 package vtgateservice
 
 import (
+	"github.com/youtube/vitess/go/vt/topo"
 	"github.com/youtube/vitess/go/vt/vtgate/proto"
 	"golang.org/x/net/context"
 )
@@ -37,6 +38,15 @@ type VTGateService interface {
 	// Map Reduce support
 	SplitQuery(ctx context.Context, req *proto.SplitQueryRequest, reply *proto.SplitQueryResult) error
 
+	// Explain returns the routing decision for a query
+	Explain(ctx context.Context, query *proto.Query, reply *proto.ExplainResult) error
+
+	// Client side sharding support
+	GetKeyspaceIdResolver(ctx context.Context, req *proto.GetKeyspaceIdResolverRequest, reply *proto.GetKeyspaceIdResolverResult) error
+
+	// Serving graph introspection
+	GetSrvKeyspace(ctx context.Context, req *proto.GetSrvKeyspaceRequest, reply *topo.SrvKeyspace) error
+
 	// HandlePanic should be called with defer at the beginning of each
 	// RPC implementation method, before calling any of the previous methods
 	HandlePanic(err *error)
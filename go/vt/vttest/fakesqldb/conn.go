@@ -32,7 +32,7 @@ type Conn struct {
 type DB struct {
 	isConnFail   bool
 	data         map[string]*proto.QueryResult
-	rejectedData map[string]*proto.QueryResult
+	rejectedData map[string]error
 	queryCalled  map[string]int
 	mu           sync.Mutex
 }
@@ -71,7 +71,23 @@ func (db *DB) DeleteQuery(query string) {
 func (db *DB) AddRejectedQuery(query string) {
 	db.mu.Lock()
 	defer db.mu.Unlock()
-	db.rejectedData[strings.ToLower(query)] = &proto.QueryResult{}
+	db.rejectedData[strings.ToLower(query)] = fmt.Errorf("unsupported query, reject query: %s", query)
+}
+
+// AddRejectedQueryError adds a query which will fail with err at execution
+// time, for instance a *sqldb.SqlError with a specific number.
+func (db *DB) AddRejectedQueryError(query string, err error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.rejectedData[strings.ToLower(query)] = err
+}
+
+// rejectedQueryError returns the error of a rejected query, nil if the
+// query is not rejected.
+func (db *DB) rejectedQueryError(query string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.rejectedData[strings.ToLower(query)]
 }
 
 // HasRejectedQuery returns true if this query will be rejected.
@@ -139,8 +155,8 @@ func (conn *Conn) ExecuteFetch(query string, maxrows int, wantfields bool) (*pro
 	if conn.IsClosed() {
 		return nil, fmt.Errorf("connection is closed")
 	}
-	if conn.db.HasRejectedQuery(query) {
-		return nil, fmt.Errorf("unsupported query, reject query: %s", query)
+	if err := conn.db.rejectedQueryError(query); err != nil {
+		return nil, err
 	}
 	result, ok := conn.db.GetQuery(query)
 	if !ok {
@@ -206,8 +222,8 @@ func (conn *Conn) ExecuteStreamFetch(query string) error {
 	if conn.IsClosed() {
 		return fmt.Errorf("connection is closed")
 	}
-	if conn.db.HasRejectedQuery(query) {
-		return fmt.Errorf("unsupported query, reject query: %s", query)
+	if err := conn.db.rejectedQueryError(query); err != nil {
+		return err
 	}
 	result, ok := conn.db.GetQuery(query)
 	if !ok {
@@ -286,7 +302,7 @@ func Register() *DB {
 	name := fmt.Sprintf("fake-%d", rand.Int63())
 	db := &DB{
 		data:         make(map[string]*proto.QueryResult),
-		rejectedData: make(map[string]*proto.QueryResult),
+		rejectedData: make(map[string]error),
 		queryCalled:  make(map[string]int),
 	}
 	sqldb.Register(name, func(sqldb.ConnParams) (sqldb.Conn, error) {
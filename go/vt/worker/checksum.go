@@ -0,0 +1,495 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package worker
+
+import (
+	"fmt"
+	"html/template"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/context"
+
+	"github.com/youtube/vitess/go/vt/key"
+	myproto "github.com/youtube/vitess/go/vt/mysqlctl/proto"
+	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/vt/wrangler"
+)
+
+// The checksum of a shard is computed by its master, one chunk of a
+// table at a time, with a statement that writes the checksum of the
+// chunk to _vt.checksum. Since the statement replicates, each replica
+// runs it again on its own data, at the same point of the replication
+// stream as the master did. Once a replica has replicated past the
+// last statement, its _vt.checksum has to be the same as the master's.
+// This only works if the master logs the statements themselves, not
+// the rows they changed.
+
+// checksumMaxRows is the maximum number of chunks we read from
+// _vt.checksum for one shard.
+const checksumMaxRows = 100000
+
+// createChecksumTable returns the statements that create the
+// _vt.checksum table.
+func createChecksumTable() []string {
+	return []string{
+		"CREATE DATABASE IF NOT EXISTS _vt",
+		`CREATE TABLE IF NOT EXISTS _vt.checksum (
+  db_name VARBINARY(250) NOT NULL,
+  table_name VARBINARY(250) NOT NULL,
+  chunk_start VARBINARY(250) NOT NULL,
+  chunk_end VARBINARY(250) NOT NULL,
+  row_count BIGINT UNSIGNED NOT NULL,
+  crc BIGINT UNSIGNED NOT NULL,
+  PRIMARY KEY (db_name, table_name, chunk_start, chunk_end)) ENGINE=InnoDB`,
+	}
+}
+
+// buildChecksumSQLFromChunks returns the statement that writes the
+// number of rows and the checksum of a chunk of a table of the
+// database dbName to _vt.checksum. The checksum is the XOR of the CRC
+// of each row, so it doesn't depend on the order of the rows: since
+// the rows include their primary key, it changes with any of them.
+func buildChecksumSQLFromChunks(dbName string, td *myproto.TableDefinition, chunks []string, chunkIndex int) string {
+	columns := make([]string, len(td.Columns))
+	isNulls := make([]string, len(td.Columns))
+	for i, column := range td.Columns {
+		columns[i] = "`" + column + "`"
+		isNulls[i] = "ISNULL(`" + column + "`)"
+	}
+	// CONCAT_WS skips the NULL values, the ISNULL flags tell them
+	// from empty strings.
+	crc := "CRC32(CONCAT_WS('#', " + strings.Join(columns, ", ") + ", CONCAT(" + strings.Join(isNulls, ", ") + ")))"
+	return fmt.Sprintf("REPLACE INTO _vt.checksum (db_name, table_name, chunk_start, chunk_end, row_count, crc) SELECT '%v', '%v', '%v', '%v', COUNT(*), COALESCE(BIT_XOR(%v), 0) FROM `%v`.%v",
+		dbName, td.Name, chunks[chunkIndex], chunks[chunkIndex+1], crc, dbName, td.Name) +
+		buildWhereClauseFromChunks(td, chunks, chunkIndex, "", key.KIT_UNSET, key.KeyRange{})
+}
+
+// checksumChunk is a chunk of a table in _vt.checksum.
+type checksumChunk struct {
+	table string
+	start string
+	end   string
+}
+
+func (cc checksumChunk) String() string {
+	return fmt.Sprintf("table %v between '%v' and '%v'", cc.table, cc.start, cc.end)
+}
+
+// checksumValue is the number of rows and the checksum of a chunk.
+type checksumValue struct {
+	rowCount string
+	crc      string
+}
+
+// ChecksumWorker checks that the replicas of all the shards of a
+// keyspace have the same data as their master.
+type ChecksumWorker struct {
+	StatusWorker
+
+	wr                   *wrangler.Wrangler
+	keyspace             string
+	tables               []string
+	tabletTypes          []topo.TabletType
+	chunkCount           int
+	minTableSizeForSplit uint64
+	cleaner              *wrangler.Cleaner
+
+	// all subsequent fields are protected by the mutex
+
+	// populated during WorkerStateInit, read-only after that
+	shards []string
+
+	// populated during WorkerStateDiff
+	// shardStatuses has the result of the checksum of each shard
+	shardStatuses []string
+	// mismatches has the chunks of the replicas that differ from
+	// their master
+	mismatches []string
+}
+
+// NewChecksumWorker returns a new ChecksumWorker object. If tables is
+// not empty, only these tables are checked.
+func NewChecksumWorker(wr *wrangler.Wrangler, keyspace string, tables []string, tabletTypes []topo.TabletType, chunkCount int, minTableSizeForSplit uint64) (Worker, error) {
+	if len(tabletTypes) == 0 {
+		return nil, fmt.Errorf("no tablet type to check")
+	}
+	for _, tabletType := range tabletTypes {
+		if !topo.IsSlaveType(tabletType) {
+			return nil, fmt.Errorf("tablet type %v doesn't replicate from the master", tabletType)
+		}
+	}
+	if chunkCount < 1 {
+		return nil, fmt.Errorf("invalid chunk count %v, it has to be at least 1", chunkCount)
+	}
+	return &ChecksumWorker{
+		StatusWorker:         NewStatusWorker(),
+		wr:                   wr,
+		keyspace:             keyspace,
+		tables:               tables,
+		tabletTypes:          tabletTypes,
+		chunkCount:           chunkCount,
+		minTableSizeForSplit: minTableSizeForSplit,
+		cleaner:              &wrangler.Cleaner{},
+	}, nil
+}
+
+// StatusAsHTML is part of the Worker interface
+func (cw *ChecksumWorker) StatusAsHTML() template.HTML {
+	cw.Mu.Lock()
+	defer cw.Mu.Unlock()
+	result := "<b>Working on:</b> " + cw.keyspace + "</br>\n"
+	result += "<b>State:</b> " + cw.State.String() + "</br>\n"
+	switch cw.State {
+	case WorkerStateDiff:
+		result += "<b>Running...</b></br>\n"
+	case WorkerStateDone:
+		result += "<b>Success.</b></br>\n"
+	}
+	for _, status := range cw.shardStatuses {
+		result += template.HTMLEscapeString(status) + "</br>\n"
+	}
+	for _, mismatch := range cw.mismatches {
+		result += "<b>Mismatch:</b> " + template.HTMLEscapeString(mismatch) + "</br>\n"
+	}
+	return template.HTML(result)
+}
+
+// StatusAsText is part of the Worker interface
+func (cw *ChecksumWorker) StatusAsText() string {
+	cw.Mu.Lock()
+	defer cw.Mu.Unlock()
+	result := "Working on: " + cw.keyspace + "\n"
+	result += "State: " + cw.State.String() + "\n"
+	switch cw.State {
+	case WorkerStateDiff:
+		result += "Running...\n"
+	case WorkerStateDone:
+		result += "Success.\n"
+	}
+	for _, status := range cw.shardStatuses {
+		result += status + "\n"
+	}
+	for _, mismatch := range cw.mismatches {
+		result += "Mismatch: " + mismatch + "\n"
+	}
+	return result
+}
+
+// Run is mostly a wrapper to run the cleanup at the end: it restarts
+// the replication of the tablets we stopped.
+func (cw *ChecksumWorker) Run(ctx context.Context) error {
+	resetVars()
+	err := runAndCleanUp(ctx, cw.wr, cw.cleaner, func() { cw.SetState(WorkerStateCleanUp) }, cw.run)
+	if err != nil {
+		cw.SetState(WorkerStateError)
+		return err
+	}
+	cw.SetState(WorkerStateDone)
+	return nil
+}
+
+func (cw *ChecksumWorker) run(ctx context.Context) error {
+	// first state: read what we need to do
+	if err := cw.init(); err != nil {
+		return fmt.Errorf("init() failed: %v", err)
+	}
+	if err := cw.checkInterrupted(ctx); err != nil {
+		return err
+	}
+
+	// second state: checksum each shard
+	cw.SetState(WorkerStateDiff)
+	for i, shard := range cw.shards {
+		if err := cw.checksumShard(ctx, i, shard); err != nil {
+			cw.setShardStatus(i, "checksum failed: %v", err)
+			return fmt.Errorf("checksumShard(%v) failed: %v", shard, err)
+		}
+		if err := cw.checkInterrupted(ctx); err != nil {
+			return err
+		}
+	}
+
+	cw.Mu.Lock()
+	mismatchCount := len(cw.mismatches)
+	cw.Mu.Unlock()
+	if mismatchCount > 0 {
+		return fmt.Errorf("%v chunks of the replicas differ from their master", mismatchCount)
+	}
+	return nil
+}
+
+// init phase:
+// - read the shards of the keyspace
+func (cw *ChecksumWorker) init() error {
+	cw.SetState(WorkerStateInit)
+
+	shards, err := cw.wr.TopoServer().GetShardNames(cw.keyspace)
+	if err != nil {
+		return fmt.Errorf("cannot read the shards of keyspace %v: %v", cw.keyspace, err)
+	}
+	if len(shards) == 0 {
+		return fmt.Errorf("keyspace %v has no shard", cw.keyspace)
+	}
+	sort.Strings(shards)
+
+	cw.Mu.Lock()
+	defer cw.Mu.Unlock()
+	cw.shards = shards
+	cw.shardStatuses = make([]string, len(shards))
+	for i, shard := range shards {
+		cw.shardStatuses[i] = cw.keyspace + "/" + shard + ": checksum not started"
+	}
+	return nil
+}
+
+func (cw *ChecksumWorker) setShardStatus(shardIndex int, format string, args ...interface{}) {
+	cw.Mu.Lock()
+	defer cw.Mu.Unlock()
+	cw.shardStatuses[shardIndex] = cw.keyspace + "/" + cw.shards[shardIndex] + ": " + fmt.Sprintf(format, args...)
+}
+
+func (cw *ChecksumWorker) addMismatch(format string, args ...interface{}) {
+	mismatch := fmt.Sprintf(format, args...)
+	cw.wr.Logger().Errorf("Mismatch: %v", mismatch)
+	cw.Mu.Lock()
+	defer cw.Mu.Unlock()
+	cw.mismatches = append(cw.mismatches, mismatch)
+}
+
+// checksumShard phase, for one shard:
+// - have the master write the checksum of each chunk of its tables to
+// _vt.checksum, and read them
+// - stop each replica once it has replicated all the checksums (add a
+// cleanup task to restart its replication)
+// - read the checksums of the replica, restart its replication, and
+// compare them with the master's (remove the cleanup task that does the
+// same)
+func (cw *ChecksumWorker) checksumShard(ctx context.Context, shardIndex int, shard string) error {
+	si, err := cw.wr.TopoServer().GetShard(cw.keyspace, shard)
+	if err != nil {
+		return fmt.Errorf("cannot read shard %v/%v: %v", cw.keyspace, shard, err)
+	}
+	if si.MasterAlias.IsZero() {
+		return fmt.Errorf("shard %v/%v has no master", cw.keyspace, shard)
+	}
+	masterInfo, err := cw.wr.TopoServer().GetTablet(si.MasterAlias)
+	if err != nil {
+		return fmt.Errorf("cannot get Tablet record for master %v: %v", si.MasterAlias, err)
+	}
+
+	// 1 - the checksums of the master
+	master, err := cw.checksumMaster(ctx, shardIndex, masterInfo)
+	if err != nil {
+		return err
+	}
+	shortCtx, cancel := context.WithTimeout(ctx, *remoteActionsTimeout)
+	masterPos, err := cw.wr.TabletManagerClient().MasterPosition(shortCtx, masterInfo)
+	cancel()
+	if err != nil {
+		return fmt.Errorf("MasterPosition for %v failed: %v", si.MasterAlias, err)
+	}
+
+	// 2 and 3 - the checksums of each replica
+	shortCtx, cancel = context.WithTimeout(ctx, *remoteActionsTimeout)
+	tabletMap, err := topo.GetTabletMapForShard(shortCtx, cw.wr.TopoServer(), cw.keyspace, shard)
+	cancel()
+	if err != nil {
+		return fmt.Errorf("cannot read the tablets of shard %v/%v: %v", cw.keyspace, shard, err)
+	}
+	var aliases topo.TabletAliasList
+	for alias, ti := range tabletMap {
+		for _, tabletType := range cw.tabletTypes {
+			if ti.Type == tabletType {
+				aliases = append(aliases, alias)
+				break
+			}
+		}
+	}
+	sort.Sort(aliases)
+	if len(aliases) == 0 {
+		cw.wr.Logger().Warningf("Shard %v/%v has no tablet of type %v to check", cw.keyspace, shard, cw.tabletTypes)
+	}
+	for i, alias := range aliases {
+		cw.setShardStatus(shardIndex, "checking tablet %v (%v/%v)", alias, i+1, len(aliases))
+		if err := cw.checksumReplica(ctx, tabletMap[alias], masterPos, master); err != nil {
+			return err
+		}
+		if err := cw.checkInterrupted(ctx); err != nil {
+			return err
+		}
+	}
+	cw.setShardStatus(shardIndex, "%v chunks checked on %v tablets", len(master), len(aliases))
+	return nil
+}
+
+// checksumMaster writes the checksums of the master to _vt.checksum,
+// and returns them.
+func (cw *ChecksumWorker) checksumMaster(ctx context.Context, shardIndex int, masterInfo *topo.TabletInfo) (map[checksumChunk]checksumValue, error) {
+	shortCtx, cancel := context.WithTimeout(ctx, *remoteActionsTimeout)
+	qr, err := cw.wr.TabletManagerClient().ExecuteFetchAsApp(shortCtx, masterInfo, "SELECT @@GLOBAL.binlog_format", 1, false)
+	cancel()
+	if err != nil {
+		return nil, fmt.Errorf("cannot read the binlog format of %v: %v", masterInfo.Alias, err)
+	}
+	if len(qr.Rows) != 1 || len(qr.Rows[0]) != 1 {
+		return nil, fmt.Errorf("unexpected result reading the binlog format of %v: %v", masterInfo.Alias, qr.Rows)
+	}
+	if format := qr.Rows[0][0].String(); format != "STATEMENT" {
+		return nil, fmt.Errorf("master %v has binlog format %v: the replicas can only compute the checksums if it is STATEMENT", masterInfo.Alias, format)
+	}
+
+	dbName := masterInfo.DbName()
+	commands := append(createChecksumTable(), fmt.Sprintf("DELETE FROM _vt.checksum WHERE db_name='%v'", dbName))
+	for _, command := range commands {
+		if err := cw.executeFetch(ctx, masterInfo, command); err != nil {
+			return nil, err
+		}
+	}
+
+	shortCtx, cancel = context.WithTimeout(ctx, *remoteActionsTimeout)
+	sd, err := cw.wr.GetSchema(shortCtx, masterInfo.Alias, cw.tables, nil /* excludeTables */, false /* includeViews */)
+	cancel()
+	if err != nil {
+		return nil, fmt.Errorf("cannot get the schema of %v: %v", masterInfo.Alias, err)
+	}
+	if len(cw.tables) > 0 && len(sd.TableDefinitions) == 0 {
+		return nil, fmt.Errorf("master %v has none of the tables %v", masterInfo.Alias, cw.tables)
+	}
+	for i, td := range sd.TableDefinitions {
+		cw.setShardStatus(shardIndex, "computing the checksums of table %v on master %v (%v/%v)", td.Name, masterInfo.Alias, i+1, len(sd.TableDefinitions))
+		chunks, err := FindChunks(ctx, cw.wr, masterInfo, td, cw.minTableSizeForSplit, cw.chunkCount)
+		if err != nil {
+			return nil, err
+		}
+		for chunkIndex := 0; chunkIndex < len(chunks)-1; chunkIndex++ {
+			if err := cw.executeFetch(ctx, masterInfo, buildChecksumSQLFromChunks(dbName, td, chunks, chunkIndex)); err != nil {
+				return nil, err
+			}
+			if err := cw.checkInterrupted(ctx); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return readChecksums(ctx, cw.wr, masterInfo)
+}
+
+// checksumReplica stops the replication of ti once it has replicated
+// the checksums of the master, compares them with its own, and
+// restarts its replication.
+func (cw *ChecksumWorker) checksumReplica(ctx context.Context, ti *topo.TabletInfo, masterPos myproto.ReplicationPosition, master map[checksumChunk]checksumValue) error {
+	cw.wr.Logger().Infof("Stopping slave %v at a minimum of %v", ti.Alias, masterPos)
+	shortCtx, cancel := context.WithTimeout(ctx, *remoteActionsTimeout)
+	_, err := cw.wr.TabletManagerClient().StopSlaveMinimum(shortCtx, ti, masterPos, *remoteActionsTimeout)
+	cancel()
+	if err != nil {
+		return fmt.Errorf("cannot stop slave %v at a minimum of %v: %v", ti.Alias, masterPos, err)
+	}
+	wrangler.RecordStartSlaveAction(cw.cleaner, ti)
+
+	replica, readErr := readChecksums(ctx, cw.wr, ti)
+
+	cw.wr.Logger().Infof("Restarting slave %v", ti.Alias)
+	shortCtx, cancel = context.WithTimeout(ctx, *remoteActionsTimeout)
+	err = cw.wr.TabletManagerClient().StartSlave(shortCtx, ti)
+	cancel()
+	if err != nil {
+		// the cleaner will try again
+		return fmt.Errorf("StartSlave for %v failed: %v", ti.Alias, err)
+	}
+	if err := cw.cleaner.RemoveActionByName(wrangler.StartSlaveActionName, ti.Alias.String()); err != nil {
+		cw.wr.Logger().Warningf("Cannot find cleaning action %v/%v: %v", wrangler.StartSlaveActionName, ti.Alias.String(), err)
+	}
+	if readErr != nil {
+		return readErr
+	}
+
+	var chunks []checksumChunk
+	for chunk := range master {
+		chunks = append(chunks, chunk)
+	}
+	for chunk := range replica {
+		if _, ok := master[chunk]; !ok {
+			chunks = append(chunks, chunk)
+		}
+	}
+	sort.Sort(checksumChunkList(chunks))
+	for _, chunk := range chunks {
+		want, inMaster := master[chunk]
+		got, inReplica := replica[chunk]
+		switch {
+		case !inReplica:
+			cw.addMismatch("%v: %v is missing on %v", ti.Keyspace+"/"+ti.Shard, chunk, ti.Alias)
+		case !inMaster:
+			cw.addMismatch("%v: %v is only on %v", ti.Keyspace+"/"+ti.Shard, chunk, ti.Alias)
+		case got != want:
+			cw.addMismatch("%v: %v has %v rows with checksum %v on %v, but %v rows with checksum %v on the master", ti.Keyspace+"/"+ti.Shard, chunk, got.rowCount, got.crc, ti.Alias, want.rowCount, want.crc)
+		}
+	}
+	return nil
+}
+
+// executeFetch runs a statement on the master ti, with the binlogs on
+// so it replicates.
+func (cw *ChecksumWorker) executeFetch(ctx context.Context, ti *topo.TabletInfo, command string) error {
+	shortCtx, cancel := context.WithTimeout(ctx, *remoteActionsTimeout)
+	_, err := cw.wr.TabletManagerClient().ExecuteFetchAsApp(shortCtx, ti, command, 0, false)
+	cancel()
+	if err != nil {
+		return fmt.Errorf("ExecuteFetch(%v) on %v failed: %v", command, ti.Alias, err)
+	}
+	return nil
+}
+
+// readChecksums returns the checksums of ti in _vt.checksum.
+func readChecksums(ctx context.Context, wr *wrangler.Wrangler, ti *topo.TabletInfo) (map[checksumChunk]checksumValue, error) {
+	shortCtx, cancel := context.WithTimeout(ctx, *remoteActionsTimeout)
+	qr, err := wr.TabletManagerClient().ExecuteFetchAsApp(shortCtx, ti, fmt.Sprintf("SELECT table_name, chunk_start, chunk_end, row_count, crc FROM _vt.checksum WHERE db_name='%v'", ti.DbName()), checksumMaxRows, false)
+	cancel()
+	if err != nil {
+		return nil, fmt.Errorf("cannot read _vt.checksum on %v: %v", ti.Alias, err)
+	}
+	result := make(map[checksumChunk]checksumValue)
+	for _, row := range qr.Rows {
+		if len(row) != 5 {
+			return nil, fmt.Errorf("unexpected row in _vt.checksum on %v: %v", ti.Alias, row)
+		}
+		chunk := checksumChunk{
+			table: row[0].String(),
+			start: row[1].String(),
+			end:   row[2].String(),
+		}
+		result[chunk] = checksumValue{
+			rowCount: row[3].String(),
+			crc:      row[4].String(),
+		}
+	}
+	return result, nil
+}
+
+// checksumChunkList is used to sort checksumChunk objects.
+type checksumChunkList []checksumChunk
+
+// Len is part of sort.Interface
+func (ccl checksumChunkList) Len() int {
+	return len(ccl)
+}
+
+// Less is part of sort.Interface
+func (ccl checksumChunkList) Less(i, j int) bool {
+	if ccl[i].table != ccl[j].table {
+		return ccl[i].table < ccl[j].table
+	}
+	if ccl[i].start != ccl[j].start {
+		return ccl[i].start < ccl[j].start
+	}
+	return ccl[i].end < ccl[j].end
+}
+
+// Swap is part of sort.Interface
+func (ccl checksumChunkList) Swap(i, j int) {
+	ccl[i], ccl[j] = ccl[j], ccl[i]
+}
@@ -0,0 +1,266 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package worker
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	mproto "github.com/youtube/vitess/go/mysql/proto"
+	"github.com/youtube/vitess/go/sqltypes"
+	"github.com/youtube/vitess/go/vt/dbconnpool"
+	"github.com/youtube/vitess/go/vt/logutil"
+	myproto "github.com/youtube/vitess/go/vt/mysqlctl/proto"
+	"github.com/youtube/vitess/go/vt/tabletmanager/tmclient"
+	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/vt/wrangler"
+	"github.com/youtube/vitess/go/vt/wrangler/testlib"
+	"github.com/youtube/vitess/go/vt/zktopo"
+	"golang.org/x/net/context"
+)
+
+// FakeChecksumTablet answers the queries of the Checksum worker, with
+// the rows of its _vt.checksum table, and counts the checksums it
+// computes.
+type FakeChecksumTablet struct {
+	t *testing.T
+
+	BinlogFormat string
+	Checksums    [][]sqltypes.Value
+
+	mu       sync.Mutex
+	Computed int
+}
+
+// fakeChecksumConnection sends its queries to a FakeChecksumTablet.
+type fakeChecksumConnection struct {
+	*FakePoolConnection
+	fct *FakeChecksumTablet
+}
+
+func (fcc fakeChecksumConnection) ExecuteFetch(query string, maxrows int, wantfields bool) (*mproto.QueryResult, error) {
+	return fcc.fct.executeFetch(query)
+}
+
+// Factory returns the DbAppConnectionFactory of the tablet.
+func (fct *FakeChecksumTablet) Factory() func() (dbconnpool.PoolConnection, error) {
+	return func() (dbconnpool.PoolConnection, error) {
+		return fakeChecksumConnection{&FakePoolConnection{t: fct.t}, fct}, nil
+	}
+}
+
+func (fct *FakeChecksumTablet) executeFetch(query string) (*mproto.QueryResult, error) {
+	fct.mu.Lock()
+	defer fct.mu.Unlock()
+	fct.t.Logf("ExecuteFetch: %v", query)
+	for _, q := range append(createChecksumTable(), "DELETE FROM _vt.checksum WHERE db_name='vt_ks'") {
+		if query == q {
+			return &mproto.QueryResult{}, nil
+		}
+	}
+	switch {
+	case query == "SELECT @@GLOBAL.binlog_format":
+		return &mproto.QueryResult{Rows: [][]sqltypes.Value{{sqltypes.MakeString([]byte(fct.BinlogFormat))}}}, nil
+	case query == "SELECT MIN(id), MAX(id) FROM vt_ks.table1":
+		return &mproto.QueryResult{
+			Fields: []mproto.Field{
+				{Name: "min", Type: mproto.VT_LONGLONG},
+				{Name: "max", Type: mproto.VT_LONGLONG},
+			},
+			Rows: [][]sqltypes.Value{{sqltypes.MakeString([]byte("100")), sqltypes.MakeString([]byte("200"))}},
+		}, nil
+	case strings.HasPrefix(query, "REPLACE INTO _vt.checksum (db_name, table_name, chunk_start, chunk_end, row_count, crc) SELECT 'vt_ks', 'table1', "):
+		fct.Computed++
+	case query == "SELECT table_name, chunk_start, chunk_end, row_count, crc FROM _vt.checksum WHERE db_name='vt_ks'":
+		return &mproto.QueryResult{Rows: fct.Checksums}, nil
+	default:
+		fct.t.Errorf("got unexpected query: %v", query)
+		return nil, fmt.Errorf("unexpected query")
+	}
+	return &mproto.QueryResult{}, nil
+}
+
+// checksumRows returns the rows of _vt.checksum for the two chunks
+// of table1, with the checksums crc1 and crc2, or without the second
+// chunk if crc2 is empty.
+func checksumRows(crc1, crc2 string) [][]sqltypes.Value {
+	rows := [][]sqltypes.Value{
+		{sqltypes.MakeString([]byte("table1")), sqltypes.MakeString([]byte("")), sqltypes.MakeString([]byte("150")), sqltypes.MakeString([]byte("50")), sqltypes.MakeString([]byte(crc1))},
+	}
+	if crc2 != "" {
+		rows = append(rows, []sqltypes.Value{sqltypes.MakeString([]byte("table1")), sqltypes.MakeString([]byte("150")), sqltypes.MakeString([]byte("")), sqltypes.MakeString([]byte("51")), sqltypes.MakeString([]byte(crc2))})
+	}
+	return rows
+}
+
+func TestChecksumBuildSQL(t *testing.T) {
+	td := &myproto.TableDefinition{
+		Name:              "table1",
+		Columns:           []string{"id", "msg"},
+		PrimaryKeyColumns: []string{"id"},
+	}
+	table := []struct {
+		chunks     []string
+		chunkIndex int
+		want       string
+	}{
+		{[]string{"", ""}, 0, ""},
+		{[]string{"", "150", ""}, 0, " WHERE id<150"},
+		{[]string{"", "150", ""}, 1, " WHERE id>=150"},
+	}
+	for _, tcase := range table {
+		got := buildChecksumSQLFromChunks("vt_ks", td, tcase.chunks, tcase.chunkIndex)
+		want := fmt.Sprintf("REPLACE INTO _vt.checksum (db_name, table_name, chunk_start, chunk_end, row_count, crc) SELECT 'vt_ks', 'table1', '%v', '%v', COUNT(*), COALESCE(BIT_XOR(CRC32(CONCAT_WS('#', `id`, `msg`, CONCAT(ISNULL(`id`), ISNULL(`msg`))))), 0) FROM `vt_ks`.table1",
+			tcase.chunks[tcase.chunkIndex], tcase.chunks[tcase.chunkIndex+1]) + tcase.want
+		if got != want {
+			t.Errorf("buildChecksumSQLFromChunks(%v, %v) = %v, want %v", tcase.chunks, tcase.chunkIndex, got, want)
+		}
+	}
+}
+
+func TestChecksum(t *testing.T) {
+	testChecksum(t, "STATEMENT", checksumRows("1234", "5678"), "")
+}
+
+func TestChecksumMismatch(t *testing.T) {
+	status := testChecksum(t, "STATEMENT", checksumRows("4321", ""), "2 chunks of the replicas differ from their master")
+	for _, want := range []string{
+		"Mismatch: ks/-80: table table1 between '' and '150' has 50 rows with checksum 4321 on cell2-0000000002, but 50 rows with checksum 1234 on the master",
+		"Mismatch: ks/-80: table table1 between '150' and '' is missing on cell2-0000000002",
+	} {
+		if !strings.Contains(status, want) {
+			t.Errorf("status doesn't contain %q: %v", want, status)
+		}
+	}
+}
+
+func TestChecksumRowBasedReplication(t *testing.T) {
+	testChecksum(t, "ROW", nil, "has binlog format ROW")
+}
+
+// testChecksum runs a Checksum on a keyspace of two shards, where
+// the rdonly tablet of the first shard has the badRdonly checksums,
+// and returns the status of the worker.
+func testChecksum(t *testing.T, binlogFormat string, badRdonly [][]sqltypes.Value, wantErr string) string {
+	ts := zktopo.NewTestServer(t, []string{"cell1", "cell2"})
+	wr := wrangler.New(logutil.NewConsoleLogger(), ts, tmclient.NewTabletManagerClient(), time.Second)
+
+	master1 := testlib.NewFakeTablet(t, wr, "cell1", 0,
+		topo.TYPE_MASTER, testlib.TabletKeyspaceShard(t, "ks", "-80"))
+	replica1 := testlib.NewFakeTablet(t, wr, "cell1", 1,
+		topo.TYPE_REPLICA, testlib.TabletKeyspaceShard(t, "ks", "-80"))
+	rdonly1 := testlib.NewFakeTablet(t, wr, "cell2", 2,
+		topo.TYPE_RDONLY, testlib.TabletKeyspaceShard(t, "ks", "-80"))
+	master2 := testlib.NewFakeTablet(t, wr, "cell1", 10,
+		topo.TYPE_MASTER, testlib.TabletKeyspaceShard(t, "ks", "80-"))
+	replica2 := testlib.NewFakeTablet(t, wr, "cell1", 11,
+		topo.TYPE_REPLICA, testlib.TabletKeyspaceShard(t, "ks", "80-"))
+	// backup tablets are not checked
+	backup2 := testlib.NewFakeTablet(t, wr, "cell1", 12,
+		topo.TYPE_BACKUP, testlib.TabletKeyspaceShard(t, "ks", "80-"))
+
+	for _, ft := range []*testlib.FakeTablet{master1, replica1, rdonly1, master2, replica2, backup2} {
+		ft.StartActionLoop(t, wr)
+		defer ft.StopActionLoop(t)
+	}
+
+	pos := myproto.ReplicationPosition{
+		GTIDSet: myproto.MariadbGTID{Domain: 12, Server: 34, Sequence: 5678},
+	}
+	var masters []*FakeChecksumTablet
+	for _, master := range []*testlib.FakeTablet{master1, master2} {
+		master.FakeMysqlDaemon.Schema = &myproto.SchemaDefinition{
+			TableDefinitions: []*myproto.TableDefinition{
+				&myproto.TableDefinition{
+					Name:              "table1",
+					Columns:           []string{"id", "msg", "keyspace_id"},
+					PrimaryKeyColumns: []string{"id"},
+					Type:              myproto.TableBaseTable,
+					DataLength:        2048,
+				},
+				&myproto.TableDefinition{
+					Name:              "table2",
+					Columns:           []string{"id", "msg"},
+					PrimaryKeyColumns: []string{"id"},
+					Type:              myproto.TableBaseTable,
+				},
+			},
+		}
+		master.FakeMysqlDaemon.CurrentMasterPosition = pos
+		fct := &FakeChecksumTablet{t: t, BinlogFormat: binlogFormat, Checksums: checksumRows("1234", "5678")}
+		master.FakeMysqlDaemon.DbAppConnectionFactory = fct.Factory()
+		masters = append(masters, fct)
+	}
+	var stopped []*testlib.FakeTablet
+	for _, replica := range []*testlib.FakeTablet{replica1, rdonly1, replica2} {
+		checksums := checksumRows("1234", "5678")
+		if replica == rdonly1 && badRdonly != nil {
+			checksums = badRdonly
+		}
+		replica.FakeMysqlDaemon.DbAppConnectionFactory = (&FakeChecksumTablet{t: t, Checksums: checksums}).Factory()
+		replica.FakeMysqlDaemon.CurrentMasterPosition = pos
+		replica.FakeMysqlDaemon.WaitMasterPosition = pos
+		if binlogFormat == "STATEMENT" {
+			replica.FakeMysqlDaemon.ExpectedExecuteSuperQueryList = []string{
+				"STOP SLAVE",
+				"START SLAVE",
+			}
+			stopped = append(stopped, replica)
+		}
+	}
+
+	gwrk, err := NewChecksumWorker(wr, "ks", []string{"table1"}, []topo.TabletType{topo.TYPE_REPLICA, topo.TYPE_RDONLY}, 2 /*chunkCount*/, 1 /*minTableSizeForSplit*/)
+	if err != nil {
+		t.Fatalf("Worker creation failed: %v", err)
+	}
+	wrk := gwrk.(*ChecksumWorker)
+
+	err = wrk.Run(context.Background())
+	status := wrk.StatusAsText()
+	t.Logf("Got status: %v", status)
+	if wantErr != "" {
+		if err == nil || !strings.Contains(err.Error(), wantErr) {
+			t.Errorf("Worker run returned %v, want error containing %q", err, wantErr)
+		}
+	} else if err != nil || wrk.State != WorkerStateDone {
+		t.Errorf("Worker run failed: %v", err)
+	}
+
+	// the replication of each tablet we stopped has to be restarted
+	for _, ft := range stopped {
+		if err := ft.FakeMysqlDaemon.CheckSuperQueryList(); err != nil {
+			t.Errorf("tablet %v: %v", ft.Tablet.Alias, err)
+		}
+	}
+	if binlogFormat == "STATEMENT" {
+		for i, fct := range masters {
+			if fct.Computed != 2 {
+				t.Errorf("master %v computed %v checksums, want 2", i, fct.Computed)
+			}
+		}
+	}
+	return status
+}
+
+func TestNewChecksumWorkerErrors(t *testing.T) {
+	table := []struct {
+		tabletTypes []topo.TabletType
+		chunkCount  int
+		want        string
+	}{
+		{nil, 1, "no tablet type to check"},
+		{[]topo.TabletType{topo.TYPE_MASTER}, 1, "tablet type master doesn't replicate from the master"},
+		{[]topo.TabletType{topo.TYPE_REPLICA}, 0, "invalid chunk count 0"},
+	}
+	for _, tcase := range table {
+		_, err := NewChecksumWorker(nil, "ks", nil, tcase.tabletTypes, tcase.chunkCount, 0)
+		if err == nil || !strings.Contains(err.Error(), tcase.want) {
+			t.Errorf("NewChecksumWorker(%v, %v) = %v, want error containing %q", tcase.tabletTypes, tcase.chunkCount, err, tcase.want)
+		}
+	}
+}
@@ -6,6 +6,7 @@ package worker
 
 import (
 	"bytes"
+	"encoding/binary"
 	"fmt"
 	"regexp"
 	"strconv"
@@ -18,8 +19,10 @@ import (
 
 	mproto "github.com/youtube/vitess/go/mysql/proto"
 	"github.com/youtube/vitess/go/sqltypes"
+	"github.com/youtube/vitess/go/vt/key"
 	myproto "github.com/youtube/vitess/go/vt/mysqlctl/proto"
 	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/vt/vterrors"
 	"github.com/youtube/vitess/go/vt/wrangler"
 )
 
@@ -88,6 +91,7 @@ type tableStatus struct {
 	threadCount    int    // how many concurrent threads will copy the data
 	threadsStarted int    // how many threads have started
 	threadsDone    int    // how many threads are done
+	resumedChunks  int    // how many chunks a previous run had copied
 }
 
 func (ts *tableStatus) setThreadCount(threadCount int) {
@@ -108,6 +112,14 @@ func (ts *tableStatus) threadDone() {
 	ts.mu.Unlock()
 }
 
+func (ts *tableStatus) chunkResumed() {
+	ts.mu.Lock()
+	ts.threadsStarted++
+	ts.threadsDone++
+	ts.resumedChunks++
+	ts.mu.Unlock()
+}
+
 func (ts *tableStatus) addCopiedRows(copiedRows int) {
 	ts.mu.Lock()
 	ts.copiedRows += uint64(copiedRows)
@@ -137,6 +149,9 @@ func formatTableStatuses(tableStatuses []*tableStatus, startTime time.Time) ([]s
 			// copy is running
 			result[i] = fmt.Sprintf("%v: copy running using %v threads (%v/%v rows)", ts.name, ts.threadsStarted-ts.threadsDone, ts.copiedRows, ts.rowCount)
 		}
+		if ts.resumedChunks > 0 {
+			result[i] += fmt.Sprintf(", %v chunks were copied by a previous run", ts.resumedChunks)
+		}
 		copiedRows += ts.copiedRows
 		rowCount += ts.rowCount
 		ts.mu.Unlock()
@@ -180,8 +195,9 @@ func executeFetchWithRetries(ctx context.Context, wr *wrangler.Wrangler, ti *top
 		if len(match) == 2 {
 			errNo = match[1]
 		}
+		code := vterrors.RecoverCode(err)
 		switch {
-		case wr.TabletManagerClient().IsTimeoutError(err):
+		case wr.TabletManagerClient().IsTimeoutError(err) || code == vterrors.DeadlineExceeded:
 			wr.Logger().Warningf("ExecuteFetch failed on %v; will retry because it was a timeout error: %v", ti, err)
 			statsRetryCounters.Add("TimeoutError", 1)
 		case errNo == "1290":
@@ -190,12 +206,15 @@ func executeFetchWithRetries(ctx context.Context, wr *wrangler.Wrangler, ti *top
 		case errNo == "2002" || errNo == "2006":
 			wr.Logger().Warningf("ExecuteFetch failed on %v; will reresolve and retry because it's due to a MySQL connection error: %v", ti, err)
 			statsRetryCounters.Add("ConnectionError", 1)
-		case errNo == "1062":
+		case errNo == "1062" || code == vterrors.IntegrityError:
 			if !isRetry {
 				return ti, fmt.Errorf("ExecuteFetch failed on %v on the first attempt; not retrying as this is not a recoverable error: %v", ti, err)
 			}
 			wr.Logger().Infof("ExecuteFetch failed on %v with a duplicate entry error; marking this as a success, because of the likelihood that this query has already succeeded before being retried: %v", ti, err)
 			return ti, nil
+		case vterrors.IsRetryable(err):
+			wr.Logger().Warningf("ExecuteFetch failed on %v; will reresolve and retry because the tablet says it's a transient error: %v", ti, err)
+			statsRetryCounters.Add("Transient", 1)
 		default:
 			// Unknown error
 			return ti, err
@@ -403,6 +422,77 @@ func buildSQLFromChunks(wr *wrangler.Wrangler, td *myproto.TableDefinition, chun
 	return selectSQL
 }
 
+// buildDeleteSQLFromChunks returns the SQL command to run to delete
+// the rows of a chunk from a destination, so a chunk a previous run
+// didn't finish can be copied again. If the source keyrange is
+// partial, only the rows that came from it are deleted.
+func buildDeleteSQLFromChunks(td *myproto.TableDefinition, chunks []string, chunkIndex int, shardingColumnName string, shardingColumnType key.KeyspaceIdType, kr key.KeyRange) string {
+	return "DELETE FROM `{{.DatabaseName}}`." + td.Name + buildWhereClauseFromChunks(td, chunks, chunkIndex, shardingColumnName, shardingColumnType, kr)
+}
+
+// buildCountSQLFromChunks returns the query that counts the rows of a
+// chunk on a destination, the same ones buildDeleteSQLFromChunks deletes.
+func buildCountSQLFromChunks(td *myproto.TableDefinition, chunks []string, chunkIndex int, shardingColumnName string, shardingColumnType key.KeyspaceIdType, kr key.KeyRange) string {
+	return "SELECT COUNT(*) FROM `{{.DatabaseName}}`." + td.Name + buildWhereClauseFromChunks(td, chunks, chunkIndex, shardingColumnName, shardingColumnType, kr)
+}
+
+// buildWhereClauseFromChunks returns the WHERE clause that selects the
+// rows of a chunk that came from the keyrange kr, or an empty string
+// if that's all the rows.
+func buildWhereClauseFromChunks(td *myproto.TableDefinition, chunks []string, chunkIndex int, shardingColumnName string, shardingColumnType key.KeyspaceIdType, kr key.KeyRange) string {
+	clauses := make([]string, 0, 4)
+	if chunks[chunkIndex] != "" {
+		clauses = append(clauses, td.PrimaryKeyColumns[0]+">="+chunks[chunkIndex])
+	}
+	if chunks[chunkIndex+1] != "" {
+		clauses = append(clauses, td.PrimaryKeyColumns[0]+"<"+chunks[chunkIndex+1])
+	}
+	if kr.Start != key.MinKey {
+		clauses = append(clauses, shardingColumnName+">="+keyspaceIdSQL(kr.Start, shardingColumnType))
+	}
+	if kr.End != key.MaxKey {
+		clauses = append(clauses, shardingColumnName+"<"+keyspaceIdSQL(kr.End, shardingColumnType))
+	}
+	if len(clauses) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(clauses, " AND ")
+}
+
+// keyspaceIdSQL returns the value of the sharding column for a
+// keyspace id, as a SQL literal.
+func keyspaceIdSQL(kid key.KeyspaceId, shardingColumnType key.KeyspaceIdType) string {
+	if shardingColumnType == key.KIT_UINT64 {
+		buf := make([]byte, 8)
+		copy(buf, kid)
+		return fmt.Sprintf("%v", binary.BigEndian.Uint64(buf))
+	}
+	return "0x" + string(kid.Hex())
+}
+
+var foreignKeyReference = regexp.MustCompile("REFERENCES (`([^`]+)`\\.)?`([^`]+)`")
+
+// checkForeignKeys returns an error if a table of the schema has a
+// foreign key to a table that is not in the schema: the copy of the
+// tables would miss the rows it references.
+func checkForeignKeys(sd *myproto.SchemaDefinition) error {
+	tables := make(map[string]bool, len(sd.TableDefinitions))
+	for _, td := range sd.TableDefinitions {
+		tables[td.Name] = true
+	}
+	for _, td := range sd.TableDefinitions {
+		for _, match := range foreignKeyReference.FindAllStringSubmatch(td.Schema, -1) {
+			if match[2] != "" {
+				return fmt.Errorf("table %v has a foreign key to table %v of database %v: drop the foreign key before moving it", td.Name, match[3], match[2])
+			}
+			if !tables[match[3]] {
+				return fmt.Errorf("table %v has a foreign key to table %v, which is not moved: move both tables, or drop the foreign key", td.Name, match[3])
+			}
+		}
+	}
+	return nil
+}
+
 // makeValueString returns a string that contains all the passed-in rows
 // as an insert SQL command's parameters.
 func makeValueString(fields []mproto.Field, rows [][]sqltypes.Value) string {
@@ -433,9 +523,18 @@ func makeValueString(fields []mproto.Field, rows [][]sqltypes.Value) string {
 	return buf.String()
 }
 
+// insertCommand is an insert sent to an executeFetchLoop.
+type insertCommand struct {
+	// sql is the command, without the "INSERT INTO `db`." prefix.
+	sql string
+	// done, if set, is called once the insert ran.
+	done func()
+}
+
 // executeFetchLoop loops over the provided insertChannel
-// and sends the commands to the provided tablet.
-func executeFetchLoop(ctx context.Context, wr *wrangler.Wrangler, r Resolver, shard string, insertChannel chan string) error {
+// and sends the commands to the provided tablet, as fast as the
+// throttler lets it.
+func executeFetchLoop(ctx context.Context, wr *wrangler.Wrangler, r Resolver, shard string, insertChannel chan *insertCommand, throttler *throttler) error {
 	ti, err := r.GetDestinationMaster(shard)
 	if err != nil {
 		return fmt.Errorf("executeFetchLoop failed: %v", err)
@@ -447,11 +546,17 @@ func executeFetchLoop(ctx context.Context, wr *wrangler.Wrangler, r Resolver, sh
 				// no more to read, we're done
 				return nil
 			}
-			cmd = "INSERT INTO `" + ti.DbName() + "`." + cmd
-			ti, err = executeFetchWithRetries(ctx, wr, ti, r, shard, cmd)
+			if err := throttler.wait(ctx, ti); err != nil {
+				// the worker is canceled, as in the case below
+				return nil
+			}
+			ti, err = executeFetchWithRetries(ctx, wr, ti, r, shard, "INSERT INTO `"+ti.DbName()+"`."+cmd.sql)
 			if err != nil {
 				return fmt.Errorf("ExecuteFetch failed: %v", err)
 			}
+			if cmd.done != nil {
+				cmd.done()
+			}
 		case <-ctx.Done():
 			// Doesn't really matter if this select gets starved, because the other case
 			// will also return an error due to executeFetch's context being closed. This case
@@ -0,0 +1,51 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package worker
+
+import (
+	"strings"
+	"testing"
+
+	myproto "github.com/youtube/vitess/go/vt/mysqlctl/proto"
+)
+
+func TestCheckForeignKeys(t *testing.T) {
+	parent := &myproto.TableDefinition{
+		Name:   "parent",
+		Schema: "CREATE TABLE `parent` (\n  `id` bigint(20) NOT NULL,\n  PRIMARY KEY (`id`)\n) ENGINE=InnoDB",
+	}
+	child := &myproto.TableDefinition{
+		Name: "child",
+		Schema: "CREATE TABLE `child` (\n  `id` bigint(20) NOT NULL,\n  `parent_id` bigint(20) NOT NULL,\n  PRIMARY KEY (`id`),\n" +
+			"  CONSTRAINT `child_ibfk_1` FOREIGN KEY (`parent_id`) REFERENCES `parent` (`id`)\n) ENGINE=InnoDB",
+	}
+	other := &myproto.TableDefinition{
+		Name: "other",
+		Schema: "CREATE TABLE `other` (\n  `id` bigint(20) NOT NULL,\n  PRIMARY KEY (`id`),\n" +
+			"  CONSTRAINT `other_ibfk_1` FOREIGN KEY (`id`) REFERENCES `vt_source`.`parent` (`id`)\n) ENGINE=InnoDB",
+	}
+
+	table := []struct {
+		tables []*myproto.TableDefinition
+		want   string
+	}{
+		{[]*myproto.TableDefinition{parent}, ""},
+		{[]*myproto.TableDefinition{parent, child}, ""},
+		{[]*myproto.TableDefinition{child}, "table child has a foreign key to table parent, which is not moved"},
+		{[]*myproto.TableDefinition{parent, other}, "table other has a foreign key to table parent of database vt_source"},
+	}
+	for _, tcase := range table {
+		err := checkForeignKeys(&myproto.SchemaDefinition{TableDefinitions: tcase.tables})
+		if tcase.want == "" {
+			if err != nil {
+				t.Errorf("checkForeignKeys(%v) = %v, want no error", tcase.tables, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tcase.want) {
+			t.Errorf("checkForeignKeys(%v) = %v, want error containing %q", tcase.tables, err, tcase.want)
+		}
+	}
+}
@@ -213,6 +213,10 @@ func (rr *RowReader) Drain() (int, error) {
 	}
 }
 
+// diffReportSampleSize is how many of the rows that differ a DiffReport
+// keeps the primary key of.
+const diffReportSampleSize = 10
+
 // DiffReport has the stats for a diff job
 type DiffReport struct {
 	// general stats
@@ -223,6 +227,8 @@ type DiffReport struct {
 	mismatchedRows int
 	extraRowsLeft  int
 	extraRowsRight int
+	// differentPKs is a sample of the primary keys of the rows above
+	differentPKs []string
 
 	// QPS variables and stats
 	startingTime  time.Time
@@ -241,8 +247,31 @@ func (dr *DiffReport) ComputeQPS() {
 	}
 }
 
+// DifferenceCount returns the number of rows the diff job found
+// different, or on one side only.
+func (dr *DiffReport) DifferenceCount() int {
+	return dr.mismatchedRows + dr.extraRowsLeft + dr.extraRowsRight
+}
+
+// addDifferentPK adds the primary key of a row to the sample, if it
+// isn't full yet.
+func (dr *DiffReport) addDifferentPK(row []sqltypes.Value, pkFieldCount int) {
+	if len(dr.differentPKs) >= diffReportSampleSize {
+		return
+	}
+	pk := make([]string, pkFieldCount)
+	for i := range pk {
+		pk[i] = row[i].String()
+	}
+	dr.differentPKs = append(dr.differentPKs, "("+strings.Join(pk, ", ")+")")
+}
+
 func (dr *DiffReport) String() string {
-	return fmt.Sprintf("DiffReport{%v processed, %v matching, %v mismatched, %v extra left, %v extra right, %v q/s}", dr.processedRows, dr.matchingRows, dr.mismatchedRows, dr.extraRowsLeft, dr.extraRowsRight, dr.processingQPS)
+	result := fmt.Sprintf("DiffReport{%v processed, %v matching, %v mismatched, %v extra left, %v extra right, %v q/s", dr.processedRows, dr.matchingRows, dr.mismatchedRows, dr.extraRowsLeft, dr.extraRowsRight, dr.processingQPS)
+	if len(dr.differentPKs) > 0 {
+		result += ", different PKs: " + strings.Join(dr.differentPKs, " ")
+	}
+	return result + "}"
 }
 
 // RowsEqual returns the index of the first different fields, or -1 if
@@ -365,22 +394,16 @@ func (rd *RowDiffer) Go(log logutil.Logger) (dr DiffReport, err error) {
 			}
 
 			// drain right, update count
-			if count, err := rd.right.Drain(); err != nil {
-				return dr, err
-			} else {
-				dr.extraRowsRight += 1 + count
-			}
-			return
+			count, err := rd.drain(&dr, rd.right, right)
+			dr.extraRowsRight += count
+			return dr, err
 		}
 		if right == nil {
 			// no more rows from the right
 			// we know we have rows from left, drain, update count
-			if count, err := rd.left.Drain(); err != nil {
-				return dr, err
-			} else {
-				dr.extraRowsLeft += 1 + count
-			}
-			return
+			count, err := rd.drain(&dr, rd.left, left)
+			dr.extraRowsLeft += count
+			return dr, err
 		}
 
 		// we have both left and right, compare
@@ -395,9 +418,10 @@ func (rd *RowDiffer) Go(log logutil.Logger) (dr DiffReport, err error) {
 
 		if f >= rd.pkFieldCount {
 			// rows have the same primary key, only content is different
-			if dr.mismatchedRows < 10 {
+			if dr.mismatchedRows < diffReportSampleSize {
 				log.Errorf("Different content %v in same PK: %v != %v", dr.mismatchedRows, left, right)
 			}
+			dr.addDifferentPK(left, rd.pkFieldCount)
 			dr.mismatchedRows++
 			advanceLeft = true
 			advanceRight = true
@@ -410,16 +434,18 @@ func (rd *RowDiffer) Go(log logutil.Logger) (dr DiffReport, err error) {
 			return dr, err
 		}
 		if c < 0 {
-			if dr.extraRowsLeft < 10 {
+			if dr.extraRowsLeft < diffReportSampleSize {
 				log.Errorf("Extra row %v on left: %v", dr.extraRowsLeft, left)
 			}
+			dr.addDifferentPK(left, rd.pkFieldCount)
 			dr.extraRowsLeft++
 			advanceLeft = true
 			continue
 		} else if c > 0 {
-			if dr.extraRowsRight < 10 {
+			if dr.extraRowsRight < diffReportSampleSize {
 				log.Errorf("Extra row %v on right: %v", dr.extraRowsRight, right)
 			}
+			dr.addDifferentPK(right, rd.pkFieldCount)
 			dr.extraRowsRight++
 			advanceRight = true
 			continue
@@ -428,15 +454,31 @@ func (rd *RowDiffer) Go(log logutil.Logger) (dr DiffReport, err error) {
 		// After looking at primary keys more carefully,
 		// they're the same. Logging a regular difference
 		// then, and advancing both.
-		if dr.mismatchedRows < 10 {
+		if dr.mismatchedRows < diffReportSampleSize {
 			log.Errorf("Different content %v in same PK: %v != %v", dr.mismatchedRows, left, right)
 		}
+		dr.addDifferentPK(left, rd.pkFieldCount)
 		dr.mismatchedRows++
 		advanceLeft = true
 		advanceRight = true
 	}
 }
 
+// drain reads the rest of a side, that the other side doesn't have,
+// starting with row. It returns how many rows it read.
+func (rd *RowDiffer) drain(dr *DiffReport, rr *RowReader, row []sqltypes.Value) (int, error) {
+	count := 0
+	for row != nil {
+		dr.addDifferentPK(row, rd.pkFieldCount)
+		count++
+		var err error
+		if row, err = rr.Next(); err != nil {
+			return count, err
+		}
+	}
+	return count, nil
+}
+
 // RowSubsetDiffer will consume rows on both sides, and compare them.
 // It assumes superset and subset are sorted by ascending primary key.
 // It will record errors in DiffReport.extraRowsRight if extra rows
@@ -528,7 +570,7 @@ func (rd *RowSubsetDiffer) Go(log logutil.Logger) (dr DiffReport, err error) {
 
 		if f >= rd.pkFieldCount {
 			// rows have the same primary key, only content is different
-			if dr.mismatchedRows < 10 {
+			if dr.mismatchedRows < diffReportSampleSize {
 				log.Errorf("Different content %v in same PK: %v != %v", dr.mismatchedRows, superset, subset)
 			}
 			dr.mismatchedRows++
@@ -546,7 +588,7 @@ func (rd *RowSubsetDiffer) Go(log logutil.Logger) (dr DiffReport, err error) {
 			advanceSuperset = true
 			continue
 		} else if c > 0 {
-			if dr.extraRowsRight < 10 {
+			if dr.extraRowsRight < diffReportSampleSize {
 				log.Errorf("Extra row %v on subset: %v", dr.extraRowsRight, subset)
 			}
 			dr.extraRowsRight++
@@ -557,7 +599,7 @@ func (rd *RowSubsetDiffer) Go(log logutil.Logger) (dr DiffReport, err error) {
 		// After looking at primary keys more carefully,
 		// they're the same. Logging a regular difference
 		// then, and advancing both.
-		if dr.mismatchedRows < 10 {
+		if dr.mismatchedRows < diffReportSampleSize {
 			log.Errorf("Different content %v in same PK: %v != %v", dr.mismatchedRows, superset, subset)
 		}
 		dr.mismatchedRows++
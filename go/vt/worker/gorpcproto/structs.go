@@ -0,0 +1,27 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+/*
+Package gorpcproto contains the Go RPC definitions of the structures used to
+execute remote vtworker commands.
+*/
+package gorpcproto
+
+// ExecuteVtworkerCommandArgs contains the parameters for the
+// ExecuteVtworkerCommand RPC call.
+type ExecuteVtworkerCommandArgs struct {
+	Args []string
+}
+
+// CancelVtworkerCommandArgs contains the parameters for the
+// CancelVtworkerCommand RPC call. vtworker runs one command at a time,
+// the one it cancels.
+type CancelVtworkerCommandArgs struct{}
+
+// CancelVtworkerCommandReply contains the result of the
+// CancelVtworkerCommand RPC call.
+type CancelVtworkerCommandReply struct {
+	// Status is the status of the job once it stopped.
+	Status string
+}
@@ -0,0 +1,73 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package gorpcvtworkerclient contains the go rpc version of the vtworker client protocol
+package gorpcvtworkerclient
+
+import (
+	"fmt"
+	"time"
+
+	rpc "github.com/youtube/vitess/go/rpcplus"
+	"github.com/youtube/vitess/go/rpcwrap/bsonrpc"
+	"github.com/youtube/vitess/go/vt/logutil"
+	"github.com/youtube/vitess/go/vt/worker/gorpcproto"
+	"github.com/youtube/vitess/go/vt/worker/vtworkerclient"
+	"golang.org/x/net/context"
+)
+
+type goRPCVtworkerClient struct {
+	rpcClient *rpc.Client
+}
+
+func goRPCVtworkerClientFactory(addr string, dialTimeout time.Duration) (vtworkerclient.VtworkerClient, error) {
+	// create the RPC client
+	rpcClient, err := bsonrpc.DialHTTP("tcp", addr, dialTimeout, nil)
+	if err != nil {
+		return nil, fmt.Errorf("RPC error for %v: %v", addr, err)
+	}
+
+	return &goRPCVtworkerClient{rpcClient}, nil
+}
+
+// ExecuteVtworkerCommand is part of the VtworkerClient interface.
+// Note the bson rpc version doesn't honor timeouts in the context.
+func (client *goRPCVtworkerClient) ExecuteVtworkerCommand(ctx context.Context, args []string) (<-chan *logutil.LoggerEvent, vtworkerclient.ErrFunc) {
+	req := &gorpcproto.ExecuteVtworkerCommandArgs{
+		Args: args,
+	}
+	sr := make(chan *logutil.LoggerEvent, 10)
+	c := client.rpcClient.StreamGo("VtworkerServer.ExecuteVtworkerCommand", req, sr)
+	return sr, func() error { return c.Error }
+}
+
+// PingVtworker is part of the VtworkerClient interface
+func (client *goRPCVtworkerClient) PingVtworker(ctx context.Context) error {
+	var result string
+	if err := client.rpcClient.Call(ctx, "VtworkerServer.PingVtworker", "payload", &result); err != nil {
+		return err
+	}
+	if result != "payload" {
+		return fmt.Errorf("bad ping result: %v", result)
+	}
+	return nil
+}
+
+// CancelVtworkerCommand is part of the VtworkerClient interface
+func (client *goRPCVtworkerClient) CancelVtworkerCommand(ctx context.Context) (string, error) {
+	var reply gorpcproto.CancelVtworkerCommandReply
+	if err := client.rpcClient.Call(ctx, "VtworkerServer.CancelVtworkerCommand", &gorpcproto.CancelVtworkerCommandArgs{}, &reply); err != nil {
+		return "", err
+	}
+	return reply.Status, nil
+}
+
+// Close is part of the VtworkerClient interface
+func (client *goRPCVtworkerClient) Close() {
+	client.rpcClient.Close()
+}
+
+func init() {
+	vtworkerclient.RegisterFactory("gorpc", goRPCVtworkerClientFactory)
+}
@@ -0,0 +1,93 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gorpcvtworkerclient
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/youtube/vitess/go/rpcplus"
+	"github.com/youtube/vitess/go/rpcwrap/bsonrpc"
+	"github.com/youtube/vitess/go/vt/logutil"
+	"github.com/youtube/vitess/go/vt/worker/gorpcvtworkerserver"
+	"golang.org/x/net/context"
+)
+
+// fakeRunner logs its arguments, and fails for the Fail command.
+func fakeRunner(ctx context.Context, args []string, logger logutil.Logger) error {
+	logger.Infof("running %v", strings.Join(args, " "))
+	if args[0] == "Fail" {
+		return fmt.Errorf("command failed")
+	}
+	return nil
+}
+
+// fakeCanceller returns the final status of a cancelled command.
+func fakeCanceller(ctx context.Context) (string, error) {
+	return "State: cancelling", nil
+}
+
+// the test here creates a fake server implementation, a fake client
+// implementation, and runs commands against the setup.
+func TestVtworkerServer(t *testing.T) {
+	// Listen on a random port
+	listener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("Cannot listen: %v", err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+
+	// Create a Go Rpc server and listen on the port
+	server := rpcplus.NewServer()
+	server.Register(gorpcvtworkerserver.NewVtworkerServer(fakeRunner, fakeCanceller))
+
+	// create the HTTP server, serve the server from it
+	handler := http.NewServeMux()
+	bsonrpc.ServeCustomRPC(handler, server, false)
+	httpServer := http.Server{
+		Handler: handler,
+	}
+	go httpServer.Serve(listener)
+
+	// Create a VtworkerClient Go Rpc client to talk to the fake server
+	client, err := goRPCVtworkerClientFactory(fmt.Sprintf("localhost:%v", port), 30*time.Second)
+	if err != nil {
+		t.Fatalf("Cannot create client: %v", err)
+	}
+	defer client.Close()
+
+	ctx := context.Background()
+	logs, errFunc := client.ExecuteVtworkerCommand(ctx, []string{"SplitDiff", "ks/-80"})
+	var got []string
+	for e := range logs {
+		got = append(got, e.Value)
+	}
+	if err := errFunc(); err != nil {
+		t.Fatalf("Remote error: %v", err)
+	}
+	if len(got) != 1 || got[0] != "running SplitDiff ks/-80" {
+		t.Errorf("Got unexpected logs: %v", got)
+	}
+
+	logs, errFunc = client.ExecuteVtworkerCommand(ctx, []string{"Fail"})
+	for _ = range logs {
+	}
+	if err := errFunc(); err == nil || !strings.Contains(err.Error(), "command failed") {
+		t.Errorf("Unexpected remote error: %v", err)
+	}
+
+	if err := client.PingVtworker(ctx); err != nil {
+		t.Errorf("PingVtworker failed: %v", err)
+	}
+
+	status, err := client.CancelVtworkerCommand(ctx)
+	if err != nil || status != "State: cancelling" {
+		t.Errorf("CancelVtworkerCommand() = (%q, %v), want the final status", status, err)
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+/*
+Package gorpcvtworkerserver contains the Go RPC implementation of the server
+side of the remote execution of vtworker commands.
+*/
+package gorpcvtworkerserver
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/youtube/vitess/go/vt/logutil"
+	"github.com/youtube/vitess/go/vt/servenv"
+	"github.com/youtube/vitess/go/vt/worker/gorpcproto"
+	"golang.org/x/net/context"
+)
+
+// CommandRunner runs a vtworker command until it is done, and sends
+// its logs to logger. It is implemented by the vtworker binary, which
+// owns the current worker.
+type CommandRunner func(ctx context.Context, args []string, logger logutil.Logger) error
+
+// CommandCanceller cancels the running vtworker command, waits until
+// it cleaned up, and returns its final status.
+type CommandCanceller func(ctx context.Context) (string, error)
+
+// VtworkerServer is our RPC server
+type VtworkerServer struct {
+	run    CommandRunner
+	cancel CommandCanceller
+}
+
+// PingVtworker is the server side method that checks the vtworker
+// answers: it sends back the payload.
+func (s *VtworkerServer) PingVtworker(ctx context.Context, args, reply *string) error {
+	*reply = *args
+	return nil
+}
+
+// ExecuteVtworkerCommand is the server side method that will run the
+// command, and stream its logs.
+func (s *VtworkerServer) ExecuteVtworkerCommand(ctx context.Context, query *gorpcproto.ExecuteVtworkerCommandArgs, sendReply func(interface{}) error) (err error) {
+	defer func() {
+		if x := recover(); x != nil {
+			err = fmt.Errorf("uncaught vtworker panic: %v", x)
+		}
+	}()
+
+	// create a logger, send the result back to the caller
+	logstream := logutil.NewChannelLogger(10)
+
+	// send logs to the caller
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		for e := range logstream {
+			// Note we don't interrupt the loop here, as
+			// we still need to flush and finish the
+			// command, even if the channel to the client
+			// has been broken. We'll just keep trying.
+			sendReply(&e)
+		}
+		wg.Done()
+	}()
+
+	// run the command
+	err = s.run(ctx, query.Args, logstream)
+
+	// close the log channel, and wait for them all to be sent
+	close(logstream)
+	wg.Wait()
+
+	return err
+}
+
+// CancelVtworkerCommand is the server side method that cancels the
+// running command, and returns its status once it stopped.
+func (s *VtworkerServer) CancelVtworkerCommand(ctx context.Context, args *gorpcproto.CancelVtworkerCommandArgs, reply *gorpcproto.CancelVtworkerCommandReply) (err error) {
+	defer func() {
+		if x := recover(); x != nil {
+			err = fmt.Errorf("uncaught vtworker panic: %v", x)
+		}
+	}()
+
+	reply.Status, err = s.cancel(ctx)
+	return err
+}
+
+// NewVtworkerServer returns a new Vtworker Server running the
+// commands with run, and cancelling them with cancel.
+func NewVtworkerServer(run CommandRunner, cancel CommandCanceller) *VtworkerServer {
+	return &VtworkerServer{run, cancel}
+}
+
+// StartServer registers the Server for RPCs
+func StartServer(run CommandRunner, cancel CommandCanceller) {
+	servenv.Register("vtworker", NewVtworkerServer(run, cancel))
+}
@@ -11,6 +11,7 @@ import (
 
 	"github.com/youtube/vitess/go/sqltypes"
 	"github.com/youtube/vitess/go/vt/key"
+	"github.com/youtube/vitess/go/vt/rowrouter"
 	"github.com/youtube/vitess/go/vt/topo"
 )
 
@@ -33,13 +34,31 @@ func si(start, end string) *topo.ShardInfo {
 	}, 0)
 }
 
+// newTestRowSplitter returns a RowSplitter for rows whose second
+// column is the sharding column.
+func newTestRowSplitter(t *testing.T, shards []*topo.ShardInfo, kit key.KeyspaceIdType) *RowSplitter {
+	ki := topo.NewKeyspaceInfo("keyspace", &topo.Keyspace{
+		ShardingColumnName: "keyspace_id",
+		ShardingColumnType: kit,
+	}, 0)
+	router, err := rowrouter.NewRouter(ki, shards)
+	if err != nil {
+		t.Fatalf("NewRouter failed: %v", err)
+	}
+	table, err := router.Table("table1", []string{"msg", "keyspace_id"})
+	if err != nil {
+		t.Fatalf("Table failed: %v", err)
+	}
+	return NewRowSplitter(table)
+}
+
 func TestRowSplitterUint64(t *testing.T) {
 	shards := []*topo.ShardInfo{
 		si("", "40"),
 		si("40", "c0"),
 		si("c0", ""),
 	}
-	rs := NewRowSplitter(shards, key.KIT_UINT64, 1)
+	rs := newTestRowSplitter(t, shards, key.KIT_UINT64)
 
 	// rows in different shards
 	row0 := []sqltypes.Value{
@@ -90,7 +109,7 @@ func TestRowSplitterString(t *testing.T) {
 		siBytes("E", "L"),
 		siBytes("L", ""),
 	}
-	rs := NewRowSplitter(shards, key.KIT_BYTES, 1)
+	rs := newTestRowSplitter(t, shards, key.KIT_BYTES)
 
 	// rows in different shards
 	row0 := []sqltypes.Value{
@@ -15,10 +15,12 @@ import (
 
 	"github.com/youtube/vitess/go/event"
 	"github.com/youtube/vitess/go/jscfg"
+	"github.com/youtube/vitess/go/sqltypes"
 	"github.com/youtube/vitess/go/sync2"
 	"github.com/youtube/vitess/go/vt/binlog/binlogplayer"
 	"github.com/youtube/vitess/go/vt/mysqlctl"
 	myproto "github.com/youtube/vitess/go/vt/mysqlctl/proto"
+	"github.com/youtube/vitess/go/vt/rowrouter"
 	"github.com/youtube/vitess/go/vt/topo"
 	"github.com/youtube/vitess/go/vt/topotools"
 	"github.com/youtube/vitess/go/vt/worker/events"
@@ -40,8 +42,12 @@ type SplitCloneWorker struct {
 	destinationPackCount   int
 	minTableSizeForSplit   uint64
 	destinationWriterCount int
+	resume                 bool
 	cleaner                *wrangler.Cleaner
 
+	// job identifies the checkpoint of this SplitClone
+	job string
+
 	// all subsequent fields are protected by the mutex
 
 	// populated during WorkerStateInit, read-only after that
@@ -52,6 +58,18 @@ type SplitCloneWorker struct {
 	// populated during WorkerStateFindTargets, read-only after that
 	sourceAliases []topo.TabletAlias
 	sourceTablets []*topo.TabletInfo
+	// checkpoint is what a previous run recorded on the destinations.
+	checkpoint *splitCloneCheckpoint
+	// resumed is set for the source shards a previous run started
+	// to copy, from the same tablet at the same position.
+	resumed []bool
+	// sourceRecorded is set for the source shards whose tablet and
+	// position are in the checkpoint.
+	sourceRecorded []bool
+
+	// throttler throttles the writes to the destinations,
+	// during WorkerStateCopy
+	throttler *throttler
 
 	// populated during WorkerStateCopy
 	tableStatus []*tableStatus
@@ -72,7 +90,7 @@ type SplitCloneWorker struct {
 }
 
 // NewSplitCloneWorker returns a new SplitCloneWorker object.
-func NewSplitCloneWorker(wr *wrangler.Wrangler, cell, keyspace, shard string, excludeTables []string, strategyStr string, sourceReaderCount, destinationPackCount int, minTableSizeForSplit uint64, destinationWriterCount int) (Worker, error) {
+func NewSplitCloneWorker(wr *wrangler.Wrangler, cell, keyspace, shard string, excludeTables []string, strategyStr string, sourceReaderCount, destinationPackCount int, minTableSizeForSplit uint64, destinationWriterCount int, resume bool) (Worker, error) {
 	strategy, err := mysqlctl.NewSplitStrategy(wr.Logger(), strategyStr)
 	if err != nil {
 		return nil, err
@@ -89,7 +107,10 @@ func NewSplitCloneWorker(wr *wrangler.Wrangler, cell, keyspace, shard string, ex
 		destinationPackCount:   destinationPackCount,
 		minTableSizeForSplit:   minTableSizeForSplit,
 		destinationWriterCount: destinationWriterCount,
+		resume:                 resume,
 		cleaner:                &wrangler.Cleaner{},
+		job:                    splitCloneJob(keyspace, shard, excludeTables),
+		throttler:              newThrottler(wr),
 
 		ev: &events.SplitClone{
 			Cell:          cell,
@@ -131,6 +152,7 @@ func (scw *SplitCloneWorker) StatusAsHTML() template.HTML {
 		result += "<b>Copying from</b>: " + scw.formatSources() + "</br>\n"
 		statuses, eta := formatTableStatuses(scw.tableStatus, scw.startTime)
 		result += "<b>ETA</b>: " + eta.String() + "</br>\n"
+		result += strings.Join(scw.throttler.statuses(), "</br>\n") + "</br>\n"
 		result += strings.Join(statuses, "</br>\n")
 	case WorkerStateDone:
 		result += "<b>Success</b>:</br>\n"
@@ -153,6 +175,7 @@ func (scw *SplitCloneWorker) StatusAsText() string {
 		result += "Copying from: " + scw.formatSources() + "\n"
 		statuses, eta := formatTableStatuses(scw.tableStatus, scw.startTime)
 		result += "ETA: " + eta.String() + "\n"
+		result += strings.Join(scw.throttler.statuses(), "\n") + "\n"
 		result += strings.Join(statuses, "\n")
 	case WorkerStateDone:
 		result += "Success:\n"
@@ -165,17 +188,13 @@ func (scw *SplitCloneWorker) StatusAsText() string {
 // Run implements the Worker interface
 func (scw *SplitCloneWorker) Run(ctx context.Context) error {
 	resetVars()
-	err := scw.run(ctx)
-
-	scw.setState(WorkerStateCleanUp)
-	cerr := scw.cleaner.CleanUp(scw.wr)
-	if cerr != nil {
+	err := runAndCleanUp(ctx, scw.wr, scw.cleaner, func() { scw.setState(WorkerStateCleanUp) }, func(ctx context.Context) error {
+		err := scw.run(ctx)
 		if err != nil {
-			scw.wr.Logger().Errorf("CleanUp failed in addition to job error: %v", cerr)
-		} else {
-			err = cerr
+			scw.keepSourcesForResume()
 		}
-	}
+		return err
+	})
 	if err != nil {
 		scw.setErrorState(err)
 		return err
@@ -189,7 +208,7 @@ func (scw *SplitCloneWorker) run(ctx context.Context) error {
 	if err := scw.init(); err != nil {
 		return fmt.Errorf("init() failed: %v", err)
 	}
-	if err := checkDone(ctx); err != nil {
+	if err := scw.checkInterrupted(ctx); err != nil {
 		return err
 	}
 
@@ -197,7 +216,7 @@ func (scw *SplitCloneWorker) run(ctx context.Context) error {
 	if err := scw.findTargets(ctx); err != nil {
 		return fmt.Errorf("findTargets() failed: %v", err)
 	}
-	if err := checkDone(ctx); err != nil {
+	if err := scw.checkInterrupted(ctx); err != nil {
 		return err
 	}
 
@@ -209,6 +228,21 @@ func (scw *SplitCloneWorker) run(ctx context.Context) error {
 	return nil
 }
 
+// keepSourcesForResume removes the clean-up actions that would restart
+// replication on the recorded source tablets, and put them back in
+// serving: they stay where they are, so the copy can be resumed.
+func (scw *SplitCloneWorker) keepSourcesForResume() {
+	for i, recorded := range scw.sourceRecorded {
+		if !recorded {
+			continue
+		}
+		alias := scw.sourceAliases[i]
+		scw.cleaner.RemoveActionByName(wrangler.StartSlaveActionName, alias.String())
+		scw.cleaner.RemoveActionByName(wrangler.ChangeSlaveTypeActionName, alias.String())
+		scw.wr.Logger().Warningf("Leaving tablet %v as worker with its replication stopped: run SplitClone again with -resume to resume the copy. To give up on it instead, clear the destination shards and the _vt.split_clone_source and _vt.split_clone_chunk tables on their masters, and run 'vtctl StartSlave %v' and 'vtctl ChangeSlaveType %v rdonly'", alias, alias, alias)
+	}
+}
+
 // init phase:
 // - read the destination keyspace, make sure it has 'servedFrom' values
 func (scw *SplitCloneWorker) init() error {
@@ -263,16 +297,45 @@ func (scw *SplitCloneWorker) init() error {
 }
 
 // findTargets phase:
-// - find one rdonly in the source shard
+// - read the checkpoint of a previous run on the destination masters
+// - find one rdonly in the source shard, or reuse the previous one
 // - mark it as 'checker' pointing back to us
 // - get the aliases of all the targets
 func (scw *SplitCloneWorker) findTargets(ctx context.Context) error {
 	scw.setState(WorkerStateFindTargets)
 	var err error
 
+	if err := scw.ResolveDestinationMasters(ctx); err != nil {
+		return fmt.Errorf("cannot resolve destination masters: %v", err)
+	}
+	destinationShardNames := make([]string, len(scw.destinationShards))
+	for i, si := range scw.destinationShards {
+		destinationShardNames[i] = si.ShardName()
+	}
+	scw.checkpoint, err = readSplitCloneCheckpoint(ctx, scw.wr, scw, destinationShardNames, scw.job)
+	if err != nil {
+		return fmt.Errorf("cannot read the checkpoint: %v", err)
+	}
+	switch {
+	case !scw.resume && !scw.checkpoint.isEmpty():
+		return fmt.Errorf("a previous run of %v didn't finish: run it again with -resume to resume its copy", scw.job)
+	case scw.resume && scw.checkpoint.isEmpty():
+		scw.wr.Logger().Infof("Nothing to resume for %v, copying from scratch", scw.job)
+	}
+
 	// find an appropriate endpoint in the source shards
 	scw.sourceAliases = make([]topo.TabletAlias, len(scw.sourceShards))
+	scw.resumed = make([]bool, len(scw.sourceShards))
 	for i, si := range scw.sourceShards {
+		if source, ok := scw.checkpoint.sources[si.ShardName()]; ok {
+			if err := UseWorkerTablet(ctx, scw.wr, scw.cleaner, source.alias); err != nil {
+				return fmt.Errorf("cannot use tablet %v of the previous run for %v/%v: %v", source.alias, si.Keyspace(), si.ShardName(), err)
+			}
+			scw.sourceAliases[i] = source.alias
+			scw.resumed[i] = true
+			scw.wr.Logger().Infof("Resuming the copy of %v/%v from tablet %v", si.Keyspace(), si.ShardName(), scw.sourceAliases[i])
+			continue
+		}
 		scw.sourceAliases[i], err = FindWorkerTablet(ctx, scw.wr, scw.cleaner, scw.cell, si.Keyspace(), si.ShardName())
 		if err != nil {
 			return fmt.Errorf("cannot find checker for %v/%v/%v: %v", scw.cell, si.Keyspace(), si.ShardName(), err)
@@ -282,6 +345,7 @@ func (scw *SplitCloneWorker) findTargets(ctx context.Context) error {
 
 	// get the tablet info for them, and stop their replication
 	scw.sourceTablets = make([]*topo.TabletInfo, len(scw.sourceAliases))
+	scw.sourceRecorded = make([]bool, len(scw.sourceAliases))
 	for i, alias := range scw.sourceAliases {
 		scw.sourceTablets[i], err = scw.wr.TopoServer().GetTablet(alias)
 		if err != nil {
@@ -301,9 +365,36 @@ func (scw *SplitCloneWorker) findTargets(ctx context.Context) error {
 			return fmt.Errorf("cannot find ChangeSlaveType action for %v: %v", alias, err)
 		}
 		action.TabletType = topo.TYPE_SPARE
-	}
 
-	return scw.ResolveDestinationMasters(ctx)
+		// a resumed copy must read the same data as the previous
+		// run, otherwise record where we copy from
+		shortCtx, cancel = context.WithTimeout(ctx, *remoteActionsTimeout)
+		status, err := scw.wr.TabletManagerClient().SlaveStatus(shortCtx, scw.sourceTablets[i])
+		cancel()
+		if err != nil {
+			return fmt.Errorf("cannot get the replication position of tablet %v: %v", alias, err)
+		}
+		shardName := scw.sourceShards[i].ShardName()
+		if scw.resumed[i] {
+			if source := scw.checkpoint.sources[shardName]; !status.Position.Equal(source.pos) {
+				return fmt.Errorf("cannot resume the copy from tablet %v: it is at position %v, the previous run copied from position %v", alias, status.Position, source.pos)
+			}
+			scw.sourceRecorded[i] = true
+			continue
+		}
+		scw.checkpoint.forgetSource(shardName)
+		queries := []string{
+			deleteSplitCloneChunks(scw.job, shardName),
+			populateSplitCloneSource(scw.job, shardName, alias, status.Position),
+		}
+		for _, si := range scw.destinationShards {
+			if err := runSqlCommands(ctx, scw.wr, scw, si.ShardName(), queries); err != nil {
+				return fmt.Errorf("cannot record the source of %v on destination shard %v: %v", shardName, si.ShardName(), err)
+			}
+		}
+		scw.sourceRecorded[i] = true
+	}
+	return nil
 }
 
 // ResolveDestinationMasters implements the Resolver interface.
@@ -397,21 +488,19 @@ func (scw *SplitCloneWorker) copy(ctx context.Context) error {
 	}
 	scw.startTime = time.Now()
 	scw.Mu.Unlock()
+	defer scw.throttler.stop()
 
-	// Find the column index for the sharding columns in all the databases, and count rows
-	columnIndexes := make([]int, len(sourceSchemaDefinition.TableDefinitions))
+	// Find the routing of the rows of all the tables, and count rows
+	router, err := rowrouter.NewRouter(scw.keyspaceInfo, scw.destinationShards)
+	if err != nil {
+		return fmt.Errorf("cannot route the rows to the destination shards: %v", err)
+	}
+	tableRoutes := make([]*rowrouter.Table, len(sourceSchemaDefinition.TableDefinitions))
 	for tableIndex, td := range sourceSchemaDefinition.TableDefinitions {
 		if td.Type == myproto.TableBaseTable {
-			// find the column to split on
-			columnIndexes[tableIndex] = -1
-			for i, name := range td.Columns {
-				if name == scw.keyspaceInfo.ShardingColumnName {
-					columnIndexes[tableIndex] = i
-					break
-				}
-			}
-			if columnIndexes[tableIndex] == -1 {
-				return fmt.Errorf("table %v doesn't have a column named '%v'", td.Name, scw.keyspaceInfo.ShardingColumnName)
+			tableRoutes[tableIndex], err = router.Table(td.Name, td.Columns)
+			if err != nil {
+				return err
 			}
 
 			scw.tableStatus[tableIndex].mu.Lock()
@@ -441,7 +530,7 @@ func (scw *SplitCloneWorker) copy(ctx context.Context) error {
 		mu.Unlock()
 	}
 
-	insertChannels := make([]chan string, len(scw.destinationShards))
+	insertChannels := make([]chan *insertCommand, len(scw.destinationShards))
 	destinationWaitGroup := sync.WaitGroup{}
 	for shardIndex, si := range scw.destinationShards {
 		// we create one channel per destination tablet.  It
@@ -449,14 +538,14 @@ func (scw *SplitCloneWorker) copy(ctx context.Context) error {
 		// destinationWriterCount * 2 items, to hopefully
 		// always have data. We then have
 		// destinationWriterCount go routines reading from it.
-		insertChannels[shardIndex] = make(chan string, scw.destinationWriterCount*2)
+		insertChannels[shardIndex] = make(chan *insertCommand, scw.destinationWriterCount*2)
 
-		go func(shardName string, insertChannel chan string) {
+		go func(shardName string, insertChannel chan *insertCommand) {
 			for j := 0; j < scw.destinationWriterCount; j++ {
 				destinationWaitGroup.Add(1)
 				go func() {
 					defer destinationWaitGroup.Done()
-					if err := executeFetchLoop(ctx, scw.wr, scw, shardName, insertChannel); err != nil {
+					if err := executeFetchLoop(ctx, scw.wr, scw, shardName, insertChannel, scw.throttler); err != nil {
 						processError("executeFetchLoop failed: %v", err)
 					}
 				}()
@@ -465,16 +554,16 @@ func (scw *SplitCloneWorker) copy(ctx context.Context) error {
 	}
 
 	// Now for each table, read data chunks and send them to all
-	// insertChannels
+	// insertChannels. The chunks a previous run copied are skipped.
 	sourceWaitGroup := sync.WaitGroup{}
-	for shardIndex := range scw.sourceShards {
+	for shardIndex, sourceShard := range scw.sourceShards {
 		sema := sync2.NewSemaphore(scw.sourceReaderCount, 0)
 		for tableIndex, td := range sourceSchemaDefinition.TableDefinitions {
 			if td.Type == myproto.TableView {
 				continue
 			}
 
-			rowSplitter := NewRowSplitter(scw.destinationShards, scw.keyspaceInfo.ShardingColumnType, columnIndexes[tableIndex])
+			rowSplitter := NewRowSplitter(tableRoutes[tableIndex])
 
 			chunks, err := FindChunks(ctx, scw.wr, scw.sourceTablets[shardIndex], td, scw.minTableSizeForSplit, scw.sourceReaderCount)
 			if err != nil {
@@ -482,16 +571,62 @@ func (scw *SplitCloneWorker) copy(ctx context.Context) error {
 			}
 			scw.tableStatus[tableIndex].setThreadCount(len(chunks) - 1)
 
-			for chunkIndex := 0; chunkIndex < len(chunks)-1; chunkIndex++ {
+			// check a sample of the chunks we skip still have
+			// the rows the previous run copied
+			tableChunks := make([]splitCloneChunk, len(chunks)-1)
+			var copiedChunks []splitCloneChunk
+			countSQLs := make(map[splitCloneChunk]string)
+			for chunkIndex := range tableChunks {
+				chunk := splitCloneChunk{
+					sourceShard: sourceShard.ShardName(),
+					table:       td.Name,
+					start:       chunks[chunkIndex],
+					end:         chunks[chunkIndex+1],
+				}
+				tableChunks[chunkIndex] = chunk
+				if scw.resumed[shardIndex] && scw.checkpoint.isCopied(chunk) {
+					copiedChunks = append(copiedChunks, chunk)
+					countSQLs[chunk] = buildCountSQLFromChunks(td, chunks, chunkIndex, scw.keyspaceInfo.ShardingColumnName, scw.keyspaceInfo.ShardingColumnType, sourceShard.KeyRange)
+				}
+			}
+			for _, chunk := range sampleChunks(copiedChunks, splitCloneResumeSampleSize) {
+				if err := verifySplitCloneChunk(ctx, scw.wr, scw, scw.checkpoint, chunk, countSQLs[chunk]); err != nil {
+					return fmt.Errorf("cannot resume the copy: %v", err)
+				}
+			}
+
+			for chunkIndex, chunk := range tableChunks {
+				if _, ok := countSQLs[chunk]; ok {
+					scw.wr.Logger().Infof("Skipping table %v between '%v' and '%v' from %v, the previous run copied it", td.Name, chunk.start, chunk.end, chunk.sourceShard)
+					scw.tableStatus[tableIndex].chunkResumed()
+					continue
+				}
+
 				sourceWaitGroup.Add(1)
-				go func(td *myproto.TableDefinition, tableIndex, chunkIndex int) {
+				go func(td *myproto.TableDefinition, shardIndex, tableIndex, chunkIndex int, chunk splitCloneChunk) {
 					defer sourceWaitGroup.Done()
 
 					sema.Acquire()
 					defer sema.Release()
 
+					// a cancelled clone stops between two chunks,
+					// a run with -resume copies the ones left
+					if scw.isCancelled() {
+						return
+					}
 					scw.tableStatus[tableIndex].threadStarted()
 
+					// the previous run may have copied part of the chunk
+					if scw.resumed[shardIndex] {
+						deleteSQL := buildDeleteSQLFromChunks(td, chunks, chunkIndex, scw.keyspaceInfo.ShardingColumnName, scw.keyspaceInfo.ShardingColumnType, scw.sourceShards[shardIndex].KeyRange)
+						for _, si := range scw.destinationShards {
+							if err := runSqlCommands(ctx, scw.wr, scw, si.ShardName(), []string{deleteSQL}); err != nil {
+								processError("cannot delete the rows of table %v between '%v' and '%v' on %v: %v", td.Name, chunk.start, chunk.end, si.ShardName(), err)
+								return
+							}
+						}
+					}
+
 					// build the query, and start the streaming
 					selectSQL := buildSQLFromChunks(scw.wr, td, chunks, chunkIndex, scw.sourceAliases[shardIndex].String())
 					qrr, err := NewQueryResultReaderForTablet(ctx, scw.wr.TopoServer(), scw.sourceAliases[shardIndex], selectSQL)
@@ -502,11 +637,25 @@ func (scw *SplitCloneWorker) copy(ctx context.Context) error {
 					defer qrr.Close()
 
 					// process the data
-					if err := scw.processData(td, tableIndex, qrr, rowSplitter, insertChannels, scw.destinationPackCount, ctx.Done()); err != nil {
+					inserts := &sync.WaitGroup{}
+					rowCounts := make([]uint64, len(scw.destinationShards))
+					if err := scw.processData(td, tableIndex, qrr, rowSplitter, insertChannels, inserts, rowCounts, scw.destinationPackCount, ctx.Done()); err != nil {
 						processError("processData failed: %v", err)
+						return
+					}
+
+					// and record the chunk once all its rows are in
+					if !waitForInserts(ctx, inserts) {
+						return
+					}
+					for i, si := range scw.destinationShards {
+						if err := runSqlCommands(ctx, scw.wr, scw, si.ShardName(), []string{populateSplitCloneChunk(scw.job, chunk, rowCounts[i])}); err != nil {
+							processError("cannot record the copy of table %v between '%v' and '%v' on %v: %v", td.Name, chunk.start, chunk.end, si.ShardName(), err)
+							return
+						}
 					}
 					scw.tableStatus[tableIndex].threadDone()
-				}(td, tableIndex, chunkIndex)
+				}(td, shardIndex, tableIndex, chunkIndex, chunk)
 			}
 		}
 	}
@@ -519,6 +668,9 @@ func (scw *SplitCloneWorker) copy(ctx context.Context) error {
 	if firstError != nil {
 		return firstError
 	}
+	if err := scw.checkInterrupted(ctx); err != nil {
+		return err
+	}
 
 	// then create and populate the blp_checkpoint table
 	if scw.strategy.PopulateBlpCheckpoint {
@@ -575,6 +727,16 @@ func (scw *SplitCloneWorker) copy(ctx context.Context) error {
 		}
 	}
 
+	// The copy is complete, a new SplitClone has to start over.
+	for _, si := range scw.destinationShards {
+		if err := runSqlCommands(ctx, scw.wr, scw, si.ShardName(), deleteSplitCloneCheckpoint(scw.job)); err != nil {
+			return fmt.Errorf("cannot delete the checkpoint on %v: %v", si.ShardName(), err)
+		}
+	}
+	for i := range scw.sourceRecorded {
+		scw.sourceRecorded[i] = false
+	}
+
 	err = scw.findReloadTargets(ctx)
 	if err != nil {
 		return fmt.Errorf("failed before reloading schema on destination tablets: %v", err)
@@ -602,8 +764,9 @@ func (scw *SplitCloneWorker) copy(ctx context.Context) error {
 }
 
 // processData pumps the data out of the provided QueryResultReader.
+// It adds the number of rows sent to each destination to rowCounts.
 // It returns any error the source encounters.
-func (scw *SplitCloneWorker) processData(td *myproto.TableDefinition, tableIndex int, qrr *QueryResultReader, rowSplitter *RowSplitter, insertChannels []chan string, destinationPackCount int, abort <-chan struct{}) error {
+func (scw *SplitCloneWorker) processData(td *myproto.TableDefinition, tableIndex int, qrr *QueryResultReader, rowSplitter *RowSplitter, insertChannels []chan *insertCommand, inserts *sync.WaitGroup, rowCounts []uint64, destinationPackCount int, abort <-chan struct{}) error {
 	baseCmd := td.Name + "(" + strings.Join(td.Columns, ", ") + ") VALUES "
 	sr := rowSplitter.StartSplit()
 	packCount := 0
@@ -622,7 +785,8 @@ func (scw *SplitCloneWorker) processData(td *myproto.TableDefinition, tableIndex
 				// the return value, we don't care
 				// here if we're aborted)
 				if packCount > 0 {
-					rowSplitter.Send(qrr.Fields, sr, baseCmd, insertChannels, abort)
+					countRows(rowCounts, sr)
+					rowSplitter.Send(qrr.Fields, sr, baseCmd, insertChannels, inserts, abort)
 				}
 				return nil
 			}
@@ -641,7 +805,8 @@ func (scw *SplitCloneWorker) processData(td *myproto.TableDefinition, tableIndex
 			}
 
 			// send the rows to be inserted
-			if aborted := rowSplitter.Send(qrr.Fields, sr, baseCmd, insertChannels, abort); aborted {
+			countRows(rowCounts, sr)
+			if aborted := rowSplitter.Send(qrr.Fields, sr, baseCmd, insertChannels, inserts, abort); aborted {
 				return nil
 			}
 
@@ -661,3 +826,28 @@ func (scw *SplitCloneWorker) processData(td *myproto.TableDefinition, tableIndex
 		}
 	}
 }
+
+// countRows adds the number of rows split to each destination to
+// rowCounts.
+func countRows(rowCounts []uint64, sr [][][]sqltypes.Value) {
+	for i, rows := range sr {
+		rowCounts[i] += uint64(len(rows))
+	}
+}
+
+// waitForInserts waits until the inserts of a chunk ran. It returns
+// false if the copy was aborted first, in which case some of them never
+// will.
+func waitForInserts(ctx context.Context, inserts *sync.WaitGroup) bool {
+	done := make(chan struct{})
+	go func() {
+		inserts.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
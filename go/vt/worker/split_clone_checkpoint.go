@@ -0,0 +1,268 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package worker
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/context"
+
+	myproto "github.com/youtube/vitess/go/vt/mysqlctl/proto"
+	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/vt/wrangler"
+)
+
+// This file contains the checkpoint of a SplitClone, kept in the _vt
+// database of the destination masters, so a SplitClone that failed
+// can be run again with -resume and only copies what it didn't finish.
+// Its rows are keyed by job, so two jobs can't mix their state:
+// - _vt.split_clone_source has the tablet each source shard is copied
+//   from, and the position its replication was stopped at. A resumed
+//   copy has to read the same data, so it uses the same tablet, and
+//   only if it is still at that position.
+// - _vt.split_clone_chunk has the chunks that were copied, and how many
+//   rows each destination got. A chunk copied to all the destinations
+//   is skipped, the others have their rows deleted and are copied
+//   again. The row counts of a sample of the skipped chunks are checked
+//   first, so we don't resume on top of destinations that changed.
+
+// splitCloneCheckpointMaxRows is the most rows we read from the
+// checkpoint tables.
+const splitCloneCheckpointMaxRows = 1000000
+
+// splitCloneResumeSampleSize is how many of the copied chunks of each
+// table we check the row counts of before we skip them.
+const splitCloneResumeSampleSize = 3
+
+// splitCloneJob returns the identity the checkpoint of a SplitClone is
+// recorded with: its source shard, and the tables it excludes.
+func splitCloneJob(keyspace, shard string, excludeTables []string) string {
+	job := "SplitClone " + keyspace + "/" + shard
+	if len(excludeTables) > 0 {
+		tables := make([]string, len(excludeTables))
+		copy(tables, excludeTables)
+		sort.Strings(tables)
+		job += " exclude_tables=" + strings.Join(tables, ",")
+	}
+	return job
+}
+
+// createSplitCloneCheckpoint returns the statements to create the
+// checkpoint tables.
+func createSplitCloneCheckpoint() []string {
+	return []string{
+		"CREATE DATABASE IF NOT EXISTS _vt",
+		"CREATE TABLE IF NOT EXISTS _vt.split_clone_source (\n" +
+			"  job VARBINARY(250) NOT NULL,\n" +
+			"  source_shard VARBINARY(64) NOT NULL,\n" +
+			"  tablet_alias VARBINARY(64) NOT NULL,\n" +
+			"  pos VARCHAR(250) NOT NULL,\n" +
+			"  PRIMARY KEY (job, source_shard)) ENGINE=InnoDB",
+		"CREATE TABLE IF NOT EXISTS _vt.split_clone_chunk (\n" +
+			"  job VARBINARY(250) NOT NULL,\n" +
+			"  source_shard VARBINARY(64) NOT NULL,\n" +
+			"  table_name VARBINARY(64) NOT NULL,\n" +
+			"  chunk_start VARBINARY(128) NOT NULL,\n" +
+			"  chunk_end VARBINARY(128) NOT NULL,\n" +
+			"  row_count BIGINT UNSIGNED NOT NULL,\n" +
+			"  PRIMARY KEY (job, source_shard, table_name, chunk_start, chunk_end)) ENGINE=InnoDB",
+	}
+}
+
+// deleteSplitCloneCheckpoint returns the statements to delete the
+// checkpoint of a job, once its copy is complete.
+func deleteSplitCloneCheckpoint(job string) []string {
+	return []string{
+		fmt.Sprintf("DELETE FROM _vt.split_clone_source WHERE job='%v'", job),
+		fmt.Sprintf("DELETE FROM _vt.split_clone_chunk WHERE job='%v'", job),
+	}
+}
+
+// populateSplitCloneSource returns the statement to record the source
+// tablet of a source shard, and its position.
+func populateSplitCloneSource(job, sourceShard string, alias topo.TabletAlias, pos myproto.ReplicationPosition) string {
+	return fmt.Sprintf("REPLACE INTO _vt.split_clone_source "+
+		"(job, source_shard, tablet_alias, pos) "+
+		"VALUES ('%v', '%v', '%v', '%v')",
+		job, sourceShard, alias, myproto.EncodeReplicationPosition(pos))
+}
+
+// deleteSplitCloneChunks returns the statement to forget the chunks
+// copied from a source shard, when it is copied again from scratch.
+func deleteSplitCloneChunks(job, sourceShard string) string {
+	return fmt.Sprintf("DELETE FROM _vt.split_clone_chunk WHERE job='%v' AND source_shard='%v'", job, sourceShard)
+}
+
+// populateSplitCloneChunk returns the statement to record a copied
+// chunk, and the number of rows the destination got.
+func populateSplitCloneChunk(job string, chunk splitCloneChunk, rowCount uint64) string {
+	return fmt.Sprintf("REPLACE INTO _vt.split_clone_chunk "+
+		"(job, source_shard, table_name, chunk_start, chunk_end, row_count) "+
+		"VALUES ('%v', '%v', '%v', '%v', '%v', %v)",
+		job, chunk.sourceShard, chunk.table, chunk.start, chunk.end, rowCount)
+}
+
+// splitCloneSource is the recorded source of a source shard.
+type splitCloneSource struct {
+	alias topo.TabletAlias
+	pos   myproto.ReplicationPosition
+}
+
+// splitCloneChunk identifies a chunk of a table in a source shard.
+type splitCloneChunk struct {
+	sourceShard string
+	table       string
+	start       string
+	end         string
+}
+
+// splitCloneCheckpoint is what the destinations have recorded.
+type splitCloneCheckpoint struct {
+	sources map[string]splitCloneSource
+	// chunks has, for each copied chunk, the number of rows of each
+	// destination shard it was copied to.
+	chunks           map[splitCloneChunk]map[string]uint64
+	destinationCount int
+}
+
+// isCopied returns true if a chunk was copied to all the destinations.
+func (cp *splitCloneCheckpoint) isCopied(chunk splitCloneChunk) bool {
+	return len(cp.chunks[chunk]) == cp.destinationCount
+}
+
+// isEmpty returns true if nothing was recorded.
+func (cp *splitCloneCheckpoint) isEmpty() bool {
+	return len(cp.sources) == 0 && len(cp.chunks) == 0
+}
+
+// forgetSource drops what was recorded about a source shard.
+func (cp *splitCloneCheckpoint) forgetSource(sourceShard string) {
+	delete(cp.sources, sourceShard)
+	for chunk := range cp.chunks {
+		if chunk.sourceShard == sourceShard {
+			delete(cp.chunks, chunk)
+		}
+	}
+}
+
+// readSplitCloneCheckpoint creates the checkpoint tables on the
+// destination masters if needed, and reads the checkpoint of a job. It
+// fails if the destinations have the checkpoint of another job.
+func readSplitCloneCheckpoint(ctx context.Context, wr *wrangler.Wrangler, r Resolver, destinationShards []string, job string) (*splitCloneCheckpoint, error) {
+	cp := &splitCloneCheckpoint{
+		sources:          make(map[string]splitCloneSource),
+		chunks:           make(map[splitCloneChunk]map[string]uint64),
+		destinationCount: len(destinationShards),
+	}
+	for _, shard := range destinationShards {
+		if err := runSqlCommands(ctx, wr, r, shard, createSplitCloneCheckpoint()); err != nil {
+			return nil, fmt.Errorf("cannot create the checkpoint tables on destination shard %v: %v", shard, err)
+		}
+		ti, err := r.GetDestinationMaster(shard)
+		if err != nil {
+			return nil, err
+		}
+
+		shortCtx, cancel := context.WithTimeout(ctx, *remoteActionsTimeout)
+		qr, err := wr.TabletManagerClient().ExecuteFetchAsApp(shortCtx, ti, "SELECT job, source_shard, tablet_alias, pos FROM _vt.split_clone_source", splitCloneCheckpointMaxRows, false)
+		cancel()
+		if err != nil {
+			return nil, fmt.Errorf("cannot read _vt.split_clone_source on %v: %v", ti.Alias, err)
+		}
+		for _, row := range qr.Rows {
+			if row[0].String() != job {
+				return nil, fmt.Errorf("destination shard %v has the checkpoint of another job (%v): resume it first, or delete its rows from _vt.split_clone_source and _vt.split_clone_chunk on all the destination masters", shard, row[0].String())
+			}
+			alias, err := topo.ParseTabletAliasString(row[2].String())
+			if err != nil {
+				return nil, fmt.Errorf("bad tablet alias in _vt.split_clone_source on %v: %v", ti.Alias, err)
+			}
+			pos, err := myproto.DecodeReplicationPosition(row[3].String())
+			if err != nil {
+				return nil, fmt.Errorf("bad position in _vt.split_clone_source on %v: %v", ti.Alias, err)
+			}
+			source := splitCloneSource{alias: alias, pos: pos}
+			if other, ok := cp.sources[row[1].String()]; ok && (other.alias != source.alias || !other.pos.Equal(source.pos)) {
+				return nil, fmt.Errorf("destination masters don't agree on the source of shard %v: %v at %v, and %v at %v", row[1].String(), other.alias, other.pos, source.alias, source.pos)
+			}
+			cp.sources[row[1].String()] = source
+		}
+
+		shortCtx, cancel = context.WithTimeout(ctx, *remoteActionsTimeout)
+		qr, err = wr.TabletManagerClient().ExecuteFetchAsApp(shortCtx, ti, "SELECT job, source_shard, table_name, chunk_start, chunk_end, row_count FROM _vt.split_clone_chunk", splitCloneCheckpointMaxRows, false)
+		cancel()
+		if err != nil {
+			return nil, fmt.Errorf("cannot read _vt.split_clone_chunk on %v: %v", ti.Alias, err)
+		}
+		for _, row := range qr.Rows {
+			if row[0].String() != job {
+				return nil, fmt.Errorf("destination shard %v has the checkpoint of another job (%v): resume it first, or delete its rows from _vt.split_clone_source and _vt.split_clone_chunk on all the destination masters", shard, row[0].String())
+			}
+			rowCount, err := strconv.ParseUint(row[5].String(), 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("bad row count in _vt.split_clone_chunk on %v: %v", ti.Alias, err)
+			}
+			chunk := splitCloneChunk{
+				sourceShard: row[1].String(),
+				table:       row[2].String(),
+				start:       row[3].String(),
+				end:         row[4].String(),
+			}
+			if cp.chunks[chunk] == nil {
+				cp.chunks[chunk] = make(map[string]uint64)
+			}
+			cp.chunks[chunk][shard] = rowCount
+		}
+	}
+	return cp, nil
+}
+
+// verifySplitCloneChunk checks that each destination still has the
+// rows a previous run copied from a chunk. countSQL counts them, with
+// the database name as a template.
+func verifySplitCloneChunk(ctx context.Context, wr *wrangler.Wrangler, r Resolver, cp *splitCloneCheckpoint, chunk splitCloneChunk, countSQL string) error {
+	for shard, want := range cp.chunks[chunk] {
+		ti, err := r.GetDestinationMaster(shard)
+		if err != nil {
+			return err
+		}
+		query, err := fillStringTemplate(countSQL, map[string]string{"DatabaseName": ti.DbName()})
+		if err != nil {
+			return fmt.Errorf("fillStringTemplate failed: %v", err)
+		}
+		shortCtx, cancel := context.WithTimeout(ctx, *remoteActionsTimeout)
+		qr, err := wr.TabletManagerClient().ExecuteFetchAsApp(shortCtx, ti, query, 1, false)
+		cancel()
+		if err != nil {
+			return fmt.Errorf("cannot count the rows of table %v on %v: %v", chunk.table, ti.Alias, err)
+		}
+		if len(qr.Rows) != 1 || len(qr.Rows[0]) != 1 {
+			return fmt.Errorf("unexpected result counting the rows of table %v on %v: %v", chunk.table, ti.Alias, qr.Rows)
+		}
+		got, err := strconv.ParseUint(qr.Rows[0][0].String(), 10, 64)
+		if err != nil {
+			return fmt.Errorf("bad row count of table %v on %v: %v", chunk.table, ti.Alias, err)
+		}
+		if got != want {
+			return fmt.Errorf("table %v has %v rows between '%v' and '%v' from %v on %v, the previous run copied %v: the destination changed since, it has to be cleared and copied again without -resume", chunk.table, got, chunk.start, chunk.end, chunk.sourceShard, ti.Alias, want)
+		}
+	}
+	return nil
+}
+
+// sampleChunks returns at most count of the chunks, spread over them.
+func sampleChunks(chunks []splitCloneChunk, count int) []splitCloneChunk {
+	if len(chunks) <= count {
+		return chunks
+	}
+	result := make([]splitCloneChunk, count)
+	for i := range result {
+		result[i] = chunks[i*len(chunks)/count]
+	}
+	return result
+}
@@ -8,12 +8,13 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
-	"sync/atomic"
+	"sync"
 	"testing"
 	"time"
 
 	mproto "github.com/youtube/vitess/go/mysql/proto"
 	"github.com/youtube/vitess/go/sqltypes"
+	"github.com/youtube/vitess/go/vt/binlog/binlogplayer"
 	"github.com/youtube/vitess/go/vt/dbconnpool"
 	"github.com/youtube/vitess/go/vt/key"
 	"github.com/youtube/vitess/go/vt/logutil"
@@ -206,44 +207,149 @@ func SourceRdonlyFactory(t *testing.T) func() (dbconnpool.PoolConnection, error)
 	}
 }
 
-// on the destinations
-func DestinationsFactory(t *testing.T, insertCount int64) func() (dbconnpool.PoolConnection, error) {
-	var queryIndex int64 = -1
+// FakeDestination answers the queries of a destination master, with
+// the rows of the checkpoint tables of a previous run, and counts them.
+type FakeDestination struct {
+	t *testing.T
+
+	Sources [][]sqltypes.Value
+	Chunks  [][]sqltypes.Value
+	// RowCount is the number of rows of table1 it has in each chunk.
+	RowCount int
+
+	mu            sync.Mutex
+	failedInsert  bool
+	Inserts       int
+	Deletes       int
+	Counts        int
+	SourceRecords int
+	ChunkRecords  int
+}
+
+// fakeDestinationConnection sends its queries to a FakeDestination.
+type fakeDestinationConnection struct {
+	*FakePoolConnection
+	fd *FakeDestination
+}
+
+func (fdc fakeDestinationConnection) ExecuteFetch(query string, maxrows int, wantfields bool) (*mproto.QueryResult, error) {
+	return fdc.fd.executeFetch(query)
+}
 
+// Factory returns the DbAppConnectionFactory of the destination.
+func (fd *FakeDestination) Factory() func() (dbconnpool.PoolConnection, error) {
 	return func() (dbconnpool.PoolConnection, error) {
-		qi := atomic.AddInt64(&queryIndex, 1)
-		switch {
-		// Return an error on the first query, to make sure that it's retried successfully
-		case qi == 0:
-			return NewFakePoolConnectionQuery(t,
-				"INSERT INTO `vt_ks`.table1(id, msg, keyspace_id) VALUES (*",
-				fmt.Errorf("The MariaDB server is running with the --read-only option so it cannot execute this statement (errno 1290) during query:"),
-			), nil
-		case qi <= insertCount:
-			return NewFakePoolConnectionQuery(t, "INSERT INTO `vt_ks`.table1(id, msg, keyspace_id) VALUES (*", nil), nil
-		case qi == insertCount+1:
-			return NewFakePoolConnectionQuery(t, "CREATE DATABASE IF NOT EXISTS _vt", nil), nil
-		case qi == insertCount+2:
-			return NewFakePoolConnectionQuery(t, "CREATE TABLE IF NOT EXISTS _vt.blp_checkpoint (\n"+
-				"  source_shard_uid INT(10) UNSIGNED NOT NULL,\n"+
-				"  pos VARCHAR(250) DEFAULT NULL,\n"+
-				"  time_updated BIGINT UNSIGNED NOT NULL,\n"+
-				"  transaction_timestamp BIGINT UNSIGNED NOT NULL,\n"+
-				"  flags VARCHAR(250) DEFAULT NULL,\n"+
-				"  PRIMARY KEY (source_shard_uid)) ENGINE=InnoDB", nil), nil
-		case qi == insertCount+3:
-			return NewFakePoolConnectionQuery(t, "INSERT INTO _vt.blp_checkpoint (source_shard_uid, pos, time_updated, transaction_timestamp, flags) VALUES (0, 'MariaDB/12-34-5678', *", nil), nil
-		}
+		return fakeDestinationConnection{&FakePoolConnection{t: fd.t}, fd}, nil
+	}
+}
 
-		return nil, fmt.Errorf("Unexpected connection")
+func (fd *FakeDestination) executeFetch(query string) (*mproto.QueryResult, error) {
+	fd.mu.Lock()
+	defer fd.mu.Unlock()
+	fd.t.Logf("ExecuteFetch: %v", query)
+	for _, q := range append(append(createSplitCloneCheckpoint(), deleteSplitCloneCheckpoint("SplitClone ks/-80")...), binlogplayer.CreateBlpCheckpoint()...) {
+		if query == q {
+			return &mproto.QueryResult{}, nil
+		}
 	}
+	switch {
+	case strings.HasPrefix(query, "INSERT INTO `vt_ks`.table1(id, msg, keyspace_id) VALUES ("):
+		// Return an error on the first insert, to make sure that it's retried successfully
+		if !fd.failedInsert {
+			fd.failedInsert = true
+			return nil, fmt.Errorf("The MariaDB server is running with the --read-only option so it cannot execute this statement (errno 1290) during query:")
+		}
+		fd.Inserts++
+	case strings.HasPrefix(query, "DELETE FROM `vt_ks`.table1 WHERE ") && strings.HasSuffix(query, " AND keyspace_id<9223372036854775808"):
+		fd.Deletes++
+	case strings.HasPrefix(query, "SELECT COUNT(*) FROM `vt_ks`.table1 WHERE ") && strings.HasSuffix(query, " AND keyspace_id<9223372036854775808"):
+		fd.Counts++
+		return &mproto.QueryResult{Rows: [][]sqltypes.Value{{sqltypes.MakeString([]byte(fmt.Sprintf("%v", fd.RowCount)))}}}, nil
+	case query == "SELECT job, source_shard, tablet_alias, pos FROM _vt.split_clone_source":
+		return &mproto.QueryResult{Rows: fd.Sources}, nil
+	case query == "SELECT job, source_shard, table_name, chunk_start, chunk_end, row_count FROM _vt.split_clone_chunk":
+		return &mproto.QueryResult{Rows: fd.Chunks}, nil
+	case query == "DELETE FROM _vt.split_clone_chunk WHERE job='SplitClone ks/-80' AND source_shard='-80'":
+	case strings.HasPrefix(query, "REPLACE INTO _vt.split_clone_source (job, source_shard, tablet_alias, pos) VALUES ('SplitClone ks/-80', '-80', 'cell1-000000000") && strings.HasSuffix(query, "', 'MariaDB/12-34-5678')"):
+		fd.SourceRecords++
+	case strings.HasPrefix(query, "REPLACE INTO _vt.split_clone_chunk (job, source_shard, table_name, chunk_start, chunk_end, row_count) VALUES ('SplitClone ks/-80', '-80', 'table1', ") && strings.HasSuffix(query, "', 5)"):
+		fd.ChunkRecords++
+	case strings.HasPrefix(query, "INSERT INTO _vt.blp_checkpoint (source_shard_uid, pos, time_updated, transaction_timestamp, flags) VALUES (0, 'MariaDB/12-34-5678', "):
+	default:
+		fd.t.Errorf("got unexpected query: %v", query)
+		return nil, fmt.Errorf("unexpected query")
+	}
+	return &mproto.QueryResult{}, nil
 }
 
 func TestSplitClonePopulateBlpCheckpoint(t *testing.T) {
-	testSplitClone(t, "-populate_blp_checkpoint")
+	left, right := testSplitClone(t, "-populate_blp_checkpoint", false, nil, nil, nil, "")
+
+	// We read 100 source rows. sourceReaderCount is set to 10, so
+	// we'll have 100/10=10 rows per table chunk.
+	// destinationPackCount is set to 4, so we take 4 source rows
+	// at once. So we'll process 4 + 4 + 2 rows to get to 10.
+	// That means 3 insert statements on each target (each
+	// containing half of the rows, i.e. 2 + 2 + 1 rows). So 3 * 10
+	// = 30 insert statements on each destination.
+	for _, fd := range []*FakeDestination{left, right} {
+		if fd.Inserts != 30 || fd.Deletes != 0 || fd.Counts != 0 || fd.SourceRecords != 1 || fd.ChunkRecords != 10 {
+			t.Errorf("got %v inserts, %v deletes, %v counts, %v source records and %v chunk records, want 30, 0, 0, 1 and 10", fd.Inserts, fd.Deletes, fd.Counts, fd.SourceRecords, fd.ChunkRecords)
+		}
+	}
 }
 
-func testSplitClone(t *testing.T, strategy string) {
+// previousRun returns the checkpoint rows of a previous run of job that
+// copied the first 4 chunks to both destinations, and the fifth one to
+// the left one only.
+func previousRun(job string) (sources, leftChunks, rightChunks [][]sqltypes.Value) {
+	sources = [][]sqltypes.Value{
+		{sqltypes.MakeString([]byte(job)), sqltypes.MakeString([]byte("-80")), sqltypes.MakeString([]byte("cell1-0000000001")), sqltypes.MakeString([]byte("MariaDB/12-34-5678"))},
+	}
+	for _, bounds := range [][]string{{"", "110"}, {"110", "120"}, {"120", "130"}, {"130", "140"}, {"140", "150"}} {
+		leftChunks = append(leftChunks, []sqltypes.Value{
+			sqltypes.MakeString([]byte(job)),
+			sqltypes.MakeString([]byte("-80")),
+			sqltypes.MakeString([]byte("table1")),
+			sqltypes.MakeString([]byte(bounds[0])),
+			sqltypes.MakeString([]byte(bounds[1])),
+			sqltypes.MakeString([]byte("5")),
+		})
+	}
+	return sources, leftChunks, leftChunks[:4]
+}
+
+func TestSplitCloneResume(t *testing.T) {
+	sources, leftChunks, rightChunks := previousRun("SplitClone ks/-80")
+	left, right := testSplitClone(t, "-populate_blp_checkpoint", true, sources, leftChunks, rightChunks, "")
+
+	// The row counts of 3 of the 4 copied chunks are checked, and
+	// the 6 other chunks are deleted and copied again.
+	for _, fd := range []*FakeDestination{left, right} {
+		if fd.Inserts != 18 || fd.Deletes != 6 || fd.Counts != 3 || fd.SourceRecords != 0 || fd.ChunkRecords != 6 {
+			t.Errorf("got %v inserts, %v deletes, %v counts, %v source records and %v chunk records, want 18, 6, 3, 0 and 6", fd.Inserts, fd.Deletes, fd.Counts, fd.SourceRecords, fd.ChunkRecords)
+		}
+	}
+}
+
+func TestSplitCloneResumeFailures(t *testing.T) {
+	sources, leftChunks, rightChunks := previousRun("SplitClone ks/-80")
+	testSplitClone(t, "-populate_blp_checkpoint", false, sources, leftChunks, rightChunks, "run it again with -resume")
+
+	// the destination lost rows since the previous run
+	for _, chunk := range rightChunks {
+		chunk[5] = sqltypes.MakeString([]byte("6"))
+	}
+	testSplitClone(t, "-populate_blp_checkpoint", true, sources, leftChunks, rightChunks, "the previous run copied 6")
+
+	sources, leftChunks, rightChunks = previousRun("SplitClone ks/-80 exclude_tables=table2")
+	testSplitClone(t, "-populate_blp_checkpoint", true, sources, leftChunks, rightChunks, "has the checkpoint of another job (SplitClone ks/-80 exclude_tables=table2)")
+}
+
+// testSplitClone runs a SplitClone of ks/-80 to ks/-40 and ks/40-80,
+// whose masters have the checkpoint rows of a previous run. It checks
+// it fails with wantErr, or succeeds if wantErr is empty.
+func testSplitClone(t *testing.T, strategy string, resume bool, sources, leftChunks, rightChunks [][]sqltypes.Value, wantErr string) (*FakeDestination, *FakeDestination) {
 	ts := zktopo.NewTestServer(t, []string{"cell1", "cell2"})
 	wr := wrangler.New(logutil.NewConsoleLogger(), ts, tmclient.NewTabletManagerClient(), time.Second)
 
@@ -281,7 +387,7 @@ func testSplitClone(t *testing.T, strategy string) {
 		t.Fatalf("RebuildKeyspaceGraph failed: %v", err)
 	}
 
-	gwrk, err := NewSplitCloneWorker(wr, "cell1", "ks", "-80", nil, strategy, 10 /*sourceReaderCount*/, 4 /*destinationPackCount*/, 1 /*minTableSizeForSplit*/, 10 /*destinationWriterCount*/)
+	gwrk, err := NewSplitCloneWorker(wr, "cell1", "ks", "-80", nil, strategy, 10 /*sourceReaderCount*/, 4 /*destinationPackCount*/, 1 /*minTableSizeForSplit*/, 10 /*destinationWriterCount*/, resume)
 	if err != nil {
 		t.Errorf("Worker creation failed: %v", err)
 	}
@@ -312,17 +418,10 @@ func testSplitClone(t *testing.T, strategy string) {
 		sourceRdonly.RPCServer.Register(gorpcqueryservice.New(&testQueryService{t: t}))
 	}
 
-	// We read 100 source rows. sourceReaderCount is set to 10, so
-	// we'll have 100/10=10 rows per table chunk.
-	// destinationPackCount is set to 4, so we take 4 source rows
-	// at once. So we'll process 4 + 4 + 2 rows to get to 10.
-	// That means 3 insert statements on each target (each
-	// containing half of the rows, i.e. 2 + 2 + 1 rows). So 3 * 10
-	// = 30 insert statements on each destination.
-	leftMaster.FakeMysqlDaemon.DbAppConnectionFactory = DestinationsFactory(t, 30)
-	leftRdonly.FakeMysqlDaemon.DbAppConnectionFactory = DestinationsFactory(t, 30)
-	rightMaster.FakeMysqlDaemon.DbAppConnectionFactory = DestinationsFactory(t, 30)
-	rightRdonly.FakeMysqlDaemon.DbAppConnectionFactory = DestinationsFactory(t, 30)
+	left := &FakeDestination{t: t, Sources: sources, Chunks: leftChunks, RowCount: 5}
+	right := &FakeDestination{t: t, Sources: sources, Chunks: rightChunks, RowCount: 5}
+	leftMaster.FakeMysqlDaemon.DbAppConnectionFactory = left.Factory()
+	rightMaster.FakeMysqlDaemon.DbAppConnectionFactory = right.Factory()
 
 	// Only wait 1 ms between retries, so that the test passes faster
 	*executeFetchRetryTime = (1 * time.Millisecond)
@@ -330,6 +429,12 @@ func testSplitClone(t *testing.T, strategy string) {
 	err = wrk.Run(ctx)
 	status := wrk.StatusAsText()
 	t.Logf("Got status: %v", status)
+	if wantErr != "" {
+		if err == nil || !strings.Contains(err.Error(), wantErr) {
+			t.Errorf("Worker run returned %v, want error containing %q", err, wantErr)
+		}
+		return left, right
+	}
 	if err != nil || wrk.State != WorkerStateDone {
 		t.Errorf("Worker run failed")
 	}
@@ -343,4 +448,5 @@ func testSplitClone(t *testing.T, strategy string) {
 	if statsRetryCounters.String() != "{\"ReadOnly\": 2}" {
 		t.Errorf("Wrong statsRetryCounters: wanted %v, got %v", "{\"ReadOnly\": 2}", statsRetryCounters.String())
 	}
+	return left, right
 }
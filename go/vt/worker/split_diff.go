@@ -45,6 +45,8 @@ type SplitDiffWorker struct {
 	// populated during WorkerStateDiff
 	sourceSchemaDefinitions     []*myproto.SchemaDefinition
 	destinationSchemaDefinition *myproto.SchemaDefinition
+	// tableStatuses has the result of the diff of each table
+	tableStatuses []string
 }
 
 // NewSplitDiffWorker returns a new SplitDiffWorker object.
@@ -72,6 +74,9 @@ func (sdw *SplitDiffWorker) StatusAsHTML() template.HTML {
 	case WorkerStateDone:
 		result += "<b>Success.</b></br>\n"
 	}
+	for _, status := range sdw.tableStatuses {
+		result += template.HTMLEscapeString(status) + "</br>\n"
+	}
 
 	return template.HTML(result)
 }
@@ -88,23 +93,16 @@ func (sdw *SplitDiffWorker) StatusAsText() string {
 	case WorkerStateDone:
 		result += "Success.\n"
 	}
+	for _, status := range sdw.tableStatuses {
+		result += status + "\n"
+	}
 	return result
 }
 
 // Run is mostly a wrapper to run the cleanup at the end.
 func (sdw *SplitDiffWorker) Run(ctx context.Context) error {
 	resetVars()
-	err := sdw.run(ctx)
-
-	sdw.SetState(WorkerStateCleanUp)
-	cerr := sdw.cleaner.CleanUp(sdw.wr)
-	if cerr != nil {
-		if err != nil {
-			sdw.wr.Logger().Errorf("CleanUp failed in addition to job error: %v", cerr)
-		} else {
-			err = cerr
-		}
-	}
+	err := runAndCleanUp(ctx, sdw.wr, sdw.cleaner, func() { sdw.SetState(WorkerStateCleanUp) }, sdw.run)
 	if err != nil {
 		sdw.SetState(WorkerStateError)
 		return err
@@ -118,7 +116,7 @@ func (sdw *SplitDiffWorker) run(ctx context.Context) error {
 	if err := sdw.init(); err != nil {
 		return fmt.Errorf("init() failed: %v", err)
 	}
-	if err := checkDone(ctx); err != nil {
+	if err := sdw.checkInterrupted(ctx); err != nil {
 		return err
 	}
 
@@ -126,7 +124,7 @@ func (sdw *SplitDiffWorker) run(ctx context.Context) error {
 	if err := sdw.findTargets(ctx); err != nil {
 		return fmt.Errorf("findTargets() failed: %v", err)
 	}
-	if err := checkDone(ctx); err != nil {
+	if err := sdw.checkInterrupted(ctx); err != nil {
 		return err
 	}
 
@@ -134,7 +132,7 @@ func (sdw *SplitDiffWorker) run(ctx context.Context) error {
 	if err := sdw.synchronizeReplication(ctx); err != nil {
 		return fmt.Errorf("synchronizeReplication() failed: %v", err)
 	}
-	if err := checkDone(ctx); err != nil {
+	if err := sdw.checkInterrupted(ctx); err != nil {
 		return err
 	}
 
@@ -321,6 +319,7 @@ func (sdw *SplitDiffWorker) synchronizeReplication(ctx context.Context) error {
 // - get the schema on all checkers
 // - if some table schema mismatches, record them (use existing schema diff tools).
 // - for each table in destination, run a diff pipeline.
+// It returns an error if some table has differences.
 
 func (sdw *SplitDiffWorker) diff(ctx context.Context) error {
 	sdw.SetState(WorkerStateDiff)
@@ -374,58 +373,88 @@ func (sdw *SplitDiffWorker) diff(ctx context.Context) error {
 
 	// run the diffs, 8 at a time
 	sdw.wr.Logger().Infof("Running the diffs...")
+	sdw.Mu.Lock()
+	sdw.tableStatuses = make([]string, len(sdw.destinationSchemaDefinition.TableDefinitions))
+	for i, tableDefinition := range sdw.destinationSchemaDefinition.TableDefinitions {
+		sdw.tableStatuses[i] = tableDefinition.Name + ": diff not started"
+	}
+	sdw.Mu.Unlock()
+	setTableStatus := func(tableIndex int, format string, args ...interface{}) {
+		sdw.Mu.Lock()
+		sdw.tableStatuses[tableIndex] = sdw.destinationSchemaDefinition.TableDefinitions[tableIndex].Name + ": " + fmt.Sprintf(format, args...)
+		sdw.Mu.Unlock()
+	}
+	diffRec := concurrency.AllErrorRecorder{}
 	sem := sync2.NewSemaphore(8, 0)
-	for _, tableDefinition := range sdw.destinationSchemaDefinition.TableDefinitions {
+	for tableIndex, tableDefinition := range sdw.destinationSchemaDefinition.TableDefinitions {
 		wg.Add(1)
-		go func(tableDefinition *myproto.TableDefinition) {
+		go func(tableIndex int, tableDefinition *myproto.TableDefinition) {
 			defer wg.Done()
 			sem.Acquire()
 			defer sem.Release()
 
+			// a cancelled diff stops between two tables
+			if sdw.isCancelled() {
+				setTableStatus(tableIndex, "diff cancelled")
+				return
+			}
 			sdw.wr.Logger().Infof("Starting the diff on table %v", tableDefinition.Name)
+			setTableStatus(tableIndex, "diff running")
+			failed := func(format string, args ...interface{}) {
+				err := fmt.Errorf(format, args...)
+				sdw.wr.Logger().Errorf("%v", err)
+				setTableStatus(tableIndex, "diff failed: %v", err)
+				diffRec.RecordError(fmt.Errorf("table %v: %v", tableDefinition.Name, err))
+			}
 			if len(sdw.sourceAliases) != 1 {
-				sdw.wr.Logger().Errorf("Don't support more than one source for table yet: %v", tableDefinition.Name)
+				failed("Don't support more than one source for table yet")
 				return
 			}
 
 			overlap, err := key.KeyRangesOverlap(sdw.shardInfo.KeyRange, sdw.shardInfo.SourceShards[0].KeyRange)
 			if err != nil {
-				sdw.wr.Logger().Errorf("Source shard doesn't overlap with destination????: %v", err)
+				failed("Source shard doesn't overlap with destination????: %v", err)
 				return
 			}
 			sourceQueryResultReader, err := TableScanByKeyRange(ctx, sdw.wr.Logger(), sdw.wr.TopoServer(), sdw.sourceAliases[0], tableDefinition, overlap, sdw.keyspaceInfo.ShardingColumnType)
 			if err != nil {
-				sdw.wr.Logger().Errorf("TableScanByKeyRange(source) failed: %v", err)
+				failed("TableScanByKeyRange(source) failed: %v", err)
 				return
 			}
 			defer sourceQueryResultReader.Close()
 
 			destinationQueryResultReader, err := TableScanByKeyRange(ctx, sdw.wr.Logger(), sdw.wr.TopoServer(), sdw.destinationAlias, tableDefinition, key.KeyRange{}, sdw.keyspaceInfo.ShardingColumnType)
 			if err != nil {
-				sdw.wr.Logger().Errorf("TableScanByKeyRange(destination) failed: %v", err)
+				failed("TableScanByKeyRange(destination) failed: %v", err)
 				return
 			}
 			defer destinationQueryResultReader.Close()
 
 			differ, err := NewRowDiffer(sourceQueryResultReader, destinationQueryResultReader, tableDefinition)
 			if err != nil {
-				sdw.wr.Logger().Errorf("NewRowDiffer() failed: %v", err)
+				failed("NewRowDiffer() failed: %v", err)
 				return
 			}
 
 			report, err := differ.Go(sdw.wr.Logger())
 			if err != nil {
-				sdw.wr.Logger().Errorf("Differ.Go failed: %v", err.Error())
-			} else {
-				if report.HasDifferences() {
-					sdw.wr.Logger().Warningf("Table %v has differences: %v", tableDefinition.Name, report.String())
-				} else {
-					sdw.wr.Logger().Infof("Table %v checks out (%v rows processed, %v qps)", tableDefinition.Name, report.processedRows, report.processingQPS)
-				}
+				failed("Differ.Go failed: %v", err)
+				return
 			}
-		}(tableDefinition)
+			if report.HasDifferences() {
+				sdw.wr.Logger().Warningf("Table %v has differences: %v", tableDefinition.Name, report.String())
+				setTableStatus(tableIndex, "%v differences: %v", report.DifferenceCount(), report.String())
+				diffRec.RecordError(fmt.Errorf("table %v has %v differences", tableDefinition.Name, report.DifferenceCount()))
+				return
+			}
+			sdw.wr.Logger().Infof("Table %v checks out (%v rows processed, %v qps)", tableDefinition.Name, report.processedRows, report.processingQPS)
+			setTableStatus(tableIndex, "checks out (%v rows processed)", report.processedRows)
+		}(tableIndex, tableDefinition)
 	}
 	wg.Wait()
 
-	return nil
+	if diffRec.HasErrors() {
+		return diffRec.Error()
+	}
+	return sdw.checkInterrupted(ctx)
 }
@@ -34,6 +34,11 @@ type destinationSqlQuery struct {
 	queryservice.ErrorQueryService
 	t             *testing.T
 	excludedTable string
+	// differs makes the destination have a different row 5, and
+	// miss rows 7 and 99.
+	differs bool
+	// onQuery is called before each query, if set.
+	onQuery func()
 }
 
 func (sq *destinationSqlQuery) StreamExecute(ctx context.Context, query *proto.Query, sendReply func(reply *mproto.QueryResult) error) error {
@@ -46,6 +51,9 @@ func (sq *destinationSqlQuery) StreamExecute(ctx context.Context, query *proto.Q
 	}
 
 	sq.t.Logf("destinationSqlQuery: got query: %v", *query)
+	if sq.onQuery != nil {
+		sq.onQuery()
+	}
 
 	// Send the headers
 	if err := sendReply(&mproto.QueryResult{
@@ -70,11 +78,20 @@ func (sq *destinationSqlQuery) StreamExecute(ctx context.Context, query *proto.Q
 	// Send the values
 	ksids := []uint64{0x2000000000000000, 0x6000000000000000}
 	for i := 0; i < 100; i++ {
+		msg := fmt.Sprintf("Text for %v", i)
+		if sq.differs {
+			if i == 7 || i == 99 {
+				continue
+			}
+			if i == 5 {
+				msg = "Other text"
+			}
+		}
 		if err := sendReply(&mproto.QueryResult{
 			Rows: [][]sqltypes.Value{
 				[]sqltypes.Value{
 					sqltypes.MakeString([]byte(fmt.Sprintf("%v", i))),
-					sqltypes.MakeString([]byte(fmt.Sprintf("Text for %v", i))),
+					sqltypes.MakeString([]byte(msg)),
 					sqltypes.MakeString([]byte(fmt.Sprintf("%v", ksids[i%2]))),
 				},
 			},
@@ -144,9 +161,57 @@ func (sq *sourceSqlQuery) StreamExecute(ctx context.Context, query *proto.Query,
 	return nil
 }
 
-// TODO(aaijazi): Create a test in which source and destination data does not match
-
 func TestSplitDiff(t *testing.T) {
+	wrk, err := testSplitDiff(t, false, false)
+	if err != nil || wrk.State != WorkerStateDone {
+		t.Errorf("Worker run failed: %v", err)
+	}
+}
+
+func TestSplitDiffDifferences(t *testing.T) {
+	wrk, err := testSplitDiff(t, true, false)
+	if err == nil || !strings.Contains(err.Error(), "table table1 has 3 differences") {
+		t.Errorf("Run() = %v, want the differences of table1", err)
+	}
+	status := wrk.StatusAsText()
+	if want := "table1: 3 differences: DiffReport{100 processed, 97 matching, 1 mismatched, 2 extra left, 0 extra right"; !strings.Contains(status, want) {
+		t.Errorf("status %q doesn't contain %q", status, want)
+	}
+	if want := "different PKs: (5) (7) (99)}"; !strings.Contains(status, want) {
+		t.Errorf("status %q doesn't contain %q", status, want)
+	}
+
+	checkSplitDiffCleanedUp(t, wrk)
+}
+
+func TestSplitDiffCancel(t *testing.T) {
+	wrk, err := testSplitDiff(t, false, true)
+	if err == nil || !strings.Contains(err.Error(), ErrWorkerCancelled.Error()) {
+		t.Errorf("Run() = %v, want %v", err, ErrWorkerCancelled)
+	}
+	if wrk.State != WorkerStateError {
+		t.Errorf("got state %v after the cancel, want %v", wrk.State, WorkerStateError)
+	}
+	checkSplitDiffCleanedUp(t, wrk)
+}
+
+// checkSplitDiffCleanedUp checks the cleaners ran: the checkers must be
+// back out of the worker type.
+func checkSplitDiffCleanedUp(t *testing.T, wrk *SplitDiffWorker) {
+	for _, alias := range append([]topo.TabletAlias{wrk.destinationAlias}, wrk.sourceAliases...) {
+		ti, err := wrk.wr.TopoServer().GetTablet(alias)
+		if err != nil {
+			t.Fatalf("GetTablet(%v) failed: %v", alias, err)
+		}
+		if ti.Type == topo.TYPE_WORKER {
+			t.Errorf("tablet %v was left as a worker", alias)
+		}
+	}
+}
+
+// testSplitDiff runs a SplitDiff. With cancel, the worker is cancelled
+// while it diffs the first table.
+func testSplitDiff(t *testing.T, destinationDiffers, cancel bool) (*SplitDiffWorker, error) {
 	ts := zktopo.NewTestServer(t, []string{"cell1", "cell2"})
 	// We need to use FakeTabletManagerClient because we don't have a good way to fake the binlog player yet,
 	// which is necessary for synchronizing replication.
@@ -216,15 +281,24 @@ func TestSplitDiff(t *testing.T) {
 		}
 	}
 
-	leftRdonly1.RPCServer.Register(gorpcqueryservice.New(&destinationSqlQuery{t: t, excludedTable: excludedTable}))
-	leftRdonly2.RPCServer.Register(gorpcqueryservice.New(&destinationSqlQuery{t: t, excludedTable: excludedTable}))
+	var onQuery func()
+	if cancel {
+		onQuery = func() {
+			wrk.Cancel()
+			wrk.Mu.Lock()
+			defer wrk.Mu.Unlock()
+			if wrk.State != WorkerStateCancelling {
+				t.Errorf("got state %v after Cancel(), want %v", wrk.State, WorkerStateCancelling)
+			}
+		}
+	}
+	leftRdonly1.RPCServer.Register(gorpcqueryservice.New(&destinationSqlQuery{t: t, excludedTable: excludedTable, differs: destinationDiffers, onQuery: onQuery}))
+	leftRdonly2.RPCServer.Register(gorpcqueryservice.New(&destinationSqlQuery{t: t, excludedTable: excludedTable, differs: destinationDiffers, onQuery: onQuery}))
 	sourceRdonly1.RPCServer.Register(gorpcqueryservice.New(&sourceSqlQuery{t: t, excludedTable: excludedTable}))
 	sourceRdonly2.RPCServer.Register(gorpcqueryservice.New(&sourceSqlQuery{t: t, excludedTable: excludedTable}))
 
 	err := wrk.Run(ctx)
 	status := wrk.StatusAsText()
 	t.Logf("Got status: %v", status)
-	if err != nil || wrk.State != WorkerStateDone {
-		t.Errorf("Worker run failed")
-	}
+	return wrk, err
 }
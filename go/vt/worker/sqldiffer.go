@@ -93,17 +93,7 @@ func (worker *SQLDiffWorker) StatusAsText() string {
 // Run is mostly a wrapper to run the cleanup at the end.
 func (worker *SQLDiffWorker) Run(ctx context.Context) error {
 	resetVars()
-	err := worker.run(ctx)
-
-	worker.SetState(WorkerStateCleanUp)
-	cerr := worker.cleaner.CleanUp(worker.wr)
-	if cerr != nil {
-		if err != nil {
-			worker.wr.Logger().Errorf("CleanUp failed in addition to job error: %v", cerr)
-		} else {
-			err = cerr
-		}
-	}
+	err := runAndCleanUp(ctx, worker.wr, worker.cleaner, func() { worker.SetState(WorkerStateCleanUp) }, worker.run)
 	if err != nil {
 		worker.SetState(WorkerStateError)
 		return err
@@ -117,7 +107,7 @@ func (worker *SQLDiffWorker) run(ctx context.Context) error {
 	if err := worker.findTargets(ctx); err != nil {
 		return err
 	}
-	if err := checkDone(ctx); err != nil {
+	if err := worker.checkInterrupted(ctx); err != nil {
 		return err
 	}
 
@@ -125,7 +115,7 @@ func (worker *SQLDiffWorker) run(ctx context.Context) error {
 	if err := worker.synchronizeReplication(ctx); err != nil {
 		return err
 	}
-	if err := checkDone(ctx); err != nil {
+	if err := worker.checkInterrupted(ctx); err != nil {
 		return err
 	}
 
@@ -180,9 +170,6 @@ func (worker *SQLDiffWorker) synchronizeReplication(ctx context.Context) error {
 	if err != nil {
 		return fmt.Errorf("Cannot stop slave %v: %v", worker.subset.alias, err)
 	}
-	if err := checkDone(ctx); err != nil {
-		return err
-	}
 
 	// change the cleaner actions from ChangeSlaveType(rdonly)
 	// to StartSlave() + ChangeSlaveType(spare)
@@ -192,6 +179,9 @@ func (worker *SQLDiffWorker) synchronizeReplication(ctx context.Context) error {
 		return fmt.Errorf("cannot find ChangeSlaveType action for %v: %v", worker.subset.alias, err)
 	}
 	action.TabletType = topo.TYPE_SPARE
+	if err := checkDone(ctx); err != nil {
+		return err
+	}
 
 	// sleep for a few seconds
 	time.Sleep(5 * time.Second)
@@ -5,8 +5,11 @@
 package worker
 
 import (
+	"errors"
 	"html/template"
 	"sync"
+
+	"golang.org/x/net/context"
 )
 
 // StatusWorkerState is the type for a StatusWorker's status
@@ -25,8 +28,13 @@ const (
 	WorkerStateCopy            StatusWorkerState = "copying the data"
 	WorkerStateDiff            StatusWorkerState = "running the diff"
 	WorkerStateCleanUp         StatusWorkerState = "cleaning up"
+	WorkerStateCancelling      StatusWorkerState = "cancelling"
 )
 
+// ErrWorkerCancelled is the error of a worker that stopped because it
+// was cancelled.
+var ErrWorkerCancelled = errors.New("the worker was cancelled")
+
 func (state StatusWorkerState) String() string {
 	return string(state)
 }
@@ -45,6 +53,9 @@ type StatusWorker struct {
 	// State contains the worker's current state, and should only
 	// be accessed under Mu.
 	State StatusWorkerState
+
+	// cancelled is set by Cancel, under Mu.
+	cancelled bool
 }
 
 // NewStatusWorker returns a StatusWorker in state WorkerStateNotSarted
@@ -55,14 +66,58 @@ func NewStatusWorker() StatusWorker {
 	}
 }
 
-// SetState is a convenience function for workers
+// SetState is a convenience function for workers. Once the worker
+// was cancelled, it stays in WorkerStateCancelling until it cleans up.
 func (worker *StatusWorker) SetState(state StatusWorkerState) {
 	worker.Mu.Lock()
+	switch state {
+	case WorkerStateCleanUp, WorkerStateDone, WorkerStateError:
+	default:
+		if worker.cancelled {
+			state = WorkerStateCancelling
+		}
+	}
 	worker.State = state
 	statsState.Set(string(state))
 	worker.Mu.Unlock()
 }
 
+// Cancel is part of the Worker interface
+func (worker *StatusWorker) Cancel() {
+	worker.Mu.Lock()
+	defer worker.Mu.Unlock()
+	if worker.cancelled {
+		return
+	}
+	worker.cancelled = true
+	switch worker.State {
+	case WorkerStateCleanUp, WorkerStateDone, WorkerStateError:
+	default:
+		worker.State = WorkerStateCancelling
+		statsState.Set(string(worker.State))
+	}
+}
+
+// isCancelled returns true once the worker was cancelled.
+func (worker *StatusWorker) isCancelled() bool {
+	worker.Mu.Lock()
+	defer worker.Mu.Unlock()
+	return worker.cancelled
+}
+
+// checkInterrupted returns ctx.Err() iff ctx.Done(), or
+// ErrWorkerCancelled if the worker was cancelled. Workers call it
+// between two chunks of work.
+func (worker *StatusWorker) checkInterrupted(ctx context.Context) error {
+	if err := checkDone(ctx); err != nil {
+		return err
+	}
+	if worker.isCancelled() {
+		return ErrWorkerCancelled
+	}
+	return nil
+}
+
 // StatusAsHTML is part of the Worker interface
 func (worker *StatusWorker) StatusAsHTML() template.HTML {
 	worker.Mu.Lock()
@@ -0,0 +1,377 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package worker
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/youtube/vitess/go/acl"
+	"github.com/youtube/vitess/go/stats"
+	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/vt/wrangler"
+	"golang.org/x/net/context"
+)
+
+// This file contains the throttling of the writes of the clones to
+// their destination masters: a maximum rate of transactions for each
+// destination tablet, and a pause of the writes to a shard while one of
+// its replicas lags too much. Both can be changed while a clone runs.
+
+var (
+	destinationMaxTPS                      = flag.Int("destination_max_tps", 0, "maximum number of transactions per second a clone sends to each destination master, 0 for no limit. It can be changed while the clone runs on /throttler")
+	destinationMaxReplicationLag           = flag.Duration("destination_max_replication_lag", 0, "a clone pauses its writes to a destination shard while one of its replicas lags more than this, 0 to never pause. It can be changed while the clone runs on /throttler")
+	destinationReplicationLagCheckInterval = flag.Duration("destination_replication_lag_check_interval", 10*time.Second, "how often a clone checks the replication lag of the destination replicas")
+
+	// throttlerSettingsMu protects the values of the settings flags,
+	// which can change at runtime.
+	throttlerSettingsMu sync.Mutex
+
+	// statsThrottlerBackoff has, for each destination shard, why its
+	// writes are paused, or an empty string if they are not.
+	statsThrottlerBackoff = stats.NewStringMap("WorkerThrottlerBackoff")
+	// statsThrottledTransactions counts the transactions that had to
+	// wait, by destination tablet.
+	statsThrottledTransactions = stats.NewCounters("WorkerThrottledTransactions")
+	// statsThrottlerTransactions counts the transactions that were
+	// let through, by destination tablet, and
+	// statsThrottlerTransactionRates has their observed rate.
+	statsThrottlerTransactions     = stats.NewCounters("WorkerThrottlerTransactions")
+	statsThrottlerTransactionRates = stats.NewRates("WorkerThrottlerTransactionRates", statsThrottlerTransactions, 15, time.Minute)
+
+	// runningThrottlers are the throttlers of the running clones,
+	// for the allowed rates in the stats.
+	runningThrottlersMu sync.Mutex
+	runningThrottlers   = make(map[*throttler]bool)
+)
+
+// throttlerBackoffRetry is how often a paused write checks if it can go.
+const throttlerBackoffRetry = time.Second
+
+// ThrottlerSettings returns the maximum rate of transactions to each
+// destination tablet, and the maximum replication lag of the
+// destination replicas. 0 means no limit.
+func ThrottlerSettings() (int, time.Duration) {
+	throttlerSettingsMu.Lock()
+	defer throttlerSettingsMu.Unlock()
+	return *destinationMaxTPS, *destinationMaxReplicationLag
+}
+
+// SetThrottlerSettings changes the throttling of the clones, including
+// the running one.
+func SetThrottlerSettings(maxTPS int, maxReplicationLag time.Duration) error {
+	if maxTPS < 0 {
+		return fmt.Errorf("invalid maximum rate %v, it has to be positive, or 0 for no limit", maxTPS)
+	}
+	if maxReplicationLag < 0 {
+		return fmt.Errorf("invalid maximum replication lag %v, it has to be positive, or 0 for no limit", maxReplicationLag)
+	}
+	throttlerSettingsMu.Lock()
+	defer throttlerSettingsMu.Unlock()
+	*destinationMaxTPS = maxTPS
+	*destinationMaxReplicationLag = maxReplicationLag
+	return nil
+}
+
+// ServeThrottlerHTTP shows the throttler settings, and changes them
+// with the 'max_tps' and 'max_replication_lag' parameters of a POST.
+func ServeThrottlerHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "POST" {
+		if err := acl.CheckAccessHTTP(r, acl.ADMIN); err != nil {
+			acl.SendError(w, err)
+			return
+		}
+		maxTPS, maxReplicationLag := ThrottlerSettings()
+		var err error
+		if value := r.FormValue("max_tps"); value != "" {
+			if maxTPS, err = strconv.Atoi(value); err != nil {
+				http.Error(w, fmt.Sprintf("invalid max_tps: %v", err), http.StatusBadRequest)
+				return
+			}
+		}
+		if value := r.FormValue("max_replication_lag"); value != "" {
+			if maxReplicationLag, err = time.ParseDuration(value); err != nil {
+				http.Error(w, fmt.Sprintf("invalid max_replication_lag: %v", err), http.StatusBadRequest)
+				return
+			}
+		}
+		if err := SetThrottlerSettings(maxTPS, maxReplicationLag); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	} else if err := acl.CheckAccessHTTP(r, acl.DEBUGGING); err != nil {
+		acl.SendError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	fmt.Fprintf(w, "%v\n", formatThrottlerSettings())
+}
+
+func formatThrottlerSettings() string {
+	maxTPS, maxReplicationLag := ThrottlerSettings()
+	result := "no transaction rate limit"
+	if maxTPS > 0 {
+		result = fmt.Sprintf("at most %v transactions per second per destination tablet", maxTPS)
+	}
+	if maxReplicationLag > 0 {
+		result += fmt.Sprintf(", paused while a destination replica lags more than %v", maxReplicationLag)
+	} else {
+		result += ", never paused for replication lag"
+	}
+	return result
+}
+
+// throttler throttles the writes of one clone.
+type throttler struct {
+	wr     *wrangler.Wrangler
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	// mu protects the following fields
+	mu sync.Mutex
+	// next is, for each destination tablet, when its next
+	// transaction may start.
+	next map[topo.TabletAlias]time.Time
+	// backoff is, for each monitored destination shard, why its
+	// writes are paused, or an empty string if they are not.
+	backoff map[string]string
+	// shards has the destination shard of each destination tablet.
+	shards map[topo.TabletAlias]string
+	// sent counts the transactions let through to each
+	// destination tablet since start.
+	sent  map[topo.TabletAlias]int64
+	start time.Time
+}
+
+// newThrottler returns a throttler, to be stopped when the clone is done.
+func newThrottler(wr *wrangler.Wrangler) *throttler {
+	ctx, cancel := context.WithCancel(context.Background())
+	t := &throttler{
+		wr:      wr,
+		ctx:     ctx,
+		cancel:  cancel,
+		next:    make(map[topo.TabletAlias]time.Time),
+		backoff: make(map[string]string),
+		shards:  make(map[topo.TabletAlias]string),
+		sent:    make(map[topo.TabletAlias]int64),
+		start:   time.Now(),
+	}
+	runningThrottlersMu.Lock()
+	runningThrottlers[t] = true
+	runningThrottlersMu.Unlock()
+	return t
+}
+
+// stop stops the replication lag checks.
+func (t *throttler) stop() {
+	t.cancel()
+	t.wg.Wait()
+	runningThrottlersMu.Lock()
+	delete(runningThrottlers, t)
+	runningThrottlersMu.Unlock()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for key := range t.backoff {
+		statsThrottlerBackoff.Set(key, "")
+	}
+}
+
+// wait returns when a transaction can be sent to the destination
+// master ti: once its shard is not paused, and the previous transaction
+// to ti started long enough ago.
+func (t *throttler) wait(ctx context.Context, ti *topo.TabletInfo) error {
+	key := ti.Keyspace + "/" + ti.Shard
+	throttled := false
+	for {
+		maxTPS, _ := ThrottlerSettings()
+		var delay time.Duration
+		t.mu.Lock()
+		t.shards[ti.Alias] = key
+		backoff, ok := t.backoff[key]
+		if !ok {
+			t.backoff[key] = ""
+			t.wg.Add(1)
+			go t.checkReplicationLag(key, ti.Keyspace, ti.Shard)
+		}
+		if backoff != "" {
+			delay = throttlerBackoffRetry
+		} else if maxTPS > 0 {
+			// reserve the next slot of the tablet
+			now := time.Now()
+			next := t.next[ti.Alias]
+			if next.Before(now) {
+				next = now
+			}
+			delay = next.Sub(now)
+			t.next[ti.Alias] = next.Add(time.Second / time.Duration(maxTPS))
+		}
+		t.mu.Unlock()
+
+		if delay == 0 {
+			t.transactionSent(ti.Alias)
+			return nil
+		}
+		if !throttled {
+			throttled = true
+			statsThrottledTransactions.Add(ti.Alias.String(), 1)
+		}
+		select {
+		case <-time.After(delay):
+			if backoff == "" {
+				t.transactionSent(ti.Alias)
+				return nil
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// transactionSent records a transaction let through to a destination
+// tablet.
+func (t *throttler) transactionSent(alias topo.TabletAlias) {
+	t.mu.Lock()
+	t.sent[alias]++
+	t.mu.Unlock()
+	statsThrottlerTransactions.Add(alias.String(), 1)
+}
+
+// allowedTPS returns the rate of transactions a destination tablet is
+// allowed: 0 while its shard is paused, -1 without a limit. t.mu has
+// to be held.
+func (t *throttler) allowedTPS(alias topo.TabletAlias, maxTPS int) int64 {
+	switch {
+	case t.backoff[t.shards[alias]] != "":
+		return 0
+	case maxTPS == 0:
+		return -1
+	}
+	return int64(maxTPS)
+}
+
+// checkReplicationLag pauses the writes to a shard while one of its
+// replicas lags too much, until the throttler is stopped.
+func (t *throttler) checkReplicationLag(key, keyspace, shard string) {
+	defer t.wg.Done()
+	for {
+		backoff := t.replicationLagBackoff(keyspace, shard)
+		t.mu.Lock()
+		if backoff != t.backoff[key] {
+			if backoff != "" {
+				t.wr.Logger().Warningf("Pausing the writes to %v: %v", key, backoff)
+			} else {
+				t.wr.Logger().Infof("Resuming the writes to %v", key)
+			}
+		}
+		t.backoff[key] = backoff
+		t.mu.Unlock()
+		statsThrottlerBackoff.Set(key, backoff)
+
+		select {
+		case <-time.After(*destinationReplicationLagCheckInterval):
+		case <-t.ctx.Done():
+			return
+		}
+	}
+}
+
+// replicationLagBackoff returns why the writes to a shard have to be
+// paused, or an empty string if they don't.
+func (t *throttler) replicationLagBackoff(keyspace, shard string) string {
+	_, maxReplicationLag := ThrottlerSettings()
+	if maxReplicationLag == 0 {
+		return ""
+	}
+	ctx, cancel := context.WithTimeout(t.ctx, *remoteActionsTimeout)
+	defer cancel()
+	tabletMap, err := topo.GetTabletMapForShard(ctx, t.wr.TopoServer(), keyspace, shard)
+	if err != nil {
+		// a partial result is still worth checking
+		t.wr.Logger().Warningf("GetTabletMapForShard(%v/%v) failed: %v", keyspace, shard, err)
+	}
+	for alias, ti := range tabletMap {
+		if ti.Type != topo.TYPE_REPLICA && ti.Type != topo.TYPE_RDONLY && ti.Type != topo.TYPE_BATCH {
+			continue
+		}
+		status, err := t.wr.TabletManagerClient().SlaveStatus(ctx, ti)
+		if err != nil {
+			t.wr.Logger().Warningf("SlaveStatus(%v) failed: %v", alias, err)
+			continue
+		}
+		if lag := time.Duration(status.SecondsBehindMaster) * time.Second; lag > maxReplicationLag {
+			return fmt.Sprintf("replica %v lags %v, more than %v", alias, lag, maxReplicationLag)
+		}
+	}
+	return ""
+}
+
+// statuses returns the throttler settings, the destination shards
+// that are paused, and the rate of transactions to each destination
+// tablet.
+func (t *throttler) statuses() []string {
+	result := []string{"Throttling: " + formatThrottlerSettings()}
+	maxTPS, _ := ThrottlerSettings()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var paused []string
+	for key, backoff := range t.backoff {
+		if backoff != "" {
+			paused = append(paused, fmt.Sprintf("Writes to %v are paused: %v", key, backoff))
+		}
+	}
+	sort.Strings(paused)
+	var rates []string
+	elapsed := time.Now().Sub(t.start).Seconds()
+	for alias, sent := range t.sent {
+		allowed := "no limit"
+		switch tps := t.allowedTPS(alias, maxTPS); tps {
+		case 0:
+			allowed = "paused"
+		case -1:
+		default:
+			allowed = fmt.Sprintf("at most %v allowed", tps)
+		}
+		rates = append(rates, fmt.Sprintf("Writes to %v: %.1f transactions per second, %v", alias, float64(sent)/elapsed, allowed))
+	}
+	sort.Strings(rates)
+	result = append(result, paused...)
+	return append(result, rates...)
+}
+
+// throttlerAllowedTPS returns the rate of transactions each destination
+// tablet of the running clones is allowed: 0 while its shard is paused,
+// -1 without a limit.
+func throttlerAllowedTPS() map[string]int64 {
+	maxTPS, _ := ThrottlerSettings()
+	result := make(map[string]int64)
+	runningThrottlersMu.Lock()
+	defer runningThrottlersMu.Unlock()
+	for t := range runningThrottlers {
+		t.mu.Lock()
+		for alias := range t.shards {
+			result[alias.String()] = t.allowedTPS(alias, maxTPS)
+		}
+		t.mu.Unlock()
+	}
+	return result
+}
+
+func init() {
+	stats.Publish("WorkerThrottlerMaxTPS", stats.IntFunc(func() int64 {
+		maxTPS, _ := ThrottlerSettings()
+		return int64(maxTPS)
+	}))
+	stats.Publish("WorkerThrottlerMaxReplicationLag", stats.DurationFunc(func() time.Duration {
+		_, maxReplicationLag := ThrottlerSettings()
+		return maxReplicationLag
+	}))
+	stats.Publish("WorkerThrottlerAllowedTPS", stats.CountersFunc(throttlerAllowedTPS))
+}
@@ -0,0 +1,147 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package worker
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/youtube/vitess/go/vt/logutil"
+	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/vt/wrangler"
+	"golang.org/x/net/context"
+)
+
+func restoreThrottlerSettings(t *testing.T) func() {
+	maxTPS, maxReplicationLag := ThrottlerSettings()
+	return func() {
+		if err := SetThrottlerSettings(maxTPS, maxReplicationLag); err != nil {
+			t.Errorf("cannot restore the throttler settings: %v", err)
+		}
+	}
+}
+
+func TestThrottlerRate(t *testing.T) {
+	defer restoreThrottlerSettings(t)()
+	if err := SetThrottlerSettings(100, 0); err != nil {
+		t.Fatalf("SetThrottlerSettings failed: %v", err)
+	}
+	throttler := newThrottler(wrangler.New(logutil.NewConsoleLogger(), nil, nil, time.Second))
+	defer throttler.stop()
+	ti := topo.NewTabletInfo(&topo.Tablet{
+		Alias:    topo.TabletAlias{Cell: "cell1", Uid: 1},
+		Keyspace: "ks",
+		Shard:    "-80",
+	}, 0)
+
+	// 11 transactions at 100 TPS take at least 100ms
+	ctx := context.Background()
+	start := time.Now()
+	for i := 0; i < 11; i++ {
+		if err := throttler.wait(ctx, ti); err != nil {
+			t.Fatalf("wait failed: %v", err)
+		}
+	}
+	if elapsed := time.Now().Sub(start); elapsed < 100*time.Millisecond {
+		t.Errorf("11 transactions at 100 TPS took %v, want at least 100ms", elapsed)
+	}
+	if got := statsThrottledTransactions.Counts()[ti.Alias.String()]; got != 10 {
+		t.Errorf("throttled transactions = %v, want 10", got)
+	}
+	if got := statsThrottlerTransactions.Counts()[ti.Alias.String()]; got != 11 {
+		t.Errorf("transactions = %v, want 11", got)
+	}
+
+	// the allowed and the observed rates are visible
+	if got := throttlerAllowedTPS()[ti.Alias.String()]; got != 100 {
+		t.Errorf("allowed rate = %v, want 100", got)
+	}
+	if got := strings.Join(throttler.statuses(), "\n"); !strings.Contains(got, "Writes to cell1-0000000001: ") || !strings.Contains(got, " transactions per second, at most 100 allowed") {
+		t.Errorf("unexpected statuses: %v", got)
+	}
+	if err := SetThrottlerSettings(0, 0); err != nil {
+		t.Fatalf("SetThrottlerSettings failed: %v", err)
+	}
+	if got := throttlerAllowedTPS()[ti.Alias.String()]; got != -1 {
+		t.Errorf("allowed rate without a limit = %v, want -1", got)
+	}
+	throttler.stop()
+	if got, ok := throttlerAllowedTPS()[ti.Alias.String()]; ok {
+		t.Errorf("allowed rate of a stopped throttler = %v", got)
+	}
+}
+
+func TestThrottlerBackoff(t *testing.T) {
+	throttler := newThrottler(wrangler.New(logutil.NewConsoleLogger(), nil, nil, time.Second))
+	defer throttler.stop()
+	ti := topo.NewTabletInfo(&topo.Tablet{
+		Alias:    topo.TabletAlias{Cell: "cell1", Uid: 2},
+		Keyspace: "ks",
+		Shard:    "80-",
+	}, 0)
+
+	// the writes to the shard are paused until its lag goes down
+	throttler.backoff["ks/80-"] = "replica cell1-0000000003 lags 1m0s, more than 30s"
+	if got := strings.Join(throttler.statuses(), "\n"); !strings.Contains(got, "Writes to ks/80- are paused: replica cell1-0000000003 lags") {
+		t.Errorf("unexpected statuses: %v", got)
+	}
+	throttler.mu.Lock()
+	throttler.shards[ti.Alias] = "ks/80-"
+	throttler.mu.Unlock()
+	if got := throttlerAllowedTPS()[ti.Alias.String()]; got != 0 {
+		t.Errorf("allowed rate while paused = %v, want 0", got)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := throttler.wait(ctx, ti); err != context.DeadlineExceeded {
+		t.Errorf("wait while paused = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	throttler.mu.Lock()
+	throttler.backoff["ks/80-"] = ""
+	throttler.mu.Unlock()
+	if err := throttler.wait(context.Background(), ti); err != nil {
+		t.Errorf("wait failed: %v", err)
+	}
+}
+
+func TestThrottlerHTTP(t *testing.T) {
+	defer restoreThrottlerSettings(t)()
+	if err := SetThrottlerSettings(0, 0); err != nil {
+		t.Fatalf("SetThrottlerSettings failed: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	ServeThrottlerHTTP(w, &http.Request{Method: "GET", URL: &url.URL{Path: "/throttler"}})
+	if got, want := w.Body.String(), "no transaction rate limit, never paused for replication lag\n"; got != want {
+		t.Errorf("GET: got %q, want %q", got, want)
+	}
+
+	w = httptest.NewRecorder()
+	r, err := http.NewRequest("POST", "/throttler", strings.NewReader(url.Values{"max_tps": {"50"}, "max_replication_lag": {"30s"}}.Encode()))
+	if err != nil {
+		t.Fatalf("NewRequest failed: %v", err)
+	}
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	ServeThrottlerHTTP(w, r)
+	if got, want := w.Body.String(), "at most 50 transactions per second per destination tablet, paused while a destination replica lags more than 30s\n"; got != want {
+		t.Errorf("POST: got %q, want %q", got, want)
+	}
+
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest("POST", "/throttler", strings.NewReader("max_tps=-1"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	ServeThrottlerHTTP(w, r)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("POST with a bad rate: got code %v, want %v", w.Code, http.StatusBadRequest)
+	}
+	if maxTPS, maxReplicationLag := ThrottlerSettings(); maxTPS != 50 || maxReplicationLag != 30*time.Second {
+		t.Errorf("settings changed after a bad POST: %v %v", maxTPS, maxReplicationLag)
+	}
+}
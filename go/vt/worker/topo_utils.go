@@ -8,9 +8,11 @@ import (
 	"flag"
 	"fmt"
 	"math/rand"
+	"sync"
 	"time"
 
 	"github.com/youtube/vitess/go/vt/servenv"
+	tproto "github.com/youtube/vitess/go/vt/tabletserver/proto"
 	"github.com/youtube/vitess/go/vt/topo"
 	"github.com/youtube/vitess/go/vt/wrangler"
 	"golang.org/x/net/context"
@@ -20,30 +22,159 @@ var (
 	minHealthyEndPoints = flag.Int("min_healthy_rdonly_endpoints", 2, "minimum number of healthy rdonly endpoints required for checker")
 )
 
-// FindHealthyRdonlyEndPoint returns a random healthy endpoint.
-// Since we don't want to use them all, we require at least
-// minHealthyEndPoints servers to be healthy.
-func FindHealthyRdonlyEndPoint(wr *wrangler.Wrangler, cell, keyspace, shard string) (topo.TabletAlias, error) {
+// FindHealthyRdonlyEndPoint returns a healthy endpoint, preferring
+// the ones in our cell, then the least lagging and least loaded ones.
+// Since we don't want to use them all, we only pick from the cells
+// where at least minHealthyEndPoints servers are healthy. If ours
+// doesn't have enough, we look in the other cells of the shard.
+func FindHealthyRdonlyEndPoint(ctx context.Context, wr *wrangler.Wrangler, cell, keyspace, shard string) (topo.TabletAlias, error) {
+	healthyAliases, err := findHealthyRdonlyAliases(wr, cell, keyspace, shard)
+	if err != nil {
+		return topo.TabletAlias{}, err
+	}
+	if len(healthyAliases) < *minHealthyEndPoints {
+		wr.Logger().Warningf("Not enough endpoints to chose from in (%v,%v/%v), have %v healthy ones, need at least %v, looking in the other cells", cell, keyspace, shard, len(healthyAliases), *minHealthyEndPoints)
+		healthyAliases = nil
+		si, err := wr.TopoServer().GetShard(keyspace, shard)
+		if err != nil {
+			return topo.TabletAlias{}, err
+		}
+		for _, otherCell := range si.Cells {
+			if otherCell == cell {
+				continue
+			}
+			aliases, err := findHealthyRdonlyAliases(wr, otherCell, keyspace, shard)
+			if err != nil {
+				wr.Logger().Warningf("%v", err)
+				continue
+			}
+			if len(aliases) >= *minHealthyEndPoints {
+				healthyAliases = append(healthyAliases, aliases...)
+			}
+		}
+		if len(healthyAliases) == 0 {
+			return topo.TabletAlias{}, fmt.Errorf("Not enough endpoints to chose from in any cell of %v/%v, need at least %v healthy ones in a cell", keyspace, shard, *minHealthyEndPoints)
+		}
+	}
+
+	// a random server among the least lagging, then least loaded
+	// ones is what we want
+	shortCtx, cancel := context.WithTimeout(ctx, *remoteActionsTimeout)
+	lags := replicationLags(shortCtx, wr, healthyAliases)
+	stats := wr.GetTabletsStats(shortCtx, healthyAliases)
+	cancel()
+	candidates := leastLoadedTablets(leastLaggingTablets(healthyAliases, lags), stats)
+	return candidates[rand.Intn(len(candidates))], nil
+}
+
+// findHealthyRdonlyAliases returns the healthy rdonly tablets of a
+// shard in a cell.
+func findHealthyRdonlyAliases(wr *wrangler.Wrangler, cell, keyspace, shard string) ([]topo.TabletAlias, error) {
 	endPoints, err := wr.TopoServer().GetEndPoints(cell, keyspace, shard, topo.TYPE_RDONLY)
 	if err != nil {
-		return topo.TabletAlias{}, fmt.Errorf("GetEndPoints(%v,%v,%v,rdonly) failed: %v", cell, keyspace, shard, err)
+		return nil, fmt.Errorf("GetEndPoints(%v,%v,%v,rdonly) failed: %v", cell, keyspace, shard, err)
 	}
-	healthyEndpoints := make([]topo.EndPoint, 0, len(endPoints.Entries))
+	healthyAliases := make([]topo.TabletAlias, 0, len(endPoints.Entries))
 	for _, entry := range endPoints.Entries {
-		if len(entry.Health) == 0 {
-			healthyEndpoints = append(healthyEndpoints, entry)
+		if isHealthyEndPoint(&entry) {
+			healthyAliases = append(healthyAliases, topo.TabletAlias{
+				Cell: cell,
+				Uid:  entry.Uid,
+			})
 		}
 	}
-	if len(healthyEndpoints) < *minHealthyEndPoints {
-		return topo.TabletAlias{}, fmt.Errorf("Not enough endpoints to chose from in (%v,%v/%v), have %v healthy ones, need at least %v", cell, keyspace, shard, len(healthyEndpoints), *minHealthyEndPoints)
+	return healthyAliases, nil
+}
+
+// replicationLags returns the replication lag of the tablets, in
+// seconds. The tablets we cannot get the replication status of are
+// logged, and not in the result.
+func replicationLags(ctx context.Context, wr *wrangler.Wrangler, aliases []topo.TabletAlias) map[topo.TabletAlias]uint {
+	result := make(map[topo.TabletAlias]uint, len(aliases))
+	mu := sync.Mutex{}
+	wg := sync.WaitGroup{}
+	for _, alias := range aliases {
+		wg.Add(1)
+		go func(alias topo.TabletAlias) {
+			defer wg.Done()
+			ti, err := wr.TopoServer().GetTablet(alias)
+			if err != nil {
+				wr.Logger().Warningf("GetTablet(%v) failed: %v", alias, err)
+				return
+			}
+			status, err := wr.TabletManagerClient().SlaveStatus(ctx, ti)
+			if err != nil {
+				wr.Logger().Warningf("SlaveStatus(%v) failed: %v", alias, err)
+				return
+			}
+			mu.Lock()
+			result[alias] = status.SecondsBehindMaster
+			mu.Unlock()
+		}(alias)
 	}
+	wg.Wait()
+	return result
+}
 
-	// random server in the list is what we want
-	index := rand.Intn(len(healthyEndpoints))
-	return topo.TabletAlias{
-		Cell: cell,
-		Uid:  healthyEndpoints[index].Uid,
-	}, nil
+// leastLaggingTablets returns the tablets with the lowest replication
+// lag. If we don't have the lag of any tablet, all of them are
+// returned.
+func leastLaggingTablets(aliases []topo.TabletAlias, lags map[topo.TabletAlias]uint) []topo.TabletAlias {
+	var result []topo.TabletAlias
+	var minLag uint
+	for _, alias := range aliases {
+		lag, ok := lags[alias]
+		if !ok {
+			continue
+		}
+		switch {
+		case len(result) == 0 || lag < minLag:
+			result = []topo.TabletAlias{alias}
+			minLag = lag
+		case lag == minLag:
+			result = append(result, alias)
+		}
+	}
+	if len(result) == 0 {
+		return aliases
+	}
+	return result
+}
+
+// isHealthyEndPoint returns true if the endpoint has no health
+// problem. The query service stats are only informational.
+func isHealthyEndPoint(entry *topo.EndPoint) bool {
+	for key := range entry.Health {
+		if key != topo.QueryServiceStats {
+			return false
+		}
+	}
+	return true
+}
+
+// leastLoadedTablets returns the tablets with the lowest QPS. If we
+// don't have the stats of any tablet, all of them are returned.
+func leastLoadedTablets(aliases []topo.TabletAlias, stats map[topo.TabletAlias]*tproto.RuntimeStats) []topo.TabletAlias {
+	var result []topo.TabletAlias
+	minQPS := 0.0
+	for _, alias := range aliases {
+		rs, ok := stats[alias]
+		if !ok {
+			continue
+		}
+		qps := rs.QPS["All"]
+		switch {
+		case len(result) == 0 || qps < minQPS:
+			result = []topo.TabletAlias{alias}
+			minQPS = qps
+		case qps == minQPS:
+			result = append(result, alias)
+		}
+	}
+	if len(result) == 0 {
+		return aliases
+	}
+	return result
 }
 
 // FindWorkerTablet will:
@@ -51,42 +182,67 @@ func FindHealthyRdonlyEndPoint(wr *wrangler.Wrangler, cell, keyspace, shard stri
 // - mark it as worker
 // - tag it with our worker process
 func FindWorkerTablet(ctx context.Context, wr *wrangler.Wrangler, cleaner *wrangler.Cleaner, cell, keyspace, shard string) (topo.TabletAlias, error) {
-	tabletAlias, err := FindHealthyRdonlyEndPoint(wr, cell, keyspace, shard)
+	tabletAlias, err := FindHealthyRdonlyEndPoint(ctx, wr, cell, keyspace, shard)
 	if err != nil {
 		return topo.TabletAlias{}, err
 	}
+	if err := UseWorkerTablet(ctx, wr, cleaner, tabletAlias); err != nil {
+		return topo.TabletAlias{}, err
+	}
+	return tabletAlias, nil
+}
 
-	// We add the tag before calling ChangeSlaveType, so the destination
+// UseWorkerTablet marks a tablet as worker, and tags it with our
+// worker process: its URL, and its identity, so 'vtctl
+// ReleaseWorkerTablets' can take the tablet back if we die without
+// cleaning up. A tablet that is already a worker, because a previous
+// worker left it there to be resumed, or died holding it, is taken as
+// is, unless another running worker holds it.
+func UseWorkerTablet(ctx context.Context, wr *wrangler.Wrangler, cleaner *wrangler.Cleaner, tabletAlias topo.TabletAlias) error {
+	// We add the tags before calling ChangeSlaveType, so the destination
 	// vttablet reloads the worker URL when it reloads the tablet.
+	ti, err := wr.TopoServer().GetTablet(tabletAlias)
+	if err != nil {
+		return err
+	}
+	if id := ti.Tags[wrangler.WorkerIDTag]; ti.Type == topo.TYPE_WORKER && id != "" && id != workerID && wr.IsWorkerAlive(ti.Tags[wrangler.WorkerTag], id) {
+		return fmt.Errorf("tablet %v is already held by vtworker %v, which is still running", tabletAlias, ti.Tags[wrangler.WorkerTag])
+	}
 	ourURL := servenv.ListeningURL.String()
-	wr.Logger().Infof("Adding tag[worker]=%v to tablet %v", ourURL, tabletAlias)
+	wr.Logger().Infof("Adding tag[%v]=%v and tag[%v]=%v to tablet %v", wrangler.WorkerTag, ourURL, wrangler.WorkerIDTag, workerID, tabletAlias)
+	var tabletType topo.TabletType
 	if err := wr.TopoServer().UpdateTabletFields(tabletAlias, func(tablet *topo.Tablet) error {
 		if tablet.Tags == nil {
 			tablet.Tags = make(map[string]string)
 		}
-		tablet.Tags["worker"] = ourURL
+		tablet.Tags[wrangler.WorkerTag] = ourURL
+		tablet.Tags[wrangler.WorkerIDTag] = workerID
+		tabletType = tablet.Type
 		return nil
 	}); err != nil {
-		return topo.TabletAlias{}, err
+		return err
 	}
-	// we remove the tag *before* calling ChangeSlaveType back, so
-	// we need to record this tag change after the change slave
+	// we remove the tags *before* calling ChangeSlaveType back, so
+	// we need to record these tag changes after the change slave
 	// type change in the cleaner.
-	defer wrangler.RecordTabletTagAction(cleaner, tabletAlias, "worker", "")
+	defer wrangler.RecordTabletTagAction(cleaner, tabletAlias, wrangler.WorkerTag, "")
+	defer wrangler.RecordTabletTagAction(cleaner, tabletAlias, wrangler.WorkerIDTag, "")
 
-	wr.Logger().Infof("Changing tablet %v to 'checker'", tabletAlias)
-	shortCtx, cancel := context.WithTimeout(ctx, *remoteActionsTimeout)
-	err = wr.ChangeType(shortCtx, tabletAlias, topo.TYPE_WORKER, false /*force*/)
-	cancel()
-	if err != nil {
-		return topo.TabletAlias{}, err
+	if tabletType != topo.TYPE_WORKER {
+		wr.Logger().Infof("Changing tablet %v to 'checker'", tabletAlias)
+		shortCtx, cancel := context.WithTimeout(ctx, *remoteActionsTimeout)
+		err := wr.ChangeType(shortCtx, tabletAlias, topo.TYPE_WORKER, false /*force*/)
+		cancel()
+		if err != nil {
+			return err
+		}
 	}
 
 	// Record a clean-up action to take the tablet back to rdonly.
 	// We will alter this one later on and let the tablet go back to
 	// 'spare' if we have stopped replication for too long on it.
 	wrangler.RecordChangeSlaveTypeAction(cleaner, tabletAlias, topo.TYPE_RDONLY)
-	return tabletAlias, nil
+	return nil
 }
 
 func init() {
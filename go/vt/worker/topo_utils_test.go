@@ -0,0 +1,40 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package worker
+
+import (
+	"reflect"
+	"testing"
+
+	tproto "github.com/youtube/vitess/go/vt/tabletserver/proto"
+	"github.com/youtube/vitess/go/vt/topo"
+)
+
+func TestLeastLaggingAndLoadedTablets(t *testing.T) {
+	a := topo.TabletAlias{Cell: "cell1", Uid: 1}
+	b := topo.TabletAlias{Cell: "cell1", Uid: 2}
+	c := topo.TabletAlias{Cell: "cell1", Uid: 3}
+	aliases := []topo.TabletAlias{a, b, c}
+
+	// b and c are the least lagging, c the least loaded of them
+	got := leastLaggingTablets(aliases, map[topo.TabletAlias]uint{a: 10, b: 0, c: 0})
+	if want := []topo.TabletAlias{b, c}; !reflect.DeepEqual(got, want) {
+		t.Errorf("leastLaggingTablets() = %v, want %v", got, want)
+	}
+	got = leastLoadedTablets(got, map[topo.TabletAlias]*tproto.RuntimeStats{
+		a: {QPS: map[string]float64{"All": 1}},
+		b: {QPS: map[string]float64{"All": 200}},
+		c: {QPS: map[string]float64{"All": 100}},
+	})
+	if want := []topo.TabletAlias{c}; !reflect.DeepEqual(got, want) {
+		t.Errorf("leastLoadedTablets() = %v, want %v", got, want)
+	}
+
+	// without the lags, all the tablets are candidates
+	got = leastLaggingTablets(aliases, nil)
+	if !reflect.DeepEqual(got, aliases) {
+		t.Errorf("leastLaggingTablets() without lags = %v, want %v", got, aliases)
+	}
+}
@@ -50,6 +50,10 @@ type VerticalSplitCloneWorker struct {
 	sourceAlias  topo.TabletAlias
 	sourceTablet *topo.TabletInfo
 
+	// throttler throttles the writes to the destinations,
+	// during WorkerStateCopy
+	throttler *throttler
+
 	// populated during WorkerStateCopy
 	tableStatus []*tableStatus
 	startTime   time.Time
@@ -85,6 +89,7 @@ func NewVerticalSplitCloneWorker(wr *wrangler.Wrangler, cell, destinationKeyspac
 		minTableSizeForSplit:   minTableSizeForSplit,
 		destinationWriterCount: destinationWriterCount,
 		cleaner:                &wrangler.Cleaner{},
+		throttler:              newThrottler(wr),
 
 		ev: &events.VerticalSplitClone{
 			Cell:     cell,
@@ -118,6 +123,7 @@ func (vscw *VerticalSplitCloneWorker) StatusAsHTML() template.HTML {
 		result += "<b>Copying from</b>: " + vscw.sourceAlias.String() + "</br>\n"
 		statuses, eta := formatTableStatuses(vscw.tableStatus, vscw.startTime)
 		result += "<b>ETA</b>: " + eta.String() + "</br>\n"
+		result += strings.Join(vscw.throttler.statuses(), "</br>\n") + "</br>\n"
 		result += strings.Join(statuses, "</br>\n")
 	case WorkerStateDone:
 		result += "<b>Success</b>:</br>\n"
@@ -140,6 +146,7 @@ func (vscw *VerticalSplitCloneWorker) StatusAsText() string {
 		result += "Copying from: " + vscw.sourceAlias.String() + "\n"
 		statuses, eta := formatTableStatuses(vscw.tableStatus, vscw.startTime)
 		result += "ETA: " + eta.String() + "\n"
+		result += strings.Join(vscw.throttler.statuses(), "\n") + "\n"
 		result += strings.Join(statuses, "\n")
 	case WorkerStateDone:
 		result += "Success:\n"
@@ -152,17 +159,7 @@ func (vscw *VerticalSplitCloneWorker) StatusAsText() string {
 // Run implements the Worker interface
 func (vscw *VerticalSplitCloneWorker) Run(ctx context.Context) error {
 	resetVars()
-	err := vscw.run(ctx)
-
-	vscw.setState(WorkerStateCleanUp)
-	cerr := vscw.cleaner.CleanUp(vscw.wr)
-	if cerr != nil {
-		if err != nil {
-			vscw.wr.Logger().Errorf("CleanUp failed in addition to job error: %v", cerr)
-		} else {
-			err = cerr
-		}
-	}
+	err := runAndCleanUp(ctx, vscw.wr, vscw.cleaner, func() { vscw.setState(WorkerStateCleanUp) }, vscw.run)
 	if err != nil {
 		vscw.setErrorState(err)
 		return err
@@ -176,7 +173,7 @@ func (vscw *VerticalSplitCloneWorker) run(ctx context.Context) error {
 	if err := vscw.init(); err != nil {
 		return fmt.Errorf("init() failed: %v", err)
 	}
-	if err := checkDone(ctx); err != nil {
+	if err := vscw.checkInterrupted(ctx); err != nil {
 		return err
 	}
 
@@ -184,7 +181,7 @@ func (vscw *VerticalSplitCloneWorker) run(ctx context.Context) error {
 	if err := vscw.findTargets(ctx); err != nil {
 		return fmt.Errorf("findTargets() failed: %v", err)
 	}
-	if err := checkDone(ctx); err != nil {
+	if err := vscw.checkInterrupted(ctx); err != nil {
 		return err
 	}
 
@@ -192,7 +189,7 @@ func (vscw *VerticalSplitCloneWorker) run(ctx context.Context) error {
 	if err := vscw.copy(ctx); err != nil {
 		return fmt.Errorf("copy() failed: %v", err)
 	}
-	if err := checkDone(ctx); err != nil {
+	if err := vscw.checkInterrupted(ctx); err != nil {
 		return err
 	}
 
@@ -339,6 +336,9 @@ func (vscw *VerticalSplitCloneWorker) copy(ctx context.Context) error {
 	if len(sourceSchemaDefinition.TableDefinitions) == 0 {
 		return fmt.Errorf("no tables matching the table filter")
 	}
+	if err := checkForeignKeys(sourceSchemaDefinition); err != nil {
+		return err
+	}
 	vscw.wr.Logger().Infof("Source tablet has %v tables to copy", len(sourceSchemaDefinition.TableDefinitions))
 	vscw.Mu.Lock()
 	vscw.tableStatus = make([]*tableStatus, len(sourceSchemaDefinition.TableDefinitions))
@@ -350,6 +350,7 @@ func (vscw *VerticalSplitCloneWorker) copy(ctx context.Context) error {
 	}
 	vscw.startTime = time.Now()
 	vscw.Mu.Unlock()
+	defer vscw.throttler.stop()
 
 	// Count rows
 	for i, td := range sourceSchemaDefinition.TableDefinitions {
@@ -387,15 +388,15 @@ func (vscw *VerticalSplitCloneWorker) copy(ctx context.Context) error {
 	// destinationWriterCount * 2 items, to hopefully
 	// always have data. We then have
 	// destinationWriterCount go routines reading from it.
-	insertChannel := make(chan string, vscw.destinationWriterCount*2)
+	insertChannel := make(chan *insertCommand, vscw.destinationWriterCount*2)
 
-	go func(shardName string, insertChannel chan string) {
+	go func(shardName string, insertChannel chan *insertCommand) {
 		for j := 0; j < vscw.destinationWriterCount; j++ {
 			destinationWaitGroup.Add(1)
 			go func() {
 				defer destinationWaitGroup.Done()
 
-				if err := executeFetchLoop(ctx, vscw.wr, vscw, shardName, insertChannel); err != nil {
+				if err := executeFetchLoop(ctx, vscw.wr, vscw, shardName, insertChannel, vscw.throttler); err != nil {
 					processError("executeFetchLoop failed: %v", err)
 				}
 			}()
@@ -424,6 +425,10 @@ func (vscw *VerticalSplitCloneWorker) copy(ctx context.Context) error {
 				sema.Acquire()
 				defer sema.Release()
 
+				// a cancelled clone stops between two chunks
+				if vscw.isCancelled() {
+					return
+				}
 				vscw.tableStatus[tableIndex].threadStarted()
 
 				// build the query, and start the streaming
@@ -450,6 +455,9 @@ func (vscw *VerticalSplitCloneWorker) copy(ctx context.Context) error {
 	if firstError != nil {
 		return firstError
 	}
+	if err := vscw.checkInterrupted(ctx); err != nil {
+		return err
+	}
 
 	// then create and populate the blp_checkpoint table
 	if vscw.strategy.PopulateBlpCheckpoint {
@@ -521,7 +529,7 @@ func (vscw *VerticalSplitCloneWorker) copy(ctx context.Context) error {
 
 // processData pumps the data out of the provided QueryResultReader.
 // It returns any error the source encounters.
-func (vscw *VerticalSplitCloneWorker) processData(td *myproto.TableDefinition, tableIndex int, qrr *QueryResultReader, insertChannel chan string, destinationPackCount int, abort <-chan struct{}) error {
+func (vscw *VerticalSplitCloneWorker) processData(td *myproto.TableDefinition, tableIndex int, qrr *QueryResultReader, insertChannel chan *insertCommand, destinationPackCount int, abort <-chan struct{}) error {
 	// process the data
 	baseCmd := td.Name + "(" + strings.Join(td.Columns, ", ") + ") VALUES "
 	var rows [][]sqltypes.Value
@@ -539,7 +547,7 @@ func (vscw *VerticalSplitCloneWorker) processData(td *myproto.TableDefinition, t
 
 				// send the remainder if any
 				if packCount > 0 {
-					cmd := baseCmd + makeValueString(qrr.Fields, rows)
+					cmd := &insertCommand{sql: baseCmd + makeValueString(qrr.Fields, rows)}
 					select {
 					case insertChannel <- cmd:
 					case <-abort:
@@ -560,7 +568,7 @@ func (vscw *VerticalSplitCloneWorker) processData(td *myproto.TableDefinition, t
 			}
 
 			// send the rows to be inserted
-			cmd := baseCmd + makeValueString(qrr.Fields, rows)
+			cmd := &insertCommand{sql: baseCmd + makeValueString(qrr.Fields, rows)}
 			select {
 			case insertChannel <- cmd:
 			case <-abort:
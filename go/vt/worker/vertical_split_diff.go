@@ -94,17 +94,7 @@ func (vsdw *VerticalSplitDiffWorker) StatusAsText() string {
 // Run is mostly a wrapper to run the cleanup at the end.
 func (vsdw *VerticalSplitDiffWorker) Run(ctx context.Context) error {
 	resetVars()
-	err := vsdw.run(ctx)
-
-	vsdw.SetState(WorkerStateCleanUp)
-	cerr := vsdw.cleaner.CleanUp(vsdw.wr)
-	if cerr != nil {
-		if err != nil {
-			vsdw.wr.Logger().Errorf("CleanUp failed in addition to job error: %v", cerr)
-		} else {
-			err = cerr
-		}
-	}
+	err := runAndCleanUp(ctx, vsdw.wr, vsdw.cleaner, func() { vsdw.SetState(WorkerStateCleanUp) }, vsdw.run)
 	if err != nil {
 		vsdw.SetState(WorkerStateError)
 		return err
@@ -118,7 +108,7 @@ func (vsdw *VerticalSplitDiffWorker) run(ctx context.Context) error {
 	if err := vsdw.init(); err != nil {
 		return fmt.Errorf("init() failed: %v", err)
 	}
-	if err := checkDone(ctx); err != nil {
+	if err := vsdw.checkInterrupted(ctx); err != nil {
 		return err
 	}
 
@@ -126,7 +116,7 @@ func (vsdw *VerticalSplitDiffWorker) run(ctx context.Context) error {
 	if err := vsdw.findTargets(ctx); err != nil {
 		return fmt.Errorf("findTargets() failed: %v", err)
 	}
-	if err := checkDone(ctx); err != nil {
+	if err := vsdw.checkInterrupted(ctx); err != nil {
 		return err
 	}
 
@@ -134,7 +124,7 @@ func (vsdw *VerticalSplitDiffWorker) run(ctx context.Context) error {
 	if err := vsdw.synchronizeReplication(ctx); err != nil {
 		return fmt.Errorf("synchronizeReplication() failed: %v", err)
 	}
-	if err := checkDone(ctx); err != nil {
+	if err := vsdw.checkInterrupted(ctx); err != nil {
 		return err
 	}
 
@@ -406,6 +396,10 @@ func (vsdw *VerticalSplitDiffWorker) diff(ctx context.Context) error {
 			sem.Acquire()
 			defer sem.Release()
 
+			// a cancelled diff stops between two tables
+			if vsdw.isCancelled() {
+				return
+			}
 			vsdw.wr.Logger().Infof("Starting the diff on table %v", tableDefinition.Name)
 			sourceQueryResultReader, err := TableScan(ctx, vsdw.wr.Logger(), vsdw.wr.TopoServer(), vsdw.sourceAlias, tableDefinition)
 			if err != nil {
@@ -441,5 +435,5 @@ func (vsdw *VerticalSplitDiffWorker) diff(ctx context.Context) error {
 	}
 	wg.Wait()
 
-	return nil
+	return vsdw.checkInterrupted(ctx)
 }
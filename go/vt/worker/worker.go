@@ -10,13 +10,16 @@ package worker
 
 import (
 	"flag"
+	"fmt"
 	"html/template"
+	"os"
 	"time"
 
 	"golang.org/x/net/context"
 
 	"github.com/youtube/vitess/go/stats"
 	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/vt/wrangler"
 )
 
 // Worker is the base interface for all long running workers.
@@ -31,6 +34,11 @@ type Worker interface {
 	// called in a go routine.  When the passed in context is
 	// cancelled, Run should exit as soon as possible.
 	Run(context.Context) error
+
+	// Cancel asks the worker to stop at its next chunk boundary,
+	// once the chunks in progress are done. Run then cleans up, and
+	// fails with ErrWorkerCancelled. It can be called at any time.
+	Cancel()
 }
 
 // Resolver is an interface that should be implemented by any workers that need to
@@ -56,8 +64,26 @@ var (
 	// use a cached topology
 	statsDestinationActualResolves = stats.NewInt("WorkerDestinationActualResolves")
 	statsRetryCounters             = stats.NewCounters("WorkerRetryCount")
+
+	// workerID identifies this process in the tags of the tablets
+	// it holds, so they can be released once it is gone.
+	workerID      = newWorkerID()
+	statsWorkerID = stats.NewString(wrangler.WorkerIDVar)
 )
 
+func init() {
+	statsWorkerID.Set(workerID)
+}
+
+// newWorkerID returns an identity that changes when vtworker restarts.
+func newWorkerID() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	return fmt.Sprintf("%v-%v-%v", hostname, os.Getpid(), time.Now().UnixNano())
+}
+
 // resetVars resets the debug variables that are meant to provide information on a
 // per-run basis. This should be called at the beginning of each worker run.
 func resetVars() {
@@ -76,3 +102,25 @@ func checkDone(ctx context.Context) error {
 	}
 	return nil
 }
+
+// runAndCleanUp runs run, then the actions recorded in cleaner, even
+// if run panics, so the tablets the worker changed are always changed
+// back. It returns the error of run, or the one of the clean up.
+// setCleanUpState is called before the clean up starts.
+func runAndCleanUp(ctx context.Context, wr *wrangler.Wrangler, cleaner *wrangler.Cleaner, setCleanUpState func(), run func(context.Context) error) (err error) {
+	defer func() {
+		if x := recover(); x != nil {
+			err = fmt.Errorf("uncaught worker panic: %v", x)
+		}
+
+		setCleanUpState()
+		if cerr := cleaner.CleanUp(wr); cerr != nil {
+			if err != nil {
+				wr.Logger().Errorf("CleanUp failed in addition to job error: %v", cerr)
+			} else {
+				err = cerr
+			}
+		}
+	}()
+	return run(ctx)
+}
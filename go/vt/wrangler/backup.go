@@ -0,0 +1,84 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wrangler
+
+import (
+	"fmt"
+
+	"github.com/youtube/vitess/go/vt/logutil"
+	"github.com/youtube/vitess/go/vt/mysqlctl"
+	"github.com/youtube/vitess/go/vt/mysqlctl/backupstorage"
+	"github.com/youtube/vitess/go/vt/tabletmanager/tmclient"
+	"github.com/youtube/vitess/go/vt/topo"
+	"golang.org/x/net/context"
+)
+
+// Backup asks a tablet to take a backup, and logs its progress. A
+// master is refused unless allowMaster is set, as the backup may stop
+// it from serving. bandwidthLimit and skipSpaceCheck are passed to the
+// tablet as is.
+func (wr *Wrangler) Backup(ctx context.Context, tabletAlias topo.TabletAlias, concurrency int, bandwidthLimit int64, skipSpaceCheck, allowMaster bool) error {
+	ti, err := wr.ts.GetTablet(tabletAlias)
+	if err != nil {
+		return err
+	}
+	if ti.Type == topo.TYPE_MASTER && !allowMaster {
+		return fmt.Errorf("tablet %v is a master, use -allow_master to back it up anyway", tabletAlias)
+	}
+	return wr.logStream(wr.tmc.Backup(ctx, ti, concurrency, bandwidthLimit, skipSpaceCheck))
+}
+
+// RestoreFromBackup asks a tablet to restore the most recent backup of
+// its shard over its data, and logs its progress.
+func (wr *Wrangler) RestoreFromBackup(ctx context.Context, tabletAlias topo.TabletAlias) error {
+	ti, err := wr.ts.GetTablet(tabletAlias)
+	if err != nil {
+		return err
+	}
+	return wr.logStream(wr.tmc.RestoreFromBackup(ctx, ti))
+}
+
+// logStream copies the events of a streaming tablet manager action to
+// the logger, and returns the error of the action.
+func (wr *Wrangler) logStream(events <-chan *logutil.LoggerEvent, errFunc tmclient.ErrFunc, err error) error {
+	if err != nil {
+		return err
+	}
+	for e := range events {
+		wr.Logger().Infof("%v", e)
+	}
+	return errFunc()
+}
+
+// ListBackups returns the backups of a shard, oldest first, with their
+// MANIFEST. The backups are read from the BackupStorage directly, not
+// through a tablet.
+func (wr *Wrangler) ListBackups(keyspace, shard string) ([]*mysqlctl.BackupInfo, error) {
+	bs, err := backupstorage.GetBackupStorage()
+	if err != nil {
+		return nil, err
+	}
+	return mysqlctl.ListBackups(bs, fmt.Sprintf("%v/%v", keyspace, shard))
+}
+
+// RemoveBackup removes a backup of a shard from the BackupStorage.
+func (wr *Wrangler) RemoveBackup(keyspace, shard, name string) error {
+	bs, err := backupstorage.GetBackupStorage()
+	if err != nil {
+		return err
+	}
+	return bs.RemoveBackup(fmt.Sprintf("%v/%v", keyspace, shard), name)
+}
+
+// VerifyBackup asks a tablet to check the integrity of a backup of its
+// shard, or of the most recent one if name is empty. The tablet reads
+// the backup from its BackupStorage, and doesn't restore it.
+func (wr *Wrangler) VerifyBackup(ctx context.Context, tabletAlias topo.TabletAlias, name string) error {
+	ti, err := wr.ts.GetTablet(tabletAlias)
+	if err != nil {
+		return err
+	}
+	return wr.tmc.VerifyBackup(ctx, ti, name)
+}
@@ -0,0 +1,149 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wrangler
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/youtube/vitess/go/sync2"
+	"github.com/youtube/vitess/go/vt/topo"
+	"golang.org/x/net/context"
+)
+
+// This file contains the bulk tablet actions, that run a tablet
+// action on all the tablets of a selection.
+
+// DefaultBulkConcurrency is the default number of tablets a bulk
+// action runs on at the same time.
+const DefaultBulkConcurrency = 8
+
+// TabletSelection selects tablets by keyspace, shard, cell and
+// type. The empty fields select everything: an empty selection is
+// all the tablets of all the cells. Shard requires Keyspace.
+type TabletSelection struct {
+	Keyspace   string
+	Shard      string
+	Cells      []string
+	TabletType topo.TabletType
+}
+
+// TabletResult is the outcome of a bulk action on one tablet. Error
+// is empty if the action succeeded.
+type TabletResult struct {
+	Alias topo.TabletAlias
+	Error string
+}
+
+// SelectTablets returns the tablets of the selection, sorted by alias.
+// The tablets that cannot be read are logged and left out.
+func (wr *Wrangler) SelectTablets(ctx context.Context, selection *TabletSelection) ([]*topo.TabletInfo, error) {
+	if selection.Shard != "" && selection.Keyspace == "" {
+		return nil, fmt.Errorf("a shard can only be selected with its keyspace")
+	}
+
+	var tabletMap map[topo.TabletAlias]*topo.TabletInfo
+	if selection.Keyspace != "" {
+		shards := []string{selection.Shard}
+		if selection.Shard == "" {
+			var err error
+			if shards, err = wr.ts.GetShardNames(selection.Keyspace); err != nil {
+				return nil, err
+			}
+		}
+		tabletMap = make(map[topo.TabletAlias]*topo.TabletInfo)
+		for _, shard := range shards {
+			shardMap, err := topo.GetTabletMapForShardByCell(ctx, wr.ts, selection.Keyspace, shard, selection.Cells)
+			switch err {
+			case nil:
+			case topo.ErrPartialResult:
+				wr.Logger().Warningf("SelectTablets: got partial result for shard %v/%v, some tablets may be missing", selection.Keyspace, shard)
+			default:
+				return nil, err
+			}
+			for alias, ti := range shardMap {
+				tabletMap[alias] = ti
+			}
+		}
+	} else {
+		cells := selection.Cells
+		if len(cells) == 0 {
+			var err error
+			if cells, err = wr.ts.GetKnownCells(); err != nil {
+				return nil, err
+			}
+		}
+		var aliases []topo.TabletAlias
+		for _, cell := range cells {
+			cellAliases, err := wr.ts.GetTabletsByCell(cell)
+			if err != nil {
+				return nil, fmt.Errorf("cannot list the tablets of cell %v: %v", cell, err)
+			}
+			aliases = append(aliases, cellAliases...)
+		}
+		var err error
+		tabletMap, err = topo.GetTabletMap(ctx, wr.ts, aliases)
+		switch err {
+		case nil:
+		case topo.ErrPartialResult:
+			wr.Logger().Warningf("SelectTablets: got partial result, some tablets may be missing")
+		default:
+			return nil, err
+		}
+	}
+
+	aliases := make(topo.TabletAliasList, 0, len(tabletMap))
+	for alias, ti := range tabletMap {
+		if selection.TabletType != "" && ti.Type != selection.TabletType {
+			continue
+		}
+		aliases = append(aliases, alias)
+	}
+	sort.Sort(aliases)
+	result := make([]*topo.TabletInfo, len(aliases))
+	for i, alias := range aliases {
+		result[i] = tabletMap[alias]
+	}
+	return result, nil
+}
+
+// RunOnTablets runs action on tablets, on at most concurrency of them
+// at the same time. It returns the result for each tablet, in the same
+// order, and an error naming the tablets the action failed on.
+func (wr *Wrangler) RunOnTablets(ctx context.Context, name string, tablets []*topo.TabletInfo, concurrency int, action func(ctx context.Context, ti *topo.TabletInfo) error) ([]TabletResult, error) {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	sem := sync2.NewSemaphore(concurrency, 0)
+	results := make([]TabletResult, len(tablets))
+	wg := sync.WaitGroup{}
+	for i, ti := range tablets {
+		results[i].Alias = ti.Alias
+		wg.Add(1)
+		go func(result *TabletResult, ti *topo.TabletInfo) {
+			defer wg.Done()
+			sem.Acquire()
+			defer sem.Release()
+			if err := action(ctx, ti); err != nil {
+				wr.Logger().Warningf("%v failed on %v: %v", name, ti.Alias, err)
+				result.Error = err.Error()
+			}
+		}(&results[i], ti)
+	}
+	wg.Wait()
+
+	var failed []string
+	for _, result := range results {
+		if result.Error != "" {
+			failed = append(failed, result.Alias.String())
+		}
+	}
+	if len(failed) > 0 {
+		return results, fmt.Errorf("%v failed on %v of %v tablets: %v", name, len(failed), len(results), strings.Join(failed, " "))
+	}
+	return results, nil
+}
@@ -0,0 +1,110 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wrangler
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/youtube/vitess/go/vt/logutil"
+	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/vt/zktopo"
+	"golang.org/x/net/context"
+)
+
+func TestBulkTabletActions(t *testing.T) {
+	ctx := context.Background()
+	ts := zktopo.NewTestServer(t, []string{"cell1", "cell2"})
+	wr := New(logutil.NewMemoryLogger(), ts, nil, time.Second)
+	for _, shard := range []string{"-80", "80-"} {
+		if err := ts.CreateShard("ks", shard, &topo.Shard{Cells: []string{"cell1", "cell2"}}); err != nil {
+			t.Fatalf("CreateShard failed: %v", err)
+		}
+	}
+	for i, tablet := range []struct {
+		cell       string
+		shard      string
+		tabletType topo.TabletType
+	}{
+		{"cell1", "-80", topo.TYPE_MASTER},
+		{"cell1", "-80", topo.TYPE_REPLICA},
+		{"cell2", "-80", topo.TYPE_REPLICA},
+		{"cell1", "80-", topo.TYPE_MASTER},
+		{"cell2", "80-", topo.TYPE_RDONLY},
+	} {
+		if err := topo.CreateTablet(ctx, ts, &topo.Tablet{
+			Alias:    topo.TabletAlias{Cell: tablet.cell, Uid: uint32(100 + i)},
+			Keyspace: "ks",
+			Shard:    tablet.shard,
+			Type:     tablet.tabletType,
+		}); err != nil {
+			t.Fatalf("CreateTablet failed: %v", err)
+		}
+	}
+
+	for _, tc := range []struct {
+		selection TabletSelection
+		want      string
+	}{
+		{TabletSelection{}, "cell1-0000000100 cell1-0000000101 cell1-0000000103 cell2-0000000102 cell2-0000000104"},
+		{TabletSelection{Keyspace: "ks", Shard: "-80"}, "cell1-0000000100 cell1-0000000101 cell2-0000000102"},
+		{TabletSelection{Keyspace: "ks", Cells: []string{"cell2"}}, "cell2-0000000102 cell2-0000000104"},
+		{TabletSelection{Cells: []string{"cell1"}, TabletType: topo.TYPE_MASTER}, "cell1-0000000100 cell1-0000000103"},
+		{TabletSelection{Keyspace: "ks", TabletType: topo.TYPE_SPARE}, ""},
+	} {
+		tablets, err := wr.SelectTablets(ctx, &tc.selection)
+		if err != nil {
+			t.Errorf("SelectTablets(%#v) failed: %v", tc.selection, err)
+			continue
+		}
+		var got []string
+		for _, ti := range tablets {
+			got = append(got, ti.Alias.String())
+		}
+		if strings.Join(got, " ") != tc.want {
+			t.Errorf("SelectTablets(%#v) = %v, want %v", tc.selection, got, tc.want)
+		}
+	}
+	if _, err := wr.SelectTablets(ctx, &TabletSelection{Shard: "-80"}); err == nil {
+		t.Errorf("SelectTablets with a shard but no keyspace worked")
+	}
+
+	// the action runs on all the tablets, at most 2 at a time, and
+	// the failures are named
+	tablets, err := wr.SelectTablets(ctx, &TabletSelection{})
+	if err != nil {
+		t.Fatalf("SelectTablets failed: %v", err)
+	}
+	var mu sync.Mutex
+	running, maxRunning := 0, 0
+	results, err := wr.RunOnTablets(ctx, "Test", tablets, 2, func(ctx context.Context, ti *topo.TabletInfo) error {
+		mu.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		mu.Lock()
+		running--
+		mu.Unlock()
+		if ti.Type == topo.TYPE_MASTER {
+			return fmt.Errorf("refused on the master")
+		}
+		return nil
+	})
+	if err == nil || !strings.Contains(err.Error(), "Test failed on 2 of 5 tablets: cell1-0000000100 cell1-0000000103") {
+		t.Errorf("RunOnTablets returned the wrong error: %v", err)
+	}
+	if maxRunning != 2 {
+		t.Errorf("RunOnTablets ran on %v tablets at the same time, want 2", maxRunning)
+	}
+	if len(results) != 5 || results[0].Alias != tablets[0].Alias || results[0].Error != "refused on the master" || results[1].Error != "" {
+		t.Errorf("RunOnTablets results: %#v", results)
+	}
+}
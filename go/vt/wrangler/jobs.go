@@ -0,0 +1,319 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wrangler
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/youtube/vitess/go/vt/logutil"
+	"golang.org/x/net/context"
+)
+
+// This file contains the job registry, that keeps track of the
+// operations run by wranglers, so they can be looked at while they
+// run and once they are done.
+
+const (
+	// DefaultRecentJobs is the number of finished jobs a
+	// JobRegistry created with it remembers.
+	DefaultRecentJobs = 100
+
+	// maxJobEvents is the number of log events a job keeps. Older
+	// events are dropped.
+	maxJobEvents = 10000
+)
+
+// DefaultJobRegistry is the registry of the jobs of the process.
+var DefaultJobRegistry = NewJobRegistry(DefaultRecentJobs)
+
+// JobStatus is the state of a Job at some point in time.
+type JobStatus struct {
+	ID    int64
+	Name  string
+	Start time.Time
+	// End is zero while the job runs.
+	End     time.Time
+	Running bool
+	// Phase is the step the job is in, like "locking shards".
+	Phase string
+	// ShardProgress has the progress of the job on each shard it
+	// works on, by keyspace/shard.
+	ShardProgress map[string]string
+	Error         string
+	// EventCount is the number of log events of the job so far.
+	EventCount int
+}
+
+// Job is an operation run by a Wrangler, like a vtctl command,
+// registered in a JobRegistry with Wrangler.StartJob.
+type Job struct {
+	id       int64
+	name     string
+	start    time.Time
+	registry *JobRegistry
+
+	// logstream gets the log events of the wrangler, and recorded
+	// is closed once they are all in events.
+	logstream logutil.ChannelLogger
+	recorded  chan struct{}
+
+	// mu protects the fields below. events has the log events,
+	// except the dropped first ones. changed is closed, and
+	// replaced, every time events or end changes.
+	mu            sync.Mutex
+	phase         string
+	shardProgress map[string]string
+	end           time.Time
+	err           error
+	events        []logutil.LoggerEvent
+	dropped       int
+	changed       chan struct{}
+}
+
+// record stores the log events of the job until logstream is closed.
+func (job *Job) record() {
+	for e := range job.logstream {
+		job.mu.Lock()
+		job.events = append(job.events, e)
+		if len(job.events) > maxJobEvents {
+			n := len(job.events) - maxJobEvents
+			job.events = job.events[n:]
+			job.dropped += n
+		}
+		job.notifyLocked()
+		job.mu.Unlock()
+	}
+	close(job.recorded)
+}
+
+func (job *Job) notifyLocked() {
+	close(job.changed)
+	job.changed = make(chan struct{})
+}
+
+// ID returns the id of the job in its registry.
+func (job *Job) ID() int64 {
+	return job.id
+}
+
+// SetPhase records the step the job is in.
+func (job *Job) SetPhase(phase string) {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	job.phase = phase
+}
+
+// SetShardProgress records the progress of the job on a shard.
+func (job *Job) SetShardProgress(keyspace, shard, progress string) {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	if job.shardProgress == nil {
+		job.shardProgress = make(map[string]string)
+	}
+	job.shardProgress[keyspace+"/"+shard] = progress
+}
+
+// Finish records the end of the job, and its error if it failed.
+// The wrangler of the job must not be used after that.
+func (job *Job) Finish(err error) {
+	close(job.logstream)
+	<-job.recorded
+
+	job.mu.Lock()
+	job.end = time.Now()
+	job.err = err
+	job.notifyLocked()
+	job.mu.Unlock()
+
+	job.registry.finish(job)
+}
+
+// Status returns the current state of the job.
+func (job *Job) Status() *JobStatus {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	status := &JobStatus{
+		ID:         job.id,
+		Name:       job.name,
+		Start:      job.start,
+		End:        job.end,
+		Running:    job.end.IsZero(),
+		Phase:      job.phase,
+		EventCount: job.dropped + len(job.events),
+	}
+	if len(job.shardProgress) > 0 {
+		status.ShardProgress = make(map[string]string, len(job.shardProgress))
+		for k, v := range job.shardProgress {
+			status.ShardProgress[k] = v
+		}
+	}
+	if job.err != nil {
+		status.Error = job.err.Error()
+	}
+	return status
+}
+
+// JobEvents is a slice of the log events of a job.
+type JobEvents struct {
+	Events []logutil.LoggerEvent
+	// Next is the position of the event after Events, to get
+	// the next ones from.
+	Next int
+	// Done is set once the job is finished and Events has its
+	// last events.
+	Done bool
+}
+
+// Events returns the log events of the job from position from. If
+// there are none yet, it waits for some until the job finishes or ctx
+// is done. Events dropped because the job has too many are skipped.
+func (job *Job) Events(ctx context.Context, from int) *JobEvents {
+	for {
+		job.mu.Lock()
+		next := job.dropped + len(job.events)
+		if from < job.dropped {
+			from = job.dropped
+		}
+		if from > next {
+			from = next
+		}
+		done := !job.end.IsZero()
+		if from < next || done {
+			result := &JobEvents{
+				Events: append([]logutil.LoggerEvent(nil), job.events[from-job.dropped:]...),
+				Next:   next,
+				Done:   done,
+			}
+			job.mu.Unlock()
+			return result
+		}
+		changed := job.changed
+		job.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return &JobEvents{Next: from}
+		}
+	}
+}
+
+// JobRegistry keeps the running jobs, and the last finished ones.
+type JobRegistry struct {
+	recentSize int
+
+	// mu protects the fields below. recent has the finished jobs,
+	// the most recent last.
+	mu      sync.Mutex
+	lastID  int64
+	running map[int64]*Job
+	recent  []*Job
+}
+
+// NewJobRegistry returns a JobRegistry that remembers recentSize
+// finished jobs.
+func NewJobRegistry(recentSize int) *JobRegistry {
+	return &JobRegistry{
+		recentSize: recentSize,
+		running:    make(map[int64]*Job),
+	}
+}
+
+func (r *JobRegistry) start(name string) *Job {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lastID++
+	job := &Job{
+		id:        r.lastID,
+		name:      name,
+		start:     time.Now(),
+		registry:  r,
+		logstream: logutil.NewChannelLogger(10),
+		recorded:  make(chan struct{}),
+		changed:   make(chan struct{}),
+	}
+	r.running[job.id] = job
+	go job.record()
+	return job
+}
+
+func (r *JobRegistry) finish(job *Job) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.running, job.id)
+	r.recent = append(r.recent, job)
+	if len(r.recent) > r.recentSize {
+		r.recent = r.recent[len(r.recent)-r.recentSize:]
+	}
+}
+
+// Job returns the job with that id, or nil if it is not running
+// and was not finished recently.
+func (r *JobRegistry) Job(id int64) *Job {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if job, ok := r.running[id]; ok {
+		return job
+	}
+	for _, job := range r.recent {
+		if job.id == id {
+			return job
+		}
+	}
+	return nil
+}
+
+type jobStatusesByID []*JobStatus
+
+func (s jobStatusesByID) Len() int           { return len(s) }
+func (s jobStatusesByID) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s jobStatusesByID) Less(i, j int) bool { return s[i].ID < s[j].ID }
+
+// Statuses returns the state of the running and recently finished
+// jobs, the oldest first.
+func (r *JobRegistry) Statuses() []*JobStatus {
+	r.mu.Lock()
+	jobs := make([]*Job, 0, len(r.running)+len(r.recent))
+	for _, job := range r.running {
+		jobs = append(jobs, job)
+	}
+	jobs = append(jobs, r.recent...)
+	r.mu.Unlock()
+
+	statuses := make([]*JobStatus, len(jobs))
+	for i, job := range jobs {
+		statuses[i] = job.Status()
+	}
+	sort.Sort(jobStatusesByID(statuses))
+	return statuses
+}
+
+// StartJob registers a job named name in registry, and makes wr
+// record its log events in it. Like SetLogger, it must be called
+// before wr is used, and Finish must be called on the returned Job
+// once the operation is done.
+func (wr *Wrangler) StartJob(registry *JobRegistry, name string) *Job {
+	job := registry.start(name)
+	wr.job = job
+	wr.logger = logutil.NewTeeLogger(job.logstream, wr.logger)
+	return job
+}
+
+// setJobPhase records the step the job of wr is in, if it has one.
+func (wr *Wrangler) setJobPhase(phase string) {
+	if wr.job != nil {
+		wr.job.SetPhase(phase)
+	}
+}
+
+// setJobShardProgress records the progress of the job of wr on a
+// shard, if it has a job.
+func (wr *Wrangler) setJobShardProgress(keyspace, shard, progress string) {
+	if wr.job != nil {
+		wr.job.SetShardProgress(keyspace, shard, progress)
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wrangler
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/youtube/vitess/go/vt/logutil"
+	"golang.org/x/net/context"
+)
+
+func TestJobRegistry(t *testing.T) {
+	registry := NewJobRegistry(1)
+	wr := New(logutil.NewMemoryLogger(), nil, nil, time.Second)
+	job := wr.StartJob(registry, "MigrateServedTypes ks/0 rdonly")
+	wr.Logger().Infof("first")
+	wr.setJobPhase("locking shards")
+	wr.setJobShardProgress("ks", "80-", "caught up")
+
+	events := job.Events(context.Background(), 0)
+	if len(events.Events) != 1 || events.Events[0].Value != "first" || events.Next != 1 || events.Done {
+		t.Errorf("Events(0): %#v", events)
+	}
+
+	// A reader waits for the next event.
+	done := make(chan *JobEvents)
+	go func() {
+		done <- job.Events(context.Background(), 1)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	wr.Logger().Warningf("second")
+	if events := <-done; len(events.Events) != 1 || events.Events[0].Value != "second" || events.Next != 2 {
+		t.Errorf("Events(1): %#v", events)
+	}
+
+	// And gives up at its deadline.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	events = job.Events(ctx, 2)
+	cancel()
+	if len(events.Events) != 0 || events.Next != 2 || events.Done {
+		t.Errorf("Events(2) with a deadline: %#v", events)
+	}
+
+	status := job.Status()
+	if !status.Running || status.Phase != "locking shards" || status.ShardProgress["ks/80-"] != "caught up" || status.EventCount != 2 {
+		t.Errorf("Status of the running job: %#v", status)
+	}
+
+	job.Finish(fmt.Errorf("migration failed"))
+	status = job.Status()
+	if status.Running || status.End.IsZero() || status.Error != "migration failed" {
+		t.Errorf("Status of the finished job: %#v", status)
+	}
+	if events := job.Events(context.Background(), 2); len(events.Events) != 0 || !events.Done {
+		t.Errorf("Events of the finished job: %#v", events)
+	}
+
+	// Only the last finished job is kept.
+	wr2 := New(logutil.NewMemoryLogger(), nil, nil, time.Second)
+	job2 := wr2.StartJob(registry, "Validate")
+	statuses := registry.Statuses()
+	if len(statuses) != 2 || statuses[0].ID != job.ID() || statuses[1].ID != job2.ID() {
+		t.Errorf("Statuses: %#v", statuses)
+	}
+	job2.Finish(nil)
+	if registry.Job(job.ID()) != nil || registry.Job(job2.ID()) != job2 {
+		t.Errorf("registry kept the wrong jobs: %#v", registry.Statuses())
+	}
+}
+
+func TestJobEventsLimit(t *testing.T) {
+	wr := New(logutil.NewMemoryLogger(), nil, nil, time.Second)
+	job := wr.StartJob(NewJobRegistry(1), "test")
+	for i := 0; i < maxJobEvents+5; i++ {
+		wr.Logger().Infof("event %v", i)
+	}
+	job.Finish(nil)
+	events := job.Events(context.Background(), 0)
+	if len(events.Events) != maxJobEvents || events.Events[0].Value != "event 5" || events.Next != maxJobEvents+5 {
+		t.Errorf("Events: %v events, first %v, next %v", len(events.Events), events.Events[0].Value, events.Next)
+	}
+}
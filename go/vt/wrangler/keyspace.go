@@ -134,6 +134,7 @@ func (wr *Wrangler) MigrateServedTypes(ctx context.Context, keyspace, shard stri
 
 	// lock the shards: sources, then destinations
 	// (note they're all ordered by shard name)
+	wr.setJobPhase("locking shards")
 	actionNode := actionnode.MigrateServedTypes(servedType)
 	sourceLockPath := make([]string, len(sourceShards))
 	for i, si := range sourceShards {
@@ -156,9 +157,11 @@ func (wr *Wrangler) MigrateServedTypes(ctx context.Context, keyspace, shard stri
 	rec := concurrency.AllErrorRecorder{}
 
 	// execute the migration
+	wr.setJobPhase("migrating served types")
 	rec.RecordError(wr.migrateServedTypes(ctx, keyspace, sourceShards, destinationShards, cells, servedType, reverse, filteredReplicationWaitTime))
 
 	// unlock the shards, we're done
+	wr.setJobPhase("unlocking shards")
 	for i := len(destinationShards) - 1; i >= 0; i-- {
 		rec.RecordError(wr.unlockShard(ctx, destinationShards[i].Keyspace(), destinationShards[i].ShardName(), actionNode, destinationLockPath[i], nil))
 	}
@@ -168,6 +171,7 @@ func (wr *Wrangler) MigrateServedTypes(ctx context.Context, keyspace, shard stri
 
 	// rebuild the keyspace serving graph if there was no error
 	if !rec.HasErrors() {
+		wr.setJobPhase("rebuilding the keyspace graph")
 		rec.RecordError(wr.RebuildKeyspaceGraph(ctx, keyspace, cells, false))
 	}
 
@@ -184,6 +188,7 @@ func (wr *Wrangler) MigrateServedTypes(ctx context.Context, keyspace, shard stri
 			// For a forwards migration, we just disabled query service on the source shards
 			refreshShards = sourceShards
 		}
+		wr.setJobPhase("refreshing tablets")
 		for _, si := range refreshShards {
 			rec.RecordError(wr.RefreshTablesByShard(ctx, si, servedType, cells))
 		}
@@ -260,6 +265,7 @@ func (wr *Wrangler) waitForFilteredReplication(ctx context.Context, sourcePositi
 
 				// and wait for it
 				wr.Logger().Infof("Waiting for %v to catch up", si.MasterAlias)
+				wr.setJobShardProgress(si.Keyspace(), si.ShardName(), fmt.Sprintf("waiting for filtered replication from %v/%v", sourceShard.Keyspace, sourceShard.Shard))
 				tablet, err := wr.ts.GetTablet(si.MasterAlias)
 				if err != nil {
 					rec.RecordError(err)
@@ -268,8 +274,10 @@ func (wr *Wrangler) waitForFilteredReplication(ctx context.Context, sourcePositi
 
 				if err := wr.tmc.WaitBlpPosition(ctx, tablet, blpPosition, waitTime); err != nil {
 					rec.RecordError(err)
+					wr.setJobShardProgress(si.Keyspace(), si.ShardName(), fmt.Sprintf("filtered replication did not catch up: %v", err))
 				} else {
 					wr.Logger().Infof("%v caught up", si.MasterAlias)
+					wr.setJobShardProgress(si.Keyspace(), si.ShardName(), "caught up")
 				}
 			}
 		}(si)
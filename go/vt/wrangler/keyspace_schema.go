@@ -0,0 +1,225 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wrangler
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	myproto "github.com/youtube/vitess/go/vt/mysqlctl/proto"
+	"github.com/youtube/vitess/go/vt/topo"
+	"golang.org/x/net/context"
+)
+
+// This file contains the comparison of the schemas of the shard
+// masters of a keyspace, table by table and column by column.
+
+// ShardSchema is the schema of the master of a shard.
+type ShardSchema struct {
+	Shard  string
+	Master topo.TabletAlias
+
+	// Schema is nil if it could not be read, and Error says why.
+	Schema *myproto.SchemaDefinition
+	Error  string
+}
+
+// KeyspaceSchemaColumn is a column of a table in one shard.
+type KeyspaceSchemaColumn struct {
+	Name string
+
+	// Definition is the line of the column in the CREATE TABLE.
+	Definition string
+
+	// Differs is true if the column is not defined the same way in
+	// all the shards that have the table.
+	Differs bool
+}
+
+// KeyspaceSchemaTable is a table of a keyspace, across its shards.
+type KeyspaceSchemaTable struct {
+	Name string
+	Type string
+
+	// Shards maps the shards that have the table to its columns there.
+	Shards map[string][]*KeyspaceSchemaColumn
+
+	// MissingIn are the shards that don't have the table.
+	MissingIn []string
+
+	// DiffColumns are the names of the columns that differ.
+	DiffColumns []string
+
+	// SchemaDiffers is true if the CREATE TABLE is not the same in all
+	// the shards that have the table, e.g. because of an index.
+	SchemaDiffers bool
+}
+
+// Differs returns true if the table is not the same in all the shards.
+func (kst *KeyspaceSchemaTable) Differs() bool {
+	return len(kst.MissingIn) > 0 || len(kst.DiffColumns) > 0 || kst.SchemaDiffers
+}
+
+// KeyspaceSchema is the schema of a keyspace, compared across its
+// shards.
+type KeyspaceSchema struct {
+	Keyspace string
+	Shards   []*ShardSchema
+
+	// Tables are all the tables in any shard, sorted by name.
+	Tables []*KeyspaceSchemaTable
+}
+
+// GetKeyspaceSchemas reads the schema of the master of each shard of
+// the keyspace, with fetchConcurrency GetSchema RPCs at a time. A shard
+// whose schema cannot be read has its Error set. The shards are sorted
+// by name.
+func (wr *Wrangler) GetKeyspaceSchemas(ctx context.Context, keyspace string, excludeTables []string, includeViews bool, fetchConcurrency int) ([]*ShardSchema, error) {
+	shards, err := wr.ts.GetShardNames(keyspace)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(shards)
+
+	sf := wr.newSchemaFetcher(excludeTables, includeViews, fetchConcurrency)
+	result := make([]*ShardSchema, len(shards))
+	wg := sync.WaitGroup{}
+	for i, shard := range shards {
+		result[i] = &ShardSchema{Shard: shard}
+		wg.Add(1)
+		go func(ss *ShardSchema) {
+			defer wg.Done()
+			si, err := wr.ts.GetShard(keyspace, ss.Shard)
+			if err != nil {
+				ss.Error = err.Error()
+				return
+			}
+			if si.MasterAlias.Uid == topo.NO_TABLET {
+				ss.Error = fmt.Sprintf("no master in shard %v/%v", keyspace, ss.Shard)
+				return
+			}
+			ss.Master = si.MasterAlias
+			if ss.Schema, err = sf.getSchema(ctx, si.MasterAlias); err != nil {
+				ss.Error = err.Error()
+			}
+		}(result[i])
+	}
+	wg.Wait()
+	return result, nil
+}
+
+// NewKeyspaceSchema compares the schemas of the shards of a keyspace.
+// The shards without a schema are left out of the comparison.
+func NewKeyspaceSchema(keyspace string, shards []*ShardSchema) *KeyspaceSchema {
+	ks := &KeyspaceSchema{
+		Keyspace: keyspace,
+		Shards:   shards,
+	}
+	tables := make(map[string]*KeyspaceSchemaTable)
+	schemas := make(map[string]map[string]string)
+	var readShards []string
+	for _, ss := range shards {
+		if ss.Schema == nil {
+			continue
+		}
+		readShards = append(readShards, ss.Shard)
+		for _, td := range ss.Schema.TableDefinitions {
+			kst, ok := tables[td.Name]
+			if !ok {
+				kst = &KeyspaceSchemaTable{
+					Name:   td.Name,
+					Type:   td.Type,
+					Shards: make(map[string][]*KeyspaceSchemaColumn),
+				}
+				tables[td.Name] = kst
+				schemas[td.Name] = make(map[string]string)
+			}
+			kst.Shards[ss.Shard] = tableColumns(td)
+			schemas[td.Name][ss.Shard] = td.Schema
+		}
+	}
+
+	for name, kst := range tables {
+		for _, shard := range readShards {
+			if _, ok := kst.Shards[shard]; !ok {
+				kst.MissingIn = append(kst.MissingIn, shard)
+			}
+		}
+		compareColumns(kst)
+
+		reference := ""
+		for _, schema := range schemas[name] {
+			if reference == "" {
+				reference = schema
+			} else if schema != reference {
+				kst.SchemaDiffers = true
+			}
+		}
+		ks.Tables = append(ks.Tables, kst)
+	}
+	sort.Sort(keyspaceSchemaTables(ks.Tables))
+	return ks
+}
+
+// compareColumns sets Differs on the columns that are missing in a
+// shard, or defined differently, and lists them in DiffColumns.
+func compareColumns(kst *KeyspaceSchemaTable) {
+	definitions := make(map[string]map[string]bool)
+	present := make(map[string]int)
+	for _, columns := range kst.Shards {
+		for _, column := range columns {
+			if definitions[column.Name] == nil {
+				definitions[column.Name] = make(map[string]bool)
+			}
+			definitions[column.Name][column.Definition] = true
+			present[column.Name]++
+		}
+	}
+	for name, defs := range definitions {
+		if len(defs) > 1 || present[name] != len(kst.Shards) {
+			kst.DiffColumns = append(kst.DiffColumns, name)
+		}
+	}
+	sort.Strings(kst.DiffColumns)
+	for _, columns := range kst.Shards {
+		for _, column := range columns {
+			column.Differs = len(definitions[column.Name]) > 1 || present[column.Name] != len(kst.Shards)
+		}
+	}
+}
+
+// tableColumns returns the columns of a table, with their line in the
+// CREATE TABLE. For the statements it cannot parse, like views, the
+// definition is the column name.
+func tableColumns(td *myproto.TableDefinition) []*KeyspaceSchemaColumn {
+	lines := make(map[string]string)
+	for _, line := range strings.Split(td.Schema, "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "`") {
+			continue
+		}
+		if end := strings.Index(line[1:], "`"); end >= 0 {
+			lines[line[1:end+1]] = strings.TrimSuffix(line, ",")
+		}
+	}
+	result := make([]*KeyspaceSchemaColumn, len(td.Columns))
+	for i, name := range td.Columns {
+		definition, ok := lines[name]
+		if !ok {
+			definition = name
+		}
+		result[i] = &KeyspaceSchemaColumn{Name: name, Definition: definition}
+	}
+	return result
+}
+
+// keyspaceSchemaTables sorts tables by name.
+type keyspaceSchemaTables []*KeyspaceSchemaTable
+
+func (kst keyspaceSchemaTables) Len() int           { return len(kst) }
+func (kst keyspaceSchemaTables) Swap(i, j int)      { kst[i], kst[j] = kst[j], kst[i] }
+func (kst keyspaceSchemaTables) Less(i, j int) bool { return kst[i].Name < kst[j].Name }
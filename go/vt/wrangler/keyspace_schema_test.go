@@ -0,0 +1,60 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wrangler
+
+import (
+	"reflect"
+	"testing"
+
+	myproto "github.com/youtube/vitess/go/vt/mysqlctl/proto"
+)
+
+func TestNewKeyspaceSchema(t *testing.T) {
+	table1 := &myproto.TableDefinition{
+		Name:    "table1",
+		Schema:  "CREATE TABLE `table1` (\n  `id` bigint(20) NOT NULL,\n  `msg` varchar(64) DEFAULT NULL,\n  PRIMARY KEY (`id`)\n) ENGINE=InnoDB",
+		Columns: []string{"id", "msg"},
+		Type:    myproto.TableBaseTable,
+	}
+	table1Wider := &myproto.TableDefinition{
+		Name:    "table1",
+		Schema:  "CREATE TABLE `table1` (\n  `id` bigint(20) NOT NULL,\n  `msg` varchar(128) DEFAULT NULL,\n  `extra` int(11),\n  PRIMARY KEY (`id`)\n) ENGINE=InnoDB",
+		Columns: []string{"id", "msg", "extra"},
+		Type:    myproto.TableBaseTable,
+	}
+	table2 := &myproto.TableDefinition{
+		Name:    "table2",
+		Schema:  "CREATE TABLE `table2` (\n  `id` bigint(20) NOT NULL\n) ENGINE=InnoDB",
+		Columns: []string{"id"},
+		Type:    myproto.TableBaseTable,
+	}
+
+	ks := NewKeyspaceSchema("ks", []*ShardSchema{
+		{Shard: "-80", Schema: &myproto.SchemaDefinition{TableDefinitions: []*myproto.TableDefinition{table1, table2}}},
+		{Shard: "80-", Schema: &myproto.SchemaDefinition{TableDefinitions: []*myproto.TableDefinition{table1Wider}}},
+		{Shard: "c0-", Error: "no master"},
+	})
+	if len(ks.Tables) != 2 || ks.Tables[0].Name != "table1" || ks.Tables[1].Name != "table2" {
+		t.Fatalf("wrong tables: %#v", ks.Tables)
+	}
+
+	t1 := ks.Tables[0]
+	if !t1.SchemaDiffers || len(t1.MissingIn) != 0 || !t1.Differs() {
+		t.Errorf("table1 should only differ in its schema: %#v", t1)
+	}
+	if want := []string{"extra", "msg"}; !reflect.DeepEqual(t1.DiffColumns, want) {
+		t.Errorf("table1 DiffColumns = %v, want %v", t1.DiffColumns, want)
+	}
+	columns := t1.Shards["80-"]
+	if len(columns) != 3 || columns[0].Differs || !columns[1].Differs || columns[1].Definition != "`msg` varchar(128) DEFAULT NULL" || !columns[2].Differs {
+		t.Errorf("table1 columns in 80-: %#v %#v %#v", columns[0], columns[1], columns[2])
+	}
+
+	// the shard without a schema is not counted as missing the table
+	t2 := ks.Tables[1]
+	if want := []string{"80-"}; !reflect.DeepEqual(t2.MissingIn, want) || t2.SchemaDiffers || len(t2.DiffColumns) != 0 {
+		t.Errorf("table2 should only be missing in 80-: %#v", t2)
+	}
+}
@@ -26,6 +26,17 @@ func (wr *Wrangler) GetPermissions(ctx context.Context, tabletAlias topo.TabletA
 	return wr.tmc.GetPermissions(ctx, tablet)
 }
 
+// ReloadUsers makes a remote tablet apply its users spec file, and
+// returns the statements it ran.
+func (wr *Wrangler) ReloadUsers(ctx context.Context, tabletAlias topo.TabletAlias) ([]string, error) {
+	tablet, err := wr.ts.GetTablet(tabletAlias)
+	if err != nil {
+		return nil, err
+	}
+
+	return wr.tmc.ReloadUsers(ctx, tablet)
+}
+
 // diffPermissions is a helper method to asynchronously diff a permissions
 func (wr *Wrangler) diffPermissions(ctx context.Context, masterPermissions *myproto.Permissions, masterAlias topo.TabletAlias, alias topo.TabletAlias, wg *sync.WaitGroup, er concurrency.ErrorRecorder) {
 	defer wg.Done()
@@ -76,10 +87,7 @@ func (wr *Wrangler) ValidatePermissionsShard(ctx context.Context, keyspace, shar
 		go wr.diffPermissions(ctx, masterPermissions, si.MasterAlias, alias, &wg, &er)
 	}
 	wg.Wait()
-	if er.HasErrors() {
-		return fmt.Errorf("Permissions diffs:\n%v", er.Error().Error())
-	}
-	return nil
+	return newValidationError("Permissions diffs", &er)
 }
 
 // ValidatePermissionsKeyspace validates all the permissions are the same
@@ -135,8 +143,5 @@ func (wr *Wrangler) ValidatePermissionsKeyspace(ctx context.Context, keyspace st
 		}
 	}
 	wg.Wait()
-	if er.HasErrors() {
-		return fmt.Errorf("Permissions diffs:\n%v", er.Error().Error())
-	}
-	return nil
+	return newValidationError("Permissions diffs", &er)
 }
@@ -0,0 +1,170 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wrangler
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/youtube/vitess/go/vt/tabletmanager/actionnode"
+	"github.com/youtube/vitess/go/vt/tabletserver/customrule/topocustomrule"
+	"github.com/youtube/vitess/go/vt/topo"
+	"golang.org/x/net/context"
+)
+
+// This file manages the query rules of the keyspaces and of the
+// tablets in the topology, that the tablets started with
+// -topocustomrules apply. The changes are done under the keyspace
+// lock, for the tablets too, and the expired rules are removed.
+
+// GetKeyspaceQueryRules returns the query rules of keyspace, including
+// the expired ones.
+func (wr *Wrangler) GetKeyspaceQueryRules(keyspace string) (*topo.QueryRules, error) {
+	queryRuler, err := wr.queryRuler()
+	if err != nil {
+		return nil, err
+	}
+	return noQueryRules(queryRuler.GetKeyspaceQueryRules(keyspace))
+}
+
+// GetTabletQueryRules returns the query rules of a tablet, including
+// the expired ones.
+func (wr *Wrangler) GetTabletQueryRules(tabletAlias topo.TabletAlias) (*topo.QueryRules, error) {
+	queryRuler, err := wr.queryRuler()
+	if err != nil {
+		return nil, err
+	}
+	return noQueryRules(queryRuler.GetTabletQueryRules(tabletAlias))
+}
+
+// SetKeyspaceQueryRule adds the rule to the query rules of keyspace,
+// replacing the one with the same name. With a ttl, the rule expires
+// after it.
+func (wr *Wrangler) SetKeyspaceQueryRule(ctx context.Context, keyspace, rule string, ttl time.Duration) error {
+	return wr.updateKeyspaceQueryRules(ctx, keyspace, setQueryRule(rule, ttl))
+}
+
+// SetTabletQueryRule is like SetKeyspaceQueryRule for a tablet. The
+// tablet rule replaces the keyspace rule with the same name.
+func (wr *Wrangler) SetTabletQueryRule(ctx context.Context, tabletAlias topo.TabletAlias, rule string, ttl time.Duration) error {
+	return wr.updateTabletQueryRules(ctx, tabletAlias, setQueryRule(rule, ttl))
+}
+
+// ClearKeyspaceQueryRules removes the named query rules of keyspace,
+// or all of them if names is empty.
+func (wr *Wrangler) ClearKeyspaceQueryRules(ctx context.Context, keyspace string, names []string) error {
+	return wr.updateKeyspaceQueryRules(ctx, keyspace, clearQueryRules(names))
+}
+
+// ClearTabletQueryRules is like ClearKeyspaceQueryRules for a tablet.
+func (wr *Wrangler) ClearTabletQueryRules(ctx context.Context, tabletAlias topo.TabletAlias, names []string) error {
+	return wr.updateTabletQueryRules(ctx, tabletAlias, clearQueryRules(names))
+}
+
+func (wr *Wrangler) queryRuler() (topo.QueryRuler, error) {
+	queryRuler, ok := wr.ts.(topo.QueryRuler)
+	if !ok {
+		return nil, fmt.Errorf("%T doesn't store query rules", wr.ts)
+	}
+	return queryRuler, nil
+}
+
+// noQueryRules returns empty rules instead of ErrNoNode.
+func noQueryRules(qrs *topo.QueryRules, err error) (*topo.QueryRules, error) {
+	if err == topo.ErrNoNode {
+		return &topo.QueryRules{}, nil
+	}
+	return qrs, err
+}
+
+func (wr *Wrangler) updateKeyspaceQueryRules(ctx context.Context, keyspace string, update func(qrs *topo.QueryRules) error) error {
+	queryRuler, err := wr.queryRuler()
+	if err != nil {
+		return err
+	}
+	return wr.updateQueryRules(ctx, keyspace, update, func() (*topo.QueryRules, error) {
+		return queryRuler.GetKeyspaceQueryRules(keyspace)
+	}, func(qrs *topo.QueryRules) error {
+		return queryRuler.SaveKeyspaceQueryRules(keyspace, qrs)
+	})
+}
+
+func (wr *Wrangler) updateTabletQueryRules(ctx context.Context, tabletAlias topo.TabletAlias, update func(qrs *topo.QueryRules) error) error {
+	queryRuler, err := wr.queryRuler()
+	if err != nil {
+		return err
+	}
+	ti, err := wr.ts.GetTablet(tabletAlias)
+	if err != nil {
+		return err
+	}
+	return wr.updateQueryRules(ctx, ti.Keyspace, update, func() (*topo.QueryRules, error) {
+		return queryRuler.GetTabletQueryRules(tabletAlias)
+	}, func(qrs *topo.QueryRules) error {
+		return queryRuler.SaveTabletQueryRules(tabletAlias, qrs)
+	})
+}
+
+// updateQueryRules runs update on the rules read by get, and saves
+// them with save, under the lock of keyspace.
+func (wr *Wrangler) updateQueryRules(ctx context.Context, keyspace string, update func(qrs *topo.QueryRules) error, get func() (*topo.QueryRules, error), save func(qrs *topo.QueryRules) error) error {
+	actionNode := actionnode.SetKeyspaceQueryRules()
+	lockPath, err := wr.lockKeyspace(ctx, keyspace, actionNode)
+	if err != nil {
+		return err
+	}
+	err = func() error {
+		qrs, err := noQueryRules(get())
+		if err != nil {
+			return err
+		}
+		if qrs.Rules == nil {
+			qrs.Rules = make(map[string]*topo.QueryRule)
+		}
+		if err := update(qrs); err != nil {
+			return err
+		}
+		now := time.Now()
+		for name, qr := range qrs.Rules {
+			if qr.Expired(now) {
+				wr.Logger().Infof("removing the expired query rule %v", name)
+				delete(qrs.Rules, name)
+			}
+		}
+		return save(qrs)
+	}()
+	return wr.unlockKeyspace(ctx, keyspace, actionNode, lockPath, err)
+}
+
+func setQueryRule(rule string, ttl time.Duration) func(qrs *topo.QueryRules) error {
+	return func(qrs *topo.QueryRules) error {
+		qr, err := topocustomrule.ParseQueryRule(rule)
+		if err != nil {
+			return fmt.Errorf("invalid query rule: %v", err)
+		}
+		newRule := &topo.QueryRule{Rule: rule}
+		if ttl > 0 {
+			newRule.Expiration = time.Now().Add(ttl).Unix()
+		}
+		qrs.Rules[qr.Name] = newRule
+		return nil
+	}
+}
+
+func clearQueryRules(names []string) func(qrs *topo.QueryRules) error {
+	return func(qrs *topo.QueryRules) error {
+		if len(names) == 0 {
+			qrs.Rules = make(map[string]*topo.QueryRule)
+			return nil
+		}
+		for _, name := range names {
+			if _, ok := qrs.Rules[name]; !ok {
+				return fmt.Errorf("no query rule %v", name)
+			}
+			delete(qrs.Rules, name)
+		}
+		return nil
+	}
+}
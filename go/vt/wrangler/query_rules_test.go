@@ -0,0 +1,128 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wrangler
+
+import (
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/youtube/vitess/go/vt/logutil"
+	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/vt/zktopo"
+	"golang.org/x/net/context"
+)
+
+// queryRuleNames returns the sorted names of the rules of qrs.
+func queryRuleNames(qrs *topo.QueryRules) string {
+	var names []string
+	for name := range qrs.Rules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
+
+func TestQueryRules(t *testing.T) {
+	ctx := context.Background()
+	ts := zktopo.NewTestServer(t, []string{"cell1"})
+	wr := New(logutil.NewMemoryLogger(), ts, nil, time.Second)
+	keyspaceRules := func() string {
+		qrs, err := wr.GetKeyspaceQueryRules("ks")
+		if err != nil {
+			t.Fatalf("GetKeyspaceQueryRules failed: %v", err)
+		}
+		return queryRuleNames(qrs)
+	}
+	tabletAlias := topo.TabletAlias{Cell: "cell1", Uid: 100}
+	if err := ts.CreateKeyspace("ks", &topo.Keyspace{}); err != nil {
+		t.Fatalf("CreateKeyspace failed: %v", err)
+	}
+	if err := ts.CreateShard("ks", "0", &topo.Shard{Cells: []string{"cell1"}}); err != nil {
+		t.Fatalf("CreateShard failed: %v", err)
+	}
+	if err := topo.CreateTablet(ctx, ts, &topo.Tablet{
+		Alias:    tabletAlias,
+		Keyspace: "ks",
+		Shard:    "0",
+		Type:     topo.TYPE_REPLICA,
+	}); err != nil {
+		t.Fatalf("CreateTablet failed: %v", err)
+	}
+
+	if got := keyspaceRules(); got != "" {
+		t.Errorf("GetKeyspaceQueryRules with no rules: %v", got)
+	}
+	for _, rule := range []string{
+		`{"Name": "r1", "Query": "select"}`,
+		`{"Name": "r2", "Action": "FAIL_RETRY"}`,
+	} {
+		if err := wr.SetKeyspaceQueryRule(ctx, "ks", rule, 0); err != nil {
+			t.Fatalf("SetKeyspaceQueryRule(%v) failed: %v", rule, err)
+		}
+	}
+	if err := wr.SetTabletQueryRule(ctx, tabletAlias, `{"Name": "r1"}`, time.Hour); err != nil {
+		t.Fatalf("SetTabletQueryRule failed: %v", err)
+	}
+	if got, want := keyspaceRules(), "r1,r2"; got != want {
+		t.Errorf("GetKeyspaceQueryRules: %v, want %v", got, want)
+	}
+	qrs, err := wr.GetTabletQueryRules(tabletAlias)
+	if err != nil {
+		t.Fatalf("GetTabletQueryRules failed: %v", err)
+	}
+	if got, want := queryRuleNames(qrs), "r1"; got != want {
+		t.Errorf("GetTabletQueryRules: %v, want %v", got, want)
+	}
+	if expiration := qrs.Rules["r1"].Expiration; expiration < time.Now().Add(59*time.Minute).Unix() || expiration > time.Now().Add(time.Hour).Unix() {
+		t.Errorf("the tablet rule should expire in an hour: %v", expiration)
+	}
+
+	// invalid rules
+	for _, c := range []struct {
+		rule, err string
+	}{
+		{`{"Name": "r3", "Action": "UNKNOWN"}`, "invalid query rule: "},
+		{`{"Query": "select"}`, "invalid query rule: the rule has no name"},
+	} {
+		if err := wr.SetKeyspaceQueryRule(ctx, "ks", c.rule, 0); err == nil || !strings.HasPrefix(err.Error(), c.err) {
+			t.Errorf("SetKeyspaceQueryRule(%v): %v, want %v", c.rule, err, c.err)
+		}
+	}
+	if err := wr.SetKeyspaceQueryRule(ctx, "unknown", `{"Name": "r1"}`, 0); err == nil {
+		t.Errorf("SetKeyspaceQueryRule on an unknown keyspace worked")
+	}
+
+	// the expired rules are removed by the next change
+	qrs, _ = ts.GetKeyspaceQueryRules("ks")
+	qrs.Rules["r2"].Expiration = time.Now().Add(-time.Second).Unix()
+	if err := ts.SaveKeyspaceQueryRules("ks", qrs); err != nil {
+		t.Fatalf("SaveKeyspaceQueryRules failed: %v", err)
+	}
+	if err := wr.SetKeyspaceQueryRule(ctx, "ks", `{"Name": "r3"}`, 0); err != nil {
+		t.Fatalf("SetKeyspaceQueryRule failed: %v", err)
+	}
+	if got, want := keyspaceRules(), "r1,r3"; got != want {
+		t.Errorf("GetKeyspaceQueryRules after an expiration: %v, want %v", got, want)
+	}
+
+	// clearing
+	if err := wr.ClearKeyspaceQueryRules(ctx, "ks", []string{"r4"}); err == nil || err.Error() != "no query rule r4" {
+		t.Errorf("ClearKeyspaceQueryRules(r4): %v", err)
+	}
+	if err := wr.ClearKeyspaceQueryRules(ctx, "ks", []string{"r1"}); err != nil {
+		t.Fatalf("ClearKeyspaceQueryRules failed: %v", err)
+	}
+	if got, want := keyspaceRules(), "r3"; got != want {
+		t.Errorf("GetKeyspaceQueryRules after ClearKeyspaceQueryRules(r1): %v, want %v", got, want)
+	}
+	if err := wr.ClearTabletQueryRules(ctx, tabletAlias, nil); err != nil {
+		t.Fatalf("ClearTabletQueryRules failed: %v", err)
+	}
+	if qrs, err := wr.GetTabletQueryRules(tabletAlias); err != nil || len(qrs.Rules) != 0 {
+		t.Errorf("GetTabletQueryRules after ClearTabletQueryRules: %v %v", qrs, err)
+	}
+}
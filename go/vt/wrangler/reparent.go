@@ -356,19 +356,25 @@ func (wr *Wrangler) plannedReparentShardLocked(ctx context.Context, ev *events.R
 	if shardInfo.MasterAlias == masterElectTabletAlias {
 		return fmt.Errorf("master-elect tablet %v is already the master", masterElectTabletAlias)
 	}
+	if masterElectTabletInfo.Health[topo.ReplicationRepaired] != "" {
+		return fmt.Errorf("master-elect tablet %v recently had its replication repaired, pick another tablet", masterElectTabletAlias)
+	}
 	oldMasterTabletInfo, ok := tabletMap[shardInfo.MasterAlias]
 	if !ok {
 		return fmt.Errorf("old master tablet %v is not in the shard", shardInfo.MasterAlias)
 	}
 	ev.OldMaster = *oldMasterTabletInfo.Tablet
 
-	// Demote the current master, get its replication position
+	// Demote the current master, get its replication position.
+	// DemoteMaster returns the final position in the same call that
+	// makes the old master read-only, so no write can happen after it.
 	wr.logger.Infof("demote current master %v", shardInfo.MasterAlias)
 	event.DispatchUpdate(ev, "demoting old master")
 	rp, err := wr.tmc.DemoteMaster(ctx, oldMasterTabletInfo)
 	if err != nil {
 		return fmt.Errorf("old master tablet %v DemoteMaster failed: %v", shardInfo.MasterAlias, err)
 	}
+	wr.logger.Infof("old master %v demoted at position %v", shardInfo.MasterAlias, rp)
 
 	// Wait on the master-elect tablet until it reaches that position,
 	// then promote it
@@ -0,0 +1,170 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wrangler
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	myproto "github.com/youtube/vitess/go/vt/mysqlctl/proto"
+	"github.com/youtube/vitess/go/vt/topo"
+	"golang.org/x/net/context"
+)
+
+// This file contains the preflight check of PlannedReparentShard: it
+// reads what the reparent would do, without changing anything.
+
+// ReparentPreflight is the report of what PlannedReparentShard would
+// do on a shard.
+type ReparentPreflight struct {
+	Keyspace  string
+	Shard     string
+	OldMaster topo.TabletAlias
+	Candidate topo.TabletAlias
+
+	// CandidateType and CandidateHealth come from the candidate
+	// tablet record.
+	CandidateType   topo.TabletType
+	CandidateHealth map[string]string
+
+	// CandidateStatus is the replication status of the candidate,
+	// nil if it could not be read.
+	CandidateStatus *myproto.ReplicationStatus
+
+	// Slaves are the tablets that will be reparented to the
+	// candidate, including the old master.
+	Slaves []topo.TabletAlias
+
+	// Cells are the cells that have tablets in the shard, which
+	// will all be reparented.
+	Cells []string
+
+	// EstimatedUnavailability is how long the shard is expected to
+	// refuse writes: from the demotion of the old master to the
+	// promotion of the candidate. It is the replication lag of the
+	// candidate plus the round trips to both tablets, so it is a
+	// lower bound.
+	EstimatedUnavailability time.Duration
+
+	// Problems are the reasons the reparent would fail. Warnings are
+	// the things that make it risky.
+	Problems []string
+	Warnings []string
+}
+
+// PlannedReparentPreflight checks that the shard can be reparented to
+// the candidate, and returns what PlannedReparentShard would do. It
+// doesn't take the shard lock, and doesn't change anything. The
+// returned error is only set if the report could not be built.
+func (wr *Wrangler) PlannedReparentPreflight(ctx context.Context, keyspace, shard string, candidate topo.TabletAlias, waitSlaveTimeout time.Duration) (*ReparentPreflight, error) {
+	shardInfo, err := wr.ts.GetShard(keyspace, shard)
+	if err != nil {
+		return nil, err
+	}
+	pf := &ReparentPreflight{
+		Keyspace:  keyspace,
+		Shard:     shard,
+		OldMaster: shardInfo.MasterAlias,
+		Candidate: candidate,
+	}
+
+	tabletMap, err := topo.GetTabletMapForShard(ctx, wr.ts, keyspace, shard)
+	switch err {
+	case nil:
+	case topo.ErrPartialResult:
+		pf.Problems = append(pf.Problems, "some tablets of the shard cannot be read")
+	default:
+		return nil, err
+	}
+
+	candidateInfo, ok := tabletMap[candidate]
+	if !ok {
+		pf.Problems = append(pf.Problems, fmt.Sprintf("master-elect tablet %v is not in the shard", candidate))
+		return pf, nil
+	}
+	pf.CandidateType = candidateInfo.Type
+	pf.CandidateHealth = candidateInfo.Health
+	if shardInfo.MasterAlias == candidate {
+		pf.Problems = append(pf.Problems, fmt.Sprintf("master-elect tablet %v is already the master", candidate))
+		return pf, nil
+	}
+	if candidateInfo.Health[topo.ReplicationRepaired] != "" {
+		pf.Problems = append(pf.Problems, fmt.Sprintf("master-elect tablet %v recently had its replication repaired, pick another tablet", candidate))
+	}
+	if candidateInfo.Type != topo.TYPE_REPLICA {
+		pf.Warnings = append(pf.Warnings, fmt.Sprintf("master-elect tablet %v is a %v tablet, not a replica", candidate, candidateInfo.Type))
+	}
+	oldMasterInfo, ok := tabletMap[shardInfo.MasterAlias]
+	if !ok {
+		pf.Problems = append(pf.Problems, fmt.Sprintf("old master tablet %v is not in the shard", shardInfo.MasterAlias))
+	} else if oldMasterInfo.Alias.Cell != candidate.Cell {
+		pf.Warnings = append(pf.Warnings, fmt.Sprintf("the master moves from cell %v to cell %v", oldMasterInfo.Alias.Cell, candidate.Cell))
+	}
+
+	cells := make(map[string]bool)
+	for alias := range tabletMap {
+		cells[alias.Cell] = true
+		if alias != candidate {
+			pf.Slaves = append(pf.Slaves, alias)
+		}
+	}
+	sort.Sort(topo.TabletAliasList(pf.Slaves))
+	for cell := range cells {
+		pf.Cells = append(pf.Cells, cell)
+	}
+	sort.Strings(pf.Cells)
+
+	// ping everybody, and time the two tablets that matter
+	roundTrips := make(map[topo.TabletAlias]time.Duration)
+	pingErrs := make(map[topo.TabletAlias]error)
+	mu := sync.Mutex{}
+	wg := sync.WaitGroup{}
+	for alias, ti := range tabletMap {
+		wg.Add(1)
+		go func(alias topo.TabletAlias, ti *topo.TabletInfo) {
+			defer wg.Done()
+			start := time.Now()
+			err := wr.tmc.Ping(ctx, ti)
+			mu.Lock()
+			roundTrips[alias] = time.Now().Sub(start)
+			pingErrs[alias] = err
+			mu.Unlock()
+		}(alias, ti)
+	}
+	wg.Wait()
+	for _, alias := range pf.Slaves {
+		if err := pingErrs[alias]; err != nil {
+			if alias == shardInfo.MasterAlias {
+				pf.Problems = append(pf.Problems, fmt.Sprintf("old master tablet %v does not answer: %v", alias, err))
+			} else {
+				pf.Warnings = append(pf.Warnings, fmt.Sprintf("slave %v does not answer, it may not be reparented: %v", alias, err))
+			}
+		}
+	}
+	if err := pingErrs[candidate]; err != nil {
+		pf.Problems = append(pf.Problems, fmt.Sprintf("master-elect tablet %v does not answer: %v", candidate, err))
+		return pf, nil
+	}
+
+	status, err := wr.tmc.SlaveStatus(ctx, candidateInfo)
+	if err != nil {
+		pf.Problems = append(pf.Problems, fmt.Sprintf("cannot read the replication status of master-elect tablet %v: %v", candidate, err))
+		return pf, nil
+	}
+	pf.CandidateStatus = &status
+	if !status.SlaveRunning() {
+		pf.Problems = append(pf.Problems, fmt.Sprintf("master-elect tablet %v is not replicating", candidate))
+	}
+	lag := time.Duration(status.SecondsBehindMaster) * time.Second
+	if lag > waitSlaveTimeout {
+		pf.Warnings = append(pf.Warnings, fmt.Sprintf("master-elect tablet %v is %v behind, more than the wait_slave_timeout of %v", candidate, lag, waitSlaveTimeout))
+	} else if lag > 0 {
+		pf.Warnings = append(pf.Warnings, fmt.Sprintf("master-elect tablet %v is %v behind, writes will be refused while it catches up", candidate, lag))
+	}
+	pf.EstimatedUnavailability = lag + roundTrips[shardInfo.MasterAlias] + roundTrips[candidate]
+	return pf, nil
+}
@@ -16,9 +16,11 @@ import (
 	"golang.org/x/net/context"
 
 	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/sync2"
 	"github.com/youtube/vitess/go/vt/concurrency"
 	myproto "github.com/youtube/vitess/go/vt/mysqlctl/proto"
 	"github.com/youtube/vitess/go/vt/schemamanager"
+	"github.com/youtube/vitess/go/vt/sqlparser"
 	"github.com/youtube/vitess/go/vt/tabletmanager/actionnode"
 	"github.com/youtube/vitess/go/vt/topo"
 	"github.com/youtube/vitess/go/vt/topotools/events"
@@ -44,35 +46,89 @@ func (wr *Wrangler) ReloadSchema(ctx context.Context, tabletAlias topo.TabletAli
 	return wr.tmc.ReloadSchema(ctx, ti)
 }
 
-// helper method to asynchronously diff a schema
-func (wr *Wrangler) diffSchema(ctx context.Context, masterSchema *myproto.SchemaDefinition, masterTabletAlias, alias topo.TabletAlias, excludeTables []string, includeViews bool, wg *sync.WaitGroup, er concurrency.ErrorRecorder) {
-	defer wg.Done()
+// DefaultSchemaFetchConcurrency is the default number of GetSchema
+// RPCs the schema validation runs at the same time.
+const DefaultSchemaFetchConcurrency = 8
+
+// schemaFetcher gets the schema of tablets, with a limited number of
+// RPCs in flight.
+type schemaFetcher struct {
+	wr            *Wrangler
+	excludeTables []string
+	includeViews  bool
+	sem           *sync2.Semaphore
+}
+
+func (wr *Wrangler) newSchemaFetcher(excludeTables []string, includeViews bool, fetchConcurrency int) *schemaFetcher {
+	if fetchConcurrency < 1 {
+		fetchConcurrency = 1
+	}
+	return &schemaFetcher{
+		wr:            wr,
+		excludeTables: excludeTables,
+		includeViews:  includeViews,
+		sem:           sync2.NewSemaphore(fetchConcurrency, 0),
+	}
+}
+
+func (sf *schemaFetcher) getSchema(ctx context.Context, alias topo.TabletAlias) (*myproto.SchemaDefinition, error) {
+	sf.sem.Acquire()
+	defer sf.sem.Release()
 	log.Infof("Gathering schema for %v", alias)
-	slaveSchema, err := wr.GetSchema(ctx, alias, nil, excludeTables, includeViews)
-	if err != nil {
-		er.RecordError(err)
+	return sf.wr.GetSchema(ctx, alias, nil, sf.excludeTables, sf.includeViews)
+}
+
+// recordSchemaDiffs records how the schema of a tablet differs from
+// the expected one. Unless verbose is set, only the names of the
+// differing tables and a short reason are recorded.
+func recordSchemaDiffs(expectedAlias topo.TabletAlias, expected *myproto.SchemaDefinition, alias topo.TabletAlias, schema *myproto.SchemaDefinition, verbose bool, er concurrency.ErrorRecorder) {
+	if verbose {
+		myproto.DiffSchema(expectedAlias.String(), expected, alias.String(), schema, er)
 		return
 	}
+	if diffs := myproto.DiffSchemaSummary(expected, schema); len(diffs) > 0 {
+		er.RecordError(fmt.Errorf("%v differs from %v: %v", alias, expectedAlias, strings.Join(diffs, ", ")))
+	}
+}
 
-	log.Infof("Diffing schema for %v", alias)
-	myproto.DiffSchema(masterTabletAlias.String(), masterSchema, alias.String(), slaveSchema, er)
+// logSchemaFixes logs the statements that change the schema of a
+// tablet into the expected one. The changes that may lose data are
+// not suggested.
+func (wr *Wrangler) logSchemaFixes(alias topo.TabletAlias, schema, expected *myproto.SchemaDefinition) {
+	er := concurrency.AllErrorRecorder{}
+	fixes := myproto.SchemaFixes(schema, expected, myproto.AlterOptions{}, &er)
+	if len(fixes) > 0 {
+		wr.Logger().Printf("Suggested schema fixes for %v:\n%v;\n", alias, strings.Join(fixes, ";\n"))
+	}
+	for _, err := range er.Errors {
+		wr.Logger().Warningf("No schema fix suggested for %v: %v", alias, err)
+	}
 }
 
-// ValidateSchemaShard will diff the schema from all the tablets in the shard.
-func (wr *Wrangler) ValidateSchemaShard(ctx context.Context, keyspace, shard string, excludeTables []string, includeViews bool) error {
+// validateShardSchema diffs the schema of all the slaves of a shard
+// with the schema of their master, which is fetched only once. If a
+// reference schema is given, the master schema is also diffed with
+// it, and the reference is used as is if it comes from that master.
+// It returns an error if the master schema cannot be found, the
+// differences are recorded in er.
+func (wr *Wrangler) validateShardSchema(ctx context.Context, sf *schemaFetcher, keyspace, shard string, referenceAlias topo.TabletAlias, referenceSchema *myproto.SchemaDefinition, suggestFixes, verbose bool, er concurrency.ErrorRecorder) error {
 	si, err := wr.ts.GetShard(keyspace, shard)
 	if err != nil {
 		return err
 	}
-
-	// get schema from the master, or error
 	if si.MasterAlias.Uid == topo.NO_TABLET {
 		return fmt.Errorf("No master in shard %v/%v", keyspace, shard)
 	}
-	log.Infof("Gathering schema for master %v", si.MasterAlias)
-	masterSchema, err := wr.GetSchema(ctx, si.MasterAlias, nil, excludeTables, includeViews)
-	if err != nil {
-		return err
+
+	masterSchema := referenceSchema
+	if referenceSchema == nil || si.MasterAlias != referenceAlias {
+		masterSchema, err = sf.getSchema(ctx, si.MasterAlias)
+		if err != nil {
+			return err
+		}
+		if referenceSchema != nil {
+			recordSchemaDiffs(referenceAlias, referenceSchema, si.MasterAlias, masterSchema, verbose, er)
+		}
 	}
 
 	// read all the aliases in the shard, that is all tablets that are
@@ -83,7 +139,6 @@ func (wr *Wrangler) ValidateSchemaShard(ctx context.Context, keyspace, shard str
 	}
 
 	// then diff with all slaves
-	er := concurrency.AllErrorRecorder{}
 	wg := sync.WaitGroup{}
 	for _, alias := range aliases {
 		if alias == si.MasterAlias {
@@ -91,18 +146,45 @@ func (wr *Wrangler) ValidateSchemaShard(ctx context.Context, keyspace, shard str
 		}
 
 		wg.Add(1)
-		go wr.diffSchema(ctx, masterSchema, si.MasterAlias, alias, excludeTables, includeViews, &wg, &er)
+		go func(alias topo.TabletAlias) {
+			defer wg.Done()
+			slaveSchema, err := sf.getSchema(ctx, alias)
+			if err != nil {
+				er.RecordError(err)
+				return
+			}
+			log.Infof("Diffing schema for %v", alias)
+			recordSchemaDiffs(si.MasterAlias, masterSchema, alias, slaveSchema, verbose, er)
+			if suggestFixes {
+				wr.logSchemaFixes(alias, slaveSchema, masterSchema)
+			}
+		}(alias)
 	}
 	wg.Wait()
-	if er.HasErrors() {
-		return fmt.Errorf("Schema diffs:\n%v", er.Error().Error())
-	}
 	return nil
 }
 
+// ValidateSchemaShard will diff the schema from all the tablets in the
+// shard. If suggestFixes is set, it also logs the statements that
+// would fix the slaves. Unless verbose is set, the differences are
+// summarized to the table names and the reasons they differ. At most
+// fetchConcurrency schemas are fetched at the same time.
+func (wr *Wrangler) ValidateSchemaShard(ctx context.Context, keyspace, shard string, excludeTables []string, includeViews, suggestFixes, verbose bool, fetchConcurrency int) error {
+	sf := wr.newSchemaFetcher(excludeTables, includeViews, fetchConcurrency)
+	er := concurrency.AllErrorRecorder{}
+	if err := wr.validateShardSchema(ctx, sf, keyspace, shard, topo.TabletAlias{}, nil, suggestFixes, verbose, &er); err != nil {
+		return err
+	}
+	return newValidationError("Schema diffs", &er)
+}
+
 // ValidateSchemaKeyspace will diff the schema from all the tablets in
-// the keyspace.
-func (wr *Wrangler) ValidateSchemaKeyspace(ctx context.Context, keyspace string, excludeTables []string, includeViews bool) error {
+// the keyspace. The masters are diffed with the master of the first
+// shard, and the slaves with the master of their shard. Unless verbose
+// is set, the differences are summarized to the table names and the
+// reasons they differ. At most fetchConcurrency schemas are fetched at
+// the same time.
+func (wr *Wrangler) ValidateSchemaKeyspace(ctx context.Context, keyspace string, excludeTables []string, includeViews, verbose bool, fetchConcurrency int) error {
 	// find all the shards
 	shards, err := wr.ts.GetShardNames(keyspace)
 	if err != nil {
@@ -114,9 +196,6 @@ func (wr *Wrangler) ValidateSchemaKeyspace(ctx context.Context, keyspace string,
 		return fmt.Errorf("No shards in keyspace %v", keyspace)
 	}
 	sort.Strings(shards)
-	if len(shards) == 1 {
-		return wr.ValidateSchemaShard(ctx, keyspace, shards[0], excludeTables, includeViews)
-	}
 
 	// find the reference schema using the first shard's master
 	si, err := wr.ts.GetShard(keyspace, shards[0])
@@ -127,60 +206,26 @@ func (wr *Wrangler) ValidateSchemaKeyspace(ctx context.Context, keyspace string,
 		return fmt.Errorf("No master in shard %v/%v", keyspace, shards[0])
 	}
 	referenceAlias := si.MasterAlias
-	log.Infof("Gathering schema for reference master %v", referenceAlias)
-	referenceSchema, err := wr.GetSchema(ctx, referenceAlias, nil, excludeTables, includeViews)
+	sf := wr.newSchemaFetcher(excludeTables, includeViews, fetchConcurrency)
+	referenceSchema, err := sf.getSchema(ctx, referenceAlias)
 	if err != nil {
 		return err
 	}
 
-	// then diff with all other tablets everywhere
+	// then diff all the shards
 	er := concurrency.AllErrorRecorder{}
 	wg := sync.WaitGroup{}
-
-	// first diff the slaves in the reference shard 0
-	aliases, err := topo.FindAllTabletAliasesInShard(ctx, wr.ts, keyspace, shards[0])
-	if err != nil {
-		return err
-	}
-
-	for _, alias := range aliases {
-		if alias == si.MasterAlias {
-			continue
-		}
-
+	for _, shard := range shards {
 		wg.Add(1)
-		go wr.diffSchema(ctx, referenceSchema, referenceAlias, alias, excludeTables, includeViews, &wg, &er)
-	}
-
-	// then diffs all tablets in the other shards
-	for _, shard := range shards[1:] {
-		si, err := wr.ts.GetShard(keyspace, shard)
-		if err != nil {
-			er.RecordError(err)
-			continue
-		}
-
-		if si.MasterAlias.Uid == topo.NO_TABLET {
-			er.RecordError(fmt.Errorf("No master in shard %v/%v", keyspace, shard))
-			continue
-		}
-
-		aliases, err := topo.FindAllTabletAliasesInShard(ctx, wr.ts, keyspace, shard)
-		if err != nil {
-			er.RecordError(err)
-			continue
-		}
-
-		for _, alias := range aliases {
-			wg.Add(1)
-			go wr.diffSchema(ctx, referenceSchema, referenceAlias, alias, excludeTables, includeViews, &wg, &er)
-		}
+		go func(shard string) {
+			defer wg.Done()
+			if err := wr.validateShardSchema(ctx, sf, keyspace, shard, referenceAlias, referenceSchema, false, verbose, &er); err != nil {
+				er.RecordError(err)
+			}
+		}(shard)
 	}
 	wg.Wait()
-	if er.HasErrors() {
-		return fmt.Errorf("Schema diffs:\n%v", er.Error().Error())
-	}
-	return nil
+	return newValidationError("Schema diffs", &er)
 }
 
 // PreflightSchema will try a schema change on the remote tablet.
@@ -207,7 +252,8 @@ func (wr *Wrangler) ApplySchema(ctx context.Context, tabletAlias topo.TabletAlia
 // recover if interrupted in the middle, because it knows which server
 // has the schema change already applied, and will just pass through them
 // very quickly.
-func (wr *Wrangler) ApplySchemaShard(ctx context.Context, keyspace, shard, change string, newParentTabletAlias topo.TabletAlias, simple, force bool, waitSlaveTimeout time.Duration) (*myproto.SchemaChangeResult, error) {
+// Changes that drop tables are refused unless allowDrop is set.
+func (wr *Wrangler) ApplySchemaShard(ctx context.Context, keyspace, shard, change string, newParentTabletAlias topo.TabletAlias, simple, force, allowDrop bool, waitSlaveTimeout time.Duration) (*myproto.SchemaChangeResult, error) {
 	// read the shard
 	shardInfo, err := wr.ts.GetShard(keyspace, shard)
 	if err != nil {
@@ -227,6 +273,9 @@ func (wr *Wrangler) ApplySchemaShard(ctx context.Context, keyspace, shard, chang
 	if err != nil {
 		return nil, err
 	}
+	if preflight.ChangeType == sqlparser.AST_DROP && !allowDrop {
+		return nil, fmt.Errorf("schema change drops tables, refusing to apply it without allowDrop: %v", change)
+	}
 
 	return wr.lockAndApplySchemaShard(ctx, shardInfo, preflight, keyspace, shard, shardInfo.MasterAlias, change, newParentTabletAlias, simple, force, waitSlaveTimeout)
 }
@@ -401,21 +450,125 @@ func (wr *Wrangler) applySchemaShardComplex(ctx context.Context, statusArray []*
 // and fail if not (unless force is specified)
 // if simple, we just do it on all masters.
 // if complex, we do the shell game in parallel on all shards
-func (wr *Wrangler) ApplySchemaKeyspace(ctx context.Context, keyspace string, change string, simple, force bool, waitSlaveTimeout time.Duration) (*myproto.SchemaChangeResult, error) {
+// The statements that were run are recorded in the schema change log
+// of the keyspace. If skipIfApplied, the statements the log says were
+// already applied on all shards are not run again.
+// Changes that drop tables are refused unless allowDrop is set.
+func (wr *Wrangler) ApplySchemaKeyspace(ctx context.Context, keyspace string, change string, simple, force, skipIfApplied, allowDrop bool, waitSlaveTimeout time.Duration) (*myproto.SchemaChangeResult, error) {
 	actionNode := actionnode.ApplySchemaKeyspace(change, simple)
 	lockPath, err := wr.lockKeyspace(ctx, keyspace, actionNode)
 	if err != nil {
 		return nil, err
 	}
 
-	err = schemamanager.Run(
-		schemamanager.NewPlainController(change, keyspace),
-		schemamanager.NewTabletExecutor(wr.tmc, wr.ts),
-	)
-
+	err = wr.applySchemaKeyspace(ctx, keyspace, change, skipIfApplied, allowDrop)
 	return nil, wr.unlockKeyspace(ctx, keyspace, actionNode, lockPath, err)
 }
 
+// applySchemaKeyspace runs the schema change and records it in the
+// keyspace. The keyspace should be locked.
+func (wr *Wrangler) applySchemaKeyspace(ctx context.Context, keyspace string, change string, skipIfApplied, allowDrop bool) error {
+	ki, err := wr.ts.GetKeyspace(keyspace)
+	if err != nil {
+		return err
+	}
+
+	controller := schemamanager.NewPlainController(change, keyspace)
+	if skipIfApplied {
+		sqls, err := controller.Read()
+		if err != nil {
+			return err
+		}
+		var remaining []string
+		for _, sql := range sqls {
+			if sc := ki.FindSchemaChange(topo.SchemaChangeHash(sql)); sc != nil {
+				wr.Logger().Infof("Skipping statement already applied to keyspace %v at %v: %v", keyspace, sc.Time, sql)
+				continue
+			}
+			remaining = append(remaining, sql)
+		}
+		if len(remaining) == 0 {
+			wr.Logger().Infof("All the statements were already applied to keyspace %v", keyspace)
+			return nil
+		}
+		controller = schemamanager.NewPlainController(strings.Join(remaining, ";"), keyspace)
+	}
+
+	executor := schemamanager.NewTabletExecutor(wr.tmc, wr.ts)
+	if allowDrop {
+		executor.AllowDrop()
+	}
+	recorder := &schemaChangeRecorder{PlainController: controller}
+	err = schemamanager.Run(recorder, executor)
+	if recorder.result == nil {
+		return err
+	}
+	changes := schemaChangesFromResult(recorder.result, time.Now())
+	if len(changes) == 0 {
+		return err
+	}
+	for _, sc := range changes {
+		ki.AddSchemaChange(sc)
+	}
+	if uerr := topo.UpdateKeyspace(wr.ts, ki); uerr != nil {
+		wr.Logger().Errorf("Cannot record the schema change in keyspace %v: %v", keyspace, uerr)
+		if err == nil {
+			err = uerr
+		}
+	}
+	return err
+}
+
+// schemaChangeRecorder is a PlainController that keeps the result of
+// the executor, so it can be recorded in the keyspace.
+type schemaChangeRecorder struct {
+	*schemamanager.PlainController
+	result *schemamanager.ExecuteResult
+}
+
+// OnExecutorComplete is part of the schemamanager.Controller interface.
+func (r *schemaChangeRecorder) OnExecutorComplete(result *schemamanager.ExecuteResult) error {
+	r.result = result
+	return r.PlainController.OnExecutorComplete(result)
+}
+
+// schemaChangesFromResult returns the log entries of the statements
+// the executor ran. It stops at the first statement that failed on a
+// shard, so only the last one can have errors, and the statements
+// after it were not run.
+func schemaChangesFromResult(result *schemamanager.ExecuteResult, now time.Time) []*topo.SchemaChange {
+	if result.ExecutorErr != "" || result.CurSqlIndex >= len(result.Sqls) {
+		return nil
+	}
+	var shards []string
+	for _, s := range result.SuccessShards {
+		shards = append(shards, s.Shard)
+	}
+	for _, f := range result.FailedShards {
+		shards = append(shards, f.Shard)
+	}
+
+	changes := make([]*topo.SchemaChange, 0, result.CurSqlIndex+1)
+	for i, sql := range result.Sqls[:result.CurSqlIndex+1] {
+		sc := &topo.SchemaChange{
+			Hash:         topo.SchemaChangeHash(sql),
+			Statement:    sql,
+			Time:         now,
+			ShardResults: make(map[string]string, len(shards)),
+		}
+		for _, shard := range shards {
+			sc.ShardResults[shard] = ""
+		}
+		if i == result.CurSqlIndex {
+			for _, f := range result.FailedShards {
+				sc.ShardResults[f.Shard] = f.Err
+			}
+		}
+		changes = append(changes, sc)
+	}
+	return changes
+}
+
 // CopySchemaShard copies the schema from a source tablet to the
 // specified shard.  The schema is applied directly on the master of
 // the destination shard, and is propogated to the replicas through
@@ -0,0 +1,54 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wrangler
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/youtube/vitess/go/vt/schemamanager"
+	"github.com/youtube/vitess/go/vt/topo"
+)
+
+func TestSchemaChangesFromResult(t *testing.T) {
+	now := time.Now()
+
+	// the second statement failed on one shard, the third was not run
+	changes := schemaChangesFromResult(&schemamanager.ExecuteResult{
+		Sqls:          []string{"create table a (id int)", "alter table b add column c int", "drop table d"},
+		CurSqlIndex:   1,
+		SuccessShards: []schemamanager.ShardResult{{Shard: "-80"}},
+		FailedShards:  []schemamanager.ShardWithError{{Shard: "80-", Err: "no such table"}},
+	}, now)
+	want := []*topo.SchemaChange{
+		{
+			Hash:         topo.SchemaChangeHash("create table a (id int)"),
+			Statement:    "create table a (id int)",
+			Time:         now,
+			ShardResults: map[string]string{"-80": "", "80-": ""},
+		},
+		{
+			Hash:         topo.SchemaChangeHash("alter table b add column c int"),
+			Statement:    "alter table b add column c int",
+			Time:         now,
+			ShardResults: map[string]string{"-80": "", "80-": "no such table"},
+		},
+	}
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("schemaChangesFromResult:\n%#v\nwant:\n%#v", changes, want)
+	}
+
+	// nothing was run
+	if changes := schemaChangesFromResult(&schemamanager.ExecuteResult{
+		Sqls:        []string{"create table a (id int)"},
+		ExecutorErr: "preflight failed",
+	}, now); changes != nil {
+		t.Errorf("schemaChangesFromResult with an executor error: %#v", changes)
+	}
+	if changes := schemaChangesFromResult(&schemamanager.ExecuteResult{}, now); changes != nil {
+		t.Errorf("schemaChangesFromResult without statements: %#v", changes)
+	}
+}
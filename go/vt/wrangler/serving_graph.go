@@ -0,0 +1,284 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wrangler
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/youtube/vitess/go/vt/concurrency"
+	"github.com/youtube/vitess/go/vt/topo"
+	"golang.org/x/net/context"
+)
+
+// This file contains the check of the serving graph of a cell against
+// the global records: the serving graph is only rebuilt on demand, so
+// it can be stale.
+
+// ServingGraphEndPoint is an end point of the serving graph, with the
+// tablet record it was built from.
+type ServingGraphEndPoint struct {
+	topo.EndPoint
+
+	// TabletType and TabletVersion come from the tablet record. They
+	// are empty if there is no tablet record.
+	TabletType    topo.TabletType
+	TabletVersion int64
+
+	// Problem is set if the end point does not match the tablet.
+	Problem string
+}
+
+// ServingGraphShard is the serving graph of a shard in a cell.
+type ServingGraphShard struct {
+	Name      string
+	SrvShard  *topo.SrvShard
+	EndPoints map[topo.TabletType][]*ServingGraphEndPoint
+
+	// Problems are the mismatches that are not about one end point,
+	// like a serving tablet without an end point.
+	Problems []string
+}
+
+// ServingGraphKeyspace is the serving graph of a keyspace in a cell.
+type ServingGraphKeyspace struct {
+	SrvKeyspace *topo.SrvKeyspace
+	Shards      []*ServingGraphShard
+	Problems    []string
+}
+
+// CellServingGraph is the serving graph of a cell, checked against
+// the global records.
+type CellServingGraph struct {
+	Cell      string
+	Keyspaces map[string]*ServingGraphKeyspace
+}
+
+// problems returns all the problems in the graph, sorted.
+func (sg *CellServingGraph) problems() []string {
+	var result []string
+	for _, kg := range sg.Keyspaces {
+		result = append(result, kg.Problems...)
+		for _, sh := range kg.Shards {
+			result = append(result, sh.Problems...)
+			for _, endPoints := range sh.EndPoints {
+				for _, ep := range endPoints {
+					if ep.Problem != "" {
+						result = append(result, ep.Problem)
+					}
+				}
+			}
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+// GetCellServingGraph reads the serving graph of all the keyspaces
+// a cell serves, or has shards in, and checks it against the tablets.
+func (wr *Wrangler) GetCellServingGraph(ctx context.Context, cell string) (*CellServingGraph, error) {
+	keyspaces, err := wr.ts.GetKeyspaces()
+	if err != nil {
+		return nil, err
+	}
+	srvKeyspaces, err := wr.ts.GetSrvKeyspaceNames(cell)
+	if err != nil && err != topo.ErrNoNode {
+		return nil, err
+	}
+	isGlobal := make(map[string]bool)
+	for _, keyspace := range keyspaces {
+		isGlobal[keyspace] = true
+	}
+
+	sg := &CellServingGraph{
+		Cell:      cell,
+		Keyspaces: make(map[string]*ServingGraphKeyspace),
+	}
+	for _, keyspace := range srvKeyspaces {
+		if !isGlobal[keyspace] {
+			sg.Keyspaces[keyspace] = &ServingGraphKeyspace{
+				Problems: []string{fmt.Sprintf("keyspace %v is served in cell %v but does not exist", keyspace, cell)},
+			}
+		}
+	}
+
+	rec := concurrency.AllErrorRecorder{}
+	mu := sync.Mutex{}
+	wg := sync.WaitGroup{}
+	for _, keyspace := range keyspaces {
+		wg.Add(1)
+		go func(keyspace string) {
+			defer wg.Done()
+			kg, err := wr.keyspaceServingGraph(ctx, cell, keyspace)
+			if err != nil {
+				rec.RecordError(err)
+				return
+			}
+			if kg != nil {
+				mu.Lock()
+				sg.Keyspaces[keyspace] = kg
+				mu.Unlock()
+			}
+		}(keyspace)
+	}
+	wg.Wait()
+	if rec.HasErrors() {
+		return nil, rec.Error()
+	}
+	return sg, nil
+}
+
+// keyspaceServingGraph returns the serving graph of a keyspace in a
+// cell, or nil if the keyspace has nothing in the cell.
+func (wr *Wrangler) keyspaceServingGraph(ctx context.Context, cell, keyspace string) (*ServingGraphKeyspace, error) {
+	kg := &ServingGraphKeyspace{}
+	srvKeyspace, err := wr.ts.GetSrvKeyspace(cell, keyspace)
+	switch err {
+	case nil:
+		kg.SrvKeyspace = srvKeyspace
+	case topo.ErrNoNode:
+	default:
+		return nil, fmt.Errorf("GetSrvKeyspace(%v, %v) failed: %v", cell, keyspace, err)
+	}
+
+	shards, err := wr.ts.GetShardNames(keyspace)
+	if err != nil {
+		return nil, fmt.Errorf("GetShardNames(%v) failed: %v", keyspace, err)
+	}
+	sort.Strings(shards)
+	for _, shard := range shards {
+		si, err := wr.ts.GetShard(keyspace, shard)
+		if err != nil {
+			return nil, fmt.Errorf("GetShard(%v, %v) failed: %v", keyspace, shard, err)
+		}
+		if !strInList(si.Cells, cell) {
+			continue
+		}
+		sh, err := wr.shardServingGraph(ctx, cell, keyspace, shard)
+		if err != nil {
+			return nil, err
+		}
+		kg.Shards = append(kg.Shards, sh)
+	}
+
+	if len(kg.Shards) == 0 && kg.SrvKeyspace == nil {
+		return nil, nil
+	}
+	if kg.SrvKeyspace == nil {
+		kg.Problems = append(kg.Problems, fmt.Sprintf("keyspace %v has shards in cell %v but no SrvKeyspace", keyspace, cell))
+	}
+	return kg, nil
+}
+
+// shardServingGraph returns the serving graph of a shard in a cell,
+// with its mismatches against the tablets of the shard in the cell.
+func (wr *Wrangler) shardServingGraph(ctx context.Context, cell, keyspace, shard string) (*ServingGraphShard, error) {
+	tablets, err := topo.GetTabletMapForShardByCell(ctx, wr.ts, keyspace, shard, []string{cell})
+	if err != nil && err != topo.ErrPartialResult {
+		return nil, fmt.Errorf("GetTabletMapForShardByCell(%v, %v, %v) failed: %v", keyspace, shard, cell, err)
+	}
+	return wr.checkShardServingGraph(cell, keyspace, shard, tablets, err == topo.ErrPartialResult)
+}
+
+// checkShardServingGraph returns the serving graph of a shard in a
+// cell, checked against tablets, the tablets of the shard in the cell.
+// partial is set if some of them could not be read.
+func (wr *Wrangler) checkShardServingGraph(cell, keyspace, shard string, tablets map[topo.TabletAlias]*topo.TabletInfo, partial bool) (*ServingGraphShard, error) {
+	sh := &ServingGraphShard{
+		Name:      shard,
+		EndPoints: make(map[topo.TabletType][]*ServingGraphEndPoint),
+	}
+	if partial {
+		sh.Problems = append(sh.Problems, fmt.Sprintf("some tablets of shard %v/%v in cell %v cannot be read", keyspace, shard, cell))
+	}
+
+	srvShard, err := wr.ts.GetSrvShard(cell, keyspace, shard)
+	switch err {
+	case nil:
+		sh.SrvShard = srvShard
+	case topo.ErrNoNode:
+	default:
+		return nil, fmt.Errorf("GetSrvShard(%v, %v, %v) failed: %v", cell, keyspace, shard, err)
+	}
+	tabletTypes, err := wr.ts.GetSrvTabletTypesPerShard(cell, keyspace, shard)
+	if err != nil && err != topo.ErrNoNode {
+		return nil, fmt.Errorf("GetSrvTabletTypesPerShard(%v, %v, %v) failed: %v", cell, keyspace, shard, err)
+	}
+
+	// check each end point against its tablet
+	served := make(map[topo.TabletAlias]topo.TabletType)
+	for _, tabletType := range tabletTypes {
+		endPoints, err := wr.ts.GetEndPoints(cell, keyspace, shard, tabletType)
+		switch err {
+		case nil:
+		case topo.ErrNoNode:
+			continue
+		default:
+			return nil, fmt.Errorf("GetEndPoints(%v, %v, %v, %v) failed: %v", cell, keyspace, shard, tabletType, err)
+		}
+		for _, entry := range endPoints.Entries {
+			alias := topo.TabletAlias{Cell: cell, Uid: entry.Uid}
+			served[alias] = tabletType
+			ep := &ServingGraphEndPoint{EndPoint: entry}
+			sh.EndPoints[tabletType] = append(sh.EndPoints[tabletType], ep)
+
+			// scrapped tablets are not in the replication graph
+			ti, ok := tablets[alias]
+			if !ok {
+				ti, err = wr.ts.GetTablet(alias)
+				if err == topo.ErrNoNode {
+					ep.Problem = fmt.Sprintf("%v end point of %v/%v in cell %v is tablet %v, which does not exist", tabletType, keyspace, shard, cell, alias)
+					continue
+				}
+				if err != nil {
+					return nil, fmt.Errorf("GetTablet(%v) failed: %v", alias, err)
+				}
+			}
+			ep.TabletType = ti.Type
+			ep.TabletVersion = ti.Version()
+			switch {
+			case ti.Type == topo.TYPE_SCRAP:
+				ep.Problem = fmt.Sprintf("%v end point of %v/%v in cell %v is scrapped tablet %v", tabletType, keyspace, shard, cell, alias)
+			case ti.Keyspace != keyspace || ti.Shard != shard:
+				ep.Problem = fmt.Sprintf("%v end point of %v/%v in cell %v is tablet %v of shard %v/%v", tabletType, keyspace, shard, cell, alias, ti.Keyspace, ti.Shard)
+			case ti.Type != tabletType:
+				ep.Problem = fmt.Sprintf("%v end point of %v/%v in cell %v is tablet %v of type %v", tabletType, keyspace, shard, cell, alias, ti.Type)
+			}
+		}
+	}
+
+	// and each serving tablet against the end points
+	aliases := make(topo.TabletAliasList, 0, len(tablets))
+	for alias := range tablets {
+		aliases = append(aliases, alias)
+	}
+	sort.Sort(aliases)
+	for _, alias := range aliases {
+		ti := tablets[alias]
+		if !ti.IsInServingGraph() {
+			continue
+		}
+		if _, ok := served[alias]; !ok {
+			sh.Problems = append(sh.Problems, fmt.Sprintf("%v tablet %v of %v/%v has no end point in cell %v", ti.Type, alias, keyspace, shard, cell))
+		}
+	}
+	return sh, nil
+}
+
+// ValidateServingGraph checks the serving graph of a cell against
+// the tablets, and returns a ValidationError listing the mismatches.
+func (wr *Wrangler) ValidateServingGraph(ctx context.Context, cell string) error {
+	sg, err := wr.GetCellServingGraph(ctx, cell)
+	if err != nil {
+		return err
+	}
+	er := concurrency.AllErrorRecorder{}
+	for _, problem := range sg.problems() {
+		er.RecordError(errors.New(problem))
+	}
+	return newValidationError("Serving graph problems", &er)
+}
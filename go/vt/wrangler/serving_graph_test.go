@@ -0,0 +1,94 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wrangler
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/youtube/vitess/go/vt/logutil"
+	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/vt/zktopo"
+	"golang.org/x/net/context"
+)
+
+func TestValidateServingGraph(t *testing.T) {
+	ctx := context.Background()
+	ts := zktopo.NewTestServer(t, []string{"cell1", "cell2"})
+	wr := New(logutil.NewMemoryLogger(), ts, nil, time.Second)
+	if err := ts.CreateKeyspace("ks", &topo.Keyspace{}); err != nil {
+		t.Fatalf("CreateKeyspace failed: %v", err)
+	}
+	if err := ts.CreateShard("ks", "0", &topo.Shard{Cells: []string{"cell1"}}); err != nil {
+		t.Fatalf("CreateShard failed: %v", err)
+	}
+	for uid, tabletType := range map[uint32]topo.TabletType{
+		100: topo.TYPE_MASTER,
+		101: topo.TYPE_REPLICA,
+		102: topo.TYPE_SCRAP,
+		104: topo.TYPE_RDONLY,
+		105: topo.TYPE_SPARE,
+	} {
+		if err := topo.CreateTablet(ctx, ts, &topo.Tablet{
+			Alias:    topo.TabletAlias{Cell: "cell1", Uid: uid},
+			Keyspace: "ks",
+			Shard:    "0",
+			Type:     tabletType,
+		}); err != nil {
+			t.Fatalf("CreateTablet failed: %v", err)
+		}
+	}
+
+	// the serving graph is one rebuild behind
+	if err := ts.UpdateSrvKeyspace("cell1", "ks", &topo.SrvKeyspace{}); err != nil {
+		t.Fatalf("UpdateSrvKeyspace failed: %v", err)
+	}
+	for tabletType, uids := range map[topo.TabletType][]uint32{
+		topo.TYPE_MASTER:  {100},
+		topo.TYPE_REPLICA: {102, 103, 104},
+	} {
+		endPoints := topo.NewEndPoints()
+		for _, uid := range uids {
+			endPoints.Entries = append(endPoints.Entries, *topo.NewEndPoint(uid, "host"))
+		}
+		if err := ts.UpdateEndPoints("cell1", "ks", "0", tabletType, endPoints); err != nil {
+			t.Fatalf("UpdateEndPoints failed: %v", err)
+		}
+	}
+
+	sg, err := wr.GetCellServingGraph(ctx, "cell1")
+	if err != nil {
+		t.Fatalf("GetCellServingGraph failed: %v", err)
+	}
+	kg := sg.Keyspaces["ks"]
+	if kg == nil || len(kg.Shards) != 1 || kg.Shards[0].Name != "0" {
+		t.Fatalf("serving graph of cell1: %#v", sg)
+	}
+	master := kg.Shards[0].EndPoints[topo.TYPE_MASTER]
+	if len(master) != 1 || master[0].Uid != 100 || master[0].TabletType != topo.TYPE_MASTER || master[0].Problem != "" {
+		t.Errorf("master end points: %#v", master)
+	}
+
+	err = wr.ValidateServingGraph(ctx, "cell1")
+	verr, ok := err.(*ValidationError)
+	if !ok {
+		t.Fatalf("ValidateServingGraph returned %v, want a ValidationError", err)
+	}
+	want := []string{
+		"replica end point of ks/0 in cell cell1 is scrapped tablet cell1-0000000102",
+		"replica end point of ks/0 in cell cell1 is tablet cell1-0000000103, which does not exist",
+		"replica end point of ks/0 in cell cell1 is tablet cell1-0000000104 of type rdonly",
+		"replica tablet cell1-0000000101 of ks/0 has no end point in cell cell1",
+	}
+	if !reflect.DeepEqual(verr.Problems, want) {
+		t.Errorf("ValidateServingGraph problems:\n%v\nwant:\n%v", verr.Problems, want)
+	}
+
+	// cell2 has nothing
+	if err := wr.ValidateServingGraph(ctx, "cell2"); err != nil {
+		t.Errorf("ValidateServingGraph(cell2) failed: %v", err)
+	}
+}
@@ -0,0 +1,93 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wrangler
+
+import (
+	"fmt"
+
+	"github.com/youtube/vitess/go/vt/tableacl"
+	"github.com/youtube/vitess/go/vt/tabletmanager/actionnode"
+	"github.com/youtube/vitess/go/vt/topo"
+	"golang.org/x/net/context"
+)
+
+// GetTableACL returns the table ACL config the tablets of keyspace
+// load from the topology, or the global one if keyspace is empty.
+func (wr *Wrangler) GetTableACL(keyspace string) (*topo.TableACL, error) {
+	if keyspace != "" {
+		return topo.GetKeyspaceTableACL(wr.ts, keyspace)
+	}
+	tableACLer, ok := wr.ts.(topo.TableACLer)
+	if !ok {
+		return nil, fmt.Errorf("%T doesn't store a global table ACL config", wr.ts)
+	}
+	return tableACLer.GetTableACL()
+}
+
+// SetTableACL saves a table ACL config as the one of keyspace, or as
+// the global one if keyspace is empty. It then asks the tablets that
+// use it to reload it: the tablets of keyspace, or the tablets of all
+// the keyspaces without their own config.
+func (wr *Wrangler) SetTableACL(ctx context.Context, keyspace string, tableACL *topo.TableACL, concurrency int) ([]TabletResult, error) {
+	if err := tableacl.ValidateConfig([]byte(tableACL.Config)); err != nil {
+		return nil, fmt.Errorf("invalid table ACL config: %v", err)
+	}
+
+	var keyspaces []string
+	if keyspace != "" {
+		actionNode := actionnode.SetKeyspaceTableACL()
+		lockPath, err := wr.lockKeyspace(ctx, keyspace, actionNode)
+		if err != nil {
+			return nil, err
+		}
+		err = wr.setKeyspaceTableACL(keyspace, tableACL)
+		if err := wr.unlockKeyspace(ctx, keyspace, actionNode, lockPath, err); err != nil {
+			return nil, err
+		}
+		keyspaces = []string{keyspace}
+	} else {
+		tableACLer, ok := wr.ts.(topo.TableACLer)
+		if !ok {
+			return nil, fmt.Errorf("%T doesn't store a global table ACL config", wr.ts)
+		}
+		if err := tableACLer.SaveTableACL(tableACL); err != nil {
+			return nil, err
+		}
+		allKeyspaces, err := wr.ts.GetKeyspaces()
+		if err != nil {
+			return nil, err
+		}
+		for _, ks := range allKeyspaces {
+			ki, err := wr.ts.GetKeyspace(ks)
+			if err != nil {
+				return nil, err
+			}
+			if ki.TableACL == nil {
+				keyspaces = append(keyspaces, ks)
+			}
+		}
+	}
+
+	var tablets []*topo.TabletInfo
+	for _, ks := range keyspaces {
+		ksTablets, err := wr.SelectTablets(ctx, &TabletSelection{Keyspace: ks})
+		if err != nil {
+			return nil, err
+		}
+		tablets = append(tablets, ksTablets...)
+	}
+	return wr.RunOnTablets(ctx, "ReloadTableACL", tablets, concurrency, func(ctx context.Context, ti *topo.TabletInfo) error {
+		return wr.tmc.ReloadTableACL(ctx, ti)
+	})
+}
+
+func (wr *Wrangler) setKeyspaceTableACL(keyspace string, tableACL *topo.TableACL) error {
+	ki, err := wr.ts.GetKeyspace(keyspace)
+	if err != nil {
+		return err
+	}
+	ki.TableACL = tableACL
+	return topo.UpdateKeyspace(wr.ts, ki)
+}
@@ -0,0 +1,108 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wrangler
+
+import (
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/youtube/vitess/go/vt/logutil"
+	"github.com/youtube/vitess/go/vt/tabletmanager/tmclient"
+	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/vt/zktopo"
+	"golang.org/x/net/context"
+)
+
+// reloadTableACLClient records the tablets ReloadTableACL is sent to.
+// It doesn't implement the other calls.
+type reloadTableACLClient struct {
+	tmclient.TabletManagerClient
+
+	mu       sync.Mutex
+	reloaded []string
+}
+
+func (client *reloadTableACLClient) ReloadTableACL(ctx context.Context, tablet *topo.TabletInfo) error {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	client.reloaded = append(client.reloaded, tablet.Alias.String())
+	return nil
+}
+
+func (client *reloadTableACLClient) takeReloaded() []string {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	reloaded := client.reloaded
+	client.reloaded = nil
+	sort.Strings(reloaded)
+	return reloaded
+}
+
+func TestSetTableACL(t *testing.T) {
+	ctx := context.Background()
+	ts := zktopo.NewTestServer(t, []string{"cell1"})
+	tmc := &reloadTableACLClient{}
+	wr := New(logutil.NewMemoryLogger(), ts, tmc, time.Second)
+	for i, keyspace := range []string{"ks1", "ks2"} {
+		if err := ts.CreateKeyspace(keyspace, &topo.Keyspace{}); err != nil {
+			t.Fatalf("CreateKeyspace failed: %v", err)
+		}
+		if err := ts.CreateShard(keyspace, "0", &topo.Shard{Cells: []string{"cell1"}}); err != nil {
+			t.Fatalf("CreateShard failed: %v", err)
+		}
+		if err := topo.CreateTablet(ctx, ts, &topo.Tablet{
+			Alias:    topo.TabletAlias{Cell: "cell1", Uid: uint32(100 + i)},
+			Keyspace: keyspace,
+			Shard:    "0",
+			Type:     topo.TYPE_REPLICA,
+		}); err != nil {
+			t.Fatalf("CreateTablet failed: %v", err)
+		}
+	}
+
+	// an invalid config is not saved
+	if _, err := wr.SetTableACL(ctx, "", &topo.TableACL{Config: `{"t": {"BADROLE": "u1"}}`}, 2); err == nil {
+		t.Errorf("SetTableACL of an invalid config should fail")
+	}
+	if _, err := wr.GetTableACL(""); err != topo.ErrNoNode {
+		t.Errorf("GetTableACL after a failed SetTableACL: %v, want ErrNoNode", err)
+	}
+
+	// the global config is reloaded everywhere
+	global := &topo.TableACL{Config: `{"t": {"READER": "u1"}}`}
+	if _, err := wr.SetTableACL(ctx, "", global, 2); err != nil {
+		t.Fatalf("SetTableACL failed: %v", err)
+	}
+	if got, want := tmc.takeReloaded(), []string{"cell1-0000000100", "cell1-0000000101"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("global SetTableACL reloaded %v, want %v", got, want)
+	}
+
+	// the keyspace config only on the keyspace
+	ks1 := &topo.TableACL{Config: `{"t": {"READER": "u2"}}`, DryRun: true}
+	if _, err := wr.SetTableACL(ctx, "ks1", ks1, 2); err != nil {
+		t.Fatalf("SetTableACL failed: %v", err)
+	}
+	if got, want := tmc.takeReloaded(), []string{"cell1-0000000100"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("keyspace SetTableACL reloaded %v, want %v", got, want)
+	}
+
+	// and the global one isn't reloaded on it anymore
+	if _, err := wr.SetTableACL(ctx, "", global, 2); err != nil {
+		t.Fatalf("SetTableACL failed: %v", err)
+	}
+	if got, want := tmc.takeReloaded(), []string{"cell1-0000000101"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("global SetTableACL reloaded %v, want %v", got, want)
+	}
+
+	for keyspace, want := range map[string]*topo.TableACL{"": global, "ks1": ks1, "ks2": global} {
+		got, err := wr.GetTableACL(keyspace)
+		if err != nil || !reflect.DeepEqual(got, want) {
+			t.Errorf("GetTableACL(%q) = %v, %v, want %v", keyspace, got, err, want)
+		}
+	}
+}
@@ -191,6 +191,27 @@ func (wr *Wrangler) ChangeType(ctx context.Context, tabletAlias topo.TabletAlias
 	return nil
 }
 
+// ChangeTypeOverride is like ChangeType, but asks the tablet to apply
+// the change even if it is not a legal transition. This is only meant
+// for emergencies: the tablet tags its record with the override, and
+// the shard record is not fixed up.
+func (wr *Wrangler) ChangeTypeOverride(ctx context.Context, tabletAlias topo.TabletAlias, tabletType topo.TabletType) error {
+	ti, err := wr.ts.GetTablet(tabletAlias)
+	if err != nil {
+		return err
+	}
+	wr.Logger().Warningf("Forcing type change of %v from %v to %v, bypassing the transition checks", tabletAlias, ti.Type, tabletType)
+	wasServing := ti.Tablet.IsInServingGraph()
+	if err := wr.tmc.ChangeType(ctx, ti, tabletType, true /*force*/); err != nil {
+		return err
+	}
+	if !wasServing && !topo.IsInServingGraph(tabletType) {
+		return nil
+	}
+	_, err = wr.RebuildShardGraph(ctx, ti.Keyspace, ti.Shard, []string{ti.Alias.Cell})
+	return err
+}
+
 // ChangeTypeNoRebuild changes a tablet's type, and returns whether
 // there's a shard that should be rebuilt, along with its cell,
 // keyspace, and shard. If force is true, it will bypass the RPC action
@@ -213,7 +234,7 @@ func (wr *Wrangler) ChangeTypeNoRebuild(ctx context.Context, tabletAlias topo.Ta
 			return false, "", "", "", err
 		}
 	} else {
-		if err := wr.tmc.ChangeType(ctx, ti, tabletType); err != nil {
+		if err := wr.tmc.ChangeType(ctx, ti, tabletType, false /*force*/); err != nil {
 			return false, "", "", "", err
 		}
 	}
@@ -242,7 +263,7 @@ func (wr *Wrangler) changeTypeInternal(ctx context.Context, tabletAlias topo.Tab
 	rebuildRequired := ti.Tablet.IsInServingGraph()
 
 	// change the type
-	if err := wr.tmc.ChangeType(ctx, ti, dbType); err != nil {
+	if err := wr.tmc.ChangeType(ctx, ti, dbType, false /*force*/); err != nil {
 		return err
 	}
 
@@ -278,3 +299,31 @@ func (wr *Wrangler) ExecuteFetchAsDba(ctx context.Context, tabletAlias topo.Tabl
 	}
 	return wr.tmc.ExecuteFetchAsDba(ctx, ti, query, maxRows, wantFields, disableBinlogs, reloadSchema)
 }
+
+// GetActionHistory returns the recent actions run by a remote tablet,
+// most recent first
+func (wr *Wrangler) GetActionHistory(ctx context.Context, tabletAlias topo.TabletAlias) ([]*actionnode.ActionHistoryRecord, error) {
+	ti, err := wr.ts.GetTablet(tabletAlias)
+	if err != nil {
+		return nil, err
+	}
+	return wr.tmc.GetActionHistory(ctx, ti)
+}
+
+// SetMaintenanceMode puts a remote tablet in or out of maintenance mode
+func (wr *Wrangler) SetMaintenanceMode(ctx context.Context, tabletAlias topo.TabletAlias, on bool, reason string) error {
+	ti, err := wr.ts.GetTablet(tabletAlias)
+	if err != nil {
+		return err
+	}
+	return wr.tmc.SetMaintenanceMode(ctx, ti, on, reason)
+}
+
+// SetPoolSize resizes one of the connection pools of a remote tablet
+func (wr *Wrangler) SetPoolSize(ctx context.Context, tabletAlias topo.TabletAlias, pool string, size int) error {
+	ti, err := wr.ts.GetTablet(tabletAlias)
+	if err != nil {
+		return err
+	}
+	return wr.tmc.SetPoolSize(ctx, ti, pool, size)
+}
@@ -0,0 +1,77 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wrangler
+
+import (
+	"sync"
+
+	tproto "github.com/youtube/vitess/go/vt/tabletserver/proto"
+	"github.com/youtube/vitess/go/vt/topo"
+	"golang.org/x/net/context"
+)
+
+// GetTabletStats returns a snapshot of the query service activity of
+// a remote tablet.
+func (wr *Wrangler) GetTabletStats(ctx context.Context, tabletAlias topo.TabletAlias) (*tproto.RuntimeStats, error) {
+	ti, err := wr.ts.GetTablet(tabletAlias)
+	if err != nil {
+		return nil, err
+	}
+	return wr.tmc.GetRuntimeStats(ctx, ti)
+}
+
+// GetTabletsStats returns the query service activity of all the
+// provided tablets, fetched in parallel. The tablets we cannot get the
+// stats of are logged, and not in the result.
+func (wr *Wrangler) GetTabletsStats(ctx context.Context, tabletAliases []topo.TabletAlias) map[topo.TabletAlias]*tproto.RuntimeStats {
+	result := make(map[topo.TabletAlias]*tproto.RuntimeStats, len(tabletAliases))
+	mu := sync.Mutex{}
+	wg := sync.WaitGroup{}
+	for _, alias := range tabletAliases {
+		wg.Add(1)
+		go func(alias topo.TabletAlias) {
+			defer wg.Done()
+			rs, err := wr.GetTabletStats(ctx, alias)
+			if err != nil {
+				wr.Logger().Warningf("GetTabletStats(%v) failed: %v", alias, err)
+				return
+			}
+			mu.Lock()
+			result[alias] = rs
+			mu.Unlock()
+		}(alias)
+	}
+	wg.Wait()
+	return result
+}
+
+// GetShardTabletStats returns the query service activity of all the
+// tablets in a shard, and their sum. QPS and error rates are added up,
+// so the sum is the load of the whole shard.
+func (wr *Wrangler) GetShardTabletStats(ctx context.Context, keyspace, shard string) (map[topo.TabletAlias]*tproto.RuntimeStats, *tproto.RuntimeStats, error) {
+	aliases, err := topo.FindAllTabletAliasesInShard(ctx, wr.ts, keyspace, shard)
+	if err != nil {
+		return nil, nil, err
+	}
+	stats := wr.GetTabletsStats(ctx, aliases)
+	return stats, SumRuntimeStats(stats), nil
+}
+
+// SumRuntimeStats adds up the provided runtime stats.
+func SumRuntimeStats(stats map[topo.TabletAlias]*tproto.RuntimeStats) *tproto.RuntimeStats {
+	total := &tproto.RuntimeStats{
+		QPS: make(map[string]float64),
+	}
+	for _, rs := range stats {
+		for name, qps := range rs.QPS {
+			total.QPS[name] += qps
+		}
+		total.ErrorCount += rs.ErrorCount
+		total.ErrorRate += rs.ErrorRate
+		total.ConnectionsInUse += rs.ConnectionsInUse
+		total.ConnectionsCapacity += rs.ConnectionsCapacity
+	}
+	return total
+}
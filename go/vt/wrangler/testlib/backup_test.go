@@ -8,10 +8,12 @@ import (
 	"io/ioutil"
 	"os"
 	"path"
+	"strings"
 	"testing"
 	"time"
 
 	mproto "github.com/youtube/vitess/go/mysql/proto"
+	"github.com/youtube/vitess/go/sqltypes"
 	"github.com/youtube/vitess/go/vt/logutil"
 	"github.com/youtube/vitess/go/vt/mysqlctl"
 	"github.com/youtube/vitess/go/vt/mysqlctl/backupstorage"
@@ -93,17 +95,15 @@ func TestBackupRestore(t *testing.T) {
 		t.Fatalf("GetTablet failed: %v", err)
 	}
 
+	// the master is refused without -allow_master
+	if err := wr.Backup(ctx, master.Tablet.Alias, 4, 0, false, false); err == nil || !strings.Contains(err.Error(), "-allow_master") {
+		t.Errorf("Backup of the master returned %v", err)
+	}
+
 	// run the backup
-	logStream, errFunc, err := wr.TabletManagerClient().Backup(ctx, ti, 4)
-	if err != nil {
+	if err := wr.Backup(ctx, sourceTablet.Tablet.Alias, 4, 0, false, false); err != nil {
 		t.Fatalf("Backup failed: %v", err)
 	}
-	for e := range logStream {
-		t.Logf("%v", e)
-	}
-	if err := errFunc(); err != nil {
-		t.Fatalf("Backup errFunc failed: %v", err)
-	}
 
 	// verify the full status
 	if err := sourceTablet.FakeMysqlDaemon.CheckSuperQueryList(); err != nil {
@@ -116,6 +116,15 @@ func TestBackupRestore(t *testing.T) {
 		t.Errorf("sourceTablet.FakeMysqlDaemon.Running not set")
 	}
 
+	// the backup is listed with its MANIFEST
+	bis, err := wr.ListBackups(ti.Keyspace, ti.Shard)
+	if err != nil || len(bis) != 1 || bis[0].Manifest == nil {
+		t.Fatalf("ListBackups returned %v %v", bis, err)
+	}
+	if bm := bis[0].Manifest; bm.BackupMethod != "builtin" || bm.DataSize != 54 || !bm.ReplicationPosition.Equal(sourceTablet.FakeMysqlDaemon.CurrentMasterPosition) {
+		t.Errorf("ListBackups returned an unexpected MANIFEST: %+v", bm)
+	}
+
 	// create a destination tablet, set it up so we can do restores
 	destTablet := NewFakeTablet(t, wr, "cell1", 2, topo.TYPE_REPLICA)
 	destTablet.FakeMysqlDaemon.ReadOnly = true
@@ -149,7 +158,7 @@ func TestBackupRestore(t *testing.T) {
 	destTablet.StartActionLoop(t, wr)
 	defer destTablet.StopActionLoop(t)
 
-	if err := destTablet.Agent.RestoreFromBackup(); err != nil {
+	if err := wr.RestoreFromBackup(ctx, destTablet.Tablet.Alias); err != nil {
 		t.Fatalf("RestoreFromBackup failed: %v", err)
 	}
 
@@ -163,5 +172,61 @@ func TestBackupRestore(t *testing.T) {
 	if !destTablet.FakeMysqlDaemon.Running {
 		t.Errorf("destTablet.FakeMysqlDaemon.Running not set")
 	}
+	if dest, err := ts.GetTablet(destTablet.Tablet.Alias); err != nil || dest.Type != topo.TYPE_REPLICA {
+		t.Errorf("destTablet is not back to replica after the restore: %v %v", dest, err)
+	}
 
+	// a tablet with data refuses the restore, and keeps serving
+	destTablet.FakeMysqlDaemon.FetchSuperQueryMap = map[string]*mproto.QueryResult{
+		"SHOW DATABASES": &mproto.QueryResult{
+			Rows: [][]sqltypes.Value{{sqltypes.MakeString([]byte("vt_db"))}},
+		},
+		"SHOW TABLES FROM vt_db": &mproto.QueryResult{
+			Rows: [][]sqltypes.Value{{sqltypes.MakeString([]byte("t1"))}},
+		},
+	}
+	if err := wr.RestoreFromBackup(ctx, destTablet.Tablet.Alias); err == nil || !strings.Contains(err.Error(), "found active db vt_db") {
+		t.Errorf("RestoreFromBackup of a tablet with data returned %v", err)
+	}
+	if dest, err := ts.GetTablet(destTablet.Tablet.Alias); err != nil || dest.Type != topo.TYPE_REPLICA {
+		t.Errorf("destTablet changed type after a refused restore: %v %v", dest, err)
+	}
+	destTablet.FakeMysqlDaemon.FetchSuperQueryMap = map[string]*mproto.QueryResult{
+		"SHOW DATABASES": &mproto.QueryResult{},
+	}
+
+	// the backup is fine
+	if err := wr.VerifyBackup(ctx, destTablet.Tablet.Alias, ""); err != nil {
+		t.Errorf("VerifyBackup failed: %v", err)
+	}
+
+	// corrupt the db.opt file of the backup: verifying it now
+	// fails, and so does restoring it, without changing the data
+	bucket := ti.Keyspace + "/" + ti.Shard
+	bs, err := backupstorage.GetBackupStorage()
+	if err != nil {
+		t.Fatalf("GetBackupStorage failed: %v", err)
+	}
+	bhs, err := bs.ListBackups(bucket)
+	if err != nil || len(bhs) != 1 {
+		t.Fatalf("ListBackups returned %v %v", bhs, err)
+	}
+	if err := ioutil.WriteFile(path.Join(fbsRoot, bucket, bhs[0].Name(), "2"), []byte("corrupted"), os.ModePerm); err != nil {
+		t.Fatalf("cannot corrupt the backup: %v", err)
+	}
+	if err := wr.VerifyBackup(ctx, destTablet.Tablet.Alias, bhs[0].Name()); err == nil || !strings.Contains(err.Error(), "checksum mismatch for: Data/vt_db/db.opt") {
+		t.Errorf("VerifyBackup of a corrupted backup returned %v", err)
+	}
+	if err := ioutil.WriteFile(path.Join(sourceDataDbDir, "db.opt"), []byte("current db opt file"), os.ModePerm); err != nil {
+		t.Fatalf("failed to write file db.opt: %v", err)
+	}
+	if _, err := mysqlctl.Restore(destTablet.FakeMysqlDaemon, logutil.NewConsoleLogger(), bucket, 4, 0, nil); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Errorf("Restore of a corrupted backup returned %v", err)
+	}
+	if data, err := ioutil.ReadFile(path.Join(sourceDataDbDir, "db.opt")); err != nil || string(data) != "current db opt file" {
+		t.Errorf("Restore of a corrupted backup changed db.opt: %q %v", data, err)
+	}
+	if _, err := os.Stat(sourceDataDir + ".restore"); !os.IsNotExist(err) {
+		t.Errorf("Restore of a corrupted backup left its staging directory: %v", err)
+	}
 }
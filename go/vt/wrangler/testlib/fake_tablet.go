@@ -9,14 +9,18 @@ deal with topology common tasks, like fake tablets and action loops.
 package testlib
 
 import (
+	"crypto/tls"
 	"fmt"
 	"net"
 	"net/http"
 	"testing"
+	"time"
 
+	"github.com/youtube/vitess/go/event"
 	"github.com/youtube/vitess/go/rpcplus"
 	"github.com/youtube/vitess/go/rpcwrap/bsonrpc"
 	"github.com/youtube/vitess/go/vt/mysqlctl"
+	"github.com/youtube/vitess/go/vt/servenv"
 	"github.com/youtube/vitess/go/vt/tabletmanager"
 	"github.com/youtube/vitess/go/vt/tabletmanager/gorpctmserver"
 	"github.com/youtube/vitess/go/vt/topo"
@@ -42,6 +46,17 @@ type FakeTablet struct {
 	Agent     *tabletmanager.ActionAgent
 	Listener  net.Listener
 	RPCServer *rpcplus.Server
+
+	// ServerTLSConfig can be set before starting the event loop, for
+	// the RPC server to also be served over TLS, on SecureListener.
+	// It is the vts port of the tablet.
+	ServerTLSConfig *tls.Config
+	SecureListener  net.Listener
+
+	// Lameduck is created with the event loop: StopActionLoop runs
+	// it before stopping the agent, like servenv.Run does. The
+	// tests can add their own OnTermSync hooks to it.
+	Lameduck *servenv.Lameduck
 }
 
 // TabletOption is an interface for changing tablet parameters.
@@ -124,10 +139,18 @@ func (ft *FakeTablet) StartActionLoop(t *testing.T, wr *wrangler.Wrangler) {
 		t.Fatalf("Cannot listen: %v", err)
 	}
 	port := ft.Listener.Addr().(*net.TCPAddr).Port
+	securePort := 0
+	if ft.ServerTLSConfig != nil {
+		ft.SecureListener, err = net.Listen("tcp", ":0")
+		if err != nil {
+			t.Fatalf("Cannot listen: %v", err)
+		}
+		securePort = ft.SecureListener.Addr().(*net.TCPAddr).Port
+	}
 
 	// create a test agent on that port, and re-read the record
 	// (it has new ports and IP)
-	ft.Agent = tabletmanager.NewTestActionAgent(context.TODO(), wr.TopoServer(), ft.Tablet.Alias, port, ft.FakeMysqlDaemon)
+	ft.Agent = tabletmanager.NewTestActionAgent(context.TODO(), wr.TopoServer(), ft.Tablet.Alias, port, securePort, ft.FakeMysqlDaemon)
 	ft.Tablet = ft.Agent.Tablet().Tablet
 
 	// create the RPC server
@@ -141,15 +164,34 @@ func (ft *FakeTablet) StartActionLoop(t *testing.T, wr *wrangler.Wrangler) {
 		Handler: handler,
 	}
 	go httpServer.Serve(ft.Listener)
+	if ft.SecureListener != nil {
+		go httpServer.Serve(tls.NewListener(ft.SecureListener, ft.ServerTLSConfig))
+	}
+
+	ft.Lameduck = &servenv.Lameduck{
+		Period:        5 * time.Second,
+		OnTermTimeout: 5 * time.Second,
+		OnTermSync:    &event.Hooks{},
+	}
+	ft.Lameduck.AddListener(ft.Listener)
+	if ft.SecureListener != nil {
+		ft.Lameduck.AddListener(ft.SecureListener)
+	}
+	ft.Lameduck.AddRPCServer(ft.RPCServer)
 }
 
-// StopActionLoop will stop the Action Loop for the given FakeTablet
+// StopActionLoop will stop the Action Loop for the given FakeTablet,
+// after the RPCs in flight finished.
 func (ft *FakeTablet) StopActionLoop(t *testing.T) {
 	if ft.Agent == nil {
 		t.Fatalf("Agent for %v is not running", ft.Tablet.Alias)
 	}
-	ft.Listener.Close()
+	if !ft.Lameduck.Run() {
+		t.Errorf("Lameduck for %v didn't finish in time", ft.Tablet.Alias)
+	}
 	ft.Agent.Stop()
 	ft.Agent = nil
 	ft.Listener = nil
+	ft.SecureListener = nil
+	ft.Lameduck = nil
 }
@@ -0,0 +1,90 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package testlib
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/youtube/vitess/go/rpcwrap/bsonrpc"
+	"github.com/youtube/vitess/go/vt/logutil"
+	"github.com/youtube/vitess/go/vt/tabletmanager/tmclient"
+	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/vt/wrangler"
+	"github.com/youtube/vitess/go/vt/zktopo"
+	"golang.org/x/net/context"
+)
+
+// Blocker has an RPC that runs until it is released, and records the
+// shutdown steps.
+type Blocker struct {
+	started chan bool
+	release chan bool
+
+	mu    sync.Mutex
+	steps []string
+}
+
+func (b *Blocker) step(name string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.steps = append(b.steps, name)
+}
+
+func (b *Blocker) Block(ctx context.Context, args *int, reply *int) error {
+	b.started <- true
+	<-b.release
+	b.step("call done")
+	return nil
+}
+
+func TestFakeTabletLameduck(t *testing.T) {
+	ts := zktopo.NewTestServer(t, []string{"cell1"})
+	wr := wrangler.New(logutil.NewConsoleLogger(), ts, tmclient.TabletManagerClient(nil), time.Second)
+	tablet := NewFakeTablet(t, wr, "cell1", 0, topo.TYPE_REPLICA)
+	tablet.StartActionLoop(t, wr)
+
+	blocker := &Blocker{started: make(chan bool, 1), release: make(chan bool)}
+	if err := tablet.RPCServer.Register(blocker); err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+	address := tablet.Listener.Addr().String()
+	client, err := bsonrpc.DialHTTP("tcp", address, time.Second, nil)
+	if err != nil {
+		t.Fatalf("DialHTTP failed: %v", err)
+	}
+	defer client.Close()
+	call := client.Go(context.Background(), "Blocker.Block", new(int), new(int), nil)
+	<-blocker.started
+
+	// the hooks run once no new connection is accepted, and the call
+	// in flight finishes after them
+	tablet.Lameduck.OnTermSync.Add(func() {
+		if conn, err := net.Dial("tcp", address); err == nil {
+			conn.Close()
+			t.Errorf("the listener still accepts connections in lameduck")
+		}
+		blocker.step("hook")
+		close(blocker.release)
+	})
+	tablet.StopActionLoop(t)
+	blocker.step("stopped")
+
+	if err := (<-call.Done).Error; err != nil {
+		t.Errorf("the call in flight failed: %v", err)
+	}
+	want := []string{"hook", "call done", "stopped"}
+	if len(blocker.steps) != len(want) {
+		t.Fatalf("steps are %v, want %v", blocker.steps, want)
+	}
+	for i, step := range want {
+		if blocker.steps[i] != step {
+			t.Errorf("steps are %v, want %v", blocker.steps, want)
+			break
+		}
+	}
+}
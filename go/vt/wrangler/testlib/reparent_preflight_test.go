@@ -0,0 +1,77 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package testlib
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/youtube/vitess/go/vt/logutil"
+	"github.com/youtube/vitess/go/vt/tabletmanager/tmclient"
+	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/vt/wrangler"
+	"github.com/youtube/vitess/go/vt/zktopo"
+	"golang.org/x/net/context"
+)
+
+func TestPlannedReparentPreflight(t *testing.T) {
+	ctx := context.Background()
+	ts := zktopo.NewTestServer(t, []string{"cell1", "cell2"})
+	wr := wrangler.New(logutil.NewConsoleLogger(), ts, tmclient.NewTabletManagerClient(), time.Second)
+
+	master := NewFakeTablet(t, wr, "cell1", 0, topo.TYPE_MASTER)
+	candidate := NewFakeTablet(t, wr, "cell1", 1, topo.TYPE_REPLICA)
+	slave := NewFakeTablet(t, wr, "cell2", 2, topo.TYPE_RDONLY)
+	candidate.FakeMysqlDaemon.Replicating = true
+	candidate.FakeMysqlDaemon.SecondsBehindMaster = 3
+	for _, ft := range []*FakeTablet{master, candidate, slave} {
+		ft.StartActionLoop(t, wr)
+		defer ft.StopActionLoop(t)
+	}
+
+	pf, err := wr.PlannedReparentPreflight(ctx, "test_keyspace", "0", candidate.Tablet.Alias, 30*time.Second)
+	if err != nil {
+		t.Fatalf("PlannedReparentPreflight failed: %v", err)
+	}
+	if len(pf.Problems) != 0 {
+		t.Errorf("unexpected problems: %v", pf.Problems)
+	}
+	if pf.OldMaster != master.Tablet.Alias || pf.CandidateType != topo.TYPE_REPLICA {
+		t.Errorf("wrong master or candidate: %#v", pf)
+	}
+	if want := []topo.TabletAlias{master.Tablet.Alias, slave.Tablet.Alias}; !reflect.DeepEqual(pf.Slaves, want) {
+		t.Errorf("Slaves = %v, want %v", pf.Slaves, want)
+	}
+	if want := []string{"cell1", "cell2"}; !reflect.DeepEqual(pf.Cells, want) {
+		t.Errorf("Cells = %v, want %v", pf.Cells, want)
+	}
+	if pf.EstimatedUnavailability < 3*time.Second {
+		t.Errorf("EstimatedUnavailability = %v, want at least the 3s of lag", pf.EstimatedUnavailability)
+	}
+	if len(pf.Warnings) != 1 || !strings.Contains(pf.Warnings[0], "3s behind") {
+		t.Errorf("Warnings = %v, want the lag", pf.Warnings)
+	}
+
+	// a candidate that doesn't replicate cannot catch up
+	candidate.FakeMysqlDaemon.Replicating = false
+	pf, err = wr.PlannedReparentPreflight(ctx, "test_keyspace", "0", candidate.Tablet.Alias, 30*time.Second)
+	if err != nil {
+		t.Fatalf("PlannedReparentPreflight failed: %v", err)
+	}
+	if len(pf.Problems) != 1 || !strings.Contains(pf.Problems[0], "is not replicating") {
+		t.Errorf("Problems = %v, want the stopped replication", pf.Problems)
+	}
+
+	// the master cannot be the candidate
+	pf, err = wr.PlannedReparentPreflight(ctx, "test_keyspace", "0", master.Tablet.Alias, 30*time.Second)
+	if err != nil {
+		t.Fatalf("PlannedReparentPreflight failed: %v", err)
+	}
+	if len(pf.Problems) != 1 || !strings.Contains(pf.Problems[0], "is already the master") {
+		t.Errorf("Problems = %v, want the candidate being the master", pf.Problems)
+	}
+}
@@ -131,3 +131,61 @@ func TestReparentTablet(t *testing.T) {
 		t.Fatalf("slave.FakeMysqlDaemon.CheckSuperQueryList failed: %v", err)
 	}
 }
+
+func TestStopSlaveMinimum(t *testing.T) {
+	ctx := context.Background()
+	ts := zktopo.NewTestServer(t, []string{"cell1", "cell2"})
+	wr := wrangler.New(logutil.NewConsoleLogger(), ts, tmclient.NewTabletManagerClient(), time.Second)
+
+	// create shard and tablet
+	if err := topo.CreateShard(ts, "test_keyspace", "0"); err != nil {
+		t.Fatalf("CreateShard failed: %v", err)
+	}
+	slave := NewFakeTablet(t, wr, "cell1", 2, topo.TYPE_REPLICA)
+
+	// the slave is behind, and catches up while we wait
+	position := func(sequence uint64) myproto.ReplicationPosition {
+		return myproto.ReplicationPosition{
+			GTIDSet: myproto.MariadbGTID{
+				Domain:   5,
+				Server:   456,
+				Sequence: sequence,
+			},
+		}
+	}
+	slave.FakeMysqlDaemon.Replicating = true
+	slave.FakeMysqlDaemon.CurrentMasterPosition = position(890)
+	slave.FakeMysqlDaemon.CatchUpPositions = []myproto.ReplicationPosition{
+		position(891),
+		position(892),
+		position(893),
+	}
+	slave.FakeMysqlDaemon.ExpectedExecuteSuperQueryList = []string{
+		"STOP SLAVE",
+	}
+	slave.StartActionLoop(t, wr)
+	defer slave.StopActionLoop(t)
+
+	ti, err := ts.GetTablet(slave.Tablet.Alias)
+	if err != nil {
+		t.Fatalf("GetTablet failed: %v", err)
+	}
+	stopPos, err := wr.TabletManagerClient().StopSlaveMinimum(ctx, ti, position(892), time.Minute)
+	if err != nil {
+		t.Fatalf("StopSlaveMinimum failed: %v", err)
+	}
+	if !stopPos.Equal(position(892)) {
+		t.Errorf("StopSlaveMinimum returned wrong position: %v", stopPos)
+	}
+	if slave.FakeMysqlDaemon.Replicating {
+		t.Errorf("slave should be stopped")
+	}
+	if err := slave.FakeMysqlDaemon.CheckSuperQueryList(); err != nil {
+		t.Fatalf("slave.FakeMysqlDaemon.CheckSuperQueryList failed: %v", err)
+	}
+
+	// a stopped slave doesn't catch up, so we time out
+	if _, err := wr.TabletManagerClient().StopSlaveMinimum(ctx, ti, position(893), time.Minute); err == nil {
+		t.Errorf("StopSlaveMinimum on a stopped slave should have failed")
+	}
+}
@@ -0,0 +1,93 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package testlib
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/youtube/vitess/go/netutil"
+	"github.com/youtube/vitess/go/rpcwrap"
+	"github.com/youtube/vitess/go/rpcwrap/tlstest"
+	"github.com/youtube/vitess/go/vt/logutil"
+	"github.com/youtube/vitess/go/vt/tabletmanager/actionnode"
+	"github.com/youtube/vitess/go/vt/tabletmanager/gorpctmclient"
+	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/vt/wrangler"
+	"github.com/youtube/vitess/go/vt/zktopo"
+	"golang.org/x/net/context"
+)
+
+func TestWranglerOverTLS(t *testing.T) {
+	ctx := context.Background()
+	ts := zktopo.NewTestServer(t, []string{"cell1"})
+
+	// the certificates: the tablet one is valid for the host name
+	// the agent publishes in the topology
+	dir, err := ioutil.TempDir("", "wrangler_tls_test")
+	if err != nil {
+		t.Fatalf("TempDir failed: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	tlstest.CreateCA(t, dir, "ca")
+	tlstest.CreateSignedCert(t, dir, "ca", "tablet", "tablet", netutil.FullyQualifiedHostnameOrPanic())
+	tlstest.CreateSignedCert(t, dir, "ca", "vtctl", "vtctl-client")
+	caFile := tlstest.CertFile(dir, "ca")
+	serverConfig, err := rpcwrap.ServerTLSConfig(tlstest.CertFile(dir, "tablet"), tlstest.KeyFile(dir, "tablet"), caFile)
+	if err != nil {
+		t.Fatalf("ServerTLSConfig failed: %v", err)
+	}
+	clientConfig, err := rpcwrap.ClientTLSConfig(tlstest.CertFile(dir, "vtctl"), tlstest.KeyFile(dir, "vtctl"), caFile)
+	if err != nil {
+		t.Fatalf("ClientTLSConfig failed: %v", err)
+	}
+
+	wr := wrangler.New(logutil.NewConsoleLogger(), ts, gorpctmclient.NewSecureGoRPCTabletManagerClient(clientConfig), time.Second)
+	tablet := NewFakeTablet(t, wr, "cell1", 0, topo.TYPE_REPLICA)
+	tablet.ServerTLSConfig = serverConfig
+	tablet.StartActionLoop(t, wr)
+	defer tablet.StopActionLoop(t)
+
+	if err := wr.ChangeType(ctx, tablet.Tablet.Alias, topo.TYPE_SPARE, false); err != nil {
+		t.Fatalf("ChangeType over TLS failed: %v", err)
+	}
+	ti, err := ts.GetTablet(tablet.Tablet.Alias)
+	if err != nil {
+		t.Fatalf("GetTablet failed: %v", err)
+	}
+	if ti.Type != topo.TYPE_SPARE {
+		t.Errorf("tablet type is %v, want %v", ti.Type, topo.TYPE_SPARE)
+	}
+
+	// the tablet saw the name of the client certificate
+	history, err := wr.TabletManagerClient().GetActionHistory(ctx, ti)
+	if err != nil {
+		t.Fatalf("GetActionHistory failed: %v", err)
+	}
+	found := false
+	for _, record := range history {
+		if record.Name == actionnode.TabletActionChangeType {
+			found = true
+			if !strings.HasPrefix(record.From, "vtctl-client@") {
+				t.Errorf("ChangeType was called from %v, want vtctl-client", record.From)
+			}
+		}
+	}
+	if !found {
+		t.Errorf("no ChangeType in the action history: %v", history)
+	}
+
+	// a client without a certificate isn't accepted
+	insecureConfig, err := rpcwrap.ClientTLSConfig("", "", caFile)
+	if err != nil {
+		t.Fatalf("ClientTLSConfig failed: %v", err)
+	}
+	if err := gorpctmclient.NewSecureGoRPCTabletManagerClient(insecureConfig).Ping(ctx, ti); err == nil {
+		t.Errorf("Ping without a client certificate should fail")
+	}
+}
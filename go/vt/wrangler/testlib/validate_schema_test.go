@@ -0,0 +1,118 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package testlib
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/youtube/vitess/go/vt/logutil"
+	myproto "github.com/youtube/vitess/go/vt/mysqlctl/proto"
+	"github.com/youtube/vitess/go/vt/tabletmanager/tmclient"
+	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/vt/wrangler"
+	"github.com/youtube/vitess/go/vt/zktopo"
+	"golang.org/x/net/context"
+)
+
+func validateSchemaTestSchema() *myproto.SchemaDefinition {
+	return &myproto.SchemaDefinition{
+		DatabaseSchema: "CREATE DATABASE `{{.DatabaseName}}` /*!40100 DEFAULT CHARACTER SET utf8 */",
+		TableDefinitions: []*myproto.TableDefinition{
+			&myproto.TableDefinition{
+				Name:              "table1",
+				Schema:            "CREATE TABLE `table1` (\n  `id` bigint(20) NOT NULL,\n  `msg` varchar(64) DEFAULT NULL,\n  PRIMARY KEY (`id`)\n) ENGINE=InnoDB DEFAULT CHARSET=utf8",
+				Columns:           []string{"id", "msg"},
+				PrimaryKeyColumns: []string{"id"},
+				Type:              myproto.TableBaseTable,
+			},
+			&myproto.TableDefinition{
+				Name:              "table2",
+				Schema:            "CREATE TABLE `table2` (\n  `id` bigint(20) NOT NULL,\n  PRIMARY KEY (`id`)\n) ENGINE=InnoDB DEFAULT CHARSET=utf8",
+				Columns:           []string{"id"},
+				PrimaryKeyColumns: []string{"id"},
+				Type:              myproto.TableBaseTable,
+			},
+		},
+	}
+}
+
+func TestValidateSchemaKeyspace(t *testing.T) {
+	ctx := context.Background()
+	ts := zktopo.NewTestServer(t, []string{"cell1", "cell2"})
+	wr := wrangler.New(logutil.NewConsoleLogger(), ts, tmclient.NewTabletManagerClient(), time.Second)
+
+	// 16 shards, with a master and a replica each (the uid 0 would
+	// not be a valid master)
+	var masters, replicas []*FakeTablet
+	for i := 0; i < 16; i++ {
+		start, end := fmt.Sprintf("%x0", i), fmt.Sprintf("%x0", i+1)
+		if i == 0 {
+			start = ""
+		}
+		if i == 15 {
+			end = ""
+		}
+		shard := start + "-" + end
+		master := NewFakeTablet(t, wr, "cell1", uint32(2*i+10), topo.TYPE_MASTER, TabletKeyspaceShard(t, "ks", shard))
+		replica := NewFakeTablet(t, wr, "cell1", uint32(2*i+11), topo.TYPE_REPLICA, TabletKeyspaceShard(t, "ks", shard))
+		for _, ft := range []*FakeTablet{master, replica} {
+			ft.FakeMysqlDaemon.Schema = validateSchemaTestSchema()
+			ft.StartActionLoop(t, wr)
+			defer ft.StopActionLoop(t)
+		}
+		masters = append(masters, master)
+		replicas = append(replicas, replica)
+	}
+
+	if err := wr.ValidateSchemaKeyspace(ctx, "ks", nil, false, false, 4); err != nil {
+		t.Fatalf("ValidateSchemaKeyspace failed: %v", err)
+	}
+
+	// a column was added on the master of the 6th shard and its
+	// replica, and a table is missing on the replica of the 10th
+	// shard: they are reported once each
+	for _, ft := range []*FakeTablet{masters[5], replicas[5]} {
+		td := ft.FakeMysqlDaemon.Schema.TableDefinitions[0]
+		td.Schema = "CREATE TABLE `table1` (\n  `id` bigint(20) NOT NULL,\n  `msg` varchar(64) DEFAULT NULL,\n  `ts` datetime DEFAULT NULL,\n  PRIMARY KEY (`id`)\n) ENGINE=InnoDB DEFAULT CHARSET=utf8"
+		td.Columns = []string{"id", "msg", "ts"}
+	}
+	replicas[9].FakeMysqlDaemon.Schema.TableDefinitions = replicas[9].FakeMysqlDaemon.Schema.TableDefinitions[:1]
+
+	err := wr.ValidateSchemaKeyspace(ctx, "ks", nil, false, false, 4)
+	if err == nil {
+		t.Fatalf("ValidateSchemaKeyspace should have failed")
+	}
+	for _, want := range []string{
+		"cell1-0000000020 differs from cell1-0000000010: table1 (column count differs)",
+		"cell1-0000000029 differs from cell1-0000000028: table2 (missing table)",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("ValidateSchemaKeyspace error doesn't contain %q: %v", want, err)
+		}
+	}
+	if got := strings.Count(err.Error(), "differs from"); got != 2 {
+		t.Errorf("ValidateSchemaKeyspace reported %v differences, expected 2: %v", got, err)
+	}
+	if verr, ok := err.(*wrangler.ValidationError); !ok || len(verr.Problems) != 2 {
+		t.Errorf("ValidateSchemaKeyspace should return a ValidationError with 2 problems: %#v", err)
+	}
+
+	// the verbose mode displays the complete differences
+	err = wr.ValidateSchemaKeyspace(ctx, "ks", nil, false, true, 4)
+	if err == nil || !strings.Contains(err.Error(), "cell1-0000000010 and cell1-0000000020 disagree on schema for table table1:\nCREATE TABLE") || !strings.Contains(err.Error(), "cell1-0000000028 has an extra table named table2") {
+		t.Errorf("unexpected verbose ValidateSchemaKeyspace error: %v", err)
+	}
+
+	// validating a single shard only compares with its master
+	if err := wr.ValidateSchemaShard(ctx, "ks", "50-60", nil, false, false, false, 4); err != nil {
+		t.Errorf("ValidateSchemaShard failed: %v", err)
+	}
+	if err := wr.ValidateSchemaShard(ctx, "ks", "90-a0", nil, false, false, false, 4); err == nil || !strings.Contains(err.Error(), "table2 (missing table)") {
+		t.Errorf("unexpected ValidateSchemaShard error: %v", err)
+	}
+}
@@ -0,0 +1,338 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wrangler
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/youtube/vitess/go/vt/topo"
+	"golang.org/x/net/context"
+)
+
+// This file contains the health report of the topology: the cheap
+// checks of the validators, that only read the topology, bounded in
+// time so they can back an alert.
+
+// Severity ranks the problems of a TopologyHealth.
+type Severity int
+
+const (
+	// SeverityCritical is for the problems that stop the
+	// topology from serving, like a shard without a master.
+	SeverityCritical Severity = iota
+
+	// SeverityWarning is for the problems that may, like a stale
+	// serving graph.
+	SeverityWarning
+
+	// SeverityInfo is for what an operator should know about the
+	// report itself, like shards left out of it.
+	SeverityInfo
+)
+
+var severityNames = map[Severity]string{
+	SeverityCritical: "critical",
+	SeverityWarning:  "warning",
+	SeverityInfo:     "info",
+}
+
+func (s Severity) String() string {
+	if name, ok := severityNames[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("Severity(%d)", int(s))
+}
+
+// MarshalText makes the severities readable in JSON.
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// TopologyProblem is a problem of the topology. Cell, Keyspace and
+// Shard are empty when it is not about one.
+type TopologyProblem struct {
+	Severity Severity
+	Cell     string
+	Keyspace string
+	Shard    string
+	Message  string
+}
+
+// CellHealth is the health of the topology of a cell.
+type CellHealth struct {
+	Cell string
+
+	// Error is set if the topology of the cell cannot be read. Its
+	// shards are not checked then.
+	Error string
+
+	// TabletCounts are the numbers of tablets of the checked shards
+	// by keyspace and type.
+	TabletCounts map[string]map[topo.TabletType]int
+}
+
+// TopologyHealth is the health report of the topology.
+type TopologyHealth struct {
+	Cells []*CellHealth
+
+	// Problems are sorted by severity, most severe first.
+	Problems []*TopologyProblem
+
+	// Sampled is set if the budget ran out before all the shards
+	// were checked: the report is then about a random sample of
+	// ShardsChecked of the ShardsTotal shards.
+	Sampled       bool
+	ShardsChecked int
+	ShardsTotal   int
+}
+
+// shardHealth is the result of the check of one shard.
+type shardHealth struct {
+	keyspace, shard string
+	problems        []*TopologyProblem
+	tabletCounts    map[string]map[topo.TabletType]int
+	err             error
+}
+
+// GetTopologyHealth checks the connectivity to the topology of each
+// cell, and each shard for a master and the staleness of its serving
+// graph in its cells, with concurrency shards at a time. The shards are
+// checked in a random order, and the report only covers the ones that
+// were checked when budget runs out. Only a failure to read the global
+// topology is returned as an error.
+func (wr *Wrangler) GetTopologyHealth(ctx context.Context, budget time.Duration, concurrency int) (*TopologyHealth, error) {
+	ctx, cancel := context.WithTimeout(ctx, budget)
+	defer cancel()
+
+	cells, err := wr.ts.GetKnownCells()
+	if err != nil {
+		return nil, err
+	}
+	keyspaces, err := wr.ts.GetKeyspaces()
+	if err != nil {
+		return nil, err
+	}
+	type keyspaceShard struct{ keyspace, shard string }
+	var shards []keyspaceShard
+	for _, keyspace := range keyspaces {
+		names, err := wr.ts.GetShardNames(keyspace)
+		if err != nil {
+			return nil, fmt.Errorf("GetShardNames(%v) failed: %v", keyspace, err)
+		}
+		for _, shard := range names {
+			shards = append(shards, keyspaceShard{keyspace, shard})
+		}
+	}
+
+	health := &TopologyHealth{ShardsTotal: len(shards)}
+	reachable := make(map[string]bool)
+	cellHealths := make(map[string]*CellHealth)
+	for _, cell := range cells {
+		ch := &CellHealth{
+			Cell:         cell,
+			TabletCounts: make(map[string]map[topo.TabletType]int),
+		}
+		if _, err := wr.ts.GetSrvKeyspaceNames(cell); err != nil && err != topo.ErrNoNode {
+			ch.Error = err.Error()
+			health.Problems = append(health.Problems, &TopologyProblem{
+				Severity: SeverityCritical,
+				Cell:     cell,
+				Message:  fmt.Sprintf("cannot read the topology of cell %v: %v", cell, err),
+			})
+		} else {
+			reachable[cell] = true
+		}
+		health.Cells = append(health.Cells, ch)
+		cellHealths[cell] = ch
+	}
+
+	// check the shards in a random order until the budget runs out.
+	// The results channel can hold them all, so the checks still
+	// running then don't block.
+	results := make(chan *shardHealth, len(shards))
+	todo := make(chan keyspaceShard, len(shards))
+	for _, i := range rand.Perm(len(shards)) {
+		todo <- shards[i]
+	}
+	close(todo)
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	wg := sync.WaitGroup{}
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ks := range todo {
+				if ctx.Err() != nil {
+					return
+				}
+				results <- wr.shardHealth(ctx, ks.keyspace, ks.shard, reachable)
+			}
+		}()
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	var checked []*shardHealth
+	collect := func(sh *shardHealth) {
+		if sh.err != nil && ctx.Err() != nil {
+			// interrupted by the budget, not checked
+			return
+		}
+		checked = append(checked, sh)
+	}
+loop:
+	for {
+		select {
+		case sh := <-results:
+			collect(sh)
+		case <-done:
+			break loop
+		case <-ctx.Done():
+			break loop
+		}
+	}
+	for len(results) > 0 {
+		collect(<-results)
+	}
+
+	for _, sh := range checked {
+		health.Problems = append(health.Problems, sh.problems...)
+		if sh.err != nil {
+			health.Problems = append(health.Problems, &TopologyProblem{
+				Severity: SeverityCritical,
+				Keyspace: sh.keyspace,
+				Shard:    sh.shard,
+				Message:  fmt.Sprintf("cannot check shard %v/%v: %v", sh.keyspace, sh.shard, sh.err),
+			})
+		}
+		for cell, counts := range sh.tabletCounts {
+			ch, ok := cellHealths[cell]
+			if !ok {
+				continue
+			}
+			if ch.TabletCounts[sh.keyspace] == nil {
+				ch.TabletCounts[sh.keyspace] = make(map[topo.TabletType]int)
+			}
+			for tabletType, n := range counts {
+				ch.TabletCounts[sh.keyspace][tabletType] += n
+			}
+		}
+	}
+	health.ShardsChecked = len(checked)
+	if health.ShardsChecked < health.ShardsTotal {
+		health.Sampled = true
+		health.Problems = append(health.Problems, &TopologyProblem{
+			Severity: SeverityInfo,
+			Message:  fmt.Sprintf("the budget of %v ran out, only %v of the %v shards were checked", budget, health.ShardsChecked, health.ShardsTotal),
+		})
+	}
+	sort.Sort(topologyProblems(health.Problems))
+	return health, nil
+}
+
+// shardHealth checks a shard has a master, and its serving graph in
+// each of its cells in reachable. The tablet counts are by cell, then
+// type.
+func (wr *Wrangler) shardHealth(ctx context.Context, keyspace, shard string, reachable map[string]bool) *shardHealth {
+	sh := &shardHealth{
+		keyspace:     keyspace,
+		shard:        shard,
+		tabletCounts: make(map[string]map[topo.TabletType]int),
+	}
+	si, err := wr.ts.GetShard(keyspace, shard)
+	if err != nil {
+		sh.err = err
+		return sh
+	}
+	if si.MasterAlias.Uid == topo.NO_TABLET {
+		sh.problems = append(sh.problems, &TopologyProblem{
+			Severity: SeverityCritical,
+			Keyspace: keyspace,
+			Shard:    shard,
+			Message:  fmt.Sprintf("shard %v/%v has no master", keyspace, shard),
+		})
+	}
+
+	var cells []string
+	for _, cell := range si.Cells {
+		if reachable[cell] {
+			cells = append(cells, cell)
+		}
+	}
+	tablets, err := topo.GetTabletMapForShardByCell(ctx, wr.ts, keyspace, shard, cells)
+	if err != nil && err != topo.ErrPartialResult {
+		sh.err = err
+		return sh
+	}
+	partial := err == topo.ErrPartialResult
+	tabletsByCell := make(map[string]map[topo.TabletAlias]*topo.TabletInfo)
+	for _, cell := range cells {
+		tabletsByCell[cell] = make(map[topo.TabletAlias]*topo.TabletInfo)
+		sh.tabletCounts[cell] = make(map[topo.TabletType]int)
+	}
+	for alias, ti := range tablets {
+		if _, ok := tabletsByCell[alias.Cell]; !ok {
+			continue
+		}
+		tabletsByCell[alias.Cell][alias] = ti
+		sh.tabletCounts[alias.Cell][ti.Type]++
+	}
+
+	for _, cell := range cells {
+		sg, err := wr.checkShardServingGraph(cell, keyspace, shard, tabletsByCell[cell], partial)
+		if err != nil {
+			sh.err = err
+			return sh
+		}
+		var messages []string
+		messages = append(messages, sg.Problems...)
+		for _, endPoints := range sg.EndPoints {
+			for _, ep := range endPoints {
+				if ep.Problem != "" {
+					messages = append(messages, ep.Problem)
+				}
+			}
+		}
+		for _, message := range messages {
+			sh.problems = append(sh.problems, &TopologyProblem{
+				Severity: SeverityWarning,
+				Cell:     cell,
+				Keyspace: keyspace,
+				Shard:    shard,
+				Message:  message,
+			})
+		}
+	}
+	return sh
+}
+
+// topologyProblems sorts problems by severity, then place and message.
+type topologyProblems []*TopologyProblem
+
+func (tp topologyProblems) Len() int      { return len(tp) }
+func (tp topologyProblems) Swap(i, j int) { tp[i], tp[j] = tp[j], tp[i] }
+func (tp topologyProblems) Less(i, j int) bool {
+	a, b := tp[i], tp[j]
+	switch {
+	case a.Severity != b.Severity:
+		return a.Severity < b.Severity
+	case a.Cell != b.Cell:
+		return a.Cell < b.Cell
+	case a.Keyspace != b.Keyspace:
+		return a.Keyspace < b.Keyspace
+	case a.Shard != b.Shard:
+		return a.Shard < b.Shard
+	}
+	return a.Message < b.Message
+}
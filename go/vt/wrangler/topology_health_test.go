@@ -0,0 +1,93 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wrangler
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/youtube/vitess/go/vt/logutil"
+	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/vt/zktopo"
+	"golang.org/x/net/context"
+)
+
+func TestGetTopologyHealth(t *testing.T) {
+	ctx := context.Background()
+	ts := zktopo.NewTestServer(t, []string{"cell1", "cell2"})
+	wr := New(logutil.NewMemoryLogger(), ts, nil, time.Second)
+	if err := ts.CreateKeyspace("ks", &topo.Keyspace{}); err != nil {
+		t.Fatalf("CreateKeyspace failed: %v", err)
+	}
+	if err := ts.CreateShard("ks", "-80", &topo.Shard{
+		MasterAlias: topo.TabletAlias{Cell: "cell1", Uid: 100},
+		Cells:       []string{"cell1"},
+	}); err != nil {
+		t.Fatalf("CreateShard failed: %v", err)
+	}
+	if err := ts.CreateShard("ks", "80-", &topo.Shard{Cells: []string{"cell1"}}); err != nil {
+		t.Fatalf("CreateShard failed: %v", err)
+	}
+	for _, tablet := range []*topo.Tablet{
+		{Alias: topo.TabletAlias{Cell: "cell1", Uid: 100}, Shard: "-80", Type: topo.TYPE_MASTER},
+		{Alias: topo.TabletAlias{Cell: "cell1", Uid: 101}, Shard: "-80", Type: topo.TYPE_REPLICA},
+		{Alias: topo.TabletAlias{Cell: "cell1", Uid: 200}, Shard: "80-", Type: topo.TYPE_REPLICA},
+	} {
+		tablet.Keyspace = "ks"
+		if err := topo.CreateTablet(ctx, ts, tablet); err != nil {
+			t.Fatalf("CreateTablet failed: %v", err)
+		}
+	}
+	for tabletType, uid := range map[topo.TabletType]uint32{
+		topo.TYPE_MASTER:  100,
+		topo.TYPE_REPLICA: 101,
+	} {
+		endPoints := topo.NewEndPoints()
+		endPoints.Entries = append(endPoints.Entries, *topo.NewEndPoint(uid, "host"))
+		if err := ts.UpdateEndPoints("cell1", "ks", "-80", tabletType, endPoints); err != nil {
+			t.Fatalf("UpdateEndPoints failed: %v", err)
+		}
+	}
+
+	health, err := wr.GetTopologyHealth(ctx, 10*time.Second, 4)
+	if err != nil {
+		t.Fatalf("GetTopologyHealth failed: %v", err)
+	}
+	if health.Sampled || health.ShardsChecked != 2 || health.ShardsTotal != 2 {
+		t.Errorf("not all shards were checked: %+v", health)
+	}
+	want := []*TopologyProblem{
+		{Severity: SeverityCritical, Keyspace: "ks", Shard: "80-", Message: "shard ks/80- has no master"},
+		{Severity: SeverityWarning, Cell: "cell1", Keyspace: "ks", Shard: "80-", Message: "replica tablet cell1-0000000200 of ks/80- has no end point in cell cell1"},
+	}
+	if !reflect.DeepEqual(health.Problems, want) {
+		for _, p := range health.Problems {
+			t.Logf("problem: %+v", *p)
+		}
+		t.Errorf("unexpected problems")
+	}
+	if len(health.Cells) != 2 || health.Cells[0].Cell != "cell1" || health.Cells[0].Error != "" {
+		t.Fatalf("unexpected cells: %+v", health.Cells)
+	}
+	wantCounts := map[string]map[topo.TabletType]int{
+		"ks": {topo.TYPE_MASTER: 1, topo.TYPE_REPLICA: 2},
+	}
+	if !reflect.DeepEqual(health.Cells[0].TabletCounts, wantCounts) {
+		t.Errorf("tablet counts of cell1: got %v, want %v", health.Cells[0].TabletCounts, wantCounts)
+	}
+
+	// without budget, no shard is checked, and the report says so
+	health, err = wr.GetTopologyHealth(ctx, 0, 4)
+	if err != nil {
+		t.Fatalf("GetTopologyHealth failed: %v", err)
+	}
+	if !health.Sampled || health.ShardsChecked != 0 || health.ShardsTotal != 2 {
+		t.Errorf("shards were checked without budget: %+v", health)
+	}
+	if len(health.Problems) != 1 || health.Problems[0].Severity != SeverityInfo {
+		t.Errorf("unexpected problems without budget: %v", health.Problems)
+	}
+}
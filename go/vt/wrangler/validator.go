@@ -6,10 +6,11 @@ package wrangler
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 	"sync"
 
-	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/vt/concurrency"
 	"github.com/youtube/vitess/go/vt/topo"
 	"golang.org/x/net/context"
 )
@@ -22,6 +23,29 @@ import (
 //
 // This may eventually move into a separate package.
 
+// ValidationError is the error returned by the Validate* methods
+// when they find problems, so the callers can report them one by one.
+type ValidationError struct {
+	// Title is the first line of the error message.
+	Title string
+	// Problems has one entry per problem found.
+	Problems []string
+}
+
+// Error is part of the error interface.
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("%v:\n%v", e.Title, strings.Join(e.Problems, "\n"))
+}
+
+// newValidationError returns a ValidationError with the errors of
+// er, or nil if it has none.
+func newValidationError(title string, er *concurrency.AllErrorRecorder) error {
+	if !er.HasErrors() {
+		return nil
+	}
+	return &ValidationError{Title: title, Problems: er.ErrorStrings()}
+}
+
 // waitForResults will wait for all the errors to come back.
 // There is no timeout, as individual calls will use the context and timeout
 // and fail at the end anyway.
@@ -31,12 +55,15 @@ func (wr *Wrangler) waitForResults(wg *sync.WaitGroup, results chan error) error
 		close(results)
 	}()
 
-	var finalErr error
+	var problems []string
 	for err := range results {
-		finalErr = fmt.Errorf("some validation errors - see log")
-		log.Errorf("%v", err)
+		problems = append(problems, err.Error())
+	}
+	if len(problems) == 0 {
+		return nil
 	}
-	return finalErr
+	sort.Strings(problems)
+	return &ValidationError{Title: "Validation errors", Problems: problems}
 }
 
 // Validate all tablets in all discoverable cells, even if they are
@@ -142,6 +169,9 @@ func (wr *Wrangler) validateShard(ctx context.Context, keyspace, shard string, p
 		results <- fmt.Errorf("no master for shard %v/%v", keyspace, shard)
 	} else if shardInfo.MasterAlias != masterAlias {
 		results <- fmt.Errorf("master mismatch for shard %v/%v: found %v, expected %v", keyspace, shard, masterAlias, shardInfo.MasterAlias)
+	} else if reason, ok := tabletMap[masterAlias].Tags[topo.MaintenanceMode]; ok {
+		// not an error, but it can't be reparented away
+		wr.Logger().Warningf("master %v of shard %v/%v is in maintenance mode: %v", masterAlias, keyspace, shard, reason)
 	}
 
 	for _, alias := range aliases {
@@ -111,10 +111,7 @@ func (wr *Wrangler) ValidateVersionShard(ctx context.Context, keyspace, shard st
 		go wr.diffVersion(masterVersion, si.MasterAlias, alias, &wg, &er)
 	}
 	wg.Wait()
-	if er.HasErrors() {
-		return fmt.Errorf("Version diffs:\n%v", er.Error().Error())
-	}
-	return nil
+	return newValidationError("Version diffs", &er)
 }
 
 // ValidateVersionKeyspace validates all versions are the same in all
@@ -170,8 +167,5 @@ func (wr *Wrangler) ValidateVersionKeyspace(ctx context.Context, keyspace string
 		}
 	}
 	wg.Wait()
-	if er.HasErrors() {
-		return fmt.Errorf("Version diffs:\n%v", er.Error().Error())
-	}
-	return nil
+	return newValidationError("Version diffs", &er)
 }
@@ -0,0 +1,150 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wrangler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/youtube/vitess/go/vt/topo"
+	"golang.org/x/net/context"
+)
+
+// This file contains the management of the tablets a vtworker changed
+// to the worker type. vtworker tags them with its URL and its identity,
+// and changes them back when it is done. If it dies before that, the
+// tablets stay out of the serving graph until they are released here.
+
+const (
+	// WorkerTag is the tablet tag with the URL of the vtworker
+	// that holds the tablet.
+	WorkerTag = "worker"
+
+	// WorkerIDTag is the tablet tag with the identity of the
+	// vtworker process that holds the tablet, which it exports as
+	// the WorkerID variable.
+	WorkerIDTag = "worker_id"
+
+	// WorkerIDVar is the name of the exported variable with the
+	// identity of a vtworker process.
+	WorkerIDVar = "WorkerID"
+)
+
+// workerCheckTimeout is how long we wait for a vtworker to answer
+// before we consider it dead.
+const workerCheckTimeout = 10 * time.Second
+
+// Worker tablet states, as returned by WorkerTablet.State.
+const (
+	// WorkerTabletAlive is a tablet held by a running vtworker.
+	WorkerTabletAlive = "alive"
+
+	// WorkerTabletDead is a tablet held by a vtworker that is
+	// gone, or was restarted.
+	WorkerTabletDead = "dead"
+
+	// WorkerTabletUnowned is a tablet no vtworker holds: a
+	// SplitClone left it there to be resumed from.
+	WorkerTabletUnowned = "unowned"
+)
+
+// WorkerTablet is a tablet of the worker type.
+type WorkerTablet struct {
+	Alias    topo.TabletAlias
+	WorkerID string
+	URL      string
+	State    string
+}
+
+// FindWorkerTablets returns the tablets of a shard that are of the
+// worker type, and checks if the vtworker that holds them is still
+// running.
+func (wr *Wrangler) FindWorkerTablets(ctx context.Context, keyspace, shard string) ([]*WorkerTablet, error) {
+	tabletMap, err := topo.GetTabletMapForShard(ctx, wr.ts, keyspace, shard)
+	if err != nil {
+		return nil, err
+	}
+	var aliases topo.TabletAliasList
+	for alias, ti := range tabletMap {
+		if ti.Type == topo.TYPE_WORKER {
+			aliases = append(aliases, alias)
+		}
+	}
+	sort.Sort(aliases)
+
+	result := make([]*WorkerTablet, 0, len(aliases))
+	for _, alias := range aliases {
+		ti := tabletMap[alias]
+		wt := &WorkerTablet{
+			Alias:    alias,
+			WorkerID: ti.Tags[WorkerIDTag],
+			URL:      ti.Tags[WorkerTag],
+		}
+		switch {
+		case wt.URL == "":
+			wt.State = WorkerTabletUnowned
+		case wr.IsWorkerAlive(wt.URL, wt.WorkerID):
+			wt.State = WorkerTabletAlive
+		default:
+			wt.State = WorkerTabletDead
+		}
+		result = append(result, wt)
+	}
+	return result, nil
+}
+
+// IsWorkerAlive returns true if the vtworker at url answers with the
+// identity the tablet was tagged with. A tablet tagged without an
+// identity was held by an older vtworker: it is alive if it answers.
+func (wr *Wrangler) IsWorkerAlive(url, workerID string) bool {
+	client := &http.Client{Timeout: workerCheckTimeout}
+	resp, err := client.Get(url + "/debug/vars")
+	if err != nil {
+		wr.Logger().Infof("vtworker %v doesn't answer: %v", url, err)
+		return false
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		wr.Logger().Infof("vtworker %v answers with status %v", url, resp.Status)
+		return false
+	}
+	if workerID == "" {
+		return true
+	}
+	vars := make(map[string]interface{})
+	if err := json.NewDecoder(resp.Body).Decode(&vars); err != nil {
+		wr.Logger().Infof("vtworker %v returns invalid variables: %v", url, err)
+		return false
+	}
+	return vars[WorkerIDVar] == workerID
+}
+
+// ReleaseWorkerTablet takes a tablet held by a vtworker back: it
+// restarts its replication, changes it back to rdonly, and removes the
+// worker tags. FindWorkerTablets tells which vtworker are gone.
+func (wr *Wrangler) ReleaseWorkerTablet(ctx context.Context, tabletAlias topo.TabletAlias) error {
+	ti, err := wr.ts.GetTablet(tabletAlias)
+	if err != nil {
+		return err
+	}
+	if ti.Type != topo.TYPE_WORKER {
+		return fmt.Errorf("tablet %v is not a worker tablet, but %v", tabletAlias, ti.Type)
+	}
+
+	if err := wr.tmc.StartSlave(ctx, ti); err != nil {
+		return fmt.Errorf("cannot restart replication on tablet %v: %v", tabletAlias, err)
+	}
+	if err := wr.ChangeType(ctx, tabletAlias, topo.TYPE_RDONLY, false /*force*/); err != nil {
+		return err
+	}
+	return wr.ts.UpdateTabletFields(tabletAlias, func(tablet *topo.Tablet) error {
+		delete(tablet.Tags, WorkerTag)
+		delete(tablet.Tags, WorkerIDTag)
+		return nil
+	})
+}
@@ -0,0 +1,80 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wrangler
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/youtube/vitess/go/vt/logutil"
+	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/vt/zktopo"
+	"golang.org/x/net/context"
+)
+
+func TestFindWorkerTablets(t *testing.T) {
+	ctx := context.Background()
+	ts := zktopo.NewTestServer(t, []string{"cell1"})
+	wr := New(logutil.NewMemoryLogger(), ts, nil, time.Second)
+	if err := ts.CreateShard("ks", "0", &topo.Shard{Cells: []string{"cell1"}}); err != nil {
+		t.Fatalf("CreateShard failed: %v", err)
+	}
+
+	// a running vtworker, exporting its id
+	worker := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "{\"%v\": \"alive-1\"}", WorkerIDVar)
+	}))
+	defer worker.Close()
+	gone := httptest.NewServer(http.NotFoundHandler())
+	goneURL := gone.URL
+	gone.Close()
+
+	for i, tablet := range []struct {
+		tabletType topo.TabletType
+		tags       map[string]string
+	}{
+		{topo.TYPE_RDONLY, nil},
+		{topo.TYPE_WORKER, map[string]string{WorkerTag: worker.URL, WorkerIDTag: "alive-1"}},
+		{topo.TYPE_WORKER, map[string]string{WorkerTag: worker.URL, WorkerIDTag: "restarted-1"}},
+		{topo.TYPE_WORKER, map[string]string{WorkerTag: goneURL, WorkerIDTag: "gone-1"}},
+		{topo.TYPE_WORKER, nil},
+	} {
+		if err := topo.CreateTablet(ctx, ts, &topo.Tablet{
+			Alias:    topo.TabletAlias{Cell: "cell1", Uid: uint32(100 + i)},
+			Keyspace: "ks",
+			Shard:    "0",
+			Type:     tablet.tabletType,
+			Tags:     tablet.tags,
+		}); err != nil {
+			t.Fatalf("CreateTablet failed: %v", err)
+		}
+	}
+
+	workerTablets, err := wr.FindWorkerTablets(ctx, "ks", "0")
+	if err != nil {
+		t.Fatalf("FindWorkerTablets failed: %v", err)
+	}
+	want := []string{
+		"cell1-0000000101 " + WorkerTabletAlive,
+		"cell1-0000000102 " + WorkerTabletDead,
+		"cell1-0000000103 " + WorkerTabletDead,
+		"cell1-0000000104 " + WorkerTabletUnowned,
+	}
+	if len(workerTablets) != len(want) {
+		t.Fatalf("FindWorkerTablets returned %v tablets, want %v", len(workerTablets), len(want))
+	}
+	for i, wt := range workerTablets {
+		if got := fmt.Sprintf("%v %v", wt.Alias, wt.State); got != want[i] {
+			t.Errorf("FindWorkerTablets()[%v] = %v, want %v", i, got, want[i])
+		}
+	}
+
+	if err := wr.ReleaseWorkerTablet(ctx, topo.TabletAlias{Cell: "cell1", Uid: 100}); err == nil {
+		t.Errorf("ReleaseWorkerTablet of a rdonly tablet should have failed")
+	}
+}
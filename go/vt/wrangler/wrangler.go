@@ -33,6 +33,8 @@ type Wrangler struct {
 	ts          topo.Server
 	tmc         tmclient.TabletManagerClient
 	lockTimeout time.Duration
+	// job is set by StartJob.
+	job *Job
 }
 
 // New creates a new Wrangler object.
@@ -68,7 +68,9 @@ func (zkts *Server) UpdateKeyspace(ki *topo.KeyspaceInfo, existingVersion int64)
 	data := jscfg.ToJSON(ki.Keyspace)
 	stat, err := zkts.zconn.Set(keyspacePath, data, int(existingVersion))
 	if err != nil {
-		if zookeeper.IsError(err, zookeeper.ZNONODE) {
+		if zookeeper.IsError(err, zookeeper.ZBADVERSION) {
+			err = topo.ErrBadVersion
+		} else if zookeeper.IsError(err, zookeeper.ZNONODE) {
 			err = topo.ErrNoNode
 		}
 		return -1, err
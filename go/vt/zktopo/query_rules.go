@@ -0,0 +1,174 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zktopo
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"time"
+
+	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/jscfg"
+	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/zk"
+	"launchpad.net/gozk/zookeeper"
+)
+
+/*
+This file contains the query rules management code for zktopo.Server
+*/
+
+const queryRulesFilename = "queryrules"
+
+func keyspaceQueryRulesPath(keyspace string) string {
+	return path.Join(globalKeyspacesPath, keyspace, queryRulesFilename)
+}
+
+func tabletQueryRulesPath(tabletAlias topo.TabletAlias) string {
+	return path.Join(TabletPathForAlias(tabletAlias), queryRulesFilename)
+}
+
+// SaveKeyspaceQueryRules is part of the topo.QueryRuler interface.
+func (zkts *Server) SaveKeyspaceQueryRules(keyspace string, qrs *topo.QueryRules) error {
+	return zkts.saveQueryRules(keyspaceQueryRulesPath(keyspace), qrs)
+}
+
+// GetKeyspaceQueryRules is part of the topo.QueryRuler interface.
+func (zkts *Server) GetKeyspaceQueryRules(keyspace string) (*topo.QueryRules, error) {
+	return zkts.getQueryRules(keyspaceQueryRulesPath(keyspace))
+}
+
+// WatchKeyspaceQueryRules is part of the topo.QueryRuler interface.
+func (zkts *Server) WatchKeyspaceQueryRules(keyspace string) (<-chan *topo.QueryRules, chan<- struct{}, error) {
+	return zkts.watchQueryRules(keyspaceQueryRulesPath(keyspace))
+}
+
+// SaveTabletQueryRules is part of the topo.QueryRuler interface.
+func (zkts *Server) SaveTabletQueryRules(tabletAlias topo.TabletAlias, qrs *topo.QueryRules) error {
+	return zkts.saveQueryRules(tabletQueryRulesPath(tabletAlias), qrs)
+}
+
+// GetTabletQueryRules is part of the topo.QueryRuler interface.
+func (zkts *Server) GetTabletQueryRules(tabletAlias topo.TabletAlias) (*topo.QueryRules, error) {
+	return zkts.getQueryRules(tabletQueryRulesPath(tabletAlias))
+}
+
+// WatchTabletQueryRules is part of the topo.QueryRuler interface.
+func (zkts *Server) WatchTabletQueryRules(tabletAlias topo.TabletAlias) (<-chan *topo.QueryRules, chan<- struct{}, error) {
+	return zkts.watchQueryRules(tabletQueryRulesPath(tabletAlias))
+}
+
+// saveQueryRules saves qrs in the node of a keyspace or tablet, which
+// has to exist.
+func (zkts *Server) saveQueryRules(zkPath string, qrs *topo.QueryRules) error {
+	_, err := zk.CreateOrUpdate(zkts.zconn, zkPath, jscfg.ToJSON(qrs), 0, zookeeper.WorldACL(zookeeper.PERM_ALL), false)
+	if err != nil && zookeeper.IsError(err, zookeeper.ZNONODE) {
+		err = topo.ErrNoNode
+	}
+	return err
+}
+
+func (zkts *Server) getQueryRules(zkPath string) (*topo.QueryRules, error) {
+	data, _, err := zkts.zconn.Get(zkPath)
+	if err != nil {
+		if zookeeper.IsError(err, zookeeper.ZNONODE) {
+			err = topo.ErrNoNode
+		}
+		return nil, err
+	}
+	return parseQueryRules(zkPath, data)
+}
+
+func parseQueryRules(zkPath, data string) (*topo.QueryRules, error) {
+	qrs := &topo.QueryRules{}
+	if err := json.Unmarshal([]byte(data), qrs); err != nil {
+		return nil, fmt.Errorf("bad query rules data in %v (%v): %q", zkPath, err, data)
+	}
+	return qrs, nil
+}
+
+// watchQueryRules is like WatchEndPoints, but while the node doesn't
+// exist it watches for its creation, so new rules are seen right away.
+func (zkts *Server) watchQueryRules(zkPath string) (<-chan *topo.QueryRules, chan<- struct{}, error) {
+	notifications := make(chan *topo.QueryRules, 10)
+	stopWatching := make(chan struct{})
+
+	// waitOrInterrupted will return true if stopWatching is triggered
+	waitOrInterrupted := func() bool {
+		timer := time.After(WatchSleepDuration)
+		select {
+		case <-stopWatching:
+			close(notifications)
+			return true
+		case <-timer:
+		}
+		return false
+	}
+
+	// send will return true if stopWatching is triggered
+	send := func(qrs *topo.QueryRules) bool {
+		select {
+		case <-stopWatching:
+			close(notifications)
+			return true
+		case notifications <- qrs:
+		}
+		return false
+	}
+
+	go func() {
+		for {
+			data, _, watch, err := zkts.zconn.GetW(zkPath)
+			switch {
+			case err == nil:
+				qrs, err := parseQueryRules(zkPath, data)
+				if err != nil {
+					log.Errorf("%v", err)
+				} else if send(qrs) {
+					return
+				}
+			case zookeeper.IsError(err, zookeeper.ZNONODE):
+				stat, existsWatch, err := zkts.zconn.ExistsW(zkPath)
+				if err != nil {
+					log.Errorf("Cannot set watch on %v, waiting for %v to retry: %v", zkPath, WatchSleepDuration, err)
+					if waitOrInterrupted() {
+						return
+					}
+					continue
+				}
+				if stat != nil {
+					// created in the meantime
+					continue
+				}
+				if send(nil) {
+					return
+				}
+				watch = existsWatch
+			default:
+				log.Errorf("Cannot set watch on %v, waiting for %v to retry: %v", zkPath, WatchSleepDuration, err)
+				if waitOrInterrupted() {
+					return
+				}
+				continue
+			}
+
+			select {
+			case event, ok := <-watch:
+				if !ok || !event.Ok() {
+					log.Warningf("watch on %v was closed or failed, waiting for %v to retry", zkPath, WatchSleepDuration)
+					if waitOrInterrupted() {
+						return
+					}
+				}
+			case <-stopWatching:
+				close(notifications)
+				return
+			}
+		}
+	}()
+
+	return notifications, stopWatching, nil
+}
@@ -62,7 +62,9 @@ func (zkts *Server) UpdateShard(si *topo.ShardInfo, existingVersion int64) (int6
 	shardPath := path.Join(globalKeyspacesPath, si.Keyspace(), "shards", si.ShardName())
 	stat, err := zkts.zconn.Set(shardPath, jscfg.ToJSON(si.Shard), int(existingVersion))
 	if err != nil {
-		if zookeeper.IsError(err, zookeeper.ZNONODE) {
+		if zookeeper.IsError(err, zookeeper.ZBADVERSION) {
+			err = topo.ErrBadVersion
+		} else if zookeeper.IsError(err, zookeeper.ZNONODE) {
 			err = topo.ErrNoNode
 		}
 		return -1, err
@@ -0,0 +1,45 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zktopo
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/youtube/vitess/go/jscfg"
+	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/zk"
+	"launchpad.net/gozk/zookeeper"
+)
+
+/*
+This file contains the table ACL management code for zktopo.Server
+*/
+
+const (
+	globalTableACLPath = "/zk/global/vt/tableacl"
+)
+
+// SaveTableACL saves the global table ACL config into the topo.
+func (zkts *Server) SaveTableACL(tableACL *topo.TableACL) error {
+	_, err := zk.CreateOrUpdate(zkts.zconn, globalTableACLPath, jscfg.ToJSON(tableACL), 0, zookeeper.WorldACL(zookeeper.PERM_ALL), true)
+	return err
+}
+
+// GetTableACL fetches the global table ACL config from the topo.
+func (zkts *Server) GetTableACL() (*topo.TableACL, error) {
+	data, _, err := zkts.zconn.Get(globalTableACLPath)
+	if err != nil {
+		if zookeeper.IsError(err, zookeeper.ZNONODE) {
+			err = topo.ErrNoNode
+		}
+		return nil, err
+	}
+	tableACL := &topo.TableACL{}
+	if err := json.Unmarshal([]byte(data), tableACL); err != nil {
+		return nil, fmt.Errorf("bad table ACL data (%v): %q", err, data)
+	}
+	return tableACL, nil
+}
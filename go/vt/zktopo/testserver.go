@@ -59,3 +59,43 @@ func (s *TestServer) SaveVSchema(vschema string) error {
 func (s *TestServer) GetVSchema() (string, error) {
 	return s.Server.(topo.Schemafier).GetVSchema()
 }
+
+// SaveTableACL has to be redefined here, like SaveVSchema.
+func (s *TestServer) SaveTableACL(tableACL *topo.TableACL) error {
+	return s.Server.(topo.TableACLer).SaveTableACL(tableACL)
+}
+
+// GetTableACL has to be redefined here, like GetVSchema.
+func (s *TestServer) GetTableACL() (*topo.TableACL, error) {
+	return s.Server.(topo.TableACLer).GetTableACL()
+}
+
+// SaveKeyspaceQueryRules has to be redefined here, like SaveVSchema.
+func (s *TestServer) SaveKeyspaceQueryRules(keyspace string, qrs *topo.QueryRules) error {
+	return s.Server.(topo.QueryRuler).SaveKeyspaceQueryRules(keyspace, qrs)
+}
+
+// GetKeyspaceQueryRules has to be redefined here, like GetVSchema.
+func (s *TestServer) GetKeyspaceQueryRules(keyspace string) (*topo.QueryRules, error) {
+	return s.Server.(topo.QueryRuler).GetKeyspaceQueryRules(keyspace)
+}
+
+// WatchKeyspaceQueryRules has to be redefined here, like GetVSchema.
+func (s *TestServer) WatchKeyspaceQueryRules(keyspace string) (<-chan *topo.QueryRules, chan<- struct{}, error) {
+	return s.Server.(topo.QueryRuler).WatchKeyspaceQueryRules(keyspace)
+}
+
+// SaveTabletQueryRules has to be redefined here, like SaveVSchema.
+func (s *TestServer) SaveTabletQueryRules(tabletAlias topo.TabletAlias, qrs *topo.QueryRules) error {
+	return s.Server.(topo.QueryRuler).SaveTabletQueryRules(tabletAlias, qrs)
+}
+
+// GetTabletQueryRules has to be redefined here, like GetVSchema.
+func (s *TestServer) GetTabletQueryRules(tabletAlias topo.TabletAlias) (*topo.QueryRules, error) {
+	return s.Server.(topo.QueryRuler).GetTabletQueryRules(tabletAlias)
+}
+
+// WatchTabletQueryRules has to be redefined here, like GetVSchema.
+func (s *TestServer) WatchTabletQueryRules(tabletAlias topo.TabletAlias) (<-chan *topo.QueryRules, chan<- struct{}, error) {
+	return s.Server.(topo.QueryRuler).WatchTabletQueryRules(tabletAlias)
+}
@@ -82,6 +82,18 @@ func TestVSchema(t *testing.T) {
 	test.CheckVSchema(t, ts)
 }
 
+func TestTableACL(t *testing.T) {
+	ts := NewTestServer(t, []string{"test"})
+	defer ts.Close()
+	test.CheckTableACL(t, ts)
+}
+
+func TestQueryRules(t *testing.T) {
+	ts := NewTestServer(t, []string{"test"})
+	defer ts.Close()
+	test.CheckQueryRules(t, ts)
+}
+
 // TestPurgeActions is a ZK specific unit test
 func TestPurgeActions(t *testing.T) {
 	ts := NewTestServer(t, []string{"test"})
@@ -0,0 +1,245 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zkctl
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	log "github.com/golang/glog"
+	"launchpad.net/gozk/zookeeper"
+)
+
+// ZkCluster is a set of ZooKeeper ensembles run on the local host:
+// one per cell, and the global one. It is defined by a JSON map of
+// the cells to their servers, in the -zk.cfg format:
+//
+//	{
+//	  "global": "1001@localhost:28881:38881:21811",
+//	  "test_nj": "1@localhost:28882:38882:21812,2@localhost:28883:38883:21813,3@localhost:28884:38884:21814"
+//	}
+//
+// The global cell needs server ids over 1000, and the other cells
+// server ids under it. Init and Teardown can be run again, they only
+// do what is left to do.
+type ZkCluster struct {
+	// cells are the sorted cell names.
+	cells []string
+	// servers has the config of each server of each cell.
+	servers map[string][]*ZkConfig
+}
+
+// NewZkCluster returns the cluster of the definition def, from the
+// cells to their servers.
+func NewZkCluster(def map[string]string) (*ZkCluster, error) {
+	zc := &ZkCluster{servers: make(map[string][]*ZkConfig)}
+	dataDirs := make(map[string]string)
+	for cell, cmdLine := range def {
+		if cell == "" || strings.ContainsAny(cell, "-/") {
+			return nil, fmt.Errorf("invalid cell name %q", cell)
+		}
+		servers, global, err := parseZkServers(cmdLine)
+		if err != nil {
+			return nil, fmt.Errorf("cell %v: %v", cell, err)
+		}
+		if global != (cell == "global") {
+			return nil, fmt.Errorf("cell %v: only the global cell has server ids over 1000", cell)
+		}
+		for _, server := range servers {
+			if server.ServerId < 1 || server.ServerId > 255 {
+				return nil, fmt.Errorf("cell %v: server id %v is not in 1-255", cell, server.ServerId)
+			}
+			config := NewZkConfig()
+			config.ServerId = server.ServerId
+			config.ClientPort = server.ClientPort
+			config.Servers = servers
+			config.Global = global
+			if other, ok := dataDirs[config.DataDir()]; ok {
+				if other == cell {
+					return nil, fmt.Errorf("cell %v has server id %v twice", cell, config.ServerId)
+				}
+				return nil, fmt.Errorf("cells %v and %v both have server id %v", other, cell, config.ServerId)
+			}
+			dataDirs[config.DataDir()] = cell
+			zc.servers[cell] = append(zc.servers[cell], config)
+		}
+		zc.cells = append(zc.cells, cell)
+	}
+	if len(zc.cells) == 0 {
+		return nil, errors.New("no cell in the cluster definition")
+	}
+	sort.Strings(zc.cells)
+	return zc, nil
+}
+
+// ReadZkClusterFile reads the cluster definition of file.
+func ReadZkClusterFile(file string) (*ZkCluster, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var def map[string]string
+	if err := json.Unmarshal(data, &def); err != nil {
+		return nil, fmt.Errorf("cannot parse cluster definition %v: %v", file, err)
+	}
+	return NewZkCluster(def)
+}
+
+// Cells returns the sorted cells of the cluster.
+func (zc *ZkCluster) Cells() []string {
+	return zc.cells
+}
+
+// ClientConfig returns the addresses of the servers of each cell, in
+// the format of the ZK_CLIENT_CONFIG file.
+func (zc *ZkCluster) ClientConfig() map[string]string {
+	config := make(map[string]string, len(zc.cells))
+	for _, cell := range zc.cells {
+		config[cell] = clientAddrs(zc.servers[cell])
+	}
+	return config
+}
+
+// WriteClientConfig writes ClientConfig to file, for the other
+// binaries to use it as their ZK_CLIENT_CONFIG.
+func (zc *ZkCluster) WriteClientConfig(file string) error {
+	data, err := json.MarshalIndent(zc.ClientConfig(), "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(path.Dir(file), 0775); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, append(data, '\n'), 0664)
+}
+
+// Init writes the config of all the servers, starts the ones that are
+// not running, waits for each cell to have a quorum, creates the
+// vitess root paths of each cell, and writes the client config to
+// clientConfigFile.
+func (zc *ZkCluster) Init(clientConfigFile string) error {
+	for _, cell := range zc.cells {
+		for _, config := range zc.servers[cell] {
+			zkd := NewZkd(config)
+			if err := zkd.writeConfig(); err != nil {
+				return err
+			}
+			if connected, _ := zkd.ruok(); connected {
+				log.Infof("zk server %v of cell %v is already running", config.ServerId, cell)
+				continue
+			}
+			log.Infof("starting zk server %v of cell %v", config.ServerId, cell)
+			if err := zkd.Start(); err != nil {
+				return fmt.Errorf("cannot start zk server %v of cell %v, check %v: %v", config.ServerId, cell, config.LogDir(), err)
+			}
+		}
+	}
+
+	// all the servers have to be started to get the quorums
+	for _, cell := range zc.cells {
+		if err := zc.initCell(cell); err != nil {
+			return fmt.Errorf("cell %v: %v", cell, err)
+		}
+	}
+	return zc.WriteClientConfig(clientConfigFile)
+}
+
+// initCell waits for the quorum of cell, and creates its root paths.
+func (zc *ZkCluster) initCell(cell string) error {
+	zkAddr := clientAddrs(zc.servers[cell])
+	zconn, session, err := zookeeper.Dial(zkAddr, StartWaitTime*time.Second)
+	if err != nil {
+		return err
+	}
+	defer zconn.Close()
+	timer := time.NewTimer(StartWaitTime * time.Second)
+	defer timer.Stop()
+	select {
+	case event := <-session:
+		if event.State != zookeeper.STATE_CONNECTED {
+			return fmt.Errorf("cannot connect to %v: %v", zkAddr, event)
+		}
+	case <-timer.C:
+		return fmt.Errorf("no quorum for %v after %vs", zkAddr, StartWaitTime)
+	}
+
+	for _, zkPath := range rootPaths(cell) {
+		_, err := zconn.Create(zkPath, "", 0, zookeeper.WorldACL(zookeeper.PERM_ALL))
+		if err != nil && !zookeeper.IsError(err, zookeeper.ZNODEEXISTS) {
+			return fmt.Errorf("cannot create %v: %v", zkPath, err)
+		}
+	}
+	log.Infof("cell %v is up on %v", cell, zkAddr)
+	return nil
+}
+
+// Teardown stops the servers that are running, and removes their
+// directories if wipe is true.
+func (zc *ZkCluster) Teardown(wipe bool) error {
+	var lastErr error
+	for _, cell := range zc.cells {
+		for _, config := range zc.servers[cell] {
+			zkd := NewZkd(config)
+			if isRunning(config.PidFile()) {
+				log.Infof("stopping zk server %v of cell %v", config.ServerId, cell)
+				if err := zkd.Shutdown(); err != nil {
+					log.Errorf("failed stopping zk server %v of cell %v: %v", config.ServerId, cell, err)
+					lastErr = err
+					continue
+				}
+			}
+			if !wipe {
+				continue
+			}
+			for _, dir := range config.DirectoryList() {
+				if err := os.RemoveAll(dir); err != nil {
+					log.Errorf("failed removing %v: %v", dir, err)
+					lastErr = err
+				}
+			}
+		}
+	}
+	return lastErr
+}
+
+// rootPaths are the paths Init creates in cell.
+func rootPaths(cell string) []string {
+	return []string{"/zk", "/zk/" + cell, "/zk/" + cell + "/vt"}
+}
+
+// clientAddrs returns the client addresses of servers.
+func clientAddrs(servers []*ZkConfig) string {
+	addrs := make([]string, len(servers))
+	for i, config := range servers {
+		for _, server := range config.Servers {
+			if server.ServerId == config.ServerId {
+				addrs[i] = fmt.Sprintf("%v:%v", server.Hostname, server.ClientPort)
+			}
+		}
+	}
+	return strings.Join(addrs, ",")
+}
+
+// isRunning returns true if the process of pidFile is running.
+func isRunning(pidFile string) bool {
+	data, err := ioutil.ReadFile(pidFile)
+	if err != nil {
+		return false
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return false
+	}
+	return syscall.Kill(pid, 0) == nil
+}
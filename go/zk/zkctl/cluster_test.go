@@ -0,0 +1,184 @@
+// Copyright 2015, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zkctl
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var testClusterDef = map[string]string{
+	"test_nj": "1@localhost:28882:38882:21812,2@localhost:28883:38883:21813,3@localhost:28884:38884:21814",
+	"global":  "1001@localhost:28881:38881:21811",
+}
+
+// setTestRoots points VTROOT to a directory with the zoo.cfg template,
+// and VTDATAROOT to an empty one. The returned function restores them.
+func setTestRoots(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "zkctl_cluster_test")
+	if err != nil {
+		t.Fatalf("TempDir failed: %v", err)
+	}
+	template := "dataDir={{.DataDir}}\nclientPort={{.ClientPort}}\n{{range .Servers}}server.{{.ServerId}}={{.Hostname}}:{{.LeaderPort}}:{{.ElectionPort}}\n{{end}}"
+	if err := os.MkdirAll(path.Join(dir, "root/config/zkcfg"), 0755); err != nil {
+		t.Fatalf("MkdirAll failed: %v", err)
+	}
+	if err := ioutil.WriteFile(path.Join(dir, "root/config/zkcfg/zoo.cfg"), []byte(template), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	vtRoot, vtDataRoot := os.Getenv("VTROOT"), os.Getenv("VTDATAROOT")
+	os.Setenv("VTROOT", path.Join(dir, "root"))
+	os.Setenv("VTDATAROOT", path.Join(dir, "data"))
+	return path.Join(dir, "data"), func() {
+		os.Setenv("VTROOT", vtRoot)
+		os.Setenv("VTDATAROOT", vtDataRoot)
+		os.RemoveAll(dir)
+	}
+}
+
+func TestNewZkCluster(t *testing.T) {
+	zc, err := NewZkCluster(testClusterDef)
+	if err != nil {
+		t.Fatalf("NewZkCluster failed: %v", err)
+	}
+	if got, want := zc.Cells(), []string{"global", "test_nj"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Cells() = %v, want %v", got, want)
+	}
+	want := map[string]string{
+		"global":  "localhost:21811",
+		"test_nj": "localhost:21812,localhost:21813,localhost:21814",
+	}
+	if got := zc.ClientConfig(); !reflect.DeepEqual(got, want) {
+		t.Errorf("ClientConfig() = %v, want %v", got, want)
+	}
+
+	for _, c := range []struct {
+		def  map[string]string
+		want string
+	}{
+		{map[string]string{}, "no cell"},
+		{map[string]string{"test-nj": "1@localhost"}, "invalid cell name"},
+		{map[string]string{"test_nj": "localhost"}, "bad command line format"},
+		{map[string]string{"global": "1@localhost"}, "only the global cell"},
+		{map[string]string{"test_nj": "1001@localhost"}, "only the global cell"},
+		{map[string]string{"test_nj": "300@localhost"}, "not in 1-255"},
+		{map[string]string{"test_nj": "1@localhost:1:2:3,1@localhost:4:5:6"}, "server id 1 twice"},
+		{map[string]string{"test_nj": "1@localhost", "test_ny": "1@localhost"}, "both have server id 1"},
+	} {
+		if _, err := NewZkCluster(c.def); err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("NewZkCluster(%v) = %v, want an error with %q", c.def, err, c.want)
+		}
+	}
+	// the global servers don't share the directories of the cells
+	if _, err := NewZkCluster(map[string]string{"global": "1001@localhost:1:2:3", "test_nj": "1@localhost:4:5:6"}); err != nil {
+		t.Errorf("NewZkCluster with the same ids for the global cell failed: %v", err)
+	}
+}
+
+func TestZkClusterConfig(t *testing.T) {
+	dataRoot, restore := setTestRoots(t)
+	defer restore()
+	zc, err := NewZkCluster(testClusterDef)
+	if err != nil {
+		t.Fatalf("NewZkCluster failed: %v", err)
+	}
+
+	// the config of the servers can be written again
+	for i := 0; i < 2; i++ {
+		for _, config := range zc.servers["test_nj"] {
+			if err := NewZkd(config).writeConfig(); err != nil {
+				t.Fatalf("writeConfig failed: %v", err)
+			}
+		}
+	}
+	myid, err := ioutil.ReadFile(path.Join(dataRoot, "zk_002/myid"))
+	if err != nil || string(myid) != "2" {
+		t.Errorf("myid of server 2 = %q, %v, want 2", myid, err)
+	}
+	cfg, err := ioutil.ReadFile(path.Join(dataRoot, "zk_002/zoo.cfg"))
+	if err != nil {
+		t.Fatalf("cannot read zoo.cfg: %v", err)
+	}
+	for _, want := range []string{
+		"dataDir=" + path.Join(dataRoot, "zk_002") + "\n",
+		"clientPort=21813\n",
+		"server.1=localhost:28882:38882\n",
+		"server.3=localhost:28884:38884\n",
+	} {
+		if !strings.Contains(string(cfg), want) {
+			t.Errorf("%q not found in zoo.cfg:\n%v", want, string(cfg))
+		}
+	}
+
+	file := path.Join(dataRoot, "tmp/zk-client-conf.json")
+	if err := zc.WriteClientConfig(file); err != nil {
+		t.Fatalf("WriteClientConfig failed: %v", err)
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatalf("cannot read the client config: %v", err)
+	}
+	var clientConfig map[string]string
+	if err := json.Unmarshal(data, &clientConfig); err != nil || !reflect.DeepEqual(clientConfig, zc.ClientConfig()) {
+		t.Errorf("client config file = %v, %v, want %v", string(data), err, zc.ClientConfig())
+	}
+
+	// without running servers, Teardown only removes the directories
+	for i := 0; i < 2; i++ {
+		if err := zc.Teardown(i == 1); err != nil {
+			t.Errorf("Teardown(%v) failed: %v", i == 1, err)
+		}
+		_, err := os.Stat(path.Join(dataRoot, "zk_002"))
+		if exists := err == nil; exists != (i == 0) {
+			t.Errorf("after Teardown(%v), zk_002 exists is %v", i == 1, exists)
+		}
+	}
+}
+
+// TestLifeCycleCluster starts a cluster, like TestLifeCycle, and checks
+// Init and Teardown can be run again.
+func TestLifeCycleCluster(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode.")
+	}
+
+	currentVtDataRoot := os.Getenv("VTDATAROOT")
+	vtDataRoot, err := ioutil.TempDir("", "VTDATAROOT")
+	if err != nil {
+		t.Fatalf("cannot create VTDATAROOT directory: %v", err)
+	}
+	defer os.RemoveAll(vtDataRoot)
+	os.Setenv("VTDATAROOT", vtDataRoot)
+	defer os.Setenv("VTDATAROOT", currentVtDataRoot)
+
+	zc, err := NewZkCluster(testClusterDef)
+	if err != nil {
+		t.Fatalf("NewZkCluster failed: %v", err)
+	}
+	clientConfig := path.Join(vtDataRoot, "zk-client-conf.json")
+	defer zc.Teardown(true)
+	for i := 0; i < 2; i++ {
+		if err := zc.Init(clientConfig); err != nil {
+			t.Fatalf("Init() err: %v", err)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		if err := zc.Teardown(false); err != nil {
+			t.Fatalf("Teardown(false) err: %v", err)
+		}
+	}
+	// it restarts with its data
+	if err := zc.Init(clientConfig); err != nil {
+		t.Fatalf("Init() err: %v", err)
+	}
+	if err := zc.Teardown(true); err != nil {
+		t.Fatalf("Teardown(true) err: %v", err)
+	}
+}
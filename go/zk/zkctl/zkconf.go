@@ -124,20 +124,45 @@ const GUESS_MYID = 0
   server_id's must be 1-255, global id's are 1001-1255 mod 1000.
 */
 func MakeZkConfigFromString(cmdLine string, myId uint32) *ZkConfig {
+	servers, global, err := parseZkServers(cmdLine)
+	if err != nil {
+		panic(err)
+	}
 	zkConfig := NewZkConfig()
+	zkConfig.Servers = servers
+	zkConfig.Global = global
+	myId = myId % 1000
+	hostname := netutil.FullyQualifiedHostnameOrPanic()
+	for _, zkServer := range zkConfig.Servers {
+		if (myId > 0 && myId == zkServer.ServerId) || (myId == 0 && zkServer.Hostname == hostname) {
+			zkConfig.ServerId = zkServer.ServerId
+			zkConfig.ClientPort = zkServer.ClientPort
+			break
+		}
+	}
+	if zkConfig.ServerId == 0 {
+		panic(fmt.Errorf("no zk server found for host %v in config %v", hostname, cmdLine))
+	}
+	return zkConfig
+}
+
+// parseZkServers parses the servers of a zk config string, and returns
+// true if they are a global quorum.
+func parseZkServers(cmdLine string) ([]zkServerAddr, bool, error) {
+	var servers []zkServerAddr
+	global := false
 	for _, zki := range strings.Split(cmdLine, ",") {
 		zkiParts := strings.SplitN(zki, "@", 2)
 		if len(zkiParts) != 2 {
-			panic("bad command line format for zk config")
+			return nil, false, fmt.Errorf("bad command line format for zk config")
 		}
 		zkId := zkiParts[0]
 		zkAddrParts := strings.Split(zkiParts[1], ":")
 		serverId, _ := strconv.ParseUint(zkId, 10, 0)
 		if serverId > 1000 {
 			serverId = serverId % 1000
-			zkConfig.Global = true
+			global = true
 		}
-		myId = myId % 1000
 
 		zkServer := zkServerAddr{ServerId: uint32(serverId), ClientPort: 2181,
 			LeaderPort: 2888, ElectionPort: 3888}
@@ -157,20 +182,9 @@ func MakeZkConfigFromString(cmdLine string, myId uint32) *ZkConfig {
 			// 	panic(fmt.Errorf("expected fully qualified hostname: %v", zkServer.Hostname))
 			// }
 		default:
-			panic(fmt.Errorf("bad command line format for zk config"))
-		}
-		zkConfig.Servers = append(zkConfig.Servers, zkServer)
-	}
-	hostname := netutil.FullyQualifiedHostnameOrPanic()
-	for _, zkServer := range zkConfig.Servers {
-		if (myId > 0 && myId == zkServer.ServerId) || (myId == 0 && zkServer.Hostname == hostname) {
-			zkConfig.ServerId = zkServer.ServerId
-			zkConfig.ClientPort = zkServer.ClientPort
-			break
+			return nil, false, fmt.Errorf("bad command line format for zk config")
 		}
+		servers = append(servers, zkServer)
 	}
-	if zkConfig.ServerId == 0 {
-		panic(fmt.Errorf("no zk server found for host %v in config %v", hostname, cmdLine))
-	}
-	return zkConfig
+	return servers, global, nil
 }
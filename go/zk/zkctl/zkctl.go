@@ -86,23 +86,11 @@ func (zkd *Zkd) Start() error {
 	// give it some time to succeed - usually by the time the socket emerges
 	// we are in good shape
 	for i := 0; i < StartWaitTime; i++ {
-		zkAddr := fmt.Sprintf(":%v", zkd.config.ClientPort)
-		conn, connErr := net.Dial("tcp", zkAddr)
-		if connErr != nil {
-			err = connErr
-			time.Sleep(time.Second)
-			continue
-		} else {
-			err = nil
-			conn.Write([]byte("ruok"))
-			reply := make([]byte, 4)
-			conn.Read(reply)
-			if string(reply) != "imok" {
-				err = fmt.Errorf("local zk unhealthy: %v %v", zkAddr, reply)
-			}
-			conn.Close()
+		var connected bool
+		if connected, err = zkd.ruok(); connected {
 			break
 		}
+		time.Sleep(time.Second)
 	}
 	zkd.done = make(chan struct{})
 	go func(done chan<- struct{}) {
@@ -113,6 +101,24 @@ func (zkd *Zkd) Start() error {
 	return err
 }
 
+// ruok asks the local server if it is ok. connected is true if it
+// answered, even if it is not ok.
+func (zkd *Zkd) ruok() (connected bool, err error) {
+	zkAddr := fmt.Sprintf(":%v", zkd.config.ClientPort)
+	conn, err := net.Dial("tcp", zkAddr)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+	conn.Write([]byte("ruok"))
+	reply := make([]byte, 4)
+	conn.Read(reply)
+	if string(reply) != "imok" {
+		return true, fmt.Errorf("local zk unhealthy: %v %v", zkAddr, reply)
+	}
+	return true, nil
+}
+
 func (zkd *Zkd) Shutdown() error {
 	log.Infof("zkctl.Shutdown")
 	pidData, err := ioutil.ReadFile(zkd.config.PidFile())
@@ -129,7 +135,9 @@ func (zkd *Zkd) Shutdown() error {
 	}
 	for i := 0; i < ShutdownWaitTime; i++ {
 		if syscall.Kill(pid, syscall.SIGKILL) == syscall.ESRCH {
-			return nil
+			// so a later Shutdown doesn't kill another process
+			// with the same pid
+			return os.Remove(zkd.config.PidFile())
 		}
 		time.Sleep(time.Second)
 	}
@@ -183,30 +191,11 @@ func (zkd *Zkd) Reinit(preserveData bool) (err error) {
 
 func (zkd *Zkd) init(preserveData bool) error {
 	log.Infof("zkd.Init")
-	for _, path := range zkd.config.DirectoryList() {
-		if err := os.MkdirAll(path, 0775); err != nil {
-			log.Errorf(err.Error())
-			return err
-		}
-		// FIXME(msolomon) validate permissions?
-	}
-
-	configData, err := zkd.makeCfg()
-	if err == nil {
-		err = ioutil.WriteFile(zkd.config.ConfigFile(), []byte(configData), 0664)
-	}
-	if err != nil {
-		log.Errorf("failed creating %v: %v", zkd.config.ConfigFile(), err)
+	if err := zkd.writeConfig(); err != nil {
 		return err
 	}
 
-	err = zkd.config.WriteMyid()
-	if err != nil {
-		log.Errorf("failed creating %v: %v", zkd.config.MyidFile(), err)
-		return err
-	}
-
-	if err = zkd.Start(); err != nil {
+	if err := zkd.Start(); err != nil {
 		log.Errorf("failed starting, check %v", zkd.config.LogDir())
 		return err
 	}
@@ -239,6 +228,34 @@ func (zkd *Zkd) init(preserveData bool) error {
 	return nil
 }
 
+// writeConfig creates the directories, zoo.cfg and myid files of
+// the server.
+func (zkd *Zkd) writeConfig() error {
+	for _, path := range zkd.config.DirectoryList() {
+		if err := os.MkdirAll(path, 0775); err != nil {
+			log.Errorf(err.Error())
+			return err
+		}
+		// FIXME(msolomon) validate permissions?
+	}
+
+	configData, err := zkd.makeCfg()
+	if err == nil {
+		err = ioutil.WriteFile(zkd.config.ConfigFile(), []byte(configData), 0664)
+	}
+	if err != nil {
+		log.Errorf("failed creating %v: %v", zkd.config.ConfigFile(), err)
+		return err
+	}
+
+	err = zkd.config.WriteMyid()
+	if err != nil {
+		log.Errorf("failed creating %v: %v", zkd.config.MyidFile(), err)
+		return err
+	}
+	return nil
+}
+
 func (zkd *Zkd) Teardown() error {
 	log.Infof("zkctl.Teardown")
 	if err := zkd.Shutdown(); err != nil {
@@ -190,11 +190,17 @@ class TestSharded(unittest.TestCase):
     # we created the schema differently, so it should show
     utils.run_vtctl(['ValidateSchemaShard', 'test_keyspace/-80'])
     utils.run_vtctl(['ValidateSchemaShard', 'test_keyspace/80-'])
+    # (the replica of the second shard matches its master)
     out, err = utils.run_vtctl(['ValidateSchemaKeyspace', 'test_keyspace'],
                                trap_output=True, raise_on_error=False)
-    if 'test_nj-0000062344 and test_nj-0000062346 disagree on schema for table vt_select_test:\nCREATE TABLE' not in err or \
-       'test_nj-0000062344 and test_nj-0000062347 disagree on schema for table vt_select_test:\nCREATE TABLE' not in err:
+    if 'test_nj-0000062346 differs from test_nj-0000062344: vt_select_test (schema differs)' not in err or \
+       'test_nj-0000062347' in err:
       self.fail('wrong ValidateSchemaKeyspace output: ' + err)
+    out, err = utils.run_vtctl(['ValidateSchemaKeyspace', '-verbose',
+                                'test_keyspace'],
+                               trap_output=True, raise_on_error=False)
+    if 'test_nj-0000062344 and test_nj-0000062346 disagree on schema for table vt_select_test:\nCREATE TABLE' not in err:
+      self.fail('wrong ValidateSchemaKeyspace -verbose output: ' + err)
 
     # validate versions
     utils.run_vtctl(['ValidateVersionShard', 'test_keyspace/-80'],
@@ -472,7 +472,7 @@ class Tablet(object):
       self.tablet_type = target_tablet_type
       args.extend(['-target_tablet_type', target_tablet_type,
                    '-health_check_interval', '2s',
-                   '-enable_replication_lag_check',
+                   '-enable_replication_reporter',
                    '-degraded_threshold', '5s'])
 
     # this is used to run InitTablet as part of the vttablet startup
@@ -483,7 +483,8 @@ class Tablet(object):
       self.keyspace = init_keyspace
       self.shard = init_shard
       args.extend(['-init_keyspace', init_keyspace,
-                   '-init_shard', init_shard])
+                   '-init_shard', init_shard,
+                   '-init_populate_metadata'])
       if init_db_name_override:
         self.dbname = init_db_name_override
         args.extend(['-init_db_name_override', init_db_name_override])